@@ -0,0 +1,769 @@
+// Package app runs the alert service. Its main package and the end-to-end
+// tests start it through Run.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"alert-service/internal/api"
+	"alert-service/internal/config"
+	"alert-service/internal/dlq"
+	"alert-service/internal/enrichment"
+	"alert-service/internal/evaluator"
+	"alert-service/internal/handler"
+	"alert-service/internal/incidents"
+	"alert-service/internal/limiter"
+	"alert-service/internal/maintenance"
+	"alert-service/internal/metrics"
+	"alert-service/internal/middleware"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/retention"
+	"alert-service/internal/schema"
+	"alert-service/internal/storage"
+	"alert-service/internal/stream"
+	"alert-service/internal/templates"
+	"alert-service/internal/watchlist"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/startup"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config is the configuration of the service
+type Config = config.Config
+
+// LoadConfig loads the configuration from the environment and validates it
+func LoadConfig() (*Config, error) {
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Run waits for the dependencies of cfg, consumes the input topics and
+// serves the API until ctx is done or the process is signalled, then shuts
+// them down in order. It returns the errors of a failed start or an unclean
+// shutdown.
+func Run(ctx context.Context, cfg *Config) error {
+	logger := slog.Default()
+	metrics.SetTenants(cfg.AllowedTenants)
+
+	// Load message templates
+	renderer, err := loadRenderer(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Components register as they are created, to be stopped in order on
+	// shutdown
+	lc := lifecycle.New(time.Duration(cfg.ShutdownDeadline)*time.Second, logger)
+
+	// Build the Kafka connection settings, failing on bad TLS or SASL config
+	kafkaConn, err := cfg.KafkaSecurity.Connect()
+	if err != nil {
+		return fmt.Errorf("invalid kafka security config: %w", err)
+	}
+	log.Printf("kafka security: %s", cfg.KafkaSecurity)
+
+	// Wait for the database and Kafka, which may still be starting
+	err = startup.Wait(ctx, time.Duration(cfg.StartupTimeout)*time.Second, logger,
+		startup.Check{Name: "postgres", Probe: func(ctx context.Context) error {
+			return storage.PingDatabase(ctx, cfg.DBUrl)
+		}},
+		startup.Check{Name: "kafka", Probe: func(ctx context.Context) error {
+			return kafkaConn.Ping(ctx, consumer.ParseBrokers(cfg.KafkaBrokers))
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	// Create the topics the service produces to with their partitions,
+	// replication and retention, when provisioning is enabled
+	provisionCtx, cancelProvision := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout)*time.Second)
+	err = cfg.KafkaTopics.ProvisionTopics(provisionCtx, kafkaConn, consumer.ParseBrokers(cfg.KafkaBrokers), cfg.OutputTopics(), logger)
+	cancelProvision()
+	if err != nil {
+		return fmt.Errorf("failed to provision Kafka topics: %w", err)
+	}
+
+	// Connect DB
+	store, err := storage.NewStorage(cfg.DBUrl)
+	if err != nil {
+		return fmt.Errorf("failed to connect database: %w", err)
+	}
+	lc.Add(lifecycle.Closer("database", lifecycle.Stores, store.Close))
+
+	// Setup digest, buffered in Redis when it is available
+	redisClient := newRedisClient(cfg)
+	if redisClient != nil {
+		lc.Add(lifecycle.Closer("redis", lifecycle.Stores, redisClient.Close))
+	}
+	digest := notifier.NewDigest(redisClient, newDigestNotifier(cfg, renderer))
+
+	// Setup notification routing
+	retry := notifier.RetryPolicy{
+		MaxRetries: cfg.MaxRetries,
+		Backoff:    time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		Timeout:    time.Duration(cfg.NotifyTimeout) * time.Second,
+	}
+	routing, err := loadRoutingPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	dispatcher, err := notifier.NewDispatcher(routing, newSenderFactory(cfg, digest, notifier.NewSMSBudget(redisClient, cfg.SMSMaxPerHour), renderer), retry)
+	if err != nil {
+		return fmt.Errorf("invalid routing policy: %w", err)
+	}
+
+	// Setup dead letter queue for deliveries that exhaust their retries
+	deadLetters := dlq.NewQueue(cfg.KafkaBrokers, cfg.ConsumerGroup+"-dlq", cfg.DLQTopic, kafkaConn, dispatcher, store, retry.Backoff)
+	lc.Add(lifecycle.Closer("dead letter queue", lifecycle.Producers, deadLetters.Close))
+
+	// Setup quarantine for input messages of unknown schema versions
+	quarantine := schema.NewQuarantine(cfg.KafkaBrokers, cfg.QuarantineTopic, kafkaConn)
+	lc.Add(lifecycle.Closer("quarantine", lifecycle.Producers, quarantine.Close))
+
+	// Setup maintenance windows and quiet hours
+	maintenanceManager, err := newMaintenanceManager(cfg, store, renderer)
+	if err != nil {
+		return err
+	}
+
+	// Setup the live alert stream, shared through Redis when it is available
+	broker := stream.NewBroker(redisClient, cfg.StreamReplaySize)
+
+	// Setup the watchlist, its lookups cached in Redis when it is available
+	accountWatchlist := newWatchlist(cfg, store, redisClient)
+
+	// Convert amounts into the base currency of the amount threshold
+	rates, err := loadExchangeRates(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Slack threads of alerts are replied in through the bot, when there is
+	// one
+	var slackThreads *notifier.Notifier
+	if cfg.SlackBotToken != "" {
+		slackThreads = notifier.NewBotNotifier(cfg.SlackBotToken, cfg.SlackChannel, renderer)
+	}
+
+	// Initialize handler
+	rules, err := loadRuleEngine(ctx, cfg, store)
+	if err != nil {
+		return err
+	}
+	severityPolicy, err := loadSeverityPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	alertHandler := handler.NewAlertHandler(
+		rules,
+		evaluator.NewThresholdEvaluator(cfg.RiskThreshold, cfg.AmountThreshold, rates, cfg.BaseCurrency),
+		severityPolicy,
+		dispatcher,
+		deadLetters,
+		quarantine,
+		newAccountLimiter(cfg, redisClient),
+		maintenanceManager,
+		store,
+		broker,
+		accountWatchlist,
+		newEnricher(cfg, store, redisClient),
+		newCorrelator(cfg, store, slackThreads),
+	)
+
+	// Setup a Kafka consumer per input topic, all feeding the handler.
+	// Messages that do not decode, and the stubs of those too large to
+	// fetch, are parked on the input dead letter topic.
+	consumers := make([]*consumer.Consumer, len(cfg.InputTopics))
+	for i, topic := range cfg.InputTopics {
+		consumers[i] = consumer.New(consumer.Config{
+			Brokers:         cfg.KafkaBrokers,
+			GroupID:         cfg.ConsumerGroup,
+			Topic:           topic,
+			Dialer:          kafkaConn.Dialer,
+			Transport:       kafkaConn.Transport,
+			BatchSize:       cfg.BatchSize,
+			Workers:         cfg.ConsumerWorkers,
+			Backoff:         retry.Backoff,
+			DeadLetterTopic: cfg.InputDLQTopic,
+			DrainTimeout:    time.Duration(cfg.ShutdownTimeout) * time.Second,
+			Metrics:         metrics.ConsumerMetrics{Topic: topic},
+			Logger:          logger,
+			LogSampleRate:   cfg.LogSampleRate,
+		}, alertHandler)
+		lc.Add(lifecycle.Closer(topic+" kafka consumer", lifecycle.Consumers, consumers[i].Close))
+	}
+
+	// Start HTTP API server
+	var pagerDuty *notifier.PagerDutySender
+	if cfg.EnablePagerDuty {
+		pagerDuty = notifier.NewPagerDutySender(cfg.PagerDutyRoutingKey, renderer)
+	}
+	jwtManager := auth.NewJWTManager(cfg.JWTKeyID, cfg.JWTSecret, cfg.JWTPreviousSecrets)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager)
+	server := &http.Server{
+		Addr:         ":" + cfg.HTTPPort,
+		Handler:      api.NewServer(store, dispatcher, slackThreads, pagerDuty, maintenanceManager, broker, accountWatchlist, cfg.SlackSigningSecret, authMiddleware).Router(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	// End alert streams on shutdown, or they would hold it up
+	server.RegisterOnShutdown(broker.Close)
+	log.Printf("Alert API running on port %s", cfg.HTTPPort)
+	lc.Add(lifecycle.Server("http server", server))
+
+	// Start metrics server if enabled, with consumer pause and resume when an
+	// admin token is set
+	if cfg.MetricsEnabled {
+		var admin http.Handler
+		if cfg.AdminToken != "" {
+			admin = consumerAdmin(cfg.InputTopics, consumers, cfg.AdminToken)
+		}
+		log.Printf("Starting metrics server on port %s", cfg.MetricsPort)
+		lc.Add(lifecycle.Server("metrics server", newMetricsServer(cfg.MetricsPort, admin, map[string]func(context.Context) error{
+			"kafka": func(ctx context.Context) error {
+				for i, cons := range consumers {
+					if err := cons.Ready(ctx); err != nil {
+						return fmt.Errorf("%s: %w", cfg.InputTopics[i], err)
+					}
+				}
+				return nil
+			},
+			"postgres": store.Ping,
+		})))
+	}
+
+	// Run the consumers. They stop before the background jobs, so alerts
+	// they are still handling can reach the digest and dead letter queue;
+	// each gives up on them after ShutdownTimeout.
+	for i, cons := range consumers {
+		lc.Add(lifecycle.Component{Name: cfg.InputTopics[i] + " consumer", Group: lifecycle.Consumers, Start: cons.Start})
+	}
+
+	// Reload rotated secrets
+	watchSecrets(lc, cfg, jwtManager, store)
+
+	// Redeliver parked alerts as their channels recover
+	lc.Add(lifecycle.Background("dead letter redelivery", func(ctx context.Context) {
+		if err := deadLetters.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("dead letter queue error: %v", err)
+		}
+	}))
+
+	// Relay alerts raised by every instance to this instance's stream clients
+	lc.Add(lifecycle.Background("alert stream relay", func(ctx context.Context) {
+		if err := broker.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("alert stream error: %v", err)
+		}
+	}))
+
+	// Keep the exchange rates up to date with the provider
+	if cfg.ExchangeRatesURL != "" {
+		lc.Add(lifecycle.Background("exchange rates refresh", func(ctx context.Context) {
+			rates.Run(ctx, cfg.ExchangeRatesURL, time.Duration(cfg.ExchangeRatesRefresh)*time.Minute)
+		}))
+	}
+
+	// Reload table rules as they change
+	if cfg.AlertRulesFile == "" {
+		lc.Add(lifecycle.Background("alert rules reload", func(ctx context.Context) {
+			watchRules(ctx, cfg, rules, store)
+		}))
+	}
+
+	// Refresh maintenance windows and summarize the ones that closed
+	refresh := time.Duration(cfg.MaintenanceRefresh) * time.Second
+	if refresh <= 0 {
+		refresh = 30 * time.Second
+	}
+	maintenanceTicker := time.NewTicker(refresh)
+	defer maintenanceTicker.Stop()
+	lc.Add(lifecycle.Background("maintenance windows", func(ctx context.Context) {
+		maintenanceManager.Run(ctx, maintenanceTicker.C)
+	}))
+
+	// Archive and delete resolved alerts past their retention, and report
+	// the open ones left for too long
+	retentionTicker := time.NewTicker(time.Duration(cfg.RetentionInterval) * time.Minute)
+	defer retentionTicker.Stop()
+	retentionJob := newRetentionJob(cfg, store, renderer)
+	lc.Add(lifecycle.Background("retention", func(ctx context.Context) {
+		retentionJob.Run(ctx, retentionTicker.C)
+	}))
+
+	// Post the digest periodically, and a final one on shutdown
+	if cfg.DigestInterval > 0 {
+		ticker := time.NewTicker(time.Duration(cfg.DigestInterval) * time.Minute)
+		defer ticker.Stop()
+		lc.Add(lifecycle.Background("digest", func(ctx context.Context) {
+			digest.Run(ctx, ticker.C)
+		}))
+	}
+
+	return lc.Run(ctx)
+}
+
+// newRedisClient connects to Redis, returning nil when it is unavailable
+func newRedisClient(cfg *config.Config) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Warning: Redis not available, digest kept in memory: %v", err)
+		client.Close()
+		return nil
+	}
+	return client
+}
+
+// newAccountLimiter returns the per-account alert rate limiter, or nil when
+// FrequencyThreshold disables it
+func newAccountLimiter(cfg *config.Config, redisClient *redis.Client) *limiter.AccountLimiter {
+	if cfg.FrequencyThreshold <= 0 {
+		return nil
+	}
+	return limiter.NewAccountLimiter(redisClient, cfg.FrequencyThreshold, cfg.RateLimitBypassCritical)
+}
+
+// newCorrelator returns the incident correlator, or nil when correlation is
+// disabled. Follow-up alerts are replied in Slack threads only with a bot.
+func newCorrelator(cfg *config.Config, store *storage.Storage, slack *notifier.Notifier) *incidents.Correlator {
+	if cfg.IncidentCorrelation == models.CorrelateNone {
+		return nil
+	}
+	var threads incidents.Threader
+	if slack != nil {
+		threads = slack
+	}
+	return incidents.New(store, threads, incidents.Config{
+		Key:    cfg.IncidentCorrelation,
+		Window: time.Duration(cfg.IncidentWindow) * time.Minute,
+	})
+}
+
+// newWatchlist returns the watchlist rule, or nil when it is disabled
+func newWatchlist(cfg *config.Config, store *storage.Storage, redisClient *redis.Client) *watchlist.Watchlist {
+	if !cfg.WatchlistEnabled {
+		return nil
+	}
+	return watchlist.New(store, redisClient, watchlist.Config{
+		Severity:        cfg.WatchlistSeverity,
+		BypassRateLimit: cfg.WatchlistBypassRateLimit,
+		CacheTTL:        time.Duration(cfg.WatchlistCacheTTL) * time.Second,
+	})
+}
+
+// loadExchangeRates returns a converter with the rates of the exchange rates
+// file, or the built-in rates without one
+func loadExchangeRates(cfg *config.Config) (*currency.Converter, error) {
+	rates, err := currency.LoadConverter(cfg.ExchangeRatesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+	log.Printf("Converting amounts to %s with exchange rates as of %s", cfg.BaseCurrency, rates.Rates().AsOf.Format(time.RFC3339))
+	return rates, nil
+}
+
+// newEnricher returns the account context enricher, or nil when no storage
+// API is configured
+func newEnricher(cfg *config.Config, store *storage.Storage, redisClient *redis.Client) *enrichment.Enricher {
+	if cfg.StorageAPIURL == "" {
+		return nil
+	}
+	return enrichment.New(
+		enrichment.NewStorageClient(cfg.StorageAPIURL, cfg.StorageAPIToken, cfg.EnrichmentWindowDays),
+		store, redisClient,
+		enrichment.Config{
+			Timeout:    time.Duration(cfg.EnrichmentTimeout) * time.Millisecond,
+			CacheTTL:   time.Duration(cfg.EnrichmentCacheTTL) * time.Second,
+			WindowDays: cfg.EnrichmentWindowDays,
+		})
+}
+
+// newMaintenanceManager builds the maintenance manager from the configured
+// windows and quiet hours, failing on a malformed schedule. Summaries of
+// closed windows are posted to Slack when it is enabled.
+func newMaintenanceManager(cfg *config.Config, store *storage.Storage, renderer *templates.Renderer) (*maintenance.Manager, error) {
+	location, err := time.LoadLocation(cfg.MaintenanceTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance timezone: %w", err)
+	}
+
+	static, err := maintenance.ParseStatic(cfg.MaintenanceWindows, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance windows: %w", err)
+	}
+	quiet, err := maintenance.ParseQuietHours(cfg.QuietHours, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours: %w", err)
+	}
+
+	var poster maintenance.Poster
+	if cfg.EnableSlack {
+		poster = newDigestNotifier(cfg, renderer)
+	}
+	return maintenance.NewManager(store, poster, static, quiet), nil
+}
+
+// newRetentionJob builds the retention job from the configured retention.
+// Stale open alert digests are posted to Slack when it is enabled.
+func newRetentionJob(cfg *config.Config, store *storage.Storage, renderer *templates.Renderer) *retention.Job {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+
+	maxAgeBySeverity := make(map[string]time.Duration, len(cfg.RetentionDaysBySeverity))
+	for severity, n := range cfg.RetentionDaysBySeverity {
+		maxAgeBySeverity[severity] = days(n)
+	}
+
+	var poster retention.Poster
+	if cfg.EnableSlack {
+		poster = newDigestNotifier(cfg, renderer)
+	}
+	if cfg.RetentionDryRun {
+		log.Println("ALERT_RETENTION_DRY_RUN is set, expired alerts are counted but not deleted")
+	}
+	return retention.New(store, poster, retention.Config{
+		MaxAge:           days(cfg.RetentionDays),
+		MaxAgeBySeverity: maxAgeBySeverity,
+		BatchSize:        cfg.RetentionBatchSize,
+		ArchiveDir:       cfg.ArchiveDir,
+		DryRun:           cfg.RetentionDryRun,
+		StaleOpenAge:     days(cfg.StaleOpenAlertDays),
+	})
+}
+
+// newDigestNotifier returns the Slack notifier digests are posted with
+func newDigestNotifier(cfg *config.Config, renderer *templates.Renderer) *notifier.Notifier {
+	if cfg.SlackBotToken != "" {
+		return notifier.NewBotNotifier(cfg.SlackBotToken, cfg.SlackChannel, renderer)
+	}
+	return notifier.NewNotifier(cfg.SlackWebhook, renderer)
+}
+
+// loadRoutingPolicy loads the configured routing policy, defaulting to all
+// enabled channels for every alert. With digests enabled, low and medium
+// severity alerts go to the digest by default instead; with PagerDuty or
+// SMS enabled, critical alerts also page on-call or are texted.
+func loadRoutingPolicy(cfg *config.Config) (*notifier.RoutingPolicy, error) {
+	if cfg.RoutingPolicyFile != "" {
+		policy, err := notifier.LoadRoutingPolicy(cfg.RoutingPolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load routing policy: %w", err)
+		}
+		return policy, nil
+	}
+
+	policy := &notifier.RoutingPolicy{}
+	if cfg.EnableSlack {
+		policy.Default = append(policy.Default, notifier.Destination{Channel: models.ChannelSlack})
+	}
+	if cfg.EnableEmail {
+		policy.Default = append(policy.Default, notifier.Destination{Channel: models.ChannelEmail})
+	}
+	if cfg.EnableWebhook {
+		policy.Default = append(policy.Default, notifier.Destination{Channel: models.ChannelWebhook})
+	}
+	if cfg.EnableConsole {
+		policy.Default = append(policy.Default, notifier.Destination{Channel: models.ChannelConsole})
+	}
+	if cfg.EnableFile {
+		policy.Default = append(policy.Default, notifier.Destination{Channel: models.ChannelFile})
+	}
+	var critical []notifier.Destination
+	if cfg.EnablePagerDuty {
+		critical = append(critical, notifier.Destination{Channel: models.ChannelPagerDuty})
+	}
+	if cfg.EnableSMS {
+		critical = append(critical, notifier.Destination{Channel: models.ChannelSMS})
+	}
+	if len(critical) > 0 {
+		critical = append(critical, policy.Default...)
+		policy.Routes = append(policy.Routes, notifier.Route{Severity: models.SeverityCritical, Destinations: critical})
+	}
+	if cfg.EnableSlack && cfg.DigestInterval > 0 {
+		digest := []notifier.Destination{{Channel: models.ChannelDigest}}
+		policy.Routes = append(policy.Routes,
+			notifier.Route{Severity: models.SeverityLow, Destinations: digest},
+			notifier.Route{Severity: models.SeverityMedium, Destinations: digest},
+		)
+	}
+	return policy, nil
+}
+
+// newSenderFactory builds senders for enabled channels from the config,
+// applying per-destination overrides. Digest destinations share one digest
+// and SMS destinations one hourly budget.
+func newSenderFactory(cfg *config.Config, digest *notifier.Digest, smsBudget *notifier.SMSBudget,
+	renderer *templates.Renderer) notifier.SenderFactory {
+	return func(dest notifier.Destination) (notifier.Sender, error) {
+		switch dest.Channel {
+		case models.ChannelSlack:
+			if !cfg.EnableSlack {
+				return nil, fmt.Errorf("slack is not enabled")
+			}
+			if dest.WebhookURL != "" {
+				return notifier.NewNotifier(dest.WebhookURL, renderer), nil
+			}
+			// A channel with a configured webhook is a logical destination
+			if url, ok := cfg.SlackWebhooks[dest.SlackChannel]; ok {
+				return notifier.NewDestinationNotifier(dest.SlackChannel, url, renderer), nil
+			}
+			if cfg.SlackBotToken != "" {
+				channel := cfg.SlackChannel
+				if dest.SlackChannel != "" {
+					channel = dest.SlackChannel
+				}
+				return notifier.NewBotNotifier(cfg.SlackBotToken, channel, renderer), nil
+			}
+			return notifier.NewTypedNotifier(cfg.SlackWebhooks, cfg.SlackWebhook, renderer), nil
+
+		case models.ChannelEmail:
+			if !cfg.EnableEmail {
+				return nil, fmt.Errorf("email is not enabled")
+			}
+			to := cfg.EmailTo
+			if len(dest.Recipients) > 0 {
+				to = dest.Recipients
+			}
+			return notifier.NewEmailSender(cfg.EmailSMTP, cfg.EmailFrom, cfg.EmailPassword, to, renderer)
+
+		case models.ChannelWebhook:
+			if !cfg.EnableWebhook {
+				return nil, fmt.Errorf("webhook is not enabled")
+			}
+			url := cfg.WebhookURL
+			if dest.WebhookURL != "" {
+				url = dest.WebhookURL
+			}
+			return notifier.NewWebhookSender(url), nil
+
+		case models.ChannelPagerDuty:
+			if !cfg.EnablePagerDuty {
+				return nil, fmt.Errorf("pagerduty is not enabled")
+			}
+			if cfg.PagerDutyRoutingKey == "" {
+				return nil, fmt.Errorf("pagerduty routing key not configured")
+			}
+			return notifier.NewPagerDutySender(cfg.PagerDutyRoutingKey, renderer), nil
+
+		case models.ChannelSMS:
+			if !cfg.EnableSMS {
+				return nil, fmt.Errorf("sms is not enabled")
+			}
+			to := cfg.SMSTo
+			if len(dest.Recipients) > 0 {
+				to = dest.Recipients
+			}
+			return notifier.NewSMSSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.SMSFrom, to, smsBudget, renderer)
+
+		case models.ChannelConsole:
+			if !cfg.EnableConsole {
+				return nil, fmt.Errorf("console is not enabled")
+			}
+			return notifier.NewConsoleSender(os.Stdout, renderer), nil
+
+		case models.ChannelFile:
+			if !cfg.EnableFile {
+				return nil, fmt.Errorf("file is not enabled")
+			}
+			path := cfg.NotifyFilePath
+			if dest.Path != "" {
+				path = dest.Path
+			}
+			return notifier.NewFileSender(path, renderer)
+
+		case models.ChannelDigest:
+			if !cfg.EnableSlack {
+				return nil, fmt.Errorf("slack is not enabled")
+			}
+			return digest, nil
+		}
+
+		return nil, fmt.Errorf("unsupported channel")
+	}
+}
+
+// loadRuleEngine loads and compiles the alert rules from the rules file, or
+// from the alert_rules table when no file is configured, failing on
+// malformed rules
+func loadRuleEngine(ctx context.Context, cfg *config.Config, store *storage.Storage) (*evaluator.RuleEngine, error) {
+	var rules []models.AlertRule
+	var err error
+
+	if cfg.AlertRulesFile != "" {
+		rules, err = evaluator.LoadRulesFile(cfg.AlertRulesFile)
+	} else {
+		rules, err = store.ListAlertRules(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alert rules: %w", err)
+	}
+
+	engine, err := evaluator.NewRuleEngine(rules, cfg.RulesEvaluateAll)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert rules:\n%w", err)
+	}
+
+	log.Printf("Loaded %d enabled alert rules", engine.Len())
+	return engine, nil
+}
+
+// watchSecrets polls the JWT secret and database password files, when the
+// secrets come from files, applying rotated values without a restart
+func watchSecrets(lc *lifecycle.Coordinator, cfg *config.Config, jwtManager *auth.JWTManager, store *storage.Storage) {
+	interval := time.Duration(cfg.SecretsReloadInterval) * time.Second
+	if cfg.JWTSecretFile != "" {
+		lc.Add(lifecycle.Background("jwt secret reload", func(ctx context.Context) {
+			secrets.Watch(ctx, cfg.JWTSecretFile, interval, jwtManager.SetSecret)
+		}))
+	}
+	if cfg.DBPasswordFile != "" {
+		lc.Add(lifecycle.Background("database password reload", func(ctx context.Context) {
+			secrets.Watch(ctx, cfg.DBPasswordFile, interval, func(password string) {
+				cfg.SetDBPassword(password)
+				pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				if err := store.SetDatabaseURL(pingCtx, cfg.DBUrl); err != nil {
+					log.Printf("database password rotation: %v", err)
+				}
+			})
+		}))
+	}
+}
+
+// watchRules reloads the rule engine from the alert_rules table whenever a
+// rule changes, and periodically in case a change signal is missed
+func watchRules(ctx context.Context, cfg *config.Config, rules *evaluator.RuleEngine, store *storage.Storage) {
+	changes, err := store.WatchAlertRules(ctx)
+	if err != nil {
+		log.Printf("Warning: alert rule changes apply on the next poll only: %v", err)
+	}
+
+	interval := time.Duration(cfg.RulesReloadInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	rules.Watch(ctx, store.ListAlertRules, changes, ticker.C)
+}
+
+// loadSeverityPolicy loads the configured severity policy, or returns nil
+// when there is none. It fails on an invalid policy.
+func loadSeverityPolicy(cfg *config.Config) (*evaluator.SeverityPolicy, error) {
+	if cfg.SeverityPolicyFile == "" {
+		return nil, nil
+	}
+
+	policy, err := evaluator.LoadSeverityPolicy(cfg.SeverityPolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid severity policy:\n%w", err)
+	}
+
+	log.Printf("Loaded severity policy with %d mappings and %d bands", len(policy.Mappings), len(policy.Bands))
+	return policy, nil
+}
+
+// loadRenderer loads the message templates, failing on malformed templates
+func loadRenderer(cfg *config.Config) (*templates.Renderer, error) {
+	location, err := time.LoadLocation(cfg.TemplateTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template timezone: %w", err)
+	}
+
+	renderer, err := templates.NewRenderer(cfg.TemplateDir, location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message templates:\n%w", err)
+	}
+	return renderer, nil
+}
+
+// consumerAdmin serves the pause and resume endpoints of the consumer of
+// each input topic under /admin/topics/{topic}/consumer/, and those of the
+// first topic's consumer under /admin/consumer/ as well
+func consumerAdmin(topics []string, consumers []*consumer.Consumer, token string) http.Handler {
+	admins := make(map[string]http.Handler, len(topics))
+	for i, topic := range topics {
+		admins[topic] = consumer.AdminHandler(consumers[i], token)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/consumer/", admins[topics[0]])
+	mux.HandleFunc("/admin/topics/{topic}/consumer/{action}", func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := admins[r.PathValue("topic")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = "/admin/consumer/"+r.PathValue("action"), ""
+		admin.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+// newMetricsServer returns the server for Prometheus metrics, liveness and
+// readiness checks and, when admin is set, consumer administration. The
+// service is ready when every check passes.
+func newMetricsServer(port string, admin http.Handler, checks map[string]func(context.Context) error) *http.Server {
+	live := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+
+	// OpenMetrics carries the latency exemplars
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	if admin != nil {
+		mux.Handle("/admin/consumer/", admin)
+		mux.Handle("/admin/topics/", admin)
+	}
+	mux.HandleFunc("/health", live)
+	mux.HandleFunc("/livez", live)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		status := http.StatusOK
+		results := make(map[string]string, len(checks))
+		for name, check := range checks {
+			results[name] = "ok"
+			if err := check(ctx); err != nil {
+				results[name] = err.Error()
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(results)
+	})
+
+	return &http.Server{Addr: ":" + port, Handler: mux}
+}
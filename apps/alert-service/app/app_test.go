@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/config"
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+)
+
+// get serves a GET of path on server, returning the status and body
+func get(t *testing.T, server *http.Server, path string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return w.Code, string(body)
+}
+
+func TestMetricsServerHealth(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("dial tcp: connection refused") }
+
+	ready := newMetricsServer("9090", nil, map[string]func(context.Context) error{"kafka": ok, "postgres": ok})
+	if ready.Addr != ":9090" {
+		t.Errorf("metrics server listens on %s, want :9090", ready.Addr)
+	}
+	for _, path := range []string{"/livez", "/health"} {
+		if status, body := get(t, ready, path); status != http.StatusOK || body != "OK" {
+			t.Errorf("GET %s = %d %q, want 200 OK", path, status, body)
+		}
+	}
+	status, body := get(t, ready, "/readyz")
+	var results map[string]string
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("readiness body %q: %v", body, err)
+	}
+	if status != http.StatusOK || results["kafka"] != "ok" || results["postgres"] != "ok" {
+		t.Errorf("GET /readyz = %d %v, want ready", status, results)
+	}
+
+	// A failed check makes the service unready but not dead
+	unready := newMetricsServer("9090", nil, map[string]func(context.Context) error{"kafka": ok, "postgres": down})
+	status, body = get(t, unready, "/readyz")
+	results = nil
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("readiness body %q: %v", body, err)
+	}
+	if status != http.StatusServiceUnavailable || results["kafka"] != "ok" || results["postgres"] != "dial tcp: connection refused" {
+		t.Errorf("GET /readyz = %d %v, want postgres reported down", status, results)
+	}
+	if status, _ := get(t, unready, "/livez"); status != http.StatusOK {
+		t.Errorf("GET /livez of an unready service = %d, want 200", status)
+	}
+}
+
+func TestMetricsServerExposesAlertMetrics(t *testing.T) {
+	metrics.RecordNotification("slack", metrics.NotificationDelivered)
+	processed := time.Now()
+	metrics.ObserveAlertLatency("txn-1", "slack", "high", processed, processed.Add(time.Second))
+	status, body := get(t, newMetricsServer("9090", nil, nil), "/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", status)
+	}
+	for _, want := range []string{
+		`alert_notifications_total{channel="slack",outcome="delivered"}`,
+		`alert_latency_seconds_count{channel="slack",severity="high"}`,
+		"# TYPE alert_build_info gauge",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not include %s", want)
+		}
+	}
+}
+
+func TestMetricsServerExposesLatencyExemplars(t *testing.T) {
+	processed := time.Now()
+	metrics.ObserveAlertLatency("txn-exemplar", "email", "critical", processed, processed.Add(3*time.Second))
+	server := newMetricsServer("9090", nil, nil)
+
+	// Exemplars are only in the OpenMetrics format, served when asked for
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text")
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("GET /metrics = %d %s, want OpenMetrics", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), `alert_latency_seconds_bucket{channel="email",severity="critical",le="5.12"} 1 # {transaction_id="txn-exemplar"} 3`) {
+		t.Error("OpenMetrics do not carry the transaction exemplar")
+	}
+
+	if _, body := get(t, server, "/metrics"); strings.Contains(body, "txn-exemplar") {
+		t.Error("the text format carries exemplars")
+	}
+}
+
+func TestMetricsServerServesConsumerAdmin(t *testing.T) {
+	admin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin " + r.URL.Path))
+	})
+	server := newMetricsServer("9090", admin, nil)
+	for _, path := range []string{"/admin/consumer/pause", "/admin/topics/alerts.ops/consumer/resume"} {
+		if status, body := get(t, server, path); status != http.StatusOK || body != "admin "+path {
+			t.Errorf("GET %s = %d %q, want it served by the admin handler", path, status, body)
+		}
+	}
+	if status, _ := get(t, newMetricsServer("9090", nil, nil), "/admin/consumer/pause"); status != http.StatusNotFound {
+		t.Errorf("GET /admin/consumer/pause without admin = %d, want 404", status)
+	}
+}
+
+func TestConsumersOfEachTopicPauseIndependently(t *testing.T) {
+	topics := []string{"transactions.processed", "alerts.ops"}
+	consumers := make([]*consumer.Consumer, len(topics))
+	for i, topic := range topics {
+		// Never started, so a pause is accepted without waiting on a drain
+		consumers[i] = consumer.New(consumer.Config{
+			Brokers:      "localhost:9092",
+			GroupID:      "alert-service",
+			Topic:        topic,
+			DrainTimeout: 10 * time.Millisecond,
+			Metrics:      metrics.ConsumerMetrics{Topic: topic},
+		}, consumer.HandlerFunc(func(context.Context, kafka.Message) error { return nil }))
+	}
+	admin := consumerAdmin(topics, consumers, "admin-token")
+
+	post := func(path string) int {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w.Code
+	}
+	paused := func() string {
+		return fmt.Sprint(consumers[0].Paused(), consumers[1].Paused())
+	}
+
+	if status := post("/admin/topics/alerts.ops/consumer/pause"); status != http.StatusAccepted {
+		t.Errorf("pause of alerts.ops = %d, want 202", status)
+	}
+	if got := paused(); got != "false true" {
+		t.Errorf("paused %s, want only alerts.ops", got)
+	}
+
+	// The unqualified routes control the first topic
+	post("/admin/consumer/pause")
+	post("/admin/topics/alerts.ops/consumer/resume")
+	if got := paused(); got != "true false" {
+		t.Errorf("paused %s, want only transactions.processed", got)
+	}
+	if status := post("/admin/topics/payments/consumer/pause"); status != http.StatusNotFound {
+		t.Errorf("pause of a topic not consumed = %d, want 404", status)
+	}
+}
+
+// sentSender accepts every alert
+type sentSender struct{}
+
+func (sentSender) SendAlert(_ context.Context, alert *models.Alert) (*models.Notification, error) {
+	return &models.Notification{AlertID: alert.ID, Status: models.NotificationStatusSent, SentAt: time.Now()}, nil
+}
+
+func TestSMSIsRoutedOnlyForCriticalAlerts(t *testing.T) {
+	policy, err := loadRoutingPolicy(&config.Config{EnableSlack: true, EnableSMS: true})
+	if err != nil {
+		t.Fatalf("loadRoutingPolicy: %v", err)
+	}
+	d, err := notifier.NewDispatcher(policy, func(notifier.Destination) (notifier.Sender, error) { return sentSender{}, nil }, notifier.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+
+	want := map[string]string{
+		models.SeverityCritical: "sms slack",
+		models.SeverityHigh:     "slack",
+		models.SeverityMedium:   "slack",
+		models.SeverityLow:      "slack",
+	}
+	for severity, channels := range want {
+		alert := &models.Alert{ID: "alert-" + severity, AlertType: models.AlertTypeFraud, Severity: severity}
+		var got []string
+		for _, delivery := range d.Dispatch(context.Background(), alert, nil) {
+			got = append(got, delivery.Destination.Channel)
+		}
+		if strings.Join(got, " ") != channels {
+			t.Errorf("%s alert delivered to %v, want %s", severity, got, channels)
+		}
+	}
+}
+
+func TestSlackDestinationsPostToTheirWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	posts := make(map[string]int)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posts[r.URL.Path]++
+	}))
+	defer webhook.Close()
+
+	renderer, err := loadRenderer(&config.Config{})
+	if err != nil {
+		t.Fatalf("loadRenderer: %v", err)
+	}
+	cfg := &config.Config{
+		EnableSlack:   true,
+		SlackWebhook:  webhook.URL + "/default",
+		SlackWebhooks: map[string]string{"pipeline-ops": webhook.URL + "/pipeline-ops", models.AlertTypeFraud: webhook.URL + "/fraud"},
+	}
+	policy := &notifier.RoutingPolicy{
+		Routes:  []notifier.Route{{Topic: "alerts.ops", Destinations: []notifier.Destination{{Channel: models.ChannelSlack, SlackChannel: "pipeline-ops"}}}},
+		Default: []notifier.Destination{{Channel: models.ChannelSlack}},
+	}
+	d, err := notifier.NewDispatcher(policy, newSenderFactory(cfg, nil, nil, renderer), notifier.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+
+	tests := []struct {
+		alert     *models.Alert
+		recipient string
+	}{
+		{&models.Alert{ID: "ops", AlertType: models.AlertTypeOperational, Severity: models.SeverityHigh, SourceTopic: "alerts.ops"}, "slack-webhook:pipeline-ops"},
+		{&models.Alert{ID: "fraud", AlertType: models.AlertTypeFraud, Severity: models.SeverityHigh}, "slack-webhook:fraud"},
+		{&models.Alert{ID: "risk", AlertType: models.AlertTypeRisk, Severity: models.SeverityHigh}, "slack-webhook"},
+	}
+	for _, tt := range tests {
+		deliveries := d.Dispatch(context.Background(), tt.alert, nil)
+		if len(deliveries) != 1 || deliveries[0].Failed() || deliveries[0].Notification.Recipient != tt.recipient {
+			t.Errorf("%s alert delivered as %+v, want it sent to %s", tt.alert.ID, deliveries, tt.recipient)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{"/pipeline-ops": 1, "/fraud": 1, "/default": 1}
+	for path, n := range want {
+		if posts[path] != n {
+			t.Errorf("%d posts to %s, want %d", posts[path], path, n)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alert-service/internal/maintenance"
+	"alert-service/internal/middleware"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+	"alert-service/internal/stream"
+	"alert-service/internal/watchlist"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/gorilla/mux"
+)
+
+// Server exposes the alerts HTTP API
+type Server struct {
+	store      *storage.Storage
+	dispatcher *notifier.Dispatcher
+	slack      *notifier.Notifier
+	pagerDuty  *notifier.PagerDutySender
+	auth       *middleware.AuthMiddleware
+
+	maintenance *maintenance.Manager
+	stream      *stream.Broker
+	watchlist   *watchlist.Watchlist
+
+	slackSigningSecret string
+}
+
+// NewServer creates a new API server. Alert previews are rendered by
+// dispatcher. slack posts follow-ups to alert
+// threads and pagerDuty resolves incidents of resolved alerts; either may
+// be nil. Slack button interactions are served only when slackSigningSecret
+// is set. New maintenance windows are applied through maintenance. Alerts
+// are streamed to clients from broker. Cached lookups of watchlist, which
+// may be nil, are dropped when an entry changes.
+func NewServer(store *storage.Storage, dispatcher *notifier.Dispatcher, slack *notifier.Notifier, pagerDuty *notifier.PagerDutySender,
+	maintenance *maintenance.Manager, broker *stream.Broker, watchlist *watchlist.Watchlist, slackSigningSecret string, authMiddleware *middleware.AuthMiddleware) *Server {
+	return &Server{
+		store:              store,
+		dispatcher:         dispatcher,
+		slack:              slack,
+		pagerDuty:          pagerDuty,
+		auth:               authMiddleware,
+		maintenance:        maintenance,
+		stream:             broker,
+		watchlist:          watchlist,
+		slackSigningSecret: slackSigningSecret,
+	}
+}
+
+// Router builds the HTTP router for the alerts API
+func (s *Server) Router() *mux.Router {
+	router := mux.NewRouter()
+
+	// Health check endpoint
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	}).Methods("GET")
+
+	// Build information
+	router.HandleFunc("/version", buildinfo.Handler("alert-service")).Methods("GET")
+
+	// Slack interactive message callbacks
+	if s.slackSigningSecret != "" {
+		router.HandleFunc("/slack/interactions", s.SlackInteractionsHandler).Methods("POST")
+	}
+
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+
+	// Alert endpoints
+	apiRouter.HandleFunc("/alerts", s.reader(s.ListAlertsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/alerts/summary", s.reader(s.AlertSummaryHandler)).Methods("GET")
+	apiRouter.HandleFunc("/alerts/stream",
+		s.auth.RequireStreamAuth(s.auth.RequireAnyRole("admin", "auditor")(s.StreamAlertsHandler))).Methods("GET")
+	apiRouter.HandleFunc("/alerts/mine", s.reader(s.MyAlertsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/alerts/{id}", s.admin(s.UpdateAlertHandler)).Methods("PATCH")
+	apiRouter.HandleFunc("/alerts/{id}/preview", s.admin(s.PreviewAlertHandler)).Methods("GET")
+
+	// Incident endpoints
+	apiRouter.HandleFunc("/incidents", s.reader(s.ListIncidentsHandler)).Methods("GET")
+
+	// Alert rule endpoints
+	apiRouter.HandleFunc("/alert-rules", s.admin(s.ListAlertRulesHandler)).Methods("GET")
+	apiRouter.HandleFunc("/alert-rules", s.admin(s.CreateAlertRuleHandler)).Methods("POST")
+	apiRouter.HandleFunc("/alert-rules/{id}", s.admin(s.GetAlertRuleHandler)).Methods("GET")
+	apiRouter.HandleFunc("/alert-rules/{id}", s.admin(s.UpdateAlertRuleHandler)).Methods("PUT")
+	apiRouter.HandleFunc("/alert-rules/{id}", s.admin(s.ToggleAlertRuleHandler)).Methods("PATCH")
+	apiRouter.HandleFunc("/alert-rules/{id}", s.admin(s.DeleteAlertRuleHandler)).Methods("DELETE")
+	apiRouter.HandleFunc("/alert-rules/{id}/test", s.admin(s.TestAlertRuleHandler)).Methods("POST")
+
+	// Maintenance window endpoints
+	apiRouter.HandleFunc("/maintenance-windows", s.reader(s.ListMaintenanceWindowsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/maintenance-windows", s.admin(s.CreateMaintenanceWindowHandler)).Methods("POST")
+	apiRouter.HandleFunc("/maintenance-windows/{id}", s.admin(s.EndMaintenanceWindowHandler)).Methods("DELETE")
+
+	// Watchlist endpoints
+	apiRouter.HandleFunc("/watchlist", s.reader(s.ListWatchlistHandler)).Methods("GET")
+	apiRouter.HandleFunc("/watchlist", s.admin(s.AddWatchlistEntryHandler)).Methods("POST")
+	apiRouter.HandleFunc("/watchlist/{account_id}", s.admin(s.RemoveWatchlistEntryHandler)).Methods("DELETE")
+
+	return router
+}
+
+// admin wraps a handler so it requires an authenticated admin
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth.RequireAuth(s.auth.RequireRole("admin")(next))
+}
+
+// reader wraps a handler so it requires a role allowed to read alerts
+func (s *Server) reader(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth.RequireAuth(s.auth.RequireAnyRole("admin", "auditor")(next))
+}
+
+// ListAlertsHandler lists alerts filtered by status, severity, account and time
+func (s *Server) ListAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := s.store.ListAlerts(r.Context(), filter)
+	if err != nil {
+		log.Printf("failed to list alerts: %v", err)
+		http.Error(w, "failed to list alerts", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// AlertSummaryHandler returns aggregated alert counts for the same filters
+func (s *Server) AlertSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := s.store.GetAlertSummary(r.Context(), filter)
+	if err != nil {
+		log.Printf("failed to get alert summary: %v", err)
+		http.Error(w, "failed to get alert summary", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// MyAlertsHandler lists the open alerts assigned to the caller
+func (s *Server) MyAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.AssignedTo = actor(r)
+	filter.OpenOnly = true
+
+	alerts, err := s.store.ListAlerts(r.Context(), filter)
+	if err != nil {
+		log.Printf("failed to list alerts: %v", err)
+		http.Error(w, "failed to list alerts", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// PreviewAlertHandler renders an alert for every destination of the
+// routing policy, as it would be delivered, without sending anything
+func (s *Server) PreviewAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	alert, err := s.store.GetAlert(r.Context(), id)
+	if errors.Is(err, storage.ErrAlertNotFound) || (err == nil && !inScope(alert, tenantScope(r))) {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get alert: %v", err)
+		http.Error(w, "failed to preview alert", http.StatusInternalServerError)
+		return
+	}
+
+	previews := s.dispatcher.Preview(alert)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"alert_id": alert.ID,
+		"previews": previews,
+		"count":    len(previews),
+	})
+}
+
+// updateAlertRequest is the body of an alert status change
+type updateAlertRequest struct {
+	Status string `json:"status"`
+	Notes  string `json:"notes"`
+	// NotifyThread posts the change as a reply to the alert's Slack thread
+	NotifyThread bool `json:"notify_thread"`
+}
+
+// UpdateAlertHandler moves an alert through its workflow. The caller is
+// recorded as the assignee or resolver; invalid transitions get 409.
+func (s *Server) UpdateAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req updateAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	caller := actor(r)
+	if caller == "" {
+		http.Error(w, "token has no user identity", http.StatusForbidden)
+		return
+	}
+
+	alert, err := s.transition(r.Context(), id, req.Status, caller, req.Notes, tenantScope(r))
+	var invalid *invalidTransitionError
+	switch {
+	case errors.Is(err, storage.ErrAlertNotFound):
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	case errors.As(err, &invalid):
+		http.Error(w, invalid.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, storage.ErrStatusConflict):
+		http.Error(w, "alert was updated concurrently, retry", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("failed to update alert: %v", err)
+		http.Error(w, "failed to update alert", http.StatusInternalServerError)
+		return
+	}
+
+	if req.NotifyThread {
+		s.replyInThreads(r.Context(), alert)
+	}
+
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// invalidTransitionError reports a status change the workflow does not allow
+type invalidTransitionError struct {
+	from, to string
+}
+
+func (e *invalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot move alert from %s to %s", e.from, e.to)
+}
+
+// transition moves an alert to a new status on behalf of caller. When the
+// alert is resolved it resolves its PagerDuty incident, and its incident
+// once the incident has no unresolved alert left. An alert outside the
+// caller's tenant scope is not found.
+func (s *Server) transition(ctx context.Context, id, status, caller, notes string, tenantID *string) (*models.Alert, error) {
+	current, err := s.store.GetAlert(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !inScope(current, tenantID) {
+		return nil, storage.ErrAlertNotFound
+	}
+
+	if !models.CanTransition(current.Status, status) {
+		return nil, &invalidTransitionError{from: current.Status, to: status}
+	}
+
+	alert, err := s.store.UpdateAlertStatus(ctx, id, current.Status, status, caller, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	if models.IsResolvedStatus(alert.Status) && !models.IsResolvedStatus(current.Status) {
+		s.resolveIncident(ctx, alert)
+		s.settleIncident(ctx, alert)
+	}
+	return alert, nil
+}
+
+// replyInThreads posts a status update under every Slack message sent for
+// an alert. Failures are logged: the status change has already been made.
+func (s *Server) replyInThreads(ctx context.Context, alert *models.Alert) {
+	if s.slack == nil {
+		return
+	}
+
+	notifications, err := s.store.ListNotifications(ctx, alert.ID)
+	if err != nil {
+		log.Printf("alert %s: %v", alert.ID, err)
+		return
+	}
+
+	message := statusMessage(alert)
+	for _, n := range notifications {
+		if n.Channel != models.ChannelSlack || n.ExternalID == "" {
+			continue
+		}
+		if err := s.slack.ReplyInThread(ctx, n.Recipient, n.ExternalID, message); err != nil {
+			log.Printf("alert %s: failed to reply in Slack thread: %v", alert.ID, err)
+		}
+	}
+}
+
+// statusMessage describes an alert's latest status change
+func statusMessage(alert *models.Alert) string {
+	message := fmt.Sprintf("Alert marked *%s* by %s", alert.Status, alert.ResolvedBy)
+	if !models.IsResolvedStatus(alert.Status) {
+		message = fmt.Sprintf("Alert marked *%s* by %s", alert.Status, alert.AssignedTo)
+	}
+	if alert.ResolutionNotes != "" {
+		message += "\n" + alert.ResolutionNotes
+	}
+	return message
+}
+
+// resolveIncident resolves the PagerDuty incident of an alert that paged.
+// Failures are logged and recorded: the status change has already been made.
+func (s *Server) resolveIncident(ctx context.Context, alert *models.Alert) {
+	if s.pagerDuty == nil {
+		return
+	}
+
+	notifications, err := s.store.ListNotifications(ctx, alert.ID)
+	if err != nil {
+		log.Printf("alert %s: %v", alert.ID, err)
+		return
+	}
+
+	paged := false
+	for _, n := range notifications {
+		if n.Channel == models.ChannelPagerDuty && n.Status == models.NotificationStatusSent {
+			paged = true
+			break
+		}
+	}
+	if !paged {
+		return
+	}
+
+	notification, err := s.pagerDuty.Resolve(ctx, alert)
+	if err != nil {
+		log.Printf("alert %s: failed to resolve PagerDuty incident: %v", alert.ID, err)
+	}
+	if err := s.store.InsertNotification(ctx, notification); err != nil {
+		log.Printf("alert %s: %v", alert.ID, err)
+	}
+}
+
+// actor returns the identity of the authenticated caller
+func actor(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		return claims.UserID
+	}
+	return ""
+}
+
+// tenantScope returns the tenant the caller's reads are limited to, or nil
+// for every tenant. Admins may pick one with the tenant_id query parameter.
+func tenantScope(r *http.Request) *string {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		tenantID := ""
+		return &tenantID
+	}
+	return claims.TenantScope(r.URL.Query().Get("tenant_id"))
+}
+
+// inScope reports whether an alert belongs to the tenant scope
+func inScope(alert *models.Alert, tenantID *string) bool {
+	return tenantID == nil || alert.TenantID == *tenantID
+}
+
+// parseFilter reads an alert filter from the query string
+func parseFilter(r *http.Request) (storage.AlertFilter, error) {
+	q := r.URL.Query()
+
+	filter := storage.AlertFilter{
+		Status:    q.Get("status"),
+		Severity:  q.Get("severity"),
+		AlertType: q.Get("alert_type"),
+		AccountID: q.Get("account_id"),
+		TenantID:  tenantScope(r),
+	}
+
+	if value := q.Get("suppressed"); value != "" {
+		suppressed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid suppressed flag")
+		}
+		filter.Suppressed = &suppressed
+	}
+
+	var err error
+	if filter.From, err = parseTime(q.Get("from")); err != nil {
+		return filter, fmt.Errorf("invalid from timestamp")
+	}
+	if filter.To, err = parseTime(q.Get("to")); err != nil {
+		return filter, fmt.Errorf("invalid to timestamp")
+	}
+	if filter.Limit, err = parseInt(q.Get("limit"), 50, 1, 500); err != nil {
+		return filter, fmt.Errorf("invalid limit")
+	}
+	if filter.Offset, err = parseInt(q.Get("offset"), 0, 0, -1); err != nil {
+		return filter, fmt.Errorf("invalid offset")
+	}
+
+	return filter, nil
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// parseTime parses an optional RFC 3339 timestamp
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseInt parses an optional integer of at least min, capped at max when
+// max is non-negative
+func parseInt(value string, defaultValue, min, max int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if max >= 0 && n > max {
+		n = max
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"alert-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// scopedRequest returns a request with query made on behalf of claims, or
+// anonymously when claims is nil
+func scopedRequest(claims *auth.Claims, query string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/alerts?"+query, nil)
+	if claims != nil {
+		r = r.WithContext(auth.WithClaims(r.Context(), claims))
+	}
+	return r
+}
+
+func TestTenantScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		query  string
+		want   *string
+	}{
+		{"anonymous reads the default tenant", nil, "tenant_id=unit-b", ptr("")},
+		{"tenant analyst reads its tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"analyst"}}, "", ptr("unit-a")},
+		{"tenant analyst cannot pick another tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"analyst"}}, "tenant_id=unit-b", ptr("unit-a")},
+		{"tenant admin cannot pick another tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"admin"}}, "tenant_id=unit-b", ptr("unit-a")},
+		{"untenanted admin reads every tenant", &auth.Claims{Roles: []string{"admin"}}, "", nil},
+		{"untenanted admin picks a tenant", &auth.Claims{Roles: []string{"admin"}}, "tenant_id=unit-b", ptr("unit-b")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tenantScope(scopedRequest(tt.claims, tt.query))
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("scope = %v, want %v", show(got), show(tt.want))
+			case *got != *tt.want:
+				t.Errorf("scope = %q, want %q", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestInScope(t *testing.T) {
+	alert := &models.Alert{ID: "alert-1", TenantID: "unit-b"}
+
+	if inScope(alert, ptr("unit-a")) {
+		t.Error("an alert of unit-b is in the scope of unit-a")
+	}
+	if !inScope(alert, ptr("unit-b")) {
+		t.Error("an alert of unit-b is not in its own tenant's scope")
+	}
+	if !inScope(alert, nil) {
+		t.Error("an alert is not in the scope of every tenant")
+	}
+}
+
+func TestFiltersScopeToTheCallerTenant(t *testing.T) {
+	r := scopedRequest(&auth.Claims{TenantID: "unit-a", Roles: []string{"analyst"}}, "tenant_id=unit-b")
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		t.Fatalf("parseFilter: %v", err)
+	}
+	if filter.TenantID == nil || *filter.TenantID != "unit-a" {
+		t.Errorf("alert filter scope = %v, want unit-a", show(filter.TenantID))
+	}
+
+	incidents, err := parseIncidentFilter(r)
+	if err != nil {
+		t.Fatalf("parseIncidentFilter: %v", err)
+	}
+	if incidents.TenantID == nil || *incidents.TenantID != "unit-a" {
+		t.Errorf("incident filter scope = %v, want unit-a", show(incidents.TenantID))
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func show(s *string) string {
+	if s == nil {
+		return "every tenant"
+	}
+	return *s
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+)
+
+// ListIncidentsHandler lists incidents filtered by status, account, maximum
+// severity and when they were first seen
+func (s *Server) ListIncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseIncidentFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	incidents, err := s.store.ListIncidents(r.Context(), filter)
+	if err != nil {
+		log.Printf("failed to list incidents: %v", err)
+		http.Error(w, "failed to list incidents", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"incidents": incidents,
+		"count":     len(incidents),
+	})
+}
+
+// parseIncidentFilter reads an incident filter from the query string
+func parseIncidentFilter(r *http.Request) (storage.IncidentFilter, error) {
+	q := r.URL.Query()
+
+	filter := storage.IncidentFilter{
+		Status:    q.Get("status"),
+		AccountID: q.Get("account_id"),
+		Severity:  q.Get("severity"),
+		TenantID:  tenantScope(r),
+	}
+
+	switch filter.Status {
+	case "", models.IncidentStatusOpen, models.IncidentStatusResolved:
+	default:
+		return filter, fmt.Errorf("invalid status")
+	}
+
+	var err error
+	if filter.From, err = parseTime(q.Get("from")); err != nil {
+		return filter, fmt.Errorf("invalid from timestamp")
+	}
+	if filter.To, err = parseTime(q.Get("to")); err != nil {
+		return filter, fmt.Errorf("invalid to timestamp")
+	}
+	if filter.Limit, err = parseInt(q.Get("limit"), 50, 1, 500); err != nil {
+		return filter, fmt.Errorf("invalid limit")
+	}
+	if filter.Offset, err = parseInt(q.Get("offset"), 0, 0, -1); err != nil {
+		return filter, fmt.Errorf("invalid offset")
+	}
+
+	return filter, nil
+}
+
+// settleIncident resolves the incident of a resolved alert once none of its
+// alerts is left unresolved. Failures are logged: the status change has
+// already been made.
+func (s *Server) settleIncident(ctx context.Context, alert *models.Alert) {
+	if alert.IncidentID == "" {
+		return
+	}
+
+	resolved, err := s.store.ResolveIncidentIfSettled(ctx, alert.IncidentID)
+	if err != nil {
+		log.Printf("alert %s: %v", alert.ID, err)
+		return
+	}
+	if resolved {
+		log.Printf("incident %s resolved with its last alert %s", alert.IncidentID, alert.ID)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+func TestParseIncidentFilter(t *testing.T) {
+	admin := &auth.Claims{Roles: []string{"admin"}}
+	tests := []struct {
+		name    string
+		query   string
+		want    storage.IncidentFilter
+		wantErr string
+	}{
+		{name: "defaults", want: storage.IncidentFilter{Limit: 50}},
+		{
+			name:  "every filter",
+			query: "status=open&account_id=acct-1&severity=high&from=2026-03-02T09:00:00Z&to=2026-03-03T09:00:00Z&limit=20&offset=40",
+			want: storage.IncidentFilter{
+				Status:    models.IncidentStatusOpen,
+				AccountID: "acct-1",
+				Severity:  models.SeverityHigh,
+				From:      time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+				To:        time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC),
+				Limit:     20,
+				Offset:    40,
+			},
+		},
+		{name: "limit capped", query: "status=resolved&limit=5000", want: storage.IncidentFilter{Status: models.IncidentStatusResolved, Limit: 500}},
+		{name: "unknown status", query: "status=closed", wantErr: "invalid status"},
+		{name: "bad from", query: "from=yesterday", wantErr: "invalid from timestamp"},
+		{name: "bad to", query: "to=2026-03-02", wantErr: "invalid to timestamp"},
+		{name: "no limit", query: "limit=0", wantErr: "invalid limit"},
+		{name: "negative offset", query: "offset=-1", wantErr: "invalid offset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parseIncidentFilter(scopedRequest(admin, tt.query))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("parseIncidentFilter() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || filter != tt.want {
+				t.Errorf("parseIncidentFilter() = %+v, %v, want %+v", filter, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListIncidentsRejectsABadFilter(t *testing.T) {
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.ListIncidentsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/incidents?status=pending", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400 before the store is queried", w.Code)
+	}
+}
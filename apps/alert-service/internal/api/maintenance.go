@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// createWindowRequest is the body of a maintenance window creation
+type createWindowRequest struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Reason     string    `json:"reason"`
+	Scope      string    `json:"scope"`
+	ScopeValue string    `json:"scope_value"`
+}
+
+// CreateMaintenanceWindowHandler schedules a maintenance window. Scope is
+// "all" (the default), "account" or "alert_type"; the latter two need a
+// scope_value naming the account or alert type.
+func (s *Server) CreateMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	var req createWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = models.MaintenanceScopeAll
+	}
+	switch {
+	case req.Start.IsZero() || !req.End.After(req.Start):
+		http.Error(w, "end must be after start", http.StatusBadRequest)
+		return
+	case !req.End.After(time.Now()):
+		http.Error(w, "window has already ended", http.StatusBadRequest)
+		return
+	case req.Scope != models.MaintenanceScopeAll && req.Scope != models.MaintenanceScopeAccount &&
+		req.Scope != models.MaintenanceScopeAlertType:
+		http.Error(w, "invalid scope", http.StatusBadRequest)
+		return
+	case req.Scope != models.MaintenanceScopeAll && req.ScopeValue == "":
+		http.Error(w, "scope_value is required", http.StatusBadRequest)
+		return
+	}
+	if req.Scope == models.MaintenanceScopeAll {
+		req.ScopeValue = ""
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	window := &models.MaintenanceWindow{
+		ID:         "mw_" + hex.EncodeToString(b),
+		Start:      req.Start,
+		End:        req.End,
+		Reason:     req.Reason,
+		Scope:      req.Scope,
+		ScopeValue: req.ScopeValue,
+		CreatedBy:  actor(r),
+		CreatedAt:  time.Now(),
+	}
+
+	if err := s.store.InsertMaintenanceWindow(r.Context(), window); err != nil {
+		log.Printf("failed to create maintenance window: %v", err)
+		http.Error(w, "failed to create maintenance window", http.StatusInternalServerError)
+		return
+	}
+	if s.maintenance != nil {
+		s.maintenance.Add(window)
+	}
+
+	log.Printf("maintenance window %s (%s %s) scheduled by %s: %s to %s",
+		window.ID, window.Scope, window.ScopeValue, window.CreatedBy, window.Start, window.End)
+	writeJSON(w, http.StatusCreated, window)
+}
+
+// ListMaintenanceWindowsHandler lists maintenance windows; with
+// active=true only those that have not yet ended
+func (s *Server) ListMaintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	var after time.Time
+	if value := r.URL.Query().Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "invalid active flag", http.StatusBadRequest)
+			return
+		}
+		if active {
+			after = time.Now()
+		}
+	}
+
+	windows, err := s.store.ListMaintenanceWindows(r.Context(), after)
+	if err != nil {
+		log.Printf("failed to list maintenance windows: %v", err)
+		http.Error(w, "failed to list maintenance windows", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, windows)
+}
+
+// EndMaintenanceWindowHandler ends a maintenance window now. Its summary is
+// sent on the next refresh.
+func (s *Server) EndMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	window, err := s.store.EndMaintenanceWindow(r.Context(), id, time.Now())
+	if errors.Is(err, storage.ErrWindowNotFound) {
+		http.Error(w, "maintenance window not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to end maintenance window: %v", err)
+		http.Error(w, "failed to end maintenance window", http.StatusInternalServerError)
+		return
+	}
+	if s.maintenance != nil {
+		s.maintenance.Remove(id)
+	}
+
+	log.Printf("maintenance window %s ended by %s", id, actor(r))
+	writeJSON(w, http.StatusOK, window)
+}
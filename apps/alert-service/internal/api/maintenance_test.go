@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateMaintenanceWindowValidation(t *testing.T) {
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().Add(3 * time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	earlier := time.Now().Add(-3 * time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"malformed body", `{"start": `, "invalid request body"},
+		{"no start", fmt.Sprintf(`{"end": %q}`, end), "end must be after start"},
+		{"end before start", fmt.Sprintf(`{"start": %q, "end": %q}`, end, start), "end must be after start"},
+		{"empty window", fmt.Sprintf(`{"start": %q, "end": %q}`, start, start), "end must be after start"},
+		{"already ended", fmt.Sprintf(`{"start": %q, "end": %q}`, earlier, past), "window has already ended"},
+		{"unknown scope", fmt.Sprintf(`{"start": %q, "end": %q, "scope": "merchant", "scope_value": "m-1"}`, start, end), "invalid scope"},
+		{"account without value", fmt.Sprintf(`{"start": %q, "end": %q, "scope": "account"}`, start, end), "scope_value is required"},
+		{"alert type without value", fmt.Sprintf(`{"start": %q, "end": %q, "scope": "alert_type"}`, start, end), "scope_value is required"},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/maintenance-windows", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			s.CreateMaintenanceWindowHandler(w, r)
+			if w.Code != http.StatusBadRequest || strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("POST = %d %q, want 400 %q", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+}
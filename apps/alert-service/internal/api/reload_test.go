@@ -0,0 +1,218 @@
+//go:build integration
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+	"alert-service/internal/testdb"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// The rule tests store rules in Postgres in a container, each test on a
+// database of its own:
+//
+//	go test -tags=integration ./internal/api/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(dbURL)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// decode decodes the JSON body into v
+func decode(t *testing.T, body string, v any) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+}
+
+// casino is a transaction of amount USD at a casino
+func casino(amount float64) *models.ProcessedTransaction {
+	return &models.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:        "txn-1",
+			AccountID: "acct-1",
+			Amount:    amount,
+			Currency:  "USD",
+			Merchant:  "Bellagio Casino Las Vegas",
+			Status:    models.TransactionStatusApproved,
+		},
+		RiskScore: 0.4,
+		RiskLevel: models.RiskLevelMedium,
+	}
+}
+
+const casinoRule = `{"id": "casino", "name": "Large casino spend", "enabled": true, "priority": 10,
+	"conditions": [{"field": "merchant", "operator": "contains", "value": "casino"},
+		{"field": "amount", "operator": "greater_than", "value": "1000"}],
+	"actions": [{"type": "set_severity", "config": {"severity": "high"}},
+		{"type": "notify", "config": {"channel": "slack"}}]}`
+
+func TestAlertRuleRoundTrip(t *testing.T) {
+	router := NewServer(newTestStorage(t), nil, nil, nil, nil, nil, nil, "", testAuth()).Router()
+	admin := bearer(t, "adm", "admin")
+
+	status, body := serve(router, http.MethodPost, "/api/v1/alert-rules", casinoRule, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("POST = %d %q", status, body)
+	}
+	var created models.AlertRule
+	decode(t, body, &created)
+	if created.Type != models.RuleTypePattern || created.CreatedAt.IsZero() {
+		t.Errorf("created rule = %+v, want a pattern rule with its creation time", created)
+	}
+	if status, body := serve(router, http.MethodPost, "/api/v1/alert-rules", casinoRule, admin); status != http.StatusConflict {
+		t.Errorf("POST of a taken ID = %d %q, want 409", status, body)
+	}
+
+	status, body = serve(router, http.MethodGet, "/api/v1/alert-rules/casino", "", admin)
+	var got models.AlertRule
+	decode(t, body, &got)
+	if status != http.StatusOK || got.Name != "Large casino spend" || len(got.Conditions) != 2 || len(got.Actions) != 2 ||
+		got.Actions[0].Config["severity"] != models.SeverityHigh || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("GET = %d %+v", status, got)
+	}
+
+	// The dry run reports the alert the rule would raise
+	dryRun := func(amount float64) testRuleResponse {
+		t.Helper()
+		txn, _ := json.Marshal(casino(amount))
+		status, body := serve(router, http.MethodPost, "/api/v1/alert-rules/casino/test", string(txn), admin)
+		if status != http.StatusOK {
+			t.Fatalf("POST /test = %d %q", status, body)
+		}
+		var resp testRuleResponse
+		decode(t, body, &resp)
+		return resp
+	}
+	if resp := dryRun(5000); !resp.Matched || resp.Alert == nil || resp.Alert.Severity != models.SeverityHigh || len(resp.Channels) != 1 || resp.Channels[0] != "slack" {
+		t.Errorf("dry run of 5000 = %+v, want a high alert to slack", resp)
+	}
+	if resp := dryRun(500); resp.Matched {
+		t.Errorf("dry run of 500 = %+v, want no match", resp)
+	}
+
+	update := `{"name": "Casino spend", "enabled": true, "priority": 5,
+		"conditions": [{"field": "merchant", "operator": "contains", "value": "casino"}]}`
+	status, body = serve(router, http.MethodPut, "/api/v1/alert-rules/casino", update, admin)
+	var updated models.AlertRule
+	decode(t, body, &updated)
+	if status != http.StatusOK || updated.Name != "Casino spend" || updated.Priority != 5 || len(updated.Actions) != 0 ||
+		!updated.CreatedAt.Equal(created.CreatedAt) || !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("PUT = %d %+v", status, updated)
+	}
+	if resp := dryRun(500); !resp.Matched {
+		t.Error("dry run of 500 after the update does not match")
+	}
+
+	status, body = serve(router, http.MethodPatch, "/api/v1/alert-rules/casino", `{"enabled": false}`, admin)
+	var toggled models.AlertRule
+	decode(t, body, &toggled)
+	if status != http.StatusOK || toggled.Enabled || toggled.Name != "Casino spend" {
+		t.Errorf("PATCH = %d %+v, want the rule disabled", status, toggled)
+	}
+	// Disabled rules are still listed and can be dry-run
+	status, body = serve(router, http.MethodGet, "/api/v1/alert-rules", "", admin)
+	var rules []models.AlertRule
+	decode(t, body, &rules)
+	if status != http.StatusOK || len(rules) != 1 || rules[0].Enabled {
+		t.Errorf("GET list = %d %+v", status, rules)
+	}
+	if resp := dryRun(500); !resp.Matched {
+		t.Error("dry run of the disabled rule does not match")
+	}
+
+	if status, body := serve(router, http.MethodDelete, "/api/v1/alert-rules/casino", "", admin); status != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %q", status, body)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/alert-rules/casino", ""},
+		{http.MethodPut, "/api/v1/alert-rules/casino", update},
+		{http.MethodPatch, "/api/v1/alert-rules/casino", `{"enabled": true}`},
+		{http.MethodDelete, "/api/v1/alert-rules/casino", ""},
+		{http.MethodPost, "/api/v1/alert-rules/casino/test", `{}`},
+	} {
+		if status, _ := serve(router, req.method, req.path, req.body, admin); status != http.StatusNotFound {
+			t.Errorf("%s %s of a deleted rule = %d, want 404", req.method, req.path, status)
+		}
+	}
+	status, body = serve(router, http.MethodGet, "/api/v1/alert-rules", "", admin)
+	if status != http.StatusOK || body != "[]" {
+		t.Errorf("GET list after the delete = %d %q, want []", status, body)
+	}
+}
+
+func TestAlertRuleChangesReachTheEvaluator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newTestStorage(t)
+	router := NewServer(store, nil, nil, nil, nil, nil, nil, "", testAuth()).Router()
+	admin := bearer(t, "adm", "admin")
+
+	engine, err := evaluator.NewRuleEngine(nil, false)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	changes, err := store.WatchAlertRules(ctx)
+	if err != nil {
+		t.Fatalf("WatchAlertRules: %v", err)
+	}
+	// No ticks: a change must arrive through its notification alone
+	go engine.Watch(ctx, store.ListAlertRules, changes, nil)
+
+	// reloaded reports how long after the request the engine raised want
+	// alerts for a transaction of 5000
+	reloaded := func(change string, want int) {
+		t.Helper()
+		start := time.Now()
+		for time.Since(start) < 5*time.Second {
+			if len(engine.Evaluate(casino(5000))) == want {
+				t.Logf("%s applied after %s", change, time.Since(start))
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s not applied after 5s", change)
+	}
+
+	if status, body := serve(router, http.MethodPost, "/api/v1/alert-rules", casinoRule, admin); status != http.StatusCreated {
+		t.Fatalf("POST = %d %q", status, body)
+	}
+	reloaded("create", 1)
+
+	if status, body := serve(router, http.MethodPatch, "/api/v1/alert-rules/casino", `{"enabled": false}`, admin); status != http.StatusOK {
+		t.Fatalf("PATCH = %d %q", status, body)
+	}
+	reloaded("disable", 0)
+
+	if status, body := serve(router, http.MethodPatch, "/api/v1/alert-rules/casino", `{"enabled": true}`, admin); status != http.StatusOK {
+		t.Fatalf("PATCH = %d %q", status, body)
+	}
+	reloaded("enable", 1)
+
+	if status, body := serve(router, http.MethodDelete, "/api/v1/alert-rules/casino", "", admin); status != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %q", status, body)
+	}
+	reloaded("delete", 0)
+}
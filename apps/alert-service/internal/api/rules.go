@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+var validRuleTypes = map[string]bool{
+	models.RuleTypeRiskScore: true,
+	models.RuleTypeAmount:    true,
+	models.RuleTypeFrequency: true,
+	models.RuleTypeLocation:  true,
+	models.RuleTypeMerchant:  true,
+	models.RuleTypeTime:      true,
+	models.RuleTypePattern:   true,
+}
+
+// testRuleResponse is the result of a rule dry run
+type testRuleResponse struct {
+	Matched  bool          `json:"matched"`
+	Alert    *models.Alert `json:"alert,omitempty"`
+	Channels []string      `json:"channels,omitempty"`
+}
+
+// ListAlertRulesHandler lists all alert rules, enabled or not
+func (s *Server) ListAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.store.ListAlertRules(r.Context())
+	if err != nil {
+		log.Printf("failed to list alert rules: %v", err)
+		http.Error(w, "failed to list alert rules", http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []models.AlertRule{}
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// GetAlertRuleHandler returns a single alert rule
+func (s *Server) GetAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, err := s.store.GetAlertRule(r.Context(), mux.Vars(r)["id"])
+	if s.ruleError(w, err, "get") {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// CreateAlertRuleHandler validates and stores a new alert rule. An ID is
+// generated when none is given. Evaluators pick the rule up within seconds.
+func (s *Server) CreateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule models.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if rule.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		rule.ID = "rule_" + hex.EncodeToString(b)
+	}
+	if err := validateRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+
+	err := s.store.InsertAlertRule(r.Context(), &rule)
+	if errors.Is(err, storage.ErrRuleExists) {
+		http.Error(w, "alert rule already exists", http.StatusConflict)
+		return
+	}
+	if s.ruleError(w, err, "create") {
+		return
+	}
+
+	log.Printf("alert rule %s created by %s", rule.ID, actor(r))
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// UpdateAlertRuleHandler validates and replaces an alert rule
+func (s *Server) UpdateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule models.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = mux.Vars(r)["id"]
+	if err := validateRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.UpdatedAt = time.Now()
+
+	updated, err := s.store.UpdateAlertRule(r.Context(), &rule)
+	if s.ruleError(w, err, "update") {
+		return
+	}
+
+	log.Printf("alert rule %s updated by %s", rule.ID, actor(r))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// ToggleAlertRuleHandler enables or disables an alert rule
+func (s *Server) ToggleAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := s.store.SetAlertRuleEnabled(r.Context(), mux.Vars(r)["id"], *req.Enabled)
+	if s.ruleError(w, err, "update") {
+		return
+	}
+
+	log.Printf("alert rule %s enabled=%t by %s", rule.ID, rule.Enabled, actor(r))
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// DeleteAlertRuleHandler deletes an alert rule
+func (s *Server) DeleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if s.ruleError(w, s.store.DeleteAlertRule(r.Context(), id), "delete") {
+		return
+	}
+
+	log.Printf("alert rule %s deleted by %s", id, actor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestAlertRuleHandler dry-runs a stored rule, enabled or not, against a
+// sample processed transaction and reports the alert it would raise.
+// Nothing is recorded or sent.
+func (s *Server) TestAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var txn models.ProcessedTransaction
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := s.store.GetAlertRule(r.Context(), mux.Vars(r)["id"])
+	if s.ruleError(w, err, "get") {
+		return
+	}
+
+	match, err := evaluator.TestRule(*rule, &txn)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("stored rule is invalid: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	resp := testRuleResponse{}
+	if match != nil {
+		resp = testRuleResponse{Matched: true, Alert: match.Alert, Channels: match.Channels}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// validateRule checks a rule before it is written, so a rule the evaluators
+// cannot compile is never stored. The type defaults to pattern.
+func validateRule(rule *models.AlertRule) error {
+	if rule.Type == "" {
+		rule.Type = models.RuleTypePattern
+	}
+	if !validRuleTypes[rule.Type] {
+		return fmt.Errorf("invalid rule: unknown type %q", rule.Type)
+	}
+	if err := evaluator.ValidateRule(*rule); err != nil {
+		return fmt.Errorf("invalid rule: %w", err)
+	}
+	return nil
+}
+
+// ruleError writes the response for a failed rule operation and reports
+// whether there was an error
+func (s *Server) ruleError(w http.ResponseWriter, err error, op string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, storage.ErrRuleNotFound):
+		http.Error(w, "alert rule not found", http.StatusNotFound)
+	default:
+		log.Printf("failed to %s alert rule: %v", op, err)
+		http.Error(w, "failed to "+op+" alert rule", http.StatusInternalServerError)
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"alert-service/internal/middleware"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWTSecret signs the tokens of the tests under key ID "test"
+const testJWTSecret = "test-jwt-secret"
+
+// testAuth returns the middleware accepting the tokens of bearer
+func testAuth() *middleware.AuthMiddleware {
+	return middleware.NewAuthMiddleware(auth.NewJWTManager("test", testJWTSecret, nil))
+}
+
+// bearer returns an Authorization header of a token of user with roles
+func bearer(t *testing.T, user string, roles ...string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		UserID: user,
+		Roles:  roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return "Bearer " + signed
+}
+
+// serve serves a request of method, path and body through router with the
+// Authorization header authorization, returning the status and body
+func serve(router http.Handler, method, path, body, authorization string) (int, string) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestAlertRulesRequireAnAdmin(t *testing.T) {
+	router := NewServer(nil, nil, nil, nil, nil, nil, nil, "", testAuth()).Router()
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{Roles: []string{"admin"}})
+	signed, err := forged.SignedString([]byte("another-secret"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"forged token", "Bearer " + signed, http.StatusUnauthorized},
+		{"analyst", bearer(t, "ana", "analyst"), http.StatusForbidden},
+		{"auditor", bearer(t, "aud", "auditor"), http.StatusForbidden},
+		// An admin reaches the handler, which rejects the empty body
+		{"admin", bearer(t, "adm", "admin"), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, req := range []struct{ method, path string }{
+				{http.MethodPost, "/api/v1/alert-rules"},
+				{http.MethodPut, "/api/v1/alert-rules/rule-1"},
+				{http.MethodPatch, "/api/v1/alert-rules/rule-1"},
+				{http.MethodPost, "/api/v1/alert-rules/rule-1/test"},
+			} {
+				if status, _ := serve(router, req.method, req.path, "", tt.authorization); status != tt.want {
+					t.Errorf("%s %s = %d, want %d", req.method, req.path, status, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidAlertRulesAreRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"malformed body", `{"name": `, ""},
+		{"unknown type", `{"name": "r", "type": "velocity", "conditions": [{"field": "amount", "operator": "greater_than", "value": "1"}]}`,
+			`unknown type "velocity"`},
+		{"missing name", `{"conditions": [{"field": "amount", "operator": "greater_than", "value": "1"}]}`, "missing name"},
+		{"no conditions", `{"name": "r"}`, "no conditions"},
+		{"unknown field", `{"name": "r", "conditions": [{"field": "iban", "operator": "equals", "value": "x"}]}`, `unknown field "iban"`},
+		{"unknown operator", `{"name": "r", "conditions": [{"field": "country", "operator": "like", "value": "US"}]}`, `operator "like" not supported`},
+		{"not a number", `{"name": "r", "conditions": [{"field": "amount", "operator": "greater_than", "value": "lots"}]}`, `needs a number, got "lots"`},
+		{"invalid regex", `{"name": "r", "conditions": [{"field": "merchant", "operator": "regex", "value": "(casino"}]}`, `invalid regex "(casino"`},
+		{"unknown channel", `{"name": "r", "conditions": [{"field": "amount", "operator": "greater_than", "value": "1"}],
+			"actions": [{"type": "notify", "config": {"channel": "fax"}}]}`, `unknown notification channel "fax"`},
+	}
+
+	// Invalid rules are rejected before the store is reached
+	router := NewServer(nil, nil, nil, nil, nil, nil, nil, "", testAuth()).Router()
+	admin := bearer(t, "adm", "admin")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, req := range []struct{ method, path string }{
+				{http.MethodPost, "/api/v1/alert-rules"},
+				{http.MethodPut, "/api/v1/alert-rules/rule-1"},
+			} {
+				status, body := serve(router, req.method, req.path, tt.body, admin)
+				want := "invalid request body"
+				if tt.want != "" {
+					want = "invalid rule: "
+				}
+				if status != http.StatusBadRequest || !strings.HasPrefix(body, want) || !strings.Contains(body, tt.want) {
+					t.Errorf("%s %s = %d %q, want 400 %q", req.method, req.path, status, body, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestToggleAlertRuleNeedsEnabled(t *testing.T) {
+	router := NewServer(nil, nil, nil, nil, nil, nil, nil, "", testAuth()).Router()
+	admin := bearer(t, "adm", "admin")
+	for _, body := range []string{`{}`, `{"enabled": null}`, `{"enabled": "yes"}`, `true`} {
+		if status, _ := serve(router, http.MethodPatch, "/api/v1/alert-rules/rule-1", body, admin); status != http.StatusBadRequest {
+			t.Errorf("PATCH %s = %d, want 400", body, status)
+		}
+	}
+}
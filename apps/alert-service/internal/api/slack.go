@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+)
+
+// slackMaxRequestAge rejects replayed interaction requests
+const slackMaxRequestAge = 5 * time.Minute
+
+// slackInteraction is the part of a Slack block_actions payload we use
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		TS string `json:"ts"`
+	} `json:"message"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// SlackInteractionsHandler handles clicks on the alert message buttons.
+// Requests are authenticated with the Slack signing secret rather than a JWT.
+func (s *Server) SlackInteractionsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	err = verifySlackSignature(s.slackSigningSecret, r.Header.Get("X-Slack-Request-Timestamp"),
+		r.Header.Get("X-Slack-Signature"), body, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid form body", http.StatusBadRequest)
+		return
+	}
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	// Slack expects a response within 3 seconds; failures are reported in
+	// the alert thread instead of the HTTP response
+	w.WriteHeader(http.StatusOK)
+
+	if interaction.Type != "block_actions" {
+		return
+	}
+	caller := "slack:" + interaction.User.Username
+	if interaction.User.Username == "" {
+		caller = "slack:" + interaction.User.ID
+	}
+
+	for _, action := range interaction.Actions {
+		var statuses []string
+		switch action.ActionID {
+		case notifier.SlackActionAcknowledge:
+			statuses = []string{models.StatusInvestigating}
+		case notifier.SlackActionFalsePositive:
+			statuses = []string{models.StatusInvestigating, models.StatusFalsePositive}
+		default:
+			continue
+		}
+
+		message := s.applySlackAction(r, action.Value, caller, statuses)
+		if s.slack != nil && interaction.Channel.ID != "" && interaction.Message.TS != "" {
+			if err := s.slack.ReplyInThread(r.Context(), interaction.Channel.ID, interaction.Message.TS, message); err != nil {
+				log.Printf("alert %s: failed to reply in Slack thread: %v", action.Value, err)
+			}
+		}
+	}
+}
+
+// applySlackAction walks an alert through statuses, skipping those it has
+// already reached, and returns the message to post in the alert thread
+func (s *Server) applySlackAction(r *http.Request, id, caller string, statuses []string) string {
+	var alert *models.Alert
+	for _, status := range statuses {
+		current, err := s.store.GetAlert(r.Context(), id)
+		if err != nil {
+			return s.slackActionFailed(id, err)
+		}
+		if current.Status == status {
+			alert = current
+			continue
+		}
+		if !models.CanTransition(current.Status, status) {
+			return fmt.Sprintf("Alert is already *%s*", current.Status)
+		}
+
+		alert, err = s.transition(r.Context(), id, status, caller, "", nil)
+		if err != nil {
+			return s.slackActionFailed(id, err)
+		}
+	}
+	return statusMessage(alert)
+}
+
+// slackActionFailed logs a failed button action and describes it for Slack
+func (s *Server) slackActionFailed(id string, err error) string {
+	var invalid *invalidTransitionError
+	switch {
+	case errors.Is(err, storage.ErrAlertNotFound):
+		return "Alert not found"
+	case errors.As(err, &invalid):
+		return "Cannot update alert: " + invalid.Error()
+	case errors.Is(err, storage.ErrStatusConflict):
+		return "Alert was updated concurrently, try again"
+	}
+	log.Printf("alert %s: failed to apply Slack action: %v", id, err)
+	return "Failed to update alert"
+}
+
+// verifySlackSignature checks a request signed with the Slack signing
+// secret: v0=HMAC-SHA256(secret, "v0:" + timestamp + ":" + body)
+func verifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if secret == "" {
+		return errors.New("slack signing secret not configured")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid request timestamp")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return errors.New("request timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid request signature")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// slackSignature signs body as Slack does at timestamp
+func slackSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// interactionRequest returns a Slack interaction request carrying payload,
+// signed with secret at timestamp
+func interactionRequest(secret string, timestamp time.Time, payload string) *http.Request {
+	body := url.Values{"payload": {payload}}.Encode()
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/slack/interactions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", slackSignature(secret, ts, body))
+	return r
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := "payload=%7B%22type%22%3A%22block_actions%22%7D"
+	valid := slackSignature(testSigningSecret, ts, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		want      string
+	}{
+		{"valid", testSigningSecret, ts, valid, body, ""},
+		{"signed with another secret", testSigningSecret, ts, slackSignature("other-secret", ts, body), body, "invalid request signature"},
+		{"tampered body", testSigningSecret, ts, valid, body + "&x=1", "invalid request signature"},
+		{"signature of another timestamp", testSigningSecret, strconv.FormatInt(now.Unix()-1, 10), valid, body, "invalid request signature"},
+		{"missing signature", testSigningSecret, ts, "", body, "invalid request signature"},
+		{"unversioned signature", testSigningSecret, ts, strings.TrimPrefix(valid, "v0="), body, "invalid request signature"},
+		{"replayed after five minutes", testSigningSecret, strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10),
+			slackSignature(testSigningSecret, strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), body), body, "request timestamp too old"},
+		{"from the future", testSigningSecret, strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10),
+			slackSignature(testSigningSecret, strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), body), body, "request timestamp too old"},
+		{"within the clock skew", testSigningSecret, strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10),
+			slackSignature(testSigningSecret, strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), body), body, ""},
+		{"malformed timestamp", testSigningSecret, "yesterday", valid, body, "invalid request timestamp"},
+		{"no signing secret", "", ts, valid, body, "slack signing secret not configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySlackSignature(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), now)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("verifySlackSignature = %v, want it accepted", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("verifySlackSignature = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlackInteractionsHandler(t *testing.T) {
+	s := &Server{slackSigningSecret: testSigningSecret}
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{"signed interaction", interactionRequest(testSigningSecret, time.Now(), `{"type":"view_submission"}`), http.StatusOK},
+		{"forged signature", interactionRequest("other-secret", time.Now(), `{"type":"block_actions"}`), http.StatusUnauthorized},
+		{"replayed request", interactionRequest(testSigningSecret, time.Now().Add(-time.Hour), `{"type":"block_actions"}`), http.StatusUnauthorized},
+		{"invalid payload", interactionRequest(testSigningSecret, time.Now(), `{"type":`), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.SlackInteractionsHandler(w, tt.request)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	unconfigured := &Server{}
+	w := httptest.NewRecorder()
+	unconfigured.SlackInteractionsHandler(w, interactionRequest("", time.Now(), `{"type":"block_actions"}`))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status without a signing secret = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
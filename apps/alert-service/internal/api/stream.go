@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/stream"
+)
+
+// heartbeatInterval is how often an idle stream sends a comment, so proxies
+// do not close it
+const heartbeatInterval = 15 * time.Second
+
+// validSeverities are the severities a stream can be filtered by
+var validSeverities = map[string]bool{
+	models.SeverityLow:      true,
+	models.SeverityMedium:   true,
+	models.SeverityHigh:     true,
+	models.SeverityCritical: true,
+}
+
+// StreamAlertsHandler streams newly raised alerts as server-sent events.
+// The severity query parameter takes a comma-separated list of severities.
+// A client reconnecting with Last-Event-ID first receives the alerts it
+// missed that are still in the stream's ring. Only alerts of the caller's
+// tenant are streamed unless the caller is an admin.
+func (s *Server) StreamAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	var severities []string
+	if value := r.URL.Query().Get("severity"); value != "" {
+		for _, severity := range strings.Split(value, ",") {
+			severity = strings.TrimSpace(severity)
+			if !validSeverities[severity] {
+				http.Error(w, fmt.Sprintf("invalid severity %q", severity), http.StatusBadRequest)
+				return
+			}
+			severities = append(severities, severity)
+		}
+	}
+
+	tenantID := tenantScope(r)
+
+	var lastID int64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the ring so no alert falls between the two
+	sub := s.stream.Subscribe(severities...)
+	defer s.stream.Unsubscribe(sub)
+
+	var missed []stream.Event
+	if lastID > 0 {
+		events, err := s.stream.Since(r.Context(), lastID)
+		if err != nil {
+			log.Printf("failed to read alert stream: %v", err)
+			http.Error(w, "failed to resume alert stream", http.StatusInternalServerError)
+			return
+		}
+		missed = events
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if !sub.Matches(event.Alert.Severity) || !inScope(event.Alert, tenantID) {
+			continue
+		}
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+		lastID = event.ID
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Fell behind or shutting down; the client reconnects and
+				// resumes
+				return
+			}
+			if event.ID <= lastID || !inScope(event.Alert, tenantID) {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes an alert as an event named alert
+func writeEvent(w http.ResponseWriter, event stream.Event) error {
+	data, err := json.Marshal(event.Alert)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: alert\ndata: %s\n\n", event.ID, data)
+	return err
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/stream"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sseEvent is one server-sent event of the alert stream
+type sseEvent struct {
+	id    int64
+	name  string
+	alert models.Alert
+}
+
+// openStream connects to the alert stream of srv with query, resuming after
+// lastEventID when set, and returns the response and its event reader
+func openStream(t *testing.T, srv *httptest.Server, query, authorization, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/alerts/stream"+query, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// nextEvent reads the next event of the stream, skipping comments
+func nextEvent(t *testing.T, body *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.name != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id, err = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			if err != nil {
+				t.Fatalf("invalid event id %q", line)
+			}
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.alert); err != nil {
+				t.Fatalf("invalid event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// streamServer serves the alerts API streaming from broker
+func streamServer(t *testing.T, broker *stream.Broker) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(NewServer(nil, nil, nil, nil, nil, broker, nil, "", testAuth()).Router())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// raise publishes alerts of the given severities, with IDs a-1, a-2...
+func raise(t *testing.T, broker *stream.Broker, severities ...string) {
+	t.Helper()
+	for _, severity := range severities {
+		events, _ := broker.Since(context.Background(), 0)
+		id := "a-" + strconv.Itoa(len(events)+1)
+		if err := broker.Publish(context.Background(), &models.Alert{ID: id, Severity: severity}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+}
+
+// gaugeValue returns the value of the unlabelled gauge name in the default
+// registry
+func gaugeValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// waitForSubscribers waits until the stream has n subscribers
+func waitForSubscribers(t *testing.T, n float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := gaugeValue(t, "alert_stream_subscribers")
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v stream subscribers, want %v", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamResumesFromTheLastEvent(t *testing.T) {
+	broker := stream.NewBroker(nil, 100)
+	srv := streamServer(t, broker)
+	raise(t, broker, models.SeverityLow, models.SeverityHigh, models.SeverityLow)
+
+	resp, body := openStream(t, srv, "", bearer(t, "auditor-1", "auditor"), "1")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET stream = %d %s, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	// The alerts missed since event 1 come first, then the live ones
+	for _, want := range []int64{2, 3} {
+		if e := nextEvent(t, body); e.id != want || e.name != "alert" || e.alert.ID != "a-"+strconv.FormatInt(want, 10) {
+			t.Errorf("replayed event %+v, want %d", e, want)
+		}
+	}
+	waitForSubscribers(t, 1)
+	raise(t, broker, models.SeverityCritical)
+	if e := nextEvent(t, body); e.id != 4 || e.alert.ID != "a-4" {
+		t.Errorf("live event %+v, want 4", e)
+	}
+}
+
+func TestStreamFiltersBySeverity(t *testing.T) {
+	broker := stream.NewBroker(nil, 100)
+	srv := streamServer(t, broker)
+	raise(t, broker, models.SeverityLow, models.SeverityCritical, models.SeverityMedium)
+
+	_, body := openStream(t, srv, "?severity=high,critical", bearer(t, "admin-1", "admin"), "0")
+	waitForSubscribers(t, 1)
+	raise(t, broker, models.SeverityLow, models.SeverityHigh)
+
+	// A Last-Event-ID of 0 replays nothing; the filter applies to live events
+	if e := nextEvent(t, body); e.id != 5 || e.alert.Severity != models.SeverityHigh {
+		t.Errorf("event %+v, want the high alert 5", e)
+	}
+
+	// The filter applies to replayed events too
+	_, body = openStream(t, srv, "?severity=medium", bearer(t, "admin-1", "admin"), "1")
+	if e := nextEvent(t, body); e.id != 3 || e.alert.Severity != models.SeverityMedium {
+		t.Errorf("replayed event %+v, want the medium alert 3", e)
+	}
+}
+
+func TestStreamScopesToTheCallerTenant(t *testing.T) {
+	broker := stream.NewBroker(nil, 100)
+	srv := streamServer(t, broker)
+	for _, tenantID := range []string{"unit-a", "unit-b"} {
+		if err := broker.Publish(context.Background(), &models.Alert{ID: tenantID, TenantID: tenantID, Severity: models.SeverityHigh}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		UserID:   "auditor-b",
+		Roles:    []string{"auditor"},
+		TenantID: "unit-b",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	// EventSource cannot set headers, so the token may be in the query
+	_, body := openStream(t, srv, "?tenant_id=unit-a&access_token="+signed, "", "0")
+	waitForSubscribers(t, 1)
+	raise(t, broker, models.SeverityHigh)
+	if err := broker.Publish(context.Background(), &models.Alert{ID: "unit-b-live", TenantID: "unit-b", Severity: models.SeverityHigh}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if e := nextEvent(t, body); e.alert.ID != "unit-b-live" {
+		t.Errorf("event %+v, want only the caller's tenant", e)
+	}
+}
+
+func TestStreamRejectsInvalidRequests(t *testing.T) {
+	srv := streamServer(t, stream.NewBroker(nil, 10))
+
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		lastEventID   string
+		want          int
+	}{
+		{"anonymous", "", "", "", http.StatusUnauthorized},
+		{"user", "", bearer(t, "user-1", "user"), "", http.StatusForbidden},
+		{"unknown severity", "?severity=high,urgent", bearer(t, "admin-1", "admin"), "", http.StatusBadRequest},
+		{"invalid Last-Event-ID", "", bearer(t, "admin-1", "admin"), "latest", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp, _ := openStream(t, srv, tt.query, tt.authorization, tt.lastEventID); resp.StatusCode != tt.want {
+				t.Errorf("GET stream = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamTearsDownWithTheClient(t *testing.T) {
+	broker := stream.NewBroker(nil, 10)
+	srv := streamServer(t, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/alerts/stream", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	r.Header.Set("Authorization", bearer(t, "admin-1", "admin"))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	defer resp.Body.Close()
+	waitForSubscribers(t, 1)
+
+	cancel()
+	waitForSubscribers(t, 0)
+
+	// A broker shutting down ends the streams it serves
+	_, body := openStream(t, srv, "", bearer(t, "admin-1", "admin"), "")
+	waitForSubscribers(t, 1)
+	broker.Close()
+	if _, err := body.ReadString('\n'); err == nil {
+		t.Error("stream still open after the broker closed")
+	}
+}
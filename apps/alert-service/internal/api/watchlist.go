@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// watchlistRequest is the body of a watchlist addition. A null expires_at
+// never expires.
+type watchlistRequest struct {
+	AccountID string     `json:"account_id"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// AddWatchlistEntryHandler watchlists an account on behalf of the caller.
+// Watchlisting an account again replaces its reason and expiry.
+func (s *Server) AddWatchlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var req watchlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.AccountID = strings.TrimSpace(req.AccountID)
+	req.Reason = strings.TrimSpace(req.Reason)
+	switch {
+	case req.AccountID == "":
+		http.Error(w, "account_id is required", http.StatusBadRequest)
+		return
+	case req.Reason == "":
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	case req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()):
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	entry := &models.WatchlistEntry{
+		AccountID: req.AccountID,
+		Reason:    req.Reason,
+		ExpiresAt: req.ExpiresAt,
+	}
+	inserted, err := s.store.UpsertWatchlistEntry(r.Context(), actor(r), entry)
+	if err != nil {
+		log.Printf("failed to add watchlist entry: %v", err)
+		http.Error(w, "failed to add watchlist entry", http.StatusInternalServerError)
+		return
+	}
+	if s.watchlist != nil {
+		s.watchlist.Invalidate(r.Context(), entry.AccountID)
+	}
+
+	log.Printf("account %s watchlisted by %s: %s", entry.AccountID, entry.CreatedBy, entry.Reason)
+	status := http.StatusOK
+	if inserted {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, entry)
+}
+
+// ListWatchlistHandler lists the watchlisted accounts, with
+// include_expired=true also those whose entry has expired
+func (s *Server) ListWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var includeExpired bool
+	if value := r.URL.Query().Get("include_expired"); value != "" {
+		var err error
+		if includeExpired, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "invalid include_expired flag", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.store.ListWatchlist(r.Context(), time.Now(), includeExpired)
+	if err != nil {
+		log.Printf("failed to list watchlist: %v", err)
+		http.Error(w, "failed to list watchlist", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// RemoveWatchlistEntryHandler removes an account from the watchlist
+func (s *Server) RemoveWatchlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["account_id"]
+
+	err := s.store.RemoveWatchlistEntry(r.Context(), actor(r), accountID)
+	if errors.Is(err, storage.ErrWatchlistEntryNotFound) {
+		http.Error(w, "watchlist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to remove watchlist entry: %v", err)
+		http.Error(w, "failed to remove watchlist entry", http.StatusInternalServerError)
+		return
+	}
+	if s.watchlist != nil {
+		s.watchlist.Invalidate(r.Context(), accountID)
+	}
+
+	log.Printf("account %s removed from the watchlist by %s", accountID, actor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddWatchlistEntryValidation(t *testing.T) {
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"malformed body", `{"account_id": `, "invalid request body"},
+		{"no account", `{"reason": "case 118"}`, "account_id is required"},
+		{"blank account", `{"account_id": "  ", "reason": "case 118"}`, "account_id is required"},
+		{"no reason", `{"account_id": "acct-1"}`, "reason is required"},
+		{"blank reason", `{"account_id": "acct-1", "reason": " "}`, "reason is required"},
+		{"already expired", fmt.Sprintf(`{"account_id": "acct-1", "reason": "case 118", "expires_at": %q}`, past), "expires_at must be in the future"},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/watchlist", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			s.AddWatchlistEntryHandler(w, r)
+			if w.Code != http.StatusBadRequest || strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("POST = %d %q, want 400 %q", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+func TestListWatchlistRejectsABadFlag(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/watchlist?include_expired=sometimes", nil)
+	w := httptest.NewRecorder()
+	(&Server{}).ListWatchlistHandler(w, r)
+	if w.Code != http.StatusBadRequest || strings.TrimSpace(w.Body.String()) != "invalid include_expired flag" {
+		t.Errorf("GET = %d %q, want 400", w.Code, w.Body.String())
+	}
+}
@@ -1,84 +1,693 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
 )
 
+// DevEnvironment is the APP_ENV value that accepts placeholder secrets
+const DevEnvironment = "development"
+
+// defaultJWTSecret is the placeholder secret, refused outside development
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 // Config holds all configuration for the alert service
 type Config struct {
+	// Environment is the APP_ENV the service runs in
+	Environment string
+
 	// Kafka configuration
-	KafkaBrokers  string
-	InputTopic    string
-	ConsumerGroup string
+	KafkaBrokers    string
+	ConsumerGroup   string
+	QuarantineTopic string // input messages of unknown schema versions
+	InputDLQTopic   string // input messages that do not decode
+	KafkaSecurity   kafkaconn.Config
+
+	// KafkaTopics provisions the topics the service produces to at
+	// startup, when TOPIC_AUTOCREATE is set
+	KafkaTopics kafkaconn.TopicsConfig
+
+	// InputTopics, from KAFKA_INPUT_TOPICS or else the single
+	// KAFKA_INPUT_TOPIC, are consumed by one reader each, all in
+	// ConsumerGroup, so operational alert topics progress independently of
+	// transactions
+	InputTopics []string
 
 	// Notification configuration
-	SlackWebhook  string
-	EmailSMTP     string
-	EmailFrom     string
-	EmailPassword string
-	EmailTo       []string
+	SlackWebhook       string
+	SlackWebhooks      map[string]string // logical channel (e.g. fraud) -> webhook URL
+	SlackBotToken      string            // when set, Slack is posted via chat.postMessage so alerts can be threaded
+	SlackChannel       string
+	SlackSigningSecret string // verifies clicks on alert buttons in bot token mode
+	EmailSMTP          string
+	EmailFrom          string
+	EmailPassword      string
+	EmailTo            []string
 
-	// Alert rules configuration
+	// Alert rules configuration. AmountThreshold is set in BaseCurrency.
 	RiskThreshold      float64
 	AmountThreshold    float64
-	FrequencyThreshold int // alerts per hour
+	FrequencyThreshold int // alerts per hour per account; 0 disables the limit
+	// RateLimitBypassCritical exempts critical alerts from the account rate limit
+	RateLimitBypassCritical bool
+
+	// Exchange rates converting amounts the processing service did not into
+	// BaseCurrency. The rates come from ExchangeRatesFile, or the built-in
+	// defaults without one, and are refreshed from ExchangeRatesURL every
+	// ExchangeRatesRefresh when it is set, the last good rates serving while
+	// it fails.
+	BaseCurrency         string
+	ExchangeRatesFile    string
+	ExchangeRatesURL     string
+	ExchangeRatesRefresh int // in minutes
+
+	// Watchlist configuration. Every processed transaction on a watchlisted
+	// account raises an alert of WatchlistSeverity, exempt from the account
+	// rate limit when WatchlistBypassRateLimit is set. Lookups are cached in
+	// Redis for WatchlistCacheTTL.
+	WatchlistEnabled         bool
+	WatchlistSeverity        string
+	WatchlistBypassRateLimit bool
+	WatchlistCacheTTL        int // in seconds
+
+	// Account context enrichment. Alerts are enriched before they are sent
+	// with the account's activity over EnrichmentWindowDays, read from the
+	// storage API at StorageAPIURL with StorageAPIToken and cached in Redis
+	// for EnrichmentCacheTTL. A lookup taking over EnrichmentTimeout is
+	// abandoned and the alert sent without it. An empty StorageAPIURL
+	// disables enrichment.
+	StorageAPIURL        string
+	StorageAPIToken      string
+	EnrichmentTimeout    int // in milliseconds
+	EnrichmentCacheTTL   int // in seconds
+	EnrichmentWindowDays int
+
+	// Incident correlation. Alerts sharing an IncidentCorrelation key, the
+	// account or the account and rule, each raised within IncidentWindow of
+	// the last are grouped into an incident, their follow-ups posted in its
+	// Slack threads. IncidentCorrelation none disables it.
+	IncidentCorrelation string
+	IncidentWindow      int // in minutes
 
-	// Service configuration
-	BatchSize      int
-	MaxRetries     int
-	ProcessTimeout int // in seconds
+	// Database configuration
+	DBHost     string
+	DBPort     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBSSLMode  string
+	DBUrl      string
+
+	// Rule engine configuration. Rules are read from AlertRulesFile when set,
+	// otherwise from the alert_rules table. Table rules are reloaded as they
+	// change and every RulesReloadInterval.
+	AlertRulesFile      string
+	RulesEvaluateAll    bool
+	RulesReloadInterval int // in seconds
+
+	// SeverityPolicyFile is a JSON severity policy mapping alert types and
+	// rules to severities; without one severity follows the risk level
+	SeverityPolicyFile string
+
+	// HTTP API configuration
+	HTTPPort  string
+	JWTSecret string
+
+	// JWTKeyID is the key ID of JWTSecret; tokens naming one of
+	// JWTPreviousSecrets, a map of key ID to secret, still validate during
+	// a rotation
+	JWTKeyID           string
+	JWTPreviousSecrets map[string]string
+
+	// StreamReplaySize is how many recent alerts the alert stream keeps for
+	// clients resuming with Last-Event-ID
+	StreamReplaySize int
+
+	// Service configuration. Transactions are handled by ConsumerWorkers
+	// goroutines, one account per worker at a time, with at most BatchSize
+	// of them in flight. On shutdown, alerts being handled get
+	// ShutdownTimeout to finish before they are abandoned.
+	BatchSize       int
+	ConsumerWorkers int
+	MaxRetries      int
+	ProcessTimeout  int // in seconds
+	ShutdownTimeout int // in seconds
+
+	// StartupTimeout bounds the wait for Postgres and Kafka at startup
+	StartupTimeout int // in seconds
+
+	// ShutdownDeadline bounds the whole shutdown, past which the components
+	// not yet stopped are abandoned and the service exits with an error. It
+	// must leave the consumers their ShutdownTimeout.
+	ShutdownDeadline int // in seconds
+
+	// Notification delivery. Each attempt times out after NotifyTimeout; the
+	// wait between retries starts at RetryBackoff and doubles. Deliveries
+	// failing every attempt are parked on DLQTopic.
+	NotifyTimeout int // in seconds
+	RetryBackoff  int // in milliseconds
+	DLQTopic      string
 
 	// Monitoring configuration
 	MetricsEnabled bool
 	MetricsPort    string
 
+	// AdminToken authenticates the consumer pause and resume endpoints on
+	// the metrics listener, which are disabled without one
+	AdminToken string
+
 	// Alert channels
 	EnableSlack   bool
 	EnableEmail   bool
 	EnableWebhook bool
 	WebhookURL    string
+
+	// Local development channels: alerts printed to stdout, or appended to
+	// NotifyFilePath as NDJSON, in place of a real Slack webhook
+	EnableConsole  bool
+	EnableFile     bool
+	NotifyFilePath string
+
+	// PagerDuty configuration; critical alerts page on-call when enabled
+	EnablePagerDuty     bool
+	PagerDutyRoutingKey string
+
+	// SMS configuration; critical alerts are texted through Twilio when
+	// enabled, at most SMSMaxPerHour messages an hour (0 for no cap)
+	EnableSMS        bool
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	SMSFrom          string
+	SMSTo            []string
+	SMSMaxPerHour    int
+
+	// Digest configuration
+	DigestInterval int // in minutes
+
+	// Redis configuration, used to persist the pending digest
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// Message templates. Files in TemplateDir override the built-in
+	// defaults; times are rendered in TemplateTimezone.
+	TemplateDir      string
+	TemplateTimezone string
+
+	// Maintenance configuration. MaintenanceWindows lists static windows
+	// separated by ";", either "start/end" in RFC 3339 or a cron expression
+	// and duration such as "0 2 * * 0 4h". QuietHours mutes severities daily,
+	// e.g. "low=22:00-08:00,medium=23:00-07:00". Both are read in
+	// MaintenanceTimezone.
+	MaintenanceWindows  string
+	MaintenanceRefresh  int // in seconds
+	QuietHours          string
+	MaintenanceTimezone string
+
+	// RoutingPolicyFile is a JSON routing policy; without one every alert
+	// goes to all enabled channels
+	RoutingPolicyFile string
+
+	// Retention configuration. Every RetentionInterval, resolved alerts are
+	// archived to NDJSON in ArchiveDir and deleted with their notifications,
+	// RetentionBatchSize at a time, once resolved for RetentionDays or the
+	// days RetentionDaysBySeverity sets for their severity; zero keeps
+	// them. Open alerts are never deleted: once a week those open for over
+	// StaleOpenAlertDays are posted in a digest, zero disabling it. In
+	// RetentionDryRun the expired alerts are only counted.
+	RetentionDays           int            // in days
+	RetentionDaysBySeverity map[string]int // in days
+	RetentionBatchSize      int
+	RetentionInterval       int // in minutes
+	RetentionDryRun         bool
+	ArchiveDir              string
+	StaleOpenAlertDays      int // in days
+
+	// Secret rotation. The secret files, empty when the secrets are set
+	// directly, are polled every SecretsReloadInterval.
+	JWTSecretFile         string
+	DBPasswordFile        string
+	SecretsReloadInterval int // in seconds
+
+	// LogSampleRate logs one in this many handled messages at info level
+	LogSampleRate int
+
+	// AllowedTenants lists the tenants, besides the default one, reported
+	// under their own metric label
+	AllowedTenants tenant.Set
+
+	// LogConfigOnStart logs the effective configuration, secrets redacted
+	LogConfigOnStart bool
+
+	// parseErrors lists environment values that could not be parsed
+	parseErrors []error
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from environment variables. Values that
+// cannot be parsed fall back to their defaults and are reported by Validate.
 func LoadConfig() *Config {
+	envErrors = nil
 	cfg := &Config{
+		Environment: getEnv("APP_ENV", "production"),
+
 		// Kafka configuration
-		KafkaBrokers:  getEnv("KAFKA_BROKERS", "localhost:9092"),
-		InputTopic:    getEnv("KAFKA_INPUT_TOPIC", "transactions.processed"),
-		ConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "alert-service"),
+		KafkaBrokers:    getEnv("KAFKA_BROKERS", "localhost:9092"),
+		InputTopics:     getEnvAsSlice("KAFKA_INPUT_TOPICS", []string{getEnv("KAFKA_INPUT_TOPIC", "transactions.processed")}),
+		ConsumerGroup:   getEnv("KAFKA_CONSUMER_GROUP", "alert-service"),
+		QuarantineTopic: getEnv("KAFKA_QUARANTINE_TOPIC", "alerts.quarantine"),
+		InputDLQTopic:   getEnv("KAFKA_INPUT_DLQ_TOPIC", "alerts.input.dlq"),
+		KafkaSecurity:   kafkaconn.LoadConfig(),
+		KafkaTopics:     kafkaconn.LoadTopicsConfig(),
 
 		// Notification configuration
-		SlackWebhook:  getEnv("SLACK_WEBHOOK", ""),
-		EmailSMTP:     getEnv("EMAIL_SMTP", "smtp.gmail.com:587"),
-		EmailFrom:     getEnv("EMAIL_FROM", "alerts@barclays.com"),
-		EmailPassword: getEnv("EMAIL_PASSWORD", ""),
-		EmailTo:       getEnvAsSlice("EMAIL_TO", []string{"fraud@barclays.com"}),
+		SlackWebhook:       getSecret("SLACK_WEBHOOK", ""),
+		SlackWebhooks:      getEnvAsMap("SLACK_WEBHOOKS"),
+		SlackBotToken:      getSecret("SLACK_BOT_TOKEN", ""),
+		SlackChannel:       getEnv("SLACK_CHANNEL", ""),
+		SlackSigningSecret: getSecret("SLACK_SIGNING_SECRET", ""),
+		EmailSMTP:          getEnv("EMAIL_SMTP", "smtp.gmail.com:587"),
+		EmailFrom:          getEnv("EMAIL_FROM", "alerts@barclays.com"),
+		EmailPassword:      getSecret("EMAIL_PASSWORD", ""),
+		EmailTo:            getEnvAsSlice("EMAIL_TO", []string{"fraud@barclays.com"}),
 
 		// Alert rules configuration
-		RiskThreshold:      getEnvAsFloat("RISK_THRESHOLD", 0.7),
-		AmountThreshold:    getEnvAsFloat("AMOUNT_THRESHOLD", 10000.0),
-		FrequencyThreshold: getEnvAsInt("FREQUENCY_THRESHOLD", 5),
+		RiskThreshold:           getEnvAsFloat("RISK_THRESHOLD", 0.7),
+		AmountThreshold:         getEnvAsFloat("AMOUNT_THRESHOLD", 10000.0),
+		FrequencyThreshold:      getEnvAsInt("FREQUENCY_THRESHOLD", 5),
+		RateLimitBypassCritical: getEnvAsBool("RATE_LIMIT_BYPASS_CRITICAL", true),
+
+		// Exchange rates
+		BaseCurrency:         getEnv("BASE_CURRENCY", "USD"),
+		ExchangeRatesFile:    getEnv("EXCHANGE_RATES_FILE", ""),
+		ExchangeRatesURL:     getEnv("EXCHANGE_RATES_URL", ""),
+		ExchangeRatesRefresh: getEnvAsInt("EXCHANGE_RATES_REFRESH_MINUTES", 60),
+
+		// Watchlist configuration
+		WatchlistEnabled:         getEnvAsBool("WATCHLIST_ENABLED", true),
+		WatchlistSeverity:        getEnv("WATCHLIST_SEVERITY", "high"),
+		WatchlistBypassRateLimit: getEnvAsBool("WATCHLIST_BYPASS_RATE_LIMIT", true),
+		WatchlistCacheTTL:        getEnvAsInt("WATCHLIST_CACHE_TTL_SECONDS", 60),
+
+		// Account context enrichment
+		StorageAPIURL:        getEnv("STORAGE_API_URL", ""),
+		StorageAPIToken:      getSecret("STORAGE_API_TOKEN", ""),
+		EnrichmentTimeout:    getEnvAsInt("ENRICHMENT_TIMEOUT_MS", 300),
+		EnrichmentCacheTTL:   getEnvAsInt("ENRICHMENT_CACHE_TTL_SECONDS", 300),
+		EnrichmentWindowDays: getEnvAsInt("ENRICHMENT_WINDOW_DAYS", 30),
+
+		// Incident correlation
+		IncidentCorrelation: getEnv("INCIDENT_CORRELATION_KEY", models.CorrelateAccount),
+		IncidentWindow:      getEnvAsInt("INCIDENT_WINDOW_MINUTES", 10),
+
+		// Database configuration
+		DBHost:     getEnv("DB_HOST", "localhost"),
+		DBPort:     getEnv("DB_PORT", "5432"),
+		DBUser:     getEnv("DB_USER", "postgres"),
+		DBPassword: getSecret("DB_PASSWORD", "password"),
+		DBName:     getEnv("DB_NAME", "barclays_tx"),
+		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
+
+		// Rule engine configuration
+		AlertRulesFile:      getEnv("ALERT_RULES_FILE", ""),
+		RulesEvaluateAll:    getEnvAsBool("RULES_EVALUATE_ALL", false),
+		RulesReloadInterval: getEnvAsInt("RULES_RELOAD_SECONDS", 30),
+		SeverityPolicyFile:  getEnv("SEVERITY_POLICY_FILE", ""),
+
+		// HTTP API configuration
+		HTTPPort:  getEnv("HTTP_PORT", "8083"),
+		JWTSecret: getSecret("JWT_SECRET", defaultJWTSecret),
+
+		JWTKeyID:           getEnv("JWT_KEY_ID", "default"),
+		JWTPreviousSecrets: getSecretKeys("JWT_PREVIOUS_SECRETS"),
+
+		StreamReplaySize: getEnvAsInt("ALERT_STREAM_REPLAY_SIZE", 500),
 
 		// Service configuration
-		BatchSize:      getEnvAsInt("BATCH_SIZE", 100),
-		MaxRetries:     getEnvAsInt("MAX_RETRIES", 3),
-		ProcessTimeout: getEnvAsInt("PROCESS_TIMEOUT", 30),
+		BatchSize:       getEnvAsInt("BATCH_SIZE", 100),
+		ConsumerWorkers: getEnvAsInt("CONSUMER_WORKERS", 8),
+		MaxRetries:      getEnvAsInt("MAX_RETRIES", 3),
+		ProcessTimeout:  getEnvAsInt("PROCESS_TIMEOUT", 30),
+		ShutdownTimeout: getEnvAsInt("SHUTDOWN_TIMEOUT", 30),
+		StartupTimeout:  getEnvAsInt("STARTUP_TIMEOUT", 60),
+
+		ShutdownDeadline: getEnvAsInt("SHUTDOWN_DEADLINE", 60),
+
+		// Notification delivery
+		NotifyTimeout: getEnvAsInt("NOTIFY_TIMEOUT", 10),
+		RetryBackoff:  getEnvAsInt("RETRY_BACKOFF_MS", 500),
+		DLQTopic:      getEnv("KAFKA_DLQ_TOPIC", "alerts.dlq"),
 
 		// Monitoring configuration
 		MetricsEnabled: getEnvAsBool("METRICS_ENABLED", true),
 		MetricsPort:    getEnv("METRICS_PORT", "9093"),
+		AdminToken:     getSecret("ADMIN_TOKEN", ""),
 
 		// Alert channels
 		EnableSlack:   getEnvAsBool("ENABLE_SLACK", true),
 		EnableEmail:   getEnvAsBool("ENABLE_EMAIL", false),
 		EnableWebhook: getEnvAsBool("ENABLE_WEBHOOK", false),
-		WebhookURL:    getEnv("WEBHOOK_URL", ""),
+		WebhookURL:    getSecret("WEBHOOK_URL", ""),
+
+		// Local development channels
+		EnableConsole:  getEnvAsBool("ENABLE_CONSOLE", false),
+		EnableFile:     getEnvAsBool("ENABLE_FILE", false),
+		NotifyFilePath: getEnv("NOTIFY_FILE_PATH", "alerts.ndjson"),
+
+		// PagerDuty configuration
+		EnablePagerDuty:     getEnvAsBool("ENABLE_PAGERDUTY", false),
+		PagerDutyRoutingKey: getSecret("PAGERDUTY_ROUTING_KEY", ""),
+
+		// SMS configuration
+		EnableSMS:        getEnvAsBool("ENABLE_SMS", false),
+		TwilioAccountSID: getEnv("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:  getSecret("TWILIO_AUTH_TOKEN", ""),
+		SMSFrom:          getEnv("SMS_FROM", ""),
+		SMSTo:            getEnvAsSlice("SMS_TO", nil),
+		SMSMaxPerHour:    getEnvAsInt("SMS_MAX_PER_HOUR", 50),
+
+		// Digest configuration
+		DigestInterval: getEnvAsInt("DIGEST_INTERVAL_MINUTES", 60),
+
+		// Redis configuration
+		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: getSecret("REDIS_PASSWORD", ""),
+		RedisDB:       getEnvAsInt("REDIS_DB", 0),
+
+		// Message templates
+		TemplateDir:      getEnv("TEMPLATE_DIR", ""),
+		TemplateTimezone: getEnv("TEMPLATE_TIMEZONE", "UTC"),
+
+		// Maintenance configuration
+		MaintenanceWindows:  getEnv("MAINTENANCE_WINDOWS", ""),
+		MaintenanceRefresh:  getEnvAsInt("MAINTENANCE_REFRESH_SECONDS", 30),
+		QuietHours:          getEnv("QUIET_HOURS", ""),
+		MaintenanceTimezone: getEnv("MAINTENANCE_TIMEZONE", "UTC"),
+
+		RoutingPolicyFile: getEnv("ROUTING_POLICY_FILE", ""),
+
+		// Retention configuration
+		RetentionDays:           getEnvAsInt("ALERT_RETENTION_DAYS", 365),
+		RetentionDaysBySeverity: getEnvAsIntMap("ALERT_RETENTION_DAYS_BY_SEVERITY", "critical=730"),
+		RetentionBatchSize:      getEnvAsInt("ALERT_RETENTION_BATCH_SIZE", 500),
+		RetentionInterval:       getEnvAsInt("ALERT_RETENTION_INTERVAL_MINUTES", 60),
+		RetentionDryRun:         getEnvAsBool("ALERT_RETENTION_DRY_RUN", false),
+		ArchiveDir:              getEnv("ALERT_ARCHIVE_DIR", "archive"),
+		StaleOpenAlertDays:      getEnvAsInt("STALE_OPEN_ALERT_DAYS", 30),
+
+		// Secret rotation
+		JWTSecretFile:         secrets.File("JWT_SECRET"),
+		DBPasswordFile:        secrets.File("DB_PASSWORD"),
+		SecretsReloadInterval: getEnvAsInt("SECRETS_RELOAD_SECONDS", 30),
+
+		AllowedTenants: tenant.Parse(getEnv("ALLOWED_TENANTS", "")),
+
+		LogSampleRate:    getEnvAsInt("LOG_SAMPLE_RATE", 100),
+		LogConfigOnStart: getEnvAsBool("LOG_CONFIG_ON_START", false),
 	}
+	cfg.parseErrors, envErrors = envErrors, nil
+
+	// Build database URL
+	cfg.DBUrl = buildDatabaseURL(cfg)
 
 	return cfg
 }
 
+// Validate checks the configuration and returns every problem found, joined
+// into one error
+func (c *Config) Validate() error {
+	problems := append([]error(nil), c.parseErrors...)
+
+	if c.Environment != DevEnvironment && (c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret) {
+		problems = append(problems, fmt.Errorf("JWT_SECRET must be set outside %s", DevEnvironment))
+	}
+	if c.JWTKeyID == "" {
+		problems = append(problems, errors.New("JWT_KEY_ID is empty"))
+	}
+	if _, ok := c.JWTPreviousSecrets[c.JWTKeyID]; ok {
+		problems = append(problems, fmt.Errorf("JWT_PREVIOUS_SECRETS must not include the current key %q", c.JWTKeyID))
+	}
+	if err := checkDatabaseURL(c.DBUrl); err != nil {
+		problems = append(problems, fmt.Errorf("database URL: %w", err))
+	}
+	if !hasBroker(c.KafkaBrokers) {
+		problems = append(problems, errors.New("KAFKA_BROKERS lists no brokers"))
+	}
+	if len(c.InputTopics) == 0 || slices.Contains(c.InputTopics, "") {
+		problems = append(problems, errors.New("KAFKA_INPUT_TOPICS lists no topics"))
+	} else if len(slices.Compact(slices.Sorted(slices.Values(c.InputTopics)))) != len(c.InputTopics) {
+		problems = append(problems, errors.New("KAFKA_INPUT_TOPICS lists a topic twice"))
+	}
+	if c.InputDLQTopic == "" {
+		problems = append(problems, errors.New("KAFKA_INPUT_DLQ_TOPIC must be set"))
+	} else if slices.Contains(c.InputTopics, c.InputDLQTopic) {
+		problems = append(problems, errors.New("KAFKA_INPUT_DLQ_TOPIC must not be an input topic"))
+	}
+	if err := c.KafkaTopics.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+
+	// Enabled channels need somewhere to deliver to
+	if c.EnableWebhook && c.WebhookURL == "" {
+		problems = append(problems, errors.New("ENABLE_WEBHOOK is set but WEBHOOK_URL is empty"))
+	}
+	if c.EnableFile && c.NotifyFilePath == "" {
+		problems = append(problems, errors.New("ENABLE_FILE is set but NOTIFY_FILE_PATH is empty"))
+	}
+	if c.EnableEmail && len(c.EmailTo) == 0 {
+		problems = append(problems, errors.New("ENABLE_EMAIL is set but EMAIL_TO is empty"))
+	}
+	if c.EnablePagerDuty && c.PagerDutyRoutingKey == "" {
+		problems = append(problems, errors.New("ENABLE_PAGERDUTY is set but PAGERDUTY_ROUTING_KEY is empty"))
+	}
+	if c.EnableSMS && (c.TwilioAccountSID == "" || c.TwilioAuthToken == "" || c.SMSFrom == "" || len(c.SMSTo) == 0) {
+		problems = append(problems, errors.New("ENABLE_SMS needs TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, SMS_FROM and SMS_TO"))
+	}
+
+	if c.RiskThreshold < 0 || c.RiskThreshold > 1 {
+		problems = append(problems, errors.New("RISK_THRESHOLD must be between 0 and 1"))
+	}
+	if _, ok := currency.Lookup(c.BaseCurrency); !ok {
+		problems = append(problems, fmt.Errorf("BASE_CURRENCY %q is not an ISO 4217 currency", c.BaseCurrency))
+	}
+	if c.ExchangeRatesURL != "" && c.ExchangeRatesRefresh < 1 {
+		problems = append(problems, errors.New("EXCHANGE_RATES_REFRESH_MINUTES must be positive"))
+	}
+	if c.WatchlistEnabled {
+		switch c.WatchlistSeverity {
+		case models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical:
+		default:
+			problems = append(problems, fmt.Errorf("WATCHLIST_SEVERITY: unknown severity %q", c.WatchlistSeverity))
+		}
+		if c.WatchlistCacheTTL < 1 {
+			problems = append(problems, errors.New("WATCHLIST_CACHE_TTL_SECONDS must be positive"))
+		}
+	}
+	if c.StorageAPIURL != "" {
+		if u, err := url.Parse(c.StorageAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("STORAGE_API_URL must be an http or https URL, got %q", c.StorageAPIURL))
+		}
+		if c.EnrichmentTimeout < 1 || c.EnrichmentCacheTTL < 1 {
+			problems = append(problems, errors.New("ENRICHMENT_TIMEOUT_MS and ENRICHMENT_CACHE_TTL_SECONDS must be positive"))
+		}
+		if c.EnrichmentWindowDays < 1 || c.EnrichmentWindowDays > 365 {
+			problems = append(problems, errors.New("ENRICHMENT_WINDOW_DAYS must be between 1 and 365"))
+		}
+	}
+	switch c.IncidentCorrelation {
+	case models.CorrelateNone:
+	case models.CorrelateAccount, models.CorrelateAccountRule:
+		if c.IncidentWindow < 1 {
+			problems = append(problems, errors.New("INCIDENT_WINDOW_MINUTES must be positive"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("INCIDENT_CORRELATION_KEY must be %s, %s or %s, got %q",
+			models.CorrelateAccount, models.CorrelateAccountRule, models.CorrelateNone, c.IncidentCorrelation))
+	}
+	if c.BatchSize < 1 {
+		problems = append(problems, errors.New("BATCH_SIZE must be positive"))
+	}
+	if c.ConsumerWorkers < 1 {
+		problems = append(problems, errors.New("CONSUMER_WORKERS must be positive"))
+	}
+	if c.MaxRetries < 0 {
+		problems = append(problems, errors.New("MAX_RETRIES must not be negative"))
+	}
+	if c.StartupTimeout < 1 {
+		problems = append(problems, errors.New("STARTUP_TIMEOUT must be positive"))
+	}
+	if c.ShutdownDeadline <= c.ShutdownTimeout {
+		problems = append(problems, errors.New("SHUTDOWN_DEADLINE must be longer than SHUTDOWN_TIMEOUT"))
+	}
+	if c.NotifyTimeout < 1 {
+		problems = append(problems, errors.New("NOTIFY_TIMEOUT must be positive"))
+	}
+	if _, err := time.LoadLocation(c.TemplateTimezone); err != nil {
+		problems = append(problems, fmt.Errorf("TEMPLATE_TIMEZONE: unknown time zone %q", c.TemplateTimezone))
+	}
+	if _, err := time.LoadLocation(c.MaintenanceTimezone); err != nil {
+		problems = append(problems, fmt.Errorf("MAINTENANCE_TIMEZONE: unknown time zone %q", c.MaintenanceTimezone))
+	}
+
+	if c.RetentionDays < 0 {
+		problems = append(problems, errors.New("ALERT_RETENTION_DAYS must not be negative"))
+	}
+	for severity, days := range c.RetentionDaysBySeverity {
+		switch severity {
+		case models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical:
+		default:
+			problems = append(problems, fmt.Errorf("ALERT_RETENTION_DAYS_BY_SEVERITY: unknown severity %q", severity))
+		}
+		if days < 0 {
+			problems = append(problems, fmt.Errorf("ALERT_RETENTION_DAYS_BY_SEVERITY: retention of %s must not be negative", severity))
+		}
+	}
+	if c.RetentionBatchSize < 1 {
+		problems = append(problems, errors.New("ALERT_RETENTION_BATCH_SIZE must be positive"))
+	}
+	if c.RetentionInterval < 1 {
+		problems = append(problems, errors.New("ALERT_RETENTION_INTERVAL_MINUTES must be positive"))
+	}
+	if c.ArchiveDir == "" {
+		problems = append(problems, errors.New("ALERT_ARCHIVE_DIR must be set"))
+	}
+	if c.StaleOpenAlertDays < 0 {
+		problems = append(problems, errors.New("STALE_OPEN_ALERT_DAYS must not be negative"))
+	}
+
+	if c.StreamReplaySize < 1 {
+		problems = append(problems, errors.New("ALERT_STREAM_REPLAY_SIZE must be positive"))
+	}
+	if c.LogSampleRate < 1 {
+		problems = append(problems, errors.New("LOG_SAMPLE_RATE must be positive"))
+	}
+	if c.SecretsReloadInterval < 1 {
+		problems = append(problems, errors.New("SECRETS_RELOAD_SECONDS must be positive"))
+	}
+
+	if err := buckets.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+// OutputTopics returns the specs of the topics the service produces to:
+// quarantined and undecodable input, and dead letters
+func (c *Config) OutputTopics() []kafkaconn.TopicSpec {
+	return c.KafkaTopics.Specs(c.QuarantineTopic, c.InputDLQTopic, c.DLQTopic)
+}
+
+// String renders the configuration with secrets redacted
+func (c Config) String() string {
+	type plain Config
+	p := plain(c)
+	p.SlackWebhook = redact(p.SlackWebhook)
+	p.SlackWebhooks = make(map[string]string, len(c.SlackWebhooks))
+	for channel, webhook := range c.SlackWebhooks {
+		p.SlackWebhooks[channel] = redact(webhook)
+	}
+	p.SlackBotToken = redact(p.SlackBotToken)
+	p.SlackSigningSecret = redact(p.SlackSigningSecret)
+	p.EmailPassword = redact(p.EmailPassword)
+	p.DBPassword = redact(p.DBPassword)
+	p.DBUrl = redactURL(p.DBUrl)
+	p.JWTSecret = redact(p.JWTSecret)
+	p.JWTPreviousSecrets = make(map[string]string, len(c.JWTPreviousSecrets))
+	for kid, secret := range c.JWTPreviousSecrets {
+		p.JWTPreviousSecrets[kid] = redact(secret)
+	}
+	p.AdminToken = redact(p.AdminToken)
+	p.StorageAPIToken = redact(p.StorageAPIToken)
+	p.WebhookURL = redact(p.WebhookURL)
+	p.PagerDutyRoutingKey = redact(p.PagerDutyRoutingKey)
+	p.TwilioAuthToken = redact(p.TwilioAuthToken)
+	p.RedisPassword = redact(p.RedisPassword)
+	p.parseErrors = nil
+	return fmt.Sprintf("%+v", p)
+}
+
+// checkDatabaseURL checks that a PostgreSQL URL names a host, user and
+// database
+func checkDatabaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("not a valid URL")
+	}
+	var missing []string
+	if u.Hostname() == "" {
+		missing = append(missing, "host")
+	}
+	if u.User.Username() == "" {
+		missing = append(missing, "user")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		missing = append(missing, "database name")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// redact hides a secret, keeping whether it was set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// redactURL hides the password in a URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redact(raw)
+	}
+	return u.Redacted()
+}
+
+// hasBroker reports whether a comma-separated broker list names a broker
+func hasBroker(brokers string) bool {
+	for _, b := range strings.Split(brokers, ",") {
+		if strings.TrimSpace(b) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDBPassword replaces the database password, after a rotation, and
+// rebuilds DBUrl
+func (c *Config) SetDBPassword(password string) {
+	c.DBPassword = password
+	c.DBUrl = buildDatabaseURL(c)
+}
+
+// buildDatabaseURL constructs the PostgreSQL connection string
+func buildDatabaseURL(cfg *Config) string {
+	if dbUrl := getSecret("DATABASE_URL", ""); dbUrl != "" {
+		return dbUrl
+	}
+
+	return "postgres://" + cfg.DBUser + ":" + cfg.DBPassword + "@" + cfg.DBHost + ":" + cfg.DBPort + "/" + cfg.DBName + "?sslmode=" + cfg.DBSSLMode
+}
+
+// envErrors collects the values the helpers fail to parse during LoadConfig
+var envErrors []error
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -87,37 +696,122 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getSecret reads a secret from key, or from the file named by key_FILE
+func getSecret(key, defaultValue string) string {
+	value, err := secrets.Lookup(key)
+	if err != nil {
+		envErrors = append(envErrors, err)
+		return defaultValue
+	}
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getSecretKeys reads a secret holding a comma-separated list of key ID and
+// secret pairs, each as kid:secret
+func getSecretKeys(key string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(getSecret(key, ""), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			envErrors = append(envErrors, fmt.Errorf("%s: entries must be kid:secret", key))
+			continue
+		}
+		keys[kid] = secret
+	}
+	return keys
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+			return defaultValue
 		}
+		return intValue
 	}
 	return defaultValue
 }
 
 func getEnvAsFloat(key string, defaultValue float64) float64 {
 	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a number", key, value))
+			return defaultValue
 		}
+		return floatValue
 	}
 	return defaultValue
 }
 
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a boolean", key, value))
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
 }
 
 func getEnvAsSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
-		// Simple comma-separated values
-		return []string{value}
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
 	}
 	return defaultValue
 }
+
+// getEnvAsIntMap parses "key=integer" pairs, falling back to the default
+// pairs when any is malformed
+func getEnvAsIntMap(key, defaultValue string) map[string]int {
+	parse := func(list string) (map[string]int, error) {
+		values := make(map[string]int)
+		for _, pair := range strings.Split(list, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if k = strings.TrimSpace(k); !ok || k == "" || err != nil {
+				return nil, fmt.Errorf("%s: %q is not key=integer", key, pair)
+			}
+			values[k] = n
+		}
+		return values, nil
+	}
+
+	values, err := parse(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, err)
+		values, _ = parse(defaultValue)
+	}
+	return values
+}
+
+// getEnvAsMap parses "key=value,key=value" pairs, skipping malformed ones
+func getEnvAsMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvAsSlice(key, nil) {
+		k, v, ok := strings.Cut(pair, "=")
+		if k, v = strings.TrimSpace(k), strings.TrimSpace(v); ok && k != "" && v != "" {
+			values[k] = v
+		}
+	}
+	return values
+}
@@ -0,0 +1,164 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/segmentio/kafka-go"
+)
+
+// maxBackoff caps the wait between redelivery attempts of a parked alert
+const maxBackoff = 5 * time.Minute
+
+// Message is a delivery parked on the dead letter queue after exhausting
+// its retries
+type Message struct {
+	Alert       *models.Alert        `json:"alert"`
+	Destination notifier.Destination `json:"destination"`
+	Error       string               `json:"error"`
+	ParkedAt    time.Time            `json:"parked_at"`
+}
+
+// Queue parks failed deliveries on a Kafka topic and redelivers them once
+// their channel recovers
+type Queue struct {
+	writer     *kafka.Writer
+	reader     *kafka.Reader
+	dispatcher *notifier.Dispatcher
+	store      *storage.Storage
+	backoff    time.Duration
+}
+
+// NewQueue creates a new dead letter queue on topic. Parked deliveries are
+// consumed by groupID and retried every backoff, doubling up to maxBackoff.
+func NewQueue(brokers, groupID, topic string, conn *kafkaconn.Connection, dispatcher *notifier.Dispatcher, store *storage.Storage, backoff time.Duration) *Queue {
+	parts := strings.Split(brokers, ",")
+	addrs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if s := strings.TrimSpace(p); s != "" {
+			addrs = append(addrs, s)
+		}
+	}
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	return &Queue{
+		// Synchronous and acknowledged by all replicas: the source offset is
+		// committed once Park returns
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(addrs...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    conn.Transport,
+		},
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  addrs,
+			GroupID:  groupID,
+			Topic:    topic,
+			Dialer:   conn.Dialer,
+			MinBytes: 1,
+			MaxBytes: 10e6, // 10MB
+		}),
+		dispatcher: dispatcher,
+		store:      store,
+		backoff:    backoff,
+	}
+}
+
+// Park publishes a failed delivery to the dead letter queue
+func (q *Queue) Park(ctx context.Context, alert *models.Alert, delivery notifier.Delivery) error {
+	data, err := json.Marshal(Message{
+		Alert:       alert,
+		Destination: delivery.Destination,
+		Error:       delivery.Notification.Error,
+		ParkedAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal parked delivery: %w", err)
+	}
+
+	err = q.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(delivery.Destination.Channel),
+		Value: data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to park delivery: %w", err)
+	}
+
+	metrics.RecordNotification(delivery.Destination.Channel, metrics.NotificationRequeued)
+	return nil
+}
+
+// Run redelivers parked deliveries until ctx is cancelled. A delivery that
+// still fails is retried with backoff and its offset is not committed, so
+// the queue drains in order once the channel recovers.
+func (q *Queue) Run(ctx context.Context) error {
+	for {
+		m, err := q.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("dlq read error: %v", err)
+			continue
+		}
+
+		var msg Message
+		if err := json.Unmarshal(m.Value, &msg); err != nil || msg.Alert == nil {
+			log.Printf("dlq: dropping undecodable message at offset %d", m.Offset)
+		} else if err := q.redeliver(ctx, &msg); err != nil {
+			return err
+		}
+
+		if err := q.reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			log.Printf("dlq commit error: %v", err)
+		}
+	}
+}
+
+// redeliver retries a parked delivery until it succeeds or ctx is cancelled
+func (q *Queue) redeliver(ctx context.Context, msg *Message) error {
+	backoff := q.backoff
+	for {
+		delivery := q.dispatcher.Deliver(ctx, msg.Alert, msg.Destination)
+		if !delivery.Failed() {
+			if err := q.store.InsertNotification(ctx, delivery.Notification); err != nil {
+				log.Printf("alert %s: %v", msg.Alert.ID, err)
+			}
+			log.Printf("alert %s redelivered via %s after %v", msg.Alert.ID, msg.Destination.Channel, time.Since(msg.ParkedAt).Round(time.Second))
+			return nil
+		}
+
+		log.Printf("alert %s: redelivery via %s failed, retrying in %v: %s",
+			msg.Alert.ID, msg.Destination.Channel, backoff, delivery.Notification.Error)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Close shuts down the queue's Kafka writer and reader
+func (q *Queue) Close() error {
+	if err := q.writer.Close(); err != nil {
+		q.reader.Close()
+		return err
+	}
+	return q.reader.Close()
+}
@@ -0,0 +1,255 @@
+//go:build integration
+
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/handler"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+	"alert-service/internal/templates"
+	"alert-service/internal/testdb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// The outage test records alerts in Postgres in a container. It simulates
+// a two minute Slack outage; with -short the outage lasts five seconds:
+//
+//	go test -tags=integration -timeout=15m ./internal/dlq/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// slackOutage is a Slack webhook that answers 503 while it is down
+type slackOutage struct {
+	*httptest.Server
+
+	down   atomic.Bool
+	posted atomic.Int64
+}
+
+func newSlackOutage(t *testing.T) *slackOutage {
+	t.Helper()
+	s := &slackOutage{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.posted.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// memoryQueue parks deliveries in memory, standing in for the Kafka topic.
+// Parking fails while broken is set.
+type memoryQueue struct {
+	broken atomic.Bool
+	parked chan Message
+}
+
+func (q *memoryQueue) Park(_ context.Context, alert *models.Alert, delivery notifier.Delivery) error {
+	if q.broken.Load() {
+		return errors.New("dead letter queue unavailable")
+	}
+	q.parked <- Message{Alert: alert, Destination: delivery.Destination, Error: delivery.Notification.Error, ParkedAt: time.Now()}
+	return nil
+}
+
+// newTestStorage returns a storage on the container's database
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.NewStorage(testdb.URL())
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// newTestDispatcher returns a dispatcher posting every alert to the Slack
+// webhook, retrying twice
+func newTestDispatcher(t *testing.T, webhookURL string) *notifier.Dispatcher {
+	t.Helper()
+	renderer, err := templates.NewRenderer("", time.UTC)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	policy := &notifier.RoutingPolicy{Default: []notifier.Destination{{Channel: models.ChannelSlack}}}
+	factory := func(notifier.Destination) (notifier.Sender, error) {
+		return notifier.NewNotifier(webhookURL, renderer), nil
+	}
+	d, err := notifier.NewDispatcher(policy, factory, notifier.RetryPolicy{MaxRetries: 2, Backoff: 10 * time.Millisecond, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	return d
+}
+
+// transaction returns a message of a high risk transaction, raising alert
+// "alert_" + id
+func transaction(id string) kafka.Message {
+	return kafka.Message{
+		Topic: "transactions.processed",
+		Value: []byte(fmt.Sprintf(`{"id": %q, "account_id": "acct-1", "amount": 250, "currency": "USD", "risk_score": 0.95, "status": "approved"}`, id)),
+	}
+}
+
+// notifications returns the number of Slack notifications with outcome
+func notifications(t *testing.T, outcome string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_notifications_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["channel"] == models.ChannelSlack && labels["outcome"] == outcome {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestSlackOutageLosesNoAlerts(t *testing.T) {
+	outage := 2 * time.Minute
+	if testing.Short() {
+		outage = 5 * time.Second
+	}
+	const alerts = 60
+
+	store := newTestStorage(t)
+	slack := newSlackOutage(t)
+	dispatcher := newTestDispatcher(t, slack.URL)
+	queue := &memoryQueue{parked: make(chan Message, alerts)}
+	h := handler.NewAlertHandler(nil, evaluator.NewThresholdEvaluator(0.8, 10000, nil, "USD"), nil, dispatcher, queue,
+		nil, nil, nil, store, nil, nil, nil, nil)
+	delivered := notifications(t, "delivered")
+
+	// The worker drains the queue throughout the outage
+	q := &Queue{dispatcher: dispatcher, store: store, backoff: 100 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-queue.parked:
+				if err := q.redeliver(ctx, &msg); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	slack.down.Store(true)
+	start := time.Now()
+	for i := range alerts {
+		// Every transaction is handled, so its offset would be committed,
+		// only because its alert was parked
+		if err := h.Handle(ctx, transaction(fmt.Sprintf("outage-%d", i))); err != nil {
+			t.Fatalf("Handle during the outage: %v", err)
+		}
+		time.Sleep(time.Until(start.Add(outage * time.Duration(i+1) / alerts)))
+	}
+	if n := slack.posted.Load(); n != 0 {
+		t.Fatalf("%d alerts posted during the outage", n)
+	}
+	slack.down.Store(false)
+
+	// Parked deliveries back off up to maxBackoff, so the queue drains
+	// within that of the recovery
+	deadline := time.Now().Add(maxBackoff + time.Minute)
+	for slack.posted.Load() < alerts && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+	if n := slack.posted.Load(); n != alerts {
+		t.Fatalf("%d of %d alerts posted after the outage", n, alerts)
+	}
+
+	for i := range alerts {
+		id := fmt.Sprintf("alert_outage-%d", i)
+		records, err := store.ListNotifications(context.Background(), id)
+		if err != nil {
+			t.Fatalf("ListNotifications: %v", err)
+		}
+		var failed, sent int
+		for _, n := range records {
+			switch n.Status {
+			case models.NotificationStatusFailed:
+				failed++
+			case models.NotificationStatusSent:
+				sent++
+			}
+		}
+		if failed != 1 || sent != 1 {
+			t.Errorf("alert %s has %d failed and %d sent notifications, want one of each", id, failed, sent)
+		}
+	}
+	if got := notifications(t, "delivered") - delivered; got != alerts {
+		t.Errorf("%v deliveries counted, want %d", got, alerts)
+	}
+}
+
+func TestUnparkedAlertIsHandledAgain(t *testing.T) {
+	store := newTestStorage(t)
+	slack := newSlackOutage(t)
+	slack.down.Store(true)
+	queue := &memoryQueue{parked: make(chan Message, 1)}
+	queue.broken.Store(true)
+	h := handler.NewAlertHandler(nil, evaluator.NewThresholdEvaluator(0.8, 10000, nil, "USD"), nil,
+		newTestDispatcher(t, slack.URL), queue, nil, nil, nil, store, nil, nil, nil, nil)
+
+	// With the queue down too the offset must not be committed, and no
+	// notification is recorded so the redelivered message is sent again
+	m := transaction("unparked")
+	if err := h.Handle(context.Background(), m); err == nil {
+		t.Fatal("Handle succeeded although the alert was neither delivered nor parked")
+	}
+	if records, err := store.ListNotifications(context.Background(), "alert_unparked"); err != nil || len(records) != 0 {
+		t.Fatalf("ListNotifications = %d records, %v, want none", len(records), err)
+	}
+
+	queue.broken.Store(false)
+	if err := h.Handle(context.Background(), m); err != nil {
+		t.Fatalf("Handle of the redelivered message: %v", err)
+	}
+	select {
+	case msg := <-queue.parked:
+		if msg.Alert.ID != "alert_unparked" || msg.Destination.Channel != models.ChannelSlack || msg.Error == "" {
+			t.Errorf("parked %+v", msg)
+		}
+	default:
+		t.Error("redelivered alert not parked")
+	}
+}
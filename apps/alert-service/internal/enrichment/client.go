@@ -0,0 +1,62 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxContextBody bounds the account context read from the storage API
+const maxContextBody = 64 << 10
+
+// StorageClient reads account contexts from the storage API
+type StorageClient struct {
+	baseURL string
+	token   string
+	days    int
+	client  *http.Client
+}
+
+// NewStorageClient creates a client of the storage API at baseURL,
+// authenticated by token as a bearer token, reading contexts covering days
+// of activity. Requests are bounded by their context.
+func NewStorageClient(baseURL, token string, days int) *StorageClient {
+	return &StorageClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		days:    days,
+		client:  &http.Client{},
+	}
+}
+
+// AccountContext reads the context of an account
+func (c *StorageClient) AccountContext(ctx context.Context, accountID string) (*AccountContext, error) {
+	endpoint := c.baseURL + "/api/v1/accounts/" + url.PathEscape(accountID) + "/context?days=" + strconv.Itoa(c.days)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build account context request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account context: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read account context: storage API returned %s", resp.Status)
+	}
+	var account AccountContext
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxContextBody)).Decode(&account); err != nil {
+		return nil, fmt.Errorf("failed to decode account context: %w", err)
+	}
+	return &account, nil
+}
@@ -0,0 +1,183 @@
+// Package enrichment adds the context of an alert's account to the alert
+// before it is sent, so the analyst sees the account's recent activity
+// without querying it.
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Alert metadata keys holding the account context
+const (
+	KeyOpenedAt       = "account_opened_at"
+	KeyWindowDays     = "account_window_days"
+	KeyTransactions   = "account_transactions"
+	KeyFlagged        = "account_flagged"
+	KeyRiskScore      = "account_risk_score"
+	KeyRiskLevel      = "account_risk_level"
+	KeyPreviousAlerts = "account_previous_alerts"
+)
+
+// AccountContext summarizes an account, as served by the storage API
+type AccountContext struct {
+	AccountID        string       `json:"account_id"`
+	OpenedAt         *time.Time   `json:"opened_at,omitempty"`
+	Since            time.Time    `json:"since"`
+	TransactionCount int64        `json:"transaction_count"`
+	FlaggedCount     int64        `json:"flagged_count"`
+	Risk             *RiskMetrics `json:"risk,omitempty"`
+}
+
+// RiskMetrics are the current risk metrics of an account
+type RiskMetrics struct {
+	RiskScore float64 `json:"risk_score"`
+	RiskLevel string  `json:"risk_level"`
+}
+
+// Source reads the context of an account
+type Source interface {
+	AccountContext(ctx context.Context, accountID string) (*AccountContext, error)
+}
+
+// AlertCounter counts the alerts raised on an account
+type AlertCounter interface {
+	CountAccountAlerts(ctx context.Context, accountID, excludeID string, since time.Time) (int64, error)
+}
+
+// Config configures an Enricher
+type Config struct {
+	// Timeout bounds the lookups enriching an alert
+	Timeout time.Duration
+	// CacheTTL is how long an account's context is cached
+	CacheTTL time.Duration
+	// WindowDays is the number of days of activity the context covers
+	WindowDays int
+}
+
+// Enricher adds the context of an alert's account to its metadata: its age,
+// its transactions and flagged transactions over the window, its risk
+// metrics and the alerts raised on it over the window. Contexts are cached
+// in Redis so every replica shares them and an alert storm on an account
+// reads the storage API once; without Redis every alert reads it.
+type Enricher struct {
+	source Source
+	alerts AlertCounter
+	redis  *redis.Client
+	cfg    Config
+}
+
+// New creates an enricher. redisClient may be nil.
+func New(source Source, alerts AlertCounter, redisClient *redis.Client, cfg Config) *Enricher {
+	return &Enricher{source: source, alerts: alerts, redis: redisClient, cfg: cfg}
+}
+
+// Enrich adds the context of the alert's account to its metadata. A lookup
+// that fails or outlasts the timeout leaves the alert as it is: the
+// context must never hold up delivery.
+func (e *Enricher) Enrich(ctx context.Context, alert *models.Alert) {
+	if alert.AccountID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	account, outcome, err := e.account(ctx, alert.AccountID)
+	var previous int64
+	if err == nil {
+		since := time.Now().AddDate(0, 0, -e.cfg.WindowDays)
+		previous, err = e.alerts.CountAccountAlerts(ctx, alert.AccountID, alert.ID, since)
+	}
+	if err != nil {
+		metrics.RecordEnrichment(metrics.EnrichmentFailed)
+		slog.WarnContext(ctx, "alert sent without account context", "alert_id", alert.ID, "error", err)
+		return
+	}
+	metrics.RecordEnrichment(outcome)
+
+	if alert.Metadata == nil {
+		alert.Metadata = make(map[string]string)
+	}
+	if account.OpenedAt != nil {
+		alert.Metadata[KeyOpenedAt] = account.OpenedAt.UTC().Format(time.RFC3339)
+	}
+	alert.Metadata[KeyWindowDays] = strconv.Itoa(e.cfg.WindowDays)
+	alert.Metadata[KeyTransactions] = strconv.FormatInt(account.TransactionCount, 10)
+	alert.Metadata[KeyFlagged] = strconv.FormatInt(account.FlaggedCount, 10)
+	if account.Risk != nil {
+		alert.Metadata[KeyRiskScore] = strconv.FormatFloat(account.Risk.RiskScore, 'f', 2, 64)
+		alert.Metadata[KeyRiskLevel] = account.Risk.RiskLevel
+	}
+	alert.Metadata[KeyPreviousAlerts] = strconv.FormatInt(previous, 10)
+}
+
+// account returns the context of an account from the cache, or from the
+// source when it is not cached, with the outcome of the lookup
+func (e *Enricher) account(ctx context.Context, accountID string) (*AccountContext, string, error) {
+	account, err := e.cached(ctx, accountID)
+	if err != nil {
+		// The cache is an optimisation; the storage API still answers
+		slog.WarnContext(ctx, "account context cache unavailable", "error", err)
+	}
+	if account != nil {
+		return account, metrics.EnrichmentCached, nil
+	}
+
+	account, err = e.source.AccountContext(ctx, accountID)
+	if err != nil {
+		return nil, "", err
+	}
+	e.cache(ctx, accountID, account)
+	return account, metrics.EnrichmentFetched, nil
+}
+
+// cached returns the cached context of an account, or nil when it is not
+// cached
+func (e *Enricher) cached(ctx context.Context, accountID string) (*AccountContext, error) {
+	if e.redis == nil {
+		return nil, nil
+	}
+
+	data, err := e.redis.Get(ctx, cacheKey(accountID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account context cache: %w", err)
+	}
+
+	var account AccountContext
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to decode cached account context: %w", err)
+	}
+	return &account, nil
+}
+
+// cache caches the context of an account for the cache TTL
+func (e *Enricher) cache(ctx context.Context, accountID string, account *AccountContext) {
+	if e.redis == nil {
+		return
+	}
+
+	data, err := json.Marshal(account)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to encode account context", "error", err)
+		return
+	}
+	if err := e.redis.Set(ctx, cacheKey(accountID), data, e.cfg.CacheTTL).Err(); err != nil {
+		slog.WarnContext(ctx, "failed to cache account context", "error", err)
+	}
+}
+
+func cacheKey(accountID string) string {
+	return "alert:account-context:" + accountID
+}
@@ -0,0 +1,297 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// stubSource serves account contexts, counting its reads. A stub with a
+// delay answers once it has passed, or fails when the context ends first.
+type stubSource struct {
+	mu       sync.Mutex
+	accounts map[string]*AccountContext
+	delay    time.Duration
+	err      error
+	reads    int
+}
+
+func (s *stubSource) AccountContext(ctx context.Context, accountID string) (*AccountContext, error) {
+	s.mu.Lock()
+	s.reads++
+	delay, err := s.delay, s.err
+	account, ok := s.accounts[accountID]
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("storage API returned 404 Not Found")
+	}
+	return account, nil
+}
+
+func (s *stubSource) readCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+// stubAlerts counts the alerts of every account as count
+type stubAlerts struct {
+	count int64
+	err   error
+}
+
+func (a stubAlerts) CountAccountAlerts(context.Context, string, string, time.Time) (int64, error) {
+	return a.count, a.err
+}
+
+// testConfig times lookups out after 100ms and caches contexts a minute
+var testConfig = Config{Timeout: 100 * time.Millisecond, CacheTTL: time.Minute, WindowDays: 30}
+
+// newStubSource returns a source knowing acct-1, opened on openedAt
+func newStubSource(openedAt time.Time) *stubSource {
+	return &stubSource{accounts: map[string]*AccountContext{
+		"acct-1": {
+			AccountID:        "acct-1",
+			OpenedAt:         &openedAt,
+			TransactionCount: 212,
+			FlaggedCount:     3,
+			Risk:             &RiskMetrics{RiskScore: 0.6234, RiskLevel: "medium"},
+		},
+	}}
+}
+
+// newTestRedis returns a client of mr, closed when the test ends
+func newTestRedis(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// alertOn returns an alert on an account
+func alertOn(accountID string) *models.Alert {
+	return &models.Alert{ID: "alert-1", AccountID: accountID, Severity: models.SeverityHigh, RiskScore: 0.84}
+}
+
+// enrichments returns the number of lookups counted with outcome
+func enrichments(t *testing.T, outcome string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_enrichments_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "outcome" && label.GetValue() == outcome {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestEnrich(t *testing.T) {
+	openedAt := time.Date(2025, 6, 1, 9, 30, 0, 0, time.FixedZone("CEST", 7200))
+	e := New(newStubSource(openedAt), stubAlerts{count: 4}, nil, testConfig)
+	before := enrichments(t, metrics.EnrichmentFetched)
+
+	alert := alertOn("acct-1")
+	alert.Metadata = map[string]string{"rule": "high_amount"}
+	e.Enrich(context.Background(), alert)
+
+	want := map[string]string{
+		"rule":            "high_amount",
+		KeyOpenedAt:       "2025-06-01T07:30:00Z",
+		KeyWindowDays:     "30",
+		KeyTransactions:   "212",
+		KeyFlagged:        "3",
+		KeyRiskScore:      "0.62",
+		KeyRiskLevel:      "medium",
+		KeyPreviousAlerts: "4",
+	}
+	if len(alert.Metadata) != len(want) {
+		t.Errorf("metadata = %v, want %v", alert.Metadata, want)
+	}
+	for k, v := range want {
+		if alert.Metadata[k] != v {
+			t.Errorf("metadata[%s] = %q, want %q", k, alert.Metadata[k], v)
+		}
+	}
+	if got := enrichments(t, metrics.EnrichmentFetched) - before; got != 1 {
+		t.Errorf("%v fetched lookups counted, want 1", got)
+	}
+
+	// An account without risk metrics or a known opening has neither
+	source := &stubSource{accounts: map[string]*AccountContext{"acct-2": {AccountID: "acct-2", TransactionCount: 1}}}
+	alert = alertOn("acct-2")
+	New(source, stubAlerts{}, nil, testConfig).Enrich(context.Background(), alert)
+	for _, k := range []string{KeyOpenedAt, KeyRiskScore, KeyRiskLevel} {
+		if _, ok := alert.Metadata[k]; ok {
+			t.Errorf("metadata[%s] set for an account without it", k)
+		}
+	}
+	if alert.Metadata[KeyTransactions] != "1" || alert.Metadata[KeyPreviousAlerts] != "0" {
+		t.Errorf("metadata = %v", alert.Metadata)
+	}
+}
+
+func TestEnrichFallsBackToTheBareAlert(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    *stubSource
+		alerts    stubAlerts
+		accountID string
+	}{
+		{"storage API down", &stubSource{err: errors.New("connection refused")}, stubAlerts{}, "acct-1"},
+		{"unknown account", newStubSource(time.Now()), stubAlerts{}, "acct-unknown"},
+		{"alert count failing", newStubSource(time.Now()), stubAlerts{err: errors.New("database down")}, "acct-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := enrichments(t, metrics.EnrichmentFailed)
+			alert := alertOn(tt.accountID)
+			New(tt.source, tt.alerts, nil, testConfig).Enrich(context.Background(), alert)
+
+			if len(alert.Metadata) != 0 {
+				t.Errorf("metadata = %v, want the alert left unenriched", alert.Metadata)
+			}
+			if got := enrichments(t, metrics.EnrichmentFailed) - before; got != 1 {
+				t.Errorf("%v failed lookups counted, want 1", got)
+			}
+		})
+	}
+}
+
+func TestEnrichTimesOut(t *testing.T) {
+	source := newStubSource(time.Now())
+	source.delay = 5 * time.Second
+	before := enrichments(t, metrics.EnrichmentFailed)
+
+	alert := alertOn("acct-1")
+	start := time.Now()
+	New(source, stubAlerts{}, nil, testConfig).Enrich(context.Background(), alert)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Enrich took %s, want it abandoned at the 100ms timeout", elapsed)
+	}
+	if len(alert.Metadata) != 0 {
+		t.Errorf("metadata = %v, want the alert left unenriched", alert.Metadata)
+	}
+	if got := enrichments(t, metrics.EnrichmentFailed) - before; got != 1 {
+		t.Errorf("%v failed lookups counted, want 1", got)
+	}
+}
+
+func TestEnrichSkipsAlertsWithoutAnAccount(t *testing.T) {
+	source := newStubSource(time.Now())
+	alert := alertOn("")
+	New(source, stubAlerts{}, nil, testConfig).Enrich(context.Background(), alert)
+	if source.readCount() != 0 || alert.Metadata != nil {
+		t.Errorf("%d lookups, metadata %v, want none", source.readCount(), alert.Metadata)
+	}
+}
+
+func TestAccountContextsAreCached(t *testing.T) {
+	mr := miniredis.RunT(t)
+	source := newStubSource(time.Now().AddDate(-1, 0, 0))
+	e := New(source, stubAlerts{count: 2}, newTestRedis(t, mr), testConfig)
+	before := enrichments(t, metrics.EnrichmentCached)
+
+	// An alert storm on one account reads the storage API once
+	for i := 0; i < 5; i++ {
+		alert := alertOn("acct-1")
+		e.Enrich(context.Background(), alert)
+		if alert.Metadata[KeyTransactions] != "212" {
+			t.Fatalf("alert %d metadata = %v, want the account context", i, alert.Metadata)
+		}
+	}
+	if n := source.readCount(); n != 1 {
+		t.Errorf("%d storage API reads, want 1", n)
+	}
+	if got := enrichments(t, metrics.EnrichmentCached) - before; got != 4 {
+		t.Errorf("%v cached lookups counted, want 4", got)
+	}
+	if ttl := mr.TTL(cacheKey("acct-1")); ttl != time.Minute {
+		t.Errorf("context cached for %s, want the cache TTL", ttl)
+	}
+
+	// Past the TTL the context is read again
+	mr.FastForward(time.Minute)
+	e.Enrich(context.Background(), alertOn("acct-1"))
+	if n := source.readCount(); n != 2 {
+		t.Errorf("%d storage API reads after the TTL, want 2", n)
+	}
+}
+
+func TestEnrichWithoutRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := newTestRedis(t, mr)
+	mr.Close()
+	source := newStubSource(time.Now())
+
+	// The storage API answers while the cache is down
+	alert := alertOn("acct-1")
+	New(source, stubAlerts{}, client, testConfig).Enrich(context.Background(), alert)
+	if alert.Metadata[KeyTransactions] != "212" {
+		t.Errorf("metadata = %v, want the account context", alert.Metadata)
+	}
+}
+
+func TestStorageClient(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/api/v1/accounts/acct 1/context":
+			w.Write([]byte(`{"account_id":"acct 1","since":"2026-01-01T00:00:00Z","transaction_count":7,"flagged_count":1,"risk":{"risk_score":0.4,"risk_level":"medium"}}`))
+		case "/api/v1/accounts/garbled/context":
+			w.Write([]byte(`{"account_id":`))
+		default:
+			http.Error(w, "account not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewStorageClient(server.URL+"/", "reader-token", 14)
+	account, err := c.AccountContext(context.Background(), "acct 1")
+	if err != nil {
+		t.Fatalf("AccountContext: %v", err)
+	}
+	if gotPath != "/api/v1/accounts/acct%201/context" || gotQuery != "days=14" || gotAuth != "Bearer reader-token" {
+		t.Errorf("requested %s?%s with %q", gotPath, gotQuery, gotAuth)
+	}
+	if account.TransactionCount != 7 || account.FlaggedCount != 1 || account.Risk == nil || account.Risk.RiskLevel != "medium" {
+		t.Errorf("account = %+v", account)
+	}
+
+	for _, accountID := range []string{"unknown", "garbled"} {
+		if _, err := c.AccountContext(context.Background(), accountID); err == nil {
+			t.Errorf("AccountContext(%s) succeeded", accountID)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"alert-service/internal/models"
+)
+
+// LoadRulesFile reads a JSON array of alert rules from a file
+func LoadRulesFile(path string) ([]models.AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var rules []models.AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,39 @@
+package evaluator
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// Watch reloads the engine's rules with load whenever changes signals an
+// edit and on every tick, until ctx is cancelled. The ticks catch changes
+// whose signal was missed. A failed load keeps the current rules.
+func (e *RuleEngine) Watch(ctx context.Context, load func(context.Context) ([]models.AlertRule, error),
+	changes <-chan struct{}, ticks <-chan time.Time) {
+	for {
+		changed := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			changed = true
+		case <-ticks:
+		}
+
+		rules, err := load(ctx)
+		if err != nil {
+			log.Printf("failed to reload alert rules: %v", err)
+			continue
+		}
+		if err := e.Reload(rules); err != nil {
+			log.Printf("invalid alert rules, keeping current rules:\n%v", err)
+			continue
+		}
+		if changed {
+			log.Printf("Reloaded %d enabled alert rules", e.Len())
+		}
+	}
+}
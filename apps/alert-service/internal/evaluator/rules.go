@@ -0,0 +1,417 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"alert-service/internal/models"
+)
+
+// Transaction fields that rule conditions can reference
+const (
+	FieldAmount    = "amount"
+	FieldRiskScore = "risk_score"
+	FieldCurrency  = "currency"
+	FieldMerchant  = "merchant"
+	FieldCountry   = "country"
+	FieldType      = "type"
+	FieldStatus    = "status"
+	FieldCategory  = "category"
+	FieldRiskLevel = "risk_level"
+	// FieldBaseAmount is the amount in the base currency, as converted by
+	// the processing service, or the amount itself when it was not
+	FieldBaseAmount = "base_amount"
+)
+
+var numericFields = map[string]func(*models.ProcessedTransaction) float64{
+	FieldAmount:     func(t *models.ProcessedTransaction) float64 { return t.Amount },
+	FieldRiskScore:  func(t *models.ProcessedTransaction) float64 { return t.RiskScore },
+	FieldBaseAmount: baseAmount,
+}
+
+// baseAmount returns the amount of t in the base currency, or in its own
+// currency when the processing service did not convert it
+func baseAmount(t *models.ProcessedTransaction) float64 {
+	if t.BaseCurrency != "" {
+		return t.BaseAmount
+	}
+	return t.Amount
+}
+
+var stringFields = map[string]func(*models.ProcessedTransaction) string{
+	FieldCurrency:  func(t *models.ProcessedTransaction) string { return t.Currency },
+	FieldMerchant:  func(t *models.ProcessedTransaction) string { return t.Merchant },
+	FieldCountry:   func(t *models.ProcessedTransaction) string { return t.Country },
+	FieldType:      func(t *models.ProcessedTransaction) string { return t.Type },
+	FieldStatus:    func(t *models.ProcessedTransaction) string { return t.Status },
+	FieldCategory:  func(t *models.ProcessedTransaction) string { return t.Category },
+	FieldRiskLevel: func(t *models.ProcessedTransaction) string { return t.RiskLevel },
+}
+
+var validSeverities = map[string]bool{
+	models.SeverityLow:      true,
+	models.SeverityMedium:   true,
+	models.SeverityHigh:     true,
+	models.SeverityCritical: true,
+}
+
+var validChannels = map[string]bool{
+	models.ChannelSlack:     true,
+	models.ChannelEmail:     true,
+	models.ChannelWebhook:   true,
+	models.ChannelSMS:       true,
+	models.ChannelPagerDuty: true,
+	models.ChannelDigest:    true,
+	models.ChannelConsole:   true,
+	models.ChannelFile:      true,
+}
+
+// Match is an alert raised by a rule, with the channels its actions
+// requested. An Unlimited alert is exempt from the account rate limit.
+type Match struct {
+	Rule      *models.AlertRule
+	Alert     *models.Alert
+	Channels  []string
+	Unlimited bool
+}
+
+// RuleEngine evaluates AlertRules against processed transactions. Rules are
+// validated and compiled when the engine is created, so a malformed rule is
+// reported at load time instead of silently never matching. Rules can be
+// replaced with Reload while the engine is in use.
+type RuleEngine struct {
+	mu          sync.RWMutex
+	rules       []compiledRule
+	evaluateAll bool
+}
+
+type compiledRule struct {
+	rule       models.AlertRule
+	conditions []compiledCondition
+}
+
+type compiledCondition struct {
+	describe string
+	match    func(*models.ProcessedTransaction) bool
+}
+
+// NewRuleEngine compiles the enabled rules, highest priority first. When
+// evaluateAll is false evaluation stops at the first matching rule. All
+// invalid rules are reported together.
+func NewRuleEngine(rules []models.AlertRule, evaluateAll bool) (*RuleEngine, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &RuleEngine{rules: compiled, evaluateAll: evaluateAll}, nil
+}
+
+// Reload replaces the engine's rules. If any rule is invalid the current
+// rules are kept.
+func (e *RuleEngine) Reload(rules []models.AlertRule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.rules = compiled
+	e.mu.Unlock()
+	return nil
+}
+
+// compileRules compiles the enabled rules, highest priority first
+func compileRules(rules []models.AlertRule) ([]compiledRule, error) {
+	var errs []error
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.ID, err))
+			continue
+		}
+		if rule.Enabled {
+			compiled = append(compiled, c)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	sort.SliceStable(compiled, func(i, j int) bool {
+		if compiled[i].rule.Priority != compiled[j].rule.Priority {
+			return compiled[i].rule.Priority > compiled[j].rule.Priority
+		}
+		return compiled[i].rule.ID < compiled[j].rule.ID
+	})
+
+	return compiled, nil
+}
+
+// Len returns the number of enabled rules
+func (e *RuleEngine) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.rules)
+}
+
+// Evaluate returns a match for each rule whose conditions all hold
+func (e *RuleEngine) Evaluate(txn *models.ProcessedTransaction) []Match {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	var matches []Match
+	for i := range rules {
+		r := &rules[i]
+		if !r.matches(txn) {
+			continue
+		}
+
+		matches = append(matches, r.apply(txn))
+		if !e.evaluateAll {
+			break
+		}
+	}
+
+	return matches
+}
+
+func (r *compiledRule) matches(txn *models.ProcessedTransaction) bool {
+	for _, c := range r.conditions {
+		if !c.match(txn) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply builds the alert for a matched rule and executes its actions
+func (r *compiledRule) apply(txn *models.ProcessedTransaction) Match {
+	description := r.rule.Description
+	if description == "" {
+		parts := make([]string, len(r.conditions))
+		for i, c := range r.conditions {
+			parts[i] = c.describe
+		}
+		description = fmt.Sprintf("rule %s matched: %s", r.rule.Name, strings.Join(parts, " and "))
+	}
+
+	alert := NewAlert(txn, models.AlertTypeRisk, SeverityFor(txn), r.rule.Name, description)
+	alert.ID = "alert_" + txn.ID + "_" + r.rule.ID
+
+	match := Match{Rule: &r.rule, Alert: alert}
+	for _, action := range r.rule.Actions {
+		if !action.Enabled {
+			continue
+		}
+		switch action.Type {
+		case models.ActionTypeNotify:
+			match.Channels = append(match.Channels, action.Config["channel"])
+		case models.ActionTypeSetSeverity:
+			alert.Severity = action.Config["severity"]
+		case models.ActionTypeSetAlertType:
+			alert.AlertType = action.Config["alert_type"]
+		}
+	}
+
+	return match
+}
+
+// ValidateRule reports whether a rule is well formed: its conditions use
+// known fields with operators and values they support, and its actions are
+// known
+func ValidateRule(rule models.AlertRule) error {
+	_, err := compileRule(rule)
+	return err
+}
+
+// TestRule evaluates a single rule against a transaction, whether or not it
+// is enabled, and returns the match it would raise
+func TestRule(rule models.AlertRule, txn *models.ProcessedTransaction) (*Match, error) {
+	c, err := compileRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	if !c.matches(txn) {
+		return nil, nil
+	}
+	match := c.apply(txn)
+	return &match, nil
+}
+
+// compileRule validates a rule and compiles its conditions
+func compileRule(rule models.AlertRule) (compiledRule, error) {
+	if rule.ID == "" {
+		return compiledRule{}, errors.New("missing id")
+	}
+	if rule.Name == "" {
+		return compiledRule{}, errors.New("missing name")
+	}
+	if len(rule.Conditions) == 0 {
+		return compiledRule{}, errors.New("no conditions")
+	}
+
+	c := compiledRule{rule: rule}
+	for i, cond := range rule.Conditions {
+		compiled, err := compileCondition(cond)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("condition %d: %w", i, err)
+		}
+		c.conditions = append(c.conditions, compiled)
+	}
+
+	for i, action := range rule.Actions {
+		if err := validateAction(action); err != nil {
+			return compiledRule{}, fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+
+	return c, nil
+}
+
+// compileCondition turns a condition into a predicate over a transaction
+func compileCondition(cond models.Condition) (compiledCondition, error) {
+	describe := fmt.Sprintf("%s %s %s", cond.Field, cond.Operator, cond.Value)
+
+	if get, ok := numericFields[cond.Field]; ok {
+		match, err := compileNumeric(get, cond.Operator, cond.Value)
+		if err != nil {
+			return compiledCondition{}, err
+		}
+		return compiledCondition{describe: describe, match: match}, nil
+	}
+
+	if get, ok := stringFields[cond.Field]; ok {
+		match, err := compileString(get, cond.Operator, cond.Value)
+		if err != nil {
+			return compiledCondition{}, err
+		}
+		return compiledCondition{describe: describe, match: match}, nil
+	}
+
+	return compiledCondition{}, fmt.Errorf("unknown field %q", cond.Field)
+}
+
+func compileNumeric(get func(*models.ProcessedTransaction) float64, operator, value string) (func(*models.ProcessedTransaction) bool, error) {
+	switch operator {
+	case models.OperatorEquals, models.OperatorNotEquals, models.OperatorGreaterThan, models.OperatorLessThan:
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s needs a number, got %q", operator, value)
+		}
+		switch operator {
+		case models.OperatorEquals:
+			return func(t *models.ProcessedTransaction) bool { return get(t) == v }, nil
+		case models.OperatorNotEquals:
+			return func(t *models.ProcessedTransaction) bool { return get(t) != v }, nil
+		case models.OperatorGreaterThan:
+			return func(t *models.ProcessedTransaction) bool { return get(t) > v }, nil
+		default:
+			return func(t *models.ProcessedTransaction) bool { return get(t) < v }, nil
+		}
+
+	case models.OperatorBetween:
+		bounds := splitList(value)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("operator between needs \"min,max\", got %q", value)
+		}
+		lo, err1 := strconv.ParseFloat(bounds[0], 64)
+		hi, err2 := strconv.ParseFloat(bounds[1], 64)
+		if err1 != nil || err2 != nil || lo > hi {
+			return nil, fmt.Errorf("operator between needs \"min,max\" numbers, got %q", value)
+		}
+		return func(t *models.ProcessedTransaction) bool {
+			v := get(t)
+			return v >= lo && v <= hi
+		}, nil
+
+	case models.OperatorIn, models.OperatorNotIn:
+		set := make(map[float64]bool)
+		for _, item := range splitList(value) {
+			v, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, fmt.Errorf("operator %s needs a list of numbers, got %q", operator, value)
+			}
+			set[v] = true
+		}
+		want := operator == models.OperatorIn
+		return func(t *models.ProcessedTransaction) bool { return set[get(t)] == want }, nil
+	}
+
+	return nil, fmt.Errorf("operator %q not supported on numeric fields", operator)
+}
+
+func compileString(get func(*models.ProcessedTransaction) string, operator, value string) (func(*models.ProcessedTransaction) bool, error) {
+	switch operator {
+	case models.OperatorEquals:
+		return func(t *models.ProcessedTransaction) bool { return strings.EqualFold(get(t), value) }, nil
+	case models.OperatorNotEquals:
+		return func(t *models.ProcessedTransaction) bool { return !strings.EqualFold(get(t), value) }, nil
+
+	case models.OperatorContains, models.OperatorNotContains:
+		needle := strings.ToLower(value)
+		want := operator == models.OperatorContains
+		return func(t *models.ProcessedTransaction) bool {
+			return strings.Contains(strings.ToLower(get(t)), needle) == want
+		}, nil
+
+	case models.OperatorIn, models.OperatorNotIn:
+		items := splitList(value)
+		if len(items) == 0 {
+			return nil, fmt.Errorf("operator %s needs a non-empty list", operator)
+		}
+		set := make(map[string]bool, len(items))
+		for _, item := range items {
+			set[strings.ToLower(item)] = true
+		}
+		want := operator == models.OperatorIn
+		return func(t *models.ProcessedTransaction) bool { return set[strings.ToLower(get(t))] == want }, nil
+
+	case models.OperatorRegex:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", value, err)
+		}
+		return func(t *models.ProcessedTransaction) bool { return re.MatchString(get(t)) }, nil
+	}
+
+	return nil, fmt.Errorf("operator %q not supported on string fields", operator)
+}
+
+func validateAction(action models.Action) error {
+	switch action.Type {
+	case models.ActionTypeNotify:
+		if !validChannels[action.Config["channel"]] {
+			return fmt.Errorf("unknown notification channel %q", action.Config["channel"])
+		}
+	case models.ActionTypeSetSeverity:
+		if !validSeverities[action.Config["severity"]] {
+			return fmt.Errorf("unknown severity %q", action.Config["severity"])
+		}
+	case models.ActionTypeSetAlertType:
+		if action.Config["alert_type"] == "" {
+			return errors.New("missing alert_type")
+		}
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated condition value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,383 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alert-service/internal/models"
+)
+
+// rule returns an enabled rule of id matching all of conditions
+func rule(id string, priority int, conditions ...models.Condition) models.AlertRule {
+	return models.AlertRule{ID: id, Name: id, Enabled: true, Priority: priority, Conditions: conditions}
+}
+
+// cond returns a condition of field, operator and value
+func cond(field, operator, value string) models.Condition {
+	return models.Condition{Field: field, Operator: operator, Value: value}
+}
+
+// card returns a transaction of 250 USD at a Las Vegas casino in the US
+func card() *models.ProcessedTransaction {
+	txn := processed(250)
+	txn.Merchant = "Bellagio Casino Las Vegas"
+	txn.Country = "US"
+	txn.Type = "purchase"
+	txn.Category = "gambling"
+	txn.RiskScore, txn.RiskLevel = 0.65, models.RiskLevelMedium
+	return txn
+}
+
+func TestRuleOperators(t *testing.T) {
+	converted := func() *models.ProcessedTransaction {
+		txn := card()
+		txn.Currency, txn.BaseCurrency, txn.BaseAmount = "GBP", "USD", 317.5
+		return txn
+	}
+
+	tests := []struct {
+		name      string
+		condition models.Condition
+		txn       func() *models.ProcessedTransaction
+		want      bool
+	}{
+		{"amount equals", cond(FieldAmount, models.OperatorEquals, "250"), card, true},
+		{"amount equals with spaces", cond(FieldAmount, models.OperatorEquals, " 250.00 "), card, true},
+		{"amount equals another", cond(FieldAmount, models.OperatorEquals, "251"), card, false},
+		{"amount not equals", cond(FieldAmount, models.OperatorNotEquals, "100"), card, true},
+		{"amount not equals itself", cond(FieldAmount, models.OperatorNotEquals, "250"), card, false},
+		{"amount greater than", cond(FieldAmount, models.OperatorGreaterThan, "249.99"), card, true},
+		{"amount greater than itself", cond(FieldAmount, models.OperatorGreaterThan, "250"), card, false},
+		{"amount less than", cond(FieldAmount, models.OperatorLessThan, "250.01"), card, true},
+		{"amount less than itself", cond(FieldAmount, models.OperatorLessThan, "250"), card, false},
+		{"amount between", cond(FieldAmount, models.OperatorBetween, "100,500"), card, true},
+		{"amount between the lower bound", cond(FieldAmount, models.OperatorBetween, "250, 500"), card, true},
+		{"amount between the upper bound", cond(FieldAmount, models.OperatorBetween, "100,250"), card, true},
+		{"amount below the range", cond(FieldAmount, models.OperatorBetween, "251,500"), card, false},
+		{"amount above the range", cond(FieldAmount, models.OperatorBetween, "0,249"), card, false},
+		{"amount in", cond(FieldAmount, models.OperatorIn, "100, 250, 500"), card, true},
+		{"amount not in the list", cond(FieldAmount, models.OperatorIn, "100,500"), card, false},
+		{"amount not in", cond(FieldAmount, models.OperatorNotIn, "100,500"), card, true},
+		{"amount not in, listed", cond(FieldAmount, models.OperatorNotIn, "250"), card, false},
+		{"risk score greater than", cond(FieldRiskScore, models.OperatorGreaterThan, "0.6"), card, true},
+		{"risk score between", cond(FieldRiskScore, models.OperatorBetween, "0.7,1"), card, false},
+		{"base amount of an unconverted amount", cond(FieldBaseAmount, models.OperatorEquals, "250"), card, true},
+		{"base amount converted", cond(FieldBaseAmount, models.OperatorGreaterThan, "300"), converted, true},
+		{"amount of a converted transaction", cond(FieldAmount, models.OperatorGreaterThan, "300"), converted, false},
+
+		{"currency equals", cond(FieldCurrency, models.OperatorEquals, "USD"), card, true},
+		{"currency equals in lower case", cond(FieldCurrency, models.OperatorEquals, "usd"), card, true},
+		{"currency equals another", cond(FieldCurrency, models.OperatorEquals, "EUR"), card, false},
+		{"currency not equals", cond(FieldCurrency, models.OperatorNotEquals, "EUR"), card, true},
+		{"currency not equals in lower case", cond(FieldCurrency, models.OperatorNotEquals, "usd"), card, false},
+		{"merchant contains", cond(FieldMerchant, models.OperatorContains, "casino"), card, true},
+		{"merchant contains another", cond(FieldMerchant, models.OperatorContains, "airline"), card, false},
+		{"merchant not contains", cond(FieldMerchant, models.OperatorNotContains, "airline"), card, true},
+		{"merchant not contains, contained", cond(FieldMerchant, models.OperatorNotContains, "LAS VEGAS"), card, false},
+		{"merchant regex", cond(FieldMerchant, models.OperatorRegex, `(?i)^bellagio\b`), card, true},
+		{"merchant regex is case sensitive", cond(FieldMerchant, models.OperatorRegex, `^bellagio`), card, false},
+		{"country in", cond(FieldCountry, models.OperatorIn, "ca, us ,mx"), card, true},
+		{"country not in the list", cond(FieldCountry, models.OperatorIn, "GB,FR"), card, false},
+		{"country not in", cond(FieldCountry, models.OperatorNotIn, "GB,FR"), card, true},
+		{"country not in, listed", cond(FieldCountry, models.OperatorNotIn, "US"), card, false},
+		{"type equals", cond(FieldType, models.OperatorEquals, "Purchase"), card, true},
+		{"status equals", cond(FieldStatus, models.OperatorEquals, models.TransactionStatusApproved), card, true},
+		{"status regex", cond(FieldStatus, models.OperatorRegex, "^(flagged|rejected)$"), card, false},
+		{"category in", cond(FieldCategory, models.OperatorIn, "gambling,crypto"), card, true},
+		{"risk level equals", cond(FieldRiskLevel, models.OperatorEquals, models.RiskLevelMedium), card, true},
+		{"empty merchant contains", cond(FieldMerchant, models.OperatorContains, "casino"), func() *models.ProcessedTransaction { return processed(250) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := TestRule(rule("r", 0, tt.condition), tt.txn())
+			if err != nil {
+				t.Fatalf("TestRule: %v", err)
+			}
+			if got := match != nil; got != tt.want {
+				t.Errorf("%s %s %q matched = %v, want %v", tt.condition.Field, tt.condition.Operator, tt.condition.Value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleConditionsAllHold(t *testing.T) {
+	r := rule("r", 0,
+		cond(FieldAmount, models.OperatorGreaterThan, "100"),
+		cond(FieldCountry, models.OperatorEquals, "US"),
+	)
+	if match, _ := TestRule(r, card()); match == nil {
+		t.Error("rule with every condition holding did not match")
+	}
+	txn := card()
+	txn.Country = "CA"
+	if match, _ := TestRule(r, txn); match != nil {
+		t.Error("rule matched with a condition failing")
+	}
+}
+
+func TestMalformedRulesAreRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.AlertRule
+		want string
+	}{
+		{"missing id", models.AlertRule{Name: "r", Conditions: []models.Condition{cond(FieldAmount, models.OperatorEquals, "1")}}, `rule "": missing id`},
+		{"missing name", models.AlertRule{ID: "r", Conditions: []models.Condition{cond(FieldAmount, models.OperatorEquals, "1")}}, `rule "r": missing name`},
+		{"no conditions", rule("r", 0), `rule "r": no conditions`},
+		{"unknown field", rule("r", 0, cond("iban", models.OperatorEquals, "x")), `rule "r": condition 0: unknown field "iban"`},
+		{"not a number", rule("r", 0, cond(FieldAmount, models.OperatorGreaterThan, "lots")), `rule "r": condition 0: operator greater_than needs a number, got "lots"`},
+		{"between of one bound", rule("r", 0, cond(FieldAmount, models.OperatorBetween, "100")), `rule "r": condition 0: operator between needs "min,max", got "100"`},
+		{"between reversed", rule("r", 0, cond(FieldAmount, models.OperatorBetween, "500,100")), `rule "r": condition 0: operator between needs "min,max" numbers, got "500,100"`},
+		{"in of a word", rule("r", 0, cond(FieldAmount, models.OperatorIn, "1,two")), `rule "r": condition 0: operator in needs a list of numbers, got "1,two"`},
+		{"numeric contains", rule("r", 0, cond(FieldAmount, models.OperatorContains, "1")), `rule "r": condition 0: operator "contains" not supported on numeric fields`},
+		{"string greater than", rule("r", 0, cond(FieldCurrency, models.OperatorGreaterThan, "A")), `rule "r": condition 0: operator "greater_than" not supported on string fields`},
+		{"empty in", rule("r", 0, cond(FieldCountry, models.OperatorIn, " , ")), `rule "r": condition 0: operator in needs a non-empty list`},
+		{"invalid regex", rule("r", 0, cond(FieldMerchant, models.OperatorRegex, "(casino")), `rule "r": condition 0: invalid regex "(casino"`},
+		{"second condition", rule("r", 0, cond(FieldAmount, models.OperatorEquals, "1"), cond(FieldCountry, "like", "US")), `rule "r": condition 1: operator "like" not supported`},
+	}
+
+	actions := []struct {
+		name   string
+		action models.Action
+		want   string
+	}{
+		{"unknown action", models.Action{Type: "page"}, `action 0: unknown action type "page"`},
+		{"unknown channel", models.Action{Type: models.ActionTypeNotify, Config: map[string]string{"channel": "fax"}}, `action 0: unknown notification channel "fax"`},
+		{"unknown severity", models.Action{Type: models.ActionTypeSetSeverity, Config: map[string]string{"severity": "urgent"}}, `action 0: unknown severity "urgent"`},
+		{"missing alert type", models.Action{Type: models.ActionTypeSetAlertType}, "action 0: missing alert_type"},
+	}
+	for _, a := range actions {
+		r := rule("r", 0, cond(FieldAmount, models.OperatorEquals, "1"))
+		r.Actions = []models.Action{a.action}
+		tests = append(tests, struct {
+			name string
+			rule models.AlertRule
+			want string
+		}{a.name, r, `rule "r": ` + a.want})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRuleEngine([]models.AlertRule{tt.rule}, false)
+			if err == nil {
+				t.Fatal("malformed rule loaded")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to start with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMalformedRulesAreReportedTogether(t *testing.T) {
+	bad := rule("bad-field", 0, cond("iban", models.OperatorEquals, "x"))
+	// A disabled rule is validated all the same
+	disabled := rule("bad-regex", 0, cond(FieldMerchant, models.OperatorRegex, "["))
+	disabled.Enabled = false
+	good := rule("good", 0, cond(FieldAmount, models.OperatorGreaterThan, "1"))
+
+	_, err := NewRuleEngine([]models.AlertRule{bad, good, disabled}, false)
+	if err == nil {
+		t.Fatal("malformed rules loaded")
+	}
+	for _, want := range []string{`rule "bad-field"`, `rule "bad-regex"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `rule "good"`) {
+		t.Errorf("error %q reports the valid rule", err)
+	}
+}
+
+func TestRulesEvaluateByPriority(t *testing.T) {
+	rules := []models.AlertRule{
+		rule("low", 1, cond(FieldAmount, models.OperatorGreaterThan, "100")),
+		rule("high", 10, cond(FieldAmount, models.OperatorGreaterThan, "100")),
+		rule("b-mid", 5, cond(FieldAmount, models.OperatorGreaterThan, "100")),
+		rule("a-mid", 5, cond(FieldAmount, models.OperatorGreaterThan, "100")),
+		rule("miss", 20, cond(FieldAmount, models.OperatorGreaterThan, "1000")),
+	}
+	// ids returns the IDs of the rules matching a card transaction
+	ids := func(e *RuleEngine) string {
+		var matched []string
+		for _, m := range e.Evaluate(card()) {
+			matched = append(matched, m.Rule.ID)
+		}
+		return strings.Join(matched, ",")
+	}
+
+	first, err := NewRuleEngine(rules, false)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	if got := ids(first); got != "high" {
+		t.Errorf("first match = %s, want high", got)
+	}
+
+	all, err := NewRuleEngine(rules, true)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	if got := ids(all); got != "high,a-mid,b-mid,low" {
+		t.Errorf("all matches = %s, want by priority then ID", got)
+	}
+}
+
+func TestDisabledRulesAreSkipped(t *testing.T) {
+	disabled := rule("disabled", 10, cond(FieldAmount, models.OperatorGreaterThan, "100"))
+	disabled.Enabled = false
+	enabled := rule("enabled", 1, cond(FieldAmount, models.OperatorGreaterThan, "100"))
+
+	e, err := NewRuleEngine([]models.AlertRule{disabled, enabled}, true)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	if e.Len() != 1 {
+		t.Errorf("Len = %d, want the enabled rule only", e.Len())
+	}
+	matches := e.Evaluate(card())
+	if len(matches) != 1 || matches[0].Rule.ID != "enabled" {
+		t.Errorf("matches = %+v, want the enabled rule", matches)
+	}
+
+	// TestRule tries a rule whether or not it is enabled
+	if match, err := TestRule(disabled, card()); err != nil || match == nil {
+		t.Errorf("TestRule of a disabled rule = %v, %v, want a match", match, err)
+	}
+}
+
+func TestMatchedRuleAppliesActions(t *testing.T) {
+	r := rule("casino", 0, cond(FieldCategory, models.OperatorEquals, "gambling"), cond(FieldAmount, models.OperatorGreaterThan, "100"))
+	r.Name = "Casino spend"
+	r.Actions = []models.Action{
+		{Type: models.ActionTypeNotify, Config: map[string]string{"channel": models.ChannelSlack}, Enabled: true},
+		{Type: models.ActionTypeNotify, Config: map[string]string{"channel": models.ChannelEmail}, Enabled: true},
+		{Type: models.ActionTypeNotify, Config: map[string]string{"channel": models.ChannelSMS}},
+		{Type: models.ActionTypeSetSeverity, Config: map[string]string{"severity": models.SeverityCritical}, Enabled: true},
+		{Type: models.ActionTypeSetAlertType, Config: map[string]string{"alert_type": models.AlertTypeCompliance}, Enabled: true},
+	}
+
+	match, err := TestRule(r, card())
+	if err != nil || match == nil {
+		t.Fatalf("TestRule = %v, %v, want a match", match, err)
+	}
+	if fmt.Sprint(match.Channels) != "[slack email]" {
+		t.Errorf("channels = %v, want those of the enabled notify actions", match.Channels)
+	}
+	alert := match.Alert
+	if alert.Severity != models.SeverityCritical || alert.AlertType != models.AlertTypeCompliance {
+		t.Errorf("alert %s of severity %s, want compliance of critical", alert.AlertType, alert.Severity)
+	}
+	if alert.ID != "alert_txn-1_casino" || alert.RuleTriggered != "Casino spend" {
+		t.Errorf("alert %s by %s", alert.ID, alert.RuleTriggered)
+	}
+	if want := "rule Casino spend matched: category equals gambling and amount greater_than 100"; alert.Description != want {
+		t.Errorf("description = %q, want %q", alert.Description, want)
+	}
+
+	// Without actions the alert is a risk alert of the transaction's severity
+	r.Actions, r.Description = nil, "Casino spend over 100"
+	match, _ = TestRule(r, card())
+	if match.Alert.AlertType != models.AlertTypeRisk || match.Alert.Severity != models.SeverityMedium || len(match.Channels) != 0 {
+		t.Errorf("alert without actions = %+v, channels %v", match.Alert, match.Channels)
+	}
+	if match.Alert.Description != "Casino spend over 100" {
+		t.Errorf("description = %q, want the rule's", match.Alert.Description)
+	}
+}
+
+func TestReloadKeepsRulesOnError(t *testing.T) {
+	e, err := NewRuleEngine([]models.AlertRule{rule("r1", 0, cond(FieldAmount, models.OperatorGreaterThan, "100"))}, true)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+
+	if err := e.Reload([]models.AlertRule{rule("r2", 0, cond(FieldAmount, models.OperatorBetween, "x"))}); err == nil {
+		t.Fatal("Reload accepted a malformed rule")
+	}
+	if matches := e.Evaluate(card()); len(matches) != 1 || matches[0].Rule.ID != "r1" {
+		t.Errorf("matches after a failed reload = %+v, want r1", matches)
+	}
+
+	err = e.Reload([]models.AlertRule{
+		rule("r2", 0, cond(FieldCountry, models.OperatorEquals, "US")),
+		rule("r3", 0, cond(FieldCountry, models.OperatorEquals, "GB")),
+	})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if matches := e.Evaluate(card()); e.Len() != 2 || len(matches) != 1 || matches[0].Rule.ID != "r2" {
+		t.Errorf("matches after the reload = %+v, want r2", matches)
+	}
+}
+
+func TestLoadRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"id": "big", "name": "Big spend", "enabled": true, "priority": 5,
+		"conditions": [{"field": "amount", "operator": "greater_than", "value": "100"}],
+		"actions": [{"type": "notify", "config": {"channel": "slack"}, "enabled": true}]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	rules, err := LoadRulesFile(path)
+	if err != nil {
+		t.Fatalf("LoadRulesFile: %v", err)
+	}
+	e, err := NewRuleEngine(rules, false)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	matches := e.Evaluate(card())
+	if len(matches) != 1 || fmt.Sprint(matches[0].Channels) != "[slack]" {
+		t.Errorf("matches = %+v, want big notifying slack", matches)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"id": "big"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := LoadRulesFile(path); err == nil || !strings.Contains(err.Error(), "failed to parse rules file") {
+		t.Errorf("LoadRulesFile of an object = %v, want a parse error", err)
+	}
+	if _, err := LoadRulesFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadRulesFile of a missing file succeeded")
+	}
+}
+
+// BenchmarkEvaluate200Rules evaluates every one of 200 rules of mixed
+// operators against a transaction that matches few of them
+func BenchmarkEvaluate200Rules(b *testing.B) {
+	var rules []models.AlertRule
+	for i := 0; i < 200; i++ {
+		var c []models.Condition
+		switch i % 5 {
+		case 0:
+			c = []models.Condition{cond(FieldAmount, models.OperatorGreaterThan, fmt.Sprint(1000+i))}
+		case 1:
+			c = []models.Condition{cond(FieldAmount, models.OperatorBetween, fmt.Sprintf("%d,%d", i, i+50)), cond(FieldCurrency, models.OperatorEquals, "EUR")}
+		case 2:
+			c = []models.Condition{cond(FieldMerchant, models.OperatorContains, fmt.Sprintf("merchant-%d", i))}
+		case 3:
+			c = []models.Condition{cond(FieldCountry, models.OperatorIn, "KP,IR,SY,CU"), cond(FieldRiskScore, models.OperatorGreaterThan, "0.5")}
+		default:
+			c = []models.Condition{cond(FieldMerchant, models.OperatorRegex, fmt.Sprintf(`(?i)^shop-%d\b`, i))}
+		}
+		rules = append(rules, rule(fmt.Sprintf("rule-%d", i), i%10, c...))
+	}
+	e, err := NewRuleEngine(rules, true)
+	if err != nil {
+		b.Fatalf("NewRuleEngine: %v", err)
+	}
+	txn := card()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Evaluate(txn)
+	}
+}
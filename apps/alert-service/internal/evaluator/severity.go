@@ -0,0 +1,136 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"alert-service/internal/models"
+)
+
+// SeverityMapping fixes the severity of alerts of a type, optionally only
+// those raised by one rule
+type SeverityMapping struct {
+	AlertType string `json:"alert_type"`
+	Rule      string `json:"rule,omitempty"`
+	Severity  string `json:"severity"`
+}
+
+// SeverityBand assigns a severity to risk scores at or above MinScore
+type SeverityBand struct {
+	MinScore float64 `json:"min_score"`
+	Severity string  `json:"severity"`
+}
+
+// SeverityPolicy derives alert severities. A mapping for the alert type and
+// rule wins, then one for the alert type alone; other alerts are graded by
+// the risk score bands, or by SeverityFor when there are none.
+type SeverityPolicy struct {
+	Mappings []SeverityMapping `json:"mappings"`
+	Bands    []SeverityBand    `json:"bands"`
+}
+
+// LoadSeverityPolicy reads and validates a JSON severity policy from a file
+func LoadSeverityPolicy(path string) (*SeverityPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read severity policy: %w", err)
+	}
+
+	var policy SeverityPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse severity policy %s: %w", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Validate checks the policy and orders its bands, highest score first.
+// All problems are reported together.
+func (p *SeverityPolicy) Validate() error {
+	var errs []error
+
+	seen := make(map[string]bool)
+	for i, m := range p.Mappings {
+		switch {
+		case m.AlertType == "":
+			errs = append(errs, fmt.Errorf("mapping %d: missing alert_type", i))
+		case !validSeverities[m.Severity]:
+			errs = append(errs, fmt.Errorf("mapping %d: unknown severity %q", i, m.Severity))
+		case seen[m.AlertType+"/"+m.Rule]:
+			errs = append(errs, fmt.Errorf("mapping %d: duplicate mapping for %s", i, describeMapping(m)))
+		}
+		seen[m.AlertType+"/"+m.Rule] = true
+	}
+
+	for i, b := range p.Bands {
+		if b.MinScore < 0 || b.MinScore > 1 {
+			errs = append(errs, fmt.Errorf("band %d: min_score %.2f outside 0-1", i, b.MinScore))
+		}
+		if !validSeverities[b.Severity] {
+			errs = append(errs, fmt.Errorf("band %d: unknown severity %q", i, b.Severity))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	sort.SliceStable(p.Bands, func(i, j int) bool { return p.Bands[i].MinScore > p.Bands[j].MinScore })
+	return nil
+}
+
+// Apply sets an alert's severity and records the reason in its metadata
+// under "severity_source", for audit
+func (p *SeverityPolicy) Apply(alert *models.Alert, txn *models.ProcessedTransaction) {
+	severity, source := p.derive(alert, txn)
+	alert.Severity = severity
+	if alert.Metadata == nil {
+		alert.Metadata = make(map[string]string)
+	}
+	alert.Metadata["severity_source"] = source
+}
+
+// derive returns the severity of an alert and what decided it
+func (p *SeverityPolicy) derive(alert *models.Alert, txn *models.ProcessedTransaction) (string, string) {
+	var typeOnly *SeverityMapping
+	for i := range p.Mappings {
+		m := &p.Mappings[i]
+		if m.AlertType != alert.AlertType {
+			continue
+		}
+		if m.Rule == alert.RuleTriggered && m.Rule != "" {
+			return m.Severity, "mapping " + describeMapping(*m)
+		}
+		if m.Rule == "" && typeOnly == nil {
+			typeOnly = m
+		}
+	}
+	if typeOnly != nil {
+		return typeOnly.Severity, "mapping " + describeMapping(*typeOnly)
+	}
+
+	for _, b := range p.Bands {
+		if txn.RiskScore >= b.MinScore {
+			return b.Severity, fmt.Sprintf("band risk_score>=%.2f", b.MinScore)
+		}
+	}
+	if len(p.Bands) > 0 {
+		// Scores below every band get the lowest severity
+		return models.SeverityLow, "band below lowest"
+	}
+
+	return SeverityFor(txn), "risk_level"
+}
+
+func describeMapping(m SeverityMapping) string {
+	if m.Rule == "" {
+		return "alert_type=" + m.AlertType
+	}
+	return "alert_type=" + m.AlertType + ",rule=" + m.Rule
+}
@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alert-service/internal/models"
+)
+
+// testSeverityPolicy keeps blocked country alerts high, never pages for
+// operational alerts and grades the rest by risk score
+func testSeverityPolicy(t *testing.T) *SeverityPolicy {
+	t.Helper()
+	p := &SeverityPolicy{
+		Mappings: []SeverityMapping{
+			{AlertType: models.AlertTypeCompliance, Rule: "sanctions_hit", Severity: models.SeverityCritical},
+			{AlertType: models.AlertTypeCompliance, Severity: models.SeverityHigh},
+			{AlertType: models.AlertTypeOperational, Severity: models.SeverityLow},
+			{AlertType: models.AlertTypeFraud, Rule: "card_testing", Severity: models.SeverityCritical},
+		},
+		Bands: []SeverityBand{
+			{MinScore: 0.5, Severity: models.SeverityMedium},
+			{MinScore: 0.95, Severity: models.SeverityCritical},
+			{MinScore: 0.8, Severity: models.SeverityHigh},
+		},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return p
+}
+
+// scored returns a transaction of risk score and level
+func scored(score float64, level string) *models.ProcessedTransaction {
+	txn := processed(100)
+	txn.RiskScore, txn.RiskLevel = score, level
+	return txn
+}
+
+func TestSeverityPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		alertType  string
+		rule       string
+		score      float64
+		want       string
+		wantSource string
+	}{
+		{"type and rule mapping wins", models.AlertTypeCompliance, "sanctions_hit", 0.1, models.SeverityCritical,
+			"mapping alert_type=compliance,rule=sanctions_hit"},
+		{"type mapping regardless of score", models.AlertTypeCompliance, "blocked_country", 0.1, models.SeverityHigh,
+			"mapping alert_type=compliance"},
+		{"type mapping over a high score", models.AlertTypeCompliance, "", 0.99, models.SeverityHigh, "mapping alert_type=compliance"},
+		{"operational never pages", models.AlertTypeOperational, "consumer_lag", 0.99, models.SeverityLow,
+			"mapping alert_type=operational"},
+		{"rule mapping without a type mapping", models.AlertTypeFraud, "card_testing", 0.2, models.SeverityCritical,
+			"mapping alert_type=fraud,rule=card_testing"},
+		{"other rule of the type falls to the bands", models.AlertTypeFraud, "high_amount", 0.85, models.SeverityHigh, "band risk_score>=0.80"},
+		{"unknown type falls to the bands", "velocity", "", 0.97, models.SeverityCritical, "band risk_score>=0.95"},
+		{"band boundary is inclusive", models.AlertTypeRisk, "", 0.5, models.SeverityMedium, "band risk_score>=0.50"},
+		{"below every band", models.AlertTypeRisk, "", 0.49, models.SeverityLow, "band below lowest"},
+	}
+
+	p := testSeverityPolicy(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &models.Alert{AlertType: tt.alertType, RuleTriggered: tt.rule, Metadata: map[string]string{"rule": tt.rule}}
+			p.Apply(alert, scored(tt.score, models.RiskLevelLow))
+			if alert.Severity != tt.want || alert.Metadata["severity_source"] != tt.wantSource {
+				t.Errorf("severity = %s from %q, want %s from %q", alert.Severity, alert.Metadata["severity_source"], tt.want, tt.wantSource)
+			}
+			if alert.Metadata["rule"] != tt.rule {
+				t.Errorf("Apply replaced the alert's metadata: %v", alert.Metadata)
+			}
+		})
+	}
+}
+
+func TestSeverityWithoutBandsFollowsTheRiskLevel(t *testing.T) {
+	p := &SeverityPolicy{Mappings: []SeverityMapping{{AlertType: models.AlertTypeOperational, Severity: models.SeverityLow}}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	tests := []struct {
+		txn  *models.ProcessedTransaction
+		want string
+	}{
+		{scored(0.1, models.RiskLevelCritical), models.SeverityCritical},
+		{scored(0.95, models.RiskLevelLow), models.SeverityLow},
+		{scored(0.75, ""), models.SeverityHigh},
+		{scored(0.2, ""), models.SeverityLow},
+	}
+	for _, tt := range tests {
+		alert := &models.Alert{AlertType: models.AlertTypeFraud}
+		p.Apply(alert, tt.txn)
+		if alert.Severity != tt.want || alert.Metadata["severity_source"] != "risk_level" {
+			t.Errorf("score %.2f level %q: severity = %s from %q, want %s from the risk level",
+				tt.txn.RiskScore, tt.txn.RiskLevel, alert.Severity, alert.Metadata["severity_source"], tt.want)
+		}
+	}
+}
+
+func TestSeverityPolicyValidation(t *testing.T) {
+	p := &SeverityPolicy{
+		Mappings: []SeverityMapping{
+			{Severity: models.SeverityHigh},
+			{AlertType: models.AlertTypeFraud, Severity: "urgent"},
+			{AlertType: models.AlertTypeCompliance, Rule: "blocked_country", Severity: models.SeverityHigh},
+			{AlertType: models.AlertTypeCompliance, Rule: "blocked_country", Severity: models.SeverityLow},
+		},
+		Bands: []SeverityBand{
+			{MinScore: 1.5, Severity: models.SeverityHigh},
+			{MinScore: 0.5, Severity: "severe"},
+		},
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("invalid policy validated")
+	}
+	for _, want := range []string{
+		"mapping 0: missing alert_type",
+		`mapping 1: unknown severity "urgent"`,
+		"mapping 3: duplicate mapping for alert_type=compliance,rule=blocked_country",
+		"band 0: min_score 1.50 outside 0-1",
+		`band 1: unknown severity "severe"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "mapping 2") {
+		t.Errorf("error %q reports the first of the duplicates", err)
+	}
+}
+
+func TestLoadSeverityPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "severity.json")
+	data := `{"mappings": [{"alert_type": "compliance", "severity": "high"}],
+		"bands": [{"min_score": 0.4, "severity": "medium"}, {"min_score": 0.9, "severity": "critical"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	p, err := LoadSeverityPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadSeverityPolicy: %v", err)
+	}
+	if len(p.Bands) != 2 || p.Bands[0].MinScore != 0.9 {
+		t.Errorf("bands = %+v, want them ordered highest score first", p.Bands)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"malformed", `{"mappings": [`, "failed to parse severity policy"},
+		{"invalid", `{"mappings": [{"alert_type": "fraud", "severity": "urgent"}]}`, `unknown severity "urgent"`},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if _, err := LoadSeverityPolicy(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s policy: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := LoadSeverityPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadSeverityPolicy of a missing file succeeded")
+	}
+}
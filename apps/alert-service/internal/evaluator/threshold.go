@@ -0,0 +1,149 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+)
+
+// Rule names recorded in Alert.RuleTriggered by the threshold evaluator
+const (
+	RuleRiskThreshold   = "risk_threshold"
+	RuleAmountThreshold = "amount_threshold"
+	RuleStatusFlagged   = "status_flagged"
+	RuleStatusRejected  = "status_rejected"
+)
+
+// ThresholdEvaluator raises alerts for processed transactions that cross the
+// configured risk or amount thresholds or that processing flagged or rejected.
+// The amount threshold is set in the base currency.
+type ThresholdEvaluator struct {
+	riskThreshold   float64
+	amountThreshold float64
+	rates           *currency.Converter
+	baseCurrency    string
+}
+
+// NewThresholdEvaluator creates a new threshold evaluator with an amount
+// threshold in baseCurrency. Amounts the processing service did not convert
+// into baseCurrency are converted with rates, which may be nil; amounts
+// without a rate are compared in their own currency.
+func NewThresholdEvaluator(riskThreshold, amountThreshold float64, rates *currency.Converter, baseCurrency string) *ThresholdEvaluator {
+	return &ThresholdEvaluator{
+		riskThreshold:   riskThreshold,
+		amountThreshold: amountThreshold,
+		rates:           rates,
+		baseCurrency:    baseCurrency,
+	}
+}
+
+// amountInBase returns the amount of txn in the base currency, or in its own
+// currency when no rate converts it, with the currency returned
+func (e *ThresholdEvaluator) amountInBase(txn *models.ProcessedTransaction) (float64, string) {
+	if amount, ok := txn.AmountIn(e.baseCurrency); ok {
+		return amount, e.baseCurrency
+	}
+	if e.rates != nil {
+		if amount, _, err := e.rates.Convert(txn.Amount, txn.Currency, e.baseCurrency); err == nil {
+			return amount, e.baseCurrency
+		}
+	}
+	return txn.Amount, txn.Currency
+}
+
+// Evaluate returns an alert for the transaction, or nil when it is below all
+// thresholds. The first matching condition names the rule and alert type; all
+// matching conditions are listed in the description.
+func (e *ThresholdEvaluator) Evaluate(txn *models.ProcessedTransaction) *models.Alert {
+	var rules, reasons []string
+	alertType := ""
+
+	trigger := func(rule, typ, reason string) {
+		rules = append(rules, rule)
+		reasons = append(reasons, reason)
+		if alertType == "" {
+			alertType = typ
+		}
+	}
+
+	if txn.RiskScore >= e.riskThreshold {
+		trigger(RuleRiskThreshold, models.AlertTypeFraud,
+			fmt.Sprintf("risk score %.2f at or above threshold %.2f", txn.RiskScore, e.riskThreshold))
+	}
+	switch txn.Status {
+	case models.TransactionStatusFlagged:
+		trigger(RuleStatusFlagged, models.AlertTypeFraud, "transaction flagged by processing")
+	case models.TransactionStatusRejected:
+		reason := "transaction rejected by processing"
+		if txn.RejectionReason != "" {
+			reason += ": " + txn.RejectionReason
+		}
+		trigger(RuleStatusRejected, models.AlertTypeRisk, reason)
+	}
+	if amount, code := e.amountInBase(txn); amount >= e.amountThreshold {
+		reason := fmt.Sprintf("amount %.2f %s at or above threshold %.2f %s", txn.Amount, txn.Currency, e.amountThreshold, code)
+		if code != txn.Currency {
+			reason = fmt.Sprintf("amount %.2f %s (%.2f %s) at or above threshold %.2f %s",
+				txn.Amount, txn.Currency, amount, code, e.amountThreshold, code)
+		}
+		trigger(RuleAmountThreshold, models.AlertTypeRisk, reason)
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return NewAlert(txn, alertType, SeverityFor(txn), rules[0], strings.Join(reasons, "; "))
+}
+
+// NewAlert builds an open alert for a processed transaction
+func NewAlert(txn *models.ProcessedTransaction, alertType, severity, rule, description string) *models.Alert {
+	now := time.Now()
+	return &models.Alert{
+		ID:            "alert_" + txn.ID,
+		TransactionID: txn.ID,
+		AccountID:     txn.AccountID,
+		UserID:        txn.UserID,
+		AlertType:     alertType,
+		Severity:      severity,
+		RiskScore:     txn.RiskScore,
+		Amount:        txn.Amount,
+		Currency:      txn.Currency,
+		Description:   description,
+		RuleTriggered: rule,
+		Status:        models.StatusOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		TenantID:      txn.TenantID,
+	}
+}
+
+// SeverityFor maps the risk level assigned by processing to an alert
+// severity, falling back to the risk score when no level is set
+func SeverityFor(txn *models.ProcessedTransaction) string {
+	switch txn.RiskLevel {
+	case models.RiskLevelCritical:
+		return models.SeverityCritical
+	case models.RiskLevelHigh:
+		return models.SeverityHigh
+	case models.RiskLevelMedium:
+		return models.SeverityMedium
+	case models.RiskLevelLow:
+		return models.SeverityLow
+	}
+
+	switch {
+	case txn.RiskScore >= 0.9:
+		return models.SeverityCritical
+	case txn.RiskScore >= 0.7:
+		return models.SeverityHigh
+	case txn.RiskScore >= 0.4:
+		return models.SeverityMedium
+	default:
+		return models.SeverityLow
+	}
+}
@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"testing"
+
+	"alert-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// processed returns an approved low risk transaction of amount in USD
+func processed(amount float64) *models.ProcessedTransaction {
+	return &models.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:        "txn-1",
+			AccountID: "acct-1",
+			UserID:    "user-1",
+			TenantID:  "unit-a",
+			Amount:    amount,
+			Currency:  "USD",
+			Status:    models.TransactionStatusApproved,
+		},
+		RiskScore: 0.1,
+		RiskLevel: models.RiskLevelLow,
+	}
+}
+
+func TestThresholdEvaluator(t *testing.T) {
+	tests := []struct {
+		name        string
+		txn         func() *models.ProcessedTransaction
+		rule        string
+		alertType   string
+		description string
+	}{
+		{
+			name: "below every threshold",
+			txn:  func() *models.ProcessedTransaction { return processed(50) },
+		},
+		{
+			name: "risk at the threshold",
+			txn: func() *models.ProcessedTransaction {
+				txn := processed(50)
+				txn.RiskScore, txn.RiskLevel = 0.8, models.RiskLevelHigh
+				return txn
+			},
+			rule:        RuleRiskThreshold,
+			alertType:   models.AlertTypeFraud,
+			description: "risk score 0.80 at or above threshold 0.80",
+		},
+		{
+			name: "flagged",
+			txn: func() *models.ProcessedTransaction {
+				txn := processed(50)
+				txn.Status = models.TransactionStatusFlagged
+				return txn
+			},
+			rule:        RuleStatusFlagged,
+			alertType:   models.AlertTypeFraud,
+			description: "transaction flagged by processing",
+		},
+		{
+			name: "rejected with a reason",
+			txn: func() *models.ProcessedTransaction {
+				txn := processed(50)
+				txn.Status, txn.RejectionReason = models.TransactionStatusRejected, "blocked merchant"
+				return txn
+			},
+			rule:        RuleStatusRejected,
+			alertType:   models.AlertTypeRisk,
+			description: "transaction rejected by processing: blocked merchant",
+		},
+		{
+			name:        "amount at the threshold",
+			txn:         func() *models.ProcessedTransaction { return processed(10000) },
+			rule:        RuleAmountThreshold,
+			alertType:   models.AlertTypeRisk,
+			description: "amount 10000.00 USD at or above threshold 10000.00 USD",
+		},
+		{
+			name: "amount converted by processing",
+			txn: func() *models.ProcessedTransaction {
+				txn := processed(9000)
+				txn.Currency = "GBP"
+				txn.BaseCurrency, txn.BaseAmount, txn.ExchangeRate = "USD", 11430, 1.27
+				return txn
+			},
+			rule:        RuleAmountThreshold,
+			alertType:   models.AlertTypeRisk,
+			description: "amount 9000.00 GBP (11430.00 USD) at or above threshold 10000.00 USD",
+		},
+		{
+			name: "every condition, the first naming the alert",
+			txn: func() *models.ProcessedTransaction {
+				txn := processed(15000)
+				txn.RiskScore, txn.Status = 0.95, models.TransactionStatusFlagged
+				return txn
+			},
+			rule:      RuleRiskThreshold,
+			alertType: models.AlertTypeFraud,
+			description: "risk score 0.95 at or above threshold 0.80; transaction flagged by processing; " +
+				"amount 15000.00 USD at or above threshold 10000.00 USD",
+		},
+	}
+
+	e := NewThresholdEvaluator(0.8, 10000, nil, "USD")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := tt.txn()
+			alert := e.Evaluate(txn)
+			if tt.rule == "" {
+				if alert != nil {
+					t.Fatalf("alert raised: %+v", alert)
+				}
+				return
+			}
+			if alert == nil {
+				t.Fatal("no alert raised")
+			}
+			if alert.RuleTriggered != tt.rule || alert.AlertType != tt.alertType {
+				t.Errorf("alert %s by %s, want %s by %s", alert.AlertType, alert.RuleTriggered, tt.alertType, tt.rule)
+			}
+			if alert.Description != tt.description {
+				t.Errorf("description = %q, want %q", alert.Description, tt.description)
+			}
+			if alert.ID != "alert_txn-1" || alert.TransactionID != "txn-1" || alert.AccountID != "acct-1" ||
+				alert.UserID != "user-1" || alert.TenantID != "unit-a" || alert.Amount != txn.Amount ||
+				alert.Currency != txn.Currency || alert.RiskScore != txn.RiskScore || alert.Status != models.StatusOpen {
+				t.Errorf("alert does not describe the transaction: %+v", alert)
+			}
+		})
+	}
+}
+
+func TestThresholdConvertsAmountsProcessingDidNot(t *testing.T) {
+	rates, err := currency.ParseRates([]byte(`{"base":"USD","rates":{"EUR":0.8,"INR":80,"GBP":0.8}}`))
+	if err != nil {
+		t.Fatalf("ParseRates: %v", err)
+	}
+	e := NewThresholdEvaluator(0.8, 10000, currency.NewConverter(rates), "USD")
+
+	in := func(amount float64, code string) *models.ProcessedTransaction {
+		txn := processed(amount)
+		txn.Currency = code
+		return txn
+	}
+	tests := []struct {
+		name        string
+		txn         *models.ProcessedTransaction
+		description string
+	}{
+		{"EUR worth over the threshold", in(9999, "EUR"), "amount 9999.00 EUR (12498.75 USD) at or above threshold 10000.00 USD"},
+		{"INR worth under the threshold", in(500000, "INR"), ""},
+		// Without a rate the amount is compared in its own currency
+		{"CHF without a rate", in(10000, "CHF"), "amount 10000.00 CHF at or above threshold 10000.00 CHF"},
+		{"CHF under the threshold without a rate", in(9999, "CHF"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := e.Evaluate(tt.txn)
+			if tt.description == "" {
+				if alert != nil {
+					t.Fatalf("alert raised: %s", alert.Description)
+				}
+				return
+			}
+			if alert == nil || alert.RuleTriggered != RuleAmountThreshold {
+				t.Fatalf("alert %+v, want the amount threshold", alert)
+			}
+			if alert.Description != tt.description {
+				t.Errorf("description = %q, want %q", alert.Description, tt.description)
+			}
+		})
+	}
+
+	// An amount processing converted into the base is not converted again
+	txn := in(9000, "GBP")
+	txn.BaseCurrency, txn.BaseAmount, txn.ExchangeRate = "USD", 9500, 1.0556
+	if alert := e.Evaluate(txn); alert != nil {
+		t.Errorf("alert raised on the converted 9500 USD: %s", alert.Description)
+	}
+}
+
+func TestSeverityFor(t *testing.T) {
+	tests := []struct {
+		level string
+		score float64
+		want  string
+	}{
+		{models.RiskLevelCritical, 0.1, models.SeverityCritical},
+		{models.RiskLevelHigh, 0.1, models.SeverityHigh},
+		{models.RiskLevelMedium, 0.95, models.SeverityMedium},
+		{models.RiskLevelLow, 0.95, models.SeverityLow},
+		{"", 0.9, models.SeverityCritical},
+		{"", 0.7, models.SeverityHigh},
+		{"", 0.4, models.SeverityMedium},
+		{"", 0.39, models.SeverityLow},
+	}
+	for _, tt := range tests {
+		txn := processed(50)
+		txn.RiskLevel, txn.RiskScore = tt.level, tt.score
+		if got := SeverityFor(txn); got != tt.want {
+			t.Errorf("SeverityFor(level %q, score %.2f) = %s, want %s", tt.level, tt.score, got, tt.want)
+		}
+	}
+}
@@ -2,30 +2,358 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"alert-service/internal/enrichment"
+	"alert-service/internal/evaluator"
+	"alert-service/internal/incidents"
+	"alert-service/internal/limiter"
+	"alert-service/internal/maintenance"
+	"alert-service/internal/metrics"
 	"alert-service/internal/models"
 	"alert-service/internal/notifier"
+	"alert-service/internal/schema"
+	"alert-service/internal/storage"
+	"alert-service/internal/watchlist"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/segmentio/kafka-go"
 )
 
+// Parker parks deliveries that failed every attempt so they can be retried
+// later
+type Parker interface {
+	Park(ctx context.Context, alert *models.Alert, delivery notifier.Delivery) error
+}
+
+// Quarantiner holds messages the handler cannot decode yet
+type Quarantiner interface {
+	Hold(ctx context.Context, m kafka.Message, reason error) error
+}
+
+// Store records alerts and their notifications
+type Store interface {
+	InsertAlert(ctx context.Context, alert *models.Alert) (bool, error)
+	ListNotifications(ctx context.Context, alertID string) ([]*models.Notification, error)
+	InsertNotification(ctx context.Context, n *models.Notification) error
+}
+
+// Streamer sends newly raised alerts to live subscribers
+type Streamer interface {
+	Publish(ctx context.Context, alert *models.Alert) error
+}
+
 type AlertHandler struct {
-	notifier *notifier.Notifier
+	rules       *evaluator.RuleEngine
+	thresholds  *evaluator.ThresholdEvaluator
+	severity    *evaluator.SeverityPolicy
+	dispatcher  *notifier.Dispatcher
+	parker      Parker
+	quarantine  Quarantiner
+	limiter     *limiter.AccountLimiter
+	maintenance *maintenance.Manager
+	store       Store
+	stream      Streamer
+	watchlist   *watchlist.Watchlist
+	enricher    *enrichment.Enricher
+	incidents   *incidents.Correlator
 }
 
-func NewAlertHandler(webhookURL string) *AlertHandler {
+// NewAlertHandler creates an alert handler. Configured rules take precedence;
+// the threshold evaluator covers transactions no rule matched. The severity
+// policy grades the alerts either raises. Transactions on accounts on the
+// watchlist raise an alert of their own. Alerts to be sent are enriched
+// with the context of their account first. New alerts are published to
+// stream, and grouped into incidents with related alerts by incidents.
+// rules, severity, limiter, maintenance, stream, watchlist, enricher and
+// incidents may be nil.
+func NewAlertHandler(rules *evaluator.RuleEngine, thresholds *evaluator.ThresholdEvaluator,
+	severity *evaluator.SeverityPolicy, dispatcher *notifier.Dispatcher, parker Parker, quarantine Quarantiner,
+	limiter *limiter.AccountLimiter, maintenance *maintenance.Manager, store Store, stream Streamer,
+	watchlist *watchlist.Watchlist, enricher *enrichment.Enricher, incidents *incidents.Correlator) *AlertHandler {
 	return &AlertHandler{
-		notifier: notifier.NewNotifier(webhookURL),
+		rules:       rules,
+		thresholds:  thresholds,
+		severity:    severity,
+		dispatcher:  dispatcher,
+		parker:      parker,
+		quarantine:  quarantine,
+		limiter:     limiter,
+		maintenance: maintenance,
+		store:       store,
+		stream:      stream,
+		watchlist:   watchlist,
+		enricher:    enricher,
+		incidents:   incidents,
 	}
 }
 
-// Handle satisfies consumer.Handler by decoding an alert and sending it via notifier
-func (h *AlertHandler) Handle(ctx context.Context, message []byte) error {
-	var alert models.Alert
-	if err := json.Unmarshal(message, &alert); err != nil {
-		return err
+// Handle satisfies consumer.Handler by decoding a message by its schema
+// version: processed transactions are evaluated and notified for each alert
+// they raise, pre-built alerts are notified directly. Messages of unknown
+// versions are quarantined, and those that do not decode are failed
+// permanently, to be dead-lettered. Alerts are tagged with the topic the
+// message was consumed from. Otherwise it returns an error only when an
+// alert was neither delivered nor parked, so the message must be handled
+// again.
+func (h *AlertHandler) Handle(ctx context.Context, m kafka.Message) error {
+	msg, err := schema.Decode(m.Headers, m.Value)
+	if errors.Is(err, schema.ErrUnknownVersion) {
+		slog.WarnContext(ctx, "quarantining message", "partition", m.Partition, "offset", m.Offset, "error", err)
+		return h.quarantine.Hold(ctx, m, err)
+	}
+	if err != nil {
+		// Retrying cannot fix a malformed message
+		slog.WarnContext(ctx, "dead-lettering undecodable message", "partition", m.Partition, "offset", m.Offset, "error", err)
+		metrics.RecordConsumerError(m.Topic, metrics.ConsumerStageDecode)
+		return consumer.Permanent(fmt.Errorf("failed to decode message: %w", err))
+	}
+	metrics.RecordDecoded(msg.Version)
+
+	if msg.Alert != nil {
+		msg.Alert.SourceTopic = m.Topic
+		return h.notify(ctx, evaluator.Match{Alert: msg.Alert}, time.Time{})
+	}
+
+	txn := msg.Transaction
+	ctx = logging.WithTransaction(ctx, txn.ID, txn.AccountID)
+	matches := h.evaluate(txn)
+	if h.watchlist != nil {
+		match, err := h.watchlist.Evaluate(ctx, txn)
+		if err != nil {
+			// Evaluation goes on; the next transaction of the account looks
+			// it up again
+			slog.WarnContext(ctx, "watchlist lookup failed", "error", err)
+			metrics.RecordWatchlistError()
+		} else if match != nil {
+			metrics.RecordWatchlistHit()
+			matches = append(matches, *match)
+		}
+	}
+	if len(matches) == 0 {
+		metrics.RecordEvaluation(metrics.OutcomeSkipped)
+		return nil
+	}
+	metrics.RecordEvaluation(metrics.OutcomeAlerted)
+
+	for _, match := range matches {
+		match.Alert.SourceTopic = m.Topic
+		if err := h.notify(ctx, match, txn.ProcessedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluate runs the rule engine, falling back to the thresholds, and grades
+// the alerts with the severity policy
+func (h *AlertHandler) evaluate(txn *models.ProcessedTransaction) []evaluator.Match {
+	var matches []evaluator.Match
+	if h.rules != nil {
+		matches = h.rules.Evaluate(txn)
+	}
+	if len(matches) == 0 {
+		if alert := h.thresholds.Evaluate(txn); alert != nil {
+			matches = []evaluator.Match{{Alert: alert}}
+		}
+	}
+
+	if h.severity != nil {
+		for _, match := range matches {
+			// A rule that sets the severity itself overrides the policy
+			if !setsSeverity(match.Rule) {
+				h.severity.Apply(match.Alert, txn)
+			}
+		}
+	}
+	return matches
+}
+
+// setsSeverity reports whether a rule has an enabled set_severity action
+func setsSeverity(rule *models.AlertRule) bool {
+	if rule == nil {
+		return false
+	}
+	for _, action := range rule.Actions {
+		if action.Enabled && action.Type == models.ActionTypeSetSeverity {
+			return true
+		}
+	}
+	return false
+}
+
+// notify records an alert, dispatches it, parks failed deliveries and
+// records every delivery. Alerts in a maintenance window or quiet hours, or
+// for an account over its alert rate unless unlimited, are recorded but not
+// dispatched. A new alert joining an open incident is posted in the
+// incident's Slack threads instead, unless it raises the incident's
+// severity or no thread takes the reply. Notifications are recorded only
+// once all failed deliveries are parked: an alert that was already
+// recorded comes from a redelivered transaction and is sent again only if
+// it has no notifications.
+func (h *AlertHandler) notify(ctx context.Context, match evaluator.Match, processedAt time.Time) error {
+	alert := match.Alert
+	ctx = logging.WithTransaction(ctx, alert.TransactionID, alert.AccountID)
+	logger := slog.Default().With("alert_id", alert.ID)
+
+	now := time.Now()
+	var suppressedBy, reason string
+	if h.maintenance != nil {
+		if w := h.maintenance.Window(alert, now); w != nil {
+			alert.Status = models.StatusSuppressedMaintenance
+			suppressedBy, reason = "maintenance window "+w.ID, metrics.SuppressedMaintenance
+		} else if h.maintenance.Quiet(alert, now) {
+			alert.Suppressed = true
+			suppressedBy, reason = "quiet hours for "+alert.Severity+" alerts", metrics.SuppressedQuietHours
+		}
 	}
 
-	log.Printf("processing alert %s: %s", alert.ID, alert.Message)
-	return h.notifier.SendAlert(ctx, &alert)
+	tripped := false
+	if suppressedBy == "" && h.limiter != nil && !match.Unlimited && alert.RuleTriggered != models.RuleAccountRateLimit {
+		var err error
+		alert.Suppressed, tripped, err = h.limiter.Check(ctx, alert)
+		if err != nil {
+			// Fail open: a noisy account is better than a missed alert
+			logger.WarnContext(ctx, "rate limit check failed", "error", err)
+		}
+		if alert.Suppressed {
+			suppressedBy, reason = "account "+alert.AccountID+" is over its alert rate", metrics.SuppressedRateLimit
+		}
+	}
+
+	// Alerts to be sent carry the context of their account, recorded with
+	// them
+	if suppressedBy == "" && h.enricher != nil {
+		h.enricher.Enrich(ctx, alert)
+	}
+
+	inserted, err := h.store.InsertAlert(ctx, alert)
+	if err != nil {
+		// Losing the record is better than losing the notification
+		logger.ErrorContext(ctx, "failed to record alert", "error", err)
+	} else if !inserted {
+		notifications, err := h.store.ListNotifications(ctx, alert.ID)
+		if err != nil {
+			return err
+		}
+		if len(notifications) > 0 {
+			logger.DebugContext(ctx, "alert already recorded, skipping")
+			metrics.RecordDeduplicated()
+			return nil
+		}
+	}
+
+	if inserted {
+		metrics.RecordAlert(alert.AlertType, alert.Severity, alert.TenantID)
+	}
+
+	// Stream new alerts, including one that failed to record since it is
+	// still notified. A redelivered alert was streamed when first recorded.
+	if (inserted || err != nil) && h.stream != nil {
+		if err := h.stream.Publish(ctx, alert); err != nil {
+			logger.WarnContext(ctx, "failed to stream alert", "error", err)
+		}
+	}
+
+	var attachment *storage.IncidentAttachment
+	if inserted && h.incidents != nil {
+		var err error
+		if attachment, err = h.incidents.Attach(ctx, alert); err != nil {
+			// The alert is notified on its own instead
+			logger.WarnContext(ctx, "failed to attach alert to incident", "error", err)
+			metrics.RecordIncidentAlert(metrics.IncidentError)
+		} else if attachment != nil {
+			metrics.RecordIncidentAlert(incidentOutcome(attachment))
+		}
+	}
+
+	if suppressedBy != "" {
+		if inserted {
+			metrics.RecordSuppressed(alert.Severity, reason)
+		}
+		logger.InfoContext(ctx, "alert suppressed", "reason", suppressedBy)
+		if tripped {
+			return h.notify(ctx, evaluator.Match{Alert: h.limiter.MetaAlert(alert)}, processedAt)
+		}
+		return nil
+	}
+
+	logger.DebugContext(ctx, "processing alert", "description", alert.Description)
+
+	if attachment != nil && !attachment.Opened && !attachment.Escalated && h.replyInIncident(ctx, attachment.Incident, alert) {
+		return nil
+	}
+
+	deliveries := h.dispatcher.Dispatch(ctx, alert, match.Channels)
+	for _, delivery := range deliveries {
+		if !delivery.Failed() {
+			continue
+		}
+		if err := h.parker.Park(ctx, alert, delivery); err != nil {
+			return fmt.Errorf("alert %s: %w", alert.ID, err)
+		}
+		logger.WarnContext(ctx, "delivery failed, parked for retry",
+			"channel", delivery.Destination.Channel, "error", delivery.Notification.Error)
+	}
+
+	for _, delivery := range deliveries {
+		notification := delivery.Notification
+		if err := h.store.InsertNotification(ctx, notification); err != nil {
+			logger.ErrorContext(ctx, "failed to record notification", "error", err)
+		}
+		if notification.Status == models.NotificationStatusDropped {
+			logger.WarnContext(ctx, "notification dropped", "channel", notification.Channel, "error", notification.Error)
+		} else if !delivery.Failed() {
+			logger.InfoContext(ctx, "alert delivered", "channel", notification.Channel, "notification_id", notification.ID)
+			if !processedAt.IsZero() && !notification.SentAt.IsZero() {
+				metrics.ObserveAlertLatency(alert.TransactionID, notification.Channel, alert.Severity, processedAt, notification.SentAt)
+			}
+		}
+	}
+	return nil
+}
+
+// incidentOutcome returns the metrics outcome of attaching an alert to an
+// incident
+func incidentOutcome(attachment *storage.IncidentAttachment) string {
+	switch {
+	case attachment.Opened:
+		return metrics.IncidentOpened
+	case attachment.Escalated:
+		return metrics.IncidentEscalated
+	}
+	return metrics.IncidentJoined
+}
+
+// replyInIncident posts an alert in the Slack threads of its incident and
+// records the replies. It reports false when no reply was sent, and the
+// alert must be dispatched as usual.
+func (h *AlertHandler) replyInIncident(ctx context.Context, incident *models.Incident, alert *models.Alert) bool {
+	logger := slog.Default().With("alert_id", alert.ID, "incident_id", incident.ID)
+
+	notifications, err := h.incidents.Reply(ctx, incident, alert)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to reply in incident threads", "error", err)
+		return false
+	}
+
+	sent := false
+	for _, notification := range notifications {
+		if err := h.store.InsertNotification(ctx, notification); err != nil {
+			logger.ErrorContext(ctx, "failed to record notification", "error", err)
+		}
+		if notification.Status == models.NotificationStatusSent {
+			sent = true
+		} else {
+			logger.WarnContext(ctx, "failed to reply in incident thread", "error", notification.Error)
+		}
+	}
+	if sent {
+		logger.InfoContext(ctx, "alert posted in incident threads")
+	}
+	return sent
 }
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/metrics"
+	"alert-service/internal/schema"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeQuarantine records the messages held
+type fakeQuarantine struct {
+	held []kafka.Message
+}
+
+func (q *fakeQuarantine) Hold(_ context.Context, m kafka.Message, _ error) error {
+	q.held = append(q.held, m)
+	return nil
+}
+
+// newTestHandler returns a handler evaluating the thresholds alone
+func newTestHandler(quarantine Quarantiner) *AlertHandler {
+	return NewAlertHandler(nil, evaluator.NewThresholdEvaluator(0.8, 10000, nil, "USD"),
+		nil, nil, nil, quarantine, nil, nil, nil, nil, nil, nil, nil)
+}
+
+// evaluations returns the number of transactions evaluated with outcome
+func evaluations(t *testing.T, outcome string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_transactions_evaluated_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == outcome {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func versioned(version string, value string) kafka.Message {
+	m := kafka.Message{Topic: "transactions.processed", Value: []byte(value)}
+	if version != "" {
+		m.Headers = []kafka.Header{{Key: schema.VersionHeader, Value: []byte(version)}}
+	}
+	return m
+}
+
+func TestUndecodableMessagesFailPermanently(t *testing.T) {
+	tests := []struct {
+		name string
+		m    kafka.Message
+	}{
+		{"unversioned garbage", versioned("", "{not json")},
+		{"transaction garbage", versioned("0", `{"amount": "lots"}`)},
+		{"alert missing its fields", versioned("1", `{"id": "alert-1"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine := &fakeQuarantine{}
+			err := newTestHandler(quarantine).Handle(context.Background(), tt.m)
+			if !consumer.IsPermanent(err) {
+				t.Fatalf("error = %v, want a permanent failure", err)
+			}
+			if !errors.Is(err, schema.ErrMalformed) {
+				t.Errorf("error = %v, want it to wrap schema.ErrMalformed", err)
+			}
+			if len(quarantine.held) != 0 {
+				t.Error("malformed message quarantined")
+			}
+		})
+	}
+}
+
+func TestUnknownVersionsAreQuarantined(t *testing.T) {
+	quarantine := &fakeQuarantine{}
+	err := newTestHandler(quarantine).Handle(context.Background(), versioned("7", `{}`))
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(quarantine.held) != 1 {
+		t.Errorf("%d messages quarantined, want 1", len(quarantine.held))
+	}
+}
+
+func TestTransactionsBelowThresholdsAreHandled(t *testing.T) {
+	quarantine := &fakeQuarantine{}
+	m := versioned("", `{"id": "txn-1", "account_id": "acct-1", "amount": 12.5, "currency": "USD", "risk_score": 0.1, "status": "approved"}`)
+	skipped := evaluations(t, metrics.OutcomeSkipped)
+	if err := newTestHandler(quarantine).Handle(context.Background(), m); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if got := evaluations(t, metrics.OutcomeSkipped); got != skipped+1 {
+		t.Errorf("%v transactions counted as skipped, want 1", got-skipped)
+	}
+}
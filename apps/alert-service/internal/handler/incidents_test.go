@@ -0,0 +1,172 @@
+//go:build integration
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/incidents"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+	"alert-service/internal/testdb"
+)
+
+// The incident tests group alerts in Postgres in a container, each test on
+// a database of its own:
+//
+//	go test -tags=integration ./internal/handler/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(dbURL)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// slackSender posts alerts to #fraud, each message its own thread
+type slackSender struct {
+	recordingSender
+}
+
+func (s *slackSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	n, err := s.recordingSender.SendAlert(ctx, alert)
+	n.Recipient, n.ExternalID = "#fraud", "ts-"+alert.ID
+	return n, err
+}
+
+// fakeThreads records the thread replies, failing them all with err when
+// it is set
+type fakeThreads struct {
+	mu      sync.Mutex
+	replies []string
+	err     error
+}
+
+func (f *fakeThreads) ReplyInThread(_ context.Context, channel, ts, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.replies = append(f.replies, channel+"/"+ts)
+	return nil
+}
+
+func (f *fakeThreads) posted() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.replies, ",")
+}
+
+// incidentPipeline is a handler recording alerts in Postgres, where they
+// are grouped into incidents
+type incidentPipeline struct {
+	*AlertHandler
+	store  *storage.Storage
+	sender *recordingSender
+}
+
+// newIncidentPipeline returns a pipeline grouping the alerts of an account
+// into incidents, posting follow-ups through threads
+func newIncidentPipeline(t *testing.T, threads *fakeThreads) *incidentPipeline {
+	t.Helper()
+	sender := &slackSender{}
+	policy := &notifier.RoutingPolicy{Default: []notifier.Destination{{Channel: models.ChannelSlack}}}
+	dispatcher, err := notifier.NewDispatcher(policy, func(notifier.Destination) (notifier.Sender, error) {
+		return sender, nil
+	}, notifier.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	store := newTestStorage(t)
+	correlator := incidents.New(store, threads, incidents.Config{Key: models.CorrelateAccount, Window: 10 * time.Minute})
+	h := NewAlertHandler(nil, evaluator.NewThresholdEvaluator(0.8, 10000, nil, "USD"), nil, dispatcher, nil,
+		&fakeQuarantine{}, nil, nil, store, nil, nil, nil, correlator)
+	return &incidentPipeline{AlertHandler: h, store: store, sender: &sender.recordingSender}
+}
+
+func TestFollowUpAlertsAreThreaded(t *testing.T) {
+	threads := &fakeThreads{}
+	p := newIncidentPipeline(t, threads)
+
+	p.raise(t, "a1", "acct-1", models.SeverityMedium)
+	p.raise(t, "a2", "acct-1", models.SeverityMedium)
+	p.raise(t, "a3", "acct-1", models.SeverityMedium)
+	// Raising the incident's severity is news of its own
+	p.raise(t, "a4", "acct-1", models.SeverityHigh)
+	p.raise(t, "a5", "acct-2", models.SeverityMedium)
+
+	if got := strings.Join(p.sender.alerts(), ","); got != "a1,a4,a5" {
+		t.Errorf("sent %s, want the first, escalating and unrelated alerts", got)
+	}
+	// a3 replies once in the thread of a1, though a2's reply is recorded
+	// with its ts too
+	if got := threads.posted(); got != "#fraud/ts-a1,#fraud/ts-a1" {
+		t.Errorf("replied in %s, want a2 and a3 in the thread of a1", got)
+	}
+
+	notifications, err := p.store.ListNotifications(context.Background(), "a2")
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].ExternalID != "ts-a1" || notifications[0].Status != models.NotificationStatusSent {
+		t.Errorf("notifications of a2 %+v, want the reply in the thread of a1", notifications)
+	}
+
+	alert, err := p.store.GetAlert(context.Background(), "a4")
+	if err != nil {
+		t.Fatalf("GetAlert: %v", err)
+	}
+	if alert.IncidentID == "" {
+		t.Fatal("a4 has no incident")
+	}
+	first, err := p.store.GetAlert(context.Background(), "a1")
+	if err != nil {
+		t.Fatalf("GetAlert: %v", err)
+	}
+	if first.IncidentID != alert.IncidentID {
+		t.Errorf("a1 in incident %s and a4 in %s, want the same", first.IncidentID, alert.IncidentID)
+	}
+}
+
+func TestFailedRepliesAreSentAsUsual(t *testing.T) {
+	threads := &fakeThreads{err: errors.New("channel_not_found")}
+	p := newIncidentPipeline(t, threads)
+
+	p.raise(t, "a1", "acct-1", models.SeverityMedium)
+	p.raise(t, "a2", "acct-1", models.SeverityMedium)
+
+	if got := strings.Join(p.sender.alerts(), ","); got != "a1,a2" {
+		t.Errorf("sent %s, want a2 sent on its own after its reply failed", got)
+	}
+	notifications, err := p.store.ListNotifications(context.Background(), "a2")
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	var statuses []string
+	for _, n := range notifications {
+		statuses = append(statuses, n.Status)
+	}
+	slices.Sort(statuses)
+	if got := strings.Join(statuses, ","); got != models.NotificationStatusFailed+","+models.NotificationStatusSent {
+		t.Errorf("notifications of a2 %s, want the failed reply and the message sent", got)
+	}
+}
@@ -0,0 +1,505 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/limiter"
+	"alert-service/internal/maintenance"
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+	"alert-service/internal/watchlist"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeStore records alerts and notifications in memory. insertErr fails
+// the recording of alerts and listErr the listing of notifications.
+type fakeStore struct {
+	mu            sync.Mutex
+	alerts        map[string]models.Alert
+	order         []string
+	notifications map[string][]*models.Notification
+	insertErr     error
+	listErr       error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{alerts: make(map[string]models.Alert), notifications: make(map[string][]*models.Notification)}
+}
+
+func (s *fakeStore) InsertAlert(_ context.Context, alert *models.Alert) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.insertErr != nil {
+		return false, s.insertErr
+	}
+	if _, ok := s.alerts[alert.ID]; ok {
+		return false, nil
+	}
+	s.alerts[alert.ID] = *alert
+	s.order = append(s.order, alert.ID)
+	return true, nil
+}
+
+func (s *fakeStore) ListNotifications(_ context.Context, alertID string) ([]*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return append([]*models.Notification(nil), s.notifications[alertID]...), nil
+}
+
+func (s *fakeStore) InsertNotification(_ context.Context, n *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications[n.AlertID] = append(s.notifications[n.AlertID], n)
+	return nil
+}
+
+// alert returns the alert recorded under id, failing the test without one
+func (s *fakeStore) alert(t *testing.T, id string) models.Alert {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert, ok := s.alerts[id]
+	if !ok {
+		t.Fatalf("alert %s not recorded", id)
+	}
+	return alert
+}
+
+// suppressed returns the IDs of the suppressed alerts of an account, in the
+// order they were recorded, space separated
+func (s *fakeStore) suppressed(accountID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, id := range s.order {
+		if alert := s.alerts[id]; alert.AccountID == accountID && alert.Suppressed {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, " ")
+}
+
+// fakeWatchlist holds watchlist entries by account
+type fakeWatchlist map[string]*models.WatchlistEntry
+
+func (w fakeWatchlist) GetWatchlistEntry(_ context.Context, accountID string, _ time.Time) (*models.WatchlistEntry, error) {
+	entry, ok := w[accountID]
+	if !ok {
+		return nil, storage.ErrWatchlistEntryNotFound
+	}
+	return entry, nil
+}
+
+// recordingSender records the IDs of the alerts sent to it
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (r *recordingSender) SendAlert(_ context.Context, alert *models.Alert) (*models.Notification, error) {
+	r.mu.Lock()
+	r.sent = append(r.sent, alert.ID)
+	r.mu.Unlock()
+	return &models.Notification{
+		ID:      "n-" + alert.ID,
+		AlertID: alert.ID,
+		Channel: models.ChannelSlack,
+		Status:  models.NotificationStatusSent,
+		SentAt:  time.Now(),
+	}, nil
+}
+
+func (r *recordingSender) alerts() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.sent...)
+}
+
+// pipeline is a handler sending every alert to one recording sender
+type pipeline struct {
+	*AlertHandler
+	store  *fakeStore
+	sender *recordingSender
+}
+
+// newTestPipeline returns a pipeline limiting alerts with l, which may be
+// nil
+func newTestPipeline(t *testing.T, l *limiter.AccountLimiter) *pipeline {
+	t.Helper()
+	sender := &recordingSender{}
+	policy := &notifier.RoutingPolicy{Default: []notifier.Destination{{Channel: models.ChannelSlack}}}
+	dispatcher, err := notifier.NewDispatcher(policy, func(notifier.Destination) (notifier.Sender, error) {
+		return sender, nil
+	}, notifier.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	store := newFakeStore()
+	h := NewAlertHandler(nil, evaluator.NewThresholdEvaluator(0.8, 10000, nil, "USD"), nil, dispatcher, nil,
+		&fakeQuarantine{}, l, nil, store, nil, nil, nil, nil)
+	return &pipeline{AlertHandler: h, store: store, sender: sender}
+}
+
+// raise notifies a new alert on account, failing the test on an error
+func (h *AlertHandler) raise(t *testing.T, id, accountID, severity string) *models.Alert {
+	t.Helper()
+	now := time.Now()
+	alert := &models.Alert{
+		ID:            id,
+		TransactionID: "txn-" + id,
+		AccountID:     accountID,
+		AlertType:     models.AlertTypeFraud,
+		Severity:      severity,
+		RiskScore:     0.9,
+		Amount:        250,
+		Currency:      "USD",
+		RuleTriggered: evaluator.RuleRiskThreshold,
+		Status:        models.StatusOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := h.notify(context.Background(), evaluator.Match{Alert: alert}, time.Time{}); err != nil {
+		t.Fatalf("notify(%s): %v", id, err)
+	}
+	return alert
+}
+
+// suppressions returns the number of alerts of severity suppressed for
+// reason
+func suppressions(t *testing.T, severity, reason string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_alerts_suppressed_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["severity"] == severity && labels["reason"] == reason {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestRateLimitedAlertsAreRecordedSuppressed(t *testing.T) {
+	p := newTestPipeline(t, limiter.NewAccountLimiter(nil, 2, true))
+	before := suppressions(t, models.SeverityHigh, metrics.SuppressedRateLimit)
+
+	for i := 1; i <= 4; i++ {
+		p.raise(t, fmt.Sprint("a", i), "acct-1", models.SeverityHigh)
+	}
+	p.raise(t, "b1", "acct-2", models.SeverityHigh)
+	// Critical alerts bypass the limiter
+	p.raise(t, "c1", "acct-1", models.SeverityCritical)
+
+	sent := p.sender.alerts()
+	if len(sent) != 5 {
+		t.Fatalf("sent %v, want two alerts, the meta-alert, the other account's and the critical", sent)
+	}
+	meta := fmt.Sprintf("alert_ratelimit_acct-1_%d", time.Now().Truncate(time.Hour).Unix())
+	if got, want := strings.Join(sent, " "), strings.Join([]string{"a1", "a2", meta, "b1", "c1"}, " "); got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+
+	// Nothing is lost: every alert is recorded, the suppressed ones flagged
+	if ids := p.store.suppressed("acct-1"); ids != "a3 a4" {
+		t.Errorf("suppressed alerts = %s, want a3 and a4", ids)
+	}
+	if stored := p.store.alert(t, meta); stored.Suppressed || stored.RuleTriggered != models.RuleAccountRateLimit {
+		t.Errorf("meta-alert = %+v", stored)
+	}
+	if got := suppressions(t, models.SeverityHigh, metrics.SuppressedRateLimit) - before; got != 2 {
+		t.Errorf("%v suppressions counted, want 2", got)
+	}
+}
+
+func TestRedeliveredAlertIsNotCountedTwice(t *testing.T) {
+	p := newTestPipeline(t, limiter.NewAccountLimiter(nil, 1, false))
+	alert := p.raise(t, "a1", "acct-1", models.SeverityHigh)
+
+	// The redelivered alert is neither counted nor sent again
+	if err := p.notify(context.Background(), evaluator.Match{Alert: alert}, time.Time{}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	p.raise(t, "a2", "acct-1", models.SeverityHigh)
+	meta := fmt.Sprintf("alert_ratelimit_acct-1_%d", time.Now().Truncate(time.Hour).Unix())
+	if got, want := strings.Join(p.sender.alerts(), " "), "a1 "+meta; got != want {
+		t.Errorf("sent %s, want a1 and the meta-alert raised by a2", got)
+	}
+}
+
+func TestUnlimitedMatchesBypassTheLimiter(t *testing.T) {
+	p := newTestPipeline(t, limiter.NewAccountLimiter(nil, 1, false))
+	p.raise(t, "a1", "acct-1", models.SeverityHigh)
+
+	alert := &models.Alert{ID: "a2", TransactionID: "txn-a2", AccountID: "acct-1", AlertType: models.AlertTypeFraud,
+		Severity: models.SeverityLow, Status: models.StatusOpen, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := p.notify(context.Background(), evaluator.Match{Alert: alert, Unlimited: true}, time.Time{}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if sent := p.sender.alerts(); len(sent) != 2 || sent[1] != "a2" {
+		t.Errorf("sent %v, want the unlimited alert sent", sent)
+	}
+}
+
+func TestAlertsInMaintenanceWindowsAreRecordedNotSent(t *testing.T) {
+	p := newTestPipeline(t, nil)
+	p.maintenance = maintenance.NewManager(nil, nil, nil, nil)
+	now := time.Now()
+	p.maintenance.Add(&models.MaintenanceWindow{ID: "mw_account", Start: now.Add(-time.Hour), End: now.Add(time.Hour),
+		Scope: models.MaintenanceScopeAccount, ScopeValue: "acct-1"})
+	p.maintenance.Add(&models.MaintenanceWindow{ID: "mw_all", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Minute),
+		Scope: models.MaintenanceScopeAll})
+	before := suppressions(t, models.SeverityCritical, metrics.SuppressedMaintenance)
+
+	p.raise(t, "a1", "acct-1", models.SeverityCritical)
+	p.raise(t, "b1", "acct-2", models.SeverityCritical)
+
+	if sent := p.sender.alerts(); len(sent) != 1 || sent[0] != "b1" {
+		t.Errorf("sent %v, want only the alert outside the window", sent)
+	}
+	if stored := p.store.alert(t, "a1"); stored.Status != models.StatusSuppressedMaintenance {
+		t.Errorf("alert in the window recorded %s, want %s", stored.Status, models.StatusSuppressedMaintenance)
+	}
+	if other := p.store.alert(t, "b1"); other.Status != models.StatusOpen {
+		t.Errorf("alert outside the window = %+v, want it open", other)
+	}
+	if got := suppressions(t, models.SeverityCritical, metrics.SuppressedMaintenance) - before; got != 1 {
+		t.Errorf("%v maintenance suppressions counted, want 1", got)
+	}
+}
+
+func TestQuietHoursMuteTheirSeverities(t *testing.T) {
+	// Quiet all day for low alerts
+	quiet, err := maintenance.ParseQuietHours("low=00:00-23:59", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseQuietHours: %v", err)
+	}
+	now := time.Now().UTC()
+	if now.Hour() == 23 && now.Minute() == 59 {
+		t.Skip("outside the quiet hours for a minute")
+	}
+	p := newTestPipeline(t, nil)
+	p.maintenance = maintenance.NewManager(nil, nil, nil, quiet)
+	before := suppressions(t, models.SeverityLow, metrics.SuppressedQuietHours)
+
+	p.raise(t, "low", "acct-1", models.SeverityLow)
+	p.raise(t, "high", "acct-1", models.SeverityHigh)
+
+	if sent := p.sender.alerts(); len(sent) != 1 || sent[0] != "high" {
+		t.Errorf("sent %v, want only the high alert", sent)
+	}
+	if stored := p.store.alert(t, "low"); !stored.Suppressed || stored.Status != models.StatusOpen {
+		t.Errorf("quiet alert recorded %s, suppressed %v, want it open and suppressed", stored.Status, stored.Suppressed)
+	}
+	if got := suppressions(t, models.SeverityLow, metrics.SuppressedQuietHours) - before; got != 1 {
+		t.Errorf("%v quiet hours suppressions counted, want 1", got)
+	}
+}
+
+// decoded returns the number of input messages of version decoded
+func decoded(t *testing.T, version string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_messages_decoded_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == version {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// schemaFixture returns a message of the schema package's fixture name
+// stamped with version, unstamped when version is empty
+func schemaFixture(t *testing.T, version, name string) kafka.Message {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "schema", "testdata", name))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return versioned(version, string(data))
+}
+
+func TestMixedSchemaVersionsOnOneStream(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPipeline(t, nil)
+	quarantine := p.quarantine.(*fakeQuarantine)
+	v0, v1 := decoded(t, "0"), decoded(t, "1")
+
+	// A rollout: transactions from producers before and after versioning,
+	// alerts from the processing service and a version from the future
+	stream := []kafka.Message{
+		schemaFixture(t, "", "v0_transaction_legacy.json"),
+		schemaFixture(t, "1", "v1_alert.json"),
+		schemaFixture(t, "", "v0_transaction.json"),
+		schemaFixture(t, "2", "v1_alert.json"),
+		schemaFixture(t, "0", "v0_transaction_legacy.json"),
+		versioned("1", `{"id": "alert-bad"}`),
+	}
+	for i, m := range stream[:5] {
+		if err := p.Handle(ctx, m); err != nil {
+			t.Fatalf("Handle(message %d): %v", i, err)
+		}
+	}
+	if err := p.Handle(ctx, stream[5]); !consumer.IsPermanent(err) {
+		t.Errorf("malformed alert: error = %v, want a permanent failure", err)
+	}
+
+	sent := p.sender.alerts()
+	if len(sent) != 2 || sent[0] != "alert-v1" {
+		t.Fatalf("sent %v, want the v1 alert then the v0 transaction's", sent)
+	}
+	if stored := p.store.alert(t, "alert-v1"); stored.SourceTopic != "transactions.processed" || stored.Severity != models.SeverityHigh {
+		t.Errorf("v1 alert stored from %q as %s, want it from transactions.processed as high", stored.SourceTopic, stored.Severity)
+	}
+	if raised := p.store.alert(t, sent[1]); raised.TransactionID != "txn-v0" || raised.AccountID != "acct-v0" {
+		t.Errorf("v0 alert = %+v, want it raised for txn-v0", raised)
+	}
+
+	if len(quarantine.held) != 1 || string(quarantine.held[0].Headers[0].Value) != "2" {
+		t.Errorf("quarantined %d messages, want the v2 one", len(quarantine.held))
+	}
+	if got := decoded(t, "0") - v0; got != 3 {
+		t.Errorf("%v v0 messages decoded, want 3", got)
+	}
+	if got := decoded(t, "1") - v1; got != 1 {
+		t.Errorf("%v v1 messages decoded, want 1", got)
+	}
+}
+
+func TestAlertsCarryTheTopicTheyWereConsumedFrom(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPipeline(t, nil)
+	ops := &recordingSender{}
+	policy := &notifier.RoutingPolicy{
+		Routes:  []notifier.Route{{Topic: "alerts.ops", Destinations: []notifier.Destination{{Channel: models.ChannelSlack, SlackChannel: "pipeline-ops"}}}},
+		Default: []notifier.Destination{{Channel: models.ChannelSlack}},
+	}
+	dispatcher, err := notifier.NewDispatcher(policy, func(dest notifier.Destination) (notifier.Sender, error) {
+		if dest.SlackChannel == "pipeline-ops" {
+			return ops, nil
+		}
+		return p.sender, nil
+	}, notifier.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	p.dispatcher = dispatcher
+
+	// An operational alert and a fraud transaction, each from its own topic
+	alert := schemaFixture(t, "1", "v1_alert.json")
+	alert.Topic = "alerts.ops"
+	transaction := schemaFixture(t, "", "v0_transaction.json")
+	for _, m := range []kafka.Message{alert, transaction} {
+		if err := p.Handle(ctx, m); err != nil {
+			t.Fatalf("Handle(%s): %v", m.Topic, err)
+		}
+	}
+
+	if sent := ops.alerts(); len(sent) != 1 || sent[0] != "alert-v1" {
+		t.Errorf("sent to #pipeline-ops %v, want only the operational alert", sent)
+	}
+	fraud := p.sender.alerts()
+	if len(fraud) != 1 {
+		t.Fatalf("sent by default %v, want only the transaction's alert", fraud)
+	}
+
+	for id, topic := range map[string]string{"alert-v1": "alerts.ops", fraud[0]: "transactions.processed"} {
+		if stored := p.store.alert(t, id); stored.SourceTopic != topic {
+			t.Errorf("alert %s stored from %q, want %s", id, stored.SourceTopic, topic)
+		}
+	}
+}
+
+func TestWatchlistedAccountsAlertOnEveryTransaction(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPipeline(t, limiter.NewAccountLimiter(nil, 1, false))
+	expired := time.Now().Add(-time.Hour)
+	entries := fakeWatchlist{
+		"acct-followed": {AccountID: "acct-followed", Reason: "mule ring case 118", CreatedBy: "analyst-1"},
+		"acct-expired":  {AccountID: "acct-expired", Reason: "old case", CreatedBy: "analyst-1", ExpiresAt: &expired},
+	}
+	p.watchlist = watchlist.New(entries, nil, watchlist.Config{Severity: models.SeverityHigh, BypassRateLimit: true, CacheTTL: time.Minute})
+
+	// Low risk transactions: only the watchlist raises alerts, every one
+	// sent despite the rate limit of one
+	for i, accountID := range []string{"acct-followed", "acct-followed", "acct-other", "acct-expired", "acct-followed"} {
+		m := versioned("", fmt.Sprintf(`{"id": "txn-%d", "account_id": %q, "amount": 12.5, "currency": "USD", "risk_score": 0.1, "status": "approved"}`, i, accountID))
+		if err := p.Handle(ctx, m); err != nil {
+			t.Fatalf("Handle(txn-%d): %v", i, err)
+		}
+	}
+
+	want := "alert_watchlist_txn-0 alert_watchlist_txn-1 alert_watchlist_txn-4"
+	if got := strings.Join(p.sender.alerts(), " "); got != want {
+		t.Errorf("sent %s, want %s", got, want)
+	}
+	if stored := p.store.alert(t, "alert_watchlist_txn-0"); stored.AlertType != models.AlertTypeRisk || stored.Severity != models.SeverityHigh || !strings.Contains(stored.Description, "mule ring case 118") {
+		t.Errorf("watchlist alert = %+v", stored)
+	}
+}
+
+func TestAlertsAreSentWhenTheyFailToRecord(t *testing.T) {
+	p := newTestPipeline(t, nil)
+	p.store.insertErr = errors.New("connection refused")
+
+	p.raise(t, "a1", "acct-1", models.SeverityHigh)
+	if sent := p.sender.alerts(); len(sent) != 1 || sent[0] != "a1" {
+		t.Errorf("sent %v, want the alert sent though it was not recorded", sent)
+	}
+}
+
+func TestRedeliveredAlertsWithSentNotificationsAreSkipped(t *testing.T) {
+	p := newTestPipeline(t, nil)
+	alert := p.raise(t, "a1", "acct-1", models.SeverityHigh)
+
+	if err := p.notify(context.Background(), evaluator.Match{Alert: alert}, time.Time{}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if sent := p.sender.alerts(); len(sent) != 1 {
+		t.Errorf("sent %v, want the redelivered alert skipped", sent)
+	}
+
+	// Unable to tell whether it was notified, the alert is handled again
+	// later rather than sent twice or dropped
+	p.store.listErr = errors.New("connection refused")
+	if err := p.notify(context.Background(), evaluator.Match{Alert: alert}, time.Time{}); err == nil {
+		t.Error("notify() = nil, want the failed listing returned")
+	}
+	if sent := p.sender.alerts(); len(sent) != 1 {
+		t.Errorf("sent %v, want nothing sent while the listing fails", sent)
+	}
+}
@@ -0,0 +1,135 @@
+package incidents
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+)
+
+// Store keeps incidents and the notifications of their alerts
+type Store interface {
+	AttachToIncident(ctx context.Context, alert *models.Alert, opened *models.Incident, window time.Duration) (*storage.IncidentAttachment, error)
+	ListIncidentThreads(ctx context.Context, incidentID string) ([]*models.Notification, error)
+}
+
+// Threader replies in Slack threads
+type Threader interface {
+	ReplyInThread(ctx context.Context, channel, ts, message string) error
+}
+
+// Config configures a Correlator
+type Config struct {
+	// Key is what alerts are correlated by: models.CorrelateAccount or
+	// models.CorrelateAccountRule
+	Key string
+	// Window is how long after an incident's last alert a related alert
+	// still joins it
+	Window time.Duration
+}
+
+// Correlator groups the alerts of an account, or of an account and rule,
+// raised within a rolling window of each other into incidents. Alerts
+// without an account are not correlated.
+type Correlator struct {
+	store Store
+	slack Threader
+	cfg   Config
+}
+
+// New creates a correlator. Follow-up alerts are posted to the Slack
+// threads of their incident through slack, which may be nil.
+func New(store Store, slack Threader, cfg Config) *Correlator {
+	return &Correlator{store: store, slack: slack, cfg: cfg}
+}
+
+// key returns the correlation key of an alert, scoped to its tenant
+func (c *Correlator) key(alert *models.Alert) string {
+	key := fmt.Sprintf("%s/account:%s", alert.TenantID, alert.AccountID)
+	if c.cfg.Key == models.CorrelateAccountRule {
+		key += "/rule:" + alert.RuleTriggered
+	}
+	return key
+}
+
+// Attach attaches a recorded alert to its incident, opening one when no
+// open incident of its key was seen within the window. It returns nil
+// for an alert without an account.
+func (c *Correlator) Attach(ctx context.Context, alert *models.Alert) (*storage.IncidentAttachment, error) {
+	if alert.AccountID == "" {
+		return nil, nil
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	opened := &models.Incident{
+		ID:             "inc_" + hex.EncodeToString(b),
+		TenantID:       alert.TenantID,
+		CorrelationKey: c.key(alert),
+		AccountID:      alert.AccountID,
+	}
+	if c.cfg.Key == models.CorrelateAccountRule {
+		opened.RuleTriggered = alert.RuleTriggered
+	}
+	return c.store.AttachToIncident(ctx, alert, opened, c.cfg.Window)
+}
+
+// Reply posts a follow-up alert of an incident in every Slack thread of
+// the incident and returns a notification of each reply, including failed
+// ones. It returns nil when the incident has no thread to reply in, e.g.
+// when Slack is sent through a webhook, so the alert must be sent as usual.
+func (c *Correlator) Reply(ctx context.Context, incident *models.Incident, alert *models.Alert) ([]*models.Notification, error) {
+	if c.slack == nil {
+		return nil, nil
+	}
+
+	threads, err := c.store.ListIncidentThreads(ctx, incident.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := followUpMessage(incident, alert)
+	var notifications []*models.Notification
+	replied := make(map[string]bool)
+	for _, thread := range threads {
+		key := thread.Recipient + "/" + thread.ExternalID
+		if replied[key] {
+			continue
+		}
+		replied[key] = true
+
+		b := make([]byte, 8)
+		rand.Read(b)
+		n := &models.Notification{
+			ID:         "ntf_" + hex.EncodeToString(b),
+			AlertID:    alert.ID,
+			Channel:    models.ChannelSlack,
+			Recipient:  thread.Recipient,
+			Subject:    thread.Subject,
+			Message:    message,
+			Status:     models.NotificationStatusSent,
+			ExternalID: thread.ExternalID,
+		}
+		if err := c.slack.ReplyInThread(ctx, thread.Recipient, thread.ExternalID, message); err != nil {
+			n.Status = models.NotificationStatusFailed
+			n.Error = err.Error()
+		} else {
+			n.SentAt = time.Now()
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// followUpMessage describes an alert joining an incident
+func followUpMessage(incident *models.Incident, alert *models.Alert) string {
+	return fmt.Sprintf("Related alert #%d (*%s*, %s): %.2f %s\n%s\nIncident total %.2f over %s",
+		incident.AlertCount, alert.Severity, notifier.EscapeSlack(alert.RuleTriggered), alert.Amount, alert.Currency,
+		notifier.EscapeSlack(alert.Description), incident.TotalAmount,
+		incident.LastSeen.Sub(incident.FirstSeen).Round(time.Second))
+}
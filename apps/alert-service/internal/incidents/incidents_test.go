@@ -0,0 +1,182 @@
+package incidents
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+)
+
+// fakeStore records the incidents it is asked to open and returns threads,
+// failing the listing with err when it is set
+type fakeStore struct {
+	mu      sync.Mutex
+	opened  []*models.Incident
+	window  time.Duration
+	threads []*models.Notification
+	err     error
+}
+
+func (f *fakeStore) AttachToIncident(_ context.Context, alert *models.Alert, opened *models.Incident, window time.Duration) (*storage.IncidentAttachment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opened = append(f.opened, opened)
+	f.window = window
+	opened.Add(alert)
+	return &storage.IncidentAttachment{Incident: opened, Opened: true}, nil
+}
+
+func (f *fakeStore) ListIncidentThreads(context.Context, string) ([]*models.Notification, error) {
+	return f.threads, f.err
+}
+
+// fakeSlack records the thread replies, failing those to channel failing
+type fakeSlack struct {
+	mu      sync.Mutex
+	replies []string
+	failing string
+}
+
+func (f *fakeSlack) ReplyInThread(_ context.Context, channel, ts, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if channel == f.failing {
+		return errors.New("channel_not_found")
+	}
+	f.replies = append(f.replies, channel+"/"+ts)
+	return nil
+}
+
+// testAlert returns an alert of rule on account
+func testAlert(id, tenantID, accountID, rule string) *models.Alert {
+	return &models.Alert{
+		ID:            id,
+		TenantID:      tenantID,
+		AccountID:     accountID,
+		Severity:      models.SeverityMedium,
+		Amount:        12500,
+		Currency:      "USD",
+		Description:   "Amount over the 10000 threshold",
+		RuleTriggered: rule,
+		CreatedAt:     time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestCorrelationKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		alert    *models.Alert
+		want     string
+		wantRule string
+	}{
+		{"by account", models.CorrelateAccount, testAlert("a1", "", "acct-1", "high_amount"), "/account:acct-1", ""},
+		{"by account within a tenant", models.CorrelateAccount, testAlert("a2", "unit-a", "acct-1", "high_amount"), "unit-a/account:acct-1", ""},
+		{"by account and rule", models.CorrelateAccountRule, testAlert("a3", "unit-a", "acct-1", "velocity"), "unit-a/account:acct-1/rule:velocity", "velocity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			c := New(store, nil, Config{Key: tt.key, Window: 10 * time.Minute})
+			attachment, err := c.Attach(context.Background(), tt.alert)
+			if err != nil {
+				t.Fatalf("Attach: %v", err)
+			}
+			opened := attachment.Incident
+			if opened.CorrelationKey != tt.want || opened.RuleTriggered != tt.wantRule {
+				t.Errorf("key %q with rule %q, want %q with %q", opened.CorrelationKey, opened.RuleTriggered, tt.want, tt.wantRule)
+			}
+			if !strings.HasPrefix(opened.ID, "inc_") || opened.AccountID != "acct-1" || opened.TenantID != tt.alert.TenantID {
+				t.Errorf("incident %+v, want an inc_ ID on the alert's account and tenant", opened)
+			}
+			if store.window != 10*time.Minute {
+				t.Errorf("window %s, want the configured 10m", store.window)
+			}
+		})
+	}
+}
+
+func TestAlertsWithoutAnAccountAreNotCorrelated(t *testing.T) {
+	store := &fakeStore{}
+	c := New(store, nil, Config{Key: models.CorrelateAccount, Window: 10 * time.Minute})
+	attachment, err := c.Attach(context.Background(), testAlert("a1", "", "", "high_amount"))
+	if err != nil || attachment != nil {
+		t.Errorf("Attach = %+v, %v, want nothing attached", attachment, err)
+	}
+	if len(store.opened) != 0 {
+		t.Errorf("%d incidents opened, want none", len(store.opened))
+	}
+}
+
+func TestReplyPostsInEveryThreadOnce(t *testing.T) {
+	thread := func(recipient, ts string) *models.Notification {
+		return &models.Notification{Channel: models.ChannelSlack, Recipient: recipient, Subject: "High amount", ExternalID: ts}
+	}
+	store := &fakeStore{threads: []*models.Notification{
+		thread("#fraud", "1700000000.000100"),
+		thread("#fraud-eu", "1700000000.000200"),
+		// A reply recorded with the ts of the message it replied to
+		thread("#fraud", "1700000000.000100"),
+		thread("#retired", "1700000000.000300"),
+	}}
+	slack := &fakeSlack{failing: "#retired"}
+	c := New(store, slack, Config{Key: models.CorrelateAccount, Window: 10 * time.Minute})
+
+	start := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	incident := &models.Incident{ID: "inc_1", AlertCount: 3, TotalAmount: 37500, FirstSeen: start, LastSeen: start.Add(6 * time.Minute)}
+	alert := testAlert("a3", "", "acct-1", "high_amount")
+	notifications, err := c.Reply(context.Background(), incident, alert)
+	if err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+
+	if got := strings.Join(slack.replies, ","); got != "#fraud/1700000000.000100,#fraud-eu/1700000000.000200" {
+		t.Errorf("replied in %s, want each thread once", got)
+	}
+	if len(notifications) != 3 {
+		t.Fatalf("%d notifications, want one per thread", len(notifications))
+	}
+	for _, n := range notifications {
+		wantStatus := models.NotificationStatusSent
+		if n.Recipient == "#retired" {
+			wantStatus = models.NotificationStatusFailed
+		}
+		if n.Status != wantStatus || n.AlertID != "a3" || n.Channel != models.ChannelSlack || n.Subject != "High amount" {
+			t.Errorf("notification %+v, want %s for a3", n, wantStatus)
+		}
+		if wantStatus == models.NotificationStatusFailed && n.Error != "channel_not_found" {
+			t.Errorf("error %q, want the failed reply's", n.Error)
+		}
+	}
+	want := "Related alert #3 (*medium*, high_amount): 12500.00 USD\nAmount over the 10000 threshold\nIncident total 37500.00 over 6m0s"
+	if notifications[0].Message != want {
+		t.Errorf("message %q, want %q", notifications[0].Message, want)
+	}
+}
+
+func TestReplyWithoutThreads(t *testing.T) {
+	incident := &models.Incident{ID: "inc_1", AlertCount: 2}
+	alert := testAlert("a2", "", "acct-1", "high_amount")
+
+	// Without a Slack client, as when sent through a webhook
+	c := New(&fakeStore{}, nil, Config{})
+	if notifications, err := c.Reply(context.Background(), incident, alert); err != nil || notifications != nil {
+		t.Errorf("Reply = %v, %v, want nothing sent", notifications, err)
+	}
+
+	c = New(&fakeStore{}, &fakeSlack{}, Config{})
+	if notifications, err := c.Reply(context.Background(), incident, alert); err != nil || notifications != nil {
+		t.Errorf("Reply = %v, %v, want nothing sent without threads", notifications, err)
+	}
+
+	c = New(&fakeStore{err: errors.New("connection refused")}, &fakeSlack{}, Config{})
+	if _, err := c.Reply(context.Background(), incident, alert); err == nil {
+		t.Error("Reply() = nil error, want the failed listing returned")
+	}
+}
@@ -0,0 +1,156 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// window is the rolling window alerts are counted over
+const window = time.Hour
+
+// AccountLimiter counts alerts per account over a rolling hour. Once an
+// account crosses the threshold its further alerts are suppressed until
+// the count falls back under it. Counts live in Redis so every replica
+// shares them; without Redis they are kept in memory.
+type AccountLimiter struct {
+	redis          *redis.Client
+	threshold      int
+	bypassCritical bool
+
+	mu      sync.Mutex
+	alerts  map[string]map[string]time.Time // account -> alert ID -> raised at
+	tripped map[string]time.Time            // account -> when it last crossed the threshold
+}
+
+// NewAccountLimiter creates a limiter allowing threshold alerts per account
+// per hour. With bypassCritical set, critical alerts are neither counted
+// nor suppressed. redisClient may be nil.
+func NewAccountLimiter(redisClient *redis.Client, threshold int, bypassCritical bool) *AccountLimiter {
+	return &AccountLimiter{
+		redis:          redisClient,
+		threshold:      threshold,
+		bypassCritical: bypassCritical,
+		alerts:         make(map[string]map[string]time.Time),
+		tripped:        make(map[string]time.Time),
+	}
+}
+
+// Check records an alert against its account. It reports whether the
+// account is over its threshold, and whether this alert is the first over
+// it within the window, in which case the caller should raise a meta-alert.
+// Checking the same alert again does not count it twice.
+func (l *AccountLimiter) Check(ctx context.Context, alert *models.Alert) (limited, tripped bool, err error) {
+	if l.bypassCritical && alert.Severity == models.SeverityCritical {
+		return false, false, nil
+	}
+
+	now := time.Now()
+
+	var count int64
+	if l.redis == nil {
+		count = l.countMemory(alert, now)
+	} else if count, err = l.countRedis(ctx, alert, now); err != nil {
+		return false, false, err
+	}
+
+	if count <= int64(l.threshold) {
+		return false, false, nil
+	}
+
+	if l.redis == nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if last, ok := l.tripped[alert.AccountID]; ok && now.Sub(last) < window {
+			return true, false, nil
+		}
+		l.tripped[alert.AccountID] = now
+		return true, true, nil
+	}
+
+	tripped, err = l.redis.SetNX(ctx, trippedKey(alert.AccountID), alert.ID, window).Result()
+	if err != nil {
+		return true, false, fmt.Errorf("failed to mark rate limit: %w", err)
+	}
+	return true, tripped, nil
+}
+
+// countRedis adds the alert to the account's sorted set, scored by time,
+// and returns the number of alerts in the window
+func (l *AccountLimiter) countRedis(ctx context.Context, alert *models.Alert, now time.Time) (int64, error) {
+	key := countKey(alert.AccountID)
+	cutoff := strconv.FormatInt(now.Add(-window).UnixMilli(), 10)
+
+	var card *redis.IntCmd
+	_, err := l.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+		pipe.ZAddNX(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: alert.ID})
+		card = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count account alerts: %w", err)
+	}
+	return card.Val(), nil
+}
+
+// countMemory is countRedis without Redis
+func (l *AccountLimiter) countMemory(alert *models.Alert, now time.Time) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	alerts, ok := l.alerts[alert.AccountID]
+	if !ok {
+		alerts = make(map[string]time.Time)
+		l.alerts[alert.AccountID] = alerts
+	}
+	for id, at := range alerts {
+		if now.Sub(at) >= window {
+			delete(alerts, id)
+		}
+	}
+	if _, ok := alerts[alert.ID]; !ok {
+		alerts[alert.ID] = now
+	}
+	return int64(len(alerts))
+}
+
+// MetaAlert builds the alert raised when an account first crosses the
+// threshold. Its ID is fixed per account and hour, so a redelivered
+// trigger does not raise it twice.
+func (l *AccountLimiter) MetaAlert(trigger *models.Alert) *models.Alert {
+	now := time.Now()
+	return &models.Alert{
+		ID:            fmt.Sprintf("alert_ratelimit_%s_%d", trigger.AccountID, now.Truncate(window).Unix()),
+		TransactionID: trigger.TransactionID,
+		AccountID:     trigger.AccountID,
+		UserID:        trigger.UserID,
+		AlertType:     models.AlertTypeOperational,
+		Severity:      models.SeverityHigh,
+		RiskScore:     trigger.RiskScore,
+		Amount:        trigger.Amount,
+		Currency:      trigger.Currency,
+		Description: fmt.Sprintf("account %s exceeded %d alerts/hour — possible attack or rule misfire; further alerts are suppressed",
+			trigger.AccountID, l.threshold),
+		RuleTriggered: models.RuleAccountRateLimit,
+		Status:        models.StatusOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		TenantID:      trigger.TenantID,
+	}
+}
+
+func countKey(accountID string) string {
+	return "alert:rate:" + accountID
+}
+
+func trippedKey(accountID string) string {
+	return "alert:rate:" + accountID + ":tripped"
+}
@@ -0,0 +1,230 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testAlert returns a high alert on account
+func testAlert(id, accountID, severity string) *models.Alert {
+	return &models.Alert{
+		ID:            id,
+		TransactionID: "txn-" + id,
+		AccountID:     accountID,
+		Severity:      severity,
+		RiskScore:     0.9,
+		Amount:        250,
+		Currency:      "USD",
+		TenantID:      "unit-a",
+	}
+}
+
+// limiters returns a limiter of threshold per mode, keeping counts in memory
+// and in Redis
+func limiters(t *testing.T, threshold int, bypassCritical bool) map[string]*AccountLimiter {
+	t.Helper()
+	return map[string]*AccountLimiter{
+		"memory": NewAccountLimiter(nil, threshold, bypassCritical),
+		"redis":  NewAccountLimiter(newTestRedis(t, miniredis.RunT(t)), threshold, bypassCritical),
+	}
+}
+
+// newTestRedis returns a client of mr, closed when the test ends
+func newTestRedis(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// check checks an alert, failing the test on an error
+func check(t *testing.T, l *AccountLimiter, alert *models.Alert) (limited, tripped bool) {
+	t.Helper()
+	limited, tripped, err := l.Check(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("Check(%s): %v", alert.ID, err)
+	}
+	return limited, tripped
+}
+
+// age moves the alerts and trip of account in l back by d, as if they were
+// raised d earlier
+func age(t *testing.T, l *AccountLimiter, mr *miniredis.Miniredis, accountID string, d time.Duration) {
+	t.Helper()
+	if l.redis == nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for id, at := range l.alerts[accountID] {
+			l.alerts[accountID][id] = at.Add(-d)
+		}
+		if at, ok := l.tripped[accountID]; ok {
+			l.tripped[accountID] = at.Add(-d)
+		}
+		return
+	}
+
+	members, err := mr.ZMembers(countKey(accountID))
+	if err != nil {
+		t.Fatalf("ZMembers: %v", err)
+	}
+	for _, member := range members {
+		score, _ := mr.ZScore(countKey(accountID), member)
+		mr.ZAdd(countKey(accountID), score-float64(d.Milliseconds()), member)
+	}
+	mr.FastForward(d)
+}
+
+func TestLimiterSuppressesOverThreshold(t *testing.T) {
+	for mode, l := range limiters(t, 3, false) {
+		t.Run(mode, func(t *testing.T) {
+			for i := 1; i <= 3; i++ {
+				if limited, tripped := check(t, l, testAlert(fmt.Sprint("a", i), "acct-1", models.SeverityHigh)); limited || tripped {
+					t.Errorf("alert %d of 3 limited %v, tripped %v", i, limited, tripped)
+				}
+			}
+			// Checking an alert again, as for a redelivered transaction,
+			// does not count it twice
+			if limited, _ := check(t, l, testAlert("a1", "acct-1", models.SeverityHigh)); limited {
+				t.Error("rechecked alert counted twice")
+			}
+
+			if limited, tripped := check(t, l, testAlert("a4", "acct-1", models.SeverityHigh)); !limited || !tripped {
+				t.Errorf("alert 4 of 3 limited %v, tripped %v, want the limiter tripped", limited, tripped)
+			}
+			if limited, tripped := check(t, l, testAlert("a5", "acct-1", models.SeverityLow)); !limited || tripped {
+				t.Errorf("alert 5 of 3 limited %v, tripped %v, want it limited without a second trip", limited, tripped)
+			}
+
+			// Other accounts have counts of their own
+			if limited, _ := check(t, l, testAlert("b1", "acct-2", models.SeverityHigh)); limited {
+				t.Error("alert of another account limited")
+			}
+		})
+	}
+}
+
+func TestLimiterResetsAfterTheWindow(t *testing.T) {
+	for _, mode := range []string{"memory", "redis"} {
+		t.Run(mode, func(t *testing.T) {
+			var mr *miniredis.Miniredis
+			l := NewAccountLimiter(nil, 2, false)
+			if mode == "redis" {
+				mr = miniredis.RunT(t)
+				l = NewAccountLimiter(newTestRedis(t, mr), 2, false)
+			}
+
+			for i := 1; i <= 3; i++ {
+				check(t, l, testAlert(fmt.Sprint("a", i), "acct-1", models.SeverityHigh))
+			}
+			if limited, _ := check(t, l, testAlert("a4", "acct-1", models.SeverityHigh)); !limited {
+				t.Fatal("account not limited over its threshold")
+			}
+
+			// Half an hour on the account is still over its threshold
+			age(t, l, mr, "acct-1", 30*time.Minute)
+			if limited, tripped := check(t, l, testAlert("a5", "acct-1", models.SeverityHigh)); !limited || tripped {
+				t.Errorf("after 30 minutes limited %v, tripped %v, want it still limited", limited, tripped)
+			}
+
+			// Once its alerts fall out of the window it is notified again,
+			// and crossing the threshold again trips the limiter again
+			age(t, l, mr, "acct-1", time.Hour)
+			if limited, _ := check(t, l, testAlert("a6", "acct-1", models.SeverityHigh)); limited {
+				t.Error("account still limited an hour later")
+			}
+			check(t, l, testAlert("a7", "acct-1", models.SeverityHigh))
+			if limited, tripped := check(t, l, testAlert("a8", "acct-1", models.SeverityHigh)); !limited || !tripped {
+				t.Errorf("crossing again limited %v, tripped %v, want the limiter tripped again", limited, tripped)
+			}
+		})
+	}
+}
+
+func TestCriticalAlertsBypassTheLimiter(t *testing.T) {
+	for mode, l := range limiters(t, 1, true) {
+		t.Run(mode, func(t *testing.T) {
+			for i := range 3 {
+				if limited, _ := check(t, l, testAlert(fmt.Sprint("c", i), "acct-1", models.SeverityCritical)); limited {
+					t.Errorf("critical alert %d limited", i)
+				}
+			}
+			// Critical alerts are not counted either
+			if limited, _ := check(t, l, testAlert("h1", "acct-1", models.SeverityHigh)); limited {
+				t.Error("first high alert limited, want the critical alerts uncounted")
+			}
+			if limited, _ := check(t, l, testAlert("h2", "acct-1", models.SeverityHigh)); !limited {
+				t.Error("second high alert not limited")
+			}
+			if limited, _ := check(t, l, testAlert("c3", "acct-1", models.SeverityCritical)); limited {
+				t.Error("critical alert of a limited account limited")
+			}
+		})
+	}
+
+	for mode, l := range limiters(t, 1, false) {
+		check(t, l, testAlert("c1", "acct-1", models.SeverityCritical))
+		if limited, _ := check(t, l, testAlert("c2", "acct-1", models.SeverityCritical)); !limited {
+			t.Errorf("%s: critical alert not limited without the bypass", mode)
+		}
+	}
+}
+
+func TestLimiterCountsAreSharedThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first := NewAccountLimiter(newTestRedis(t, mr), 2, false)
+	second := NewAccountLimiter(newTestRedis(t, mr), 2, false)
+
+	check(t, first, testAlert("a1", "acct-1", models.SeverityHigh))
+	check(t, second, testAlert("a2", "acct-1", models.SeverityHigh))
+	if limited, tripped := check(t, first, testAlert("a3", "acct-1", models.SeverityHigh)); !limited || !tripped {
+		t.Errorf("third alert across replicas limited %v, tripped %v", limited, tripped)
+	}
+	// Only one replica raises the meta-alert
+	if limited, tripped := check(t, second, testAlert("a4", "acct-1", models.SeverityHigh)); !limited || tripped {
+		t.Errorf("fourth alert on the other replica limited %v, tripped %v", limited, tripped)
+	}
+	if ttl := mr.TTL(countKey("acct-1")); ttl <= 0 || ttl > window {
+		t.Errorf("count expires in %s, want within the window", ttl)
+	}
+}
+
+func TestLimiterReportsRedisErrors(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewAccountLimiter(newTestRedis(t, mr), 2, false)
+	mr.Close()
+
+	limited, tripped, err := l.Check(context.Background(), testAlert("a1", "acct-1", models.SeverityHigh))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to count account alerts") {
+		t.Errorf("Check with Redis down = %v, want a count error", err)
+	}
+	if limited || tripped {
+		t.Error("alert limited although it could not be counted")
+	}
+}
+
+func TestMetaAlert(t *testing.T) {
+	trigger := testAlert("a4", "acct-1", models.SeverityLow)
+	meta := NewAccountLimiter(nil, 3, false).MetaAlert(trigger)
+
+	if want := fmt.Sprintf("alert_ratelimit_acct-1_%d", time.Now().Truncate(window).Unix()); meta.ID != want {
+		t.Errorf("ID = %s, want %s", meta.ID, want)
+	}
+	if meta.AccountID != "acct-1" || meta.TransactionID != "txn-a4" || meta.TenantID != "unit-a" {
+		t.Errorf("meta-alert not of the trigger's account: %+v", meta)
+	}
+	if meta.AlertType != models.AlertTypeOperational || meta.Severity != models.SeverityHigh ||
+		meta.RuleTriggered != models.RuleAccountRateLimit || meta.Status != models.StatusOpen {
+		t.Errorf("meta-alert = %+v", meta)
+	}
+	if !strings.HasPrefix(meta.Description, "account acct-1 exceeded 3 alerts/hour") {
+		t.Errorf("description = %q", meta.Description)
+	}
+}
@@ -0,0 +1,191 @@
+package maintenance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+)
+
+// summaryLimit caps the alerts summarized for a closed window
+const summaryLimit = 10000
+
+// Poster posts a plain text message, e.g. to Slack
+type Poster interface {
+	PostText(ctx context.Context, message string) error
+}
+
+// Manager decides whether alerts fall in a maintenance window or quiet
+// hours. Windows live in the database so every replica shares them; each
+// replica caches the ones not yet ended and refreshes the cache periodically.
+type Manager struct {
+	store  *storage.Storage
+	poster Poster
+	static []Static
+	quiet  *QuietHours
+
+	mu      sync.RWMutex
+	windows []*models.MaintenanceWindow
+}
+
+// NewManager creates a maintenance manager. poster and quiet may be nil.
+func NewManager(store *storage.Storage, poster Poster, static []Static, quiet *QuietHours) *Manager {
+	return &Manager{
+		store:  store,
+		poster: poster,
+		static: static,
+		quiet:  quiet,
+	}
+}
+
+// Run refreshes the window cache on every tick, summarizing windows that
+// have closed, until ctx is cancelled
+func (m *Manager) Run(ctx context.Context, ticks <-chan time.Time) {
+	m.refresh(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			m.refresh(ctx)
+		}
+	}
+}
+
+// refresh stores the current static windows, reloads the cache and sends
+// the summaries of closed windows
+func (m *Manager) refresh(ctx context.Context) {
+	now := time.Now()
+
+	for _, w := range m.staticWindows(now) {
+		if err := m.store.InsertMaintenanceWindow(ctx, w); err != nil {
+			log.Printf("maintenance: %v", err)
+		}
+	}
+
+	windows, err := m.store.ListMaintenanceWindows(ctx, now)
+	if err != nil {
+		log.Printf("maintenance: %v", err)
+	} else {
+		m.mu.Lock()
+		m.windows = windows
+		m.mu.Unlock()
+	}
+
+	ended, err := m.store.ClaimEndedMaintenanceWindows(ctx, now)
+	if err != nil {
+		log.Printf("maintenance: %v", err)
+		return
+	}
+	for _, w := range ended {
+		if err := m.summarize(ctx, w); err != nil {
+			log.Printf("maintenance window %s: %v", w.ID, err)
+		}
+	}
+}
+
+// staticWindows returns the configured windows in effect at now. Their IDs
+// are derived from their times, so every replica stores the same rows.
+func (m *Manager) staticWindows(now time.Time) []*models.MaintenanceWindow {
+	var windows []*models.MaintenanceWindow
+	for i, s := range m.static {
+		start, end := s.Start, s.End
+		if s.Cron != nil {
+			var ok bool
+			if start, ok = s.Occurrence(now); !ok {
+				continue
+			}
+			end = start.Add(s.Duration)
+		} else if !now.Before(end) {
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%d/%d", i, start.Unix(), end.Unix())))
+		windows = append(windows, &models.MaintenanceWindow{
+			ID:        "mw_static_" + hex.EncodeToString(sum[:8]),
+			Start:     start,
+			End:       end,
+			Reason:    "scheduled maintenance",
+			Scope:     models.MaintenanceScopeAll,
+			CreatedBy: "config",
+			CreatedAt: now,
+		})
+	}
+	return windows
+}
+
+// Add caches a newly created window so it applies on this replica at once
+func (m *Manager) Add(w *models.MaintenanceWindow) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = append(m.windows, w)
+}
+
+// Remove drops a window from the cache once it has been ended
+func (m *Manager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, w := range m.windows {
+		if w.ID == id {
+			m.windows = append(m.windows[:i:i], m.windows[i+1:]...)
+			return
+		}
+	}
+}
+
+// Window returns the maintenance window covering an alert at t, if any
+func (m *Manager) Window(alert *models.Alert, t time.Time) *models.MaintenanceWindow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, w := range m.windows {
+		if w.Active(t) && w.Covers(alert) {
+			return w
+		}
+	}
+	return nil
+}
+
+// Quiet reports whether an alert falls in the quiet hours of its severity
+func (m *Manager) Quiet(alert *models.Alert, t time.Time) bool {
+	return m.quiet != nil && m.quiet.Muted(alert.Severity, t)
+}
+
+// summarize posts a summary of the alerts suppressed during a window
+func (m *Manager) summarize(ctx context.Context, w *models.MaintenanceWindow) error {
+	filter := storage.AlertFilter{
+		Status: models.StatusSuppressedMaintenance,
+		From:   w.Start,
+		To:     w.End,
+		Limit:  summaryLimit,
+	}
+	switch w.Scope {
+	case models.MaintenanceScopeAccount:
+		filter.AccountID = w.ScopeValue
+	case models.MaintenanceScopeAlertType:
+		filter.AlertType = w.ScopeValue
+	}
+
+	alerts, err := m.store.ListAlerts(ctx, filter)
+	if err != nil {
+		return err
+	}
+	log.Printf("maintenance window %s closed with %d suppressed alerts", w.ID, len(alerts))
+	if m.poster == nil || len(alerts) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("🔧 *Maintenance window closed:* %s (%s – %s)\n%s",
+		w.Reason, w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339),
+		notifier.FormatDigest(notifier.Summarize(alerts)))
+	if err := m.poster.PostText(ctx, message); err != nil {
+		return fmt.Errorf("failed to post summary: %w", err)
+	}
+	return nil
+}
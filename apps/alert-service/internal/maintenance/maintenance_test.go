@@ -0,0 +1,128 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// base is when the windows of the tests start
+var base = time.Date(2026, 3, 2, 22, 0, 0, 0, time.UTC)
+
+// window returns a window of scope from base+from to base+to
+func window(id string, from, to time.Duration, scope, value string) *models.MaintenanceWindow {
+	return &models.MaintenanceWindow{
+		ID:         id,
+		Start:      base.Add(from),
+		End:        base.Add(to),
+		Reason:     "replay " + id,
+		Scope:      scope,
+		ScopeValue: value,
+	}
+}
+
+// windowID returns the ID of w, or "" when it is nil
+func windowID(w *models.MaintenanceWindow) string {
+	if w == nil {
+		return ""
+	}
+	return w.ID
+}
+
+func TestWindowOfOverlappingWindows(t *testing.T) {
+	m := NewManager(nil, nil, nil, nil)
+	m.Add(window("all", 0, 2*time.Hour, models.MaintenanceScopeAll, ""))
+	m.Add(window("acct", time.Hour, 4*time.Hour, models.MaintenanceScopeAccount, "acct-1"))
+	m.Add(window("fraud", 3*time.Hour, 5*time.Hour, models.MaintenanceScopeAlertType, models.AlertTypeFraud))
+
+	fraud := &models.Alert{AccountID: "acct-1", AlertType: models.AlertTypeFraud}
+	risk := &models.Alert{AccountID: "acct-2", AlertType: models.AlertTypeRisk}
+	tests := []struct {
+		name  string
+		alert *models.Alert
+		at    time.Duration
+		want  string
+	}{
+		{"before every window", fraud, -time.Minute, ""},
+		{"in the global window", risk, 30 * time.Minute, "all"},
+		{"first of two overlapping windows", fraud, 90 * time.Minute, "all"},
+		{"at the end of the global window", fraud, 2 * time.Hour, "acct"},
+		{"other account after the global window", risk, 2 * time.Hour, ""},
+		{"account and type windows overlapping", fraud, 3*time.Hour + 30*time.Minute, "acct"},
+		{"type window alone", &models.Alert{AccountID: "acct-3", AlertType: models.AlertTypeFraud}, 3*time.Hour + 30*time.Minute, "fraud"},
+		{"type window after the account window", fraud, 4 * time.Hour, "fraud"},
+		{"after every window", fraud, 5 * time.Hour, ""},
+	}
+	for _, tt := range tests {
+		if got := windowID(m.Window(tt.alert, base.Add(tt.at))); got != tt.want {
+			t.Errorf("%s: window = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveEndsAWindow(t *testing.T) {
+	m := NewManager(nil, nil, nil, nil)
+	m.Add(window("first", 0, time.Hour, models.MaintenanceScopeAll, ""))
+	m.Add(window("second", 0, 2*time.Hour, models.MaintenanceScopeAll, ""))
+	alert := &models.Alert{AccountID: "acct-1"}
+
+	m.Remove("first")
+	if got := windowID(m.Window(alert, base)); got != "second" {
+		t.Errorf("window after removing the first = %q, want the overlapping second", got)
+	}
+	m.Remove("unknown")
+	m.Remove("second")
+	if w := m.Window(alert, base); w != nil {
+		t.Errorf("window %s after removing both", w.ID)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	quiet, err := ParseQuietHours("low=22:00-08:00", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseQuietHours: %v", err)
+	}
+	m := NewManager(nil, nil, nil, quiet)
+	if !m.Quiet(&models.Alert{Severity: models.SeverityLow}, base) {
+		t.Error("low alert not quiet at 22:00")
+	}
+	if m.Quiet(&models.Alert{Severity: models.SeverityHigh}, base) {
+		t.Error("high alert quiet at 22:00")
+	}
+	if NewManager(nil, nil, nil, nil).Quiet(&models.Alert{Severity: models.SeverityLow}, base) {
+		t.Error("alert quiet without quiet hours")
+	}
+}
+
+func TestStaticWindows(t *testing.T) {
+	static, err := ParseStatic("2026-03-02T22:00:00Z/2026-03-03T02:00:00Z; 0 2 * * * 1h", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseStatic: %v", err)
+	}
+	m := NewManager(nil, nil, static, nil)
+
+	// Before the fixed window only it is stored ahead; the daily window is
+	// stored while it is in effect
+	windows := m.staticWindows(base.Add(-time.Hour))
+	if len(windows) != 1 || !windows[0].Start.Equal(base) || windows[0].Scope != models.MaintenanceScopeAll || windows[0].CreatedBy != "config" {
+		t.Fatalf("windows before the fixed window = %+v", windows)
+	}
+
+	at := time.Date(2026, 3, 3, 2, 30, 0, 0, time.UTC)
+	windows = m.staticWindows(at)
+	if len(windows) != 1 || !windows[0].Start.Equal(time.Date(2026, 3, 3, 2, 0, 0, 0, time.UTC)) || !windows[0].End.Equal(time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("windows at 02:30 after the fixed window = %+v", windows)
+	}
+
+	// Every replica derives the same ID for an occurrence, and another
+	// occurrence gets another
+	again := NewManager(nil, nil, static, nil).staticWindows(at.Add(20 * time.Minute))
+	if len(again) != 1 || again[0].ID != windows[0].ID {
+		t.Errorf("IDs of the same occurrence = %v and %v", windows, again)
+	}
+	next := m.staticWindows(at.Add(24 * time.Hour))
+	if len(next) != 1 || next[0].ID == windows[0].ID {
+		t.Errorf("the next day's occurrence shares ID %s", windows[0].ID)
+	}
+}
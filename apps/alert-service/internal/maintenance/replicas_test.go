@@ -0,0 +1,193 @@
+//go:build integration
+
+package maintenance
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+	"alert-service/internal/testdb"
+)
+
+// The replica tests share windows through Postgres in a container, each
+// test on a database of its own:
+//
+//	go test -tags=integration ./internal/maintenance/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(dbURL)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// recordingPoster records the messages posted, shared by the replicas
+type recordingPoster struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (p *recordingPoster) PostText(_ context.Context, message string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *recordingPoster) posted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.messages...)
+}
+
+// suppressAlert records an alert suppressed by maintenance at
+func suppressAlert(t *testing.T, store *storage.Storage, id, accountID string, at time.Time) {
+	t.Helper()
+	alert := &models.Alert{
+		ID:            id,
+		TransactionID: "txn-" + id,
+		AccountID:     accountID,
+		AlertType:     models.AlertTypeFraud,
+		Severity:      models.SeverityHigh,
+		RiskScore:     0.9,
+		Amount:        250,
+		Currency:      "USD",
+		Status:        models.StatusSuppressedMaintenance,
+		CreatedAt:     at,
+		UpdatedAt:     at,
+	}
+	if inserted, err := store.InsertAlert(context.Background(), alert); err != nil || !inserted {
+		t.Fatalf("InsertAlert(%s) = %v, %v", id, inserted, err)
+	}
+}
+
+func TestWindowsAreSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	poster := &recordingPoster{}
+	first := NewManager(store, poster, nil, nil)
+	second := NewManager(store, poster, nil, nil)
+
+	// The API stores a window and caches it on the replica it reached
+	now := time.Now()
+	w := &models.MaintenanceWindow{ID: "mw_replay", Start: now.Add(-time.Hour), End: now.Add(time.Hour), Reason: "replay",
+		Scope: models.MaintenanceScopeAll, CreatedBy: "ops", CreatedAt: now}
+	if err := store.InsertMaintenanceWindow(ctx, w); err != nil {
+		t.Fatalf("InsertMaintenanceWindow: %v", err)
+	}
+	first.Add(w)
+
+	alert := &models.Alert{AccountID: "acct-1", AlertType: models.AlertTypeFraud}
+	if second.Window(alert, now) != nil {
+		t.Fatal("window applies on the other replica before its refresh")
+	}
+	second.refresh(ctx)
+	if got := windowID(second.Window(alert, time.Now())); got != "mw_replay" {
+		t.Fatalf("window on the other replica after its refresh = %q", got)
+	}
+
+	suppressAlert(t, store, "a1", "acct-1", now.Add(-30*time.Minute))
+	suppressAlert(t, store, "a2", "acct-2", now.Add(-20*time.Minute))
+
+	// Ending the window lifts it everywhere, and exactly one replica sends
+	// its summary
+	if _, err := store.EndMaintenanceWindow(ctx, "mw_replay", time.Now()); err != nil {
+		t.Fatalf("EndMaintenanceWindow: %v", err)
+	}
+	first.Remove("mw_replay")
+	var wg sync.WaitGroup
+	for _, m := range []*Manager{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.refresh(ctx)
+		}()
+	}
+	wg.Wait()
+	first.refresh(ctx)
+
+	for name, m := range map[string]*Manager{"first": first, "second": second} {
+		if w := m.Window(alert, time.Now()); w != nil {
+			t.Errorf("%s replica still applies window %s", name, w.ID)
+		}
+	}
+	messages := poster.posted()
+	if len(messages) != 1 {
+		t.Fatalf("%d summaries posted, want 1", len(messages))
+	}
+	if !strings.HasPrefix(messages[0], "🔧 *Maintenance window closed:* replay (") || !strings.Contains(messages[0], "*Alert digest: 2 alerts*") {
+		t.Errorf("summary =\n%s", messages[0])
+	}
+}
+
+func TestSummaryIsScopedToTheWindow(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	poster := &recordingPoster{}
+	m := NewManager(store, poster, nil, nil)
+
+	now := time.Now()
+	account := &models.MaintenanceWindow{ID: "mw_account", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Minute), Reason: "account migration",
+		Scope: models.MaintenanceScopeAccount, ScopeValue: "acct-1", CreatedAt: now}
+	empty := &models.MaintenanceWindow{ID: "mw_empty", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Minute), Reason: "quiet night",
+		Scope: models.MaintenanceScopeAccount, ScopeValue: "acct-9", CreatedAt: now}
+	for _, w := range []*models.MaintenanceWindow{account, empty} {
+		if err := store.InsertMaintenanceWindow(ctx, w); err != nil {
+			t.Fatalf("InsertMaintenanceWindow: %v", err)
+		}
+	}
+	suppressAlert(t, store, "in", "acct-1", now.Add(-time.Hour))
+	suppressAlert(t, store, "other-account", "acct-2", now.Add(-time.Hour))
+	suppressAlert(t, store, "before", "acct-1", now.Add(-3*time.Hour))
+
+	m.refresh(ctx)
+	messages := poster.posted()
+	if len(messages) != 1 {
+		t.Fatalf("posted %q, want the account window's summary alone", messages)
+	}
+	if !strings.Contains(messages[0], "account migration") || !strings.Contains(messages[0], "*Alert digest: 1 alerts*") || !strings.Contains(messages[0], "• in (") {
+		t.Errorf("summary =\n%s", messages[0])
+	}
+}
+
+func TestStaticWindowsAreStoredOnce(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	static, err := ParseStatic(start.Format(time.RFC3339)+"/"+start.Add(2*time.Hour).Format(time.RFC3339), time.UTC)
+	if err != nil {
+		t.Fatalf("ParseStatic: %v", err)
+	}
+
+	replicas := []*Manager{NewManager(store, nil, static, nil), NewManager(store, nil, static, nil)}
+	for _, m := range replicas {
+		m.refresh(ctx)
+	}
+	windows, err := store.ListMaintenanceWindows(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ListMaintenanceWindows: %v", err)
+	}
+	if len(windows) != 1 || !windows[0].Start.Equal(start) || windows[0].CreatedBy != "config" {
+		t.Fatalf("stored windows = %+v, want the static window once", windows)
+	}
+	for i, m := range replicas {
+		if got := windowID(m.Window(&models.Alert{AccountID: "acct-1"}, start.Add(time.Minute))); got != windows[0].ID {
+			t.Errorf("replica %d applies %q, want the static window", i, got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Static is a maintenance window from the config: either a fixed range or
+// a recurring window opened by a cron expression
+type Static struct {
+	Start, End time.Time // fixed range
+	Cron       *Cron     // recurring; nil for a fixed range
+	Duration   time.Duration
+}
+
+// ParseStatic parses semicolon-separated static windows. Each is either a
+// fixed range "2024-01-06T22:00:00Z/2024-01-07T02:00:00Z" or a cron
+// expression followed by a duration, "0 2 * * 0 4h" for four hours from
+// 02:00 every Sunday.
+func ParseStatic(value string, location *time.Location) ([]Static, error) {
+	var windows []Static
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if start, end, ok := strings.Cut(entry, "/"); ok {
+			s, err1 := time.Parse(time.RFC3339, strings.TrimSpace(start))
+			e, err2 := time.Parse(time.RFC3339, strings.TrimSpace(end))
+			if err1 != nil || err2 != nil || !e.After(s) {
+				return nil, fmt.Errorf("invalid maintenance window %q", entry)
+			}
+			windows = append(windows, Static{Start: s, End: e})
+			continue
+		}
+
+		fields := strings.Fields(entry)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("invalid maintenance window %q: want 5 cron fields and a duration", entry)
+		}
+		cron, err := ParseCron(strings.Join(fields[:5], " "), location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", entry, err)
+		}
+		duration, err := time.ParseDuration(fields[5])
+		if err != nil || duration < time.Minute {
+			return nil, fmt.Errorf("invalid maintenance window %q: bad duration", entry)
+		}
+		windows = append(windows, Static{Cron: cron, Duration: duration})
+	}
+	return windows, nil
+}
+
+// Occurrence returns the start of the occurrence of a recurring window that
+// is in effect at t, if any
+func (s Static) Occurrence(t time.Time) (time.Time, bool) {
+	for start := t.Truncate(time.Minute); t.Sub(start) < s.Duration; start = start.Add(-time.Minute) {
+		if s.Cron.Matches(start) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Cron is a five-field cron expression (minute hour day-of-month month
+// day-of-week) supporting *, lists, ranges and steps
+type Cron struct {
+	minute, hour, dom, month, dow map[int]bool
+	location                      *time.Location
+}
+
+// ParseCron parses a cron expression evaluated in location
+func ParseCron(expr string, location *time.Location) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields", expr)
+	}
+
+	c := &Cron{location: location}
+	bounds := []struct {
+		set      *map[int]bool
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 6},
+	}
+	for i, b := range bounds {
+		set, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, err
+		}
+		*b.set = set
+	}
+	return c, nil
+}
+
+// Matches reports whether the cron fires in the minute of t
+func (c *Cron) Matches(t time.Time) bool {
+	t = t.In(c.location)
+	return c.minute[t.Minute()] && c.hour[t.Hour()] && c.dom[t.Day()] &&
+		c.month[int(t.Month())] && c.dow[int(t.Weekday())]
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid cron step %q", part)
+			}
+			part, step = base, n
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			from, to, isRange := strings.Cut(part, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(from)
+			hi = lo
+			if isRange {
+				hi, err2 = strconv.Atoi(to)
+			}
+			if err1 != nil || err2 != nil || lo < min || hi > max || lo > hi {
+				return nil, fmt.Errorf("invalid cron field %q", part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// QuietHours mutes alerts of some severities during a daily time range
+type QuietHours struct {
+	ranges   map[string][2]int // severity -> start, end minute of day
+	location *time.Location
+}
+
+// ParseQuietHours parses comma-separated "severity=HH:MM-HH:MM" ranges in
+// location. A range may wrap past midnight, e.g. low=22:00-08:00.
+func ParseQuietHours(value string, location *time.Location) (*QuietHours, error) {
+	q := &QuietHours{ranges: make(map[string][2]int), location: location}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		severity, span, ok := strings.Cut(entry, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		start, err1 := parseClock(from)
+		end, err2 := parseClock(to)
+		if !ok || !ok2 || err1 != nil || err2 != nil || start == end {
+			return nil, fmt.Errorf("invalid quiet hours %q", entry)
+		}
+		q.ranges[strings.TrimSpace(severity)] = [2]int{start, end}
+	}
+	return q, nil
+}
+
+// Muted reports whether alerts of a severity are muted at t
+func (q *QuietHours) Muted(severity string, t time.Time) bool {
+	r, ok := q.ranges[severity]
+	if !ok {
+		return false
+	}
+
+	t = t.In(q.location)
+	minute := t.Hour()*60 + t.Minute()
+	if r[0] < r[1] {
+		return minute >= r[0] && minute < r[1]
+	}
+	return minute >= r[0] || minute < r[1]
+}
+
+// parseClock parses HH:MM as minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,199 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newYork returns the America/New_York location, skipping the test without
+// a time zone database
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	return location
+}
+
+func TestParseStatic(t *testing.T) {
+	windows, err := ParseStatic(" 2026-01-06T22:00:00Z/2026-01-07T02:00:00Z ; 0 2 * * 0 4h;", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseStatic: %v", err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("%d windows, want 2", len(windows))
+	}
+	fixed := windows[0]
+	if fixed.Cron != nil || !fixed.Start.Equal(time.Date(2026, 1, 6, 22, 0, 0, 0, time.UTC)) || !fixed.End.Equal(time.Date(2026, 1, 7, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("fixed window = %+v", fixed)
+	}
+	recurring := windows[1]
+	if recurring.Cron == nil || recurring.Duration != 4*time.Hour {
+		t.Errorf("recurring window = %+v", recurring)
+	}
+
+	if windows, err := ParseStatic("", time.UTC); err != nil || len(windows) != 0 {
+		t.Errorf("ParseStatic of nothing = %v, %v", windows, err)
+	}
+}
+
+func TestParseStaticRejectsBadWindows(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2026-01-07T02:00:00Z/2026-01-06T22:00:00Z", "invalid maintenance window"},
+		{"2026-01-06T22:00:00Z/2026-01-06T22:00:00Z", "invalid maintenance window"},
+		{"yesterday/today", "invalid maintenance window"},
+		{"0 2 * * 0", "want 5 cron fields and a duration"},
+		{"0 2 * * 0 4h extra", "want 5 cron fields and a duration"},
+		{"0 24 * * 0 4h", "invalid cron field"},
+		{"0 2 * * 0 30s", "bad duration"},
+		{"0 2 * * 0 soon", "bad duration"},
+		{"2026-01-06T22:00:00Z/2026-01-07T02:00:00Z; 61 * * * * 1h", "invalid cron field"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseStatic(tt.value, time.UTC); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseStatic(%q) = %v, want %q", tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"* * * * *", time.Date(2026, 3, 2, 9, 31, 0, 0, time.UTC), true},
+		{"30 9 * * *", time.Date(2026, 3, 2, 9, 30, 59, 0, time.UTC), true},
+		{"30 9 * * *", time.Date(2026, 3, 2, 9, 31, 0, 0, time.UTC), false},
+		{"0,30 9 * * *", time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC), true},
+		{"*/15 * * * *", time.Date(2026, 3, 2, 9, 45, 0, 0, time.UTC), true},
+		{"*/15 * * * *", time.Date(2026, 3, 2, 9, 50, 0, 0, time.UTC), false},
+		{"0 22-23 * * *", time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC), true},
+		{"0 22-23 * * *", time.Date(2026, 3, 2, 21, 0, 0, 0, time.UTC), false},
+		{"0 0-12/6 * * *", time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC), true},
+		{"0 0-12/6 * * *", time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC), false},
+		// 2026-03-01 is a Sunday
+		{"0 2 * * 0", time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC), true},
+		{"0 2 * * 0", time.Date(2026, 3, 2, 2, 0, 0, 0, time.UTC), false},
+		{"0 2 1 * *", time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC), true},
+		{"0 2 1 6 *", time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr, time.UTC)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := cron.Matches(tt.at); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCronIsEvaluatedInItsLocation(t *testing.T) {
+	cron, err := ParseCron("0 2 * * *", newYork(t))
+	if err != nil {
+		t.Fatalf("ParseCron: %v", err)
+	}
+	// 02:00 in New York is 07:00 UTC in winter
+	if !cron.Matches(time.Date(2026, 1, 15, 7, 0, 0, 0, time.UTC)) {
+		t.Error("cron does not fire at 02:00 New York time")
+	}
+	if cron.Matches(time.Date(2026, 1, 15, 2, 0, 0, 0, time.UTC)) {
+		t.Error("cron fires at 02:00 UTC")
+	}
+}
+
+func TestParseCronRejectsBadExpressions(t *testing.T) {
+	for _, expr := range []string{"* * * *", "* * * * * *", "60 * * * *", "* * 0 * *", "* * * 13 *", "* * * * 7", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	windows, err := ParseStatic("0 2 * * 0 4h", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseStatic: %v", err)
+	}
+	sunday := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{sunday.Add(-time.Minute), false},
+		{sunday, true},
+		{sunday.Add(3*time.Hour + 59*time.Minute + 30*time.Second), true},
+		{sunday.Add(4 * time.Hour), false},
+		{sunday.Add(24 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		start, ok := windows[0].Occurrence(tt.at)
+		if ok != tt.want || (ok && !start.Equal(sunday)) {
+			t.Errorf("occurrence at %s = %s, %v, want %v", tt.at, start, ok, tt.want)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := ParseQuietHours("low=22:00-08:00, medium = 12:00-13:30", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseQuietHours: %v", err)
+	}
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		severity string
+		at       time.Duration
+		want     bool
+	}{
+		{"low", 21*time.Hour + 59*time.Minute, false},
+		{"low", 22 * time.Hour, true},
+		{"low", 23*time.Hour + 59*time.Minute, true},
+		{"low", 0, true},
+		{"low", 7*time.Hour + 59*time.Minute, true},
+		{"low", 8 * time.Hour, false},
+		{"low", 12 * time.Hour, false},
+		{"medium", 11*time.Hour + 59*time.Minute, false},
+		{"medium", 12 * time.Hour, true},
+		{"medium", 13*time.Hour + 29*time.Minute, true},
+		{"medium", 13*time.Hour + 30*time.Minute, false},
+		{"medium", 23 * time.Hour, false},
+		{"high", 23 * time.Hour, false},
+		{"critical", 3 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		at := day.Add(tt.at)
+		if got := q.Muted(tt.severity, at); got != tt.want {
+			t.Errorf("%s muted at %s = %v, want %v", tt.severity, at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursAreInTheirLocation(t *testing.T) {
+	q, err := ParseQuietHours("low=22:00-08:00", newYork(t))
+	if err != nil {
+		t.Fatalf("ParseQuietHours: %v", err)
+	}
+	// 23:00 UTC is 18:00 in New York, and 04:00 UTC is 23:00
+	if q.Muted("low", time.Date(2026, 1, 15, 23, 0, 0, 0, time.UTC)) {
+		t.Error("low alerts muted at 18:00 New York time")
+	}
+	if !q.Muted("low", time.Date(2026, 1, 16, 4, 0, 0, 0, time.UTC)) {
+		t.Error("low alerts not muted at 23:00 New York time")
+	}
+}
+
+func TestParseQuietHoursRejectsBadRanges(t *testing.T) {
+	for _, value := range []string{"low", "low=22:00", "low=22:00-25:00", "low=10pm-8am", "low=08:00-08:00", "=22:00-08:00x"} {
+		if _, err := ParseQuietHours(value, time.UTC); err == nil {
+			t.Errorf("ParseQuietHours(%q) succeeded", value)
+		}
+	}
+}
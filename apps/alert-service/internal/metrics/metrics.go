@@ -0,0 +1,531 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	buildInfo = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "alert_build_info",
+			Help:        "Build information of the running binary, always 1",
+			ConstLabels: buildinfo.Labels(),
+		},
+	)
+
+	transactionsEvaluated = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_transactions_evaluated_total",
+			Help: "Total number of processed transactions evaluated, by outcome",
+		},
+		[]string{"outcome"},
+	)
+
+	alertsRaised = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_alerts_raised_total",
+			Help: "Total number of alerts raised",
+		},
+		[]string{"alert_type", "severity", "tenant"},
+	)
+
+	watchlistLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_watchlist_lookups_total",
+			Help: "Total number of watchlist lookups that found the account watchlisted (hit) or failed (error)",
+		},
+		[]string{"outcome"},
+	)
+
+	enrichments = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_enrichments_total",
+			Help: "Total number of account context lookups for alerts, by whether the context was fetched, read from the cache, or not found in time (failed)",
+		},
+		[]string{"outcome"},
+	)
+
+	alertsDeduplicated = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_alerts_deduplicated_total",
+			Help: "Total number of alerts skipped because they were already recorded",
+		},
+	)
+
+	incidentAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_incident_alerts_total",
+			Help: "Total number of alerts correlated into incidents, by whether the alert opened, joined or escalated its incident, or failed to be attached (error)",
+		},
+		[]string{"outcome"},
+	)
+
+	consumerErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_consumer_errors_total",
+			Help: "Total number of Kafka consumer errors, by input topic and stage",
+		},
+		[]string{"topic", "stage"},
+	)
+
+	consumerOversized = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_consumer_oversized_skipped_total",
+			Help: "Total number of messages skipped for exceeding the fetch size limit, by input topic",
+		},
+		[]string{"topic"},
+	)
+
+	consumerDeadLettered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_consumer_dead_lettered_total",
+			Help: "Total number of input messages parked on the input dead letter topic, by input topic",
+		},
+		[]string{"topic"},
+	)
+
+	consumerAbandoned = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_consumer_abandoned_total",
+			Help: "Total number of messages abandoned mid-handling because the shutdown drain timed out, by input topic",
+		},
+		[]string{"topic"},
+	)
+
+	consumerLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_consumer_lag",
+			Help: "Number of messages on an input topic not yet consumed",
+		},
+		[]string{"topic"},
+	)
+
+	consumerPartitionLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_consumer_partition_lag",
+			Help: "Number of messages on an input topic not yet committed per partition",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	consumerPaused = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_consumer_paused",
+			Help: "Whether consumption of an input topic is paused by an operator (1) or running (0)",
+		},
+		[]string{"topic"},
+	)
+
+	messagesQuarantined = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_messages_quarantined_total",
+			Help: "Total number of input messages quarantined for an unknown schema version",
+		},
+		[]string{"version"},
+	)
+
+	messagesDecoded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_messages_decoded_total",
+			Help: "Total number of input messages decoded, by schema version",
+		},
+		[]string{"version"},
+	)
+
+	consumerQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_consumer_worker_queue_depth",
+			Help: "Number of messages waiting in each consumer worker queue, by input topic",
+		},
+		[]string{"topic", "worker"},
+	)
+
+	sendDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alert_notification_send_duration_seconds",
+			Help:    "Duration of a single notification delivery attempt",
+			Buckets: buckets.For("alert_notification_send_duration_seconds", prometheus.DefBuckets),
+		},
+		[]string{"channel"},
+	)
+
+	endToEndLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alert_end_to_end_latency_seconds",
+			Help:    "Time from a transaction being processed to its alert notification being sent",
+			Buckets: buckets.For("alert_end_to_end_latency_seconds", prometheus.ExponentialBuckets(0.05, 2, 12)),
+		},
+		[]string{"channel"},
+	)
+
+	alertLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "alert_latency_seconds",
+			Help:    "Time from a transaction being processed to its alert notification being sent, by channel and severity",
+			Buckets: buckets.For("alert_latency_seconds", prometheus.ExponentialBuckets(0.005, 2, 15)),
+		},
+		[]string{"channel", "severity"},
+	)
+
+	alertLatencyClockSkew = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_latency_clock_skew_total",
+			Help: "Total number of notifications sent before their transaction was processed, observed as zero latency",
+		},
+	)
+
+	alertsSuppressed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_alerts_suppressed_total",
+			Help: "Total number of alerts recorded without notifying, by severity and reason",
+		},
+		[]string{"severity", "reason"},
+	)
+
+	digestSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alert_digest_size",
+			Help: "Number of alerts waiting for the next digest",
+		},
+	)
+
+	digestFlushes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_digest_flushes_total",
+			Help: "Total number of digests posted",
+		},
+	)
+
+	digestAlerts = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "alert_digest_alerts",
+			Help:    "Number of alerts summarized per posted digest",
+			Buckets: buckets.For("alert_digest_alerts", prometheus.ExponentialBuckets(1, 2, 10)),
+		},
+	)
+
+	retentionArchived = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_retention_archived_total",
+			Help: "Total number of resolved alerts archived for their retention",
+		},
+	)
+
+	retentionDeleted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_retention_deleted_total",
+			Help: "Total number of rows deleted for their retention, by table",
+		},
+		[]string{"table"},
+	)
+
+	retentionExpired = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alert_retention_expired_alerts",
+			Help: "Number of resolved alerts past their retention at the last dry run",
+		},
+	)
+
+	staleOpenAlerts = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alert_stale_open_alerts",
+			Help: "Number of open alerts older than the stale open alert age at the last check",
+		},
+	)
+
+	notifications = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_notifications_total",
+			Help: "Total number of notification deliveries, by channel and outcome",
+		},
+		[]string{"channel", "outcome"},
+	)
+
+	slackDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_slack_deliveries_total",
+			Help: "Total number of Slack deliveries, by destination and outcome",
+		},
+		[]string{"destination", "outcome"},
+	)
+
+	slackRateLimited = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_slack_rate_limited_total",
+			Help: "Total number of Slack requests rejected with 429 and retried",
+		},
+	)
+
+	templateFallbacks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_template_fallbacks_total",
+			Help: "Total number of custom templates that failed to render and fell back to the default",
+		},
+		[]string{"template"},
+	)
+
+	streamSubscribers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alert_stream_subscribers",
+			Help: "Number of connected alert stream subscribers",
+		},
+	)
+
+	streamSubscribersDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alert_stream_subscribers_dropped_total",
+			Help: "Total number of alert stream subscribers disconnected for falling behind",
+		},
+	)
+)
+
+// Evaluation outcomes
+const (
+	OutcomeAlerted = "alerted"
+	OutcomeSkipped = "skipped"
+)
+
+// Enrichment outcomes
+const (
+	EnrichmentFetched = "fetched"
+	EnrichmentCached  = "cached"
+	EnrichmentFailed  = "failed"
+)
+
+// Consumer error stages
+const (
+	ConsumerStageRead   = "read"
+	ConsumerStageDecode = "decode"
+	ConsumerStageHandle = "handle"
+	ConsumerStageCommit = "commit"
+)
+
+// Notification delivery outcomes
+const (
+	NotificationDelivered = "delivered"
+	NotificationFailed    = "failed"   // every attempt failed
+	NotificationRequeued  = "requeued" // parked on the dead letter queue
+	NotificationDropped   = "dropped"  // not sent by policy, e.g. a spend cap
+)
+
+// Incident correlation outcomes
+const (
+	IncidentOpened    = "opened"
+	IncidentJoined    = "joined"
+	IncidentEscalated = "escalated"
+	IncidentError     = "error"
+)
+
+// Suppression reasons
+const (
+	SuppressedRateLimit   = "rate_limit"
+	SuppressedMaintenance = "maintenance"
+	SuppressedQuietHours  = "quiet_hours"
+)
+
+// RecordEvaluation records the outcome of evaluating a transaction
+func RecordEvaluation(outcome string) {
+	transactionsEvaluated.WithLabelValues(outcome).Inc()
+}
+
+// tenants are the tenants labelled by name; the others share one label
+var tenants tenant.Set
+
+// SetTenants sets the tenants labelled by name in tenant labels
+func SetTenants(allowed tenant.Set) {
+	tenants = allowed
+}
+
+// RecordAlert records a raised alert
+func RecordAlert(alertType, severity, tenantID string) {
+	alertsRaised.WithLabelValues(alertType, severity, tenants.Label(tenantID)).Inc()
+}
+
+// RecordWatchlistHit records a transaction on a watchlisted account
+func RecordWatchlistHit() {
+	watchlistLookups.WithLabelValues("hit").Inc()
+}
+
+// RecordWatchlistError records a failed watchlist lookup
+func RecordWatchlistError() {
+	watchlistLookups.WithLabelValues("error").Inc()
+}
+
+// RecordEnrichment records the outcome of an account context lookup
+func RecordEnrichment(outcome string) {
+	enrichments.WithLabelValues(outcome).Inc()
+}
+
+// RecordDeduplicated records an alert skipped as already recorded
+func RecordDeduplicated() {
+	alertsDeduplicated.Inc()
+}
+
+// RecordIncidentAlert records the outcome of correlating an alert into an
+// incident
+func RecordIncidentAlert(outcome string) {
+	incidentAlerts.WithLabelValues(outcome).Inc()
+}
+
+// RecordConsumerError records a consumer error on an input topic at the
+// given stage
+func RecordConsumerError(topic, stage string) {
+	consumerErrors.WithLabelValues(topic, stage).Inc()
+}
+
+// ConsumerMetrics reports the measurements of the Kafka consumer of Topic as
+// alert service metrics
+type ConsumerMetrics struct {
+	Topic string
+}
+
+// RecordError records a consumer error at the given stage
+func (m ConsumerMetrics) RecordError(stage string) { RecordConsumerError(m.Topic, stage) }
+
+// SetQueueDepth records the queue depth of a consumer worker
+func (m ConsumerMetrics) SetQueueDepth(worker string, depth int) {
+	consumerQueueDepth.WithLabelValues(m.Topic, worker).Set(float64(depth))
+}
+
+// RecordDeadLettered records an input message parked on the input dead
+// letter topic
+func (m ConsumerMetrics) RecordDeadLettered() { consumerDeadLettered.WithLabelValues(m.Topic).Inc() }
+
+// RecordAbandoned records a shutdown drain that timed out
+func (m ConsumerMetrics) RecordAbandoned() { consumerAbandoned.WithLabelValues(m.Topic).Inc() }
+
+// RecordOversized records a message skipped for its size
+func (m ConsumerMetrics) RecordOversized() { consumerOversized.WithLabelValues(m.Topic).Inc() }
+
+// SetLag records the consumer lag
+func (m ConsumerMetrics) SetLag(lag int64) { consumerLag.WithLabelValues(m.Topic).Set(float64(lag)) }
+
+// SetPartitionLag records the lag of a partition
+func (m ConsumerMetrics) SetPartitionLag(partition int, lag int64) {
+	consumerPartitionLag.WithLabelValues(m.Topic, strconv.Itoa(partition)).Set(float64(lag))
+}
+
+// SetPaused records whether consumption is paused
+func (m ConsumerMetrics) SetPaused(paused bool) {
+	if paused {
+		consumerPaused.WithLabelValues(m.Topic).Set(1)
+	} else {
+		consumerPaused.WithLabelValues(m.Topic).Set(0)
+	}
+}
+
+// RecordQuarantined records an input message quarantined for its schema
+// version
+func RecordQuarantined(version string) {
+	messagesQuarantined.WithLabelValues(version).Inc()
+}
+
+// RecordDecoded records a decoded input message of a schema version
+func RecordDecoded(version int) {
+	messagesDecoded.WithLabelValues(strconv.Itoa(version)).Inc()
+}
+
+// RecordSendDuration records the duration of a delivery attempt
+func RecordSendDuration(channel string, seconds float64) {
+	sendDuration.WithLabelValues(channel).Observe(seconds)
+}
+
+// ObserveAlertLatency records the time from transaction processing to a
+// notification sent at sentAt, with the transaction ID as the exemplar. A
+// negative latency, from clocks skewed between hosts, is counted and
+// observed as zero. alert_end_to_end_latency_seconds predates
+// alert_latency_seconds and is still observed for existing dashboards.
+func ObserveAlertLatency(transactionID, channel, severity string, processedAt, sentAt time.Time) {
+	latency := sentAt.Sub(processedAt).Seconds()
+	if latency < 0 {
+		alertLatencyClockSkew.Inc()
+		latency = 0
+	}
+	endToEndLatency.WithLabelValues(channel).Observe(latency)
+
+	observer := alertLatency.WithLabelValues(channel, severity)
+	if exemplar, ok := observer.(prometheus.ExemplarObserver); ok && transactionID != "" {
+		exemplar.ObserveWithExemplar(latency, prometheus.Labels{"transaction_id": transactionID})
+		return
+	}
+	observer.Observe(latency)
+}
+
+// RecordSuppressed records an alert recorded without notifying
+func RecordSuppressed(severity, reason string) {
+	alertsSuppressed.WithLabelValues(severity, reason).Inc()
+}
+
+// SetDigestSize records the number of alerts waiting for the next digest
+func SetDigestSize(size int) {
+	digestSize.Set(float64(size))
+}
+
+// RecordRetentionPurge records alerts archived and deleted with their
+// notifications for their retention
+func RecordRetentionPurge(alerts, notifications int) {
+	retentionArchived.Add(float64(alerts))
+	retentionDeleted.WithLabelValues("alerts").Add(float64(alerts))
+	retentionDeleted.WithLabelValues("notifications").Add(float64(notifications))
+}
+
+// SetRetentionExpired records the alerts a dry run found past their
+// retention
+func SetRetentionExpired(count int64) {
+	retentionExpired.Set(float64(count))
+}
+
+// SetStaleOpenAlerts records the number of stale open alerts
+func SetStaleOpenAlerts(count int64) {
+	staleOpenAlerts.Set(float64(count))
+}
+
+// SetStreamSubscribers records the number of alert stream subscribers
+func SetStreamSubscribers(n int) {
+	streamSubscribers.Set(float64(n))
+}
+
+// RecordStreamSubscriberDropped records a subscriber disconnected for
+// falling behind
+func RecordStreamSubscriberDropped() {
+	streamSubscribersDropped.Inc()
+}
+
+// RecordDigestFlush records a posted digest and the number of alerts in it
+func RecordDigestFlush(alerts int) {
+	digestFlushes.Inc()
+	digestAlerts.Observe(float64(alerts))
+}
+
+// RecordTemplateFallback records a custom template falling back to the default
+func RecordTemplateFallback(template string) {
+	templateFallbacks.WithLabelValues(template).Inc()
+}
+
+// RecordNotification records the outcome of a notification delivery
+func RecordNotification(channel, outcome string) {
+	notifications.WithLabelValues(channel, outcome).Inc()
+}
+
+// RecordSlackDelivery records the outcome of a Slack delivery to a
+// destination
+func RecordSlackDelivery(destination, outcome string) {
+	slackDeliveries.WithLabelValues(destination, outcome).Inc()
+}
+
+// RecordSlackRateLimited records a Slack request rejected with 429
+func RecordSlackRateLimited() {
+	slackRateLimited.Inc()
+}
+
+// SetBuildInfo exports the build_info gauge
+func SetBuildInfo() {
+	buildInfo.Set(1)
+}
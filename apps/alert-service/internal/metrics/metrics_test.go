@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogram returns the sample count and sum of the histogram name with
+// labels in the default registry
+func histogram(t *testing.T, name string, labels map[string]string) (uint64, float64) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestRecordAlertLabelsTenants(t *testing.T) {
+	SetTenants(tenant.Set{"unit-a": true})
+	defer SetTenants(nil)
+
+	RecordAlert("fraud", "high", "unit-a")
+	RecordAlert("fraud", "high", "unit-a")
+	RecordAlert("fraud", "high", "unit-z")
+	RecordAlert("risk", "low", "")
+
+	tests := []struct {
+		alertType, severity, tenant string
+		want                        float64
+	}{
+		{"fraud", "high", "unit-a", 2},
+		{"fraud", "high", tenant.LabelOther, 1},
+		{"risk", "low", tenant.LabelDefault, 1},
+		{"fraud", "high", "unit-z", 0},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(alertsRaised.WithLabelValues(tt.alertType, tt.severity, tt.tenant)); got != tt.want {
+			t.Errorf("alerts raised{%s,%s,%s} = %v, want %v", tt.alertType, tt.severity, tt.tenant, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationCounters(t *testing.T) {
+	RecordNotification("slack", NotificationDelivered)
+	RecordNotification("slack", NotificationDelivered)
+	RecordNotification("slack", NotificationFailed)
+	RecordNotification("email", NotificationRequeued)
+
+	if got := testutil.ToFloat64(notifications.WithLabelValues("slack", NotificationDelivered)); got != 2 {
+		t.Errorf("slack delivered = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(notifications.WithLabelValues("slack", NotificationFailed)); got != 1 {
+		t.Errorf("slack failed = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(notifications.WithLabelValues("email", NotificationRequeued)); got != 1 {
+		t.Errorf("email requeued = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(notifications.WithLabelValues("email", NotificationDelivered)); got != 0 {
+		t.Errorf("email delivered = %v, want 0", got)
+	}
+}
+
+func TestSuppressedAndDeduplicatedCounters(t *testing.T) {
+	deduplicated := testutil.ToFloat64(alertsDeduplicated)
+	RecordSuppressed("low", SuppressedRateLimit)
+	RecordSuppressed("low", SuppressedQuietHours)
+	RecordSuppressed("low", SuppressedQuietHours)
+	RecordDeduplicated()
+
+	if got := testutil.ToFloat64(alertsSuppressed.WithLabelValues("low", SuppressedRateLimit)); got != 1 {
+		t.Errorf("suppressed by the rate limit = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(alertsSuppressed.WithLabelValues("low", SuppressedQuietHours)); got != 2 {
+		t.Errorf("suppressed in quiet hours = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(alertsDeduplicated) - deduplicated; got != 1 {
+		t.Errorf("deduplicated = %v, want 1", got)
+	}
+}
+
+func TestConsumerErrorCounters(t *testing.T) {
+	RecordConsumerError("transactions.processed", ConsumerStageDecode)
+	ConsumerMetrics{Topic: "transactions.processed"}.RecordError(ConsumerStageDecode)
+	ConsumerMetrics{Topic: "alerts.ops"}.RecordError(ConsumerStageDecode)
+
+	if got := testutil.ToFloat64(consumerErrors.WithLabelValues("transactions.processed", ConsumerStageDecode)); got != 2 {
+		t.Errorf("decode errors on transactions.processed = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(consumerErrors.WithLabelValues("alerts.ops", ConsumerStageDecode)); got != 1 {
+		t.Errorf("decode errors on alerts.ops = %v, want 1", got)
+	}
+}
+
+func TestAbandonedDrainsAreCountedByTopic(t *testing.T) {
+	ConsumerMetrics{Topic: "transactions.processed"}.RecordAbandoned()
+	if got := testutil.ToFloat64(consumerAbandoned.WithLabelValues("transactions.processed")); got != 1 {
+		t.Errorf("abandoned drains of transactions.processed = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(consumerAbandoned.WithLabelValues("alerts.ops")); got != 0 {
+		t.Errorf("abandoned drains of alerts.ops = %v, want 0", got)
+	}
+}
+
+func TestConsumerProgressIsTrackedByTopic(t *testing.T) {
+	fraud, ops := ConsumerMetrics{Topic: "transactions.processed"}, ConsumerMetrics{Topic: "alerts.ops"}
+	fraud.SetLag(120)
+	fraud.SetPartitionLag(0, 120)
+	ops.SetLag(0)
+	ops.SetPartitionLag(0, 0)
+	ops.SetPaused(true)
+
+	if got := testutil.ToFloat64(consumerLag.WithLabelValues("transactions.processed")); got != 120 {
+		t.Errorf("lag of transactions.processed = %v, want 120", got)
+	}
+	if got := testutil.ToFloat64(consumerLag.WithLabelValues("alerts.ops")); got != 0 {
+		t.Errorf("lag of alerts.ops = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(consumerPartitionLag.WithLabelValues("transactions.processed", "0")); got != 120 {
+		t.Errorf("partition lag of transactions.processed = %v, want 120", got)
+	}
+	if got := testutil.ToFloat64(consumerPaused.WithLabelValues("alerts.ops")); got != 1 {
+		t.Errorf("alerts.ops paused = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(consumerPaused.WithLabelValues("transactions.processed")); got != 0 {
+		t.Errorf("transactions.processed paused = %v, want 0", got)
+	}
+}
+
+func TestObserveAlertLatency(t *testing.T) {
+	processed := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	ObserveAlertLatency("txn-1", "pagerduty", "critical", processed, processed.Add(1500*time.Millisecond))
+	ObserveAlertLatency("txn-2", "pagerduty", "critical", processed, processed.Add(500*time.Millisecond))
+
+	count, sum := histogram(t, "alert_latency_seconds", map[string]string{"channel": "pagerduty", "severity": "critical"})
+	if count != 2 || sum != 2 {
+		t.Errorf("alert latency = %d samples summing %vs, want 2 summing 2s", count, sum)
+	}
+	count, sum = histogram(t, "alert_end_to_end_latency_seconds", map[string]string{"channel": "pagerduty"})
+	if count != 2 || sum != 2 {
+		t.Errorf("end to end latency = %d samples summing %vs, want 2 summing 2s", count, sum)
+	}
+
+	// A notification sent before its transaction was processed, by the
+	// skewed clocks, is observed as zero
+	skew := testutil.ToFloat64(alertLatencyClockSkew)
+	ObserveAlertLatency("txn-3", "pagerduty", "critical", processed, processed.Add(-time.Second))
+	count, sum = histogram(t, "alert_latency_seconds", map[string]string{"channel": "pagerduty", "severity": "critical"})
+	if count != 3 || sum != 2 {
+		t.Errorf("alert latency = %d samples summing %vs, want the skewed one observed as zero", count, sum)
+	}
+	if got := testutil.ToFloat64(alertLatencyClockSkew) - skew; got != 1 {
+		t.Errorf("clock skew = %v, want 1", got)
+	}
+}
+
+func TestRecordSendDuration(t *testing.T) {
+	RecordSendDuration("sms", 0.25)
+	RecordSendDuration("sms", 0.5)
+	if count, sum := histogram(t, "alert_notification_send_duration_seconds", map[string]string{"channel": "sms"}); count != 2 || sum != 0.75 {
+		t.Errorf("send duration = %d samples summing %vs, want 2 summing 0.75s", count, sum)
+	}
+}
+
+func TestMetricsAreValid(t *testing.T) {
+	problems, err := testutil.GatherAndLint(prometheus.DefaultGatherer)
+	if err != nil {
+		t.Fatalf("GatherAndLint: %v", err)
+	}
+	for _, problem := range problems {
+		if strings.HasPrefix(problem.Metric, "alert_") {
+			t.Errorf("%s: %s", problem.Metric, problem.Text)
+		}
+	}
+}
+
+func TestBuildInfoGauge(t *testing.T) {
+	SetBuildInfo()
+
+	want := `# HELP alert_build_info Build information of the running binary, always 1
+# TYPE alert_build_info gauge
+alert_build_info{goversion="` + runtime.Version() + `",revision="unknown",version="dev"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "alert_build_info"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// AuthMiddleware handles JWT authentication
+type AuthMiddleware struct {
+	jwtManager *auth.JWTManager
+}
+
+// NewAuthMiddleware creates a new authentication middleware
+func NewAuthMiddleware(jwtManager *auth.JWTManager) *AuthMiddleware {
+	return &AuthMiddleware{
+		jwtManager: jwtManager,
+	}
+}
+
+// RequireAuth wraps a handler and requires valid JWT authentication
+func (a *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract token from header
+		token, err := auth.ExtractTokenFromHeader(r)
+		if err != nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		// Validate token
+		claims, err := a.jwtManager.ValidateToken(token)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		// Add claims to context
+		ctx := auth.WithClaims(r.Context(), claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// RequireStreamAuth is RequireAuth for event streams: the token may also be
+// passed in the access_token query parameter
+func (a *AuthMiddleware) RequireStreamAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.ExtractTokenFromHeader(r)
+		if err != nil {
+			token, err = auth.ExtractTokenFromQuery(r)
+		}
+		if err != nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := a.jwtManager.ValidateToken(token)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := auth.WithClaims(r.Context(), claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// RequireRole wraps a handler and requires a specific role
+func (a *AuthMiddleware) RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !claims.HasRole(role) {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// RequireAnyRole wraps a handler and requires any of the specified roles
+func (a *AuthMiddleware) RequireAnyRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !claims.HasAnyRole(roles...) {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
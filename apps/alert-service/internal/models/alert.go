@@ -2,29 +2,12 @@ package models
 
 import (
 	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
 )
 
 // Alert represents a fraud or operational alert
-type Alert struct {
-	ID              string            `json:"id"`
-	TransactionID   string            `json:"transaction_id"`
-	AccountID       string            `json:"account_id"`
-	UserID          string            `json:"user_id"`
-	AlertType       string            `json:"alert_type"`
-	Severity        string            `json:"severity"`
-	RiskScore       float64           `json:"risk_score"`
-	Amount          float64           `json:"amount"`
-	Currency        string            `json:"currency"`
-	Description     string            `json:"description"`
-	RuleTriggered   string            `json:"rule_triggered"`
-	Status          string            `json:"status"`
-	CreatedAt       time.Time         `json:"created_at"`
-	UpdatedAt       time.Time         `json:"updated_at"`
-	ResolvedAt      *time.Time        `json:"resolved_at,omitempty"`
-	ResolvedBy      string            `json:"resolved_by,omitempty"`
-	ResolutionNotes string            `json:"resolution_notes,omitempty"`
-	Metadata        map[string]string `json:"metadata,omitempty"`
-}
+type Alert = shared.Alert
 
 // AlertRule represents a rule that can trigger alerts
 type AlertRule struct {
@@ -65,6 +48,143 @@ type Notification struct {
 	Status    string    `json:"status"`
 	SentAt    time.Time `json:"sent_at"`
 	Error     string    `json:"error,omitempty"`
+	// ExternalID is the provider's message ID, e.g. the Slack message ts
+	// used to thread follow-ups
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// MaintenanceWindow suppresses notifications for matching alerts between
+// Start and End. Alerts raised during it are recorded with status
+// suppressed_maintenance and summarized once it ends.
+type MaintenanceWindow struct {
+	ID         string    `json:"id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Reason     string    `json:"reason"`
+	Scope      string    `json:"scope"`
+	ScopeValue string    `json:"scope_value,omitempty"` // account ID or alert type
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Active reports whether the window is in effect at t
+func (w *MaintenanceWindow) Active(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Covers reports whether the window's scope includes an alert
+func (w *MaintenanceWindow) Covers(alert *Alert) bool {
+	switch w.Scope {
+	case MaintenanceScopeAll:
+		return true
+	case MaintenanceScopeAccount:
+		return alert.AccountID == w.ScopeValue
+	case MaintenanceScopeAlertType:
+		return alert.AlertType == w.ScopeValue
+	}
+	return false
+}
+
+// Constants for maintenance window scopes
+const (
+	MaintenanceScopeAll       = "all"
+	MaintenanceScopeAccount   = "account"
+	MaintenanceScopeAlertType = "alert_type"
+)
+
+// WatchlistEntry makes every transaction on an account raise an alert, for
+// investigators following the account, until ExpiresAt. A nil ExpiresAt
+// never expires.
+type WatchlistEntry struct {
+	AccountID string     `json:"account_id"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Active reports whether the entry is in effect at t
+func (e *WatchlistEntry) Active(t time.Time) bool {
+	return e.ExpiresAt == nil || t.Before(*e.ExpiresAt)
+}
+
+// Audit actions
+const (
+	AuditActionWatchlistAdd    = "watchlist_add"
+	AuditActionWatchlistRemove = "watchlist_remove"
+)
+
+// ArchivedAlert is a line of an alert archive: an alert deleted for its
+// retention, with its notifications
+type ArchivedAlert struct {
+	Alert         *Alert          `json:"alert"`
+	Notifications []*Notification `json:"notifications"`
+}
+
+// Incident groups the alerts sharing a correlation key, each raised within
+// the correlation window of the one before. It resolves once all its
+// alerts are resolved. TotalAmount adds up the amounts of its alerts as
+// raised, whatever their currency.
+type Incident struct {
+	ID             string     `json:"id"`
+	TenantID       string     `json:"tenant_id,omitempty"`
+	CorrelationKey string     `json:"correlation_key"`
+	AccountID      string     `json:"account_id"`
+	RuleTriggered  string     `json:"rule_triggered,omitempty"` // set when correlating by account and rule
+	Status         string     `json:"status"`
+	AlertCount     int        `json:"alert_count"`
+	MaxSeverity    string     `json:"max_severity"`
+	TotalAmount    float64    `json:"total_amount"`
+	FirstSeen      time.Time  `json:"first_seen"`
+	LastSeen       time.Time  `json:"last_seen"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Add counts an alert into the incident's aggregates
+func (i *Incident) Add(alert *Alert) {
+	i.AlertCount++
+	i.TotalAmount += alert.Amount
+	if SeverityRank(alert.Severity) > SeverityRank(i.MaxSeverity) {
+		i.MaxSeverity = alert.Severity
+	}
+	if i.FirstSeen.IsZero() || alert.CreatedAt.Before(i.FirstSeen) {
+		i.FirstSeen = alert.CreatedAt
+	}
+	if alert.CreatedAt.After(i.LastSeen) {
+		i.LastSeen = alert.CreatedAt
+	}
+}
+
+// Constants for incident status
+const (
+	IncidentStatusOpen     = "open"
+	IncidentStatusResolved = "resolved"
+)
+
+// Constants for the keys alerts are correlated into incidents by
+const (
+	CorrelateNone        = "none"
+	CorrelateAccount     = "account"
+	CorrelateAccountRule = "account_rule"
+)
+
+// SeverityRank orders severities from low, 1, to critical, 4. An unknown
+// severity ranks 0.
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	}
+	return 0
 }
 
 // AlertSummary represents aggregated alert data
@@ -82,18 +202,26 @@ type AlertSummary struct {
 
 // Constants for alert types
 const (
-	AlertTypeFraud       = "fraud"
-	AlertTypeOperational = "operational"
-	AlertTypeCompliance  = "compliance"
-	AlertTypeRisk        = "risk"
+	AlertTypeFraud       = shared.AlertTypeFraud
+	AlertTypeOperational = shared.AlertTypeOperational
+	AlertTypeCompliance  = shared.AlertTypeCompliance
+	AlertTypeRisk        = shared.AlertTypeRisk
 )
 
+// RuleAccountRateLimit is the rule of the meta-alert raised when an account
+// exceeds its alert rate
+const RuleAccountRateLimit = "account_rate_limit"
+
+// RuleWatchlist is the rule of the alerts raised for transactions on
+// watchlisted accounts
+const RuleWatchlist = "watchlist"
+
 // Constants for alert severity
 const (
-	SeverityLow      = "low"
-	SeverityMedium   = "medium"
-	SeverityHigh     = "high"
-	SeverityCritical = "critical"
+	SeverityLow      = shared.SeverityLow
+	SeverityMedium   = shared.SeverityMedium
+	SeverityHigh     = shared.SeverityHigh
+	SeverityCritical = shared.SeverityCritical
 )
 
 // Constants for alert status
@@ -103,14 +231,49 @@ const (
 	StatusResolved      = "resolved"
 	StatusFalsePositive = "false_positive"
 	StatusClosed        = "closed"
+	// StatusSuppressedMaintenance marks alerts raised during a maintenance
+	// window, recorded without notifying
+	StatusSuppressedMaintenance = "suppressed_maintenance"
 )
 
+// statusTransitions lists the statuses an alert may move to from each status
+var statusTransitions = map[string][]string{
+	StatusOpen:                  {StatusInvestigating},
+	StatusInvestigating:         {StatusResolved, StatusFalsePositive, StatusClosed},
+	StatusResolved:              {StatusClosed},
+	StatusFalsePositive:         {StatusClosed},
+	StatusSuppressedMaintenance: {StatusInvestigating, StatusClosed},
+}
+
+// CanTransition reports whether an alert may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsResolvedStatus reports whether a status ends the investigation of an alert
+func IsResolvedStatus(status string) bool {
+	switch status {
+	case StatusResolved, StatusFalsePositive, StatusClosed:
+		return true
+	}
+	return false
+}
+
 // Constants for notification channels
 const (
-	ChannelSlack   = "slack"
-	ChannelEmail   = "email"
-	ChannelWebhook = "webhook"
-	ChannelSMS     = "sms"
+	ChannelSlack     = "slack"
+	ChannelEmail     = "email"
+	ChannelWebhook   = "webhook"
+	ChannelSMS       = "sms"
+	ChannelPagerDuty = "pagerduty"
+	ChannelDigest    = "digest"  // buffered into the periodic digest
+	ChannelConsole   = "console" // printed to stdout, for local development
+	ChannelFile      = "file"    // appended to a file as NDJSON, for local development
 )
 
 // Constants for notification status
@@ -118,6 +281,7 @@ const (
 	NotificationStatusPending = "pending"
 	NotificationStatusSent    = "sent"
 	NotificationStatusFailed  = "failed"
+	NotificationStatusDropped = "dropped" // deliberately not sent, e.g. over the SMS budget
 )
 
 // Constants for rule types
@@ -131,6 +295,13 @@ const (
 	RuleTypePattern   = "pattern"
 )
 
+// Constants for rule action types
+const (
+	ActionTypeNotify       = "notify"         // config: channel
+	ActionTypeSetSeverity  = "set_severity"   // config: severity
+	ActionTypeSetAlertType = "set_alert_type" // config: alert_type
+)
+
 // Constants for condition operators
 const (
 	OperatorEquals      = "equals"
@@ -166,7 +337,29 @@ func CreateTablesSQL() []string {
 			resolved_at TIMESTAMP,
 			resolved_by VARCHAR(255),
 			resolution_notes TEXT,
-			metadata JSONB
+			assigned_to VARCHAR(255),
+			suppressed BOOLEAN DEFAULT false,
+			metadata JSONB,
+			tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+			source_topic VARCHAR(255) NOT NULL DEFAULT '',
+			incident_id VARCHAR(255)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS incidents (
+			id VARCHAR(255) PRIMARY KEY,
+			tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+			correlation_key VARCHAR(600) NOT NULL,
+			account_id VARCHAR(255) NOT NULL,
+			rule_triggered VARCHAR(255),
+			status VARCHAR(50) NOT NULL DEFAULT 'open',
+			alert_count INTEGER NOT NULL DEFAULT 0,
+			max_severity VARCHAR(20) NOT NULL,
+			total_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+			first_seen TIMESTAMP NOT NULL,
+			last_seen TIMESTAMP NOT NULL,
+			resolved_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 
 		`CREATE TABLE IF NOT EXISTS alert_rules (
@@ -182,6 +375,45 @@ func CreateTablesSQL() []string {
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS maintenance_windows (
+			id VARCHAR(255) PRIMARY KEY,
+			start_at TIMESTAMP NOT NULL,
+			end_at TIMESTAMP NOT NULL,
+			reason TEXT,
+			scope VARCHAR(50) NOT NULL,
+			scope_value VARCHAR(255),
+			created_by VARCHAR(255),
+			summary_sent BOOLEAN DEFAULT false,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS watchlist (
+			account_id VARCHAR(255) PRIMARY KEY,
+			reason TEXT NOT NULL,
+			expires_at TIMESTAMP,
+			created_by VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Shaped like the storage service's audit log, which it shares when
+		// both services use the same database
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor VARCHAR(255) NOT NULL,
+			action VARCHAR(100) NOT NULL,
+			subject VARCHAR(255),
+			details TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// One row per week whose stale open alert digest was sent, so only
+		// one replica sends it
+		`CREATE TABLE IF NOT EXISTS stale_alert_digests (
+			week_start DATE PRIMARY KEY,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS notifications (
 			id VARCHAR(255) PRIMARY KEY,
 			alert_id VARCHAR(255) NOT NULL,
@@ -192,11 +424,45 @@ func CreateTablesSQL() []string {
 			status VARCHAR(50) DEFAULT 'pending',
 			sent_at TIMESTAMP,
 			error TEXT,
+			external_id VARCHAR(255),
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 	}
 }
 
+// MigrationsSQL returns the SQL to bring tables created by earlier versions
+// up to date
+func MigrationsSQL() []string {
+	return []string{
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS assigned_to VARCHAR(255)`,
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS external_id VARCHAR(255)`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS suppressed BOOLEAN DEFAULT false`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS source_topic VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS incident_id VARCHAR(255)`,
+
+		// Signal rule edits, however they are made, so evaluators reload
+		`CREATE OR REPLACE FUNCTION notify_alert_rules_changed() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_notify('` + AlertRulesChannel + `', '');
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'alert_rules_changed') THEN
+				CREATE TRIGGER alert_rules_changed AFTER INSERT OR UPDATE OR DELETE ON alert_rules
+					FOR EACH STATEMENT EXECUTE FUNCTION notify_alert_rules_changed();
+			END IF;
+		END
+		$$`,
+	}
+}
+
+// AlertRulesChannel is the Postgres notification channel signalled when
+// alert rules change
+const AlertRulesChannel = "alert_rules_changed"
+
 // CreateIndexesSQL returns the SQL to create the necessary indexes
 func CreateIndexesSQL() []string {
 	return []string{
@@ -206,9 +472,18 @@ func CreateIndexesSQL() []string {
 		`CREATE INDEX IF NOT EXISTS idx_alerts_severity ON alerts(severity)`,
 		`CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_alerts_alert_type ON alerts(alert_type)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_assigned_to ON alerts(assigned_to)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_tenant_id ON alerts(tenant_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_resolved_at ON alerts(resolved_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_incident_id ON alerts(incident_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_incidents_correlation_key ON incidents(correlation_key, status, last_seen)`,
+		`CREATE INDEX IF NOT EXISTS idx_incidents_first_seen ON incidents(tenant_id, first_seen)`,
 		`CREATE INDEX IF NOT EXISTS idx_notifications_alert_id ON notifications(alert_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_notifications_status ON notifications(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_alert_rules_enabled ON alert_rules(enabled)`,
 		`CREATE INDEX IF NOT EXISTS idx_alert_rules_priority ON alert_rules(priority)`,
+		`CREATE INDEX IF NOT EXISTS idx_maintenance_windows_end_at ON maintenance_windows(end_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_watchlist_expires_at ON watchlist(expires_at)`,
 	}
 }
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	statuses := []string{StatusOpen, StatusInvestigating, StatusResolved, StatusFalsePositive, StatusClosed, StatusSuppressedMaintenance}
+	allowed := map[string][]string{
+		StatusOpen:                  {StatusInvestigating},
+		StatusInvestigating:         {StatusResolved, StatusFalsePositive, StatusClosed},
+		StatusResolved:              {StatusClosed},
+		StatusFalsePositive:         {StatusClosed},
+		StatusClosed:                nil,
+		StatusSuppressedMaintenance: {StatusInvestigating, StatusClosed},
+	}
+
+	for _, from := range statuses {
+		want := map[string]bool{}
+		for _, to := range allowed[from] {
+			want[to] = true
+		}
+		for _, to := range append(statuses, "", "reopened") {
+			if got := CanTransition(from, to); got != want[to] {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", from, to, got, want[to])
+			}
+		}
+	}
+	if CanTransition("unknown", StatusInvestigating) {
+		t.Error("an unknown status can transition")
+	}
+}
+
+func TestIsResolvedStatus(t *testing.T) {
+	for status, want := range map[string]bool{
+		StatusOpen:                  false,
+		StatusInvestigating:         false,
+		StatusResolved:              true,
+		StatusFalsePositive:         true,
+		StatusClosed:                true,
+		StatusSuppressedMaintenance: false,
+	} {
+		if got := IsResolvedStatus(status); got != want {
+			t.Errorf("IsResolvedStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestIncidentAggregates(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	var incident Incident
+
+	tests := []struct {
+		name      string
+		alert     *Alert
+		count     int
+		severity  string
+		total     float64
+		firstSeen time.Time
+		lastSeen  time.Time
+	}{
+		{"first alert", &Alert{Severity: SeverityMedium, Amount: 1200.10, CreatedAt: start},
+			1, SeverityMedium, 1200.10, start, start},
+		{"higher severity", &Alert{Severity: SeverityHigh, Amount: 300.20, CreatedAt: start.Add(4 * time.Minute)},
+			2, SeverityHigh, 1500.30, start, start.Add(4 * time.Minute)},
+		{"lower severity keeps the highest", &Alert{Severity: SeverityLow, Amount: 99.70, CreatedAt: start.Add(7 * time.Minute)},
+			3, SeverityHigh, 1600, start, start.Add(7 * time.Minute)},
+		// An alert recorded late, raised before the others, moves first seen
+		// back and leaves last seen
+		{"out of order", &Alert{Severity: SeverityMedium, Amount: 400, CreatedAt: start.Add(-2 * time.Minute)},
+			4, SeverityHigh, 2000, start.Add(-2 * time.Minute), start.Add(7 * time.Minute)},
+		{"critical", &Alert{Severity: SeverityCritical, Amount: 0, CreatedAt: start.Add(9 * time.Minute)},
+			5, SeverityCritical, 2000, start.Add(-2 * time.Minute), start.Add(9 * time.Minute)},
+		{"unknown severity ranks lowest", &Alert{Severity: "urgent", Amount: 500, CreatedAt: start.Add(9 * time.Minute)},
+			6, SeverityCritical, 2500, start.Add(-2 * time.Minute), start.Add(9 * time.Minute)},
+	}
+	for _, tt := range tests {
+		incident.Add(tt.alert)
+		if incident.AlertCount != tt.count || incident.MaxSeverity != tt.severity || math.Abs(incident.TotalAmount-tt.total) > 1e-9 {
+			t.Errorf("%s: %d alerts, max %s, total %v, want %d, %s, %v",
+				tt.name, incident.AlertCount, incident.MaxSeverity, incident.TotalAmount, tt.count, tt.severity, tt.total)
+		}
+		if !incident.FirstSeen.Equal(tt.firstSeen) || !incident.LastSeen.Equal(tt.lastSeen) {
+			t.Errorf("%s: seen %s to %s, want %s to %s", tt.name,
+				incident.FirstSeen.Format(time.Kitchen), incident.LastSeen.Format(time.Kitchen),
+				tt.firstSeen.Format(time.Kitchen), tt.lastSeen.Format(time.Kitchen))
+		}
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	ordered := []string{"", SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+	for i, severity := range ordered {
+		if got := SeverityRank(severity); got != i {
+			t.Errorf("SeverityRank(%q) = %d, want %d", severity, got, i)
+		}
+	}
+	if got := SeverityRank("urgent"); got != 0 {
+		t.Errorf("SeverityRank of an unknown severity = %d, want 0", got)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// RawTransaction represents the transaction as received by the ingestion service
+type RawTransaction = shared.Transaction
+
+// ProcessedTransaction represents a transaction published by the processing
+// service on transactions.processed
+type ProcessedTransaction = shared.ProcessedTransaction
+
+// Constants for risk levels
+const (
+	RiskLevelLow      = shared.RiskLevelLow
+	RiskLevelMedium   = shared.RiskLevelMedium
+	RiskLevelHigh     = shared.RiskLevelHigh
+	RiskLevelCritical = shared.RiskLevelCritical
+)
+
+// Constants for transaction statuses
+const (
+	TransactionStatusPending  = shared.TransactionStatusPending
+	TransactionStatusApproved = shared.TransactionStatusApproved
+	TransactionStatusRejected = shared.TransactionStatusRejected
+	TransactionStatusFlagged  = shared.TransactionStatusFlagged
+	TransactionStatusFailed   = shared.TransactionStatusFailed
+)
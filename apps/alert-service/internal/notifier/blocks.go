@@ -0,0 +1,119 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+)
+
+// Action IDs of the interactive alert buttons
+const (
+	SlackActionAcknowledge   = "alert_acknowledge"
+	SlackActionFalsePositive = "alert_false_positive"
+)
+
+// SlackAttachment wraps blocks so the message gets a severity-coloured bar
+type SlackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock is a Block Kit layout block
+type SlackBlock struct {
+	Type     string        `json:"type"`
+	Text     *SlackText    `json:"text,omitempty"`
+	Fields   []SlackText   `json:"fields,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+// SlackText is a Block Kit text object
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackButton is a Block Kit button element. Value carries the alert ID.
+type SlackButton struct {
+	Type     string    `json:"type"`
+	Text     SlackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+	Style    string    `json:"style,omitempty"`
+}
+
+// FormatSlackBlocks renders an alert as Block Kit blocks, escaping alert
+// content, with the account context it was enriched with. With interactive
+// set the message carries Acknowledge and False Positive buttons.
+func FormatSlackBlocks(alert *models.Alert, interactive bool) []SlackAttachment {
+	color, ok := severityColors[alert.Severity]
+	if !ok {
+		color = severityColors[models.SeverityMedium]
+	}
+
+	blocks := []SlackBlock{
+		{
+			Type: "header",
+			Text: &SlackText{Type: "plain_text", Text: fmt.Sprintf("🚨 %s %s alert", strings.ToUpper(alert.Severity), EscapeSlack(alert.AlertType))},
+		},
+	}
+
+	if alert.Description != "" {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: EscapeSlack(alert.Description)},
+		})
+	}
+
+	blocks = append(blocks, SlackBlock{
+		Type: "section",
+		Fields: []SlackText{
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Amount:*\n%.2f %s", alert.Amount, EscapeSlack(alert.Currency))},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Account:*\n%s", EscapeSlack(alert.AccountID))},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Risk score:*\n%.2f", alert.RiskScore)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Rule:*\n%s", EscapeSlack(alert.RuleTriggered))},
+		},
+	})
+
+	if fields := (templates.Data{Alert: alert}).AccountContext(); fields != nil {
+		lines := []string{"*Account context*"}
+		for _, field := range fields {
+			lines = append(lines, fmt.Sprintf("%s: %s", field.Label, EscapeSlack(field.Value)))
+		}
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: strings.Join(lines, "\n")},
+		})
+	}
+
+	blocks = append(blocks, SlackBlock{
+		Type: "context",
+		Elements: []interface{}{
+			SlackText{Type: "mrkdwn", Text: fmt.Sprintf("Transaction %s · %s", EscapeSlack(alert.TransactionID), alert.CreatedAt.Format("2006-01-02 15:04:05 MST"))},
+		},
+	})
+
+	if interactive {
+		blocks = append(blocks, SlackBlock{
+			Type: "actions",
+			Elements: []interface{}{
+				SlackButton{
+					Type:     "button",
+					Text:     SlackText{Type: "plain_text", Text: "Acknowledge"},
+					ActionID: SlackActionAcknowledge,
+					Value:    alert.ID,
+					Style:    "primary",
+				},
+				SlackButton{
+					Type:     "button",
+					Text:     SlackText{Type: "plain_text", Text: "False Positive"},
+					ActionID: SlackActionFalsePositive,
+					Value:    alert.ID,
+				},
+			},
+		})
+	}
+
+	return []SlackAttachment{{Color: color, Blocks: blocks}}
+}
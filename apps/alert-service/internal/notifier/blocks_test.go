@@ -0,0 +1,133 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"alert-service/internal/models"
+)
+
+// blocksFixtureJSON is the attachment posted for alertFixture
+const blocksFixtureJSON = `[{"color":"#e65100","blocks":[` +
+	`{"type":"header","text":{"type":"plain_text","text":"🚨 HIGH fraud alert"}},` +
+	`{"type":"section","text":{"type":"mrkdwn","text":"Amount over the 10000 threshold"}},` +
+	`{"type":"section","fields":[` +
+	`{"type":"mrkdwn","text":"*Amount:*\n12500.00 USD"},` +
+	`{"type":"mrkdwn","text":"*Account:*\nacct-1"},` +
+	`{"type":"mrkdwn","text":"*Risk score:*\n0.87"},` +
+	`{"type":"mrkdwn","text":"*Rule:*\nhigh_amount"}]},` +
+	`{"type":"context","elements":[{"type":"mrkdwn","text":"Transaction txn-1 · 2026-03-02 09:30:00 UTC"}]},` +
+	`{"type":"actions","elements":[` +
+	`{"type":"button","text":{"type":"plain_text","text":"Acknowledge"},"action_id":"alert_acknowledge","value":"alert-1","style":"primary"},` +
+	`{"type":"button","text":{"type":"plain_text","text":"False Positive"},"action_id":"alert_false_positive","value":"alert-1"}]}]}]`
+
+// blockTypes returns the types of the blocks of an attachment
+func blockTypes(attachment SlackAttachment) []string {
+	types := make([]string, len(attachment.Blocks))
+	for i, block := range attachment.Blocks {
+		types[i] = block.Type
+	}
+	return types
+}
+
+func TestFormatSlackBlocks(t *testing.T) {
+	got, err := json.Marshal(FormatSlackBlocks(alertFixture(), true))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != blocksFixtureJSON {
+		t.Errorf("attachments =\n%s\nwant\n%s", got, blocksFixtureJSON)
+	}
+}
+
+func TestFormatSlackBlocksWithoutButtons(t *testing.T) {
+	alert := alertFixture()
+	alert.Description = ""
+
+	attachments := FormatSlackBlocks(alert, false)
+	if len(attachments) != 1 {
+		t.Fatalf("%d attachments, want 1", len(attachments))
+	}
+	if got := blockTypes(attachments[0]); len(got) != 3 || got[0] != "header" || got[1] != "section" || got[2] != "context" {
+		t.Errorf("blocks = %v, want the header, fields and context only", got)
+	}
+}
+
+func TestFormatSlackBlocksColoursBySeverity(t *testing.T) {
+	colours := map[string]string{
+		models.SeverityCritical: "#b00020",
+		models.SeverityHigh:     "#e65100",
+		models.SeverityMedium:   "#f9a825",
+		models.SeverityLow:      "#2e7d32",
+		"unknown":               "#f9a825",
+	}
+	for severity, want := range colours {
+		alert := alertFixture()
+		alert.Severity = severity
+		if got := FormatSlackBlocks(alert, true)[0].Color; got != want {
+			t.Errorf("%s alert coloured %s, want %s", severity, got, want)
+		}
+	}
+}
+
+func TestFormatSlackBlocksEscapesAlertContent(t *testing.T) {
+	alert := alertFixture()
+	alert.Description = "Merchant <!channel> & <https://evil.example|click>"
+	alert.AccountID = "<@U123>"
+	alert.RuleTriggered = "a>b"
+
+	blocks := FormatSlackBlocks(alert, true)[0].Blocks
+	if got, want := blocks[1].Text.Text, "Merchant &lt;!channel&gt; &amp; &lt;https://evil.example|click&gt;"; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+	if got, want := blocks[2].Fields[1].Text, "*Account:*\n&lt;@U123&gt;"; got != want {
+		t.Errorf("account field = %q, want %q", got, want)
+	}
+	if got, want := blocks[2].Fields[3].Text, "*Rule:*\na&gt;b"; got != want {
+		t.Errorf("rule field = %q, want %q", got, want)
+	}
+}
+
+func TestBotNotifierPostsBlocks(t *testing.T) {
+	stub := newSlackAPIStub(t)
+	if _, err := newTestBotNotifier(t, stub, "fraud-alerts").SendAlert(context.Background(), alertFixture()); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	payloads, _ := stub.posted()
+	if len(payloads) != 1 {
+		t.Fatalf("%d messages posted, want 1", len(payloads))
+	}
+	payload := payloads[0]
+	if payload.Text != slackFixtureText {
+		t.Errorf("fallback text =\n%s\nwant\n%s", payload.Text, slackFixtureText)
+	}
+	// The stub decodes elements as maps, so compare the decoded JSON
+	got, err := json.Marshal(payload.Attachments)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var posted, want interface{}
+	if err := json.Unmarshal(got, &posted); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := json.Unmarshal([]byte(blocksFixtureJSON), &want); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(posted, want) {
+		t.Errorf("attachments =\n%s\nwant\n%s", got, blocksFixtureJSON)
+	}
+}
+
+func TestWebhookNotifierPostsPlainText(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusOK)
+	if _, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture()); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	payloads := stub.posted()
+	if len(payloads) != 1 || payloads[0].Text != slackFixtureText || len(payloads[0].Attachments) != 0 {
+		t.Errorf("posted %+v, want the plain text message without buttons", payloads)
+	}
+}
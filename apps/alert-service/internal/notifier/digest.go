@@ -0,0 +1,287 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// digestKey is the Redis list holding alerts waiting for the next digest
+const digestKey = "alert:digest"
+
+// digestTopItems is how many of the highest-risk alerts a digest lists
+const digestTopItems = 5
+
+// Digest buffers alerts and periodically posts a single Slack summary of
+// them in place of one message per alert. The buffer lives in Redis so a
+// restart does not lose the pending digest; without Redis it is kept in
+// memory.
+type Digest struct {
+	redis *redis.Client
+	slack *Notifier
+
+	mu     sync.Mutex
+	memory []*models.Alert
+}
+
+// NewDigest creates a new digest posting to slack. redisClient may be nil.
+func NewDigest(redisClient *redis.Client, slack *Notifier) *Digest {
+	return &Digest{redis: redisClient, slack: slack}
+}
+
+// SendAlert buffers an alert for the next digest. The notification stays
+// pending until the digest is posted.
+func (d *Digest) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelDigest,
+		Recipient: "digest",
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
+
+	if err := d.push(ctx, alert); err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	return notification, nil
+}
+
+// Preview renders the digest the alert would be posted in, were it the
+// only alert buffered
+func (d *Digest) Preview(alert *models.Alert) (*Preview, error) {
+	return &Preview{
+		Recipient: "digest",
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   FormatDigest(Summarize([]*models.Alert{alert})),
+	}, nil
+}
+
+// Run flushes the digest on every tick and once more when ctx is cancelled
+func (d *Digest) Run(ctx context.Context, ticks <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			// Flush with a fresh context: ctx is already cancelled
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := d.Flush(flushCtx); err != nil {
+				slog.Error("digest flush on shutdown failed", "error", err)
+			}
+			cancel()
+			return
+		case <-ticks:
+			if err := d.Flush(ctx); err != nil {
+				slog.ErrorContext(ctx, "digest flush failed", "error", err)
+			}
+		}
+	}
+}
+
+// Flush posts a summary of the buffered alerts and empties the buffer. If
+// posting fails the alerts are put back for the next flush.
+func (d *Digest) Flush(ctx context.Context) error {
+	alerts, err := d.drain(ctx)
+	if err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	message := FormatDigest(Summarize(alerts))
+	if _, err := d.slack.postText(ctx, message); err != nil {
+		for _, alert := range alerts {
+			if err := d.push(ctx, alert); err != nil {
+				slog.ErrorContext(logging.WithTransaction(ctx, alert.TransactionID, alert.AccountID),
+					"digest: failed to requeue alert", "alert_id", alert.ID, "error", err)
+			}
+		}
+		return fmt.Errorf("failed to post digest: %w", err)
+	}
+
+	metrics.RecordDigestFlush(len(alerts))
+	slog.InfoContext(ctx, "posted digest", "alerts", len(alerts))
+	return nil
+}
+
+// push appends an alert to the buffer
+func (d *Digest) push(ctx context.Context, alert *models.Alert) error {
+	if d.redis == nil {
+		d.mu.Lock()
+		d.memory = append(d.memory, alert)
+		metrics.SetDigestSize(len(d.memory))
+		d.mu.Unlock()
+		return nil
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	size, err := d.redis.RPush(ctx, digestKey, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to buffer alert: %w", err)
+	}
+	metrics.SetDigestSize(int(size))
+	return nil
+}
+
+// drain removes and returns all buffered alerts
+func (d *Digest) drain(ctx context.Context) ([]*models.Alert, error) {
+	if d.redis == nil {
+		d.mu.Lock()
+		alerts := d.memory
+		d.memory = nil
+		d.mu.Unlock()
+		metrics.SetDigestSize(0)
+		return alerts, nil
+	}
+
+	// Read and trim atomically so alerts pushed meanwhile stay buffered
+	var values *redis.StringSliceCmd
+	_, err := d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(ctx, digestKey, 0, -1)
+		pipe.Del(ctx, digestKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to drain digest: %w", err)
+	}
+	metrics.SetDigestSize(0)
+
+	alerts := make([]*models.Alert, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		var alert models.Alert
+		if err := json.Unmarshal([]byte(value), &alert); err != nil {
+			slog.WarnContext(ctx, "digest: dropping undecodable alert", "error", err)
+			continue
+		}
+		alerts = append(alerts, &alert)
+	}
+	return alerts, nil
+}
+
+// AccountCount is the number of alerts raised for an account
+type AccountCount struct {
+	AccountID string
+	Count     int
+}
+
+// DigestSummary aggregates a batch of alerts
+type DigestSummary struct {
+	Total      int
+	ByType     map[string]int
+	BySeverity map[string]int
+	// Amounts totals the flagged amount per currency
+	Amounts     map[string]float64
+	TopAccounts []AccountCount
+	// TopRisk holds the highest-risk alerts, riskiest first
+	TopRisk []*models.Alert
+}
+
+// Summarize aggregates alerts into a digest summary
+func Summarize(alerts []*models.Alert) *DigestSummary {
+	summary := &DigestSummary{
+		Total:      len(alerts),
+		ByType:     make(map[string]int),
+		BySeverity: make(map[string]int),
+		Amounts:    make(map[string]float64),
+	}
+
+	accounts := make(map[string]int)
+	for _, alert := range alerts {
+		summary.ByType[alert.AlertType]++
+		summary.BySeverity[alert.Severity]++
+		summary.Amounts[alert.Currency] += alert.Amount
+		accounts[alert.AccountID]++
+	}
+
+	for accountID, count := range accounts {
+		summary.TopAccounts = append(summary.TopAccounts, AccountCount{AccountID: accountID, Count: count})
+	}
+	sort.Slice(summary.TopAccounts, func(i, j int) bool {
+		a, b := summary.TopAccounts[i], summary.TopAccounts[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.AccountID < b.AccountID
+	})
+	if len(summary.TopAccounts) > digestTopItems {
+		summary.TopAccounts = summary.TopAccounts[:digestTopItems]
+	}
+
+	summary.TopRisk = append([]*models.Alert(nil), alerts...)
+	sort.SliceStable(summary.TopRisk, func(i, j int) bool {
+		return summary.TopRisk[i].RiskScore > summary.TopRisk[j].RiskScore
+	})
+	if len(summary.TopRisk) > digestTopItems {
+		summary.TopRisk = summary.TopRisk[:digestTopItems]
+	}
+
+	return summary
+}
+
+// FormatDigest renders a digest summary as Slack message text
+func FormatDigest(summary *DigestSummary) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "📋 *Alert digest: %d alerts*", summary.Total)
+
+	b.WriteString("\n*By severity:* ")
+	b.WriteString(formatCounts(summary.BySeverity))
+	b.WriteString("\n*By type:* ")
+	b.WriteString(formatCounts(summary.ByType))
+
+	b.WriteString("\n*Flagged amount:* ")
+	currencies := sortedKeys(summary.Amounts)
+	for i, currency := range currencies {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%.2f %s", summary.Amounts[currency], currency)
+	}
+
+	b.WriteString("\n*Top accounts:*")
+	for _, a := range summary.TopAccounts {
+		fmt.Fprintf(&b, "\n• %s: %d", a.AccountID, a.Count)
+	}
+
+	b.WriteString("\n*Highest risk:*")
+	for _, alert := range summary.TopRisk {
+		fmt.Fprintf(&b, "\n• %s (%.2f) %s, %.2f %s", alert.ID, alert.RiskScore, alert.AccountID, alert.Amount, alert.Currency)
+	}
+
+	return b.String()
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := sortedKeys(counts)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
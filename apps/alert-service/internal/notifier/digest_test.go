@@ -0,0 +1,261 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// digestAlert returns an alert of severity and type on account
+func digestAlert(id, accountID, severity, alertType string, riskScore, amount float64, currency string) *models.Alert {
+	return &models.Alert{
+		ID:        id,
+		AccountID: accountID,
+		Severity:  severity,
+		AlertType: alertType,
+		RiskScore: riskScore,
+		Amount:    amount,
+		Currency:  currency,
+	}
+}
+
+// gaugeValue returns the value of the unlabelled gauge name in the default
+// registry
+func gaugeValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// waitForPosts waits until the stub has received n payloads
+func waitForPosts(t *testing.T, stub *webhookStub, n int) []SlackPayload {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		payloads := stub.posted()
+		if len(payloads) >= n {
+			return payloads
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d posts, want %d", len(payloads), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSummarizeAggregates(t *testing.T) {
+	alerts := []*models.Alert{
+		digestAlert("a1", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.30, 100, "USD"),
+		digestAlert("a2", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.55, 250.50, "USD"),
+		digestAlert("a3", "acct-1", models.SeverityLow, models.AlertTypeRisk, 0.10, 20, "EUR"),
+		digestAlert("a4", "acct-2", models.SeverityMedium, models.AlertTypeRisk, 0.65, 1000, "USD"),
+		digestAlert("a5", "acct-2", models.SeverityLow, models.AlertTypeOperational, 0.05, 0, "USD"),
+		digestAlert("a6", "acct-3", models.SeverityMedium, models.AlertTypeFraud, 0.60, 80, "EUR"),
+		digestAlert("a7", "acct-4", models.SeverityLow, models.AlertTypeFraud, 0.20, 5, "GBP"),
+		digestAlert("a8", "acct-5", models.SeverityLow, models.AlertTypeFraud, 0.15, 5, "GBP"),
+		digestAlert("a9", "acct-6", models.SeverityLow, models.AlertTypeFraud, 0.25, 5, "GBP"),
+	}
+
+	summary := Summarize(alerts)
+	if summary.Total != 9 {
+		t.Errorf("total = %d, want 9", summary.Total)
+	}
+	if got := fmt.Sprint(summary.BySeverity); got != "map[low:6 medium:3]" {
+		t.Errorf("by severity = %s", got)
+	}
+	if got := fmt.Sprint(summary.ByType); got != "map[fraud:6 operational:1 risk:2]" {
+		t.Errorf("by type = %s", got)
+	}
+	if got := fmt.Sprint(summary.Amounts); got != "map[EUR:100 GBP:15 USD:1350.5]" {
+		t.Errorf("amounts = %s", got)
+	}
+	// Ties are broken by account ID, and only the top five are kept
+	if got := fmt.Sprint(summary.TopAccounts); got != "[{acct-1 3} {acct-2 2} {acct-3 1} {acct-4 1} {acct-5 1}]" {
+		t.Errorf("top accounts = %s", got)
+	}
+	var riskiest []string
+	for _, alert := range summary.TopRisk {
+		riskiest = append(riskiest, alert.ID)
+	}
+	if got := fmt.Sprint(riskiest); got != "[a4 a6 a2 a1 a9]" {
+		t.Errorf("top risk = %s, want the five riskiest, riskiest first", got)
+	}
+
+	empty := Summarize(nil)
+	if empty.Total != 0 || len(empty.TopAccounts) != 0 || len(empty.TopRisk) != 0 {
+		t.Errorf("summary of no alerts = %+v", empty)
+	}
+}
+
+func TestFormatDigest(t *testing.T) {
+	summary := Summarize([]*models.Alert{
+		digestAlert("a1", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.30, 100, "USD"),
+		digestAlert("a2", "acct-1", models.SeverityMedium, models.AlertTypeRisk, 0.55, 250.5, "USD"),
+		digestAlert("a3", "acct-2", models.SeverityLow, models.AlertTypeFraud, 0.10, 20, "EUR"),
+	})
+
+	want := "📋 *Alert digest: 3 alerts*\n" +
+		"*By severity:* low 2, medium 1\n" +
+		"*By type:* fraud 2, risk 1\n" +
+		"*Flagged amount:* 20.00 EUR, 350.50 USD\n" +
+		"*Top accounts:*\n" +
+		"• acct-1: 2\n" +
+		"• acct-2: 1\n" +
+		"*Highest risk:*\n" +
+		"• a2 (0.55) acct-1, 250.50 USD\n" +
+		"• a1 (0.30) acct-1, 100.00 USD\n" +
+		"• a3 (0.10) acct-2, 20.00 EUR"
+	if got := FormatDigest(summary); got != want {
+		t.Errorf("digest =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDigestFlushesOnTickAndShutdown(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusOK)
+	d := NewDigest(nil, NewNotifier(stub.URL, newTestRenderer(t)))
+	ticks := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, ticks)
+		close(done)
+	}()
+
+	first := []*models.Alert{
+		digestAlert("a1", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.3, 100, "USD"),
+		digestAlert("a2", "acct-2", models.SeverityMedium, models.AlertTypeFraud, 0.5, 200, "USD"),
+	}
+	for _, alert := range first {
+		notification, err := d.SendAlert(ctx, alert)
+		if err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+		if notification.Status != models.NotificationStatusPending || notification.Channel != models.ChannelDigest {
+			t.Errorf("notification = %+v, want it pending in the digest", notification)
+		}
+	}
+	if size := gaugeValue(t, "alert_digest_size"); size != 2 {
+		t.Errorf("digest size = %v, want 2", size)
+	}
+	// Nothing is posted until the ticker fires
+	time.Sleep(20 * time.Millisecond)
+	if payloads := stub.posted(); len(payloads) != 0 {
+		t.Fatalf("posted %d messages before the tick", len(payloads))
+	}
+
+	ticks <- time.Now()
+	payloads := waitForPosts(t, stub, 1)
+	if want := FormatDigest(Summarize(first)); payloads[0].Text != want {
+		t.Errorf("digest =\n%s\nwant\n%s", payloads[0].Text, want)
+	}
+
+	// An empty buffer posts nothing; the ticks are unbuffered, so the second
+	// has been received once the third is sent
+	ticks <- time.Now()
+	ticks <- time.Now()
+	if payloads := stub.posted(); len(payloads) != 1 {
+		t.Errorf("%d posts after empty ticks, want 1", len(payloads))
+	}
+
+	pending := digestAlert("a3", "acct-3", models.SeverityLow, models.AlertTypeRisk, 0.1, 5, "EUR")
+	if _, err := d.SendAlert(ctx, pending); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	payloads = stub.posted()
+	if len(payloads) != 2 || payloads[1].Text != FormatDigest(Summarize([]*models.Alert{pending})) {
+		t.Errorf("posts after shutdown = %+v, want the pending alert flushed", payloads)
+	}
+	if size := gaugeValue(t, "alert_digest_size"); size != 0 {
+		t.Errorf("digest size = %v after the flush, want 0", size)
+	}
+}
+
+func TestDigestBufferSurvivesRestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	stub := newWebhookStub(t, http.StatusOK)
+	before := NewDigest(client, NewNotifier(stub.URL, newTestRenderer(t)))
+	alert := digestAlert("a1", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.3, 100, "USD")
+	if _, err := before.SendAlert(context.Background(), alert); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	// A new process finds the buffered alert in Redis
+	after := NewDigest(client, NewNotifier(stub.URL, newTestRenderer(t)))
+	if err := after.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	payloads := stub.posted()
+	if len(payloads) != 1 || payloads[0].Text != FormatDigest(Summarize([]*models.Alert{alert})) {
+		t.Errorf("posted %+v, want the digest of the buffered alert", payloads)
+	}
+	if mr.Exists(digestKey) {
+		t.Error("buffer not emptied by the flush")
+	}
+}
+
+func TestDigestRequeuesWhenPostingFails(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	d := NewDigest(client, NewNotifier(newWebhookStub(t, http.StatusInternalServerError).URL, newTestRenderer(t)))
+	for _, id := range []string{"a1", "a2"} {
+		if _, err := d.SendAlert(context.Background(), digestAlert(id, "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.3, 100, "USD")); err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+	}
+	if err := d.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded against a failing webhook")
+	}
+	if n, _ := client.LLen(context.Background(), digestKey).Result(); n != 2 {
+		t.Fatalf("%d alerts buffered after the failed flush, want 2", n)
+	}
+
+	stub := newWebhookStub(t, http.StatusOK)
+	d.slack = NewNotifier(stub.URL, newTestRenderer(t))
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if payloads := stub.posted(); len(payloads) != 1 || !strings.HasPrefix(payloads[0].Text, "📋 *Alert digest: 2 alerts*") {
+		t.Errorf("posted %+v, want one digest of both alerts", payloads)
+	}
+}
+
+func TestDigestFailsWhenRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	mr.Close()
+
+	d := NewDigest(client, NewNotifier("", newTestRenderer(t)))
+	notification, err := d.SendAlert(context.Background(), digestAlert("a1", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.3, 100, "USD"))
+	if err == nil || notification.Status != models.NotificationStatusFailed {
+		t.Errorf("SendAlert with Redis down = %+v, %v, want it failed", notification, err)
+	}
+}
@@ -0,0 +1,255 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+)
+
+// Destination is a channel an alert is delivered to, with optional
+// per-destination overrides of the channel's configured target
+type Destination struct {
+	Channel      string   `json:"channel"`
+	WebhookURL   string   `json:"webhook_url,omitempty"`   // Slack or webhook URL override
+	SlackChannel string   `json:"slack_channel,omitempty"` // Slack channel override: a SLACK_WEBHOOKS name, or a channel in bot token mode
+	Recipients   []string `json:"recipients,omitempty"`    // email address or SMS number override
+	Path         string   `json:"path,omitempty"`          // notification file override
+}
+
+// key identifies destinations that can share a sender
+func (d Destination) key() string {
+	return d.Channel + "|" + d.WebhookURL + "|" + d.SlackChannel + "|" + strings.Join(d.Recipients, ",") + "|" + d.Path
+}
+
+// Route sends alerts matching a severity, alert type and source topic to a
+// set of destinations. Empty match fields match any value. A route on the
+// topic of operational alerts, listed first, keeps them to their own
+// channel, such as {"topic": "alerts.ops", "destinations": [{"channel":
+// "slack", "slack_channel": "pipeline-ops"}]}.
+type Route struct {
+	Severity     string        `json:"severity,omitempty"`
+	AlertType    string        `json:"alert_type,omitempty"`
+	Topic        string        `json:"topic,omitempty"`
+	Destinations []Destination `json:"destinations"`
+}
+
+func (r Route) matches(alert *models.Alert) bool {
+	return (r.Severity == "" || r.Severity == alert.Severity) &&
+		(r.AlertType == "" || r.AlertType == alert.AlertType) &&
+		(r.Topic == "" || r.Topic == alert.SourceTopic)
+}
+
+// RoutingPolicy decides where alerts are delivered. Routes are tried in
+// order and the first match wins; alerts matching no route go to Default.
+// A route with no destinations drops matching alerts.
+type RoutingPolicy struct {
+	Routes  []Route       `json:"routes"`
+	Default []Destination `json:"default"`
+}
+
+// LoadRoutingPolicy reads a JSON routing policy from a file
+func LoadRoutingPolicy(path string) (*RoutingPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing policy: %w", err)
+	}
+
+	var policy RoutingPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse routing policy %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+// RetryPolicy bounds the delivery attempts to one destination
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt
+	Backoff    time.Duration // wait before the first retry, doubled after each
+	Timeout    time.Duration // per attempt; zero means no timeout
+}
+
+// Delivery is the outcome of delivering an alert to one destination
+type Delivery struct {
+	Destination  Destination
+	Notification *models.Notification
+}
+
+// Failed reports whether every attempt to deliver failed
+func (d Delivery) Failed() bool {
+	return d.Notification.Status == models.NotificationStatusFailed
+}
+
+// SenderFactory builds the sender for a destination, or fails when the
+// channel is not enabled or the overrides are invalid
+type SenderFactory func(Destination) (Sender, error)
+
+// Dispatcher owns the channel senders and delivers each alert to the
+// destinations chosen by the routing policy
+type Dispatcher struct {
+	policy  *RoutingPolicy
+	factory SenderFactory
+	retry   RetryPolicy
+
+	mu      sync.Mutex
+	senders map[string]Sender
+}
+
+// NewDispatcher creates a dispatcher. Senders for every destination in the
+// policy are built up front so a bad policy fails at startup.
+func NewDispatcher(policy *RoutingPolicy, factory SenderFactory, retry RetryPolicy) (*Dispatcher, error) {
+	d := &Dispatcher{
+		policy:  policy,
+		factory: factory,
+		retry:   retry,
+		senders: make(map[string]Sender),
+	}
+
+	for i, route := range policy.Routes {
+		for _, dest := range route.Destinations {
+			if _, err := d.sender(dest); err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+	}
+	for _, dest := range policy.Default {
+		if _, err := d.sender(dest); err != nil {
+			return nil, fmt.Errorf("default route: %w", err)
+		}
+	}
+
+	return d, nil
+}
+
+// Dispatch delivers an alert and returns one delivery per destination.
+// Channels requested by a rule take precedence over the policy. Destinations
+// are sent to concurrently, so a slow or failing channel does not hold up
+// the others.
+func (d *Dispatcher) Dispatch(ctx context.Context, alert *models.Alert, channels []string) []Delivery {
+	destinations := d.route(alert, channels)
+	deliveries := make([]Delivery, len(destinations))
+
+	var wg sync.WaitGroup
+	for i, dest := range destinations {
+		wg.Add(1)
+		go func(i int, dest Destination) {
+			defer wg.Done()
+			deliveries[i] = d.Deliver(ctx, alert, dest)
+		}(i, dest)
+	}
+	wg.Wait()
+
+	return deliveries
+}
+
+// Deliver sends an alert to one destination, retrying failed attempts with
+// exponential backoff. It returns the record of the last attempt.
+func (d *Dispatcher) Deliver(ctx context.Context, alert *models.Alert, dest Destination) Delivery {
+	backoff := d.retry.Backoff
+	for attempt := 0; ; attempt++ {
+		notification := d.attempt(ctx, alert, dest)
+		if notification.Status == models.NotificationStatusDropped {
+			metrics.RecordNotification(dest.Channel, metrics.NotificationDropped)
+			return Delivery{Destination: dest, Notification: notification}
+		}
+		if notification.Status != models.NotificationStatusFailed {
+			metrics.RecordNotification(dest.Channel, metrics.NotificationDelivered)
+			return Delivery{Destination: dest, Notification: notification}
+		}
+		if attempt >= d.retry.MaxRetries || ctx.Err() != nil {
+			metrics.RecordNotification(dest.Channel, metrics.NotificationFailed)
+			return Delivery{Destination: dest, Notification: notification}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt makes a single delivery attempt within the per-attempt timeout
+func (d *Dispatcher) attempt(ctx context.Context, alert *models.Alert, dest Destination) *models.Notification {
+	if d.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.retry.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	notification := d.send(ctx, alert, dest)
+	metrics.RecordSendDuration(dest.Channel, time.Since(start).Seconds())
+	return notification
+}
+
+// route picks the destinations for an alert
+func (d *Dispatcher) route(alert *models.Alert, channels []string) []Destination {
+	if len(channels) > 0 {
+		destinations := make([]Destination, len(channels))
+		for i, channel := range channels {
+			destinations[i] = Destination{Channel: channel}
+		}
+		return destinations
+	}
+
+	for _, route := range d.policy.Routes {
+		if route.matches(alert) {
+			return route.Destinations
+		}
+	}
+	return d.policy.Default
+}
+
+// send delivers to one destination, always returning a notification record
+func (d *Dispatcher) send(ctx context.Context, alert *models.Alert, dest Destination) *models.Notification {
+	failed := func(err error) *models.Notification {
+		return &models.Notification{
+			ID:      newNotificationID(),
+			AlertID: alert.ID,
+			Channel: dest.Channel,
+			Status:  models.NotificationStatusFailed,
+			SentAt:  time.Now(),
+			Error:   err.Error(),
+		}
+	}
+
+	sender, err := d.sender(dest)
+	if err != nil {
+		return failed(err)
+	}
+
+	notification, err := sender.SendAlert(ctx, alert)
+	if notification == nil {
+		if err == nil {
+			err = fmt.Errorf("sender returned no notification")
+		}
+		return failed(err)
+	}
+	return notification
+}
+
+// sender returns the cached sender for a destination, building it on first use
+func (d *Dispatcher) sender(dest Destination) (Sender, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dest.key()
+	if s, ok := d.senders[key]; ok {
+		return s, nil
+	}
+
+	s, err := d.factory(dest)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: %w", dest.Channel, err)
+	}
+	d.senders[key] = s
+	return s, nil
+}
@@ -0,0 +1,304 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// fakeSender records the alerts sent to a destination. It fails the first
+// failures attempts, and blocks each attempt until its context is done when
+// hang is set.
+type fakeSender struct {
+	dest     Destination
+	failures int
+	hang     bool
+
+	mu       sync.Mutex
+	attempts int
+	sent     []string
+}
+
+func (f *fakeSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	f.mu.Lock()
+	f.attempts++
+	fail := f.attempts <= f.failures
+	f.mu.Unlock()
+
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   f.dest.Channel,
+		Recipient: f.dest.key(),
+		Status:    models.NotificationStatusSent,
+		SentAt:    time.Now(),
+	}
+	var err error
+	if f.hang {
+		<-ctx.Done()
+		err = ctx.Err()
+	} else if fail {
+		err = errors.New("channel unavailable")
+	}
+	if err != nil {
+		notification.Status, notification.Error, notification.SentAt = models.NotificationStatusFailed, err.Error(), time.Time{}
+		return notification, err
+	}
+
+	f.mu.Lock()
+	f.sent = append(f.sent, alert.ID)
+	f.mu.Unlock()
+	return notification, nil
+}
+
+// fakeChannels builds a fakeSender per destination, refusing the fax
+// channel. Senders can be configured before the dispatcher builds them.
+type fakeChannels struct {
+	mu      sync.Mutex
+	senders map[string]*fakeSender
+}
+
+func newFakeChannels() *fakeChannels {
+	return &fakeChannels{senders: make(map[string]*fakeSender)}
+}
+
+func (c *fakeChannels) get(dest Destination) *fakeSender {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.senders[dest.key()]
+	if !ok {
+		s = &fakeSender{dest: dest}
+		c.senders[dest.key()] = s
+	}
+	return s
+}
+
+func (c *fakeChannels) factory(dest Destination) (Sender, error) {
+	if dest.Channel == "fax" {
+		return nil, errors.New("not enabled")
+	}
+	return c.get(dest), nil
+}
+
+// testPolicy pages critical alerts everywhere, posts high ones to Slack,
+// keeps operational alerts to their own channel and digests the rest
+func testPolicy() *RoutingPolicy {
+	return &RoutingPolicy{
+		Routes: []Route{
+			{Topic: "alerts.ops", Destinations: []Destination{{Channel: models.ChannelSlack, SlackChannel: "pipeline-ops"}}},
+			{Severity: models.SeverityCritical, Destinations: []Destination{
+				{Channel: models.ChannelSlack, WebhookURL: "https://hooks.slack.example/fraud-critical"},
+				{Channel: models.ChannelEmail},
+				{Channel: models.ChannelWebhook},
+			}},
+			{Severity: models.SeverityHigh, AlertType: models.AlertTypeCompliance, Destinations: []Destination{
+				{Channel: models.ChannelEmail, Recipients: []string{"compliance@bank.example"}},
+			}},
+			{Severity: models.SeverityHigh, Destinations: []Destination{{Channel: models.ChannelSlack}}},
+			{Severity: models.SeverityLow, AlertType: models.AlertTypeOperational},
+		},
+		Default: []Destination{{Channel: models.ChannelDigest}},
+	}
+}
+
+// destinations returns the keys of the destinations delivered to
+func destinations(deliveries []Delivery) string {
+	keys := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		keys[i] = d.Destination.key()
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestDispatchRoutingMatrix(t *testing.T) {
+	tests := []struct {
+		name      string
+		severity  string
+		alertType string
+		topic     string
+		channels  []string
+		want      string
+	}{
+		{"critical fraud", models.SeverityCritical, models.AlertTypeFraud, "", nil,
+			"slack|https://hooks.slack.example/fraud-critical||| email|||| webhook||||"},
+		{"critical risk", models.SeverityCritical, models.AlertTypeRisk, "", nil,
+			"slack|https://hooks.slack.example/fraud-critical||| email|||| webhook||||"},
+		{"high fraud", models.SeverityHigh, models.AlertTypeFraud, "", nil, "slack||||"},
+		{"high compliance", models.SeverityHigh, models.AlertTypeCompliance, "", nil, "email|||compliance@bank.example|"},
+		{"medium fraud", models.SeverityMedium, models.AlertTypeFraud, "", nil, "digest||||"},
+		{"low fraud", models.SeverityLow, models.AlertTypeFraud, "", nil, "digest||||"},
+		{"low operational dropped", models.SeverityLow, models.AlertTypeOperational, "", nil, ""},
+		{"critical on the ops topic", models.SeverityCritical, models.AlertTypeOperational, "alerts.ops", nil, "slack||pipeline-ops||"},
+		{"rule channels override the policy", models.SeverityLow, models.AlertTypeFraud, "", []string{models.ChannelSMS, models.ChannelSlack},
+			"sms|||| slack||||"},
+	}
+
+	channels := newFakeChannels()
+	d, err := NewDispatcher(testPolicy(), channels.factory, RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := alertFixture()
+			alert.ID, alert.Severity, alert.AlertType, alert.SourceTopic = tt.name, tt.severity, tt.alertType, tt.topic
+
+			deliveries := d.Dispatch(context.Background(), alert, tt.channels)
+			if got := destinations(deliveries); got != tt.want {
+				t.Errorf("delivered to %q, want %q", got, tt.want)
+			}
+			for _, delivery := range deliveries {
+				if delivery.Failed() || delivery.Notification.AlertID != tt.name {
+					t.Errorf("delivery to %s = %+v", delivery.Destination.key(), delivery.Notification)
+				}
+				if sent := channels.get(delivery.Destination).sent; len(sent) == 0 || sent[len(sent)-1] != tt.name {
+					t.Errorf("%s did not receive the alert", delivery.Destination.key())
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchRecordsEachChannelDespiteFailures(t *testing.T) {
+	policy := testPolicy()
+	channels := newFakeChannels()
+	// The webhook is down and Slack answers too slowly to be waited for
+	webhook := channels.get(Destination{Channel: models.ChannelWebhook})
+	webhook.failures = 10
+	slack := channels.get(policy.Routes[1].Destinations[0])
+	slack.hang = true
+
+	d, err := NewDispatcher(policy, channels.factory, RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond, Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	alert := alertFixture()
+	alert.Severity = models.SeverityCritical
+
+	start := time.Now()
+	deliveries := d.Dispatch(context.Background(), alert, nil)
+	// Slack's three attempts time out while the other channels are sent to
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dispatch took %s, want the channels sent to concurrently", elapsed)
+	}
+
+	if len(deliveries) != 3 {
+		t.Fatalf("%d deliveries, want one per destination", len(deliveries))
+	}
+	ids := map[string]bool{}
+	for _, delivery := range deliveries {
+		n := delivery.Notification
+		ids[n.ID] = true
+		switch delivery.Destination.Channel {
+		case models.ChannelEmail:
+			if delivery.Failed() || n.Status != models.NotificationStatusSent {
+				t.Errorf("email delivery = %+v, want it sent", n)
+			}
+		case models.ChannelWebhook, models.ChannelSlack:
+			if !delivery.Failed() || n.Error == "" {
+				t.Errorf("%s delivery = %+v, want it failed with the error", delivery.Destination.Channel, n)
+			}
+		}
+	}
+	if len(ids) != 3 {
+		t.Errorf("deliveries share notification records: %v", ids)
+	}
+	if webhook.attempts != 3 || slack.attempts != 3 {
+		t.Errorf("webhook attempted %d times and slack %d, want 3 each", webhook.attempts, slack.attempts)
+	}
+	if email := channels.get(Destination{Channel: models.ChannelEmail}); len(email.sent) != 1 {
+		t.Errorf("email sent %d times, want once", len(email.sent))
+	}
+}
+
+func TestDeliverRetriesUntilSent(t *testing.T) {
+	channels := newFakeChannels()
+	slack := channels.get(Destination{Channel: models.ChannelSlack})
+	slack.failures = 2
+
+	d, err := NewDispatcher(&RoutingPolicy{}, channels.factory, RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	delivery := d.Deliver(context.Background(), alertFixture(), Destination{Channel: models.ChannelSlack})
+	if delivery.Failed() || slack.attempts != 3 {
+		t.Errorf("delivery failed %v after %d attempts, want sent on the third", delivery.Failed(), slack.attempts)
+	}
+}
+
+func TestDispatchOfUnknownChannelIsRecordedFailed(t *testing.T) {
+	d, err := NewDispatcher(&RoutingPolicy{}, newFakeChannels().factory, RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	deliveries := d.Dispatch(context.Background(), alertFixture(), []string{"fax", models.ChannelSlack})
+	if len(deliveries) != 2 {
+		t.Fatalf("%d deliveries, want 2", len(deliveries))
+	}
+	if n := deliveries[0].Notification; !deliveries[0].Failed() || n.Error != "channel fax: not enabled" || n.AlertID != "alert-1" {
+		t.Errorf("fax delivery = %+v, want it failed", n)
+	}
+	if deliveries[1].Failed() {
+		t.Errorf("slack delivery failed: %+v", deliveries[1].Notification)
+	}
+}
+
+func TestNewDispatcherRejectsBadPolicy(t *testing.T) {
+	policy := testPolicy()
+	policy.Routes[2].Destinations = append(policy.Routes[2].Destinations, Destination{Channel: "fax"})
+	if _, err := NewDispatcher(policy, newFakeChannels().factory, RetryPolicy{}); err == nil || err.Error() != "route 2: channel fax: not enabled" {
+		t.Errorf("NewDispatcher = %v, want the route of the bad destination", err)
+	}
+
+	policy = testPolicy()
+	policy.Default = []Destination{{Channel: "fax"}}
+	if _, err := NewDispatcher(policy, newFakeChannels().factory, RetryPolicy{}); err == nil || !strings.HasPrefix(err.Error(), "default route:") {
+		t.Errorf("NewDispatcher = %v, want the default route rejected", err)
+	}
+}
+
+func TestLoadRoutingPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routing.json")
+	data := `{
+		"routes": [
+			{"severity": "critical", "destinations": [
+				{"channel": "slack", "webhook_url": "https://hooks.slack.example/fraud-critical"},
+				{"channel": "email", "recipients": ["oncall@bank.example"]}
+			]},
+			{"severity": "high", "destinations": [{"channel": "slack"}]}
+		],
+		"default": [{"channel": "digest"}]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	policy, err := LoadRoutingPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadRoutingPolicy: %v", err)
+	}
+	d, err := NewDispatcher(policy, newFakeChannels().factory, RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	alert := alertFixture()
+	alert.Severity = models.SeverityCritical
+	if got, want := destinations(d.Dispatch(context.Background(), alert, nil)),
+		"slack|https://hooks.slack.example/fraud-critical||| email|||oncall@bank.example|"; got != want {
+		t.Errorf("critical alert delivered to %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"routes": {}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := LoadRoutingPolicy(path); err == nil || !strings.Contains(err.Error(), "failed to parse routing policy") {
+		t.Errorf("LoadRoutingPolicy of a malformed policy = %v, want a parse error", err)
+	}
+}
@@ -0,0 +1,242 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+)
+
+// severityColors are the header colours of alert emails
+var severityColors = map[string]string{
+	models.SeverityCritical: "#b00020",
+	models.SeverityHigh:     "#e65100",
+	models.SeverityMedium:   "#f9a825",
+	models.SeverityLow:      "#2e7d32",
+}
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{"upper": strings.ToUpper}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; margin: 0;">
+<div style="background: {{.Color}}; color: #ffffff; padding: 16px;">
+<h2 style="margin: 0;">{{.Severity | upper}} {{.AlertType}} alert</h2>
+</div>
+<div style="padding: 16px;">
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<table cellpadding="4">
+<tr><td><b>Rule</b></td><td>{{.RuleTriggered}}</td></tr>
+<tr><td><b>Risk score</b></td><td>{{printf "%.2f" .RiskScore}}</td></tr>
+<tr><td><b>Amount</b></td><td>{{printf "%.2f" .Amount}} {{.Currency}}</td></tr>
+<tr><td><b>Account</b></td><td>{{.AccountID}}</td></tr>
+<tr><td><b>Transaction</b></td><td>{{.TransactionID}}</td></tr>
+<tr><td><b>User</b></td><td>{{.UserID}}</td></tr>
+<tr><td><b>Raised at</b></td><td>{{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+</table>
+</div>
+</body>
+</html>
+`))
+
+// EmailSender sends alerts by SMTP. The connection is upgraded with STARTTLS
+// before authenticating, so credentials are never sent in the clear.
+type EmailSender struct {
+	addr     string
+	host     string
+	from     string
+	password string
+	to       []string
+	renderer *templates.Renderer
+
+	// rootCAs verify the server's certificate, the system roots when nil
+	rootCAs *x509.CertPool
+}
+
+// NewEmailSender creates a new email sender for an SMTP server at addr (host:port)
+func NewEmailSender(addr, from, password string, to []string, renderer *templates.Renderer) (*EmailSender, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", addr, err)
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no email recipients configured")
+	}
+
+	return &EmailSender{
+		addr:     addr,
+		host:     host,
+		from:     from,
+		password: password,
+		to:       to,
+		renderer: renderer,
+	}, nil
+}
+
+// SendAlert emails an alert to all configured recipients
+func (e *EmailSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelEmail,
+		Recipient: strings.Join(e.to, ","),
+		Status:    models.NotificationStatusPending,
+	}
+
+	subject, err := e.renderer.Render(templates.EmailSubject, alert)
+	var text string
+	var msg []byte
+	if err == nil {
+		notification.Subject = subject
+		text, msg, err = e.buildMessage(alert, subject)
+	}
+	if err == nil {
+		notification.Message = text
+		err = e.send(ctx, msg)
+	}
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	notification.Status = models.NotificationStatusSent
+	notification.SentAt = time.Now()
+	return notification, nil
+}
+
+// Preview renders the subject and plaintext body the alert would be
+// emailed with
+func (e *EmailSender) Preview(alert *models.Alert) (*Preview, error) {
+	subject, err := e.renderer.Render(templates.EmailSubject, alert)
+	if err != nil {
+		return nil, err
+	}
+	text, err := e.renderer.Render(templates.Email, alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{Recipient: strings.Join(e.to, ","), Subject: subject, Message: text}, nil
+}
+
+// buildMessage renders the alert as a multipart/alternative message with a
+// plaintext and an HTML part. It returns the plaintext body and the message.
+func (e *EmailSender) buildMessage(alert *models.Alert, subject string) (string, []byte, error) {
+	text, err := e.renderer.Render(templates.Email, alert)
+	if err != nil {
+		return "", nil, err
+	}
+
+	color, ok := severityColors[alert.Severity]
+	if !ok {
+		color = severityColors[models.SeverityMedium]
+	}
+	var html bytes.Buffer
+	err = emailHTMLTemplate.Execute(&html, struct {
+		*models.Alert
+		Color string
+	}{alert, color})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to render email html: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", []byte(text + "\n")},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return "", nil, err
+		}
+		qp.Close()
+	}
+	mw.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return text, msg.Bytes(), nil
+}
+
+// send delivers a message over SMTP with STARTTLS and PLAIN auth
+func (e *EmailSender) send(ctx context.Context, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		return fmt.Errorf("SMTP server does not support STARTTLS")
+	}
+	if err := client.StartTLS(&tls.Config{ServerName: e.host, RootCAs: e.rootCAs}); err != nil {
+		return fmt.Errorf("failed to start TLS: %w", err)
+	}
+
+	if e.password != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.from, e.password, e.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, rcpt := range e.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
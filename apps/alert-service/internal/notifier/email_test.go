@@ -0,0 +1,349 @@
+package notifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// smtpStub is an SMTP server on localhost offering STARTTLS with a
+// self-signed certificate, recording the mail it accepts
+type smtpStub struct {
+	addr     string
+	rootCAs  *x509.CertPool
+	startTLS bool
+	config   *tls.Config
+
+	mu      sync.Mutex
+	auth    string
+	from    string
+	rcpts   []string
+	data    []byte
+	usedTLS bool
+}
+
+func newSMTPStub(t *testing.T, startTLS bool) *smtpStub {
+	t.Helper()
+	cert, pool := selfSignedCert(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &smtpStub{
+		addr:     ln.Addr().String(),
+		rootCAs:  pool,
+		startTLS: startTLS,
+		config:   &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+// serve speaks just enough SMTP for net/smtp's client
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stub")
+	secure := false
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.startTLS && !secure {
+				tp.PrintfLine("250-localhost\r\n250 STARTTLS")
+			} else {
+				tp.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.config)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, tp, secure = tlsConn, textproto.NewConn(tlsConn), true
+			s.mu.Lock()
+			s.usedTLS = true
+			s.mu.Unlock()
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			s.mu.Lock()
+			s.auth = string(credentials)
+			s.mu.Unlock()
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = data
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// received returns the message the stub accepted, parsed
+func (s *smtpStub) received(t *testing.T) *mail.Message {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		t.Fatal("no message received")
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(s.data)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	return msg
+}
+
+// emailParts returns the decoded parts of a multipart/alternative message
+// by media type
+func emailParts(t *testing.T, msg *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %s, %v, want multipart/alternative", mediaType, err)
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		parts[strings.Split(part.Header.Get("Content-Type"), ";")[0]] = string(body)
+	}
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 and a pool trusting it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// newTestEmailSender returns a sender to the stub trusting its certificate
+func newTestEmailSender(t *testing.T, stub *smtpStub, password string, to ...string) *EmailSender {
+	t.Helper()
+	e, err := NewEmailSender(stub.addr, "alerts@bank.example", password, to, newTestRenderer(t))
+	if err != nil {
+		t.Fatalf("NewEmailSender: %v", err)
+	}
+	e.rootCAs = stub.rootCAs
+	return e
+}
+
+func TestEmailSendsAlertToRecipients(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	e := newTestEmailSender(t, stub, "s3cret", "fraud@bank.example", "oncall@bank.example")
+
+	notification, err := e.SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if notification.Status != models.NotificationStatusSent || notification.Channel != models.ChannelEmail ||
+		notification.Recipient != "fraud@bank.example,oncall@bank.example" || notification.SentAt.IsZero() {
+		t.Errorf("notification = %+v", notification)
+	}
+	if notification.Subject != "[HIGH] fraud alert for account acct-1" {
+		t.Errorf("subject = %q", notification.Subject)
+	}
+
+	stub.mu.Lock()
+	if !stub.usedTLS {
+		t.Error("mail sent without STARTTLS")
+	}
+	if stub.auth != "\x00alerts@bank.example\x00s3cret" {
+		t.Errorf("authenticated as %q", stub.auth)
+	}
+	if stub.from != "alerts@bank.example" || strings.Join(stub.rcpts, ",") != "fraud@bank.example,oncall@bank.example" {
+		t.Errorf("envelope from %s to %v", stub.from, stub.rcpts)
+	}
+	stub.mu.Unlock()
+
+	msg := stub.received(t)
+	for header, want := range map[string]string{
+		"From":         "alerts@bank.example",
+		"To":           "fraud@bank.example, oncall@bank.example",
+		"Subject":      "[HIGH] fraud alert for account acct-1",
+		"Mime-Version": "1.0",
+	} {
+		if got := msg.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	parts := emailParts(t, msg)
+	text := "HIGH fraud alert\n\n" +
+		"Amount over the 10000 threshold\n\n" +
+		"Rule:        high_amount\n" +
+		"Risk score:  0.87\n" +
+		"Amount:      $12,500.00\n" +
+		"Account:     acct-1\n" +
+		"Transaction: txn-1\n" +
+		"User:        user-1\n" +
+		"Raised at:   2026-03-02 09:30:00 UTC\n"
+	if parts["text/plain"] != text {
+		t.Errorf("plaintext body =\n%s\nwant\n%s", parts["text/plain"], text)
+	}
+	if notification.Message != strings.TrimSuffix(text, "\n") {
+		t.Errorf("notification message = %q", notification.Message)
+	}
+	html := parts["text/html"]
+	for _, want := range []string{
+		`background: #e65100`,
+		`<h2 style="margin: 0;">HIGH fraud alert</h2>`,
+		`<p>Amount over the 10000 threshold</p>`,
+		`<td><b>Amount</b></td><td>12500.00 USD</td>`,
+		`<td><b>Transaction</b></td><td>txn-1</td>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html body does not contain %s:\n%s", want, html)
+		}
+	}
+}
+
+func TestEmailEscapesHTML(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	e := newTestEmailSender(t, stub, "", "fraud@bank.example")
+	alert := alertFixture()
+	alert.Description = `<script>alert("x")</script>`
+
+	if _, err := e.SendAlert(context.Background(), alert); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	stub.mu.Lock()
+	if stub.auth != "" {
+		t.Errorf("authenticated without a password as %q", stub.auth)
+	}
+	stub.mu.Unlock()
+
+	html := emailParts(t, stub.received(t))["text/html"]
+	if strings.Contains(html, "<script>") || !strings.Contains(html, "&lt;script&gt;") {
+		t.Errorf("description not escaped in the html:\n%s", html)
+	}
+}
+
+func TestEmailRequiresStartTLS(t *testing.T) {
+	stub := newSMTPStub(t, false)
+	e := newTestEmailSender(t, stub, "s3cret", "fraud@bank.example")
+
+	notification, err := e.SendAlert(context.Background(), alertFixture())
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("SendAlert without STARTTLS = %v, want it refused", err)
+	}
+	if notification.Status != models.NotificationStatusFailed || notification.Error == "" {
+		t.Errorf("notification = %+v, want it failed", notification)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.auth != "" || stub.data != nil {
+		t.Error("credentials or mail sent in the clear")
+	}
+}
+
+func TestEmailVerifiesServerCertificate(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	e := newTestEmailSender(t, stub, "s3cret", "fraud@bank.example")
+	e.rootCAs = x509.NewCertPool()
+
+	if _, err := e.SendAlert(context.Background(), alertFixture()); err == nil || !strings.Contains(err.Error(), "failed to start TLS") {
+		t.Fatalf("SendAlert to an untrusted server = %v, want a TLS error", err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.auth != "" {
+		t.Error("credentials sent to an untrusted server")
+	}
+}
+
+func TestNewEmailSenderValidatesConfig(t *testing.T) {
+	if _, err := NewEmailSender("smtp.bank.example", "alerts@bank.example", "", []string{"fraud@bank.example"}, newTestRenderer(t)); err == nil {
+		t.Error("address without a port accepted")
+	}
+	if _, err := NewEmailSender("smtp.bank.example:587", "alerts@bank.example", "", nil, newTestRenderer(t)); err == nil {
+		t.Error("sender without recipients accepted")
+	}
+}
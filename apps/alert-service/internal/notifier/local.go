@@ -0,0 +1,178 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+)
+
+// ConsoleSender prints alerts to a writer, normally stdout, so the alert
+// path can be exercised locally without Slack
+type ConsoleSender struct {
+	out      io.Writer
+	renderer *templates.Renderer
+
+	mu sync.Mutex
+}
+
+// NewConsoleSender creates a new console sender printing to out
+func NewConsoleSender(out io.Writer, renderer *templates.Renderer) *ConsoleSender {
+	return &ConsoleSender{out: out, renderer: renderer}
+}
+
+// SendAlert prints the alert, rendered with the console template
+func (c *ConsoleSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelConsole,
+		Recipient: "stdout",
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
+
+	message, err := c.renderer.Render(templates.Console, alert)
+	if err == nil {
+		notification.Message = message
+		err = c.print(notification.ID, message)
+	}
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	notification.Status = models.NotificationStatusSent
+	notification.SentAt = time.Now()
+	return notification, nil
+}
+
+// print writes a message under a rule naming its notification, in one
+// write so concurrent alerts do not interleave
+func (c *ConsoleSender) print(id, message string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "──── %s ────\n%s\n\n", id, message)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := io.WriteString(c.out, b.String()); err != nil {
+		return fmt.Errorf("failed to print alert: %w", err)
+	}
+	return nil
+}
+
+// Preview renders the alert as it would be printed
+func (c *ConsoleSender) Preview(alert *models.Alert) (*Preview, error) {
+	message, err := c.renderer.Render(templates.Console, alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{
+		Recipient: "stdout",
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   message,
+	}, nil
+}
+
+// FileRecord is one line of the file written by FileSender
+type FileRecord struct {
+	NotificationID string        `json:"notification_id"`
+	SentAt         time.Time     `json:"sent_at"`
+	Subject        string        `json:"subject"`
+	Message        string        `json:"message"`
+	Alert          *models.Alert `json:"alert"`
+}
+
+// FileSender appends alerts to a file as newline-delimited JSON, one
+// FileRecord per line, so local runs and tests can inspect what was sent
+type FileSender struct {
+	path     string
+	renderer *templates.Renderer
+
+	mu sync.Mutex
+}
+
+// NewFileSender creates a new file sender appending to path. The file is
+// created on the first alert.
+func NewFileSender(path string, renderer *templates.Renderer) (*FileSender, error) {
+	if path == "" {
+		return nil, fmt.Errorf("notification file path not configured")
+	}
+	return &FileSender{path: path, renderer: renderer}, nil
+}
+
+// SendAlert appends the alert to the file
+func (f *FileSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelFile,
+		Recipient: f.path,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
+
+	message, err := f.renderer.Render(templates.Console, alert)
+	if err == nil {
+		notification.Message = message
+		notification.SentAt = time.Now()
+		err = f.append(FileRecord{
+			NotificationID: notification.ID,
+			SentAt:         notification.SentAt,
+			Subject:        notification.Subject,
+			Message:        message,
+			Alert:          alert,
+		})
+	}
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	notification.Status = models.NotificationStatusSent
+	return notification, nil
+}
+
+// append writes a record as one line
+func (f *FileSender) append(record FileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write notification file: %w", err)
+	}
+	return file.Close()
+}
+
+// Preview renders the alert as it would be written
+func (f *FileSender) Preview(alert *models.Alert) (*Preview, error) {
+	message, err := f.renderer.Render(templates.Console, alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{
+		Recipient: f.path,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   message,
+	}, nil
+}
@@ -0,0 +1,154 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alert-service/internal/models"
+)
+
+// consoleFixtureText is the message printed for alertFixture
+const consoleFixtureText = "🟠 HIGH fraud alert alert-1\n" +
+	"  Amount over the 10000 threshold\n" +
+	"  Rule:        high_amount\n" +
+	"  Risk score:  0.87\n" +
+	"  Amount:      $12,500.00\n" +
+	"  Account:     acct-1\n" +
+	"  Transaction: txn-1\n" +
+	"  User:        user-1\n" +
+	"  Raised at:   2026-03-02 09:30:00 UTC"
+
+func TestConsolePrintsEachAlert(t *testing.T) {
+	var out bytes.Buffer
+	c := NewConsoleSender(&out, newTestRenderer(t))
+
+	notification, err := c.SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if notification.Channel != models.ChannelConsole || notification.Recipient != "stdout" ||
+		notification.Status != models.NotificationStatusSent || notification.SentAt.IsZero() {
+		t.Errorf("notification = %+v", notification)
+	}
+	if notification.Message != consoleFixtureText {
+		t.Errorf("message =\n%s\nwant\n%s", notification.Message, consoleFixtureText)
+	}
+	want := "──── " + notification.ID + " ────\n" + consoleFixtureText + "\n\n"
+	if out.String() != want {
+		t.Errorf("printed\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+// readRecords returns the records of a notification file, failing the test
+// on a line that is not one
+func readRecords(t *testing.T, path string) []FileRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open notification file: %v", err)
+	}
+	defer file.Close()
+
+	var records []FileRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record FileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d is not a record: %v: %s", len(records)+1, err, scanner.Text())
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read notification file: %v", err)
+	}
+	return records
+}
+
+func TestFileAppendsOneRecordPerLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.ndjson")
+	f, err := NewFileSender(path, newTestRenderer(t))
+	if err != nil {
+		t.Fatalf("NewFileSender: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file created before the first alert: %v", err)
+	}
+
+	first, second := alertFixture(), alertFixture()
+	second.ID, second.Description = "alert-2", "Multi-line\ndescription"
+	var notifications []*models.Notification
+	for _, alert := range []*models.Alert{first, second} {
+		notification, err := f.SendAlert(context.Background(), alert)
+		if err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+		if notification.Channel != models.ChannelFile || notification.Recipient != path || notification.Status != models.NotificationStatusSent {
+			t.Errorf("notification = %+v", notification)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 || !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("file of %d lines, want 2 each ending in a newline:\n%s", n, data)
+	}
+
+	records := readRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	for i, record := range records {
+		notification := notifications[i]
+		if record.NotificationID != notification.ID || !record.SentAt.Equal(notification.SentAt) {
+			t.Errorf("record %d of %s at %s, want %s at %s", i, record.NotificationID, record.SentAt, notification.ID, notification.SentAt)
+		}
+		if record.Subject != "high fraud alert" || record.Message != notification.Message {
+			t.Errorf("record %d subject %q message %q", i, record.Subject, record.Message)
+		}
+		if record.Alert == nil || record.Alert.ID != []string{"alert-1", "alert-2"}[i] || record.Alert.TransactionID != "txn-1" {
+			t.Errorf("record %d alert = %+v", i, record.Alert)
+		}
+	}
+	if records[0].Message != consoleFixtureText {
+		t.Errorf("record message =\n%s\nwant the console message", records[0].Message)
+	}
+
+	// Records are appended to what the file already holds
+	f, err = NewFileSender(path, newTestRenderer(t))
+	if err != nil {
+		t.Fatalf("NewFileSender: %v", err)
+	}
+	if _, err := f.SendAlert(context.Background(), alertFixture()); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if n := len(readRecords(t, path)); n != 3 {
+		t.Errorf("%d records after a restart, want 3", n)
+	}
+}
+
+func TestFileSenderFailures(t *testing.T) {
+	if _, err := NewFileSender("", newTestRenderer(t)); err == nil {
+		t.Error("NewFileSender accepted an empty path")
+	}
+
+	f, err := NewFileSender(filepath.Join(t.TempDir(), "missing", "alerts.ndjson"), newTestRenderer(t))
+	if err != nil {
+		t.Fatalf("NewFileSender: %v", err)
+	}
+	notification, err := f.SendAlert(context.Background(), alertFixture())
+	if err == nil {
+		t.Fatal("SendAlert to a missing directory succeeded")
+	}
+	if notification.Status != models.NotificationStatusFailed || !strings.Contains(notification.Error, "failed to open notification file") {
+		t.Errorf("notification = %+v", notification)
+	}
+}
@@ -3,46 +3,201 @@ package notifier
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"alert-service/internal/metrics"
 	"alert-service/internal/models"
+	"alert-service/internal/templates"
 )
 
-// Notifier handles sending alerts to external services
+// Sender delivers an alert over one notification channel and returns the
+// delivery record, including when delivery fails
+type Sender interface {
+	SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error)
+}
+
+// slackPostMessageURL is the Slack Web API method used in bot token mode
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// slackMaxRetries is how many times a rate-limited Slack request is retried
+const slackMaxRetries = 3
+
+// slackEscaper escapes the characters Slack treats as control sequences
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Notifier handles sending alerts to Slack, either through an incoming
+// webhook or, in bot token mode, through chat.postMessage. Only bot token
+// mode returns the message ts needed to thread follow-ups.
 type Notifier struct {
-	webhookURL string
+	webhookURL  string
+	webhooks    map[string]string // alert type -> webhook URL, overriding webhookURL
+	destination string            // logical destination name, for metrics
+	botToken    string
+	channel     string
+	apiURL      string // chat.postMessage endpoint, in bot token mode
+	renderer    *templates.Renderer
+}
+
+// NewNotifier creates a new notifier posting to an incoming webhook
+func NewNotifier(webhookURL string, renderer *templates.Renderer) *Notifier {
+	return &Notifier{webhookURL: webhookURL, renderer: renderer}
+}
+
+// NewDestinationNotifier creates a new notifier posting to the webhook of a
+// named logical destination, e.g. "fraud"
+func NewDestinationNotifier(destination, webhookURL string, renderer *templates.Renderer) *Notifier {
+	return &Notifier{webhookURL: webhookURL, destination: destination, renderer: renderer}
 }
 
-// NewNotifier creates a new notifier instance
-func NewNotifier(webhookURL string) *Notifier {
-	return &Notifier{webhookURL: webhookURL}
+// NewTypedNotifier creates a new notifier posting each alert to the webhook
+// for its alert type, e.g. fraud alerts to the #fraud webhook. Alerts of
+// other types go to defaultURL.
+func NewTypedNotifier(webhooks map[string]string, defaultURL string, renderer *templates.Renderer) *Notifier {
+	return &Notifier{webhookURL: defaultURL, webhooks: webhooks, renderer: renderer}
 }
 
-// SlackPayload defines the JSON structure for Slack messages
+// NewBotNotifier creates a new notifier posting to a channel with a bot token
+func NewBotNotifier(botToken, channel string, renderer *templates.Renderer) *Notifier {
+	return &Notifier{botToken: botToken, channel: channel, apiURL: slackPostMessageURL, renderer: renderer}
+}
+
+// SlackPayload defines the JSON structure for Slack messages. Text is the
+// notification fallback when the message has attachments.
 type SlackPayload struct {
-	Text string `json:"text"`
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
 }
 
-// SendAlert sends an alert to the configured notification channel
-func (n *Notifier) SendAlert(ctx context.Context, alert *models.Alert) error {
-	message := fmt.Sprintf("🚨 *%s Alert* (%s)\n%s",
-		alert.Severity, alert.Type, alert.Message)
+// slackAPIResponse is the response of chat.postMessage
+type slackAPIResponse struct {
+	OK    bool   `json:"ok"`
+	TS    string `json:"ts"`
+	Error string `json:"error"`
+}
+
+// SendAlert sends an alert to the configured notification channel and
+// returns the delivery record. The record is returned even when delivery
+// fails, with the error captured, so callers can persist the outcome.
+// Alert content is escaped, so merchant names and descriptions cannot
+// inject Slack markup.
+func (n *Notifier) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	destination, recipient, url := n.target(alert)
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelSlack,
+		Recipient: recipient,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
 
-	if alert.TransactionID != "" {
-		message += fmt.Sprintf("\nTransaction: %s", alert.TransactionID)
+	message, err := n.render(alert)
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+	notification.Message = message
+
+	var ts string
+	if n.botToken != "" {
+		ts, err = n.postPayload(ctx, SlackPayload{
+			Channel:     n.channel,
+			Text:        message,
+			Attachments: FormatSlackBlocks(alert, true),
+		})
+	} else {
+		// Webhook-only configs cannot receive interactions: keep to plain text
+		err = n.sendWebhook(ctx, url, message)
+	}
+	notification.ExternalID = ts
+	if destination == "" {
+		destination = "default"
 	}
-	if alert.UserID != "" {
-		message += fmt.Sprintf("\nUser: %s", alert.UserID)
+	if err != nil {
+		metrics.RecordSlackDelivery(destination, metrics.NotificationFailed)
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	metrics.RecordSlackDelivery(destination, metrics.NotificationDelivered)
+	notification.Status = models.NotificationStatusSent
+	notification.SentAt = time.Now()
+	return notification, nil
+}
+
+// Preview renders the alert as it would be posted
+func (n *Notifier) Preview(alert *models.Alert) (*Preview, error) {
+	_, recipient, _ := n.target(alert)
+	message, err := n.render(alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{
+		Recipient: recipient,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   message,
+	}, nil
+}
+
+// render renders the Slack message of an alert, escaped
+func (n *Notifier) render(alert *models.Alert) (string, error) {
+	message, err := n.renderer.Render(templates.Slack, alert)
+	if err != nil {
+		return "", err
+	}
+	return EscapeSlack(message), nil
+}
+
+// target returns where an alert is posted: the destination named in
+// metrics, the recipient recorded and, without a bot token, the webhook
+func (n *Notifier) target(alert *models.Alert) (string, string, string) {
+	destination, url := n.webhookFor(alert)
+	if n.destination != "" {
+		destination = n.destination
+	}
+	if n.botToken != "" {
+		return n.channel, n.channel, url
+	}
+	if destination != "" {
+		return destination, "slack-webhook:" + destination, url
+	}
+	return destination, "slack-webhook", url
+}
+
+// webhookFor returns the webhook for an alert and the alert type it was
+// chosen for, if any
+func (n *Notifier) webhookFor(alert *models.Alert) (string, string) {
+	if url, ok := n.webhooks[alert.AlertType]; ok {
+		return alert.AlertType, url
 	}
+	return "", n.webhookURL
+}
 
-	return n.sendSlackNotification(ctx, message)
+// EscapeSlack escapes &, < and > so text is shown literally by Slack
+func EscapeSlack(text string) string {
+	return slackEscaper.Replace(text)
 }
 
-// sendSlackNotification posts a message to Slack using the webhook URL
-func (n *Notifier) sendSlackNotification(ctx context.Context, message string) error {
-	if n.webhookURL == "" {
+// newNotificationID returns a random notification ID
+func newNotificationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "ntf_" + hex.EncodeToString(b)
+}
+
+// sendWebhook posts a message to Slack through an incoming webhook
+func (n *Notifier) sendWebhook(ctx context.Context, url, message string) error {
+	if url == "" {
 		return fmt.Errorf("slack webhook URL not configured")
 	}
 
@@ -52,15 +207,16 @@ func (n *Notifier) sendSlackNotification(ctx context.Context, message string) er
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", n.webhookURL, bytes.NewBuffer(body))
+	resp, err := doSlack(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request to Slack: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -70,3 +226,93 @@ func (n *Notifier) sendSlackNotification(ctx context.Context, message string) er
 
 	return nil
 }
+
+// doSlack sends the request built by newRequest, waiting out 429 responses
+// for as long as Retry-After asks and ctx allows
+func doSlack(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request to Slack: %w", err)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= slackMaxRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		metrics.RecordSlackRateLimited()
+		wait := retryAfter(resp.Header.Get("Retry-After"), time.Duration(attempt+1)*time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("rate limited by Slack: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// postText posts a message and returns its ts, which is only known in bot
+// token mode
+func (n *Notifier) postText(ctx context.Context, message string) (string, error) {
+	if n.botToken != "" {
+		return n.postMessage(ctx, n.channel, message, "")
+	}
+	return "", n.sendWebhook(ctx, n.webhookURL, message)
+}
+
+// PostText posts a plain text message to the configured channel
+func (n *Notifier) PostText(ctx context.Context, message string) error {
+	_, err := n.postText(ctx, message)
+	return err
+}
+
+// ReplyInThread posts a follow-up to the thread of an earlier message. It
+// needs bot token mode, since webhooks do not return message timestamps.
+func (n *Notifier) ReplyInThread(ctx context.Context, channel, ts, message string) error {
+	if n.botToken == "" {
+		return fmt.Errorf("slack bot token not configured")
+	}
+	_, err := n.postMessage(ctx, channel, message, ts)
+	return err
+}
+
+// postMessage posts a text message with chat.postMessage and returns its ts
+func (n *Notifier) postMessage(ctx context.Context, channel, message, threadTS string) (string, error) {
+	return n.postPayload(ctx, SlackPayload{Channel: channel, Text: message, ThreadTS: threadTS})
+}
+
+// postPayload posts a message with chat.postMessage and returns its ts
+func (n *Notifier) postPayload(ctx context.Context, payload SlackPayload) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := doSlack(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", n.apiURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("Authorization", "Bearer "+n.botToken)
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result slackAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode Slack response: %w", err)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("slack error: %s", result.Error)
+	}
+
+	return result.TS, nil
+}
@@ -0,0 +1,471 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestRenderer returns a renderer of the default templates in UTC
+func newTestRenderer(t *testing.T) *templates.Renderer {
+	t.Helper()
+	r, err := templates.NewRenderer("", time.UTC)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	return r
+}
+
+// alertFixture returns a high severity fraud alert on a transaction
+func alertFixture() *models.Alert {
+	return &models.Alert{
+		ID:            "alert-1",
+		TransactionID: "txn-1",
+		AccountID:     "acct-1",
+		UserID:        "user-1",
+		AlertType:     "fraud",
+		Severity:      models.SeverityHigh,
+		RiskScore:     0.87,
+		Amount:        12500,
+		Currency:      "USD",
+		Description:   "Amount over the 10000 threshold",
+		RuleTriggered: "high_amount",
+		CreatedAt:     time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+// slackFixtureText is the message posted for alertFixture
+const slackFixtureText = "🟠 *HIGH fraud alert*\n" +
+	"Amount over the 10000 threshold\n" +
+	"Rule: high_amount\n" +
+	"Risk score: 0.87\n" +
+	"Amount: $12,500.00\n" +
+	"Account: acct-1\n" +
+	"Transaction: txn-1\n" +
+	"User: user-1"
+
+// webhookStub is a Slack incoming webhook answering with status, recording
+// the payloads posted to it
+type webhookStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	payloads []SlackPayload
+}
+
+func newWebhookStub(t *testing.T, status int) *webhookStub {
+	t.Helper()
+	stub := &webhookStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SlackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		stub.mu.Lock()
+		stub.payloads = append(stub.payloads, payload)
+		stub.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *webhookStub) posted() []SlackPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SlackPayload(nil), s.payloads...)
+}
+
+// slackAPIStub is Slack's chat.postMessage, answering each post with the
+// next message ts and recording the payloads and their bearer tokens
+type slackAPIStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	payloads []SlackPayload
+	tokens   []string
+}
+
+func newSlackAPIStub(t *testing.T) *slackAPIStub {
+	t.Helper()
+	stub := &slackAPIStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SlackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		stub.mu.Lock()
+		stub.payloads = append(stub.payloads, payload)
+		stub.tokens = append(stub.tokens, r.Header.Get("Authorization"))
+		ts := "1700000000.00010" + strconv.Itoa(len(stub.payloads))
+		stub.mu.Unlock()
+
+		if payload.Channel == "archived" {
+			json.NewEncoder(w).Encode(slackAPIResponse{Error: "is_archived"})
+			return
+		}
+		json.NewEncoder(w).Encode(slackAPIResponse{OK: true, TS: ts})
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *slackAPIStub) posted() ([]SlackPayload, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SlackPayload(nil), s.payloads...), append([]string(nil), s.tokens...)
+}
+
+// newTestBotNotifier returns a bot token notifier posting to the stub
+func newTestBotNotifier(t *testing.T, stub *slackAPIStub, channel string) *Notifier {
+	t.Helper()
+	n := NewBotNotifier("xoxb-test", channel, newTestRenderer(t))
+	n.apiURL = stub.URL
+	return n
+}
+
+func TestSlackMessageRendersAlert(t *testing.T) {
+	preview, err := NewNotifier("", newTestRenderer(t)).Preview(alertFixture())
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if preview.Message != slackFixtureText {
+		t.Errorf("message =\n%s\nwant\n%s", preview.Message, slackFixtureText)
+	}
+	if preview.Subject != "high fraud alert" {
+		t.Errorf("subject = %q", preview.Subject)
+	}
+}
+
+func TestSlackMessageOmitsAbsentFields(t *testing.T) {
+	alert := alertFixture()
+	alert.Description, alert.RuleTriggered, alert.TransactionID, alert.UserID = "", "", "", ""
+	alert.Currency = "CHF"
+
+	preview, err := NewNotifier("", newTestRenderer(t)).Preview(alert)
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	want := "🟠 *HIGH fraud alert*\nRisk score: 0.87\nAmount: 12,500.00 CHF\nAccount: acct-1"
+	if preview.Message != want {
+		t.Errorf("message =\n%s\nwant\n%s", preview.Message, want)
+	}
+}
+
+func TestSendAlertReturnsDeliveryRecord(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusOK)
+	notification, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	payloads := stub.posted()
+	if len(payloads) != 1 || payloads[0].Text != slackFixtureText {
+		t.Fatalf("posted %+v, want the rendered alert once", payloads)
+	}
+	if len(payloads[0].Attachments) != 0 {
+		t.Error("webhook message posted with attachments")
+	}
+	if notification.AlertID != "alert-1" || notification.Channel != models.ChannelSlack || notification.Recipient != "slack-webhook" {
+		t.Errorf("notification = %+v", notification)
+	}
+	if notification.Status != models.NotificationStatusSent || notification.SentAt.IsZero() || notification.Error != "" {
+		t.Errorf("notification status %s sent at %s with error %q, want sent", notification.Status, notification.SentAt, notification.Error)
+	}
+	if notification.Message != slackFixtureText {
+		t.Errorf("notification message = %q", notification.Message)
+	}
+}
+
+func TestSendAlertRecordsFailedDelivery(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusInternalServerError)
+	notification, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	if err == nil {
+		t.Fatal("SendAlert succeeded against a failing webhook")
+	}
+	if notification == nil || notification.Status != models.NotificationStatusFailed || notification.Error == "" {
+		t.Errorf("notification = %+v, want it failed with the error", notification)
+	}
+	if !notification.SentAt.IsZero() {
+		t.Error("failed notification has a sent time")
+	}
+
+	unconfigured, err := NewNotifier("", newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	if err == nil || unconfigured.Status != models.NotificationStatusFailed {
+		t.Errorf("SendAlert without a webhook = %+v, %v, want it failed", unconfigured, err)
+	}
+}
+
+func TestBotNotifierStoresMessageTSForThreading(t *testing.T) {
+	stub := newSlackAPIStub(t)
+	n := newTestBotNotifier(t, stub, "fraud-alerts")
+
+	notification, err := n.SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if notification.ExternalID != "1700000000.000101" || notification.Recipient != "fraud-alerts" ||
+		notification.Status != models.NotificationStatusSent {
+		t.Errorf("notification = %+v, want it sent with the message ts", notification)
+	}
+
+	// The resolution is replied under the alert's message
+	if err := n.ReplyInThread(context.Background(), notification.Recipient, notification.ExternalID, "Alert marked *resolved* by analyst-1"); err != nil {
+		t.Fatalf("ReplyInThread: %v", err)
+	}
+
+	payloads, tokens := stub.posted()
+	if len(payloads) != 2 {
+		t.Fatalf("%d posts, want the alert and the reply", len(payloads))
+	}
+	alert, reply := payloads[0], payloads[1]
+	if alert.Channel != "fraud-alerts" || alert.Text != slackFixtureText || alert.ThreadTS != "" {
+		t.Errorf("alert posted as %+v", alert)
+	}
+	if reply.Channel != "fraud-alerts" || reply.ThreadTS != "1700000000.000101" || reply.Text != "Alert marked *resolved* by analyst-1" {
+		t.Errorf("reply posted as %+v, want it in the alert's thread", reply)
+	}
+	for _, token := range tokens {
+		if token != "Bearer xoxb-test" {
+			t.Errorf("posted with authorization %q", token)
+		}
+	}
+}
+
+func TestReplyInThreadNeedsBotToken(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusOK)
+	if err := NewNotifier(stub.URL, newTestRenderer(t)).ReplyInThread(context.Background(), "fraud-alerts", "1700000000.000101", "resolved"); err == nil {
+		t.Error("ReplyInThread succeeded through a webhook, which cannot thread")
+	}
+	if payloads := stub.posted(); len(payloads) != 0 {
+		t.Errorf("webhook posted %+v", payloads)
+	}
+}
+
+func TestBotNotifierReportsSlackErrors(t *testing.T) {
+	stub := newSlackAPIStub(t)
+	notification, err := newTestBotNotifier(t, stub, "archived").SendAlert(context.Background(), alertFixture())
+	if err == nil || err.Error() != "slack error: is_archived" {
+		t.Fatalf("SendAlert to an archived channel = %v, want the Slack error", err)
+	}
+	if notification.Status != models.NotificationStatusFailed || notification.ExternalID != "" {
+		t.Errorf("notification = %+v, want it failed without a ts", notification)
+	}
+}
+
+// counterValue returns the value of the counter name with labels in the
+// default registry, 0 when it has not been incremented
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// rateLimitedStub is a Slack incoming webhook answering 429 with
+// retryAfter to the first limited posts, then 200, and counting the posts
+type rateLimitedStub struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	limited int
+	posts   int
+}
+
+func newRateLimitedStub(t *testing.T, limited int, retryAfter string) *rateLimitedStub {
+	t.Helper()
+	stub := &rateLimitedStub{limited: limited}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		stub.posts++
+		limit := stub.posts <= stub.limited
+		stub.mu.Unlock()
+		if limit {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *rateLimitedStub) postCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts
+}
+
+func TestEscapeSlack(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Bellagio Casino", "Bellagio Casino"},
+		{"Marks & Spencer", "Marks &amp; Spencer"},
+		{"<!channel> wins", "&lt;!channel&gt; wins"},
+		{"<https://evil.example|click here>", "&lt;https://evil.example|click here&gt;"},
+		{"<@U123>", "&lt;@U123&gt;"},
+		{"already &amp; escaped", "already &amp;amp; escaped"},
+		{"*bold* _italic_", "*bold* _italic_"},
+	}
+	for _, tt := range tests {
+		if got := EscapeSlack(tt.text); got != tt.want {
+			t.Errorf("EscapeSlack(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSlackMessageEscapesAlertContent(t *testing.T) {
+	stub := newWebhookStub(t, http.StatusOK)
+	alert := alertFixture()
+	alert.Description = "Spend at <Tom & Jerry's> <!here>"
+
+	if _, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alert); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	text := stub.posted()[0].Text
+	if !strings.Contains(text, "Spend at &lt;Tom &amp; Jerry's&gt; &lt;!here&gt;\n") {
+		t.Errorf("posted %q, want the description escaped", text)
+	}
+	if !strings.HasPrefix(text, "🟠 *HIGH fraud alert*") {
+		t.Errorf("posted %q, want the template's own markup kept", text)
+	}
+}
+
+func TestTypedNotifierRoutesByAlertType(t *testing.T) {
+	fraud, compliance, fallback := newWebhookStub(t, http.StatusOK), newWebhookStub(t, http.StatusOK), newWebhookStub(t, http.StatusOK)
+	n := NewTypedNotifier(map[string]string{
+		models.AlertTypeFraud:      fraud.URL,
+		models.AlertTypeCompliance: compliance.URL,
+	}, fallback.URL, newTestRenderer(t))
+
+	tests := []struct {
+		alertType string
+		stub      *webhookStub
+		recipient string
+	}{
+		{models.AlertTypeFraud, fraud, "slack-webhook:fraud"},
+		{models.AlertTypeCompliance, compliance, "slack-webhook:compliance"},
+		{models.AlertTypeOperational, fallback, "slack-webhook"},
+	}
+	for _, tt := range tests {
+		alert := alertFixture()
+		alert.ID, alert.AlertType = "alert-"+tt.alertType, tt.alertType
+		notification, err := n.SendAlert(context.Background(), alert)
+		if err != nil {
+			t.Fatalf("SendAlert(%s): %v", tt.alertType, err)
+		}
+		if notification.Recipient != tt.recipient {
+			t.Errorf("%s alert recorded to %q, want %q", tt.alertType, notification.Recipient, tt.recipient)
+		}
+	}
+	for _, tt := range tests {
+		if payloads := tt.stub.posted(); len(payloads) != 1 || !strings.Contains(payloads[0].Text, tt.alertType+" alert") {
+			t.Errorf("%s webhook received %+v, want the %s alert alone", tt.alertType, payloads, tt.alertType)
+		}
+	}
+}
+
+func TestSlackDeliveriesAreCountedByDestination(t *testing.T) {
+	ok, failing := newWebhookStub(t, http.StatusOK), newWebhookStub(t, http.StatusInternalServerError)
+	delivered := func(destination, outcome string) float64 {
+		return counterValue(t, "alert_slack_deliveries_total", map[string]string{"destination": destination, "outcome": outcome})
+	}
+	before := map[string]float64{
+		"pipeline-ops": delivered("pipeline-ops", metrics.NotificationDelivered),
+		"compliance":   delivered("compliance", metrics.NotificationFailed),
+		"default":      delivered("default", metrics.NotificationDelivered),
+	}
+
+	NewDestinationNotifier("pipeline-ops", ok.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	compliance := alertFixture()
+	compliance.AlertType = models.AlertTypeCompliance
+	NewTypedNotifier(map[string]string{models.AlertTypeCompliance: failing.URL}, ok.URL, newTestRenderer(t)).SendAlert(context.Background(), compliance)
+	NewNotifier(ok.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+
+	if got := delivered("pipeline-ops", metrics.NotificationDelivered) - before["pipeline-ops"]; got != 1 {
+		t.Errorf("deliveries to pipeline-ops = %v, want 1", got)
+	}
+	if got := delivered("compliance", metrics.NotificationFailed) - before["compliance"]; got != 1 {
+		t.Errorf("failed deliveries to compliance = %v, want 1", got)
+	}
+	if got := delivered("default", metrics.NotificationDelivered) - before["default"]; got != 1 {
+		t.Errorf("deliveries to the default webhook = %v, want 1", got)
+	}
+}
+
+func TestSlackRetriesAfter429(t *testing.T) {
+	limitedBefore := counterValue(t, "alert_slack_rate_limited_total", nil)
+	stub := newRateLimitedStub(t, 2, "0")
+	notification, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	if err != nil || notification.Status != models.NotificationStatusSent {
+		t.Fatalf("SendAlert after two 429s = %+v, %v, want it sent", notification, err)
+	}
+	if n := stub.postCount(); n != 3 {
+		t.Errorf("%d posts, want sent on the third", n)
+	}
+	if got := counterValue(t, "alert_slack_rate_limited_total", nil) - limitedBefore; got != 2 {
+		t.Errorf("rate limited count = %v, want 2", got)
+	}
+
+	// Past its retries the delivery fails with the 429
+	limited := newRateLimitedStub(t, slackMaxRetries+1, "0")
+	notification, err = NewNotifier(limited.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture())
+	if err == nil || !strings.Contains(err.Error(), "429") || notification.Status != models.NotificationStatusFailed {
+		t.Errorf("SendAlert while rate limited = %+v, %v, want it failed with the 429", notification, err)
+	}
+	if n := limited.postCount(); n != slackMaxRetries+1 {
+		t.Errorf("%d posts, want %d", n, slackMaxRetries+1)
+	}
+}
+
+func TestSlackWaitsOutRetryAfter(t *testing.T) {
+	stub := newRateLimitedStub(t, 1, "1")
+	start := time.Now()
+	if _, err := NewNotifier(stub.URL, newTestRenderer(t)).SendAlert(context.Background(), alertFixture()); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, before the 1s Retry-After", elapsed)
+	}
+
+	// A wait longer than the context allows gives up
+	slow := newRateLimitedStub(t, 1, "30")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewNotifier(slow.URL, newTestRenderer(t)).SendAlert(ctx, alertFixture())
+	if err == nil || !strings.Contains(err.Error(), "rate limited by Slack") {
+		t.Errorf("SendAlert = %v, want it rate limited past the deadline", err)
+	}
+	if n := slow.postCount(); n != 1 {
+		t.Errorf("%d posts, want no retry before Retry-After", n)
+	}
+}
@@ -0,0 +1,231 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyMaxRetries is how many times a rate-limited event is retried
+const pagerDutyMaxRetries = 3
+
+// PagerDuty event actions
+const (
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+// pagerDutySeverities maps alert severities to PagerDuty severities
+var pagerDutySeverities = map[string]string{
+	models.SeverityCritical: "critical",
+	models.SeverityHigh:     "error",
+	models.SeverityMedium:   "warning",
+	models.SeverityLow:      "info",
+}
+
+// PagerDutySender triggers and resolves PagerDuty incidents through the
+// Events API v2. Alerts for the same account and rule share a dedup key, so
+// repeats update one incident instead of paging again.
+type PagerDutySender struct {
+	routingKey string
+	url        string
+	client     *http.Client
+	renderer   *templates.Renderer
+}
+
+// NewPagerDutySender creates a new PagerDuty sender for an integration's routing key
+func NewPagerDutySender(routingKey string, renderer *templates.Renderer) *PagerDutySender {
+	return &PagerDutySender{
+		routingKey: routingKey,
+		url:        pagerDutyEventsURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		renderer:   renderer,
+	}
+}
+
+// PagerDutyEvent is an Events API v2 request
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload describes the incident of a trigger event
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyResponse is the response of the Events API
+type pagerDutyResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	DedupKey string `json:"dedup_key"`
+}
+
+// PagerDutyDedupKey returns the dedup key of an alert's incident
+func PagerDutyDedupKey(alert *models.Alert) string {
+	return "tx-monitoring/" + alert.AccountID + "/" + alert.RuleTriggered
+}
+
+// SendAlert triggers (or updates) the incident for an alert
+func (p *PagerDutySender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	severity, ok := pagerDutySeverities[alert.Severity]
+	if !ok {
+		severity = "warning"
+	}
+
+	summary, err := p.renderer.Render(templates.PagerDuty, alert)
+	if err != nil {
+		return &models.Notification{
+			ID:      newNotificationID(),
+			AlertID: alert.ID,
+			Channel: models.ChannelPagerDuty,
+			Status:  models.NotificationStatusFailed,
+			Error:   err.Error(),
+		}, err
+	}
+
+	event := PagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: pagerDutyTrigger,
+		DedupKey:    PagerDutyDedupKey(alert),
+		Payload: &PagerDutyPayload{
+			Summary:   summary,
+			Source:    "alert-service",
+			Severity:  severity,
+			Timestamp: alert.CreatedAt.Format(time.RFC3339),
+			Component: alert.AccountID,
+			Class:     alert.AlertType,
+			CustomDetails: map[string]string{
+				"alert_id":       alert.ID,
+				"transaction_id": alert.TransactionID,
+				"account_id":     alert.AccountID,
+				"user_id":        alert.UserID,
+				"amount":         strconv.FormatFloat(alert.Amount, 'f', 2, 64),
+				"currency":       alert.Currency,
+				"risk_score":     strconv.FormatFloat(alert.RiskScore, 'f', 2, 64),
+				"rule":           alert.RuleTriggered,
+				"description":    alert.Description,
+			},
+		},
+	}
+
+	return p.sendEvent(ctx, alert, event)
+}
+
+// Preview renders the summary of the incident the alert would trigger
+func (p *PagerDutySender) Preview(alert *models.Alert) (*Preview, error) {
+	summary, err := p.renderer.Render(templates.PagerDuty, alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{Recipient: "pagerduty:" + PagerDutyDedupKey(alert), Message: summary}, nil
+}
+
+// Resolve resolves the incident for an alert. Since alerts for the same
+// account and rule share an incident, this resolves it for all of them.
+func (p *PagerDutySender) Resolve(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	event := PagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: pagerDutyResolve,
+		DedupKey:    PagerDutyDedupKey(alert),
+	}
+
+	return p.sendEvent(ctx, alert, event)
+}
+
+// sendEvent posts an event and returns the delivery record
+func (p *PagerDutySender) sendEvent(ctx context.Context, alert *models.Alert, event PagerDutyEvent) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:         newNotificationID(),
+		AlertID:    alert.ID,
+		Channel:    models.ChannelPagerDuty,
+		Recipient:  "pagerduty",
+		Subject:    fmt.Sprintf("%s %s", event.EventAction, event.DedupKey),
+		Status:     models.NotificationStatusPending,
+		ExternalID: event.DedupKey,
+	}
+
+	body, err := json.Marshal(event)
+	if err == nil {
+		if event.Payload != nil {
+			notification.Message = event.Payload.Summary
+		}
+		err = p.post(ctx, body)
+	}
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	notification.Status = models.NotificationStatusSent
+	notification.SentAt = time.Now()
+	return notification, nil
+}
+
+// post sends an event, waiting out 429 responses as long as ctx allows
+func (p *PagerDutySender) post(ctx context.Context, body []byte) error {
+	if p.routingKey == "" {
+		return fmt.Errorf("pagerduty routing key not configured")
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request to PagerDuty: %w", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < pagerDutyMaxRetries {
+			wait := retryAfter(resp.Header.Get("Retry-After"), time.Duration(attempt+1)*time.Second)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("rate limited by PagerDuty: %w", ctx.Err())
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			var result pagerDutyResponse
+			json.Unmarshal(data, &result)
+			return fmt.Errorf("non-2xx response from PagerDuty: %s %s", resp.Status, result.Message)
+		}
+		return nil
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds, falling back to
+// defaultWait when it is missing or malformed
+func retryAfter(value string, defaultWait time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultWait
+}
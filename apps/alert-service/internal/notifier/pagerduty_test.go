@@ -0,0 +1,243 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// pagerDutyStub is the Events API, answering with the queued statuses and
+// then 202, and recording the events posted to it
+type pagerDutyStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	events   []PagerDutyEvent
+}
+
+func newPagerDutyStub(t *testing.T, statuses ...int) *pagerDutyStub {
+	t.Helper()
+	stub := &pagerDutyStub{statuses: statuses}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event PagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid event: %v", err)
+		}
+		stub.mu.Lock()
+		stub.events = append(stub.events, event)
+		status := http.StatusAccepted
+		if len(stub.statuses) > 0 {
+			status, stub.statuses = stub.statuses[0], stub.statuses[1:]
+		}
+		stub.mu.Unlock()
+
+		switch status {
+		case http.StatusAccepted:
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(pagerDutyResponse{Status: "success", Message: "Event processed", DedupKey: event.DedupKey})
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+		default:
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(pagerDutyResponse{Status: "invalid event", Message: "Event object is invalid"})
+		}
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *pagerDutyStub) posted() []PagerDutyEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PagerDutyEvent(nil), s.events...)
+}
+
+// newTestPagerDutySender returns a sender posting to the stub
+func newTestPagerDutySender(t *testing.T, stub *pagerDutyStub, routingKey string) *PagerDutySender {
+	t.Helper()
+	p := NewPagerDutySender(routingKey, newTestRenderer(t))
+	p.url = stub.URL
+	return p
+}
+
+func TestPagerDutyTrigger(t *testing.T) {
+	stub := newPagerDutyStub(t)
+	notification, err := newTestPagerDutySender(t, stub, "routing-key").SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	events := stub.posted()
+	if len(events) != 1 {
+		t.Fatalf("%d events posted, want 1", len(events))
+	}
+	event := events[0]
+	if event.RoutingKey != "routing-key" || event.EventAction != "trigger" || event.DedupKey != "tx-monitoring/acct-1/high_amount" {
+		t.Errorf("event = %+v", event)
+	}
+	payload := event.Payload
+	if payload == nil {
+		t.Fatal("trigger without a payload")
+	}
+	if payload.Summary != "high fraud alert for account acct-1: high_amount" || payload.Source != "alert-service" ||
+		payload.Severity != "error" || payload.Timestamp != "2026-03-02T09:30:00Z" || payload.Component != "acct-1" || payload.Class != "fraud" {
+		t.Errorf("payload = %+v", payload)
+	}
+	want := map[string]string{
+		"alert_id":       "alert-1",
+		"transaction_id": "txn-1",
+		"account_id":     "acct-1",
+		"user_id":        "user-1",
+		"amount":         "12500.00",
+		"currency":       "USD",
+		"risk_score":     "0.87",
+		"rule":           "high_amount",
+		"description":    "Amount over the 10000 threshold",
+	}
+	for key, value := range want {
+		if payload.CustomDetails[key] != value {
+			t.Errorf("custom detail %s = %q, want %q", key, payload.CustomDetails[key], value)
+		}
+	}
+
+	if notification.Status != models.NotificationStatusSent || notification.Channel != models.ChannelPagerDuty ||
+		notification.ExternalID != "tx-monitoring/acct-1/high_amount" || notification.Message != payload.Summary ||
+		notification.Subject != "trigger tx-monitoring/acct-1/high_amount" || notification.SentAt.IsZero() {
+		t.Errorf("notification = %+v", notification)
+	}
+}
+
+func TestPagerDutySeverities(t *testing.T) {
+	stub := newPagerDutyStub(t)
+	p := newTestPagerDutySender(t, stub, "routing-key")
+	severities := map[string]string{
+		models.SeverityCritical: "critical",
+		models.SeverityHigh:     "error",
+		models.SeverityMedium:   "warning",
+		models.SeverityLow:      "info",
+		"unknown":               "warning",
+	}
+	for severity, want := range severities {
+		alert := alertFixture()
+		alert.Severity = severity
+		if _, err := p.SendAlert(context.Background(), alert); err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+		events := stub.posted()
+		if got := events[len(events)-1].Payload.Severity; got != want {
+			t.Errorf("%s alert paged as %s, want %s", severity, got, want)
+		}
+	}
+}
+
+func TestPagerDutyDedupsAccountAndRule(t *testing.T) {
+	stub := newPagerDutyStub(t)
+	p := newTestPagerDutySender(t, stub, "routing-key")
+
+	first, repeat, otherRule, otherAccount := alertFixture(), alertFixture(), alertFixture(), alertFixture()
+	repeat.ID, repeat.TransactionID = "alert-2", "txn-2"
+	otherRule.ID, otherRule.RuleTriggered = "alert-3", "velocity"
+	otherAccount.ID, otherAccount.AccountID = "alert-4", "acct-2"
+	for _, alert := range []*models.Alert{first, repeat, otherRule, otherAccount} {
+		if _, err := p.SendAlert(context.Background(), alert); err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+	}
+
+	var keys []string
+	for _, event := range stub.posted() {
+		keys = append(keys, event.DedupKey)
+	}
+	want := "tx-monitoring/acct-1/high_amount tx-monitoring/acct-1/high_amount tx-monitoring/acct-1/velocity tx-monitoring/acct-2/high_amount"
+	if got := strings.Join(keys, " "); got != want {
+		t.Errorf("dedup keys = %s, want %s", got, want)
+	}
+}
+
+func TestPagerDutyResolve(t *testing.T) {
+	stub := newPagerDutyStub(t)
+	p := newTestPagerDutySender(t, stub, "routing-key")
+	alert := alertFixture()
+	alert.Status = models.StatusResolved
+
+	notification, err := p.Resolve(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	events := stub.posted()
+	if len(events) != 1 {
+		t.Fatalf("%d events posted, want 1", len(events))
+	}
+	if e := events[0]; e.EventAction != "resolve" || e.DedupKey != "tx-monitoring/acct-1/high_amount" || e.RoutingKey != "routing-key" || e.Payload != nil {
+		t.Errorf("resolve event = %+v", e)
+	}
+	if notification.Status != models.NotificationStatusSent || notification.Subject != "resolve tx-monitoring/acct-1/high_amount" {
+		t.Errorf("notification = %+v", notification)
+	}
+}
+
+func TestPagerDutyRetriesRateLimitedEvents(t *testing.T) {
+	stub := newPagerDutyStub(t, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	notification, err := newTestPagerDutySender(t, stub, "routing-key").SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if n := len(stub.posted()); n != 3 || notification.Status != models.NotificationStatusSent {
+		t.Errorf("%d attempts ending %s, want sent on the third", n, notification.Status)
+	}
+
+	limited := newPagerDutyStub(t, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	notification, err = newTestPagerDutySender(t, limited, "routing-key").SendAlert(context.Background(), alertFixture())
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("SendAlert while rate limited = %v, want a 429 error", err)
+	}
+	if n := len(limited.posted()); n != pagerDutyMaxRetries+1 || notification.Status != models.NotificationStatusFailed {
+		t.Errorf("%d attempts ending %s, want %d failed", n, notification.Status, pagerDutyMaxRetries+1)
+	}
+}
+
+func TestPagerDutyRecordsFailures(t *testing.T) {
+	stub := newPagerDutyStub(t, http.StatusBadRequest)
+	notification, err := newTestPagerDutySender(t, stub, "routing-key").SendAlert(context.Background(), alertFixture())
+	if err == nil || !strings.Contains(err.Error(), "Event object is invalid") {
+		t.Errorf("SendAlert of a rejected event = %v, want PagerDuty's message", err)
+	}
+	if notification.Status != models.NotificationStatusFailed || notification.Error == "" || !notification.SentAt.IsZero() {
+		t.Errorf("notification = %+v, want it failed", notification)
+	}
+
+	unconfigured := newPagerDutyStub(t)
+	if _, err := newTestPagerDutySender(t, unconfigured, "").SendAlert(context.Background(), alertFixture()); err == nil {
+		t.Error("SendAlert without a routing key succeeded")
+	}
+	if n := len(unconfigured.posted()); n != 0 {
+		t.Errorf("%d events posted without a routing key", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 2 * time.Second},
+		{"0", 0},
+		{"30", 30 * time.Second},
+		{"-1", 2 * time.Second},
+		{"Wed, 21 Oct 2026 07:28:00 GMT", 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value, 2*time.Second); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
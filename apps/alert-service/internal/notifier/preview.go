@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"errors"
+
+	"alert-service/internal/models"
+)
+
+// errNoPreview is the preview error of a sender that cannot be previewed
+var errNoPreview = errors.New("channel cannot be previewed")
+
+// Preview is what a sender would deliver for an alert
+type Preview struct {
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Previewer renders what a sender would deliver for an alert without
+// delivering it. Previewing never touches the network.
+type Previewer interface {
+	Preview(alert *models.Alert) (*Preview, error)
+}
+
+// ChannelPreview is the preview of an alert on one destination of the
+// routing policy. Routed is set when the policy sends the alert there.
+type ChannelPreview struct {
+	Channel string `json:"channel"`
+	Routed  bool   `json:"routed"`
+	*Preview
+	Error string `json:"error,omitempty"`
+}
+
+// Preview renders an alert for every destination of the routing policy,
+// in policy order, without sending anything. Channels requested by rules
+// are not known here, so Routed reflects the policy alone.
+func (d *Dispatcher) Preview(alert *models.Alert) []ChannelPreview {
+	routed := make(map[string]bool)
+	for _, dest := range d.route(alert, nil) {
+		routed[dest.key()] = true
+	}
+
+	var destinations []Destination
+	seen := make(map[string]bool)
+	for _, route := range d.policy.Routes {
+		for _, dest := range route.Destinations {
+			if !seen[dest.key()] {
+				seen[dest.key()] = true
+				destinations = append(destinations, dest)
+			}
+		}
+	}
+	for _, dest := range d.policy.Default {
+		if !seen[dest.key()] {
+			seen[dest.key()] = true
+			destinations = append(destinations, dest)
+		}
+	}
+
+	previews := make([]ChannelPreview, len(destinations))
+	for i, dest := range destinations {
+		previews[i] = ChannelPreview{Channel: dest.Channel, Routed: routed[dest.key()]}
+		preview, err := d.preview(alert, dest)
+		if err != nil {
+			previews[i].Error = err.Error()
+			continue
+		}
+		previews[i].Preview = preview
+	}
+	return previews
+}
+
+// preview renders an alert for one destination
+func (d *Dispatcher) preview(alert *models.Alert, dest Destination) (*Preview, error) {
+	sender, err := d.sender(dest)
+	if err != nil {
+		return nil, err
+	}
+	previewer, ok := sender.(Previewer)
+	if !ok {
+		return nil, errNoPreview
+	}
+	return previewer.Preview(alert)
+}
@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"alert-service/internal/models"
+)
+
+// connectionCounter is a listener counting the connections made to it, so
+// a test can point every sender at it and tell whether any was used
+type connectionCounter struct {
+	net.Listener
+
+	mu    sync.Mutex
+	count int
+}
+
+func newConnectionCounter(t *testing.T) *connectionCounter {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	c := &connectionCounter{Listener: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.mu.Lock()
+			c.count++
+			c.mu.Unlock()
+			conn.Close()
+		}
+	}()
+	return c
+}
+
+func (c *connectionCounter) connections() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+func TestPreviewSendsNothing(t *testing.T) {
+	counter := newConnectionCounter(t)
+	url := "http://" + counter.Addr().String()
+	path := filepath.Join(t.TempDir(), "alerts.ndjson")
+	var console bytes.Buffer
+
+	policy := &RoutingPolicy{
+		Routes: []Route{
+			{Severity: models.SeverityCritical, Destinations: []Destination{
+				{Channel: models.ChannelPagerDuty},
+				{Channel: models.ChannelSMS},
+			}},
+			{Severity: models.SeverityHigh, Destinations: []Destination{
+				{Channel: models.ChannelSlack},
+				{Channel: models.ChannelEmail},
+				{Channel: models.ChannelWebhook},
+			}},
+		},
+		Default: []Destination{{Channel: models.ChannelDigest}, {Channel: models.ChannelConsole}, {Channel: models.ChannelFile}},
+	}
+	factory := func(dest Destination) (Sender, error) {
+		renderer := newTestRenderer(t)
+		switch dest.Channel {
+		case models.ChannelSlack:
+			return NewNotifier(url, renderer), nil
+		case models.ChannelEmail:
+			return NewEmailSender(counter.Addr().String(), "alerts@bank.example", "secret", []string{"fraud@bank.example"}, renderer)
+		case models.ChannelWebhook:
+			return NewWebhookSender(url), nil
+		case models.ChannelPagerDuty:
+			p := NewPagerDutySender("routing-key", renderer)
+			p.url = url
+			return p, nil
+		case models.ChannelSMS:
+			s, err := NewSMSSender("AC123", "auth-token", "+15550100", []string{"+15550199"}, NewSMSBudget(nil, 0), renderer)
+			if s != nil {
+				s.url = url
+			}
+			return s, err
+		case models.ChannelDigest:
+			return NewDigest(nil, NewNotifier(url, renderer)), nil
+		case models.ChannelConsole:
+			return NewConsoleSender(&console, renderer), nil
+		case models.ChannelFile:
+			return NewFileSender(path, renderer)
+		}
+		return nil, errors.New("not enabled")
+	}
+	d, err := NewDispatcher(policy, factory, RetryPolicy{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+
+	previews := d.Preview(alertFixture())
+	var channels []string
+	for _, p := range previews {
+		channels = append(channels, p.Channel)
+	}
+	want := "pagerduty sms slack email webhook digest console file"
+	if got := strings.Join(channels, " "); got != want {
+		t.Fatalf("previewed %q, want every destination in policy order %q", got, want)
+	}
+
+	routed := map[string]bool{models.ChannelSlack: true, models.ChannelEmail: true, models.ChannelWebhook: true}
+	for _, p := range previews {
+		if p.Routed != routed[p.Channel] {
+			t.Errorf("%s routed %v, want %v", p.Channel, p.Routed, routed[p.Channel])
+		}
+		if p.Error != "" || p.Preview == nil || p.Message == "" || p.Recipient == "" {
+			t.Errorf("preview of %s = %+v", p.Channel, p)
+		}
+	}
+	for _, p := range previews {
+		switch p.Channel {
+		case models.ChannelSlack:
+			if p.Message != slackFixtureText {
+				t.Errorf("Slack preview =\n%s\nwant\n%s", p.Message, slackFixtureText)
+			}
+		case models.ChannelSMS:
+			if p.Message != smsFixtureText {
+				t.Errorf("SMS preview = %q, want %q", p.Message, smsFixtureText)
+			}
+		case models.ChannelConsole, models.ChannelFile:
+			if p.Message != consoleFixtureText {
+				t.Errorf("%s preview =\n%s\nwant the console message", p.Channel, p.Message)
+			}
+		}
+	}
+
+	if n := counter.connections(); n != 0 {
+		t.Errorf("previewing made %d connections, want none", n)
+	}
+	if console.Len() != 0 {
+		t.Errorf("previewing printed %q", console.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("previewing wrote the notification file: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/templates"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// twilioAPIURL is the base of the Twilio REST API
+const twilioAPIURL = "https://api.twilio.com/2010-04-01"
+
+// smsMaxLength is the longest message sent, two concatenated SMS segments
+const smsMaxLength = 320
+
+// smsMaxRetries is how many times a message is retried after a Twilio 5xx
+// or a timeout
+const smsMaxRetries = 2
+
+// SMSSender texts alerts to a list of phone numbers through Twilio. Every
+// message is charged against a shared hourly budget.
+type SMSSender struct {
+	accountSID string
+	authToken  string
+	from       string
+	to         []string
+	budget     *SMSBudget
+	url        string
+	client     *http.Client
+	renderer   *templates.Renderer
+}
+
+// NewSMSSender creates a new Twilio SMS sender
+func NewSMSSender(accountSID, authToken, from string, to []string, budget *SMSBudget, renderer *templates.Renderer) (*SMSSender, error) {
+	if accountSID == "" || authToken == "" {
+		return nil, fmt.Errorf("twilio credentials not configured")
+	}
+	if from == "" {
+		return nil, fmt.Errorf("sms from number not configured")
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no sms recipients configured")
+	}
+
+	return &SMSSender{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		to:         to,
+		budget:     budget,
+		url:        twilioAPIURL + "/Accounts/" + accountSID + "/Messages.json",
+		client:     &http.Client{Timeout: 10 * time.Second},
+		renderer:   renderer,
+	}, nil
+}
+
+// twilioMessage is the part of a Twilio message resource we read
+type twilioMessage struct {
+	SID     string `json:"sid"`
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// twilioError is an error response from Twilio. Only 5xx responses are
+// worth retrying.
+type twilioError struct {
+	status  int
+	code    int
+	message string
+}
+
+func (e *twilioError) Error() string {
+	return fmt.Sprintf("twilio error %d (HTTP %d): %s", e.code, e.status, e.message)
+}
+
+// SendAlert texts the alert to every recipient. The notification records
+// the Twilio message SIDs; it fails only when no message was sent, since
+// retrying would text the recipients that did receive it again. Messages
+// over the hourly budget are dropped.
+func (s *SMSSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelSMS,
+		Recipient: strings.Join(s.to, ","),
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
+
+	body, err := s.renderer.Render(templates.SMS, alert)
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+	body = truncateSMS(body)
+	notification.Message = body
+
+	var sids, failures []string
+	dropped := 0
+	for _, to := range s.to {
+		allowed, err := s.budget.Take(ctx)
+		if err != nil {
+			// Fail open: an uncounted text is better than a missed alert
+			slog.WarnContext(ctx, "sms budget check failed", "error", err)
+			allowed = true
+		}
+		if !allowed {
+			dropped++
+			continue
+		}
+
+		sid, err := s.send(ctx, to, body)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", to, err))
+			continue
+		}
+		sids = append(sids, sid)
+	}
+
+	if dropped > 0 {
+		failures = append(failures, fmt.Sprintf("%d messages dropped: hourly SMS budget of %d exhausted", dropped, s.budget.max))
+	}
+	notification.Error = strings.Join(failures, "; ")
+	notification.ExternalID = strings.Join(sids, ",")
+
+	switch {
+	case len(sids) > 0:
+		notification.Status = models.NotificationStatusSent
+		notification.SentAt = time.Now()
+		return notification, nil
+	case dropped > 0 && len(failures) == 1:
+		notification.Status = models.NotificationStatusDropped
+		return notification, nil
+	default:
+		notification.Status = models.NotificationStatusFailed
+		return notification, errors.New(notification.Error)
+	}
+}
+
+// Preview renders the text the alert would be sent as
+func (s *SMSSender) Preview(alert *models.Alert) (*Preview, error) {
+	body, err := s.renderer.Render(templates.SMS, alert)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{
+		Recipient: strings.Join(s.to, ","),
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   truncateSMS(body),
+	}, nil
+}
+
+// send creates one message and returns its SID, retrying 5xx responses and
+// timeouts
+func (s *SMSSender) send(ctx context.Context, to, body string) (string, error) {
+	form := url.Values{"To": {to}, "From": {s.from}, "Body": {body}}.Encode()
+
+	for attempt := 0; ; attempt++ {
+		sid, err := s.post(ctx, form)
+		if err == nil || attempt >= smsMaxRetries || !retryableSMSError(err) {
+			return sid, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(time.Duration(attempt+1) * time.Second):
+		}
+	}
+}
+
+func (s *SMSSender) post(ctx context.Context, form string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, strings.NewReader(form))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request to Twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var result twilioMessage
+	json.Unmarshal(data, &result)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &twilioError{status: resp.StatusCode, code: result.Code, message: result.Message}
+	}
+	if result.SID == "" {
+		return "", fmt.Errorf("twilio response has no message SID")
+	}
+	return result.SID, nil
+}
+
+// retryableSMSError reports whether a failed send may succeed if retried:
+// Twilio server errors and timeouts, but not rejected requests
+func retryableSMSError(err error) bool {
+	var apiErr *twilioError
+	if errors.As(err, &apiErr) {
+		return apiErr.status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// truncateSMS shortens a message to smsMaxLength characters
+func truncateSMS(body string) string {
+	runes := []rune(strings.TrimSpace(body))
+	if len(runes) <= smsMaxLength {
+		return string(runes)
+	}
+	return string(runes[:smsMaxLength-1]) + "…"
+}
+
+// SMSBudget caps the SMS messages sent per clock hour across all senders.
+// The count lives in Redis so every replica shares it; without Redis it is
+// kept in memory.
+type SMSBudget struct {
+	redis *redis.Client
+	max   int
+
+	mu    sync.Mutex
+	hour  time.Time
+	count int
+}
+
+// NewSMSBudget creates a budget of max messages per hour; max <= 0 means
+// unlimited. redisClient may be nil.
+func NewSMSBudget(redisClient *redis.Client, max int) *SMSBudget {
+	return &SMSBudget{redis: redisClient, max: max}
+}
+
+// Take charges one message against the budget and reports whether it may
+// be sent
+func (b *SMSBudget) Take(ctx context.Context) (bool, error) {
+	if b.max <= 0 {
+		return true, nil
+	}
+
+	hour := time.Now().Truncate(time.Hour)
+	if b.redis == nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !hour.Equal(b.hour) {
+			b.hour, b.count = hour, 0
+		}
+		if b.count >= b.max {
+			return false, nil
+		}
+		b.count++
+		return true, nil
+	}
+
+	key := fmt.Sprintf("sms:budget:%d", hour.Unix())
+	var count *redis.IntCmd
+	_, err := b.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 2*time.Hour)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check SMS budget: %w", err)
+	}
+	return count.Val() <= int64(b.max), nil
+}
@@ -0,0 +1,310 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"alert-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// twilioStub is the Twilio Messages API. It answers with the queued
+// statuses and then 201, rejects the invalid numbers, and records the
+// messages posted to it.
+type twilioStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	delay    time.Duration
+	invalid  map[string]bool
+	messages []map[string]string
+}
+
+func newTwilioStub(t *testing.T, statuses ...int) *twilioStub {
+	t.Helper()
+	stub := &twilioStub{statuses: statuses, invalid: make(map[string]bool)}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Accounts/AC123/Messages.json" {
+			t.Errorf("posted to %s", r.URL.Path)
+		}
+		if sid, token, ok := r.BasicAuth(); !ok || sid != "AC123" || token != "auth-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(twilioMessage{Code: 20003, Message: "Authenticate"})
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid form: %v", err)
+		}
+		stub.mu.Lock()
+		stub.messages = append(stub.messages, map[string]string{"To": r.PostForm.Get("To"), "From": r.PostForm.Get("From"), "Body": r.PostForm.Get("Body")})
+		n := len(stub.messages)
+		status := http.StatusCreated
+		if len(stub.statuses) > 0 {
+			status, stub.statuses = stub.statuses[0], stub.statuses[1:]
+		}
+		delay := stub.delay
+		stub.delay = 0
+		invalid := stub.invalid[r.PostForm.Get("To")]
+		stub.mu.Unlock()
+
+		time.Sleep(delay)
+		switch {
+		case invalid:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(twilioMessage{Code: 21211, Message: "Invalid 'To' Phone Number"})
+		case status == http.StatusCreated:
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(twilioMessage{SID: fmt.Sprintf("SM%d", n), Status: "queued"})
+		default:
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(twilioMessage{Code: 20500, Message: "Internal Server Error"})
+		}
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *twilioStub) posted() []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]string(nil), s.messages...)
+}
+
+// newTestSMSSender returns a sender texting to through the stub, charged
+// against budget
+func newTestSMSSender(t *testing.T, stub *twilioStub, budget *SMSBudget, to ...string) *SMSSender {
+	t.Helper()
+	s, err := NewSMSSender("AC123", "auth-token", "+15550100", to, budget, newTestRenderer(t))
+	if err != nil {
+		t.Fatalf("NewSMSSender: %v", err)
+	}
+	s.url = stub.URL + "/Accounts/AC123/Messages.json"
+	return s
+}
+
+// smsFixtureText is the message texted for alertFixture
+const smsFixtureText = "HIGH fraud alert: $12,500.00 on account acct-1, risk 0.87. high_amount - Amount over the 10000 threshold (alert-1)"
+
+func TestSMSTextsEveryRecipient(t *testing.T) {
+	stub := newTwilioStub(t)
+	s := newTestSMSSender(t, stub, NewSMSBudget(nil, 0), "+15550101", "+15550102")
+
+	notification, err := s.SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	messages := stub.posted()
+	if len(messages) != 2 {
+		t.Fatalf("%d messages posted, want 2", len(messages))
+	}
+	for i, to := range []string{"+15550101", "+15550102"} {
+		if m := messages[i]; m["To"] != to || m["From"] != "+15550100" || m["Body"] != smsFixtureText {
+			t.Errorf("message %d = %v", i, m)
+		}
+	}
+	if notification.Status != models.NotificationStatusSent || notification.Channel != models.ChannelSMS ||
+		notification.ExternalID != "SM1,SM2" || notification.Recipient != "+15550101,+15550102" ||
+		notification.Subject != "high fraud alert" || notification.Message != smsFixtureText ||
+		notification.Error != "" || notification.SentAt.IsZero() {
+		t.Errorf("notification = %+v", notification)
+	}
+}
+
+func TestSMSIsTruncated(t *testing.T) {
+	stub := newTwilioStub(t)
+	alert := alertFixture()
+	alert.Description = strings.Repeat("velocity ", 60)
+
+	notification, err := newTestSMSSender(t, stub, NewSMSBudget(nil, 0), "+15550101").SendAlert(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	body := stub.posted()[0]["Body"]
+	if utf8.RuneCountInString(body) != smsMaxLength || !strings.HasSuffix(body, "…") || notification.Message != body {
+		t.Errorf("texted %d characters %q, want %d ending in …", utf8.RuneCountInString(body), body, smsMaxLength)
+	}
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"  short  ", "short"},
+		{strings.Repeat("a", smsMaxLength), strings.Repeat("a", smsMaxLength)},
+		{strings.Repeat("a", smsMaxLength+1), strings.Repeat("a", smsMaxLength-1) + "…"},
+		// Multi-byte characters count once
+		{strings.Repeat("€", smsMaxLength), strings.Repeat("€", smsMaxLength)},
+	}
+	for _, tt := range tests {
+		if got := truncateSMS(tt.body); got != tt.want {
+			t.Errorf("truncateSMS of %d characters = %d characters", utf8.RuneCountInString(tt.body), utf8.RuneCountInString(got))
+		}
+	}
+}
+
+func TestSMSRetriesServerErrorsAndTimeouts(t *testing.T) {
+	stub := newTwilioStub(t, http.StatusServiceUnavailable)
+	notification, err := newTestSMSSender(t, stub, NewSMSBudget(nil, 0), "+15550101").SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert after a 503: %v", err)
+	}
+	if n := len(stub.posted()); n != 2 || notification.ExternalID != "SM2" {
+		t.Errorf("%d attempts sending %s, want sent on the second", n, notification.ExternalID)
+	}
+
+	slow := newTwilioStub(t)
+	slow.delay = 200 * time.Millisecond
+	s := newTestSMSSender(t, slow, NewSMSBudget(nil, 0), "+15550101")
+	s.client.Timeout = 50 * time.Millisecond
+	notification, err = s.SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert after a timeout: %v", err)
+	}
+	if n := len(slow.posted()); n != 2 || notification.Status != models.NotificationStatusSent {
+		t.Errorf("%d attempts ending %s, want sent on the second", n, notification.Status)
+	}
+}
+
+func TestSMSErrorMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		token    string
+		want     string
+		attempts int
+	}{
+		{"invalid number", nil, "auth-token", "twilio error 21211 (HTTP 400): Invalid 'To' Phone Number", 1},
+		{"bad credentials", nil, "wrong-token", "twilio error 20003 (HTTP 401): Authenticate", 0},
+		{"server errors", []int{500, 502, 503}, "auth-token", "twilio error 20500 (HTTP 503): Internal Server Error", smsMaxRetries + 1},
+	}
+	if testing.Short() {
+		tests = tests[:2]
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newTwilioStub(t, tt.statuses...)
+			stub.invalid["+15550199"] = tt.name == "invalid number"
+			s := newTestSMSSender(t, stub, NewSMSBudget(nil, 0), "+15550199")
+			s.authToken = tt.token
+
+			notification, err := s.SendAlert(context.Background(), alertFixture())
+			if err == nil || !strings.Contains(err.Error(), "+15550199: "+tt.want) {
+				t.Errorf("SendAlert = %v, want %q", err, tt.want)
+			}
+			if notification.Status != models.NotificationStatusFailed || notification.ExternalID != "" || !notification.SentAt.IsZero() {
+				t.Errorf("notification = %+v, want it failed", notification)
+			}
+			if n := len(stub.posted()); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestSMSPartialFailureIsSent(t *testing.T) {
+	stub := newTwilioStub(t)
+	stub.invalid["+15550199"] = true
+	notification, err := newTestSMSSender(t, stub, NewSMSBudget(nil, 0), "+15550199", "+15550101").SendAlert(context.Background(), alertFixture())
+	if err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if notification.Status != models.NotificationStatusSent || notification.ExternalID != "SM2" ||
+		!strings.HasPrefix(notification.Error, "+15550199: twilio error 21211") {
+		t.Errorf("notification = %+v, want sent with the invalid number's error", notification)
+	}
+}
+
+func TestSMSBudgetCapsMessagesPerHour(t *testing.T) {
+	mr := miniredis.RunT(t)
+	budgets := map[string]func() *SMSBudget{
+		"memory": func() *SMSBudget { return NewSMSBudget(nil, 3) },
+		"redis": func() *SMSBudget {
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+			t.Cleanup(func() { client.Close() })
+			return NewSMSBudget(client, 3)
+		},
+	}
+
+	for name, budget := range budgets {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			stub := newTwilioStub(t)
+			s := newTestSMSSender(t, stub, budget(), "+15550101", "+15550102")
+
+			if n, err := s.SendAlert(context.Background(), alertFixture()); err != nil || n.Status != models.NotificationStatusSent || n.Error != "" {
+				t.Fatalf("first alert = %+v, %v", n, err)
+			}
+			n, err := s.SendAlert(context.Background(), alertFixture())
+			if err != nil || n.Status != models.NotificationStatusSent || n.ExternalID != "SM3" ||
+				n.Error != "1 messages dropped: hourly SMS budget of 3 exhausted" {
+				t.Errorf("second alert = %+v, %v, want one message sent and one dropped", n, err)
+			}
+			n, err = s.SendAlert(context.Background(), alertFixture())
+			if err != nil || n.Status != models.NotificationStatusDropped || n.ExternalID != "" {
+				t.Errorf("third alert = %+v, %v, want it dropped", n, err)
+			}
+			if got := len(stub.posted()); got != 3 {
+				t.Errorf("%d messages posted, want the budget of 3", got)
+			}
+		})
+	}
+
+	// Replicas share the count through Redis
+	mr.FlushAll()
+	stub := newTwilioStub(t)
+	first := newTestSMSSender(t, stub, budgets["redis"](), "+15550101")
+	second := newTestSMSSender(t, stub, budgets["redis"](), "+15550101")
+	for i := 0; i < 4; i++ {
+		for _, s := range []*SMSSender{first, second} {
+			s.SendAlert(context.Background(), alertFixture())
+		}
+	}
+	if got := len(stub.posted()); got != 3 {
+		t.Errorf("%d messages posted by two replicas, want the shared budget of 3", got)
+	}
+}
+
+func TestSMSBudgetFailsOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	mr.Close()
+
+	stub := newTwilioStub(t)
+	notification, err := newTestSMSSender(t, stub, NewSMSBudget(client, 1), "+15550101", "+15550102").SendAlert(context.Background(), alertFixture())
+	if err != nil || notification.Status != models.NotificationStatusSent {
+		t.Fatalf("SendAlert without Redis = %+v, %v, want it sent", notification, err)
+	}
+	if got := len(stub.posted()); got != 2 {
+		t.Errorf("%d messages posted without Redis, want both", got)
+	}
+}
+
+func TestNewSMSSenderNeedsConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		sid, token, from string
+		to               []string
+	}{
+		{"no account SID", "", "auth-token", "+15550100", []string{"+15550101"}},
+		{"no auth token", "AC123", "", "+15550100", []string{"+15550101"}},
+		{"no from number", "AC123", "auth-token", "", []string{"+15550101"}},
+		{"no recipients", "AC123", "auth-token", "+15550100", nil},
+	}
+	for _, tt := range tests {
+		if _, err := NewSMSSender(tt.sid, tt.token, tt.from, tt.to, NewSMSBudget(nil, 0), newTestRenderer(t)); err == nil {
+			t.Errorf("%s: NewSMSSender succeeded", tt.name)
+		}
+	}
+}
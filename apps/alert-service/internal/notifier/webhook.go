@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// WebhookSender posts alerts as JSON to a generic HTTP endpoint
+type WebhookSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSender creates a new webhook sender
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendAlert posts the alert to the webhook
+func (w *WebhookSender) SendAlert(ctx context.Context, alert *models.Alert) (*models.Notification, error) {
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		AlertID:   alert.ID,
+		Channel:   models.ChannelWebhook,
+		Recipient: w.url,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Status:    models.NotificationStatusPending,
+	}
+
+	body, err := json.Marshal(alert)
+	if err == nil {
+		notification.Message = string(body)
+		err = w.post(ctx, body)
+	}
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		return notification, err
+	}
+
+	notification.Status = models.NotificationStatusSent
+	notification.SentAt = time.Now()
+	return notification, nil
+}
+
+// Preview renders the alert as it would be posted
+func (w *WebhookSender) Preview(alert *models.Alert) (*Preview, error) {
+	body, err := json.MarshalIndent(alert, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	return &Preview{
+		Recipient: w.url,
+		Subject:   fmt.Sprintf("%s %s alert", alert.Severity, alert.AlertType),
+		Message:   string(body),
+	}, nil
+}
+
+func (w *WebhookSender) post(ctx context.Context, body []byte) error {
+	if w.url == "" {
+		return fmt.Errorf("webhook URL not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx response from webhook: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+//go:build integration
+
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+	"alert-service/internal/testdb"
+)
+
+// The retention tests purge alerts seeded in Postgres in a container, each
+// test on a database of its own:
+//
+//	go test -tags=integration ./internal/retention/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(dbURL)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// recordingPoster records the messages posted
+type recordingPoster struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (p *recordingPoster) PostText(_ context.Context, message string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *recordingPoster) posted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.messages...)
+}
+
+// seeded describes an alert seeded age days ago
+type seeded struct {
+	id, status, severity string
+	days                 int
+	notifications        int
+	expired              bool
+}
+
+// seed are alerts spanning the cutoffs of testConfig: a year by default,
+// two for critical alerts, never for low ones
+var seed = []seeded{
+	{"resolved-old", models.StatusResolved, models.SeverityHigh, 400, 2, true},
+	{"resolved-recent", models.StatusResolved, models.SeverityHigh, 300, 1, false},
+	{"false-positive-old", models.StatusFalsePositive, models.SeverityMedium, 366, 0, true},
+	{"closed-old", models.StatusClosed, models.SeverityMedium, 500, 1, true},
+	{"critical-within", models.StatusResolved, models.SeverityCritical, 400, 1, false},
+	{"critical-old", models.StatusResolved, models.SeverityCritical, 800, 0, true},
+	{"low-kept", models.StatusClosed, models.SeverityLow, 1000, 0, false},
+	{"open-stale", models.StatusOpen, models.SeverityHigh, 1000, 1, false},
+	{"investigating-stale", models.StatusInvestigating, models.SeverityMedium, 45, 0, false},
+	{"open-fresh", models.StatusOpen, models.SeverityMedium, 10, 0, false},
+}
+
+// seedAlerts stores the seed alerts as of now, with their notifications
+func seedAlerts(t *testing.T, s *storage.Storage, now time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for _, a := range seed {
+		at := now.AddDate(0, 0, -a.days)
+		alert := &models.Alert{
+			ID:            a.id,
+			TransactionID: "txn-" + a.id,
+			AccountID:     "acct-1",
+			UserID:        "user-1",
+			AlertType:     models.AlertTypeFraud,
+			Severity:      a.severity,
+			RiskScore:     0.9,
+			Amount:        250,
+			Currency:      "USD",
+			RuleTriggered: "high_amount",
+			Status:        a.status,
+			CreatedAt:     at,
+			UpdatedAt:     at,
+		}
+		if inserted, err := s.InsertAlert(ctx, alert); err != nil || !inserted {
+			t.Fatalf("InsertAlert(%s) = %v, %v", a.id, inserted, err)
+		}
+		for i := 0; i < a.notifications; i++ {
+			n := &models.Notification{
+				ID:      fmt.Sprintf("n-%s-%d", a.id, i),
+				AlertID: a.id,
+				Channel: models.ChannelSlack,
+				Status:  models.NotificationStatusSent,
+				SentAt:  at,
+			}
+			if err := s.InsertNotification(ctx, n); err != nil {
+				t.Fatalf("InsertNotification(%s): %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// testConfig keeps resolved alerts a year, critical ones two, low ones
+// forever, purging two at a time
+func testConfig(dir string) Config {
+	return Config{
+		MaxAge: 365 * 24 * time.Hour,
+		MaxAgeBySeverity: map[string]time.Duration{
+			models.SeverityCritical: 730 * 24 * time.Hour,
+			models.SeverityLow:      0,
+		},
+		BatchSize:    2,
+		ArchiveDir:   dir,
+		StaleOpenAge: 30 * 24 * time.Hour,
+	}
+}
+
+// archivedIDs returns the IDs of the alerts archived in dir, sorted, and
+// their number of notifications
+func archivedIDs(t *testing.T, dir string) ([]string, int) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "alerts-*.ndjson"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	var ids []string
+	notifications := 0
+	for _, path := range paths {
+		for _, a := range readArchive(t, path) {
+			ids = append(ids, a.Alert.ID)
+			notifications += len(a.Notifications)
+		}
+	}
+	sort.Strings(ids)
+	return ids, notifications
+}
+
+func TestRetentionPurgesResolvedAlertsPastTheirCutoff(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now()
+	seedAlerts(t, s, now)
+	dir := t.TempDir()
+
+	New(s, nil, testConfig(dir)).RunOnce(ctx, now)
+
+	var wantIDs []string
+	wantNotifications := 0
+	for _, a := range seed {
+		_, err := s.GetAlert(ctx, a.id)
+		switch {
+		case a.expired && !errors.Is(err, storage.ErrAlertNotFound):
+			t.Errorf("expired alert %s: GetAlert = %v, want it deleted", a.id, err)
+		case !a.expired && err != nil:
+			t.Errorf("alert %s: GetAlert = %v, want it kept", a.id, err)
+		}
+		notifications, err := s.ListNotifications(ctx, a.id)
+		if err != nil {
+			t.Fatalf("ListNotifications(%s): %v", a.id, err)
+		}
+		if a.expired {
+			wantIDs = append(wantIDs, a.id)
+			wantNotifications += a.notifications
+			if len(notifications) != 0 {
+				t.Errorf("expired alert %s left %d notifications", a.id, len(notifications))
+			}
+		} else if len(notifications) != a.notifications {
+			t.Errorf("alert %s has %d notifications, want %d", a.id, len(notifications), a.notifications)
+		}
+	}
+
+	// Every deleted alert was archived first, with its notifications, in
+	// one file for the run
+	sort.Strings(wantIDs)
+	ids, notifications := archivedIDs(t, dir)
+	if strings.Join(ids, " ") != strings.Join(wantIDs, " ") || notifications != wantNotifications {
+		t.Errorf("archived %v with %d notifications, want %v with %d", ids, notifications, wantIDs, wantNotifications)
+	}
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*")); len(paths) != 1 {
+		t.Errorf("archive files %v, want one", paths)
+	}
+
+	// A second run finds nothing more to purge
+	New(s, nil, testConfig(dir)).RunOnce(ctx, now.Add(time.Second))
+	if ids, _ := archivedIDs(t, dir); len(ids) != len(wantIDs) {
+		t.Errorf("archived %v after the second run, want nothing more", ids)
+	}
+}
+
+func TestRetentionDryRunDeletesNothing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now()
+	seedAlerts(t, s, now)
+	dir := t.TempDir()
+
+	cfg := testConfig(dir)
+	cfg.DryRun = true
+	j := New(s, nil, cfg)
+	j.RunOnce(ctx, now)
+
+	for _, a := range seed {
+		if _, err := s.GetAlert(ctx, a.id); err != nil {
+			t.Errorf("alert %s: GetAlert = %v, want it kept by the dry run", a.id, err)
+		}
+	}
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*")); len(paths) != 0 {
+		t.Errorf("dry run archived to %v", paths)
+	}
+
+	count, err := s.CountExpiredAlerts(ctx, j.cutoffs(now))
+	if err != nil {
+		t.Fatalf("CountExpiredAlerts: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("%d expired alerts counted, want 4", count)
+	}
+}
+
+func TestStaleOpenAlertDigestIsPostedOnceAWeek(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now()
+	seedAlerts(t, s, now)
+	poster := &recordingPoster{}
+
+	// Two replicas run in the same week
+	New(s, poster, testConfig(t.TempDir())).RunOnce(ctx, now)
+	New(s, poster, testConfig(t.TempDir())).RunOnce(ctx, now.Add(time.Hour))
+
+	posted := poster.posted()
+	if len(posted) != 1 {
+		t.Fatalf("%d digests posted, want 1", len(posted))
+	}
+	if !strings.Contains(posted[0], "2 alerts have been open for over 30 days") {
+		t.Errorf("digest %q, want the open and investigating alerts over 30 days old", posted[0])
+	}
+
+	// The next week's is posted again
+	New(s, poster, testConfig(t.TempDir())).RunOnce(ctx, now.AddDate(0, 0, 7))
+	if n := len(poster.posted()); n != 2 {
+		t.Errorf("%d digests posted after a week, want 2", n)
+	}
+}
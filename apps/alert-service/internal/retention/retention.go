@@ -0,0 +1,242 @@
+// Package retention archives and deletes resolved alerts once they are past
+// their retention, and reports open alerts left unresolved for too long.
+package retention
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+	"alert-service/internal/notifier"
+	"alert-service/internal/storage"
+)
+
+// staleDigestLimit caps the alerts summarized in a stale open alert digest
+const staleDigestLimit = 10000
+
+// Poster posts a plain text message, e.g. to Slack
+type Poster interface {
+	PostText(ctx context.Context, message string) error
+}
+
+// Config configures a Job
+type Config struct {
+	// MaxAge is how long after their resolution alerts are kept, and
+	// MaxAgeBySeverity overrides it for the severities it lists. Zero keeps
+	// the alerts.
+	MaxAge           time.Duration
+	MaxAgeBySeverity map[string]time.Duration
+	// BatchSize is how many alerts are archived and deleted at a time
+	BatchSize int
+	// ArchiveDir receives an NDJSON archive of the alerts each run deletes
+	ArchiveDir string
+	// DryRun counts the expired alerts instead of deleting them
+	DryRun bool
+	// StaleOpenAge is the age over which open alerts are posted in the
+	// weekly digest, zero disabling it
+	StaleOpenAge time.Duration
+}
+
+// Job enforces the alert retention. Resolved alerts past their retention
+// are archived and deleted with their notifications, a batch at a time so
+// no transaction holds many rows. Open alerts are never deleted; once a
+// week those open for too long are posted in a digest, claimed in the
+// database so only one replica posts it.
+type Job struct {
+	store    *storage.Storage
+	poster   Poster
+	cfg      Config
+	hostname string
+}
+
+// New creates a retention job. poster may be nil.
+func New(store *storage.Storage, poster Poster, cfg Config) *Job {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &Job{store: store, poster: poster, cfg: cfg, hostname: hostname}
+}
+
+// Run enforces the retention on every tick until ctx is cancelled
+func (j *Job) Run(ctx context.Context, ticks <-chan time.Time) {
+	j.RunOnce(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticks:
+			j.RunOnce(ctx, t)
+		}
+	}
+}
+
+// RunOnce purges the alerts expired at now and sends the stale open alert
+// digest if this week's is due
+func (j *Job) RunOnce(ctx context.Context, now time.Time) {
+	if err := j.purge(ctx, now); err != nil && ctx.Err() == nil {
+		log.Printf("retention: %v", err)
+	}
+	if err := j.digest(ctx, now); err != nil && ctx.Err() == nil {
+		log.Printf("retention: %v", err)
+	}
+}
+
+// cutoffs returns the times before which resolved alerts expire at now
+func (j *Job) cutoffs(now time.Time) storage.RetentionCutoffs {
+	cutoff := func(maxAge time.Duration) time.Time {
+		if maxAge <= 0 {
+			return time.Time{}
+		}
+		return now.Add(-maxAge)
+	}
+
+	cutoffs := storage.RetentionCutoffs{
+		Default:    cutoff(j.cfg.MaxAge),
+		BySeverity: make(map[string]time.Time, len(j.cfg.MaxAgeBySeverity)),
+	}
+	for severity, maxAge := range j.cfg.MaxAgeBySeverity {
+		cutoffs.BySeverity[severity] = cutoff(maxAge)
+	}
+	return cutoffs
+}
+
+// purge archives and deletes the alerts expired at now, batch by batch,
+// into one archive file
+func (j *Job) purge(ctx context.Context, now time.Time) error {
+	cutoffs := j.cutoffs(now)
+
+	if j.cfg.DryRun {
+		count, err := j.store.CountExpiredAlerts(ctx, cutoffs)
+		if err != nil {
+			return err
+		}
+		metrics.SetRetentionExpired(count)
+		log.Printf("retention dry run: %d resolved alerts are past their retention and would be archived and deleted", count)
+		return nil
+	}
+
+	archive := &archiveFile{path: filepath.Join(j.cfg.ArchiveDir,
+		fmt.Sprintf("alerts-%s-%s.ndjson", now.UTC().Format("20060102T150405Z"), j.hostname))}
+	defer archive.Close()
+
+	var alerts, notifications int
+	defer func() {
+		if alerts > 0 {
+			log.Printf("retention: archived %d alerts and %d notifications to %s and deleted them", alerts, notifications, archive.path)
+		}
+	}()
+	for ctx.Err() == nil {
+		n, m, err := j.store.PurgeExpiredAlerts(ctx, cutoffs, j.cfg.BatchSize, archive.Write)
+		if err != nil {
+			return err
+		}
+		alerts += n
+		notifications += m
+		metrics.RecordRetentionPurge(n, m)
+		if n < j.cfg.BatchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// digest posts the open alerts older than StaleOpenAge once a week, on the
+// first run of the week on any replica
+func (j *Job) digest(ctx context.Context, now time.Time) error {
+	if j.cfg.StaleOpenAge <= 0 {
+		return nil
+	}
+
+	filter := storage.AlertFilter{OpenOnly: true, To: now.Add(-j.cfg.StaleOpenAge)}
+	summary, err := j.store.GetAlertSummary(ctx, filter)
+	if err != nil {
+		return err
+	}
+	metrics.SetStaleOpenAlerts(summary.TotalAlerts)
+	if summary.TotalAlerts == 0 {
+		return nil
+	}
+
+	claimed, err := j.store.ClaimStaleAlertDigest(ctx, weekStart(now))
+	if err != nil || !claimed {
+		return err
+	}
+
+	filter.Limit = staleDigestLimit
+	alerts, err := j.store.ListAlerts(ctx, filter)
+	if err != nil {
+		return err
+	}
+	log.Printf("retention: %d alerts have been open for over %s", summary.TotalAlerts, j.cfg.StaleOpenAge)
+	if j.poster == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("🕰️ *Stale open alerts:* %d alerts have been open for over %d days\n%s",
+		summary.TotalAlerts, int(j.cfg.StaleOpenAge.Hours()/24),
+		notifier.FormatDigest(notifier.Summarize(alerts)))
+	if err := j.poster.PostText(ctx, message); err != nil {
+		return fmt.Errorf("failed to post stale open alert digest: %w", err)
+	}
+	return nil
+}
+
+// weekStart returns the Monday, in UTC, of the week of t
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// archiveFile appends archived alerts to an NDJSON file, created on the
+// first write
+type archiveFile struct {
+	path string
+	file *os.File
+}
+
+// Write appends alerts, one per line, and syncs them to disk before
+// returning, so they are archived before they are deleted
+func (a *archiveFile) Write(alerts []models.ArchivedAlert) error {
+	if a.file == nil {
+		if err := os.MkdirAll(filepath.Dir(a.path), 0o750); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+		file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		a.file = file
+	}
+
+	buf := bufio.NewWriter(a.file)
+	enc := json.NewEncoder(buf)
+	for i := range alerts {
+		if err := enc.Encode(&alerts[i]); err != nil {
+			return fmt.Errorf("failed to encode archived alert: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	return nil
+}
+
+// Close closes the archive file, if it was created
+func (a *archiveFile) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,133 @@
+package retention
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+func TestWeekStart(t *testing.T) {
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at   time.Time
+		want time.Time
+	}{
+		{monday, monday},
+		{time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC), monday},
+		{time.Date(2026, 3, 8, 23, 59, 59, 0, time.UTC), monday},
+		{time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), monday.AddDate(0, 0, 7)},
+		// Early on Monday east of UTC is still Sunday in UTC
+		{time.Date(2026, 3, 2, 0, 30, 0, 0, time.FixedZone("CET", 3600)), monday.AddDate(0, 0, -7)},
+	}
+	for _, tt := range tests {
+		if got := weekStart(tt.at); !got.Equal(tt.want) {
+			t.Errorf("weekStart(%s) = %s, want %s", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCutoffs(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	j := &Job{cfg: Config{
+		MaxAge: 365 * 24 * time.Hour,
+		MaxAgeBySeverity: map[string]time.Duration{
+			models.SeverityCritical: 730 * 24 * time.Hour,
+			models.SeverityLow:      0,
+		},
+	}}
+
+	cutoffs := j.cutoffs(now)
+	if want := now.AddDate(0, 0, -365); !cutoffs.Default.Equal(want) {
+		t.Errorf("default cutoff %s, want %s", cutoffs.Default, want)
+	}
+	if want := now.AddDate(0, 0, -730); !cutoffs.BySeverity[models.SeverityCritical].Equal(want) {
+		t.Errorf("critical cutoff %s, want %s", cutoffs.BySeverity[models.SeverityCritical], want)
+	}
+	// A retention of zero keeps the severity's alerts
+	if cutoff, ok := cutoffs.BySeverity[models.SeverityLow]; !ok || !cutoff.IsZero() {
+		t.Errorf("low cutoff %s, listed %v, want a zero cutoff listed", cutoff, ok)
+	}
+
+	if cutoffs := (&Job{}).cutoffs(now); !cutoffs.Default.IsZero() || len(cutoffs.BySeverity) != 0 {
+		t.Errorf("cutoffs without retention = %+v, want every alert kept", cutoffs)
+	}
+}
+
+// readArchive returns the alerts archived at path
+func readArchive(t *testing.T, path string) []models.ArchivedAlert {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	var archived []models.ArchivedAlert
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var a models.ArchivedAlert
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			t.Fatalf("archive line %q is not an archived alert: %v", scanner.Text(), err)
+		}
+		archived = append(archived, a)
+	}
+	return archived
+}
+
+func TestArchiveFileAppendsOneAlertPerLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive", "alerts.ndjson")
+	archive := &archiveFile{path: path}
+	defer archive.Close()
+
+	// Nothing is created before the first batch
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close before writing: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("archive created before any write: %v", err)
+	}
+
+	batch := func(ids ...string) []models.ArchivedAlert {
+		var alerts []models.ArchivedAlert
+		for _, id := range ids {
+			alerts = append(alerts, models.ArchivedAlert{
+				Alert:         &models.Alert{ID: id, Status: models.StatusResolved},
+				Notifications: []*models.Notification{{ID: "n-" + id, AlertID: id}},
+			})
+		}
+		return alerts
+	}
+	if err := archive.Write(batch("a1", "a2")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := archive.Write(batch("a3")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	archived := readArchive(t, path)
+	if len(archived) != 3 {
+		t.Fatalf("%d alerts archived, want 3", len(archived))
+	}
+	for i, id := range []string{"a1", "a2", "a3"} {
+		if archived[i].Alert.ID != id || len(archived[i].Notifications) != 1 || archived[i].Notifications[0].ID != "n-"+id {
+			t.Errorf("line %d = %+v, want %s with its notification", i, archived[i], id)
+		}
+	}
+}
+
+func TestArchiveFileFailures(t *testing.T) {
+	// A directory cannot be created under a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	archive := &archiveFile{path: filepath.Join(file, "alerts.ndjson")}
+	if err := archive.Write([]models.ArchivedAlert{{Alert: &models.Alert{ID: "a1"}}}); err == nil {
+		t.Error("Write succeeded without an archive directory")
+	}
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"alert-service/internal/metrics"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/segmentio/kafka-go"
+)
+
+// Quarantine holds messages of unknown schema versions on a Kafka topic,
+// unchanged, so they can be replayed once the service understands them
+type Quarantine struct {
+	writer *kafka.Writer
+}
+
+// NewQuarantine creates a quarantine on topic
+func NewQuarantine(brokers, topic string, conn *kafkaconn.Connection) *Quarantine {
+	parts := strings.Split(brokers, ",")
+	addrs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if s := strings.TrimSpace(p); s != "" {
+			addrs = append(addrs, s)
+		}
+	}
+
+	return &Quarantine{
+		// Synchronous: the source offset is committed once Hold returns
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(addrs...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    conn.Transport,
+		},
+	}
+}
+
+// Hold publishes a message to the quarantine topic with its key and
+// headers, adding the reason it was quarantined
+func (q *Quarantine) Hold(ctx context.Context, m kafka.Message, reason error) error {
+	headers := append(append([]kafka.Header(nil), m.Headers...),
+		kafka.Header{Key: "quarantine_reason", Value: []byte(reason.Error())},
+		kafka.Header{Key: "source_topic", Value: []byte(m.Topic)},
+	)
+
+	err := q.writer.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
+	}
+
+	version := headerValue(m.Headers, VersionHeader)
+	if _, err := strconv.Atoi(version); err != nil {
+		// Keep garbage out of the metric labels
+		version = "invalid"
+	}
+	metrics.RecordQuarantined(version)
+	return nil
+}
+
+// Close shuts down the quarantine writer
+func (q *Quarantine) Close() error {
+	return q.writer.Close()
+}
+
+func headerValue(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+// Package schema decodes messages from the alert input topic. Producers
+// stamp each message with a schema_version header; messages without one
+// predate versioning and carry a processed transaction.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"alert-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// VersionHeader is the Kafka header carrying the schema version
+const VersionHeader = "schema_version"
+
+// Schema versions
+const (
+	VersionTransaction = 0 // a models.ProcessedTransaction to evaluate
+	VersionAlert       = 1 // a pre-built models.Alert to dispatch
+)
+
+// ErrUnknownVersion is returned for messages of a version this service
+// cannot decode; they belong in quarantine, not the bin
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// ErrMalformed is returned for messages that cannot be decoded as their
+// version; retrying cannot fix them
+var ErrMalformed = errors.New("malformed message")
+
+// Message is a decoded message. Exactly one of Transaction and Alert is set.
+type Message struct {
+	Version     int
+	Transaction *models.ProcessedTransaction
+	Alert       *models.Alert
+}
+
+// Version returns the schema version of a message, 0 when it has no
+// version header
+func Version(headers []kafka.Header) (int, error) {
+	for _, h := range headers {
+		if h.Key != VersionHeader {
+			continue
+		}
+		v, err := strconv.Atoi(string(h.Value))
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, h.Value)
+		}
+		return v, nil
+	}
+	return VersionTransaction, nil
+}
+
+// Decode decodes a message by its schema version
+func Decode(headers []kafka.Header, payload []byte) (*Message, error) {
+	version, err := Version(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Version: version}
+	switch version {
+	case VersionTransaction:
+		var txn models.ProcessedTransaction
+		if err := json.Unmarshal(payload, &txn); err != nil {
+			return nil, fmt.Errorf("%w: v%d: %v", ErrMalformed, version, err)
+		}
+		msg.Transaction = &txn
+	case VersionAlert:
+		var alert models.Alert
+		if err := json.Unmarshal(payload, &alert); err != nil {
+			return nil, fmt.Errorf("%w: v%d: %v", ErrMalformed, version, err)
+		}
+		if alert.ID == "" || alert.AccountID == "" || alert.AlertType == "" {
+			return nil, fmt.Errorf("%w: v%d: alert needs id, account_id and alert_type", ErrMalformed, version)
+		}
+		msg.Alert = &alert
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return msg, nil
+}
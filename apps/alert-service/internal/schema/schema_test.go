@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fixture returns the payload of the fixture name in testdata
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return data
+}
+
+// header returns the version header of value
+func header(value string) []kafka.Header {
+	return []kafka.Header{{Key: VersionHeader, Value: []byte(value)}}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		want    int
+		wantErr bool
+	}{
+		{"no headers", nil, VersionTransaction, false},
+		{"other headers only", []kafka.Header{{Key: "traceparent", Value: []byte("00-abc")}}, VersionTransaction, false},
+		{"transaction", header("0"), VersionTransaction, false},
+		{"alert", header("1"), VersionAlert, false},
+		{"future version", header("7"), 7, false},
+		{"negative", header("-1"), 0, true},
+		{"not a number", header("v1"), 0, true},
+		{"empty", header(""), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Version(tt.headers)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownVersion) {
+					t.Errorf("Version = %d, %v, want ErrUnknownVersion", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Version = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTransactionFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		headers []kafka.Header
+		wantID  string
+		score   float64
+	}{
+		{"unversioned", "v0_transaction.json", nil, "txn-v0", 0.92},
+		{"explicit v0", "v0_transaction.json", header("0"), "txn-v0", 0.92},
+		// Transactions produced before ingested_at and the currency
+		// exponent were introduced still decode
+		{"legacy unversioned", "v0_transaction_legacy.json", nil, "txn-legacy", 0.12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.headers, fixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if msg.Version != VersionTransaction || msg.Alert != nil || msg.Transaction == nil {
+				t.Fatalf("message = %+v, want a v0 transaction", msg)
+			}
+			txn := msg.Transaction
+			if txn.ID != tt.wantID || txn.RiskScore != tt.score || txn.Currency != "USD" || txn.ProcessedAt.IsZero() {
+				t.Errorf("transaction = %+v, want %s scored %v", txn, tt.wantID, tt.score)
+			}
+		})
+	}
+
+	msg, err := Decode(nil, fixture(t, "v0_transaction.json"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	txn := msg.Transaction
+	if txn.ProcessingTime != 1500*time.Microsecond || txn.CurrencyExponent != 2 || txn.RiskLevel != models.RiskLevelCritical ||
+		!txn.IngestedAt.Equal(time.Date(2026, 3, 2, 9, 29, 59, 0, time.UTC)) {
+		t.Errorf("transaction = %+v, want every field of the fixture", txn)
+	}
+}
+
+func TestDecodeAlertFixture(t *testing.T) {
+	msg, err := Decode(header("1"), fixture(t, "v1_alert.json"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if msg.Version != VersionAlert || msg.Transaction != nil || msg.Alert == nil {
+		t.Fatalf("message = %+v, want a v1 alert", msg)
+	}
+	alert := msg.Alert
+	if alert.ID != "alert-v1" || alert.AccountID != "acct-v1" || alert.AlertType != models.AlertTypeFraud ||
+		alert.Severity != models.SeverityHigh || alert.Amount != 9800 || alert.Currency != "EUR" ||
+		alert.RuleTriggered != "card_testing" || alert.Metadata["producer"] != "processing-service" {
+		t.Errorf("alert = %+v, want every field of the fixture", alert)
+	}
+
+	// Without its header the alert is read as a transaction, which is why
+	// producers must stamp the version
+	msg, err = Decode(nil, fixture(t, "v1_alert.json"))
+	if err != nil || msg.Transaction == nil || msg.Transaction.ID != "alert-v1" {
+		t.Errorf("unversioned alert = %+v, %v, want it decoded as a transaction", msg, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		payload string
+		want    error
+	}{
+		{"transaction not JSON", nil, "{not json", ErrMalformed},
+		{"transaction of the wrong types", header("0"), `{"amount": "lots"}`, ErrMalformed},
+		{"alert not JSON", header("1"), "{not json", ErrMalformed},
+		{"alert without an account", header("1"), `{"id": "a-1", "alert_type": "fraud"}`, ErrMalformed},
+		{"alert without a type", header("1"), `{"id": "a-1", "account_id": "acct-1"}`, ErrMalformed},
+		{"alert without an ID", header("1"), `{"account_id": "acct-1", "alert_type": "fraud"}`, ErrMalformed},
+		{"future version", header("2"), `{"id": "a-1"}`, ErrUnknownVersion},
+		{"invalid version", header("latest"), `{"id": "a-1"}`, ErrUnknownVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.headers, []byte(tt.payload))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode = %+v, %v, want %v", msg, err, tt.want)
+			}
+			if errors.Is(err, ErrMalformed) && errors.Is(err, ErrUnknownVersion) {
+				t.Errorf("error %v is both malformed and of an unknown version", err)
+			}
+		})
+	}
+}
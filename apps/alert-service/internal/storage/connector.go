@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/lib/pq"
+)
+
+// dsnConnector opens every connection with the current DSN, so a rotated
+// database password applies to new connections without replacing the pool
+type dsnConnector struct {
+	dsn atomic.Pointer[string]
+}
+
+// newDSNConnector creates a connector, checking the DSN parses
+func newDSNConnector(dsn string) (*dsnConnector, error) {
+	if _, err := pq.NewConnector(dsn); err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	c := &dsnConnector{}
+	c.dsn.Store(&dsn)
+	return c, nil
+}
+
+// Connect opens a connection with the current DSN
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := pq.NewConnector(*c.dsn.Load())
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver returns the PostgreSQL driver
+func (c *dsnConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// PingDatabase opens a connection to the database at dbURL and closes it, to
+// wait for the database to accept connections before NewStorage
+func PingDatabase(ctx context.Context, dbURL string) error {
+	connector, err := pq.NewConnector(dbURL)
+	if err != nil {
+		return fmt.Errorf("invalid database URL: %w", err)
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return conn.Close()
+}
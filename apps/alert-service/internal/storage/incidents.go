@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// incidentColumns is the column list read by scanIncident
+const incidentColumns = `id, tenant_id, correlation_key, account_id, COALESCE(rule_triggered, ''),
+	status, alert_count, max_severity, total_amount, first_seen, last_seen, resolved_at,
+	created_at, updated_at`
+
+func scanIncident(row rowScanner) (*models.Incident, error) {
+	var i models.Incident
+	var resolvedAt sql.NullTime
+	err := row.Scan(&i.ID, &i.TenantID, &i.CorrelationKey, &i.AccountID, &i.RuleTriggered,
+		&i.Status, &i.AlertCount, &i.MaxSeverity, &i.TotalAmount, &i.FirstSeen, &i.LastSeen, &resolvedAt,
+		&i.CreatedAt, &i.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		i.ResolvedAt = &resolvedAt.Time
+	}
+	return &i, nil
+}
+
+// IncidentAttachment is the incident an alert was attached to. Opened
+// reports the alert opened it; Escalated that the alert raised its
+// severity.
+type IncidentAttachment struct {
+	Incident  *models.Incident
+	Opened    bool
+	Escalated bool
+}
+
+// AttachToIncident attaches an alert to the open incident of opened's
+// correlation key last seen within window of the alert, updating its
+// aggregates, or else opens opened with the alert as its first. Alerts of
+// the same key are attached one at a time, so concurrent alerts cannot
+// open two incidents.
+func (s *Storage) AttachToIncident(ctx context.Context, alert *models.Alert, opened *models.Incident, window time.Duration) (*IncidentAttachment, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin incident attachment: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	if _, err := dbTx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, opened.CorrelationKey); err != nil {
+		return nil, fmt.Errorf("failed to lock incident key: %w", err)
+	}
+
+	now := time.Now()
+	incident, err := scanIncident(dbTx.QueryRowContext(ctx, `SELECT `+incidentColumns+`
+		FROM incidents
+		WHERE correlation_key = $1 AND status = $2 AND last_seen >= $3
+		ORDER BY last_seen DESC
+		LIMIT 1
+	`, opened.CorrelationKey, models.IncidentStatusOpen, alert.CreatedAt.Add(-window)))
+
+	attachment := &IncidentAttachment{}
+	switch {
+	case err == sql.ErrNoRows:
+		incident = opened
+		incident.Status = models.IncidentStatusOpen
+		incident.CreatedAt, incident.UpdatedAt = now, now
+		incident.Add(alert)
+		attachment.Opened = true
+
+		_, err = dbTx.ExecContext(ctx, `
+			INSERT INTO incidents (
+				id, tenant_id, correlation_key, account_id, rule_triggered, status, alert_count,
+				max_severity, total_amount, first_seen, last_seen, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13)
+		`, incident.ID, incident.TenantID, incident.CorrelationKey, incident.AccountID, incident.RuleTriggered,
+			incident.Status, incident.AlertCount, incident.MaxSeverity, incident.TotalAmount,
+			incident.FirstSeen, incident.LastSeen, incident.CreatedAt, incident.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open incident: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to find open incident: %w", err)
+	default:
+		severity := incident.MaxSeverity
+		incident.Add(alert)
+		incident.UpdatedAt = now
+		attachment.Escalated = incident.MaxSeverity != severity
+
+		_, err = dbTx.ExecContext(ctx, `
+			UPDATE incidents SET
+				alert_count = $2,
+				max_severity = $3,
+				total_amount = $4,
+				first_seen = $5,
+				last_seen = $6,
+				updated_at = $7
+			WHERE id = $1
+		`, incident.ID, incident.AlertCount, incident.MaxSeverity, incident.TotalAmount,
+			incident.FirstSeen, incident.LastSeen, incident.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update incident: %w", err)
+		}
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `UPDATE alerts SET incident_id = $1 WHERE id = $2`, incident.ID, alert.ID); err != nil {
+		return nil, fmt.Errorf("failed to attach alert to incident: %w", err)
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit incident attachment: %w", err)
+	}
+
+	alert.IncidentID = incident.ID
+	attachment.Incident = incident
+	return attachment, nil
+}
+
+// ResolveIncidentIfSettled resolves an open incident once none of its
+// alerts is left unresolved, reporting whether it did
+func (s *Storage) ResolveIncidentIfSettled(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE incidents SET status = $2, resolved_at = $3, updated_at = $3
+		WHERE id = $1 AND status = $4 AND NOT EXISTS (
+			SELECT 1 FROM alerts
+			WHERE incident_id = $1 AND status NOT IN ('resolved', 'false_positive', 'closed')
+		)
+	`, id, models.IncidentStatusResolved, now, models.IncidentStatusOpen)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve incident: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve incident: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListIncidentThreads returns the Slack messages sent for the alerts of an
+// incident, oldest first. Replies are recorded with the ts of the message
+// they reply to, so a thread may be returned more than once.
+func (s *Storage) ListIncidentThreads(ctx context.Context, incidentID string) ([]*models.Notification, error) {
+	query := `SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE alert_id IN (SELECT id FROM alerts WHERE incident_id = $1)
+			AND channel = $2 AND status = $3 AND external_id IS NOT NULL
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, incidentID, models.ChannelSlack, models.NotificationStatusSent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incident threads: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list incident threads: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// IncidentFilter narrows an incident listing
+type IncidentFilter struct {
+	Status    string
+	AccountID string
+	// Severity restricts the listing to incidents of that maximum severity
+	Severity string
+	// From and To bound when incidents were first seen
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+	// TenantID, when set, restricts the listing to one tenant
+	TenantID *string
+}
+
+// where builds the WHERE clause and arguments for a filter
+func (f IncidentFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.AccountID != "" {
+		add("account_id = $%d", f.AccountID)
+	}
+	if f.Severity != "" {
+		add("max_severity = $%d", f.Severity)
+	}
+	if f.TenantID != nil {
+		add("tenant_id = $%d", *f.TenantID)
+	}
+	if !f.From.IsZero() {
+		add("first_seen >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("first_seen < $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListIncidents returns incidents matching the filter, most recently seen
+// first
+func (s *Storage) ListIncidents(ctx context.Context, filter IncidentFilter) ([]*models.Incident, error) {
+	where, args := filter.where()
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := `SELECT ` + incidentColumns + ` FROM incidents` + where +
+		fmt.Sprintf(` ORDER BY last_seen DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := []*models.Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		incidents = append(incidents, incident)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list incidents: %w", err)
+	}
+
+	return incidents, nil
+}
@@ -0,0 +1,283 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// incidentWindow is the correlation window of the incident tests
+const incidentWindow = 10 * time.Minute
+
+// attach records alert and attaches it to the incident of its account,
+// failing the test on an error
+func attach(t *testing.T, s *Storage, alert *models.Alert) *IncidentAttachment {
+	t.Helper()
+	insertAlerts(t, s, alert)
+	opened := &models.Incident{
+		ID:             "inc-" + alert.ID,
+		TenantID:       alert.TenantID,
+		CorrelationKey: alert.TenantID + "/account:" + alert.AccountID,
+		AccountID:      alert.AccountID,
+	}
+	attachment, err := s.AttachToIncident(context.Background(), alert, opened, incidentWindow)
+	if err != nil {
+		t.Fatalf("AttachToIncident(%s): %v", alert.ID, err)
+	}
+	return attachment
+}
+
+// resolve moves an alert through investigation to resolved
+func resolve(t *testing.T, s *Storage, id string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.UpdateAlertStatus(ctx, id, models.StatusOpen, models.StatusInvestigating, "analyst-1", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus(%s): %v", id, err)
+	}
+	if _, err := s.UpdateAlertStatus(ctx, id, models.StatusInvestigating, models.StatusResolved, "analyst-1", "confirmed"); err != nil {
+		t.Fatalf("UpdateAlertStatus(%s): %v", id, err)
+	}
+}
+
+// incident returns the stored incident of id
+func incident(t *testing.T, s *Storage, id string) *models.Incident {
+	t.Helper()
+	incidents, err := s.ListIncidents(context.Background(), IncidentFilter{})
+	if err != nil {
+		t.Fatalf("ListIncidents: %v", err)
+	}
+	for _, i := range incidents {
+		if i.ID == id {
+			return i
+		}
+	}
+	t.Fatalf("incident %s not stored", id)
+	return nil
+}
+
+func TestAlertsAreGroupedIntoIncidents(t *testing.T) {
+	s := newTestStorage(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	first := testAlert("a1", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start)
+	first.Amount = 1200.10
+	second := testAlert("a2", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.8, start.Add(4*time.Minute))
+	second.Amount = 300.20
+	// Twelve minutes after the first, but within the window of the last
+	third := testAlert("a3", "acct-1", models.SeverityLow, models.AlertTypeFraud, 0.3, start.Add(12*time.Minute))
+	third.Amount = 99.70
+
+	tests := []struct {
+		alert     *models.Alert
+		opened    bool
+		escalated bool
+	}{
+		{first, true, false},
+		{second, false, true},
+		{third, false, false},
+	}
+	for _, tt := range tests {
+		got := attach(t, s, tt.alert)
+		if got.Incident.ID != "inc-a1" || got.Opened != tt.opened || got.Escalated != tt.escalated {
+			t.Errorf("%s: attached to %s, opened %v, escalated %v, want inc-a1, %v, %v",
+				tt.alert.ID, got.Incident.ID, got.Opened, got.Escalated, tt.opened, tt.escalated)
+		}
+	}
+	other := attach(t, s, testAlert("a4", "acct-2", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(5*time.Minute)))
+	if !other.Opened || other.Incident.ID != "inc-a4" {
+		t.Errorf("alert of another account attached to %s, want an incident of its own", other.Incident.ID)
+	}
+
+	got := incident(t, s, "inc-a1")
+	if got.AlertCount != 3 || got.MaxSeverity != models.SeverityHigh || got.TotalAmount != 1600 || got.Status != models.IncidentStatusOpen {
+		t.Errorf("incident %+v, want 3 open alerts of at most high severity totalling 1600", got)
+	}
+	if !got.FirstSeen.Equal(start) || !got.LastSeen.Equal(start.Add(12*time.Minute)) {
+		t.Errorf("incident seen %s to %s, want 9:00 to 9:12", got.FirstSeen, got.LastSeen)
+	}
+	stored, err := s.GetAlert(context.Background(), "a3")
+	if err != nil {
+		t.Fatalf("GetAlert: %v", err)
+	}
+	if stored.IncidentID != "inc-a1" {
+		t.Errorf("a3 stored in incident %q, want inc-a1", stored.IncidentID)
+	}
+}
+
+func TestWindowExpiryOpensANewIncident(t *testing.T) {
+	s := newTestStorage(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		alert  *models.Alert
+		want   string
+		opened bool
+	}{
+		{testAlert("a1", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start), "inc-a1", true},
+		{testAlert("a2", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(incidentWindow)), "inc-a1", false},
+		// More than the window after the last alert
+		{testAlert("a3", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(2*incidentWindow+time.Second)), "inc-a3", true},
+		{testAlert("a4", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(2*incidentWindow+time.Minute)), "inc-a3", false},
+	}
+	for _, tt := range tests {
+		if got := attach(t, s, tt.alert); got.Incident.ID != tt.want || got.Opened != tt.opened {
+			t.Errorf("%s attached to %s, opened %v, want %s, opened %v", tt.alert.ID, got.Incident.ID, got.Opened, tt.want, tt.opened)
+		}
+	}
+	if got := incident(t, s, "inc-a1"); got.AlertCount != 2 {
+		t.Errorf("expired incident has %d alerts, want 2", got.AlertCount)
+	}
+
+	// A resolved incident is not joined, however recent
+	resolve(t, s, "a3")
+	resolve(t, s, "a4")
+	if resolved, err := s.ResolveIncidentIfSettled(context.Background(), "inc-a3"); err != nil || !resolved {
+		t.Fatalf("ResolveIncidentIfSettled = %v, %v, want inc-a3 resolved", resolved, err)
+	}
+	if got := attach(t, s, testAlert("a5", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(2*incidentWindow+2*time.Minute))); !got.Opened {
+		t.Errorf("a5 attached to the resolved %s, want a new incident", got.Incident.ID)
+	}
+}
+
+func TestConcurrentAlertsOpenOneIncident(t *testing.T) {
+	s := newTestStorage(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	alerts := make([]*models.Alert, 5)
+	for i := range alerts {
+		alerts[i] = testAlert(fmt.Sprintf("a%d", i+1), "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(time.Duration(i)*time.Second))
+	}
+	insertAlerts(t, s, alerts...)
+
+	var wg sync.WaitGroup
+	for _, alert := range alerts {
+		wg.Add(1)
+		go func(alert *models.Alert) {
+			defer wg.Done()
+			opened := &models.Incident{ID: "inc-" + alert.ID, CorrelationKey: "/account:acct-1", AccountID: "acct-1"}
+			if _, err := s.AttachToIncident(context.Background(), alert, opened, incidentWindow); err != nil {
+				t.Errorf("AttachToIncident(%s): %v", alert.ID, err)
+			}
+		}(alert)
+	}
+	wg.Wait()
+
+	incidents, err := s.ListIncidents(context.Background(), IncidentFilter{})
+	if err != nil {
+		t.Fatalf("ListIncidents: %v", err)
+	}
+	if len(incidents) != 1 || incidents[0].AlertCount != 5 || incidents[0].TotalAmount != 62500 {
+		t.Errorf("incidents %+v, want one of the 5 alerts", incidents)
+	}
+}
+
+func TestIncidentResolvesWithItsLastAlert(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	attach(t, s, testAlert("a1", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start))
+	attach(t, s, testAlert("a2", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(time.Minute)))
+
+	resolve(t, s, "a1")
+	if resolved, err := s.ResolveIncidentIfSettled(ctx, "inc-a1"); err != nil || resolved {
+		t.Fatalf("ResolveIncidentIfSettled = %v, %v, want a2 to keep it open", resolved, err)
+	}
+
+	if _, err := s.UpdateAlertStatus(ctx, "a2", models.StatusOpen, models.StatusInvestigating, "analyst-1", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus: %v", err)
+	}
+	if _, err := s.UpdateAlertStatus(ctx, "a2", models.StatusInvestigating, models.StatusFalsePositive, "analyst-1", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus: %v", err)
+	}
+	if resolved, err := s.ResolveIncidentIfSettled(ctx, "inc-a1"); err != nil || !resolved {
+		t.Fatalf("ResolveIncidentIfSettled = %v, %v, want it resolved", resolved, err)
+	}
+	if got := incident(t, s, "inc-a1"); got.Status != models.IncidentStatusResolved || got.ResolvedAt == nil {
+		t.Errorf("incident %s, resolved at %v, want it resolved", got.Status, got.ResolvedAt)
+	}
+	if resolved, err := s.ResolveIncidentIfSettled(ctx, "inc-a1"); err != nil || resolved {
+		t.Errorf("ResolveIncidentIfSettled = %v, %v, want nothing left to resolve", resolved, err)
+	}
+}
+
+func TestListIncidentsFilters(t *testing.T) {
+	s := newTestStorage(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	attach(t, s, testAlert("a1", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.8, start))
+	attach(t, s, testAlert("a2", "acct-2", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(time.Hour)))
+	tenanted := testAlert("a3", "acct-3", models.SeverityMedium, models.AlertTypeFraud, 0.5, start.Add(2*time.Hour))
+	tenanted.TenantID = "unit-a"
+	attach(t, s, tenanted)
+	resolve(t, s, "a2")
+	if _, err := s.ResolveIncidentIfSettled(context.Background(), "inc-a2"); err != nil {
+		t.Fatalf("ResolveIncidentIfSettled: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter IncidentFilter
+		want   string
+	}{
+		{"everything, most recent first", IncidentFilter{}, "inc-a3,inc-a2,inc-a1"},
+		{"open", IncidentFilter{Status: models.IncidentStatusOpen}, "inc-a3,inc-a1"},
+		{"resolved", IncidentFilter{Status: models.IncidentStatusResolved}, "inc-a2"},
+		{"account", IncidentFilter{AccountID: "acct-1"}, "inc-a1"},
+		{"severity", IncidentFilter{Severity: models.SeverityMedium}, "inc-a3,inc-a2"},
+		{"tenant", IncidentFilter{TenantID: ptr("unit-a")}, "inc-a3"},
+		{"default tenant", IncidentFilter{TenantID: ptr("")}, "inc-a2,inc-a1"},
+		{"first seen", IncidentFilter{From: start.Add(30 * time.Minute), To: start.Add(90 * time.Minute)}, "inc-a2"},
+		{"page", IncidentFilter{Limit: 1, Offset: 1}, "inc-a2"},
+	}
+	for _, tt := range tests {
+		incidents, err := s.ListIncidents(context.Background(), tt.filter)
+		if err != nil {
+			t.Fatalf("%s: ListIncidents: %v", tt.name, err)
+		}
+		var ids []string
+		for _, i := range incidents {
+			ids = append(ids, i.ID)
+		}
+		if got := strings.Join(ids, ","); got != tt.want {
+			t.Errorf("%s: listed %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListIncidentThreads(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	attach(t, s, testAlert("a1", "acct-1", models.SeverityMedium, models.AlertTypeFraud, 0.5, start))
+	attach(t, s, testAlert("a2", "acct-2", models.SeverityMedium, models.AlertTypeFraud, 0.5, start))
+
+	for _, n := range []*models.Notification{
+		{ID: "n1", AlertID: "a1", Channel: models.ChannelSlack, Recipient: "#fraud", Status: models.NotificationStatusSent, SentAt: start, ExternalID: "1700000000.000100"},
+		{ID: "n2", AlertID: "a1", Channel: models.ChannelSlack, Recipient: "#fraud-eu", Status: models.NotificationStatusFailed, Error: "channel_not_found"},
+		{ID: "n3", AlertID: "a1", Channel: models.ChannelSlack, Recipient: "#hooks", Status: models.NotificationStatusSent, SentAt: start},
+		{ID: "n4", AlertID: "a1", Channel: models.ChannelEmail, Recipient: "fraud@example.com", Status: models.NotificationStatusSent, SentAt: start, ExternalID: "msg-1"},
+		{ID: "n5", AlertID: "a2", Channel: models.ChannelSlack, Recipient: "#fraud", Status: models.NotificationStatusSent, SentAt: start, ExternalID: "1700000000.000200"},
+	} {
+		if err := s.InsertNotification(ctx, n); err != nil {
+			t.Fatalf("InsertNotification(%s): %v", n.ID, err)
+		}
+	}
+
+	threads, err := s.ListIncidentThreads(ctx, "inc-a1")
+	if err != nil {
+		t.Fatalf("ListIncidentThreads: %v", err)
+	}
+	if len(threads) != 1 || threads[0].ID != "n1" {
+		t.Errorf("threads %+v, want only the sent Slack message with a ts", threads)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
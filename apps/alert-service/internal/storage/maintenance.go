@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// ErrWindowNotFound is returned when a maintenance window does not exist
+var ErrWindowNotFound = errors.New("maintenance window not found")
+
+const windowColumns = `id, start_at, end_at, COALESCE(reason, ''), scope,
+	COALESCE(scope_value, ''), COALESCE(created_by, ''), created_at`
+
+func scanWindow(row rowScanner) (*models.MaintenanceWindow, error) {
+	var w models.MaintenanceWindow
+	err := row.Scan(&w.ID, &w.Start, &w.End, &w.Reason, &w.Scope, &w.ScopeValue, &w.CreatedBy, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// InsertMaintenanceWindow stores a maintenance window. Inserting a window
+// whose ID already exists is a no-op, so static windows can be inserted by
+// every replica.
+func (s *Storage) InsertMaintenanceWindow(ctx context.Context, w *models.MaintenanceWindow) error {
+	query := `
+		INSERT INTO maintenance_windows (id, start_at, end_at, reason, scope, scope_value, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		w.ID, w.Start, w.End, w.Reason, w.Scope, w.ScopeValue, w.CreatedBy, w.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert maintenance window: %w", err)
+	}
+	return nil
+}
+
+// ListMaintenanceWindows returns the windows that have not ended by after,
+// soonest first. A zero after returns every window.
+func (s *Storage) ListMaintenanceWindows(ctx context.Context, after time.Time) ([]*models.MaintenanceWindow, error) {
+	query := `SELECT ` + windowColumns + ` FROM maintenance_windows`
+	var args []interface{}
+	if !after.IsZero() {
+		query += ` WHERE end_at > $1`
+		args = append(args, after)
+	}
+	query += ` ORDER BY start_at`
+
+	return s.queryWindows(ctx, query, args...)
+}
+
+// EndMaintenanceWindow ends a window at the given time, if it has not
+// already ended
+func (s *Storage) EndMaintenanceWindow(ctx context.Context, id string, at time.Time) (*models.MaintenanceWindow, error) {
+	query := `
+		UPDATE maintenance_windows SET end_at = LEAST(end_at, GREATEST(start_at, $2))
+		WHERE id = $1
+		RETURNING ` + windowColumns
+
+	w, err := scanWindow(s.db.QueryRowContext(ctx, query, id, at))
+	if err == sql.ErrNoRows {
+		return nil, ErrWindowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to end maintenance window: %w", err)
+	}
+	return w, nil
+}
+
+// ClaimEndedMaintenanceWindows returns the windows that ended by now and
+// have not been summarized, marking them summarized. Each window is claimed
+// by exactly one caller, so only one replica sends its summary.
+func (s *Storage) ClaimEndedMaintenanceWindows(ctx context.Context, now time.Time) ([]*models.MaintenanceWindow, error) {
+	query := `
+		UPDATE maintenance_windows SET summary_sent = true
+		WHERE end_at <= $1 AND NOT COALESCE(summary_sent, false)
+		RETURNING ` + windowColumns
+
+	return s.queryWindows(ctx, query, now)
+}
+
+func (s *Storage) queryWindows(ctx context.Context, query string, args ...interface{}) ([]*models.MaintenanceWindow, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	windows := []*models.MaintenanceWindow{}
+	for rows.Next() {
+		w, err := scanWindow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance window: %w", err)
+		}
+		windows = append(windows, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query maintenance windows: %w", err)
+	}
+	return windows, nil
+}
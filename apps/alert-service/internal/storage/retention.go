@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// resolvedStatuses are the statuses of alerts whose investigation ended, the
+// only ones retention deletes
+var resolvedStatuses = []string{models.StatusResolved, models.StatusFalsePositive, models.StatusClosed}
+
+// RetentionCutoffs are the times before which resolved alerts expire:
+// BySeverity for the severities it lists, Default for the others. A zero
+// time keeps the alerts it applies to.
+type RetentionCutoffs struct {
+	Default    time.Time
+	BySeverity map[string]time.Time
+}
+
+// where builds the condition matching expired alerts, reporting false when
+// every alert is kept. An alert's age counts from its resolution.
+func (c RetentionCutoffs) where() (string, []interface{}, bool) {
+	args := []interface{}{pq.Array(resolvedStatuses)}
+	add := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var terms []string
+	listed := []string{}
+	for severity, cutoff := range c.BySeverity {
+		listed = append(listed, severity)
+		if !cutoff.IsZero() {
+			terms = append(terms, fmt.Sprintf("(severity = %s AND COALESCE(resolved_at, updated_at) < %s)", add(severity), add(cutoff)))
+		}
+	}
+	if !c.Default.IsZero() {
+		terms = append(terms, fmt.Sprintf("(NOT severity = ANY(%s) AND COALESCE(resolved_at, updated_at) < %s)", add(pq.Array(listed)), add(c.Default)))
+	}
+	if len(terms) == 0 {
+		return "", nil, false
+	}
+	return " WHERE status = ANY($1) AND (" + strings.Join(terms, " OR ") + ")", args, true
+}
+
+// CountExpiredAlerts counts the resolved alerts past the cutoffs
+func (s *Storage) CountExpiredAlerts(ctx context.Context, cutoffs RetentionCutoffs) (int64, error) {
+	where, args, ok := cutoffs.where()
+	if !ok {
+		return 0, nil
+	}
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM alerts`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count expired alerts: %w", err)
+	}
+	return count, nil
+}
+
+// PurgeExpiredAlerts deletes up to limit resolved alerts past the cutoffs,
+// oldest resolved first, with their notifications. The alerts are handed to
+// archive first, and deleted only once it succeeds, in the same transaction:
+// an alert is either archived and deleted or left in place. Alerts being
+// purged by another replica are skipped. It returns the numbers of alerts
+// and notifications deleted. Incidents left without alerts are deleted with
+// them.
+func (s *Storage) PurgeExpiredAlerts(ctx context.Context, cutoffs RetentionCutoffs, limit int, archive func([]models.ArchivedAlert) error) (int, int, error) {
+	where, args, ok := cutoffs.where()
+	if !ok {
+		return 0, 0, nil
+	}
+
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin alert purge: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	args = append(args, limit)
+	query := `SELECT ` + alertColumns + ` FROM alerts` + where +
+		fmt.Sprintf(` ORDER BY COALESCE(resolved_at, updated_at) LIMIT $%d FOR UPDATE SKIP LOCKED`, len(args))
+	rows, err := dbTx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select expired alerts: %w", err)
+	}
+	var archived []models.ArchivedAlert
+	var ids []string
+	byID := make(map[string]int)
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		byID[alert.ID] = len(archived)
+		archived = append(archived, models.ArchivedAlert{Alert: alert, Notifications: []*models.Notification{}})
+		ids = append(ids, alert.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to select expired alerts: %w", err)
+	}
+	if len(archived) == 0 {
+		return 0, 0, nil
+	}
+
+	rows, err = dbTx.QueryContext(ctx, `SELECT `+notificationColumns+`
+		FROM notifications WHERE alert_id = ANY($1) ORDER BY created_at`, pq.Array(ids))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to select notifications of expired alerts: %w", err)
+	}
+	notifications := 0
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		i := byID[n.AlertID]
+		archived[i].Notifications = append(archived[i].Notifications, n)
+		notifications++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to select notifications of expired alerts: %w", err)
+	}
+
+	if err := archive(archived); err != nil {
+		return 0, 0, fmt.Errorf("failed to archive expired alerts: %w", err)
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `DELETE FROM notifications WHERE alert_id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete notifications of expired alerts: %w", err)
+	}
+	if _, err := dbTx.ExecContext(ctx, `DELETE FROM alerts WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete expired alerts: %w", err)
+	}
+	var incidentIDs []string
+	for _, a := range archived {
+		if a.Alert.IncidentID != "" {
+			incidentIDs = append(incidentIDs, a.Alert.IncidentID)
+		}
+	}
+	if len(incidentIDs) > 0 {
+		_, err := dbTx.ExecContext(ctx, `
+			DELETE FROM incidents i
+			WHERE i.id = ANY($1) AND NOT EXISTS (SELECT 1 FROM alerts WHERE incident_id = i.id)
+		`, pq.Array(incidentIDs))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete incidents of expired alerts: %w", err)
+		}
+	}
+	if err := dbTx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit alert purge: %w", err)
+	}
+	return len(archived), notifications, nil
+}
+
+// ClaimStaleAlertDigest claims the stale open alert digest of the week
+// starting at weekStart, reporting false when it was already claimed. Each
+// week is claimed by exactly one caller, so only one replica sends it.
+func (s *Storage) ClaimStaleAlertDigest(ctx context.Context, weekStart time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO stale_alert_digests (week_start) VALUES ($1)
+		ON CONFLICT (week_start) DO NOTHING
+	`, weekStart.Format(time.DateOnly))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim stale alert digest: %w", err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim stale alert digest: %w", err)
+	}
+	return claimed > 0, nil
+}
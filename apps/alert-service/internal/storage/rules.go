@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrRuleNotFound is returned when an alert rule does not exist
+var ErrRuleNotFound = errors.New("alert rule not found")
+
+// ErrRuleExists is returned when creating a rule whose ID is taken
+var ErrRuleExists = errors.New("alert rule already exists")
+
+const ruleColumns = `id, name, COALESCE(description, ''), type, conditions, actions,
+	enabled, priority, created_at, updated_at`
+
+func scanRule(row rowScanner) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	var conditions, actions []byte
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.Type, &conditions, &actions,
+		&rule.Enabled, &rule.Priority, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conditions) > 0 {
+		if err := json.Unmarshal(conditions, &rule.Conditions); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid conditions: %w", rule.ID, err)
+		}
+	}
+	if len(actions) > 0 {
+		if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid actions: %w", rule.ID, err)
+		}
+	}
+	return &rule, nil
+}
+
+// ListAlertRules returns all alert rules
+func (s *Storage) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	query := `SELECT ` + ruleColumns + ` FROM alert_rules ORDER BY priority DESC, id`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.AlertRule
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetAlertRule returns a single alert rule
+func (s *Storage) GetAlertRule(ctx context.Context, id string) (*models.AlertRule, error) {
+	query := `SELECT ` + ruleColumns + ` FROM alert_rules WHERE id = $1`
+
+	rule, err := scanRule(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// InsertAlertRule stores a new alert rule
+func (s *Storage) InsertAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	conditions, actions, err := marshalRule(rule)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO alert_rules (id, name, description, type, conditions, actions, enabled, priority, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	result, err := s.db.ExecContext(ctx, query, rule.ID, rule.Name, rule.Description, rule.Type,
+		conditions, actions, rule.Enabled, rule.Priority, rule.CreatedAt, rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert alert rule: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrRuleExists
+	}
+	return nil
+}
+
+// UpdateAlertRule replaces an alert rule, keeping its creation time
+func (s *Storage) UpdateAlertRule(ctx context.Context, rule *models.AlertRule) (*models.AlertRule, error) {
+	conditions, actions, err := marshalRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE alert_rules
+		SET name = $2, description = $3, type = $4, conditions = $5, actions = $6,
+			enabled = $7, priority = $8, updated_at = $9
+		WHERE id = $1
+		RETURNING ` + ruleColumns
+
+	updated, err := scanRule(s.db.QueryRowContext(ctx, query, rule.ID, rule.Name, rule.Description,
+		rule.Type, conditions, actions, rule.Enabled, rule.Priority, rule.UpdatedAt))
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return updated, nil
+}
+
+// SetAlertRuleEnabled enables or disables an alert rule
+func (s *Storage) SetAlertRuleEnabled(ctx context.Context, id string, enabled bool) (*models.AlertRule, error) {
+	query := `
+		UPDATE alert_rules SET enabled = $2, updated_at = $3
+		WHERE id = $1
+		RETURNING ` + ruleColumns
+
+	rule, err := scanRule(s.db.QueryRowContext(ctx, query, id, enabled, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// DeleteAlertRule deletes an alert rule
+func (s *Storage) DeleteAlertRule(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// marshalRule encodes a rule's conditions and actions for their JSONB columns
+func marshalRule(rule *models.AlertRule) (string, string, error) {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal conditions: %w", err)
+	}
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal actions: %w", err)
+	}
+	return string(conditions), string(actions), nil
+}
+
+// WatchAlertRules listens for alert rule changes until ctx is cancelled.
+// The returned channel receives a value after every change, and after the
+// listener reconnects since changes may have been missed meanwhile.
+func (s *Storage) WatchAlertRules(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case changes <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+
+	listener := pq.NewListener(s.url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("alert rules listener: %v", err)
+		}
+		if event == pq.ListenerEventReconnected {
+			signal()
+		}
+	})
+	if err := listener.Listen(models.AlertRulesChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen for alert rule changes: %w", err)
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-listener.Notify:
+				signal()
+			}
+		}
+	}()
+	return changes, nil
+}
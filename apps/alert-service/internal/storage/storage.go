@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// ErrAlertNotFound is returned when an alert does not exist
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrStatusConflict is returned when an alert is no longer in the status a
+// transition expected, because another caller changed it first
+var ErrStatusConflict = errors.New("alert status changed concurrently")
+
+// poolSize is the maximum number of open, and of idle, connections
+const poolSize = 10
+
+// Storage persists alerts, notifications and alert rules in PostgreSQL
+type Storage struct {
+	db        *sql.DB
+	connector *dsnConnector
+	url       string
+}
+
+// NewStorage connects to the database and runs the schema migrations
+func NewStorage(dbURL string) (*Storage, error) {
+	connector, err := newDSNConnector(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db := sql.OpenDB(connector)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	db.SetMaxOpenConns(poolSize)
+	db.SetMaxIdleConns(poolSize)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	storage := &Storage{db: db, connector: connector, url: dbURL}
+	if err := storage.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return storage, nil
+}
+
+// initSchema creates the necessary tables and indexes
+func (s *Storage) initSchema() error {
+	log.Println("Initializing database schema...")
+
+	for _, sql := range models.CreateTablesSQL() {
+		if _, err := s.db.Exec(sql); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	for _, sql := range models.MigrationsSQL() {
+		if _, err := s.db.Exec(sql); err != nil {
+			return fmt.Errorf("failed to migrate table: %w", err)
+		}
+	}
+
+	for _, sql := range models.CreateIndexesSQL() {
+		if _, err := s.db.Exec(sql); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	log.Println("Database schema initialized successfully")
+	return nil
+}
+
+// alertColumns is the column list read by scanAlert
+const alertColumns = `id, transaction_id, account_id, user_id, alert_type, severity,
+	COALESCE(risk_score, 0), COALESCE(amount, 0), COALESCE(currency, ''),
+	COALESCE(description, ''), COALESCE(rule_triggered, ''), status,
+	created_at, updated_at, resolved_at, COALESCE(resolved_by, ''),
+	COALESCE(resolution_notes, ''), COALESCE(assigned_to, ''), COALESCE(suppressed, false), metadata,
+	tenant_id, source_topic, COALESCE(incident_id, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(row rowScanner) (*models.Alert, error) {
+	var alert models.Alert
+	var resolvedAt sql.NullTime
+	var metadata []byte
+
+	err := row.Scan(&alert.ID, &alert.TransactionID, &alert.AccountID, &alert.UserID,
+		&alert.AlertType, &alert.Severity, &alert.RiskScore, &alert.Amount, &alert.Currency,
+		&alert.Description, &alert.RuleTriggered, &alert.Status,
+		&alert.CreatedAt, &alert.UpdatedAt, &resolvedAt, &alert.ResolvedBy,
+		&alert.ResolutionNotes, &alert.AssignedTo, &alert.Suppressed, &metadata,
+		&alert.TenantID, &alert.SourceTopic, &alert.IncidentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolvedAt.Valid {
+		alert.ResolvedAt = &resolvedAt.Time
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &alert.Metadata); err != nil {
+			log.Printf("Warning: failed to unmarshal alert metadata: %v", err)
+		}
+	}
+
+	return &alert, nil
+}
+
+// InsertAlert stores a new alert. It reports false when an alert with the
+// same ID already exists, which happens when a transaction is redelivered.
+func (s *Storage) InsertAlert(ctx context.Context, alert *models.Alert) (bool, error) {
+	var metadata interface{}
+	if len(alert.Metadata) > 0 {
+		data, err := json.Marshal(alert.Metadata)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		metadata = string(data)
+	}
+
+	query := `
+		INSERT INTO alerts (
+			id, transaction_id, account_id, user_id, alert_type, severity,
+			risk_score, amount, currency, description, rule_triggered, status,
+			created_at, updated_at, suppressed, metadata, tenant_id, source_topic
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		alert.ID, alert.TransactionID, alert.AccountID, alert.UserID, alert.AlertType, alert.Severity,
+		alert.RiskScore, alert.Amount, alert.Currency, alert.Description, alert.RuleTriggered, alert.Status,
+		alert.CreatedAt, alert.UpdatedAt, alert.Suppressed, metadata, alert.TenantID, alert.SourceTopic,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert alert: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to insert alert: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// GetAlert retrieves an alert by ID
+func (s *Storage) GetAlert(ctx context.Context, id string) (*models.Alert, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = $1`, id)
+
+	alert, err := scanAlert(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	return alert, nil
+}
+
+// UpdateAlertStatus moves an alert from one status to another on behalf of
+// actor. Moving to investigating assigns the alert to actor; resolving
+// statuses record actor as the resolver along with the notes. The update
+// only applies while the alert is still in the from status, so concurrent
+// transitions cannot both succeed.
+func (s *Storage) UpdateAlertStatus(ctx context.Context, id, from, to, actor, notes string) (*models.Alert, error) {
+	now := time.Now()
+
+	var resolvedAt interface{}
+	resolvedBy, assignedTo := "", ""
+	if models.IsResolvedStatus(to) {
+		resolvedAt = now
+		resolvedBy = actor
+	}
+	if to == models.StatusInvestigating {
+		assignedTo = actor
+	}
+
+	query := `
+		UPDATE alerts SET
+			status = $3,
+			resolved_at = COALESCE($4, resolved_at),
+			resolved_by = COALESCE(NULLIF($5, ''), resolved_by),
+			resolution_notes = COALESCE(NULLIF($6, ''), resolution_notes),
+			assigned_to = COALESCE(NULLIF($7, ''), assigned_to),
+			updated_at = $8
+		WHERE id = $1 AND status = $2
+		RETURNING ` + alertColumns
+
+	alert, err := scanAlert(s.db.QueryRowContext(ctx, query, id, from, to, resolvedAt, resolvedBy, notes, assignedTo, now))
+	if err == sql.ErrNoRows {
+		if _, err := s.GetAlert(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrStatusConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert status: %w", err)
+	}
+	return alert, nil
+}
+
+// InsertNotification records a notification attempt
+func (s *Storage) InsertNotification(ctx context.Context, n *models.Notification) error {
+	var sentAt interface{}
+	if !n.SentAt.IsZero() {
+		sentAt = n.SentAt
+	}
+
+	query := `
+		INSERT INTO notifications (
+			id, alert_id, channel, recipient, subject, message, status, sent_at, error, external_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''))
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		n.ID, n.AlertID, n.Channel, n.Recipient, n.Subject, n.Message, n.Status, sentAt, n.Error, n.ExternalID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+	return nil
+}
+
+// notificationColumns is the column list read by scanNotification
+const notificationColumns = `id, alert_id, channel, COALESCE(recipient, ''), COALESCE(subject, ''),
+	COALESCE(message, ''), status, sent_at, COALESCE(error, ''), COALESCE(external_id, '')`
+
+func scanNotification(row rowScanner) (*models.Notification, error) {
+	var n models.Notification
+	var sentAt sql.NullTime
+	err := row.Scan(&n.ID, &n.AlertID, &n.Channel, &n.Recipient, &n.Subject,
+		&n.Message, &n.Status, &sentAt, &n.Error, &n.ExternalID)
+	if err != nil {
+		return nil, err
+	}
+	n.SentAt = sentAt.Time
+	return &n, nil
+}
+
+// ListNotifications returns the notifications sent for an alert, oldest first
+func (s *Storage) ListNotifications(ctx context.Context, alertID string) ([]*models.Notification, error) {
+	query := `SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE alert_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// AlertFilter narrows an alert listing
+type AlertFilter struct {
+	Status     string
+	Severity   string
+	AlertType  string
+	AccountID  string
+	AssignedTo string
+	// Suppressed, when set, restricts the listing to suppressed or
+	// unsuppressed alerts
+	Suppressed *bool
+	// OpenOnly restricts the listing to open and investigating alerts
+	OpenOnly bool
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+	// TenantID, when set, restricts the listing to one tenant
+	TenantID *string
+}
+
+// where builds the WHERE clause and arguments for a filter
+func (f AlertFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.Severity != "" {
+		add("severity = $%d", f.Severity)
+	}
+	if f.AlertType != "" {
+		add("alert_type = $%d", f.AlertType)
+	}
+	if f.AccountID != "" {
+		add("account_id = $%d", f.AccountID)
+	}
+	if f.AssignedTo != "" {
+		add("assigned_to = $%d", f.AssignedTo)
+	}
+	if f.Suppressed != nil {
+		add("COALESCE(suppressed, false) = $%d", *f.Suppressed)
+	}
+	if f.TenantID != nil {
+		add("tenant_id = $%d", *f.TenantID)
+	}
+	if f.OpenOnly {
+		conditions = append(conditions, "status IN ('open', 'investigating')")
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListAlerts returns alerts matching the filter, newest first
+func (s *Storage) ListAlerts(ctx context.Context, filter AlertFilter) ([]*models.Alert, error) {
+	where, args := filter.where()
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := `SELECT ` + alertColumns + ` FROM alerts` + where +
+		fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []*models.Alert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// GetAlertSummary aggregates the alerts matching the filter. Open counts
+// open and investigating alerts, resolved counts every closing status, and
+// critical alerts are counted as high severity.
+func (s *Storage) GetAlertSummary(ctx context.Context, filter AlertFilter) (*models.AlertSummary, error) {
+	where, args := filter.where()
+
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status IN ('open', 'investigating')),
+			COUNT(*) FILTER (WHERE status IN ('resolved', 'false_positive', 'closed')),
+			COUNT(*) FILTER (WHERE severity IN ('high', 'critical')),
+			COUNT(*) FILTER (WHERE severity = 'medium'),
+			COUNT(*) FILTER (WHERE severity = 'low'),
+			COUNT(*) FILTER (WHERE alert_type = 'fraud'),
+			COUNT(*) FILTER (WHERE alert_type = 'operational'),
+			COALESCE(AVG(risk_score), 0)
+		FROM alerts` + where
+
+	var summary models.AlertSummary
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&summary.TotalAlerts, &summary.OpenAlerts, &summary.ResolvedAlerts,
+		&summary.HighSeverity, &summary.MediumSeverity, &summary.LowSeverity,
+		&summary.FraudAlerts, &summary.OperationalAlerts, &summary.AverageRiskScore,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert summary: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// CountAccountAlerts counts the alerts raised on an account since since,
+// other than the alert excludeID
+func (s *Storage) CountAccountAlerts(ctx context.Context, accountID, excludeID string, since time.Time) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM alerts
+		WHERE account_id = $1 AND id <> $2 AND created_at >= $3
+	`, accountID, excludeID, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count account alerts: %w", err)
+	}
+	return count, nil
+}
+
+// Ping checks the database connection
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// SetDatabaseURL switches the pool to a new database URL, after a credential
+// rotation. Idle connections are closed so the pool is rebuilt with the new
+// credentials; connections in use are replaced as they reach their maximum
+// lifetime. The alert rules listener keeps its own session, which a rotation
+// does not end. The returned error reports whether the new URL can connect.
+func (s *Storage) SetDatabaseURL(ctx context.Context, dbURL string) error {
+	if _, err := newDSNConnector(dbURL); err != nil {
+		return err
+	}
+	s.connector.dsn.Store(&dbURL)
+	s.db.SetMaxIdleConns(0)
+	s.db.SetMaxIdleConns(poolSize)
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database with new credentials: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
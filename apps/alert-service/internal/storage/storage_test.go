@@ -0,0 +1,311 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/testdb"
+)
+
+// The integration tests run against Postgres in a container, started once
+// for the package, each test on a database of its own:
+//
+//	go test -tags=integration ./internal/storage/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := NewStorage(dbURL)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testAlert returns an open alert on account raised at
+func testAlert(id, accountID, severity, alertType string, riskScore float64, at time.Time) *models.Alert {
+	return &models.Alert{
+		ID:            id,
+		TransactionID: "txn-" + id,
+		AccountID:     accountID,
+		UserID:        "user-1",
+		AlertType:     alertType,
+		Severity:      severity,
+		RiskScore:     riskScore,
+		Amount:        12500,
+		Currency:      "USD",
+		Description:   "Amount over the 10000 threshold",
+		RuleTriggered: "high_amount",
+		Status:        models.StatusOpen,
+		CreatedAt:     at,
+		UpdatedAt:     at,
+	}
+}
+
+// insertAlerts stores alerts, failing the test on an error or a duplicate
+func insertAlerts(t *testing.T, s *Storage, alerts ...*models.Alert) {
+	t.Helper()
+	for _, alert := range alerts {
+		inserted, err := s.InsertAlert(context.Background(), alert)
+		if err != nil || !inserted {
+			t.Fatalf("InsertAlert(%s) = %v, %v", alert.ID, inserted, err)
+		}
+	}
+}
+
+func TestAlertLifecycleIsPersisted(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+
+	alert := testAlert("alert-1", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.87, at)
+	alert.TenantID, alert.SourceTopic = "unit-a", "transactions.processed"
+	alert.Metadata = map[string]string{"merchant": "Bellagio"}
+	insertAlerts(t, s, alert)
+
+	// A redelivered transaction raises the same alert again
+	if inserted, err := s.InsertAlert(ctx, alert); err != nil || inserted {
+		t.Errorf("InsertAlert of a stored alert = %v, %v, want it skipped", inserted, err)
+	}
+
+	stored, err := s.GetAlert(ctx, "alert-1")
+	if err != nil {
+		t.Fatalf("GetAlert: %v", err)
+	}
+	if stored.TransactionID != "txn-alert-1" || stored.AccountID != "acct-1" || stored.Severity != models.SeverityHigh ||
+		stored.RiskScore != 0.87 || stored.Amount != 12500 || stored.Currency != "USD" || stored.RuleTriggered != "high_amount" ||
+		stored.Status != models.StatusOpen || stored.TenantID != "unit-a" || stored.SourceTopic != "transactions.processed" ||
+		!stored.CreatedAt.Equal(at) || stored.ResolvedAt != nil || stored.Metadata["merchant"] != "Bellagio" {
+		t.Errorf("stored alert = %+v", stored)
+	}
+
+	// Every delivery attempt is recorded, failed or not
+	sent := &models.Notification{ID: "n-1", AlertID: "alert-1", Channel: models.ChannelSlack, Recipient: "slack-webhook",
+		Subject: "high fraud alert", Message: "text", Status: models.NotificationStatusSent, SentAt: at, ExternalID: "1700000000.000100"}
+	failed := &models.Notification{ID: "n-2", AlertID: "alert-1", Channel: models.ChannelEmail, Recipient: "fraud@bank.example",
+		Status: models.NotificationStatusFailed, Error: "connection refused"}
+	for _, n := range []*models.Notification{sent, failed} {
+		if err := s.InsertNotification(ctx, n); err != nil {
+			t.Fatalf("InsertNotification: %v", err)
+		}
+	}
+	notifications, err := s.ListNotifications(ctx, "alert-1")
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("%d notifications, want 2", len(notifications))
+	}
+	if n := notifications[0]; n.ID != "n-1" || n.Status != models.NotificationStatusSent || !n.SentAt.Equal(at) || n.ExternalID != "1700000000.000100" || n.Error != "" {
+		t.Errorf("sent notification = %+v", n)
+	}
+	if n := notifications[1]; n.ID != "n-2" || n.Status != models.NotificationStatusFailed || !n.SentAt.IsZero() || n.Error != "connection refused" {
+		t.Errorf("failed notification = %+v", n)
+	}
+
+	investigating, err := s.UpdateAlertStatus(ctx, "alert-1", models.StatusOpen, models.StatusInvestigating, "analyst-1", "")
+	if err != nil {
+		t.Fatalf("UpdateAlertStatus to investigating: %v", err)
+	}
+	if investigating.Status != models.StatusInvestigating || investigating.AssignedTo != "analyst-1" || investigating.ResolvedAt != nil {
+		t.Errorf("investigating alert = %+v", investigating)
+	}
+	if !investigating.UpdatedAt.After(at) {
+		t.Errorf("updated at %s, not after the alert was raised", investigating.UpdatedAt)
+	}
+
+	// A transition from a status the alert has left loses the race
+	if _, err := s.UpdateAlertStatus(ctx, "alert-1", models.StatusOpen, models.StatusInvestigating, "analyst-2", ""); !errors.Is(err, ErrStatusConflict) {
+		t.Errorf("stale transition = %v, want ErrStatusConflict", err)
+	}
+
+	resolved, err := s.UpdateAlertStatus(ctx, "alert-1", models.StatusInvestigating, models.StatusFalsePositive, "analyst-1", "known customer")
+	if err != nil {
+		t.Fatalf("UpdateAlertStatus to false positive: %v", err)
+	}
+	if resolved.Status != models.StatusFalsePositive || resolved.ResolvedBy != "analyst-1" || resolved.ResolvedAt == nil ||
+		resolved.ResolutionNotes != "known customer" || resolved.AssignedTo != "analyst-1" {
+		t.Errorf("resolved alert = %+v", resolved)
+	}
+
+	// Closing records who closed the alert and keeps the notes
+	closed, err := s.UpdateAlertStatus(ctx, "alert-1", models.StatusFalsePositive, models.StatusClosed, "lead-1", "")
+	if err != nil {
+		t.Fatalf("UpdateAlertStatus to closed: %v", err)
+	}
+	if closed.ResolvedBy != "lead-1" || closed.ResolutionNotes != "known customer" {
+		t.Errorf("closed alert resolved by %s with notes %q", closed.ResolvedBy, closed.ResolutionNotes)
+	}
+
+	if _, err := s.GetAlert(ctx, "alert-2"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("GetAlert of an unknown alert = %v, want ErrAlertNotFound", err)
+	}
+	if _, err := s.UpdateAlertStatus(ctx, "alert-2", models.StatusOpen, models.StatusInvestigating, "analyst-1", ""); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("UpdateAlertStatus of an unknown alert = %v, want ErrAlertNotFound", err)
+	}
+}
+
+func TestListAlertsFilters(t *testing.T) {
+	s := newTestStorage(t)
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	unitB := testAlert("alert-5", "acct-2", models.SeverityLow, models.AlertTypeFraud, 0.2, at.Add(4*time.Hour))
+	unitB.TenantID = "unit-b"
+	insertAlerts(t, s,
+		testAlert("alert-1", "acct-1", models.SeverityCritical, models.AlertTypeFraud, 0.95, at),
+		testAlert("alert-2", "acct-1", models.SeverityHigh, models.AlertTypeRisk, 0.8, at.Add(time.Hour)),
+		testAlert("alert-3", "acct-2", models.SeverityMedium, models.AlertTypeOperational, 0.5, at.Add(2*time.Hour)),
+		testAlert("alert-4", "acct-2", models.SeverityHigh, models.AlertTypeFraud, 0.75, at.Add(3*time.Hour)),
+		unitB,
+	)
+	ctx := context.Background()
+	if _, err := s.UpdateAlertStatus(ctx, "alert-2", models.StatusOpen, models.StatusInvestigating, "analyst-1", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus: %v", err)
+	}
+	if _, err := s.UpdateAlertStatus(ctx, "alert-2", models.StatusInvestigating, models.StatusResolved, "analyst-1", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus: %v", err)
+	}
+	if _, err := s.UpdateAlertStatus(ctx, "alert-4", models.StatusOpen, models.StatusInvestigating, "analyst-2", ""); err != nil {
+		t.Fatalf("UpdateAlertStatus: %v", err)
+	}
+
+	tenantB, empty := "unit-b", ""
+	tests := []struct {
+		name   string
+		filter AlertFilter
+		want   string
+	}{
+		{"everything, newest first", AlertFilter{}, "[alert-5 alert-4 alert-3 alert-2 alert-1]"},
+		{"status", AlertFilter{Status: models.StatusOpen}, "[alert-5 alert-3 alert-1]"},
+		{"severity", AlertFilter{Severity: models.SeverityHigh}, "[alert-4 alert-2]"},
+		{"alert type", AlertFilter{AlertType: models.AlertTypeFraud}, "[alert-5 alert-4 alert-1]"},
+		{"account", AlertFilter{AccountID: "acct-1"}, "[alert-2 alert-1]"},
+		{"assignee's open alerts", AlertFilter{AssignedTo: "analyst-2", OpenOnly: true}, "[alert-4]"},
+		{"open only", AlertFilter{OpenOnly: true}, "[alert-5 alert-4 alert-3 alert-1]"},
+		{"combined", AlertFilter{AccountID: "acct-2", Severity: models.SeverityHigh, Status: models.StatusInvestigating}, "[alert-4]"},
+		{"time range", AlertFilter{From: at.Add(time.Hour), To: at.Add(3 * time.Hour)}, "[alert-3 alert-2]"},
+		{"page", AlertFilter{Limit: 2, Offset: 1}, "[alert-4 alert-3]"},
+		{"tenant", AlertFilter{TenantID: &tenantB}, "[alert-5]"},
+		{"default tenant", AlertFilter{TenantID: &empty, Severity: models.SeverityCritical}, "[alert-1]"},
+		{"no match", AlertFilter{AccountID: "acct-3"}, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts, err := s.ListAlerts(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("ListAlerts: %v", err)
+			}
+			ids := make([]string, len(alerts))
+			for i, alert := range alerts {
+				ids[i] = alert.ID
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("alerts = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertSummaryMath(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	insertAlerts(t, s,
+		testAlert("alert-1", "acct-1", models.SeverityCritical, models.AlertTypeFraud, 0.9, at),
+		testAlert("alert-2", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.8, at),
+		testAlert("alert-3", "acct-1", models.SeverityMedium, models.AlertTypeOperational, 0.4, at),
+		testAlert("alert-4", "acct-1", models.SeverityLow, models.AlertTypeRisk, 0.1, at),
+		testAlert("alert-5", "acct-2", models.SeverityLow, models.AlertTypeCompliance, 0.3, at),
+	)
+	transitions := []struct{ id, from, to string }{
+		{"alert-2", models.StatusOpen, models.StatusInvestigating},
+		{"alert-3", models.StatusOpen, models.StatusInvestigating},
+		{"alert-3", models.StatusInvestigating, models.StatusResolved},
+		{"alert-4", models.StatusOpen, models.StatusInvestigating},
+		{"alert-4", models.StatusInvestigating, models.StatusFalsePositive},
+		{"alert-5", models.StatusOpen, models.StatusInvestigating},
+		{"alert-5", models.StatusInvestigating, models.StatusClosed},
+	}
+	for _, tr := range transitions {
+		if _, err := s.UpdateAlertStatus(ctx, tr.id, tr.from, tr.to, "analyst-1", ""); err != nil {
+			t.Fatalf("UpdateAlertStatus(%s, %s): %v", tr.id, tr.to, err)
+		}
+	}
+
+	summary, err := s.GetAlertSummary(ctx, AlertFilter{})
+	if err != nil {
+		t.Fatalf("GetAlertSummary: %v", err)
+	}
+	// Open counts investigating alerts, resolved every closing status, and
+	// high severity includes critical
+	want := models.AlertSummary{
+		TotalAlerts: 5, OpenAlerts: 2, ResolvedAlerts: 3,
+		HighSeverity: 2, MediumSeverity: 1, LowSeverity: 2,
+		FraudAlerts: 2, OperationalAlerts: 1,
+	}
+	average := summary.AverageRiskScore
+	summary.AverageRiskScore = 0
+	if *summary != want {
+		t.Errorf("summary = %+v, want %+v", *summary, want)
+	}
+	if math.Abs(average-0.5) > 1e-9 {
+		t.Errorf("average risk score = %v, want 0.5", average)
+	}
+
+	account, err := s.GetAlertSummary(ctx, AlertFilter{AccountID: "acct-1", OpenOnly: true})
+	if err != nil {
+		t.Fatalf("GetAlertSummary: %v", err)
+	}
+	if account.TotalAlerts != 2 || account.OpenAlerts != 2 || account.ResolvedAlerts != 0 || math.Abs(account.AverageRiskScore-0.85) > 1e-9 {
+		t.Errorf("open alerts of acct-1 summarized as %+v", account)
+	}
+
+	none, err := s.GetAlertSummary(ctx, AlertFilter{AccountID: "acct-3"})
+	if err != nil {
+		t.Fatalf("GetAlertSummary: %v", err)
+	}
+	if *none != (models.AlertSummary{}) {
+		t.Errorf("summary of no alerts = %+v, want zeros", *none)
+	}
+}
+
+func TestCountAccountAlerts(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	insertAlerts(t, s,
+		testAlert("a1", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.9, now.AddDate(0, 0, -40)),
+		testAlert("a2", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.9, now.AddDate(0, 0, -20)),
+		testAlert("a3", "acct-1", models.SeverityMedium, models.AlertTypeRisk, 0.6, now.AddDate(0, 0, -1)),
+		testAlert("a4", "acct-1", models.SeverityHigh, models.AlertTypeFraud, 0.9, now),
+		testAlert("a5", "acct-2", models.SeverityHigh, models.AlertTypeFraud, 0.9, now),
+	)
+
+	// The alert being enriched and those before the window do not count
+	count, err := s.CountAccountAlerts(ctx, "acct-1", "a4", now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("CountAccountAlerts: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountAccountAlerts = %d, want 2", count)
+	}
+	if count, _ := s.CountAccountAlerts(ctx, "acct-3", "a9", now.AddDate(0, 0, -30)); count != 0 {
+		t.Errorf("CountAccountAlerts of an account without alerts = %d, want 0", count)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// ErrWatchlistEntryNotFound is returned when an account is not watchlisted
+var ErrWatchlistEntryNotFound = errors.New("watchlist entry not found")
+
+const watchlistColumns = `account_id, reason, expires_at, COALESCE(created_by, ''), created_at, updated_at`
+
+func scanWatchlistEntry(row rowScanner) (*models.WatchlistEntry, error) {
+	var e models.WatchlistEntry
+	var expiresAt sql.NullTime
+	err := row.Scan(&e.AccountID, &e.Reason, &expiresAt, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, nil
+}
+
+// UpsertWatchlistEntry watchlists an account on behalf of actor, replacing
+// the reason and expiry of an existing entry, and records the change in the
+// audit log. It reports whether the entry is new.
+func (s *Storage) UpsertWatchlistEntry(ctx context.Context, actor string, e *models.WatchlistEntry) (bool, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin watchlist add: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	now := time.Now().UTC()
+	var inserted bool
+	err = dbTx.QueryRowContext(ctx, `
+		INSERT INTO watchlist (account_id, reason, expires_at, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (account_id) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			expires_at = EXCLUDED.expires_at,
+			created_by = EXCLUDED.created_by,
+			updated_at = EXCLUDED.updated_at
+		RETURNING created_at, (xmax = 0)
+	`, e.AccountID, e.Reason, utcOrNil(e.ExpiresAt), actor, now).Scan(&e.CreatedAt, &inserted)
+	if err != nil {
+		return false, fmt.Errorf("failed to add watchlist entry: %w", err)
+	}
+	e.CreatedBy = actor
+	e.UpdatedAt = now
+
+	if err := auditWatchlist(ctx, dbTx, actor, models.AuditActionWatchlistAdd, e); err != nil {
+		return false, err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit watchlist add: %w", err)
+	}
+	return inserted, nil
+}
+
+// GetWatchlistEntry returns the entry of an account in effect at now
+func (s *Storage) GetWatchlistEntry(ctx context.Context, accountID string, now time.Time) (*models.WatchlistEntry, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlist
+		WHERE account_id = $1 AND (expires_at IS NULL OR expires_at > $2)`
+
+	e, err := scanWatchlistEntry(s.db.QueryRowContext(ctx, query, accountID, now.UTC()))
+	if err == sql.ErrNoRows {
+		return nil, ErrWatchlistEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watchlist entry: %w", err)
+	}
+	return e, nil
+}
+
+// ListWatchlist returns the entries in effect at now, soonest to expire
+// first, or every entry when includeExpired is set
+func (s *Storage) ListWatchlist(ctx context.Context, now time.Time, includeExpired bool) ([]*models.WatchlistEntry, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlist`
+	var args []interface{}
+	if !includeExpired {
+		query += ` WHERE expires_at IS NULL OR expires_at > $1`
+		args = append(args, now.UTC())
+	}
+	query += ` ORDER BY expires_at NULLS LAST, account_id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watchlist: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.WatchlistEntry{}
+	for rows.Next() {
+		e, err := scanWatchlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan watchlist entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list watchlist: %w", err)
+	}
+	return entries, nil
+}
+
+// RemoveWatchlistEntry removes an account from the watchlist on behalf of
+// actor and records it in the audit log
+func (s *Storage) RemoveWatchlistEntry(ctx context.Context, actor, accountID string) error {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin watchlist removal: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	e, err := scanWatchlistEntry(dbTx.QueryRowContext(ctx,
+		`DELETE FROM watchlist WHERE account_id = $1 RETURNING `+watchlistColumns, accountID))
+	if err == sql.ErrNoRows {
+		return ErrWatchlistEntryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove watchlist entry: %w", err)
+	}
+
+	if err := auditWatchlist(ctx, dbTx, actor, models.AuditActionWatchlistRemove, e); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit watchlist removal: %w", err)
+	}
+	return nil
+}
+
+// auditWatchlist records a watchlist change in the audit log within dbTx, so
+// no change is made unrecorded
+func auditWatchlist(ctx context.Context, dbTx *sql.Tx, actor, action string, e *models.WatchlistEntry) error {
+	details := fmt.Sprintf("reason=%q", e.Reason)
+	if e.ExpiresAt != nil {
+		details += " expires_at=" + e.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	_, err := dbTx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, subject, details, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, actor, action, "watchlist:"+e.AccountID, details, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// utcOrNil returns t in UTC, the zone of the table's timestamps, or nil
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
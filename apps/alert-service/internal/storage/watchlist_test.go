@@ -0,0 +1,142 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+)
+
+// auditEntry is a row of the audit log
+type auditEntry struct {
+	actor, action, subject, details string
+}
+
+// auditLog returns the audit log, oldest first
+func auditLog(t *testing.T, s *Storage) []auditEntry {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT actor, action, subject, details FROM audit_log ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to read the audit log: %v", err)
+	}
+	defer rows.Close()
+	var entries []auditEntry
+	for rows.Next() {
+		var e auditEntry
+		if err := rows.Scan(&e.actor, &e.action, &e.subject, &e.details); err != nil {
+			t.Fatalf("failed to scan audit entry: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestWatchlistEntriesAreAudited(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	e := &models.WatchlistEntry{AccountID: "acct-1", Reason: "mule ring case 118"}
+	inserted, err := s.UpsertWatchlistEntry(ctx, "analyst-1", e)
+	if err != nil || !inserted {
+		t.Fatalf("UpsertWatchlistEntry = %v, %v, want a new entry", inserted, err)
+	}
+	// Watchlisting the account again replaces its reason and expiry
+	inserted, err = s.UpsertWatchlistEntry(ctx, "analyst-2", &models.WatchlistEntry{AccountID: "acct-1", Reason: "case 121", ExpiresAt: &expires})
+	if err != nil || inserted {
+		t.Fatalf("UpsertWatchlistEntry again = %v, %v, want the entry replaced", inserted, err)
+	}
+
+	got, err := s.GetWatchlistEntry(ctx, "acct-1", time.Now())
+	if err != nil {
+		t.Fatalf("GetWatchlistEntry: %v", err)
+	}
+	if got.Reason != "case 121" || got.CreatedBy != "analyst-2" || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("entry = %+v, want the replacement", got)
+	}
+
+	if err := s.RemoveWatchlistEntry(ctx, "analyst-3", "acct-1"); err != nil {
+		t.Fatalf("RemoveWatchlistEntry: %v", err)
+	}
+	if _, err := s.GetWatchlistEntry(ctx, "acct-1", time.Now()); !errors.Is(err, ErrWatchlistEntryNotFound) {
+		t.Errorf("GetWatchlistEntry after removal = %v, want ErrWatchlistEntryNotFound", err)
+	}
+	if err := s.RemoveWatchlistEntry(ctx, "analyst-3", "acct-1"); !errors.Is(err, ErrWatchlistEntryNotFound) {
+		t.Errorf("RemoveWatchlistEntry again = %v, want ErrWatchlistEntryNotFound", err)
+	}
+
+	want := []auditEntry{
+		{"analyst-1", models.AuditActionWatchlistAdd, "watchlist:acct-1", `reason="mule ring case 118"`},
+		{"analyst-2", models.AuditActionWatchlistAdd, "watchlist:acct-1", `reason="case 121" expires_at=` + expires.Format(time.RFC3339)},
+		{"analyst-3", models.AuditActionWatchlistRemove, "watchlist:acct-1", `reason="case 121" expires_at=` + expires.Format(time.RFC3339)},
+	}
+	log := auditLog(t, s)
+	if len(log) != len(want) {
+		t.Fatalf("audit log = %+v, want %d entries", log, len(want))
+	}
+	for i := range want {
+		if log[i] != want[i] {
+			t.Errorf("audit entry %d = %+v, want %+v", i, log[i], want[i])
+		}
+	}
+}
+
+func TestExpiredWatchlistEntriesDropOut(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+	soon, later := now.Add(time.Hour), now.Add(48*time.Hour)
+
+	for _, e := range []*models.WatchlistEntry{
+		{AccountID: "acct-forever", Reason: "case 1"},
+		{AccountID: "acct-later", Reason: "case 2", ExpiresAt: &later},
+		{AccountID: "acct-soon", Reason: "case 3", ExpiresAt: &soon},
+	} {
+		if _, err := s.UpsertWatchlistEntry(ctx, "analyst-1", e); err != nil {
+			t.Fatalf("UpsertWatchlistEntry(%s): %v", e.AccountID, err)
+		}
+	}
+
+	ids := func(entries []*models.WatchlistEntry) []string {
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.AccountID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name           string
+		at             time.Time
+		includeExpired bool
+		want           []string
+	}{
+		{"now", now, false, []string{"acct-soon", "acct-later", "acct-forever"}},
+		{"past the first expiry", now.Add(2 * time.Hour), false, []string{"acct-later", "acct-forever"}},
+		{"past every expiry", now.Add(72 * time.Hour), false, []string{"acct-forever"}},
+		{"with the expired", now.Add(72 * time.Hour), true, []string{"acct-soon", "acct-later", "acct-forever"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := s.ListWatchlist(ctx, tt.at, tt.includeExpired)
+			if err != nil {
+				t.Fatalf("ListWatchlist: %v", err)
+			}
+			if got := ids(entries); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ListWatchlist = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.GetWatchlistEntry(ctx, "acct-soon", now.Add(2*time.Hour)); !errors.Is(err, ErrWatchlistEntryNotFound) {
+		t.Errorf("GetWatchlistEntry past its expiry = %v, want ErrWatchlistEntryNotFound", err)
+	}
+	if _, err := s.GetWatchlistEntry(ctx, "acct-soon", now); err != nil {
+		t.Errorf("GetWatchlistEntry before its expiry: %v", err)
+	}
+}
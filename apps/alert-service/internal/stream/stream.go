@@ -0,0 +1,232 @@
+// Package stream fans newly raised alerts out to live subscribers, such as
+// the server-sent events endpoint. Every alert gets an increasing event ID
+// and the most recent ones are kept in a ring so a subscriber that
+// reconnects can resume after the last event it saw. With Redis the ring
+// and the ID counter are shared, and alerts raised by any instance reach
+// the subscribers of every instance; without it they are kept in memory.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the ring, the event ID counter and the fan-out channel
+const (
+	ringKey    = "alert:stream"
+	seqKey     = "alert:stream:seq"
+	channelKey = "alert:stream:events"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is disconnected to resume from the ring
+const subscriberBuffer = 64
+
+// Event is an alert as sent to subscribers
+type Event struct {
+	ID    int64         `json:"id"`
+	Alert *models.Alert `json:"alert"`
+}
+
+// Subscription receives the events matching its severities on C. C is
+// closed when the subscriber falls behind; it should reconnect and resume.
+type Subscription struct {
+	C          <-chan Event
+	c          chan Event
+	severities map[string]bool
+}
+
+// Matches reports whether the subscription wants alerts of severity
+func (s *Subscription) Matches(severity string) bool {
+	return len(s.severities) == 0 || s.severities[severity]
+}
+
+// Broker publishes alerts to subscribers
+type Broker struct {
+	redis *redis.Client
+	size  int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	memory []Event // ring used without Redis, oldest first
+	seq    int64
+}
+
+// NewBroker creates a broker keeping the last size events for resume.
+// redisClient may be nil.
+func NewBroker(redisClient *redis.Client, size int) *Broker {
+	return &Broker{
+		redis: redisClient,
+		size:  size,
+		subs:  make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the alert an event ID, adds it to the ring and sends it to
+// the subscribers. With Redis the subscribers are reached through Run.
+func (b *Broker) Publish(ctx context.Context, alert *models.Alert) error {
+	if b.redis == nil {
+		b.mu.Lock()
+		b.seq++
+		event := Event{ID: b.seq, Alert: alert}
+		b.memory = append(b.memory, event)
+		if len(b.memory) > b.size {
+			b.memory = b.memory[len(b.memory)-b.size:]
+		}
+		b.mu.Unlock()
+		b.fanOut(event)
+		return nil
+	}
+
+	id, err := b.redis.Incr(ctx, seqKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to assign event id: %w", err)
+	}
+	data, err := json.Marshal(Event{ID: id, Alert: alert})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	_, err = b.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, ringKey, data)
+		pipe.LTrim(ctx, ringKey, int64(-b.size), -1)
+		pipe.Publish(ctx, channelKey, data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Run relays the events published by every instance to this instance's
+// subscribers until ctx is cancelled. Without Redis it only waits.
+func (b *Broker) Run(ctx context.Context) error {
+	if b.redis == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	pubsub := b.redis.Subscribe(ctx, channelKey)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("alert stream subscription closed")
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(m.Payload), &event); err != nil {
+				slog.WarnContext(ctx, "stream: dropping undecodable event", "error", err)
+				continue
+			}
+			b.fanOut(event)
+		}
+	}
+}
+
+// Since returns the events in the ring after lastID, oldest first
+func (b *Broker) Since(ctx context.Context, lastID int64) ([]Event, error) {
+	var events []Event
+	if b.redis == nil {
+		b.mu.Lock()
+		events = append(events, b.memory...)
+		b.mu.Unlock()
+	} else {
+		values, err := b.redis.LRange(ctx, ringKey, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read alert stream: %w", err)
+		}
+		for _, v := range values {
+			var event Event
+			if err := json.Unmarshal([]byte(v), &event); err != nil {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	// Instances publishing at once may push their events out of ID order
+	var after []Event
+	for _, event := range events {
+		if event.ID > lastID {
+			after = append(after, event)
+		}
+	}
+	sort.Slice(after, func(i, j int) bool { return after[i].ID < after[j].ID })
+	return after, nil
+}
+
+// Subscribe registers a subscriber to alerts of the given severities, all
+// of them when none are given
+func (b *Broker) Subscribe(severities ...string) *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, severities: make(map[string]bool, len(severities))}
+	for _, s := range severities {
+		sub.severities[s] = true
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	metrics.SetStreamSubscribers(len(b.subs))
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes a subscriber, if the broker has not already
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// Close disconnects every subscriber, ending their streams
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// fanOut sends an event to the matching subscribers, dropping those that
+// fell behind
+func (b *Broker) fanOut(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if !sub.Matches(event.Alert.Severity) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			metrics.RecordStreamSubscriberDropped()
+			b.remove(sub)
+		}
+	}
+}
+
+// remove drops a registered subscriber and closes its channel. b.mu must be
+// held.
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+	metrics.SetStreamSubscribers(len(b.subs))
+}
@@ -0,0 +1,231 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// gaugeValue returns the value of the unlabelled gauge name in the default
+// registry
+func gaugeValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// alert returns an alert of severity
+func alert(id, severity string) *models.Alert {
+	return &models.Alert{ID: id, AccountID: "acct-1", Severity: severity}
+}
+
+// receive returns the next event of sub
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+// ids returns the alert IDs of events
+func ids(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.Alert.ID)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscriptionsFilterBySeverity(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(nil, 10)
+	all := b.Subscribe()
+	urgent := b.Subscribe(models.SeverityHigh, models.SeverityCritical)
+	defer b.Unsubscribe(all)
+	defer b.Unsubscribe(urgent)
+	if got := gaugeValue(t, "alert_stream_subscribers"); got != 2 {
+		t.Errorf("subscribers = %v, want 2", got)
+	}
+
+	for _, a := range []*models.Alert{alert("a-1", models.SeverityLow), alert("a-2", models.SeverityCritical), alert("a-3", models.SeverityHigh)} {
+		if err := b.Publish(ctx, a); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	for i, want := range []string{"a-1", "a-2", "a-3"} {
+		if e := receive(t, all); e.Alert.ID != want || e.ID != int64(i+1) {
+			t.Errorf("event %d/%s, want %d/%s", e.ID, e.Alert.ID, i+1, want)
+		}
+	}
+	for _, want := range []string{"a-2", "a-3"} {
+		if e := receive(t, urgent); e.Alert.ID != want {
+			t.Errorf("urgent subscriber received %s, want %s", e.Alert.ID, want)
+		}
+	}
+}
+
+func TestSinceResumesAfterTheLastEvent(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(nil, 3)
+	for _, id := range []string{"a-1", "a-2", "a-3", "a-4", "a-5"} {
+		if err := b.Publish(ctx, alert(id, models.SeverityHigh)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	tests := []struct {
+		lastID int64
+		want   []string
+	}{
+		{0, []string{"a-3", "a-4", "a-5"}}, // only the ring is kept
+		{3, []string{"a-4", "a-5"}},
+		{5, nil},
+		{9, nil},
+	}
+	for _, tt := range tests {
+		events, err := b.Since(ctx, tt.lastID)
+		if err != nil {
+			t.Fatalf("Since: %v", err)
+		}
+		if got := ids(events); !equal(got, tt.want) {
+			t.Errorf("Since(%d) = %v, want %v", tt.lastID, got, tt.want)
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(nil, 1)
+	slow := b.Subscribe()
+	for i := 0; i <= subscriberBuffer; i++ {
+		if err := b.Publish(ctx, alert("a", models.SeverityLow)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	// Unsubscribing after the broker dropped it is harmless
+	b.Unsubscribe(slow)
+}
+
+func TestCloseEndsEveryStream(t *testing.T) {
+	b := NewBroker(nil, 1)
+	subs := []*Subscription{b.Subscribe(), b.Subscribe(models.SeverityLow)}
+	b.Close()
+	for _, sub := range subs {
+		if _, ok := <-sub.C; ok {
+			t.Error("subscription still open after Close")
+		}
+	}
+	if got := gaugeValue(t, "alert_stream_subscribers"); got != 0 {
+		t.Errorf("subscribers = %v, want 0", got)
+	}
+}
+
+func TestRedisSharesTheRingAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newClient := func() *redis.Client {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two instances sharing Redis: one raises the alerts, the other streams them
+	raiser := NewBroker(newClient(), 3)
+	streamer := NewBroker(newClient(), 3)
+	sub := streamer.Subscribe(models.SeverityCritical)
+	defer streamer.Unsubscribe(sub)
+	done := make(chan error, 1)
+	go func() { done <- streamer.Run(ctx) }()
+	// Run has subscribed once Redis counts the subscriber
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub(channelKey)[channelKey] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Run never subscribed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, a := range []*models.Alert{alert("a-1", models.SeverityLow), alert("a-2", models.SeverityCritical),
+		alert("a-3", models.SeverityLow), alert("a-4", models.SeverityCritical)} {
+		if err := raiser.Publish(ctx, a); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	for _, want := range []int64{2, 4} {
+		if e := receive(t, sub); e.ID != want || e.Alert.Severity != models.SeverityCritical {
+			t.Errorf("received event %d %s, want %d", e.ID, e.Alert.Severity, want)
+		}
+	}
+
+	// Either instance resumes from the shared ring
+	events, err := streamer.Since(ctx, 2)
+	if err != nil {
+		t.Fatalf("Since: %v", err)
+	}
+	if got := ids(events); !equal(got, []string{"a-3", "a-4"}) {
+		t.Errorf("Since(2) = %v, want a-3 and a-4", got)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	b := NewBroker(client, 3)
+	mr.Close()
+
+	if err := b.Publish(context.Background(), alert("a-1", models.SeverityHigh)); err == nil {
+		t.Error("Publish with Redis down succeeded")
+	}
+	if _, err := b.Since(context.Background(), 0); err == nil {
+		t.Error("Since with Redis down succeeded")
+	}
+}
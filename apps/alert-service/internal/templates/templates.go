@@ -0,0 +1,259 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"alert-service/internal/enrichment"
+	"alert-service/internal/metrics"
+	"alert-service/internal/models"
+)
+
+// Names of the message templates. A template named "<name>.<alert_type>"
+// overrides "<name>" for alerts of that type.
+const (
+	Slack        = "slack"
+	EmailSubject = "email_subject"
+	Email        = "email"
+	PagerDuty    = "pagerduty"
+	SMS          = "sms"
+	Console      = "console" // console and file notifications
+)
+
+var names = map[string]bool{
+	Slack:        true,
+	EmailSubject: true,
+	Email:        true,
+	PagerDuty:    true,
+	SMS:          true,
+	Console:      true,
+}
+
+//go:embed defaults/*.tmpl
+var defaultFS embed.FS
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"GBP": "£",
+	"EUR": "€",
+	"JPY": "¥",
+	"INR": "₹",
+}
+
+var severityEmojis = map[string]string{
+	models.SeverityCritical: "🔴",
+	models.SeverityHigh:     "🟠",
+	models.SeverityMedium:   "🟡",
+	models.SeverityLow:      "🟢",
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Data is what templates are executed with: the full alert plus derived
+// helpers
+type Data struct {
+	*models.Alert
+	location *time.Location
+}
+
+// FormattedAmount returns the amount with its currency symbol, e.g. £1,250.00
+func (d Data) FormattedAmount() string {
+	amount := formatThousands(d.Amount)
+	if symbol, ok := currencySymbols[strings.ToUpper(d.Currency)]; ok {
+		return symbol + amount
+	}
+	return strings.TrimSpace(amount + " " + d.Currency)
+}
+
+// LocalTime returns when the alert was raised in the configured time zone
+func (d Data) LocalTime() string {
+	return d.CreatedAt.In(d.location).Format("2006-01-02 15:04:05 MST")
+}
+
+// SeverityEmoji returns an emoji for the alert severity
+func (d Data) SeverityEmoji() string {
+	if emoji, ok := severityEmojis[d.Severity]; ok {
+		return emoji
+	}
+	return "🚨"
+}
+
+// ContextField is a line of the account context section of a message
+type ContextField struct {
+	Label string
+	Value string
+}
+
+// AccountContext returns the context the alert was enriched with, as lines
+// of the account context section, or nil when it was not enriched
+func (d Data) AccountContext() []ContextField {
+	days, ok := d.Metadata[enrichment.KeyWindowDays]
+	if !ok {
+		return nil
+	}
+
+	var fields []ContextField
+	if opened, err := time.Parse(time.RFC3339, d.Metadata[enrichment.KeyOpenedAt]); err == nil {
+		raised := d.CreatedAt
+		if raised.IsZero() {
+			raised = time.Now()
+		}
+		age := int(raised.Sub(opened).Hours() / 24)
+		fields = append(fields, ContextField{"Account age", fmt.Sprintf("%d days", max(age, 0))})
+	}
+	fields = append(fields,
+		ContextField{"Transactions (" + days + "d)", d.Metadata[enrichment.KeyTransactions]},
+		ContextField{"Flagged (" + days + "d)", d.Metadata[enrichment.KeyFlagged]},
+	)
+	if score, ok := d.Metadata[enrichment.KeyRiskScore]; ok {
+		fields = append(fields, ContextField{"Account risk", score + " (" + d.Metadata[enrichment.KeyRiskLevel] + ")"})
+	}
+	fields = append(fields, ContextField{"Previous alerts (" + days + "d)", d.Metadata[enrichment.KeyPreviousAlerts]})
+	return fields
+}
+
+// Renderer renders alert messages from templates. The embedded defaults
+// can be overridden from a directory; a custom template that fails to
+// render falls back to the default.
+type Renderer struct {
+	templates map[string]*template.Template
+	defaults  map[string]*template.Template
+	location  *time.Location
+}
+
+// NewRenderer parses the default templates and any *.tmpl overrides in dir,
+// which may be empty. All parse errors are reported together.
+func NewRenderer(dir string, location *time.Location) (*Renderer, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	defaults, err := parseDir(defaultFS, "defaults")
+	if err != nil {
+		return nil, fmt.Errorf("invalid default templates: %w", err)
+	}
+
+	r := &Renderer{
+		templates: make(map[string]*template.Template, len(defaults)),
+		defaults:  defaults,
+		location:  location,
+	}
+	for key, t := range defaults {
+		r.templates[key] = t
+	}
+
+	if dir != "" {
+		custom, err := parseDir(os.DirFS(dir), ".")
+		if err != nil {
+			return nil, fmt.Errorf("invalid templates in %s: %w", dir, err)
+		}
+		for key, t := range custom {
+			r.templates[key] = t
+		}
+		log.Printf("Loaded %d custom message templates from %s", len(custom), dir)
+	}
+
+	return r, nil
+}
+
+// Render renders the named template for an alert
+func (r *Renderer) Render(name string, alert *models.Alert) (string, error) {
+	key := name + "." + alert.AlertType
+	t, ok := r.templates[key]
+	if !ok {
+		key = name
+		t, ok = r.templates[key]
+	}
+	if !ok {
+		return "", fmt.Errorf("no template named %s", name)
+	}
+
+	out, err := r.execute(t, alert)
+	if err == nil {
+		return out, nil
+	}
+
+	def, ok := r.defaults[key]
+	if !ok {
+		def = r.defaults[name]
+	}
+	if def == nil || def == t {
+		return "", fmt.Errorf("failed to render template %s: %w", key, err)
+	}
+
+	log.Printf("template %s failed, using default: %v", key, err)
+	metrics.RecordTemplateFallback(key)
+	return r.execute(def, alert)
+}
+
+func (r *Renderer) execute(t *template.Template, alert *models.Alert) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, Data{Alert: alert, location: r.location}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// parseDir parses every *.tmpl file in dir, keyed by file name without the
+// extension
+func parseDir(fsys fs.FS, dir string) (map[string]*template.Template, error) {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	parsed := make(map[string]*template.Template, len(paths))
+	for _, p := range paths {
+		key := strings.TrimSuffix(path.Base(p), ".tmpl")
+		if name, _, _ := strings.Cut(key, "."); !names[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown template name %q", p, name))
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t, err := template.New(key).Funcs(funcs).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		parsed[key] = t
+	}
+
+	return parsed, errors.Join(errs...)
+}
+
+// formatThousands formats an amount with two decimals and comma separators
+func formatThousands(amount float64) string {
+	s := fmt.Sprintf("%.2f", amount)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String() + "." + frac
+}
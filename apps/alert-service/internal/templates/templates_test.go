@@ -0,0 +1,343 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"alert-service/internal/enrichment"
+	"alert-service/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// alertFixture returns a high fraud alert raised at 09:30 UTC
+func alertFixture() *models.Alert {
+	return &models.Alert{
+		ID:            "alert-1",
+		TransactionID: "txn-1",
+		AccountID:     "acct-1",
+		UserID:        "user-1",
+		AlertType:     models.AlertTypeFraud,
+		Severity:      models.SeverityHigh,
+		RiskScore:     0.87,
+		Amount:        12500,
+		Currency:      "USD",
+		Description:   "Amount over the 10000 threshold",
+		RuleTriggered: "high_amount",
+		CreatedAt:     time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+// enrichedFixture returns alertFixture with the account context attached
+func enrichedFixture() *models.Alert {
+	alert := alertFixture()
+	alert.Metadata = map[string]string{
+		enrichment.KeyOpenedAt:       "2025-03-02T00:00:00Z",
+		enrichment.KeyWindowDays:     "30",
+		enrichment.KeyTransactions:   "42",
+		enrichment.KeyFlagged:        "3",
+		enrichment.KeyRiskScore:      "0.40",
+		enrichment.KeyRiskLevel:      "medium",
+		enrichment.KeyPreviousAlerts: "2",
+	}
+	return alert
+}
+
+// newTestRenderer returns a renderer of the templates in dir, in UTC
+func newTestRenderer(t *testing.T, dir string) *Renderer {
+	t.Helper()
+	r, err := NewRenderer(dir, time.UTC)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	return r
+}
+
+// writeTemplates writes files, keyed by name, to a new directory
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	return dir
+}
+
+// fallbacks returns the fallback count of template in the default registry
+func fallbacks(t *testing.T, template string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "alert_template_fallbacks_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "template" && label.GetValue() == template {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	compliance := alertFixture()
+	compliance.AlertType = models.AlertTypeCompliance
+
+	tests := []struct {
+		name  string
+		alert *models.Alert
+		want  string
+	}{
+		{Slack, alertFixture(), "🟠 *HIGH fraud alert*\n" +
+			"Amount over the 10000 threshold\n" +
+			"Rule: high_amount\n" +
+			"Risk score: 0.87\n" +
+			"Amount: $12,500.00\n" +
+			"Account: acct-1\n" +
+			"Transaction: txn-1\n" +
+			"User: user-1"},
+		{EmailSubject, alertFixture(), "[HIGH] fraud alert for account acct-1"},
+		{Email, alertFixture(), "HIGH fraud alert\n\n" +
+			"Amount over the 10000 threshold\n\n" +
+			"Rule:        high_amount\n" +
+			"Risk score:  0.87\n" +
+			"Amount:      $12,500.00\n" +
+			"Account:     acct-1\n" +
+			"Transaction: txn-1\n" +
+			"User:        user-1\n" +
+			"Raised at:   2026-03-02 09:30:00 UTC"},
+		{EmailSubject, compliance, "[HIGH] Compliance review required for account acct-1"},
+		{Email, compliance, "A transaction requires compliance review.\n\n" +
+			"Reason: Amount over the 10000 threshold\n\n" +
+			"Rule:        high_amount\n" +
+			"Amount:      $12,500.00\n" +
+			"Account:     acct-1\n" +
+			"Transaction: txn-1\n" +
+			"Raised at:   2026-03-02 09:30:00 UTC\n\n" +
+			"This notice is confidential. Do not inform the customer that a review is under way."},
+		{PagerDuty, alertFixture(), "high fraud alert for account acct-1: high_amount"},
+		{SMS, alertFixture(), "HIGH fraud alert: $12,500.00 on account acct-1, risk 0.87. high_amount - Amount over the 10000 threshold (alert-1)"},
+		{Console, alertFixture(), "🟠 HIGH fraud alert alert-1\n" +
+			"  Amount over the 10000 threshold\n" +
+			"  Rule:        high_amount\n" +
+			"  Risk score:  0.87\n" +
+			"  Amount:      $12,500.00\n" +
+			"  Account:     acct-1\n" +
+			"  Transaction: txn-1\n" +
+			"  User:        user-1\n" +
+			"  Raised at:   2026-03-02 09:30:00 UTC"},
+	}
+
+	r := newTestRenderer(t, "")
+	for _, tt := range tests {
+		t.Run(tt.name+"."+tt.alert.AlertType, func(t *testing.T) {
+			got, err := r.Render(tt.name, tt.alert)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultTemplatesIncludeAccountContext(t *testing.T) {
+	r := newTestRenderer(t, "")
+	context := "Account age: 365 days\n" +
+		"Transactions (30d): 42\n" +
+		"Flagged (30d): 3\n" +
+		"Account risk: 0.40 (medium)\n" +
+		"Previous alerts (30d): 2"
+
+	slack, err := r.Render(Slack, enrichedFixture())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.HasSuffix(slack, "\n\n*Account context*\n"+context) {
+		t.Errorf("slack message without the account context:\n%s", slack)
+	}
+
+	email, err := r.Render(Email, enrichedFixture())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.HasSuffix(email, "\n\nAccount context\n  "+strings.ReplaceAll(context, "\n", "\n  ")) {
+		t.Errorf("email without the account context:\n%s", email)
+	}
+}
+
+func TestFormattedAmount(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{12500, "USD", "$12,500.00"},
+		{1250, "gbp", "£1,250.00"},
+		{0.5, "EUR", "€0.50"},
+		{1234567.891, "JPY", "¥1,234,567.89"},
+		{999, "INR", "₹999.00"},
+		{-1500, "USD", "$-1,500.00"},
+		{100000, "CHF", "100,000.00 CHF"},
+		{42, "", "42.00"},
+	}
+	for _, tt := range tests {
+		data := Data{Alert: &models.Alert{Amount: tt.amount, Currency: tt.currency}}
+		if got := data.FormattedAmount(); got != tt.want {
+			t.Errorf("FormattedAmount(%v %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestSeverityEmoji(t *testing.T) {
+	emojis := map[string]string{
+		models.SeverityCritical: "🔴",
+		models.SeverityHigh:     "🟠",
+		models.SeverityMedium:   "🟡",
+		models.SeverityLow:      "🟢",
+		"unknown":               "🚨",
+	}
+	for severity, want := range emojis {
+		if got := (Data{Alert: &models.Alert{Severity: severity}}).SeverityEmoji(); got != want {
+			t.Errorf("emoji of %s = %s, want %s", severity, got, want)
+		}
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	r, err := NewRenderer("", london)
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	alert := alertFixture()
+	alert.CreatedAt = time.Date(2026, 7, 1, 9, 30, 0, 0, time.UTC)
+
+	got, err := r.Render(Email, alert)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(got, "Raised at:   2026-07-01 10:30:00 BST") {
+		t.Errorf("email not in London time:\n%s", got)
+	}
+}
+
+func TestCustomTemplatesOverrideDefaults(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"slack.tmpl":       "{{.Severity}} alert {{.ID}}",
+		"sms.fraud.tmpl":   "Fraud on {{.AccountID}}: {{.FormattedAmount}}",
+		"README.md":        "not a template",
+		"email.draft.tmpl": "{{.ID}}",
+	})
+	r := newTestRenderer(t, dir)
+
+	tests := []struct {
+		name      string
+		alertType string
+		want      string
+	}{
+		{Slack, models.AlertTypeFraud, "high alert alert-1"},
+		{Slack, models.AlertTypeRisk, "high alert alert-1"},
+		{SMS, models.AlertTypeFraud, "Fraud on acct-1: $12,500.00"},
+		{SMS, models.AlertTypeRisk, "HIGH risk alert: $12,500.00 on account acct-1, risk 0.87. high_amount - Amount over the 10000 threshold (alert-1)"},
+		{PagerDuty, models.AlertTypeFraud, "high fraud alert for account acct-1: high_amount"},
+	}
+	for _, tt := range tests {
+		alert := alertFixture()
+		alert.AlertType = tt.alertType
+		got, err := r.Render(tt.name, alert)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("%s of a %s alert = %q, want %q", tt.name, tt.alertType, got, tt.want)
+		}
+	}
+}
+
+func TestMalformedTemplatesFailAtStartup(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"slack.tmpl":  "{{.Severity",
+		"email.tmpl":  "{{if .Description}}unterminated",
+		"tweet.tmpl":  "{{.ID}}",
+		"sms.tmpl":    "{{.ID}}",
+		"console.txt": "{{",
+	})
+
+	r, err := NewRenderer(dir, time.UTC)
+	if err == nil {
+		t.Fatal("NewRenderer accepted malformed templates")
+	}
+	if r != nil {
+		t.Error("NewRenderer returned a renderer along with the error")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "invalid templates in "+dir+": ") {
+		t.Errorf("error %q does not name the directory", msg)
+	}
+	// Every bad template is reported, not only the first
+	for _, want := range []string{"slack", "email", `unknown template name "tweet"`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not report %s", msg, want)
+		}
+	}
+	if strings.Contains(msg, "sms") || strings.Contains(msg, "console") {
+		t.Errorf("error %q reports a valid or ignored file", msg)
+	}
+}
+
+func TestRenderFallsBackToDefault(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"slack.tmpl":           "{{.NoSuchField}}",
+		"pagerduty.fraud.tmpl": "{{.Metadata.missing}}",
+	})
+	r := newTestRenderer(t, dir)
+
+	before := fallbacks(t, "slack")
+	got, err := r.Render(Slack, alertFixture())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.HasPrefix(got, "🟠 *HIGH fraud alert*") {
+		t.Errorf("rendered %q, want the default message", got)
+	}
+	if n := fallbacks(t, "slack") - before; n != 1 {
+		t.Errorf("%v fallbacks recorded for slack, want 1", n)
+	}
+
+	// A type-specific override falls back to the generic default
+	alert := alertFixture()
+	alert.Metadata = map[string]string{}
+	before = fallbacks(t, "pagerduty.fraud")
+	got, err = r.Render(PagerDuty, alert)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got != "high fraud alert for account acct-1: high_amount" {
+		t.Errorf("rendered %q, want the default summary", got)
+	}
+	if n := fallbacks(t, "pagerduty.fraud") - before; n != 1 {
+		t.Errorf("%v fallbacks recorded for pagerduty.fraud, want 1", n)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := newTestRenderer(t, "").Render("fax", alertFixture()); err == nil || err.Error() != "no template named fax" {
+		t.Errorf("Render of an unknown template = %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package watchlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"alert-service/internal/evaluator"
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// notWatchlisted is cached for accounts without an entry
+const notWatchlisted = "none"
+
+// Store reads watchlist entries
+type Store interface {
+	GetWatchlistEntry(ctx context.Context, accountID string, now time.Time) (*models.WatchlistEntry, error)
+}
+
+// Config configures a Watchlist
+type Config struct {
+	// Severity is the severity of watchlist alerts
+	Severity string
+	// BypassRateLimit exempts watchlist alerts from the account rate limit
+	BypassRateLimit bool
+	// CacheTTL is how long a lookup is cached
+	CacheTTL time.Duration
+}
+
+// Watchlist raises an alert for every transaction on a watchlisted account,
+// whatever its risk. Lookups, including misses, are cached in Redis so
+// every replica shares them; without Redis every lookup reads the
+// database. An entry is cached no longer than until it expires, and
+// Invalidate drops a changed one.
+type Watchlist struct {
+	store Store
+	redis *redis.Client
+	cfg   Config
+}
+
+// New creates a watchlist. redisClient may be nil.
+func New(store Store, redisClient *redis.Client, cfg Config) *Watchlist {
+	return &Watchlist{store: store, redis: redisClient, cfg: cfg}
+}
+
+// Evaluate returns the alert match of a transaction on a watchlisted
+// account, or nil when the account is not watchlisted
+func (w *Watchlist) Evaluate(ctx context.Context, txn *models.ProcessedTransaction) (*evaluator.Match, error) {
+	entry, err := w.Lookup(ctx, txn.AccountID)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("account %s is on the watchlist: %s", txn.AccountID, entry.Reason)
+	alert := evaluator.NewAlert(txn, models.AlertTypeRisk, w.cfg.Severity, models.RuleWatchlist, description)
+	// A transaction may also raise a rule or threshold alert of its own
+	alert.ID = "alert_watchlist_" + txn.ID
+	alert.Metadata = map[string]string{
+		"watchlist_reason":   entry.Reason,
+		"watchlist_added_by": entry.CreatedBy,
+	}
+	return &evaluator.Match{Alert: alert, Unlimited: w.cfg.BypassRateLimit}, nil
+}
+
+// Lookup returns the entry of an account in effect now, or nil when it is
+// not watchlisted
+func (w *Watchlist) Lookup(ctx context.Context, accountID string) (*models.WatchlistEntry, error) {
+	now := time.Now()
+
+	entry, cached, err := w.cached(ctx, accountID)
+	if err != nil {
+		// The cache is an optimisation; the database still answers
+		slog.WarnContext(ctx, "watchlist cache unavailable", "error", err)
+	}
+	if !cached {
+		entry, err = w.store.GetWatchlistEntry(ctx, accountID, now)
+		if errors.Is(err, storage.ErrWatchlistEntryNotFound) {
+			entry = nil
+		} else if err != nil {
+			return nil, err
+		}
+		w.cache(ctx, accountID, entry, now)
+	}
+
+	if entry != nil && !entry.Active(now) {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Invalidate drops the cached lookup of an account after its entry changed
+func (w *Watchlist) Invalidate(ctx context.Context, accountID string) {
+	if w.redis == nil {
+		return
+	}
+	if err := w.redis.Del(ctx, cacheKey(accountID)).Err(); err != nil {
+		slog.WarnContext(ctx, "failed to invalidate watchlist cache", "account_id", accountID, "error", err)
+	}
+}
+
+// cached returns the cached lookup of an account, reporting whether there
+// was one
+func (w *Watchlist) cached(ctx context.Context, accountID string) (*models.WatchlistEntry, bool, error) {
+	if w.redis == nil {
+		return nil, false, nil
+	}
+
+	data, err := w.redis.Get(ctx, cacheKey(accountID)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read watchlist cache: %w", err)
+	}
+	if string(data) == notWatchlisted {
+		return nil, true, nil
+	}
+
+	var entry models.WatchlistEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached watchlist entry: %w", err)
+	}
+	return &entry, true, nil
+}
+
+// cache caches the lookup of an account for the cache TTL, or until its
+// entry expires when that is sooner
+func (w *Watchlist) cache(ctx context.Context, accountID string, entry *models.WatchlistEntry, now time.Time) {
+	ttl := w.cfg.CacheTTL
+	if entry != nil && entry.ExpiresAt != nil {
+		ttl = min(ttl, entry.ExpiresAt.Sub(now))
+	}
+	if w.redis == nil || ttl <= 0 {
+		return
+	}
+
+	value := []byte(notWatchlisted)
+	if entry != nil {
+		var err error
+		if value, err = json.Marshal(entry); err != nil {
+			slog.WarnContext(ctx, "failed to encode watchlist entry", "error", err)
+			return
+		}
+	}
+	if err := w.redis.Set(ctx, cacheKey(accountID), value, ttl).Err(); err != nil {
+		slog.WarnContext(ctx, "failed to cache watchlist entry", "error", err)
+	}
+}
+
+func cacheKey(accountID string) string {
+	return "alert:watchlist:" + accountID
+}
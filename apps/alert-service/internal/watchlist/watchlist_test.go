@@ -0,0 +1,229 @@
+package watchlist
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/models"
+	"alert-service/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeStore holds watchlist entries in memory, counting its reads
+type fakeStore struct {
+	mu      sync.Mutex
+	entries map[string]*models.WatchlistEntry
+	err     error
+	reads   int
+}
+
+func newFakeStore(entries ...*models.WatchlistEntry) *fakeStore {
+	s := &fakeStore{entries: make(map[string]*models.WatchlistEntry)}
+	for _, e := range entries {
+		s.entries[e.AccountID] = e
+	}
+	return s
+}
+
+func (s *fakeStore) GetWatchlistEntry(_ context.Context, accountID string, now time.Time) (*models.WatchlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	if s.err != nil {
+		return nil, s.err
+	}
+	e, ok := s.entries[accountID]
+	if !ok || !e.Active(now) {
+		return nil, storage.ErrWatchlistEntryNotFound
+	}
+	return e, nil
+}
+
+func (s *fakeStore) remove(accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, accountID)
+}
+
+func (s *fakeStore) readCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+// entry returns the entry of an account expiring at expiresAt, never when
+// zero
+func entry(accountID, reason string, expiresAt time.Time) *models.WatchlistEntry {
+	e := &models.WatchlistEntry{AccountID: accountID, Reason: reason, CreatedBy: "analyst-1", CreatedAt: time.Now()}
+	if !expiresAt.IsZero() {
+		e.ExpiresAt = &expiresAt
+	}
+	return e
+}
+
+// newTestRedis returns a client of mr, closed when the test ends
+func newTestRedis(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// testConfig raises high alerts exempt from the rate limit
+var testConfig = Config{Severity: models.SeverityHigh, BypassRateLimit: true, CacheTTL: time.Minute}
+
+// transaction returns a low risk transaction on an account
+func transaction(id, accountID string) *models.ProcessedTransaction {
+	txn := &models.ProcessedTransaction{}
+	txn.ID = id
+	txn.AccountID = accountID
+	txn.Amount = 42
+	txn.Currency = "USD"
+	txn.RiskScore = 0.05
+	txn.ProcessedAt = time.Now()
+	return txn
+}
+
+func TestEvaluate(t *testing.T) {
+	store := newFakeStore(
+		entry("acct-followed", "linked to mule ring case 118", time.Time{}),
+		entry("acct-expired", "old case", time.Now().Add(-time.Hour)),
+		entry("acct-expiring", "short follow", time.Now().Add(time.Hour)),
+	)
+	w := New(store, nil, testConfig)
+
+	tests := []struct {
+		accountID string
+		hit       bool
+	}{
+		{"acct-followed", true},
+		{"acct-expiring", true},
+		{"acct-expired", false},
+		{"acct-unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accountID, func(t *testing.T) {
+			match, err := w.Evaluate(context.Background(), transaction("txn-1", tt.accountID))
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if (match != nil) != tt.hit {
+				t.Fatalf("match = %v, want hit %v", match, tt.hit)
+			}
+		})
+	}
+
+	// A hit alerts whatever the transaction's risk score
+	match, _ := w.Evaluate(context.Background(), transaction("txn-1", "acct-followed"))
+	alert := match.Alert
+	if alert.ID != "alert_watchlist_txn-1" || alert.AlertType != models.AlertTypeRisk || alert.Severity != models.SeverityHigh ||
+		alert.RuleTriggered != models.RuleWatchlist {
+		t.Errorf("alert = %+v", alert)
+	}
+	if !strings.Contains(alert.Description, "linked to mule ring case 118") {
+		t.Errorf("description %q, want the watchlist reason", alert.Description)
+	}
+	if alert.Metadata["watchlist_reason"] != "linked to mule ring case 118" || alert.Metadata["watchlist_added_by"] != "analyst-1" {
+		t.Errorf("metadata = %v", alert.Metadata)
+	}
+	if !match.Unlimited {
+		t.Error("watchlist alert is rate limited, want it to bypass the limit")
+	}
+
+	limited := New(store, nil, Config{Severity: models.SeverityCritical, CacheTTL: time.Minute})
+	match, _ = limited.Evaluate(context.Background(), transaction("txn-1", "acct-followed"))
+	if match.Unlimited || match.Alert.Severity != models.SeverityCritical {
+		t.Errorf("match %+v, want a rate limited critical alert", match)
+	}
+}
+
+func TestLookupsAreCached(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newFakeStore(entry("acct-1", "case 7", time.Time{}))
+	w := New(store, newTestRedis(t, mr), testConfig)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if e, err := w.Lookup(ctx, "acct-1"); err != nil || e == nil {
+			t.Fatalf("Lookup(acct-1) = %v, %v", e, err)
+		}
+		// Misses are cached too
+		if e, err := w.Lookup(ctx, "acct-2"); err != nil || e != nil {
+			t.Fatalf("Lookup(acct-2) = %v, %v", e, err)
+		}
+	}
+	if n := store.readCount(); n != 2 {
+		t.Errorf("%d database reads, want one per account", n)
+	}
+	if ttl := mr.TTL(cacheKey("acct-2")); ttl != time.Minute {
+		t.Errorf("miss cached for %s, want the cache TTL", ttl)
+	}
+
+	// A removed entry is dropped from the cache
+	store.remove("acct-1")
+	w.Invalidate(ctx, "acct-1")
+	if e, _ := w.Lookup(ctx, "acct-1"); e != nil {
+		t.Errorf("Lookup after removal = %+v, want nil", e)
+	}
+}
+
+func TestCachedEntriesDropOutWhenTheyExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newFakeStore(entry("acct-1", "case 7", time.Now().Add(time.Second)))
+	w := New(store, newTestRedis(t, mr), Config{Severity: models.SeverityHigh, CacheTTL: time.Hour})
+	ctx := context.Background()
+
+	if e, _ := w.Lookup(ctx, "acct-1"); e == nil {
+		t.Fatal("Lookup = nil, want the entry before it expires")
+	}
+	if ttl := mr.TTL(cacheKey("acct-1")); ttl <= 0 || ttl > time.Second {
+		t.Errorf("entry cached for %s, want no longer than until it expires", ttl)
+	}
+
+	// Past its expiry, the entry is neither cached nor in effect
+	time.Sleep(1100 * time.Millisecond)
+	mr.FastForward(time.Second)
+	if e, _ := w.Lookup(ctx, "acct-1"); e != nil {
+		t.Errorf("Lookup after expiry = %+v, want nil", e)
+	}
+}
+
+func TestExpiredCachedEntryIsNotInEffect(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newFakeStore(entry("acct-1", "case 7", time.Now().Add(time.Hour)))
+	w := New(store, newTestRedis(t, mr), testConfig)
+
+	// An entry left cached past its expiry
+	expired := entry("acct-1", "case 7", time.Now().Add(-time.Second))
+	data := `{"account_id":"acct-1","reason":"case 7","expires_at":"` + expired.ExpiresAt.UTC().Format(time.RFC3339Nano) + `"}`
+	mr.Set(cacheKey("acct-1"), data)
+
+	if e, err := w.Lookup(context.Background(), "acct-1"); err != nil || e != nil {
+		t.Errorf("Lookup = %+v, %v, want the expired entry ignored", e, err)
+	}
+}
+
+func TestLookupFailures(t *testing.T) {
+	store := newFakeStore(entry("acct-1", "case 7", time.Time{}))
+	ctx := context.Background()
+
+	// Without Redis the database answers
+	mr := miniredis.RunT(t)
+	client := newTestRedis(t, mr)
+	mr.Close()
+	if e, err := New(store, client, testConfig).Lookup(ctx, "acct-1"); err != nil || e == nil {
+		t.Errorf("Lookup with Redis down = %v, %v, want the entry from the database", e, err)
+	}
+
+	// A failing database is reported
+	store.err = errors.New("connection refused")
+	if _, err := New(store, nil, testConfig).Evaluate(ctx, transaction("txn-1", "acct-1")); err == nil {
+		t.Error("Evaluate succeeded with the database down")
+	}
+}
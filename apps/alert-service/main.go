@@ -3,39 +3,32 @@ package main
 import (
 	"context"
 	"log"
-	"os"
-	"os/signal"
-	"syscall"
 
-	"alert-service/internal/config"
-	"alert-service/internal/consumer"
-	"alert-service/internal/handler"
+	"alert-service/app"
+	"alert-service/internal/metrics"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
 )
 
 func main() {
-	// Load config
-	cfg := config.LoadConfig()
-
-	// Initialize handler
-	alertHandler := handler.NewAlertHandler(cfg.SlackWebhook)
-
-	// Setup Kafka consumer
-	cons := consumer.NewConsumer(cfg.KafkaBrokers, cfg.ConsumerGroup, cfg.InputTopic, alertHandler)
-	defer cons.Close()
+	// Structured logging; the standard log package writes through it too
+	logging.Setup("alert-service")
+	log.Printf("Starting %s", buildinfo.Get("alert-service"))
+	metrics.SetBuildInfo()
 
-	// Run consumer
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		if err := cons.Start(ctx); err != nil && ctx.Err() == nil {
-			log.Printf("consumer error: %v", err)
-		}
-	}()
-
-	// Graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
-
-	log.Println("Shutting down alert-service...")
-	cancel()
+	// Load config
+	cfg, err := app.LoadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	if cfg.LogConfigOnStart {
+		log.Printf("Effective configuration: %s", cfg)
+	}
+
+	// Run until SIGINT or SIGTERM
+	if err := app.Run(context.Background(), cfg); err != nil {
+		log.Fatalf("alert-service failed:\n%v", err)
+	}
+	log.Println("alert-service exited gracefully")
 }
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/redis"
+)
+
+// idempotencyKeysPage is the default number of keys listed per page
+const idempotencyKeysPage = 100
+
+// idempotencyKeyResponse describes a cached idempotency key
+type idempotencyKeyResponse struct {
+	Key        string                     `json:"key"`
+	UserID     string                     `json:"user_id,omitempty"`
+	TTLSeconds int64                      `json:"ttl_seconds"` // -1 when it never expires
+	Response   models.TransactionResponse `json:"response"`
+}
+
+// idempotencyKeysResponse is a page of the idempotency keys of a user
+type idempotencyKeysResponse struct {
+	UserID     string   `json:"user_id"`
+	Keys       []string `json:"keys"`
+	NextCursor uint64   `json:"next_cursor"` // zero after the last page
+}
+
+// GetIdempotencyKeyHandler returns the response cached under an idempotency
+// key, its TTL and the user who made the request
+func GetIdempotencyKeyHandler(redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		entry, ok := lookupIdempotencyKey(w, r, redisClient, key)
+		auditIdempotency(r, "inspect", "key", key, "found", ok)
+		if !ok {
+			return
+		}
+
+		ttl, err := redisClient.IdempotencyKeyTTL(r.Context(), key)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "failed to read idempotency key")
+			return
+		}
+		ttlSeconds := int64(-1)
+		if ttl >= 0 {
+			ttlSeconds = int64(ttl / time.Second)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(idempotencyKeyResponse{
+			Key:        key,
+			UserID:     entry.UserID,
+			TTLSeconds: ttlSeconds,
+			Response:   entry.TransactionResponse,
+		})
+	}
+}
+
+// DeleteIdempotencyKeyHandler purges an idempotency key, so a retry of the
+// request is processed again
+func DeleteIdempotencyKeyHandler(redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		entry, ok := lookupIdempotencyKey(w, r, redisClient, key)
+		if !ok {
+			auditIdempotency(r, "purge", "key", key, "found", false)
+			return
+		}
+
+		deleted, err := redisClient.DeleteIdempotencyKey(r.Context(), key, entry.UserID)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete idempotency key")
+			return
+		}
+		auditIdempotency(r, "purge", "key", key, "found", deleted, "owner_user_id", entry.UserID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListIdempotencyKeysHandler lists a page of the idempotency keys of the
+// user named by user_id. The page starts at cursor and holds about count
+// keys; next_cursor is zero after the last page.
+func ListIdempotencyKeysHandler(redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		userID := query.Get("user_id")
+		if userID == "" {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeMissingRequiredFields, "user_id is required",
+				apierror.Detail{Field: "user_id", Code: apierror.CodeMissingRequiredFields, Message: "is required"})
+			return
+		}
+		var cursor uint64
+		if v := query.Get("cursor"); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidParameter, "invalid cursor",
+					apierror.Detail{Field: "cursor", Code: apierror.CodeInvalidParameter, Message: "must be an unsigned integer"})
+				return
+			}
+			cursor = parsed
+		}
+		count := int64(idempotencyKeysPage)
+		if v := query.Get("count"); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || parsed <= 0 {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidParameter, "invalid count",
+					apierror.Detail{Field: "count", Code: apierror.CodeInvalidParameter, Message: "must be a positive integer"})
+				return
+			}
+			count = parsed
+		}
+
+		keys, next, err := redisClient.ScanUserIdempotencyKeys(r.Context(), userID, cursor, count)
+		auditIdempotency(r, "list", "owner_user_id", userID, "cursor", cursor)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "failed to list idempotency keys")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(idempotencyKeysResponse{
+			UserID:     userID,
+			Keys:       keys,
+			NextCursor: next,
+		})
+	}
+}
+
+// lookupIdempotencyKey reads and decodes the entry cached under key. When it
+// is missing or unreadable it writes the error response and returns false.
+func lookupIdempotencyKey(w http.ResponseWriter, r *http.Request, redisClient *redis.Client, key string) (models.IdempotencyEntry, bool) {
+	var entry models.IdempotencyEntry
+	data, err := redisClient.GetIdempotencyKey(r.Context(), key)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "failed to read idempotency key")
+		return entry, false
+	}
+	if data == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "idempotency key not found")
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "invalid cached response")
+		return entry, false
+	}
+	return entry, true
+}
+
+// auditIdempotency logs an idempotency cache operation with the admin who
+// performed it
+func auditIdempotency(r *http.Request, action string, args ...interface{}) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	args = append([]interface{}{
+		"action", action,
+		"admin_user_id", claims.UserID,
+		"remote_addr", r.RemoteAddr,
+	}, args...)
+	slog.Info("idempotency admin", args...)
+}
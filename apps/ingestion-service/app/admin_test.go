@@ -0,0 +1,182 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/middleware"
+	"ingestion-service/internal/publisher/fake"
+
+	"github.com/gorilla/mux"
+)
+
+var admin = &auth.Claims{UserID: "admin-1", Roles: []string{"admin"}}
+
+// captureLogs sends the default logger's records to a buffer until the test
+// ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// serveAdmin sends a request of method to path, with the idempotency key
+// route variable, on behalf of admin
+func serveAdmin(handler http.HandlerFunc, method, path, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r = r.WithContext(auth.WithClaims(r.Context(), admin))
+	if key != "" {
+		r = mux.SetURLVars(r, map[string]string{"key": key})
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestInspectAndPurgeAnIdempotencyKey(t *testing.T) {
+	logs := captureLogs(t)
+	client, mr := newRedis(t)
+
+	// A request cached by the middleware is recorded with its user
+	idempotency := middleware.NewIdempotencyMiddleware(client, time.Hour)
+	ingest := idempotency.Wrap(newIngestHandler(t, fake.New()))
+	body, err := json.Marshal(transactionRequest(""))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", bytes.NewReader(body))
+	r.Header.Set("Idempotency-Key", "key-1")
+	r = r.WithContext(auth.WithClaims(r.Context(), user))
+	w := httptest.NewRecorder()
+	ingest(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("ingest status %d, want 202: %s", w.Code, w.Body)
+	}
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&accepted); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	mr.FastForward(10 * time.Minute)
+
+	w = serveAdmin(GetIdempotencyKeyHandler(client), http.MethodGet, "/api/v1/admin/idempotency/key-1", "key-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status %d, want 200: %s", w.Code, w.Body)
+	}
+	var got idempotencyKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.Key != "key-1" || got.UserID != user.UserID || got.TTLSeconds != 50*60 || got.Response.ID != accepted.ID {
+		t.Errorf("GET = %+v, want key-1 of %s with 50m left, cached as %s", got, user.UserID, accepted.ID)
+	}
+
+	w = serveAdmin(DeleteIdempotencyKeyHandler(client), http.MethodDelete, "/api/v1/admin/idempotency/key-1", "key-1")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status %d, want 204: %s", w.Code, w.Body)
+	}
+	if mr.Exists("idempotency:key-1") {
+		t.Error("key still cached after DELETE")
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		handler := GetIdempotencyKeyHandler(client)
+		if method == http.MethodDelete {
+			handler = DeleteIdempotencyKeyHandler(client)
+		}
+		w := serveAdmin(handler, method, "/api/v1/admin/idempotency/key-1", "key-1")
+		if w.Code != http.StatusNotFound || errorCode(t, w) != apierror.CodeNotFound {
+			t.Errorf("%s of a purged key = %d, want 404", method, w.Code)
+		}
+	}
+
+	// Every operation is audited with the admin who performed it
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record["msg"] != "idempotency admin" {
+			continue
+		}
+		if record["admin_user_id"] != admin.UserID || record["key"] != "key-1" {
+			t.Errorf("audit record %s, want admin-1 on key-1", line)
+		}
+		actions = append(actions, record["action"].(string))
+	}
+	if got := strings.Join(actions, ","); got != "inspect,purge,inspect,purge" {
+		t.Errorf("audited %s, want inspect,purge,inspect,purge", got)
+	}
+
+	// The retry is processed afresh
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/transactions", bytes.NewReader(body))
+	r.Header.Set("Idempotency-Key", "key-1")
+	r = r.WithContext(auth.WithClaims(r.Context(), user))
+	w = httptest.NewRecorder()
+	ingest(w, r)
+	if w.Code != http.StatusAccepted || w.Header().Get("X-Idempotency-Cache") != "" {
+		t.Errorf("retry after the purge = %d from the cache %q, want processed", w.Code, w.Header().Get("X-Idempotency-Cache"))
+	}
+}
+
+func TestListIdempotencyKeys(t *testing.T) {
+	logs := captureLogs(t)
+	client, _ := newRedis(t)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		if err := client.SetIdempotencyKey(t.Context(), key, "user-1", struct{}{}, time.Hour); err != nil {
+			t.Fatalf("SetIdempotencyKey: %v", err)
+		}
+	}
+	handler := ListIdempotencyKeysHandler(client)
+
+	w := serveAdmin(handler, http.MethodGet, "/api/v1/admin/idempotency?user_id=user-1&count=10", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var page idempotencyKeysResponse
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if page.UserID != "user-1" || len(page.Keys) != 3 || page.NextCursor != 0 {
+		t.Errorf("page = %+v, want the 3 keys of user-1 and no more", page)
+	}
+	if !strings.Contains(logs.String(), `"action":"list","admin_user_id":"admin-1"`) ||
+		!strings.Contains(logs.String(), `"owner_user_id":"user-1"`) {
+		t.Errorf("logs = %s, want the listing audited", logs)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"no user", "", "user_id"},
+		{"malformed cursor", "?user_id=user-1&cursor=next", "cursor"},
+		{"zero count", "?user_id=user-1&count=0", "count"},
+		{"negative count", "?user_id=user-1&count=-5", "count"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAdmin(handler, http.MethodGet, "/api/v1/admin/idempotency"+tt.query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", w.Code)
+			}
+			var envelope apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if details := envelope.Error.Details; len(details) != 1 || details[0].Field != tt.field {
+				t.Errorf("details = %+v, want one on %s", details, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,892 @@
+// Package app runs the ingestion service. Its main package and the
+// end-to-end tests start it through Run.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/openapi"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/startup"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/callback"
+	"ingestion-service/internal/config"
+	"ingestion-service/internal/duplicates"
+	"ingestion-service/internal/metadata"
+	"ingestion-service/internal/middleware"
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/outbox"
+	"ingestion-service/internal/publisher"
+	"ingestion-service/internal/redis"
+)
+
+// serviceName identifies the service in build information
+const serviceName = "ingestion-service"
+
+// serverWriteGrace is how long past the longest route deadline the server
+// waits for a response to be written, leaving time for the timeout response
+const serverWriteGrace = 5 * time.Second
+
+// idempotencyTTL is how long idempotency keys are remembered, of requests
+// and of the transactions of batches
+const idempotencyTTL = 24 * time.Hour
+
+// Config is the configuration of the service
+type Config = config.Config
+
+// LoadConfig loads the configuration from the environment and validates it
+func LoadConfig() (*Config, error) {
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Run waits for the dependencies of cfg, serves the API and runs the
+// producer or outbox relay until ctx is done or the process is signalled,
+// then shuts them down in order. It returns the errors of a failed start or
+// an unclean shutdown.
+func Run(ctx context.Context, cfg *Config) error {
+	// Components register as they are created, to be stopped in order on
+	// shutdown
+	lc := lifecycle.New(time.Duration(cfg.ShutdownDeadline)*time.Second, nil)
+
+	// Build the Kafka connection settings, failing on bad TLS or SASL config
+	kafkaConn, err := cfg.KafkaSecurity.Connect()
+	if err != nil {
+		return fmt.Errorf("invalid Kafka security config: %w", err)
+	}
+
+	// Wait for Redis, Kafka and, in outbox mode, the outbox database, which
+	// may still be starting
+	redisProbe := cfg.Redis.NewClient()
+	dependencies := []startup.Check{
+		{Name: "redis", Probe: func(ctx context.Context) error {
+			return redisconn.Ping(ctx, redisProbe)
+		}},
+		{Name: "kafka", Probe: func(ctx context.Context) error {
+			return kafkaConn.Ping(ctx, strings.Split(cfg.KafkaBrokers, ","))
+		}},
+	}
+	if cfg.IngestMode == config.IngestModeOutbox {
+		dependencies = append(dependencies, startup.Check{Name: "postgres", Probe: func(ctx context.Context) error {
+			return outbox.Ping(ctx, cfg.OutboxDatabaseURL)
+		}})
+	}
+	err = startup.Wait(ctx, time.Duration(cfg.StartupTimeout)*time.Second, nil, dependencies...)
+	redisProbe.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	// Create the topics the service produces to with their partitions,
+	// replication and retention, when provisioning is enabled
+	provisionCtx, cancelProvision := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout)*time.Second)
+	err = cfg.KafkaTopics.ProvisionTopics(provisionCtx, kafkaConn, strings.Split(cfg.KafkaBrokers, ","), cfg.OutputTopics(), nil)
+	cancelProvision()
+	if err != nil {
+		return fmt.Errorf("failed to provision Kafka topics: %w", err)
+	}
+
+	// Setup Redis client, skipping Redis behind a circuit breaker while it
+	// keeps failing
+	redisClient, err := redis.NewClient(cfg.Redis, redis.BreakerConfig{
+		Threshold:     cfg.RedisBreakerThreshold,
+		Cooldown:      time.Duration(cfg.RedisBreakerCooldown) * time.Second,
+		OpTimeout:     time.Duration(cfg.RedisOpTimeout) * time.Millisecond,
+		OnStateChange: middleware.RecordRedisBreakerTransition,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Redis client: %w", err)
+	}
+	lc.Add(lifecycle.Closer("redis", lifecycle.Stores, redisClient.Close))
+
+	// Setup JWT manager, reloading the secret when its file is rotated
+	jwtManager := auth.NewJWTManager(cfg.JWTKeyID, cfg.JWTSecret, cfg.JWTPreviousSecrets, cfg.JWTExpiration)
+
+	// Report whether Redis stays reachable, as failovers come and go
+	middleware.SetRedisUp(true)
+	lc.Add(lifecycle.Background("redis health", func(ctx context.Context) {
+		redisClient.Watch(ctx, redisconn.HealthInterval, middleware.SetRedisUp)
+	}))
+	if cfg.JWTSecretFile != "" {
+		lc.Add(lifecycle.Background("jwt secret reload", func(ctx context.Context) {
+			secrets.Watch(ctx, cfg.JWTSecretFile, time.Duration(cfg.SecretsReloadInterval)*time.Second, jwtManager.SetSecret)
+		}))
+	}
+
+	// Setup load shedding, fed the delivery latencies of the producer. In
+	// outbox mode a transaction is accepted once stored, so Kafka latency
+	// does not hold up requests and nothing is shed.
+	loadShedder := middleware.NewLoadShedder(cfg.BackpressureEnabled && cfg.IngestMode == config.IngestModeDirect, middleware.LoadShedderConfig{
+		LatencyThreshold: time.Duration(cfg.BackpressureLatencyMs) * time.Millisecond,
+		QueueThreshold:   cfg.BackpressureQueueMax,
+		ShedPercent:      cfg.BackpressureShedPercent,
+		RecoveryRatio:    cfg.BackpressureRecoveryRatio,
+		Window:           time.Duration(cfg.BackpressureWindow) * time.Second,
+		RetryAfter:       time.Duration(cfg.BackpressureRetryAfter) * time.Second,
+		Interval:         time.Second,
+	})
+
+	// Accepted transactions go straight to Kafka, or in outbox mode to the
+	// outbox database, from where the relay publishes them
+	var sink Sink
+	var store *outbox.Store
+	if cfg.IngestMode == config.IngestModeOutbox {
+		store, err = outbox.Open(cfg.OutboxDatabaseURL)
+		if err != nil {
+			return fmt.Errorf("failed to open outbox: %w", err)
+		}
+		lc.Add(lifecycle.Closer("outbox database", lifecycle.Stores, store.Close))
+
+		// The relay stops before its writer is closed; whatever it has
+		// not published is published on the next start
+		relay := outbox.NewRelay(store, cfg.KafkaBrokers, kafkaConn.Dialer,
+			time.Duration(cfg.OutboxPollInterval)*time.Millisecond,
+			cfg.OutboxBatchSize,
+			time.Duration(cfg.OutboxRetention)*time.Hour)
+		lc.Add(
+			lifecycle.Closer("outbox relay writer", lifecycle.Producers, relay.Close),
+			lifecycle.Component{Name: "outbox relay", Group: lifecycle.Producers, Start: func(ctx context.Context) error {
+				relay.Run(ctx)
+				return nil
+			}},
+		)
+		sink = store
+		log.Println("Ingest mode outbox: transactions are stored before they are published")
+	} else {
+		producer, err := publisher.NewProducer(cfg.KafkaBrokers, kafkaConn.Dialer, cfg.KafkaWriter, loadShedder)
+		if err != nil {
+			return fmt.Errorf("failed to create Kafka producer: %w", err)
+		}
+		// Closing the producer flushes the messages it still holds
+		lc.Add(lifecycle.Closer("kafka producer", lifecycle.Producers, producer.Close))
+		lc.Add(lifecycle.Background("load shedder", func(ctx context.Context) {
+			loadShedder.Run(ctx, producer.Queued)
+		}))
+		sink = producer
+	}
+
+	// Setup duplicate detection by content, which catches retries sent with
+	// a fresh idempotency key
+	duplicateDetector := duplicates.NewDetector(redisClient, cfg.DuplicateDetection, cfg.DuplicateHashFields,
+		time.Duration(cfg.DuplicateWindow)*time.Second)
+	if cfg.DuplicateDetection != duplicates.ModeOff {
+		log.Printf("Duplicate detection %s: hashing %v over %ds", cfg.DuplicateDetection, cfg.DuplicateHashFields, cfg.DuplicateWindow)
+	}
+
+	// Setup middleware
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(redisClient, idempotencyTTL)
+	authLockout := middleware.NewAuthLockout(cfg.AuthLockoutEnabled, redisClient, middleware.AuthLockoutConfig{
+		Threshold:         cfg.AuthLockoutThreshold,
+		Window:            time.Duration(cfg.AuthLockoutWindow) * time.Second,
+		Cooldown:          time.Duration(cfg.AuthLockoutCooldown) * time.Second,
+		TokenLimit:        cfg.AuthTokenRateLimit,
+		TokenWindow:       time.Duration(cfg.AuthTokenRateWindow) * time.Second,
+		TrustForwardedFor: cfg.TrustForwardedFor,
+	})
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager, authLockout)
+	metricsMiddleware := middleware.NewMetricsMiddleware()
+
+	// Setup router
+	router := mux.NewRouter()
+	router.Use(middleware.VersionHeader)
+
+	// Health check endpoint
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	}).Methods("GET")
+
+	// Readiness check, failing while the pipeline is saturated or the
+	// outbox database is unreachable so the load balancer drains the
+	// instance
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if loadShedder.Shedding() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "saturated"})
+			return
+		}
+		if store != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+			defer cancel()
+			if err := store.Ping(ctx); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]string{"status": "outbox unavailable"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	}).Methods("GET")
+
+	// Build information
+	router.HandleFunc("/version", buildinfo.Handler(serviceName)).Methods("GET")
+
+	// Metrics endpoint for Prometheus
+	if cfg.MetricsEnabled {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
+
+	// Protected API routes, each abandoned with 503 past its deadline
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	deadline := func(path string) func(http.HandlerFunc) http.HandlerFunc {
+		return middleware.Timeout(path, cfg.RouteTimeout(path))
+	}
+
+	// Transaction ingestion endpoint with all middleware
+	apiRouter.HandleFunc("/transactions",
+		metricsMiddleware.Wrap(
+			deadline("/api/v1/transactions")(
+				authMiddleware.RequireAuth(
+					idempotencyMiddleware.Wrap(
+						loadShedder.Wrap(
+							authMiddleware.RequireAnyRole("teller", "admin")(
+								IngestTransactionHandler(sink, cfg.KafkaTopic, cfg.AllowedTenants, cfg.SupportedCurrencies, cfg.CallbackHosts, cfg.MetadataLimits, duplicateDetector),
+							),
+						),
+					),
+				),
+			),
+		),
+	).Methods("POST")
+
+	// Batch transaction ingestion endpoint
+	apiRouter.HandleFunc("/transactions/batch",
+		metricsMiddleware.Wrap(
+			deadline("/api/v1/transactions/batch")(
+				authMiddleware.RequireAuth(
+					idempotencyMiddleware.WrapBatch(
+						authMiddleware.RequireRole("admin")(
+							IngestBatchTransactionHandler(sink, cfg.KafkaTopic, cfg.AllowedTenants, cfg.SupportedCurrencies, cfg.CallbackHosts, cfg.MetadataLimits, duplicateDetector, redisClient, idempotencyTTL),
+						),
+					),
+				),
+			),
+		),
+	).Methods("POST")
+
+	// Idempotency cache administration, audited to the log. The routes are
+	// not measured, as the metrics are labelled by path, which holds the key.
+	requireAdmin := func(h http.HandlerFunc) http.HandlerFunc {
+		return deadline("/api/v1/admin/idempotency")(authMiddleware.RequireAuth(authMiddleware.RequireRole("admin")(h)))
+	}
+	apiRouter.HandleFunc("/admin/idempotency", requireAdmin(ListIdempotencyKeysHandler(redisClient))).Methods("GET")
+	apiRouter.HandleFunc("/admin/idempotency/{key}", requireAdmin(GetIdempotencyKeyHandler(redisClient))).Methods("GET")
+	apiRouter.HandleFunc("/admin/idempotency/{key}", requireAdmin(DeleteIdempotencyKeyHandler(redisClient))).Methods("DELETE")
+
+	// JWT token generation endpoint (for testing), limited per client IP
+	if cfg.TokenEndpointEnabled {
+		mint := TokenHandler(jwtManager, authMiddleware, cfg.AllowedTenants, cfg.DevMode)
+		apiRouter.HandleFunc("/auth/token",
+			metricsMiddleware.Wrap(
+				deadline("/api/v1/auth/token")(
+					authLockout.LimitTokenRequests(mint),
+				),
+			),
+		).Methods("POST")
+	}
+
+	// API description, with a Swagger UI page to browse it when enabled
+	router.HandleFunc("/openapi.json", apiDocument().Handler()).Methods("GET")
+	if cfg.APIDocsEnabled {
+		router.HandleFunc("/docs", openapi.DocsHandler("Transaction Ingestion API", "/openapi.json")).Methods("GET")
+	}
+
+	// Start HTTP server. Reading a request and writing its response may
+	// take as long as the longest route deadline, plus a grace period for
+	// the timeout response itself; each route is held to its own deadline
+	// by its middleware.
+	longest := cfg.MaxRouteTimeout()
+	server := &http.Server{
+		Addr:              cfg.HTTPHOST + ":" + cfg.HTTPPORT,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       longest,
+		WriteTimeout:      longest + serverWriteGrace,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    int(cfg.MaxRequestSize),
+	}
+
+	// Serve until SIGINT or SIGTERM, then stop the server before the
+	// producer or relay it feeds, and those before Redis and the outbox
+	log.Printf("Ingestion service running on %s:%s", cfg.HTTPHOST, cfg.HTTPPORT)
+	if cfg.MetricsEnabled {
+		log.Printf("Metrics endpoint available at /metrics")
+	}
+	lc.Add(lifecycle.Server("http server", server))
+	return lc.Run(ctx)
+}
+
+// Sink accepts transactions for delivery to Kafka: the producer publishes
+// them directly, the outbox stores them for its relay to publish
+type Sink interface {
+	Publish(ctx context.Context, topic string, transaction models.Transaction) error
+	PublishBatch(ctx context.Context, topic string, transactions []models.Transaction) error
+	Durable() bool
+}
+
+// IngestTransactionHandler accepts a JSON transaction and publishes it to
+// Kafka. A transaction repeating one accepted within the duplicate window is
+// refused or tagged, according to the detector's mode.
+func IngestTransactionHandler(sink Sink, topic string, allowed tenant.Set, currencies currency.Allowlist, callbacks callback.Allowlist, limits metadata.Limits, detector *duplicates.Detector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.TransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			middleware.RecordTransactionFailed("invalid_json")
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid JSON payload")
+			return
+		}
+
+		// Validate the fields, reporting every problem
+		if details := validateRequest(req, currencies, callbacks, limits, ""); len(details) > 0 {
+			middleware.RecordValidationFailures(details)
+			apierror.Write(w, r, http.StatusBadRequest, details[0].Code, invalidMessage(details), details...)
+			return
+		}
+
+		// Scope the transaction to the caller's tenant
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		tenantID, err := resolveTenant(claims, req.TenantID, allowed)
+		if err != nil {
+			middleware.RecordTransactionFailed("tenant_denied")
+			writeTenantError(w, r, err, "", err.Error())
+			return
+		}
+
+		// Create transaction with generated ID and timestamp
+		now := time.Now()
+		txn := models.Transaction{
+			ID:             generateTransactionID(),
+			IdempotencyKey: req.IdempotencyKey,
+			AccountID:      req.AccountID,
+			UserID:         req.UserID,
+			Amount:         req.Amount,
+			Currency:       req.Currency,
+			Type:           req.Type,
+			Category:       req.Category,
+			Merchant:       req.Merchant,
+			Reference:      req.Reference,
+			Status:         "pending",
+			Timestamp:      now,
+			Metadata:       truncateMetadata(limits, req.Metadata),
+			TenantID:       tenantID,
+			IngestedAt:     now,
+
+			ParentTransactionID: req.ParentTransactionID,
+			CallbackURL:         req.CallbackURL,
+		}
+
+		// Refuse or tag a transaction repeating one accepted recently
+		if firstID := checkDuplicate(r.Context(), detector, &txn); firstID != "" {
+			middleware.RecordDuplicateSuspect(detector.Mode())
+			if detector.Mode() == duplicates.ModeReject {
+				middleware.RecordTransactionFailed("duplicate_content")
+				apierror.Write(w, r, http.StatusConflict, apierror.CodeDuplicateContent, "suspected duplicate of transaction "+firstID)
+				return
+			}
+			duplicates.Tag(&txn, firstID)
+		}
+
+		// Publish to Kafka, or store in the outbox
+		if err := sink.Publish(r.Context(), topic, txn); err != nil {
+			forgetDuplicates(r.Context(), detector, txn)
+			if errors.Is(err, outbox.ErrDuplicate) {
+				middleware.RecordTransactionFailed("duplicate_idempotency_key")
+				apierror.Write(w, r, http.StatusConflict, apierror.CodeDuplicateIdempotencyKey, "duplicate idempotency key")
+				return
+			}
+			middleware.RecordTransactionFailed(enqueueFailure(sink))
+			apierror.Write(w, r, http.StatusInternalServerError, enqueueErrorCode(sink), "failed to enqueue transaction")
+			return
+		}
+
+		// Record success metrics
+		middleware.RecordTransactionIngested(txn.Currency, txn.Type, allowed.Label(txn.TenantID), "success")
+
+		// Return success response
+		message := "Transaction queued for processing"
+		if sink.Durable() {
+			message = "Transaction durably accepted for processing"
+		}
+		response := models.TransactionResponse{
+			ID:        txn.ID,
+			Status:    "accepted",
+			Message:   message,
+			Timestamp: time.Now(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// IngestBatchTransactionHandler accepts multiple transactions and publishes
+// them in batch. The batch is refused if any transaction names a tenant the
+// caller may not ingest into or an unsupported currency, or, in reject mode,
+// if any repeats a transaction accepted within the duplicate window. A
+// transaction whose idempotency key was accepted for its tenant and user
+// within ttl, in an earlier batch or earlier in this one, is skipped and reported as a duplicate with
+// the ID it was accepted under; while Redis is unavailable only repeats
+// within the batch are caught, and the response carries
+// X-Idempotency-Degraded: true.
+func IngestBatchTransactionHandler(sink Sink, topic string, allowed tenant.Set, currencies currency.Allowlist, callbacks callback.Allowlist, limits metadata.Limits, detector *duplicates.Detector, items *redis.Client, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqs []models.TransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid JSON payload")
+			return
+		}
+
+		if len(reqs) == 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeEmptyBatch, "empty batch")
+			return
+		}
+
+		// Validate every transaction, reporting the problems of all of them
+		// with their counts by code
+		var invalid []apierror.Detail
+		summary := ""
+		for i, req := range reqs {
+			details := validateRequest(req, currencies, callbacks, limits, fmt.Sprintf("[%d].", i))
+			if len(details) == 0 {
+				continue
+			}
+			middleware.RecordValidationFailures(details)
+			if summary == "" {
+				summary = fmt.Sprintf("transaction %d: %s", i, invalidMessage(details))
+			}
+			invalid = append(invalid, details...)
+		}
+		if len(invalid) > 0 {
+			apierror.WriteBatch(w, r, http.StatusBadRequest, invalid[0].Code, summary, invalid)
+			return
+		}
+
+		// Convert requests to transactions
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		now := time.Now()
+		transactions := make([]models.Transaction, len(reqs))
+		for i, req := range reqs {
+			prefix := fmt.Sprintf("[%d].", i)
+			tenantID, err := resolveTenant(claims, req.TenantID, allowed)
+			if err != nil {
+				writeTenantError(w, r, err, prefix, fmt.Sprintf("transaction %d: %v", i, err))
+				return
+			}
+			transactions[i] = models.Transaction{
+				ID:             generateTransactionID(),
+				IdempotencyKey: req.IdempotencyKey,
+				AccountID:      req.AccountID,
+				UserID:         req.UserID,
+				Amount:         req.Amount,
+				Currency:       req.Currency,
+				Type:           req.Type,
+				Category:       req.Category,
+				Merchant:       req.Merchant,
+				Reference:      req.Reference,
+				Status:         "pending",
+				Timestamp:      now,
+				Metadata:       truncateMetadata(limits, req.Metadata),
+				TenantID:       tenantID,
+				IngestedAt:     now,
+
+				ParentTransactionID: req.ParentTransactionID,
+				CallbackURL:         req.CallbackURL,
+			}
+		}
+
+		// Skip the transactions whose idempotency key was accepted before
+		seen, degraded := lookupItemKeys(r.Context(), items, transactions)
+		if degraded {
+			w.Header().Set("X-Idempotency-Degraded", "true")
+		}
+		results := make([]models.BatchItemResult, len(transactions))
+		var accepted []models.Transaction
+		var indexes []int
+		for i, txn := range transactions {
+			results[i] = models.BatchItemResult{Index: i, IdempotencyKey: txn.IdempotencyKey, ID: txn.ID, Status: models.BatchItemAccepted}
+			key := itemKeyOf(txn)
+			if id, ok := seen[key]; ok {
+				results[i].ID, results[i].Status = id, models.BatchItemDuplicate
+				continue
+			}
+			seen[key] = txn.ID
+			accepted = append(accepted, txn)
+			indexes = append(indexes, i)
+		}
+		duplicateItems := len(transactions) - len(accepted)
+		if duplicateItems > 0 {
+			middleware.RecordBatchDuplicateItems(duplicateItems)
+		}
+
+		if len(accepted) > 0 {
+			// Refuse the batch or tag the transactions repeating ones
+			// accepted recently, including earlier ones of the batch
+			for n := range accepted {
+				firstID := checkDuplicate(r.Context(), detector, &accepted[n])
+				if firstID == "" {
+					continue
+				}
+				middleware.RecordDuplicateSuspect(detector.Mode())
+				if detector.Mode() == duplicates.ModeReject {
+					forgetDuplicates(r.Context(), detector, accepted[:n]...)
+					apierror.Write(w, r, http.StatusConflict, apierror.CodeDuplicateContent, fmt.Sprintf("transaction %d: suspected duplicate of transaction %s", indexes[n], firstID))
+					return
+				}
+				duplicates.Tag(&accepted[n], firstID)
+			}
+
+			// Publish batch to Kafka, or store it in the outbox
+			if err := sink.PublishBatch(r.Context(), topic, accepted); err != nil {
+				forgetDuplicates(r.Context(), detector, accepted...)
+				if errors.Is(err, outbox.ErrDuplicate) {
+					apierror.Write(w, r, http.StatusConflict, apierror.CodeDuplicateIdempotencyKey, err.Error())
+					return
+				}
+				apierror.Write(w, r, http.StatusInternalServerError, enqueueErrorCode(sink), "failed to enqueue batch")
+				return
+			}
+			recordItemKeys(r.Context(), items, accepted, ttl)
+		}
+
+		// Return success response
+		status, code := "accepted", http.StatusAccepted
+		message := "Batch queued for processing"
+		if sink.Durable() {
+			message = "Batch durably accepted for processing"
+		}
+		if len(accepted) == 0 {
+			status, code = models.BatchItemDuplicate, http.StatusOK
+			message = "Every transaction of the batch was accepted before"
+		}
+		response := models.BatchResponse{
+			Status:     status,
+			Message:    message,
+			Count:      len(accepted),
+			Duplicates: duplicateItems,
+			Results:    results,
+			Timestamp:  time.Now(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// TokenHandler returns the handler of the token endpoint: open in dev mode,
+// restricted to admins otherwise, since a token may carry any role and tenant
+func TokenHandler(jwtManager *auth.JWTManager, am *middleware.AuthMiddleware, allowed tenant.Set, devMode bool) http.HandlerFunc {
+	mint := GenerateTokenHandler(jwtManager, allowed)
+	if devMode {
+		return mint
+	}
+	return am.RequireAuth(am.RequireRole("admin")(mint))
+}
+
+// GenerateTokenHandler generates JWT tokens for testing. A tenant_id must be
+// one of the allowed tenants. When the caller is authenticated, as it must
+// be outside dev mode, a caller bound to a tenant mints tokens of its own
+// tenant only.
+func GenerateTokenHandler(jwtManager *auth.JWTManager, allowed tenant.Set) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid JSON payload")
+			return
+		}
+		if !allowed.Allowed(req.TenantID) {
+			writeTenantError(w, r, errUnknownTenant, "", errUnknownTenant.Error())
+			return
+		}
+		if caller, ok := auth.ClaimsFromContext(r.Context()); ok && caller.TenantID != "" && caller.TenantID != req.TenantID {
+			writeTenantError(w, r, errTenantMismatch, "", errTenantMismatch.Error())
+			return
+		}
+
+		// Generate token
+		token, err := jwtManager.GenerateToken(req.UserID, req.AccountID, req.Roles, req.TenantID)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate token")
+			return
+		}
+
+		response := models.TokenResponse{
+			Token: token,
+			Type:  "Bearer",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// Errors returned by resolveTenant
+var (
+	errUnknownTenant  = errors.New("unknown tenant")
+	errTenantMismatch = errors.New("tenant does not match token")
+)
+
+// resolveTenant returns the tenant a transaction is ingested into. A token
+// with a tenant claim ingests into that tenant, which an empty requested
+// tenant defaults to. Without a claim the transaction belongs to the default
+// tenant unless an admin names an allowed one.
+func resolveTenant(claims *auth.Claims, requested string, allowed tenant.Set) (string, error) {
+	if claims.TenantID != "" {
+		if !allowed.Allowed(claims.TenantID) {
+			return "", errUnknownTenant
+		}
+		if requested != "" && requested != claims.TenantID {
+			return "", errTenantMismatch
+		}
+		return claims.TenantID, nil
+	}
+	if requested == "" {
+		return "", nil
+	}
+	if !claims.HasRole("admin") {
+		return "", errTenantMismatch
+	}
+	if !allowed.Allowed(requested) {
+		return "", errUnknownTenant
+	}
+	return requested, nil
+}
+
+// writeTenantError writes the error response of a resolveTenant error: an
+// unknown tenant is invalid, another tenant than the token's is forbidden.
+// prefix locates the transaction in a batch.
+func writeTenantError(w http.ResponseWriter, r *http.Request, err error, prefix, message string) {
+	if errors.Is(err, errUnknownTenant) {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeUnknownTenant, message,
+			apierror.Detail{Field: prefix + "tenant_id", Code: apierror.CodeUnknownTenant, Message: err.Error()})
+		return
+	}
+	apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, message,
+		apierror.Detail{Field: prefix + "tenant_id", Code: apierror.CodeForbidden, Message: err.Error()})
+}
+
+// validateRequest returns a detail for each problem of a transaction
+// request: missing required fields, an invalid parent transaction, an
+// unsupported currency or an amount too precise for it, a callback URL off
+// the allowlisted hosts and, in strict mode, metadata breaking its limits.
+// The single and batch endpoints share it, so a payload gets the same
+// details from both. prefix locates the transaction in a batch.
+func validateRequest(req models.TransactionRequest, currencies currency.Allowlist, callbacks callback.Allowlist, limits metadata.Limits, prefix string) []apierror.Detail {
+	details := missingFields(req, prefix)
+	if err := validateParent(req); err != nil {
+		details = append(details, apierror.Detail{Field: prefix + "parent_transaction_id", Code: apierror.CodeInvalidParentTransaction, Message: err.Error()})
+	}
+	if _, err := currencies.Validate(req.Currency, req.Amount); err != nil {
+		details = append(details, currencyDetail(err, prefix))
+	}
+	if req.CallbackURL != "" {
+		if err := callbacks.Validate(req.CallbackURL); err != nil {
+			details = append(details, apierror.Detail{Field: prefix + "callback_url", Code: apierror.CodeInvalidCallbackURL, Message: err.Error()})
+		}
+	}
+	if !limits.Lenient() {
+		details = append(details, metadataDetails(limits.Validate(req.Metadata), prefix)...)
+	}
+	return details
+}
+
+// metadataCodes maps the kinds of metadata violation to their error codes
+var metadataCodes = map[string]string{
+	metadata.ViolationKey:      apierror.CodeInvalidMetadataKey,
+	metadata.ViolationValue:    apierror.CodeInvalidMetadataValue,
+	metadata.ViolationTooLarge: apierror.CodeMetadataTooLarge,
+}
+
+// metadataDetails returns a detail for each metadata violation, on the
+// offending key, as in metadata.country, or on the metadata as a whole.
+// prefix locates the transaction in a batch.
+func metadataDetails(violations []metadata.Violation, prefix string) []apierror.Detail {
+	details := make([]apierror.Detail, 0, len(violations))
+	for _, v := range violations {
+		field := prefix + "metadata"
+		if v.Key != "" {
+			field += "." + v.Key
+		}
+		details = append(details, apierror.Detail{Field: field, Code: metadataCodes[v.Kind], Message: v.Message})
+	}
+	return details
+}
+
+// truncateMetadata returns the metadata of a transaction cut down to the
+// limits in lenient mode, counting the truncations; in strict mode it was
+// refused unless within them
+func truncateMetadata(limits metadata.Limits, md map[string]string) map[string]string {
+	if !limits.Lenient() {
+		return md
+	}
+	md, truncated := limits.Truncate(md)
+	if truncated {
+		middleware.RecordMetadataTruncated()
+	}
+	return md
+}
+
+// invalidMessage returns the message of the response refusing a
+// transaction for details, from validateRequest
+func invalidMessage(details []apierror.Detail) string {
+	if details[0].Code == apierror.CodeMissingRequiredFields {
+		return "missing required fields"
+	}
+	return details[0].Message
+}
+
+// missingFields returns a detail for each required field req lacks. prefix
+// locates the transaction in a batch.
+func missingFields(req models.TransactionRequest, prefix string) []apierror.Detail {
+	var missing []apierror.Detail
+	for _, f := range []struct{ name, value string }{
+		{"idempotency_key", req.IdempotencyKey},
+		{"account_id", req.AccountID},
+		{"user_id", req.UserID},
+	} {
+		if f.value == "" {
+			missing = append(missing, apierror.Detail{Field: prefix + f.name, Code: apierror.CodeMissingRequiredFields, Message: "is required"})
+		}
+	}
+	return missing
+}
+
+// currencyDetail returns the detail of a currency.Validate error: on the
+// currency when it is not supported, on the amount when it has too many
+// decimal places. prefix locates the transaction in a batch.
+func currencyDetail(err error, prefix string) apierror.Detail {
+	field := "currency"
+	if errors.Is(err, currency.ErrPrecision) {
+		field = "amount"
+	}
+	return apierror.Detail{Field: prefix + field, Code: apierror.CodeInvalidCurrency, Message: err.Error()}
+}
+
+// generateTransactionID generates a unique transaction ID
+func generateTransactionID() string {
+	return "txn_" + time.Now().Format("20060102150405.000000000")
+}
+
+// transactionIDPattern matches the IDs made by generateTransactionID
+var transactionIDPattern = regexp.MustCompile(`^txn_\d{14}\.\d{9}$`)
+
+// validateParent checks the parent transaction of a request: refunds must
+// name a well-formed one, and only refunds may name one
+func validateParent(req models.TransactionRequest) error {
+	switch {
+	case req.Type == models.TransactionTypeRefund && req.ParentTransactionID == "":
+		return errors.New("refund requires parent_transaction_id")
+	case req.Type != models.TransactionTypeRefund && req.ParentTransactionID != "":
+		return errors.New("parent_transaction_id is only allowed on refunds")
+	case req.ParentTransactionID != "" && !transactionIDPattern.MatchString(req.ParentTransactionID):
+		return errors.New("invalid parent_transaction_id")
+	}
+	return nil
+}
+
+// checkDuplicate returns the ID of the transaction txn duplicates, or "" when
+// it is the first of its content or the check fails: duplicate detection is
+// best effort and does not hold up ingestion while Redis is unavailable
+func checkDuplicate(ctx context.Context, detector *duplicates.Detector, txn *models.Transaction) string {
+	firstID, err := detector.Check(ctx, txn)
+	if err != nil {
+		middleware.RecordRedisOperation("duplicate_check", "error")
+		log.Printf("Duplicate check failed for transaction %s: %v", txn.ID, err)
+		return ""
+	}
+	return firstID
+}
+
+// itemKeyOf returns the idempotency key of a transaction in a batch, scoped
+// to its tenant and user
+func itemKeyOf(txn models.Transaction) redis.ItemKey {
+	return redis.ItemKey{TenantID: txn.TenantID, UserID: txn.UserID, Key: txn.IdempotencyKey}
+}
+
+// lookupItemKeys returns the IDs the idempotency keys of transactions were
+// accepted under before, by key. It reports whether Redis was unavailable,
+// in which case no key is found.
+func lookupItemKeys(ctx context.Context, items *redis.Client, transactions []models.Transaction) (map[redis.ItemKey]string, bool) {
+	if items.Degraded() {
+		middleware.RecordRedisOperation("batch_item_check", "skipped")
+		return map[redis.ItemKey]string{}, true
+	}
+	keys := make([]redis.ItemKey, len(transactions))
+	for i, txn := range transactions {
+		keys[i] = itemKeyOf(txn)
+	}
+	seen, err := items.LookupItemKeys(ctx, keys)
+	if err != nil {
+		middleware.RecordRedisOperation("batch_item_check", "error")
+		log.Printf("Batch idempotency check failed: %v", err)
+		return map[redis.ItemKey]string{}, true
+	}
+	return seen, false
+}
+
+// recordItemKeys records the idempotency keys of accepted transactions for
+// ttl. It runs even when ctx is done, as the batch was accepted.
+func recordItemKeys(ctx context.Context, items *redis.Client, accepted []models.Transaction, ttl time.Duration) {
+	ids := make(map[redis.ItemKey]string, len(accepted))
+	for _, txn := range accepted {
+		ids[itemKeyOf(txn)] = txn.ID
+	}
+	if err := items.RecordItemKeys(context.WithoutCancel(ctx), ids, ttl); err != nil {
+		middleware.RecordRedisOperation("batch_item_record", "error")
+		log.Printf("Failed to record batch idempotency keys: %v", err)
+	}
+}
+
+// forgetDuplicates drops the content recorded for transactions that were not
+// accepted, so their retries are not taken for duplicates. It runs even when
+// ctx is done, as the request may have been refused for timing out.
+func forgetDuplicates(ctx context.Context, detector *duplicates.Detector, transactions ...models.Transaction) {
+	ctx = context.WithoutCancel(ctx)
+	for i := range transactions {
+		if err := detector.Forget(ctx, &transactions[i]); err != nil {
+			middleware.RecordRedisOperation("duplicate_forget", "error")
+			log.Printf("Failed to forget content of transaction %s: %v", transactions[i].ID, err)
+		}
+	}
+}
+
+// enqueueFailure returns the failure reason recorded when sink refuses a
+// transaction
+func enqueueFailure(sink Sink) string {
+	if sink.Durable() {
+		return "outbox_write_failed"
+	}
+	return "kafka_publish_failed"
+}
+
+// enqueueErrorCode returns the error code of a transaction sink refuses
+func enqueueErrorCode(sink Sink) string {
+	if sink.Durable() {
+		return apierror.CodeOutboxUnavailable
+	}
+	return apierror.CodeKafkaUnavailable
+}
@@ -0,0 +1,1085 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/callback"
+	"ingestion-service/internal/duplicates"
+	"ingestion-service/internal/metadata"
+	"ingestion-service/internal/middleware"
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/outbox"
+	"ingestion-service/internal/publisher/fake"
+	"ingestion-service/internal/redis"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const testSecret = "handler-test-secret-of-32-bytes!!"
+
+var testTenants = tenant.Parse("unit-a,unit-b")
+
+// post sends body as JSON to handler, on behalf of claims when not nil
+func post(t *testing.T, handler http.HandlerFunc, claims *auth.Claims, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", bytes.NewReader(data))
+	if claims != nil {
+		r = r.WithContext(auth.WithClaims(r.Context(), claims))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// newIngestHandler returns the single transaction handler publishing to sink
+func newIngestHandler(t *testing.T, sink Sink) http.HandlerFunc {
+	t.Helper()
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	return IngestTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), metadata.Limits{}, nil)
+}
+
+func transactionRequest(tenantID string) models.TransactionRequest {
+	return models.TransactionRequest{
+		IdempotencyKey: "key-1",
+		AccountID:      "acct-1",
+		UserID:         "user-1",
+		Amount:         42.5,
+		Currency:       "USD",
+		Type:           "purchase",
+		TenantID:       tenantID,
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	tests := []struct {
+		name      string
+		claims    auth.Claims
+		requested string
+		want      string
+		err       error
+	}{
+		{"tenant token defaults to its tenant", auth.Claims{TenantID: "unit-a"}, "", "unit-a", nil},
+		{"tenant token names its tenant", auth.Claims{TenantID: "unit-a"}, "unit-a", "unit-a", nil},
+		{"tenant token names another tenant", auth.Claims{TenantID: "unit-a"}, "unit-b", "", errTenantMismatch},
+		{"tenant admin names another tenant", auth.Claims{TenantID: "unit-a", Roles: []string{"admin"}}, "unit-b", "", errTenantMismatch},
+		{"token of a removed tenant", auth.Claims{TenantID: "unit-z"}, "", "", errUnknownTenant},
+		{"untenanted token defaults", auth.Claims{}, "", "", nil},
+		{"untenanted user names a tenant", auth.Claims{Roles: []string{"user"}}, "unit-b", "", errTenantMismatch},
+		{"untenanted admin names a tenant", auth.Claims{Roles: []string{"admin"}}, "unit-b", "unit-b", nil},
+		{"untenanted admin names an unknown tenant", auth.Claims{Roles: []string{"admin"}}, "unit-z", "", errUnknownTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTenant(&tt.claims, tt.requested, testTenants)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("tenant = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestRefusesAnotherTenant(t *testing.T) {
+	sink := fake.New()
+	handler := newIngestHandler(t, sink)
+
+	w := post(t, handler, &auth.Claims{UserID: "user-1", TenantID: "unit-a"}, transactionRequest("unit-b"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body)
+	}
+	if n := len(sink.Messages()); n != 0 {
+		t.Errorf("%d transactions published for another tenant", n)
+	}
+}
+
+func TestIngestScopesToTheTokenTenant(t *testing.T) {
+	sink := fake.New()
+	handler := newIngestHandler(t, sink)
+
+	w := post(t, handler, &auth.Claims{UserID: "user-1", TenantID: "unit-a"}, transactionRequest(""))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d transactions published, want 1", len(messages))
+	}
+	if got := messages[0].Transaction.TenantID; got != "unit-a" {
+		t.Errorf("tenant = %q, want unit-a", got)
+	}
+}
+
+// newTokenHandler returns the token endpoint handler as registered in or
+// out of dev mode, with the manager that signs its tokens
+func newTokenHandler(devMode bool) (http.HandlerFunc, *auth.JWTManager) {
+	jwtManager := auth.NewJWTManager("test", testSecret, nil, 1)
+	am := middleware.NewAuthMiddleware(jwtManager, nil)
+	return TokenHandler(jwtManager, am, testTenants, devMode), jwtManager
+}
+
+// mint requests a token, presenting bearer when set
+func mint(handler http.HandlerFunc, bearer string, req models.TokenRequest) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", bytes.NewReader(data))
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestTokenEndpointRequiresAdminOutsideDevMode(t *testing.T) {
+	handler, jwtManager := newTokenHandler(false)
+	req := models.TokenRequest{UserID: "mallory", AccountID: "acct-1", Roles: []string{"admin"}}
+
+	if w := mint(handler, "", req); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status %d, want 401", w.Code)
+	}
+
+	user, _ := jwtManager.GenerateToken("user-1", "acct-1", []string{"user"}, "")
+	if w := mint(handler, user, req); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status %d, want 403", w.Code)
+	}
+
+	admin, _ := jwtManager.GenerateToken("admin-1", "acct-1", []string{"admin"}, "")
+	if w := mint(handler, admin, req); w.Code != http.StatusOK {
+		t.Errorf("admin: status %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestTokenEndpointOpenInDevMode(t *testing.T) {
+	handler, _ := newTokenHandler(true)
+	w := mint(handler, "", models.TokenRequest{UserID: "dev", AccountID: "acct-1", TenantID: "unit-a"})
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestTenantAdminMintsItsOwnTenantOnly(t *testing.T) {
+	handler, jwtManager := newTokenHandler(false)
+	admin, _ := jwtManager.GenerateToken("admin-a", "acct-1", []string{"admin"}, "unit-a")
+
+	w := mint(handler, admin, models.TokenRequest{UserID: "user-1", AccountID: "acct-1", TenantID: "unit-b"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("another tenant: status %d, want 403", w.Code)
+	}
+	w = mint(handler, admin, models.TokenRequest{UserID: "user-1", AccountID: "acct-1"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("no tenant: status %d, want 403", w.Code)
+	}
+
+	w = mint(handler, admin, models.TokenRequest{UserID: "user-1", AccountID: "acct-1", TenantID: "unit-a"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("own tenant: status %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp models.TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	claims, err := jwtManager.ValidateToken(resp.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.TenantID != "unit-a" {
+		t.Errorf("minted tenant = %q, want unit-a", claims.TenantID)
+	}
+}
+
+// errKafka is the error of a sink whose broker is unreachable
+var errKafka = errors.New("kafka: leader not available")
+
+// newRedis returns a client of an in-memory Redis, closed when the test ends
+func newRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient(redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		redis.BreakerConfig{Threshold: 1, Cooldown: time.Minute, OpTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+// newBatchHandler returns the batch handler publishing to sink, remembering
+// the idempotency keys of its items in items
+func newBatchHandler(t *testing.T, sink Sink, detector *duplicates.Detector, items *redis.Client) http.HandlerFunc {
+	t.Helper()
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	return IngestBatchTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), metadata.Limits{}, detector, items, time.Hour)
+}
+
+func batchRequest(keys ...string) []models.TransactionRequest {
+	reqs := make([]models.TransactionRequest, len(keys))
+	for i, key := range keys {
+		reqs[i] = transactionRequest("")
+		reqs[i].IdempotencyKey = key
+		reqs[i].Reference = key
+	}
+	return reqs
+}
+
+// errorCode decodes the code of an error response
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var envelope apierror.Envelope
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	return envelope.Error.Code
+}
+
+var user = &auth.Claims{UserID: "user-1"}
+
+func TestIngestPublishesToTheTopic(t *testing.T) {
+	sink := fake.New()
+	w := post(t, newIngestHandler(t, sink), user, transactionRequest(""))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	var resp models.TransactionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d transactions published, want 1", len(messages))
+	}
+	got := messages[0]
+	if got.Topic != "transactions" || got.Transaction.ID != resp.ID || got.Transaction.Status != "pending" {
+		t.Errorf("published %s to %s as %s, want %s to transactions as pending", got.Transaction.ID, got.Topic, got.Transaction.Status, resp.ID)
+	}
+	if resp.Message != "Transaction queued for processing" {
+		t.Errorf("message = %q", resp.Message)
+	}
+}
+
+func TestIngestStampsTheIngestionTime(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	before := time.Now()
+	if w := post(t, newIngestHandler(t, sink), user, transactionRequest("")); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	if w := post(t, newBatchHandler(t, sink, nil, client), user, batchRequest("key-2", "key-3")); w.Code != http.StatusAccepted {
+		t.Fatalf("batch: status %d, want 202: %s", w.Code, w.Body)
+	}
+	after := time.Now()
+
+	// The end-to-end latency downstream is measured from it
+	for _, m := range sink.Messages() {
+		if at := m.Transaction.IngestedAt; at.Before(before) || at.After(after) {
+			t.Errorf("%s ingested at %s, want during the request", m.Transaction.ID, at)
+		}
+	}
+}
+
+func TestIngestValidatesTheParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		txnType string
+		parent  string
+		message string
+	}{
+		{"orphan refund", models.TransactionTypeRefund, "", "refund requires parent_transaction_id"},
+		{"malformed parent", models.TransactionTypeRefund, "txn-1", "invalid parent_transaction_id"},
+		{"parent of a purchase", "purchase", "txn_20260302120000.000000001", "parent_transaction_id is only allowed on refunds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := fake.New()
+			req := transactionRequest("")
+			req.Type, req.ParentTransactionID = tt.txnType, tt.parent
+			w := post(t, newIngestHandler(t, sink), user, req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+			}
+			var envelope apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			details := envelope.Error.Details
+			if len(details) != 1 || details[0].Field != "parent_transaction_id" ||
+				details[0].Code != apierror.CodeInvalidParentTransaction || details[0].Message != tt.message {
+				t.Errorf("details = %+v, want %q on parent_transaction_id", details, tt.message)
+			}
+			if n := len(sink.Messages()); n != 0 {
+				t.Errorf("%d transactions published", n)
+			}
+		})
+	}
+}
+
+func TestIngestCarriesTheParentOfARefund(t *testing.T) {
+	sink := fake.New()
+	req := transactionRequest("")
+	req.Type, req.ParentTransactionID = models.TransactionTypeRefund, "txn_20260302120000.000000001"
+	if w := post(t, newIngestHandler(t, sink), user, req); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 || messages[0].Transaction.ParentTransactionID != req.ParentTransactionID {
+		t.Errorf("published %+v, want the refund with its parent", messages)
+	}
+}
+
+func TestIngestValidatesTheCurrency(t *testing.T) {
+	currencies, err := currency.ParseAllowlist("USD,JPY,BHD")
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	tests := []struct {
+		name     string
+		currency string
+		amount   float64
+		field    string
+	}{
+		{"cents", "USD", 42.5, ""},
+		{"whole yen", "JPY", 1500, ""},
+		{"yen with decimals", "JPY", 1500.5, "amount"},
+		{"three places for dinars", "BHD", 12.345, ""},
+		{"four places for dinars", "BHD", 12.3456, "amount"},
+		{"not allowed", "EUR", 10, "currency"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := fake.New()
+			handler := IngestTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), metadata.Limits{}, nil)
+			req := transactionRequest("")
+			req.Currency, req.Amount = tt.currency, tt.amount
+			w := post(t, handler, user, req)
+			if tt.field == "" {
+				if w.Code != http.StatusAccepted || len(sink.Messages()) != 1 {
+					t.Errorf("status %d with %d published, want 202 and 1: %s", w.Code, len(sink.Messages()), w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+			}
+			var envelope apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			details := envelope.Error.Details
+			if len(details) != 1 || details[0].Field != tt.field || details[0].Code != apierror.CodeInvalidCurrency {
+				t.Errorf("details = %+v, want %s on %s", details, apierror.CodeInvalidCurrency, tt.field)
+			}
+			if n := len(sink.Messages()); n != 0 {
+				t.Errorf("%d transactions published", n)
+			}
+		})
+	}
+}
+
+func TestIngestRefusalsCarryTheirCode(t *testing.T) {
+	missing := transactionRequest("")
+	missing.AccountID, missing.UserID = "", ""
+
+	tests := []struct {
+		name    string
+		body    interface{}
+		code    string
+		details []apierror.Detail
+	}{
+		{"invalid JSON", "not a transaction", apierror.CodeInvalidJSON, nil},
+		{"missing fields", missing, apierror.CodeMissingRequiredFields, []apierror.Detail{
+			{Field: "account_id", Code: apierror.CodeMissingRequiredFields, Message: "is required"},
+			{Field: "user_id", Code: apierror.CodeMissingRequiredFields, Message: "is required"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := fake.New()
+			w := post(t, newIngestHandler(t, sink), user, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+			}
+			var envelope apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if envelope.Error.Code != tt.code || envelope.Error.RequestID == "" {
+				t.Errorf("error %+v, want %s with a request ID", envelope.Error, tt.code)
+			}
+			if !reflect.DeepEqual(envelope.Error.Details, tt.details) {
+				t.Errorf("details = %+v, want %+v", envelope.Error.Details, tt.details)
+			}
+			if n := len(sink.Messages()); n != 0 {
+				t.Errorf("%d transactions published", n)
+			}
+		})
+	}
+}
+
+func TestBatchRefusalsCarryTheirCode(t *testing.T) {
+	items, _ := newRedis(t)
+	handler := newBatchHandler(t, fake.New(), nil, items)
+
+	if code := errorCode(t, post(t, handler, user, []models.TransactionRequest{})); code != apierror.CodeEmptyBatch {
+		t.Errorf("code of an empty batch %q, want %q", code, apierror.CodeEmptyBatch)
+	}
+	if code := errorCode(t, post(t, handler, user, map[string]string{"id": "txn-1"})); code != apierror.CodeInvalidJSON {
+		t.Errorf("code of a batch that is not a list %q, want %q", code, apierror.CodeInvalidJSON)
+	}
+
+	// Every problem of every transaction is reported, located by index
+	reqs := batchRequest("key-1", "key-2", "key-3")
+	reqs[0].Currency = "XYZ"
+	reqs[2].UserID, reqs[2].Currency = "", "XYZ"
+	w := post(t, handler, user, reqs)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+	var envelope apierror.Envelope
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	var fields []string
+	for _, d := range envelope.Error.Details {
+		fields = append(fields, d.Field+" "+d.Code)
+	}
+	want := []string{"[0].currency invalid_currency", "[2].user_id missing_required_fields", "[2].currency invalid_currency"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("details %v, want %v", fields, want)
+	}
+	if envelope.Error.Code != apierror.CodeInvalidCurrency {
+		t.Errorf("code %q, want that of the first problem", envelope.Error.Code)
+	}
+	if counts := envelope.Error.Counts; counts[apierror.CodeInvalidCurrency] != 2 || counts[apierror.CodeMissingRequiredFields] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+}
+
+func TestIngestSinkFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		durable bool
+		err     error
+		status  int
+		code    string
+	}{
+		{"kafka unavailable", false, errKafka, http.StatusInternalServerError, apierror.CodeKafkaUnavailable},
+		{"outbox unavailable", true, errors.New("connection refused"), http.StatusInternalServerError, apierror.CodeOutboxUnavailable},
+		{"outbox duplicate", true, fmt.Errorf("%w: key-1", outbox.ErrDuplicate), http.StatusConflict, apierror.CodeDuplicateIdempotencyKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := fake.New()
+			sink.Err, sink.IsDurable = tt.err, tt.durable
+
+			w := post(t, newIngestHandler(t, sink), user, transactionRequest(""))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if code := errorCode(t, w); code != tt.code {
+				t.Errorf("code = %s, want %s", code, tt.code)
+			}
+			if n := len(sink.Messages()); n != 0 {
+				t.Errorf("%d transactions recorded by a failing sink", n)
+			}
+		})
+	}
+}
+
+func TestIngestSlowKafkaTimesOut(t *testing.T) {
+	sink := fake.New()
+	sink.Latency = time.Minute
+	handler := middleware.Timeout("/api/v1/transactions", 20*time.Millisecond)(newIngestHandler(t, sink))
+
+	start := time.Now()
+	w := post(t, handler, user, transactionRequest(""))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503: %s", w.Code, w.Body)
+	}
+	if code := errorCode(t, w); code != apierror.CodeTimeout {
+		t.Errorf("code = %s, want %s", code, apierror.CodeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %v, want it cut at the route timeout", elapsed)
+	}
+	if n := len(sink.Messages()); n != 0 {
+		t.Errorf("%d transactions published after the timeout", n)
+	}
+}
+
+func TestIngestRetryAfterKafkaFailureIsNotADuplicate(t *testing.T) {
+	client, _ := newRedis(t)
+	fields, err := duplicates.ParseFields(duplicates.DefaultFields)
+	if err != nil {
+		t.Fatalf("ParseFields: %v", err)
+	}
+	detector := duplicates.NewDetector(client, duplicates.ModeReject, fields, time.Hour)
+	sink := fake.New()
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	handler := IngestTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), metadata.Limits{}, detector)
+
+	sink.Err = errKafka
+	if w := post(t, handler, user, transactionRequest("")); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500: %s", w.Code, w.Body)
+	}
+
+	sink.Err = nil
+	if w := post(t, handler, user, transactionRequest("")); w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d, want 202: %s", w.Code, w.Body)
+	}
+	if w := post(t, handler, user, transactionRequest("")); w.Code != http.StatusConflict {
+		t.Errorf("repeat: status %d, want 409: %s", w.Code, w.Body)
+	}
+}
+
+// duplicateSuspects returns the suspected duplicates counted in mode
+func duplicateSuspects(t *testing.T, mode string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "ingestion_duplicate_suspects_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() == mode {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// newDuplicateHandlers returns the single and batch handlers publishing to
+// sink, detecting duplicates in mode
+func newDuplicateHandlers(t *testing.T, sink Sink, mode string) (single, batch http.HandlerFunc) {
+	t.Helper()
+	client, _ := newRedis(t)
+	fields, err := duplicates.ParseFields(duplicates.DefaultFields)
+	if err != nil {
+		t.Fatalf("ParseFields: %v", err)
+	}
+	detector := duplicates.NewDetector(client, mode, fields, time.Hour)
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	single = IngestTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), metadata.Limits{}, detector)
+	return single, newBatchHandler(t, sink, detector, client)
+}
+
+func TestIngestRejectsDuplicateContent(t *testing.T) {
+	sink := fake.New()
+	single, batch := newDuplicateHandlers(t, sink, duplicates.ModeReject)
+	before := duplicateSuspects(t, duplicates.ModeReject)
+
+	if w := post(t, single, user, transactionRequest("")); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	first := sink.Messages()[0].Transaction.ID
+
+	// The same content under a fresh idempotency key is refused
+	retry := transactionRequest("")
+	retry.IdempotencyKey = "key-2"
+	w := post(t, single, user, retry)
+	if w.Code != http.StatusConflict || errorCode(t, w) != apierror.CodeDuplicateContent {
+		t.Fatalf("retry: status %d, want 409 %s", w.Code, apierror.CodeDuplicateContent)
+	}
+	// So is a batch repeating it, whole
+	items := batchRequest("key-3", "key-4")
+	items[1].Reference = ""
+	w = post(t, batch, user, items)
+	if w.Code != http.StatusConflict || errorCode(t, w) != apierror.CodeDuplicateContent {
+		t.Errorf("batch: status %d, want 409 %s", w.Code, apierror.CodeDuplicateContent)
+	}
+	if n := len(sink.Messages()); n != 1 {
+		t.Errorf("%d transactions published, want only %s", n, first)
+	}
+	if got := duplicateSuspects(t, duplicates.ModeReject) - before; got != 2 {
+		t.Errorf("%v duplicates counted as rejected, want 2", got)
+	}
+
+	// Other content is accepted, as is the batch's first item once the
+	// batch was refused
+	other := transactionRequest("")
+	other.IdempotencyKey, other.Amount = "key-5", 43
+	if w := post(t, single, user, other); w.Code != http.StatusAccepted {
+		t.Errorf("other content: status %d, want 202: %s", w.Code, w.Body)
+	}
+	if w := post(t, batch, user, batchRequest("key-3")); w.Code != http.StatusAccepted {
+		t.Errorf("batch item retried: status %d, want 202: %s", w.Code, w.Body)
+	}
+}
+
+func TestIngestTagsDuplicateContent(t *testing.T) {
+	sink := fake.New()
+	single, batch := newDuplicateHandlers(t, sink, duplicates.ModeTag)
+	before := duplicateSuspects(t, duplicates.ModeTag)
+
+	req := transactionRequest("")
+	if w := post(t, single, user, req); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	req.IdempotencyKey = "key-2"
+	if w := post(t, single, user, req); w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d, want 202 tagged: %s", w.Code, w.Body)
+	}
+	items := batchRequest("key-3")
+	items[0].Reference = ""
+	if w := post(t, batch, user, items); w.Code != http.StatusAccepted {
+		t.Fatalf("batch: status %d, want 202 tagged: %s", w.Code, w.Body)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("%d transactions published, want 3", len(messages))
+	}
+	first := messages[0].Transaction
+	if _, tagged := first.Metadata[duplicates.MetadataSuspect]; tagged {
+		t.Errorf("first transaction tagged: %v", first.Metadata)
+	}
+	for _, m := range messages[1:] {
+		got := m.Transaction.Metadata
+		if got[duplicates.MetadataSuspect] != "true" || got[duplicates.MetadataDuplicateOf] != first.ID {
+			t.Errorf("%s metadata %v, want tagged as a duplicate of %s", m.Transaction.ID, got, first.ID)
+		}
+	}
+	if got := duplicateSuspects(t, duplicates.ModeTag) - before; got != 2 {
+		t.Errorf("%v duplicates counted as tagged, want 2", got)
+	}
+}
+
+func TestBatchPublishesEveryTransaction(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	sink.IsDurable = true
+
+	w := post(t, newBatchHandler(t, sink, nil, client), user, batchRequest("key-1", "key-2", "key-3"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	var resp models.BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if resp.Count != 3 || resp.Message != "Batch durably accepted for processing" {
+		t.Errorf("count %d, message %q", resp.Count, resp.Message)
+	}
+	messages := sink.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("%d transactions published, want 3", len(messages))
+	}
+	for i, m := range messages {
+		if m.Transaction.ID != resp.Results[i].ID {
+			t.Errorf("transaction %d published as %s, reported as %s", i, m.Transaction.ID, resp.Results[i].ID)
+		}
+	}
+}
+
+func TestBatchKafkaFailureRecordsNothing(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	handler := newBatchHandler(t, sink, nil, client)
+
+	sink.Err = errKafka
+	w := post(t, handler, user, batchRequest("key-1", "key-2"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500: %s", w.Code, w.Body)
+	}
+	if code := errorCode(t, w); code != apierror.CodeKafkaUnavailable {
+		t.Errorf("code = %s, want %s", code, apierror.CodeKafkaUnavailable)
+	}
+
+	// The keys of the refused batch were not recorded, so its retry is
+	// accepted whole
+	sink.Err = nil
+	w = post(t, handler, user, batchRequest("key-1", "key-2"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d, want 202: %s", w.Code, w.Body)
+	}
+	if n := len(sink.Messages()); n != 2 {
+		t.Errorf("%d transactions published by the retry, want 2", n)
+	}
+}
+
+func TestBatchSkipsKeysAcceptedBefore(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	handler := newBatchHandler(t, sink, nil, client)
+
+	if w := post(t, handler, user, batchRequest("key-1")); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	sink.Reset()
+
+	w := post(t, handler, user, batchRequest("key-1", "key-2", "key-2"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	var resp models.BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if resp.Count != 1 || resp.Duplicates != 2 {
+		t.Errorf("count %d, duplicates %d, want 1 and 2", resp.Count, resp.Duplicates)
+	}
+	if n := len(sink.Messages()); n != 1 {
+		t.Errorf("%d transactions published, want key-2 once", n)
+	}
+
+	w = post(t, handler, user, batchRequest("key-1", "key-2"))
+	if w.Code != http.StatusOK {
+		t.Errorf("repeated batch: status %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+// batchResponse decodes a batch response
+func batchResponse(t *testing.T, w *httptest.ResponseRecorder) models.BatchResponse {
+	t.Helper()
+	var resp models.BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return resp
+}
+
+func TestBatchPartialRetryReportsDuplicates(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	handler := newBatchHandler(t, sink, nil, client)
+
+	// The first six transactions were accepted before the client gave up on
+	// the batch, and it retries with the seventh
+	first := post(t, handler, user, batchRequest("key-1", "key-2", "key-3", "key-4", "key-5", "key-6"))
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", first.Code, first.Body)
+	}
+	accepted := batchResponse(t, first)
+	sink.Reset()
+
+	w := post(t, handler, user, batchRequest("key-1", "key-2", "key-3", "key-4", "key-5", "key-6", "key-7"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d, want 202: %s", w.Code, w.Body)
+	}
+	resp := batchResponse(t, w)
+	if resp.Count != 1 || resp.Duplicates != 6 || len(resp.Results) != 7 {
+		t.Fatalf("count %d, duplicates %d, %d results, want 1, 6 and 7", resp.Count, resp.Duplicates, len(resp.Results))
+	}
+	for i, result := range resp.Results[:6] {
+		if result.Index != i || result.IdempotencyKey != accepted.Results[i].IdempotencyKey ||
+			result.Status != models.BatchItemDuplicate || result.ID != accepted.Results[i].ID {
+			t.Errorf("result %d = %+v, want a duplicate of %s", i, result, accepted.Results[i].ID)
+		}
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d transactions published by the retry, want key-7 alone", len(messages))
+	}
+	if last := resp.Results[6]; last.Status != models.BatchItemAccepted || last.IdempotencyKey != "key-7" ||
+		last.ID != messages[0].Transaction.ID {
+		t.Errorf("result 6 = %+v, want key-7 accepted as %s", last, messages[0].Transaction.ID)
+	}
+
+	// A repeat within the batch is a duplicate of the first, under its ID
+	sink.Reset()
+	resp = batchResponse(t, post(t, handler, user, batchRequest("key-8", "key-8")))
+	if n := len(sink.Messages()); n != 1 {
+		t.Errorf("%d transactions published, want key-8 once", n)
+	}
+	if r := resp.Results; r[0].Status != models.BatchItemAccepted || r[1].Status != models.BatchItemDuplicate || r[1].ID != r[0].ID {
+		t.Errorf("results %+v, want the repeat reported as a duplicate of the first", r)
+	}
+}
+
+func TestBatchItemKeysAreScopedToTheCaller(t *testing.T) {
+	client, _ := newRedis(t)
+	sink := fake.New()
+	handler := newBatchHandler(t, sink, nil, client)
+
+	first := post(t, handler, user, batchRequest("key-1"))
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", first.Code, first.Body)
+	}
+	accepted := batchResponse(t, first).Results[0]
+
+	// Another user of the tenant, and the same user in another tenant,
+	// reuse the key
+	other := batchRequest("key-1")
+	other[0].UserID = "user-2"
+	elsewhere := batchRequest("key-1")
+	elsewhere[0].TenantID = "unit-b"
+	admin := &auth.Claims{UserID: "admin-1", Roles: []string{"admin"}}
+	for _, req := range [][]models.TransactionRequest{other, elsewhere} {
+		w := post(t, handler, admin, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+		}
+		result := batchResponse(t, w).Results[0]
+		if result.Status != models.BatchItemAccepted || result.ID == accepted.ID {
+			t.Errorf("result %+v, want accepted under its own ID rather than %s", result, accepted.ID)
+		}
+	}
+	if n := len(sink.Messages()); n != 3 {
+		t.Errorf("%d transactions published, want each caller's", n)
+	}
+
+	// The same caller repeating it is still a duplicate
+	result := batchResponse(t, post(t, handler, user, batchRequest("key-1"))).Results[0]
+	if result.Status != models.BatchItemDuplicate || result.ID != accepted.ID {
+		t.Errorf("result %+v, want a duplicate of %s", result, accepted.ID)
+	}
+}
+
+func TestBatchWithRedisDownIsPublishedDegraded(t *testing.T) {
+	client, mr := newRedis(t)
+	sink := fake.New()
+	handler := newBatchHandler(t, sink, nil, client)
+	mr.Close()
+
+	w := post(t, handler, user, batchRequest("key-1", "key-1", "key-2"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Idempotency-Degraded") != "true" {
+		t.Error("missing X-Idempotency-Degraded header")
+	}
+	if n := len(sink.Messages()); n != 2 {
+		t.Errorf("%d transactions published, want the repeat within the batch skipped", n)
+	}
+}
+
+func TestSingleAndBatchDescribeABadTransactionAlike(t *testing.T) {
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	callbacks := callback.ParseAllowlist("hooks.example.com")
+	limits := metadata.Limits{MaxKeys: 4, MaxKeyLength: 16, MaxValueLength: 32, MaxSize: 512, Mode: metadata.ModeStrict}
+	items, _ := newRedis(t)
+	single := IngestTransactionHandler(fake.New(), "transactions", testTenants, currencies, callbacks, limits, nil)
+	batch := IngestBatchTransactionHandler(fake.New(), "transactions", testTenants, currencies, callbacks, limits, nil, items, time.Hour)
+
+	bad := func(change func(*models.TransactionRequest)) models.TransactionRequest {
+		req := transactionRequest("")
+		req.IdempotencyKey = "key-bad"
+		change(&req)
+		return req
+	}
+	tests := []struct {
+		name string
+		req  models.TransactionRequest
+	}{
+		{"missing fields", bad(func(r *models.TransactionRequest) { r.IdempotencyKey, r.UserID = "", "" })},
+		{"unsupported currency", bad(func(r *models.TransactionRequest) { r.Currency = "XYZ" })},
+		{"amount too precise", bad(func(r *models.TransactionRequest) { r.Currency, r.Amount = "JPY", 10.5 })},
+		{"callback off the allowlist", bad(func(r *models.TransactionRequest) { r.CallbackURL = "https://evil.example.net/hook" })},
+		{"bad metadata", bad(func(r *models.TransactionRequest) { r.Metadata = map[string]string{"a-key-far-too-long": "x"} })},
+		{"several problems", bad(func(r *models.TransactionRequest) {
+			r.AccountID, r.Currency = "", "XYZ"
+			r.Metadata = map[string]string{"channel": strings.Repeat("v", 40)}
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(t, single, user, tt.req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("single status %d, want 400: %s", w.Code, w.Body)
+			}
+			var alone apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&alone); err != nil {
+				t.Fatalf("failed to decode single response: %v", err)
+			}
+
+			// The same payload second in a batch
+			w = post(t, batch, user, []models.TransactionRequest{batchRequest("key-ok")[0], tt.req})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("batch status %d, want 400: %s", w.Code, w.Body)
+			}
+			var inBatch apierror.Envelope
+			if err := json.NewDecoder(w.Body).Decode(&inBatch); err != nil {
+				t.Fatalf("failed to decode batch response: %v", err)
+			}
+
+			if len(alone.Error.Details) == 0 {
+				t.Fatal("single response without details")
+			}
+			want := make([]apierror.Detail, len(alone.Error.Details))
+			counts := make(map[string]int)
+			for i, d := range alone.Error.Details {
+				d.Field = "[1]." + d.Field
+				want[i] = d
+				counts[d.Code]++
+			}
+			if !reflect.DeepEqual(inBatch.Error.Details, want) {
+				t.Errorf("batch details = %+v, want the single ones located at [1]: %+v", inBatch.Error.Details, want)
+			}
+			if inBatch.Error.Code != alone.Error.Code {
+				t.Errorf("batch code %q, single code %q", inBatch.Error.Code, alone.Error.Code)
+			}
+			if inBatch.Error.Message != "transaction 1: "+alone.Error.Message {
+				t.Errorf("batch message %q, single message %q", inBatch.Error.Message, alone.Error.Message)
+			}
+			if !reflect.DeepEqual(inBatch.Error.Counts, counts) {
+				t.Errorf("batch counts = %v, want %v", inBatch.Error.Counts, counts)
+			}
+			if alone.Error.Counts != nil {
+				t.Errorf("single response counts %v, want none", alone.Error.Counts)
+			}
+		})
+	}
+}
+
+func TestCallbackURLsAreCheckedAgainstTheAllowlist(t *testing.T) {
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	sink := fake.New()
+	handler := IngestTransactionHandler(sink, "transactions", testTenants, currencies,
+		callback.ParseAllowlist("hooks.example.com"), metadata.Limits{}, nil)
+
+	req := transactionRequest("")
+	req.CallbackURL = "https://evil.example.net/hook"
+	w := post(t, handler, user, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback off the allowlist: status %d, want 400", w.Code)
+	}
+	if code := errorCode(t, w); code != apierror.CodeInvalidCallbackURL {
+		t.Errorf("error code = %s, want %s", code, apierror.CodeInvalidCallbackURL)
+	}
+	if n := len(sink.Messages()); n != 0 {
+		t.Fatalf("%d transactions published with a refused callback", n)
+	}
+
+	// An allowlisted callback travels with the transaction to storage
+	req.CallbackURL = "https://hooks.example.com/outcome"
+	if w := post(t, handler, user, req); w.Code != http.StatusAccepted {
+		t.Fatalf("allowlisted callback: status %d, want 202: %s", w.Code, w.Body)
+	}
+	if messages := sink.Messages(); len(messages) != 1 || messages[0].Transaction.CallbackURL != req.CallbackURL {
+		t.Errorf("published %+v, want the transaction with its callback URL", messages)
+	}
+}
+
+// metadataTruncations returns the transactions counted with their metadata
+// truncated
+func metadataTruncations(t *testing.T) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "ingestion_metadata_truncated_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestMetadataLimitsByMode(t *testing.T) {
+	currencies, err := currency.ParseAllowlist(currency.DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	handler := func(sink Sink, mode string) http.HandlerFunc {
+		limits := metadata.Limits{MaxKeys: 2, MaxKeyLength: 16, MaxValueLength: 8, MaxSize: 1024, Mode: mode}
+		return IngestTransactionHandler(sink, "transactions", testTenants, currencies, callback.ParseAllowlist(""), limits, nil)
+	}
+	req := transactionRequest("")
+	req.Metadata = map[string]string{"channel": "web", "country": "gb", "note": "far too long a note"}
+
+	// Strict mode refuses every violation, each at its key
+	sink := fake.New()
+	w := post(t, handler(sink, metadata.ModeStrict), user, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("strict: status %d, want 400: %s", w.Code, w.Body)
+	}
+	var envelope apierror.Envelope
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	var got []string
+	for _, d := range envelope.Error.Details {
+		got = append(got, d.Field+" "+d.Code)
+	}
+	want := []string{
+		"metadata.country " + apierror.CodeInvalidMetadataValue,
+		"metadata.note " + apierror.CodeInvalidMetadataValue,
+		"metadata " + apierror.CodeMetadataTooLarge,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("strict: details %v, want %v", got, want)
+	}
+	if n := len(sink.Messages()); n != 0 {
+		t.Errorf("strict: %d transactions published", n)
+	}
+
+	// Lenient mode accepts the transaction with its metadata cut to fit
+	before := metadataTruncations(t)
+	sink = fake.New()
+	if w := post(t, handler(sink, metadata.ModeLenient), user, req); w.Code != http.StatusAccepted {
+		t.Fatalf("lenient: status %d, want 202: %s", w.Code, w.Body)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("lenient: %d transactions published, want 1", len(messages))
+	}
+	wantMetadata := map[string]string{"channel": "web", "note": "far too ", "metadata_truncated": "true"}
+	if got := messages[0].Transaction.Metadata; !reflect.DeepEqual(got, wantMetadata) {
+		t.Errorf("lenient: metadata %v, want %v", got, wantMetadata)
+	}
+	if !messages[0].Transaction.MetadataWasTruncated() {
+		t.Error("lenient: transaction not flagged as truncated")
+	}
+	if got := metadataTruncations(t) - before; got != 1 {
+		t.Errorf("lenient: %v truncations counted, want 1", got)
+	}
+
+	// Metadata within the limits passes untouched in either mode
+	req.Metadata = map[string]string{"channel": "web", "country": "GB"}
+	for _, mode := range []string{metadata.ModeStrict, metadata.ModeLenient} {
+		sink := fake.New()
+		if w := post(t, handler(sink, mode), user, req); w.Code != http.StatusAccepted {
+			t.Fatalf("%s within the limits: status %d, want 202: %s", mode, w.Code, w.Body)
+		}
+		if got := sink.Messages()[0].Transaction.Metadata; !reflect.DeepEqual(got, req.Metadata) {
+			t.Errorf("%s within the limits: metadata %v, want it untouched", mode, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/openapi"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/models"
+)
+
+// apiDocument describes the HTTP API of the service. The schemas are
+// generated from the request and response types the handlers use; the
+// operations listed here must follow the routes registered in main.
+func apiDocument() *openapi.Document {
+	doc := openapi.New("Transaction Ingestion API", buildinfo.Version,
+		"Accepts transactions for risk processing and publishes them to Kafka. Errors are returned as a JSON envelope whose code, listed in the Error schema, is stable across releases.")
+
+	idempotencyKey := openapi.HeaderParam("Idempotency-Key",
+		"Key identifying the request; a retry with the same key returns the cached response", true)
+	batchIdempotencyKey := openapi.HeaderParam("Idempotency-Key",
+		"Key identifying the batch; a retry of the identical batch with the same key returns the cached response", false)
+	// failure describes an error response and the codes it carries
+	failure := func(description string, codes ...string) *openapi.Response {
+		return doc.JSON(description+" ("+strings.Join(codes, ", ")+")", apierror.Envelope{})
+	}
+	unauthorized := failure("Missing or invalid bearer token", apierror.CodeUnauthorized)
+	forbidden := failure("The token lacks the required role, or names another tenant", apierror.CodeForbidden)
+	lockedOut := failure("Too many invalid tokens from this client IP or user; retry after the Retry-After header", apierror.CodeRateLimited)
+
+	doc.Add("GET", "/health", &openapi.Operation{
+		Summary:   "Report that the service is up",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": doc.JSON("Healthy", map[string]string{})},
+	})
+	doc.Add("GET", "/readyz", &openapi.Operation{
+		Summary: "Report whether the service accepts transactions",
+		Tags:    []string{"operations"},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("Ready", map[string]string{}),
+			"503": doc.JSON("Saturated, or the outbox database is unreachable", map[string]string{}),
+		},
+	})
+	doc.Add("GET", "/version", &openapi.Operation{
+		Summary:   "Return the build information of the service",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": doc.JSON("Build information", buildinfo.Info{})},
+	})
+
+	doc.Add("POST", "/api/v1/transactions", &openapi.Operation{
+		Summary:     "Ingest a transaction",
+		Description: "Requires the teller or admin role. A transaction repeating the content of one accepted shortly before may be refused or tagged as a suspected duplicate, depending on DUPLICATE_DETECTION.",
+		Tags:        []string{"transactions"},
+		Security:    openapi.Bearer,
+		Parameters:  []openapi.Parameter{idempotencyKey},
+		RequestBody: doc.JSONBody("The transaction", models.TransactionRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("Cached response to an earlier request with the same idempotency key", models.TransactionResponse{}),
+			"202": doc.JSON("Accepted for processing", models.TransactionResponse{}),
+			"400": failure("Missing Idempotency-Key header, or invalid payload, currency, tenant, parent transaction, callback URL or metadata",
+				apierror.CodeIdempotencyKeyRequired, apierror.CodeInvalidJSON, apierror.CodeMissingRequiredFields,
+				apierror.CodeInvalidCurrency, apierror.CodeUnknownTenant, apierror.CodeInvalidParentTransaction,
+				apierror.CodeInvalidCallbackURL, apierror.CodeInvalidMetadataKey, apierror.CodeInvalidMetadataValue,
+				apierror.CodeMetadataTooLarge),
+			"401": unauthorized,
+			"429": lockedOut,
+			"403": forbidden,
+			"409": failure("Duplicate idempotency key in outbox mode, or suspected duplicate content",
+				apierror.CodeDuplicateIdempotencyKey, apierror.CodeDuplicateContent),
+			"500": failure("The transaction could not be enqueued", apierror.CodeKafkaUnavailable, apierror.CodeOutboxUnavailable),
+			"503": failure("Load is being shed, retry after the Retry-After header; or the request ran past its deadline",
+				apierror.CodeRateLimited, apierror.CodeTimeout),
+		},
+	})
+	doc.Add("POST", "/api/v1/transactions/batch", &openapi.Operation{
+		Summary:     "Ingest a batch of transactions",
+		Description: "Requires the admin role. The batch is accepted or refused whole, except the transactions whose idempotency_key was accepted within the last 24 hours, which are skipped and reported as duplicates with the ID they were accepted under. Invalid transactions are all reported, with the same details the single endpoint gives, their fields prefixed with the transaction's index, and counted by code; the message names the first.",
+		Tags:        []string{"transactions"},
+		Security:    openapi.Bearer,
+		Parameters:  []openapi.Parameter{batchIdempotencyKey},
+		RequestBody: doc.JSONBody("The transactions", []models.TransactionRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("Every transaction a duplicate, or the cached response to an identical batch sent with the same Idempotency-Key header", models.BatchResponse{}),
+			"202": doc.JSON("The transactions not duplicates accepted for processing", models.BatchResponse{}),
+			"400": failure("Empty batch, or transactions with missing fields or an invalid currency, tenant, parent, callback URL or metadata; details name the fields of the transactions, as in [2].currency",
+				apierror.CodeInvalidJSON, apierror.CodeEmptyBatch, apierror.CodeMissingRequiredFields,
+				apierror.CodeInvalidCurrency, apierror.CodeUnknownTenant, apierror.CodeInvalidParentTransaction,
+				apierror.CodeInvalidCallbackURL, apierror.CodeInvalidMetadataKey, apierror.CodeInvalidMetadataValue,
+				apierror.CodeMetadataTooLarge),
+			"401": unauthorized,
+			"429": lockedOut,
+			"403": forbidden,
+			"409": failure("Duplicate idempotency key in outbox mode, or suspected duplicate content",
+				apierror.CodeDuplicateIdempotencyKey, apierror.CodeDuplicateContent),
+			"500": failure("The batch could not be enqueued", apierror.CodeKafkaUnavailable, apierror.CodeOutboxUnavailable),
+			"503": failure("Load is being shed, retry after the Retry-After header; or the request ran past its deadline",
+				apierror.CodeRateLimited, apierror.CodeTimeout),
+		},
+	})
+
+	doc.Add("GET", "/api/v1/admin/idempotency", &openapi.Operation{
+		Summary:  "List a page of the idempotency keys of a user",
+		Tags:     []string{"admin"},
+		Security: openapi.Bearer,
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("user_id", "User whose keys are listed (required)", &openapi.Schema{Type: "string"}),
+			openapi.QueryParam("cursor", "Cursor of the page, from next_cursor", &openapi.Schema{Type: "integer", Format: "int64"}),
+			openapi.QueryParam("count", "Approximate number of keys per page", &openapi.Schema{Type: "integer", Format: "int64"}),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("A page of keys", idempotencyKeysResponse{}),
+			"400": failure("Missing user_id, or invalid cursor or count",
+				apierror.CodeMissingRequiredFields, apierror.CodeInvalidParameter),
+			"401": unauthorized,
+			"429": lockedOut,
+			"403": forbidden,
+		},
+	})
+	doc.Add("GET", "/api/v1/admin/idempotency/{key}", &openapi.Operation{
+		Summary:    "Inspect the response cached under an idempotency key",
+		Tags:       []string{"admin"},
+		Security:   openapi.Bearer,
+		Parameters: []openapi.Parameter{openapi.PathParam("key", "The idempotency key")},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The cached response", idempotencyKeyResponse{}),
+			"401": unauthorized,
+			"429": lockedOut,
+			"403": forbidden,
+			"404": failure("Idempotency key not found", apierror.CodeNotFound),
+		},
+	})
+	doc.Add("DELETE", "/api/v1/admin/idempotency/{key}", &openapi.Operation{
+		Summary:    "Purge an idempotency key, so a retry is processed again",
+		Tags:       []string{"admin"},
+		Security:   openapi.Bearer,
+		Parameters: []openapi.Parameter{openapi.PathParam("key", "The idempotency key")},
+		Responses: map[string]*openapi.Response{
+			"204": openapi.Empty("Purged"),
+			"401": unauthorized,
+			"429": lockedOut,
+			"403": forbidden,
+			"404": failure("Idempotency key not found", apierror.CodeNotFound),
+		},
+	})
+
+	doc.Add("POST", "/api/v1/auth/token", &openapi.Operation{
+		Summary:     "Issue a JWT for testing",
+		Tags:        []string{"auth"},
+		RequestBody: doc.JSONBody("The claims of the token", models.TokenRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The token", models.TokenResponse{}),
+			"400": failure("Invalid payload or unknown tenant", apierror.CodeInvalidJSON, apierror.CodeUnknownTenant),
+			"429": failure("Too many token requests from this client IP; retry after the Retry-After header", apierror.CodeRateLimited),
+			"500": failure("The token could not be signed", apierror.CodeInternal),
+		},
+	})
+
+	// List every code in the schema of the envelope
+	doc.Components.Schemas["Error"].Properties["code"].Enum = apierror.Codes
+	doc.Components.Schemas["Detail"].Properties["code"].Enum = apierror.Codes
+
+	return doc
+}
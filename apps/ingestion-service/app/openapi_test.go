@@ -0,0 +1,147 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/publisher/fake"
+)
+
+// TestResponsesMatchTheDocument records the payloads the handlers write in
+// the cases their tests cover, and checks each against the schema the API
+// document publishes for its path and status
+func TestResponsesMatchTheDocument(t *testing.T) {
+	doc := apiDocument()
+	client, _ := newRedis(t)
+	if err := client.SetIdempotencyKey(t.Context(), "key-1", "user-1", models.TransactionResponse{ID: "txn_1", Status: "accepted"}, time.Hour); err != nil {
+		t.Fatalf("SetIdempotencyKey: %v", err)
+	}
+	failing := fake.New()
+	failing.Err = errKafka
+	batch := newBatchHandler(t, fake.New(), nil, client)
+	tokens, _ := newTokenHandler(true)
+
+	invalid := transactionRequest("")
+	invalid.Currency, invalid.AccountID = "XYZ", ""
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		serve  func() *httptest.ResponseRecorder
+		status int
+	}{
+		{"accepted", "POST", "/api/v1/transactions", func() *httptest.ResponseRecorder {
+			return post(t, newIngestHandler(t, fake.New()), user, transactionRequest(""))
+		}, http.StatusAccepted},
+		{"invalid transaction", "POST", "/api/v1/transactions", func() *httptest.ResponseRecorder {
+			return post(t, newIngestHandler(t, fake.New()), user, invalid)
+		}, http.StatusBadRequest},
+		{"another tenant", "POST", "/api/v1/transactions", func() *httptest.ResponseRecorder {
+			return post(t, newIngestHandler(t, fake.New()), &auth.Claims{UserID: "user-1", TenantID: "unit-a"}, transactionRequest("unit-b"))
+		}, http.StatusForbidden},
+		{"kafka unavailable", "POST", "/api/v1/transactions", func() *httptest.ResponseRecorder {
+			return post(t, newIngestHandler(t, failing), user, transactionRequest(""))
+		}, http.StatusInternalServerError},
+		{"batch accepted", "POST", "/api/v1/transactions/batch", func() *httptest.ResponseRecorder {
+			return post(t, batch, admin, batchRequest("item-1", "item-2"))
+		}, http.StatusAccepted},
+		{"batch of duplicates", "POST", "/api/v1/transactions/batch", func() *httptest.ResponseRecorder {
+			return post(t, batch, admin, batchRequest("item-1", "item-2"))
+		}, http.StatusOK},
+		{"empty batch", "POST", "/api/v1/transactions/batch", func() *httptest.ResponseRecorder {
+			return post(t, batch, admin, []models.TransactionRequest{})
+		}, http.StatusBadRequest},
+		{"invalid batch", "POST", "/api/v1/transactions/batch", func() *httptest.ResponseRecorder {
+			return post(t, batch, admin, []models.TransactionRequest{transactionRequest(""), invalid})
+		}, http.StatusBadRequest},
+		{"token", "POST", "/api/v1/auth/token", func() *httptest.ResponseRecorder {
+			return mint(tokens, "", models.TokenRequest{UserID: "user-1", AccountID: "acct-1", Roles: []string{"teller"}})
+		}, http.StatusOK},
+		{"token of an unknown tenant", "POST", "/api/v1/auth/token", func() *httptest.ResponseRecorder {
+			return mint(tokens, "", models.TokenRequest{UserID: "user-1", TenantID: "unit-z"})
+		}, http.StatusBadRequest},
+		{"idempotency keys", "GET", "/api/v1/admin/idempotency", func() *httptest.ResponseRecorder {
+			return serveAdmin(ListIdempotencyKeysHandler(client), http.MethodGet, "/api/v1/admin/idempotency?user_id=user-1", "")
+		}, http.StatusOK},
+		{"idempotency keys without a user", "GET", "/api/v1/admin/idempotency", func() *httptest.ResponseRecorder {
+			return serveAdmin(ListIdempotencyKeysHandler(client), http.MethodGet, "/api/v1/admin/idempotency", "")
+		}, http.StatusBadRequest},
+		{"idempotency key", "GET", "/api/v1/admin/idempotency/{key}", func() *httptest.ResponseRecorder {
+			return serveAdmin(GetIdempotencyKeyHandler(client), http.MethodGet, "/api/v1/admin/idempotency/key-1", "key-1")
+		}, http.StatusOK},
+		{"unknown idempotency key", "GET", "/api/v1/admin/idempotency/{key}", func() *httptest.ResponseRecorder {
+			return serveAdmin(GetIdempotencyKeyHandler(client), http.MethodGet, "/api/v1/admin/idempotency/key-9", "key-9")
+		}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.serve()
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if err := doc.ValidateResponse(tt.method, tt.path, strconv.Itoa(w.Code), w.Body.Bytes()); err != nil {
+				t.Errorf("response does not match the document: %v\n%s", err, w.Body)
+			}
+		})
+	}
+}
+
+func TestRequestsMatchTheDocument(t *testing.T) {
+	doc := apiDocument()
+	tests := []struct {
+		path string
+		body interface{}
+	}{
+		{"/api/v1/transactions", transactionRequest("unit-a")},
+		{"/api/v1/transactions/batch", batchRequest("item-1", "item-2")},
+		{"/api/v1/auth/token", models.TokenRequest{UserID: "user-1", AccountID: "acct-1", Roles: []string{"admin"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if err := doc.ValidateRequest("POST", tt.path, body); err != nil {
+				t.Errorf("request does not match the document: %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+func TestDocumentIsServed(t *testing.T) {
+	w := httptest.NewRecorder()
+	apiDocument().Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi %q, want 3.0.3", doc.OpenAPI)
+	}
+	for path, method := range map[string]string{
+		"/api/v1/transactions":            "post",
+		"/api/v1/transactions/batch":      "post",
+		"/api/v1/auth/token":              "post",
+		"/api/v1/admin/idempotency/{key}": "delete",
+	} {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("document lacks %s %s", method, path)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Command loadgen drives the ingestion API at a target request rate and
+// reports latency percentiles, status codes and achieved throughput.
+//
+//	go run ./cmd/loadgen -url http://localhost:8080 -rps 200 -duration 1m
+//
+// Ctrl-C stops the run early and still prints the summary.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ingestion-service/internal/collector"
+	"ingestion-service/internal/models"
+)
+
+// options are the command line flags
+type options struct {
+	url          string
+	token        string
+	rps          float64
+	duration     time.Duration
+	workers      int
+	timeout      time.Duration
+	batchRatio   float64
+	batchSize    int
+	currencies   string
+	amountDist   string
+	minAmount    float64
+	maxAmount    float64
+	accounts     int
+	duplicatePct float64
+	rampStep     float64
+	rampEvery    time.Duration
+	maxRPS       float64
+	csvPath      string
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.url, "url", "http://localhost:8080", "ingestion service base URL")
+	flag.StringVar(&opts.token, "token", "", "JWT to send; fetched from /api/v1/auth/token when empty")
+	flag.Float64Var(&opts.rps, "rps", 100, "target requests per second")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "how long to run")
+	flag.IntVar(&opts.workers, "workers", 50, "concurrent requests in flight at most")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "per-request timeout")
+	flag.Float64Var(&opts.batchRatio, "batch-ratio", 0, "fraction of requests sent to the batch endpoint")
+	flag.IntVar(&opts.batchSize, "batch-size", 10, "transactions per batch request")
+	flag.StringVar(&opts.currencies, "currencies", "USD,EUR,GBP,INR", "comma-separated currencies to pick from")
+	flag.StringVar(&opts.amountDist, "amount-dist", collector.AmountUniform, "amount distribution: uniform or lognormal")
+	flag.Float64Var(&opts.minAmount, "min-amount", 1, "smallest amount")
+	flag.Float64Var(&opts.maxAmount, "max-amount", 1000, "largest amount")
+	flag.IntVar(&opts.accounts, "accounts", 10000, "number of distinct accounts")
+	flag.Float64Var(&opts.duplicatePct, "duplicate-pct", 0, "percentage of requests resending an earlier idempotency key")
+	flag.Float64Var(&opts.rampStep, "ramp-step", 0, "requests per second added every -ramp-every; 0 holds -rps")
+	flag.DurationVar(&opts.rampEvery, "ramp-every", 10*time.Second, "interval between ramp steps")
+	flag.Float64Var(&opts.maxRPS, "max-rps", 0, "ramp ceiling; 0 is unbounded")
+	flag.StringVar(&opts.csvPath, "csv", "", "write one row per request to this CSV file")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		log.Fatalf("loadgen: %v", err)
+	}
+}
+
+// run executes the load test and prints the summary
+func run(opts options) error {
+	if opts.rps <= 0 || opts.workers < 1 || opts.duration <= 0 {
+		return errors.New("-rps, -workers and -duration must be positive")
+	}
+	if opts.batchRatio < 0 || opts.batchRatio > 1 || opts.batchSize < 1 {
+		return errors.New("-batch-ratio must be between 0 and 1 and -batch-size positive")
+	}
+
+	gen, err := collector.NewGenerator(collector.GeneratorConfig{
+		Currencies:    splitList(opts.currencies),
+		AmountDist:    opts.amountDist,
+		MinAmount:     opts.minAmount,
+		MaxAmount:     opts.maxAmount,
+		Accounts:      opts.accounts,
+		DuplicateRate: opts.duplicatePct / 100,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &http.Client{
+		Timeout: opts.timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.workers,
+			MaxIdleConnsPerHost: opts.workers,
+		},
+	}
+	baseURL := strings.TrimRight(opts.url, "/")
+
+	token := opts.token
+	if token == "" {
+		if token, err = fetchToken(ctx, client, baseURL); err != nil {
+			return err
+		}
+	}
+
+	var csvOut *os.File
+	if opts.csvPath != "" {
+		if csvOut, err = os.Create(opts.csvPath); err != nil {
+			return fmt.Errorf("failed to create CSV file: %w", err)
+		}
+		defer csvOut.Close()
+	}
+
+	d := &driver{client: client, baseURL: baseURL, token: token, gen: gen, batchSize: opts.batchSize}
+	rate := rateController{rps: opts.rps, rampStep: opts.rampStep, rampEvery: opts.rampEvery, maxRPS: opts.maxRPS}
+
+	log.Printf("Driving %s at %.0f req/s for %v with %d workers", baseURL, opts.rps, opts.duration, opts.workers)
+	sum, skipped, err := d.run(ctx, rate, opts, csvOut)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		fmt.Println("\nInterrupted, summary of the requests completed so far:")
+	}
+
+	sum.Print(os.Stdout)
+	if skipped > 0 {
+		fmt.Printf("Skipped:       %d sends, every worker was busy; raise -workers to reach the target rate\n", skipped)
+	}
+	return nil
+}
+
+// driver sends the generated requests
+type driver struct {
+	client    *http.Client
+	baseURL   string
+	token     string
+	gen       *collector.Generator
+	batchSize int
+}
+
+// run paces requests onto the worker pool for the configured duration and
+// aggregates their results. A send finding every worker busy is skipped and
+// counted rather than queued, so latency is not inflated by queueing.
+func (d *driver) run(ctx context.Context, rate rateController, opts options, csvOut io.Writer) (summary, int, error) {
+	runCtx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	var cw *csv.Writer
+	if csvOut != nil {
+		var err error
+		if cw, err = newCSVWriter(csvOut); err != nil {
+			return summary{}, 0, err
+		}
+	}
+
+	jobs := make(chan string)
+	results := make(chan result, opts.workers)
+	var wg sync.WaitGroup
+	for range opts.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for kind := range jobs {
+				results <- d.send(kind)
+			}
+		}()
+	}
+
+	agg := newAggregator()
+	aggDone := make(chan error, 1)
+	go func() {
+		var csvErr error
+		for r := range results {
+			agg.add(r)
+			if cw != nil && csvErr == nil {
+				csvErr = cw.Write(csvRecord(r))
+			}
+		}
+		if cw != nil {
+			cw.Flush()
+			if csvErr == nil {
+				csvErr = cw.Error()
+			}
+		}
+		aggDone <- csvErr
+	}()
+
+	skipped := 0
+	rate.run(runCtx, func() {
+		kind := kindSingle
+		if opts.batchRatio > 0 && rand.Float64() < opts.batchRatio {
+			kind = kindBatch
+		}
+		select {
+		case jobs <- kind:
+		default:
+			skipped++
+		}
+	})
+
+	// Requests in flight finish within their timeout
+	close(jobs)
+	wg.Wait()
+	close(results)
+	if err := <-aggDone; err != nil {
+		return summary{}, skipped, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return agg.summary(), skipped, nil
+}
+
+// send issues one request of kind and times it
+func (d *driver) send(kind string) result {
+	r := result{Start: time.Now(), Kind: kind}
+
+	var body any
+	var key string
+	if kind == kindBatch {
+		batch := make([]models.TransactionRequest, d.batchSize)
+		for i := range batch {
+			batch[i], _ = d.gen.Request()
+		}
+		body = batch
+		key = fmt.Sprintf("loadgen_batch_%d", rand.Uint64())
+		r.Transactions = len(batch)
+	} else {
+		req, duplicate := d.gen.Request()
+		body = req
+		key = req.IdempotencyKey
+		r.Transactions = 1
+		r.Duplicate = duplicate
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	path := "/api/v1/transactions"
+	if kind == kindBatch {
+		path += "/batch"
+	}
+	req, err := http.NewRequest(http.MethodPost, d.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	req.Header.Set("Idempotency-Key", key)
+
+	r.Start = time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		r.Latency = time.Since(r.Start)
+		r.Err = err
+		return r
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	r.Latency = time.Since(r.Start)
+	r.Status = resp.StatusCode
+	r.Replayed = resp.Header.Get("X-Idempotency-Cache") == "true"
+	return r
+}
+
+// fetchToken obtains an admin JWT, which both the single and the batch
+// endpoints accept
+func fetchToken(ctx context.Context, client *http.Client, baseURL string) (string, error) {
+	payload, _ := json.Marshal(map[string]any{
+		"user_id":    "loadgen",
+		"account_id": "loadgen",
+		"roles":      []string{"admin"},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/v1/auth/token", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch token: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Token == "" {
+		return "", errors.New("failed to fetch token: no token in response")
+	}
+	return body.Token, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
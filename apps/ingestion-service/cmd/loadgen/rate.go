@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// rateController paces requests at a target rate, optionally stepping the
+// rate up at a fixed interval
+type rateController struct {
+	rps       float64 // starting requests per second
+	rampStep  float64 // added every rampEvery; 0 holds rps
+	rampEvery time.Duration
+	maxRPS    float64 // ramp ceiling; 0 is unbounded
+}
+
+// rateAt returns the target rate after elapsed
+func (r rateController) rateAt(elapsed time.Duration) float64 {
+	rate := r.rps
+	if r.rampStep > 0 && r.rampEvery > 0 {
+		rate += r.rampStep * float64(elapsed/r.rampEvery)
+	}
+	if r.maxRPS > 0 && rate > r.maxRPS {
+		rate = r.maxRPS
+	}
+	return rate
+}
+
+// run calls fire at the target rate until ctx is done. Send times follow a
+// fixed schedule, so a late wakeup is made up by the sends after it rather
+// than lowering the achieved rate.
+func (r rateController) run(ctx context.Context, fire func()) {
+	start := time.Now()
+	next := start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		for !next.After(now) {
+			fire()
+			rate := r.rateAt(next.Sub(start))
+			if rate <= 0 {
+				return
+			}
+			next = next.Add(time.Duration(float64(time.Second) / rate))
+		}
+		timer.Reset(next.Sub(now))
+	}
+}
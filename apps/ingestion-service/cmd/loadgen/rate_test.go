@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    rateController
+		elapsed time.Duration
+		want    float64
+	}{
+		{"steady", rateController{rps: 50}, time.Hour, 50},
+		{"before the first step", rateController{rps: 10, rampStep: 5, rampEvery: 10 * time.Second}, 9 * time.Second, 10},
+		{"after two steps", rateController{rps: 10, rampStep: 5, rampEvery: 10 * time.Second}, 25 * time.Second, 20},
+		{"capped", rateController{rps: 10, rampStep: 5, rampEvery: 10 * time.Second, maxRPS: 18}, time.Minute, 18},
+		{"step without an interval", rateController{rps: 10, rampStep: 5}, time.Minute, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rate.rateAt(tt.elapsed); got != tt.want {
+				t.Errorf("rateAt(%s) = %v, want %v", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+// fired runs r for d, returning how many times it fired
+func fired(r rateController, d time.Duration) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	var n atomic.Int64
+	r.run(ctx, func() { n.Add(1) })
+	return n.Load()
+}
+
+func TestRunHoldsTheRate(t *testing.T) {
+	// 200 requests per second for half a second, the first sent at once
+	n := fired(rateController{rps: 200}, 500*time.Millisecond)
+	if n < 90 || n > 102 {
+		t.Errorf("fired %d times, want about 100", n)
+	}
+}
+
+func TestRunRamps(t *testing.T) {
+	// 100/s for the first 200ms, then 300/s: about 20 + 60
+	n := fired(rateController{rps: 100, rampStep: 200, rampEvery: 200 * time.Millisecond, maxRPS: 300}, 400*time.Millisecond)
+	if n < 70 || n > 82 {
+		t.Errorf("fired %d times, want about 80", n)
+	}
+}
+
+func TestRunStopsAtAZeroRate(t *testing.T) {
+	done := make(chan int64)
+	go func() { done <- fired(rateController{}, time.Minute) }()
+	select {
+	case n := <-done:
+		if n != 1 {
+			t.Errorf("fired %d times, want once", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return at a zero rate")
+	}
+}
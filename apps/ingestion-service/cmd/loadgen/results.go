@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request kinds
+const (
+	kindSingle = "single"
+	kindBatch  = "batch"
+)
+
+// result is the outcome of one request. Status is 0 when no response was
+// received.
+type result struct {
+	Start        time.Time
+	Kind         string
+	Transactions int
+	Status       int
+	Latency      time.Duration
+	Duplicate    bool
+	Replayed     bool // served from the idempotency cache
+	Err          error
+}
+
+// aggregator accumulates results. It is not safe for concurrent use; one
+// goroutine feeds it.
+type aggregator struct {
+	latencies    []time.Duration
+	statuses     map[int]int
+	errors       map[string]int // transport errors by message
+	requests     int
+	transactions int
+	duplicates   int
+	replayed     int
+	first, last  time.Time
+}
+
+// newAggregator creates an empty aggregator
+func newAggregator() *aggregator {
+	return &aggregator{statuses: make(map[int]int), errors: make(map[string]int)}
+}
+
+// add records a result
+func (a *aggregator) add(r result) {
+	a.requests++
+	a.latencies = append(a.latencies, r.Latency)
+	a.statuses[r.Status]++
+	if r.Err != nil {
+		a.errors[r.Err.Error()]++
+	}
+	if r.Status >= 200 && r.Status < 300 {
+		a.transactions += r.Transactions
+	}
+	if r.Duplicate {
+		a.duplicates++
+	}
+	if r.Replayed {
+		a.replayed++
+	}
+	if a.first.IsZero() || r.Start.Before(a.first) {
+		a.first = r.Start
+	}
+	if end := r.Start.Add(r.Latency); end.After(a.last) {
+		a.last = end
+	}
+}
+
+// summary is the aggregate of every result
+type summary struct {
+	Requests     int
+	Transactions int
+	Failed       int // no response or a non-2xx status
+	Duplicates   int
+	Replayed     int
+	Elapsed      time.Duration
+	Statuses     map[int]int
+	Errors       map[string]int
+	P50, P90     time.Duration
+	P95, P99     time.Duration
+	Max          time.Duration
+}
+
+// summary computes the aggregate
+func (a *aggregator) summary() summary {
+	s := summary{
+		Requests:     a.requests,
+		Transactions: a.transactions,
+		Duplicates:   a.duplicates,
+		Replayed:     a.replayed,
+		Elapsed:      a.last.Sub(a.first),
+		Statuses:     a.statuses,
+		Errors:       a.errors,
+	}
+	for status, n := range a.statuses {
+		if status < 200 || status >= 300 {
+			s.Failed += n
+		}
+	}
+
+	sorted := append([]time.Duration(nil), a.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.P50 = percentile(sorted, 50)
+	s.P90 = percentile(sorted, 90)
+	s.P95 = percentile(sorted, 95)
+	s.P99 = percentile(sorted, 99)
+	if len(sorted) > 0 {
+		s.Max = sorted[len(sorted)-1]
+	}
+	return s
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[min(rank, len(sorted))-1]
+}
+
+// ErrorRate returns the fraction of requests that failed
+func (s summary) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Requests)
+}
+
+// Throughput returns the achieved requests and transactions per second
+func (s summary) Throughput() (requests, transactions float64) {
+	if s.Elapsed <= 0 {
+		return 0, 0
+	}
+	secs := s.Elapsed.Seconds()
+	return float64(s.Requests) / secs, float64(s.Transactions) / secs
+}
+
+// Print writes the summary as a report
+func (s summary) Print(w io.Writer) {
+	reqRate, txRate := s.Throughput()
+	fmt.Fprintf(w, "Requests:      %d in %v (%d duplicates, %d served from the idempotency cache)\n",
+		s.Requests, s.Elapsed.Round(time.Millisecond), s.Duplicates, s.Replayed)
+	fmt.Fprintf(w, "Throughput:    %.1f req/s, %.1f tx/s accepted\n", reqRate, txRate)
+	fmt.Fprintf(w, "Latency:       p50 %v  p90 %v  p95 %v  p99 %v  max %v\n",
+		round(s.P50), round(s.P90), round(s.P95), round(s.P99), round(s.Max))
+	fmt.Fprintf(w, "Error rate:    %.2f%% (%d failed)\n", 100*s.ErrorRate(), s.Failed)
+
+	statuses := make([]int, 0, len(s.Statuses))
+	for status := range s.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	fmt.Fprintln(w, "Status codes:")
+	for _, status := range statuses {
+		label := strconv.Itoa(status)
+		if status == 0 {
+			label = "no response"
+		}
+		fmt.Fprintf(w, "  %-12s %d\n", label, s.Statuses[status])
+	}
+
+	if len(s.Errors) > 0 {
+		messages := make([]string, 0, len(s.Errors))
+		for msg := range s.Errors {
+			messages = append(messages, msg)
+		}
+		sort.Strings(messages)
+		fmt.Fprintln(w, "Errors:")
+		for _, msg := range messages {
+			fmt.Fprintf(w, "  %d x %s\n", s.Errors[msg], msg)
+		}
+	}
+}
+
+// round shortens a latency for display
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+// csvHeader lists the columns of the per-request CSV
+var csvHeader = []string{"start", "kind", "transactions", "status", "latency_ms", "duplicate", "replayed", "error"}
+
+// csvRecord renders a result as a CSV row
+func csvRecord(r result) []string {
+	errMsg := ""
+	if r.Err != nil {
+		errMsg = strings.ReplaceAll(r.Err.Error(), "\n", " ")
+	}
+	return []string{
+		r.Start.Format(time.RFC3339Nano),
+		r.Kind,
+		strconv.Itoa(r.Transactions),
+		strconv.Itoa(r.Status),
+		strconv.FormatFloat(float64(r.Latency)/float64(time.Millisecond), 'f', 3, 64),
+		strconv.FormatBool(r.Duplicate),
+		strconv.FormatBool(r.Replayed),
+		errMsg,
+	}
+}
+
+// newCSVWriter writes the header and returns a writer for result rows
+func newCSVWriter(w io.Writer) (*csv.Writer, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return cw, nil
+}
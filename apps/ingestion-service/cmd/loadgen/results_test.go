@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{99.5, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of none = %s, want 0", got)
+	}
+	if got := percentile(sorted[:1], 99); got != time.Millisecond {
+		t.Errorf("percentile of one = %s, want it", got)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := newAggregator()
+	// Added out of order, as workers finish them
+	a.add(result{Start: start.Add(time.Second), Kind: kindBatch, Transactions: 10, Status: 202, Latency: 40 * time.Millisecond})
+	a.add(result{Start: start, Kind: kindSingle, Transactions: 1, Status: 202, Latency: 10 * time.Millisecond})
+	a.add(result{Start: start.Add(500 * time.Millisecond), Kind: kindSingle, Transactions: 1, Status: 200, Latency: 20 * time.Millisecond, Duplicate: true, Replayed: true})
+	a.add(result{Start: start.Add(600 * time.Millisecond), Kind: kindSingle, Transactions: 1, Status: 429, Latency: 5 * time.Millisecond})
+	a.add(result{Start: start.Add(1900 * time.Millisecond), Kind: kindBatch, Transactions: 10, Latency: 100 * time.Millisecond, Err: errors.New("connection refused")})
+
+	s := a.summary()
+	if s.Requests != 5 || s.Failed != 2 || s.Duplicates != 1 || s.Replayed != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	// Only accepted requests count their transactions
+	if s.Transactions != 12 {
+		t.Errorf("%d transactions, want 12", s.Transactions)
+	}
+	// From the first start to the last completion
+	if s.Elapsed != 2*time.Second {
+		t.Errorf("elapsed %s, want 2s", s.Elapsed)
+	}
+	if s.P50 != 20*time.Millisecond || s.P99 != 100*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("p50 %s, p99 %s, max %s", s.P50, s.P99, s.Max)
+	}
+	if s.Statuses[202] != 2 || s.Statuses[200] != 1 || s.Statuses[429] != 1 || s.Statuses[0] != 1 {
+		t.Errorf("statuses = %v", s.Statuses)
+	}
+	if s.Errors["connection refused"] != 1 {
+		t.Errorf("errors = %v", s.Errors)
+	}
+	if rate := s.ErrorRate(); rate != 0.4 {
+		t.Errorf("error rate %v, want 0.4", rate)
+	}
+	if requests, transactions := s.Throughput(); requests != 2.5 || transactions != 6 {
+		t.Errorf("throughput %v req/s, %v tx/s, want 2.5 and 6", requests, transactions)
+	}
+
+	var out bytes.Buffer
+	s.Print(&out)
+	for _, want := range []string{"Error rate:    40.00% (2 failed)", "  no response  1", "  1 x connection refused"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestEmptySummary(t *testing.T) {
+	s := newAggregator().summary()
+	if s.ErrorRate() != 0 {
+		t.Errorf("error rate %v, want 0", s.ErrorRate())
+	}
+	if requests, transactions := s.Throughput(); requests != 0 || transactions != 0 {
+		t.Errorf("throughput %v, %v, want 0", requests, transactions)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newCSVWriter(&buf)
+	if err != nil {
+		t.Fatalf("newCSVWriter: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.Write(csvRecord(result{Start: start, Kind: kindSingle, Transactions: 1, Status: 202, Latency: 1500 * time.Microsecond}))
+	w.Write(csvRecord(result{Start: start, Kind: kindBatch, Transactions: 10, Latency: time.Second, Err: errors.New("read: connection\nreset")}))
+	w.Flush()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	want := [][]string{
+		csvHeader,
+		{"2026-01-01T00:00:00Z", "single", "1", "202", "1.500", "false", "false", ""},
+		{"2026-01-01T00:00:00Z", "batch", "10", "0", "1000.000", "false", "false", "read: connection reset"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, rows[i], want[i])
+		}
+	}
+}
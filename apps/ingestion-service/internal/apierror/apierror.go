@@ -0,0 +1,132 @@
+// Package apierror writes the error responses of the ingestion API: a JSON
+// envelope carrying a stable, machine-readable code alongside the message,
+// so clients can tell failures apart without matching on text.
+package apierror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes. They are part of the API: a code is never renamed or reused
+// for another failure.
+const (
+	CodeInvalidJSON              = "invalid_json"
+	CodeMissingRequiredFields    = "missing_required_fields"
+	CodeInvalidParentTransaction = "invalid_parent_transaction"
+	CodeInvalidCurrency          = "invalid_currency"
+	CodeInvalidCallbackURL       = "invalid_callback_url"
+	CodeInvalidMetadataKey       = "invalid_metadata_key"
+	CodeInvalidMetadataValue     = "invalid_metadata_value"
+	CodeMetadataTooLarge         = "metadata_too_large"
+	CodeInvalidParameter         = "invalid_parameter"
+	CodeEmptyBatch               = "empty_batch"
+	CodeUnknownTenant            = "unknown_tenant"
+	CodeIdempotencyKeyRequired   = "idempotency_key_required"
+	CodeDuplicateIdempotencyKey  = "duplicate_idempotency_key"
+	CodeDuplicateContent         = "duplicate_content"
+	CodeUnauthorized             = "unauthorized"
+	CodeForbidden                = "forbidden"
+	CodeNotFound                 = "not_found"
+	CodeRateLimited              = "rate_limited"
+	CodeKafkaUnavailable         = "kafka_unavailable"
+	CodeOutboxUnavailable        = "outbox_unavailable"
+	CodeTimeout                  = "timeout"
+	CodeInternal                 = "internal_error"
+)
+
+// Codes lists every error code, for the API description
+var Codes = []string{
+	CodeInvalidJSON,
+	CodeMissingRequiredFields,
+	CodeInvalidParentTransaction,
+	CodeInvalidCurrency,
+	CodeInvalidCallbackURL,
+	CodeInvalidMetadataKey,
+	CodeInvalidMetadataValue,
+	CodeMetadataTooLarge,
+	CodeInvalidParameter,
+	CodeEmptyBatch,
+	CodeUnknownTenant,
+	CodeIdempotencyKeyRequired,
+	CodeDuplicateIdempotencyKey,
+	CodeDuplicateContent,
+	CodeUnauthorized,
+	CodeForbidden,
+	CodeNotFound,
+	CodeRateLimited,
+	CodeKafkaUnavailable,
+	CodeOutboxUnavailable,
+	CodeTimeout,
+	CodeInternal,
+}
+
+// RequestIDHeader carries the ID of a request, set by the gateway
+const RequestIDHeader = "X-Request-ID"
+
+// Envelope is the body of every error response
+type Envelope struct {
+	Error Error `json:"error"`
+}
+
+// Error describes a failure
+type Error struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []Detail `json:"details,omitempty"`
+	// Counts counts the details by code, on a refused batch, so a spike of
+	// one failure can be told apart
+	Counts map[string]int `json:"counts,omitempty"`
+	// RequestID identifies the request in the logs of the gateway and
+	// services
+	RequestID string `json:"request_id"`
+}
+
+// Detail is a problem with one field of the request, with the code of the
+// problem. In a batch, the field is prefixed with the index of the
+// transaction, as in [2].currency.
+type Detail struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Write writes an error response. Its request ID is that of the request's
+// X-Request-ID header, or a new one when the request has none, and is
+// echoed in the response header.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...Detail) {
+	write(w, r, status, Error{Code: code, Message: message, Details: details})
+}
+
+// WriteBatch writes the error response of a refused batch, which counts its
+// details by code
+func WriteBatch(w http.ResponseWriter, r *http.Request, status int, code, message string, details []Detail) {
+	counts := make(map[string]int)
+	for _, d := range details {
+		counts[d.Code]++
+	}
+	write(w, r, status, Error{Code: code, Message: message, Details: details, Counts: counts})
+}
+
+func write(w http.ResponseWriter, r *http.Request, status int, e Error) {
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	w.Header().Set(RequestIDHeader, requestID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	e.RequestID = requestID
+	json.NewEncoder(w).Encode(Envelope{Error: e})
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,120 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// decode decodes an error response, failing the test when it is not one
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	return body
+}
+
+func TestWriteEnvelope(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", nil)
+	r.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+
+	Write(w, r, http.StatusBadRequest, CodeMissingRequiredFields, "missing required fields",
+		Detail{Field: "account_id", Code: CodeMissingRequiredFields, Message: "is required"},
+		Detail{Field: "user_id", Code: CodeMissingRequiredFields, Message: "is required"})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "req-42" {
+		t.Errorf("%s = %q, want the request's", RequestIDHeader, got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+
+	want := map[string]any{"error": map[string]any{
+		"code":    "missing_required_fields",
+		"message": "missing required fields",
+		"details": []any{
+			map[string]any{"field": "account_id", "code": "missing_required_fields", "message": "is required"},
+			map[string]any{"field": "user_id", "code": "missing_required_fields", "message": "is required"},
+		},
+		"request_id": "req-42",
+	}}
+	if got := decode(t, w); !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v, want %v", got, want)
+	}
+}
+
+func TestWriteWithoutDetailsOrRequestID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", nil)
+	w := httptest.NewRecorder()
+	Write(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required")
+
+	e := decode(t, w)["error"].(map[string]any)
+	if _, ok := e["details"]; ok {
+		t.Errorf("error %v has details", e)
+	}
+	if _, ok := e["counts"]; ok {
+		t.Errorf("error %v has counts", e)
+	}
+	id, _ := e["request_id"].(string)
+	if len(id) != 32 || w.Header().Get(RequestIDHeader) != id {
+		t.Errorf("request ID %q, header %q, want the same generated ID", id, w.Header().Get(RequestIDHeader))
+	}
+
+	// Each request without an ID is given its own
+	w2 := httptest.NewRecorder()
+	Write(w2, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required")
+	if w2.Header().Get(RequestIDHeader) == id {
+		t.Error("two requests were given the same ID")
+	}
+}
+
+func TestWriteBatchCountsDetailsByCode(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/batch", nil)
+	w := httptest.NewRecorder()
+	WriteBatch(w, r, http.StatusBadRequest, CodeInvalidCurrency, "transaction 0: unsupported currency", []Detail{
+		{Field: "[0].currency", Code: CodeInvalidCurrency, Message: "unsupported"},
+		{Field: "[2].currency", Code: CodeInvalidCurrency, Message: "unsupported"},
+		{Field: "[2].user_id", Code: CodeMissingRequiredFields, Message: "is required"},
+	})
+
+	var envelope Envelope
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	want := map[string]int{CodeInvalidCurrency: 2, CodeMissingRequiredFields: 1}
+	if !reflect.DeepEqual(envelope.Error.Counts, want) {
+		t.Errorf("counts = %v, want %v", envelope.Error.Counts, want)
+	}
+	if len(envelope.Error.Details) != 3 || envelope.Error.Details[1].Field != "[2].currency" {
+		t.Errorf("details = %+v", envelope.Error.Details)
+	}
+}
+
+func TestCodesAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, code := range Codes {
+		if seen[code] {
+			t.Errorf("code %s listed twice", code)
+		}
+		seen[code] = true
+	}
+	for _, code := range []string{
+		CodeInvalidJSON, CodeMissingRequiredFields, CodeIdempotencyKeyRequired, CodeRateLimited,
+		CodeKafkaUnavailable, CodeForbidden, CodeUnauthorized,
+	} {
+		if !seen[code] {
+			t.Errorf("code %s not listed", code)
+		}
+	}
+}
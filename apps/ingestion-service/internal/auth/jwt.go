@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,29 +17,80 @@ type Claims struct {
 	UserID    string   `json:"user_id"`
 	AccountID string   `json:"account_id"`
 	Roles     []string `json:"roles"`
+	TenantID  string   `json:"tenant_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTManager handles JWT operations
+// ErrUnknownKeyID is returned for a token naming a key ID that is not
+// configured
+var ErrUnknownKeyID = errors.New("unknown key ID")
+
+// JWTManager handles JWT operations. Tokens are signed with the current key
+// and carry its ID in the kid header; tokens signed with any configured key
+// validate, so keys can be rotated without invalidating outstanding tokens.
 type JWTManager struct {
-	secret     string
+	mu         sync.RWMutex
+	keyID      string
+	keys       map[string][]byte
 	expiration time.Duration
 }
 
-// NewJWTManager creates a new JWT manager
-func NewJWTManager(secret string, expirationHours int) *JWTManager {
+// NewJWTManager creates a JWT manager signing with secret under keyID, and
+// accepting tokens signed with the previous secrets, by key ID
+func NewJWTManager(keyID, secret string, previous map[string]string, expirationHours int) *JWTManager {
+	keys := make(map[string][]byte, len(previous)+1)
+	for kid, s := range previous {
+		keys[kid] = []byte(s)
+	}
+	keys[keyID] = []byte(secret)
 	return &JWTManager{
-		secret:     secret,
+		keyID:      keyID,
+		keys:       keys,
 		expiration: time.Duration(expirationHours) * time.Hour,
 	}
 }
 
-// GenerateToken generates a new JWT token
-func (j *JWTManager) GenerateToken(userID, accountID string, roles []string) (string, error) {
+// SetSecret replaces the secret of the current key, so a rotated secret
+// applies without a restart. Tokens signed with the old secret under the
+// same key ID no longer validate; rotating to a new key ID, with the old one
+// among the previous secrets, keeps them valid.
+func (j *JWTManager) SetSecret(secret string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys[j.keyID] = []byte(secret)
+}
+
+// signingKey returns the ID and secret of the current key
+func (j *JWTManager) signingKey() (string, []byte) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keyID, j.keys[j.keyID]
+}
+
+// verificationKey returns the key named by the kid header of token. Tokens
+// without one, issued before key IDs, are checked against the current key.
+func (j *JWTManager) verificationKey(token *jwt.Token) ([]byte, error) {
+	kid, _ := token.Header["kid"].(string)
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if kid == "" {
+		kid = j.keyID
+	}
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKeyID, kid)
+	}
+	return key, nil
+}
+
+// GenerateToken generates a new JWT token. An empty tenantID leaves out the
+// tenant claim, for the default tenant.
+func (j *JWTManager) GenerateToken(userID, accountID string, roles []string, tenantID string) (string, error) {
 	claims := &Claims{
 		UserID:    userID,
 		AccountID: accountID,
 		Roles:     roles,
+		TenantID:  tenantID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -45,8 +98,10 @@ func (j *JWTManager) GenerateToken(userID, accountID string, roles []string) (st
 		},
 	}
 
+	kid, key := j.signingKey()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secret))
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
 // ValidateToken validates a JWT token and returns claims
@@ -55,7 +110,7 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(j.secret), nil
+		return j.verificationKey(token)
 	})
 
 	if err != nil {
@@ -69,6 +124,17 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
+// UnverifiedUserID returns the user_id claim of a token without verifying
+// it, or "" when the token does not parse. It identifies whom a rejected
+// token claimed to be, and must not be trusted for anything else.
+func UnverifiedUserID(tokenString string) string {
+	var claims Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return ""
+	}
+	return claims.UserID
+}
+
 // ExtractTokenFromHeader extracts JWT token from Authorization header
 func ExtractTokenFromHeader(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	oldSecret = "old-secret-at-least-thirty-two-bytes!"
+	newSecret = "new-secret-at-least-thirty-two-bytes!"
+)
+
+func TestTokenCarriesCurrentKeyID(t *testing.T) {
+	j := NewJWTManager("2025-06", newSecret, nil, 1)
+
+	token, err := j.GenerateToken("user-1", "acct-1", []string{"user"}, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := j.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.AccountID != "acct-1" {
+		t.Errorf("claims = %+v, want user-1/acct-1", claims)
+	}
+}
+
+func TestRotationKeepsOutstandingTokensValid(t *testing.T) {
+	before := NewJWTManager("2025-05", oldSecret, nil, 1)
+	outstanding, err := before.GenerateToken("user-1", "acct-1", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	after := NewJWTManager("2025-06", newSecret, map[string]string{"2025-05": oldSecret}, 1)
+	if _, err := after.ValidateToken(outstanding); err != nil {
+		t.Errorf("token of the previous key rejected after rotation: %v", err)
+	}
+
+	fresh, err := after.GenerateToken("user-2", "acct-2", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := after.ValidateToken(fresh); err != nil {
+		t.Errorf("token of the current key rejected: %v", err)
+	}
+	// The previous key only verifies; it cannot validate tokens of the new one
+	if _, err := before.ValidateToken(fresh); err == nil {
+		t.Error("token of the new key accepted by a manager that does not know it")
+	}
+}
+
+func TestUnknownKeyIDRejected(t *testing.T) {
+	issuer := NewJWTManager("retired", oldSecret, nil, 1)
+	token, err := issuer.GenerateToken("user-1", "acct-1", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	j := NewJWTManager("2025-06", newSecret, map[string]string{"2025-05": oldSecret}, 1)
+	_, err = j.ValidateToken(token)
+	if !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("ValidateToken error = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestSetSecretInvalidatesTokensOfTheReplacedSecret(t *testing.T) {
+	j := NewJWTManager("2025-06", oldSecret, nil, 1)
+	token, err := j.GenerateToken("user-1", "acct-1", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	j.SetSecret(newSecret)
+	if _, err := j.ValidateToken(token); err == nil {
+		t.Error("token signed with the replaced secret still validates")
+	}
+
+	// Tokens issued after the rotation are signed and checked with the new secret
+	token, err = j.GenerateToken("user-1", "acct-1", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := NewJWTManager("2025-06", newSecret, nil, 1).ValidateToken(token); err != nil {
+		t.Errorf("token issued after the rotation does not validate against the new secret: %v", err)
+	}
+	if _, err := j.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken after the rotation: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package callback checks the callback URLs transactions are submitted with.
+// The storage service posts the outcome of a transaction to its callback URL,
+// so only URLs on hosts the operators allowlisted are accepted, keeping the
+// pipeline from being pointed at arbitrary, possibly internal, addresses.
+package callback
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxURLLength bounds the length of a callback URL
+const maxURLLength = 2048
+
+// Allowlist is the set of hostnames callback URLs may point at, lowercase
+type Allowlist map[string]bool
+
+// ParseAllowlist reads a comma-separated list of hostnames
+func ParseAllowlist(list string) Allowlist {
+	allowed := make(Allowlist)
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowed[host] = true
+		}
+	}
+	return allowed
+}
+
+// Validate checks that raw is an absolute http or https URL on an
+// allowlisted host, without credentials
+func (a Allowlist) Validate(raw string) error {
+	if len(a) == 0 {
+		return errors.New("callback URLs are not accepted")
+	}
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("callback_url must be at most %d characters", maxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("callback_url is not an absolute URL")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("callback_url must be http or https")
+	}
+	if u.User != nil {
+		return errors.New("callback_url must not carry credentials")
+	}
+	if !a[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("callback_url host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
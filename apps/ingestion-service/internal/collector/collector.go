@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
 )
 
 // Transaction represents a normalized financial transaction event
@@ -42,9 +44,9 @@ func (m *MockCollector) Collect(out chan<- Transaction) error {
 			Source:    "mock",
 		}
 
-		// log transaction in JSON format
-		bytes, _ := json.Marshal(txn)
-		log.Printf("[collector] New Transaction: %s\n", string(bytes))
+		// log transaction in JSON format, sensitive values masked
+		redacted, _ := json.Marshal(logging.Redact(txn))
+		log.Printf("[collector] New Transaction: %s\n", redacted)
 
 		out <- txn
 		time.Sleep(500 * time.Millisecond) // simulate delay
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+
+	"ingestion-service/internal/models"
+)
+
+// Amount distributions of a Generator
+const (
+	AmountUniform   = "uniform"
+	AmountLogNormal = "lognormal"
+)
+
+var (
+	defaultCategories = []string{"groceries", "utilities", "entertainment", "transport"}
+	defaultMerchants  = []string{"Walmart", "Amazon", "Netflix", "Uber"}
+)
+
+// Generator produces fake transaction requests for driving the ingestion
+// API. It is safe for concurrent use.
+type Generator struct {
+	currencies    []string
+	dist          string
+	minAmount     float64
+	maxAmount     float64
+	accounts      int
+	duplicateRate float64
+
+	mu     sync.Mutex
+	seq    uint64
+	recent []models.TransactionRequest // ring of sent requests to duplicate
+	next   int
+}
+
+// GeneratorConfig configures a Generator
+type GeneratorConfig struct {
+	Currencies []string
+	// AmountDist is AmountUniform (the default) between MinAmount and
+	// MaxAmount, or AmountLogNormal, which skews towards small amounts
+	// with a long tail, clamped to the same range
+	AmountDist string
+	MinAmount  float64
+	MaxAmount  float64
+	// Accounts is the number of distinct accounts transactions spread over
+	Accounts int
+	// DuplicateRate is the fraction of requests, in [0, 1], that resend an
+	// earlier request with the same idempotency key
+	DuplicateRate float64
+}
+
+// recentSize is how many earlier requests a duplicate is picked from
+const recentSize = 1000
+
+// NewGenerator creates a generator, checking the configuration
+func NewGenerator(cfg GeneratorConfig) (*Generator, error) {
+	if len(cfg.Currencies) == 0 {
+		cfg.Currencies = []string{"USD"}
+	}
+	if cfg.AmountDist == "" {
+		cfg.AmountDist = AmountUniform
+	}
+	if cfg.AmountDist != AmountUniform && cfg.AmountDist != AmountLogNormal {
+		return nil, fmt.Errorf("unknown amount distribution %q", cfg.AmountDist)
+	}
+	if cfg.MinAmount <= 0 || cfg.MaxAmount < cfg.MinAmount {
+		return nil, fmt.Errorf("invalid amount range %.2f-%.2f", cfg.MinAmount, cfg.MaxAmount)
+	}
+	if cfg.Accounts < 1 {
+		cfg.Accounts = 1
+	}
+	if cfg.DuplicateRate < 0 || cfg.DuplicateRate > 1 {
+		return nil, fmt.Errorf("duplicate rate %.2f is not between 0 and 1", cfg.DuplicateRate)
+	}
+
+	return &Generator{
+		currencies:    cfg.Currencies,
+		dist:          cfg.AmountDist,
+		minAmount:     cfg.MinAmount,
+		maxAmount:     cfg.MaxAmount,
+		accounts:      cfg.Accounts,
+		duplicateRate: cfg.DuplicateRate,
+		recent:        make([]models.TransactionRequest, 0, recentSize),
+	}, nil
+}
+
+// Request returns the next transaction request, and whether it duplicates
+// an earlier one
+func (g *Generator) Request() (models.TransactionRequest, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.recent) > 0 && rand.Float64() < g.duplicateRate {
+		return g.recent[rand.IntN(len(g.recent))], true
+	}
+
+	g.seq++
+	req := models.TransactionRequest{
+		IdempotencyKey: fmt.Sprintf("loadgen_%d_%d", g.seq, rand.Uint32()),
+		AccountID:      fmt.Sprintf("acc_%d", rand.IntN(g.accounts)),
+		UserID:         fmt.Sprintf("user_%d", rand.IntN(g.accounts*10)),
+		Amount:         g.amount(),
+		Currency:       g.currencies[rand.IntN(len(g.currencies))],
+		Type:           pickType(),
+		Category:       defaultCategories[rand.IntN(len(defaultCategories))],
+		Merchant:       defaultMerchants[rand.IntN(len(defaultMerchants))],
+		Reference:      fmt.Sprintf("ref_%d", g.seq),
+		Metadata:       map[string]string{"source": "loadgen"},
+	}
+
+	if len(g.recent) < recentSize {
+		g.recent = append(g.recent, req)
+	} else {
+		g.recent[g.next] = req
+		g.next = (g.next + 1) % recentSize
+	}
+	return req, false
+}
+
+// amount draws an amount from the configured distribution, rounded to cents
+func (g *Generator) amount() float64 {
+	var a float64
+	switch g.dist {
+	case AmountLogNormal:
+		// Median at the geometric mean of the range
+		mu := (math.Log(g.minAmount) + math.Log(g.maxAmount)) / 2
+		a = math.Exp(mu + rand.NormFloat64())
+	default:
+		a = g.minAmount + rand.Float64()*(g.maxAmount-g.minAmount)
+	}
+	a = math.Min(math.Max(a, g.minAmount), g.maxAmount)
+	return math.Round(a*100) / 100
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewGeneratorValidates(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  GeneratorConfig
+		want string
+	}{
+		{"unknown distribution", GeneratorConfig{AmountDist: "normal", MinAmount: 1, MaxAmount: 10}, `unknown amount distribution "normal"`},
+		{"no minimum", GeneratorConfig{MaxAmount: 10}, "invalid amount range"},
+		{"inverted range", GeneratorConfig{MinAmount: 10, MaxAmount: 1}, "invalid amount range"},
+		{"duplicate rate above 1", GeneratorConfig{MinAmount: 1, MaxAmount: 10, DuplicateRate: 1.5}, "not between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGenerator(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewGenerator = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratorMix(t *testing.T) {
+	for _, dist := range []string{AmountUniform, AmountLogNormal} {
+		t.Run(dist, func(t *testing.T) {
+			g, err := NewGenerator(GeneratorConfig{
+				Currencies: []string{"USD", "EUR"},
+				AmountDist: dist,
+				MinAmount:  5,
+				MaxAmount:  500,
+				Accounts:   3,
+			})
+			if err != nil {
+				t.Fatalf("NewGenerator: %v", err)
+			}
+
+			currencies := make(map[string]int)
+			keys := make(map[string]bool)
+			for range 1000 {
+				req, duplicate := g.Request()
+				if duplicate || keys[req.IdempotencyKey] {
+					t.Fatalf("duplicate request %s without a duplicate rate", req.IdempotencyKey)
+				}
+				keys[req.IdempotencyKey] = true
+				currencies[req.Currency]++
+				if req.Amount < 5 || req.Amount > 500 {
+					t.Errorf("amount %.2f outside 5-500", req.Amount)
+				}
+				if req.AccountID != "acc_0" && req.AccountID != "acc_1" && req.AccountID != "acc_2" {
+					t.Errorf("account %s outside the 3 configured", req.AccountID)
+				}
+			}
+			if len(currencies) != 2 || currencies["USD"] < 400 || currencies["EUR"] < 400 {
+				t.Errorf("currencies = %v, want an even USD and EUR mix", currencies)
+			}
+		})
+	}
+}
+
+func TestGeneratorDuplicates(t *testing.T) {
+	g, err := NewGenerator(GeneratorConfig{MinAmount: 1, MaxAmount: 10, DuplicateRate: 0.2})
+	if err != nil {
+		t.Fatalf("NewGenerator: %v", err)
+	}
+
+	sent := make(map[string]float64)
+	duplicates := 0
+	for range 5000 {
+		req, duplicate := g.Request()
+		if !duplicate {
+			sent[req.IdempotencyKey] = req.Amount
+			continue
+		}
+		duplicates++
+		// A duplicate resends an earlier request as it was
+		if amount, ok := sent[req.IdempotencyKey]; !ok || amount != req.Amount {
+			t.Fatalf("duplicate %s does not match an earlier request", req.IdempotencyKey)
+		}
+	}
+	if rate := float64(duplicates) / 5000; rate < 0.17 || rate > 0.23 {
+		t.Errorf("duplicate rate %.3f, want about 0.2", rate)
+	}
+}
@@ -1,63 +1,456 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"ingestion-service/internal/callback"
+	"ingestion-service/internal/duplicates"
+	"ingestion-service/internal/metadata"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+)
+
+// defaultRouteTimeouts are the deadlines, in milliseconds, of the routes
+// whose requests take notably less or more than others
+const defaultRouteTimeouts = "/api/v1/transactions=2000,/api/v1/transactions/batch=10000,/api/v1/transactions/upload=60000"
+
+// DevEnvironment is the APP_ENV value that turns on DevMode when DEV_MODE
+// is not set
+const DevEnvironment = "development"
+
+// Ingest modes: direct publishes accepted transactions to Kafka, outbox
+// stores them in the outbox database first and relays them
+const (
+	IngestModeDirect = "direct"
+	IngestModeOutbox = "outbox"
 )
 
+// defaultJWTSecret is the placeholder secret, refused outside dev mode
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// minJWTSecretLength is the length in bytes a JWT secret must have outside
+// dev mode, the size of the HS256 hash
+const minJWTSecretLength = 32
+
 // Config holds all configuration for our service
 type Config struct {
+	// DevMode, set by DEV_MODE or else APP_ENV=development, accepts
+	// placeholder and short JWT secrets
+	DevMode bool
+
+	// TokenEndpointEnabled serves /api/v1/auth/token, which mints tokens for
+	// testing. It defaults to DevMode.
+	TokenEndpointEnabled bool
+
 	// HTTP server configuration
 	HTTPPORT string
 	HTTPHOST string
 
+	// Request deadlines. RouteTimeouts maps a route path to how long its
+	// requests may run before they are abandoned with 503; other routes get
+	// RequestTimeout. The server's read and write timeouts follow the
+	// longest deadline.
+	RequestTimeout int            // in milliseconds
+	RouteTimeouts  map[string]int // in milliseconds
+
 	// Kafka configuration
 	KafkaBrokers string
 	KafkaTopic   string
 
-	// Redis configuration for idempotency and caching
-	RedisAddr     string
-	RedisPassword string
-	RedisDB       int
+	// Kafka TLS and SASL configuration
+	KafkaSecurity kafkaconn.Config
+
+	// Compression, batching and acknowledgements of the producer
+	KafkaWriter kafkaconn.WriterConfig
+
+	// KafkaTopics provisions the topics the service produces to at
+	// startup, when TOPIC_AUTOCREATE is set
+	KafkaTopics kafkaconn.TopicsConfig
+
+	// Redis configuration for idempotency and caching: a single node, or
+	// through Sentinel or a cluster
+	Redis redisconn.Config
+
+	// Redis soft-fail: each operation is bounded by RedisOpTimeout, and
+	// RedisBreakerThreshold consecutive failures skip Redis for
+	// RedisBreakerCooldown before it is probed again
+	RedisOpTimeout        int // in milliseconds
+	RedisBreakerThreshold int
+	RedisBreakerCooldown  int // in seconds
 
-	// JWT configuration
-	JWTSecret     string
-	JWTExpiration int // in hours
+	// JWT configuration. Tokens are signed with JWTSecret and carry
+	// JWTKeyID; tokens signed with JWTPreviousSecrets, a map of key ID to
+	// secret, still validate during a rotation.
+	JWTSecret          string
+	JWTKeyID           string
+	JWTPreviousSecrets map[string]string
+	JWTExpiration      int // in hours
 
 	// Security configuration
 	RateLimitPerSecond int
 	MaxRequestSize     int64 // in bytes
 
+	// Authentication lockout: AuthLockoutThreshold invalid tokens from a
+	// client IP or user_id claim within AuthLockoutWindow refuse its further
+	// invalid tokens with 429 for AuthLockoutCooldown. The token endpoint
+	// allows AuthTokenRateLimit requests per client IP per
+	// AuthTokenRateWindow. With TrustForwardedFor the client IP is taken
+	// from X-Forwarded-For, set by the gateway.
+	AuthLockoutEnabled   bool
+	AuthLockoutThreshold int64
+	AuthLockoutWindow    int // in seconds
+	AuthLockoutCooldown  int // in seconds
+	AuthTokenRateLimit   int64
+	AuthTokenRateWindow  int // in seconds
+	TrustForwardedFor    bool
+
 	// Monitoring configuration
 	MetricsEnabled bool
 	MetricsPort    string
+
+	// APIDocsEnabled serves a Swagger UI page at /docs
+	APIDocsEnabled bool
+
+	// StartupTimeout bounds the wait for Redis, Kafka and, in outbox mode,
+	// the outbox database at startup
+	StartupTimeout int // in seconds
+
+	// ShutdownDeadline bounds the whole shutdown, past which the components
+	// not yet stopped are abandoned and the service exits with an error
+	ShutdownDeadline int // in seconds
+
+	// Back-pressure. While the p95 Kafka publish latency or the number of
+	// queued messages is over its threshold, BackpressureShedPercent of
+	// non-admin requests get 503 and the service reports not ready. It
+	// recovers once both fall below BackpressureRecoveryRatio of their
+	// thresholds.
+	BackpressureEnabled       bool
+	BackpressureLatencyMs     int
+	BackpressureQueueMax      int64
+	BackpressureShedPercent   int
+	BackpressureRecoveryRatio float64
+	BackpressureWindow        int // in seconds
+	BackpressureRetryAfter    int // in seconds
+
+	// Ingest mode and, in outbox mode, the PostgreSQL outbox the relay
+	// publishes from
+	IngestMode         string
+	OutboxDatabaseURL  string
+	OutboxPollInterval int // in milliseconds
+	OutboxBatchSize    int
+	OutboxRetention    int // in hours
+
+	// Duplicate detection by content, whatever the idempotency key. In
+	// reject or tag mode a transaction hashing the same over
+	// DuplicateHashFields as one accepted in the last DuplicateWindow
+	// seconds is refused with 409, or accepted tagged as a suspected
+	// duplicate.
+	DuplicateDetection  string
+	DuplicateHashFields []string
+	DuplicateWindow     int // in seconds
+
+	// Secret rotation. JWTSecretFile is the file JWT_SECRET is read from,
+	// empty when set directly; it is polled every SecretsReloadInterval.
+	JWTSecretFile         string
+	SecretsReloadInterval int // in seconds
+
+	// AllowedTenants lists the tenants, besides the default one, that tokens
+	// may be issued for and transactions ingested into
+	AllowedTenants tenant.Set
+
+	// SupportedCurrencies lists the ISO 4217 currencies transactions may be
+	// ingested in
+	SupportedCurrencies currency.Allowlist
+
+	// CallbackHosts lists the hostnames transactions' callback URLs may
+	// point at; with none, transactions with a callback URL are refused
+	CallbackHosts callback.Allowlist
+
+	// MetadataLimits bounds the metadata of transactions. In strict mode
+	// metadata breaking a limit is refused with 400; in lenient mode it is
+	// truncated to fit and flagged metadata_truncated.
+	MetadataLimits metadata.Limits
+
+	// LogConfigOnStart logs the effective configuration, secrets redacted
+	LogConfigOnStart bool
+
+	// parseErrors lists environment values that could not be parsed
+	parseErrors []error
 }
 
-// LoadConfig reads configuration from environment variables
+// LoadConfig reads configuration from environment variables. Values that
+// cannot be parsed fall back to their defaults and are reported by Validate.
 func LoadConfig() *Config {
-	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
-	rateLimit, _ := strconv.Atoi(getEnv("RATE_LIMIT_PER_SECOND", "1000"))
-	maxRequestSize, _ := strconv.ParseInt(getEnv("MAX_REQUEST_SIZE", "1048576"), 10, 64) // 1MB default
-	jwtExpiration, _ := strconv.Atoi(getEnv("JWT_EXPIRATION_HOURS", "24"))
-	metricsEnabled, _ := strconv.ParseBool(getEnv("METRICS_ENABLED", "true"))
-
-	return &Config{
-		HTTPPORT:           getEnv("HTTP_PORT", "8080"),
-		HTTPHOST:           getEnv("HTTP_HOST", "0.0.0.0"),
-		KafkaBrokers:       getEnv("KAFKA_BROKERS", "localhost:9092"),
-		KafkaTopic:         getEnv("KAFKA_TOPIC", "transactions.raw"),
-		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
-		RedisDB:            redisDB,
-		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		JWTExpiration:      jwtExpiration,
-		RateLimitPerSecond: rateLimit,
-		MaxRequestSize:     maxRequestSize,
-		MetricsEnabled:     metricsEnabled,
-		MetricsPort:        getEnv("METRICS_PORT", "9090"),
+	envErrors = nil
+	cfg := &Config{
+		DevMode:               getEnvAsBool("DEV_MODE", os.Getenv("APP_ENV") == DevEnvironment),
+		HTTPPORT:              getEnv("HTTP_PORT", "8080"),
+		HTTPHOST:              getEnv("HTTP_HOST", "0.0.0.0"),
+		RequestTimeout:        getEnvAsInt("REQUEST_TIMEOUT_MS", 5000),
+		RouteTimeouts:         getEnvAsIntMap("ROUTE_TIMEOUTS_MS", defaultRouteTimeouts),
+		KafkaBrokers:          getEnv("KAFKA_BROKERS", "localhost:9092"),
+		KafkaTopic:            getEnv("KAFKA_TOPIC", "transactions.raw"),
+		KafkaSecurity:         kafkaconn.LoadConfig(),
+		KafkaWriter:           kafkaconn.LoadWriterConfig(),
+		KafkaTopics:           kafkaconn.LoadTopicsConfig(),
+		Redis:                 redisconn.LoadConfig(),
+		RedisOpTimeout:        getEnvAsInt("REDIS_OP_TIMEOUT_MS", 50),
+		RedisBreakerThreshold: getEnvAsInt("REDIS_BREAKER_THRESHOLD", 5),
+		RedisBreakerCooldown:  getEnvAsInt("REDIS_BREAKER_COOLDOWN_SECONDS", 10),
+		JWTSecret:             getSecret("JWT_SECRET", defaultJWTSecret),
+		JWTKeyID:              getEnv("JWT_KEY_ID", "default"),
+		JWTPreviousSecrets:    getSecretKeys("JWT_PREVIOUS_SECRETS"),
+		JWTExpiration:         getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+		RateLimitPerSecond:    getEnvAsInt("RATE_LIMIT_PER_SECOND", 1000),
+		MaxRequestSize:        getEnvAsInt64("MAX_REQUEST_SIZE", 1048576), // 1MB default
+		AuthLockoutEnabled:    getEnvAsBool("AUTH_LOCKOUT_ENABLED", true),
+		AuthLockoutThreshold:  getEnvAsInt64("AUTH_LOCKOUT_THRESHOLD", 20),
+		AuthLockoutWindow:     getEnvAsInt("AUTH_LOCKOUT_WINDOW_SECONDS", 60),
+		AuthLockoutCooldown:   getEnvAsInt("AUTH_LOCKOUT_COOLDOWN_SECONDS", 300),
+		AuthTokenRateLimit:    getEnvAsInt64("AUTH_TOKEN_RATE_LIMIT", 10),
+		AuthTokenRateWindow:   getEnvAsInt("AUTH_TOKEN_RATE_WINDOW_SECONDS", 60),
+		TrustForwardedFor:     getEnvAsBool("TRUST_FORWARDED_FOR", false),
+		MetricsEnabled:        getEnvAsBool("METRICS_ENABLED", true),
+		MetricsPort:           getEnv("METRICS_PORT", "9090"),
+		APIDocsEnabled:        getEnvAsBool("API_DOCS_ENABLED", false),
+		StartupTimeout:        getEnvAsInt("STARTUP_TIMEOUT", 60),
+		ShutdownDeadline:      getEnvAsInt("SHUTDOWN_DEADLINE", 60),
+		JWTSecretFile:         secrets.File("JWT_SECRET"),
+		SecretsReloadInterval: getEnvAsInt("SECRETS_RELOAD_SECONDS", 30),
+		AllowedTenants:        tenant.Parse(getEnv("ALLOWED_TENANTS", "")),
+		SupportedCurrencies:   getEnvAsCurrencies("SUPPORTED_CURRENCIES", currency.DefaultSupported),
+		CallbackHosts:         callback.ParseAllowlist(getEnv("CALLBACK_ALLOWED_HOSTS", "")),
+		LogConfigOnStart:      getEnvAsBool("LOG_CONFIG_ON_START", false),
+
+		MetadataLimits: metadata.Limits{
+			MaxKeys:        getEnvAsInt("METADATA_MAX_KEYS", 20),
+			MaxKeyLength:   getEnvAsInt("METADATA_MAX_KEY_LENGTH", 64),
+			MaxValueLength: getEnvAsInt("METADATA_MAX_VALUE_LENGTH", 256),
+			MaxSize:        getEnvAsInt("METADATA_MAX_BYTES", 4096),
+			KnownOnly:      getEnvAsBool("METADATA_KNOWN_KEYS_ONLY", false),
+			Mode:           getEnv("METADATA_MODE", metadata.ModeStrict),
+		},
+
+		BackpressureEnabled:       getEnvAsBool("BACKPRESSURE_ENABLED", true),
+		BackpressureLatencyMs:     getEnvAsInt("BACKPRESSURE_LATENCY_MS", 500),
+		BackpressureQueueMax:      getEnvAsInt64("BACKPRESSURE_QUEUE_MAX", 10000),
+		BackpressureShedPercent:   getEnvAsInt("BACKPRESSURE_SHED_PERCENT", 50),
+		BackpressureRecoveryRatio: getEnvAsFloat("BACKPRESSURE_RECOVERY_RATIO", 0.8),
+		BackpressureWindow:        getEnvAsInt("BACKPRESSURE_WINDOW_SECONDS", 30),
+		BackpressureRetryAfter:    getEnvAsInt("BACKPRESSURE_RETRY_AFTER_SECONDS", 5),
+
+		IngestMode:         getEnv("INGEST_MODE", IngestModeDirect),
+		OutboxDatabaseURL:  getSecret("OUTBOX_DATABASE_URL", ""),
+		OutboxPollInterval: getEnvAsInt("OUTBOX_POLL_INTERVAL_MS", 100),
+		OutboxBatchSize:    getEnvAsInt("OUTBOX_BATCH_SIZE", 500),
+		OutboxRetention:    getEnvAsInt("OUTBOX_RETENTION_HOURS", 24),
+
+		DuplicateDetection:  getEnv("DUPLICATE_DETECTION", duplicates.ModeOff),
+		DuplicateHashFields: getEnvAsHashFields("DUPLICATE_HASH_FIELDS", duplicates.DefaultFields),
+		DuplicateWindow:     getEnvAsInt("DUPLICATE_WINDOW_SECONDS", 300),
+	}
+	cfg.TokenEndpointEnabled = getEnvAsBool("TOKEN_ENDPOINT_ENABLED", cfg.DevMode)
+	cfg.parseErrors, envErrors = envErrors, nil
+
+	return cfg
+}
+
+// Validate checks the configuration and returns every problem found, joined
+// into one error
+func (c *Config) Validate() error {
+	problems := append([]error(nil), c.parseErrors...)
+
+	if !c.DevMode {
+		if c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret {
+			problems = append(problems, errors.New("JWT_SECRET must be set unless DEV_MODE=true"))
+		} else if len(c.JWTSecret) < minJWTSecretLength {
+			problems = append(problems, fmt.Errorf("JWT_SECRET must be at least %d bytes unless DEV_MODE=true", minJWTSecretLength))
+		}
+		for kid, secret := range c.JWTPreviousSecrets {
+			if len(secret) < minJWTSecretLength {
+				problems = append(problems, fmt.Errorf("JWT_PREVIOUS_SECRETS: secret of key %q must be at least %d bytes unless DEV_MODE=true", kid, minJWTSecretLength))
+			}
+		}
+	}
+	if c.JWTKeyID == "" {
+		problems = append(problems, errors.New("JWT_KEY_ID is empty"))
+	}
+	if _, ok := c.JWTPreviousSecrets[c.JWTKeyID]; ok {
+		problems = append(problems, fmt.Errorf("JWT_PREVIOUS_SECRETS must not include the current key %q", c.JWTKeyID))
+	}
+	if !hasBroker(c.KafkaBrokers) {
+		problems = append(problems, errors.New("KAFKA_BROKERS lists no brokers"))
+	}
+	if c.KafkaTopic == "" {
+		problems = append(problems, errors.New("KAFKA_TOPIC is empty"))
+	}
+	if err := c.KafkaWriter.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := c.KafkaTopics.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := c.Redis.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RedisOpTimeout < 1 || c.RedisBreakerThreshold < 1 || c.RedisBreakerCooldown < 1 {
+		problems = append(problems, errors.New("REDIS_OP_TIMEOUT_MS, REDIS_BREAKER_THRESHOLD and REDIS_BREAKER_COOLDOWN_SECONDS must be positive"))
+	}
+	if c.JWTExpiration < 1 {
+		problems = append(problems, errors.New("JWT_EXPIRATION_HOURS must be positive"))
+	}
+	if c.RateLimitPerSecond < 1 {
+		problems = append(problems, errors.New("RATE_LIMIT_PER_SECOND must be positive"))
+	}
+	if c.MaxRequestSize < 1 {
+		problems = append(problems, errors.New("MAX_REQUEST_SIZE must be positive"))
+	}
+	if c.AuthLockoutEnabled && (c.AuthLockoutThreshold < 1 || c.AuthLockoutWindow < 1 || c.AuthLockoutCooldown < 1 ||
+		c.AuthTokenRateLimit < 1 || c.AuthTokenRateWindow < 1) {
+		problems = append(problems, errors.New("AUTH_LOCKOUT_THRESHOLD, AUTH_LOCKOUT_WINDOW_SECONDS, AUTH_LOCKOUT_COOLDOWN_SECONDS, AUTH_TOKEN_RATE_LIMIT and AUTH_TOKEN_RATE_WINDOW_SECONDS must be positive"))
+	}
+	if c.RequestTimeout < 1 {
+		problems = append(problems, errors.New("REQUEST_TIMEOUT_MS must be positive"))
+	}
+	for route, ms := range c.RouteTimeouts {
+		if ms < 1 {
+			problems = append(problems, fmt.Errorf("ROUTE_TIMEOUTS_MS: deadline of %s must be positive", route))
+		}
+	}
+	if c.StartupTimeout < 1 {
+		problems = append(problems, errors.New("STARTUP_TIMEOUT must be positive"))
+	}
+	if c.ShutdownDeadline < 1 {
+		problems = append(problems, errors.New("SHUTDOWN_DEADLINE must be positive"))
+	}
+	if c.SecretsReloadInterval < 1 {
+		problems = append(problems, errors.New("SECRETS_RELOAD_SECONDS must be positive"))
+	}
+	if c.BackpressureEnabled {
+		if c.BackpressureLatencyMs < 1 {
+			problems = append(problems, errors.New("BACKPRESSURE_LATENCY_MS must be positive"))
+		}
+		if c.BackpressureQueueMax < 1 {
+			problems = append(problems, errors.New("BACKPRESSURE_QUEUE_MAX must be positive"))
+		}
+		if c.BackpressureShedPercent < 0 || c.BackpressureShedPercent > 100 {
+			problems = append(problems, errors.New("BACKPRESSURE_SHED_PERCENT must be between 0 and 100"))
+		}
+		if c.BackpressureRecoveryRatio <= 0 || c.BackpressureRecoveryRatio > 1 {
+			problems = append(problems, errors.New("BACKPRESSURE_RECOVERY_RATIO must be above 0 and at most 1"))
+		}
+		if c.BackpressureWindow < 1 {
+			problems = append(problems, errors.New("BACKPRESSURE_WINDOW_SECONDS must be positive"))
+		}
+		if c.BackpressureRetryAfter < 1 {
+			problems = append(problems, errors.New("BACKPRESSURE_RETRY_AFTER_SECONDS must be positive"))
+		}
+	}
+	switch c.IngestMode {
+	case IngestModeDirect:
+	case IngestModeOutbox:
+		if c.OutboxDatabaseURL == "" {
+			problems = append(problems, errors.New("OUTBOX_DATABASE_URL must be set in outbox mode"))
+		}
+		if c.OutboxPollInterval < 1 || c.OutboxBatchSize < 1 || c.OutboxRetention < 1 {
+			problems = append(problems, errors.New("OUTBOX_POLL_INTERVAL_MS, OUTBOX_BATCH_SIZE and OUTBOX_RETENTION_HOURS must be positive"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("INGEST_MODE must be %s or %s, got %q", IngestModeDirect, IngestModeOutbox, c.IngestMode))
+	}
+
+	limits := c.MetadataLimits
+	if limits.MaxKeys < 1 || limits.MaxKeyLength < 1 || limits.MaxValueLength < 1 || limits.MaxSize < 1 {
+		problems = append(problems, errors.New("METADATA_MAX_KEYS, METADATA_MAX_KEY_LENGTH, METADATA_MAX_VALUE_LENGTH and METADATA_MAX_BYTES must be positive"))
+	}
+	if limits.Mode != metadata.ModeStrict && limits.Mode != metadata.ModeLenient {
+		problems = append(problems, fmt.Errorf("METADATA_MODE must be %s or %s, got %q", metadata.ModeStrict, metadata.ModeLenient, limits.Mode))
 	}
+
+	switch c.DuplicateDetection {
+	case duplicates.ModeOff:
+	case duplicates.ModeReject, duplicates.ModeTag:
+		if c.DuplicateWindow < 1 {
+			problems = append(problems, errors.New("DUPLICATE_WINDOW_SECONDS must be positive"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("DUPLICATE_DETECTION must be %s, %s or %s, got %q",
+			duplicates.ModeOff, duplicates.ModeReject, duplicates.ModeTag, c.DuplicateDetection))
+	}
+
+	if err := buckets.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+// OutputTopics returns the specs of the topics the service produces to
+func (c *Config) OutputTopics() []kafkaconn.TopicSpec {
+	return c.KafkaTopics.Specs(c.KafkaTopic)
+}
+
+// String renders the configuration with secrets redacted
+func (c Config) String() string {
+	type plain Config
+	p := plain(c)
+	p.JWTSecret = redact(p.JWTSecret)
+	p.JWTPreviousSecrets = make(map[string]string, len(c.JWTPreviousSecrets))
+	for kid, secret := range c.JWTPreviousSecrets {
+		p.JWTPreviousSecrets[kid] = redact(secret)
+	}
+	p.OutboxDatabaseURL = redact(p.OutboxDatabaseURL)
+	p.parseErrors = nil
+	return fmt.Sprintf("%+v", p)
+}
+
+// RouteTimeout returns the deadline of requests to the route path
+func (c *Config) RouteTimeout(path string) time.Duration {
+	if ms, ok := c.RouteTimeouts[path]; ok {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Duration(c.RequestTimeout) * time.Millisecond
+}
+
+// MaxRouteTimeout returns the longest request deadline
+func (c *Config) MaxRouteTimeout() time.Duration {
+	longest := c.RequestTimeout
+	for _, ms := range c.RouteTimeouts {
+		longest = max(longest, ms)
+	}
+	return time.Duration(longest) * time.Millisecond
 }
 
+// redact hides a secret, keeping whether it was set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// hasBroker reports whether a comma-separated broker list names a broker
+func hasBroker(brokers string) bool {
+	for _, b := range strings.Split(brokers, ",") {
+		if strings.TrimSpace(b) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// envErrors collects the values the helpers fail to parse during LoadConfig
+var envErrors []error
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -65,3 +458,133 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getSecret reads a secret from key, or from the file named by key_FILE
+func getSecret(key, defaultValue string) string {
+	value, err := secrets.Lookup(key)
+	if err != nil {
+		envErrors = append(envErrors, err)
+		return defaultValue
+	}
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getSecretKeys reads a secret holding a comma-separated list of key ID and
+// secret pairs, each as kid:secret
+func getSecretKeys(key string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(getSecret(key, ""), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			envErrors = append(envErrors, fmt.Errorf("%s: entries must be kid:secret", key))
+			continue
+		}
+		keys[kid] = secret
+	}
+	return keys
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+			return defaultValue
+		}
+		return intValue
+	}
+	return defaultValue
+}
+
+func getEnvAsInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+			return defaultValue
+		}
+		return intValue
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a number", key, value))
+			return defaultValue
+		}
+		return floatValue
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a boolean", key, value))
+			return defaultValue
+		}
+		return boolValue
+	}
+	return defaultValue
+}
+
+// getEnvAsCurrencies parses a comma-separated list of ISO 4217 codes,
+// falling back to the default list when it is invalid
+func getEnvAsCurrencies(key, defaultValue string) currency.Allowlist {
+	allowed, err := currency.ParseAllowlist(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, fmt.Errorf("%s: %w", key, err))
+		allowed, _ = currency.ParseAllowlist(defaultValue)
+	}
+	return allowed
+}
+
+// getEnvAsHashFields parses a comma-separated list of the transaction fields
+// duplicate detection hashes, falling back to the default list when it is
+// invalid
+func getEnvAsHashFields(key, defaultValue string) []string {
+	fields, err := duplicates.ParseFields(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, fmt.Errorf("%s: %w", key, err))
+		fields, _ = duplicates.ParseFields(defaultValue)
+	}
+	return fields
+}
+
+// getEnvAsIntMap parses "key=integer" pairs, falling back to the default
+// pairs when any is malformed
+func getEnvAsIntMap(key, defaultValue string) map[string]int {
+	parse := func(list string) (map[string]int, error) {
+		values := make(map[string]int)
+		for _, pair := range strings.Split(list, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if k = strings.TrimSpace(k); !ok || k == "" || err != nil {
+				return nil, fmt.Errorf("%s: %q is not key=integer", key, pair)
+			}
+			values[k] = n
+		}
+		return values, nil
+	}
+
+	values, err := parse(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, err)
+		values, _ = parse(defaultValue)
+	}
+	return values
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const strongSecret = "a-production-secret-of-32-bytes!!"
+
+func TestStartupGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "default secret refused",
+			env:     map[string]string{"JWT_SECRET": defaultJWTSecret},
+			wantErr: "JWT_SECRET must be set",
+		},
+		{
+			name:    "short secret refused",
+			env:     map[string]string{"JWT_SECRET": "too-short"},
+			wantErr: "at least 32 bytes",
+		},
+		{
+			name:    "short previous secret refused",
+			env:     map[string]string{"JWT_SECRET": strongSecret, "JWT_PREVIOUS_SECRETS": "old:short"},
+			wantErr: `secret of key "old"`,
+		},
+		{
+			name: "strong secret accepted",
+			env:  map[string]string{"JWT_SECRET": strongSecret},
+		},
+		{
+			name: "default secret accepted in dev mode",
+			env:  map[string]string{"JWT_SECRET": defaultJWTSecret, "DEV_MODE": "true"},
+		},
+		{
+			name: "APP_ENV=development turns on dev mode",
+			env:  map[string]string{"JWT_SECRET": defaultJWTSecret, "APP_ENV": DevEnvironment},
+		},
+		{
+			name:    "DEV_MODE=false wins over APP_ENV",
+			env:     map[string]string{"JWT_SECRET": defaultJWTSecret, "APP_ENV": DevEnvironment, "DEV_MODE": "false"},
+			wantErr: "JWT_SECRET must be set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", "")
+			t.Setenv("DEV_MODE", "")
+			t.Setenv("JWT_PREVIOUS_SECRETS", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			err := LoadConfig().Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// validEnv is an environment the configuration validates in
+var validEnv = map[string]string{
+	"APP_ENV":                     "",
+	"DEV_MODE":                    "",
+	"JWT_SECRET":                  strongSecret,
+	"JWT_SECRET_FILE":             "",
+	"JWT_PREVIOUS_SECRETS":        "",
+	"KAFKA_BROKERS":               "kafka-1:9092,kafka-2:9092",
+	"RATE_LIMIT_PER_SECOND":       "",
+	"METRICS_ENABLED":             "",
+	"ROUTE_TIMEOUTS_MS":           "",
+	"INGEST_MODE":                 "",
+	"OUTBOX_DATABASE_URL":         "",
+	"BACKPRESSURE_ENABLED":        "",
+	"BACKPRESSURE_RECOVERY_RATIO": "",
+	"SUPPORTED_CURRENCIES":        "",
+	"DUPLICATE_DETECTION":         "",
+	"DUPLICATE_HASH_FIELDS":       "",
+	"DUPLICATE_WINDOW_SECONDS":    "",
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "valid"},
+		{
+			name: "unparsable numbers are reported, not defaulted",
+			env:  map[string]string{"RATE_LIMIT_PER_SECOND": "fast", "BACKPRESSURE_RECOVERY_RATIO": "most"},
+			want: []string{`RATE_LIMIT_PER_SECOND: "fast" is not an integer`, `BACKPRESSURE_RECOVERY_RATIO: "most" is not a number`},
+		},
+		{
+			name: "unparsable boolean",
+			env:  map[string]string{"METRICS_ENABLED": "sometimes"},
+			want: []string{`METRICS_ENABLED: "sometimes" is not a boolean`},
+		},
+		{
+			name: "unparsable route deadlines",
+			env:  map[string]string{"ROUTE_TIMEOUTS_MS": "/api/v1/transactions/batch:30000"},
+			want: []string{`ROUTE_TIMEOUTS_MS: "/api/v1/transactions/batch:30000" is not key=integer`},
+		},
+		{
+			name: "no brokers",
+			env:  map[string]string{"KAFKA_BROKERS": " , "},
+			want: []string{"KAFKA_BROKERS lists no brokers"},
+		},
+		{
+			name: "unreadable secret file",
+			env:  map[string]string{"JWT_SECRET": "", "JWT_SECRET_FILE": "/nonexistent/jwt-secret"},
+			want: []string{"JWT_SECRET_FILE"},
+		},
+		{
+			name: "outbox mode without its database",
+			env:  map[string]string{"INGEST_MODE": IngestModeOutbox},
+			want: []string{"OUTBOX_DATABASE_URL must be set in outbox mode"},
+		},
+		{
+			name: "unknown currencies",
+			env:  map[string]string{"SUPPORTED_CURRENCIES": "USD,XYZ"},
+			want: []string{"SUPPORTED_CURRENCIES: unknown ISO 4217 currency codes: XYZ"},
+		},
+		{
+			name: "currencies beyond the default",
+			env:  map[string]string{"SUPPORTED_CURRENCIES": "usd,jpy,bhd"},
+		},
+		{
+			name: "unknown duplicate detection mode and hash field",
+			env:  map[string]string{"DUPLICATE_DETECTION": "drop", "DUPLICATE_HASH_FIELDS": "account_id,iban"},
+			want: []string{`DUPLICATE_DETECTION must be off, reject or tag, got "drop"`, `DUPLICATE_HASH_FIELDS: unknown field "iban"`},
+		},
+		{
+			name: "duplicate detection without a window",
+			env:  map[string]string{"DUPLICATE_DETECTION": "tag", "DUPLICATE_WINDOW_SECONDS": "0"},
+			want: []string{"DUPLICATE_WINDOW_SECONDS must be positive"},
+		},
+		{
+			name: "duplicate detection hashing configured fields",
+			env:  map[string]string{"DUPLICATE_DETECTION": "reject", "DUPLICATE_HASH_FIELDS": "account_id, amount"},
+		},
+		{
+			name: "no time to wait for dependencies",
+			env:  map[string]string{"STARTUP_TIMEOUT": "0"},
+			want: []string{"STARTUP_TIMEOUT must be positive"},
+		},
+		{
+			name: "writer tuning out of range",
+			env:  map[string]string{"KAFKA_WRITER_COMPRESSION": "brotli", "KAFKA_WRITER_BATCH_SIZE": "-1"},
+			want: []string{`KAFKA_WRITER_COMPRESSION: "brotli"`, "KAFKA_WRITER_WRITE_TIMEOUT_MS must not be negative"},
+		},
+		{
+			name: "deadlines that are not positive",
+			env:  map[string]string{"REQUEST_TIMEOUT_MS": "0", "ROUTE_TIMEOUTS_MS": "/api/v1/transactions=-1"},
+			want: []string{"REQUEST_TIMEOUT_MS must be positive", "ROUTE_TIMEOUTS_MS: deadline of /api/v1/transactions must be positive"},
+		},
+		{
+			name: "Redis soft-fail settings that are not positive",
+			env:  map[string]string{"REDIS_OP_TIMEOUT_MS": "0", "REDIS_BREAKER_THRESHOLD": "-1"},
+			want: []string{"REDIS_OP_TIMEOUT_MS, REDIS_BREAKER_THRESHOLD and REDIS_BREAKER_COOLDOWN_SECONDS must be positive"},
+		},
+		{
+			name: "metadata limits out of range and an unknown mode",
+			env:  map[string]string{"METADATA_MAX_KEYS": "0", "METADATA_MODE": "truncate"},
+			want: []string{"METADATA_MAX_KEYS, METADATA_MAX_KEY_LENGTH, METADATA_MAX_VALUE_LENGTH and METADATA_MAX_BYTES must be positive",
+				`METADATA_MODE must be strict or lenient, got "truncate"`},
+		},
+		{
+			name: "lenient metadata of known keys only",
+			env:  map[string]string{"METADATA_MODE": "lenient", "METADATA_KNOWN_KEYS_ONLY": "true"},
+		},
+		{
+			name: "histogram buckets that do not parse",
+			env:  map[string]string{"METRICS_BUCKETS_HTTP_REQUEST_DURATION_SECONDS": "0.1,0.05"},
+			want: []string{"METRICS_BUCKETS_HTTP_REQUEST_DURATION_SECONDS: 0.05 does not increase on 0.1"},
+		},
+		{
+			name: "histogram buckets configured",
+			env:  map[string]string{"METRICS_BUCKETS_REDIS_OPERATION_DURATION_SECONDS": "0.0001,0.0005,0.001"},
+		},
+		{
+			name: "no time to shut down",
+			env:  map[string]string{"SHUTDOWN_DEADLINE": "0"},
+			want: []string{"SHUTDOWN_DEADLINE must be positive"},
+		},
+		{
+			name: "topic partitions that are not positive",
+			env:  map[string]string{"KAFKA_TOPIC_PARTITIONS": "0"},
+			want: []string{"KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive"},
+		},
+		{
+			name: "topic spec that does not parse",
+			env:  map[string]string{"KAFKA_TOPIC_SPECS": "transactions.raw=12:x"},
+			want: []string{`KAFKA_TOPIC_SPECS: "transactions.raw=12:x" is not topic=partitions:replication:retention_ms`},
+		},
+		{
+			name: "topics provisioned strictly",
+			env:  map[string]string{"TOPIC_AUTOCREATE": "true", "TOPIC_STRICT": "true", "KAFKA_TOPIC_SPECS": "transactions.raw=1::2592000000"},
+		},
+		{
+			name: "every problem at once",
+			env: map[string]string{"JWT_SECRET": defaultJWTSecret, "KAFKA_BROKERS": ",", "RATE_LIMIT_PER_SECOND": "0",
+				"METRICS_ENABLED": "sometimes", "INGEST_MODE": "queue"},
+			want: []string{"JWT_SECRET must be set", "KAFKA_BROKERS lists no brokers", "RATE_LIMIT_PER_SECOND must be positive",
+				`METRICS_ENABLED: "sometimes" is not a boolean`, `INGEST_MODE must be direct or outbox, got "queue"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range validEnv {
+				t.Setenv(k, v)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			err := LoadConfig().Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT_MS", "5000")
+	t.Setenv("ROUTE_TIMEOUTS_MS", "")
+	defaults := LoadConfig()
+
+	tests := []struct {
+		route string
+		want  time.Duration
+	}{
+		{"/api/v1/transactions", 2 * time.Second},
+		{"/api/v1/transactions/batch", 10 * time.Second},
+		{"/api/v1/transactions/upload", time.Minute},
+		// Routes without their own deadline take the default one
+		{"/api/v1/transactions/schema", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := defaults.RouteTimeout(tt.route); got != tt.want {
+			t.Errorf("RouteTimeout(%s) = %s, want %s", tt.route, got, tt.want)
+		}
+	}
+	if got := defaults.MaxRouteTimeout(); got != time.Minute {
+		t.Errorf("MaxRouteTimeout() = %s, want the upload deadline", got)
+	}
+
+	// The default deadline counts when it is the longest
+	t.Setenv("REQUEST_TIMEOUT_MS", "90000")
+	t.Setenv("ROUTE_TIMEOUTS_MS", "/api/v1/transactions=500")
+	c := LoadConfig()
+	if got := c.RouteTimeout("/api/v1/transactions"); got != 500*time.Millisecond {
+		t.Errorf("RouteTimeout = %s, want the configured 500ms", got)
+	}
+	if got := c.MaxRouteTimeout(); got != 90*time.Second {
+		t.Errorf("MaxRouteTimeout() = %s, want the default deadline", got)
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	for k, v := range validEnv {
+		t.Setenv(k, v)
+	}
+	t.Setenv("JWT_PREVIOUS_SECRETS", "old:a-retired-secret-of-32-bytes!!!")
+	t.Setenv("OUTBOX_DATABASE_URL", "postgres://ingest:outbox-password@db:5432/outbox")
+
+	got := LoadConfig().String()
+	for _, secret := range []string{strongSecret, "a-retired-secret-of-32-bytes!!!", "outbox-password"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("String() = %s, leaks %q", got, secret)
+		}
+	}
+	if !strings.Contains(got, "kafka-1:9092,kafka-2:9092") || !strings.Contains(got, "old:[redacted]") {
+		t.Errorf("String() = %s, want the brokers and the previous key IDs", got)
+	}
+}
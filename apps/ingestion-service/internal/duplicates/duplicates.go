@@ -0,0 +1,136 @@
+// Package duplicates detects transactions whose content repeats one accepted
+// shortly before, whatever their idempotency keys: upstream systems that
+// generate a fresh key on every retry would otherwise get the same
+// transaction through twice.
+package duplicates
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/redis"
+)
+
+// Detection modes: off accepts duplicates unchecked, reject refuses them and
+// tag accepts them flagged for the processing service to score
+const (
+	ModeOff    = "off"
+	ModeReject = "reject"
+	ModeTag    = "tag"
+)
+
+// Metadata keys set on a transaction tagged as a suspected duplicate
+const (
+	MetadataSuspect     = "duplicate_suspect"
+	MetadataDuplicateOf = "duplicate_of"
+)
+
+// fieldValues maps each field that may be hashed to its value in a
+// transaction. Strings are trimmed and currencies upper-cased, so formatting
+// differences between retries do not hide a duplicate.
+var fieldValues = map[string]func(txn *models.Transaction) string{
+	"account_id": func(txn *models.Transaction) string { return strings.TrimSpace(txn.AccountID) },
+	"user_id":    func(txn *models.Transaction) string { return strings.TrimSpace(txn.UserID) },
+	"amount":     func(txn *models.Transaction) string { return strconv.FormatFloat(txn.Amount, 'f', -1, 64) },
+	"currency":   func(txn *models.Transaction) string { return strings.ToUpper(strings.TrimSpace(txn.Currency)) },
+	"type":       func(txn *models.Transaction) string { return strings.TrimSpace(txn.Type) },
+	"category":   func(txn *models.Transaction) string { return strings.TrimSpace(txn.Category) },
+	"merchant":   func(txn *models.Transaction) string { return strings.TrimSpace(txn.Merchant) },
+	"reference":  func(txn *models.Transaction) string { return strings.TrimSpace(txn.Reference) },
+	"tenant_id":  func(txn *models.Transaction) string { return txn.TenantID },
+}
+
+// DefaultFields are the fields hashed unless configured otherwise
+const DefaultFields = "account_id,amount,currency,type,merchant,reference"
+
+// ParseFields parses a comma-separated list of the fields to hash
+func ParseFields(list string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if fieldValues[field] == nil {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields listed")
+	}
+	return fields, nil
+}
+
+// Hash returns the content hash of txn over fields. Each value is prefixed
+// with its field name and length, so values cannot run into one another.
+func Hash(txn *models.Transaction, fields []string) string {
+	h := sha256.New()
+	for _, field := range fields {
+		value := fieldValues[field](txn)
+		fmt.Fprintf(h, "%s:%d:%s;", field, len(value), value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Detector remembers the content hash of each transaction for a window, in
+// Redis, and reports later transactions with the same hash
+type Detector struct {
+	client *redis.Client
+	mode   string
+	fields []string
+	window time.Duration
+}
+
+// NewDetector creates a detector in the given mode, hashing fields and
+// remembering each hash for window. A nil detector checks nothing.
+func NewDetector(client *redis.Client, mode string, fields []string, window time.Duration) *Detector {
+	if mode == ModeOff {
+		return nil
+	}
+	return &Detector{client: client, mode: mode, fields: fields, window: window}
+}
+
+// Mode returns the detection mode
+func (d *Detector) Mode() string {
+	if d == nil {
+		return ModeOff
+	}
+	return d.mode
+}
+
+// Check records the content of txn and returns the ID of the transaction it
+// duplicates, or "" when it is the first within the window
+func (d *Detector) Check(ctx context.Context, txn *models.Transaction) (string, error) {
+	if d == nil {
+		return "", nil
+	}
+	return d.client.ClaimContentHash(ctx, Hash(txn, d.fields), txn.ID, d.window)
+}
+
+// Forget drops the content of txn, recorded by Check, so that it is not
+// reported as a duplicate when retried after it could not be accepted
+func (d *Detector) Forget(ctx context.Context, txn *models.Transaction) error {
+	if d == nil {
+		return nil
+	}
+	return d.client.ReleaseContentHash(ctx, Hash(txn, d.fields), txn.ID)
+}
+
+// Tag flags txn as a suspected duplicate of the transaction firstID
+func Tag(txn *models.Transaction, firstID string) {
+	metadata := make(map[string]string, len(txn.Metadata)+2)
+	for k, v := range txn.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataSuspect] = "true"
+	metadata[MetadataDuplicateOf] = firstID
+	txn.Metadata = metadata
+}
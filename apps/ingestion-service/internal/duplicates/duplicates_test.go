@@ -0,0 +1,208 @@
+package duplicates
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/redis"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func testTransaction(id string) *models.Transaction {
+	return &models.Transaction{
+		ID:             id,
+		IdempotencyKey: "key-" + id,
+		AccountID:      "acct-1",
+		UserID:         "user-1",
+		Amount:         42.5,
+		Currency:       "USD",
+		Type:           "purchase",
+		Merchant:       "Corner Shop",
+		Reference:      "inv-1001",
+		Timestamp:      time.Now(),
+	}
+}
+
+func defaultFields(t *testing.T) []string {
+	t.Helper()
+	fields, err := ParseFields(DefaultFields)
+	if err != nil {
+		t.Fatalf("ParseFields: %v", err)
+	}
+	return fields
+}
+
+func TestHashIsStable(t *testing.T) {
+	fields := defaultFields(t)
+	first := testTransaction("txn-1")
+
+	// The hash is part of the Redis keys, so it must not change between
+	// releases: a change would let duplicates through during a deploy. It is
+	// the SHA-256 of
+	//
+	//	account_id:6:acct-1;amount:4:42.5;currency:3:USD;type:8:purchase;merchant:11:Corner Shop;reference:8:inv-1001;
+	const want = "0235c55676b093063612474a22152dff44cd10c3692e6e9bcc7e1dbf274365ed"
+	if got := Hash(first, fields); got != want {
+		t.Errorf("Hash = %s, want %s", got, want)
+	}
+
+	// A retry under a fresh idempotency key, at another time, from another
+	// user and formatted differently hashes the same
+	retry := testTransaction("txn-2")
+	retry.Timestamp = first.Timestamp.Add(time.Minute)
+	retry.UserID = "user-2"
+	retry.Currency = " usd"
+	retry.Merchant = "Corner Shop "
+	retry.Amount = 42.50
+	if Hash(retry, fields) != Hash(first, fields) {
+		t.Error("retry hashes differently")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.Transaction)
+	}{
+		{"account", func(txn *models.Transaction) { txn.AccountID = "acct-2" }},
+		{"amount", func(txn *models.Transaction) { txn.Amount = 42.51 }},
+		{"currency", func(txn *models.Transaction) { txn.Currency = "EUR" }},
+		{"type", func(txn *models.Transaction) { txn.Type = "refund" }},
+		{"merchant", func(txn *models.Transaction) { txn.Merchant = "Corner Store" }},
+		{"reference", func(txn *models.Transaction) { txn.Reference = "inv-1002" }},
+		// Values cannot run into one another
+		{"shifted values", func(txn *models.Transaction) { txn.Merchant, txn.Reference = "Corner Shopinv", "-1001" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := testTransaction("txn-3")
+			tt.modify(other)
+			if Hash(other, fields) == Hash(first, fields) {
+				t.Errorf("different %s hashes the same", tt.name)
+			}
+		})
+	}
+
+	// Only the configured fields count
+	narrow := []string{"account_id", "amount"}
+	other := testTransaction("txn-4")
+	other.Merchant = "Elsewhere"
+	if Hash(other, narrow) != Hash(first, narrow) {
+		t.Error("field left out of the hash changed it")
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		list string
+		want string
+		err  string
+	}{
+		{DefaultFields, "[account_id amount currency type merchant reference]", ""},
+		{" Account_ID, amount ,,user_id ", "[account_id amount user_id]", ""},
+		{"account_id,iban", "", `unknown field "iban"`},
+		{" , ", "", "no fields listed"},
+	}
+	for _, tt := range tests {
+		fields, err := ParseFields(tt.list)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseFields(%q) = %v, want %q", tt.list, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(fields) != tt.want {
+			t.Errorf("ParseFields(%q) = %v, %v, want %s", tt.list, fields, err, tt.want)
+		}
+	}
+}
+
+// newDetector returns a detector in mode on a Redis stand-in, with a
+// 5-minute window
+func newDetector(t *testing.T, mode string) (*Detector, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient(redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		redis.BreakerConfig{Threshold: 1, Cooldown: time.Minute, OpTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewDetector(client, mode, defaultFields(t), 5*time.Minute), mr
+}
+
+func TestDetectorReportsTheFirstTransaction(t *testing.T) {
+	ctx := context.Background()
+	d, mr := newDetector(t, ModeTag)
+
+	if first, err := d.Check(ctx, testTransaction("txn-1")); err != nil || first != "" {
+		t.Fatalf("Check of the first = %q, %v, want none", first, err)
+	}
+	for _, id := range []string{"txn-2", "txn-3"} {
+		if first, err := d.Check(ctx, testTransaction(id)); err != nil || first != "txn-1" {
+			t.Errorf("Check of %s = %q, %v, want txn-1", id, first, err)
+		}
+	}
+
+	// Once the window has passed the content may be accepted again
+	mr.FastForward(5*time.Minute + time.Second)
+	if first, err := d.Check(ctx, testTransaction("txn-4")); err != nil || first != "" {
+		t.Errorf("Check after the window = %q, %v, want none", first, err)
+	}
+}
+
+func TestDetectorForgetsOnlyItsOwnClaim(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newDetector(t, ModeReject)
+	if _, err := d.Check(ctx, testTransaction("txn-1")); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	// A duplicate that could not be accepted leaves the first claim
+	if err := d.Forget(ctx, testTransaction("txn-2")); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if first, _ := d.Check(ctx, testTransaction("txn-3")); first != "txn-1" {
+		t.Errorf("Check after forgetting another = %q, want txn-1", first)
+	}
+
+	// The first, when it could not be accepted, may be retried
+	if err := d.Forget(ctx, testTransaction("txn-1")); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if first, _ := d.Check(ctx, testTransaction("txn-1")); first != "" {
+		t.Errorf("Check of the retry = %q, want none", first)
+	}
+}
+
+func TestDetectorOff(t *testing.T) {
+	d := NewDetector(nil, ModeOff, defaultFields(t), time.Minute)
+	if d != nil || d.Mode() != ModeOff {
+		t.Fatalf("NewDetector(off) = %+v in mode %s, want nil", d, d.Mode())
+	}
+	for range 2 {
+		if first, err := d.Check(context.Background(), testTransaction("txn-1")); first != "" || err != nil {
+			t.Errorf("Check = %q, %v, want nothing checked", first, err)
+		}
+	}
+	if err := d.Forget(context.Background(), testTransaction("txn-1")); err != nil {
+		t.Errorf("Forget = %v", err)
+	}
+}
+
+func TestTagCopiesTheMetadata(t *testing.T) {
+	txn := testTransaction("txn-2")
+	original := map[string]string{"channel": "web"}
+	txn.Metadata = original
+
+	Tag(txn, "txn-1")
+	if txn.Metadata[MetadataSuspect] != "true" || txn.Metadata[MetadataDuplicateOf] != "txn-1" || txn.Metadata["channel"] != "web" {
+		t.Errorf("metadata %v, want tagged as a duplicate of txn-1", txn.Metadata)
+	}
+	if len(original) != 1 {
+		t.Errorf("request metadata changed to %v", original)
+	}
+}
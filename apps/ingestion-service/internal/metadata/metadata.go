@@ -0,0 +1,230 @@
+// Package metadata bounds the free-form metadata of transactions: how many
+// keys it holds, how long they and their values are and how large it is
+// serialized, and, optionally, which keys it may hold. The values of the
+// keys known to the pipeline must be well formed. In strict mode metadata
+// breaking a limit is refused; in lenient mode it is truncated to fit and
+// flagged instead.
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+	_ "time/tzdata" // time zones are checked in images without a zoneinfo database
+	"unicode/utf8"
+
+	"ingestion-service/internal/duplicates"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// Modes: strict refuses metadata breaking a limit, lenient truncates it
+const (
+	ModeStrict  = "strict"
+	ModeLenient = "lenient"
+)
+
+// Kinds of violation
+const (
+	ViolationKey      = "key"       // a key unknown, reserved or too long
+	ViolationValue    = "value"     // a value too long or malformed
+	ViolationTooLarge = "too_large" // too many keys or too many bytes
+)
+
+// reserved are the keys only the ingestion service sets
+var reserved = map[string]bool{
+	shared.MetadataTruncated:       true,
+	duplicates.MetadataSuspect:     true,
+	duplicates.MetadataDuplicateOf: true,
+}
+
+var (
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	channelPattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+	mccPattern     = regexp.MustCompile(`^[0-9]{4}$`)
+)
+
+// formats checks the values of the known keys; device_info is free-form
+var formats = map[string]func(value string) error{
+	shared.MetadataCountry: func(value string) error {
+		if !countryPattern.MatchString(value) {
+			return fmt.Errorf("%q is not an ISO 3166-1 alpha-2 country code", value)
+		}
+		return nil
+	},
+	shared.MetadataIPAddress: func(value string) error {
+		if _, err := netip.ParseAddr(value); err != nil {
+			return fmt.Errorf("%q is not an IP address", value)
+		}
+		return nil
+	},
+	shared.MetadataChannel: func(value string) error {
+		if !channelPattern.MatchString(value) {
+			return fmt.Errorf("%q is not lowercase letters, digits, hyphens and underscores", value)
+		}
+		return nil
+	},
+	shared.MetadataMCC: func(value string) error {
+		if !mccPattern.MatchString(value) {
+			return fmt.Errorf("%q is not a four-digit merchant category code", value)
+		}
+		return nil
+	},
+	shared.MetadataTimezone: validTimezone,
+}
+
+// timezones caches the time zone names checked so far
+var timezones sync.Map
+
+func validTimezone(value string) error {
+	if known, ok := timezones.Load(value); ok {
+		if !known.(bool) {
+			return fmt.Errorf("%q is not an IANA time zone", value)
+		}
+		return nil
+	}
+	// Local is the zone of the server, not a name a client can mean
+	_, err := time.LoadLocation(value)
+	known := err == nil && value != "" && value != "Local"
+	timezones.Store(value, known)
+	if !known {
+		return fmt.Errorf("%q is not an IANA time zone", value)
+	}
+	return nil
+}
+
+// Violation is metadata breaking a limit, at Key, or at no key when the
+// metadata as a whole is too large
+type Violation struct {
+	Key     string
+	Kind    string
+	Message string
+}
+
+// Limits bounds metadata
+type Limits struct {
+	MaxKeys        int
+	MaxKeyLength   int // in bytes
+	MaxValueLength int // in bytes
+	// MaxSize bounds the metadata serialized as JSON, in bytes
+	MaxSize int
+	// KnownOnly refuses the keys not in shared.KnownMetadataKeys
+	KnownOnly bool
+	Mode      string
+}
+
+// Lenient reports whether metadata breaking a limit is truncated rather
+// than refused
+func (l Limits) Lenient() bool {
+	return l.Mode == ModeLenient
+}
+
+// Validate returns how metadata breaks the limits, keys in order
+func (l Limits) Validate(metadata map[string]string) []Violation {
+	var violations []Violation
+	for _, key := range sortedKeys(metadata) {
+		if v, ok := l.checkEntry(key, metadata[key]); !ok {
+			violations = append(violations, v)
+		}
+	}
+	if len(metadata) > l.MaxKeys {
+		violations = append(violations, Violation{Kind: ViolationTooLarge,
+			Message: fmt.Sprintf("has %d keys, more than %d", len(metadata), l.MaxKeys)})
+	}
+	if size := serializedSize(metadata); size > l.MaxSize {
+		violations = append(violations, Violation{Kind: ViolationTooLarge,
+			Message: fmt.Sprintf("is %d bytes serialized, more than %d", size, l.MaxSize)})
+	}
+	return violations
+}
+
+// Truncate returns metadata cut down to the limits, and whether anything
+// was cut: entries with a bad key or malformed value are dropped, long
+// values shortened, and then entries dropped in reverse key order until
+// the count and size fit. Truncated metadata is flagged with
+// shared.MetadataTruncated, which is not counted against the limits.
+func (l Limits) Truncate(metadata map[string]string) (map[string]string, bool) {
+	if len(metadata) == 0 {
+		return metadata, false
+	}
+
+	truncated := false
+	kept := make(map[string]string, len(metadata))
+	var keys []string
+	for _, key := range sortedKeys(metadata) {
+		value := metadata[key]
+		if len(value) > l.MaxValueLength {
+			value = cut(value, l.MaxValueLength)
+			truncated = true
+		}
+		if _, ok := l.checkEntry(key, value); !ok {
+			truncated = true
+			continue
+		}
+		kept[key] = value
+		keys = append(keys, key)
+	}
+	for len(keys) > 0 && (len(keys) > l.MaxKeys || serializedSize(kept) > l.MaxSize) {
+		delete(kept, keys[len(keys)-1])
+		keys = keys[:len(keys)-1]
+		truncated = true
+	}
+
+	if !truncated {
+		return metadata, false
+	}
+	kept[shared.MetadataTruncated] = "true"
+	return kept, true
+}
+
+// checkEntry checks one entry of the metadata
+func (l Limits) checkEntry(key, value string) (Violation, bool) {
+	switch {
+	case reserved[key]:
+		return Violation{Key: key, Kind: ViolationKey, Message: "is reserved"}, false
+	case len(key) == 0 || len(key) > l.MaxKeyLength:
+		return Violation{Key: key, Kind: ViolationKey,
+			Message: fmt.Sprintf("key must be 1 to %d bytes", l.MaxKeyLength)}, false
+	case l.KnownOnly && !slices.Contains(shared.KnownMetadataKeys, key):
+		return Violation{Key: key, Kind: ViolationKey, Message: "is not a known metadata key"}, false
+	case len(value) > l.MaxValueLength:
+		return Violation{Key: key, Kind: ViolationValue,
+			Message: fmt.Sprintf("value is %d bytes, more than %d", len(value), l.MaxValueLength)}, false
+	}
+	if format, ok := formats[key]; ok {
+		if err := format(value); err != nil {
+			return Violation{Key: key, Kind: ViolationValue, Message: err.Error()}, false
+		}
+	}
+	return Violation{}, true
+}
+
+// cut shortens s to at most n bytes without splitting a UTF-8 sequence
+func cut(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// serializedSize returns the size of metadata serialized as JSON
+func serializedSize(metadata map[string]string) int {
+	if len(metadata) == 0 {
+		return 0
+	}
+	data, _ := json.Marshal(metadata)
+	return len(data)
+}
+
+func sortedKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
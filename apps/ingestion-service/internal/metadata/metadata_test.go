@@ -0,0 +1,180 @@
+package metadata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// testLimits are small limits, in mode
+func testLimits(mode string) Limits {
+	return Limits{MaxKeys: 4, MaxKeyLength: 16, MaxValueLength: 32, MaxSize: 150, Mode: mode}
+}
+
+func TestValidate(t *testing.T) {
+	known := testLimits(ModeStrict)
+	known.KnownOnly = true
+
+	tests := []struct {
+		name     string
+		limits   Limits
+		metadata map[string]string
+		want     []Violation
+	}{
+		{"none", testLimits(ModeStrict), nil, nil},
+		{"within the limits", testLimits(ModeStrict), map[string]string{"channel": "web", "order_ref": "A-1042"}, nil},
+		{
+			"key too long", testLimits(ModeStrict), map[string]string{"a-key-far-too-long": "x"},
+			[]Violation{{Key: "a-key-far-too-long", Kind: ViolationKey, Message: "key must be 1 to 16 bytes"}},
+		},
+		{
+			"empty key", testLimits(ModeStrict), map[string]string{"": "x"},
+			[]Violation{{Key: "", Kind: ViolationKey, Message: "key must be 1 to 16 bytes"}},
+		},
+		{
+			"reserved key", testLimits(ModeStrict), map[string]string{shared.MetadataTruncated: "false"},
+			[]Violation{{Key: shared.MetadataTruncated, Kind: ViolationKey, Message: "is reserved"}},
+		},
+		{
+			"value too long", testLimits(ModeStrict), map[string]string{"note": strings.Repeat("x", 33)},
+			[]Violation{{Key: "note", Kind: ViolationValue, Message: "value is 33 bytes, more than 32"}},
+		},
+		{
+			"too many keys", testLimits(ModeStrict), map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"},
+			[]Violation{{Kind: ViolationTooLarge, Message: "has 5 keys, more than 4"}},
+		},
+		{
+			"too many bytes", testLimits(ModeStrict),
+			map[string]string{"a": strings.Repeat("x", 32), "b": strings.Repeat("x", 32), "c": strings.Repeat("x", 32), "d": strings.Repeat("x", 32)},
+			[]Violation{{Kind: ViolationTooLarge, Message: "is 157 bytes serialized, more than 150"}},
+		},
+		{"known keys only, all known", known, map[string]string{"country": "GB", "mcc": "5411"}, nil},
+		{
+			"known keys only, one unknown", known, map[string]string{"country": "GB", "order_ref": "A-1042"},
+			[]Violation{{Key: "order_ref", Kind: ViolationKey, Message: "is not a known metadata key"}},
+		},
+		{
+			"every problem, keys in order", testLimits(ModeStrict),
+			map[string]string{"mcc": "54", "a-key-far-too-long": "x", "country": "gb", "d": "4", "e": "5"},
+			[]Violation{
+				{Key: "a-key-far-too-long", Kind: ViolationKey, Message: "key must be 1 to 16 bytes"},
+				{Key: "country", Kind: ViolationValue, Message: `"gb" is not an ISO 3166-1 alpha-2 country code`},
+				{Key: "mcc", Kind: ViolationValue, Message: `"54" is not a four-digit merchant category code`},
+				{Kind: ViolationTooLarge, Message: "has 5 keys, more than 4"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.Validate(tt.metadata); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownKeyFormats(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{shared.MetadataCountry, "GB", true},
+		{shared.MetadataCountry, "gb", false},
+		{shared.MetadataCountry, "GBR", false},
+		{shared.MetadataIPAddress, "203.0.113.7", true},
+		{shared.MetadataIPAddress, "2001:db8::1", true},
+		{shared.MetadataIPAddress, "203.0.113.300", false},
+		{shared.MetadataIPAddress, "localhost", false},
+		{shared.MetadataChannel, "mobile_app", true},
+		{shared.MetadataChannel, "Mobile App", false},
+		{shared.MetadataMCC, "5411", true},
+		{shared.MetadataMCC, "541", false},
+		{shared.MetadataMCC, "54a1", false},
+		{shared.MetadataTimezone, "Europe/London", true},
+		{shared.MetadataTimezone, "UTC", true},
+		{shared.MetadataTimezone, "Mars/Olympus", false},
+		{shared.MetadataTimezone, "Local", false},
+		{shared.MetadataDeviceInfo, "iPhone 15; iOS 18.1", true},
+	}
+	limits := testLimits(ModeStrict)
+	for _, tt := range tests {
+		// Twice, the second time zone check answered from the cache
+		for range 2 {
+			violations := limits.Validate(map[string]string{tt.key: tt.value})
+			if valid := len(violations) == 0; valid != tt.valid {
+				t.Errorf("%s %q: violations %+v, want valid %v", tt.key, tt.value, violations, tt.valid)
+				break
+			}
+			if !tt.valid && (violations[0].Key != tt.key || violations[0].Kind != ViolationValue) {
+				t.Errorf("%s %q: violation %+v, want a value violation at the key", tt.key, tt.value, violations[0])
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     map[string]string
+	}{
+		{"within the limits is left alone", map[string]string{"channel": "web"}, map[string]string{"channel": "web"}},
+		{
+			"long value shortened",
+			map[string]string{"note": strings.Repeat("x", 40)},
+			map[string]string{"note": strings.Repeat("x", 32), shared.MetadataTruncated: "true"},
+		},
+		{
+			"bad keys and malformed values dropped",
+			map[string]string{"a-key-far-too-long": "x", "country": "gb", "channel": "web", shared.MetadataTruncated: "false"},
+			map[string]string{"channel": "web", shared.MetadataTruncated: "true"},
+		},
+		{
+			"last keys dropped to fit the count",
+			map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6"},
+			map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", shared.MetadataTruncated: "true"},
+		},
+		{
+			"last keys dropped to fit the size",
+			map[string]string{"a": strings.Repeat("x", 32), "b": strings.Repeat("x", 32), "c": strings.Repeat("x", 32), "d": strings.Repeat("x", 32)},
+			map[string]string{"a": strings.Repeat("x", 32), "b": strings.Repeat("x", 32), "c": strings.Repeat("x", 32), shared.MetadataTruncated: "true"},
+		},
+	}
+	limits := testLimits(ModeLenient)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := limits.Truncate(tt.metadata)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Truncate = %v, want %v", got, tt.want)
+			}
+			if truncated != (got[shared.MetadataTruncated] == "true") {
+				t.Errorf("truncated = %v for %v", truncated, got)
+			}
+			// Truncated metadata passes, the flag aside
+			delete(got, shared.MetadataTruncated)
+			if violations := limits.Validate(got); len(violations) > 0 {
+				t.Errorf("truncated metadata breaks the limits: %+v", violations)
+			}
+		})
+	}
+}
+
+func TestTruncateKeepsUTF8Whole(t *testing.T) {
+	limits := testLimits(ModeLenient)
+	// 31 bytes, then a three-byte rune straddling the limit
+	value := strings.Repeat("x", 31) + "€€"
+	got, truncated := limits.Truncate(map[string]string{"note": value})
+	if !truncated || got["note"] != strings.Repeat("x", 31) || !utf8.ValidString(got["note"]) {
+		t.Errorf("Truncate = %q, want the rune straddling the limit dropped whole", got["note"])
+	}
+}
+
+func TestLenient(t *testing.T) {
+	if testLimits(ModeStrict).Lenient() || !testLimits(ModeLenient).Lenient() {
+		t.Error("Lenient does not follow the mode")
+	}
+}
@@ -4,18 +4,22 @@ import (
 	"net/http"
 	"strings"
 
+	"ingestion-service/internal/apierror"
 	"ingestion-service/internal/auth"
 )
 
 // AuthMiddleware handles JWT authentication
 type AuthMiddleware struct {
 	jwtManager *auth.JWTManager
+	lockout    *AuthLockout
 }
 
-// NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(jwtManager *auth.JWTManager) *AuthMiddleware {
+// NewAuthMiddleware creates a new authentication middleware. Invalid tokens
+// are throttled by lockout, which may be nil.
+func NewAuthMiddleware(jwtManager *auth.JWTManager, lockout *AuthLockout) *AuthMiddleware {
 	return &AuthMiddleware{
 		jwtManager: jwtManager,
+		lockout:    lockout,
 	}
 }
 
@@ -25,14 +29,17 @@ func (a *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		// Extract token from header
 		token, err := auth.ExtractTokenFromHeader(r)
 		if err != nil {
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 			return
 		}
 
-		// Validate token
+		// Validate token. The lockout applies to invalid tokens only, so a
+		// valid one is never throttled.
 		claims, err := a.jwtManager.ValidateToken(token)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			if !a.lockout.Refuse(w, r, token) {
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid token")
+			}
 			return
 		}
 
@@ -48,12 +55,12 @@ func (a *AuthMiddleware) RequireRole(role string) func(http.HandlerFunc) http.Ha
 		return func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := auth.ClaimsFromContext(r.Context())
 			if !ok {
-				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 				return
 			}
 
 			if !claims.HasRole(role) {
-				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Insufficient permissions")
 				return
 			}
 
@@ -68,12 +75,12 @@ func (a *AuthMiddleware) RequireAnyRole(roles ...string) func(http.HandlerFunc)
 		return func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := auth.ClaimsFromContext(r.Context())
 			if !ok {
-				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 				return
 			}
 
 			if !claims.HasAnyRole(roles...) {
-				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Insufficient permissions")
 				return
 			}
 
@@ -87,7 +94,7 @@ func (a *AuthMiddleware) RequireAccountAccess(next http.HandlerFunc) http.Handle
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := auth.ClaimsFromContext(r.Context())
 		if !ok {
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 			return
 		}
 
@@ -108,7 +115,7 @@ func (a *AuthMiddleware) RequireAccountAccess(next http.HandlerFunc) http.Handle
 
 		// Check if user has access to this account
 		if claims.AccountID != accountID && !claims.HasRole("admin") {
-			http.Error(w, "Access denied to account", http.StatusForbidden)
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Access denied to account")
 			return
 		}
 
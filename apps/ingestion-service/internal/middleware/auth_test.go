@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+)
+
+// errorCode decodes the code of an error response
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var envelope apierror.Envelope
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	return envelope.Error.Code
+}
+
+func TestAuthFailuresCarryTheirCode(t *testing.T) {
+	jwtManager := auth.NewJWTManager("test", testSecret, nil, 1)
+	am := NewAuthMiddleware(jwtManager, nil)
+	userToken, err := jwtManager.GenerateToken("user-1", "acct-1", []string{"user"}, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	admin := &auth.Claims{UserID: "admin-1", AccountID: "acct-9", Roles: []string{"admin"}}
+	user := &auth.Claims{UserID: "user-1", AccountID: "acct-1", Roles: []string{"user"}}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		bearer  string
+		claims  *auth.Claims
+		path    string
+		status  int
+		code    string
+	}{
+		{"no token", am.RequireAuth(ok), "", nil, "/api/v1/transactions", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"invalid token", am.RequireAuth(ok), "not-a-token", nil, "/api/v1/transactions", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"valid token", am.RequireAuth(ok), userToken, nil, "/api/v1/transactions", http.StatusOK, ""},
+		{"role without claims", am.RequireRole("admin")(ok), "", nil, "/admin", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"missing role", am.RequireRole("admin")(ok), "", user, "/admin", http.StatusForbidden, apierror.CodeForbidden},
+		{"role held", am.RequireRole("admin")(ok), "", admin, "/admin", http.StatusOK, ""},
+		{"none of the roles", am.RequireAnyRole("admin", "auditor")(ok), "", user, "/admin", http.StatusForbidden, apierror.CodeForbidden},
+		{"any role without claims", am.RequireAnyRole("admin")(ok), "", nil, "/admin", http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"another account", am.RequireAccountAccess(ok), "", user, "/accounts/acct-2?account_id=acct-2", http.StatusForbidden, apierror.CodeForbidden},
+		{"own account", am.RequireAccountAccess(ok), "", user, "/accounts/acct-1?account_id=acct-1", http.StatusOK, ""},
+		{"any account as admin", am.RequireAccountAccess(ok), "", admin, "/accounts/acct-2?account_id=acct-2", http.StatusOK, ""},
+		{"account without claims", am.RequireAccountAccess(ok), "", nil, "/accounts/acct-1", http.StatusUnauthorized, apierror.CodeUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.claims != nil {
+				r = r.WithContext(auth.WithClaims(r.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.code != "" {
+				if code := errorCode(t, w); code != tt.code {
+					t.Errorf("code %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyRequired(t *testing.T) {
+	// The key is checked before the cache is touched
+	handler := NewIdempotencyMiddleware(nil, 0).Wrap(ok)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/v1/transactions", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	if code := errorCode(t, w); code != apierror.CodeIdempotencyKeyRequired {
+		t.Errorf("code %q, want %q", code, apierror.CodeIdempotencyKeyRequired)
+	}
+}
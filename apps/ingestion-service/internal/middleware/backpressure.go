@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+)
+
+// latencySamples is how many recent publish latencies the p95 is taken over
+const latencySamples = 1024
+
+// LoadShedderConfig sets when the pipeline counts as saturated and how much
+// traffic is refused while it is
+type LoadShedderConfig struct {
+	// LatencyThreshold is the p95 publish latency that saturates
+	LatencyThreshold time.Duration
+	// QueueThreshold is the number of queued messages that saturates
+	QueueThreshold int64
+	// ShedPercent is the percentage of non-admin requests refused while
+	// saturated
+	ShedPercent int
+	// RecoveryRatio is the fraction of both thresholds the signals must fall
+	// below before saturation ends, so the state does not flap
+	RecoveryRatio float64
+	// Window is how far back publish latencies count towards the p95
+	Window time.Duration
+	// RetryAfter is sent to refused clients
+	RetryAfter time.Duration
+	// Interval is how often the signals are evaluated
+	Interval time.Duration
+}
+
+// latencySample is a publish latency and when it was observed
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// LoadShedder refuses part of the ingestion traffic with 503 while Kafka
+// publishing is saturated, judged by the p95 publish latency and the number
+// of messages queued in the writer. Admin requests are never refused. A nil
+// LoadShedder sheds nothing.
+type LoadShedder struct {
+	cfg      LoadShedderConfig
+	shedding atomic.Bool
+
+	mu      sync.Mutex
+	samples []latencySample // ring of the last latencySamples latencies
+	next    int
+}
+
+// NewLoadShedder creates a load shedder, or returns nil when disabled
+func NewLoadShedder(enabled bool, cfg LoadShedderConfig) *LoadShedder {
+	if !enabled {
+		return nil
+	}
+	return &LoadShedder{
+		cfg:     cfg,
+		samples: make([]latencySample, 0, latencySamples),
+	}
+}
+
+// ObservePublish records the latency of a delivered Kafka publish
+func (l *LoadShedder) ObservePublish(latency time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sample := latencySample{at: time.Now(), latency: latency}
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, sample)
+		return
+	}
+	l.samples[l.next] = sample
+	l.next = (l.next + 1) % latencySamples
+}
+
+// Shedding reports whether the pipeline is saturated
+func (l *LoadShedder) Shedding() bool {
+	return l != nil && l.shedding.Load()
+}
+
+// Run evaluates the publish latency and queue length from queued every
+// interval until ctx is done
+func (l *LoadShedder) Run(ctx context.Context, queued func() int64) {
+	if l == nil {
+		return
+	}
+
+	ticker := time.NewTicker(l.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.evaluate(l.p95(time.Now()), queued())
+		}
+	}
+}
+
+// evaluate updates the shedding state from the current signals. Saturation
+// starts when either signal exceeds its threshold and ends once both are
+// below RecoveryRatio of it.
+func (l *LoadShedder) evaluate(p95 time.Duration, queued int64) {
+	saturated := p95 > l.cfg.LatencyThreshold || queued > l.cfg.QueueThreshold
+	recovered := float64(p95) < float64(l.cfg.LatencyThreshold)*l.cfg.RecoveryRatio &&
+		float64(queued) < float64(l.cfg.QueueThreshold)*l.cfg.RecoveryRatio
+
+	switch shedding := l.shedding.Load(); {
+	case !shedding && saturated:
+		l.shedding.Store(true)
+		SetBackpressureShedding(true)
+		log.Printf("Pipeline saturated (p95 publish latency %s, %d messages queued), shedding %d%% of requests",
+			p95, queued, l.cfg.ShedPercent)
+	case shedding && recovered:
+		l.shedding.Store(false)
+		SetBackpressureShedding(false)
+		log.Printf("Pipeline recovered (p95 publish latency %s, %d messages queued), accepting all requests",
+			p95, queued)
+	}
+}
+
+// p95 returns the 95th percentile of the latencies observed within the
+// window before now, or zero when there are none
+func (l *LoadShedder) p95(now time.Time) time.Duration {
+	l.mu.Lock()
+	latencies := make([]time.Duration, 0, len(l.samples))
+	for _, s := range l.samples {
+		if now.Sub(s.at) <= l.cfg.Window {
+			latencies = append(latencies, s.latency)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(latencies) == 0 {
+		return 0
+	}
+	slices.Sort(latencies)
+	return latencies[(len(latencies)*95+99)/100-1]
+}
+
+// Wrap refuses ShedPercent of non-admin requests with 503 and Retry-After
+// while the pipeline is saturated. It must run after authentication.
+func (l *LoadShedder) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l.Shedding() && !isAdmin(r) && rand.IntN(100) < l.cfg.ShedPercent {
+			RecordRequestShed()
+			w.Header().Set("Retry-After", strconv.Itoa(int(l.cfg.RetryAfter.Seconds())))
+			apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CodeRateLimited, "service overloaded, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// isAdmin reports whether the request was made with an admin token
+func isAdmin(r *http.Request) bool {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	return ok && claims.HasRole("admin")
+}
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testShedderConfig saturates at a 100ms p95 or 1000 queued messages and
+// recovers below half of both
+func testShedderConfig(shedPercent int) LoadShedderConfig {
+	return LoadShedderConfig{
+		LatencyThreshold: 100 * time.Millisecond,
+		QueueThreshold:   1000,
+		ShedPercent:      shedPercent,
+		RecoveryRatio:    0.5,
+		Window:           time.Minute,
+		RetryAfter:       5 * time.Second,
+		Interval:         time.Millisecond,
+	}
+}
+
+// observe records each latency as a delivered publish
+func observe(l *LoadShedder, latencies ...time.Duration) {
+	for _, latency := range latencies {
+		l.ObservePublish(latency)
+	}
+}
+
+func TestP95OfPublishLatencies(t *testing.T) {
+	l := NewLoadShedder(true, testShedderConfig(50))
+	if p95 := l.p95(time.Now()); p95 != 0 {
+		t.Errorf("p95 of no publishes = %s, want 0", p95)
+	}
+
+	// 95 fast publishes and 5 slow ones
+	for i := 0; i < 95; i++ {
+		observe(l, 10*time.Millisecond)
+	}
+	observe(l, time.Second, time.Second, time.Second, time.Second, time.Second)
+	if p95 := l.p95(time.Now()); p95 != 10*time.Millisecond {
+		t.Errorf("p95 = %s, want 10ms", p95)
+	}
+	observe(l, time.Second)
+	if p95 := l.p95(time.Now()); p95 != time.Second {
+		t.Errorf("p95 with 6 slow publishes in 101 = %s, want 1s", p95)
+	}
+
+	// Publishes older than the window no longer count
+	if p95 := l.p95(time.Now().Add(2 * time.Minute)); p95 != 0 {
+		t.Errorf("p95 past the window = %s, want 0", p95)
+	}
+}
+
+func TestP95KeepsTheLatestSamples(t *testing.T) {
+	l := NewLoadShedder(true, testShedderConfig(50))
+	for i := 0; i < latencySamples; i++ {
+		observe(l, time.Second)
+	}
+	// The ring overwrites the oldest samples
+	for i := 0; i < latencySamples; i++ {
+		observe(l, time.Millisecond)
+	}
+	if p95 := l.p95(time.Now()); p95 != time.Millisecond {
+		t.Errorf("p95 = %s, want only the latest samples counted", p95)
+	}
+}
+
+func TestSheddingHysteresis(t *testing.T) {
+	// The gauge is shared with the shedders of the other tests
+	SetBackpressureShedding(false)
+	l := NewLoadShedder(true, testShedderConfig(50))
+
+	steps := []struct {
+		name     string
+		p95      time.Duration
+		queued   int64
+		shedding bool
+	}{
+		{"healthy", 20 * time.Millisecond, 10, false},
+		{"at the thresholds", 100 * time.Millisecond, 1000, false},
+		{"slow publishes", 150 * time.Millisecond, 10, true},
+		{"below the threshold, above recovery", 80 * time.Millisecond, 10, true},
+		{"latency recovered, queue above recovery", 20 * time.Millisecond, 600, true},
+		{"both recovered", 40 * time.Millisecond, 400, false},
+		{"below the thresholds again", 90 * time.Millisecond, 900, false},
+		{"deep queue", 20 * time.Millisecond, 1500, true},
+		{"drained", 20 * time.Millisecond, 0, false},
+	}
+
+	for _, step := range steps {
+		l.evaluate(step.p95, step.queued)
+		if got := l.Shedding(); got != step.shedding {
+			t.Fatalf("%s: shedding = %v, want %v", step.name, got, step.shedding)
+		}
+		want := 0.0
+		if step.shedding {
+			want = 1
+		}
+		if got := testutil.ToFloat64(backpressureShedding); got != want {
+			t.Errorf("%s: shedding gauge = %v, want %v", step.name, got, want)
+		}
+	}
+}
+
+// shed sends n requests through l, as an admin when admin is set, returning
+// how many were refused
+func shed(t *testing.T, l *LoadShedder, n int, admin bool) int {
+	t.Helper()
+	handler := l.Wrap(ok)
+	refused := 0
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", nil)
+		roles := []string{"user"}
+		if admin {
+			roles = []string{"admin"}
+		}
+		r = r.WithContext(auth.WithClaims(r.Context(), &auth.Claims{UserID: "user-1", Roles: roles}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		switch w.Code {
+		case http.StatusOK:
+		case http.StatusServiceUnavailable:
+			refused++
+			if got := w.Header().Get("Retry-After"); got != "5" {
+				t.Fatalf("Retry-After = %q, want 5", got)
+			}
+			if code := errorCode(t, w); code != apierror.CodeRateLimited {
+				t.Fatalf("code %q, want %q", code, apierror.CodeRateLimited)
+			}
+		default:
+			t.Fatalf("status %d, want 200 or 503", w.Code)
+		}
+	}
+	return refused
+}
+
+func TestShedPercentage(t *testing.T) {
+	l := NewLoadShedder(true, testShedderConfig(30))
+	if refused := shed(t, l, 100, false); refused != 0 {
+		t.Fatalf("%d requests refused before saturation", refused)
+	}
+
+	l.evaluate(time.Second, 0)
+	before := testutil.ToFloat64(requestsShed)
+	const requests = 5000
+	refused := shed(t, l, requests, false)
+	if rate := float64(refused) / requests; rate < 0.27 || rate > 0.33 {
+		t.Errorf("%.3f of requests refused, want about 0.3", rate)
+	}
+	if got := testutil.ToFloat64(requestsShed) - before; got != float64(refused) {
+		t.Errorf("%v requests counted as shed, want %d", got, refused)
+	}
+
+	// Admins are never refused
+	if refused := shed(t, l, 200, true); refused != 0 {
+		t.Errorf("%d admin requests refused", refused)
+	}
+
+	l.evaluate(0, 0)
+	if refused := shed(t, l, 100, false); refused != 0 {
+		t.Errorf("%d requests refused after recovery", refused)
+	}
+}
+
+func TestRunEvaluatesTheSignals(t *testing.T) {
+	l := NewLoadShedder(true, testShedderConfig(100))
+	var queued atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Run(ctx, queued.Load)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitUntil := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	queued.Store(2000)
+	waitUntil("shedding on a deep queue", l.Shedding)
+	queued.Store(0)
+	waitUntil("recovery once drained", func() bool { return !l.Shedding() })
+
+	observe(l, time.Second)
+	waitUntil("shedding on slow publishes", l.Shedding)
+}
+
+func TestDisabledShedderShedsNothing(t *testing.T) {
+	l := NewLoadShedder(false, testShedderConfig(100))
+	if l != nil {
+		t.Fatalf("NewLoadShedder(false) = %v, want nil", l)
+	}
+	l.ObservePublish(time.Hour)
+	l.Run(context.Background(), func() int64 { return 1 << 30 })
+	if l.Shedding() {
+		t.Error("disabled shedder is shedding")
+	}
+	if refused := shed(t, l, 10, false); refused != 0 {
+		t.Errorf("%d requests refused", refused)
+	}
+}
@@ -1,11 +1,19 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
 	"ingestion-service/internal/models"
 	"ingestion-service/internal/redis"
 )
@@ -24,72 +32,142 @@ func NewIdempotencyMiddleware(redisClient *redis.Client, ttl time.Duration) *Ide
 	}
 }
 
-// Wrap wraps an HTTP handler with idempotency checks
+// Wrap wraps an HTTP handler with idempotency checks. It runs after
+// authentication, so cached responses are recorded with the user who made
+// the request. While the Redis circuit breaker is open the cache is skipped
+// altogether and the response carries X-Idempotency-Degraded: true.
 func (i *IdempotencyMiddleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract idempotency key from header
 		idempotencyKey := r.Header.Get("Idempotency-Key")
 		if idempotencyKey == "" {
-			http.Error(w, "Idempotency-Key header required", http.StatusBadRequest)
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeIdempotencyKeyRequired, "Idempotency-Key header required")
+			return
+		}
+		i.serve(w, r, next, idempotencyKey, "")
+	}
+}
+
+// WrapBatch wraps a batch handler, whose transactions carry their own
+// idempotency keys, with an optional Idempotency-Key header. Without one the
+// request passes straight through. With one, only a replay of the identical
+// batch body is answered from the cache, with the whole batch response; a
+// different body under the same key is processed, and its response cached
+// in place of the earlier one.
+func (i *IdempotencyMiddleware) WrapBatch(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Check if we've seen this request before
-		cachedResponse, err := i.redisClient.GetIdempotencyKey(r.Context(), idempotencyKey)
+		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			// Log error but continue processing
-			fmt.Printf("Redis error during idempotency check: %v\n", err)
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "failed to read request body")
+			return
 		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		i.serve(w, r, next, idempotencyKey, hex.EncodeToString(sum[:]))
+	}
+}
 
-		if cachedResponse != nil {
-			// Return cached response
-			var response models.TransactionResponse
-			if err := json.Unmarshal(cachedResponse, &response); err != nil {
-				http.Error(w, "Invalid cached response", http.StatusInternalServerError)
-				return
-			}
+// serve answers a request under an idempotency key from the cache, or
+// processes it and caches a successful response. With a body hash, the
+// cached response only answers a request whose body has the same hash, and
+// the whole response is cached.
+func (i *IdempotencyMiddleware) serve(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, idempotencyKey, bodyHash string) {
+	if i.redisClient.Degraded() {
+		i.degraded(w, r, next)
+		return
+	}
+
+	// Check if we've seen this request before
+	cachedResponse, err := i.redisClient.GetIdempotencyKey(r.Context(), idempotencyKey)
+	if errors.Is(err, redis.ErrCircuitOpen) {
+		i.degraded(w, r, next)
+		return
+	}
+	if err != nil {
+		// Log error but continue processing
+		fmt.Printf("Redis error during idempotency check: %v\n", err)
+	}
 
+	if cachedResponse != nil {
+		var entry models.IdempotencyEntry
+		if err := json.Unmarshal(cachedResponse, &entry); err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Invalid cached response")
+			return
+		}
+
+		// Return cached response, unless it answered another body
+		if entry.BodyHash == bodyHash {
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Idempotency-Cache", "true")
 			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(response)
+			if entry.Body != nil {
+				w.Write(entry.Body)
+			} else {
+				json.NewEncoder(w).Encode(entry.TransactionResponse)
+			}
 			return
 		}
+	}
 
-		// Create a response recorder to capture the response
-		recorder := &responseRecorder{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-			body:           make([]byte, 0),
-		}
+	// Create a response recorder to capture the response
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+		body:           make([]byte, 0),
+	}
 
-		// Process the request
-		next.ServeHTTP(recorder, r)
+	// Process the request
+	next.ServeHTTP(recorder, r)
 
-		// If successful, cache the response
-		if recorder.statusCode >= 200 && recorder.statusCode < 300 {
-			response := models.TransactionResponse{
-				Status:    "success",
-				Message:   "Transaction processed",
-				Timestamp: time.Now(),
-			}
+	// If successful, cache the response
+	if recorder.statusCode >= 200 && recorder.statusCode < 300 {
+		response := models.TransactionResponse{
+			Status:    "success",
+			Message:   "Transaction processed",
+			Timestamp: time.Now(),
+		}
 
-			// Try to extract transaction ID from response body if available
-			var txnResponse map[string]interface{}
-			if json.Unmarshal(recorder.body, &txnResponse) == nil {
-				if id, ok := txnResponse["id"].(string); ok {
-					response.ID = id
-				}
+		// Try to extract transaction ID from response body if available
+		var txnResponse map[string]interface{}
+		if json.Unmarshal(recorder.body, &txnResponse) == nil {
+			if id, ok := txnResponse["id"].(string); ok {
+				response.ID = id
 			}
+		}
 
-			// Cache the response
-			if err := i.redisClient.SetIdempotencyKey(r.Context(), idempotencyKey, response, i.ttl); err != nil {
-				fmt.Printf("Failed to cache idempotency response: %v\n", err)
-			}
+		// Cache the response with its owner, for the admin API. A
+		// request that timed out may still have been accepted, so the
+		// response is cached whether or not the request context is done,
+		// for the client's retry to find it.
+		entry := models.IdempotencyEntry{TransactionResponse: response, BodyHash: bodyHash}
+		if bodyHash != "" {
+			response.Message = "Batch processed"
+			entry.TransactionResponse = response
+			entry.Body = json.RawMessage(recorder.body)
+		}
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			entry.UserID = claims.UserID
+		}
+		if err := i.redisClient.SetIdempotencyKey(context.WithoutCancel(r.Context()), idempotencyKey, entry.UserID, entry, i.ttl); err != nil {
+			fmt.Printf("Failed to cache idempotency response: %v\n", err)
 		}
 	}
 }
 
+// degraded serves a request without the idempotency cache, telling the
+// client its retries may not be recognized
+func (i *IdempotencyMiddleware) degraded(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	RecordRedisOperation("idempotency_check", "skipped")
+	w.Header().Set("X-Idempotency-Degraded", "true")
+	next.ServeHTTP(w, r)
+}
+
 // responseRecorder captures the response for caching
 type responseRecorder struct {
 	http.ResponseWriter
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/redis"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newIdempotency returns an idempotency middleware backed by an in-memory
+// Redis, whose breaker opens after two failures
+func newIdempotency(t *testing.T) (*IdempotencyMiddleware, *redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient(redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		redis.BreakerConfig{Threshold: 2, Cooldown: time.Minute, OpTimeout: time.Second, OnStateChange: RecordRedisBreakerTransition})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewIdempotencyMiddleware(client, time.Hour), client, mr
+}
+
+// countingHandler accepts a transaction, counting the requests it serves
+func countingHandler(served *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"txn-1"}`))
+	}
+}
+
+// idempotentRequest posts a transaction under key through handler
+func idempotentRequest(handler http.HandlerFunc, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", strings.NewReader(`{}`))
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestIdempotencySkipsTheCacheWhileRedisIsDown(t *testing.T) {
+	idempotency, client, mr := newIdempotency(t)
+	var served atomic.Int64
+	handler := idempotency.Wrap(countingHandler(&served))
+
+	idempotentRequest(handler, "key-1")
+	w := idempotentRequest(handler, "key-1")
+	if w.Header().Get("X-Idempotency-Cache") != "true" || served.Load() != 1 {
+		t.Fatalf("retry served %d times, cache header %q, want it answered from the cache",
+			served.Load(), w.Header().Get("X-Idempotency-Cache"))
+	}
+
+	skipped := func() float64 {
+		return testutil.ToFloat64(redisOperationsTotal.WithLabelValues("idempotency_check", "skipped"))
+	}
+	before := skipped()
+	mr.Close()
+
+	// A request failing both its lookup and its caching is processed, and
+	// opens the breaker
+	if w := idempotentRequest(handler, "key-2"); w.Code != http.StatusAccepted || w.Header().Get("X-Idempotency-Degraded") != "" {
+		t.Fatalf("request with Redis down: status %d, degraded %q, want 202 before the breaker opens",
+			w.Code, w.Header().Get("X-Idempotency-Degraded"))
+	}
+	if !client.Degraded() {
+		t.Fatal("breaker still closed after 2 failed operations")
+	}
+	if got := testutil.ToFloat64(redisBreakerState); got != float64(redis.BreakerOpen) {
+		t.Errorf("breaker state gauge = %v, want open", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		w := idempotentRequest(handler, "key-1")
+		if w.Code != http.StatusAccepted || w.Header().Get("X-Idempotency-Degraded") != "true" {
+			t.Errorf("request with the breaker open: status %d, degraded %q, want 202 and true",
+				w.Code, w.Header().Get("X-Idempotency-Degraded"))
+		}
+	}
+	if served.Load() != 5 {
+		t.Errorf("handler served %d requests, want every request past the first retry", served.Load())
+	}
+	if got := skipped() - before; got != 3 {
+		t.Errorf("%v idempotency checks counted as skipped, want 3", got)
+	}
+}
+
+// echoHandler answers a batch with its own body, counting the requests it
+// serves
+func echoHandler(served *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(body)
+	}
+}
+
+// batchEnvelope posts body through handler, under key when it is not empty
+func batchEnvelope(handler http.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/batch", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestBatchHeaderOnlyGuardsTheIdenticalBody(t *testing.T) {
+	idempotency, _, _ := newIdempotency(t)
+	var served atomic.Int64
+	handler := idempotency.WrapBatch(echoHandler(&served))
+	batchA := `[{"idempotency_key":"key-1"},{"idempotency_key":"key-2"}]`
+	batchB := `[{"idempotency_key":"key-1"},{"idempotency_key":"key-3"}]`
+
+	// Without the header every batch is served, left to the item keys
+	for i := 0; i < 2; i++ {
+		if w := batchEnvelope(handler, "", batchA); w.Code != http.StatusAccepted || w.Header().Get("X-Idempotency-Cache") != "" {
+			t.Fatalf("batch without a key: status %d, cache %q, want it served", w.Code, w.Header().Get("X-Idempotency-Cache"))
+		}
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		cached bool
+	}{
+		{"first batch under the key", batchA, false},
+		{"replay of the identical batch", batchA, true},
+		{"another batch under the key", batchB, false},
+		{"replay of the other batch", batchB, true},
+	}
+	for _, tt := range tests {
+		before := served.Load()
+		w := batchEnvelope(handler, "batch-1", tt.body)
+		wantServed := int64(1)
+		if tt.cached {
+			wantServed = 0
+		}
+		cached := w.Header().Get("X-Idempotency-Cache") == "true"
+		if n := served.Load() - before; cached != tt.cached || n != wantServed {
+			t.Errorf("%s: cached %v and served %d times, want cached %v", tt.name, cached, n, tt.cached)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: body %s, want the whole batch response %s", tt.name, w.Body, tt.body)
+		}
+	}
+}
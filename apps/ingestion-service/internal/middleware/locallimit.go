@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// localLimiter counts requests in fixed windows in process, as Redis does
+// for the shared limits. It stands in while Redis is unavailable, so each
+// instance enforces the limit on its own share of the traffic.
+type localLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]localWindow
+	lastPrune time.Time
+}
+
+// localWindow is the count of a key in the window ending at end
+type localWindow struct {
+	count int64
+	end   time.Time
+}
+
+func newLocalLimiter() *localLimiter {
+	return &localLimiter{windows: make(map[string]localWindow)}
+}
+
+// count counts a request under key in a window starting at its first
+// request, returning the count so far and the time left in the window
+func (l *localLimiter) count(key string, window time.Duration) (int64, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop the windows that have ended, at most once per window length
+	if now.Sub(l.lastPrune) >= window {
+		for k, w := range l.windows {
+			if !now.Before(w.end) {
+				delete(l.windows, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.end) {
+		w = localWindow{end: now.Add(window)}
+	}
+	w.count++
+	l.windows[key] = w
+	return w.count, w.end.Sub(now)
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/redis"
+)
+
+// Lockout scopes: a source is a client IP or the user_id claim of the
+// tokens it presents
+const (
+	LockoutScopeIP   = "ip"
+	LockoutScopeUser = "user"
+)
+
+// AuthLockoutConfig configures an AuthLockout
+type AuthLockoutConfig struct {
+	// Threshold invalid tokens from a source within Window lock it out for
+	// Cooldown
+	Threshold int64
+	Window    time.Duration
+	Cooldown  time.Duration
+
+	// TokenLimit requests to the token endpoint are allowed per client IP
+	// in each TokenWindow
+	TokenLimit  int64
+	TokenWindow time.Duration
+
+	// TrustForwardedFor takes the client IP from the first X-Forwarded-For
+	// entry, for when the service is only reachable through the gateway
+	TrustForwardedFor bool
+}
+
+// AuthLockout throttles brute-forcing of tokens. Invalid tokens are counted
+// in Redis per client IP and per user_id claim; a source reaching the
+// threshold has its further invalid tokens refused with 429 until the
+// cooldown ends. Valid tokens are never refused, whatever their source. The
+// counts fail open while Redis is unavailable, except the token endpoint's
+// limit, which falls back to counting in process.
+type AuthLockout struct {
+	client *redis.Client
+	cfg    AuthLockoutConfig
+	local  *localLimiter
+}
+
+// NewAuthLockout creates an authentication lockout, or returns nil when
+// disabled
+func NewAuthLockout(enabled bool, client *redis.Client, cfg AuthLockoutConfig) *AuthLockout {
+	if !enabled {
+		return nil
+	}
+	return &AuthLockout{client: client, cfg: cfg, local: newLocalLimiter()}
+}
+
+// lockoutSubject is a source counted for lockout
+type lockoutSubject struct {
+	scope string
+	value string
+}
+
+func (s lockoutSubject) key() string {
+	return s.scope + ":" + s.value
+}
+
+// subjects returns the sources of a request presenting token
+func (l *AuthLockout) subjects(r *http.Request, token string) []lockoutSubject {
+	subjects := []lockoutSubject{{scope: LockoutScopeIP, value: l.clientIP(r)}}
+	if userID := auth.UnverifiedUserID(token); userID != "" {
+		subjects = append(subjects, lockoutSubject{scope: LockoutScopeUser, value: userID})
+	}
+	return subjects
+}
+
+// Refuse handles a request whose token did not validate. It reports whether
+// the request was refused with 429 because a source is locked out, and
+// otherwise counts the failure against its sources, locking out those
+// reaching the threshold.
+func (l *AuthLockout) Refuse(w http.ResponseWriter, r *http.Request, token string) bool {
+	RecordAuthInvalidToken()
+	if l == nil {
+		return false
+	}
+
+	ctx := r.Context()
+	subjects := l.subjects(r, token)
+	if retryAfter := l.locked(ctx, subjects); retryAfter > 0 {
+		RecordAuthRefused("api")
+		writeTooManyRequests(w, r, retryAfter, "too many failed authentication attempts, retry later")
+		return true
+	}
+
+	for _, subject := range subjects {
+		locked, err := l.client.RecordAuthFailure(ctx, subject.key(), l.cfg.Window, l.cfg.Threshold, l.cfg.Cooldown)
+		if err != nil {
+			slog.WarnContext(ctx, "auth lockout unavailable", "error", err)
+			return false
+		}
+		if locked {
+			RecordAuthLockout(subject.scope)
+			slog.WarnContext(ctx, "auth lockout",
+				"scope", subject.scope,
+				"subject", subject.value,
+				"threshold", l.cfg.Threshold,
+				"window", l.cfg.Window,
+				"cooldown", l.cfg.Cooldown,
+				"path", r.URL.Path)
+		}
+	}
+	return false
+}
+
+// locked returns the longest remaining lockout of the subjects, zero when
+// none is locked out
+func (l *AuthLockout) locked(ctx context.Context, subjects []lockoutSubject) time.Duration {
+	var longest time.Duration
+	for _, subject := range subjects {
+		remaining, err := l.client.AuthLockout(ctx, subject.key())
+		if err != nil {
+			slog.WarnContext(ctx, "auth lockout unavailable", "error", err)
+			return 0
+		}
+		longest = max(longest, remaining)
+	}
+	return longest
+}
+
+// LimitTokenRequests refuses requests to the token endpoint with 429 once a
+// client IP has made TokenLimit of them in the current TokenWindow. The
+// requests are counted in process while Redis cannot count them.
+func (l *AuthLockout) LimitTokenRequests(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIP(r)
+		key := "auth-token:" + ip
+		count, remaining, err := l.client.CountRequest(r.Context(), key, l.cfg.TokenWindow)
+		if err != nil {
+			if !errors.Is(err, redis.ErrCircuitOpen) {
+				slog.WarnContext(r.Context(), "token rate limit falling back to local count", "error", err)
+			}
+			RecordRedisOperation("rate_limit", "local")
+			count, remaining = l.local.count(key, l.cfg.TokenWindow)
+		}
+		if count > l.cfg.TokenLimit {
+			RecordAuthRefused("token")
+			if count == l.cfg.TokenLimit+1 {
+				slog.WarnContext(r.Context(), "token rate limit reached",
+					"ip", ip, "limit", l.cfg.TokenLimit, "window", l.cfg.TokenWindow)
+			}
+			writeTooManyRequests(w, r, remaining, "too many token requests, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// clientIP returns the IP of the client making a request
+func (l *AuthLockout) clientIP(r *http.Request) string {
+	if l.cfg.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeTooManyRequests refuses a request with 429, to be retried after
+// retryAfter, rounded up to a second
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeRateLimited, message)
+}
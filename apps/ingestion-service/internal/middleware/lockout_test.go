@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/auth"
+	"ingestion-service/internal/redis"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/alicebob/miniredis/v2"
+)
+
+const testSecret = "lockout-test-secret-of-32-bytes!!"
+
+// newTestLockout returns an auth middleware locking out a source after
+// threshold invalid tokens, backed by an in-memory Redis
+func newTestLockout(t *testing.T, cfg AuthLockoutConfig) (*AuthMiddleware, *AuthLockout, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient(redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		redis.BreakerConfig{Threshold: 5, Cooldown: time.Second, OpTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	lockout := NewAuthLockout(true, client, cfg)
+	jwtManager := auth.NewJWTManager("test", testSecret, nil, 1)
+	return NewAuthMiddleware(jwtManager, lockout), lockout, mr
+}
+
+// request makes a request from ip presenting token through handler
+func request(handler http.HandlerFunc, ip, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/transactions", nil)
+	r.RemoteAddr = ip + ":40000"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// forgedToken returns a token claiming userID signed with the wrong key
+func forgedToken(t *testing.T, userID string) string {
+	t.Helper()
+	token, err := auth.NewJWTManager("test", "not-the-secret-of-the-service!!!!", nil, 1).
+		GenerateToken(userID, "acct", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func TestBruteForceBurstLocksOutSource(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 5, Window: time.Minute, Cooldown: 5 * time.Minute}
+	am, _, _ := newTestLockout(t, cfg)
+	handler := am.RequireAuth(ok)
+	forged := forgedToken(t, "mallory")
+
+	for i := 0; i < 5; i++ {
+		if w := request(handler, "203.0.113.7", forged); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, w.Code)
+		}
+	}
+
+	w := request(handler, "203.0.113.7", forged)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("attempt after the threshold: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "300" {
+		t.Errorf("Retry-After = %q, want 300", w.Header().Get("Retry-After"))
+	}
+	if code := errorCode(t, w); code != apierror.CodeRateLimited {
+		t.Errorf("code %q, want %q", code, apierror.CodeRateLimited)
+	}
+
+	// The user_id claim is locked out too, from any address
+	if w := request(handler, "198.51.100.9", forged); w.Code != http.StatusTooManyRequests {
+		t.Errorf("same user from another address: status %d, want 429", w.Code)
+	}
+}
+
+func TestValidTokensAreNeverThrottled(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 3, Window: time.Minute, Cooldown: 5 * time.Minute}
+	am, _, _ := newTestLockout(t, cfg)
+	handler := am.RequireAuth(ok)
+
+	for i := 0; i < 10; i++ {
+		request(handler, "203.0.113.7", forgedToken(t, "mallory"))
+	}
+
+	valid, err := auth.NewJWTManager("test", testSecret, nil, 1).GenerateToken("mallory", "acct", nil, "")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if w := request(handler, "203.0.113.7", valid); w.Code != http.StatusOK {
+		t.Errorf("valid token from a locked out source: status %d, want 200", w.Code)
+	}
+}
+
+func TestLockoutEndsAfterCooldown(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 2, Window: time.Minute, Cooldown: 30 * time.Second}
+	am, _, mr := newTestLockout(t, cfg)
+	handler := am.RequireAuth(ok)
+	forged := forgedToken(t, "mallory")
+
+	request(handler, "203.0.113.7", forged)
+	request(handler, "203.0.113.7", forged)
+	if w := request(handler, "203.0.113.7", forged); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d during the cooldown, want 429", w.Code)
+	}
+
+	mr.FastForward(31 * time.Second)
+	if w := request(handler, "203.0.113.7", forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d after the cooldown, want 401", w.Code)
+	}
+}
+
+func TestFailuresOutsideTheWindowDoNotAccumulate(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 3, Window: 10 * time.Second, Cooldown: time.Minute}
+	am, _, mr := newTestLockout(t, cfg)
+	handler := am.RequireAuth(ok)
+	forged := forgedToken(t, "mallory")
+
+	for i := 0; i < 5; i++ {
+		if w := request(handler, "203.0.113.7", forged); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, w.Code)
+		}
+		// Two failures per window never reach the threshold of three
+		if i%2 == 1 {
+			mr.FastForward(11 * time.Second)
+		}
+	}
+}
+
+func TestTokenEndpointLimit(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 100, Window: time.Minute, Cooldown: time.Minute, TokenLimit: 3, TokenWindow: time.Minute}
+	_, lockout, mr := newTestLockout(t, cfg)
+	handler := lockout.LimitTokenRequests(ok)
+
+	for i := 0; i < 3; i++ {
+		if w := request(handler, "203.0.113.7", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+	}
+	if w := request(handler, "203.0.113.7", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status %d, want 429", w.Code)
+	}
+	if w := request(handler, "198.51.100.9", ""); w.Code != http.StatusOK {
+		t.Errorf("another address: status %d, want 200", w.Code)
+	}
+
+	mr.FastForward(61 * time.Second)
+	if w := request(handler, "203.0.113.7", ""); w.Code != http.StatusOK {
+		t.Errorf("status %d in the next window, want 200", w.Code)
+	}
+}
+
+func TestTokenEndpointLimitFallsBackToALocalCount(t *testing.T) {
+	cfg := AuthLockoutConfig{Threshold: 100, Window: time.Minute, Cooldown: time.Minute, TokenLimit: 3, TokenWindow: time.Minute}
+	_, lockout, mr := newTestLockout(t, cfg)
+	handler := lockout.LimitTokenRequests(ok)
+	mr.Close()
+
+	// The limit holds across the failures opening the breaker and after
+	for i := 0; i < 3; i++ {
+		if w := request(handler, "203.0.113.7", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d with Redis down: status %d, want 200", i+1, w.Code)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if w := request(handler, "203.0.113.7", ""); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("request over the limit with Redis down: status %d, want 429", w.Code)
+		}
+	}
+	if w := request(handler, "198.51.100.9", ""); w.Code != http.StatusOK {
+		t.Errorf("another address with Redis down: status %d, want 200", w.Code)
+	}
+}
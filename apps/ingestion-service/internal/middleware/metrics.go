@@ -2,9 +2,15 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"ingestion-service/internal/apierror"
+	"ingestion-service/internal/redis"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -23,7 +29,7 @@ var (
 		prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
 			Help:    "Duration of HTTP requests",
-			Buckets: prometheus.DefBuckets,
+			Buckets: buckets.For("http_request_duration_seconds", buckets.Request),
 		},
 		[]string{"method", "endpoint"},
 	)
@@ -34,7 +40,7 @@ var (
 			Name: "transactions_ingested_total",
 			Help: "Total number of transactions ingested",
 		},
-		[]string{"currency", "type", "status"},
+		[]string{"currency", "type", "tenant", "status"},
 	)
 
 	transactionsFailed = promauto.NewCounterVec(
@@ -57,12 +63,104 @@ var (
 	kafkaPublishDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "kafka_publish_duration_seconds",
-			Help:    "Duration of Kafka publish operations",
-			Buckets: prometheus.DefBuckets,
+			Help:    "Duration of Kafka publish operations, until the broker acknowledges",
+			Buckets: buckets.For("kafka_publish_duration_seconds", buckets.Publish),
 		},
 		[]string{"topic"},
 	)
 
+	kafkaPublishQueued = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kafka_publish_queued_messages",
+			Help: "Number of messages handed to the Kafka writer and not yet acknowledged",
+		},
+	)
+
+	// Back-pressure metrics
+	backpressureShedding = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingestion_backpressure_shedding",
+			Help: "Whether requests are being shed because the pipeline is saturated (1) or not (0)",
+		},
+	)
+
+	requestsShed = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestion_requests_shed_total",
+			Help: "Total number of requests refused with 503 to shed load",
+		},
+	)
+
+	requestTimeouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_request_timeouts_total",
+			Help: "Total number of requests refused with 503 for running past their route's deadline, by route",
+		},
+		[]string{"route"},
+	)
+
+	// Outbox metrics
+	outboxDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingestion_outbox_depth",
+			Help: "Number of accepted transactions in the outbox waiting to be published",
+		},
+	)
+
+	outboxOldestAge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingestion_outbox_oldest_age_seconds",
+			Help: "Age of the oldest transaction in the outbox waiting to be published",
+		},
+	)
+
+	// Duplicate detection metrics
+	duplicateSuspects = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_duplicate_suspects_total",
+			Help: "Total number of transactions whose content repeats one accepted within the duplicate window, by what was done with them",
+		},
+		[]string{"mode"},
+	)
+
+	batchDuplicateItems = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestion_batch_duplicate_items_total",
+			Help: "Total number of batch transactions skipped for an idempotency key accepted before",
+		},
+	)
+
+	metadataTruncated = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestion_metadata_truncated_total",
+			Help: "Total number of transactions whose metadata was truncated to fit the limits in lenient mode",
+		},
+	)
+
+	// Authentication lockout metrics
+	authInvalidTokens = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestion_auth_invalid_tokens_total",
+			Help: "Total number of requests presenting a token that does not validate",
+		},
+	)
+
+	authLockouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_auth_lockouts_total",
+			Help: "Total number of sources locked out for repeated authentication failures, by whether a client IP or a user_id claim",
+		},
+		[]string{"scope"},
+	)
+
+	authRefused = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_auth_refused_total",
+			Help: "Total number of requests refused with 429 by the authentication limits, by endpoint",
+		},
+		[]string{"endpoint"},
+	)
+
 	// Redis metrics
 	redisOperationsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -76,10 +174,41 @@ var (
 		prometheus.HistogramOpts{
 			Name:    "redis_operation_duration_seconds",
 			Help:    "Duration of Redis operations",
-			Buckets: prometheus.DefBuckets,
+			Buckets: buckets.For("redis_operation_duration_seconds", buckets.Redis),
 		},
 		[]string{"operation"},
 	)
+
+	redisUp = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingestion_redis_up",
+			Help: "Whether Redis is reachable (1) or not (0)",
+		},
+	)
+
+	redisBreakerState = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingestion_redis_breaker_state",
+			Help: "State of the Redis circuit breaker: closed (0), open (1) or half-open (2)",
+		},
+	)
+
+	redisBreakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_redis_breaker_transitions_total",
+			Help: "Total number of Redis circuit breaker state changes, by state left and entered",
+		},
+		[]string{"from", "to"},
+	)
+
+	// Build information
+	buildInfo = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "ingestion_build_info",
+			Help:        "Build information of the running binary, always 1",
+			ConstLabels: buildinfo.Labels(),
+		},
+	)
 )
 
 // MetricsMiddleware wraps HTTP handlers with Prometheus metrics
@@ -116,9 +245,10 @@ func (m *MetricsMiddleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// RecordTransactionIngested records a successful transaction ingestion
-func RecordTransactionIngested(currency, txnType, status string) {
-	transactionsIngested.WithLabelValues(currency, txnType, status).Inc()
+// RecordTransactionIngested records a successful transaction ingestion. The
+// tenant is a label from tenant.Set.Label, which keeps it bounded.
+func RecordTransactionIngested(currency, txnType, tenant, status string) {
+	transactionsIngested.WithLabelValues(currency, txnType, tenant, status).Inc()
 }
 
 // RecordTransactionFailed records a failed transaction
@@ -126,6 +256,23 @@ func RecordTransactionFailed(reason string) {
 	transactionsFailed.WithLabelValues(reason).Inc()
 }
 
+// RecordValidationFailures records a transaction refused for details, with
+// the code of each problem as its reason. Codes other than the API's are
+// recorded as other, so the label stays bounded.
+func RecordValidationFailures(details []apierror.Detail) {
+	recorded := make(map[string]bool, len(details))
+	for _, d := range details {
+		code := d.Code
+		if !slices.Contains(apierror.Codes, code) {
+			code = "other"
+		}
+		if !recorded[code] {
+			recorded[code] = true
+			transactionsFailed.WithLabelValues(code).Inc()
+		}
+	}
+}
+
 // RecordKafkaMessagePublished records a Kafka message publication
 func RecordKafkaMessagePublished(topic, status string) {
 	kafkaMessagesPublished.WithLabelValues(topic, status).Inc()
@@ -136,6 +283,65 @@ func RecordKafkaPublishDuration(topic string, duration time.Duration) {
 	kafkaPublishDuration.WithLabelValues(topic).Observe(duration.Seconds())
 }
 
+// SetKafkaPublishQueued records the number of messages awaiting acknowledgement
+func SetKafkaPublishQueued(queued int64) {
+	kafkaPublishQueued.Set(float64(queued))
+}
+
+// SetBackpressureShedding records whether requests are being shed
+func SetBackpressureShedding(shedding bool) {
+	if shedding {
+		backpressureShedding.Set(1)
+	} else {
+		backpressureShedding.Set(0)
+	}
+}
+
+// RecordRequestShed records a request refused to shed load
+func RecordRequestShed() {
+	requestsShed.Inc()
+}
+
+// SetOutboxBacklog records the number of unpublished outbox entries and the
+// age of the oldest
+func SetOutboxBacklog(depth int64, oldest time.Duration) {
+	outboxDepth.Set(float64(depth))
+	outboxOldestAge.Set(oldest.Seconds())
+}
+
+// RecordDuplicateSuspect records a suspected duplicate, rejected or tagged
+// according to mode
+func RecordDuplicateSuspect(mode string) {
+	duplicateSuspects.WithLabelValues(mode).Inc()
+}
+
+// RecordBatchDuplicateItems records n batch transactions skipped for their
+// idempotency key
+func RecordBatchDuplicateItems(n int) {
+	batchDuplicateItems.Add(float64(n))
+}
+
+// RecordMetadataTruncated records a transaction whose metadata was
+// truncated to fit the limits
+func RecordMetadataTruncated() {
+	metadataTruncated.Inc()
+}
+
+// RecordAuthInvalidToken records a request presenting an invalid token
+func RecordAuthInvalidToken() {
+	authInvalidTokens.Inc()
+}
+
+// RecordAuthLockout records a source locked out, by scope
+func RecordAuthLockout(scope string) {
+	authLockouts.WithLabelValues(scope).Inc()
+}
+
+// RecordAuthRefused records a request refused by the authentication limits
+func RecordAuthRefused(endpoint string) {
+	authRefused.WithLabelValues(endpoint).Inc()
+}
+
 // RecordRedisOperation records a Redis operation
 func RecordRedisOperation(operation, status string) {
 	redisOperationsTotal.WithLabelValues(operation, status).Inc()
@@ -146,6 +352,27 @@ func RecordRedisOperationDuration(operation string, duration time.Duration) {
 	redisOperationDuration.WithLabelValues(operation).Observe(duration.Seconds())
 }
 
+// SetRedisUp records whether Redis is reachable
+func SetRedisUp(up bool) {
+	if up {
+		redisUp.Set(1)
+	} else {
+		redisUp.Set(0)
+	}
+}
+
+// RecordRedisBreakerTransition records a state change of the Redis circuit
+// breaker
+func RecordRedisBreakerTransition(from, to redis.BreakerState) {
+	redisBreakerState.Set(float64(to))
+	redisBreakerTransitions.WithLabelValues(from.String(), to.String()).Inc()
+}
+
+// SetBuildInfo exports the build_info gauge
+func SetBuildInfo() {
+	buildInfo.Set(1)
+}
+
 // statusRecorder captures the HTTP status code
 type statusRecorder struct {
 	http.ResponseWriter
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ingestion-service/internal/apierror"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestValidationFailuresAreCountedByCode(t *testing.T) {
+	failed := func(reason string) float64 {
+		return testutil.ToFloat64(transactionsFailed.WithLabelValues(reason))
+	}
+	before := map[string]float64{}
+	for _, reason := range []string{apierror.CodeMissingRequiredFields, apierror.CodeInvalidCurrency, "other", "made_up"} {
+		before[reason] = failed(reason)
+	}
+
+	// A transaction missing two fields, with a bad currency and a problem
+	// of a code the API does not know
+	RecordValidationFailures([]apierror.Detail{
+		{Field: "account_id", Code: apierror.CodeMissingRequiredFields},
+		{Field: "user_id", Code: apierror.CodeMissingRequiredFields},
+		{Field: "currency", Code: apierror.CodeInvalidCurrency},
+		{Field: "metadata", Code: "made_up"},
+	})
+
+	want := map[string]float64{
+		apierror.CodeMissingRequiredFields: 1,
+		apierror.CodeInvalidCurrency:       1,
+		"other":                            1,
+		"made_up":                          0,
+	}
+	for reason, n := range want {
+		if got := failed(reason) - before[reason]; got != n {
+			t.Errorf("%v failures counted as %s, want %v", got, reason, n)
+		}
+	}
+}
+
+// scrape returns the /metrics output of handler
+func scrape(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read /metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestDefaultBucketsAreExposed(t *testing.T) {
+	redisOperationDuration.WithLabelValues("buckets_test").Observe(0.0003)
+
+	body := scrape(t, promhttp.Handler())
+	for _, bound := range []string{"0.0001", "0.00025", "0.0005", "0.1", "+Inf"} {
+		line := `redis_operation_duration_seconds_bucket{operation="buckets_test",le="` + bound + `"}`
+		if !strings.Contains(body, line) {
+			t.Errorf("/metrics lacks %s", line)
+		}
+	}
+	// prometheus.DefBuckets would go on to 10s
+	if strings.Contains(body, `redis_operation_duration_seconds_bucket{operation="buckets_test",le="10"}`) {
+		t.Error("/metrics exposes the default Prometheus buckets")
+	}
+}
+
+func TestConfiguredBucketsAreExposed(t *testing.T) {
+	t.Setenv(buckets.EnvVar("kafka_publish_duration_seconds"), "0.0005,0.002,0.008")
+	registry := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kafka_publish_duration_seconds",
+		Help:    "Duration of Kafka publish operations, until the broker acknowledges",
+		Buckets: buckets.For("kafka_publish_duration_seconds", buckets.Publish),
+	})
+	registry.MustRegister(histogram)
+	histogram.Observe(0.001)
+
+	body := scrape(t, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	want := []string{
+		`kafka_publish_duration_seconds_bucket{le="0.0005"} 0`,
+		`kafka_publish_duration_seconds_bucket{le="0.002"} 1`,
+		`kafka_publish_duration_seconds_bucket{le="0.008"} 1`,
+		`kafka_publish_duration_seconds_bucket{le="+Inf"} 1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(body, line) {
+			t.Errorf("/metrics lacks %q:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `le="0.001"`) {
+		t.Error("/metrics exposes the default buckets besides the configured ones")
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"ingestion-service/internal/apierror"
+)
+
+// Timeout bounds requests to route to d. The request context is cancelled
+// at the deadline, so the Redis and Kafka calls made with it are abandoned,
+// and unless the handler has started its response the client gets 503 with
+// a timeout error. Whatever the handler writes afterwards is discarded.
+func Timeout(route string, d time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ctx: ctx, w: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				if !tw.timeout() {
+					// The response was under way; let the handler finish it
+					select {
+					case p := <-panicked:
+						panic(p)
+					case <-done:
+					}
+					return
+				}
+				requestTimeouts.WithLabelValues(route).Inc()
+				apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CodeTimeout, "request timed out")
+			}
+		}
+	}
+}
+
+// timeoutWriter hands the handler's response to the client until the
+// request times out. The handler gets its own headers, so they are not set
+// while the timeout response is written. A response the handler starts once
+// the deadline has passed, such as the error of a call cancelled by it, is
+// dropped so the timeout response wins.
+type timeoutWriter struct {
+	ctx    context.Context
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(statusCode)
+}
+
+func (tw *timeoutWriter) writeHeader(statusCode int) {
+	if tw.timedOut || tw.wroteHeader || tw.ctx.Err() != nil {
+		return
+	}
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(statusCode)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || !tw.wroteHeader && tw.ctx.Err() != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(data)
+}
+
+// timeout marks the request timed out, reporting false when the handler
+// has already started its response
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wroteHeader {
+		return false
+	}
+	tw.timedOut = true
+	return true
+}
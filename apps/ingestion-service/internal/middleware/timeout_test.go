@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/apierror"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowHandler sleeps before answering, reporting the error of its context
+// and of its write
+type slowHandler struct {
+	sleep    time.Duration
+	ctxErr   chan error
+	writeErr chan error
+}
+
+func newSlowHandler(sleep time.Duration) *slowHandler {
+	return &slowHandler{sleep: sleep, ctxErr: make(chan error, 1), writeErr: make(chan error, 1)}
+}
+
+func (h *slowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(h.sleep)
+	h.ctxErr <- r.Context().Err()
+	w.Header().Set("X-Handler", "slow")
+	w.WriteHeader(http.StatusAccepted)
+	_, err := w.Write([]byte(`{"status":"accepted"}`))
+	h.writeErr <- err
+}
+
+func TestTimeoutRefusesRequestsPastTheDeadline(t *testing.T) {
+	const route = "/api/v1/transactions"
+	before := testutil.ToFloat64(requestTimeouts.WithLabelValues(route))
+	h := newSlowHandler(200 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPost, route, nil)
+	req.Header.Set(apierror.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	Timeout(route, 20*time.Millisecond)(h.ServeHTTP)(rec, req)
+
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("answered after %s, want at the deadline", elapsed)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	var body apierror.Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not an error envelope: %v", rec.Body, err)
+	}
+	if body.Error.Code != apierror.CodeTimeout || body.Error.RequestID != "req-1" {
+		t.Errorf("error = %+v, want a timeout for req-1", body.Error)
+	}
+	if got := testutil.ToFloat64(requestTimeouts.WithLabelValues(route)) - before; got != 1 {
+		t.Errorf("%v timeouts counted for %s, want 1", got, route)
+	}
+
+	// The handler's context ends at the deadline and its late response is
+	// discarded
+	if err := <-h.ctxErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context error %v, want the deadline exceeded", err)
+	}
+	if err := <-h.writeErr; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error %v, want ErrHandlerTimeout", err)
+	}
+	if rec.Header().Get("X-Handler") != "" {
+		t.Error("late handler header leaked into the timeout response")
+	}
+}
+
+func TestTimeoutPassesResponsesWithinTheDeadline(t *testing.T) {
+	const route = "/api/v1/transactions/upload"
+	before := testutil.ToFloat64(requestTimeouts.WithLabelValues(route))
+	h := newSlowHandler(10 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	Timeout(route, time.Second)(h.ServeHTTP)(rec, httptest.NewRequest(http.MethodPost, route, nil))
+
+	if rec.Code != http.StatusAccepted || rec.Body.String() != `{"status":"accepted"}` || rec.Header().Get("X-Handler") != "slow" {
+		t.Errorf("response %d %q %v, want the handler's", rec.Code, rec.Body, rec.Header())
+	}
+	if err := <-h.ctxErr; err != nil {
+		t.Errorf("handler context error %v within the deadline", err)
+	}
+	if got := testutil.ToFloat64(requestTimeouts.WithLabelValues(route)) - before; got != 0 {
+		t.Errorf("%v timeouts counted within the deadline", got)
+	}
+}
+
+func TestTimeoutWinsOverTheErrorOfACancelledCall(t *testing.T) {
+	const route = "/api/v1/transactions"
+	// The handler answers as soon as its call is cancelled, racing the
+	// timeout response
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeKafkaUnavailable, "failed to enqueue transaction")
+	}
+
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		Timeout(route, time.Millisecond)(handler)(rec, httptest.NewRequest(http.MethodPost, route, nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestTimeoutLetsAStartedResponseFinish(t *testing.T) {
+	const route = "/api/v1/transactions/batch"
+	before := testutil.ToFloat64(requestTimeouts.WithLabelValues(route))
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		<-r.Context().Done()
+		w.Write([]byte("rest of the response"))
+	}
+
+	rec := httptest.NewRecorder()
+	Timeout(route, 20*time.Millisecond)(handler)(rec, httptest.NewRequest(http.MethodPost, route, nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "rest of the response" {
+		t.Errorf("response %d %q, want the started response finished", rec.Code, rec.Body)
+	}
+	if got := testutil.ToFloat64(requestTimeouts.WithLabelValues(route)) - before; got != 0 {
+		t.Errorf("%v timeouts counted for a started response", got)
+	}
+}
+
+func TestTimeoutPropagatesPanics(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}
+	defer func() {
+		if p := recover(); p != "handler failed" {
+			t.Errorf("recovered %v, want the handler's panic", p)
+		}
+	}()
+	Timeout("/api/v1/transactions", time.Second)(handler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	t.Error("the handler's panic was swallowed")
+}
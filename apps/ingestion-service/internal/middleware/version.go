@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+)
+
+// VersionHeaderName is the response header carrying the service version
+const VersionHeaderName = "X-Service-Version"
+
+// VersionHeader sets the X-Service-Version header on every response
+func VersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeaderName, buildinfo.Version)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVersionHeader(t *testing.T) {
+	handler := VersionHeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+
+	// Every response carries the header, errors included
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/transactions/missing", nil))
+	if got := w.Header().Get(VersionHeaderName); got != buildinfo.Version {
+		t.Errorf("%s = %q, want %q", VersionHeaderName, got, buildinfo.Version)
+	}
+}
+
+func TestBuildInfoGauge(t *testing.T) {
+	SetBuildInfo()
+
+	want := `# HELP ingestion_build_info Build information of the running binary, always 1
+# TYPE ingestion_build_info gauge
+ingestion_build_info{goversion="` + runtime.Version() + `",revision="unknown",version="dev"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "ingestion_build_info"); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,24 +1,18 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
 
 // Transaction represents a financial transaction that will be ingested.
 // This is the core data structure we're moving through the pipeline.
-type Transaction struct {
-	ID             string            `json:"id"`                  // unique identifier for the transaction
-	IdempotencyKey string            `json:"idempotency_key"`     // idempotency key for deduplication
-	AccountID      string            `json:"account_id"`          // account identifier for Kafka partitioning
-	UserID         string            `json:"user_id"`             // the user who initiated it
-	Amount         float64           `json:"amount"`              // how much money is involved
-	Currency       string            `json:"currency"`            // currency code (e.g., USD, INR)
-	Type           string            `json:"type"`                // transaction type (deposit, withdrawal, transfer, etc.)
-	Category       string            `json:"category"`            // transaction category (e.g., "groceries", "utilities")
-	Merchant       string            `json:"merchant,omitempty"`  // merchant name for card transactions
-	Reference      string            `json:"reference,omitempty"` // external reference number
-	Status         string            `json:"status"`              // transaction status (pending, completed, failed)
-	Timestamp      time.Time         `json:"timestamp"`           // when the transaction happened
-	Metadata       map[string]string `json:"metadata,omitempty"`  // optional extra info (tags, source, notes)
-}
+type Transaction = shared.Transaction
+
+// TransactionTypeRefund is the type of a transaction refunding another
+const TransactionTypeRefund = shared.TransactionTypeRefund
 
 // TransactionRequest represents the incoming HTTP request
 type TransactionRequest struct {
@@ -32,6 +26,15 @@ type TransactionRequest struct {
 	Merchant       string            `json:"merchant,omitempty"`
 	Reference      string            `json:"reference,omitempty"`
 	Metadata       map[string]string `json:"metadata,omitempty"`
+	TenantID       string            `json:"tenant_id,omitempty"`
+
+	// ParentTransactionID is the transaction a refund refunds, required
+	// when Type is refund
+	ParentTransactionID string `json:"parent_transaction_id,omitempty"`
+
+	// CallbackURL, on an allowlisted host, is posted the outcome of the
+	// transaction once it is decided
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 // TransactionResponse represents the API response
@@ -41,3 +44,57 @@ type TransactionResponse struct {
 	Message   string    `json:"message"`
 	Timestamp time.Time `json:"timestamp"`
 }
+
+// Statuses of the transactions of a batch
+const (
+	BatchItemAccepted  = "accepted"
+	BatchItemDuplicate = "duplicate"
+)
+
+// BatchItemResult is the outcome of one transaction of a batch. A duplicate
+// carries the ID its idempotency key was accepted under before.
+type BatchItemResult struct {
+	Index          int    `json:"index"`
+	IdempotencyKey string `json:"idempotency_key"`
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+}
+
+// BatchResponse is the response to a batch. A batch whose transactions are
+// valid is accepted whole, except the transactions whose idempotency key was
+// accepted before, which are skipped as duplicates; Count is the number of
+// transactions accepted.
+type BatchResponse struct {
+	Status     string            `json:"status"`
+	Message    string            `json:"message"`
+	Count      int               `json:"count"`
+	Duplicates int               `json:"duplicates"`
+	Results    []BatchItemResult `json:"results"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+// TokenRequest asks for a JWT for testing
+type TokenRequest struct {
+	UserID    string   `json:"user_id"`
+	AccountID string   `json:"account_id"`
+	Roles     []string `json:"roles"`
+	TenantID  string   `json:"tenant_id"`
+}
+
+// TokenResponse holds a JWT and its type
+type TokenResponse struct {
+	Token string `json:"token"`
+	Type  string `json:"type"`
+}
+
+// IdempotencyEntry is the response cached under an idempotency key, with the
+// user who made the request
+type IdempotencyEntry struct {
+	TransactionResponse
+	UserID string `json:"user_id,omitempty"`
+	// BodyHash is the SHA-256 of the request body, for a batch
+	BodyHash string `json:"body_hash,omitempty"`
+	// Body is the whole response, replayed in place of TransactionResponse
+	// when set, as for a batch
+	Body json.RawMessage `json:"body,omitempty"`
+}
@@ -0,0 +1,248 @@
+// Package outbox durably accepts transactions into a PostgreSQL table
+// within the HTTP request, and relays them to Kafka in the background. A
+// transaction is published at least once: if the relay dies between
+// publishing and marking entries sent, they are published again, and
+// consumers drop the repeats by transaction ID.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/publisher"
+
+	"github.com/lib/pq"
+	"github.com/segmentio/kafka-go"
+)
+
+// writeTimeout bounds the insert of accepted transactions
+const writeTimeout = 5 * time.Second
+
+// relayLockID is the advisory lock held by the one relay publishing at a
+// time, which keeps each account's transactions in order across instances
+const relayLockID = 7_344_211
+
+// ErrDuplicate is returned for a transaction whose idempotency key is
+// already in the outbox
+var ErrDuplicate = errors.New("duplicate idempotency key")
+
+// schemaSQL creates the outbox table
+var schemaSQL = []string{
+	`CREATE TABLE IF NOT EXISTS ingestion_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		idempotency_key VARCHAR(255) NOT NULL UNIQUE,
+		topic VARCHAR(255) NOT NULL,
+		key VARCHAR(255),
+		payload BYTEA NOT NULL,
+		headers JSONB,
+		created_at TIMESTAMP NOT NULL,
+		sent_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_ingestion_outbox_unsent ON ingestion_outbox(id) WHERE sent_at IS NULL`,
+}
+
+// Store is the outbox table
+type Store struct {
+	db *sql.DB
+}
+
+// Ping connects to the outbox database and disconnects, to wait for it to
+// accept connections before Open
+func Ping(ctx context.Context, databaseURL string) error {
+	connector, err := pq.NewConnector(databaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid outbox database URL: %w", err)
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to outbox database: %w", err)
+	}
+	return conn.Close()
+}
+
+// Open connects to the outbox database and creates the table
+func Open(databaseURL string) (*Store, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox database: %w", err)
+	}
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping outbox database: %w", err)
+	}
+	for _, stmt := range schemaSQL {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create outbox table: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Durable reports whether accepted transactions survive a crash of the
+// service; the outbox's are committed to the database
+func (s *Store) Durable() bool {
+	return true
+}
+
+// Publish stores a transaction for the relay to publish to topic
+func (s *Store) Publish(ctx context.Context, topic string, transaction models.Transaction) error {
+	return s.PublishBatch(ctx, topic, []models.Transaction{transaction})
+}
+
+// PublishBatch stores transactions for the relay to publish to topic, all
+// or none. It fails with ErrDuplicate when an idempotency key is already in
+// the outbox. The write is abandoned when ctx is done, or after writeTimeout.
+func (s *Store) PublishBatch(ctx context.Context, topic string, transactions []models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin outbox write: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	for _, txn := range transactions {
+		message, err := publisher.NewMessage(topic, txn)
+		if err != nil {
+			return fmt.Errorf("failed to serialize transaction: %w", err)
+		}
+		headers, err := json.Marshal(message.Headers)
+		if err != nil {
+			return fmt.Errorf("failed to serialize headers: %w", err)
+		}
+
+		result, err := dbTx.ExecContext(ctx, `
+			INSERT INTO ingestion_outbox (idempotency_key, topic, key, payload, headers, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (idempotency_key) DO NOTHING
+		`, txn.IdempotencyKey, topic, string(message.Key), message.Value, headers, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to write transaction to outbox: %w", err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("%w: %s", ErrDuplicate, txn.IdempotencyKey)
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit outbox write: %w", err)
+	}
+	return nil
+}
+
+// Relay locks up to limit unsent entries in insertion order, hands them to
+// publish and marks them sent once publish succeeds. It returns how many
+// were published, zero when another relay holds the lock.
+func (s *Store) Relay(ctx context.Context, limit int, publish func(context.Context, []kafka.Message) error) (int, error) {
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin outbox relay: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var locked bool
+	if err := dbTx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to lock outbox relay: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := dbTx.QueryContext(ctx, `
+		SELECT id, topic, key, payload, headers, created_at FROM ingestion_outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var ids []int64
+	var messages []kafka.Message
+	for rows.Next() {
+		var id int64
+		var message kafka.Message
+		var key sql.NullString
+		var headers []byte
+		if err := rows.Scan(&id, &message.Topic, &key, &message.Value, &headers, &message.Time); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &message.Headers); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to decode headers of outbox entry %d: %w", id, err)
+			}
+		}
+		message.Key = []byte(key.String)
+		ids = append(ids, id)
+		messages = append(messages, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, messages); err != nil {
+		return 0, err
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `UPDATE ingestion_outbox SET sent_at = $2 WHERE id = ANY($1)`,
+		pq.Array(ids), time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("failed to mark outbox entries sent: %w", err)
+	}
+	if err := dbTx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox relay: %w", err)
+	}
+	return len(messages), nil
+}
+
+// Backlog returns the number of unsent entries and the age of the oldest
+func (s *Store) Backlog(ctx context.Context) (int64, time.Duration, error) {
+	var depth int64
+	var oldest sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), MIN(created_at) FROM ingestion_outbox WHERE sent_at IS NULL`,
+	).Scan(&depth, &oldest)
+	if err != nil || !oldest.Valid {
+		return depth, 0, err
+	}
+	return depth, time.Since(oldest.Time), nil
+}
+
+// Prune deletes entries that were sent before the cutoff
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM ingestion_outbox WHERE sent_at < $1`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Ping checks that the outbox database is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,270 @@
+//go:build integration
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ingestion-service/internal/models"
+	"ingestion-service/internal/testdb"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// The integration tests run against Postgres in a container, started once
+// for the package, each test on a database of its own:
+//
+//	go test -tags=integration ./internal/outbox/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStore returns an outbox on a new database, closed when the test
+// ends
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := Open(dbURL)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testTransaction(key, accountID string) models.Transaction {
+	return models.Transaction{
+		ID:             "txn-" + key,
+		IdempotencyKey: key,
+		AccountID:      accountID,
+		UserID:         "user-1",
+		Amount:         42.5,
+		Currency:       "USD",
+		Type:           "purchase",
+		Status:         "pending",
+		Timestamp:      time.Now(),
+	}
+}
+
+// collector is a Kafka stand-in recording the messages published to it
+type collector struct {
+	messages []kafka.Message
+}
+
+func (c *collector) publish(_ context.Context, messages []kafka.Message) error {
+	c.messages = append(c.messages, messages...)
+	return nil
+}
+
+// idempotencyKeys returns the idempotency key header of each message
+func idempotencyKeys(messages []kafka.Message) []string {
+	keys := make([]string, len(messages))
+	for i, m := range messages {
+		for _, h := range m.Headers {
+			if h.Key == "idempotency_key" {
+				keys[i] = string(h.Value)
+			}
+		}
+	}
+	return keys
+}
+
+// backlog returns the number of unsent entries in s
+func backlog(t *testing.T, s *Store) int64 {
+	t.Helper()
+	depth, _, err := s.Backlog(context.Background())
+	if err != nil {
+		t.Fatalf("Backlog: %v", err)
+	}
+	return depth
+}
+
+func TestPublishBatchIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	if err := s.Publish(ctx, "transactions", testTransaction("key-1", "acct-1")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// A key already in the outbox refuses the whole batch
+	batch := []models.Transaction{testTransaction("key-2", "acct-1"), testTransaction("key-1", "acct-1")}
+	if err := s.PublishBatch(ctx, "transactions", batch); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("PublishBatch = %v, want %v", err, ErrDuplicate)
+	}
+	if depth := backlog(t, s); depth != 1 {
+		t.Errorf("backlog %d, want only the first transaction", depth)
+	}
+
+	if err := s.PublishBatch(ctx, "transactions", batch[:1]); err != nil {
+		t.Errorf("PublishBatch of the refused transaction = %v", err)
+	}
+	if depth, oldest, err := s.Backlog(ctx); err != nil || depth != 2 || oldest <= 0 || oldest > time.Minute {
+		t.Errorf("Backlog = %d, %s, %v, want 2 entries just accepted", depth, oldest, err)
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	accounts := []string{"acct-1", "acct-2", "acct-1", "acct-1", "acct-2"}
+	for i, account := range accounts {
+		if err := s.Publish(ctx, "transactions", testTransaction(fmt.Sprintf("key-%d", i), account)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	broker := &collector{}
+	if n, err := s.Relay(ctx, 3, broker.publish); err != nil || n != 3 {
+		t.Fatalf("Relay = %d, %v, want 3", n, err)
+	}
+	if n, err := s.Relay(ctx, 3, broker.publish); err != nil || n != 2 {
+		t.Fatalf("Relay = %d, %v, want the other 2", n, err)
+	}
+	if n, err := s.Relay(ctx, 3, broker.publish); err != nil || n != 0 {
+		t.Errorf("Relay of an empty outbox = %d, %v", n, err)
+	}
+
+	keys := idempotencyKeys(broker.messages)
+	for i, m := range broker.messages {
+		if want := fmt.Sprintf("key-%d", i); keys[i] != want || string(m.Key) != accounts[i] || m.Topic != "transactions" {
+			t.Errorf("message %d is %s of %s on %s, want %s of %s", i, keys[i], m.Key, m.Topic, want, accounts[i])
+		}
+		var txn models.Transaction
+		if err := json.Unmarshal(m.Value, &txn); err != nil || txn.IdempotencyKey != keys[i] {
+			t.Errorf("message %d carries %+v, %v", i, txn, err)
+		}
+	}
+	if depth := backlog(t, s); depth != 0 {
+		t.Errorf("backlog %d after relaying everything", depth)
+	}
+}
+
+func TestRelayCrashBeforePublishLosesNothing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	for i := range 3 {
+		if err := s.Publish(ctx, "transactions", testTransaction(fmt.Sprintf("key-%d", i), "acct-1")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	// The relay dies after reading the entries, before Kafka has them
+	errKafka := errors.New("kafka: leader not available")
+	if _, err := s.Relay(ctx, 10, func(context.Context, []kafka.Message) error { return errKafka }); !errors.Is(err, errKafka) {
+		t.Fatalf("Relay = %v, want %v", err, errKafka)
+	}
+	if depth := backlog(t, s); depth != 3 {
+		t.Fatalf("backlog %d, want every entry kept", depth)
+	}
+
+	broker := &collector{}
+	if n, err := s.Relay(ctx, 10, broker.publish); err != nil || n != 3 {
+		t.Fatalf("Relay after the restart = %d, %v, want 3", n, err)
+	}
+	if keys := idempotencyKeys(broker.messages); len(keys) != 3 || keys[0] != "key-0" || keys[2] != "key-2" {
+		t.Errorf("published %v, want each entry once, in order", keys)
+	}
+}
+
+func TestRelayCrashAfterPublishRepublishesTheSameEntries(t *testing.T) {
+	s := newTestStore(t)
+	for i := range 3 {
+		if err := s.Publish(context.Background(), "transactions", testTransaction(fmt.Sprintf("key-%d", i), "acct-1")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	// The relay dies once Kafka has the entries, before marking them sent
+	broker := &collector{}
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := s.Relay(ctx, 10, func(ctx context.Context, messages []kafka.Message) error {
+		defer cancel()
+		return broker.publish(ctx, messages)
+	})
+	if err == nil {
+		t.Fatal("Relay succeeded without marking the entries sent")
+	}
+	if depth := backlog(t, s); depth != 3 {
+		t.Fatalf("backlog %d, want the unmarked entries kept", depth)
+	}
+
+	if n, err := s.Relay(context.Background(), 10, broker.publish); err != nil || n != 3 {
+		t.Fatalf("Relay after the restart = %d, %v, want 3", n, err)
+	}
+	if depth := backlog(t, s); depth != 0 {
+		t.Errorf("backlog %d once relayed", depth)
+	}
+
+	// Delivery is at least once: the repeats carry the idempotency keys and
+	// transaction IDs consumers drop them by, so no transaction is lost or
+	// counted twice
+	seen := make(map[string]int)
+	for _, key := range idempotencyKeys(broker.messages) {
+		seen[key]++
+	}
+	if len(broker.messages) != 6 || len(seen) != 3 {
+		t.Fatalf("published %v, want the 3 entries twice", seen)
+	}
+	for key, n := range seen {
+		if n != 2 {
+			t.Errorf("%s published %d times, want 2", key, n)
+		}
+	}
+	for i := range 3 {
+		if first, again := broker.messages[i], broker.messages[i+3]; string(first.Value) != string(again.Value) {
+			t.Errorf("entry %d republished as %s, was %s", i, again.Value, first.Value)
+		}
+	}
+}
+
+func TestOneRelayAtATime(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	if err := s.Publish(ctx, "transactions", testTransaction("key-1", "acct-1")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// A second relay while the first is publishing finds the lock held
+	var concurrent int
+	n, err := s.Relay(ctx, 10, func(ctx context.Context, _ []kafka.Message) error {
+		var err error
+		concurrent, err = s.Relay(ctx, 10, (&collector{}).publish)
+		return err
+	})
+	if err != nil || n != 1 || concurrent != 0 {
+		t.Errorf("Relay = %d, %v with %d relayed concurrently, want 1 and 0", n, err, concurrent)
+	}
+}
+
+func TestPruneDeletesSentEntries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	for _, key := range []string{"key-1", "key-2"} {
+		if err := s.Publish(ctx, "transactions", testTransaction(key, "acct-1")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if _, err := s.Relay(ctx, 1, (&collector{}).publish); err != nil {
+		t.Fatalf("Relay: %v", err)
+	}
+
+	if n, err := s.Prune(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Prune before the entry was sent = %d, %v", n, err)
+	}
+	if n, err := s.Prune(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("Prune = %d, %v, want the sent entry", n, err)
+	}
+	if depth := backlog(t, s); depth != 1 {
+		t.Errorf("backlog %d, want the unsent entry kept", depth)
+	}
+	// A pruned key may be accepted again
+	if err := s.Publish(ctx, "transactions", testTransaction("key-1", "acct-1")); err != nil {
+		t.Errorf("Publish of a pruned key = %v", err)
+	}
+}
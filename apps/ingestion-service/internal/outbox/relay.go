@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ingestion-service/internal/middleware"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// pruneInterval is how often sent entries are deleted from the outbox
+const pruneInterval = time.Hour
+
+// Relay moves transactions from the outbox to Kafka
+type Relay struct {
+	store     *Store
+	writer    *kafka.Writer
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+// NewRelay creates a relay polling the outbox every interval. Writes are
+// synchronous and acknowledged by all replicas, because entries are marked
+// sent only once the publish has returned. The dialer carries the TLS and
+// SASL settings.
+func NewRelay(store *Store, brokers string, dialer *kafka.Dialer, interval time.Duration, batchSize int, retention time.Duration) *Relay {
+	return &Relay{
+		store: store,
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      []string{brokers},
+			Dialer:       dialer,
+			Balancer:     &kafka.Hash{}, // Same partitioning as direct mode
+			RequiredAcks: -1,
+			BatchSize:    batchSize,
+		}),
+		interval:  interval,
+		batchSize: batchSize,
+		retention: retention,
+	}
+}
+
+// Run relays the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.drain(ctx)
+
+		if depth, oldest, err := r.store.Backlog(ctx); err == nil {
+			middleware.SetOutboxBacklog(depth, oldest)
+		}
+
+		if time.Since(lastPrune) >= pruneInterval {
+			if _, err := r.store.Prune(ctx, time.Now().Add(-r.retention)); err != nil {
+				log.Printf("outbox prune error: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// drain publishes batches until the outbox is empty or an error occurs
+func (r *Relay) drain(ctx context.Context) {
+	for {
+		n, err := r.store.Relay(ctx, r.batchSize, r.publish)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("outbox relay error: %v", err)
+			}
+			return
+		}
+		if n < r.batchSize {
+			return
+		}
+	}
+}
+
+// publish writes messages to Kafka. They keep the time they were accepted
+// as their timestamp.
+func (r *Relay) publish(ctx context.Context, messages []kafka.Message) error {
+	status := "success"
+	err := r.writer.WriteMessages(ctx, messages...)
+	if err != nil {
+		status = "failed"
+	}
+	for _, m := range messages {
+		middleware.RecordKafkaMessagePublished(m.Topic, status)
+	}
+	return err
+}
+
+// Close shuts down the Kafka writer
+func (r *Relay) Close() error {
+	return r.writer.Close()
+}
@@ -0,0 +1,89 @@
+// Package fake provides an in-memory sink for the ingestion handlers, so
+// they can be exercised without a Kafka broker or outbox database.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ingestion-service/internal/models"
+)
+
+// Message is a transaction accepted by the sink, with its topic
+type Message struct {
+	Topic       string
+	Transaction models.Transaction
+}
+
+// Sink records the transactions it accepts. Err, when set, is returned by
+// every publish instead of recording; Latency delays every publish, which
+// returns early with the context's error when it is cancelled first.
+type Sink struct {
+	Err       error
+	Latency   time.Duration
+	IsDurable bool
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// New creates an empty sink
+func New() *Sink {
+	return &Sink{}
+}
+
+// Publish records a transaction
+func (s *Sink) Publish(ctx context.Context, topic string, transaction models.Transaction) error {
+	return s.PublishBatch(ctx, topic, []models.Transaction{transaction})
+}
+
+// PublishBatch records transactions, all or none
+func (s *Sink) PublishBatch(ctx context.Context, topic string, transactions []models.Transaction) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	for _, transaction := range transactions {
+		s.messages = append(s.messages, Message{Topic: topic, Transaction: transaction})
+	}
+	return nil
+}
+
+// Durable reports IsDurable, so the sink can stand in for the outbox
+func (s *Sink) Durable() bool {
+	return s.IsDurable
+}
+
+// Messages returns the transactions accepted so far, in order
+func (s *Sink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the transactions accepted so far
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+func (s *Sink) wait(ctx context.Context) error {
+	if s.Latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(s.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,113 +4,156 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"ingestion-service/internal/middleware"
 	"ingestion-service/internal/models"
 
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
 	"github.com/segmentio/kafka-go"
 )
 
 // Producer wraps a Kafka writer
 type Producer struct {
-	writer *kafka.Writer
+	writer  *kafka.Writer
+	shedder *middleware.LoadShedder
+	queued  atomic.Int64 // messages written and not yet acknowledged
 }
 
-// NewProducer initializes a new Kafka producer
-func NewProducer(brokers string) (*Producer, error) {
-	writer := kafka.NewWriter(kafka.WriterConfig{
+// NewProducer initializes a new Kafka producer. The dialer carries the TLS
+// and SASL settings, and tuning the compression, batching and
+// acknowledgements. Delivery latencies are reported to shedder, which may be
+// nil.
+func NewProducer(brokers string, dialer *kafka.Dialer, tuning kafkaconn.WriterConfig, shedder *middleware.LoadShedder) (*Producer, error) {
+	writerConfig := kafka.WriterConfig{
 		Brokers:      []string{brokers},
+		Dialer:       dialer,
 		Balancer:     &kafka.Hash{}, // Use hash balancer for partitioning
 		Async:        true,          // Enable async publishing for better performance
 		RequiredAcks: 1,             // Require acknowledgment for reliability
-	})
-	return &Producer{writer: writer}, nil
+	}
+	tuning.Apply(&writerConfig)
+	writer := kafka.NewWriter(writerConfig)
+	log.Printf("Kafka producer: %s", kafkaconn.DescribeWriter(writer))
+
+	p := &Producer{writer: writer, shedder: shedder}
+	writer.Completion = p.delivered
+	return p, nil
+}
+
+// Queued returns the number of messages written and not yet acknowledged
+func (p *Producer) Queued() int64 {
+	return p.queued.Load()
+}
+
+// addQueued counts n messages into the writer's queue, or out of it when
+// negative. The writer reports no queue of its own, so its depth is that of
+// the messages written and not yet acknowledged.
+func (p *Producer) addQueued(n int) {
+	middleware.SetKafkaPublishQueued(p.queued.Add(int64(n)))
 }
 
-// Publish sends a message to the given Kafka topic with account-based partitioning
-func (p *Producer) Publish(topic string, transaction models.Transaction) error {
-	start := time.Now()
+// delivered accounts for messages the writer is done with. The writer is
+// asynchronous, so the publish duration runs from the write until the
+// broker acknowledges the batch.
+func (p *Producer) delivered(messages []kafka.Message, err error) {
+	p.addQueued(-len(messages))
+	if len(messages) == 0 {
+		return
+	}
+
+	latency := time.Since(messages[0].Time)
+	middleware.RecordKafkaPublishDuration(messages[0].Topic, latency)
+	p.shedder.ObservePublish(latency)
+}
 
-	// Serialize the transaction
-	message, err := json.Marshal(transaction)
+// Durable reports whether accepted transactions survive a crash of the
+// service; the producer's are buffered in memory until acknowledged
+func (p *Producer) Durable() bool {
+	return false
+}
+
+// NewMessage serializes a transaction into a Kafka message for topic, keyed
+// by account ID so each account's transactions stay in order
+func NewMessage(topic string, transaction models.Transaction) (kafka.Message, error) {
+	value, err := json.Marshal(transaction)
 	if err != nil {
-		middleware.RecordKafkaMessagePublished(topic, "failed")
-		log.Printf("failed to serialize transaction: %v", err)
-		return err
+		return kafka.Message{}, err
 	}
 
-	// Create Kafka message with account-based partitioning
-	kafkaMessage := kafka.Message{
+	return kafka.Message{
 		Topic: topic,
 		Key:   []byte(transaction.AccountID), // Partition by account ID
-		Value: message,
+		Value: value,
+		Time:  time.Now(),
 		Headers: []kafka.Header{
 			{Key: "idempotency_key", Value: []byte(transaction.IdempotencyKey)},
 			{Key: "user_id", Value: []byte(transaction.UserID)},
 			{Key: "currency", Value: []byte(transaction.Currency)},
 			{Key: "type", Value: []byte(transaction.Type)},
+			{Key: tenant.Header, Value: []byte(transaction.TenantID)},
 		},
+	}, nil
+}
+
+// Publish sends a message to the given Kafka topic with account-based
+// partitioning, giving up when ctx is done
+func (p *Producer) Publish(ctx context.Context, topic string, transaction models.Transaction) error {
+	kafkaMessage, err := NewMessage(topic, transaction)
+	if err != nil {
+		middleware.RecordKafkaMessagePublished(topic, "failed")
+		log.Printf("failed to serialize transaction: %v", err)
+		return err
 	}
 
-	// Publish message
-	err = p.writer.WriteMessages(context.Background(), kafkaMessage)
+	// Publish message. A failed write queued nothing.
+	p.addQueued(1)
+	err = p.writer.WriteMessages(ctx, kafkaMessage)
 
 	// Record metrics
-	duration := time.Since(start)
 	if err != nil {
+		p.addQueued(-1)
 		middleware.RecordKafkaMessagePublished(topic, "failed")
 		log.Printf("failed to publish message to topic %s: %v", topic, err)
 	} else {
 		middleware.RecordKafkaMessagePublished(topic, "success")
 	}
 
-	middleware.RecordKafkaPublishDuration(topic, duration)
 	return err
 }
 
-// PublishBatch publishes multiple messages in a batch for better throughput
-func (p *Producer) PublishBatch(topic string, transactions []models.Transaction) error {
+// PublishBatch publishes multiple messages in a batch for better
+// throughput, giving up when ctx is done
+func (p *Producer) PublishBatch(ctx context.Context, topic string, transactions []models.Transaction) error {
 	if len(transactions) == 0 {
 		return nil
 	}
 
-	start := time.Now()
 	messages := make([]kafka.Message, len(transactions))
-
 	for i, txn := range transactions {
-		message, err := json.Marshal(txn)
+		message, err := NewMessage(topic, txn)
 		if err != nil {
 			log.Printf("failed to serialize transaction %d: %v", i, err)
 			continue
 		}
-
-		messages[i] = kafka.Message{
-			Topic: topic,
-			Key:   []byte(txn.AccountID),
-			Value: message,
-			Headers: []kafka.Header{
-				{Key: "idempotency_key", Value: []byte(txn.IdempotencyKey)},
-				{Key: "user_id", Value: []byte(txn.UserID)},
-				{Key: "currency", Value: []byte(txn.Currency)},
-				{Key: "type", Value: []byte(txn.Type)},
-			},
-		}
+		messages[i] = message
 	}
 
-	// Publish batch
-	err := p.writer.WriteMessages(context.Background(), messages...)
+	// Publish batch. A failed write queued nothing.
+	p.addQueued(len(messages))
+	err := p.writer.WriteMessages(ctx, messages...)
 
 	// Record metrics
-	duration := time.Since(start)
 	if err != nil {
+		p.addQueued(-len(messages))
 		middleware.RecordKafkaMessagePublished(topic, "failed")
 		log.Printf("failed to publish batch to topic %s: %v", topic, err)
 	} else {
 		middleware.RecordKafkaMessagePublished(topic, "success")
 	}
 
-	middleware.RecordKafkaPublishDuration(topic, duration)
 	return err
 }
 
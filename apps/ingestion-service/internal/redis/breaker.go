@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen is returned by the operations of a Client whose breaker is
+// open, without Redis being asked
+var ErrCircuitOpen = errors.New("redis circuit breaker open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+// Breaker states: closed lets every operation through, open refuses them
+// all, half-open lets a single probe through to decide between the two
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig configures the circuit breaker of a Client
+type BreakerConfig struct {
+	// Threshold consecutive failed operations open the breaker, which
+	// stays open for Cooldown before letting a probe through
+	Threshold int
+	Cooldown  time.Duration
+
+	// OpTimeout bounds each operation, well below the connection timeouts
+	// so an unreachable Redis costs a request little
+	OpTimeout time.Duration
+
+	// OnStateChange, when set, is called on each transition, for metrics
+	OnStateChange func(from, to BreakerState)
+}
+
+// breaker is a consecutive-failure circuit breaker
+type breaker struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker creates a closed breaker
+func newBreaker(cfg BreakerConfig) *breaker {
+	return &breaker{cfg: cfg}
+}
+
+// allow reports whether an operation may run. Once the cooldown of an open
+// breaker is over, the first caller is let through as the half-open probe;
+// the others are refused until it reports.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// abandon reports an operation allow let through that ended without an
+// outcome, its caller having given up, freeing the probe slot
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record reports the outcome of an operation allow let through
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.cfg.Threshold {
+		b.open()
+	}
+}
+
+// open opens the breaker for a cooldown
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.transition(BreakerOpen)
+}
+
+// transition moves the breaker to state, logging and reporting the change
+func (b *breaker) transition(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+
+	attrs := []any{"from", from.String(), "to", state.String()}
+	switch state {
+	case BreakerOpen:
+		slog.Warn("redis circuit breaker opened", append(attrs,
+			"consecutive_failures", b.failures, "cooldown", b.cfg.Cooldown)...)
+	case BreakerHalfOpen:
+		slog.Info("redis circuit breaker probing", attrs...)
+	default:
+		slog.Info("redis circuit breaker closed", attrs...)
+	}
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, state)
+	}
+}
+
+// isOpen reports whether the breaker refuses operations
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen && time.Since(b.openedAt) < b.cfg.Cooldown
+}
+
+// do runs an operation through the breaker, bounded by the operation
+// timeout. A missing key is an answer, not a failure, and nor is the end of
+// the caller's own context.
+func (c *Client) do(ctx context.Context, op func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, c.breaker.cfg.OpTimeout)
+	defer cancel()
+	err := op(opCtx)
+
+	if err != nil && ctx.Err() != nil {
+		c.breaker.abandon()
+	} else {
+		c.breaker.record(err != nil && !errors.Is(err, redis.Nil))
+	}
+	return err
+}
+
+// Degraded reports whether the breaker is open, so Redis is being skipped
+func (c *Client) Degraded() bool {
+	return c.breaker.isOpen()
+}
@@ -0,0 +1,200 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+)
+
+// transitions records the state changes of a breaker
+type transitions struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (tr *transitions) record(from, to BreakerState) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.seen = append(tr.seen, from.String()+">"+to.String())
+}
+
+func (tr *transitions) get() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.seen...)
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	tr := &transitions{}
+	b := newBreaker(BreakerConfig{Threshold: 3, Cooldown: time.Minute, OnStateChange: tr.record})
+
+	// A success in between resets the count
+	for _, failed := range []bool{true, true, false, true, true} {
+		if !b.allow() {
+			t.Fatal("closed breaker refused an operation")
+		}
+		b.record(failed)
+	}
+	if b.isOpen() {
+		t.Fatal("breaker opened without 3 consecutive failures")
+	}
+
+	b.allow()
+	b.record(true)
+	if !b.isOpen() || b.allow() {
+		t.Fatal("breaker let operations through after 3 consecutive failures")
+	}
+	if got := tr.get(); len(got) != 1 || got[0] != "closed>open" {
+		t.Errorf("transitions = %v, want closed>open", got)
+	}
+}
+
+func TestBreakerProbesOnceTheCooldownIsOver(t *testing.T) {
+	tests := []struct {
+		name   string
+		failed bool
+		state  BreakerState
+		want   []string
+	}{
+		{"probe succeeding closes it", false, BreakerClosed, []string{"closed>open", "open>half_open", "half_open>closed"}},
+		{"probe failing opens it again", true, BreakerOpen, []string{"closed>open", "open>half_open", "half_open>open"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &transitions{}
+			b := newBreaker(BreakerConfig{Threshold: 1, Cooldown: 20 * time.Millisecond, OnStateChange: tr.record})
+			b.allow()
+			b.record(true)
+			if b.allow() {
+				t.Fatal("open breaker let an operation through")
+			}
+
+			time.Sleep(30 * time.Millisecond)
+			if !b.allow() {
+				t.Fatal("no probe let through after the cooldown")
+			}
+			if b.allow() {
+				t.Fatal("a second operation let through while probing")
+			}
+			b.record(tt.failed)
+
+			if b.state != tt.state {
+				t.Errorf("state after the probe = %s, want %s", b.state, tt.state)
+			}
+			got := tr.get()
+			if len(got) != len(tt.want) {
+				t.Fatalf("transitions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("transitions = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAbandonedProbeFreesTheSlot(t *testing.T) {
+	b := newBreaker(BreakerConfig{Threshold: 1, Cooldown: 10 * time.Millisecond})
+	b.allow()
+	b.record(true)
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("no probe let through after the cooldown")
+	}
+	b.abandon()
+	if !b.allow() {
+		t.Error("probe slot still taken after the probe was abandoned")
+	}
+}
+
+// newBlackholedClient returns a client of a Redis that accepts connections
+// and never answers, as one behind a dropped route would
+func newBlackholedClient(t *testing.T, cfg BreakerConfig) *Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	// NewClient would wait out its ping, so the client is assembled here
+	rdb := redisconn.Config{Mode: redisconn.ModeSingle, Addr: ln.Addr().String()}.NewClient()
+	client := &Client{rdb: rdb, breaker: newBreaker(cfg)}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestBlackholedRedisCostsBoundedLatency(t *testing.T) {
+	const opTimeout = 50 * time.Millisecond
+	client := newBlackholedClient(t, BreakerConfig{Threshold: 3, Cooldown: time.Minute, OpTimeout: opTimeout})
+	ctx := context.Background()
+
+	// Each operation gives up at the operation timeout, not the connection's
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		_, err := client.GetIdempotencyKey(ctx, "key-1")
+		elapsed := time.Since(start)
+		if err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("operation %d = %v, want it to time out", i+1, err)
+		}
+		if elapsed > 10*opTimeout {
+			t.Errorf("operation %d took %v, want about %v", i+1, elapsed, opTimeout)
+		}
+	}
+
+	// Then Redis is skipped without being asked
+	if !client.Degraded() {
+		t.Fatal("client not degraded after 3 timeouts")
+	}
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if _, err := client.GetIdempotencyKey(ctx, "key-1"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("operation with the breaker open = %v, want ErrCircuitOpen", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > opTimeout {
+		t.Errorf("100 operations with the breaker open took %v, want them refused at once", elapsed)
+	}
+}
+
+func TestMissingKeyIsNotAFailure(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.breaker = newBreaker(BreakerConfig{Threshold: 1, Cooldown: time.Minute, OpTimeout: time.Second})
+
+	for i := 0; i < 3; i++ {
+		if data, err := client.GetIdempotencyKey(context.Background(), "missing"); err != nil || data != nil {
+			t.Fatalf("GetIdempotencyKey = %q, %v, want nothing found", data, err)
+		}
+	}
+	if client.Degraded() {
+		t.Error("breaker opened on missing keys")
+	}
+}
@@ -3,49 +3,116 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
 	"github.com/redis/go-redis/v9"
 )
 
-// Client wraps the Redis client
+// Client wraps the Redis client. Its keys are each used alone, so it works
+// against a single node, a Sentinel-managed master or a cluster alike. Its
+// operations run through a circuit breaker, so an unreachable Redis is
+// skipped rather than waited on by every request.
 type Client struct {
-	rdb *redis.Client
+	rdb     redis.UniversalClient
+	breaker *breaker
 }
 
-// NewClient creates a new Redis client
-func NewClient(addr, password string, db int) (*Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-	})
+// NewClient creates a new Redis client in the configured mode
+func NewClient(cfg redisconn.Config, breaker BreakerConfig) (*Client, error) {
+	rdb := cfg.NewClient()
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := rdb.Ping(ctx).Err(); err != nil {
+	if err := redisconn.Ping(ctx, rdb); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &Client{rdb: rdb}, nil
+	return &Client{rdb: rdb, breaker: newBreaker(breaker)}, nil
+}
+
+// Watch pings Redis every interval until ctx is done, calling report with
+// whether it answered and logging each change
+func (c *Client) Watch(ctx context.Context, interval time.Duration, report func(up bool)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	up := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := redisconn.Ping(pingCtx, c.rdb)
+		cancel()
+
+		if healthy := err == nil; healthy != up {
+			up = healthy
+			if up {
+				log.Println("Redis connection restored")
+			} else {
+				log.Printf("Redis connection lost: %v", err)
+			}
+		}
+		report(up)
+	}
+}
+
+// maxUserKeysPage bounds the number of keys returned by one page of
+// ScanUserIdempotencyKeys
+const maxUserKeysPage = 1000
+
+// idempotencyKey returns the Redis key of an idempotency key
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
+
+// userIdempotencyKeys returns the Redis key of the set indexing a user's
+// idempotency keys
+func userIdempotencyKeys(userID string) string {
+	return fmt.Sprintf("idempotency-user:%s", userID)
 }
 
-// SetIdempotencyKey sets an idempotency key with TTL
-func (c *Client) SetIdempotencyKey(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+// SetIdempotencyKey sets an idempotency key with TTL, and indexes it under
+// the user who made the request. The index expires with the user's latest
+// key. The key and the index fall in different hash slots of a cluster, so
+// they are written in one pipeline rather than a transaction; an index entry
+// left behind by a failed write is dropped by ScanUserIdempotencyKeys.
+func (c *Client) SetIdempotencyKey(ctx context.Context, key, userID string, value interface{}, ttl time.Duration) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to marshal value: %w", err)
 	}
 
-	return c.rdb.Set(ctx, fmt.Sprintf("idempotency:%s", key), data, ttl).Err()
+	return c.do(ctx, func(ctx context.Context) error {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, idempotencyKey(key), data, ttl)
+			if userID != "" {
+				pipe.SAdd(ctx, userIdempotencyKeys(userID), key)
+				pipe.Expire(ctx, userIdempotencyKeys(userID), ttl)
+			}
+			return nil
+		})
+		return err
+	})
 }
 
 // GetIdempotencyKey retrieves an idempotency key
 func (c *Client) GetIdempotencyKey(ctx context.Context, key string) ([]byte, error) {
-	data, err := c.rdb.Get(ctx, fmt.Sprintf("idempotency:%s", key)).Bytes()
+	var data []byte
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		data, err = c.rdb.Get(ctx, idempotencyKey(key)).Bytes()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // Key not found
@@ -55,14 +122,250 @@ func (c *Client) GetIdempotencyKey(ctx context.Context, key string) ([]byte, err
 	return data, nil
 }
 
+// IdempotencyKeyTTL returns the time left before an idempotency key expires,
+// zero when it does not exist and -1 when it never expires
+func (c *Client) IdempotencyKeyTTL(ctx context.Context, key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		ttl, err = c.rdb.TTL(ctx, idempotencyKey(key)).Result()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get key TTL: %w", err)
+	}
+	if ttl == -2 {
+		return 0, nil // Key not found
+	}
+	return ttl, nil
+}
+
+// DeleteIdempotencyKey deletes an idempotency key and removes it from the
+// index of userID, in one pipeline as SetIdempotencyKey writes them. It
+// reports whether the key existed.
+func (c *Client) DeleteIdempotencyKey(ctx context.Context, key, userID string) (bool, error) {
+	var deleted *redis.IntCmd
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			deleted = pipe.Del(ctx, idempotencyKey(key))
+			if userID != "" {
+				pipe.SRem(ctx, userIdempotencyKeys(userID), key)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete key: %w", err)
+	}
+	return deleted.Val() > 0, nil
+}
+
+// ScanUserIdempotencyKeys returns a page of the idempotency keys of a user,
+// starting at cursor, and the cursor of the next page, zero after the last.
+// Like SCAN, count is a hint, capped at maxUserKeysPage: Redis returns a
+// small index whole. Keys that have expired are dropped from the index as
+// they are found.
+func (c *Client) ScanUserIdempotencyKeys(ctx context.Context, userID string, cursor uint64, count int64) ([]string, uint64, error) {
+	if count <= 0 || count > maxUserKeysPage {
+		count = maxUserKeysPage
+	}
+
+	var members []string
+	var next uint64
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		members, next, err = c.rdb.SScan(ctx, userIdempotencyKeys(userID), cursor, "", count).Result()
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan user keys: %w", err)
+	}
+	if len(members) == 0 {
+		return []string{}, next, nil
+	}
+
+	exists := make([]*redis.IntCmd, len(members))
+	err = c.do(ctx, func(ctx context.Context) error {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range members {
+				exists[i] = pipe.Exists(ctx, idempotencyKey(key))
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check user keys: %w", err)
+	}
+
+	keys := make([]string, 0, len(members))
+	var expired []interface{}
+	for i, key := range members {
+		if exists[i].Val() > 0 {
+			keys = append(keys, key)
+		} else {
+			expired = append(expired, key)
+		}
+	}
+	if len(expired) > 0 {
+		err := c.do(ctx, func(ctx context.Context) error {
+			return c.rdb.SRem(ctx, userIdempotencyKeys(userID), expired...).Err()
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to drop expired user keys: %w", err)
+		}
+	}
+	return keys, next, nil
+}
+
+// ItemKey is the idempotency key of a transaction in a batch, scoped to the
+// tenant and user of the transaction so that callers reusing a key do not
+// see each other's transactions
+type ItemKey struct {
+	TenantID string
+	UserID   string
+	Key      string
+}
+
+// itemKey returns the Redis key of the idempotency key of a transaction in
+// a batch, holding the ID the transaction was accepted under
+func itemKey(key ItemKey) string {
+	return fmt.Sprintf("idempotency-item:%s:%s:%s", key.TenantID, key.UserID, key.Key)
+}
+
+// LookupItemKeys returns the transaction IDs recorded for the idempotency
+// keys of batch items, by key, in one pipeline. Keys not recorded are left
+// out.
+func (c *Client) LookupItemKeys(ctx context.Context, keys []ItemKey) (map[ItemKey]string, error) {
+	if len(keys) == 0 {
+		return map[ItemKey]string{}, nil
+	}
+
+	gets := make([]*redis.StringCmd, len(keys))
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				gets[i] = pipe.Get(ctx, itemKey(key))
+			}
+			return nil
+		})
+		if err == nil {
+			return nil
+		}
+		// Keys not found fail their command, not the lookup; an unreachable
+		// Redis may fail the pipeline without failing any command
+		if !errors.Is(err, redis.Nil) {
+			return err
+		}
+		for _, get := range gets {
+			if err := get.Err(); err != nil && err != redis.Nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up item keys: %w", err)
+	}
+
+	ids := make(map[ItemKey]string)
+	for i, key := range keys {
+		if id, err := gets[i].Result(); err == nil {
+			ids[key] = id
+		}
+	}
+	return ids, nil
+}
+
+// RecordItemKeys records the transaction ID each batch item idempotency key
+// was accepted under, for ttl, in one pipeline
+func (c *Client) RecordItemKeys(ctx context.Context, ids map[ItemKey]string, ttl time.Duration) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for key, id := range ids {
+				pipe.Set(ctx, itemKey(key), id, ttl)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record item keys: %w", err)
+	}
+	return nil
+}
+
+// contentHashKey returns the Redis key of a transaction content hash
+func contentHashKey(hash string) string {
+	return fmt.Sprintf("content:%s", hash)
+}
+
+// ClaimContentHash records transactionID as the first transaction with the
+// content hash for ttl. If another transaction claimed it first and its claim
+// has not expired, that transaction's ID is returned instead.
+func (c *Client) ClaimContentHash(ctx context.Context, hash, transactionID string, ttl time.Duration) (string, error) {
+	var claimed bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		claimed, err = c.rdb.SetNX(ctx, contentHashKey(hash), transactionID, ttl).Result()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to claim content hash: %w", err)
+	}
+	if claimed {
+		return "", nil
+	}
+	var first string
+	err = c.do(ctx, func(ctx context.Context) (err error) {
+		first, err = c.rdb.Get(ctx, contentHashKey(hash)).Result()
+		return err
+	})
+	if err == redis.Nil {
+		// The claim expired in between; the next transaction claims it
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get content hash: %w", err)
+	}
+	return first, nil
+}
+
+// releaseContentHash deletes a content hash claim if transactionID holds it
+var releaseContentHash = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ReleaseContentHash drops the claim of transactionID on the content hash,
+// leaving a claim made by another transaction in place
+func (c *Client) ReleaseContentHash(ctx context.Context, hash, transactionID string) error {
+	err := c.do(ctx, func(ctx context.Context) error {
+		return releaseContentHash.Run(ctx, c.rdb, []string{contentHashKey(hash)}, transactionID).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release content hash: %w", err)
+	}
+	return nil
+}
+
 // SetAccountBalance sets account balance cache
 func (c *Client) SetAccountBalance(ctx context.Context, accountID string, balance float64, ttl time.Duration) error {
-	return c.rdb.Set(ctx, fmt.Sprintf("balance:%s", accountID), balance, ttl).Err()
+	return c.do(ctx, func(ctx context.Context) error {
+		return c.rdb.Set(ctx, fmt.Sprintf("balance:%s", accountID), balance, ttl).Err()
+	})
 }
 
 // GetAccountBalance retrieves account balance from cache
 func (c *Client) GetAccountBalance(ctx context.Context, accountID string) (float64, error) {
-	balance, err := c.rdb.Get(ctx, fmt.Sprintf("balance:%s", accountID)).Float64()
+	var balance float64
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		balance, err = c.rdb.Get(ctx, fmt.Sprintf("balance:%s", accountID)).Float64()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return 0, nil // No cached balance
@@ -72,6 +375,93 @@ func (c *Client) GetAccountBalance(ctx context.Context, accountID string) (float
 	return balance, nil
 }
 
+// authFailuresKey and authLockoutKey return the Redis keys counting the
+// authentication failures of a subject and marking it locked out. The
+// subject is hash-tagged so both keys fall in the same cluster slot.
+func authFailuresKey(subject string) string {
+	return fmt.Sprintf("auth-failures:{%s}", subject)
+}
+
+func authLockoutKey(subject string) string {
+	return fmt.Sprintf("auth-lockout:{%s}", subject)
+}
+
+// recordAuthFailure counts a failure of the subject in a window starting at
+// its first failure, and once the count reaches the threshold locks the
+// subject out for the cooldown and starts counting afresh
+var recordAuthFailure = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+if count >= tonumber(ARGV[2]) then
+	redis.call("SET", KEYS[2], "1", "PX", ARGV[3])
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// RecordAuthFailure counts an authentication failure of subject within
+// window, and reports whether it reached threshold and locked the subject
+// out for cooldown
+func (c *Client) RecordAuthFailure(ctx context.Context, subject string, window time.Duration, threshold int64, cooldown time.Duration) (bool, error) {
+	var locked int
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		locked, err = recordAuthFailure.Run(ctx, c.rdb, []string{authFailuresKey(subject), authLockoutKey(subject)},
+			window.Milliseconds(), threshold, cooldown.Milliseconds()).Int()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to record auth failure: %w", err)
+	}
+	return locked == 1, nil
+}
+
+// AuthLockout returns how long subject remains locked out, zero when it is
+// not
+func (c *Client) AuthLockout(ctx context.Context, subject string) (time.Duration, error) {
+	var ttl time.Duration
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		ttl, err = c.rdb.PTTL(ctx, authLockoutKey(subject)).Result()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get auth lockout: %w", err)
+	}
+	// PTTL is negative for a missing key
+	return max(ttl, 0), nil
+}
+
+// countRequest counts a request in a window starting at the first request,
+// returning the count and the milliseconds left in the window
+var countRequest = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// CountRequest counts a request under key in a fixed window starting at the
+// first request, returning the count so far and the time left in the window
+func (c *Client) CountRequest(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	var result []int64
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		result, err = countRequest.Run(ctx, c.rdb, []string{requestCountKey(key)}, window.Milliseconds()).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count request: %w", err)
+	}
+	return result[0], time.Duration(max(result[1], 0)) * time.Millisecond, nil
+}
+
+// requestCountKey returns the Redis key counting the requests under key
+func requestCountKey(key string) string {
+	return fmt.Sprintf("request-count:%s", key)
+}
+
 // Close closes the Redis client
 func (c *Client) Close() error {
 	return c.rdb.Close()
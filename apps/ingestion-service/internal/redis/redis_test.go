@@ -0,0 +1,313 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient returns a client of an in-memory Redis, closed when the
+// test ends
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := NewClient(redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		BreakerConfig{Threshold: 5, Cooldown: time.Minute, OpTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+// userKey returns key of user-1 in tenant unit-a
+func userKey(key string) ItemKey {
+	return ItemKey{TenantID: "unit-a", UserID: "user-1", Key: key}
+}
+
+func TestItemKeys(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if err := client.RecordItemKeys(ctx, map[ItemKey]string{userKey("key-1"): "txn-1"}, time.Hour); err != nil {
+		t.Fatalf("RecordItemKeys: %v", err)
+	}
+	seen, err := client.LookupItemKeys(ctx, []ItemKey{userKey("key-1"), userKey("key-2")})
+	if err != nil {
+		t.Fatalf("LookupItemKeys: %v", err)
+	}
+	if len(seen) != 1 || seen[userKey("key-1")] != "txn-1" {
+		t.Errorf("seen = %v, want key-1 alone", seen)
+	}
+}
+
+func TestItemKeysAreScopedToTheCaller(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if err := client.RecordItemKeys(ctx, map[ItemKey]string{userKey("key-1"): "txn-1"}, time.Hour); err != nil {
+		t.Fatalf("RecordItemKeys: %v", err)
+	}
+	others := []ItemKey{
+		{TenantID: "unit-b", UserID: "user-1", Key: "key-1"},
+		{TenantID: "unit-a", UserID: "user-2", Key: "key-1"},
+		{Key: "key-1"},
+	}
+	seen, err := client.LookupItemKeys(ctx, others)
+	if err != nil {
+		t.Fatalf("LookupItemKeys: %v", err)
+	}
+	if len(seen) != 0 {
+		t.Errorf("seen = %v, want the key of user-1 in unit-a hidden from other callers", seen)
+	}
+}
+
+// roundTrips counts the round trips to Redis: single commands and
+// pipelines, with the commands of each pipeline
+type roundTrips struct {
+	mu        sync.Mutex
+	commands  int
+	pipelines []int
+}
+
+func (r *roundTrips) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (r *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		r.mu.Lock()
+		r.commands++
+		r.mu.Unlock()
+		return next(ctx, cmd)
+	}
+}
+
+func (r *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		r.mu.Lock()
+		r.pipelines = append(r.pipelines, len(cmds))
+		r.mu.Unlock()
+		return next(ctx, cmds)
+	}
+}
+
+// counts returns the single commands and the sizes of the pipelines sent
+// since the last call
+func (r *roundTrips) counts() (int, []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	commands, pipelines := r.commands, r.pipelines
+	r.commands, r.pipelines = 0, nil
+	return commands, pipelines
+}
+
+func TestItemKeysArePipelined(t *testing.T) {
+	client, mr := newTestClient(t)
+	trips := &roundTrips{}
+	client.rdb.AddHook(trips)
+	ctx := context.Background()
+
+	ids := make(map[ItemKey]string, 50)
+	keys := make([]ItemKey, 0, 100)
+	for i := 0; i < 100; i++ {
+		key := userKey(fmt.Sprintf("key-%d", i))
+		keys = append(keys, key)
+		if i%2 == 0 {
+			ids[key] = fmt.Sprintf("txn-%d", i)
+		}
+	}
+
+	if err := client.RecordItemKeys(ctx, ids, time.Hour); err != nil {
+		t.Fatalf("RecordItemKeys: %v", err)
+	}
+	if commands, pipelines := trips.counts(); commands != 0 || len(pipelines) != 1 || pipelines[0] != 50 {
+		t.Errorf("recording sent %d commands and pipelines of %v, want one pipeline of 50", commands, pipelines)
+	}
+	if ttl := mr.TTL("idempotency-item:unit-a:user-1:key-0"); ttl != time.Hour {
+		t.Errorf("item key TTL = %s, want 1h", ttl)
+	}
+
+	seen, err := client.LookupItemKeys(ctx, keys)
+	if err != nil {
+		t.Fatalf("LookupItemKeys: %v", err)
+	}
+	if commands, pipelines := trips.counts(); commands != 0 || len(pipelines) != 1 || pipelines[0] != 100 {
+		t.Errorf("lookup sent %d commands and pipelines of %v, want one pipeline of 100", commands, pipelines)
+	}
+	if len(seen) != 50 || seen[userKey("key-0")] != "txn-0" || seen[userKey("key-98")] != "txn-98" || seen[userKey("key-1")] != "" {
+		t.Errorf("seen %d keys, key-0 as %q, want the 50 recorded ones", len(seen), seen[userKey("key-0")])
+	}
+
+	// Nothing to look up or record costs no round trip
+	if _, err := client.LookupItemKeys(ctx, nil); err != nil {
+		t.Fatalf("LookupItemKeys: %v", err)
+	}
+	if err := client.RecordItemKeys(ctx, nil, time.Hour); err != nil {
+		t.Fatalf("RecordItemKeys: %v", err)
+	}
+	if commands, pipelines := trips.counts(); commands != 0 || len(pipelines) != 0 {
+		t.Errorf("empty batch sent %d commands and %d pipelines, want none", commands, len(pipelines))
+	}
+}
+
+func TestLookupItemKeysFailsWhileRedisIsDown(t *testing.T) {
+	client, mr := newTestClient(t)
+	mr.Close()
+
+	seen, err := client.LookupItemKeys(context.Background(), []ItemKey{userKey("key-1"), userKey("key-2")})
+	if err == nil {
+		t.Errorf("lookup succeeded with %v, want it failed rather than every key found", seen)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	client, mr := newTestClient(t)
+	ctx := context.Background()
+
+	if err := client.SetIdempotencyKey(ctx, "key-1", "user-1", map[string]string{"id": "txn-1"}, time.Hour); err != nil {
+		t.Fatalf("SetIdempotencyKey: %v", err)
+	}
+	data, err := client.GetIdempotencyKey(ctx, "key-1")
+	if err != nil || string(data) != `{"id":"txn-1"}` {
+		t.Errorf("GetIdempotencyKey = %s, %v", data, err)
+	}
+	if ttl, err := client.IdempotencyKeyTTL(ctx, "key-1"); err != nil || ttl != time.Hour {
+		t.Errorf("IdempotencyKeyTTL = %s, %v, want 1h", ttl, err)
+	}
+	if ok, _ := mr.SIsMember("idempotency-user:user-1", "key-1"); !ok {
+		t.Error("key not indexed under its user")
+	}
+
+	// Missing keys have no entry and no TTL, and keys without one report -1
+	if data, err := client.GetIdempotencyKey(ctx, "key-2"); data != nil || err != nil {
+		t.Errorf("GetIdempotencyKey of a missing key = %s, %v", data, err)
+	}
+	if ttl, err := client.IdempotencyKeyTTL(ctx, "key-2"); ttl != 0 || err != nil {
+		t.Errorf("IdempotencyKeyTTL of a missing key = %s, %v", ttl, err)
+	}
+	mr.Set("idempotency:key-3", "{}")
+	if ttl, err := client.IdempotencyKeyTTL(ctx, "key-3"); ttl != -1 || err != nil {
+		t.Errorf("IdempotencyKeyTTL without expiry = %s, %v, want -1", ttl, err)
+	}
+
+	if deleted, err := client.DeleteIdempotencyKey(ctx, "key-1", "user-1"); !deleted || err != nil {
+		t.Errorf("DeleteIdempotencyKey = %v, %v, want deleted", deleted, err)
+	}
+	if mr.Exists("idempotency:key-1") {
+		t.Error("key still cached after delete")
+	}
+	if ok, _ := mr.SIsMember("idempotency-user:user-1", "key-1"); ok {
+		t.Error("key still indexed after delete")
+	}
+	if deleted, err := client.DeleteIdempotencyKey(ctx, "key-1", "user-1"); deleted || err != nil {
+		t.Errorf("second DeleteIdempotencyKey = %v, %v, want nothing deleted", deleted, err)
+	}
+}
+
+func TestScanUserIdempotencyKeys(t *testing.T) {
+	client, mr := newTestClient(t)
+	ctx := context.Background()
+
+	const n = 300
+	for i := 0; i < n; i++ {
+		if err := client.SetIdempotencyKey(ctx, fmt.Sprintf("key-%03d", i), "user-1", "{}", time.Hour); err != nil {
+			t.Fatalf("SetIdempotencyKey: %v", err)
+		}
+	}
+	if err := client.SetIdempotencyKey(ctx, "other", "user-2", "{}", time.Hour); err != nil {
+		t.Fatalf("SetIdempotencyKey: %v", err)
+	}
+	seen := make(map[string]bool)
+	var cursor uint64
+	for pages := 0; ; pages++ {
+		if pages > n {
+			t.Fatal("scan did not finish")
+		}
+		keys, next, err := client.ScanUserIdempotencyKeys(ctx, "user-1", cursor, 50)
+		if err != nil {
+			t.Fatalf("ScanUserIdempotencyKeys: %v", err)
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != n || seen["other"] {
+		t.Errorf("scanned %d keys, want the user's %d", len(seen), n)
+	}
+
+	// An index entry whose key expired is dropped as it is found
+	mr.Del("idempotency:other")
+	keys, _, err := client.ScanUserIdempotencyKeys(ctx, "user-2", 0, 50)
+	if err != nil || len(keys) != 0 {
+		t.Errorf("scan of an expired key = %v, %v, want none", keys, err)
+	}
+	if ok, _ := mr.SIsMember("idempotency-user:user-2", "other"); ok {
+		t.Error("expired key still indexed")
+	}
+
+	keys, next, err := client.ScanUserIdempotencyKeys(ctx, "user-3", 0, 50)
+	if err != nil || keys == nil || len(keys) != 0 || next != 0 {
+		t.Errorf("scan of a user without keys = %v, %d, %v, want an empty page", keys, next, err)
+	}
+}
+
+func TestAccountBalance(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if balance, err := client.GetAccountBalance(ctx, "acct-1"); balance != 0 || err != nil {
+		t.Errorf("GetAccountBalance of an uncached balance = %v, %v, want 0", balance, err)
+	}
+	if err := client.SetAccountBalance(ctx, "acct-1", 1250.75, time.Hour); err != nil {
+		t.Fatalf("SetAccountBalance: %v", err)
+	}
+	if balance, err := client.GetAccountBalance(ctx, "acct-1"); balance != 1250.75 || err != nil {
+		t.Errorf("GetAccountBalance = %v, %v, want 1250.75", balance, err)
+	}
+}
+
+func TestWatchReportsConnectionChanges(t *testing.T) {
+	client, mr := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reports := make(chan bool, 100)
+	go client.Watch(ctx, 10*time.Millisecond, func(up bool) { reports <- up })
+
+	// await waits for a report of up, failing the test after a few seconds
+	await := func(up bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case got := <-reports:
+				if got == up {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Redis never reported up=%v", up)
+			}
+		}
+	}
+	await(true)
+	mr.Close()
+	await(false)
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	await(true)
+}
@@ -0,0 +1,164 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The Sentinel test runs a master, a replica and a sentinel in a container
+// and fails the master over:
+//
+//	go test -tags=integration ./internal/redis/
+
+// sentinelMaster is the name the sentinel monitors the master under
+const sentinelMaster = "mymaster"
+
+// freePort returns a TCP port free on localhost
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// sentinelSetup is a master, its replica and the sentinel monitoring them.
+// Each listens in the container on the port it is published on, so the
+// addresses the sentinel hands out reach them from the host.
+type sentinelSetup struct {
+	master, replica, sentinel string
+}
+
+func startSentinel(t *testing.T) sentinelSetup {
+	t.Helper()
+	ctx := context.Background()
+	master, replica, sentinel := freePort(t), freePort(t), freePort(t)
+
+	script := fmt.Sprintf(`
+redis-server --port %[1]d --save '' --replica-announce-ip 127.0.0.1 --daemonize yes
+redis-server --port %[2]d --save '' --replica-announce-ip 127.0.0.1 --replicaof 127.0.0.1 %[1]d --daemonize yes
+cat > /tmp/sentinel.conf <<EOF
+port %[3]d
+sentinel announce-ip 127.0.0.1
+sentinel monitor %[4]s 127.0.0.1 %[1]d 1
+sentinel down-after-milliseconds %[4]s 1000
+sentinel failover-timeout %[4]s 5000
+EOF
+exec redis-sentinel /tmp/sentinel.conf`, master, replica, sentinel, sentinelMaster)
+
+	ports := []int{master, replica, sentinel}
+	exposed := make([]string, len(ports))
+	for i, port := range ports {
+		exposed[i] = strconv.Itoa(port) + "/tcp"
+	}
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "redis:7-alpine",
+			Entrypoint:   []string{"sh", "-c", script},
+			ExposedPorts: exposed,
+			HostConfigModifier: func(hc *container.HostConfig) {
+				hc.PortBindings = network.PortMap{}
+				for _, port := range ports {
+					p := network.MustParsePort(strconv.Itoa(port) + "/tcp")
+					hc.PortBindings[p] = []network.PortBinding{{HostIP: netip.MustParseAddr("127.0.0.1"), HostPort: strconv.Itoa(port)}}
+				}
+			},
+			// The sentinel can fail over once it has found the replica
+			WaitingFor: wait.ForLog("+slave slave").WithStartupTimeout(time.Minute),
+		},
+		Started: true,
+	})
+	testcontainers.CleanupContainer(t, c)
+	if err != nil {
+		t.Fatalf("failed to start sentinel: %v", err)
+	}
+
+	addr := func(port int) string { return "127.0.0.1:" + strconv.Itoa(port) }
+	return sentinelSetup{master: addr(master), replica: addr(replica), sentinel: addr(sentinel)}
+}
+
+// eventually checks condition until it holds, failing the test after timeout
+func eventually(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestSentinelFailover(t *testing.T) {
+	setup := startSentinel(t)
+	ctx := context.Background()
+
+	client, err := NewClient(redisconn.Config{
+		Mode:          redisconn.ModeSentinel,
+		MasterName:    sentinelMaster,
+		SentinelAddrs: []string{setup.sentinel},
+	}, BreakerConfig{Threshold: 5, Cooldown: 100 * time.Millisecond, OpTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetIdempotencyKey(ctx, "key-1", "user-1", map[string]string{"id": "txn-1"}, time.Hour); err != nil {
+		t.Fatalf("SetIdempotencyKey: %v", err)
+	}
+	if err := client.SetAccountBalance(ctx, "acct-1", 100, time.Hour); err != nil {
+		t.Fatalf("SetAccountBalance: %v", err)
+	}
+
+	// Wait for the replica to hold the keys before promoting it
+	replica := redis.NewClient(&redis.Options{Addr: setup.replica})
+	defer replica.Close()
+	eventually(t, 10*time.Second, "the keys to replicate", func() bool {
+		n, err := replica.Exists(ctx, idempotencyKey("key-1"), "balance:acct-1").Result()
+		return err == nil && n == 2
+	})
+
+	sentinel := redis.NewSentinelClient(&redis.Options{Addr: setup.sentinel})
+	defer sentinel.Close()
+	if err := sentinel.Failover(ctx, sentinelMaster).Err(); err != nil {
+		t.Fatalf("SENTINEL FAILOVER: %v", err)
+	}
+	eventually(t, 30*time.Second, "the replica to be promoted", func() bool {
+		addr, err := sentinel.GetMasterAddrByName(ctx, sentinelMaster).Result()
+		return err == nil && net.JoinHostPort(addr[0], addr[1]) == setup.replica
+	})
+
+	// The same client follows the new master, without a restart, for
+	// writes as well as reads
+	eventually(t, 30*time.Second, "writes to reach the new master", func() bool {
+		return client.SetIdempotencyKey(ctx, "key-2", "user-1", map[string]string{"id": "txn-2"}, time.Hour) == nil
+	})
+	if n, err := replica.Exists(ctx, idempotencyKey("key-2")).Result(); err != nil || n != 1 {
+		t.Errorf("key written after the failover not on the new master: %d, %v", n, err)
+	}
+	if data, err := client.GetIdempotencyKey(ctx, "key-1"); err != nil || string(data) != `{"id":"txn-1"}` {
+		t.Errorf("GetIdempotencyKey after the failover = %s, %v", data, err)
+	}
+	if balance, err := client.GetAccountBalance(ctx, "acct-1"); err != nil || balance != 100 {
+		t.Errorf("GetAccountBalance after the failover = %v, %v, want 100", balance, err)
+	}
+	if err := redisconn.Ping(ctx, client.rdb); err != nil {
+		t.Errorf("Ping after the failover: %v", err)
+	}
+}
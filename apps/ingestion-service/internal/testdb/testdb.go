@@ -0,0 +1,96 @@
+//go:build integration
+
+// Package testdb runs Postgres in a container for the integration tests of
+// a package, started once for the package, each test on a database of its
+// own:
+//
+//	func TestMain(m *testing.M) {
+//		testdb.Main(m)
+//	}
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// serverURL is the URL of the container's default database
+var serverURL string
+
+// databases numbers the databases created by the tests
+var databases atomic.Int64
+
+// Main starts Postgres, runs the tests and exits with their result
+func Main(m *testing.M) {
+	stop := Start()
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// Start starts Postgres in a container, exiting when it cannot, and returns
+// a function terminating it. It serves packages whose TestMain starts other
+// containers too.
+func Start() (stop func()) {
+	ctx := context.Background()
+	container, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("outbox"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		postgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		log.Fatalf("failed to start postgres: %v", err)
+	}
+	serverURL, err = container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Fatalf("failed to get postgres URL: %v", err)
+	}
+	return func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			log.Printf("failed to terminate postgres: %v", err)
+		}
+	}
+}
+
+// URL returns the URL of the container's default database
+func URL() string {
+	return serverURL
+}
+
+// New creates a new database in the container and returns its URL
+func New(t *testing.T) string {
+	t.Helper()
+	return Create(t, serverURL)
+}
+
+// Create creates a new database on the server of dbURL and returns its URL
+func Create(t *testing.T, dbURL string) string {
+	t.Helper()
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	defer admin.Close()
+
+	name := fmt.Sprintf("test_%d", databases.Add(1))
+	if _, err := admin.Exec(`CREATE DATABASE ` + name); err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("failed to parse postgres URL: %v", err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
@@ -0,0 +1,836 @@
+// Package app runs the processing service. Its main package and the
+// end-to-end tests start it through Run.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"processing-service/internal/accounts"
+	"processing-service/internal/audit"
+	"processing-service/internal/blocklist"
+	"processing-service/internal/config"
+	"processing-service/internal/countries"
+	"processing-service/internal/dailytotals"
+	"processing-service/internal/devices"
+	"processing-service/internal/exactlyonce"
+	"processing-service/internal/merchants"
+	"processing-service/internal/processor"
+	"processing-service/internal/publisher"
+	"processing-service/internal/recurrence"
+	"processing-service/internal/storageapi"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/startup"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+// serviceName identifies the service in logs and build information
+const serviceName = "processing-service"
+
+// Config is the configuration of the service
+type Config = config.Config
+
+// LoadConfig loads the configuration from the environment and validates it
+func LoadConfig() (*Config, error) {
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Run waits for Kafka, then consumes, decides and publishes transactions
+// until ctx is done or the process is signalled, and shuts down in order.
+// It returns the errors of a failed start or an unclean shutdown.
+func Run(ctx context.Context, cfg *Config) error {
+	logger := slog.Default()
+
+	// Initialize Prometheus metrics
+	initMetrics()
+
+	// Components register as they are created, to be stopped in order on
+	// shutdown
+	lc := lifecycle.New(time.Duration(cfg.ShutdownDeadline)*time.Second, logger)
+
+	// Build the Kafka connection settings, failing on bad TLS or SASL config
+	kafkaConn, err := cfg.KafkaSecurity.Connect()
+	if err != nil {
+		return fmt.Errorf("invalid Kafka security config: %w", err)
+	}
+
+	// Wait for Kafka, which may still be starting
+	err = startup.Wait(ctx, time.Duration(cfg.StartupTimeout)*time.Second, logger,
+		startup.Check{Name: "kafka", Probe: func(ctx context.Context) error {
+			return kafkaConn.Ping(ctx, consumer.ParseBrokers(cfg.KafkaBrokers))
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	// Create the topics the service produces to with their partitions,
+	// replication and retention, when provisioning is enabled
+	provisionCtx, cancelProvision := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout)*time.Second)
+	err = cfg.KafkaTopics.ProvisionTopics(provisionCtx, kafkaConn, consumer.ParseBrokers(cfg.KafkaBrokers), cfg.OutputTopics(), logger)
+	cancelProvision()
+	if err != nil {
+		return fmt.Errorf("failed to provision Kafka topics: %w", err)
+	}
+
+	// Setup fault injection, a no-op unless enabled
+	chaosInjector := chaos.New(cfg.ChaosEnabled, chaosMetrics{})
+	if cfg.ChaosEnabled {
+		log.Println("Warning: CHAOS_ENABLED is set, faults can be injected into Kafka")
+	}
+
+	// Create publisher for processed transactions
+	pub := publisher.NewPublisher(cfg.KafkaBrokers, cfg.OutputTopic, kafkaConn.Dialer, cfg.KafkaWriter, chaosInjector, cfg.ExactlyOnce)
+	lc.Add(lifecycle.Closer("kafka publisher", lifecycle.Producers, pub.Close))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "processing_kafka_writer_queued_messages",
+			Help: "Number of messages written to the Kafka publisher and not yet acknowledged",
+		},
+		func() float64 { return float64(pub.Queued()) },
+	))
+
+	// Look up the refunded transactions of refunds and the blocklist in the
+	// storage API
+	var parents processor.ParentLookup
+	var blocklistSource blocklist.Source
+	if cfg.StorageAPIURL != "" {
+		storageAPI := storageapi.NewClient(cfg.StorageAPIURL, cfg.StorageAPIToken,
+			time.Duration(cfg.StorageAPITimeout)*time.Millisecond)
+		parents, blocklistSource = storageAPI, storageAPI
+	} else {
+		log.Println("STORAGE_API_URL is not set, refunds are not checked against their parent and only the configured blocklist applies")
+	}
+	blocked := blocklist.New(cfg.BlockedCountries, cfg.BlockedMerchants, blocklistSource, blocklistMetrics{})
+
+	// Track the devices of users, the countries of accounts and their
+	// recurring charges, and read the account statuses the storage service
+	// caches, in Redis when configured
+	var deviceHistory *devices.History
+	var processorDevices processor.DeviceHistory
+	var processorCountries processor.CountryHistory
+	var processorAccounts processor.AccountStatuses
+	var processorRecurrence processor.RecurrenceHistory
+	var processorTotals processor.DailyTotals
+	if cfg.RedisAddr != "" {
+		redisClient := newRedisClient(cfg)
+		lc.Add(lifecycle.Closer("redis", lifecycle.Stores, redisClient.Close))
+		deviceHistory = devices.NewHistory(redisClient, time.Duration(cfg.DeviceHistoryTTL)*24*time.Hour)
+		processorDevices = deviceHistory
+		processorCountries = countries.NewHistory(redisClient,
+			time.Duration(cfg.CountryHistoryTTL)*24*time.Hour,
+			cfg.CountryMinHistory,
+			time.Duration(cfg.CountrySwitchGap)*time.Minute)
+		processorAccounts = accounts.NewStatuses(redisClient)
+		processorRecurrence = recurrence.NewHistory(redisClient,
+			time.Duration(cfg.RecurrenceHistoryTTL)*24*time.Hour,
+			cfg.RecurrenceMinOccurrences,
+			cfg.RecurrenceCadenceTolerance,
+			cfg.RecurrenceAmountTolerance)
+		processorTotals = dailytotals.New(redisClient)
+	} else {
+		log.Println("REDIS_ADDR is not set, devices, countries, account statuses, recurring charges and daily caps are not checked")
+	}
+
+	// Publish the audit of every decision, off the decision path
+	var auditor processor.DecisionAuditor
+	if cfg.AuditTopic != "" {
+		recorder := audit.New(audit.Config{
+			Brokers:       cfg.KafkaBrokers,
+			Topic:         cfg.AuditTopic,
+			Transport:     kafkaConn.Transport,
+			BufferSize:    cfg.AuditBufferSize,
+			BatchSize:     cfg.AuditBatchSize,
+			FlushInterval: time.Duration(cfg.AuditFlushInterval) * time.Millisecond,
+		}, auditMetrics{})
+		lc.Add(lifecycle.Closer("audit recorder", lifecycle.Producers, recorder.Close))
+		auditor = recorder
+	} else {
+		log.Println("KAFKA_AUDIT_TOPIC is not set, decisions are not audited")
+	}
+
+	// Convert amounts into the base currency of the amount rules
+	rates, err := loadExchangeRates(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Compare a canary rules configuration with the primary one on a sample
+	// of transactions, publishing the comparisons off the decision path
+	canaryRules, err := loadCanaryRules(cfg)
+	if err != nil {
+		return err
+	}
+	canary := processor.CanaryConfig{Rules: canaryRules, Percent: cfg.CanaryPercent}
+	if canary.Rules != nil && cfg.CanaryTopic != "" {
+		recorder := audit.New(audit.Config{
+			Brokers:       cfg.KafkaBrokers,
+			Topic:         cfg.CanaryTopic,
+			Transport:     kafkaConn.Transport,
+			BufferSize:    cfg.AuditBufferSize,
+			BatchSize:     cfg.AuditBatchSize,
+			FlushInterval: time.Duration(cfg.AuditFlushInterval) * time.Millisecond,
+		}, canaryRecorderMetrics{})
+		lc.Add(lifecycle.Closer("canary recorder", lifecycle.Producers, recorder.Close))
+		canary.Recorder = recorder
+	}
+
+	// Load the business rules
+	rules, err := loadRiskRules(cfg)
+	if err != nil {
+		return err
+	}
+	typePolicies, err := loadTypePolicies(cfg)
+	if err != nil {
+		return err
+	}
+	normalizer, err := loadMerchantNormalizer(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Create processor with business rules
+	proc := processor.NewProcessor(processor.Deps{
+		Publisher:  pub,
+		Rules:      rules,
+		Metrics:    processorMetrics{},
+		Parents:    parents,
+		Currencies: cfg.SupportedCurrencies,
+		Blocklist:  blocked,
+		Devices:    processorDevices,
+		Countries:  processorCountries,
+		Accounts:   processorAccounts,
+		Normalizer: normalizer,
+		Auditor:    auditor,
+		Lanes: processor.LaneConfig{
+			FastMaxAmount: cfg.FastLaneMaxAmount,
+			FastMaxScore:  cfg.FastLaneMaxScore,
+			SlowWorkers:   cfg.SlowLaneWorkers,
+		},
+		Staleness:  stalenessPolicy(cfg),
+		Conversion: processor.Conversion{Rates: rates, Base: cfg.BaseCurrency},
+		Recurrence: processor.Recurrence{
+			History:    processorRecurrence,
+			Adjustment: cfg.RecurrenceRiskAdjustment,
+			Floor:      cfg.RecurrenceRiskFloor,
+		},
+		TypeLimits: processor.TypeLimits{Policies: typePolicies, Totals: processorTotals},
+		Canary:     canary,
+	})
+
+	// In exactly-once mode, skip raw transactions already published before
+	// a crash or rebalance redelivered them
+	var handler consumer.Handler = proc
+	if cfg.ExactlyOnce {
+		handler = exactlyonce.New(exactlyonce.Config{
+			Brokers:     cfg.KafkaBrokers,
+			Transport:   kafkaConn.Transport,
+			GroupID:     cfg.ConsumerGroup,
+			InputTopic:  cfg.InputTopic,
+			OutputTopic: cfg.OutputTopic,
+			ScanDepth:   cfg.ExactlyOnceScanDepth,
+			BatchSize:   cfg.BatchSize,
+		}, exactlyOnceMetrics{}).Wrap(proc)
+		log.Printf("Exactly-once publishing enabled, reading back %d messages per partition of %s", cfg.ExactlyOnceScanDepth, cfg.OutputTopic)
+	}
+
+	// Create consumer for raw transactions. A transaction failing every
+	// attempt is parked on the dead letter topic.
+	cons := consumer.New(consumer.Config{
+		Brokers:         cfg.KafkaBrokers,
+		GroupID:         cfg.ConsumerGroup,
+		Topic:           cfg.InputTopic,
+		Dialer:          kafkaConn.Dialer,
+		Transport:       kafkaConn.Transport,
+		BatchSize:       cfg.BatchSize,
+		Workers:         cfg.ConsumerWorkers,
+		MaxAttempts:     cfg.MaxRetries + 1,
+		DeadLetterTopic: cfg.DLQTopic,
+		MaxRedrives:     cfg.MaxRedrives,
+		DrainTimeout:    time.Duration(cfg.ProcessTimeout) * time.Second,
+		Metrics:         consumerMetrics{},
+		Logger:          logger,
+		LogSampleRate:   cfg.LogSampleRate,
+		Chaos:           chaosInjector,
+
+		// Lag alerts go to the alert service with the processed transactions
+		LagAlerter:       pub,
+		LagThreshold:     int64(cfg.LagAlertThreshold),
+		LagSustain:       time.Duration(cfg.LagAlertSustain) * time.Second,
+		LagRecoveryRatio: cfg.LagAlertRecoveryRatio,
+	}, handler)
+
+	// The consumer drains the batch in flight for up to ProcessTimeout once
+	// stopped, before it is closed and the publishers it feeds flush
+	lc.Add(
+		lifecycle.Closer("kafka consumer", lifecycle.Consumers, cons.Close),
+		lifecycle.Component{Name: "consumer", Group: lifecycle.Consumers, Start: cons.Start},
+	)
+
+	// Keep the blocklist up to date with the storage API
+	if blocklistSource != nil {
+		lc.Add(lifecycle.Background("blocklist refresh", func(ctx context.Context) {
+			blocked.Run(ctx, time.Duration(cfg.BlocklistRefreshInterval)*time.Second)
+		}))
+	}
+
+	// Keep the exchange rates up to date with the provider
+	if cfg.ExchangeRatesURL != "" {
+		lc.Add(lifecycle.Background("exchange rates refresh", func(ctx context.Context) {
+			rates.Run(ctx, cfg.ExchangeRatesURL, time.Duration(cfg.ExchangeRatesRefresh)*time.Minute)
+		}))
+	}
+
+	// Serve health, version, consumer administration, fault injection and,
+	// if enabled, metrics
+	log.Printf("Starting HTTP server on port %s", cfg.MetricsPort)
+	lc.Add(lifecycle.Server("http server", newHTTPServer(cfg, cons, proc, chaosInjector, deviceHistory)))
+
+	return lc.Run(ctx)
+}
+
+// Prometheus metrics
+var (
+	transactionsProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "transactions_processed_total",
+			Help: "Total number of transactions processed",
+		},
+		[]string{"status", "risk_level"},
+	)
+
+	processingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "transaction_processing_duration_seconds",
+			Help:    "Duration of transaction processing",
+			Buckets: buckets.For("transaction_processing_duration_seconds", buckets.Request),
+		},
+		[]string{"status"},
+	)
+
+	processingErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "transaction_processing_errors_total",
+			Help: "Total number of processing errors",
+		},
+		[]string{"error_type"},
+	)
+
+	consumerQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processing_consumer_worker_queue_depth",
+			Help: "Number of messages waiting in each consumer worker queue",
+		},
+		[]string{"worker"},
+	)
+
+	consumerLag = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "processing_consumer_lag",
+			Help: "Number of raw transactions not yet consumed",
+		},
+	)
+
+	consumerPartitionLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processing_consumer_partition_lag",
+			Help: "Number of raw transactions not yet committed per partition",
+		},
+		[]string{"partition"},
+	)
+
+	consumerDeadLettered = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processing_consumer_dead_lettered_total",
+			Help: "Total number of raw transactions parked on the dead letter topic",
+		},
+	)
+
+	consumerOversized = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processing_consumer_oversized_skipped_total",
+			Help: "Total number of raw transactions skipped for exceeding the fetch size limit",
+		},
+	)
+
+	consumerPaused = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "processing_consumer_paused",
+			Help: "Whether consumption is paused by an operator (1) or running (0)",
+		},
+	)
+
+	shadowRuleHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_shadow_rule_hits_total",
+			Help: "Total number of transactions a shadow risk rule would have scored",
+		},
+		[]string{"rule"},
+	)
+
+	ruleEvaluations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_rule_evaluations_total",
+			Help: "Total number of risk rule evaluations, by rule and outcome (hit, miss or error)",
+		},
+		[]string{"rule", "outcome"},
+	)
+
+	ruleEvaluationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "processing_rule_evaluation_duration_seconds",
+			Help:    "Duration of a risk rule evaluation, by rule",
+			Buckets: buckets.For("processing_rule_evaluation_duration_seconds", prometheus.ExponentialBuckets(0.000001, 4, 10)),
+		},
+		[]string{"rule"},
+	)
+
+	ruleContribution = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "processing_rule_contribution",
+			Help:    "Weight an enforced risk rule added to the risk score of the transactions it matched, by rule",
+			Buckets: buckets.For("processing_rule_contribution", prometheus.LinearBuckets(0.1, 0.1, 10)),
+		},
+		[]string{"rule"},
+	)
+
+	riskDecisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_risk_decisions_total",
+			Help: "Total number of decisions of the risk stage, by status and the enforced rule contributing the highest weight, none without any",
+		},
+		[]string{"status", "top_rule"},
+	)
+
+	laneTransactions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_lane_transactions_total",
+			Help: "Total number of transactions whose risk was assessed, by processing lane",
+		},
+		[]string{"lane"},
+	)
+
+	staleTransactions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_stale_transactions_total",
+			Help: "Total number of transactions failed for being picked up after the max age of their type, by type",
+		},
+		[]string{"type"},
+	)
+
+	laneDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "processing_lane_duration_seconds",
+			Help:    "Duration of risk assessment, including lookups and waiting for the slow lane, by processing lane",
+			Buckets: buckets.For("processing_lane_duration_seconds", buckets.Request),
+		},
+		[]string{"lane"},
+	)
+
+	duplicatesSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processing_duplicates_skipped_total",
+			Help: "Total number of redelivered raw transactions skipped as already published in exactly-once mode",
+		},
+	)
+
+	exactlyOnceRecoveryDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "processing_exactly_once_recovery_duration_seconds",
+			Help:    "Duration of reading back the output topic for the raw transactions already published",
+			Buckets: buckets.For("processing_exactly_once_recovery_duration_seconds", prometheus.DefBuckets),
+		},
+	)
+
+	auditsPublished = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processing_decision_audits_published_total",
+			Help: "Total number of decision audits published",
+		},
+	)
+
+	auditsLost = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_decision_audits_lost_total",
+			Help: "Total number of decision audits dropped without being published, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	canaryComparisons = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_canary_comparisons_total",
+			Help: "Total number of sampled transactions evaluated with the canary rules, by whether the decisions agree or disagree",
+		},
+		[]string{"result"},
+	)
+
+	canaryRuleDisagreements = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_canary_rule_disagreements_total",
+			Help: "Total number of disagreeing canary decisions in which a rule was enforced by one configuration and not the other",
+		},
+		[]string{"rule"},
+	)
+
+	canaryComparisonsPublished = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processing_canary_comparisons_published_total",
+			Help: "Total number of canary comparisons published",
+		},
+	)
+
+	canaryComparisonsLost = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_canary_comparisons_lost_total",
+			Help: "Total number of canary comparisons dropped without being published, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	blocklistEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "processing_blocklist_entries",
+			Help: "Number of blocklist entries loaded, including expired ones not yet refreshed away",
+		},
+	)
+
+	chaosFaultsInjected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "processing_chaos_faults_injected_total",
+			Help: "Total number of faults injected by chaos mode",
+		},
+		[]string{"target", "mode"},
+	)
+
+	buildInfo = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "processing_build_info",
+			Help:        "Build information of the running binary, always 1",
+			ConstLabels: buildinfo.Labels(),
+		},
+	)
+)
+
+// initMetrics initializes Prometheus metrics
+func initMetrics() {
+	prometheus.MustRegister(transactionsProcessed)
+	prometheus.MustRegister(processingDuration)
+	prometheus.MustRegister(processingErrors)
+	prometheus.MustRegister(consumerQueueDepth)
+	prometheus.MustRegister(consumerLag)
+	prometheus.MustRegister(consumerPartitionLag)
+	prometheus.MustRegister(consumerDeadLettered)
+	prometheus.MustRegister(consumerOversized)
+	prometheus.MustRegister(consumerPaused)
+	prometheus.MustRegister(shadowRuleHits)
+	prometheus.MustRegister(ruleEvaluations)
+	prometheus.MustRegister(ruleEvaluationDuration)
+	prometheus.MustRegister(ruleContribution)
+	prometheus.MustRegister(riskDecisions)
+	prometheus.MustRegister(laneTransactions)
+	prometheus.MustRegister(laneDuration)
+	prometheus.MustRegister(staleTransactions)
+	prometheus.MustRegister(duplicatesSkipped)
+	prometheus.MustRegister(exactlyOnceRecoveryDuration)
+	prometheus.MustRegister(auditsPublished)
+	prometheus.MustRegister(auditsLost)
+	prometheus.MustRegister(canaryComparisons)
+	prometheus.MustRegister(canaryRuleDisagreements)
+	prometheus.MustRegister(canaryComparisonsPublished)
+	prometheus.MustRegister(canaryComparisonsLost)
+	prometheus.MustRegister(blocklistEntries)
+	prometheus.MustRegister(chaosFaultsInjected)
+	prometheus.MustRegister(buildInfo)
+	buildInfo.Set(1)
+}
+
+// consumerMetrics reports the Kafka consumer's measurements
+type consumerMetrics struct{}
+
+func (consumerMetrics) RecordError(stage string) {
+	processingErrors.WithLabelValues("consumer_" + stage).Inc()
+}
+func (consumerMetrics) SetQueueDepth(worker string, depth int) {
+	consumerQueueDepth.WithLabelValues(worker).Set(float64(depth))
+}
+func (consumerMetrics) RecordDeadLettered() { consumerDeadLettered.Inc() }
+func (consumerMetrics) RecordAbandoned() {
+	processingErrors.WithLabelValues("consumer_abandoned").Inc()
+}
+func (consumerMetrics) RecordOversized() { consumerOversized.Inc() }
+func (consumerMetrics) SetLag(lag int64) { consumerLag.Set(float64(lag)) }
+func (consumerMetrics) SetPartitionLag(partition int, lag int64) {
+	consumerPartitionLag.WithLabelValues(strconv.Itoa(partition)).Set(float64(lag))
+}
+func (consumerMetrics) SetPaused(paused bool) {
+	if paused {
+		consumerPaused.Set(1)
+	} else {
+		consumerPaused.Set(0)
+	}
+}
+
+// processorMetrics reports the outcome of risk rules and lookups, and the
+// lanes transactions take
+type processorMetrics struct{}
+
+func (processorMetrics) RecordShadowHit(rule string) { shadowRuleHits.WithLabelValues(rule).Inc() }
+func (processorMetrics) RecordParentLookupError() {
+	processingErrors.WithLabelValues("parent_lookup").Inc()
+}
+func (processorMetrics) RecordDeviceLookupError() {
+	processingErrors.WithLabelValues("device_lookup").Inc()
+}
+func (processorMetrics) RecordCountryLookupError() {
+	processingErrors.WithLabelValues("country_lookup").Inc()
+}
+func (processorMetrics) RecordAccountLookupError() {
+	processingErrors.WithLabelValues("account_lookup").Inc()
+}
+func (processorMetrics) RecordLane(lane string, took time.Duration) {
+	laneTransactions.WithLabelValues(lane).Inc()
+	laneDuration.WithLabelValues(lane).Observe(took.Seconds())
+}
+func (processorMetrics) RecordStale(txnType string) {
+	staleTransactions.WithLabelValues(txnType).Inc()
+}
+func (processorMetrics) RecordRateLookupError() {
+	processingErrors.WithLabelValues("exchange_rate").Inc()
+}
+func (processorMetrics) RecordRecurrenceLookupError() {
+	processingErrors.WithLabelValues("recurrence_lookup").Inc()
+}
+func (processorMetrics) RecordDailyTotalLookupError() {
+	processingErrors.WithLabelValues("daily_total_lookup").Inc()
+}
+func (processorMetrics) RecordCanaryComparison(agree bool) {
+	if agree {
+		canaryComparisons.WithLabelValues("agree").Inc()
+	} else {
+		canaryComparisons.WithLabelValues("disagree").Inc()
+	}
+}
+func (processorMetrics) RecordCanaryRuleDisagreement(rule string) {
+	canaryRuleDisagreements.WithLabelValues(rule).Inc()
+}
+func (processorMetrics) RecordRuleEvaluation(rule, outcome string, took time.Duration) {
+	ruleEvaluations.WithLabelValues(rule, outcome).Inc()
+	ruleEvaluationDuration.WithLabelValues(rule).Observe(took.Seconds())
+}
+func (processorMetrics) RecordRuleContribution(rule string, weight float64) {
+	ruleContribution.WithLabelValues(rule).Observe(weight)
+}
+func (processorMetrics) RecordDecision(status, topRule string) {
+	riskDecisions.WithLabelValues(status, topRule).Inc()
+}
+
+// exactlyOnceMetrics reports the duplicates skipped in exactly-once mode and
+// the recoveries finding them
+type exactlyOnceMetrics struct{}
+
+func (exactlyOnceMetrics) RecordDuplicateSkipped() { duplicatesSkipped.Inc() }
+func (exactlyOnceMetrics) RecordRecovery(_ int, took time.Duration) {
+	exactlyOnceRecoveryDuration.Observe(took.Seconds())
+}
+
+// auditMetrics reports the decision audits published and lost
+type auditMetrics struct{}
+
+func (auditMetrics) RecordAuditsPublished(n int) { auditsPublished.Add(float64(n)) }
+func (auditMetrics) RecordAuditsLost(reason string, n int) {
+	auditsLost.WithLabelValues(reason).Add(float64(n))
+}
+
+// canaryRecorderMetrics reports the canary comparisons published and lost
+type canaryRecorderMetrics struct{}
+
+func (canaryRecorderMetrics) RecordAuditsPublished(n int) { canaryComparisonsPublished.Add(float64(n)) }
+func (canaryRecorderMetrics) RecordAuditsLost(reason string, n int) {
+	canaryComparisonsLost.WithLabelValues(reason).Add(float64(n))
+}
+
+// blocklistMetrics reports blocklist refreshes
+type blocklistMetrics struct{}
+
+func (blocklistMetrics) SetEntries(n int) { blocklistEntries.Set(float64(n)) }
+func (blocklistMetrics) RecordRefreshError() {
+	processingErrors.WithLabelValues("blocklist_refresh").Inc()
+}
+
+// chaosMetrics reports injected faults
+type chaosMetrics struct{}
+
+func (chaosMetrics) RecordFault(target, mode string) {
+	chaosFaultsInjected.WithLabelValues(target, mode).Inc()
+}
+
+// newRedisClient connects to the Redis of the device, country and
+// recurrence histories and the account status cache.
+// The client is kept when Redis is down: lookups fail until it is back, and
+// transactions are assessed without them meanwhile.
+func newRedisClient(cfg *config.Config) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Warning: Redis not available, devices, countries, account statuses, recurring charges and daily caps are unchecked until it is: %v", err)
+	}
+	return client
+}
+
+// loadRiskRules returns the risk rules with the configured modes, or nil for
+// the defaults when no rules file is set
+func loadRiskRules(cfg *config.Config) ([]processor.RiskRule, error) {
+	if cfg.RiskRulesFile == "" {
+		return nil, nil
+	}
+
+	rules, err := processor.LoadRiskRules(cfg.RiskRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid risk rules:\n%w", err)
+	}
+
+	var shadow []string
+	for _, rule := range rules {
+		if rule.Mode == processor.RuleModeShadow {
+			shadow = append(shadow, rule.Name)
+		}
+	}
+	log.Printf("Loaded %d risk rules, in shadow mode: %v", len(rules), shadow)
+	return rules, nil
+}
+
+// loadTypePolicies returns the policies of transaction types in the
+// configured file, or nil for the defaults when none is set
+func loadTypePolicies(cfg *config.Config) (processor.TypePolicies, error) {
+	if cfg.TypePoliciesFile == "" {
+		return nil, nil
+	}
+
+	policies, err := processor.LoadTypePolicies(cfg.TypePoliciesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type policies:\n%w", err)
+	}
+	log.Printf("Loaded policies of %d transaction types", len(policies))
+	return policies, nil
+}
+
+// loadCanaryRules returns the canary risk rules, or nil when no canary
+// rules file is set
+func loadCanaryRules(cfg *config.Config) ([]processor.RiskRule, error) {
+	if cfg.CanaryRulesFile == "" {
+		return nil, nil
+	}
+
+	rules, err := processor.LoadRiskRules(cfg.CanaryRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid canary risk rules:\n%w", err)
+	}
+	log.Printf("Loaded canary risk rules %s, evaluated on %g%% of transactions", processor.RulesVersion(rules), cfg.CanaryPercent)
+	return rules, nil
+}
+
+// stalenessPolicy returns the max ages of transactions in the configuration
+func stalenessPolicy(cfg *config.Config) processor.StalenessPolicy {
+	maxAgeByType := make(map[string]time.Duration, len(cfg.StaleMaxAgeByType))
+	for txnType, seconds := range cfg.StaleMaxAgeByType {
+		maxAgeByType[txnType] = time.Duration(seconds) * time.Second
+	}
+	return processor.StalenessPolicy{
+		MaxAge:        time.Duration(cfg.StaleMaxAge) * time.Second,
+		MaxAgeByType:  maxAgeByType,
+		AlertInterval: time.Duration(cfg.StaleAlertInterval) * time.Second,
+	}
+}
+
+// loadMerchantNormalizer returns the merchant normalizer extended by the
+// configured file, or nil for the defaults when none is set
+func loadMerchantNormalizer(cfg *config.Config) (processor.MerchantNormalizer, error) {
+	if cfg.MerchantNormalizationFile == "" {
+		return nil, nil
+	}
+
+	normalizer, err := merchants.Load(cfg.MerchantNormalizationFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merchant normalization:\n%w", err)
+	}
+	log.Printf("Loaded merchant normalization from %s", cfg.MerchantNormalizationFile)
+	return normalizer, nil
+}
+
+// loadExchangeRates returns a converter with the rates of the exchange rates
+// file, or the built-in rates without one
+func loadExchangeRates(cfg *config.Config) (*currency.Converter, error) {
+	rates, err := currency.LoadConverter(cfg.ExchangeRatesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+	log.Printf("Converting amounts to %s with exchange rates as of %s", cfg.BaseCurrency, rates.Rates().AsOf.Format(time.RFC3339))
+	return rates, nil
+}
+
+// newHTTPServer returns the server for health and readiness checks, build
+// information, consumer pause and resume, dry-run evaluation, canary
+// agreement, fault injection and device history clearing when an admin
+// token is set and, when enabled, Prometheus metrics. The service is not ready while the
+// consumer is paused. deviceHistory may be nil.
+func newHTTPServer(cfg *config.Config, cons *consumer.Consumer, proc *processor.Processor, chaosInjector *chaos.Injector, deviceHistory *devices.History) *http.Server {
+	mux := http.NewServeMux()
+	if cfg.MetricsEnabled {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+	if cfg.AdminToken != "" {
+		admin := consumer.AdminHandler(cons, cfg.AdminToken)
+		mux.Handle("/admin/consumer/", admin)
+		mux.Handle("/admin/dlq/", admin)
+		mux.Handle("/admin/evaluate", processor.EvaluateHandler(proc, cfg.AdminToken, cfg.EvaluateRateLimit))
+		mux.Handle("/admin/canary", processor.CanaryHandler(proc, cfg.AdminToken))
+		mux.Handle("/admin/rules", processor.RulesHandler(proc, cfg.AdminToken))
+	}
+	if cfg.AdminToken != "" && chaosInjector != nil {
+		mux.Handle("/admin/chaos", chaosInjector.Handler(cfg.AdminToken))
+	}
+	if cfg.AdminToken != "" && deviceHistory != nil {
+		mux.Handle("/admin/devices/", devices.Handler(deviceHistory, cfg.AdminToken))
+	}
+	mux.HandleFunc("/version", buildinfo.Handler(serviceName))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		if err := cons.Ready(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	return &http.Server{Addr: ":" + cfg.MetricsPort, Handler: mux}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/config"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+)
+
+// serveRequest serves a request of method and path through the service's
+// HTTP listener with the Authorization header authorization
+func serveRequest(t *testing.T, srv *http.Server, method, path, authorization string) (int, string) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+// get serves a GET of path through the service's HTTP listener
+func get(t *testing.T, srv *http.Server, path string) (*http.Response, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return w.Result(), string(body)
+}
+
+func TestBuildInfoIsServed(t *testing.T) {
+	initMetrics()
+	srv := newHTTPServer(&config.Config{MetricsEnabled: true}, nil, nil, nil, nil)
+
+	resp, body := get(t, srv, "/version")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /version = %d %s", resp.StatusCode, body)
+	}
+	var info buildinfo.Info
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if info != buildinfo.Get(serviceName) {
+		t.Errorf("GET /version = %+v, want %+v", info, buildinfo.Get(serviceName))
+	}
+
+	// The listener's metrics export the build_info gauge
+	resp, body = get(t, srv, "/metrics")
+	want := `processing_build_info{goversion="` + runtime.Version() + `",revision="unknown",version="dev"} 1`
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, want) {
+		t.Errorf("GET /metrics = %d, want it to contain %s", resp.StatusCode, want)
+	}
+}
+
+func TestPauseIsReflectedInReadiness(t *testing.T) {
+	// A listener hanging up on every connection stands in for the broker the
+	// readiness check dials
+	broker, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer broker.Close()
+	go func() {
+		for {
+			conn, err := broker.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	cons := consumer.New(consumer.Config{
+		Brokers:      broker.Addr().String(),
+		GroupID:      "processing-test",
+		Topic:        "transactions",
+		DrainTimeout: 10 * time.Millisecond,
+	}, consumer.HandlerFunc(func(context.Context, kafka.Message) error { return nil }))
+	defer cons.Close()
+	srv := newHTTPServer(&config.Config{AdminToken: "admin-token"}, cons, nil, nil, nil)
+
+	if status, body := serveRequest(t, srv, http.MethodGet, "/readyz", ""); status != http.StatusOK {
+		t.Fatalf("GET /readyz = %d %s, want 200", status, body)
+	}
+	if status, _ := serveRequest(t, srv, http.MethodPost, "/admin/consumer/pause", ""); status != http.StatusUnauthorized {
+		t.Errorf("pause without the admin token = %d, want 401", status)
+	}
+
+	// Not started, the consumer never reports idle, so the pause is accepted
+	// once the drain timeout passes
+	if status, body := serveRequest(t, srv, http.MethodPost, "/admin/consumer/pause", "Bearer admin-token"); status != http.StatusAccepted {
+		t.Fatalf("pause = %d %s, want 202", status, body)
+	}
+	if status, body := serveRequest(t, srv, http.MethodGet, "/readyz", ""); status != http.StatusServiceUnavailable || body != consumer.ErrPaused.Error() {
+		t.Errorf("GET /readyz while paused = %d %s, want 503 %q", status, body, consumer.ErrPaused)
+	}
+	// The liveness check is unaffected, so a paused pod is not restarted
+	if status, _ := serveRequest(t, srv, http.MethodGet, "/health", ""); status != http.StatusOK {
+		t.Errorf("GET /health while paused = %d, want 200", status)
+	}
+
+	if status, body := serveRequest(t, srv, http.MethodPost, "/admin/consumer/resume", "Bearer admin-token"); status != http.StatusOK {
+		t.Fatalf("resume = %d %s, want 200", status, body)
+	}
+	if status, body := serveRequest(t, srv, http.MethodGet, "/readyz", ""); status != http.StatusOK {
+		t.Errorf("GET /readyz after the resume = %d %s, want 200", status, body)
+	}
+}
+
+func TestStalenessPolicyTakesTheConfiguredMaxAges(t *testing.T) {
+	policy := stalenessPolicy(&config.Config{
+		StaleMaxAge:        3600,
+		StaleMaxAgeByType:  map[string]int{"purchase": 900, "transfer": 86400},
+		StaleAlertInterval: 300,
+	})
+	if policy.MaxAge != time.Hour || policy.AlertInterval != 5*time.Minute {
+		t.Errorf("max age %s, alert interval %s, want 1h and 5m", policy.MaxAge, policy.AlertInterval)
+	}
+	if policy.MaxAgeByType["purchase"] != 15*time.Minute || policy.MaxAgeByType["transfer"] != 24*time.Hour {
+		t.Errorf("max ages by type %v, want 15m for purchases and 24h for transfers", policy.MaxAgeByType)
+	}
+}
@@ -3,19 +3,121 @@ module processing-service
 go 1.25.0
 
 require (
+	github.com/alicebob/miniredis/v2 v2.33.0
 	github.com/prometheus/client_golang v1.23.0
+	github.com/redis/go-redis/v9 v9.3.1
 	github.com/segmentio/kafka-go v0.4.48
+	github.com/testcontainers/testcontainers-go v0.44.0
+	github.com/testcontainers/testcontainers-go/modules/kafka v0.44.0
 )
 
 require (
+	dario.cat/mergo v1.0.2 // indirect
+	github.com/Azure/go-ansiterm v0.0.0-20250102033503-faa5f7b0171c // indirect
+	github.com/Microsoft/go-winio v0.6.2 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
+	github.com/containerd/errdefs v1.0.0 // indirect
+	github.com/containerd/errdefs/pkg v0.3.0 // indirect
+	github.com/containerd/log v0.1.0 // indirect
+	github.com/containerd/platforms v0.2.1 // indirect
+	github.com/cpuguy83/dockercfg v0.3.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/distribution/reference v0.6.0 // indirect
+	github.com/docker/go-connections v0.7.0 // indirect
+	github.com/docker/go-units v0.5.0 // indirect
+	github.com/ebitengine/purego v0.10.1 // indirect
+	github.com/felixge/httpsnoop v1.1.0 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/lufia/plan9stats v0.0.0-20260330125221-c963978e514e // indirect
+	github.com/magiconair/properties v1.8.10 // indirect
+	github.com/moby/docker-image-spec v1.3.1 // indirect
+	github.com/moby/go-archive v0.2.0 // indirect
+	github.com/moby/moby/api v1.55.0 // indirect
+	github.com/moby/moby/client v0.5.0 // indirect
+	github.com/moby/patternmatcher v0.6.1 // indirect
+	github.com/moby/sys/sequential v0.7.0 // indirect
+	github.com/moby/sys/user v0.4.0 // indirect
+	github.com/moby/sys/userns v0.1.0 // indirect
+	github.com/moby/term v0.5.2 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/power-devops/perfstat v0.0.0-20240221224432-82ca36839d55 // indirect
+	github.com/shirou/gopsutil/v4 v4.26.6 // indirect
+	github.com/sirupsen/logrus v1.9.4 // indirect
+	github.com/stretchr/testify v1.11.1 // indirect
+	github.com/tklauser/go-sysconf v0.4.0 // indirect
+	github.com/tklauser/numcpus v0.12.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	github.com/yusufpapurcu/wmi v1.2.4 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.69.0 // indirect
+	go.opentelemetry.io/otel v1.44.0 // indirect
+	go.opentelemetry.io/otel/metric v1.44.0 // indirect
+	go.opentelemetry.io/otel/trace v1.44.0 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/mod v0.38.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+require (
+	github.com/Harsh5840/real-time-tx-monitoring/libs/auth v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/buckets v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/chaos v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/consumer v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/currency v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/logging v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/models v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/secrets v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/startup v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/tenant v0.0.0
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
-	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/klauspost/compress v1.18.6 // indirect
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
-	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	github.com/pierrec/lz4/v4 v4.1.18 // indirect
 	github.com/prometheus/client_model v0.6.2 // indirect
 	github.com/prometheus/common v0.65.0 // indirect
 	github.com/prometheus/procfs v0.16.1 // indirect
-	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/models => ../../libs/models
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/consumer => ../../libs/consumer
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn => ../../libs/kafkaconn
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/secrets => ../../libs/secrets
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/logging => ../../libs/logging
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo => ../../libs/buildinfo
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/chaos => ../../libs/chaos
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/tenant => ../../libs/tenant
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/currency => ../../libs/currency
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/startup => ../../libs/startup
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/buckets => ../../libs/buckets
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle => ../../libs/lifecycle
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/auth => ../../libs/auth
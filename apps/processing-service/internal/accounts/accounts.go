@@ -0,0 +1,37 @@
+// Package accounts reads the status of accounts from the cache the storage
+// service keeps in Redis, so that transactions on frozen and closed accounts
+// can be rejected.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"processing-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Statuses is the account status cache in Redis
+type Statuses struct {
+	client *redis.Client
+}
+
+// NewStatuses creates an account status cache reader over client
+func NewStatuses(client *redis.Client) *Statuses {
+	return &Statuses{client: client}
+}
+
+// Status returns the status of an account, or "" when the account is not
+// known to the storage service
+func (s *Statuses) Status(ctx context.Context, accountID string) (string, error) {
+	value, err := s.client.Get(ctx, models.AccountStatusKey(accountID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up account status: %w", err)
+	}
+	return models.ParseAccountStatusValue(value), nil
+}
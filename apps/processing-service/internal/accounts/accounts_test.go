@@ -0,0 +1,46 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	statuses := NewStatuses(client)
+
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	mr.Set(models.AccountStatusKey("acct-1"), shared.AccountStatusValue(models.AccountStatusFrozen, at))
+	mr.Set(models.AccountStatusKey("acct-2"), models.AccountStatusActive)
+
+	tests := []struct {
+		account string
+		want    string
+	}{
+		{"acct-1", models.AccountStatusFrozen},
+		{"acct-2", models.AccountStatusActive},
+		{"acct-unknown", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.account, func(t *testing.T) {
+			if got, err := statuses.Status(ctx, tt.account); err != nil || got != tt.want {
+				t.Errorf("Status = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	mr.Close()
+	if _, err := statuses.Status(ctx, "acct-1"); err == nil {
+		t.Error("Status succeeded with Redis down")
+	}
+}
@@ -0,0 +1,220 @@
+// Package audit publishes the decision audits of the processor to the audit
+// topic, and the comparisons of canary rules to the canary topic. Audits are
+// buffered and flushed in batches by a background
+// goroutine, so that publishing them never holds up a decision; an audit
+// that cannot be buffered or published is dropped and counted instead.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
+	"github.com/segmentio/kafka-go"
+)
+
+// Reasons an audit is lost
+const (
+	LostBufferFull    = "buffer_full"
+	LostEncodeFailed  = "encode_failed"
+	LostPublishFailed = "publish_failed"
+	LostClosed        = "closed"
+)
+
+// Config configures a Recorder
+type Config struct {
+	Brokers   string // comma-separated
+	Topic     string
+	Transport *kafka.Transport
+
+	// BufferSize audits wait to be published; audits recorded while it is
+	// full are lost. Up to BatchSize of them are published together, at
+	// least every FlushInterval.
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Metrics records the audits published and lost
+type Metrics interface {
+	RecordAuditsPublished(n int)
+	RecordAuditsLost(reason string, n int)
+}
+
+// Recorder buffers decision audits, or canary comparisons, and publishes
+// them asynchronously
+type Recorder struct {
+	writer   *kafka.Writer
+	metrics  Metrics
+	cfg      Config
+	version  string
+	instance string
+
+	mu     sync.RWMutex
+	closed bool
+	audits chan entry
+	done   chan struct{}
+}
+
+// entry is a record waiting to be published, keyed by transaction so the
+// records of a transaction keep their order
+type entry struct {
+	key      string
+	tenantID string
+	value    any
+}
+
+// New creates a recorder and starts publishing. metrics may be nil.
+func New(cfg Config, metrics Metrics) *Recorder {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(consumer.ParseBrokers(cfg.Brokers)...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	if cfg.Transport != nil {
+		writer.Transport = cfg.Transport
+	}
+
+	instance, err := os.Hostname()
+	if err != nil || instance == "" {
+		instance = "unknown"
+	}
+
+	r := &Recorder{
+		writer:   writer,
+		metrics:  metrics,
+		cfg:      cfg,
+		version:  buildinfo.Version,
+		instance: instance,
+		audits:   make(chan entry, cfg.BufferSize),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record stamps an audit with the processor's version and instance and
+// buffers it for publishing, dropping it when the buffer is full
+func (r *Recorder) Record(ctx context.Context, audit *models.DecisionAudit) {
+	audit.ProcessorVersion = r.version
+	audit.ProcessorInstance = r.instance
+	r.enqueue(ctx, entry{key: audit.TransactionID, tenantID: audit.TenantID, value: audit})
+}
+
+// RecordComparison buffers the comparison of a canary rules configuration
+// for publishing, dropping it when the buffer is full
+func (r *Recorder) RecordComparison(ctx context.Context, comparison *models.CanaryComparison) {
+	r.enqueue(ctx, entry{key: comparison.TransactionID, tenantID: comparison.TenantID, value: comparison})
+}
+
+// enqueue buffers a record, dropping it when the buffer is full or the
+// recorder closed
+func (r *Recorder) enqueue(ctx context.Context, e entry) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		r.lost(ctx, LostClosed, 1)
+		return
+	}
+	select {
+	case r.audits <- e:
+	default:
+		r.lost(ctx, LostBufferFull, 1)
+	}
+}
+
+// run publishes the buffered audits in batches until Close
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]entry, 0, r.cfg.BatchSize)
+	for {
+		select {
+		case e, ok := <-r.audits:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) < r.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		r.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush publishes a batch of records
+func (r *Recorder) flush(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx := context.Background()
+
+	messages := make([]kafka.Message, 0, len(batch))
+	for _, e := range batch {
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to serialize record", "topic", r.cfg.Topic, "transaction_id", e.key, "error", err)
+			r.lost(ctx, LostEncodeFailed, 1)
+			continue
+		}
+		messages = append(messages, kafka.Message{
+			Key:     []byte(e.key),
+			Value:   value,
+			Headers: []kafka.Header{{Key: tenant.Header, Value: []byte(e.tenantID)}},
+		})
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := r.writer.WriteMessages(ctx, messages...); err != nil {
+		slog.ErrorContext(ctx, "failed to publish records", "topic", r.cfg.Topic, "count", len(messages), "error", err)
+		r.lost(ctx, LostPublishFailed, len(messages))
+		return
+	}
+	if r.metrics != nil {
+		r.metrics.RecordAuditsPublished(len(messages))
+	}
+}
+
+// lost counts audits dropped for reason
+func (r *Recorder) lost(ctx context.Context, reason string, n int) {
+	slog.DebugContext(ctx, "record lost", "topic", r.cfg.Topic, "reason", reason, "count", n)
+	if r.metrics != nil {
+		r.metrics.RecordAuditsLost(reason, n)
+	}
+}
+
+// Close stops recording, publishes the audits still buffered and closes the
+// writer
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.audits)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+	return r.writer.Close()
+}
@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeMetrics records the audits published and lost, by reason
+type fakeMetrics struct {
+	mu        sync.Mutex
+	published int
+	lostBy    map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{lostBy: make(map[string]int)}
+}
+
+func (m *fakeMetrics) RecordAuditsPublished(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published += n
+}
+
+func (m *fakeMetrics) RecordAuditsLost(reason string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lostBy[reason] += n
+}
+
+func (m *fakeMetrics) lost(reason string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lostBy[reason]
+}
+
+// failingTransport fails every request to the brokers, as an unreachable
+// cluster does
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(context.Context, net.Addr, kafka.Request) (kafka.Response, error) {
+	return nil, errors.New("kafka: broker not available")
+}
+
+// newFailingRecorder returns a recorder whose every publish fails at once,
+// closed when the test ends
+func newFailingRecorder(t *testing.T, cfg Config, metrics Metrics) *Recorder {
+	t.Helper()
+	cfg.Brokers, cfg.Topic = "127.0.0.1:1", "transactions.audit"
+	r := New(cfg, metrics)
+	r.writer.Transport = failingTransport{}
+	r.writer.MaxAttempts = 1
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRecordStampsTheProcessor(t *testing.T) {
+	r := newFailingRecorder(t, Config{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour}, nil)
+	r.version, r.instance = "v1.4.2", "processing-7f9c"
+
+	audit := &models.DecisionAudit{TransactionID: "txn-1", ProcessorID: "processor-001"}
+	r.Record(context.Background(), audit)
+	if audit.ProcessorVersion != "v1.4.2" || audit.ProcessorInstance != "processing-7f9c" {
+		t.Errorf("audit stamped %q on %q, want v1.4.2 on processing-7f9c", audit.ProcessorVersion, audit.ProcessorInstance)
+	}
+}
+
+func TestAuditsLostWhenTheBufferIsFull(t *testing.T) {
+	metrics := newFakeMetrics()
+	// Not started, so nothing drains the buffer
+	r := &Recorder{metrics: metrics, audits: make(chan entry, 2)}
+
+	for i := 0; i < 5; i++ {
+		r.Record(context.Background(), &models.DecisionAudit{TransactionID: "txn-1"})
+	}
+	if n := metrics.lost(LostBufferFull); n != 3 {
+		t.Errorf("%d audits lost to a full buffer, want 3", n)
+	}
+	if len(r.audits) != 2 {
+		t.Errorf("%d audits buffered, want 2", len(r.audits))
+	}
+}
+
+func TestAuditsLostWhenPublishingFails(t *testing.T) {
+	metrics := newFakeMetrics()
+	r := newFailingRecorder(t, Config{BufferSize: 10, BatchSize: 2, FlushInterval: 10 * time.Millisecond}, metrics)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		r.Record(context.Background(), &models.DecisionAudit{TransactionID: "txn-1"})
+	}
+	r.RecordComparison(context.Background(), &models.CanaryComparison{TransactionID: "txn-1"})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("recording took %s, want it never to wait on publishing", elapsed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for metrics.lost(LostPublishFailed) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d audits lost to failed publishes, want 4", metrics.lost(LostPublishFailed))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if metrics.published != 0 {
+		t.Errorf("%d audits counted as published", metrics.published)
+	}
+}
+
+func TestCloseFlushesTheBufferAndStopsRecording(t *testing.T) {
+	metrics := newFakeMetrics()
+	r := newFailingRecorder(t, Config{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour}, metrics)
+
+	r.Record(context.Background(), &models.DecisionAudit{TransactionID: "txn-1"})
+	r.Record(context.Background(), &models.DecisionAudit{TransactionID: "txn-2"})
+	r.Close()
+	// The buffered audits were attempted before Close returned
+	if n := metrics.lost(LostPublishFailed); n != 2 {
+		t.Errorf("%d buffered audits attempted on close, want 2", n)
+	}
+
+	r.Record(context.Background(), &models.DecisionAudit{TransactionID: "txn-3"})
+	if n := metrics.lost(LostClosed); n != 1 {
+		t.Errorf("%d audits lost after close, want 1", n)
+	}
+}
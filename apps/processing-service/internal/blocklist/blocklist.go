@@ -0,0 +1,139 @@
+// Package blocklist holds the countries, merchants and accounts whose
+// transactions are rejected. Entries come from the configuration and from the
+// storage service API, which is polled so changes made there apply without a
+// restart.
+package blocklist
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// Source lists the active blocklist entries
+type Source interface {
+	Blocklist(ctx context.Context) ([]*models.BlocklistEntry, error)
+}
+
+// Metrics records blocklist refreshes
+type Metrics interface {
+	SetEntries(n int)
+	RecordRefreshError()
+}
+
+// key identifies an entry by type and value
+type key struct {
+	entryType string
+	value     string
+}
+
+// Blocklist is the set of blocklist entries, safe for concurrent use
+type Blocklist struct {
+	static  map[key]*models.BlocklistEntry
+	source  Source
+	metrics Metrics
+
+	mu      sync.RWMutex
+	entries map[key]*models.BlocklistEntry
+}
+
+// New creates a blocklist of the given countries and merchants, which never
+// expire, extended by the entries of source once refreshed. source and
+// metrics may be nil.
+func New(countries, merchants []string, source Source, metrics Metrics) *Blocklist {
+	static := make(map[key]*models.BlocklistEntry)
+	add := func(entryType string, values []string) {
+		for _, value := range values {
+			static[keyOf(entryType, value)] = &models.BlocklistEntry{
+				Type:    entryType,
+				Value:   value,
+				AddedBy: "config",
+			}
+		}
+	}
+	add(models.BlocklistTypeCountry, countries)
+	add(models.BlocklistTypeMerchant, merchants)
+
+	b := &Blocklist{static: static, source: source, metrics: metrics, entries: static}
+	if metrics != nil {
+		metrics.SetEntries(len(static))
+	}
+	return b
+}
+
+// Lookup returns the active entry blocking the value of the given type, or
+// nil. Country codes match regardless of case.
+func (b *Blocklist) Lookup(entryType, value string) *models.BlocklistEntry {
+	if value == "" {
+		return nil
+	}
+	b.mu.RLock()
+	entry := b.entries[keyOf(entryType, value)]
+	b.mu.RUnlock()
+	if entry == nil || !entry.Active(time.Now()) {
+		return nil
+	}
+	return entry
+}
+
+// Refresh replaces the entries of the source with its current list. On
+// failure the previous entries stay in effect.
+func (b *Blocklist) Refresh(ctx context.Context) error {
+	if b.source == nil {
+		return nil
+	}
+	fetched, err := b.source.Blocklist(ctx)
+	if err != nil {
+		if b.metrics != nil {
+			b.metrics.RecordRefreshError()
+		}
+		return err
+	}
+
+	entries := make(map[key]*models.BlocklistEntry, len(b.static)+len(fetched))
+	for k, entry := range b.static {
+		entries[k] = entry
+	}
+	for _, entry := range fetched {
+		entries[keyOf(entry.Type, entry.Value)] = entry
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.mu.Unlock()
+	if b.metrics != nil {
+		b.metrics.SetEntries(len(entries))
+	}
+	return nil
+}
+
+// Run refreshes the blocklist now and then every interval until ctx is
+// cancelled
+func (b *Blocklist) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.Refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "failed to refresh blocklist", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// keyOf returns the key of an entry, upper-casing country codes
+func keyOf(entryType, value string) key {
+	if entryType == models.BlocklistTypeCountry {
+		value = strings.ToUpper(value)
+	}
+	return key{entryType: entryType, value: value}
+}
@@ -0,0 +1,177 @@
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// fakeSource returns entries, or err when set
+type fakeSource struct {
+	mu      sync.Mutex
+	entries []*models.BlocklistEntry
+	err     error
+	calls   int
+}
+
+func (s *fakeSource) Blocklist(context.Context) ([]*models.BlocklistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return s.entries, s.err
+}
+
+func (s *fakeSource) set(entries []*models.BlocklistEntry, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries, s.err = entries, err
+}
+
+func (s *fakeSource) refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// fakeMetrics records the entry count and refresh errors
+type fakeMetrics struct {
+	entries, errors int
+}
+
+func (m *fakeMetrics) SetEntries(n int)    { m.entries = n }
+func (m *fakeMetrics) RecordRefreshError() { m.errors++ }
+
+func entry(entryType, value string, expiresAt *time.Time) *models.BlocklistEntry {
+	return &models.BlocklistEntry{Type: entryType, Value: value, Reason: "fraud ring", AddedBy: "ops-1", ExpiresAt: expiresAt}
+}
+
+func TestConfiguredEntries(t *testing.T) {
+	metrics := &fakeMetrics{}
+	b := New([]string{"KP"}, []string{"Crypto Exchange"}, nil, metrics)
+
+	tests := []struct {
+		name      string
+		entryType string
+		value     string
+		blocked   bool
+	}{
+		{"country", models.BlocklistTypeCountry, "KP", true},
+		{"country in lower case", models.BlocklistTypeCountry, "kp", true},
+		{"merchant", models.BlocklistTypeMerchant, "Crypto Exchange", true},
+		{"merchant of another case", models.BlocklistTypeMerchant, "crypto exchange", false},
+		{"value of another type", models.BlocklistTypeAccount, "KP", false},
+		{"empty value", models.BlocklistTypeCountry, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.Lookup(tt.entryType, tt.value)
+			if (got != nil) != tt.blocked {
+				t.Errorf("Lookup(%s, %q) = %+v, want blocked %v", tt.entryType, tt.value, got, tt.blocked)
+			}
+		})
+	}
+	if metrics.entries != 2 {
+		t.Errorf("%d entries counted, want 2", metrics.entries)
+	}
+	// Without a source, refreshing keeps the configuration
+	if err := b.Refresh(context.Background()); err != nil || b.Lookup(models.BlocklistTypeCountry, "KP") == nil {
+		t.Errorf("Refresh = %v, want the configured entries kept", err)
+	}
+}
+
+func TestRefreshReplacesTheSourceEntries(t *testing.T) {
+	ctx := context.Background()
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	source := &fakeSource{entries: []*models.BlocklistEntry{
+		entry(models.BlocklistTypeAccount, "acct-1", nil),
+		entry(models.BlocklistTypeMerchant, "Shady Shop", &future),
+		entry(models.BlocklistTypeCountry, "ru", &past),
+	}}
+	metrics := &fakeMetrics{}
+	b := New([]string{"KP"}, nil, source, metrics)
+
+	if b.Lookup(models.BlocklistTypeAccount, "acct-1") != nil {
+		t.Error("source entry in effect before a refresh")
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := b.Lookup(models.BlocklistTypeAccount, "acct-1"); got == nil || got.Reason != "fraud ring" {
+		t.Errorf("Lookup(acct-1) = %+v, want the source entry", got)
+	}
+	if b.Lookup(models.BlocklistTypeMerchant, "Shady Shop") == nil {
+		t.Error("entry expiring later is not in effect")
+	}
+	// Expired entries are ignored without waiting for the source to drop them
+	if got := b.Lookup(models.BlocklistTypeCountry, "RU"); got != nil {
+		t.Errorf("expired entry in effect: %+v", got)
+	}
+	if b.Lookup(models.BlocklistTypeCountry, "KP") == nil {
+		t.Error("configured entry lost on refresh")
+	}
+	if metrics.entries != 4 {
+		t.Errorf("%d entries counted, want 4", metrics.entries)
+	}
+
+	// A removed entry stops applying at the next refresh
+	source.set([]*models.BlocklistEntry{entry(models.BlocklistTypeMerchant, "Shady Shop", &future)}, nil)
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if b.Lookup(models.BlocklistTypeAccount, "acct-1") != nil {
+		t.Error("removed entry still in effect")
+	}
+
+	// A failed refresh keeps the previous entries
+	errStorage := errors.New("storage API returned 503 Service Unavailable")
+	source.set(nil, errStorage)
+	if err := b.Refresh(ctx); !errors.Is(err, errStorage) {
+		t.Fatalf("Refresh = %v, want %v", err, errStorage)
+	}
+	if b.Lookup(models.BlocklistTypeMerchant, "Shady Shop") == nil {
+		t.Error("entries lost on a failed refresh")
+	}
+	if metrics.errors != 1 {
+		t.Errorf("%d refresh errors recorded, want 1", metrics.errors)
+	}
+}
+
+func TestRunRefreshesUntilCancelled(t *testing.T) {
+	source := &fakeSource{}
+	b := New(nil, nil, source, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run(ctx, time.Millisecond)
+	}()
+
+	waitUntil := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitUntil("the first refresh", func() bool { return source.refreshes() > 0 })
+
+	// An entry added at the source later takes effect without a restart
+	source.set([]*models.BlocklistEntry{entry(models.BlocklistTypeMerchant, "Shady Shop", nil)}, nil)
+	waitUntil("the entry to be refreshed", func() bool {
+		return b.Lookup(models.BlocklistTypeMerchant, "Shady Shop") != nil
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return once cancelled")
+	}
+}
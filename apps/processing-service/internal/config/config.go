@@ -1,8 +1,16 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
 )
 
 // Config holds all configuration for the processing service
@@ -12,51 +20,494 @@ type Config struct {
 	InputTopic    string
 	OutputTopic   string
 	ConsumerGroup string
+	DLQTopic      string // raw transactions that fail every attempt
+	KafkaSecurity kafkaconn.Config
+
+	// Compression, batching and acknowledgements of the publisher
+	KafkaWriter kafkaconn.WriterConfig
+
+	// KafkaTopics provisions the topics the service produces to at
+	// startup, when TOPIC_AUTOCREATE is set
+	KafkaTopics kafkaconn.TopicsConfig
+
+	// MaxRedrives caps how many times a message is re-driven from DLQTopic
+	// through /admin/dlq/redrive
+	MaxRedrives int
+
+	// ExactlyOnce publishes each raw transaction at most once even when it
+	// is redelivered, by reading back the last ExactlyOnceScanDepth
+	// messages of each OutputTopic partition for the raw transactions
+	// already published. Processed transactions are then written
+	// synchronously. Without it delivery is at least once.
+	ExactlyOnce          bool
+	ExactlyOnceScanDepth int
+
+	// Decision audit configuration. The audit of every decision is
+	// published on AuditTopic, empty publishing none, from a buffer of
+	// AuditBufferSize audits flushed in batches of AuditBatchSize at least
+	// every AuditFlushInterval. Audits recorded while the buffer is full are
+	// dropped and counted.
+	AuditTopic         string
+	AuditBufferSize    int
+	AuditBatchSize     int
+	AuditFlushInterval int // in milliseconds
+
+	// Processing configuration. Transactions are processed by
+	// ConsumerWorkers goroutines, one account per worker at a time, with at
+	// most BatchSize of them in flight.
+	MaxRetries      int
+	BatchSize       int
+	ConsumerWorkers int
+	ProcessTimeout  int // in seconds
+
+	// StartupTimeout bounds the wait for Kafka at startup
+	StartupTimeout int // in seconds
 
-	// Processing configuration
-	MaxRetries     int
-	BatchSize      int
-	ProcessTimeout int // in seconds
+	// ShutdownDeadline bounds the whole shutdown, past which the components
+	// not yet stopped are abandoned and the service exits with an error
+	ShutdownDeadline int // in seconds
+
+	// Processing lanes. Transactions other than refunds of at most
+	// FastLaneMaxAmount whose score from the rules needing no lookups is
+	// below FastLaneMaxScore skip the device, country and refund lookups;
+	// a zero FastLaneMaxAmount disables the fast lane. At most
+	// SlowLaneWorkers transactions are in those lookups at once, zero for
+	// no limit.
+	FastLaneMaxAmount float64
+	FastLaneMaxScore  float64
+	SlowLaneWorkers   int
+
+	// Staleness. A valid transaction picked up more than the max age of its
+	// type after ingestion is failed as stale: StaleMaxAgeByType maps
+	// transaction types to their max age, StaleMaxAge covers the others,
+	// and zero disables the check. Stale transactions raise at most one
+	// operational alert per type every StaleAlertInterval.
+	StaleMaxAge        int            // in seconds
+	StaleMaxAgeByType  map[string]int // in seconds
+	StaleAlertInterval int            // in seconds
 
 	// Monitoring configuration
 	MetricsEnabled bool
 	MetricsPort    string
 
+	// AdminToken authenticates the consumer pause and resume and the
+	// dry-run evaluation endpoints on the metrics listener, which are
+	// disabled without one
+	AdminToken string
+
+	// EvaluateRateLimit is how many dry-run evaluations /admin/evaluate
+	// serves a minute
+	EvaluateRateLimit int
+
+	// ChaosEnabled turns on fault injection into Kafka, driven through
+	// /admin/chaos on the metrics listener
+	ChaosEnabled bool
+
 	// Business rules configuration
 	RiskThreshold    float64
 	MaxAmount        float64
 	BlockedCountries []string
 	BlockedMerchants []string
+
+	// RiskRulesFile is a JSON file setting risk rules to enforce or shadow
+	// mode; without one every rule keeps its default mode
+	RiskRulesFile string
+
+	// TypePoliciesFile is a JSON file setting the policy of transaction
+	// types: their max amount, daily cap per account, required fields and
+	// the amount above which they are flagged for AML review. Types it does
+	// not name keep their default policy. Daily caps apply only with
+	// RedisAddr, where the daily totals are kept.
+	TypePoliciesFile string
+
+	// CanaryRulesFile is a rules file like RiskRulesFile evaluated beside
+	// it on CanaryPercent of the transactions, chosen by ID, without
+	// affecting their decision; the comparisons are published on
+	// CanaryTopic, empty publishing none. Without one there is no canary.
+	CanaryRulesFile string
+	CanaryPercent   float64
+	CanaryTopic     string
+
+	// MerchantNormalizationFile is a JSON file adding patterns stripped from
+	// merchant names and aliases mapping them to a canonical merchant;
+	// without one the defaults apply
+	MerchantNormalizationFile string
+
+	// SupportedCurrencies lists the ISO 4217 currencies transactions may be
+	// in; transactions in any other currency are rejected
+	SupportedCurrencies currency.Allowlist
+
+	// Exchange rates converting amounts into BaseCurrency, the currency the
+	// amount rules are set in. The rates come from ExchangeRatesFile, or the
+	// built-in defaults without one, and are refreshed from ExchangeRatesURL
+	// every ExchangeRatesRefresh when it is set, the last good rates serving
+	// while it fails.
+	BaseCurrency         string
+	ExchangeRatesFile    string
+	ExchangeRatesURL     string
+	ExchangeRatesRefresh int // in minutes
+
+	// Storage API the refunded transactions of refunds are looked up in,
+	// with an admin token. Refunds are not checked against their parent
+	// without StorageAPIURL.
+	StorageAPIURL     string
+	StorageAPIToken   string
+	StorageAPITimeout int // in milliseconds
+
+	// BlocklistRefreshInterval is how often the blocklist is reloaded from
+	// the storage API. BlockedCountries and BlockedMerchants always apply.
+	BlocklistRefreshInterval int // in seconds
+
+	// Redis keeps the devices each user has transacted from, for
+	// DeviceHistoryTTL after the last new one. Without RedisAddr devices are
+	// not tracked.
+	RedisAddr        string
+	RedisPassword    string
+	RedisDB          int
+	DeviceHistoryTTL int // in days
+
+	// Redis also keeps the countries each account transacts in, for
+	// CountryHistoryTTL after its last transaction. An account has a home
+	// country once CountryMinHistory transactions are recorded, and a
+	// transaction less than CountrySwitchGap after one in another country
+	// scores as a switch. Rule weights are set in RiskRulesFile.
+	CountryHistoryTTL int // in days
+	CountryMinHistory int
+	CountrySwitchGap  int // in minutes
+
+	// Redis also keeps the last charges of each account at each merchant,
+	// for RecurrenceHistoryTTL after the last one, in buckets of amounts
+	// within about RecurrenceAmountTolerance of each other. A charge
+	// following RecurrenceMinOccurrences like it, each a week or a month
+	// apart within RecurrenceCadenceTolerance, is recurring, and its risk
+	// score lowered by RecurrenceRiskAdjustment, though not below
+	// RecurrenceRiskFloor. The tolerances are fractions.
+	RecurrenceHistoryTTL       int // in days
+	RecurrenceMinOccurrences   int
+	RecurrenceCadenceTolerance float64
+	RecurrenceAmountTolerance  float64
+	RecurrenceRiskAdjustment   float64
+	RecurrenceRiskFloor        float64
+
+	// A partition of InputTopic lagging by LagAlertThreshold messages or
+	// more for LagAlertSustain raises an operational alert on OutputTopic,
+	// resolved once its lag falls to LagAlertThreshold times
+	// LagAlertRecoveryRatio. A zero threshold disables lag alerts.
+	LagAlertThreshold     int
+	LagAlertSustain       int // in seconds
+	LagAlertRecoveryRatio float64
+
+	// LogSampleRate logs one in this many handled messages at info level
+	LogSampleRate int
+
+	// LogConfigOnStart logs the effective configuration, secrets redacted
+	LogConfigOnStart bool
+
+	// parseErrors lists environment values that could not be parsed
+	parseErrors []error
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from environment variables. Values that
+// cannot be parsed fall back to their defaults and are reported by Validate.
 func LoadConfig() *Config {
+	envErrors = nil
 	cfg := &Config{
 		// Kafka configuration
 		KafkaBrokers:  getEnv("KAFKA_BROKERS", "localhost:9092"),
 		InputTopic:    getEnv("KAFKA_INPUT_TOPIC", "transactions.raw"),
 		OutputTopic:   getEnv("KAFKA_OUTPUT_TOPIC", "transactions.processed"),
 		ConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "processing-service"),
+		DLQTopic:      getEnv("KAFKA_DLQ_TOPIC", "transactions.raw.dlq"),
+		KafkaSecurity: kafkaconn.LoadConfig(),
+		KafkaWriter:   kafkaconn.LoadWriterConfig(),
+		KafkaTopics:   kafkaconn.LoadTopicsConfig(),
+		MaxRedrives:   getEnvAsInt("DLQ_MAX_REDRIVES", 3),
+
+		ExactlyOnce:          getEnvAsBool("EXACTLY_ONCE", false),
+		ExactlyOnceScanDepth: getEnvAsInt("EXACTLY_ONCE_SCAN_DEPTH", 10000),
+
+		// Decision audit configuration
+		AuditTopic:         getEnv("KAFKA_AUDIT_TOPIC", "transactions.audit"),
+		AuditBufferSize:    getEnvAsInt("AUDIT_BUFFER_SIZE", 10000),
+		AuditBatchSize:     getEnvAsInt("AUDIT_BATCH_SIZE", 500),
+		AuditFlushInterval: getEnvAsInt("AUDIT_FLUSH_INTERVAL_MS", 1000),
 
 		// Processing configuration
-		MaxRetries:     getEnvAsInt("MAX_RETRIES", 3),
-		BatchSize:      getEnvAsInt("BATCH_SIZE", 100),
-		ProcessTimeout: getEnvAsInt("PROCESS_TIMEOUT", 30),
+		MaxRetries:      getEnvAsInt("MAX_RETRIES", 3),
+		BatchSize:       getEnvAsInt("BATCH_SIZE", 100),
+		ConsumerWorkers: getEnvAsInt("CONSUMER_WORKERS", 8),
+		ProcessTimeout:  getEnvAsInt("PROCESS_TIMEOUT", 30),
+		StartupTimeout:  getEnvAsInt("STARTUP_TIMEOUT", 60),
+
+		ShutdownDeadline: getEnvAsInt("SHUTDOWN_DEADLINE", 60),
+
+		// Processing lanes
+		FastLaneMaxAmount: getEnvAsFloat("FAST_LANE_MAX_AMOUNT", 0),
+		FastLaneMaxScore:  getEnvAsFloat("FAST_LANE_MAX_SCORE", 0.1),
+		SlowLaneWorkers:   getEnvAsInt("SLOW_LANE_WORKERS", 0),
+
+		StaleMaxAge:        getEnvAsInt("STALE_MAX_AGE_SECONDS", 3600),
+		StaleMaxAgeByType:  getEnvAsIntMap("STALE_MAX_AGE_BY_TYPE", "purchase=900,withdrawal=900,transfer=86400"),
+		StaleAlertInterval: getEnvAsInt("STALE_ALERT_INTERVAL_SECONDS", 300),
 
 		// Monitoring configuration
 		MetricsEnabled: getEnvAsBool("METRICS_ENABLED", true),
 		MetricsPort:    getEnv("METRICS_PORT", "9091"),
+		AdminToken:     getSecret("ADMIN_TOKEN", ""),
+		ChaosEnabled:   getEnvAsBool("CHAOS_ENABLED", false),
+
+		EvaluateRateLimit: getEnvAsInt("EVALUATE_RATE_LIMIT", 60),
 
 		// Business rules configuration
 		RiskThreshold:    getEnvAsFloat("RISK_THRESHOLD", 0.7),
 		MaxAmount:        getEnvAsFloat("MAX_AMOUNT", 100000.0),
 		BlockedCountries: getEnvAsSlice("BLOCKED_COUNTRIES", []string{"XX", "YY"}),
 		BlockedMerchants: getEnvAsSlice("BLOCKED_MERCHANTS", []string{"blocked_merchant_1", "blocked_merchant_2"}),
+		RiskRulesFile:    getEnv("RISK_RULES_FILE", ""),
+
+		TypePoliciesFile: getEnv("TYPE_POLICIES_FILE", ""),
+
+		CanaryRulesFile: getEnv("CANARY_RULES_FILE", ""),
+		CanaryPercent:   getEnvAsFloat("CANARY_SAMPLE_PERCENT", 10),
+		CanaryTopic:     getEnv("KAFKA_CANARY_TOPIC", "rules.canary"),
+
+		MerchantNormalizationFile: getEnv("MERCHANT_NORMALIZATION_FILE", ""),
+
+		SupportedCurrencies: getEnvAsCurrencies("SUPPORTED_CURRENCIES", currency.DefaultSupported),
+
+		// Exchange rates
+		BaseCurrency:         getEnv("BASE_CURRENCY", "USD"),
+		ExchangeRatesFile:    getEnv("EXCHANGE_RATES_FILE", ""),
+		ExchangeRatesURL:     getEnv("EXCHANGE_RATES_URL", ""),
+		ExchangeRatesRefresh: getEnvAsInt("EXCHANGE_RATES_REFRESH_MINUTES", 60),
+
+		// Storage API
+		StorageAPIURL:     getEnv("STORAGE_API_URL", ""),
+		StorageAPIToken:   getSecret("STORAGE_API_TOKEN", ""),
+		StorageAPITimeout: getEnvAsInt("STORAGE_API_TIMEOUT_MS", 2000),
+
+		BlocklistRefreshInterval: getEnvAsInt("BLOCKLIST_REFRESH_SECONDS", 30),
+
+		RedisAddr:        getEnv("REDIS_ADDR", ""),
+		RedisPassword:    getSecret("REDIS_PASSWORD", ""),
+		RedisDB:          getEnvAsInt("REDIS_DB", 0),
+		DeviceHistoryTTL: getEnvAsInt("DEVICE_HISTORY_TTL_DAYS", 180),
+
+		CountryHistoryTTL: getEnvAsInt("COUNTRY_HISTORY_TTL_DAYS", 180),
+		CountryMinHistory: getEnvAsInt("COUNTRY_MIN_HISTORY", 5),
+		CountrySwitchGap:  getEnvAsInt("COUNTRY_SWITCH_GAP_MINUTES", 120),
+
+		RecurrenceHistoryTTL:       getEnvAsInt("RECURRENCE_HISTORY_TTL_DAYS", 100),
+		RecurrenceMinOccurrences:   getEnvAsInt("RECURRENCE_MIN_OCCURRENCES", 3),
+		RecurrenceCadenceTolerance: getEnvAsFloat("RECURRENCE_CADENCE_TOLERANCE", 0.1),
+		RecurrenceAmountTolerance:  getEnvAsFloat("RECURRENCE_AMOUNT_TOLERANCE", 0.05),
+		RecurrenceRiskAdjustment:   getEnvAsFloat("RECURRENCE_RISK_ADJUSTMENT", 0.2),
+		RecurrenceRiskFloor:        getEnvAsFloat("RECURRENCE_RISK_FLOOR", 0.1),
+
+		LagAlertThreshold:     getEnvAsInt("LAG_ALERT_THRESHOLD", 10000),
+		LagAlertSustain:       getEnvAsInt("LAG_ALERT_SUSTAIN_SECONDS", 300),
+		LagAlertRecoveryRatio: getEnvAsFloat("LAG_ALERT_RECOVERY_RATIO", 0.5),
+
+		LogSampleRate:    getEnvAsInt("LOG_SAMPLE_RATE", 100),
+		LogConfigOnStart: getEnvAsBool("LOG_CONFIG_ON_START", false),
 	}
+	cfg.parseErrors, envErrors = envErrors, nil
 
 	return cfg
 }
 
+// Validate checks the configuration and returns every problem found, joined
+// into one error
+func (c *Config) Validate() error {
+	problems := append([]error(nil), c.parseErrors...)
+
+	if !hasBroker(c.KafkaBrokers) {
+		problems = append(problems, errors.New("KAFKA_BROKERS lists no brokers"))
+	}
+	if c.InputTopic == "" || c.OutputTopic == "" {
+		problems = append(problems, errors.New("KAFKA_INPUT_TOPIC and KAFKA_OUTPUT_TOPIC must be set"))
+	}
+	if c.MaxRetries < 0 {
+		problems = append(problems, errors.New("MAX_RETRIES must not be negative"))
+	}
+	if c.MaxRedrives < 1 {
+		problems = append(problems, errors.New("DLQ_MAX_REDRIVES must be positive"))
+	}
+	if c.ExactlyOnce && c.ExactlyOnceScanDepth < c.BatchSize {
+		problems = append(problems, errors.New("EXACTLY_ONCE_SCAN_DEPTH must be at least BATCH_SIZE"))
+	}
+	if err := c.KafkaWriter.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := c.KafkaTopics.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.ExactlyOnce && c.KafkaWriter.RequiredAcks != "" && c.KafkaWriter.RequiredAcks != kafkaconn.AcksAll {
+		problems = append(problems, errors.New("KAFKA_WRITER_REQUIRED_ACKS must be all in exactly-once mode"))
+	}
+	if c.AuditTopic != "" && (c.AuditBufferSize < 1 || c.AuditBatchSize < 1 || c.AuditFlushInterval < 1) {
+		problems = append(problems, errors.New("AUDIT_BUFFER_SIZE, AUDIT_BATCH_SIZE and AUDIT_FLUSH_INTERVAL_MS must be positive"))
+	}
+	if c.CanaryRulesFile != "" && (c.CanaryPercent <= 0 || c.CanaryPercent > 100) {
+		problems = append(problems, errors.New("CANARY_SAMPLE_PERCENT must be above 0 and at most 100"))
+	}
+	if c.CanaryRulesFile != "" && c.CanaryTopic != "" && (c.AuditBufferSize < 1 || c.AuditBatchSize < 1 || c.AuditFlushInterval < 1) {
+		problems = append(problems, errors.New("AUDIT_BUFFER_SIZE, AUDIT_BATCH_SIZE and AUDIT_FLUSH_INTERVAL_MS must be positive, the canary comparisons being buffered like audits"))
+	}
+	if _, ok := currency.Lookup(c.BaseCurrency); !ok {
+		problems = append(problems, fmt.Errorf("BASE_CURRENCY %q is not an ISO 4217 currency", c.BaseCurrency))
+	}
+	if c.ExchangeRatesURL != "" && c.ExchangeRatesRefresh < 1 {
+		problems = append(problems, errors.New("EXCHANGE_RATES_REFRESH_MINUTES must be positive"))
+	}
+	if c.BatchSize < 1 {
+		problems = append(problems, errors.New("BATCH_SIZE must be positive"))
+	}
+	if c.ConsumerWorkers < 1 {
+		problems = append(problems, errors.New("CONSUMER_WORKERS must be positive"))
+	}
+	if c.ProcessTimeout < 1 {
+		problems = append(problems, errors.New("PROCESS_TIMEOUT must be positive"))
+	}
+	if c.StartupTimeout < 1 {
+		problems = append(problems, errors.New("STARTUP_TIMEOUT must be positive"))
+	}
+	if c.ShutdownDeadline < 1 {
+		problems = append(problems, errors.New("SHUTDOWN_DEADLINE must be positive"))
+	}
+	if c.FastLaneMaxAmount < 0 {
+		problems = append(problems, errors.New("FAST_LANE_MAX_AMOUNT must not be negative"))
+	}
+	if c.FastLaneMaxScore < 0 || c.FastLaneMaxScore > 1 {
+		problems = append(problems, errors.New("FAST_LANE_MAX_SCORE must be between 0 and 1"))
+	}
+	if c.SlowLaneWorkers < 0 {
+		problems = append(problems, errors.New("SLOW_LANE_WORKERS must not be negative"))
+	}
+	if c.StaleMaxAge < 0 {
+		problems = append(problems, errors.New("STALE_MAX_AGE_SECONDS must not be negative"))
+	}
+	for txnType, maxAge := range c.StaleMaxAgeByType {
+		if maxAge < 0 {
+			problems = append(problems, fmt.Errorf("STALE_MAX_AGE_BY_TYPE: max age of %s must not be negative", txnType))
+		}
+	}
+	if c.StaleAlertInterval < 1 {
+		problems = append(problems, errors.New("STALE_ALERT_INTERVAL_SECONDS must be positive"))
+	}
+	if c.RiskThreshold < 0 || c.RiskThreshold > 1 {
+		problems = append(problems, errors.New("RISK_THRESHOLD must be between 0 and 1"))
+	}
+	if c.MaxAmount <= 0 {
+		problems = append(problems, errors.New("MAX_AMOUNT must be positive"))
+	}
+	if c.EvaluateRateLimit < 1 {
+		problems = append(problems, errors.New("EVALUATE_RATE_LIMIT must be positive"))
+	}
+	if c.ChaosEnabled && c.AdminToken == "" {
+		problems = append(problems, errors.New("CHAOS_ENABLED requires ADMIN_TOKEN"))
+	}
+	if c.StorageAPIURL != "" && c.StorageAPIToken == "" {
+		problems = append(problems, errors.New("STORAGE_API_URL requires STORAGE_API_TOKEN"))
+	}
+	if c.StorageAPITimeout < 1 {
+		problems = append(problems, errors.New("STORAGE_API_TIMEOUT_MS must be positive"))
+	}
+	if c.BlocklistRefreshInterval < 1 {
+		problems = append(problems, errors.New("BLOCKLIST_REFRESH_SECONDS must be positive"))
+	}
+	if c.DeviceHistoryTTL < 1 {
+		problems = append(problems, errors.New("DEVICE_HISTORY_TTL_DAYS must be positive"))
+	}
+	if c.CountryHistoryTTL < 1 || c.CountryMinHistory < 1 || c.CountrySwitchGap < 1 {
+		problems = append(problems, errors.New("COUNTRY_HISTORY_TTL_DAYS, COUNTRY_MIN_HISTORY and COUNTRY_SWITCH_GAP_MINUTES must be positive"))
+	}
+	if c.RecurrenceHistoryTTL < 1 || c.RecurrenceMinOccurrences < 1 {
+		problems = append(problems, errors.New("RECURRENCE_HISTORY_TTL_DAYS and RECURRENCE_MIN_OCCURRENCES must be positive"))
+	}
+	if c.RecurrenceCadenceTolerance <= 0 || c.RecurrenceCadenceTolerance >= 0.5 || c.RecurrenceAmountTolerance <= 0 || c.RecurrenceAmountTolerance >= 1 {
+		problems = append(problems, errors.New("RECURRENCE_CADENCE_TOLERANCE must be above 0 and below 0.5, RECURRENCE_AMOUNT_TOLERANCE above 0 and below 1"))
+	}
+	if c.RecurrenceRiskAdjustment < 0 || c.RecurrenceRiskAdjustment > 1 || c.RecurrenceRiskFloor < 0 || c.RecurrenceRiskFloor > 1 {
+		problems = append(problems, errors.New("RECURRENCE_RISK_ADJUSTMENT and RECURRENCE_RISK_FLOOR must be between 0 and 1"))
+	}
+	if c.LagAlertThreshold < 0 {
+		problems = append(problems, errors.New("LAG_ALERT_THRESHOLD must not be negative"))
+	}
+	if c.LagAlertSustain < 1 {
+		problems = append(problems, errors.New("LAG_ALERT_SUSTAIN_SECONDS must be positive"))
+	}
+	if c.LagAlertRecoveryRatio <= 0 || c.LagAlertRecoveryRatio >= 1 {
+		problems = append(problems, errors.New("LAG_ALERT_RECOVERY_RATIO must be between 0 and 1"))
+	}
+
+	if c.LogSampleRate < 1 {
+		problems = append(problems, errors.New("LOG_SAMPLE_RATE must be positive"))
+	}
+
+	if err := buckets.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+// OutputTopics returns the specs of the topics the service produces to:
+// processed transactions and operational alerts, dead letters, and the
+// audit and canary topics when they are published
+func (c *Config) OutputTopics() []kafkaconn.TopicSpec {
+	topics := []string{c.OutputTopic, c.DLQTopic, c.AuditTopic}
+	if c.CanaryRulesFile != "" {
+		topics = append(topics, c.CanaryTopic)
+	}
+	return c.KafkaTopics.Specs(topics...)
+}
+
+// String renders the configuration with secrets redacted; the Kafka
+// credentials are left out by kafkaconn.Config
+func (c Config) String() string {
+	type plain Config
+	p := plain(c)
+	p.AdminToken = redact(p.AdminToken)
+	p.StorageAPIToken = redact(p.StorageAPIToken)
+	p.RedisPassword = redact(p.RedisPassword)
+	p.parseErrors = nil
+	return fmt.Sprintf("%+v", p)
+}
+
+// redact hides a secret, keeping whether it was set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// hasBroker reports whether a comma-separated broker list names a broker
+func hasBroker(brokers string) bool {
+	for _, b := range strings.Split(brokers, ",") {
+		if strings.TrimSpace(b) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// envErrors collects the values the helpers fail to parse during LoadConfig
+var envErrors []error
+
+// getSecret reads a secret from key, or from the file named by key_FILE
+func getSecret(key, defaultValue string) string {
+	value, err := secrets.Lookup(key)
+	if err != nil {
+		envErrors = append(envErrors, err)
+		return defaultValue
+	}
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -67,27 +518,36 @@ func getEnv(key, defaultValue string) string {
 
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+			return defaultValue
 		}
+		return intValue
 	}
 	return defaultValue
 }
 
 func getEnvAsFloat(key string, defaultValue float64) float64 {
 	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a number", key, value))
+			return defaultValue
 		}
+		return floatValue
 	}
 	return defaultValue
 }
 
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a boolean", key, value))
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
 }
@@ -99,3 +559,41 @@ func getEnvAsSlice(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// getEnvAsIntMap parses "key=integer,key=integer" pairs, falling back to
+// the default pairs when one is malformed
+func getEnvAsIntMap(key, defaultValue string) map[string]int {
+	parse := func(list string) (map[string]int, error) {
+		values := make(map[string]int)
+		for _, pair := range strings.Split(list, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if k = strings.TrimSpace(k); !ok || k == "" || err != nil {
+				return nil, fmt.Errorf("%s: %q is not key=integer", key, pair)
+			}
+			values[k] = n
+		}
+		return values, nil
+	}
+
+	values, err := parse(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, err)
+		values, _ = parse(defaultValue)
+	}
+	return values
+}
+
+// getEnvAsCurrencies parses a comma-separated list of ISO 4217 codes,
+// falling back to the default list when it is invalid
+func getEnvAsCurrencies(key, defaultValue string) currency.Allowlist {
+	allowed, err := currency.ParseAllowlist(getEnv(key, defaultValue))
+	if err != nil {
+		envErrors = append(envErrors, fmt.Errorf("%s: %w", key, err))
+		allowed, _ = currency.ParseAllowlist(defaultValue)
+	}
+	return allowed
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// validEnv is an environment the configuration validates in
+var validEnv = map[string]string{
+	"KAFKA_BROKERS":              "kafka-1:9092,kafka-2:9092",
+	"BATCH_SIZE":                 "",
+	"RISK_THRESHOLD":             "",
+	"CHAOS_ENABLED":              "",
+	"ADMIN_TOKEN":                "",
+	"STORAGE_API_URL":            "",
+	"STORAGE_API_TOKEN":          "",
+	"STALE_MAX_AGE_BY_TYPE":      "",
+	"BASE_CURRENCY":              "",
+	"REDIS_PASSWORD":             "",
+	"SUPPORTED_CURRENCIES":       "",
+	"COUNTRY_MIN_HISTORY":        "",
+	"COUNTRY_SWITCH_GAP_MINUTES": "",
+	"DEVICE_HISTORY_TTL_DAYS":    "",
+	"LAG_ALERT_THRESHOLD":        "",
+	"LAG_ALERT_SUSTAIN_SECONDS":  "",
+	"LAG_ALERT_RECOVERY_RATIO":   "",
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "valid"},
+		{
+			name: "unparsable numbers are reported, not defaulted",
+			env:  map[string]string{"BATCH_SIZE": "lots", "RISK_THRESHOLD": "high"},
+			want: []string{`BATCH_SIZE: "lots" is not an integer`, `RISK_THRESHOLD: "high" is not a number`},
+		},
+		{
+			name: "unparsable boolean",
+			env:  map[string]string{"CHAOS_ENABLED": "maybe"},
+			want: []string{`CHAOS_ENABLED: "maybe" is not a boolean`},
+		},
+		{
+			name: "unparsable max ages",
+			env:  map[string]string{"STALE_MAX_AGE_BY_TYPE": "purchase"},
+			want: []string{`STALE_MAX_AGE_BY_TYPE: "purchase" is not key=integer`},
+		},
+		{
+			name: "no brokers",
+			env:  map[string]string{"KAFKA_BROKERS": " , "},
+			want: []string{"KAFKA_BROKERS lists no brokers"},
+		},
+		{
+			name: "chaos without an admin token",
+			env:  map[string]string{"CHAOS_ENABLED": "true"},
+			want: []string{"CHAOS_ENABLED requires ADMIN_TOKEN"},
+		},
+		{
+			name: "chaos with an admin token",
+			env:  map[string]string{"CHAOS_ENABLED": "true", "ADMIN_TOKEN": "admin-token"},
+		},
+		{
+			name: "storage API without a token",
+			env:  map[string]string{"STORAGE_API_URL": "http://storage-service:8082"},
+			want: []string{"STORAGE_API_URL requires STORAGE_API_TOKEN"},
+		},
+		{
+			name: "unknown currencies",
+			env:  map[string]string{"SUPPORTED_CURRENCIES": "USD,XYZ"},
+			want: []string{"SUPPORTED_CURRENCIES: unknown ISO 4217 currency codes: XYZ"},
+		},
+		{
+			name: "currencies beyond the default",
+			env:  map[string]string{"SUPPORTED_CURRENCIES": "usd,jpy,bhd"},
+		},
+		{
+			name: "device history kept for no time",
+			env:  map[string]string{"DEVICE_HISTORY_TTL_DAYS": "0"},
+			want: []string{"DEVICE_HISTORY_TTL_DAYS must be positive"},
+		},
+		{
+			name: "country rule without a history",
+			env:  map[string]string{"COUNTRY_MIN_HISTORY": "0", "COUNTRY_SWITCH_GAP_MINUTES": "-30"},
+			want: []string{"COUNTRY_HISTORY_TTL_DAYS, COUNTRY_MIN_HISTORY and COUNTRY_SWITCH_GAP_MINUTES must be positive"},
+		},
+		{
+			name: "lag alerts recovering at the threshold",
+			env:  map[string]string{"LAG_ALERT_THRESHOLD": "-1", "LAG_ALERT_SUSTAIN_SECONDS": "0", "LAG_ALERT_RECOVERY_RATIO": "1"},
+			want: []string{"LAG_ALERT_THRESHOLD must not be negative", "LAG_ALERT_SUSTAIN_SECONDS must be positive",
+				"LAG_ALERT_RECOVERY_RATIO must be between 0 and 1"},
+		},
+		{
+			name: "lag alerts disabled",
+			env:  map[string]string{"LAG_ALERT_THRESHOLD": "0"},
+		},
+		{
+			name: "exactly once reading back less than a batch",
+			env:  map[string]string{"EXACTLY_ONCE": "true", "EXACTLY_ONCE_SCAN_DEPTH": "50", "BATCH_SIZE": "100"},
+			want: []string{"EXACTLY_ONCE_SCAN_DEPTH must be at least BATCH_SIZE"},
+		},
+		{
+			name: "audits never flushed",
+			env:  map[string]string{"AUDIT_FLUSH_INTERVAL_MS": "0", "AUDIT_BATCH_SIZE": "-1"},
+			want: []string{"AUDIT_BUFFER_SIZE, AUDIT_BATCH_SIZE and AUDIT_FLUSH_INTERVAL_MS must be positive"},
+		},
+		{
+			name: "lanes out of range",
+			env:  map[string]string{"FAST_LANE_MAX_AMOUNT": "-1", "FAST_LANE_MAX_SCORE": "1.5", "SLOW_LANE_WORKERS": "-2"},
+			want: []string{
+				"FAST_LANE_MAX_AMOUNT must not be negative",
+				"FAST_LANE_MAX_SCORE must be between 0 and 1",
+				"SLOW_LANE_WORKERS must not be negative",
+			},
+		},
+		{
+			name: "no time to wait for dependencies",
+			env:  map[string]string{"STARTUP_TIMEOUT": "0"},
+			want: []string{"STARTUP_TIMEOUT must be positive"},
+		},
+		{
+			name: "writer tuning out of range",
+			env:  map[string]string{"KAFKA_WRITER_COMPRESSION": "brotli", "KAFKA_WRITER_REQUIRED_ACKS": "quorum"},
+			want: []string{`KAFKA_WRITER_COMPRESSION: "brotli"`, `KAFKA_WRITER_REQUIRED_ACKS: "quorum"`},
+		},
+		{
+			name: "exactly once without every replica acknowledging",
+			env:  map[string]string{"EXACTLY_ONCE": "true", "KAFKA_WRITER_REQUIRED_ACKS": "one"},
+			want: []string{"KAFKA_WRITER_REQUIRED_ACKS must be all in exactly-once mode"},
+		},
+		{
+			name: "stale transactions checked against negative ages",
+			env:  map[string]string{"STALE_MAX_AGE_SECONDS": "-1", "STALE_MAX_AGE_BY_TYPE": "purchase=900,transfer=-5", "STALE_ALERT_INTERVAL_SECONDS": "0"},
+			want: []string{
+				"STALE_MAX_AGE_SECONDS must not be negative",
+				"STALE_MAX_AGE_BY_TYPE: max age of transfer must not be negative",
+				"STALE_ALERT_INTERVAL_SECONDS must be positive",
+			},
+		},
+		{
+			name: "base currency outside ISO 4217",
+			env:  map[string]string{"BASE_CURRENCY": "XYZ", "EXCHANGE_RATES_URL": "https://rates.example.com/latest", "EXCHANGE_RATES_REFRESH_MINUTES": "0"},
+			want: []string{`BASE_CURRENCY "XYZ" is not an ISO 4217 currency`, "EXCHANGE_RATES_REFRESH_MINUTES must be positive"},
+		},
+		{
+			name: "rates from a file, never refreshed",
+			env:  map[string]string{"BASE_CURRENCY": "EUR", "EXCHANGE_RATES_FILE": "/etc/rates.json", "EXCHANGE_RATES_REFRESH_MINUTES": "0"},
+		},
+		{
+			name: "canary sample out of range",
+			env:  map[string]string{"CANARY_RULES_FILE": "/etc/canary-rules.json", "CANARY_SAMPLE_PERCENT": "150"},
+			want: []string{"CANARY_SAMPLE_PERCENT must be above 0 and at most 100"},
+		},
+		{
+			name: "canary comparisons without a buffer",
+			env:  map[string]string{"CANARY_RULES_FILE": "/etc/canary-rules.json", "AUDIT_BUFFER_SIZE": "0"},
+			want: []string{"the canary comparisons being buffered like audits"},
+		},
+		{
+			name: "canary sample ignored without canary rules",
+			env:  map[string]string{"CANARY_SAMPLE_PERCENT": "0"},
+		},
+		{
+			name: "recurrence history that keeps nothing",
+			env:  map[string]string{"RECURRENCE_HISTORY_TTL_DAYS": "0"},
+			want: []string{"RECURRENCE_HISTORY_TTL_DAYS and RECURRENCE_MIN_OCCURRENCES must be positive"},
+		},
+		{
+			name: "recurrence tolerances and adjustment out of range",
+			env: map[string]string{"RECURRENCE_CADENCE_TOLERANCE": "0.5", "RECURRENCE_AMOUNT_TOLERANCE": "0",
+				"RECURRENCE_RISK_FLOOR": "1.5"},
+			want: []string{"RECURRENCE_CADENCE_TOLERANCE must be above 0 and below 0.5, RECURRENCE_AMOUNT_TOLERANCE above 0 and below 1",
+				"RECURRENCE_RISK_ADJUSTMENT and RECURRENCE_RISK_FLOOR must be between 0 and 1"},
+		},
+		{
+			name: "histogram buckets that do not parse",
+			env:  map[string]string{"METRICS_BUCKETS_TRANSACTION_PROCESSING_DURATION_SECONDS": "0.001,fast"},
+			want: []string{`METRICS_BUCKETS_TRANSACTION_PROCESSING_DURATION_SECONDS: "fast" is not a number`},
+		},
+		{
+			name: "histogram buckets configured",
+			env:  map[string]string{"METRICS_BUCKETS_KAFKA_PUBLISH_DURATION_SECONDS": "0.001,0.01,0.1"},
+		},
+		{
+			name: "no time to shut down",
+			env:  map[string]string{"SHUTDOWN_DEADLINE": "0"},
+			want: []string{"SHUTDOWN_DEADLINE must be positive"},
+		},
+		{
+			name: "topic partitions that are not positive",
+			env:  map[string]string{"KAFKA_TOPIC_PARTITIONS": "0"},
+			want: []string{"KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive"},
+		},
+		{
+			name: "topic spec that does not parse",
+			env:  map[string]string{"KAFKA_TOPIC_SPECS": "transactions.processed=12:x"},
+			want: []string{`KAFKA_TOPIC_SPECS: "transactions.processed=12:x" is not topic=partitions:replication:retention_ms`},
+		},
+		{
+			name: "topics provisioned strictly",
+			env:  map[string]string{"TOPIC_AUTOCREATE": "true", "TOPIC_STRICT": "true", "KAFKA_TOPIC_SPECS": "transactions.processed=1::2592000000"},
+		},
+		{
+			name: "every problem at once",
+			env:  map[string]string{"KAFKA_BROKERS": ",", "BATCH_SIZE": "0", "RISK_THRESHOLD": "1.5", "BASE_CURRENCY": "XYZ"},
+			want: []string{"KAFKA_BROKERS lists no brokers", "BATCH_SIZE must be positive", "RISK_THRESHOLD must be between 0 and 1",
+				`BASE_CURRENCY "XYZ" is not an ISO 4217 currency`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range validEnv {
+				t.Setenv(k, v)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			err := LoadConfig().Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	for k, v := range validEnv {
+		t.Setenv(k, v)
+	}
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	t.Setenv("STORAGE_API_TOKEN", "storage-token")
+	t.Setenv("REDIS_PASSWORD", "redis-password")
+
+	got := LoadConfig().String()
+	for _, secret := range []string{"admin-token", "storage-token", "redis-password"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("String() = %s, leaks %q", got, secret)
+		}
+	}
+	if !strings.Contains(got, "kafka-1:9092,kafka-2:9092") || !strings.Contains(got, "AdminToken:[redacted]") {
+		t.Errorf("String() = %s, want the brokers and the redacted token", got)
+	}
+}
+
+func TestOutputTopics(t *testing.T) {
+	for k, v := range validEnv {
+		t.Setenv(k, v)
+	}
+	t.Setenv("KAFKA_TOPIC_SPECS", "transactions.raw.dlq=1")
+
+	tests := []struct {
+		name        string
+		canaryRules string
+		want        string
+	}{
+		{"without canary rules", "", "transactions.processed:6 transactions.raw.dlq:1 transactions.audit:6"},
+		{"with canary rules", "/etc/canary-rules.json", "transactions.processed:6 transactions.raw.dlq:1 transactions.audit:6 rules.canary:6"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CANARY_RULES_FILE", tt.canaryRules)
+		var got []string
+		for _, spec := range LoadConfig().OutputTopics() {
+			got = append(got, fmt.Sprintf("%s:%d", spec.Name, spec.Partitions))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: OutputTopics = %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//go:build integration
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+// The provisioning tests create the output topics on Kafka in a container:
+//
+//	go test -tags=integration ./internal/config/
+
+// brokers are the comma-separated brokers of the container
+var brokers string
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	container, err := tckafka.Run(ctx, "confluentinc/confluent-local:7.5.0", tckafka.WithClusterID("provisioning"))
+	if err != nil {
+		log.Fatalf("failed to start kafka: %v", err)
+	}
+	addrs, err := container.Brokers(ctx)
+	if err != nil {
+		log.Fatalf("failed to get kafka brokers: %v", err)
+	}
+	brokers = strings.Join(addrs, ",")
+
+	code := m.Run()
+	if err := testcontainers.TerminateContainer(container); err != nil {
+		log.Printf("failed to terminate kafka: %v", err)
+	}
+	os.Exit(code)
+}
+
+// provision provisions the output topics of the configuration loaded from
+// the environment, logging to logs
+func provision(t *testing.T, logs *bytes.Buffer) error {
+	t.Helper()
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	conn, err := cfg.KafkaSecurity.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return cfg.KafkaTopics.ProvisionTopics(ctx, conn, consumer.ParseBrokers(brokers), cfg.OutputTopics(), slog.New(slog.NewTextHandler(logs, nil)))
+}
+
+// describeTopic returns the partition count and retention.ms of a topic,
+// waiting for the cluster to list it
+func describeTopic(t *testing.T, name string) (partitions int, retention string) {
+	t.Helper()
+	ctx := context.Background()
+	client := &kafka.Client{Addr: kafka.TCP(consumer.ParseBrokers(brokers)...)}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{name}})
+		if err == nil && len(metadata.Topics) == 1 && metadata.Topics[0].Error == nil {
+			partitions = len(metadata.Topics[0].Partitions)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("topic %s not listed: %v", name, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: []kafka.DescribeConfigRequestResource{{
+		ResourceType: kafka.ResourceTypeTopic,
+		ResourceName: name,
+		ConfigNames:  []string{"retention.ms"},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to describe %s: %v", name, err)
+	}
+	for _, resource := range resp.Resources {
+		for _, entry := range resource.ConfigEntries {
+			if entry.ConfigName == "retention.ms" {
+				retention = entry.ConfigValue
+			}
+		}
+	}
+	return partitions, retention
+}
+
+func TestProvisionTopics(t *testing.T) {
+	for k, v := range validEnv {
+		t.Setenv(k, v)
+	}
+	t.Setenv("KAFKA_BROKERS", brokers)
+	t.Setenv("KAFKA_OUTPUT_TOPIC", "provisioned.processed")
+	t.Setenv("KAFKA_DLQ_TOPIC", "provisioned.dlq")
+	t.Setenv("KAFKA_AUDIT_TOPIC", "provisioned.audit")
+	t.Setenv("TOPIC_AUTOCREATE", "true")
+	t.Setenv("KAFKA_TOPIC_PARTITIONS", "3")
+	t.Setenv("KAFKA_TOPIC_RETENTION_MS", "3600000")
+	t.Setenv("KAFKA_TOPIC_SPECS", "provisioned.dlq=1::86400000")
+
+	var logs bytes.Buffer
+	if err := provision(t, &logs); err != nil {
+		t.Fatalf("ProvisionTopics: %v", err)
+	}
+	tests := []struct {
+		topic      string
+		partitions int
+		retention  string
+	}{
+		{"provisioned.processed", 3, "3600000"},
+		{"provisioned.audit", 3, "3600000"},
+		{"provisioned.dlq", 1, "86400000"},
+	}
+	for _, tt := range tests {
+		if partitions, retention := describeTopic(t, tt.topic); partitions != tt.partitions || retention != tt.retention {
+			t.Errorf("%s has %d partitions and retention.ms %s, want %d and %s", tt.topic, partitions, retention, tt.partitions, tt.retention)
+		}
+	}
+	if strings.Count(logs.String(), "topic created") != 3 {
+		t.Errorf("logs %s, want the 3 topics reported created", logs.String())
+	}
+
+	// Topics matching their spec are left alone, without a warning
+	logs.Reset()
+	if err := provision(t, &logs); err != nil {
+		t.Fatalf("ProvisionTopics again: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("logs %s, want nothing to report", logs.String())
+	}
+
+	// A mismatch is logged, and the topic never altered
+	t.Setenv("KAFKA_TOPIC_PARTITIONS", "4")
+	t.Setenv("KAFKA_TOPIC_SPECS", "provisioned.dlq=1::604800000")
+	if err := provision(t, &logs); err != nil {
+		t.Fatalf("ProvisionTopics() = %v, want the mismatch only logged", err)
+	}
+	for _, want := range []string{
+		`topic=provisioned.processed problem="has 3 partitions, spec has 4"`,
+		`topic=provisioned.dlq problem="has retention.ms 86400000, spec has 604800000"`,
+	} {
+		if !strings.Contains(logs.String(), "topic does not match its spec") || !strings.Contains(logs.String(), want) {
+			t.Errorf("logs %s, want a warning of %s", logs.String(), want)
+		}
+	}
+	if partitions, _ := describeTopic(t, "provisioned.processed"); partitions != 3 {
+		t.Errorf("provisioned.processed has %d partitions, want it unaltered", partitions)
+	}
+
+	// Strict, the mismatch fails the startup
+	t.Setenv("TOPIC_STRICT", "true")
+	err := provision(t, &logs)
+	if err == nil || !strings.Contains(err.Error(), "topic provisioned.audit: has 3 partitions, spec has 4") {
+		t.Errorf("ProvisionTopics() = %v, want the mismatch returned", err)
+	}
+}
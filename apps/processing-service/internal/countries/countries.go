@@ -0,0 +1,96 @@
+// Package countries tracks the countries each account transacts in, so that
+// a transaction away from the account's home country, or too soon after one
+// in another country, can be scored as riskier.
+package countries
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Fields of an account's history hash besides the per-country counts,
+// which are prefixed with countPrefix
+const (
+	countPrefix      = "n:"
+	fieldLastCountry = "last_country"
+	fieldLastAt      = "last_at"
+)
+
+// History is the per-account count of transactions by country, with the
+// country and time of the last one, kept in Redis. Each history expires ttl
+// after the account's last transaction.
+type History struct {
+	client     *redis.Client
+	ttl        time.Duration
+	minHistory int64
+	minGap     time.Duration
+}
+
+// NewHistory creates a country history in client. An account has a home
+// country once minHistory of its transactions are recorded; a transaction
+// less than minGap after one in another country counts as a switch.
+func NewHistory(client *redis.Client, ttl time.Duration, minHistory int, minGap time.Duration) *History {
+	return &History{client: client, ttl: ttl, minHistory: int64(minHistory), minGap: minGap}
+}
+
+// key returns the Redis key of an account's history
+func key(accountID string) string {
+	return "countries:" + accountID
+}
+
+// Compare compares a transaction in country at the given time with the
+// account's history
+func (h *History) Compare(ctx context.Context, accountID, country string, at time.Time) (models.CountryFacts, error) {
+	fields, err := h.client.HGetAll(ctx, key(accountID)).Result()
+	if err != nil {
+		return models.CountryFacts{}, fmt.Errorf("failed to look up country history: %w", err)
+	}
+
+	var facts models.CountryFacts
+	var total, best int64
+	for field, value := range fields {
+		c, ok := strings.CutPrefix(field, countPrefix)
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		total += n
+		// Ties go to the first country alphabetically, so the home
+		// country does not depend on map order
+		if n > best || (n == best && c < facts.Home) {
+			facts.Home, best = c, n
+		}
+	}
+	if total < h.minHistory {
+		facts.Home = ""
+	}
+
+	facts.Previous = fields[fieldLastCountry]
+	if lastAt, err := strconv.ParseInt(fields[fieldLastAt], 10, 64); err == nil && facts.Previous != "" {
+		gap := at.Sub(time.Unix(lastAt, 0)).Abs()
+		facts.Switched = facts.Previous != country && gap < h.minGap
+	}
+	return facts, nil
+}
+
+// Record adds a transaction in country at the given time to the account's
+// history
+func (h *History) Record(ctx context.Context, accountID, country string, at time.Time) error {
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key(accountID), countPrefix+country, 1)
+		pipe.HSet(ctx, key(accountID), fieldLastCountry, country, fieldLastAt, at.Unix())
+		pipe.Expire(ctx, key(accountID), h.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record country: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package countries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestHistory returns a country history in a Redis stand-in, giving
+// accounts a home country after 3 transactions and counting a change of
+// country within 2 hours as a switch
+func newTestHistory(t *testing.T) (*History, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewHistory(client, 30*24*time.Hour, 3, 2*time.Hour), mr
+}
+
+func TestCompareSyntheticSequences(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	type visit struct {
+		country string
+		after   time.Duration // since the previous transaction
+	}
+
+	tests := []struct {
+		name    string
+		history []visit
+		country string
+		after   time.Duration
+		want    models.CountryFacts
+	}{
+		{
+			name:    "first transaction",
+			country: "US",
+			want:    models.CountryFacts{},
+		},
+		{
+			name:    "history too short for a home country",
+			history: []visit{{"US", 0}, {"US", 24 * time.Hour}},
+			country: "FR",
+			after:   24 * time.Hour,
+			want:    models.CountryFacts{Previous: "US"},
+		},
+		{
+			name:    "consistent country",
+			history: []visit{{"US", 0}, {"US", 24 * time.Hour}, {"US", 24 * time.Hour}},
+			country: "US",
+			after:   time.Hour,
+			want:    models.CountryFacts{Home: "US", Previous: "US"},
+		},
+		{
+			name:    "away from home after travelling time",
+			history: []visit{{"US", 0}, {"US", 24 * time.Hour}, {"US", 24 * time.Hour}},
+			country: "FR",
+			after:   12 * time.Hour,
+			want:    models.CountryFacts{Home: "US", Previous: "US"},
+		},
+		{
+			name:    "sudden switch",
+			history: []visit{{"US", 0}, {"US", 24 * time.Hour}, {"US", 24 * time.Hour}},
+			country: "FR",
+			after:   30 * time.Minute,
+			want:    models.CountryFacts{Home: "US", Previous: "US", Switched: true},
+		},
+		{
+			name:    "back home soon after a switch",
+			history: []visit{{"US", 0}, {"US", 24 * time.Hour}, {"US", 24 * time.Hour}, {"FR", 30 * time.Minute}},
+			country: "US",
+			after:   30 * time.Minute,
+			want:    models.CountryFacts{Home: "US", Previous: "FR", Switched: true},
+		},
+		{
+			name:    "home country is the most frequent",
+			history: []visit{{"US", 0}, {"GB", 24 * time.Hour}, {"GB", 24 * time.Hour}, {"US", 24 * time.Hour}, {"GB", 24 * time.Hour}},
+			country: "GB",
+			after:   24 * time.Hour,
+			want:    models.CountryFacts{Home: "GB", Previous: "GB"},
+		},
+		{
+			name:    "ties go to the first country alphabetically",
+			history: []visit{{"US", 0}, {"GB", 24 * time.Hour}, {"US", 24 * time.Hour}, {"GB", 24 * time.Hour}},
+			country: "GB",
+			after:   24 * time.Hour,
+			want:    models.CountryFacts{Home: "GB", Previous: "GB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, _ := newTestHistory(t)
+			at := start
+			for _, v := range tt.history {
+				at = at.Add(v.after)
+				if err := h.Record(ctx, "acct-1", v.country, at); err != nil {
+					t.Fatalf("Record: %v", err)
+				}
+			}
+			got, err := h.Compare(ctx, "acct-1", tt.country, at.Add(tt.after))
+			if err != nil {
+				t.Fatalf("Compare: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Compare = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoriesArePerAccountAndExpire(t *testing.T) {
+	ctx := context.Background()
+	h, mr := newTestHistory(t)
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for range 3 {
+		if err := h.Record(ctx, "acct-1", "US", at); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	if got, _ := h.Compare(ctx, "acct-2", "FR", at); got != (models.CountryFacts{}) {
+		t.Errorf("another account compared as %+v, want no history", got)
+	}
+	if ttl := mr.TTL("countries:acct-1"); ttl != 30*24*time.Hour {
+		t.Errorf("TTL %s, want 30 days", ttl)
+	}
+	mr.FastForward(31 * 24 * time.Hour)
+	if got, _ := h.Compare(ctx, "acct-1", "FR", at); got != (models.CountryFacts{}) {
+		t.Errorf("expired history compared as %+v, want none", got)
+	}
+}
+
+func TestHistoryFailsWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	h, mr := newTestHistory(t)
+	mr.Close()
+
+	if _, err := h.Compare(ctx, "acct-1", "US", time.Now()); err == nil {
+		t.Error("Compare succeeded with Redis down")
+	}
+	if err := h.Record(ctx, "acct-1", "US", time.Now()); err == nil {
+		t.Error("Record succeeded with Redis down")
+	}
+}
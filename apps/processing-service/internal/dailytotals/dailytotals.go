@@ -0,0 +1,61 @@
+// Package dailytotals keeps the total amount each account transacts each
+// day, by transaction type and currency, so that a type can be capped per
+// account and day.
+package dailytotals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ttl keeps a day's total past the day, so late transactions of the day
+// still find it
+const ttl = 48 * time.Hour
+
+// Totals are the daily totals of accounts, kept in Redis
+type Totals struct {
+	client *redis.Client
+}
+
+// New creates daily totals in client
+func New(client *redis.Client) *Totals {
+	return &Totals{client: client}
+}
+
+// key returns the Redis key of an account's total of a type and currency on
+// the UTC day of day
+func key(accountID, txnType, currency string, day time.Time) string {
+	return fmt.Sprintf("daily:%s:%s:%s:%s", accountID, txnType, currency, day.UTC().Format(time.DateOnly))
+}
+
+// Total returns the account's total of a type and currency on the day of
+// day, zero when it has none
+func (t *Totals) Total(ctx context.Context, accountID, txnType, currency string, day time.Time) (float64, error) {
+	total, err := t.client.Get(ctx, key(accountID, txnType, currency, day)).Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up daily total: %w", err)
+	}
+	return total, nil
+}
+
+// Add adds amount to the account's total of a type and currency on the day
+// of day
+func (t *Totals) Add(ctx context.Context, accountID, txnType, currency string, day time.Time, amount float64) error {
+	k := key(accountID, txnType, currency, day)
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrByFloat(ctx, k, amount)
+		pipe.Expire(ctx, k, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add to daily total: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package dailytotals
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestTotals returns daily totals in a Redis stand-in
+func newTestTotals(t *testing.T) (*Totals, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client), mr
+}
+
+func TestTotals(t *testing.T) {
+	ctx := context.Background()
+	totals, mr := newTestTotals(t)
+	morning := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	if total, err := totals.Total(ctx, "acct-1", "withdrawal", "USD", morning); err != nil || total != 0 {
+		t.Fatalf("Total = %v, %v, want 0 before any withdrawal", total, err)
+	}
+	for _, amount := range []float64{1200.50, 800.25} {
+		if err := totals.Add(ctx, "acct-1", "withdrawal", "USD", morning, amount); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	// Late in the evening in New York is the next UTC day
+	newYork := time.FixedZone("EST", -5*60*60)
+	if err := totals.Add(ctx, "acct-1", "withdrawal", "USD", time.Date(2026, 3, 2, 21, 0, 0, 0, newYork), 100); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		account  string
+		txnType  string
+		currency string
+		day      time.Time
+		want     float64
+	}{
+		{"same day", "acct-1", "withdrawal", "USD", morning.Add(14 * time.Hour), 2000.75},
+		{"next UTC day", "acct-1", "withdrawal", "USD", morning.Add(24 * time.Hour), 100},
+		{"another account", "acct-2", "withdrawal", "USD", morning, 0},
+		{"another type", "acct-1", "transfer", "USD", morning, 0},
+		{"another currency", "acct-1", "withdrawal", "EUR", morning, 0},
+	}
+	for _, tt := range tests {
+		if total, err := totals.Total(ctx, tt.account, tt.txnType, tt.currency, tt.day); err != nil || total != tt.want {
+			t.Errorf("%s: Total = %v, %v, want %v", tt.name, total, err, tt.want)
+		}
+	}
+
+	// A day's total outlives the day, then expires
+	k := "daily:acct-1:withdrawal:USD:2026-03-02"
+	if ttl := mr.TTL(k); ttl != 48*time.Hour {
+		t.Errorf("TTL of %s = %s, want 48h", k, ttl)
+	}
+	mr.FastForward(48 * time.Hour)
+	if total, err := totals.Total(ctx, "acct-1", "withdrawal", "USD", morning); err != nil || total != 0 {
+		t.Errorf("Total = %v, %v, want the expired total gone", total, err)
+	}
+}
+
+func TestTotalsReportRedisFailures(t *testing.T) {
+	ctx := context.Background()
+	totals, mr := newTestTotals(t)
+	mr.Close()
+
+	if _, err := totals.Total(ctx, "acct-1", "withdrawal", "USD", time.Now()); err == nil {
+		t.Error("Total() = nil error, want the failed lookup reported")
+	}
+	if err := totals.Add(ctx, "acct-1", "withdrawal", "USD", time.Now(), 10); err == nil {
+		t.Error("Add() = nil error, want the failed update reported")
+	}
+}
@@ -0,0 +1,106 @@
+// Package devices remembers the devices each user has transacted from, by a
+// fingerprint of the device info, so that a transaction from a device never
+// seen before can be scored as riskier.
+package devices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+// History is the per-user set of device fingerprints, kept in Redis. Each
+// set expires ttl after the user's last transaction from a new device.
+type History struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewHistory creates a device history in client
+func NewHistory(client *redis.Client, ttl time.Duration) *History {
+	return &History{client: client, ttl: ttl}
+}
+
+// Fingerprint hashes device info, so the history holds no raw device data
+func Fingerprint(deviceInfo string) string {
+	sum := sha256.Sum256([]byte(deviceInfo))
+	return hex.EncodeToString(sum[:16])
+}
+
+// key returns the Redis key of a user's devices
+func key(userID string) string {
+	return "devices:" + userID
+}
+
+// Known reports whether the user has transacted from the device before
+func (h *History) Known(ctx context.Context, userID, deviceInfo string) (bool, error) {
+	known, err := h.client.SIsMember(ctx, key(userID), Fingerprint(deviceInfo)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to look up device: %w", err)
+	}
+	return known, nil
+}
+
+// Remember adds the device to the user's history
+func (h *History) Remember(ctx context.Context, userID, deviceInfo string) error {
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key(userID), Fingerprint(deviceInfo))
+		pipe.Expire(ctx, key(userID), h.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remember device: %w", err)
+	}
+	return nil
+}
+
+// Clear forgets every device of the user, as after an account recovery, and
+// returns how many there were
+func (h *History) Clear(ctx context.Context, userID string) (int64, error) {
+	var count *redis.IntCmd
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.SCard(ctx, key(userID))
+		pipe.Del(ctx, key(userID))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear device history: %w", err)
+	}
+	return count.Val(), nil
+}
+
+// Handler serves DELETE /admin/devices/{user_id}, clearing the user's device
+// history, authenticated by token as a bearer token; an empty token refuses
+// every request
+func Handler(h *History, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /admin/devices/{user_id}", func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("user_id")
+		cleared, err := h.Clear(r.Context(), userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to clear device history", "user_id", userID, "error", err)
+			http.Error(w, "failed to clear device history", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "device history cleared", "user_id", userID, "devices", cleared, "remote_addr", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "cleared": cleared})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package devices
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testAdminToken = "admin-token"
+
+// newTestHistory returns a device history in a Redis stand-in, with a
+// 180-day TTL
+func newTestHistory(t *testing.T) (*History, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewHistory(client, 180*24*time.Hour), mr
+}
+
+func TestHistoryRemembersDevicesPerUser(t *testing.T) {
+	ctx := context.Background()
+	h, mr := newTestHistory(t)
+	const phone = "iPhone 15; iOS 19.1; Safari"
+
+	if known, err := h.Known(ctx, "user-1", phone); err != nil || known {
+		t.Fatalf("Known before any transaction = %v, %v, want a new device", known, err)
+	}
+	if err := h.Remember(ctx, "user-1", phone); err != nil {
+		t.Fatalf("Remember: %v", err)
+	}
+	if known, err := h.Known(ctx, "user-1", phone); err != nil || !known {
+		t.Errorf("Known once remembered = %v, %v, want a known device", known, err)
+	}
+	// Devices are per user
+	if known, _ := h.Known(ctx, "user-2", phone); known {
+		t.Error("device known to another user")
+	}
+
+	// Only the fingerprint is kept, expiring after the TTL
+	members, err := mr.Members("devices:user-1")
+	if err != nil || len(members) != 1 || members[0] != Fingerprint(phone) || strings.Contains(members[0], "iPhone") {
+		t.Errorf("stored %v, %v, want only the fingerprint of the device", members, err)
+	}
+	if ttl := mr.TTL("devices:user-1"); ttl != 180*24*time.Hour {
+		t.Errorf("TTL %s, want 180 days", ttl)
+	}
+	mr.FastForward(181 * 24 * time.Hour)
+	if known, _ := h.Known(ctx, "user-1", phone); known {
+		t.Error("device known after the history expired")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, b := Fingerprint("Pixel 9; Android 16"), Fingerprint("Pixel 9; Android 16")
+	if a != b || len(a) != 32 {
+		t.Errorf("Fingerprint = %q and %q, want the same 32 hex digits", a, b)
+	}
+	if Fingerprint("Pixel 9; Android 17") == a {
+		t.Error("different devices share a fingerprint")
+	}
+}
+
+func TestHistoryFailsWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	h, mr := newTestHistory(t)
+	mr.Close()
+
+	if _, err := h.Known(ctx, "user-1", "Pixel 9"); err == nil {
+		t.Error("Known succeeded with Redis down")
+	}
+	if err := h.Remember(ctx, "user-1", "Pixel 9"); err == nil {
+		t.Error("Remember succeeded with Redis down")
+	}
+	if _, err := h.Clear(ctx, "user-1"); err == nil {
+		t.Error("Clear succeeded with Redis down")
+	}
+}
+
+func TestHandlerClearsTheHistory(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHistory(t)
+	for _, device := range []string{"Pixel 9", "iPad Air"} {
+		if err := h.Remember(ctx, "user-1", device); err != nil {
+			t.Fatalf("Remember: %v", err)
+		}
+	}
+	if err := h.Remember(ctx, "user-2", "Pixel 9"); err != nil {
+		t.Fatalf("Remember: %v", err)
+	}
+	handler := Handler(h, testAdminToken)
+
+	clearHistory := func(authorization string) (int, string) {
+		r := httptest.NewRequest(http.MethodDelete, "/admin/devices/user-1", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	for _, authorization := range []string{"", "Bearer guess", testAdminToken} {
+		if status, _ := clearHistory(authorization); status != http.StatusUnauthorized {
+			t.Errorf("clear with %q = %d, want 401", authorization, status)
+		}
+	}
+	if known, _ := h.Known(ctx, "user-1", "Pixel 9"); !known {
+		t.Fatal("unauthenticated request cleared the history")
+	}
+
+	status, body := clearHistory("Bearer " + testAdminToken)
+	if status != http.StatusOK || body != `{"cleared":2,"user_id":"user-1"}` {
+		t.Fatalf("clear = %d %s, want 200 with 2 devices cleared", status, body)
+	}
+	if known, _ := h.Known(ctx, "user-1", "Pixel 9"); known {
+		t.Error("device still known after the history was cleared")
+	}
+	if known, _ := h.Known(ctx, "user-2", "Pixel 9"); !known {
+		t.Error("another user's history cleared")
+	}
+	if status, body := clearHistory("Bearer " + testAdminToken); status != http.StatusOK || body != `{"cleared":0,"user_id":"user-1"}` {
+		t.Errorf("clear of an empty history = %d %s, want 0 cleared", status, body)
+	}
+
+	// An empty token refuses every request
+	r := httptest.NewRequest(http.MethodDelete, "/admin/devices/user-2", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	Handler(h, "").ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("clear without an admin token configured = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,309 @@
+// Package exactlyonce keeps the processing service from publishing a raw
+// transaction twice when it is redelivered, such as after a crash between
+// publishing it and committing its offset. Each processed transaction names
+// the raw transaction it came from in its source headers. Before handling a
+// partition it has not handled, or has not handled since another consumer
+// may have, the guard reads back the tail of the output topic to learn which
+// of the partition's uncommitted offsets were already published, and skips
+// those.
+package exactlyonce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+)
+
+// fetchBytes bounds each fetch of the output topic while recovering
+const fetchBytes = 1 << 20
+
+// Config configures a Guard
+type Config struct {
+	Brokers   string // comma-separated
+	Transport *kafka.Transport
+
+	// GroupID and InputTopic are those of the consumer the guard wraps,
+	// whose committed offsets bound the offsets that can be redelivered
+	GroupID    string
+	InputTopic string
+
+	// OutputTopic is read back ScanDepth messages per partition to recover
+	// the offsets already published. It must hold every message published
+	// since the input's committed offsets.
+	OutputTopic string
+	ScanDepth   int
+
+	// BatchSize is that of the consumer, the most messages it has in
+	// flight. A partition whose offsets jump further than that was handled
+	// elsewhere meanwhile, and is recovered again.
+	BatchSize int
+}
+
+// Metrics records the duplicates the guard skips and its recoveries
+type Metrics interface {
+	RecordDuplicateSkipped()
+	RecordRecovery(published int, took time.Duration)
+}
+
+// Guard wraps the handler of raw transactions, skipping those already
+// published
+type Guard struct {
+	cfg     Config
+	client  *kafka.Client
+	metrics Metrics
+
+	mu         sync.Mutex
+	partitions map[int]*partition
+}
+
+// partition is what the guard knows of an input partition: the offsets
+// handled by this process or recovered from the output topic, true once
+// published, and the highest of them
+type partition struct {
+	handled map[int64]bool
+	highest int64
+}
+
+// New creates a guard. metrics may be nil.
+func New(cfg Config, metrics Metrics) *Guard {
+	client := &kafka.Client{Addr: kafka.TCP(consumer.ParseBrokers(cfg.Brokers)...)}
+	if cfg.Transport != nil {
+		client.Transport = cfg.Transport
+	}
+	return &Guard{
+		cfg:        cfg,
+		client:     client,
+		metrics:    metrics,
+		partitions: make(map[int]*partition),
+	}
+}
+
+// Wrap returns a handler handling each raw transaction with next unless it
+// was already published. A transaction is taken as published once next
+// succeeds, so next must publish synchronously.
+func (g *Guard) Wrap(next consumer.Handler) consumer.Handler {
+	return consumer.HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		published, err := g.published(ctx, m)
+		if err != nil {
+			// Whether it was published cannot be told; retried
+			return err
+		}
+		if published {
+			slog.InfoContext(ctx, "skipping raw transaction already published",
+				"partition", m.Partition, "offset", m.Offset)
+			if g.metrics != nil {
+				g.metrics.RecordDuplicateSkipped()
+			}
+			return nil
+		}
+
+		if err := next.Handle(ctx, m); err != nil {
+			return err
+		}
+		g.record(m)
+		return nil
+	})
+}
+
+// published reports whether the message at m's offset was published,
+// recovering its partition first when needed
+func (g *Guard) published(ctx context.Context, m kafka.Message) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.partitions[m.Partition]
+	if p == nil || g.stale(p, m.Offset) {
+		recovered, err := g.recover(ctx, m.Partition)
+		if err != nil {
+			return false, err
+		}
+		if p == nil {
+			p = &partition{handled: make(map[int64]bool), highest: -1}
+			g.partitions[m.Partition] = p
+		}
+		for offset := range recovered {
+			p.handled[offset] = true
+		}
+	}
+
+	published := p.handled[m.Offset]
+	p.handled[m.Offset] = published
+	p.highest = max(p.highest, m.Offset)
+	g.prune(p)
+	return published, nil
+}
+
+// stale reports whether the partition may have been handled by another
+// consumer since this process last handled it: the offset is new to it and
+// more than a batch away from its highest offset. Within a batch, workers
+// handle a partition's messages out of order.
+func (g *Guard) stale(p *partition, offset int64) bool {
+	if _, ok := p.handled[offset]; ok {
+		return false
+	}
+	batch := int64(g.cfg.BatchSize)
+	return offset < p.highest-batch || offset > p.highest+batch
+}
+
+// record marks the message at m's offset published
+func (g *Guard) record(m kafka.Message) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if p := g.partitions[m.Partition]; p != nil {
+		p.handled[m.Offset] = true
+	}
+}
+
+// prune forgets offsets further behind the partition's highest than a
+// recovery reads back, once they outnumber it twice over
+func (g *Guard) prune(p *partition) {
+	if len(p.handled) <= 2*g.cfg.ScanDepth {
+		return
+	}
+	for offset := range p.handled {
+		if offset < p.highest-int64(g.cfg.ScanDepth) {
+			delete(p.handled, offset)
+		}
+	}
+}
+
+// recover returns the offsets of an input partition published to the output
+// topic since the partition's committed offset
+func (g *Guard) recover(ctx context.Context, inputPartition int) (map[int64]bool, error) {
+	start := time.Now()
+
+	committed, err := g.committedOffset(ctx, inputPartition)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := g.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{g.cfg.OutputTopic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output topic metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("failed to read output topic metadata: %v", topicError(meta.Topics))
+	}
+
+	var requests []kafka.OffsetRequest
+	for _, p := range meta.Topics[0].Partitions {
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	offsets, err := g.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{g.cfg.OutputTopic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list output topic offsets: %w", err)
+	}
+
+	published := make(map[int64]bool)
+	for _, p := range offsets.Topics[g.cfg.OutputTopic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of output partition %d: %w", p.Partition, p.Error)
+		}
+		from := max(p.FirstOffset, p.LastOffset-int64(g.cfg.ScanDepth))
+		if err := g.scan(ctx, p.Partition, from, p.LastOffset, func(source consumer.Source) {
+			if source.Topic == g.cfg.InputTopic && source.Partition == inputPartition && source.Offset >= committed {
+				published[source.Offset] = true
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.InfoContext(ctx, "recovered published offsets", "partition", inputPartition,
+		"committed_offset", committed, "published", len(published), "duration", time.Since(start))
+	if g.metrics != nil {
+		g.metrics.RecordRecovery(len(published), time.Since(start))
+	}
+	return published, nil
+}
+
+// committedOffset returns the committed offset of an input partition, or 0
+// when the group has committed none
+func (g *Guard) committedOffset(ctx context.Context, inputPartition int) (int64, error) {
+	resp, err := g.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: g.cfg.GroupID,
+		Topics:  map[string][]int{g.cfg.InputTopic: {inputPartition}},
+	})
+	if err == nil {
+		err = resp.Error
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch committed offset: %w", err)
+	}
+	for _, p := range resp.Topics[g.cfg.InputTopic] {
+		if p.Partition != inputPartition {
+			continue
+		}
+		if p.Error != nil {
+			return 0, fmt.Errorf("failed to fetch committed offset: %w", p.Error)
+		}
+		return max(p.CommittedOffset, 0), nil
+	}
+	return 0, nil
+}
+
+// scan calls fn with the source of each message of an output partition from
+// offset from up to offset to
+func (g *Guard) scan(ctx context.Context, outputPartition int, from, to int64, fn func(consumer.Source)) error {
+	for offset := from; offset < to; {
+		resp, err := g.client.Fetch(ctx, &kafka.FetchRequest{
+			Topic:     g.cfg.OutputTopic,
+			Partition: outputPartition,
+			Offset:    offset,
+			MinBytes:  1,
+			MaxBytes:  fetchBytes,
+			MaxWait:   time.Second,
+		})
+		if err == nil {
+			err = resp.Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read output partition %d at offset %d: %w", outputPartition, offset, err)
+		}
+
+		next := offset
+		for resp.Records != nil {
+			record, err := resp.Records.ReadRecord()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read output partition %d at offset %d: %w", outputPartition, next, err)
+			}
+			if record.Offset < offset {
+				continue // earlier records of a compressed batch
+			}
+			if record.Offset >= to {
+				break
+			}
+			if source, ok := consumer.SourceOf(record.Headers); ok {
+				fn(source)
+			}
+			next = record.Offset + 1
+		}
+		if next == offset {
+			// Nothing returned below the end; the rest is gone or too
+			// large to fetch
+			return fmt.Errorf("failed to read output partition %d at offset %d: no records returned", outputPartition, offset)
+		}
+		offset = next
+	}
+	return nil
+}
+
+// topicError describes why the metadata of the output topic is missing
+func topicError(topics []kafka.Topic) error {
+	if len(topics) == 1 {
+		return topics[0].Error
+	}
+	return errors.New("topic not found")
+}
@@ -0,0 +1,158 @@
+package exactlyonce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeMetrics records the duplicates skipped and the offsets recovered
+type fakeMetrics struct {
+	mu         sync.Mutex
+	skipped    int
+	recoveries []int
+}
+
+func (m *fakeMetrics) RecordDuplicateSkipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped++
+}
+
+func (m *fakeMetrics) RecordRecovery(published int, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recoveries = append(m.recoveries, published)
+}
+
+func (m *fakeMetrics) skippedCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.skipped
+}
+
+// unreachable is a guard configuration whose brokers refuse connections, so
+// that any recovery fails
+func unreachable() Config {
+	return Config{
+		Brokers:     "127.0.0.1:1",
+		GroupID:     "processing",
+		InputTopic:  "transactions.raw",
+		OutputTopic: "transactions.processed",
+		ScanDepth:   100,
+		BatchSize:   10,
+	}
+}
+
+// message returns the raw transaction at offset of partition 0
+func message(offset int64) kafka.Message {
+	return kafka.Message{Topic: "transactions.raw", Offset: offset}
+}
+
+func TestRedeliveredOffsetsAreSkipped(t *testing.T) {
+	metrics := &fakeMetrics{}
+	g := New(unreachable(), metrics)
+	// Offsets 0 and 1 were published, 2 handled without being published
+	g.partitions[0] = &partition{handled: map[int64]bool{0: true, 1: true, 2: false}, highest: 2}
+
+	var handled []int64
+	fail := false
+	handler := g.Wrap(consumer.HandlerFunc(func(_ context.Context, m kafka.Message) error {
+		handled = append(handled, m.Offset)
+		if fail {
+			return errors.New("failed to publish")
+		}
+		return nil
+	}))
+
+	steps := []struct {
+		offset  int64
+		fail    bool
+		handled bool
+	}{
+		{1, false, false},
+		{2, false, true},
+		{3, true, true},
+		// A failed publish is retried
+		{3, false, true},
+		{3, false, false},
+		{2, false, false},
+		// Within a batch of the highest offset, workers handle out of order
+		{12, false, true},
+		{5, false, true},
+	}
+	for _, step := range steps {
+		fail = step.fail
+		before := len(handled)
+		err := handler.Handle(context.Background(), message(step.offset))
+		if (err != nil) != step.fail {
+			t.Errorf("offset %d: Handle = %v", step.offset, err)
+		}
+		if got := len(handled) > before; got != step.handled {
+			t.Errorf("offset %d handled: %v, want %v", step.offset, got, step.handled)
+		}
+	}
+	if n := metrics.skippedCount(); n != 3 {
+		t.Errorf("%d duplicates skipped, want 3", n)
+	}
+	if len(metrics.recoveries) != 0 {
+		t.Errorf("%d recoveries, want none", len(metrics.recoveries))
+	}
+}
+
+func TestUnrecoveredPartitionsAreNotHandled(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition *partition
+		offset    int64
+	}{
+		{"first message", nil, 0},
+		{"offsets jumped ahead", &partition{handled: map[int64]bool{2: true}, highest: 2}, 13},
+		{"offsets jumped back", &partition{handled: map[int64]bool{40: true}, highest: 40}, 29},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(unreachable(), nil)
+			if tt.partition != nil {
+				g.partitions[0] = tt.partition
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			called := false
+			err := g.Wrap(consumer.HandlerFunc(func(context.Context, kafka.Message) error {
+				called = true
+				return nil
+			})).Handle(ctx, message(tt.offset))
+			if err == nil || called {
+				t.Errorf("Handle = %v, handled %v, want the recovery error and nothing handled", err, called)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	g := New(Config{ScanDepth: 10}, nil)
+
+	p := &partition{handled: make(map[int64]bool), highest: 19}
+	for offset := int64(0); offset < 20; offset++ {
+		p.handled[offset] = true
+	}
+	g.prune(p)
+	if len(p.handled) != 20 {
+		t.Errorf("%d offsets kept of 20, want all while they do not outnumber twice the scan depth", len(p.handled))
+	}
+
+	p.handled[20], p.highest = true, 20
+	g.prune(p)
+	for offset := int64(0); offset <= 20; offset++ {
+		if _, kept := p.handled[offset]; kept != (offset >= 10) {
+			t.Errorf("offset %d kept: %v", offset, kept)
+		}
+	}
+}
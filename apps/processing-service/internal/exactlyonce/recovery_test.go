@@ -0,0 +1,308 @@
+//go:build integration
+
+package exactlyonce
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+// The recovery tests crash and restart consumers against Kafka in a
+// container:
+//
+//	go test -tags=integration ./internal/exactlyonce/
+
+// brokers are the comma-separated brokers of the container
+var brokers string
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	container, err := tckafka.Run(ctx, "confluentinc/confluent-local:7.5.0", tckafka.WithClusterID("exactlyonce"))
+	if err != nil {
+		log.Fatalf("failed to start kafka: %v", err)
+	}
+	addrs, err := container.Brokers(ctx)
+	if err != nil {
+		log.Fatalf("failed to get kafka brokers: %v", err)
+	}
+	brokers = strings.Join(addrs, ",")
+
+	code := m.Run()
+	if err := testcontainers.TerminateContainer(container); err != nil {
+		log.Printf("failed to terminate kafka: %v", err)
+	}
+	os.Exit(code)
+}
+
+// testTopics creates an input topic of one partition holding n raw
+// transactions, and an empty output topic of two, named after the test
+func testTopics(t *testing.T, n int) (input, output string) {
+	t.Helper()
+	ctx := context.Background()
+	name := strings.ToLower(strings.NewReplacer("/", "-", " ", "-").Replace(t.Name()))
+	input, output = name+".raw", name+".processed"
+
+	client := &kafka.Client{Addr: kafka.TCP(consumer.ParseBrokers(brokers)...)}
+	resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: []kafka.TopicConfig{
+		{Topic: input, NumPartitions: 1, ReplicationFactor: 1},
+		{Topic: output, NumPartitions: 2, ReplicationFactor: 1},
+	}})
+	if err != nil {
+		t.Fatalf("failed to create topics: %v", err)
+	}
+	for topic, err := range resp.Errors {
+		if err != nil {
+			t.Fatalf("failed to create topic %s: %v", topic, err)
+		}
+	}
+
+	writer := &kafka.Writer{Addr: kafka.TCP(consumer.ParseBrokers(brokers)...), Topic: input, BatchTimeout: 10 * time.Millisecond}
+	defer writer.Close()
+	messages := make([]kafka.Message, n)
+	for i := range messages {
+		messages[i] = kafka.Message{Key: []byte(fmt.Sprintf("acct-%d", i%3)), Value: []byte(fmt.Sprintf("txn-%d", i))}
+	}
+	if err := writer.WriteMessages(ctx, messages...); err != nil {
+		t.Fatalf("failed to produce raw transactions: %v", err)
+	}
+	return input, output
+}
+
+// publishing returns a handler publishing each raw transaction to output
+// synchronously, named by its source headers as the processing publisher
+// does
+func publishing(t *testing.T, output string) consumer.Handler {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(consumer.ParseBrokers(brokers)...),
+		Topic:        output,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	t.Cleanup(func() { writer.Close() })
+	return consumer.HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		source := consumer.Source{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+		return writer.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: source.Headers()})
+	})
+}
+
+// consume handles the raw transactions of input as a member of group, from
+// the group's committed offset up to offset last. It commits each offset up
+// to commitThrough, then stops as a crash would: without committing the
+// offsets it handled after.
+func consume(t *testing.T, group, input string, handler consumer.Handler, last, commitThrough int64) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     consumer.ParseBrokers(brokers),
+		GroupID:     group,
+		Topic:       input,
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     100 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			t.Fatalf("failed to fetch raw transaction: %v", err)
+		}
+		if err := handler.Handle(ctx, m); err != nil {
+			t.Fatalf("failed to handle offset %d: %v", m.Offset, err)
+		}
+		if m.Offset <= commitThrough {
+			if err := reader.CommitMessages(ctx, m); err != nil {
+				t.Fatalf("failed to commit offset %d: %v", m.Offset, err)
+			}
+		}
+		if m.Offset >= last {
+			return
+		}
+	}
+}
+
+// delivered returns how many times a downstream consumer receives each raw
+// transaction of input, reading every partition of output by the source
+// headers
+func delivered(t *testing.T, input, output string) map[int64]int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := &kafka.Client{Addr: kafka.TCP(consumer.ParseBrokers(brokers)...)}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{
+		output: {kafka.LastOffsetOf(0), kafka.LastOffsetOf(1)},
+	}})
+	if err != nil {
+		t.Fatalf("failed to list output offsets: %v", err)
+	}
+
+	counts := make(map[int64]int)
+	for _, p := range offsets.Topics[output] {
+		if p.LastOffset == 0 {
+			continue
+		}
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   consumer.ParseBrokers(brokers),
+			Topic:     output,
+			Partition: p.Partition,
+			MaxWait:   100 * time.Millisecond,
+		})
+		for {
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				reader.Close()
+				t.Fatalf("failed to read output partition %d: %v", p.Partition, err)
+			}
+			source, ok := consumer.SourceOf(m.Headers)
+			if !ok || source.Topic != input {
+				t.Errorf("processed transaction at %d/%d names source %+v", p.Partition, m.Offset, source)
+			}
+			counts[source.Offset]++
+			if m.Offset == p.LastOffset-1 {
+				break
+			}
+		}
+		reader.Close()
+	}
+	return counts
+}
+
+// duplicates returns how many raw transactions up to offset last were
+// delivered more than once, failing the test when one was not delivered
+func duplicates(t *testing.T, counts map[int64]int, last int64) int {
+	t.Helper()
+	n := 0
+	for offset := int64(0); offset <= last; offset++ {
+		switch {
+		case counts[offset] == 0:
+			t.Errorf("offset %d never delivered", offset)
+		case counts[offset] > 1:
+			n++
+		}
+	}
+	return n
+}
+
+func TestRestartAfterACrashPublishesNothingTwice(t *testing.T) {
+	tests := []struct {
+		name           string
+		guarded        bool
+		wantDuplicates int
+	}{
+		// The crash leaves offsets 5 to 12 published and uncommitted
+		{"at least once", false, 8},
+		{"exactly once", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, output := testTopics(t, 20)
+			cfg := Config{
+				Brokers:     brokers,
+				GroupID:     input + "-group",
+				InputTopic:  input,
+				OutputTopic: output,
+				ScanDepth:   100,
+				BatchSize:   5,
+			}
+			// Each run is a fresh process, remembering nothing
+			run := func(metrics *fakeMetrics) consumer.Handler {
+				if !tt.guarded {
+					return publishing(t, output)
+				}
+				return New(cfg, metrics).Wrap(publishing(t, output))
+			}
+
+			consume(t, cfg.GroupID, input, run(&fakeMetrics{}), 12, 4)
+			if n := duplicates(t, delivered(t, input, output), 12); n != 0 {
+				t.Fatalf("%d duplicates before the crash", n)
+			}
+
+			restarted := &fakeMetrics{}
+			consume(t, cfg.GroupID, input, run(restarted), 19, 19)
+			if n := duplicates(t, delivered(t, input, output), 19); n != tt.wantDuplicates {
+				t.Errorf("%d raw transactions delivered twice, want %d", n, tt.wantDuplicates)
+			}
+			if tt.guarded {
+				if n := restarted.skippedCount(); n != 8 {
+					t.Errorf("%d duplicates skipped, want 8", n)
+				}
+				if len(restarted.recoveries) != 1 || restarted.recoveries[0] != 8 {
+					t.Errorf("recoveries found %v published, want one finding 8", restarted.recoveries)
+				}
+			}
+		})
+	}
+}
+
+func TestPartitionHandledElsewhereIsRecoveredAgain(t *testing.T) {
+	input, output := testTopics(t, 10)
+	cfg := Config{
+		Brokers:     brokers,
+		GroupID:     input + "-group",
+		InputTopic:  input,
+		OutputTopic: output,
+		ScanDepth:   100,
+		BatchSize:   2,
+	}
+	first, other := &fakeMetrics{}, &fakeMetrics{}
+	guard := New(cfg, first)
+
+	// The first process handles the partition up to offset 1, then loses
+	// it to another that crashes after publishing up to offset 9
+	consume(t, cfg.GroupID, input, guard.Wrap(publishing(t, output)), 1, 1)
+	consume(t, cfg.GroupID, input, New(cfg, other).Wrap(publishing(t, output)), 9, 4)
+
+	// Back with the first, the jump past its highest offset makes it read
+	// the output again
+	consume(t, cfg.GroupID, input, guard.Wrap(publishing(t, output)), 9, 9)
+	if n := duplicates(t, delivered(t, input, output), 9); n != 0 {
+		t.Errorf("%d raw transactions delivered twice, want none", n)
+	}
+	if n := first.skippedCount(); n != 5 {
+		t.Errorf("%d duplicates skipped, want 5", n)
+	}
+	if len(first.recoveries) != 2 {
+		t.Errorf("%d recoveries, want one on first handling the partition and one after the jump", len(first.recoveries))
+	}
+}
+
+// Offsets published before the committed offset are not redelivered, and so
+// not recovered either
+func TestRecoveryStopsAtTheCommittedOffset(t *testing.T) {
+	input, output := testTopics(t, 6)
+	cfg := Config{
+		Brokers:     brokers,
+		GroupID:     input + "-group",
+		InputTopic:  input,
+		OutputTopic: output,
+		ScanDepth:   100,
+		BatchSize:   2,
+	}
+	consume(t, cfg.GroupID, input, publishing(t, output), 3, 2)
+
+	published, err := New(cfg, nil).recover(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if len(published) != 1 || !published[3] {
+		t.Errorf("recovered %v, want offset 3 alone", published)
+	}
+
+	// A group that never committed is recovered from the start
+	cfg.GroupID = input + "-new"
+	if published, err = New(cfg, nil).recover(context.Background(), 0); err != nil || len(published) != 4 {
+		t.Errorf("recover = %v, %v, want offsets 0 to 3", published, err)
+	}
+}
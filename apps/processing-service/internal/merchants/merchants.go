@@ -0,0 +1,144 @@
+// Package merchants normalizes merchant names, so that the many spellings of
+// one merchant on card statements, such as "AMZN Mktp US*2K4", "Amazon
+// Marketplace" and "AMAZON.COM", are scored and counted as one.
+package merchants
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultPatterns strip the processor prefixes, order references, store and
+// terminal numbers with the locations after them, web domains and country
+// suffixes merchant names carry. They apply in order to the lowercased name,
+// and each match is removed.
+var DefaultPatterns = []string{
+	`^(sq|tst|pp|paypal|sp|goog|apl|py)\s*\*\s*`, // payment processor prefixes
+	`\*[a-z0-9]+$`,                      // order and terminal references
+	`\s+store\s*\d+.*$`,                 // numbered stores
+	`\s*#\s*\d+.*$`,                     // store numbers and the location after them
+	`\s+\d{3,}\b.*$`,                    // terminal numbers and the location after them
+	`\.(com|net|org|co\.uk|co|in|io)\b`, // web domains
+	`^www\.`,                            // web hosts
+	`\s+(us|usa|ca|gb|uk|in|de|fr|au)$`, // country suffixes
+	`['’]`,                              // apostrophes, so "joe's" reads "joes"
+}
+
+// DefaultAliases map common spellings, once stripped, to their canonical
+// merchant
+var DefaultAliases = map[string]string{
+	"amzn":               "amazon",
+	"amzn mktp":          "amazon",
+	"amazon mktplace":    "amazon",
+	"amazon marketplace": "amazon",
+	"amazon prime":       "amazon",
+	"wal mart":           "walmart",
+	"wm supercenter":     "walmart",
+	"netflix com":        "netflix",
+	"uber trip":          "uber",
+}
+
+// nonAlphanumeric matches the punctuation left between words once the
+// patterns have run
+var nonAlphanumeric = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Normalizer maps merchant names to a canonical form: lowercased, stripped
+// of the parts matching its patterns, and looked up in its alias table
+type Normalizer struct {
+	patterns []*regexp.Regexp
+	aliases  map[string]string
+}
+
+// NewNormalizer creates a normalizer stripping the given patterns in order
+// and mapping the result through aliases. Alias keys are matched against the
+// stripped name, with punctuation replaced by spaces.
+func NewNormalizer(patterns []string, aliases map[string]string) (*Normalizer, error) {
+	n := &Normalizer{aliases: make(map[string]string, len(aliases))}
+
+	var errs []error
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pattern %d: %w", i, err))
+			continue
+		}
+		n.patterns = append(n.patterns, re)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	for alias, canonical := range aliases {
+		n.aliases[clean(strings.ToLower(alias))] = clean(strings.ToLower(canonical))
+	}
+	return n, nil
+}
+
+// Default returns a normalizer with the default patterns and aliases
+func Default() *Normalizer {
+	n, err := NewNormalizer(DefaultPatterns, DefaultAliases)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Normalize returns the canonical form of a merchant name, or "" when there
+// is no name
+func (n *Normalizer) Normalize(merchant string) string {
+	name := strings.ToLower(strings.TrimSpace(merchant))
+	for _, re := range n.patterns {
+		name = strings.TrimSpace(re.ReplaceAllString(name, ""))
+	}
+	name = clean(name)
+	if name == "" {
+		// Nothing left once stripped; keep the name rather than lose it
+		name = clean(strings.ToLower(merchant))
+	}
+	if canonical, ok := n.aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// clean replaces punctuation with single spaces
+func clean(name string) string {
+	return strings.TrimSpace(nonAlphanumeric.ReplaceAllString(name, " "))
+}
+
+// file is the JSON file extending the default patterns and aliases, e.g.
+//
+//	{"patterns": ["\\s+f\\d+$"], "aliases": {"mcd": "mcdonalds"}}
+type file struct {
+	Patterns []string          `json:"patterns"`
+	Aliases  map[string]string `json:"aliases"`
+}
+
+// Load returns a normalizer with the default patterns and aliases extended
+// by a JSON file. The file's patterns run after the defaults, and its aliases
+// replace default aliases of the same name.
+func Load(path string) (*Normalizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merchant normalization: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse merchant normalization %s: %w", path, err)
+	}
+
+	patterns := append(append([]string(nil), DefaultPatterns...), f.Patterns...)
+	aliases := make(map[string]string, len(DefaultAliases)+len(f.Aliases))
+	for alias, canonical := range DefaultAliases {
+		aliases[alias] = canonical
+	}
+	for alias, canonical := range f.Aliases {
+		aliases[alias] = canonical
+	}
+	return NewNormalizer(patterns, aliases)
+}
@@ -0,0 +1,144 @@
+package merchants
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corpus holds merchant names as they appear on card statements, with the
+// canonical name each must normalize to
+var corpus = []struct {
+	merchant string
+	want     string
+}{
+	// One merchant, many spellings
+	{"AMZN Mktp US*2K4", "amazon"},
+	{"AMZN MKTP US", "amazon"},
+	{"Amazon Marketplace", "amazon"},
+	{"AMAZON.COM", "amazon"},
+	{"amazon.com*MK1234", "amazon"},
+	{"Amazon Prime*7Y2", "amazon"},
+	{"WAL-MART #1234 SPRINGFIELD MO", "walmart"},
+	{"WM SUPERCENTER #5678", "walmart"},
+	{"Walmart.com", "walmart"},
+	{"PAYPAL *NETFLIX", "netflix"},
+	{"NETFLIX.COM", "netflix"},
+	{"Netflix.com 866-579-7172 CA", "netflix"},
+	{"Uber Trip", "uber"},
+	{"STARBUCKS STORE 01234 SEATTLE WA", "starbucks"},
+	{"Starbucks #5521 Portland", "starbucks"},
+
+	// Processor prefixes, terminals and hosts
+	{"SQ *BLUE BOTTLE COFFEE", "blue bottle coffee"},
+	{"TST* Joe's Pizza", "joes pizza"},
+	{"GOOG *YouTube Premium", "youtube premium"},
+	{"APL* ITUNES.COM/BILL", "itunes bill"},
+	{"SHELL OIL 57442145 HOUSTON TX", "shell oil"},
+	{"www.booking.com", "booking"},
+	{"LUCKY GAMBLING HALL #22", "lucky gambling hall"},
+
+	// Names needing no more than lowercasing and spacing
+	{"Corner Shop", "corner shop"},
+	{"  Corner   Shop  ", "corner shop"},
+	{"Crypto Exchange", "crypto exchange"},
+	{"Café Zürich", "café zürich"},
+	{"7-Eleven", "7 eleven"},
+
+	// Nothing to keep
+	{"***", ""},
+	{"", ""},
+}
+
+func TestNormalizeCorpus(t *testing.T) {
+	n := Default()
+	for _, tt := range corpus {
+		t.Run(tt.merchant, func(t *testing.T) {
+			if got := n.Normalize(tt.merchant); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.merchant, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepsNamesThePatternsWouldErase(t *testing.T) {
+	n, err := NewNormalizer([]string{`^.*$`}, nil)
+	if err != nil {
+		t.Fatalf("NewNormalizer: %v", err)
+	}
+	if got := n.Normalize("Shop #12"); got != "shop 12" {
+		t.Errorf("Normalize = %q, want the cleaned name kept", got)
+	}
+}
+
+func TestNewNormalizerReportsEveryInvalidPattern(t *testing.T) {
+	_, err := NewNormalizer([]string{`\s+`, `(unclosed`, `[z-a]`}, nil)
+	if err == nil {
+		t.Fatal("NewNormalizer accepted invalid patterns")
+	}
+	for _, want := range []string{"pattern 1", "pattern 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %s", err, want)
+		}
+	}
+}
+
+// writeFile writes content to a file in a temporary directory and returns
+// its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "merchants.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadExtendsTheDefaults(t *testing.T) {
+	n, err := Load(writeFile(t, `{
+		"patterns": ["\\s*\\*trip\\b.*$"],
+		"aliases": {"MCD": "McDonald's", "amzn": "amazon.com inc"}
+	}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		merchant string
+		want     string
+	}{
+		// The file's pattern runs after the defaults
+		{"UBER *TRIP HELP.UBER.COM", "uber"},
+		// Aliases are matched and mapped once cleaned
+		{"MCD #4411 CHICAGO", "mcdonald s"},
+		// The file's alias replaces the default
+		{"AMZN", "amazon com inc"},
+		// The defaults still apply
+		{"WM SUPERCENTER #5678", "walmart"},
+	}
+	for _, tt := range tests {
+		if got := n.Normalize(tt.merchant); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.merchant, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.json"), "failed to read merchant normalization"},
+		{"invalid JSON", writeFile(t, `{"patterns": [`), "failed to parse merchant normalization"},
+		{"invalid pattern", writeFile(t, `{"patterns": ["(unclosed"]}`), "pattern 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
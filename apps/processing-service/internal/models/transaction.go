@@ -2,69 +2,24 @@ package models
 
 import (
 	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
 )
 
 // RawTransaction represents the incoming transaction from ingestion service
-type RawTransaction struct {
-	ID             string            `json:"id"`
-	IdempotencyKey string            `json:"idempotency_key"`
-	AccountID      string            `json:"account_id"`
-	UserID         string            `json:"user_id"`
-	Amount         float64           `json:"amount"`
-	Currency       string            `json:"currency"`
-	Type           string            `json:"type"`
-	Category       string            `json:"category"`
-	Merchant       string            `json:"merchant,omitempty"`
-	Reference      string            `json:"reference,omitempty"`
-	Status         string            `json:"status"`
-	Timestamp      time.Time         `json:"timestamp"`
-	Metadata       map[string]string `json:"metadata,omitempty"`
-}
+type RawTransaction = shared.Transaction
 
 // ProcessedTransaction represents the transaction after business logic processing
-type ProcessedTransaction struct {
-	RawTransaction
-	// Processing results
-	RiskScore       float64 `json:"risk_score"`
-	RiskLevel       string  `json:"risk_level"`
-	IsApproved      bool    `json:"is_approved"`
-	RejectionReason string  `json:"rejection_reason,omitempty"`
-
-	// Business validation results
-	IsValid          bool     `json:"is_valid"`
-	ValidationErrors []string `json:"validation_errors,omitempty"`
-
-	// Enrichment data
-	Country    string `json:"country,omitempty"`
-	IPAddress  string `json:"ip_address,omitempty"`
-	DeviceInfo string `json:"device_info,omitempty"`
-
-	// Processing metadata
-	ProcessedAt    time.Time     `json:"processed_at"`
-	ProcessingTime time.Duration `json:"processing_time"`
-	ProcessorID    string        `json:"processor_id"`
-}
+type ProcessedTransaction = shared.ProcessedTransaction
 
 // TransactionValidation represents validation rules and results
-type TransactionValidation struct {
-	IsValid  bool                `json:"is_valid"`
-	Errors   []ValidationError   `json:"errors,omitempty"`
-	Warnings []ValidationWarning `json:"warnings,omitempty"`
-}
+type TransactionValidation = shared.TransactionValidation
 
 // ValidationError represents a validation error
-type ValidationError struct {
-	Field   string `json:"field"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type ValidationError = shared.ValidationError
 
 // ValidationWarning represents a validation warning
-type ValidationWarning struct {
-	Field   string `json:"field"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
+type ValidationWarning = shared.ValidationWarning
 
 // RiskAssessment represents the risk analysis of a transaction
 type RiskAssessment struct {
@@ -72,14 +27,49 @@ type RiskAssessment struct {
 	RiskLevel      string       `json:"risk_level"`
 	RiskFactors    []RiskFactor `json:"risk_factors"`
 	Recommendation string       `json:"recommendation"`
+	Noise          float64      `json:"noise"` // pseudo-random component of the score, derived from the transaction ID
 }
 
 // RiskFactor represents a specific risk factor
-type RiskFactor struct {
-	Factor      string  `json:"factor"`
-	Weight      float64 `json:"weight"`
-	Description string  `json:"description"`
-	Severity    string  `json:"severity"`
+type RiskFactor = shared.RiskFactor
+
+// ParentTransaction is the transaction a refund refunds, as stored, with the
+// refunds already made against it
+type ParentTransaction struct {
+	ID      string   `json:"id"`
+	Amount  float64  `json:"amount"`
+	Status  string   `json:"status"`
+	Refunds []Refund `json:"refunds"`
+}
+
+// Refund is a refund made against a ParentTransaction
+type Refund struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+	Status string  `json:"status"`
+}
+
+// CountryFacts compares the country of a transaction with where its account
+// has transacted before
+type CountryFacts struct {
+	// Home is the account's most frequent country, or "" while its history
+	// is too short to tell
+	Home string
+	// Previous is the country of the account's previous transaction
+	Previous string
+	// Switched is set when the previous transaction was in another country
+	// too shortly before to have travelled
+	Switched bool
+}
+
+// RecurrenceFacts tells whether a transaction continues an established
+// pattern of charges like it, such as a subscription
+type RecurrenceFacts struct {
+	Recurring bool
+	// Cadence is weekly or monthly on a recurring charge
+	Cadence string
+	// Occurrences is the number of earlier charges considered
+	Occurrences int
 }
 
 // ProcessingResult represents the final result of transaction processing
@@ -93,30 +83,129 @@ type ProcessingResult struct {
 	Timestamp       time.Time     `json:"timestamp"`
 }
 
+// BlocklistEntry blocks transactions from a country, with a merchant or on
+// an account
+type BlocklistEntry = shared.BlocklistEntry
+
+// Alert is an alert the service raises itself, such as a consumer lag alert
+type Alert = shared.Alert
+
+// AlertTypeOperational is the type of the alerts the service raises itself
+const AlertTypeOperational = shared.AlertTypeOperational
+
+// Alert severities
+const (
+	SeverityMedium   = shared.SeverityMedium
+	SeverityHigh     = shared.SeverityHigh
+	SeverityCritical = shared.SeverityCritical
+)
+
+// DecisionAudit records how a transaction was decided
+type DecisionAudit = shared.DecisionAudit
+
+// RuleContribution is what a matching rule added to the risk score
+type RuleContribution = shared.RuleContribution
+
+// DecisionThresholds are the risk scores deciding a transaction
+type DecisionThresholds = shared.DecisionThresholds
+
+// CanaryComparison compares the decision of the primary rules configuration
+// on a sampled transaction with the one a canary configuration would have
+// made on the same facts and noise. Only the primary decision is published.
+type CanaryComparison struct {
+	TransactionID string    `json:"transaction_id"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	ComparedAt    time.Time `json:"compared_at"`
+
+	PrimaryRulesVersion string   `json:"primary_rules_version"`
+	CanaryRulesVersion  string   `json:"canary_rules_version"`
+	PrimaryScore        float64  `json:"primary_score"`
+	CanaryScore         float64  `json:"canary_score"`
+	PrimaryDecision     string   `json:"primary_decision"`
+	CanaryDecision      string   `json:"canary_decision"`
+	PrimaryRulesFired   []string `json:"primary_rules_fired"`
+	CanaryRulesFired    []string `json:"canary_rules_fired"`
+
+	// Agree is set when both configurations reach the same decision.
+	// DisagreeingRules are the rules enforced by one configuration and not
+	// the other on this transaction.
+	Agree            bool     `json:"agree"`
+	DisagreeingRules []string `json:"disagreeing_rules"`
+}
+
+// Decision stages
+const (
+	DecisionStageValidation = shared.DecisionStageValidation
+	DecisionStageBlocklist  = shared.DecisionStageBlocklist
+	DecisionStageAccount    = shared.DecisionStageAccount
+	DecisionStageRisk       = shared.DecisionStageRisk
+	DecisionStageStaleness  = shared.DecisionStageStaleness
+)
+
+// Processing lanes
+const (
+	LaneFast = shared.LaneFast
+	LaneSlow = shared.LaneSlow
+)
+
+// Blocklist entry types
+const (
+	BlocklistTypeCountry  = shared.BlocklistTypeCountry
+	BlocklistTypeMerchant = shared.BlocklistTypeMerchant
+	BlocklistTypeAccount  = shared.BlocklistTypeAccount
+)
+
 // Constants for risk levels
 const (
-	RiskLevelLow      = "low"
-	RiskLevelMedium   = "medium"
-	RiskLevelHigh     = "high"
-	RiskLevelCritical = "critical"
+	RiskLevelLow      = shared.RiskLevelLow
+	RiskLevelMedium   = shared.RiskLevelMedium
+	RiskLevelHigh     = shared.RiskLevelHigh
+	RiskLevelCritical = shared.RiskLevelCritical
 )
 
+// TypeRefund is the type of a transaction refunding its parent transaction
+const TypeRefund = shared.TransactionTypeRefund
+
 // Constants for transaction statuses
 const (
-	StatusPending  = "pending"
-	StatusApproved = "approved"
-	StatusRejected = "rejected"
-	StatusFlagged  = "flagged"
-	StatusFailed   = "failed"
+	StatusPending  = shared.TransactionStatusPending
+	StatusApproved = shared.TransactionStatusApproved
+	StatusRejected = shared.TransactionStatusRejected
+	StatusFlagged  = shared.TransactionStatusFlagged
+	StatusFailed   = shared.TransactionStatusFailed
 )
 
 // Constants for validation codes
 const (
-	ValidationCodeRequiredField   = "REQUIRED_FIELD"
-	ValidationCodeInvalidAmount   = "INVALID_AMOUNT"
-	ValidationCodeInvalidCurrency = "INVALID_CURRENCY"
-	ValidationCodeBlockedCountry  = "BLOCKED_COUNTRY"
-	ValidationCodeBlockedMerchant = "BLOCKED_MERCHANT"
-	ValidationCodeExceedsLimit    = "EXCEEDS_LIMIT"
-	ValidationCodeInvalidType     = "INVALID_TYPE"
+	ValidationCodeRequiredField   = shared.ValidationCodeRequiredField
+	ValidationCodeInvalidAmount   = shared.ValidationCodeInvalidAmount
+	ValidationCodeInvalidCurrency = shared.ValidationCodeInvalidCurrency
+	ValidationCodeBlockedCountry  = shared.ValidationCodeBlockedCountry
+	ValidationCodeBlockedMerchant = shared.ValidationCodeBlockedMerchant
+	ValidationCodeBlockedAccount  = shared.ValidationCodeBlockedAccount
+	ValidationCodeExceedsLimit    = shared.ValidationCodeExceedsLimit
+	ValidationCodeInvalidType     = shared.ValidationCodeInvalidType
+	ValidationCodePrecision       = shared.ValidationCodePrecision
+	ValidationCodeAccountInactive = shared.ValidationCodeAccountInactive
+
+	ValidationCodeTypeFieldRequired = shared.ValidationCodeTypeFieldRequired
+	ValidationCodeExceedsTypeLimit  = shared.ValidationCodeExceedsTypeLimit
+	ValidationCodeExceedsDailyCap   = shared.ValidationCodeExceedsDailyCap
 )
+
+// Account statuses
+const (
+	AccountStatusActive = shared.AccountStatusActive
+	AccountStatusFrozen = shared.AccountStatusFrozen
+	AccountStatusClosed = shared.AccountStatusClosed
+)
+
+// AccountStatusKey returns the Redis key of an account's cached status
+func AccountStatusKey(accountID string) string {
+	return shared.AccountStatusKey(accountID)
+}
+
+// ParseAccountStatusValue returns the status in a cached status value
+func ParseAccountStatusValue(value string) string {
+	return shared.ParseAccountStatusValue(value)
+}
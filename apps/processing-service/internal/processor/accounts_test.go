@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// accountStatuses is an account status cache of fixed statuses, failing
+// every lookup with err when set
+type accountStatuses struct {
+	statuses map[string]string
+	err      error
+}
+
+func (a accountStatuses) Status(_ context.Context, accountID string) (string, error) {
+	return a.statuses[accountID], a.err
+}
+
+func TestAccountStatusIsEnforced(t *testing.T) {
+	statuses := accountStatuses{statuses: map[string]string{
+		"acct-active": models.AccountStatusActive,
+		"acct-frozen": models.AccountStatusFrozen,
+		"acct-closed": models.AccountStatusClosed,
+	}}
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		account string
+		status  string
+		reason  string
+		stage   string
+		rule    bool
+	}{
+		{"active", "acct-active", models.StatusApproved, "", models.DecisionStageRisk, false},
+		{"frozen", "acct-frozen", models.StatusRejected, "account_id: Account acct-frozen is frozen", models.DecisionStageAccount, false},
+		{"closed", "acct-closed", models.StatusRejected, "account_id: Account acct-closed is closed", models.DecisionStageAccount, false},
+		// Unknown accounts are flagged by the enforced unknown_account rule
+		{"unknown", "acct-unknown", models.StatusFlagged, "", models.DecisionStageRisk, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p := NewProcessor(Deps{Publisher: pub, Accounts: statuses})
+			txn := rawTransaction("txn_1", 12, noon)
+			txn.AccountID = tt.account
+
+			evaluation, err := p.Evaluate(context.Background(), txn)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if evaluation.Stage != tt.stage {
+				t.Errorf("decided at %s, want %s", evaluation.Stage, tt.stage)
+			}
+			if fired := strings.Contains(strings.Join(evaluation.RulesFired, ","), "unknown_account"); fired != tt.rule {
+				t.Errorf("rules fired %v, want unknown_account %v", evaluation.RulesFired, tt.rule)
+			}
+
+			got := process(t, p, pub, txn)
+			if got.Status != tt.status || got.RejectionReason != tt.reason {
+				t.Errorf("status %s (%s), want %s (%s)", got.Status, got.RejectionReason, tt.status, tt.reason)
+			}
+			if tt.reason != "" && got.IsValid {
+				t.Error("transaction on an inactive account is valid")
+			}
+		})
+	}
+}
+
+func TestAccountsAreUncheckedWhenTheCacheIsDown(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	statuses := accountStatuses{err: errors.New("failed to look up account status: connection refused")}
+	p := NewProcessor(Deps{Publisher: pub, Metrics: metrics, Accounts: statuses})
+
+	txn := rawTransaction("txn_1", 12, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	evaluation, err := p.Evaluate(context.Background(), txn)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if len(evaluation.RulesFired) != 0 {
+		t.Errorf("rules fired %v, want the account unchecked", evaluation.RulesFired)
+	}
+	if got := process(t, p, pub, txn); got.Status != models.StatusApproved {
+		t.Errorf("status %s (%s), want approved", got.Status, got.RejectionReason)
+	}
+	if n := metrics.failedLookups("account"); n != 2 {
+		t.Errorf("%d failed account lookups counted, want 2", n)
+	}
+}
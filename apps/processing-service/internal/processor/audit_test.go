@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+func TestDecisionAuditsMatchTheDecisions(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	lateNight := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		amount   float64
+		at       time.Time
+		merchant string
+		stage    string
+		status   string
+		enforced []string
+		shadow   []string
+	}{
+		// Without device information, missing_device fires in shadow mode
+		{"approved", 25, noon, "Corner Shop", models.DecisionStageRisk, models.StatusApproved, nil, []string{"missing_device"}},
+		{"flagged", 120, lateNight, "LUCKY GAMBLING HALL #22", models.DecisionStageRisk, models.StatusFlagged,
+			[]string{"late_night", "risky_merchant"}, []string{"missing_device"}},
+		{"rejected on risk", 15000, lateNight, "Crypto Exchange", models.DecisionStageRisk, models.StatusRejected,
+			[]string{"high_amount", "late_night", "risky_merchant"}, []string{"missing_device", "round_amount"}},
+		{"rejected on validation", -5, noon, "Corner Shop", models.DecisionStageValidation, models.StatusRejected, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			auditor := &fakeAuditor{}
+			p := newAuditedProcessor(pub, auditor)
+			raw := rawTransaction("txn_"+tt.name, tt.amount, tt.at)
+			raw.TenantID = "unit-a"
+			raw.Merchant = tt.merchant
+
+			txn := process(t, p, pub, raw)
+			if auditor.count() != 1 {
+				t.Fatalf("%d decisions audited, want 1", auditor.count())
+			}
+			audit := auditor.audits[0]
+
+			if txn.Status != tt.status {
+				t.Fatalf("decided %s, want %s", txn.Status, tt.status)
+			}
+			if audit.TransactionID != txn.ID || audit.TenantID != "unit-a" || !audit.DecidedAt.Equal(txn.ProcessedAt) {
+				t.Errorf("audit of %s/%s at %s, want %s/unit-a at %s",
+					audit.TenantID, audit.TransactionID, audit.DecidedAt, txn.ID, txn.ProcessedAt)
+			}
+			if audit.Stage != tt.stage || audit.Decision != txn.Status || audit.RejectionReason != txn.RejectionReason {
+				t.Errorf("audit %s at %s (%s), want %s at %s (%s)",
+					audit.Decision, audit.Stage, audit.RejectionReason, txn.Status, tt.stage, txn.RejectionReason)
+			}
+			if audit.RiskScore != txn.RiskScore || audit.RiskLevel != txn.RiskLevel {
+				t.Errorf("audit score %v (%s), want %v (%s)", audit.RiskScore, audit.RiskLevel, txn.RiskScore, txn.RiskLevel)
+			}
+			if audit.ProcessorID != txn.ProcessorID || audit.ProcessorID == "" {
+				t.Errorf("audit by %q, want %q", audit.ProcessorID, txn.ProcessorID)
+			}
+			if audit.RulesVersion != RulesVersion(DefaultRiskRules()) {
+				t.Errorf("rules version %s, want that of the default rules", audit.RulesVersion)
+			}
+			want := models.DecisionThresholds{AutoApprove: 0.3, Flag: 0.6, AutoReject: 0.8}
+			if audit.Thresholds != want {
+				t.Errorf("thresholds %+v, want %+v", audit.Thresholds, want)
+			}
+
+			var enforced, shadow []string
+			sum := audit.Noise
+			for _, c := range audit.Contributions {
+				switch c.Mode {
+				case RuleModeEnforce:
+					enforced = append(enforced, c.Rule)
+					if c.Contribution != c.Weight {
+						t.Errorf("%s contributed %v, want its weight %v", c.Rule, c.Contribution, c.Weight)
+					}
+				case RuleModeShadow:
+					shadow = append(shadow, c.Rule)
+					if c.Contribution != 0 {
+						t.Errorf("shadow rule %s contributed %v", c.Rule, c.Contribution)
+					}
+				}
+				sum += c.Contribution
+			}
+			slices.Sort(enforced)
+			slices.Sort(shadow)
+			if !slices.Equal(enforced, tt.enforced) || !slices.Equal(shadow, tt.shadow) {
+				t.Errorf("contributions of %v enforced and %v shadow, want %v and %v", enforced, shadow, tt.enforced, tt.shadow)
+			}
+
+			// The contributions and noise add up to the score, capped at 1
+			if tt.stage == models.DecisionStageValidation {
+				if audit.Noise != 0 || len(audit.Contributions) != 0 {
+					t.Errorf("unassessed decision audited with noise %v and %d contributions", audit.Noise, len(audit.Contributions))
+				}
+				return
+			}
+			if audit.Noise != riskNoise(txn.ID) {
+				t.Errorf("noise %v, want %v", audit.Noise, riskNoise(txn.ID))
+			}
+			if math.Abs(math.Min(sum, 1)-audit.RiskScore) > 1e-9 {
+				t.Errorf("contributions and noise sum to %v, want the score %v", sum, audit.RiskScore)
+			}
+		})
+	}
+}
+
+func TestRulesVersion(t *testing.T) {
+	rules := DefaultRiskRules()
+	version := RulesVersion(rules)
+	if version != RulesVersion(DefaultRiskRules()) {
+		t.Error("the same rules have different versions")
+	}
+
+	changed := func(change func(rules []RiskRule) []RiskRule) string {
+		return RulesVersion(change(DefaultRiskRules()))
+	}
+	tests := []struct {
+		name   string
+		change func(rules []RiskRule) []RiskRule
+		same   bool
+	}{
+		{"weight", func(r []RiskRule) []RiskRule { r[0].Weight = 0.35; return r }, false},
+		{"mode", func(r []RiskRule) []RiskRule { r[4].Mode = RuleModeEnforce; return r }, false},
+		{"name", func(r []RiskRule) []RiskRule { r[1].Name = "night"; return r }, false},
+		{"order", func(r []RiskRule) []RiskRule { r[0], r[1] = r[1], r[0]; return r }, false},
+		{"rule removed", func(r []RiskRule) []RiskRule { return r[1:] }, false},
+		// Descriptions and severities do not change how transactions are scored
+		{"description", func(r []RiskRule) []RiskRule { r[0].Description = "Large"; r[0].Severity = "high"; return r }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changed(tt.change); (got == version) != tt.same {
+				t.Errorf("version %s after changing the %s, was %s", got, tt.name, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// CanaryConfig configures the evaluation of a canary rules configuration
+// beside the primary one, on a sample of live transactions, before it is
+// rolled out. Without Rules there is no canary.
+type CanaryConfig struct {
+	Rules []RiskRule
+	// Percent of the transactions whose risk is assessed are evaluated
+	// with both configurations, chosen by transaction ID so a replay
+	// samples the same transactions
+	Percent float64
+	// Recorder publishes the comparisons, and may be nil
+	Recorder CanaryRecorder
+}
+
+// CanaryRecorder records the comparison of the canary and primary
+// decisions of a transaction. RecordComparison must not block the decision
+// path.
+type CanaryRecorder interface {
+	RecordComparison(ctx context.Context, comparison *models.CanaryComparison)
+}
+
+// CanaryStats is the agreement of the canary with the primary rules since
+// the processor started
+type CanaryStats struct {
+	PrimaryRulesVersion string  `json:"primary_rules_version"`
+	CanaryRulesVersion  string  `json:"canary_rules_version"`
+	SamplePercent       float64 `json:"sample_percent"`
+	Compared            int64   `json:"compared"`
+	Agreed              int64   `json:"agreed"`
+	// AgreementRate is Agreed over Compared, 0 before any comparison
+	AgreementRate float64 `json:"agreement_rate"`
+	// RuleDisagreements counts, by rule, the disagreeing decisions in which
+	// the rule was enforced by one configuration and not the other
+	RuleDisagreements map[string]int64 `json:"rule_disagreements"`
+}
+
+// canary is a canary rules configuration and its agreement so far
+type canary struct {
+	rules    []RiskRule
+	version  string
+	percent  float64
+	recorder CanaryRecorder
+
+	mu            sync.Mutex
+	compared      int64
+	agreed        int64
+	disagreements map[string]int64
+}
+
+// newCanary returns the canary of cfg, or nil without canary rules
+func newCanary(cfg CanaryConfig) *canary {
+	if cfg.Rules == nil {
+		return nil
+	}
+	return &canary{
+		rules:         cfg.Rules,
+		version:       RulesVersion(cfg.Rules),
+		percent:       cfg.Percent,
+		recorder:      cfg.Recorder,
+		disagreements: make(map[string]int64),
+	}
+}
+
+// sampled reports whether the transaction with id is evaluated with the
+// canary rules. The choice depends on the ID alone.
+func (c *canary) sampled(id string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return float64(h.Sum64()%10000) < c.percent*100
+}
+
+// score returns the risk score the canary rules give txn with the noise of
+// the primary assessment, lowered as p lowers recurring charges, and the
+// enforced rules that matched. txn is only read.
+func (c *canary) score(p *Processor, txn *models.ProcessedTransaction, facts Facts, noise float64) (float64, []string) {
+	score := noise
+	fired := []string{}
+	for _, rule := range c.rules {
+		if rule.Mode == RuleModeShadow {
+			continue
+		}
+		if matched, _ := safeMatch(rule, txn, facts); !matched {
+			continue
+		}
+		score += rule.Weight
+		fired = append(fired, rule.Name)
+	}
+	if factor, ok := p.recurrenceFactor(score, facts); ok {
+		score += factor.Weight
+		fired = append(fired, factor.Factor)
+	}
+	return min(score, 1.0), fired
+}
+
+// record counts a comparison
+func (c *canary) record(comparison *models.CanaryComparison) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.compared++
+	if comparison.Agree {
+		c.agreed++
+		return
+	}
+	for _, rule := range comparison.DisagreeingRules {
+		c.disagreements[rule]++
+	}
+}
+
+// compareCanary evaluates a sampled transaction decided at the risk stage
+// with the canary rules, on the facts and noise of its primary decision,
+// and records how the two decisions compare. It runs once the primary
+// decision is published and changes nothing about it.
+func (p *Processor) compareCanary(ctx context.Context, d *decision) {
+	c := p.canary
+	if c == nil || d.stage != models.DecisionStageRisk || d.assessment == nil || !c.sampled(d.txn.ID) {
+		return
+	}
+
+	txn := d.txn
+	primaryFired := []string{}
+	for _, factor := range d.assessment.RiskFactors {
+		// The AML review is set by the type policy, not by the rules
+		if factor.Factor != AMLReviewFactor {
+			primaryFired = append(primaryFired, factor.Factor)
+		}
+	}
+	canaryScore, canaryFired := c.score(p, txn, d.facts, d.assessment.Noise)
+	canaryDecision := decisionFor(canaryScore)
+	if d.review && canaryDecision == models.StatusApproved {
+		canaryDecision = models.StatusFlagged
+	}
+
+	comparison := &models.CanaryComparison{
+		TransactionID:       txn.ID,
+		TenantID:            txn.TenantID,
+		ComparedAt:          time.Now(),
+		PrimaryRulesVersion: p.rulesVersion,
+		CanaryRulesVersion:  c.version,
+		PrimaryScore:        txn.RiskScore,
+		CanaryScore:         canaryScore,
+		PrimaryDecision:     txn.Status,
+		CanaryDecision:      canaryDecision,
+		PrimaryRulesFired:   primaryFired,
+		CanaryRulesFired:    canaryFired,
+		DisagreeingRules:    []string{},
+	}
+	comparison.Agree = comparison.PrimaryDecision == comparison.CanaryDecision
+	for _, rule := range primaryFired {
+		if !slices.Contains(canaryFired, rule) {
+			comparison.DisagreeingRules = append(comparison.DisagreeingRules, rule)
+		}
+	}
+	for _, rule := range canaryFired {
+		if !slices.Contains(primaryFired, rule) {
+			comparison.DisagreeingRules = append(comparison.DisagreeingRules, rule)
+		}
+	}
+
+	c.record(comparison)
+	if p.metrics != nil {
+		p.metrics.RecordCanaryComparison(comparison.Agree)
+		if !comparison.Agree {
+			for _, rule := range comparison.DisagreeingRules {
+				p.metrics.RecordCanaryRuleDisagreement(rule)
+			}
+		}
+	}
+	if c.recorder != nil {
+		c.recorder.RecordComparison(ctx, comparison)
+	}
+}
+
+// decisionFor returns the status of a valid transaction scoring score, as
+// applyBusinessRules and setFinalStatus decide it
+func decisionFor(score float64) string {
+	switch {
+	case score < autoApproveBelow:
+		return models.StatusApproved
+	case score > autoRejectAbove:
+		return models.StatusRejected
+	case score > flagAbove:
+		return models.StatusFlagged
+	default:
+		return models.StatusApproved
+	}
+}
+
+// CanaryStats returns the agreement of the canary with the primary rules,
+// and false when there is no canary
+func (p *Processor) CanaryStats() (CanaryStats, bool) {
+	c := p.canary
+	if c == nil {
+		return CanaryStats{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CanaryStats{
+		PrimaryRulesVersion: p.rulesVersion,
+		CanaryRulesVersion:  c.version,
+		SamplePercent:       c.percent,
+		Compared:            c.compared,
+		Agreed:              c.agreed,
+		RuleDisagreements:   make(map[string]int64, len(c.disagreements)),
+	}
+	if c.compared > 0 {
+		stats.AgreementRate = float64(c.agreed) / float64(c.compared)
+	}
+	for rule, n := range c.disagreements {
+		stats.RuleDisagreements[rule] = n
+	}
+	return stats, true
+}
+
+// CanaryHandler serves GET /admin/canary, the agreement of the canary rules
+// with the primary ones, authenticated by token as a bearer token; an empty
+// token refuses every request
+func CanaryHandler(p *Processor, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		stats, ok := p.CanaryStats()
+		if !ok {
+			http.Error(w, "no canary rules configured", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+}
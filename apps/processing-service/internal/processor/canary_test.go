@@ -0,0 +1,280 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// fakeCanaryRecorder records the canary comparisons
+type fakeCanaryRecorder struct {
+	mu          sync.Mutex
+	comparisons []*models.CanaryComparison
+}
+
+func (r *fakeCanaryRecorder) RecordComparison(_ context.Context, comparison *models.CanaryComparison) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.comparisons = append(r.comparisons, comparison)
+}
+
+func (r *fakeCanaryRecorder) recorded() []*models.CanaryComparison {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.comparisons)
+}
+
+// canaryRules returns the default rules with high_amount replaced by a
+// heavier very_high_amount, rejecting what the primary rules approve
+func canaryRules() []RiskRule {
+	rules := withMode("high_amount", "")
+	return append(rules, RiskRule{
+		Name:        "very_high_amount",
+		Mode:        RuleModeEnforce,
+		Weight:      0.9,
+		Description: "Transaction amount exceeds 10,000",
+		Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+			return thresholdAmount(txn) > highAmount
+		},
+	})
+}
+
+// newCanaryProcessor returns a test processor comparing the canary rules
+// on percent of the transactions
+func newCanaryProcessor(pub *fake.Publisher, metrics Metrics, percent float64, recorder CanaryRecorder) *Processor {
+	return NewProcessor(Deps{
+		Publisher: pub,
+		Metrics:   metrics,
+		Canary:    CanaryConfig{Rules: canaryRules(), Percent: percent, Recorder: recorder},
+	})
+}
+
+// canaryTraffic returns transactions of every decision, by day and night,
+// small and large
+func canaryTraffic() []*models.RawTransaction {
+	day := time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 3, 4, 23, 30, 0, 0, time.UTC)
+	var txns []*models.RawTransaction
+	for i, amount := range []float64{25, 950, 15000, 60000} {
+		txns = append(txns,
+			rawTransaction(fmt.Sprintf("txn_day_%d", i), amount, day),
+			rawTransaction(fmt.Sprintf("txn_night_%d", i), amount, night))
+	}
+	invalid := rawTransaction("txn_invalid", -5, day)
+	return append(txns, invalid)
+}
+
+func TestCanaryDoesNotChangePublishedDecisions(t *testing.T) {
+	primaryPub, canaryPub := fake.New(), fake.New()
+	primary := NewProcessor(Deps{Publisher: primaryPub})
+	recorder := &fakeCanaryRecorder{}
+	withCanary := newCanaryProcessor(canaryPub, nil, 100, recorder)
+
+	for _, txn := range canaryTraffic() {
+		a, b := *txn, *txn
+		if err := primary.ProcessTransaction(context.Background(), &a); err != nil {
+			t.Fatalf("ProcessTransaction: %v", err)
+		}
+		if err := withCanary.ProcessTransaction(context.Background(), &b); err != nil {
+			t.Fatalf("ProcessTransaction with a canary: %v", err)
+		}
+	}
+
+	want, got := primaryPub.Transactions(), canaryPub.Transactions()
+	if len(got) != len(want) {
+		t.Fatalf("%d transactions published with a canary, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w, g := *want[i], *got[i]
+		w.ProcessedAt, g.ProcessedAt = time.Time{}, time.Time{}
+		w.ProcessingTime, g.ProcessingTime = 0, 0
+		if !reflect.DeepEqual(w, g) {
+			t.Errorf("%s published as\n%+v\nwith a canary, want\n%+v", w.ID, g, w)
+		}
+	}
+
+	// Every transaction decided on its risk was compared, some disagreeing
+	comparisons := recorder.recorded()
+	if len(comparisons) != len(want)-1 {
+		t.Errorf("%d comparisons recorded, want one per valid transaction", len(comparisons))
+	}
+	if !slices.ContainsFunc(comparisons, func(c *models.CanaryComparison) bool { return !c.Agree }) {
+		t.Error("no comparison disagrees, so the canary decided nothing differently")
+	}
+}
+
+func TestCanaryComparison(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	recorder := &fakeCanaryRecorder{}
+	p := newCanaryProcessor(pub, metrics, 100, recorder)
+
+	day := time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC)
+	process(t, p, pub, rawTransaction("txn_small", 25, day))
+	large := process(t, p, pub, rawTransaction("txn_large", 15000, day))
+
+	comparisons := recorder.recorded()
+	if len(comparisons) != 2 {
+		t.Fatalf("%d comparisons recorded, want 2", len(comparisons))
+	}
+
+	small := comparisons[0]
+	if !small.Agree || small.PrimaryDecision != models.StatusApproved || small.CanaryDecision != models.StatusApproved ||
+		len(small.DisagreeingRules) != 0 || small.PrimaryScore != small.CanaryScore {
+		t.Errorf("small transaction compared as %+v, want both approving alike", small)
+	}
+
+	c := comparisons[1]
+	if c.Agree || c.PrimaryDecision != models.StatusApproved || c.CanaryDecision != models.StatusRejected {
+		t.Errorf("large transaction %s by the primary and %s by the canary, agree %v, want approved, rejected and disagreeing",
+			c.PrimaryDecision, c.CanaryDecision, c.Agree)
+	}
+	if c.PrimaryScore != large.RiskScore || c.PrimaryDecision != large.Status {
+		t.Errorf("primary side %v %s, want the published %v %s", c.PrimaryScore, c.PrimaryDecision, large.RiskScore, large.Status)
+	}
+	// Both scores carry the same noise
+	if got := c.CanaryScore - c.PrimaryScore; got < 0.6-1e-9 || got > 0.6+1e-9 {
+		t.Errorf("canary score %v, want the primary %v raised by 0.6", c.CanaryScore, c.PrimaryScore)
+	}
+	if !reflect.DeepEqual(c.PrimaryRulesFired, []string{"high_amount"}) || !reflect.DeepEqual(c.CanaryRulesFired, []string{"very_high_amount"}) {
+		t.Errorf("rules fired %v by the primary and %v by the canary", c.PrimaryRulesFired, c.CanaryRulesFired)
+	}
+	if !reflect.DeepEqual(c.DisagreeingRules, []string{"high_amount", "very_high_amount"}) {
+		t.Errorf("disagreeing rules = %v, want high_amount and very_high_amount", c.DisagreeingRules)
+	}
+	if c.PrimaryRulesVersion != RulesVersion(DefaultRiskRules()) || c.CanaryRulesVersion != RulesVersion(canaryRules()) {
+		t.Errorf("versions %s and %s, want those of the two configurations", c.PrimaryRulesVersion, c.CanaryRulesVersion)
+	}
+
+	if agreed, disagreed := metrics.canary(); agreed != 1 || disagreed != 1 {
+		t.Errorf("%d agreeing and %d disagreeing comparisons counted, want 1 and 1", agreed, disagreed)
+	}
+	if n := metrics.ruleDisagreements("very_high_amount"); n != 1 {
+		t.Errorf("very_high_amount counted in %d disagreements, want 1", n)
+	}
+
+	stats, ok := p.CanaryStats()
+	if !ok {
+		t.Fatal("no canary stats")
+	}
+	want := CanaryStats{
+		PrimaryRulesVersion: c.PrimaryRulesVersion,
+		CanaryRulesVersion:  c.CanaryRulesVersion,
+		SamplePercent:       100,
+		Compared:            2,
+		Agreed:              1,
+		AgreementRate:       0.5,
+		RuleDisagreements:   map[string]int64{"high_amount": 1, "very_high_amount": 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestCanarySamplingIsDeterministic(t *testing.T) {
+	c := newCanary(CanaryConfig{Rules: canaryRules(), Percent: 10})
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("txn_%d", i)
+		first := c.sampled(id)
+		if again := c.sampled(id); again != first {
+			t.Fatalf("%s sampled %v then %v", id, first, again)
+		}
+		if first {
+			sampled++
+		}
+	}
+	if sampled < 900 || sampled > 1100 {
+		t.Errorf("%d of 10000 transactions sampled at 10%%, want about 1000", sampled)
+	}
+
+	// A replay through another processor compares the same transactions
+	compared := func() []string {
+		pub := fake.New()
+		recorder := &fakeCanaryRecorder{}
+		p := newCanaryProcessor(pub, nil, 30, recorder)
+		for i := 0; i < 50; i++ {
+			process(t, p, pub, rawTransaction(fmt.Sprintf("txn_%d", i), 25, time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC)))
+		}
+		var ids []string
+		for _, c := range recorder.recorded() {
+			ids = append(ids, c.TransactionID)
+		}
+		return ids
+	}
+	first := compared()
+	if len(first) == 0 || len(first) == 50 {
+		t.Fatalf("%d of 50 transactions compared at 30%%", len(first))
+	}
+	if again := compared(); !reflect.DeepEqual(again, first) {
+		t.Errorf("replay compared %v, want %v", again, first)
+	}
+}
+
+func TestNoCanaryWithoutRules(t *testing.T) {
+	p := newTestProcessor(fake.New())
+	if _, ok := p.CanaryStats(); ok {
+		t.Error("canary stats without canary rules")
+	}
+	if c := newCanary(CanaryConfig{Percent: 100}); c != nil {
+		t.Error("canary created without rules")
+	}
+}
+
+func TestCanaryHandler(t *testing.T) {
+	pub := fake.New()
+	p := newCanaryProcessor(pub, nil, 100, nil)
+	process(t, p, pub, rawTransaction("txn_large", 15000, time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC)))
+
+	get := func(handler http.Handler, method, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/admin/canary", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	handler := CanaryHandler(p, "admin-token")
+	w := get(handler, http.MethodGet, "admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var stats CanaryStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.Compared != 1 || stats.Agreed != 0 || stats.AgreementRate != 0 || stats.RuleDisagreements["very_high_amount"] != 1 {
+		t.Errorf("stats = %+v, want one disagreeing comparison", stats)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		token   string
+		status  int
+	}{
+		{"no token", handler, http.MethodGet, "", http.StatusUnauthorized},
+		{"wrong token", handler, http.MethodGet, "guess", http.StatusUnauthorized},
+		{"no token configured", CanaryHandler(p, ""), http.MethodGet, "", http.StatusUnauthorized},
+		{"not a GET", handler, http.MethodPost, "admin-token", http.StatusMethodNotAllowed},
+		{"no canary", CanaryHandler(newTestProcessor(fake.New()), "admin-token"), http.MethodGet, "admin-token", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := get(tt.handler, tt.method, tt.token); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+)
+
+// testConversion converts into USD at 0.8 EUR and 80 INR to the dollar,
+// without a rate for GBP
+func testConversion(t *testing.T) Conversion {
+	t.Helper()
+	rates, err := currency.ParseRates([]byte(`{"base":"USD","rates":{"EUR":0.8,"INR":80}}`))
+	if err != nil {
+		t.Fatalf("ParseRates: %v", err)
+	}
+	return Conversion{Rates: currency.NewConverter(rates), Base: "USD"}
+}
+
+// newConvertingProcessor returns a test processor converting amounts with
+// conversion
+func newConvertingProcessor(pub *fake.Publisher, metrics Metrics, conversion Conversion) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Metrics: metrics, Conversion: conversion})
+}
+
+// inCurrency returns a transaction of amount in code
+func inCurrency(id string, amount float64, code string) *models.RawTransaction {
+	txn := rawTransaction(id, amount, time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC))
+	txn.Currency = code
+	return txn
+}
+
+func TestHighAmountRuleComparesTheBaseAmount(t *testing.T) {
+	tests := []struct {
+		name string
+		txn  *models.RawTransaction
+		high bool
+	}{
+		{"EUR worth over 10,000 dollars", inCurrency("txn_1", 9999, "EUR"), true},
+		{"INR worth under 10,000 dollars", inCurrency("txn_2", 500000, "INR"), false},
+		{"USD over 10,000", inCurrency("txn_3", 10001, "USD"), true},
+		{"USD under 10,000", inCurrency("txn_4", 9999, "USD"), false},
+		// Without a rate the amount is compared in its own currency
+		{"GBP over 10,000 without a rate", inCurrency("txn_5", 10001, "GBP"), true},
+		{"GBP under 10,000 without a rate", inCurrency("txn_6", 9999, "GBP"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			metrics := newFakeMetrics()
+			process(t, newConvertingProcessor(pub, metrics, testConversion(t)), pub, tt.txn)
+			if _, contributions := metrics.counts("high_amount"); (contributions == 1) != tt.high {
+				t.Errorf("high_amount contributed %d times, want %v", contributions, tt.high)
+			}
+		})
+	}
+}
+
+// rule returns the default rule named name
+func rule(t *testing.T, name string) RiskRule {
+	t.Helper()
+	for _, r := range DefaultRiskRules() {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("no default rule %s", name)
+	return RiskRule{}
+}
+
+func TestAmountRulesCompareTheBaseAmount(t *testing.T) {
+	// converted returns a transaction of amount in code, worth base in USD,
+	// unconverted when base is zero
+	converted := func(amount float64, code string, base float64) *models.ProcessedTransaction {
+		txn := &models.ProcessedTransaction{}
+		txn.Amount, txn.Currency = amount, code
+		if base > 0 {
+			txn.BaseCurrency, txn.BaseAmount = "USD", base
+		}
+		return txn
+	}
+	tests := []struct {
+		rule        string
+		txn         *models.ProcessedTransaction
+		match       bool
+		description string
+	}{
+		{"high_amount", converted(9999, "EUR", 12498.75), true, "Transaction amount exceeds 10,000 USD"},
+		{"high_amount", converted(900000, "INR", 9500), false, ""},
+		{"high_amount", converted(10001, "GBP", 0), true, "Transaction amount exceeds 10,000 GBP"},
+		{"new_device_high_amount", converted(900, "EUR", 1125), true, "First transaction from this device, for over 1,000 USD"},
+		{"new_device_high_amount", converted(90000, "INR", 1000), false, ""},
+		{"new_device", converted(90000, "INR", 1000), true, "First transaction from this device"},
+		{"new_device", converted(1001, "GBP", 0), false, ""},
+	}
+	for _, tt := range tests {
+		r := rule(t, tt.rule)
+		facts := Facts{Device: DeviceNew}
+		if got := r.Match(tt.txn, facts); got != tt.match {
+			t.Errorf("%s on %v %s (%v USD) = %v, want %v", tt.rule, tt.txn.Amount, tt.txn.Currency, tt.txn.BaseAmount, got, tt.match)
+			continue
+		}
+		if !tt.match {
+			continue
+		}
+		description := r.Description
+		if r.Describe != nil {
+			description = r.Describe(tt.txn, facts)
+		}
+		if description != tt.description {
+			t.Errorf("%s described as %q, want %q", tt.rule, description, tt.description)
+		}
+	}
+}
+
+func TestConversionIsRecordedOnTheProcessedTransaction(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	p := newConvertingProcessor(pub, metrics, testConversion(t))
+
+	got := process(t, p, pub, inCurrency("txn_1", 9999, "EUR"))
+	if got.BaseCurrency != "USD" || got.ExchangeRate != 1.25 || got.BaseAmount != 12498.75 {
+		t.Errorf("converted to %v %s at %v, want 12498.75 USD at 1.25", got.BaseAmount, got.BaseCurrency, got.ExchangeRate)
+	}
+	if got.Amount != 9999 || got.Currency != "EUR" {
+		t.Errorf("native amount %v %s, want it kept", got.Amount, got.Currency)
+	}
+
+	got = process(t, p, pub, inCurrency("txn_2", 42.5, "USD"))
+	if got.BaseCurrency != "USD" || got.ExchangeRate != 1 || got.BaseAmount != 42.5 {
+		t.Errorf("base currency recorded as %v %s at %v, want it at 1", got.BaseAmount, got.BaseCurrency, got.ExchangeRate)
+	}
+
+	// A currency without a rate is left unconverted and the lookup counted
+	got = process(t, p, pub, inCurrency("txn_3", 100, "GBP"))
+	if got.BaseCurrency != "" || got.ExchangeRate != 0 || got.BaseAmount != 0 {
+		t.Errorf("unrated amount recorded as %v %s at %v, want no conversion", got.BaseAmount, got.BaseCurrency, got.ExchangeRate)
+	}
+	if n := metrics.failedLookups("rate"); n != 1 {
+		t.Errorf("%d failed rate lookups counted, want 1", n)
+	}
+}
+
+func TestNoConversionWithoutRates(t *testing.T) {
+	pub := fake.New()
+	got := process(t, newConvertingProcessor(pub, nil, Conversion{}), pub, inCurrency("txn_1", 9999, "EUR"))
+	if got.BaseCurrency != "" {
+		t.Errorf("converted to %s without rates", got.BaseCurrency)
+	}
+}
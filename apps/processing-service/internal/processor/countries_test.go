@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/countries"
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newCountryProcessor returns a processor keeping country histories in a
+// Redis stand-in, with a home country after 3 transactions and a switch
+// within 2 hours
+func newCountryProcessor(t *testing.T, pub *fake.Publisher, metrics Metrics) (*Processor, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	history := countries.NewHistory(client, 30*24*time.Hour, 3, 2*time.Hour)
+	p := NewProcessor(Deps{Publisher: pub, Metrics: metrics, Countries: history})
+	return p, mr
+}
+
+// countryFactor returns the country factor the shadow country rules would
+// have added to txn, or nil without one
+func countryFactor(txn *models.ProcessedTransaction) *models.RiskFactor {
+	for i, factor := range txn.ShadowRiskFactors {
+		if strings.HasPrefix(factor.Factor, "country_") {
+			return &txn.ShadowRiskFactors[i]
+		}
+	}
+	return nil
+}
+
+func TestCountryRulesOnSyntheticSequences(t *testing.T) {
+	type step struct {
+		country     string
+		after       time.Duration // since the previous transaction
+		factor      string        // "" for none
+		description string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first transaction", []step{
+			{"FR", 0, "", ""},
+		}},
+		{"consistent country", []step{
+			{"US", 0, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"US", 10 * time.Minute, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+		}},
+		{"away before the history is long enough", []step{
+			{"US", 0, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"FR", 10 * time.Minute, "", ""},
+		}},
+		{"sudden switch", []step{
+			{"US", 0, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"FR", 30 * time.Minute, "country_switch", "Transaction in FR, outside the account's home country US, shortly after one in US"},
+			{"FR", 30 * time.Minute, "country_mismatch", "Transaction in FR, outside the account's home country US"},
+		}},
+		{"travel with time to travel", []step{
+			{"US", 0, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"US", 24 * time.Hour, "", ""},
+			{"GB", 12 * time.Hour, "country_mismatch", "Transaction in GB, outside the account's home country US"},
+			{"US", 7 * 24 * time.Hour, "", ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p, _ := newCountryProcessor(t, pub, nil)
+			at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+			for i, s := range tt.steps {
+				at = at.Add(s.after)
+				txn := rawTransaction("txn_"+string(rune('a'+i)), 120, at)
+				txn.Metadata = map[string]string{"country": s.country}
+
+				got := countryFactor(process(t, p, pub, txn))
+				switch {
+				case s.factor == "" && got != nil:
+					t.Errorf("step %d in %s: factor %+v, want none", i, s.country, got)
+				case s.factor != "" && (got == nil || got.Factor != s.factor || got.Description != s.description):
+					t.Errorf("step %d in %s: factor %+v, want %s: %q", i, s.country, got, s.factor, s.description)
+				}
+			}
+		})
+	}
+}
+
+func TestCountriesAreUncheckedWhenRedisIsDown(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	p, mr := newCountryProcessor(t, pub, metrics)
+	mr.Close()
+
+	txn := rawTransaction("txn_1", 120, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	txn.Metadata = map[string]string{"country": "FR"}
+	got := process(t, p, pub, txn)
+	if got.Status == models.StatusRejected || countryFactor(got) != nil {
+		t.Errorf("status %s with factor %+v, want the country unchecked", got.Status, countryFactor(got))
+	}
+	if n := metrics.failedLookups("country"); n != 1 {
+		t.Errorf("%d failed country lookups counted, want 1", n)
+	}
+}
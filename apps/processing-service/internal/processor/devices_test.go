@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/devices"
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newDeviceProcessor returns a processor with the device rules in mode,
+// keeping device histories in a Redis stand-in
+func newDeviceProcessor(t *testing.T, pub *fake.Publisher, metrics Metrics, mode string) (*Processor, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	var rules []RiskRule
+	for _, rule := range DefaultRiskRules() {
+		if strings.Contains(rule.Name, "device") {
+			rule.Mode = mode
+		}
+		rules = append(rules, rule)
+	}
+	p := NewProcessor(Deps{
+		Publisher: pub,
+		Rules:     rules,
+		Metrics:   metrics,
+		Devices:   devices.NewHistory(client, time.Hour),
+	})
+	return p, mr
+}
+
+// fromDevice returns a transaction of amount from the device
+func fromDevice(id string, amount float64, device string) *models.RawTransaction {
+	txn := rawTransaction(id, amount, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	if device != "" {
+		txn.Metadata = map[string]string{"device_info": device}
+	}
+	return txn
+}
+
+// process processes txn with p, returning its published decision
+func process(t *testing.T, p *Processor, pub *fake.Publisher, txn *models.RawTransaction) *models.ProcessedTransaction {
+	t.Helper()
+	if err := p.ProcessTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("ProcessTransaction: %v", err)
+	}
+	published := pub.Transactions()
+	return published[len(published)-1]
+}
+
+// deviceFactor returns the device factor the shadow device rules would have
+// added to txn, or nil without one
+func deviceFactor(txn *models.ProcessedTransaction) *models.RiskFactor {
+	for i, factor := range txn.ShadowRiskFactors {
+		if strings.Contains(factor.Factor, "device") {
+			return &txn.ShadowRiskFactors[i]
+		}
+	}
+	return nil
+}
+
+func TestNewDevicesAddRisk(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      float64
+		device      string
+		factor      string
+		weight      float64
+		description string
+	}{
+		{"new device", 120, "Pixel 9", "new_device", 0.2, "First transaction from this device"},
+		{"new device, high amount", 4500, "Pixel 9", "new_device_high_amount", 0.4, "First transaction from this device, for over 1,000 USD"},
+		{"no device info", 120, "", "missing_device", 0.05, "Transaction without device information"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p, _ := newDeviceProcessor(t, pub, nil, RuleModeShadow)
+			got := deviceFactor(process(t, p, pub, fromDevice("txn_1", tt.amount, tt.device)))
+			if got == nil || got.Factor != tt.factor || got.Weight != tt.weight || got.Description != tt.description {
+				t.Errorf("device factor %+v, want %s weighing %v: %q", got, tt.factor, tt.weight, tt.description)
+			}
+		})
+	}
+}
+
+func TestRepeatDevicesAddNoRisk(t *testing.T) {
+	pub := fake.New()
+	p, mr := newDeviceProcessor(t, pub, nil, RuleModeShadow)
+
+	if deviceFactor(process(t, p, pub, fromDevice("txn_1", 120, "Pixel 9"))) == nil {
+		t.Fatal("first transaction from the device scored no device factor")
+	}
+	if got := deviceFactor(process(t, p, pub, fromDevice("txn_2", 120, "Pixel 9"))); got != nil {
+		t.Errorf("repeat device scored %+v", got)
+	}
+
+	// The device is new to another user, and to the user on another device
+	other := fromDevice("txn_3", 120, "Pixel 9")
+	other.UserID = "user-2"
+	if got := deviceFactor(process(t, p, pub, other)); got == nil || got.Factor != "new_device" {
+		t.Errorf("another user's first transaction scored %+v, want new_device", got)
+	}
+	if got := deviceFactor(process(t, p, pub, fromDevice("txn_4", 120, "iPad Air"))); got == nil {
+		t.Error("the user's second device scored no device factor")
+	}
+	if members, _ := mr.Members("devices:user-1"); len(members) != 2 {
+		t.Errorf("user-1 has %d devices, want 2", len(members))
+	}
+}
+
+func TestEnforcedDeviceRulesBumpTheScore(t *testing.T) {
+	pub := fake.New()
+	p, _ := newDeviceProcessor(t, pub, nil, RuleModeEnforce)
+
+	first := process(t, p, pub, fromDevice("txn_1", 120, "Pixel 9"))
+	again := process(t, p, pub, fromDevice("txn_2", 120, "Pixel 9"))
+	highAmount := process(t, p, pub, fromDevice("txn_3", 4500, "iPad Air"))
+	// The transaction IDs add noise of less than 0.1 to the scores
+	if bump := first.RiskScore - again.RiskScore; bump < 0.1 || bump > 0.3 {
+		t.Errorf("new device scored %v, repeat %v, want a bump of about 0.2", first.RiskScore, again.RiskScore)
+	}
+	if bump := highAmount.RiskScore - again.RiskScore; bump < 0.3 || bump > 0.5 {
+		t.Errorf("new device for a high amount scored %v, repeat %v, want a bump of about 0.4", highAmount.RiskScore, again.RiskScore)
+	}
+}
+
+func TestRejectedTransactionsDoNotRememberTheDevice(t *testing.T) {
+	pub := fake.New()
+	p, mr := newDeviceProcessor(t, pub, nil, RuleModeShadow)
+
+	rejected := fromDevice("txn_1", 120, "Pixel 9")
+	rejected.Currency = "XYZ"
+	if got := process(t, p, pub, rejected); got.Status != models.StatusRejected {
+		t.Fatalf("status %s, want rejected", got.Status)
+	}
+	if mr.Exists("devices:user-1") {
+		t.Error("device of a rejected transaction remembered")
+	}
+	if got := deviceFactor(process(t, p, pub, fromDevice("txn_2", 120, "Pixel 9"))); got == nil || got.Factor != "new_device" {
+		t.Errorf("next transaction scored %+v, want the device still new", got)
+	}
+}
+
+func TestDevicesAreUncheckedWhenRedisIsDown(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	p, mr := newDeviceProcessor(t, pub, metrics, RuleModeShadow)
+	mr.Close()
+
+	got := process(t, p, pub, fromDevice("txn_1", 120, "Pixel 9"))
+	if got.Status == models.StatusRejected {
+		t.Fatalf("rejected with Redis down: %s", got.RejectionReason)
+	}
+	if factor := deviceFactor(got); factor != nil {
+		t.Errorf("device factor %+v with Redis down, want the device unchecked", factor)
+	}
+	if n := metrics.failedLookups("device"); n != 1 {
+		t.Errorf("%d failed device lookups counted, want 1", n)
+	}
+
+	// Without device info, the missing device factor needs no lookup
+	if factor := deviceFactor(process(t, p, pub, fromDevice("txn_2", 120, ""))); factor == nil || factor.Factor != "missing_device" {
+		t.Errorf("device factor %+v, want missing_device", factor)
+	}
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// maxEvaluateBody bounds the raw transaction an evaluation is asked for
+const maxEvaluateBody = 1 << 20
+
+// Evaluation is the decision the processor would make on a raw transaction
+type Evaluation struct {
+	Transaction *models.ProcessedTransaction `json:"transaction"`
+	// Stage is the stage the transaction was decided at
+	Stage string `json:"stage"`
+	// RiskFactors are the factors of the enforced rules that fired, with
+	// Recommendation and Noise empty when the transaction was decided
+	// before its risk was assessed
+	RiskFactors    []models.RiskFactor `json:"risk_factors"`
+	Recommendation string              `json:"recommendation,omitempty"`
+	Noise          float64             `json:"noise"`
+	// RulesFired and ShadowRulesFired name the enforced and shadow rules
+	// that matched
+	RulesFired       []string `json:"rules_fired"`
+	ShadowRulesFired []string `json:"shadow_rules_fired"`
+	RulesVersion     string   `json:"rules_version"`
+}
+
+// Evaluate decides a raw transaction as ProcessTransaction would, with the
+// current rules, in a dry run: nothing is published or audited, no alert is
+// raised, and the device and country histories are read but not updated.
+// The risk noise is derived from the transaction ID, so with the same rules
+// and histories the evaluation scores a transaction as its live decision.
+func (p *Processor) Evaluate(ctx context.Context, rawTxn *models.RawTransaction) (*Evaluation, error) {
+	d, err := p.decide(ctx, rawTxn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := &Evaluation{
+		Transaction:      d.txn,
+		Stage:            d.stage,
+		RiskFactors:      []models.RiskFactor{},
+		RulesFired:       []string{},
+		ShadowRulesFired: []string{},
+		RulesVersion:     p.rulesVersion,
+	}
+	if d.assessment != nil {
+		if d.assessment.RiskFactors != nil {
+			evaluation.RiskFactors = d.assessment.RiskFactors
+		}
+		evaluation.Recommendation = d.assessment.Recommendation
+		evaluation.Noise = d.assessment.Noise
+		for _, factor := range d.assessment.RiskFactors {
+			evaluation.RulesFired = append(evaluation.RulesFired, factor.Factor)
+		}
+	}
+	for _, factor := range d.txn.ShadowRiskFactors {
+		evaluation.ShadowRulesFired = append(evaluation.ShadowRulesFired, factor.Factor)
+	}
+	return evaluation, nil
+}
+
+// EvaluateHandler serves POST /admin/evaluate, evaluating the raw
+// transaction in the body with Evaluate, authenticated by token as a bearer
+// token; an empty token refuses every request. At most perMinute
+// evaluations are served a minute.
+func EvaluateHandler(p *Processor, token string, perMinute int) http.Handler {
+	limiter := newEvaluateLimiter(perMinute)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !limiter.allow(time.Now()) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "evaluation rate limit reached, retry later", http.StatusTooManyRequests)
+			return
+		}
+
+		var rawTxn models.RawTransaction
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEvaluateBody)).Decode(&rawTxn); err != nil {
+			http.Error(w, "invalid transaction: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		evaluation, err := p.Evaluate(r.Context(), &rawTxn)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to evaluate transaction", "error", err)
+			http.Error(w, "failed to evaluate transaction", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "transaction evaluated", "transaction_id", rawTxn.ID,
+			"status", evaluation.Transaction.Status, "rules_version", evaluation.RulesVersion, "remote_addr", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(evaluation)
+	})
+}
+
+// evaluateLimiter is a token bucket refilling perMinute tokens a minute, up
+// to perMinute
+type evaluateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newEvaluateLimiter(perMinute int) *evaluateLimiter {
+	return &evaluateLimiter{
+		rate:     float64(perMinute) / 60,
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+	}
+}
+
+// allow takes a token at now, reporting whether there was one
+func (l *evaluateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// newTestProcessor returns a processor with the default rules and no
+// lookups, publishing to pub
+func newTestProcessor(pub *fake.Publisher) *Processor {
+	return NewProcessor(Deps{Publisher: pub})
+}
+
+func rawTransaction(id string, amount float64, at time.Time) *models.RawTransaction {
+	return &models.RawTransaction{
+		ID:        id,
+		AccountID: "acct-1",
+		UserID:    "user-1",
+		Amount:    amount,
+		Currency:  "USD",
+		Type:      "purchase",
+		Category:  "groceries",
+		Merchant:  "Corner Shop",
+		Timestamp: at,
+	}
+}
+
+func TestRiskNoiseIsDeterministic(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("txn_%d", i)
+		noise := riskNoise(id)
+		if noise < 0 || noise >= maxRiskNoise {
+			t.Fatalf("noise of %s = %v, want in [0, %v)", id, noise, maxRiskNoise)
+		}
+		if again := riskNoise(id); again != noise {
+			t.Fatalf("noise of %s = %v then %v", id, noise, again)
+		}
+	}
+	if riskNoise("txn_a") == riskNoise("txn_b") {
+		t.Error("distinct transactions drew the same noise")
+	}
+}
+
+func TestEvaluateMatchesTheLiveDecision(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		txn  *models.RawTransaction
+	}{
+		{"low risk", rawTransaction("txn_low", 25, noon)},
+		{"high amount", rawTransaction("txn_high", 20000, noon)},
+		{"high amount at night", rawTransaction("txn_night", 20000, midnight)},
+		{"invalid", rawTransaction("txn_invalid", -5, noon)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p := newTestProcessor(pub)
+
+			evaluation, err := p.Evaluate(context.Background(), tt.txn)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if n := len(pub.Transactions()); n != 0 {
+				t.Fatalf("evaluation published %d transactions", n)
+			}
+
+			live := *tt.txn
+			if err := p.ProcessTransaction(context.Background(), &live); err != nil {
+				t.Fatalf("ProcessTransaction: %v", err)
+			}
+			published := pub.Transactions()
+			if len(published) != 1 {
+				t.Fatalf("%d transactions published, want 1", len(published))
+			}
+
+			got, want := evaluation.Transaction, published[0]
+			if got.Status != want.Status || got.RiskScore != want.RiskScore || got.RiskLevel != want.RiskLevel {
+				t.Errorf("evaluated %s at %v (%s), live decision %s at %v (%s)",
+					got.Status, got.RiskScore, got.RiskLevel, want.Status, want.RiskScore, want.RiskLevel)
+			}
+		})
+	}
+}
+
+func TestEvaluateIsRepeatable(t *testing.T) {
+	p := newTestProcessor(fake.New())
+	txn := rawTransaction("txn_repeat", 20000, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+
+	first, err := p.Evaluate(context.Background(), txn)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := p.Evaluate(context.Background(), txn)
+		if err != nil {
+			t.Fatalf("Evaluate: %v", err)
+		}
+		if again.Noise != first.Noise || again.Transaction.RiskScore != first.Transaction.RiskScore {
+			t.Fatalf("evaluation %d scored %v with noise %v, first %v with noise %v",
+				i+2, again.Transaction.RiskScore, again.Noise, first.Transaction.RiskScore, first.Noise)
+		}
+	}
+	if first.Noise != riskNoise(txn.ID) {
+		t.Errorf("noise = %v, want the transaction's %v", first.Noise, riskNoise(txn.ID))
+	}
+}
+
+func TestEvaluateHandlerMatchesTheLiveDecision(t *testing.T) {
+	pub := fake.New()
+	p := newTestProcessor(pub)
+	handler := EvaluateHandler(p, "admin-token", 60)
+	txn := rawTransaction("txn_http", 20000, time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC))
+
+	body, _ := json.Marshal(txn)
+	r := httptest.NewRequest(http.MethodPost, "/admin/evaluate", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var evaluation Evaluation
+	if err := json.NewDecoder(w.Body).Decode(&evaluation); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if err := p.ProcessTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("ProcessTransaction: %v", err)
+	}
+	live := pub.Transactions()[0]
+	if evaluation.Transaction.Status != live.Status || evaluation.Transaction.RiskScore != live.RiskScore {
+		t.Errorf("evaluated %s at %v, live decision %s at %v",
+			evaluation.Transaction.Status, evaluation.Transaction.RiskScore, live.Status, live.RiskScore)
+	}
+	if len(evaluation.RulesFired) == 0 {
+		t.Error("no rule fired on a large transaction at night")
+	}
+}
+
+func TestEvaluateHandlerRefusesWithoutToken(t *testing.T) {
+	handler := EvaluateHandler(newTestProcessor(fake.New()), "admin-token", 60)
+
+	for _, token := range []string{"", "wrong"} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/evaluate", bytes.NewReader([]byte("{}")))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, w.Code)
+		}
+	}
+}
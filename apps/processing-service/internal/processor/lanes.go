@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"processing-service/internal/models"
+)
+
+// LaneConfig splits transactions between two lanes. Transactions other than
+// refunds of at most FastMaxAmount, in their own currency, whose prescreen
+// score is below FastMaxScore take the fast lane: their risk is assessed
+// without looking up the device, country history or refunded transaction,
+// the rules needing those do not match, and neither the device nor the
+// country is remembered, so the histories learn from the slow lane alone.
+// The account status is checked
+// in both lanes, so inactive accounts are always rejected. Every other
+// transaction takes the slow lane, at most SlowWorkers at a time.
+//
+// A zero FastMaxAmount sends every transaction down the slow lane, and a
+// zero SlowWorkers leaves the slow lane unbounded.
+type LaneConfig struct {
+	FastMaxAmount float64
+	FastMaxScore  float64
+	SlowWorkers   int
+}
+
+// prescreen scores a transaction with the enforced rules matching on facts,
+// without noise or recording anything. It is how sure the processor is that
+// a transaction is low risk before paying for the slow lane's lookups.
+func (p *Processor) prescreen(txn *models.ProcessedTransaction, facts Facts) float64 {
+	score := 0.0
+	for _, rule := range p.rules {
+		if rule.Mode == RuleModeEnforce && rule.Match(txn, facts) {
+			score += rule.Weight
+		}
+	}
+	return score
+}
+
+// laneOf picks the lane of a transaction, given what is known without
+// lookups
+func (p *Processor) laneOf(txn *models.ProcessedTransaction, facts Facts) string {
+	if p.lanes.FastMaxAmount <= 0 || txn.Type == models.TypeRefund || txn.Amount > p.lanes.FastMaxAmount {
+		return models.LaneSlow
+	}
+	if p.prescreen(txn, facts) >= p.lanes.FastMaxScore {
+		return models.LaneSlow
+	}
+	return models.LaneFast
+}
+
+// quickFacts returns what is known about a transaction without lookups,
+// besides the status of its account
+func quickFacts(txn *models.ProcessedTransaction, account AccountState) Facts {
+	facts := Facts{Account: account, Device: DeviceUnchecked}
+	if txn.DeviceInfo == "" {
+		facts.Device = DeviceMissing
+	}
+	return facts
+}
+
+// enterSlowLane waits for a slot in the slow lane, returning the function
+// releasing it
+func (p *Processor) enterSlowLane(ctx context.Context) (func(), error) {
+	if p.slowLane == nil {
+		return func() {}, nil
+	}
+	select {
+	case p.slowLane <- struct{}{}:
+		return func() { <-p.slowLane }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to enter the slow lane: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,251 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// countingLookups stands in for the device, country, parent and recurrence
+// lookups of the slow lane, counting the calls made to each. Lookups, as
+// opposed to the records made after publishing, wait on gate when it is
+// set, tracking how many are in flight.
+type countingLookups struct {
+	gate chan struct{}
+
+	mu          sync.Mutex
+	calls       map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func newCountingLookups() *countingLookups {
+	return &countingLookups{calls: make(map[string]int)}
+}
+
+// recorded counts a call recording what was seen
+func (l *countingLookups) recorded(lookup string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls[lookup]++
+}
+
+// called counts a lookup, waiting on gate
+func (l *countingLookups) called(lookup string) {
+	l.mu.Lock()
+	l.calls[lookup]++
+	l.inFlight++
+	l.maxInFlight = max(l.maxInFlight, l.inFlight)
+	l.mu.Unlock()
+
+	if l.gate != nil {
+		<-l.gate
+	}
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+}
+
+// total returns the number of lookups made of any kind
+func (l *countingLookups) total() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, calls := range l.calls {
+		n += calls
+	}
+	return n
+}
+
+func (l *countingLookups) Known(context.Context, string, string) (bool, error) {
+	l.called("device")
+	return true, nil
+}
+
+func (l *countingLookups) Remember(context.Context, string, string) error {
+	l.recorded("device")
+	return nil
+}
+
+func (l *countingLookups) Compare(context.Context, string, string, time.Time) (models.CountryFacts, error) {
+	l.called("country")
+	return models.CountryFacts{}, nil
+}
+
+func (l *countingLookups) Record(context.Context, string, string, time.Time) error {
+	l.recorded("country")
+	return nil
+}
+
+func (l *countingLookups) ParentTransaction(context.Context, string) (*models.ParentTransaction, error) {
+	l.called("parent")
+	return nil, nil
+}
+
+// recurrenceLookups adapts countingLookups to RecurrenceHistory, whose
+// Record differs from that of CountryHistory
+type recurrenceLookups struct{ *countingLookups }
+
+func (l recurrenceLookups) Match(context.Context, *models.ProcessedTransaction) (models.RecurrenceFacts, error) {
+	l.called("recurrence")
+	return models.RecurrenceFacts{}, nil
+}
+
+func (l recurrenceLookups) Record(context.Context, *models.ProcessedTransaction) error {
+	l.recorded("recurrence")
+	return nil
+}
+
+// newLaneProcessor returns a processor splitting transactions by lanes,
+// looking everything up through lookups
+func newLaneProcessor(pub *fake.Publisher, metrics Metrics, lookups *countingLookups, lanes LaneConfig) *Processor {
+	return NewProcessor(Deps{
+		Publisher:  pub,
+		Rules:      DefaultRiskRules(),
+		Metrics:    metrics,
+		Parents:    lookups,
+		Devices:    lookups,
+		Countries:  lookups,
+		Lanes:      lanes,
+		Recurrence: Recurrence{History: recurrenceLookups{lookups}},
+	})
+}
+
+func TestLaneSelection(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	lateNight := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+	lanes := LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.2}
+
+	tests := []struct {
+		name     string
+		lanes    LaneConfig
+		amount   float64
+		at       time.Time
+		txnType  string
+		merchant string
+		want     string
+	}{
+		{"small", lanes, 25, noon, "", "", models.LaneFast},
+		{"at the amount limit", lanes, 100, noon, "", "", models.LaneFast},
+		{"over the amount limit", lanes, 100.01, noon, "", "", models.LaneSlow},
+		{"refund", lanes, 25, noon, models.TypeRefund, "", models.LaneSlow},
+		// late_night weighs 0.2, at the score limit
+		{"at the score limit", lanes, 25, lateNight, "", "", models.LaneSlow},
+		{"under the score limit", LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.21}, 25, lateNight, "", "", models.LaneFast},
+		{"risky merchant", LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.21}, 25, noon, "", "Crypto Exchange", models.LaneSlow},
+		// missing_device matches every transaction here, in shadow mode
+		{"shadow rules do not count", LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.01}, 25, noon, "", "", models.LaneFast},
+		{"fast lane disabled", LaneConfig{}, 25, noon, "", "", models.LaneSlow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			metrics := newFakeMetrics()
+			lookups := newCountingLookups()
+			p := newLaneProcessor(pub, metrics, lookups, tt.lanes)
+
+			raw := rawTransaction("txn_1", tt.amount, tt.at)
+			if tt.txnType != "" {
+				raw.Type = tt.txnType
+				raw.ParentTransactionID = "txn_0"
+			}
+			if tt.merchant != "" {
+				raw.Merchant = tt.merchant
+			}
+			txn := process(t, p, pub, raw)
+			if txn.Lane != tt.want {
+				t.Errorf("took the %s lane, want %s", txn.Lane, tt.want)
+			}
+			if metrics.lanes(tt.want) != 1 || metrics.lanes(models.LaneFast)+metrics.lanes(models.LaneSlow) != 1 {
+				t.Errorf("lanes counted fast %d slow %d, want one %s", metrics.lanes(models.LaneFast), metrics.lanes(models.LaneSlow), tt.want)
+			}
+		})
+	}
+}
+
+func TestFastLaneLooksNothingUp(t *testing.T) {
+	pub := fake.New()
+	lookups := newCountingLookups()
+	p := newLaneProcessor(pub, newFakeMetrics(), lookups, LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.2})
+
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"txn_1", "txn_2", "txn_3"} {
+		raw := rawTransaction(id, 25, noon)
+		raw.Metadata = map[string]string{"device_info": "Pixel 9", "country": "GB"}
+		if txn := process(t, p, pub, raw); txn.Lane != models.LaneFast || txn.Status != models.StatusApproved {
+			t.Fatalf("%s took the %s lane to %s, want approved in the fast lane", id, txn.Lane, txn.Status)
+		}
+	}
+	if n := lookups.total(); n != 0 {
+		t.Errorf("fast lane made %d lookups %v, want none", n, lookups.calls)
+	}
+
+	// The same transaction over the amount limit pays for every lookup
+	raw := rawTransaction("txn_4", 250, noon)
+	raw.Metadata = map[string]string{"device_info": "Pixel 9", "country": "GB"}
+	if txn := process(t, p, pub, raw); txn.Lane != models.LaneSlow {
+		t.Fatalf("took the %s lane, want slow", txn.Lane)
+	}
+	for _, lookup := range []string{"device", "country", "recurrence"} {
+		if lookups.calls[lookup] == 0 {
+			t.Errorf("slow lane made no %s lookup", lookup)
+		}
+	}
+}
+
+func TestSlowLaneIsBoundedToItsWorkers(t *testing.T) {
+	pub := fake.New()
+	lookups := newCountingLookups()
+	lookups.gate = make(chan struct{})
+	p := newLaneProcessor(pub, newFakeMetrics(), lookups, LaneConfig{FastMaxAmount: 100, FastMaxScore: 0.2, SlowWorkers: 1})
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"txn_1", "txn_2", "txn_3"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			raw := rawTransaction(id, 250, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+			if err := p.ProcessTransaction(context.Background(), raw); err != nil {
+				t.Errorf("ProcessTransaction: %v", err)
+			}
+		}()
+	}
+
+	// The fast lane does not wait for the slow one
+	fast := rawTransaction("txn_fast", 25, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	done := make(chan error, 1)
+	go func() { done <- p.ProcessTransaction(context.Background(), fast) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ProcessTransaction: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast-lane transaction waited on the slow lane")
+	}
+
+	released := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case lookups.gate <- struct{}{}:
+			case <-released:
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(released)
+
+	if lookups.maxInFlight != 1 {
+		t.Errorf("%d lookups in flight at once, want 1 with one slow-lane worker", lookups.maxInFlight)
+	}
+	if n := len(pub.Transactions()); n != 4 {
+		t.Errorf("%d transactions published, want 4", n)
+	}
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/merchants"
+	"processing-service/internal/publisher/fake"
+)
+
+func TestMerchantsAreNormalizedBeforeTheRules(t *testing.T) {
+	aliased, err := merchants.NewNormalizer(merchants.DefaultPatterns, map[string]string{"betco": "betco gambling"})
+	if err != nil {
+		t.Fatalf("NewNormalizer: %v", err)
+	}
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		normalizer MerchantNormalizer
+		merchant   string
+		normalized string
+		risky      bool
+	}{
+		{"risky name", nil, "LUCKY GAMBLING HALL #22", "lucky gambling hall", true},
+		{"processor prefix", nil, "SQ *CRYPTO KIOSK 0042", "crypto kiosk", true},
+		{"ordinary name", nil, "PAYPAL *NETFLIX", "netflix", false},
+		// An alias can name the category a merchant's own name hides
+		{"aliased", aliased, "BETCO*88812", "betco gambling", true},
+		{"without the alias", nil, "BETCO*88812", "betco", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p := NewProcessor(Deps{Publisher: pub, Normalizer: tt.normalizer})
+			txn := rawTransaction("txn_1", 12, noon)
+			txn.Merchant = tt.merchant
+
+			evaluation, err := p.Evaluate(context.Background(), txn)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if fired := strings.Contains(strings.Join(evaluation.RulesFired, ","), "risky_merchant"); fired != tt.risky {
+				t.Errorf("rules fired %v, want risky_merchant %v", evaluation.RulesFired, tt.risky)
+			}
+
+			got := process(t, p, pub, txn)
+			if got.MerchantNormalized != tt.normalized {
+				t.Errorf("normalized %q, want %q", got.MerchantNormalized, tt.normalized)
+			}
+			if got.Merchant != tt.merchant {
+				t.Errorf("merchant %q, want the original %q kept", got.Merchant, tt.merchant)
+			}
+		})
+	}
+}
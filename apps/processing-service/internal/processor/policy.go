@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// AMLReviewFactor is the risk factor of a transaction flagged for AML review
+// by the policy of its type, whatever its risk score
+const AMLReviewFactor = "aml_review"
+
+// validTypes are the transaction types the processor accepts
+var validTypes = []string{"purchase", "transfer", "withdrawal", "deposit", "refund"}
+
+// policyFields are the fields a type policy may require, by their JSON name
+var policyFields = map[string]func(*models.RawTransaction) string{
+	"reference":             func(txn *models.RawTransaction) string { return txn.Reference },
+	"parent_transaction_id": func(txn *models.RawTransaction) string { return txn.ParentTransactionID },
+	"merchant":              func(txn *models.RawTransaction) string { return txn.Merchant },
+	"category":              func(txn *models.RawTransaction) string { return txn.Category },
+}
+
+// TypePolicy is the policy of a transaction type. Amounts are in the
+// currency of the transaction, and zero leaves them unbounded. A
+// transaction over MaxAmount, or lacking one of RequiredFields, is
+// rejected, as is one taking its account's total of the type for the day
+// over DailyCap. One over ForceFlagAbove is flagged for AML review whatever
+// its risk score, unless rejected.
+type TypePolicy struct {
+	MaxAmount      float64  `json:"max_amount,omitempty"`
+	DailyCap       float64  `json:"daily_cap,omitempty"`
+	RequiredFields []string `json:"required_fields,omitempty"`
+	ForceFlagAbove float64  `json:"force_flag_above,omitempty"`
+}
+
+// TypePolicies are the policies of transaction types, by type. A type
+// without one is bound only by the limits common to every transaction.
+type TypePolicies map[string]TypePolicy
+
+// DailyTotals keeps the total amount each account transacted each day, by
+// transaction type and currency
+type DailyTotals interface {
+	Total(ctx context.Context, accountID, txnType, currency string, day time.Time) (float64, error)
+	Add(ctx context.Context, accountID, txnType, currency string, day time.Time, amount float64) error
+}
+
+// TypeLimits bounds transactions by the policy of their type, with the
+// daily totals of accounts kept in Totals. Without Totals no daily cap
+// applies.
+type TypeLimits struct {
+	Policies TypePolicies
+	Totals   DailyTotals
+}
+
+// DefaultTypePolicies returns the built-in type policies: withdrawals are
+// capped at 5000 a day, transfers require a reference, refunds the
+// transaction they refund, and deposits over 10000 are flagged for AML
+// review
+func DefaultTypePolicies() TypePolicies {
+	return TypePolicies{
+		"withdrawal": {DailyCap: 5000},
+		"transfer":   {RequiredFields: []string{"reference"}},
+		"refund":     {RequiredFields: []string{"parent_transaction_id"}},
+		"deposit":    {ForceFlagAbove: 10000},
+	}
+}
+
+// LoadTypePolicies returns the built-in type policies with those set in a
+// JSON file, an object mapping transaction types to their policy. A type
+// the file names takes its policy from the file alone; the others keep
+// their defaults. All problems are reported together.
+func LoadTypePolicies(path string) (TypePolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read type policies: %w", err)
+	}
+
+	var file TypePolicies
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse type policies %s: %w", path, err)
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+
+	policies := DefaultTypePolicies()
+	for txnType, policy := range file {
+		policies[txnType] = policy
+	}
+	return policies, nil
+}
+
+// Validate reports every policy of an unknown type, with a negative amount
+// or requiring a field no policy may require
+func (t TypePolicies) Validate() error {
+	txnTypes := make([]string, 0, len(t))
+	for txnType := range t {
+		txnTypes = append(txnTypes, txnType)
+	}
+	sort.Strings(txnTypes)
+
+	var errs []error
+	for _, txnType := range txnTypes {
+		policy := t[txnType]
+		if !slices.Contains(validTypes, txnType) {
+			errs = append(errs, fmt.Errorf("%s: unknown transaction type, not one of %v", txnType, validTypes))
+			continue
+		}
+		if policy.MaxAmount < 0 || policy.DailyCap < 0 || policy.ForceFlagAbove < 0 {
+			errs = append(errs, fmt.Errorf("%s: max_amount, daily_cap and force_flag_above must not be negative", txnType))
+		}
+		for _, field := range policy.RequiredFields {
+			if _, ok := policyFields[field]; !ok {
+				errs = append(errs, fmt.Errorf("%s: field %q cannot be required", txnType, field))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkTypePolicy returns the violations of txn of the fields and max
+// amount of its type's policy
+func (p *Processor) checkTypePolicy(txn *models.RawTransaction) []models.ValidationError {
+	policy, ok := p.typeLimits.Policies[txn.Type]
+	if !ok {
+		return nil
+	}
+
+	var violations []models.ValidationError
+	for _, field := range policy.RequiredFields {
+		if get := policyFields[field]; get != nil && get(txn) == "" {
+			violations = append(violations, models.ValidationError{
+				Field:   field,
+				Code:    models.ValidationCodeTypeFieldRequired,
+				Message: fmt.Sprintf("%s is required on %s transactions", field, txn.Type),
+			})
+		}
+	}
+	if policy.MaxAmount > 0 && txn.Amount > policy.MaxAmount {
+		violations = append(violations, models.ValidationError{
+			Field:   "amount",
+			Code:    models.ValidationCodeExceedsTypeLimit,
+			Message: fmt.Sprintf("Amount exceeds the %s limit of %g %s", txn.Type, policy.MaxAmount, txn.Currency),
+		})
+	}
+	return violations
+}
+
+// checkDailyCap returns the violation of txn of the daily cap of its type,
+// if it takes its account's total of the day over the cap. A failed lookup
+// is logged and the cap not enforced rather than the transaction held up.
+func (p *Processor) checkDailyCap(ctx context.Context, txn *models.ProcessedTransaction) []models.ValidationError {
+	policy := p.typeLimits.Policies[txn.Type]
+	if p.typeLimits.Totals == nil || policy.DailyCap <= 0 {
+		return nil
+	}
+
+	total, err := p.typeLimits.Totals.Total(ctx, txn.AccountID, txn.Type, txn.Currency, txn.Timestamp)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up daily total", "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordDailyTotalLookupError()
+		}
+		return nil
+	}
+	if total+txn.Amount <= policy.DailyCap {
+		return nil
+	}
+	return []models.ValidationError{{
+		Field:   "amount",
+		Code:    models.ValidationCodeExceedsDailyCap,
+		Message: fmt.Sprintf("Amount exceeds the daily %s cap of %g %s, %g already used", txn.Type, policy.DailyCap, txn.Currency, total),
+	}}
+}
+
+// addDailyTotal adds txn to its account's total of the day, when its type
+// is capped
+func (p *Processor) addDailyTotal(ctx context.Context, txn *models.ProcessedTransaction) {
+	if p.typeLimits.Totals == nil || p.typeLimits.Policies[txn.Type].DailyCap <= 0 {
+		return
+	}
+	if err := p.typeLimits.Totals.Add(ctx, txn.AccountID, txn.Type, txn.Currency, txn.Timestamp, txn.Amount); err != nil {
+		slog.WarnContext(ctx, "failed to add to daily total", "error", err)
+	}
+}
+
+// amlReviewOf returns the risk factor flagging txn for AML review, when its
+// type's policy forces a flag above its amount
+func (p *Processor) amlReviewOf(txn *models.ProcessedTransaction) (models.RiskFactor, bool) {
+	policy := p.typeLimits.Policies[txn.Type]
+	if policy.ForceFlagAbove <= 0 || txn.Amount <= policy.ForceFlagAbove {
+		return models.RiskFactor{}, false
+	}
+	return models.RiskFactor{
+		Factor:      AMLReviewFactor,
+		Description: fmt.Sprintf("%s over %g %s, flagged for AML review", txn.Type, policy.ForceFlagAbove, txn.Currency),
+		Severity:    "high",
+	}, true
+}
@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// fakeTotals keeps daily totals in a map, failing lookups with err when it
+// is set
+type fakeTotals struct {
+	mu     sync.Mutex
+	totals map[string]float64
+	err    error
+}
+
+func newFakeTotals() *fakeTotals {
+	return &fakeTotals{totals: make(map[string]float64)}
+}
+
+// totalKey keys a total by account, type, currency and UTC day
+func totalKey(accountID, txnType, currency string, day time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/%s", accountID, txnType, currency, day.UTC().Format(time.DateOnly))
+}
+
+func (f *fakeTotals) Total(_ context.Context, accountID, txnType, currency string, day time.Time) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.totals[totalKey(accountID, txnType, currency, day)], nil
+}
+
+func (f *fakeTotals) Add(_ context.Context, accountID, txnType, currency string, day time.Time, amount float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.totals[totalKey(accountID, txnType, currency, day)] += amount
+	return nil
+}
+
+// newPolicyProcessor returns a processor bounding types by the default
+// policies, with daily totals kept in totals
+func newPolicyProcessor(pub *fake.Publisher, metrics Metrics, totals DailyTotals) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Metrics: metrics, TypeLimits: TypeLimits{Totals: totals}})
+}
+
+// ofType returns a transaction of txnType with amount at noon
+func ofType(id, txnType string, amount float64) *models.RawTransaction {
+	txn := rawTransaction(id, amount, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	txn.Type = txnType
+	return txn
+}
+
+// hasFactor reports whether factors include factor
+func hasFactor(factors []models.RiskFactor, factor string) bool {
+	for _, f := range factors {
+		if f.Factor == factor {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTypePolicies(t *testing.T) {
+	withReference := ofType("txn_transfer_2", "transfer", 500)
+	withReference.Reference = "rent March"
+	withParent := ofType("txn_refund_2", models.TypeRefund, 20)
+	withParent.ParentTransactionID = "txn_purchase"
+
+	tests := []struct {
+		name       string
+		txn        *models.RawTransaction
+		wantStatus string
+		wantReason string
+		wantAML    bool
+	}{
+		{name: "purchase without a policy", txn: ofType("txn_purchase", "purchase", 500), wantStatus: models.StatusApproved},
+		{name: "withdrawal under its cap", txn: ofType("txn_withdrawal", "withdrawal", 4000), wantStatus: models.StatusApproved},
+		{name: "withdrawal over its cap at once", txn: ofType("txn_withdrawal_2", "withdrawal", 6000), wantStatus: models.StatusRejected,
+			wantReason: "amount: Amount exceeds the daily withdrawal cap of 5000 USD, 0 already used"},
+		{name: "transfer with a reference", txn: withReference, wantStatus: models.StatusApproved},
+		{name: "transfer without a reference", txn: ofType("txn_transfer", "transfer", 500), wantStatus: models.StatusRejected,
+			wantReason: "reference: reference is required on transfer transactions"},
+		{name: "refund naming its parent", txn: withParent, wantStatus: models.StatusApproved},
+		{name: "refund naming no parent", txn: ofType("txn_refund", models.TypeRefund, 20), wantStatus: models.StatusRejected,
+			wantReason: "parent_transaction_id: parent_transaction_id is required on refund transactions"},
+		{name: "deposit at the AML threshold", txn: ofType("txn_deposit", "deposit", 10000), wantStatus: models.StatusApproved},
+		// Over 10,000 it scores about 0.3, approved but for the policy
+		{name: "deposit over the AML threshold", txn: ofType("txn_deposit_2", "deposit", 12000), wantStatus: models.StatusFlagged, wantAML: true},
+		{name: "unknown type", txn: ofType("txn_unknown", "chargeback", 500), wantStatus: models.StatusRejected,
+			wantReason: "type: Invalid transaction type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPolicyProcessor(fake.New(), nil, newFakeTotals())
+			evaluation, err := p.Evaluate(context.Background(), tt.txn)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			got := evaluation.Transaction
+			if got.Status != tt.wantStatus || got.RejectionReason != tt.wantReason {
+				t.Errorf("status %s for %q, want %s for %q", got.Status, got.RejectionReason, tt.wantStatus, tt.wantReason)
+			}
+			if aml := hasFactor(evaluation.RiskFactors, AMLReviewFactor); aml != tt.wantAML {
+				t.Errorf("AML review factor %v, want %v in %+v", aml, tt.wantAML, evaluation.RiskFactors)
+			}
+		})
+	}
+}
+
+func TestTypePolicyMaxAmountAndFields(t *testing.T) {
+	pub := fake.New()
+	policies := TypePolicies{"purchase": {MaxAmount: 2000, RequiredFields: []string{"merchant", "category"}}}
+	p := NewProcessor(Deps{Publisher: pub, TypeLimits: TypeLimits{Policies: policies}})
+
+	txn := ofType("txn_1", "purchase", 2500)
+	txn.Merchant = ""
+	var codes []string
+	for _, e := range p.validateTransaction(txn).Errors {
+		codes = append(codes, e.Field+"="+e.Code)
+	}
+	want := "merchant=" + models.ValidationCodeTypeFieldRequired + ",amount=" + models.ValidationCodeExceedsTypeLimit
+	if got := strings.Join(codes, ","); got != want {
+		t.Errorf("violations %s, want %s", got, want)
+	}
+
+	if got := process(t, p, pub, ofType("txn_2", "purchase", 2000)); got.Status != models.StatusApproved {
+		t.Errorf("status %s at the max amount, want approved", got.Status)
+	}
+}
+
+func TestWithdrawalsAreCappedPerDay(t *testing.T) {
+	pub := fake.New()
+	totals := newFakeTotals()
+	p := newPolicyProcessor(pub, nil, totals)
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	withdrawal := func(id, account, currency string, amount float64, at time.Time) *models.RawTransaction {
+		txn := rawTransaction(id, amount, at)
+		txn.Type, txn.AccountID, txn.Currency = "withdrawal", account, currency
+		return txn
+	}
+
+	tests := []struct {
+		name string
+		txn  *models.RawTransaction
+		want string
+	}{
+		{"first of the day", withdrawal("txn_1", "acct-1", "USD", 3000, noon), models.StatusApproved},
+		{"reaching the cap", withdrawal("txn_2", "acct-1", "USD", 2000, noon.Add(time.Hour)), models.StatusApproved},
+		{"over the cap", withdrawal("txn_3", "acct-1", "USD", 0.01, noon.Add(2*time.Hour)), models.StatusRejected},
+		{"another account", withdrawal("txn_4", "acct-2", "USD", 4000, noon), models.StatusApproved},
+		{"another currency", withdrawal("txn_5", "acct-1", "EUR", 4000, noon), models.StatusApproved},
+		{"the next day", withdrawal("txn_6", "acct-1", "USD", 4000, noon.Add(12*time.Hour)), models.StatusApproved},
+	}
+	for _, tt := range tests {
+		if got := process(t, p, pub, tt.txn); got.Status != tt.want {
+			t.Errorf("%s: status %s (%s), want %s", tt.name, got.Status, got.RejectionReason, tt.want)
+		}
+	}
+
+	// The rejected withdrawal is left out of the total
+	if total, _ := totals.Total(context.Background(), "acct-1", "withdrawal", "USD", noon); total != 5000 {
+		t.Errorf("total %v, want 5000", total)
+	}
+	// Types without a cap keep no total
+	process(t, p, pub, ofType("txn_7", "purchase", 100))
+	if total, _ := totals.Total(context.Background(), "acct-1", "purchase", "USD", noon); total != 0 {
+		t.Errorf("purchase total %v, want none kept", total)
+	}
+}
+
+func TestDailyCapIsUnenforcedWhenTheLookupFails(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	totals := newFakeTotals()
+	totals.err = errors.New("redis unavailable")
+	p := newPolicyProcessor(pub, metrics, totals)
+
+	if got := process(t, p, pub, ofType("txn_1", "withdrawal", 6000)); got.Status != models.StatusApproved {
+		t.Errorf("status %s, want the withdrawal approved", got.Status)
+	}
+	if n := metrics.failedLookups("daily_total"); n != 1 {
+		t.Errorf("%d failed lookups counted, want 1", n)
+	}
+}
+
+func TestLoadTypePolicies(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "type-policies.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	policies, err := LoadTypePolicies(filepath.Join("..", "..", "type-policies.example.json"))
+	if err != nil {
+		t.Fatalf("LoadTypePolicies: %v", err)
+	}
+	if withdrawal := policies["withdrawal"]; withdrawal.MaxAmount != 2000 || withdrawal.DailyCap != 5000 {
+		t.Errorf("withdrawal policy %+v, want the example's", withdrawal)
+	}
+
+	// A type the file names takes its policy from the file alone
+	policies, err = LoadTypePolicies(write(t, `{"deposit": {"max_amount": 50000}}`))
+	if err != nil {
+		t.Fatalf("LoadTypePolicies: %v", err)
+	}
+	if deposit := policies["deposit"]; deposit.MaxAmount != 50000 || deposit.ForceFlagAbove != 0 {
+		t.Errorf("deposit policy %+v, want the file's alone", deposit)
+	}
+	if withdrawal := policies["withdrawal"]; withdrawal.DailyCap != 5000 {
+		t.Errorf("withdrawal policy %+v, want the default", withdrawal)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"not JSON", `{"deposit":`, []string{"failed to parse type policies"}},
+		{"not an object of policies", `{"deposit": {"max_amount": "lots"}}`, []string{"failed to parse type policies"}},
+		{"every problem at once", `{"chargeback": {}, "withdrawal": {"daily_cap": -1}, "transfer": {"required_fields": ["iban"]}}`, []string{
+			"chargeback: unknown transaction type",
+			"withdrawal: max_amount, daily_cap and force_flag_above must not be negative",
+			`transfer: field "iban" cannot be required`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTypePolicies(write(t, tt.content))
+			for _, want := range tt.want {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("LoadTypePolicies() = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadTypePolicies(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "failed to read type policies") {
+		t.Errorf("LoadTypePolicies() = %v, want the missing file reported", err)
+	}
+}
+
+func TestDefaultTypePoliciesAreValid(t *testing.T) {
+	if err := DefaultTypePolicies().Validate(); err != nil {
+		t.Errorf("Validate() = %v, want the defaults valid", err)
+	}
+}
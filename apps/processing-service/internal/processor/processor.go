@@ -2,44 +2,366 @@ package processor
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"math/rand"
+	"hash/fnv"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"processing-service/internal/merchants"
 	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// RecurringFactor is the risk factor lowering the score of a recurring
+// charge
+const RecurringFactor = "recurring_charge"
+
+// Risk score thresholds: transactions scoring below autoApproveBelow are
+// approved outright, those above autoRejectAbove rejected, and approved
+// transactions above flagAbove flagged for review
+const (
+	autoApproveBelow = 0.3
+	flagAbove        = 0.6
+	autoRejectAbove  = 0.8
 )
 
 // Processor handles transaction processing with business logic
 type Processor struct {
-	publisher Publisher
+	publisher    Publisher
+	rules        []RiskRule
+	rulesVersion string
+	// ruleWindows count the evaluations of each rule over the last hour
+	ruleWindows map[string]*ruleWindow
+	metrics     Metrics
+	parents     ParentLookup
+
+	currencies currency.Allowlist
+	blocklist  Blocklist
+	devices    DeviceHistory
+	countries  CountryHistory
+	accounts   AccountStatuses
+	merchants  MerchantNormalizer
+	auditor    DecisionAuditor
+
+	lanes    LaneConfig
+	slowLane chan struct{} // slots of the slow lane, nil when unbounded
+
+	staleness   StalenessPolicy
+	staleAlerts staleAlerts
+
+	conversion Conversion
+	recurrence Recurrence
+	typeLimits TypeLimits
+
+	canary *canary
+}
+
+// Conversion converts transaction amounts into the base currency the amount
+// rules are set in. Without Rates, or without a rate for a currency, amounts
+// are compared in their own currency.
+type Conversion struct {
+	Rates *currency.Converter
+	Base  string
+}
+
+// Recurrence recognizes recurring charges, such as subscriptions, with
+// History, and lowers their risk score by Adjustment, though never below
+// Floor so a recurring charge cannot hide fraud. Without History no charge
+// is recurring.
+type Recurrence struct {
+	History    RecurrenceHistory
+	Adjustment float64
+	Floor      float64
 }
 
-// Publisher interface for publishing processed transactions
+// Publisher interface for publishing processed transactions and the
+// operational alerts raised while processing them
 type Publisher interface {
 	PublishProcessedTransaction(ctx context.Context, transaction *models.ProcessedTransaction) error
+	PublishAlert(ctx context.Context, alert *models.Alert) error
+}
+
+// Metrics records the outcome of risk rules
+type Metrics interface {
+	RecordShadowHit(rule string)
+	RecordParentLookupError()
+	RecordDeviceLookupError()
+	RecordCountryLookupError()
+	RecordAccountLookupError()
+	RecordLane(lane string, took time.Duration)
+	RecordStale(txnType string)
+	RecordRateLookupError()
+	RecordRecurrenceLookupError()
+	RecordDailyTotalLookupError()
+	RecordCanaryComparison(agree bool)
+	RecordCanaryRuleDisagreement(rule string)
+	RecordRuleEvaluation(rule, outcome string, took time.Duration)
+	RecordRuleContribution(rule string, weight float64)
+	RecordDecision(status, topRule string)
+}
+
+// ParentLookup finds the transaction a refund refunds, returning nil when
+// there is no such transaction
+type ParentLookup interface {
+	ParentTransaction(ctx context.Context, id string) (*models.ParentTransaction, error)
+}
+
+// Blocklist finds the active entry blocking a country, merchant or account,
+// returning nil when there is none
+type Blocklist interface {
+	Lookup(entryType, value string) *models.BlocklistEntry
+}
+
+// DeviceHistory remembers the devices each user has transacted from
+type DeviceHistory interface {
+	Known(ctx context.Context, userID, deviceInfo string) (bool, error)
+	Remember(ctx context.Context, userID, deviceInfo string) error
+}
+
+// CountryHistory tracks the countries each account transacts in
+type CountryHistory interface {
+	Compare(ctx context.Context, accountID, country string, at time.Time) (models.CountryFacts, error)
+	Record(ctx context.Context, accountID, country string, at time.Time) error
+}
+
+// RecurrenceHistory tracks the charges of each account at each merchant
+type RecurrenceHistory interface {
+	Match(ctx context.Context, txn *models.ProcessedTransaction) (models.RecurrenceFacts, error)
+	Record(ctx context.Context, txn *models.ProcessedTransaction) error
+}
+
+// AccountStatuses returns the status of an account, or "" when the account
+// is unknown
+type AccountStatuses interface {
+	Status(ctx context.Context, accountID string) (string, error)
+}
+
+// MerchantNormalizer maps a merchant name to its canonical form
+type MerchantNormalizer interface {
+	Normalize(merchant string) string
+}
+
+// DecisionAuditor records the audit of each published decision. Record must
+// not block the decision path.
+type DecisionAuditor interface {
+	Record(ctx context.Context, audit *models.DecisionAudit)
 }
 
-// NewProcessor creates a new transaction processor
-func NewProcessor(publisher Publisher) *Processor {
+// Deps are the dependencies and settings of a Processor. Publisher is
+// required; every other field may be left unset.
+type Deps struct {
+	Publisher Publisher
+
+	// Rules assess risk, DefaultRiskRules when nil
+	Rules []RiskRule
+	// Metrics records the outcomes of processing
+	Metrics Metrics
+	// Parents finds the parents of refunds; without it refunds are assessed
+	// like any other transaction
+	Parents ParentLookup
+	// Currencies are those accepted, currency.DefaultSupported when nil
+	Currencies currency.Allowlist
+	// Blocklist rejects the transactions of blocked countries, merchants
+	// and accounts
+	Blocklist Blocklist
+	// Devices and Countries are checked for new devices and home countries;
+	// without them no device is new and no account has a home country
+	Devices   DeviceHistory
+	Countries CountryHistory
+	// Accounts rejects transactions on frozen and closed accounts
+	Accounts AccountStatuses
+	// Normalizer maps merchant names to their canonical form,
+	// merchants.Default() when nil
+	Normalizer MerchantNormalizer
+	// Auditor audits every published decision
+	Auditor DecisionAuditor
+	// Lanes splits transactions between the fast and slow lanes
+	Lanes LaneConfig
+	// Staleness fails valid transactions picked up too long after ingestion
+	Staleness StalenessPolicy
+	// Conversion converts amounts into the base currency of the amount rules
+	Conversion Conversion
+	// Recurrence recognizes recurring charges and lowers their risk
+	Recurrence Recurrence
+	// TypeLimits binds each type by its policy, DefaultTypePolicies when its
+	// Policies are nil
+	TypeLimits TypeLimits
+	// Canary evaluates a sample of transactions with its rules, if any,
+	// without affecting their decision
+	Canary CanaryConfig
+}
+
+// NewProcessor creates a new transaction processor from deps
+func NewProcessor(deps Deps) *Processor {
+	rules := deps.Rules
+	if rules == nil {
+		rules = DefaultRiskRules()
+	}
+	currencies := deps.Currencies
+	if currencies == nil {
+		currencies, _ = currency.ParseAllowlist(currency.DefaultSupported)
+	}
+	normalizer := deps.Normalizer
+	if normalizer == nil {
+		normalizer = merchants.Default()
+	}
+	typeLimits := deps.TypeLimits
+	if typeLimits.Policies == nil {
+		typeLimits.Policies = DefaultTypePolicies()
+	}
+	var slowLane chan struct{}
+	if deps.Lanes.SlowWorkers > 0 {
+		slowLane = make(chan struct{}, deps.Lanes.SlowWorkers)
+	}
 	return &Processor{
-		publisher: publisher,
+		publisher:    deps.Publisher,
+		rules:        rules,
+		rulesVersion: RulesVersion(rules),
+		ruleWindows:  newRuleWindows(rules),
+		metrics:      deps.Metrics,
+		parents:      deps.Parents,
+		currencies:   currencies,
+		blocklist:    deps.Blocklist,
+		devices:      deps.Devices,
+		countries:    deps.Countries,
+		accounts:     deps.Accounts,
+		merchants:    normalizer,
+		auditor:      deps.Auditor,
+		lanes:        deps.Lanes,
+		slowLane:     slowLane,
+		staleness:    deps.Staleness,
+		conversion:   deps.Conversion,
+		recurrence:   deps.Recurrence,
+		typeLimits:   typeLimits,
+		canary:       newCanary(deps.Canary),
+	}
+}
+
+// Handle satisfies consumer.Handler by decoding a raw transaction and
+// processing it. Messages that cannot be decoded fail permanently, so they
+// are dead-lettered without retries.
+func (p *Processor) Handle(ctx context.Context, message kafka.Message) error {
+	var rawTxn models.RawTransaction
+	if err := json.Unmarshal(message.Value, &rawTxn); err != nil {
+		return consumer.Permanent(fmt.Errorf("failed to decode raw transaction: %w", err))
+	}
+	if rawTxn.ID == "" {
+		slog.WarnContext(ctx, "skipping message without transaction ID",
+			"partition", message.Partition, "offset", message.Offset)
+		return nil
 	}
+
+	return p.ProcessTransaction(ctx, &rawTxn)
 }
 
 // ProcessTransaction processes a raw transaction through business logic
 func (p *Processor) ProcessTransaction(ctx context.Context, rawTxn *models.RawTransaction) error {
-	startTime := time.Now()
+	ctx = logging.WithTransaction(ctx, rawTxn.ID, rawTxn.AccountID)
+
+	slog.DebugContext(ctx, "processing transaction")
 
-	log.Printf("Processing transaction %s for account %s", rawTxn.ID, rawTxn.AccountID)
+	d, err := p.decide(ctx, rawTxn, false)
+	if err != nil {
+		return err
+	}
+	processedTxn := d.txn
+
+	switch d.stage {
+	case models.DecisionStageStaleness:
+		return p.failStale(ctx, processedTxn, d.age, d.maxAge)
+	case models.DecisionStageBlocklist:
+		slog.InfoContext(ctx, "transaction blocked", "reason", logging.RedactString(processedTxn.RejectionReason))
+	case models.DecisionStageAccount:
+		slog.InfoContext(ctx, "transaction on inactive account", "account_status", d.accountStatus)
+	case models.DecisionStageRisk:
+		slog.DebugContext(ctx, "transaction processed",
+			"risk_level", processedTxn.RiskLevel, "risk_score", processedTxn.RiskScore,
+			"status", processedTxn.Status, "duration", processedTxn.ProcessingTime)
+	}
+
+	// Publish processed transaction
+	if err := p.publish(ctx, processedTxn, d.stage, d.assessment); err != nil {
+		return err
+	}
+	p.compareCanary(ctx, d)
+
+	// Remember the device, country and charge only once published, so a
+	// redelivered transaction is assessed the same, and not for a rejected
+	// transaction. The fast lane looked none up, so it remembers none, but
+	// its transactions count towards the daily caps all the same.
+	if d.stage != models.DecisionStageRisk || processedTxn.Status == models.StatusRejected {
+		return nil
+	}
+	p.addDailyTotal(ctx, processedTxn)
+	if processedTxn.Lane == models.LaneFast {
+		return nil
+	}
+	if d.facts.Device == DeviceNew {
+		if err := p.devices.Remember(ctx, processedTxn.UserID, processedTxn.DeviceInfo); err != nil {
+			slog.WarnContext(ctx, "failed to remember device", "error", err)
+		}
+	}
+	if p.countries != nil {
+		if err := p.countries.Record(ctx, processedTxn.AccountID, processedTxn.Country, processedTxn.Timestamp); err != nil {
+			slog.WarnContext(ctx, "failed to record country", "error", err)
+		}
+	}
+	if p.recurrence.History != nil {
+		if err := p.recurrence.History.Record(ctx, processedTxn); err != nil {
+			slog.WarnContext(ctx, "failed to record recurrence", "error", err)
+		}
+	}
+	return nil
+}
+
+// decision is a decided transaction and how it was decided
+type decision struct {
+	txn   *models.ProcessedTransaction
+	stage string
+	// assessment is nil for transactions rejected before their risk was
+	// assessed
+	assessment *models.RiskAssessment
+	facts      Facts
+
+	// review is set when the policy of the transaction's type flagged it
+	// for AML review whatever its score
+	review bool
+
+	// accountStatus is the status of an inactive account
+	accountStatus string
+	// age and maxAge are how late a stale transaction was picked up
+	age, maxAge time.Duration
+}
+
+// decide runs a raw transaction through validation, enrichment, the
+// blocklist, the account check, risk assessment and the business rules. It
+// only reads: publishing the decision and remembering the device and
+// country are up to the caller. A dry run neither records metrics for
+// shadow rules and lanes nor waits for the slow lane, so it never delays
+// live transactions.
+func (p *Processor) decide(ctx context.Context, rawTxn *models.RawTransaction, dryRun bool) (*decision, error) {
+	startTime := time.Now()
 
 	// Create processed transaction
 	processedTxn := &models.ProcessedTransaction{
-		RawTransaction: *rawTxn,
-		ProcessedAt:    time.Now(),
-		ProcessorID:    "processor-001",
+		Transaction: *rawTxn,
+		ProcessedAt: time.Now(),
+		ProcessorID: "processor-001",
 	}
+	if c, ok := currency.Lookup(rawTxn.Currency); ok {
+		processedTxn.CurrencyExponent = c.Exponent
+	}
+	d := &decision{txn: processedTxn}
 
 	// Step 1: Validate transaction
 	validation := p.validateTransaction(rawTxn)
@@ -49,33 +371,100 @@ func (p *Processor) ProcessTransaction(ctx context.Context, rawTxn *models.RawTr
 		processedTxn.Status = models.StatusRejected
 		processedTxn.RejectionReason = p.formatValidationErrors(validation.Errors)
 		processedTxn.ProcessingTime = time.Since(startTime)
+		d.stage = models.DecisionStageValidation
+		return d, nil
+	}
 
-		// Publish rejected transaction
-		return p.publisher.PublishProcessedTransaction(ctx, processedTxn)
+	// Fail a transaction picked up too long after ingestion rather than
+	// decide it after the merchant has given up on it
+	if age, maxAge, stale := p.staleness.check(rawTxn, processedTxn.ProcessedAt); stale {
+		processedTxn.Status = models.StatusFailed
+		processedTxn.RejectionReason = StaleReason
+		processedTxn.ProcessingTime = time.Since(startTime)
+		d.stage, d.age, d.maxAge = models.DecisionStageStaleness, age, maxAge
+		return d, nil
 	}
 
 	// Step 2: Enrich transaction data
 	p.enrichTransaction(processedTxn)
+	p.convertAmount(ctx, processedTxn)
+
+	// Reject blocked countries, merchants and accounts, known once enriched
+	if blocked := p.checkBlocklist(processedTxn); len(blocked) > 0 {
+		processedTxn.IsValid = false
+		processedTxn.Status = models.StatusRejected
+		processedTxn.RejectionReason = p.formatValidationErrors(blocked)
+		processedTxn.ProcessingTime = time.Since(startTime)
+		d.stage = models.DecisionStageBlocklist
+		return d, nil
+	}
+
+	// Reject transactions on frozen and closed accounts
+	account, status := p.accountOf(ctx, processedTxn)
+	if status == models.AccountStatusFrozen || status == models.AccountStatusClosed {
+		processedTxn.IsValid = false
+		processedTxn.Status = models.StatusRejected
+		processedTxn.RejectionReason = p.formatValidationErrors([]models.ValidationError{{
+			Field:   "account_id",
+			Code:    models.ValidationCodeAccountInactive,
+			Message: fmt.Sprintf("Account %s is %s", processedTxn.AccountID, status),
+		}})
+		processedTxn.ProcessingTime = time.Since(startTime)
+		d.stage, d.accountStatus = models.DecisionStageAccount, status
+		return d, nil
+	}
+
+	// Reject transactions over the daily cap of their type
+	if overCap := p.checkDailyCap(ctx, processedTxn); len(overCap) > 0 {
+		processedTxn.IsValid = false
+		processedTxn.Status = models.StatusRejected
+		processedTxn.RejectionReason = p.formatValidationErrors(overCap)
+		processedTxn.ProcessingTime = time.Since(startTime)
+		d.stage = models.DecisionStageValidation
+		return d, nil
+	}
 
-	// Step 3: Assess risk
-	riskAssessment := p.assessRisk(processedTxn)
+	// Step 3: Assess risk, in the fast lane without lookups when the
+	// transaction is confidently low risk
+	laneStart := time.Now()
+	facts := quickFacts(processedTxn, account)
+	processedTxn.Lane = p.laneOf(processedTxn, facts)
+	if processedTxn.Lane == models.LaneSlow {
+		release := func() {}
+		if !dryRun {
+			var err error
+			if release, err = p.enterSlowLane(ctx); err != nil {
+				return nil, err
+			}
+		}
+		facts.Parent = p.parentOf(ctx, rawTxn)
+		facts.Device = p.deviceOf(ctx, processedTxn)
+		facts.Country = p.countryOf(ctx, processedTxn)
+		facts.Recurrence = p.recurrenceOf(ctx, processedTxn)
+		processedTxn.IsRecurring = facts.Recurrence.Recurring
+		release()
+	}
+	riskAssessment := p.assessRisk(processedTxn, facts, dryRun)
+	if p.metrics != nil && !dryRun {
+		p.metrics.RecordLane(processedTxn.Lane, time.Since(laneStart))
+	}
 	processedTxn.RiskScore = riskAssessment.RiskScore
 	processedTxn.RiskLevel = riskAssessment.RiskLevel
 
 	// Step 4: Apply business rules
-	p.applyBusinessRules(processedTxn)
+	d.review = p.applyBusinessRules(processedTxn, riskAssessment)
 
 	// Step 5: Set final status
-	p.setFinalStatus(processedTxn)
+	p.setFinalStatus(processedTxn, d.review)
+	if p.metrics != nil && !dryRun {
+		p.metrics.RecordDecision(processedTxn.Status, topRule(riskAssessment))
+	}
 
 	// Calculate processing time
 	processedTxn.ProcessingTime = time.Since(startTime)
 
-	log.Printf("Transaction %s processed: Risk=%s, Status=%s, Time=%v",
-		processedTxn.ID, processedTxn.RiskLevel, processedTxn.Status, processedTxn.ProcessingTime)
-
-	// Publish processed transaction
-	return p.publisher.PublishProcessedTransaction(ctx, processedTxn)
+	d.stage, d.assessment, d.facts = models.DecisionStageRisk, riskAssessment, facts
+	return d, nil
 }
 
 // validateTransaction validates the transaction against business rules
@@ -124,36 +513,25 @@ func (p *Processor) validateTransaction(txn *models.RawTransaction) *models.Tran
 		validation.IsValid = false
 	}
 
-	// Currency validation
-	validCurrencies := []string{"USD", "EUR", "GBP", "INR", "CAD", "AUD"}
-	currencyValid := false
-	for _, curr := range validCurrencies {
-		if curr == txn.Currency {
-			currencyValid = true
-			break
-		}
-	}
-
-	if !currencyValid {
+	// Currency and amount precision validation
+	if _, err := p.currencies.Validate(txn.Currency, txn.Amount); errors.Is(err, currency.ErrUnsupported) {
 		validation.Errors = append(validation.Errors, models.ValidationError{
 			Field:   "currency",
 			Code:    models.ValidationCodeInvalidCurrency,
 			Message: "Invalid currency code",
 		})
 		validation.IsValid = false
+	} else if err != nil {
+		validation.Errors = append(validation.Errors, models.ValidationError{
+			Field:   "amount",
+			Code:    models.ValidationCodePrecision,
+			Message: "Amount has more decimal places than the currency allows",
+		})
+		validation.IsValid = false
 	}
 
 	// Transaction type validation
-	validTypes := []string{"purchase", "transfer", "withdrawal", "deposit", "refund"}
-	typeValid := false
-	for _, t := range validTypes {
-		if t == txn.Type {
-			typeValid = true
-			break
-		}
-	}
-
-	if !typeValid {
+	if !slices.Contains(validTypes, txn.Type) {
 		validation.Errors = append(validation.Errors, models.ValidationError{
 			Field:   "type",
 			Code:    models.ValidationCodeInvalidType,
@@ -162,22 +540,49 @@ func (p *Processor) validateTransaction(txn *models.RawTransaction) *models.Tran
 		validation.IsValid = false
 	}
 
+	// Fields and limit of the type's policy
+	if violations := p.checkTypePolicy(txn); len(violations) > 0 {
+		validation.Errors = append(validation.Errors, violations...)
+		validation.IsValid = false
+	}
+
 	return validation
 }
 
+// convertAmount records the amount of txn in the base currency and the rate
+// converting it. A currency without a rate is left unconverted, so the
+// amount rules compare its amount as it is.
+func (p *Processor) convertAmount(ctx context.Context, txn *models.ProcessedTransaction) {
+	if p.conversion.Rates == nil {
+		return
+	}
+	amount, rate, err := p.conversion.Rates.Convert(txn.Amount, txn.Currency, p.conversion.Base)
+	if err != nil {
+		if p.metrics != nil {
+			p.metrics.RecordRateLookupError()
+		}
+		slog.WarnContext(ctx, "amount not converted to base currency", "currency", txn.Currency, "base", p.conversion.Base, "error", err)
+		return
+	}
+	txn.BaseCurrency, txn.ExchangeRate, txn.BaseAmount = p.conversion.Base, rate, amount
+}
+
 // enrichTransaction adds additional data to the transaction
 func (p *Processor) enrichTransaction(txn *models.ProcessedTransaction) {
-	// Simulate data enrichment
-	if txn.Metadata != nil {
-		if country, exists := txn.Metadata["country"]; exists {
-			txn.Country = country
-		}
-		if ip, exists := txn.Metadata["ip_address"]; exists {
-			txn.IPAddress = ip
-		}
-		if device, exists := txn.Metadata["device_info"]; exists {
-			txn.DeviceInfo = device
-		}
+	// Enrich from the metadata keys the ingestion service validated
+	if country := txn.MetadataCountry(); country != "" {
+		txn.Country = country
+	}
+	if ip := txn.MetadataIPAddress(); ip != "" {
+		txn.IPAddress = ip
+	}
+	if device := txn.MetadataDeviceInfo(); device != "" {
+		txn.DeviceInfo = device
+	}
+
+	// Canonical merchant name, for per-merchant rules and statistics
+	if txn.Merchant != "" {
+		txn.MerchantNormalized = p.merchants.Normalize(txn.Merchant)
 	}
 
 	// Set default values if not present
@@ -189,62 +594,184 @@ func (p *Processor) enrichTransaction(txn *models.ProcessedTransaction) {
 	}
 }
 
-// assessRisk calculates the risk score for the transaction
-func (p *Processor) assessRisk(txn *models.ProcessedTransaction) *models.RiskAssessment {
-	riskScore := 0.0
-	var riskFactors []models.RiskFactor
+// checkBlocklist returns a validation error for each of the transaction's
+// country, merchant and account that is blocked
+func (p *Processor) checkBlocklist(txn *models.ProcessedTransaction) []models.ValidationError {
+	if p.blocklist == nil {
+		return nil
+	}
 
-	// Amount-based risk
-	if txn.Amount > 10000 {
-		riskScore += 0.3
-		riskFactors = append(riskFactors, models.RiskFactor{
-			Factor:      "high_amount",
-			Weight:      0.3,
-			Description: "Transaction amount exceeds $10,000",
-			Severity:    "medium",
-		})
+	checks := []struct {
+		entryType, field, code, value string
+	}{
+		{models.BlocklistTypeCountry, "country", models.ValidationCodeBlockedCountry, txn.Country},
+		{models.BlocklistTypeMerchant, "merchant", models.ValidationCodeBlockedMerchant, txn.Merchant},
+		{models.BlocklistTypeAccount, "account_id", models.ValidationCodeBlockedAccount, txn.AccountID},
 	}
 
-	// Time-based risk (late night transactions)
-	hour := txn.Timestamp.Hour()
-	if hour >= 22 || hour <= 6 {
-		riskScore += 0.2
-		riskFactors = append(riskFactors, models.RiskFactor{
-			Factor:      "late_night",
-			Weight:      0.2,
-			Description: "Transaction during late night hours",
-			Severity:    "low",
+	var blocked []models.ValidationError
+	for _, check := range checks {
+		entry := p.blocklist.Lookup(check.entryType, check.value)
+		if entry == nil {
+			continue
+		}
+		message := fmt.Sprintf("Blocked %s %s", check.entryType, check.value)
+		if entry.Reason != "" {
+			message += ": " + entry.Reason
+		}
+		blocked = append(blocked, models.ValidationError{
+			Field:   check.field,
+			Code:    check.code,
+			Message: message,
 		})
 	}
+	return blocked
+}
 
-	// Country-based risk
-	if txn.Country == "XX" || txn.Country == "YY" {
-		riskScore += 0.5
-		riskFactors = append(riskFactors, models.RiskFactor{
-			Factor:      "blocked_country",
-			Weight:      0.5,
-			Description: "Transaction from blocked country",
-			Severity:    "high",
-		})
+// accountOf returns whether the storage service knows the transaction's
+// account, with its status when it does. A failed lookup is logged and the
+// transaction assessed as if the account were unchecked rather than held up.
+func (p *Processor) accountOf(ctx context.Context, txn *models.ProcessedTransaction) (AccountState, string) {
+	if p.accounts == nil {
+		return AccountUnchecked, ""
 	}
 
-	// Merchant-based risk
-	if strings.Contains(strings.ToLower(txn.Merchant), "gambling") ||
-		strings.Contains(strings.ToLower(txn.Merchant), "crypto") {
-		riskScore += 0.4
-		riskFactors = append(riskFactors, models.RiskFactor{
-			Factor:      "risky_merchant",
-			Weight:      0.4,
-			Description: "Transaction with risky merchant category",
-			Severity:    "medium",
-		})
+	status, err := p.accounts.Status(ctx, txn.AccountID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up account status", "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordAccountLookupError()
+		}
+		return AccountUnchecked, ""
+	}
+	if status == "" {
+		return AccountUnknown, ""
 	}
+	return AccountKnown, status
+}
 
-	// Random factor for demonstration (in real system, this would be ML-based)
-	rand.Seed(time.Now().UnixNano())
-	randomRisk := rand.Float64() * 0.1
+// deviceOf returns whether the transaction comes from a device new to its
+// user. A failed lookup is logged and the transaction assessed as if the
+// device were unchecked rather than held up.
+func (p *Processor) deviceOf(ctx context.Context, txn *models.ProcessedTransaction) DeviceStatus {
+	if txn.DeviceInfo == "" {
+		return DeviceMissing
+	}
+	if p.devices == nil {
+		return DeviceUnchecked
+	}
+
+	known, err := p.devices.Known(ctx, txn.UserID, txn.DeviceInfo)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up device", "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordDeviceLookupError()
+		}
+		return DeviceUnchecked
+	}
+	if known {
+		return DeviceKnown
+	}
+	return DeviceNew
+}
+
+// countryOf compares the country of the transaction with its account's
+// history. A failed lookup is logged and the transaction assessed as if the
+// account had no home country rather than held up.
+func (p *Processor) countryOf(ctx context.Context, txn *models.ProcessedTransaction) models.CountryFacts {
+	if p.countries == nil {
+		return models.CountryFacts{}
+	}
+
+	facts, err := p.countries.Compare(ctx, txn.AccountID, txn.Country, txn.Timestamp)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up country history", "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordCountryLookupError()
+		}
+		return models.CountryFacts{}
+	}
+	return facts
+}
+
+// recurrenceOf returns whether the transaction is a recurring charge. A
+// failed lookup is logged and the transaction assessed as not recurring
+// rather than held up.
+func (p *Processor) recurrenceOf(ctx context.Context, txn *models.ProcessedTransaction) models.RecurrenceFacts {
+	if p.recurrence.History == nil {
+		return models.RecurrenceFacts{}
+	}
+
+	facts, err := p.recurrence.History.Match(ctx, txn)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up recurrence history", "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordRecurrenceLookupError()
+		}
+		return models.RecurrenceFacts{}
+	}
+	return facts
+}
+
+// parentOf returns the parent transaction of a refund, or nil for other
+// transactions and refunds whose parent is not stored. A failed lookup is
+// logged and the refund assessed without its parent rather than held up.
+func (p *Processor) parentOf(ctx context.Context, txn *models.RawTransaction) *models.ParentTransaction {
+	if p.parents == nil || txn.Type != models.TypeRefund || txn.ParentTransactionID == "" {
+		return nil
+	}
+
+	parent, err := p.parents.ParentTransaction(ctx, txn.ParentTransactionID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up refunded transaction",
+			"parent_transaction_id", txn.ParentTransactionID, "error", err)
+		if p.metrics != nil {
+			p.metrics.RecordParentLookupError()
+		}
+		return nil
+	}
+	if parent == nil {
+		slog.InfoContext(ctx, "refunded transaction not found",
+			"parent_transaction_id", txn.ParentTransactionID)
+	}
+	return parent
+}
+
+// assessRisk calculates the risk score for the transaction. Shadow rules
+// that match are recorded on the transaction instead of scored, and counted
+// unless dryRun is set.
+func (p *Processor) assessRisk(txn *models.ProcessedTransaction, facts Facts, dryRun bool) *models.RiskAssessment {
+	riskScore := 0.0
+	var riskFactors []models.RiskFactor
+
+	for _, rule := range p.rules {
+		if !p.matchRule(rule, txn, facts, dryRun) {
+			continue
+		}
+		if rule.Mode == RuleModeShadow {
+			txn.ShadowRiskFactors = append(txn.ShadowRiskFactors, rule.factor(txn, facts))
+			if p.metrics != nil && !dryRun {
+				p.metrics.RecordShadowHit(rule.Name)
+			}
+			continue
+		}
+		riskScore += rule.Weight
+		riskFactors = append(riskFactors, rule.factor(txn, facts))
+		if p.metrics != nil && !dryRun {
+			p.metrics.RecordRuleContribution(rule.Name, rule.Weight)
+		}
+	}
+
+	// Noise factor for demonstration (in real system, this would be ML-based)
+	randomRisk := riskNoise(txn.ID)
 	riskScore += randomRisk
 
+	// Lower the score of a recurring charge
+	if factor, ok := p.recurrenceFactor(riskScore, facts); ok {
+		riskScore += factor.Weight
+		riskFactors = append(riskFactors, factor)
+	}
+
 	// Cap risk score at 1.0
 	if riskScore > 1.0 {
 		riskScore = 1.0
@@ -255,13 +782,13 @@ func (p *Processor) assessRisk(txn *models.ProcessedTransaction) *models.RiskAss
 	var recommendation string
 
 	switch {
-	case riskScore < 0.3:
+	case riskScore < autoApproveBelow:
 		riskLevel = models.RiskLevelLow
 		recommendation = "Approve automatically"
-	case riskScore < 0.6:
+	case riskScore < flagAbove:
 		riskLevel = models.RiskLevelMedium
 		recommendation = "Review manually"
-	case riskScore < 0.8:
+	case riskScore < autoRejectAbove:
 		riskLevel = models.RiskLevelHigh
 		recommendation = "Flag for investigation"
 	default:
@@ -274,55 +801,75 @@ func (p *Processor) assessRisk(txn *models.ProcessedTransaction) *models.RiskAss
 		RiskLevel:      riskLevel,
 		RiskFactors:    riskFactors,
 		Recommendation: recommendation,
+		Noise:          randomRisk,
 	}
 }
 
-// applyBusinessRules applies business logic to the transaction
-func (p *Processor) applyBusinessRules(txn *models.ProcessedTransaction) {
+// maxRiskNoise bounds the noise added to every risk score
+const maxRiskNoise = 0.1
+
+// riskNoise returns the noise added to the risk score of the transaction with
+// id, in [0, maxRiskNoise). It is derived from the ID, so a redelivered or
+// dry-run transaction is scored the same as its live decision.
+func riskNoise(id string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte("risk-noise/"))
+	h.Write([]byte(id))
+	return float64(h.Sum64()%1000000) / 1000000 * maxRiskNoise
+}
+
+// recurrenceFactor returns the factor lowering score, noise included, for a
+// recurring charge: by the recurrence adjustment, though not below the
+// floor, and never raising a score already below it. ok is false when the
+// score is not lowered.
+func (p *Processor) recurrenceFactor(score float64, facts Facts) (factor models.RiskFactor, ok bool) {
+	if !facts.Recurrence.Recurring {
+		return models.RiskFactor{}, false
+	}
+	adjusted := max(score-p.recurrence.Adjustment, min(score, p.recurrence.Floor))
+	if adjusted >= score {
+		return models.RiskFactor{}, false
+	}
+	return models.RiskFactor{
+		Factor: RecurringFactor,
+		Weight: adjusted - score,
+		Description: fmt.Sprintf("Recurring %s charge, following %d earlier ones",
+			facts.Recurrence.Cadence, facts.Recurrence.Occurrences),
+		Severity: "low",
+	}, true
+}
+
+// applyBusinessRules applies business logic to the transaction, and
+// reports whether the policy of its type flags it for AML review, adding
+// the factor to assessment
+func (p *Processor) applyBusinessRules(txn *models.ProcessedTransaction, assessment *models.RiskAssessment) bool {
+	review, flagged := p.amlReviewOf(txn)
+	if flagged {
+		assessment.RiskFactors = append(assessment.RiskFactors, review)
+	}
+
 	// Auto-approve low-risk transactions
-	if txn.RiskScore < 0.3 {
+	if txn.RiskScore < autoApproveBelow {
 		txn.IsApproved = true
-		return
+		return flagged
 	}
 
 	// Auto-reject high-risk transactions
-	if txn.RiskScore > 0.8 {
+	if txn.RiskScore > autoRejectAbove {
 		txn.IsApproved = false
 		txn.RejectionReason = "High risk score - automatic rejection"
-		return
+		return flagged
 	}
 
-	// For medium risk, apply additional rules
-	if txn.RiskScore >= 0.3 && txn.RiskScore <= 0.8 {
-		// Check for specific risk factors
-		hasBlockedCountry := false
-		hasBlockedMerchant := false
-
-		for _, factor := range []string{"XX", "YY"} {
-			if txn.Country == factor {
-				hasBlockedCountry = true
-				break
-			}
-		}
-
-		for _, merchant := range []string{"blocked_merchant_1", "blocked_merchant_2"} {
-			if txn.Merchant == merchant {
-				hasBlockedMerchant = true
-				break
-			}
-		}
-
-		if hasBlockedCountry || hasBlockedMerchant {
-			txn.IsApproved = false
-			txn.RejectionReason = "Blocked country or merchant"
-		} else {
-			txn.IsApproved = true
-		}
-	}
+	// Approve medium risk; blocked countries and merchants were rejected
+	// before risk was assessed
+	txn.IsApproved = true
+	return flagged
 }
 
-// setFinalStatus sets the final status based on processing results
-func (p *Processor) setFinalStatus(txn *models.ProcessedTransaction) {
+// setFinalStatus sets the final status based on processing results,
+// flagging approved transactions for review when review is set
+func (p *Processor) setFinalStatus(txn *models.ProcessedTransaction, review bool) {
 	if !txn.IsValid {
 		txn.Status = models.StatusRejected
 		return
@@ -335,11 +882,77 @@ func (p *Processor) setFinalStatus(txn *models.ProcessedTransaction) {
 	}
 
 	// Flag high-risk approved transactions for review
-	if txn.IsApproved && txn.RiskScore > 0.6 {
+	if txn.IsApproved && (review || txn.RiskScore > flagAbove) {
 		txn.Status = models.StatusFlagged
 	}
 }
 
+// publish publishes a decided transaction and records the audit of the
+// decision, made at stage. assessment is nil for transactions rejected
+// before their risk was assessed.
+func (p *Processor) publish(ctx context.Context, txn *models.ProcessedTransaction, stage string, assessment *models.RiskAssessment) error {
+	if err := p.publisher.PublishProcessedTransaction(ctx, txn); err != nil {
+		return err
+	}
+	if p.auditor != nil {
+		p.auditor.Record(ctx, p.decisionAudit(txn, stage, assessment))
+	}
+	return nil
+}
+
+// decisionAudit describes how txn was decided
+func (p *Processor) decisionAudit(txn *models.ProcessedTransaction, stage string, assessment *models.RiskAssessment) *models.DecisionAudit {
+	audit := &models.DecisionAudit{
+		TransactionID: txn.ID,
+		TenantID:      txn.TenantID,
+		DecidedAt:     txn.ProcessedAt,
+		Stage:         stage,
+		RulesVersion:  p.rulesVersion,
+		Contributions: []models.RuleContribution{},
+		RiskScore:     txn.RiskScore,
+		RiskLevel:     txn.RiskLevel,
+		Thresholds: models.DecisionThresholds{
+			AutoApprove: autoApproveBelow,
+			Flag:        flagAbove,
+			AutoReject:  autoRejectAbove,
+		},
+		Decision:        txn.Status,
+		RejectionReason: txn.RejectionReason,
+		ProcessorID:     txn.ProcessorID,
+	}
+	if assessment == nil {
+		return audit
+	}
+
+	audit.Noise = assessment.Noise
+	for _, factor := range assessment.RiskFactors {
+		audit.Contributions = append(audit.Contributions, models.RuleContribution{
+			Rule:         factor.Factor,
+			Mode:         RuleModeEnforce,
+			Weight:       factor.Weight,
+			Contribution: factor.Weight,
+		})
+	}
+	for _, factor := range txn.ShadowRiskFactors {
+		audit.Contributions = append(audit.Contributions, models.RuleContribution{
+			Rule:   factor.Factor,
+			Mode:   RuleModeShadow,
+			Weight: factor.Weight,
+		})
+	}
+	return audit
+}
+
+// RulesVersion identifies a rules configuration by a hash of the name, mode
+// and weight of each rule, in order
+func RulesVersion(rules []RiskRule) string {
+	h := sha256.New()
+	for _, rule := range rules {
+		fmt.Fprintf(h, "%s\x00%s\x00%g\n", rule.Name, rule.Mode, rule.Weight)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
 // formatValidationErrors formats validation errors into a readable string
 func (p *Processor) formatValidationErrors(errors []models.ValidationError) string {
 	if len(errors) == 0 {
@@ -356,15 +969,15 @@ func (p *Processor) formatValidationErrors(errors []models.ValidationError) stri
 
 // ProcessBatch processes multiple transactions in batch
 func (p *Processor) ProcessBatch(ctx context.Context, transactions []*models.RawTransaction) error {
-	log.Printf("Processing batch of %d transactions", len(transactions))
+	slog.DebugContext(ctx, "processing batch", "size", len(transactions))
 
 	for _, txn := range transactions {
 		if err := p.ProcessTransaction(ctx, txn); err != nil {
-			log.Printf("Failed to process transaction %s: %v", txn.ID, err)
+			slog.ErrorContext(logging.WithTransaction(ctx, txn.ID, txn.AccountID), "failed to process transaction", "error", err)
 			// Continue processing other transactions
 		}
 	}
 
-	log.Printf("Batch processing completed")
+	slog.DebugContext(ctx, "batch processing completed", "size", len(transactions))
 	return nil
 }
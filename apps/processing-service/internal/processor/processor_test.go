@@ -0,0 +1,325 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/blocklist"
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// errKafka is the error of a publisher whose broker is unreachable
+var errKafka = errors.New("kafka: leader not available")
+
+// fakeAuditor records the decision audits
+type fakeAuditor struct {
+	mu     sync.Mutex
+	audits []*models.DecisionAudit
+}
+
+func (a *fakeAuditor) Record(_ context.Context, audit *models.DecisionAudit) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.audits = append(a.audits, audit)
+}
+
+func (a *fakeAuditor) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.audits)
+}
+
+// newAuditedProcessor returns a test processor publishing to pub and
+// auditing its decisions to auditor
+func newAuditedProcessor(pub *fake.Publisher, auditor *fakeAuditor) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Auditor: auditor})
+}
+
+func message(t *testing.T, txn *models.RawTransaction) kafka.Message {
+	t.Helper()
+	data, err := json.Marshal(txn)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return kafka.Message{Key: []byte(txn.AccountID), Value: data}
+}
+
+func TestHandlePublishesTheDecision(t *testing.T) {
+	pub := fake.New()
+	auditor := &fakeAuditor{}
+	p := newAuditedProcessor(pub, auditor)
+
+	txn := rawTransaction("txn_1", 25, time.Now())
+	if err := p.Handle(context.Background(), message(t, txn)); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	published := pub.Transactions()
+	if len(published) != 1 || published[0].ID != "txn_1" {
+		t.Fatalf("published %d transactions, want txn_1", len(published))
+	}
+	if auditor.count() != 1 {
+		t.Errorf("%d decisions audited, want 1", auditor.count())
+	}
+}
+
+func TestProcessingLogsCarryTheTransactionID(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&buf, "processing-service", slog.LevelDebug))
+
+	p := newTestProcessor(fake.New())
+	if err := p.Handle(context.Background(), message(t, rawTransaction("txn_1", 25, time.Now()))); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	var logged int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		if entry["msg"] != "processing transaction" && entry["msg"] != "transaction processed" {
+			continue
+		}
+		logged++
+		if entry[logging.KeyTransactionID] != "txn_1" || entry[logging.KeyAccountID] != "acct-1" {
+			t.Errorf("entry %v, want the transaction and account IDs", entry)
+		}
+		// Per-transaction success is debug noise, not info
+		if entry["level"] != "DEBUG" {
+			t.Errorf("entry %v logged at %v, want DEBUG", entry, entry["level"])
+		}
+	}
+	if logged != 2 {
+		t.Errorf("%d per-transaction entries in %s, want 2", logged, buf.String())
+	}
+}
+
+func TestHandleSkipsMalformedMessages(t *testing.T) {
+	pub := fake.New()
+	p := newTestProcessor(pub)
+
+	err := p.Handle(context.Background(), kafka.Message{Value: []byte("{not json")})
+	if !consumer.IsPermanent(err) {
+		t.Errorf("error = %v, want a permanent failure", err)
+	}
+	if err := p.Handle(context.Background(), kafka.Message{Value: []byte(`{"amount": 10}`)}); err != nil {
+		t.Errorf("message without an ID: %v, want it skipped", err)
+	}
+	if n := len(pub.Transactions()); n != 0 {
+		t.Errorf("%d transactions published", n)
+	}
+}
+
+func TestPublishFailureIsRetried(t *testing.T) {
+	pub := fake.New()
+	pub.Err = errKafka
+	auditor := &fakeAuditor{}
+	p := newAuditedProcessor(pub, auditor)
+
+	txn := rawTransaction("txn_1", 25, time.Now())
+	err := p.Handle(context.Background(), message(t, txn))
+	if !errors.Is(err, errKafka) {
+		t.Fatalf("error = %v, want the publish error", err)
+	}
+	if consumer.IsPermanent(err) {
+		t.Error("publish failure is permanent, want the message retried")
+	}
+	if auditor.count() != 0 {
+		t.Error("unpublished decision audited")
+	}
+
+	// The redelivery is decided and published as the first attempt was
+	pub.Err = nil
+	if err := p.Handle(context.Background(), message(t, txn)); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if n := len(pub.Transactions()); n != 1 || auditor.count() != 1 {
+		t.Errorf("%d transactions published and %d audited, want 1 each", n, auditor.count())
+	}
+}
+
+func TestSlowPublishGivesWayToTheContext(t *testing.T) {
+	pub := fake.New()
+	pub.Latency = time.Minute
+	p := newTestProcessor(pub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.ProcessTransaction(ctx, rawTransaction("txn_1", 25, time.Now()))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline exceeded", err)
+	}
+	if n := len(pub.Transactions()); n != 0 {
+		t.Errorf("%d transactions published after the deadline", n)
+	}
+}
+
+func TestCurrencyValidation(t *testing.T) {
+	currencies, err := currency.ParseAllowlist("USD,JPY,BHD")
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	p := NewProcessor(Deps{Publisher: fake.New(), Currencies: currencies})
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		currency string
+		amount   float64
+		code     string
+	}{
+		{"cents", "USD", 42.5, ""},
+		{"whole yen", "JPY", 1500, ""},
+		{"yen with decimals", "JPY", 1500.5, models.ValidationCodePrecision},
+		{"three places for dinars", "BHD", 12.345, ""},
+		{"four places for dinars", "BHD", 12.3456, models.ValidationCodePrecision},
+		{"default currency left out", "EUR", 10, models.ValidationCodeInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := rawTransaction("txn_1", tt.amount, noon)
+			txn.Currency = tt.currency
+			validation := p.validateTransaction(txn)
+			var codes []string
+			for _, e := range validation.Errors {
+				codes = append(codes, e.Code)
+			}
+			if tt.code == "" && len(codes) > 0 {
+				t.Errorf("errors %v, want none", codes)
+			}
+			if tt.code != "" && (validation.IsValid || len(codes) != 1 || codes[0] != tt.code) {
+				t.Errorf("errors %v, want %s", codes, tt.code)
+			}
+		})
+	}
+}
+
+func TestProcessedTransactionsCarryTheCurrencyExponent(t *testing.T) {
+	currencies, err := currency.ParseAllowlist("JPY,BHD")
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	pub := fake.New()
+	p := NewProcessor(Deps{Publisher: pub, Currencies: currencies})
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	yen := rawTransaction("txn_yen", 1500, noon)
+	yen.Currency = "JPY"
+	dinars := rawTransaction("txn_dinars", 12.3456, noon)
+	dinars.Currency = "BHD"
+	for _, txn := range []*models.RawTransaction{yen, dinars} {
+		if err := p.ProcessTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("ProcessTransaction: %v", err)
+		}
+	}
+
+	published := pub.Transactions()
+	if len(published) != 2 {
+		t.Fatalf("%d transactions published, want 2", len(published))
+	}
+	if got := published[0]; got.CurrencyExponent != 0 || got.Status == models.StatusRejected {
+		t.Errorf("yen: exponent %d, status %s, want 0 and not rejected", got.CurrencyExponent, got.Status)
+	}
+	// A rejected transaction still carries its exponent for rendering
+	if got := published[1]; got.CurrencyExponent != 3 || got.Status != models.StatusRejected ||
+		!strings.Contains(got.RejectionReason, "amount:") {
+		t.Errorf("dinars: exponent %d, status %s (%s), want 3 and rejected on the amount",
+			got.CurrencyExponent, got.Status, got.RejectionReason)
+	}
+}
+
+// blocklistEntries is a blocklist source of fixed entries
+type blocklistEntries []*models.BlocklistEntry
+
+func (e blocklistEntries) Blocklist(context.Context) ([]*models.BlocklistEntry, error) {
+	return e, nil
+}
+
+func TestBlockedTransactionsAreRejected(t *testing.T) {
+	blocked := blocklist.New([]string{"KP"}, []string{"Crypto Exchange"}, blocklistEntries{
+		{Type: models.BlocklistTypeAccount, Value: "acct-frozen", Reason: "chargeback ring"},
+	}, nil)
+	if err := blocked.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		modify func(*models.RawTransaction)
+		reason string
+	}{
+		{"allowed", func(*models.RawTransaction) {}, ""},
+		{"country", func(txn *models.RawTransaction) { txn.Metadata = map[string]string{"country": "KP"} }, "country: Blocked country KP"},
+		{"merchant", func(txn *models.RawTransaction) { txn.Merchant = "Crypto Exchange" }, "merchant: Blocked merchant Crypto Exchange"},
+		{"account", func(txn *models.RawTransaction) { txn.AccountID = "acct-frozen" }, "account_id: Blocked account acct-frozen: chargeback ring"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			p := NewProcessor(Deps{Publisher: pub, Blocklist: blocked})
+			// A small purchase, rejected at any risk score when blocked
+			txn := rawTransaction("txn_1", 12, noon)
+			tt.modify(txn)
+			if err := p.ProcessTransaction(context.Background(), txn); err != nil {
+				t.Fatalf("ProcessTransaction: %v", err)
+			}
+			got := pub.Transactions()[0]
+			if tt.reason == "" {
+				if got.Status == models.StatusRejected {
+					t.Errorf("rejected: %s", got.RejectionReason)
+				}
+				return
+			}
+			if got.Status != models.StatusRejected || got.IsValid || got.RejectionReason != tt.reason {
+				t.Errorf("status %s (%s), want rejected for %q", got.Status, got.RejectionReason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEnrichmentReadsTheMetadataKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		country  string
+		ip       string
+		device   string
+	}{
+		{"no metadata", nil, "US", "192.168.1.1", ""},
+		{
+			"known keys",
+			map[string]string{"country": "GB", "ip_address": "2001:db8::1", "device_info": "iPhone 15", "metadata_truncated": "true"},
+			"GB", "2001:db8::1", "iPhone 15",
+		},
+		{"empty values fall back", map[string]string{"country": "", "ip_address": ""}, "US", "192.168.1.1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			txn := rawTransaction("txn_1", 25, time.Date(2026, 3, 4, 14, 0, 0, 0, time.UTC))
+			txn.Metadata = tt.metadata
+			got := process(t, newTestProcessor(pub), pub, txn)
+			if got.Country != tt.country || got.IPAddress != tt.ip || got.DeviceInfo != tt.device {
+				t.Errorf("enriched with %q, %q, %q, want %q, %q, %q",
+					got.Country, got.IPAddress, got.DeviceInfo, tt.country, tt.ip, tt.device)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// fakeRecurrence is a recurrence history matching every transaction with
+// facts, or failing with err, and remembering the recorded transactions
+type fakeRecurrence struct {
+	mu       sync.Mutex
+	facts    models.RecurrenceFacts
+	err      error
+	recorded []string
+}
+
+func (h *fakeRecurrence) Match(context.Context, *models.ProcessedTransaction) (models.RecurrenceFacts, error) {
+	return h.facts, h.err
+}
+
+func (h *fakeRecurrence) Record(_ context.Context, txn *models.ProcessedTransaction) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recorded = append(h.recorded, txn.ID)
+	return nil
+}
+
+func (h *fakeRecurrence) records() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.recorded...)
+}
+
+// newRecurrenceProcessor returns a processor with the default rules and
+// recurrence
+func newRecurrenceProcessor(pub *fake.Publisher, metrics Metrics, recurrence Recurrence) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Rules: DefaultRiskRules(), Metrics: metrics, Recurrence: recurrence})
+}
+
+// evaluate evaluates txn with p
+func evaluate(t *testing.T, p *Processor, txn *models.RawTransaction) *Evaluation {
+	t.Helper()
+	evaluation, err := p.Evaluate(context.Background(), txn)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	return evaluation
+}
+
+// recurringFactor returns the recurring charge factor of evaluation, or nil
+// without one
+func recurringFactor(evaluation *Evaluation) *models.RiskFactor {
+	for i, factor := range evaluation.RiskFactors {
+		if factor.Factor == RecurringFactor {
+			return &evaluation.RiskFactors[i]
+		}
+	}
+	return nil
+}
+
+func TestRecurringChargesAreScoredLower(t *testing.T) {
+	monthly := models.RecurrenceFacts{Recurring: true, Cadence: "monthly", Occurrences: 4}
+	// Late at night and above 10,000, the charge scores 0.5 before noise;
+	// at noon and small, it scores the noise alone
+	lateAndLarge := rawTransaction("txn_1", 12000, time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC))
+	small := rawTransaction("txn_2", 25, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name       string
+		txn        *models.RawTransaction
+		facts      models.RecurrenceFacts
+		adjustment float64
+		floor      float64
+		lowered    func(score float64) float64 // nil when the score is unchanged
+	}{
+		{"lowered by the adjustment", lateAndLarge, monthly, 0.2, 0.1,
+			func(score float64) float64 { return score - 0.2 }},
+		{"no lower than the floor", lateAndLarge, monthly, 0.6, 0.3,
+			func(float64) float64 { return 0.3 }},
+		{"already below the floor", small, monthly, 0.2, 0.3, nil},
+		{"not recurring", lateAndLarge, models.RecurrenceFacts{}, 0.2, 0.1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := evaluate(t, newRecurrenceProcessor(fake.New(), nil, Recurrence{}), tt.txn)
+			score := baseline.Transaction.RiskScore
+
+			history := &fakeRecurrence{facts: tt.facts}
+			recurrence := Recurrence{History: history, Adjustment: tt.adjustment, Floor: tt.floor}
+			got := evaluate(t, newRecurrenceProcessor(fake.New(), nil, recurrence), tt.txn)
+
+			if got.Transaction.IsRecurring != tt.facts.Recurring {
+				t.Errorf("IsRecurring = %v, want %v", got.Transaction.IsRecurring, tt.facts.Recurring)
+			}
+			factor := recurringFactor(got)
+			if tt.lowered == nil {
+				if got.Transaction.RiskScore != score || factor != nil {
+					t.Errorf("score %v with factor %+v, want %v unchanged", got.Transaction.RiskScore, factor, score)
+				}
+				return
+			}
+
+			want := tt.lowered(score)
+			if diff := got.Transaction.RiskScore - want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("score %v, want %v lowered to %v", got.Transaction.RiskScore, score, want)
+			}
+			if factor == nil {
+				t.Fatal("no recurring charge factor")
+			}
+			if diff := score + factor.Weight - got.Transaction.RiskScore; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("factor weight %v, want the reduction %v", factor.Weight, got.Transaction.RiskScore-score)
+			}
+			if want := "Recurring monthly charge, following 4 earlier ones"; factor.Description != want {
+				t.Errorf("description %q, want %q", factor.Description, want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceIsUncheckedWhenTheLookupFails(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	history := &fakeRecurrence{
+		facts: models.RecurrenceFacts{Recurring: true, Cadence: "weekly", Occurrences: 3},
+		err:   errors.New("redis: connection refused"),
+	}
+	p := newRecurrenceProcessor(pub, metrics, Recurrence{History: history, Adjustment: 0.2, Floor: 0.1})
+	txn := rawTransaction("txn_1", 12000, time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC))
+
+	want := evaluate(t, newRecurrenceProcessor(fake.New(), nil, Recurrence{}), txn).Transaction.RiskScore
+	got := process(t, p, pub, txn)
+	if got.IsRecurring || got.RiskScore != want {
+		t.Errorf("recurring %v with score %v, want a charge assessed as not recurring at %v", got.IsRecurring, got.RiskScore, want)
+	}
+	if n := metrics.failedLookups("recurrence"); n != 1 {
+		t.Errorf("%d failed recurrence lookups counted, want 1", n)
+	}
+}
+
+func TestProcessedChargesAreRecorded(t *testing.T) {
+	pub := fake.New()
+	history := &fakeRecurrence{}
+	p := newRecurrenceProcessor(pub, nil, Recurrence{History: history, Adjustment: 0.2, Floor: 0.1})
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	process(t, p, pub, rawTransaction("txn_1", 25, at))
+	// Rejected as invalid, it is no charge to recur
+	process(t, p, pub, rawTransaction("txn_2", 250000, at))
+	// A dry run records nothing
+	evaluate(t, p, rawTransaction("txn_3", 25, at))
+	process(t, p, pub, rawTransaction("txn_4", 25, at.AddDate(0, 1, 0)))
+
+	got := history.records()
+	if len(got) != 2 || got[0] != "txn_1" || got[1] != "txn_4" {
+		t.Errorf("recorded %v, want [txn_1 txn_4]", got)
+	}
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// fakeParents looks parents up in a map, failing with err when it is set
+type fakeParents struct {
+	parents map[string]*models.ParentTransaction
+	err     error
+}
+
+func (f fakeParents) ParentTransaction(_ context.Context, id string) (*models.ParentTransaction, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.parents[id], nil
+}
+
+// refund returns a refund of amount against the transaction parentID
+func refund(id, parentID string, amount float64) *models.RawTransaction {
+	txn := rawTransaction(id, amount, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	txn.Type = models.TypeRefund
+	txn.ParentTransactionID = parentID
+	return txn
+}
+
+// rulesFired evaluates txn with parents, returning the enforced rules that
+// fired
+func rulesFired(t *testing.T, parents ParentLookup, metrics Metrics, txn *models.RawTransaction) string {
+	t.Helper()
+	p := NewProcessor(Deps{Publisher: fake.New(), Metrics: metrics, Parents: parents})
+	evaluation, err := p.Evaluate(context.Background(), txn)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	return strings.Join(evaluation.RulesFired, ",")
+}
+
+func TestRefundRules(t *testing.T) {
+	parents := fakeParents{parents: map[string]*models.ParentTransaction{
+		"txn_purchase": {ID: "txn_purchase", Amount: 100, Status: models.StatusApproved, Refunds: []models.Refund{
+			{ID: "txn_refund_1", Amount: 60, Status: models.StatusApproved},
+			{ID: "txn_refund_rejected", Amount: 500, Status: models.StatusRejected},
+		}},
+		"txn_rejected": {ID: "txn_rejected", Amount: 100, Status: models.StatusRejected},
+	}}
+
+	tests := []struct {
+		name string
+		txn  *models.RawTransaction
+		want string
+	}{
+		{"within the parent amount", refund("txn_refund_2", "txn_purchase", 40), ""},
+		{"over-refund", refund("txn_refund_2", "txn_purchase", 41), "refund_exceeds_parent"},
+		// A redelivered refund is not counted against itself
+		{"redelivered refund", refund("txn_refund_1", "txn_purchase", 60), ""},
+		{"refund of a rejected parent", refund("txn_refund_3", "txn_rejected", 10), "refund_of_rejected"},
+		{"orphan refund", refund("txn_refund_4", "txn_missing", 1000), ""},
+		{"purchase naming no parent", rawTransaction("txn_purchase_2", 1000, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rulesFired(t, parents, nil, tt.txn); got != tt.want {
+				t.Errorf("rules fired = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundsAreAssessedWithoutAFailedLookup(t *testing.T) {
+	metrics := newFakeMetrics()
+	parents := fakeParents{err: errors.New("storage API returned 503 Service Unavailable")}
+
+	if got := rulesFired(t, parents, metrics, refund("txn_refund", "txn_purchase", 1000)); got != "" {
+		t.Errorf("rules fired = %q, want none without the parent", got)
+	}
+	if n := metrics.failedLookups("parent"); n != 1 {
+		t.Errorf("%d failed parent lookups counted, want 1", n)
+	}
+
+	// Without a lookup refunds are assessed like any other transaction
+	if got := rulesFired(t, nil, metrics, refund("txn_refund", "txn_purchase", 1000)); got != "" {
+		t.Errorf("rules fired = %q, want none", got)
+	}
+}
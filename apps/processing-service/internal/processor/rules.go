@@ -0,0 +1,363 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"processing-service/internal/models"
+)
+
+// Risk rule modes
+const (
+	// RuleModeEnforce adds the rule's weight to the risk score
+	RuleModeEnforce = "enforce"
+	// RuleModeShadow records what the rule would have added without
+	// affecting the risk score, approval or status
+	RuleModeShadow = "shadow"
+)
+
+// DeviceStatus tells whether a transaction comes from a device its user has
+// transacted from before
+type DeviceStatus int
+
+// Device statuses
+const (
+	// DeviceUnchecked means the device history could not be consulted
+	DeviceUnchecked DeviceStatus = iota
+	// DeviceMissing means the transaction carries no device info
+	DeviceMissing
+	// DeviceKnown means the user has transacted from the device before
+	DeviceKnown
+	// DeviceNew means the device is new to the user
+	DeviceNew
+)
+
+// AccountState tells whether the storage service knows a transaction's
+// account
+type AccountState int
+
+// Account states
+const (
+	// AccountUnchecked means the account status cache could not be consulted
+	AccountUnchecked AccountState = iota
+	// AccountKnown means the account exists
+	AccountKnown
+	// AccountUnknown means no account with the transaction's account ID
+	// exists
+	AccountUnknown
+)
+
+// Amount thresholds of the rules, in the base currency
+const (
+	// highAmount is the amount over which a transaction scores as
+	// high_amount
+	highAmount = 10000
+	// newDeviceHighAmount is the amount over which a transaction from a new
+	// device scores as new_device_high_amount instead of new_device
+	newDeviceHighAmount = 1000
+)
+
+// Facts is what is known about a transaction beyond its own fields
+type Facts struct {
+	// Parent is the refunded transaction of a refund, or nil for other
+	// transactions and refunds whose parent is unknown
+	Parent  *models.ParentTransaction
+	Device  DeviceStatus
+	Country models.CountryFacts
+	Account AccountState
+	// Recurrence tells whether the transaction is a recurring charge
+	Recurrence models.RecurrenceFacts
+}
+
+// RiskRule is a named check that adds a weighted factor to the risk score of
+// the transactions it matches. Describe, when set, replaces Description with
+// one specific to the transaction.
+type RiskRule struct {
+	Name        string
+	Mode        string
+	Weight      float64
+	Description string
+	Severity    string
+	Match       func(txn *models.ProcessedTransaction, facts Facts) bool
+	Describe    func(txn *models.ProcessedTransaction, facts Facts) string
+}
+
+// factor returns the risk factor the rule adds to txn
+func (r RiskRule) factor(txn *models.ProcessedTransaction, facts Facts) models.RiskFactor {
+	description := r.Description
+	if r.Describe != nil {
+		description = r.Describe(txn, facts)
+	}
+	return models.RiskFactor{
+		Factor:      r.Name,
+		Weight:      r.Weight,
+		Description: description,
+		Severity:    r.Severity,
+	}
+}
+
+// DefaultRiskRules returns the built-in risk rules. New rules start in shadow
+// mode until their hit rate has been reviewed.
+func DefaultRiskRules() []RiskRule {
+	return []RiskRule{
+		{
+			Name:        "high_amount",
+			Mode:        RuleModeEnforce,
+			Weight:      0.3,
+			Description: "Transaction amount exceeds 10,000 in the base currency",
+			Severity:    "medium",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				return thresholdAmount(txn) > highAmount
+			},
+			Describe: func(txn *models.ProcessedTransaction, _ Facts) string {
+				return "Transaction amount exceeds 10,000 " + thresholdCurrency(txn)
+			},
+		},
+		{
+			Name:        "late_night",
+			Mode:        RuleModeEnforce,
+			Weight:      0.2,
+			Description: "Transaction during late night hours",
+			Severity:    "low",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				hour := txn.Timestamp.Hour()
+				return hour >= 22 || hour <= 6
+			},
+		},
+		{
+			Name:        "blocked_country",
+			Mode:        RuleModeEnforce,
+			Weight:      0.5,
+			Description: "Transaction from blocked country",
+			Severity:    "high",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				return txn.Country == "XX" || txn.Country == "YY"
+			},
+		},
+		{
+			Name:        "risky_merchant",
+			Mode:        RuleModeEnforce,
+			Weight:      0.4,
+			Description: "Transaction with risky merchant category",
+			Severity:    "medium",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				merchant := txn.MerchantNormalized
+				return strings.Contains(merchant, "gambling") || strings.Contains(merchant, "crypto")
+			},
+		},
+		{
+			Name:        "round_amount",
+			Mode:        RuleModeShadow,
+			Weight:      0.2,
+			Description: "Large round amount, a common structuring pattern",
+			Severity:    "low",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				return txn.Amount >= 5000 && math.Mod(txn.Amount, 1000) == 0
+			},
+		},
+		{
+			Name:        "refund_exceeds_parent",
+			Mode:        RuleModeEnforce,
+			Weight:      0.6,
+			Description: "Refunds exceed the amount of the refunded transaction",
+			Severity:    "high",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Parent != nil && refunded(txn, facts.Parent) > facts.Parent.Amount
+			},
+		},
+		{
+			Name:        "refund_of_rejected",
+			Mode:        RuleModeEnforce,
+			Weight:      0.6,
+			Description: "Refund of a rejected transaction",
+			Severity:    "high",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Parent != nil && facts.Parent.Status == models.StatusRejected
+			},
+		},
+		{
+			Name:        "new_device",
+			Mode:        RuleModeShadow,
+			Weight:      0.2,
+			Description: "First transaction from this device",
+			Severity:    "medium",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Device == DeviceNew && thresholdAmount(txn) <= newDeviceHighAmount
+			},
+		},
+		{
+			Name:        "new_device_high_amount",
+			Mode:        RuleModeShadow,
+			Weight:      0.4,
+			Description: "First transaction from this device, for over 1,000 in the base currency",
+			Severity:    "high",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Device == DeviceNew && thresholdAmount(txn) > newDeviceHighAmount
+			},
+			Describe: func(txn *models.ProcessedTransaction, _ Facts) string {
+				return "First transaction from this device, for over 1,000 " + thresholdCurrency(txn)
+			},
+		},
+		{
+			Name:        "missing_device",
+			Mode:        RuleModeShadow,
+			Weight:      0.05,
+			Description: "Transaction without device information",
+			Severity:    "low",
+			Match: func(_ *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Device == DeviceMissing
+			},
+		},
+		{
+			Name:        "country_mismatch",
+			Mode:        RuleModeShadow,
+			Weight:      0.2,
+			Description: "Transaction outside the account's home country",
+			Severity:    "medium",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return awayFromHome(txn, facts) && !facts.Country.Switched
+			},
+			Describe: func(txn *models.ProcessedTransaction, facts Facts) string {
+				return fmt.Sprintf("Transaction in %s, outside the account's home country %s", txn.Country, facts.Country.Home)
+			},
+		},
+		{
+			Name:        "country_switch",
+			Mode:        RuleModeShadow,
+			Weight:      0.5,
+			Description: "Transaction outside the account's home country shortly after one in another country",
+			Severity:    "high",
+			Match: func(txn *models.ProcessedTransaction, facts Facts) bool {
+				return awayFromHome(txn, facts) && facts.Country.Switched
+			},
+			Describe: func(txn *models.ProcessedTransaction, facts Facts) string {
+				return fmt.Sprintf("Transaction in %s, outside the account's home country %s, shortly after one in %s",
+					txn.Country, facts.Country.Home, facts.Country.Previous)
+			},
+		},
+		{
+			Name:        "unknown_account",
+			Mode:        RuleModeEnforce,
+			Weight:      0.6,
+			Description: "Transaction on an account unknown to the storage service",
+			Severity:    "high",
+			Match: func(_ *models.ProcessedTransaction, facts Facts) bool {
+				return facts.Account == AccountUnknown
+			},
+		},
+		{
+			Name:        "duplicate_suspect",
+			Mode:        RuleModeShadow,
+			Weight:      0.3,
+			Description: "Transaction repeating the content of one ingested shortly before, under another idempotency key",
+			Severity:    "medium",
+			Match: func(txn *models.ProcessedTransaction, _ Facts) bool {
+				return txn.Metadata["duplicate_suspect"] == "true"
+			},
+			Describe: func(txn *models.ProcessedTransaction, _ Facts) string {
+				if first := txn.Metadata["duplicate_of"]; first != "" {
+					return "Transaction repeating the content of transaction " + first + ", ingested shortly before under another idempotency key"
+				}
+				return "Transaction repeating the content of one ingested shortly before, under another idempotency key"
+			},
+		},
+	}
+}
+
+// thresholdAmount returns the amount of txn compared with the amount
+// thresholds: the amount in the base currency, or the amount in its own
+// currency when no rate converted it
+func thresholdAmount(txn *models.ProcessedTransaction) float64 {
+	if txn.BaseCurrency != "" {
+		return txn.BaseAmount
+	}
+	return txn.Amount
+}
+
+// thresholdCurrency returns the currency of thresholdAmount
+func thresholdCurrency(txn *models.ProcessedTransaction) string {
+	if txn.BaseCurrency != "" {
+		return txn.BaseCurrency
+	}
+	return txn.Currency
+}
+
+// awayFromHome reports whether txn is outside the home country of an account
+// with a long enough history to have one
+func awayFromHome(txn *models.ProcessedTransaction, facts Facts) bool {
+	return facts.Country.Home != "" && txn.Country != facts.Country.Home
+}
+
+// refunded returns the amount refunded against parent including txn.
+// Rejected refunds returned nothing and a redelivered txn is counted once.
+func refunded(txn *models.ProcessedTransaction, parent *models.ParentTransaction) float64 {
+	total := txn.Amount
+	for _, refund := range parent.Refunds {
+		if refund.ID != txn.ID && refund.Status != models.StatusRejected {
+			total += refund.Amount
+		}
+	}
+	return total
+}
+
+// riskRulesFile is the JSON file setting the mode and weight of built-in
+// rules, e.g.
+//
+//	{"rules": [{"name": "round_amount", "mode": "enforce"}, {"name": "new_device", "weight": 0.3}]}
+type riskRulesFile struct {
+	Rules []struct {
+		Name   string   `json:"name"`
+		Mode   string   `json:"mode"`
+		Weight *float64 `json:"weight"`
+	} `json:"rules"`
+}
+
+// LoadRiskRules returns the built-in risk rules with the modes and weights
+// set in a JSON file. Rules the file does not name, and fields it leaves
+// out, keep their defaults. All problems are reported together.
+func LoadRiskRules(path string) ([]RiskRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read risk rules: %w", err)
+	}
+
+	var file riskRulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse risk rules %s: %w", path, err)
+	}
+
+	rules := DefaultRiskRules()
+	index := make(map[string]int, len(rules))
+	for i, rule := range rules {
+		index[rule.Name] = i
+	}
+
+	var errs []error
+	for i, override := range file.Rules {
+		j, ok := index[override.Name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("rule %d: unknown rule %q", i, override.Name))
+		case override.Mode != "" && override.Mode != RuleModeEnforce && override.Mode != RuleModeShadow:
+			errs = append(errs, fmt.Errorf("rule %d: mode %q is not %s or %s", i, override.Mode, RuleModeEnforce, RuleModeShadow))
+		case override.Weight != nil && (*override.Weight < 0 || *override.Weight > 1):
+			errs = append(errs, fmt.Errorf("rule %d: weight %v is not between 0 and 1", i, *override.Weight))
+		default:
+			if override.Mode != "" {
+				rules[j].Mode = override.Mode
+			}
+			if override.Weight != nil {
+				rules[j].Weight = *override.Weight
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return rules, nil
+}
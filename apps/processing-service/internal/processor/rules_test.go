@@ -0,0 +1,392 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// fakeMetrics counts the shadow hits, evaluations and score contributions
+// of each rule, the decisions, the failed lookups of each kind, the
+// transactions of each lane and the stale transactions of each type,
+// ignoring the other metrics
+type fakeMetrics struct {
+	mu            sync.Mutex
+	shadowHits    map[string]int
+	contributions map[string]int
+	weights       map[string]float64
+	evaluations   map[string]int // by rule/outcome
+	decisions     map[string]int // by status/top rule
+	lookupErrors  map[string]int
+	laneCounts    map[string]int
+	staleCounts   map[string]int
+	canaryCounts  map[bool]int
+	disagreements map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{
+		shadowHits:    make(map[string]int),
+		contributions: make(map[string]int),
+		weights:       make(map[string]float64),
+		evaluations:   make(map[string]int),
+		decisions:     make(map[string]int),
+		lookupErrors:  make(map[string]int),
+		laneCounts:    make(map[string]int),
+		staleCounts:   make(map[string]int),
+		canaryCounts:  make(map[bool]int),
+		disagreements: make(map[string]int),
+	}
+}
+
+func (m *fakeMetrics) lookupFailed(lookup string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lookupErrors[lookup]++
+}
+
+// failedLookups returns the number of failed lookups of kind lookup
+func (m *fakeMetrics) failedLookups(lookup string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lookupErrors[lookup]
+}
+
+func (m *fakeMetrics) RecordShadowHit(rule string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shadowHits[rule]++
+}
+
+func (m *fakeMetrics) RecordRuleContribution(rule string, weight float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contributions[rule]++
+	m.weights[rule] += weight
+}
+
+func (m *fakeMetrics) counts(rule string) (shadowHits, contributions int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.shadowHits[rule], m.contributions[rule]
+}
+
+func (m *fakeMetrics) RecordParentLookupError()     { m.lookupFailed("parent") }
+func (m *fakeMetrics) RecordDeviceLookupError()     { m.lookupFailed("device") }
+func (m *fakeMetrics) RecordCountryLookupError()    { m.lookupFailed("country") }
+func (m *fakeMetrics) RecordAccountLookupError()    { m.lookupFailed("account") }
+func (m *fakeMetrics) RecordRateLookupError()       { m.lookupFailed("rate") }
+func (m *fakeMetrics) RecordRecurrenceLookupError() { m.lookupFailed("recurrence") }
+func (m *fakeMetrics) RecordDailyTotalLookupError() { m.lookupFailed("daily_total") }
+
+func (m *fakeMetrics) RecordLane(lane string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.laneCounts[lane]++
+}
+
+// lanes returns the number of transactions assessed in lane
+func (m *fakeMetrics) lanes(lane string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.laneCounts[lane]
+}
+
+func (m *fakeMetrics) RecordStale(txnType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staleCounts[txnType]++
+}
+
+// stale returns the number of stale transactions of txnType
+func (m *fakeMetrics) stale(txnType string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.staleCounts[txnType]
+}
+
+func (m *fakeMetrics) RecordCanaryComparison(agree bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.canaryCounts[agree]++
+}
+
+func (m *fakeMetrics) RecordCanaryRuleDisagreement(rule string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disagreements[rule]++
+}
+
+// canary returns the numbers of canary comparisons agreeing and disagreeing
+func (m *fakeMetrics) canary() (agreed, disagreed int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.canaryCounts[true], m.canaryCounts[false]
+}
+
+// ruleDisagreements returns the number of disagreeing comparisons rule
+// was counted in
+func (m *fakeMetrics) ruleDisagreements(rule string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.disagreements[rule]
+}
+
+func (m *fakeMetrics) RecordRuleEvaluation(rule, outcome string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evaluations[rule+"/"+outcome]++
+}
+
+// ruleEvaluations returns the number of evaluations of rule with outcome
+func (m *fakeMetrics) ruleEvaluations(rule, outcome string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evaluations[rule+"/"+outcome]
+}
+
+// contributed returns the weight rule added to risk scores in total
+func (m *fakeMetrics) contributed(rule string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.weights[rule]
+}
+
+func (m *fakeMetrics) RecordDecision(status, topRule string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decisions[status+"/"+topRule]++
+}
+
+// decided returns the number of decisions of status topRule contributed
+// most to
+func (m *fakeMetrics) decided(status, topRule string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.decisions[status+"/"+topRule]
+}
+
+// withMode returns the default rules with the rule name in mode, or left out
+// when mode is ""
+func withMode(name, mode string) []RiskRule {
+	var rules []RiskRule
+	for _, rule := range DefaultRiskRules() {
+		if rule.Name == name {
+			if mode == "" {
+				continue
+			}
+			rule.Mode = mode
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// decideWith processes txn with rules, returning the published decision
+func decideWith(t *testing.T, rules []RiskRule, metrics Metrics, txn *models.RawTransaction) *models.ProcessedTransaction {
+	t.Helper()
+	pub := fake.New()
+	p := NewProcessor(Deps{Publisher: pub, Rules: rules, Metrics: metrics})
+	live := *txn
+	if err := p.ProcessTransaction(context.Background(), &live); err != nil {
+		t.Fatalf("ProcessTransaction: %v", err)
+	}
+	published := pub.Transactions()
+	if len(published) != 1 {
+		t.Fatalf("%d transactions published, want 1", len(published))
+	}
+	return published[0]
+}
+
+// factorNames returns the names of factors, in order
+func factorNames(factors []models.RiskFactor) string {
+	names := make([]string, len(factors))
+	for i, factor := range factors {
+		names[i] = factor.Factor
+	}
+	return strings.Join(names, ",")
+}
+
+func TestShadowRulesDoNotAffectDecisions(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+	// Every transaction is a large round amount, matching round_amount
+	tests := []struct {
+		name string
+		txn  *models.RawTransaction
+	}{
+		{"approved", rawTransaction("txn_round", 5000, noon)},
+		{"high amount", rawTransaction("txn_high", 20000, noon)},
+		{"high amount at night", rawTransaction("txn_night", 20000, midnight)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shadowed := decideWith(t, withMode("round_amount", RuleModeShadow), nil, tt.txn)
+			without := decideWith(t, withMode("round_amount", ""), nil, tt.txn)
+
+			if shadowed.RiskScore != without.RiskScore || shadowed.RiskLevel != without.RiskLevel ||
+				shadowed.IsApproved != without.IsApproved || shadowed.Status != without.Status ||
+				shadowed.RejectionReason != without.RejectionReason {
+				t.Errorf("with the shadow rule %s at %v (%s), without it %s at %v (%s)",
+					shadowed.Status, shadowed.RiskScore, shadowed.RiskLevel, without.Status, without.RiskScore, without.RiskLevel)
+			}
+			// Only the would-be factor tells them apart
+			if !strings.Contains(factorNames(shadowed.ShadowRiskFactors), "round_amount") {
+				t.Errorf("shadow factors = %s, want round_amount", factorNames(shadowed.ShadowRiskFactors))
+			}
+			if strings.Contains(factorNames(without.ShadowRiskFactors), "round_amount") {
+				t.Errorf("shadow factors without the rule = %s", factorNames(without.ShadowRiskFactors))
+			}
+		})
+	}
+}
+
+func TestEnforcingAShadowRuleScoresIt(t *testing.T) {
+	txn := rawTransaction("txn_round", 20000, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	shadowed := decideWith(t, withMode("round_amount", RuleModeShadow), nil, txn)
+	enforced := decideWith(t, withMode("round_amount", RuleModeEnforce), nil, txn)
+
+	if got, want := enforced.RiskScore, shadowed.RiskScore+0.2; got < want-1e-9 || got > want+1e-9 {
+		t.Errorf("enforced score %v, want the shadowed %v plus the rule's 0.2", got, shadowed.RiskScore)
+	}
+	if strings.Contains(factorNames(enforced.ShadowRiskFactors), "round_amount") {
+		t.Errorf("enforced rule recorded as a shadow factor")
+	}
+}
+
+func TestShadowHitsAreCounted(t *testing.T) {
+	metrics := newFakeMetrics()
+	txn := rawTransaction("txn_round", 5000, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	decideWith(t, withMode("round_amount", RuleModeShadow), metrics, txn)
+
+	if hits, contributions := metrics.counts("round_amount"); hits != 1 || contributions != 0 {
+		t.Errorf("round_amount: %d shadow hits, %d contributions, want 1 and 0", hits, contributions)
+	}
+
+	// A dry run counts nothing
+	p := NewProcessor(Deps{Publisher: fake.New(), Rules: withMode("round_amount", RuleModeShadow), Metrics: metrics})
+	if _, err := p.Evaluate(context.Background(), txn); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if hits, _ := metrics.counts("round_amount"); hits != 1 {
+		t.Errorf("%d shadow hits after a dry run, want 1", hits)
+	}
+}
+
+// modes returns the mode of each rule, by name
+func modes(rules []RiskRule) map[string]string {
+	m := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		m[rule.Name] = rule.Mode
+	}
+	return m
+}
+
+func TestExampleRulesFlipModes(t *testing.T) {
+	rules, err := LoadRiskRules(filepath.Join("..", "..", "risk-rules.example.json"))
+	if err != nil {
+		t.Fatalf("LoadRiskRules: %v", err)
+	}
+	got := modes(rules)
+	if got["round_amount"] != RuleModeEnforce || got["late_night"] != RuleModeShadow {
+		t.Errorf("round_amount %s, late_night %s, want enforce and shadow", got["round_amount"], got["late_night"])
+	}
+	// Rules the file leaves out keep their defaults
+	for name, mode := range modes(DefaultRiskRules()) {
+		if name != "round_amount" && name != "late_night" && got[name] != mode {
+			t.Errorf("%s is %s, want its default %s", name, got[name], mode)
+		}
+	}
+}
+
+func TestLoadRiskRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown rule", `{"rules": [{"name": "velocity", "mode": "enforce"}]}`, `rule 0: unknown rule "velocity"`},
+		{"unknown mode", `{"rules": [{"name": "late_night", "mode": "audit"}]}`, `rule 0: mode "audit" is not enforce or shadow`},
+		{"weight out of range", `{"rules": [{"name": "late_night", "weight": 1.5}]}`, "rule 0: weight 1.5 is not between 0 and 1"},
+		{"malformed", `{"rules": `, "failed to parse risk rules"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			if _, err := LoadRiskRules(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadRiskRules = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported, and a weight alone leaves the mode
+	path := filepath.Join(t.TempDir(), "rules.json")
+	content := `{"rules": [{"name": "velocity"}, {"name": "late_night", "mode": "audit"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := LoadRiskRules(path); err == nil || !strings.Contains(err.Error(), "rule 0") || !strings.Contains(err.Error(), "rule 1") {
+		t.Errorf("LoadRiskRules = %v, want both rules reported", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"rules": [{"name": "new_device", "weight": 0.35}]}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rules, err := LoadRiskRules(path)
+	if err != nil {
+		t.Fatalf("LoadRiskRules: %v", err)
+	}
+	for _, rule := range rules {
+		if rule.Name == "new_device" && (rule.Weight != 0.35 || rule.Mode != RuleModeShadow) {
+			t.Errorf("new_device weighs %v in %s mode, want 0.35 in shadow mode", rule.Weight, rule.Mode)
+		}
+	}
+}
+
+func TestDuplicateSuspectRule(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		metadata    map[string]string
+		description string
+	}{
+		{"not tagged", nil, ""},
+		{"tagged", map[string]string{"duplicate_suspect": "true", "duplicate_of": "txn_first"},
+			"Transaction repeating the content of transaction txn_first, ingested shortly before under another idempotency key"},
+		{"tagged without the first", map[string]string{"duplicate_suspect": "true"},
+			"Transaction repeating the content of one ingested shortly before, under another idempotency key"},
+		{"flag not set", map[string]string{"duplicate_suspect": "false", "duplicate_of": "txn_first"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := rawTransaction("txn_retry", 42.5, noon)
+			txn.Metadata = tt.metadata
+			got := decideWith(t, DefaultRiskRules(), nil, txn)
+
+			var factor *models.RiskFactor
+			for i := range got.ShadowRiskFactors {
+				if got.ShadowRiskFactors[i].Factor == "duplicate_suspect" {
+					factor = &got.ShadowRiskFactors[i]
+				}
+			}
+			switch {
+			case tt.description == "" && factor != nil:
+				t.Errorf("factor %+v, want none", factor)
+			case tt.description != "" && (factor == nil || factor.Description != tt.description || factor.Weight != 0.3):
+				t.Errorf("factor %+v, want 0.3: %q", factor, tt.description)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// Outcomes of the evaluation of a risk rule
+const (
+	RuleHit   = "hit"
+	RuleMiss  = "miss"
+	RuleError = "error"
+)
+
+// NoRule labels the decisions no enforced rule contributed to
+const NoRule = "none"
+
+// The hit rates of GET /admin/rules are over the last hitRateWindow, counted
+// in slots of hitRateSlot
+const (
+	hitRateWindow = time.Hour
+	hitRateSlot   = time.Minute
+	hitRateSlots  = int(hitRateWindow / hitRateSlot)
+)
+
+// ruleCounts counts the evaluations of a rule
+type ruleCounts struct {
+	Evaluations int64 `json:"evaluations"`
+	Hits        int64 `json:"hits"`
+	Errors      int64 `json:"errors"`
+}
+
+// ruleWindow counts the evaluations of a rule over a sliding window, one
+// slot per hitRateSlot
+type ruleWindow struct {
+	mu    sync.Mutex
+	slots [hitRateSlots]struct {
+		index int64 // of the slot since the epoch
+		ruleCounts
+	}
+}
+
+// record counts an evaluation at time at
+func (w *ruleWindow) record(outcome string, at time.Time) {
+	index := at.UnixNano() / int64(hitRateSlot)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := &w.slots[index%int64(hitRateSlots)]
+	if slot.index != index {
+		slot.index, slot.ruleCounts = index, ruleCounts{}
+	}
+	slot.Evaluations++
+	switch outcome {
+	case RuleHit:
+		slot.Hits++
+	case RuleError:
+		slot.Errors++
+	}
+}
+
+// counts returns the counts of the window ending at now
+func (w *ruleWindow) counts(now time.Time) ruleCounts {
+	index := now.UnixNano() / int64(hitRateSlot)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var total ruleCounts
+	for _, slot := range w.slots {
+		if index-slot.index < int64(hitRateSlots) {
+			total.Evaluations += slot.Evaluations
+			total.Hits += slot.Hits
+			total.Errors += slot.Errors
+		}
+	}
+	return total
+}
+
+// newRuleWindows returns an empty window for each rule, by name
+func newRuleWindows(rules []RiskRule) map[string]*ruleWindow {
+	windows := make(map[string]*ruleWindow, len(rules))
+	for _, rule := range rules {
+		windows[rule.Name] = &ruleWindow{}
+	}
+	return windows
+}
+
+// safeMatch evaluates rule on txn, turning a panic of its Match into an
+// error
+func safeMatch(rule RiskRule, txn *models.ProcessedTransaction, facts Facts) (matched bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			matched, err = false, fmt.Errorf("rule %s panicked: %v", rule.Name, r)
+		}
+	}()
+	return rule.Match(txn, facts), nil
+}
+
+// matchRule evaluates rule on txn and, unless dryRun, records the outcome
+// and how long it took. A rule failing to evaluate does not match.
+func (p *Processor) matchRule(rule RiskRule, txn *models.ProcessedTransaction, facts Facts, dryRun bool) bool {
+	start := time.Now()
+	matched, err := safeMatch(rule, txn, facts)
+	if dryRun {
+		return matched
+	}
+
+	outcome := RuleMiss
+	switch {
+	case err != nil:
+		outcome = RuleError
+		slog.Error("risk rule failed", "rule", rule.Name, "transaction_id", txn.ID, "error", err)
+	case matched:
+		outcome = RuleHit
+	}
+	if w := p.ruleWindows[rule.Name]; w != nil {
+		w.record(outcome, start)
+	}
+	if p.metrics != nil {
+		p.metrics.RecordRuleEvaluation(rule.Name, outcome, time.Since(start))
+	}
+	return matched
+}
+
+// topRule returns the name of the enforced rule contributing the highest
+// weight to assessment, or NoRule
+func topRule(assessment *models.RiskAssessment) string {
+	top, weight := NoRule, 0.0
+	for _, factor := range assessment.RiskFactors {
+		if factor.Factor != RecurringFactor && factor.Weight > weight {
+			top, weight = factor.Factor, factor.Weight
+		}
+	}
+	return top
+}
+
+// RuleStats is a risk rule and its hit rate over the sliding window
+type RuleStats struct {
+	Name        string  `json:"name"`
+	Mode        string  `json:"mode"`
+	Weight      float64 `json:"weight"`
+	Severity    string  `json:"severity"`
+	Description string  `json:"description"`
+	ruleCounts
+	// HitRate is Hits over Evaluations, 0 before any evaluation
+	HitRate float64 `json:"hit_rate"`
+}
+
+// rulesResponse is the body of GET /admin/rules
+type rulesResponse struct {
+	RulesVersion  string      `json:"rules_version"`
+	WindowSeconds int         `json:"window_seconds"`
+	Rules         []RuleStats `json:"rules"`
+}
+
+// RuleStats returns the risk rules, in evaluation order, with their hit
+// rates over the last hour
+func (p *Processor) RuleStats() []RuleStats {
+	now := time.Now()
+	stats := make([]RuleStats, 0, len(p.rules))
+	for _, rule := range p.rules {
+		s := RuleStats{
+			Name:        rule.Name,
+			Mode:        rule.Mode,
+			Weight:      rule.Weight,
+			Severity:    rule.Severity,
+			Description: rule.Description,
+		}
+		if w := p.ruleWindows[rule.Name]; w != nil {
+			s.ruleCounts = w.counts(now)
+		}
+		if s.Evaluations > 0 {
+			s.HitRate = float64(s.Hits) / float64(s.Evaluations)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// RulesHandler serves GET /admin/rules, the risk rules with their hit rates
+// over the last hour, authenticated by token as a bearer token; an empty
+// token refuses every request
+func RulesHandler(p *Processor, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rulesResponse{
+			RulesVersion:  p.rulesVersion,
+			WindowSeconds: int(hitRateWindow / time.Second),
+			Rules:         p.RuleStats(),
+		})
+	})
+}
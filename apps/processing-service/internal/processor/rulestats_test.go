@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// brokenRule is an enforced rule whose provider fails on every evaluation
+var brokenRule = RiskRule{
+	Name:        "broken_provider",
+	Mode:        RuleModeEnforce,
+	Weight:      0.5,
+	Description: "Rule of a provider that always fails",
+	Severity:    "high",
+	Match: func(*models.ProcessedTransaction, Facts) bool {
+		panic("provider unavailable")
+	},
+}
+
+// newRulesProcessor returns a processor with rules
+func newRulesProcessor(pub *fake.Publisher, metrics Metrics, rules []RiskRule) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Rules: rules, Metrics: metrics})
+}
+
+func TestRuleMetricsForATransactionTrippingTwoRules(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	p := newRulesProcessor(pub, metrics, append(DefaultRiskRules(), brokenRule))
+
+	// Above 10,000 late at night, it trips high_amount and late_night, and
+	// scores 0.5 before noise. Without a device it also trips the shadow
+	// rule missing_device, which contributes nothing.
+	got := process(t, p, pub, rawTransaction("txn_1", 12345, time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)))
+	if got.Status != models.StatusApproved {
+		t.Fatalf("status %s, want the transaction approved despite the failing rule", got.Status)
+	}
+
+	for _, rule := range DefaultRiskRules() {
+		outcome := RuleMiss
+		if rule.Name == "high_amount" || rule.Name == "late_night" || rule.Name == "missing_device" {
+			outcome = RuleHit
+		}
+		if n := metrics.ruleEvaluations(rule.Name, outcome); n != 1 {
+			t.Errorf("%s: %d evaluations counted as %s, want 1", rule.Name, n, outcome)
+		}
+	}
+	if n := metrics.ruleEvaluations(brokenRule.Name, RuleError); n != 1 {
+		t.Errorf("%d failed evaluations of %s counted, want 1", n, brokenRule.Name)
+	}
+
+	for rule, want := range map[string]float64{"high_amount": 0.3, "late_night": 0.2, "missing_device": 0, brokenRule.Name: 0} {
+		if weight := metrics.contributed(rule); math.Abs(weight-want) > 1e-9 {
+			t.Errorf("%s contributed %v, want %v", rule, weight, want)
+		}
+	}
+	if n := metrics.decided(models.StatusApproved, "high_amount"); n != 1 {
+		t.Errorf("%d approvals led by high_amount counted, want 1", n)
+	}
+
+	// A transaction no rule contributes to is decided by none, and a dry
+	// run counts nothing
+	process(t, p, pub, rawTransaction("txn_2", 25, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)))
+	if _, err := p.Evaluate(context.Background(), rawTransaction("txn_3", 12345, time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC))); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if n := metrics.decided(models.StatusApproved, NoRule); n != 1 {
+		t.Errorf("%d approvals led by no rule counted, want 1", n)
+	}
+	if n := metrics.ruleEvaluations("high_amount", RuleHit); n != 1 {
+		t.Errorf("%d hits of high_amount counted, want the dry run left out", n)
+	}
+	if n := metrics.decided(models.StatusApproved, "high_amount"); n != 1 {
+		t.Errorf("%d approvals led by high_amount counted, want the dry run left out", n)
+	}
+}
+
+func TestTopRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		factors []models.RiskFactor
+		want    string
+	}{
+		{"no factors", nil, NoRule},
+		{"highest weight", []models.RiskFactor{{Factor: "late_night", Weight: 0.2}, {Factor: "high_amount", Weight: 0.3}}, "high_amount"},
+		{"first of equal weights", []models.RiskFactor{{Factor: "late_night", Weight: 0.2}, {Factor: "new_device", Weight: 0.2}}, "late_night"},
+		{"recurring charge lowers, never leads", []models.RiskFactor{{Factor: RecurringFactor, Weight: -0.2}}, NoRule},
+	}
+	for _, tt := range tests {
+		if got := topRule(&models.RiskAssessment{RiskFactors: tt.factors}); got != tt.want {
+			t.Errorf("%s: topRule = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleWindowSlides(t *testing.T) {
+	var w ruleWindow
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	w.record(RuleHit, start)
+	w.record(RuleMiss, start.Add(10*time.Second))
+	w.record(RuleError, start.Add(30*time.Minute))
+	w.record(RuleHit, start.Add(59*time.Minute))
+
+	tests := []struct {
+		at   time.Time
+		want ruleCounts
+	}{
+		{start.Add(59 * time.Minute), ruleCounts{Evaluations: 4, Hits: 2, Errors: 1}},
+		// The first minute has left the window
+		{start.Add(time.Hour), ruleCounts{Evaluations: 2, Hits: 1, Errors: 1}},
+		{start.Add(90 * time.Minute), ruleCounts{Evaluations: 1, Hits: 1}},
+		{start.Add(3 * time.Hour), ruleCounts{}},
+	}
+	for _, tt := range tests {
+		if got := w.counts(tt.at); got != tt.want {
+			t.Errorf("counts at %s = %+v, want %+v", tt.at.Format(time.Kitchen), got, tt.want)
+		}
+	}
+
+	// A slot is reused once its minute is an hour old
+	w.record(RuleMiss, start.Add(time.Hour))
+	if got := w.counts(start.Add(time.Hour)); got != (ruleCounts{Evaluations: 3, Hits: 1, Errors: 1}) {
+		t.Errorf("counts = %+v, want the first minute replaced", got)
+	}
+}
+
+func TestRulesHandler(t *testing.T) {
+	pub := fake.New()
+	p := newRulesProcessor(pub, nil, append(DefaultRiskRules(), brokenRule))
+	at := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+	process(t, p, pub, rawTransaction("txn_1", 12345, at))
+	process(t, p, pub, rawTransaction("txn_2", 25, at))
+	process(t, p, pub, rawTransaction("txn_3", 25, at.Add(-12*time.Hour)))
+	process(t, p, pub, rawTransaction("txn_4", 12345, at.Add(-12*time.Hour)))
+
+	get := func(handler http.Handler, method, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/admin/rules", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	handler := RulesHandler(p, "admin-token")
+	w := get(handler, http.MethodGet, "admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var body rulesResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode rules: %v", err)
+	}
+	if body.RulesVersion != p.rulesVersion || body.WindowSeconds != 3600 || len(body.Rules) != len(DefaultRiskRules())+1 {
+		t.Fatalf("version %s, window %ds, %d rules, want every rule over an hour", body.RulesVersion, body.WindowSeconds, len(body.Rules))
+	}
+
+	want := map[string]struct {
+		hits, errors int64
+		rate         float64
+	}{
+		"high_amount":     {2, 0, 0.5},
+		"late_night":      {2, 0, 0.5},
+		"blocked_country": {0, 0, 0},
+		brokenRule.Name:   {0, 4, 0},
+	}
+	for _, rule := range body.Rules {
+		w, ok := want[rule.Name]
+		if !ok {
+			continue
+		}
+		if rule.Evaluations != 4 || rule.Hits != w.hits || rule.Errors != w.errors || rule.HitRate != w.rate {
+			t.Errorf("%s: %+v, want 4 evaluations, %d hits, %d errors at %v", rule.Name, rule, w.hits, w.errors, w.rate)
+		}
+	}
+	if first := body.Rules[0]; first.Name != "high_amount" || first.Mode != RuleModeEnforce || first.Weight != 0.3 || first.Severity != "medium" {
+		t.Errorf("first rule %+v, want high_amount as registered", first)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		token   string
+		status  int
+	}{
+		{"no token", handler, http.MethodGet, "", http.StatusUnauthorized},
+		{"wrong token", handler, http.MethodGet, "guess", http.StatusUnauthorized},
+		{"no token configured", RulesHandler(p, ""), http.MethodGet, "", http.StatusUnauthorized},
+		{"not a GET", handler, http.MethodPost, "admin-token", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if w := get(tt.handler, tt.method, tt.token); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// StaleReason is the rejection reason of a transaction picked up too long
+// after it was ingested
+const StaleReason = "stale - exceeded processing SLA"
+
+// RuleStaleTransaction is the rule triggering stale transaction alerts
+const RuleStaleTransaction = "stale_transaction"
+
+// StalenessPolicy bounds how long after ingestion a transaction may still be
+// decided. One picked up later, as when the pipeline has backed up, is
+// failed rather than approved after the merchant has given up on it. The
+// max age of a type is taken from MaxAgeByType, or else MaxAge; zero
+// disables the check. Transactions ingested before IngestedAt was recorded
+// are never stale.
+//
+// Each stale transaction raises an operational alert, at most one per type
+// in each AlertInterval (default 5m).
+type StalenessPolicy struct {
+	MaxAge        time.Duration
+	MaxAgeByType  map[string]time.Duration
+	AlertInterval time.Duration
+}
+
+// maxAge returns the max age of a transaction type, zero when unbounded
+func (s StalenessPolicy) maxAge(txnType string) time.Duration {
+	if maxAge, ok := s.MaxAgeByType[txnType]; ok {
+		return maxAge
+	}
+	return s.MaxAge
+}
+
+// check returns how long after ingestion txn is picked up at now, and the
+// max age of its type, reporting whether it exceeded it
+func (s StalenessPolicy) check(txn *models.RawTransaction, now time.Time) (age, maxAge time.Duration, stale bool) {
+	maxAge = s.maxAge(txn.Type)
+	if maxAge <= 0 || txn.IngestedAt.IsZero() {
+		return 0, maxAge, false
+	}
+	age = now.Sub(txn.IngestedAt)
+	return age, maxAge, age > maxAge
+}
+
+// staleAlerts remembers the alert interval each type last raised a stale
+// transaction alert in
+type staleAlerts struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// claim reports whether an alert for txnType may be raised in the interval
+// starting at bucket, recording it when so
+func (a *staleAlerts) claim(txnType string, bucket time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.last == nil {
+		a.last = make(map[string]time.Time)
+	}
+	if last, ok := a.last[txnType]; ok && !bucket.After(last) {
+		return false
+	}
+	a.last[txnType] = bucket
+	return true
+}
+
+// failStale publishes txn, failed for being picked up age after its
+// ingestion, over maxAge, and raises the alert of its type unless one was
+// raised in the current interval
+func (p *Processor) failStale(ctx context.Context, txn *models.ProcessedTransaction, age, maxAge time.Duration) error {
+	slog.WarnContext(ctx, "stale transaction", "type", txn.Type, "age", age, "max_age", maxAge)
+	if p.metrics != nil {
+		p.metrics.RecordStale(txn.Type)
+	}
+	if err := p.publish(ctx, txn, models.DecisionStageStaleness, nil); err != nil {
+		return err
+	}
+
+	interval := p.staleness.AlertInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	bucket := txn.ProcessedAt.Truncate(interval)
+	if !p.staleAlerts.claim(txn.Type, bucket) {
+		return nil
+	}
+	if err := p.publisher.PublishAlert(ctx, staleAlert(txn, age, maxAge, bucket)); err != nil {
+		// The transaction is already failed; the next stale one alerts
+		slog.WarnContext(ctx, "failed to publish stale transaction alert", "error", err)
+	}
+	return nil
+}
+
+// staleAlert builds the alert of a stale transaction. Every instance fails
+// the stale transactions it consumes, so the ID is derived from the type and
+// the alert interval, letting the alert service deduplicate the alerts the
+// instances raise for the same backlog.
+func staleAlert(txn *models.ProcessedTransaction, age, maxAge time.Duration, bucket time.Time) *models.Alert {
+	return &models.Alert{
+		ID:            fmt.Sprintf("stale-transactions-%s-%d", txn.Type, bucket.Unix()),
+		AccountID:     "pipeline:processing",
+		TenantID:      txn.TenantID,
+		AlertType:     models.AlertTypeOperational,
+		Severity:      staleSeverity(age, maxAge),
+		Description:   fmt.Sprintf("%s transactions are picked up %s after ingestion, over their SLA of %s, and are failed as stale", txn.Type, age.Round(time.Second), maxAge),
+		RuleTriggered: RuleStaleTransaction,
+		Status:        "open",
+		CreatedAt:     txn.ProcessedAt,
+		UpdatedAt:     txn.ProcessedAt,
+		Metadata: map[string]string{
+			"transaction_id":   txn.ID,
+			"transaction_type": txn.Type,
+			"lag_seconds":      strconv.FormatFloat(age.Seconds(), 'f', 0, 64),
+			"max_age_seconds":  strconv.FormatFloat(maxAge.Seconds(), 'f', 0, 64),
+			"ingested_at":      txn.IngestedAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// staleSeverity grades a stale transaction by how far over its max age it
+// was picked up
+func staleSeverity(age, maxAge time.Duration) string {
+	switch {
+	case age >= 10*maxAge:
+		return models.SeverityCritical
+	case age >= 3*maxAge:
+		return models.SeverityHigh
+	default:
+		return models.SeverityMedium
+	}
+}
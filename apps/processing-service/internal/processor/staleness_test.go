@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+	"processing-service/internal/publisher/fake"
+)
+
+// testStaleness fails purchases after 15 minutes, transfers after a day and
+// the other types after an hour, never deposits
+var testStaleness = StalenessPolicy{
+	MaxAge: time.Hour,
+	MaxAgeByType: map[string]time.Duration{
+		"purchase": 15 * time.Minute,
+		"transfer": 24 * time.Hour,
+		"deposit":  0,
+	},
+	AlertInterval: time.Minute,
+}
+
+// newStaleProcessor returns a test processor failing transactions by
+// staleness
+func newStaleProcessor(pub *fake.Publisher, metrics Metrics, staleness StalenessPolicy) *Processor {
+	return NewProcessor(Deps{Publisher: pub, Metrics: metrics, Staleness: staleness})
+}
+
+// ingested returns a transaction of txnType ingested age ago
+func ingested(id, txnType string, age time.Duration) *models.RawTransaction {
+	txn := rawTransaction(id, 25, time.Now())
+	txn.Type = txnType
+	txn.Reference = "INV-1"
+	if age > 0 {
+		txn.IngestedAt = time.Now().Add(-age)
+	}
+	return txn
+}
+
+func TestStaleTransactionsAreFailed(t *testing.T) {
+	tests := []struct {
+		name  string
+		txn   *models.RawTransaction
+		stale bool
+	}{
+		{"purchase within its SLA", ingested("txn_1", "purchase", 10*time.Minute), false},
+		{"purchase past its SLA", ingested("txn_2", "purchase", 20*time.Minute), true},
+		{"transfer tolerating hours", ingested("txn_3", "transfer", 2*time.Hour), false},
+		{"transfer past a day", ingested("txn_4", "transfer", 25*time.Hour), true},
+		{"type without its own max age", ingested("txn_5", "withdrawal", 2*time.Hour), true},
+		{"type never stale", ingested("txn_6", "deposit", 72*time.Hour), false},
+		{"ingested before ingestion times", ingested("txn_7", "purchase", 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := fake.New()
+			metrics := newFakeMetrics()
+			got := process(t, newStaleProcessor(pub, metrics, testStaleness), pub, tt.txn)
+
+			if stale := got.RejectionReason == StaleReason; stale != tt.stale {
+				t.Fatalf("published %s %q, want stale %v", got.Status, got.RejectionReason, tt.stale)
+			}
+			if !tt.stale {
+				if got.Status == models.StatusFailed {
+					t.Errorf("fresh transaction failed")
+				}
+				if len(pub.Alerts()) != 0 || metrics.stale(tt.txn.Type) != 0 {
+					t.Errorf("fresh transaction alerted or counted stale")
+				}
+				return
+			}
+			if got.Status != models.StatusFailed {
+				t.Errorf("stale transaction published %s, want failed", got.Status)
+			}
+			if got.RiskScore != 0 || got.RiskLevel != "" {
+				t.Errorf("stale transaction assessed at %v", got.RiskScore)
+			}
+			if n := metrics.stale(tt.txn.Type); n != 1 {
+				t.Errorf("%d stale %s transactions counted, want 1", n, tt.txn.Type)
+			}
+			if len(pub.Alerts()) != 1 {
+				t.Errorf("%d alerts raised, want 1", len(pub.Alerts()))
+			}
+		})
+	}
+}
+
+func TestStaleTransactionAlert(t *testing.T) {
+	pub := fake.New()
+	txn := ingested("txn_1", "purchase", 100*time.Minute)
+	process(t, newStaleProcessor(pub, nil, testStaleness), pub, txn)
+
+	alerts := pub.Alerts()
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts raised, want 1", len(alerts))
+	}
+	alert := alerts[0]
+	if alert.AlertType != models.AlertTypeOperational || alert.RuleTriggered != RuleStaleTransaction {
+		t.Errorf("alert %s raised by %s, want an operational stale transaction alert", alert.AlertType, alert.RuleTriggered)
+	}
+	// 100 minutes is over three times the 15 minutes of purchases
+	if alert.Severity != models.SeverityHigh {
+		t.Errorf("severity %s, want high", alert.Severity)
+	}
+	if !strings.HasPrefix(alert.ID, "stale-transactions-purchase-") {
+		t.Errorf("alert ID %s, want it derived from the type", alert.ID)
+	}
+	lag := alert.Metadata["lag_seconds"]
+	if lag != "6000" && lag != "6001" {
+		t.Errorf("lag_seconds = %s, want 6000", lag)
+	}
+	if alert.Metadata["max_age_seconds"] != "900" || alert.Metadata["transaction_id"] != "txn_1" || alert.Metadata["transaction_type"] != "purchase" {
+		t.Errorf("metadata = %v", alert.Metadata)
+	}
+	if alert.Metadata["ingested_at"] != txn.IngestedAt.UTC().Format(time.RFC3339) {
+		t.Errorf("ingested_at = %s, want %s", alert.Metadata["ingested_at"], txn.IngestedAt.UTC().Format(time.RFC3339))
+	}
+}
+
+func TestStaleAlertsAreRaisedOncePerTypeAndInterval(t *testing.T) {
+	pub := fake.New()
+	metrics := newFakeMetrics()
+	p := newStaleProcessor(pub, metrics, StalenessPolicy{MaxAge: time.Minute, AlertInterval: time.Hour})
+
+	// A backlog of stale purchases and withdrawals
+	for i, txnType := range []string{"purchase", "purchase", "withdrawal", "purchase", "withdrawal"} {
+		process(t, p, pub, ingested(fmt.Sprintf("txn_%d", i), txnType, 2*time.Hour))
+	}
+
+	if metrics.stale("purchase") != 3 || metrics.stale("withdrawal") != 2 {
+		t.Errorf("stale counts purchase %d, withdrawal %d, want 3 and 2", metrics.stale("purchase"), metrics.stale("withdrawal"))
+	}
+	alerts := pub.Alerts()
+	if len(alerts) != 2 {
+		t.Fatalf("%d alerts raised, want one per type", len(alerts))
+	}
+	if !strings.Contains(alerts[0].ID, "purchase") || !strings.Contains(alerts[1].ID, "withdrawal") {
+		t.Errorf("alerts %s and %s, want purchase then withdrawal", alerts[0].ID, alerts[1].ID)
+	}
+	if n := len(pub.Transactions()); n != 5 {
+		t.Errorf("%d transactions published, want every stale one", n)
+	}
+}
+
+func TestStaleSeverity(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{16 * time.Minute, models.SeverityMedium},
+		{45 * time.Minute, models.SeverityHigh},
+		{150 * time.Minute, models.SeverityCritical},
+	}
+	for _, tt := range tests {
+		if got := staleSeverity(tt.age, 15*time.Minute); got != tt.want {
+			t.Errorf("staleSeverity(%s) = %s, want %s", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestStalenessDisabled(t *testing.T) {
+	pub := fake.New()
+	got := process(t, newStaleProcessor(pub, nil, StalenessPolicy{}), pub, ingested("txn_1", "purchase", 48*time.Hour))
+	if got.Status == models.StatusFailed || len(pub.Alerts()) != 0 {
+		t.Errorf("published %s with %d alerts, want the transaction decided", got.Status, len(pub.Alerts()))
+	}
+}
+
+func TestStaleTransactionPublishFailureIsRetried(t *testing.T) {
+	pub := fake.New()
+	pub.Err = errKafka
+	p := newStaleProcessor(pub, nil, testStaleness)
+	if err := p.ProcessTransaction(context.Background(), ingested("txn_1", "purchase", time.Hour)); err == nil {
+		t.Error("ProcessTransaction succeeded without publishing")
+	}
+}
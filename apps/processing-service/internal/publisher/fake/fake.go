@@ -0,0 +1,87 @@
+// Package fake provides an in-memory publisher for the processor, so it can
+// be exercised without a Kafka broker.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// Publisher records what it publishes. Err, when set, is returned by every
+// publish instead of recording; Latency delays every publish, which returns
+// early with the context's error when it is cancelled first.
+type Publisher struct {
+	Err     error
+	Latency time.Duration
+
+	mu           sync.Mutex
+	transactions []*models.ProcessedTransaction
+	alerts       []*models.Alert
+}
+
+// New creates an empty publisher
+func New() *Publisher {
+	return &Publisher{}
+}
+
+// PublishProcessedTransaction records a processed transaction
+func (p *Publisher) PublishProcessedTransaction(ctx context.Context, transaction *models.ProcessedTransaction) error {
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.transactions = append(p.transactions, transaction)
+	return nil
+}
+
+// PublishAlert records an alert
+func (p *Publisher) PublishAlert(ctx context.Context, alert *models.Alert) error {
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.alerts = append(p.alerts, alert)
+	return nil
+}
+
+// Transactions returns the processed transactions published so far, in
+// order
+func (p *Publisher) Transactions() []*models.ProcessedTransaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*models.ProcessedTransaction(nil), p.transactions...)
+}
+
+// Alerts returns the alerts published so far, in order
+func (p *Publisher) Alerts() []*models.Alert {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*models.Alert(nil), p.alerts...)
+}
+
+func (p *Publisher) wait(ctx context.Context) error {
+	if p.Latency <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(p.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -3,44 +3,102 @@ package publisher
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"processing-service/internal/models"
 
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/tenant"
 	"github.com/segmentio/kafka-go"
 )
 
+// schemaVersionHeader tells consumers how to decode a message. Processed
+// transactions are version 0; version 1 is reserved for alerts.
+const (
+	schemaVersionHeader      = "schema_version"
+	schemaVersionTransaction = "0"
+	schemaVersionAlert       = "1"
+)
+
 // Publisher handles publishing processed transactions to Kafka
 type Publisher struct {
 	writer *kafka.Writer
 	topic  string
+	chaos  *chaos.Injector
+	queued atomic.Int64 // messages written and not yet acknowledged
 }
 
-// NewPublisher creates a new Kafka publisher
-func NewPublisher(brokers, topic string) *Publisher {
-	writer := kafka.NewWriter(kafka.WriterConfig{
+// NewPublisher creates a new Kafka publisher. The dialer carries the TLS and
+// SASL settings, and tuning the compression, batching and acknowledgements.
+// Writes are subject to the writer faults of chaosInjector, which may be
+// nil. With sync set, a write returns once every in-sync replica has
+// acknowledged it, instead of as soon as it is enqueued.
+func NewPublisher(brokers, topic string, dialer *kafka.Dialer, tuning kafkaconn.WriterConfig, chaosInjector *chaos.Injector, sync bool) *Publisher {
+	writerConfig := kafka.WriterConfig{
 		Brokers:      []string{brokers},
 		Topic:        topic,
+		Dialer:       dialer,
 		Balancer:     &kafka.Hash{}, // Use hash balancer for partitioning
 		Async:        true,          // Enable async publishing for better performance
 		RequiredAcks: 1,             // Require acknowledgment for reliability
-	})
+	}
+	if sync {
+		writerConfig.Async = false
+		writerConfig.RequiredAcks = int(kafka.RequireAll)
+		// Concurrent writes still share batches, without each waiting the
+		// default second for its batch to fill
+		writerConfig.BatchTimeout = 10 * time.Millisecond
+	}
+	tuning.Apply(&writerConfig)
+	writer := kafka.NewWriter(writerConfig)
+	slog.Info("kafka publisher", "topic", topic, "settings", kafkaconn.DescribeWriter(writer))
 
-	return &Publisher{
+	p := &Publisher{
 		writer: writer,
 		topic:  topic,
+		chaos:  chaosInjector,
+	}
+	if writer.Async {
+		writer.Completion = func(messages []kafka.Message, err error) {
+			p.queued.Add(-int64(len(messages)))
+		}
+	}
+	return p
+}
+
+// Queued returns the number of messages written and not yet acknowledged.
+// The writer reports no queue of its own, so this is its depth.
+func (p *Publisher) Queued() int64 {
+	return p.queued.Load()
+}
+
+// write writes messages, counting them as queued until they are
+// acknowledged: on return when writing synchronously, on completion when
+// asynchronously. A failed write queued nothing.
+func (p *Publisher) write(ctx context.Context, messages ...kafka.Message) error {
+	p.queued.Add(int64(len(messages)))
+	err := p.writer.WriteMessages(ctx, messages...)
+	if err != nil || !p.writer.Async {
+		p.queued.Add(-int64(len(messages)))
 	}
+	return err
 }
 
-// PublishProcessedTransaction publishes a processed transaction to Kafka
+// PublishProcessedTransaction publishes a processed transaction to Kafka,
+// naming the raw transaction it was consumed from in the source headers
 func (p *Publisher) PublishProcessedTransaction(ctx context.Context, transaction *models.ProcessedTransaction) error {
 	start := time.Now()
 
 	// Serialize the transaction
 	message, err := json.Marshal(transaction)
 	if err != nil {
-		log.Printf("Failed to serialize processed transaction: %v", err)
+		slog.ErrorContext(ctx, "failed to serialize processed transaction", "error", err)
 		return err
 	}
 
@@ -50,24 +108,33 @@ func (p *Publisher) PublishProcessedTransaction(ctx context.Context, transaction
 		Key:   []byte(transaction.AccountID), // Partition by account ID
 		Value: message,
 		Headers: []kafka.Header{
+			{Key: schemaVersionHeader, Value: []byte(schemaVersionTransaction)},
 			{Key: "idempotency_key", Value: []byte(transaction.IdempotencyKey)},
 			{Key: "user_id", Value: []byte(transaction.UserID)},
 			{Key: "risk_level", Value: []byte(transaction.RiskLevel)},
 			{Key: "status", Value: []byte(transaction.Status)},
 			{Key: "processed_at", Value: []byte(transaction.ProcessedAt.Format(time.RFC3339))},
+			{Key: tenant.Header, Value: []byte(transaction.TenantID)},
 		},
 	}
+	if id := logging.CorrelationID(ctx); id != "" {
+		kafkaMessage.Headers = append(kafkaMessage.Headers, kafka.Header{Key: logging.CorrelationHeader, Value: []byte(id)})
+	}
+	if source, ok := consumer.SourceFromContext(ctx); ok {
+		kafkaMessage.Headers = append(kafkaMessage.Headers, source.Headers()...)
+	}
 
 	// Publish message
-	err = p.writer.WriteMessages(ctx, kafkaMessage)
+	err = p.chaos.Inject(ctx, chaos.TargetKafkaWriter)
+	if err == nil {
+		err = p.write(ctx, kafkaMessage)
+	}
 
 	// Log the result
 	if err != nil {
-		log.Printf("Failed to publish processed transaction %s to topic %s: %v",
-			transaction.ID, p.topic, err)
+		slog.ErrorContext(ctx, "failed to publish processed transaction", "topic", p.topic, "error", err)
 	} else {
-		log.Printf("Published processed transaction %s to topic %s in %v",
-			transaction.ID, p.topic, time.Since(start))
+		slog.DebugContext(ctx, "published processed transaction", "topic", p.topic, "duration", time.Since(start))
 	}
 
 	return err
@@ -85,7 +152,7 @@ func (p *Publisher) PublishBatch(ctx context.Context, transactions []*models.Pro
 	for i, txn := range transactions {
 		message, err := json.Marshal(txn)
 		if err != nil {
-			log.Printf("Failed to serialize transaction %d: %v", i, err)
+			slog.ErrorContext(ctx, "failed to serialize transaction", "index", i, "error", err)
 			continue
 		}
 
@@ -94,27 +161,52 @@ func (p *Publisher) PublishBatch(ctx context.Context, transactions []*models.Pro
 			Key:   []byte(txn.AccountID),
 			Value: message,
 			Headers: []kafka.Header{
+				{Key: schemaVersionHeader, Value: []byte(schemaVersionTransaction)},
 				{Key: "idempotency_key", Value: []byte(txn.IdempotencyKey)},
 				{Key: "user_id", Value: []byte(txn.UserID)},
 				{Key: "risk_level", Value: []byte(txn.RiskLevel)},
 				{Key: "status", Value: []byte(txn.Status)},
 				{Key: "processed_at", Value: []byte(txn.ProcessedAt.Format(time.RFC3339))},
+				{Key: tenant.Header, Value: []byte(txn.TenantID)},
 			},
 		}
 	}
 
 	// Publish batch
-	err := p.writer.WriteMessages(ctx, messages...)
+	err := p.write(ctx, messages...)
 
 	// Log the result
 	if err != nil {
-		log.Printf("Failed to publish batch of %d transactions to topic %s: %v",
-			len(transactions), p.topic, err)
+		slog.ErrorContext(ctx, "failed to publish batch", "size", len(transactions), "topic", p.topic, "error", err)
 	} else {
-		log.Printf("Published batch of %d transactions to topic %s in %v",
-			len(transactions), p.topic, time.Since(start))
+		slog.DebugContext(ctx, "published batch", "size", len(transactions), "topic", p.topic, "duration", time.Since(start))
+	}
+
+	return err
+}
+
+// PublishAlert publishes an alert built by the service itself, such as a
+// consumer lag alert, for the alert service to dispatch as is. Like the
+// transactions it is written asynchronously, so only a failure to enqueue it
+// is returned.
+func (p *Publisher) PublishAlert(ctx context.Context, alert *models.Alert) error {
+	message, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %w", err)
 	}
 
+	err = p.write(ctx, kafka.Message{
+		Topic: p.topic,
+		Key:   []byte(alert.AccountID),
+		Value: message,
+		Headers: []kafka.Header{
+			{Key: schemaVersionHeader, Value: []byte(schemaVersionAlert)},
+			{Key: tenant.Header, Value: []byte(alert.TenantID)},
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to publish alert", "topic", p.topic, "alert_id", alert.ID, "error", err)
+	}
 	return err
 }
 
@@ -0,0 +1,42 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+)
+
+func TestWriterFaults(t *testing.T) {
+	injector := chaos.New(true, nil)
+	// Nothing listens on the broker address, so only an injected fault can
+	// fail the write before it is attempted
+	p := NewPublisher("127.0.0.1:1", "transactions.processed", nil, kafkaconn.WriterConfig{}, injector, false)
+	defer p.Close()
+	transaction := &models.ProcessedTransaction{Transaction: models.RawTransaction{AccountID: "acct-1"}}
+
+	if err := injector.Set(chaos.TargetKafkaWriter, chaos.ModeError, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := p.PublishProcessedTransaction(context.Background(), transaction); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("PublishProcessedTransaction = %v, want %v", err, chaos.ErrInjected)
+	}
+	if n := p.Queued(); n != 0 {
+		t.Errorf("%d messages queued by a failed write", n)
+	}
+
+	// A latency fault holds the write until the caller gives up
+	if err := injector.Set(chaos.TargetKafkaWriter, chaos.ModeLatency, 1, time.Minute, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.PublishProcessedTransaction(ctx, transaction); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PublishProcessedTransaction = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
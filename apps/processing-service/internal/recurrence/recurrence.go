@@ -0,0 +1,148 @@
+// Package recurrence recognizes recurring charges, such as subscriptions:
+// charges of an account at a merchant for about the same amount, a week or
+// a month apart. They would otherwise keep being scored as risky for their
+// regularity.
+package recurrence
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cadences a recurring charge may have
+const (
+	CadenceWeekly  = "weekly"
+	CadenceMonthly = "monthly"
+)
+
+// cadences are the periods of the cadences, shortest first
+var cadences = []struct {
+	name   string
+	period time.Duration
+}{
+	{CadenceWeekly, 7 * 24 * time.Hour},
+	{CadenceMonthly, 30 * 24 * time.Hour},
+}
+
+// kept is how many occurrences of a charge are kept
+const kept = 12
+
+// History is the time of the last charges of each account at each merchant,
+// in each currency and amount bucket, kept in Redis. Each history expires
+// ttl after its last charge.
+type History struct {
+	client           *redis.Client
+	ttl              time.Duration
+	minOccurrences   int
+	cadenceTolerance float64
+	amountTolerance  float64
+}
+
+// NewHistory creates a recurrence history in client. A charge is recurring
+// once minOccurrences charges preceded it, each interval between them and
+// up to it a cadence's period within cadenceTolerance of it, as a
+// fraction. Amounts within about amountTolerance of each other, as a
+// fraction, share a bucket.
+func NewHistory(client *redis.Client, ttl time.Duration, minOccurrences int, cadenceTolerance, amountTolerance float64) *History {
+	return &History{
+		client:           client,
+		ttl:              ttl,
+		minOccurrences:   minOccurrences,
+		cadenceTolerance: cadenceTolerance,
+		amountTolerance:  amountTolerance,
+	}
+}
+
+// key returns the Redis key of the charges like txn: of its account at its
+// merchant, in its currency and amount bucket. Buckets are logarithmic, so
+// their width is a fraction of the amount. The merchant is hashed to keep
+// the key short.
+func (h *History) key(txn *models.ProcessedTransaction) string {
+	merchant := sha256.Sum256([]byte(txn.MerchantNormalized))
+	bucket := int64(math.Floor(math.Log(txn.Amount) / math.Log1p(h.amountTolerance)))
+	return "recurrence:" + txn.AccountID + ":" + hex.EncodeToString(merchant[:8]) + ":" +
+		txn.Currency + ":" + strconv.FormatInt(bucket, 10)
+}
+
+// Match reports whether txn continues an established pattern of charges
+// like it. It needs minOccurrences earlier charges: a cold start is never
+// recurring. A redelivered txn is not counted as its own predecessor.
+func (h *History) Match(ctx context.Context, txn *models.ProcessedTransaction) (models.RecurrenceFacts, error) {
+	if txn.MerchantNormalized == "" || txn.Amount <= 0 {
+		return models.RecurrenceFacts{}, nil
+	}
+
+	prior, err := h.client.ZRangeArgsWithScores(ctx, redis.ZRangeArgs{
+		Key:     h.key(txn),
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(txn.Timestamp.Unix(), 10),
+		ByScore: true,
+		Rev:     true,
+		Count:   int64(h.minOccurrences) + 1,
+	}).Result()
+	if err != nil {
+		return models.RecurrenceFacts{}, fmt.Errorf("failed to look up recurrence history: %w", err)
+	}
+
+	// The most recent earlier charges, newest first
+	var times []time.Time
+	for _, z := range prior {
+		if z.Member == txn.ID {
+			continue
+		}
+		times = append(times, time.Unix(int64(z.Score), 0))
+	}
+	if len(times) < h.minOccurrences {
+		return models.RecurrenceFacts{Occurrences: len(times)}, nil
+	}
+	times = times[:h.minOccurrences]
+
+	for _, cadence := range cadences {
+		if h.follows(txn.Timestamp, times, cadence.period) {
+			return models.RecurrenceFacts{Recurring: true, Cadence: cadence.name, Occurrences: len(times)}, nil
+		}
+	}
+	return models.RecurrenceFacts{Occurrences: len(times)}, nil
+}
+
+// follows reports whether every interval between at and times, newest
+// first, is period within the cadence tolerance
+func (h *History) follows(at time.Time, times []time.Time, period time.Duration) bool {
+	slack := time.Duration(float64(period) * h.cadenceTolerance)
+	for _, t := range times {
+		interval := at.Sub(t)
+		if interval < period-slack || interval > period+slack {
+			return false
+		}
+		at = t
+	}
+	return true
+}
+
+// Record adds txn to the history of charges like it
+func (h *History) Record(ctx context.Context, txn *models.ProcessedTransaction) error {
+	if txn.MerchantNormalized == "" || txn.Amount <= 0 {
+		return nil
+	}
+
+	key := h.key(txn)
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(txn.Timestamp.Unix()), Member: txn.ID})
+		pipe.ZRemRangeByRank(ctx, key, 0, -kept-1)
+		pipe.Expire(ctx, key, h.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record recurrence: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package recurrence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"processing-service/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestHistory returns a recurrence history in a Redis stand-in, needing
+// three earlier charges within 10% of the cadence and 5% of the amount
+func newTestHistory(t *testing.T) (*History, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewHistory(client, 100*24*time.Hour, 3, 0.1, 0.05), mr
+}
+
+// start is the time of the first charge of the histories
+var start = time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+// charge returns a charge of acct-1 at the merchant of amount, at
+func charge(id string, amount float64, at time.Time) *models.ProcessedTransaction {
+	txn := &models.ProcessedTransaction{}
+	txn.ID, txn.AccountID, txn.Currency, txn.Amount, txn.Timestamp = id, "acct-1", "USD", amount, at
+	txn.MerchantNormalized = "streamflix"
+	return txn
+}
+
+// record records charges of amount every interval from start, n of them
+func record(t *testing.T, h *History, n int, amount float64, interval time.Duration) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		txn := charge(fmt.Sprintf("txn_%d", i), amount, start.Add(time.Duration(i)*interval))
+		if err := h.Record(context.Background(), txn); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+const (
+	day   = 24 * time.Hour
+	week  = 7 * day
+	month = 30 * day
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		prior    int
+		interval time.Duration
+		next     *models.ProcessedTransaction
+		want     models.RecurrenceFacts
+	}{
+		{
+			name: "monthly", prior: 3, interval: month,
+			next: charge("txn_next", 15.99, start.Add(3*month)),
+			want: models.RecurrenceFacts{Recurring: true, Cadence: CadenceMonthly, Occurrences: 3},
+		},
+		{
+			name: "weekly", prior: 4, interval: week,
+			next: charge("txn_next", 15.99, start.Add(4*week)),
+			want: models.RecurrenceFacts{Recurring: true, Cadence: CadenceWeekly, Occurrences: 3},
+		},
+		{
+			name: "calendar month within the tolerance", prior: 3, interval: month,
+			next: charge("txn_next", 15.99, start.Add(3*month+2*day)),
+			want: models.RecurrenceFacts{Recurring: true, Cadence: CadenceMonthly, Occurrences: 3},
+		},
+		{
+			name: "amount within the tolerance", prior: 3, interval: month,
+			next: charge("txn_next", 16.01, start.Add(3*month)),
+			want: models.RecurrenceFacts{Recurring: true, Cadence: CadenceMonthly, Occurrences: 3},
+		},
+		{
+			name: "near-miss amount", prior: 3, interval: month,
+			next: charge("txn_next", 17.99, start.Add(3*month)),
+			want: models.RecurrenceFacts{Occurrences: 0},
+		},
+		{
+			name: "off cadence", prior: 3, interval: month,
+			next: charge("txn_next", 15.99, start.Add(2*month+15*day)),
+			want: models.RecurrenceFacts{Occurrences: 3},
+		},
+		{
+			name: "irregular history", prior: 3, interval: 12 * day,
+			next: charge("txn_next", 15.99, start.Add(36*day)),
+			want: models.RecurrenceFacts{Occurrences: 3},
+		},
+		{
+			name: "cold start", prior: 0, interval: month,
+			next: charge("txn_next", 15.99, start),
+			want: models.RecurrenceFacts{},
+		},
+		{
+			name: "too few earlier charges", prior: 2, interval: month,
+			next: charge("txn_next", 15.99, start.Add(2*month)),
+			want: models.RecurrenceFacts{Occurrences: 2},
+		},
+		{
+			name: "another merchant", prior: 3, interval: month,
+			next: func() *models.ProcessedTransaction {
+				txn := charge("txn_next", 15.99, start.Add(3*month))
+				txn.MerchantNormalized = "tunesbox"
+				return txn
+			}(),
+			want: models.RecurrenceFacts{},
+		},
+		{
+			name: "another currency", prior: 3, interval: month,
+			next: func() *models.ProcessedTransaction {
+				txn := charge("txn_next", 15.99, start.Add(3*month))
+				txn.Currency = "EUR"
+				return txn
+			}(),
+			want: models.RecurrenceFacts{},
+		},
+		{
+			name: "no merchant", prior: 3, interval: month,
+			next: func() *models.ProcessedTransaction {
+				txn := charge("txn_next", 15.99, start.Add(3*month))
+				txn.MerchantNormalized = ""
+				return txn
+			}(),
+			want: models.RecurrenceFacts{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHistory(t)
+			record(t, h, tt.prior, 15.99, tt.interval)
+			got, err := h.Match(context.Background(), tt.next)
+			if err != nil {
+				t.Fatalf("Match: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternIsEstablishedAfterTheMinimumOccurrences(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHistory(t)
+
+	// Each charge is matched then recorded, as the processor does
+	for i := 0; i < 6; i++ {
+		txn := charge(fmt.Sprintf("txn_%d", i), 15.99, start.Add(time.Duration(i)*month))
+		got, err := h.Match(ctx, txn)
+		if err != nil {
+			t.Fatalf("Match: %v", err)
+		}
+		if got.Recurring != (i >= 3) {
+			t.Errorf("charge %d recurring %v, want it recurring from the fourth", i+1, got.Recurring)
+		}
+		if err := h.Record(ctx, txn); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func TestRedeliveryIsNotItsOwnPredecessor(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHistory(t)
+	record(t, h, 3, 15.99, month)
+
+	// The third charge redelivered follows only two others
+	redelivered := charge("txn_2", 15.99, start.Add(2*month))
+	got, err := h.Match(ctx, redelivered)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if got.Recurring || got.Occurrences != 2 {
+		t.Errorf("Match = %+v, want two earlier charges and no pattern", got)
+	}
+}
+
+func TestHistoryIsBoundedAndExpires(t *testing.T) {
+	h, mr := newTestHistory(t)
+	record(t, h, 20, 15.99, week)
+
+	key := h.key(charge("", 15.99, start))
+	members, err := mr.ZMembers(key)
+	if err != nil {
+		t.Fatalf("ZMembers: %v", err)
+	}
+	if len(members) != kept || members[0] != "txn_8" {
+		t.Errorf("kept %d charges from %s, want the last %d", len(members), members[0], kept)
+	}
+	if ttl := mr.TTL(key); ttl != 100*day {
+		t.Errorf("TTL %s, want 100 days", ttl)
+	}
+}
+
+func TestHistoryFailsWhenRedisIsDown(t *testing.T) {
+	h, mr := newTestHistory(t)
+	mr.Close()
+
+	txn := charge("txn_1", 15.99, start)
+	if _, err := h.Match(context.Background(), txn); err == nil {
+		t.Error("Match succeeded with Redis down")
+	}
+	if err := h.Record(context.Background(), txn); err == nil {
+		t.Error("Record succeeded with Redis down")
+	}
+}
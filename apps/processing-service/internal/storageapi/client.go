@@ -0,0 +1,90 @@
+// Package storageapi reads stored transactions and the blocklist from the
+// storage service API
+package storageapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"processing-service/internal/models"
+)
+
+// Client calls the storage service API with a bearer token. The token needs
+// the admin role to read transactions of every tenant.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for the storage API at baseURL
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// ParentTransaction returns the stored transaction with its refunds, or nil
+// when there is no transaction with that ID
+func (c *Client) ParentTransaction(ctx context.Context, id string) (*models.ParentTransaction, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/api/v1/transactions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get transaction %s: storage API returned %s", id, resp.Status)
+	}
+
+	var parent models.ParentTransaction
+	if err := json.NewDecoder(resp.Body).Decode(&parent); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction %s: %w", id, err)
+	}
+	return &parent, nil
+}
+
+// Blocklist returns the active blocklist entries
+func (c *Client) Blocklist(ctx context.Context) ([]*models.BlocklistEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/blocklist", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocklist: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get blocklist: storage API returned %s", resp.Status)
+	}
+
+	var body struct {
+		Entries []*models.BlocklistEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode blocklist: %w", err)
+	}
+	return body.Entries, nil
+}
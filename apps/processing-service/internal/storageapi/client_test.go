@@ -0,0 +1,123 @@
+package storageapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storedPurchase is a transaction as the storage API returns it, with its
+// refunds
+const storedPurchase = `{
+	"id": "txn_20260302120000.000000001",
+	"account_id": "acct-1",
+	"amount": 100,
+	"currency": "USD",
+	"type": "purchase",
+	"status": "approved",
+	"risk_score": 0.05,
+	"refunds": [
+		{"id": "txn_20260302130000.000000001", "amount": 60, "status": "approved", "parent_transaction_id": "txn_20260302120000.000000001"},
+		{"id": "txn_20260302140000.000000001", "amount": 500, "status": "rejected", "parent_transaction_id": "txn_20260302120000.000000001"}
+	]
+}`
+
+// storedBlocklist is the blocklist as the storage API returns it
+const storedBlocklist = `{
+	"entries": [
+		{"id": 1, "type": "merchant", "value": "Shady Shop", "reason": "chargeback ring", "added_by": "ops-1", "created_at": "2026-03-01T09:00:00Z"},
+		{"id": 2, "type": "country", "value": "KP", "reason": "sanctions", "added_by": "ops-1", "created_at": "2026-03-01T09:00:00Z", "expires_at": "2026-06-01T00:00:00Z"}
+	],
+	"count": 2
+}`
+
+// newStorageAPI serves GET /api/v1/transactions/{id} for the one stored
+// purchase and GET /api/v1/blocklist, failing with status for other paths
+func newStorageAPI(t *testing.T, status int) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer storage-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/transactions/txn_20260302120000.000000001":
+			w.Write([]byte(storedPurchase))
+		case "/api/v1/blocklist":
+			w.Write([]byte(storedBlocklist))
+		default:
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", "storage-token", time.Second)
+}
+
+func TestParentTransaction(t *testing.T) {
+	parent, err := newStorageAPI(t, http.StatusNotFound).ParentTransaction(context.Background(), "txn_20260302120000.000000001")
+	if err != nil {
+		t.Fatalf("ParentTransaction: %v", err)
+	}
+	if parent.ID != "txn_20260302120000.000000001" || parent.Amount != 100 || parent.Status != "approved" {
+		t.Errorf("parent = %+v", parent)
+	}
+	if len(parent.Refunds) != 2 || parent.Refunds[0].Amount != 60 || parent.Refunds[1].Status != "rejected" {
+		t.Errorf("refunds = %+v, want both", parent.Refunds)
+	}
+}
+
+func TestParentTransactionNotFound(t *testing.T) {
+	parent, err := newStorageAPI(t, http.StatusNotFound).ParentTransaction(context.Background(), "txn_20260302120000.000000002")
+	if err != nil || parent != nil {
+		t.Errorf("ParentTransaction = %+v, %v, want nil without error", parent, err)
+	}
+}
+
+func TestParentTransactionFailures(t *testing.T) {
+	_, err := newStorageAPI(t, http.StatusServiceUnavailable).ParentTransaction(context.Background(), "txn_20260302120000.000000002")
+	if err == nil || !strings.Contains(err.Error(), "storage API returned 503 Service Unavailable") {
+		t.Errorf("ParentTransaction = %v, want the status reported", err)
+	}
+
+	unauthorized := NewClient(newStorageAPI(t, http.StatusNotFound).baseURL, "wrong-token", time.Second)
+	if _, err := unauthorized.ParentTransaction(context.Background(), "txn_20260302120000.000000001"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("ParentTransaction with a wrong token = %v, want 401 reported", err)
+	}
+
+	unreachable := NewClient("http://127.0.0.1:1", "storage-token", time.Second)
+	if _, err := unreachable.ParentTransaction(context.Background(), "txn_20260302120000.000000001"); err == nil {
+		t.Error("ParentTransaction of an unreachable API succeeded")
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	entries, err := newStorageAPI(t, http.StatusNotFound).Blocklist(context.Background())
+	if err != nil {
+		t.Fatalf("Blocklist: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want both", entries)
+	}
+	if e := entries[0]; e.Type != "merchant" || e.Value != "Shady Shop" || e.Reason != "chargeback ring" || e.ExpiresAt != nil {
+		t.Errorf("entry = %+v, want the permanent merchant", e)
+	}
+	if e := entries[1]; e.ExpiresAt == nil || !e.ExpiresAt.Equal(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("entry = %+v, want the country expiring in June", e)
+	}
+}
+
+func TestBlocklistFailures(t *testing.T) {
+	unauthorized := NewClient(newStorageAPI(t, http.StatusNotFound).baseURL, "wrong-token", time.Second)
+	if _, err := unauthorized.Blocklist(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Blocklist with a wrong token = %v, want 401 reported", err)
+	}
+
+	unreachable := NewClient("http://127.0.0.1:1", "storage-token", time.Second)
+	if _, err := unreachable.Blocklist(context.Background()); err == nil {
+		t.Error("Blocklist of an unreachable API succeeded")
+	}
+}
@@ -0,0 +1,423 @@
+// Package app runs the storage service. Its main package and the
+// end-to-end tests start it through Run.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"storage-service/internal/api"
+	"storage-service/internal/callback"
+	"storage-service/internal/config"
+	"storage-service/internal/encryption"
+	"storage-service/internal/feed"
+	"storage-service/internal/handler"
+	"storage-service/internal/integrity"
+	"storage-service/internal/metrics"
+	"storage-service/internal/middleware"
+	"storage-service/internal/outbox"
+	"storage-service/internal/publisher"
+	"storage-service/internal/reconcile"
+	"storage-service/internal/risk"
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/lifecycle"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/startup"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+)
+
+// Config is the configuration of the service
+type Config = config.Config
+
+// LoadConfig loads the configuration from the environment and validates it
+func LoadConfig() (*Config, error) {
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Run waits for the database and Kafka, then stores the transactions
+// consumed and serves the API until ctx is done or the process is
+// signalled, and shuts down in order. It returns the errors of a failed
+// start or an unclean shutdown.
+func Run(ctx context.Context, cfg *Config) error {
+	logger := slog.Default()
+
+	// Setup fault injection, a no-op unless enabled
+	chaosInjector := chaos.New(cfg.ChaosEnabled, metrics.ChaosMetrics{})
+	if cfg.ChaosEnabled {
+		log.Println("Warning: CHAOS_ENABLED is set, faults can be injected into Kafka and the database")
+	}
+
+	// Build the Kafka connection settings, failing on bad TLS or SASL config
+	kafkaConn, err := cfg.KafkaSecurity.Connect()
+	if err != nil {
+		return fmt.Errorf("invalid kafka security config: %w", err)
+	}
+
+	// Wait for the database and Kafka, which may still be starting
+	err = startup.Wait(ctx, time.Duration(cfg.StartupTimeout)*time.Second, logger,
+		startup.Check{Name: "postgres", Probe: func(ctx context.Context) error {
+			return storage.PingDatabase(ctx, cfg.DBUrl)
+		}},
+		startup.Check{Name: "kafka", Probe: func(ctx context.Context) error {
+			return kafkaConn.Ping(ctx, consumer.ParseBrokers(cfg.KafkaBrokers))
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	// Create the topics the service produces to with their partitions,
+	// replication and retention, when provisioning is enabled
+	provisionCtx, cancelProvision := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout)*time.Second)
+	err = cfg.KafkaTopics.ProvisionTopics(provisionCtx, kafkaConn, consumer.ParseBrokers(cfg.KafkaBrokers), cfg.OutputTopics(), logger)
+	cancelProvision()
+	if err != nil {
+		return fmt.Errorf("failed to provision Kafka topics: %w", err)
+	}
+
+	// Convert stats totals into the base currency
+	rates, err := loadExchangeRates(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Connect DB
+	store, err := newStore(cfg, rates, chaosInjector)
+	if err != nil {
+		return err
+	}
+
+	// Components register as they are created, to be stopped in order on
+	// shutdown
+	lc := lifecycle.New(time.Duration(cfg.ShutdownDeadline)*time.Second, logger)
+	lc.Add(lifecycle.Closer("database", lifecycle.Stores, store.Close))
+
+	// Initialize handler
+	txHandler := handler.NewTransactionHandler(store)
+
+	// Publisher of the outbox relay and of lag alerts
+	pub := publisher.NewPublisher(cfg.KafkaBrokers, kafkaConn.Transport, chaosInjector)
+	lc.Add(lifecycle.Closer("kafka publisher", lifecycle.Producers, pub.Close))
+
+	// Setup Kafka consumer. A transaction failing every attempt is parked on
+	// the dead letter topic.
+	cons := consumer.New(consumer.Config{
+		Brokers:         cfg.KafkaBrokers,
+		GroupID:         cfg.ConsumerGroup,
+		Topic:           cfg.InputTopic,
+		Dialer:          kafkaConn.Dialer,
+		Transport:       kafkaConn.Transport,
+		BatchSize:       cfg.ConsumerBatchSize,
+		Workers:         cfg.ConsumerConcurrency,
+		MaxAttempts:     cfg.MaxRetries + 1,
+		DeadLetterTopic: cfg.DLQTopic,
+		MaxRedrives:     cfg.MaxRedrives,
+		DrainTimeout:    time.Duration(cfg.ProcessTimeout) * time.Second,
+		Metrics:         metrics.ConsumerMetrics{},
+		Logger:          logger,
+		LogSampleRate:   cfg.LogSampleRate,
+		Chaos:           chaosInjector,
+
+		LagAlerter:       publisher.NewAlertPublisher(pub, cfg.LagAlertTopic),
+		LagThreshold:     int64(cfg.LagAlertThreshold),
+		LagSustain:       time.Duration(cfg.LagAlertSustain) * time.Second,
+		LagRecoveryRatio: cfg.LagAlertRecoveryRatio,
+	}, consumer.HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if !handler.IsTransaction(m) {
+			return nil
+		}
+		return txHandler.Handle(ctx, m.Value)
+	}))
+	lc.Add(lifecycle.Closer("kafka consumer", lifecycle.Consumers, cons.Close))
+
+	// Setup reconciliation between the input topic and the database
+	reconciler := reconcile.NewReconciler(cfg.KafkaBrokers, cfg.InputTopic, kafkaConn.Dialer, store, txHandler, cfg.ReconcileChunkSize)
+
+	// Setup risk recomputation, decaying the risk of accounts over time
+	recomputer := risk.NewRecomputer(store,
+		time.Duration(cfg.RiskWindowDays)*24*time.Hour,
+		time.Duration(cfg.RiskHalfLifeDays)*24*time.Hour,
+		cfg.RiskRecomputeBatchSize)
+
+	// Setup the live feed, consuming the input topic with its own group from
+	// the latest transactions
+	var feedHandler *feed.Handler
+	var feedConsumer *consumer.Consumer
+	if cfg.FeedEnabled {
+		hub := feed.NewHub(cfg.FeedReplaySize, cfg.FeedClientBuffer)
+		feedHandler = feed.NewHandler(hub)
+		feedConsumer = consumer.New(consumer.Config{
+			Brokers:       cfg.KafkaBrokers,
+			GroupID:       cfg.FeedConsumerGroup,
+			Topic:         cfg.InputTopic,
+			Dialer:        kafkaConn.Dialer,
+			Transport:     kafkaConn.Transport,
+			BatchSize:     cfg.ConsumerBatchSize,
+			Logger:        logger,
+			LogSampleRate: cfg.LogSampleRate,
+			StartOffset:   kafka.LastOffset,
+		}, consumer.HandlerFunc(hub.Consume))
+		lc.Add(lifecycle.Closer("feed kafka consumer", lifecycle.Consumers, feedConsumer.Close))
+	}
+
+	// Setup the decision audit consumer, appending the audits of the
+	// processing service with its own group. An audit is retried until it
+	// is stored, so none is skipped while the database is down.
+	var auditConsumer *consumer.Consumer
+	if cfg.AuditTopic != "" {
+		auditConsumer = consumer.New(consumer.Config{
+			Brokers:       cfg.KafkaBrokers,
+			GroupID:       cfg.AuditConsumerGroup,
+			Topic:         cfg.AuditTopic,
+			Dialer:        kafkaConn.Dialer,
+			Transport:     kafkaConn.Transport,
+			BatchSize:     cfg.ConsumerBatchSize,
+			Workers:       cfg.ConsumerConcurrency,
+			DrainTimeout:  time.Duration(cfg.ProcessTimeout) * time.Second,
+			Logger:        logger,
+			LogSampleRate: cfg.LogSampleRate,
+		}, handler.NewAuditHandler(store))
+		lc.Add(lifecycle.Closer("audit kafka consumer", lifecycle.Consumers, auditConsumer.Close))
+	}
+
+	// Start HTTP API server
+	jwtManager := auth.NewJWTManager(cfg.JWTKeyID, cfg.JWTSecret, cfg.JWTPreviousSecrets)
+	authMiddleware := middleware.NewAuthMiddleware(jwtManager)
+	server := &http.Server{
+		Addr:         ":" + cfg.HTTPPort,
+		Handler:      api.NewServer(store, reconciler, authMiddleware, feedHandler, cfg.APIDocsEnabled, cfg.ExportMaxRows).Router(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 60 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	log.Printf("Storage API running on port %s", cfg.HTTPPort)
+	lc.Add(lifecycle.Server("http server", server))
+
+	// Serve the metrics, also serving readiness and consumer administration
+	log.Printf("Starting metrics server on port %s", cfg.MetricsPort)
+	lc.Add(lifecycle.Server("metrics server", newMetricsServer(cfg, cons, chaosInjector)))
+
+	// Reload rotated secrets
+	watchSecrets(lc, cfg, jwtManager, store)
+
+	// Run outbox relay. It stops after the consumers writing the outbox and
+	// before the publisher it publishes through.
+	relay := outbox.NewRelay(store, pub,
+		time.Duration(cfg.OutboxPollInterval)*time.Millisecond,
+		cfg.OutboxBatchSize,
+		time.Duration(cfg.OutboxRetention)*time.Hour)
+	lc.Add(lifecycle.Background("outbox relay", relay.Run))
+
+	// Deliver the outcomes of transactions to their callback URLs
+	if cfg.CallbackSecret != "" {
+		deliverer := callback.NewDeliverer(store, callback.Config{
+			Secret:      cfg.CallbackSecret,
+			Interval:    time.Duration(cfg.CallbackPollInterval) * time.Millisecond,
+			BatchSize:   cfg.CallbackBatchSize,
+			Timeout:     time.Duration(cfg.CallbackTimeout) * time.Second,
+			MaxAttempts: cfg.CallbackMaxAttempts,
+			Backoff:     time.Duration(cfg.CallbackBackoff) * time.Second,
+			MaxBackoff:  time.Duration(cfg.CallbackMaxBackoff) * time.Second,
+		})
+		lc.Add(lifecycle.Background("callback deliverer", deliverer.Run))
+	} else {
+		log.Println("CALLBACK_SIGNING_SECRET not set, transaction callbacks are not delivered")
+	}
+
+	// Run scheduled reconciliation
+	if cfg.ReconcileInterval > 0 {
+		lc.Add(lifecycle.Background("scheduled reconciliation", func(ctx context.Context) {
+			reconciler.RunScheduled(ctx,
+				time.Duration(cfg.ReconcileInterval)*time.Minute,
+				time.Duration(cfg.ReconcileLag)*time.Minute,
+				cfg.ReconcileRepair)
+		}))
+	}
+
+	// Run scheduled risk recomputation
+	if cfg.RiskRecomputeInterval > 0 {
+		lc.Add(lifecycle.Background("scheduled risk recomputation", func(ctx context.Context) {
+			recomputer.RunScheduled(ctx, time.Duration(cfg.RiskRecomputeInterval)*time.Minute)
+		}))
+	}
+
+	// Run scheduled integrity verification
+	if cfg.IntegrityEnabled && cfg.IntegrityVerifyInterval > 0 {
+		verifier := integrity.NewVerifier(store, cfg.BatchSize)
+		lc.Add(lifecycle.Background("scheduled integrity verification", func(ctx context.Context) {
+			verifier.RunScheduled(ctx, time.Duration(cfg.IntegrityVerifyInterval)*time.Minute)
+		}))
+	}
+
+	// Keep the exchange rates up to date with the provider
+	if cfg.ExchangeRatesURL != "" {
+		lc.Add(lifecycle.Background("exchange rates refresh", func(ctx context.Context) {
+			rates.Run(ctx, cfg.ExchangeRatesURL, time.Duration(cfg.ExchangeRatesRefresh)*time.Minute)
+		}))
+	}
+
+	// Keep the account statuses cached for the processing service in sync
+	if cfg.AccountStatusSyncInterval > 0 {
+		lc.Add(lifecycle.Background("account status sync", func(ctx context.Context) {
+			store.RunAccountStatusSync(ctx, time.Duration(cfg.AccountStatusSyncInterval)*time.Minute)
+		}))
+	}
+
+	// Run the consumers. Each drains the batch in flight for up to
+	// ProcessTimeout once stopped, before it is closed.
+	lc.Add(lifecycle.Component{Name: "consumer", Group: lifecycle.Consumers, Start: cons.Start})
+	if auditConsumer != nil {
+		lc.Add(lifecycle.Component{Name: "audit consumer", Group: lifecycle.Consumers, Start: auditConsumer.Start})
+	}
+	if feedConsumer != nil {
+		lc.Add(lifecycle.Component{Name: "feed consumer", Group: lifecycle.Consumers, Start: feedConsumer.Start})
+	}
+
+	return lc.Run(ctx)
+}
+
+// OpenStore waits for the database of cfg and connects to it, for the
+// one-off commands run instead of the service
+func OpenStore(ctx context.Context, cfg *Config) (*storage.Storage, error) {
+	err := startup.Wait(ctx, time.Duration(cfg.StartupTimeout)*time.Second, slog.Default(),
+		startup.Check{Name: "postgres", Probe: func(ctx context.Context) error {
+			return storage.PingDatabase(ctx, cfg.DBUrl)
+		}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+	rates, err := loadExchangeRates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(cfg, rates, chaos.New(cfg.ChaosEnabled, metrics.ChaosMetrics{}))
+}
+
+// newStore connects to the database of cfg, encrypting the PII columns when
+// keys are configured
+func newStore(cfg *Config, rates *currency.Converter, chaosInjector *chaos.Injector) (*storage.Storage, error) {
+	var fieldCipher *encryption.FieldCipher
+	if cfg.PIIEncryptionKeys != "" {
+		keys, err := encryption.NewStaticKeyProvider(cfg.PIIEncryptionKeys, cfg.PIIEncryptionKeyVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII encryption keys: %w", err)
+		}
+		fieldCipher = encryption.NewFieldCipher(keys)
+	} else {
+		log.Println("Warning: PII_ENCRYPTION_KEYS not set, PII columns are stored in plaintext")
+	}
+
+	store, err := storage.NewStorage(storage.Options{
+		DBUrl:                 cfg.DBUrl,
+		Flavor:                cfg.DBFlavor,
+		ChunkInterval:         cfg.TimescaleChunkPeriod,
+		ReplicaURL:            cfg.DBReplicaURL,
+		ReplicaHealthInterval: time.Duration(cfg.ReplicaHealthInterval) * time.Second,
+		Redis:                 cfg.Redis,
+		CacheTTL:              time.Duration(cfg.CacheTTL) * time.Second,
+		NegativeCacheTTL:      time.Duration(cfg.NegativeCacheTTL) * time.Second,
+		SummaryCacheTTL:       time.Duration(cfg.SummaryCacheTTL) * time.Second,
+		SearchTimeout:         time.Duration(cfg.SearchTimeout) * time.Millisecond,
+		QueryTimeout:          time.Duration(cfg.QueryTimeout) * time.Second,
+		SlowQueryThreshold:    time.Duration(cfg.SlowQueryThreshold) * time.Millisecond,
+		Cipher:                fieldCipher,
+		StoredTopic:           cfg.StoredTopic,
+		AccountTopic:          cfg.AccountTopic,
+		Integrity:             cfg.IntegrityEnabled,
+		Callbacks:             cfg.CallbackSecret != "",
+		Rates:                 rates,
+		BaseCurrency:          cfg.BaseCurrency,
+		Chaos:                 chaosInjector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+	return store, nil
+}
+
+// loadExchangeRates returns a converter with the rates of the exchange rates
+// file, or the built-in rates without one
+func loadExchangeRates(cfg *config.Config) (*currency.Converter, error) {
+	rates, err := currency.LoadConverter(cfg.ExchangeRatesFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+	log.Printf("Reporting totals in %s with exchange rates as of %s", cfg.BaseCurrency, rates.Rates().AsOf.Format(time.RFC3339))
+	return rates, nil
+}
+
+// newMetricsServer returns the server for Prometheus metrics, when enabled,
+// health and readiness checks, and consumer pause and resume and fault
+// injection when an admin token is set. The service is not ready while the
+// consumer is paused.
+func newMetricsServer(cfg *config.Config, cons *consumer.Consumer, chaosInjector *chaos.Injector) *http.Server {
+	mux := http.NewServeMux()
+	if cfg.MetricsEnabled {
+		// OpenMetrics carries the latency exemplars
+		mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	if cfg.AdminToken != "" {
+		admin := consumer.AdminHandler(cons, cfg.AdminToken)
+		mux.Handle("/admin/consumer/", admin)
+		mux.Handle("/admin/dlq/", admin)
+	}
+	if cfg.AdminToken != "" && chaosInjector != nil {
+		mux.Handle("/admin/chaos", chaosInjector.Handler(cfg.AdminToken))
+	}
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		if err := cons.Ready(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	return &http.Server{Addr: ":" + cfg.MetricsPort, Handler: mux}
+}
+
+// watchSecrets polls the JWT secret and database password files, when the
+// secrets come from files, applying rotated values without a restart
+func watchSecrets(lc *lifecycle.Coordinator, cfg *config.Config, jwtManager *auth.JWTManager, store *storage.Storage) {
+	interval := time.Duration(cfg.SecretsReloadInterval) * time.Second
+	if cfg.JWTSecretFile != "" {
+		lc.Add(lifecycle.Background("jwt secret reload", func(ctx context.Context) {
+			secrets.Watch(ctx, cfg.JWTSecretFile, interval, jwtManager.SetSecret)
+		}))
+	}
+	if cfg.DBPasswordFile != "" {
+		lc.Add(lifecycle.Background("database password reload", func(ctx context.Context) {
+			secrets.Watch(ctx, cfg.DBPasswordFile, interval, func(password string) {
+				cfg.SetDBPassword(password)
+				pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				if err := store.SetDatabaseURL(pingCtx, cfg.DBUrl); err != nil {
+					log.Printf("database password rotation: %v", err)
+				}
+			})
+		}))
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/gorilla/mux"
+)
+
+// accountRequest is the body of an account creation. The tenant is taken
+// from the caller's claims when they carry one.
+type accountRequest struct {
+	ID          string `json:"id"`
+	UserID      string `json:"user_id"`
+	TenantID    string `json:"tenant_id"`
+	AccountType string `json:"account_type"`
+	Currency    string `json:"currency"`
+}
+
+// accountStatusRequest is the body of an account status change
+type accountStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// accountsResponse is a list of accounts
+type accountsResponse struct {
+	Accounts []*models.Account `json:"accounts"`
+	Count    int               `json:"count"`
+}
+
+// CreateAccountHandler creates an active account
+func (s *Server) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req accountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ID = strings.TrimSpace(req.ID)
+	req.UserID = strings.TrimSpace(req.UserID)
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.ID == "" || req.UserID == "" {
+		http.Error(w, "id and user_id are required", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidAccountType(req.AccountType) {
+		http.Error(w, "account_type must be checking, savings, credit or business", http.StatusBadRequest)
+		return
+	}
+	if _, ok := currency.Lookup(req.Currency); !ok {
+		http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.TenantID != "" {
+		if req.TenantID != "" && req.TenantID != claims.TenantID {
+			http.Error(w, "tenant_id does not match the caller's tenant", http.StatusForbidden)
+			return
+		}
+		req.TenantID = claims.TenantID
+	}
+
+	account := &models.Account{
+		ID:          req.ID,
+		UserID:      req.UserID,
+		TenantID:    req.TenantID,
+		AccountType: req.AccountType,
+		Currency:    req.Currency,
+	}
+	if err := s.store.CreateAccount(r.Context(), actor(r), account); err != nil {
+		writeAccountError(w, "failed to create account", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// GetAccountHandler returns an account
+func (s *Server) GetAccountHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.scopedAccount(w, r, "failed to get account")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// ListAccountsHandler returns the accounts of the user given by user_id
+func (s *Server) ListAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	accounts, err := s.store.ListAccountsByUser(r.Context(), userID, tenantScope(r))
+	if err != nil {
+		log.Printf("failed to list accounts: %v", err)
+		http.Error(w, "failed to list accounts", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, accountsResponse{
+		Accounts: accounts,
+		Count:    len(accounts),
+	})
+}
+
+// UpdateAccountStatusHandler freezes, thaws or closes an account
+func (s *Server) UpdateAccountStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var req accountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidAccountStatus(req.Status) {
+		http.Error(w, "status must be active, frozen or closed", http.StatusBadRequest)
+		return
+	}
+
+	current, ok := s.scopedAccount(w, r, "failed to update account status")
+	if !ok {
+		return
+	}
+
+	account, err := s.store.UpdateAccountStatus(r.Context(), actor(r), current.ID, req.Status)
+	if err != nil {
+		writeAccountError(w, "failed to update account status", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// scopedAccount loads the account named in the path, writing a 404 when it
+// does not exist or belongs to a tenant outside the caller's scope
+func (s *Server) scopedAccount(w http.ResponseWriter, r *http.Request, message string) (*models.Account, bool) {
+	account, err := s.store.GetAccount(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAccountError(w, message, err)
+		return nil, false
+	}
+	if tenantID := tenantScope(r); tenantID != nil && account.TenantID != *tenantID {
+		http.Error(w, storage.ErrAccountNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return account, true
+}
+
+// writeAccountError maps an account storage error to its HTTP status
+func writeAccountError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrAccountNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrAccountExists), errors.Is(err, storage.ErrInvalidStatusTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, storeErrorStatus(err))
+	}
+}
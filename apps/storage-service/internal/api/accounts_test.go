@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"storage-service/internal/storage"
+)
+
+func TestAccountRequestsAreValidatedBeforeTheStore(t *testing.T) {
+	router := newDocumentedServer(false).Router()
+	token := signedToken(t, "admin")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+	}{
+		{"create without an ID", "POST", "/api/v1/accounts", `{"user_id":"user-1","account_type":"checking","currency":"USD"}`, "id and user_id are required"},
+		{"create of an unknown type", "POST", "/api/v1/accounts", `{"id":"acct-1","user_id":"user-1","account_type":"brokerage","currency":"USD"}`, "account_type must be"},
+		{"create in an unknown currency", "POST", "/api/v1/accounts", `{"id":"acct-1","user_id":"user-1","account_type":"checking","currency":"XYZ"}`, "currency must be an ISO 4217 code"},
+		{"create of invalid JSON", "POST", "/api/v1/accounts", `{"id":`, "invalid request body"},
+		{"unknown status", "PATCH", "/api/v1/accounts/acct-1", `{"status":"suspended"}`, "status must be active, frozen or closed"},
+		{"list without a user", "GET", "/api/v1/accounts", "", "user_id is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("%s %s = %d %q, want 400 %q", tt.method, tt.path, w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteAccountError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", storage.ErrAccountNotFound, http.StatusNotFound},
+		{"exists", storage.ErrAccountExists, http.StatusConflict},
+		{"transition", fmt.Errorf("%w: closed to active", storage.ErrInvalidStatusTransition), http.StatusConflict},
+		{"timeout", storage.ErrQueryTimeout, http.StatusGatewayTimeout},
+		{"other", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeAccountError(w, "failed to update account status", tt.err)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
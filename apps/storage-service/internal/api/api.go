@@ -0,0 +1,626 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"storage-service/internal/feed"
+	"storage-service/internal/middleware"
+	"storage-service/internal/models"
+	"storage-service/internal/reconcile"
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/openapi"
+	"github.com/gorilla/mux"
+)
+
+// Server exposes the storage HTTP API
+type Server struct {
+	store      *storage.Storage
+	reconciler *reconcile.Reconciler
+	auth       *middleware.AuthMiddleware
+	feed       *feed.Handler
+	docs       bool
+
+	// exportMaxRows is the most transactions an export may hold
+	exportMaxRows int
+}
+
+// NewServer creates a new API server. The live feed is not served when
+// feedHandler is nil, and the Swagger UI page only when docs is set. Exports
+// matching more than exportMaxRows transactions are refused.
+func NewServer(store *storage.Storage, reconciler *reconcile.Reconciler, authMiddleware *middleware.AuthMiddleware, feedHandler *feed.Handler, docs bool, exportMaxRows int) *Server {
+	return &Server{
+		store:         store,
+		reconciler:    reconciler,
+		auth:          authMiddleware,
+		feed:          feedHandler,
+		docs:          docs,
+		exportMaxRows: exportMaxRows,
+	}
+}
+
+// transactionsResponse is a list of transactions
+type transactionsResponse struct {
+	Transactions []*models.StoredTransaction `json:"transactions"`
+	Count        int                         `json:"count"`
+}
+
+// decisionAuditsResponse is the stored decision on a transaction and the
+// audits of every decision made on it
+type decisionAuditsResponse struct {
+	TransactionID string                  `json:"transaction_id"`
+	Status        string                  `json:"status"`
+	RiskScore     float64                 `json:"risk_score"`
+	Audits        []*models.DecisionAudit `json:"audits"`
+	Count         int                     `json:"count"`
+}
+
+// callbacksResponse is the callbacks of a transaction and their delivery
+// attempts
+type callbacksResponse struct {
+	TransactionID string             `json:"transaction_id"`
+	Callbacks     []*models.Callback `json:"callbacks"`
+	Count         int                `json:"count"`
+}
+
+// dailyVolumeResponse is the daily volume of an account
+type dailyVolumeResponse struct {
+	AccountID string                `json:"account_id"`
+	Volumes   []*models.DailyVolume `json:"volumes"`
+}
+
+// Router builds the HTTP router for the storage API
+func (s *Server) Router() *mux.Router {
+	router := mux.NewRouter()
+
+	// Health check endpoint
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	}).Methods("GET")
+
+	// Build information
+	router.HandleFunc("/version", buildinfo.Handler("storage-service")).Methods("GET")
+
+	// API description, with a Swagger UI page to browse it when enabled
+	router.HandleFunc("/openapi.json", s.document().Handler()).Methods("GET")
+	if s.docs {
+		router.HandleFunc("/docs", openapi.DocsHandler("Transaction Storage API", "/openapi.json")).Methods("GET")
+	}
+
+	// Live feed of processed transactions
+	if s.feed != nil {
+		router.HandleFunc("/ws/transactions",
+			s.auth.RequireStreamAuth(s.auth.RequireAnyRole("admin", "auditor")(s.feed.ServeHTTP))).Methods("GET")
+	}
+
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+
+	// Transaction read endpoints
+	apiRouter.HandleFunc("/transactions/search", s.reader(s.SearchTransactionsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/transactions/export", s.exporter(s.ExportTransactionsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/transactions/{id}", s.reader(s.GetTransactionHandler)).Methods("GET")
+	apiRouter.HandleFunc("/transactions/{id}/audit", s.reader(s.DecisionAuditHandler)).Methods("GET")
+	apiRouter.HandleFunc("/transactions/{id}/callbacks", s.reader(s.CallbacksHandler)).Methods("GET")
+
+	// Stats endpoints
+	apiRouter.HandleFunc("/stats/accounts/{account_id}/daily-volume", s.reader(s.DailyVolumeHandler)).Methods("GET")
+
+	// Account endpoints, changes admin only
+	apiRouter.HandleFunc("/accounts", s.reader(s.ListAccountsHandler)).Methods("GET")
+	apiRouter.HandleFunc("/accounts", s.admin(s.CreateAccountHandler)).Methods("POST")
+	apiRouter.HandleFunc("/accounts/{id}", s.reader(s.GetAccountHandler)).Methods("GET")
+	apiRouter.HandleFunc("/accounts/{id}", s.admin(s.UpdateAccountStatusHandler)).Methods("PATCH")
+	apiRouter.HandleFunc("/accounts/{id}/risk", s.reader(s.AccountRiskHandler)).Methods("GET")
+	apiRouter.HandleFunc("/accounts/{id}/context", s.reader(s.AccountContextHandler)).Methods("GET")
+
+	// Blocklist endpoints, changes admin only
+	apiRouter.HandleFunc("/blocklist", s.reader(s.ListBlocklistHandler)).Methods("GET")
+	apiRouter.HandleFunc("/blocklist", s.admin(s.AddBlocklistEntryHandler)).Methods("POST")
+	apiRouter.HandleFunc("/blocklist/{id}", s.reader(s.GetBlocklistEntryHandler)).Methods("GET")
+	apiRouter.HandleFunc("/blocklist/{id}", s.admin(s.UpdateBlocklistEntryHandler)).Methods("PUT")
+	apiRouter.HandleFunc("/blocklist/{id}", s.admin(s.RemoveBlocklistEntryHandler)).Methods("DELETE")
+
+	// Data subject endpoints (admin only)
+	apiRouter.HandleFunc("/admin/users/{user_id}/erase", s.admin(s.EraseUserHandler)).Methods("POST")
+	apiRouter.HandleFunc("/admin/users/{user_id}/export", s.admin(s.ExportUserHandler)).Methods("GET")
+
+	// Operations endpoints (admin only)
+	apiRouter.HandleFunc("/admin/reconcile", s.admin(s.ReconcileHandler)).Methods("POST")
+	apiRouter.HandleFunc("/admin/verify-integrity", s.admin(s.VerifyIntegrityHandler)).Methods("POST")
+
+	return router
+}
+
+// admin wraps a handler so it requires an authenticated admin
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth.RequireAuth(s.auth.RequireRole("admin")(next))
+}
+
+// reader wraps a handler so it requires a role allowed to read transactions
+func (s *Server) reader(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth.RequireAuth(s.auth.RequireAnyRole("admin", "auditor")(next))
+}
+
+// exporter wraps a handler so it requires a role allowed to export
+// transactions in bulk
+func (s *Server) exporter(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth.RequireAuth(s.auth.RequireAnyRole("admin", "analyst")(next))
+}
+
+// SearchTransactionsHandler searches transactions by merchant and reference
+func (s *Server) SearchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := storage.SearchFilter{
+		AccountID: q.Get("account_id"),
+		Status:    q.Get("status"),
+		TenantID:  tenantScope(r),
+	}
+
+	var err error
+	if filter.From, err = parseTime(q.Get("from")); err != nil {
+		http.Error(w, "invalid from timestamp", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTime(q.Get("to")); err != nil {
+		http.Error(w, "invalid to timestamp", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(q.Get("limit"), 50, 500)
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	transactions, err := s.store.SearchTransactions(r.Context(), q.Get("q"), filter, limit)
+	if errors.Is(err, storage.ErrSearchQueryTooShort) {
+		http.Error(w, fmt.Sprintf("query must be at least %d characters", storage.MinSearchQueryLength), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to search transactions: %v", err)
+		http.Error(w, "failed to search transactions", storeErrorStatus(err))
+		return
+	}
+
+	if !canReadPII(r) {
+		for _, txn := range transactions {
+			redactPII(txn)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, transactionsResponse{
+		Transactions: transactions,
+		Count:        len(transactions),
+	})
+}
+
+// GetTransactionHandler returns a transaction with the refunds made against
+// it. Transactions outside the caller's tenant are not found.
+func (s *Server) GetTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	txn, err := s.store.GetTransaction(r.Context(), id)
+	if errors.Is(err, storage.ErrTransactionNotFound) {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get transaction: %v", err)
+		http.Error(w, "failed to get transaction", storeErrorStatus(err))
+		return
+	}
+
+	tenantID := tenantScope(r)
+	if tenantID != nil && txn.TenantID != *tenantID {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+
+	refunds, err := s.store.GetRefunds(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get refunds: %v", err)
+		http.Error(w, "failed to get transaction", storeErrorStatus(err))
+		return
+	}
+	if tenantID != nil {
+		scoped := refunds[:0]
+		for _, refund := range refunds {
+			if refund.TenantID == *tenantID {
+				scoped = append(scoped, refund)
+			}
+		}
+		refunds = scoped
+	}
+
+	if !canReadPII(r) {
+		redactPII(txn)
+		for _, refund := range refunds {
+			redactPII(refund)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, models.TransactionWithRefunds{
+		StoredTransaction: txn,
+		Refunds:           refunds,
+	})
+}
+
+// DecisionAuditHandler returns the audits of the decisions made on a
+// transaction alongside the decision stored for it
+func (s *Server) DecisionAuditHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	txn, err := s.store.GetTransaction(r.Context(), id)
+	if errors.Is(err, storage.ErrTransactionNotFound) {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get transaction: %v", err)
+		http.Error(w, "failed to get decision audits", storeErrorStatus(err))
+		return
+	}
+	if tenantID := tenantScope(r); tenantID != nil && txn.TenantID != *tenantID {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+
+	audits, err := s.store.GetDecisionAudits(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get decision audits: %v", err)
+		http.Error(w, "failed to get decision audits", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, decisionAuditsResponse{
+		TransactionID: txn.ID,
+		Status:        txn.Status,
+		RiskScore:     txn.RiskScore,
+		Audits:        audits,
+		Count:         len(audits),
+	})
+}
+
+// CallbacksHandler returns the callbacks of a transaction with their
+// delivery attempts. Transactions outside the caller's tenant are not found.
+func (s *Server) CallbacksHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	txn, err := s.store.GetTransaction(r.Context(), id)
+	if errors.Is(err, storage.ErrTransactionNotFound) {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get transaction: %v", err)
+		http.Error(w, "failed to get callbacks", storeErrorStatus(err))
+		return
+	}
+	if tenantID := tenantScope(r); tenantID != nil && txn.TenantID != *tenantID {
+		http.Error(w, "transaction not found", http.StatusNotFound)
+		return
+	}
+
+	callbacks, err := s.store.GetCallbacks(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to get callbacks: %v", err)
+		http.Error(w, "failed to get callbacks", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, callbacksResponse{
+		TransactionID: txn.ID,
+		Callbacks:     callbacks,
+		Count:         len(callbacks),
+	})
+}
+
+// DailyVolumeHandler returns the daily transaction volume of an account,
+// defaulting to the last 30 days
+func (s *Server) DailyVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["account_id"]
+	q := r.URL.Query()
+
+	to, err := parseTime(q.Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to timestamp", http.StatusBadRequest)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	from, err := parseTime(q.Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from timestamp", http.StatusBadRequest)
+		return
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+
+	if tenantID := tenantScope(r); tenantID != nil {
+		inTenant, err := s.store.AccountInTenant(r.Context(), accountID, *tenantID)
+		if err != nil {
+			log.Printf("failed to check account tenant: %v", err)
+			http.Error(w, "failed to get daily volume", storeErrorStatus(err))
+			return
+		}
+		if !inTenant {
+			http.Error(w, "account not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	volumes, err := s.store.GetDailyVolume(r.Context(), accountID, from, to)
+	if err != nil {
+		log.Printf("failed to get daily volume: %v", err)
+		http.Error(w, "failed to get daily volume", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dailyVolumeResponse{
+		AccountID: accountID,
+		Volumes:   volumes,
+	})
+}
+
+// AccountRiskHandler returns the current risk metrics of an account
+func (s *Server) AccountRiskHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	if tenantID := tenantScope(r); tenantID != nil {
+		inTenant, err := s.store.AccountInTenant(r.Context(), accountID, *tenantID)
+		if err != nil {
+			log.Printf("failed to check account tenant: %v", err)
+			http.Error(w, "failed to get risk metrics", storeErrorStatus(err))
+			return
+		}
+		if !inTenant {
+			http.Error(w, "account not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	riskMetrics, err := s.store.GetRiskMetrics(r.Context(), accountID)
+	if err != nil {
+		log.Printf("failed to get risk metrics: %v", err)
+		http.Error(w, "failed to get risk metrics", storeErrorStatus(err))
+		return
+	}
+	if riskMetrics == nil {
+		http.Error(w, "risk metrics not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, riskMetrics)
+}
+
+// AccountContextHandler summarizes an account's activity over the last days
+// given by days, 30 by default and at most 365
+func (s *Server) AccountContextHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["id"]
+
+	days, err := parseLimit(r.URL.Query().Get("days"), 30, 365)
+	if err != nil {
+		http.Error(w, "invalid days", http.StatusBadRequest)
+		return
+	}
+
+	if tenantID := tenantScope(r); tenantID != nil {
+		inTenant, err := s.store.AccountInTenant(r.Context(), accountID, *tenantID)
+		if err != nil {
+			log.Printf("failed to check account tenant: %v", err)
+			http.Error(w, "failed to get account context", storeErrorStatus(err))
+			return
+		}
+		if !inTenant {
+			http.Error(w, "account not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	summary, err := s.store.GetAccountContext(r.Context(), accountID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("failed to get account context: %v", err)
+		http.Error(w, "failed to get account context", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// EraseUserHandler anonymizes all personal data held for a user
+func (s *Server) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	result, err := s.store.EraseUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("failed to erase user: %v", err)
+		http.Error(w, "failed to erase user", storeErrorStatus(err))
+		return
+	}
+
+	// The raw user ID is gone from the ledger, so the audit entry refers to the tombstone
+	details := fmt.Sprintf("transactions_affected=%d accounts_affected=%d", result.TransactionsAffected, result.AccountsAffected)
+	if err := s.store.RecordAudit(r.Context(), actor(r), models.AuditActionEraseUser, result.Tombstone, details); err != nil {
+		log.Printf("failed to audit user erasure %s: %v", result.Tombstone, err)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ExportUserHandler streams all of a user's transactions as JSON. The export
+// is unredacted: a subject-access response must contain all personal data held.
+func (s *Server) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	// Audit before streaming: the export must never happen unrecorded
+	if err := s.store.RecordAudit(r.Context(), actor(r), models.AuditActionExportUser, userID, ""); err != nil {
+		log.Printf("failed to audit user export: %v", err)
+		http.Error(w, "failed to export user", storeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", userID+".json"))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := s.store.ExportUser(r.Context(), userID, w); err != nil {
+		// Headers are already sent; the truncated body signals the failure
+		log.Printf("failed to export user: %v", err)
+	}
+}
+
+// reconcileRequest is the body of a reconciliation request
+type reconcileRequest struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Repair bool      `json:"repair"`
+}
+
+// ReconcileHandler runs a reconciliation over a time range and returns its report
+func (s *Server) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	var req reconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		http.Error(w, "from and to are required and from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.reconciler.Reconcile(r.Context(), req.From, req.To, req.Repair)
+	if err != nil {
+		log.Printf("failed to reconcile: %v", err)
+		http.Error(w, "failed to reconcile", storeErrorStatus(err))
+		return
+	}
+
+	details := fmt.Sprintf("report_id=%d repair=%t missing=%d repaired=%d", report.ID, req.Repair, report.Missing, report.Repaired)
+	subject := req.From.Format(time.RFC3339) + "/" + req.To.Format(time.RFC3339)
+	if err := s.store.RecordAudit(r.Context(), actor(r), models.AuditActionReconcile, subject, details); err != nil {
+		log.Printf("failed to audit reconciliation %d: %v", report.ID, err)
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// VerifyIntegrityHandler verifies the integrity chain of an account and
+// returns its report
+func (s *Server) VerifyIntegrityHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := r.URL.Query().Get("account_id")
+	if accountID == "" {
+		http.Error(w, "account_id is required", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.store.VerifyIntegrity(r.Context(), accountID)
+	if err != nil {
+		log.Printf("failed to verify integrity of account %s: %v", accountID, err)
+		http.Error(w, "failed to verify integrity", storeErrorStatus(err))
+		return
+	}
+
+	details := fmt.Sprintf("valid=%t links=%d unchained=%d", report.Valid, report.Links, report.Unchained)
+	if report.Broken != nil {
+		details += fmt.Sprintf(" broken_seq=%d", report.Broken.Seq)
+	}
+	if err := s.store.RecordAudit(r.Context(), actor(r), models.AuditActionVerifyIntegrity, accountID, details); err != nil {
+		log.Printf("failed to audit integrity verification of account %s: %v", accountID, err)
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// actor returns the identity of the authenticated caller
+func actor(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		return claims.UserID
+	}
+	return "unknown"
+}
+
+// tenantScope returns the tenant the caller's reads are limited to, or nil
+// for every tenant. Admins may pick one with the tenant_id query parameter.
+func tenantScope(r *http.Request) *string {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		tenantID := ""
+		return &tenantID
+	}
+	return claims.TenantScope(r.URL.Query().Get("tenant_id"))
+}
+
+// redactedValue replaces PII for callers without the pii role
+const redactedValue = "[REDACTED]"
+
+// canReadPII reports whether the caller may see decrypted PII
+func canReadPII(r *http.Request) bool {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	return ok && claims.HasRole("pii")
+}
+
+// redactPII masks the PII fields of a transaction in place
+func redactPII(txn *models.StoredTransaction) {
+	if txn.IPAddress != "" {
+		txn.IPAddress = redactedValue
+	}
+	if txn.DeviceInfo != "" {
+		txn.DeviceInfo = redactedValue
+	}
+	for k := range txn.Metadata {
+		txn.Metadata[k] = redactedValue
+	}
+}
+
+// storeErrorStatus returns the HTTP status of a failed storage call: a
+// gateway timeout when a query ran past the query timeout, otherwise an
+// internal error
+func storeErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrQueryTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// parseTime parses an optional RFC 3339 timestamp
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseLimit parses an optional positive limit, capped at max
+func parseLimit(value string, defaultLimit, max int) (int, error) {
+	if value == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit %q", value)
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit, nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// scopedRequest returns a request with query made on behalf of claims, or
+// anonymously when claims is nil
+func scopedRequest(claims *auth.Claims, query string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/transactions?"+query, nil)
+	if claims != nil {
+		r = r.WithContext(auth.WithClaims(r.Context(), claims))
+	}
+	return r
+}
+
+func TestTenantScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		query  string
+		want   *string
+	}{
+		{"anonymous reads the default tenant", nil, "tenant_id=unit-b", ptr("")},
+		{"tenant user reads its tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"auditor"}}, "", ptr("unit-a")},
+		{"tenant user cannot pick another tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"auditor"}}, "tenant_id=unit-b", ptr("unit-a")},
+		{"tenant admin cannot pick another tenant", &auth.Claims{TenantID: "unit-a", Roles: []string{"admin"}}, "tenant_id=unit-b", ptr("unit-a")},
+		{"untenanted user reads the default tenant", &auth.Claims{Roles: []string{"auditor"}}, "tenant_id=unit-b", ptr("")},
+		{"untenanted admin reads every tenant", &auth.Claims{Roles: []string{"admin"}}, "", nil},
+		{"untenanted admin picks a tenant", &auth.Claims{Roles: []string{"admin"}}, "tenant_id=unit-b", ptr("unit-b")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tenantScope(scopedRequest(tt.claims, tt.query))
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("scope = %v, want %v", show(got), show(tt.want))
+			case *got != *tt.want:
+				t.Errorf("scope = %q, want %q", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func show(s *string) string {
+	if s == nil {
+		return "every tenant"
+	}
+	return *s
+}
+
+func TestPIIIsRedactedWithoutThePIIRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		want   bool
+	}{
+		{"anonymous", nil, false},
+		{"analyst", &auth.Claims{Roles: []string{"analyst"}}, false},
+		{"admin", &auth.Claims{Roles: []string{"admin"}}, false},
+		{"pii", &auth.Claims{Roles: []string{"analyst", "pii"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canReadPII(scopedRequest(tt.claims, "")); got != tt.want {
+				t.Errorf("canReadPII = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	txn := exportTransaction()
+	txn.IPAddress = "203.0.113.7"
+	txn.DeviceInfo = "iPhone 15; iOS 19"
+	txn.Metadata = map[string]string{"note": "birthday present for Alex"}
+	redactPII(txn)
+	if txn.IPAddress != redactedValue || txn.DeviceInfo != redactedValue || txn.Metadata["note"] != redactedValue {
+		t.Errorf("redacted to ip %q, device %q, metadata %v", txn.IPAddress, txn.DeviceInfo, txn.Metadata)
+	}
+
+	empty := exportTransaction()
+	empty.IPAddress, empty.DeviceInfo, empty.Metadata = "", "", nil
+	redactPII(empty)
+	if empty.IPAddress != "" || empty.DeviceInfo != "" {
+		t.Errorf("absent fields redacted to ip %q, device %q", empty.IPAddress, empty.DeviceInfo)
+	}
+}
+
+func TestStoreErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"query timeout", fmt.Errorf("failed to search transactions: %w", storage.ErrQueryTimeout), http.StatusGatewayTimeout},
+		{"other failure", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storeErrorStatus(tt.err); got != tt.want {
+				t.Errorf("storeErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
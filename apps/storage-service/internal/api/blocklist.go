@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// blocklistRequest is the body of a blocklist add or update. Type and value
+// cannot be changed by an update.
+type blocklistRequest struct {
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// blocklistResponse is a list of blocklist entries
+type blocklistResponse struct {
+	Entries []*models.BlocklistEntry `json:"entries"`
+	Count   int                      `json:"count"`
+}
+
+// ListBlocklistHandler returns the active blocklist entries, or every entry
+// with include_expired=true. The blocklist applies to every tenant.
+func (s *Server) ListBlocklistHandler(w http.ResponseWriter, r *http.Request) {
+	includeExpired, _ := strconv.ParseBool(r.URL.Query().Get("include_expired"))
+
+	entries, err := s.store.ListBlocklist(r.Context(), includeExpired)
+	if err != nil {
+		log.Printf("failed to list blocklist: %v", err)
+		http.Error(w, "failed to list blocklist", storeErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, blocklistResponse{
+		Entries: entries,
+		Count:   len(entries),
+	})
+}
+
+// GetBlocklistEntryHandler returns a blocklist entry
+func (s *Server) GetBlocklistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := blocklistID(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := s.store.GetBlocklistEntry(r.Context(), id)
+	if err != nil {
+		writeBlocklistError(w, "failed to get blocklist entry", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// AddBlocklistEntryHandler adds a blocklist entry on behalf of the caller
+func (s *Server) AddBlocklistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var req blocklistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Value = strings.TrimSpace(req.Value)
+	if req.Type == models.BlocklistTypeCountry {
+		req.Value = strings.ToUpper(req.Value)
+	}
+	if !models.ValidBlocklistType(req.Type) {
+		http.Error(w, "type must be country, merchant or account", http.StatusBadRequest)
+		return
+	}
+	if req.Value == "" {
+		http.Error(w, "value is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	entry := &models.BlocklistEntry{
+		Type:      req.Type,
+		Value:     req.Value,
+		Reason:    req.Reason,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.store.AddBlocklistEntry(r.Context(), actor(r), entry); err != nil {
+		writeBlocklistError(w, "failed to add blocklist entry", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// UpdateBlocklistEntryHandler changes the reason and expiry of a blocklist
+// entry. A null expires_at makes the entry permanent.
+func (s *Server) UpdateBlocklistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := blocklistID(w, r)
+	if !ok {
+		return
+	}
+
+	var req blocklistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := s.store.UpdateBlocklistEntry(r.Context(), actor(r), id, req.Reason, req.ExpiresAt)
+	if err != nil {
+		writeBlocklistError(w, "failed to update blocklist entry", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// RemoveBlocklistEntryHandler deletes a blocklist entry
+func (s *Server) RemoveBlocklistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := blocklistID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.RemoveBlocklistEntry(r.Context(), actor(r), id); err != nil {
+		writeBlocklistError(w, "failed to remove blocklist entry", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// blocklistID parses the entry ID from the path, writing a 400 when it is
+// invalid
+func blocklistID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid blocklist entry ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeBlocklistError maps a blocklist storage error to its HTTP status
+func writeBlocklistError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrBlocklistEntryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrBlocklistEntryExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, storeErrorStatus(err))
+	}
+}
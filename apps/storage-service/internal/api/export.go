@@ -0,0 +1,308 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+)
+
+// Export formats
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+// exportFlushInterval is how often an export in progress is flushed to the
+// client, so that proxies see it progress and do not time it out
+const exportFlushInterval = time.Second
+
+// exportWriteTimeout bounds writing an export between two flushes. It
+// replaces the server's write timeout, which would cut long exports short.
+const exportWriteTimeout = time.Minute
+
+// exportColumns are the columns of a CSV export
+var exportColumns = []string{
+	"id", "idempotency_key", "account_id", "user_id", "tenant_id",
+	"amount", "currency", "currency_exponent", "type", "category",
+	"merchant", "merchant_normalized", "reference", "parent_transaction_id",
+	"status", "timestamp", "risk_score", "risk_level", "is_approved",
+	"rejection_reason", "is_valid", "validation_errors", "country",
+	"ip_address", "device_info", "metadata", "processed_at",
+	"processing_time_ms", "processor_id", "created_at", "updated_at",
+	"is_recurring",
+}
+
+// exportEncoder writes the transactions of an export in one format
+type exportEncoder interface {
+	Encode(txn *models.StoredTransaction) error
+	// Flush writes the buffered transactions out
+	Flush() error
+}
+
+// ExportTransactionsHandler streams the transactions matching the filters,
+// oldest first, as CSV or NDJSON. Transactions are read from a database
+// cursor and written as they are read, gzipped when the client accepts it,
+// and flushed every exportFlushInterval. More matching transactions than
+// the row cap are refused rather than truncated.
+func (s *Server) ExportTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	filter := storage.SearchFilter{
+		AccountID: q.Get("account_id"),
+		Status:    q.Get("status"),
+		TenantID:  tenantScope(r),
+	}
+
+	var err error
+	if filter.From, err = parseTime(q.Get("from")); err != nil {
+		http.Error(w, "invalid from timestamp", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTime(q.Get("to")); err != nil {
+		http.Error(w, "invalid to timestamp", http.StatusBadRequest)
+		return
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	export, err := s.store.ExportTransactions(r.Context(), filter, s.exportMaxRows)
+	if errors.Is(err, storage.ErrExportTooLarge) {
+		http.Error(w, fmt.Sprintf("more than %d transactions match, narrow the filters", s.exportMaxRows), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to export transactions: %v", err)
+		http.Error(w, "failed to export transactions", storeErrorStatus(err))
+		return
+	}
+	defer export.Close()
+
+	// Audit before streaming: the export must never happen unrecorded
+	details := fmt.Sprintf("format=%s rows=%d account_id=%s status=%s", format, export.Total, filter.AccountID, filter.Status)
+	if err := s.store.RecordAudit(r.Context(), actor(r), models.AuditActionExportTransactions, exportRange(filter), details); err != nil {
+		log.Printf("failed to audit transaction export: %v", err)
+		http.Error(w, "failed to export transactions", storeErrorStatus(err))
+		return
+	}
+
+	if format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(filter, format)))
+	w.Header().Set("X-Total-Count", strconv.Itoa(export.Total))
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	var body io.Writer = w
+	var gz *gzip.Writer
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(w)
+		defer gz.Close()
+		body = gz
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var enc exportEncoder
+	if format == exportFormatCSV {
+		enc = newCSVExport(body)
+	} else {
+		enc = newNDJSONExport(body)
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	flush := func() error {
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		return controller.Flush()
+	}
+
+	// Headers are sent from here on; a truncated body, shorter than
+	// X-Total-Count, signals a failure
+	written := 0
+	defer func() { metrics.RecordExported(format, written) }()
+
+	readPII := canReadPII(r)
+	lastFlush := time.Now()
+	for export.Next() {
+		txn := export.Transaction()
+		if !readPII {
+			redactPII(txn)
+		}
+		if err := enc.Encode(txn); err != nil {
+			log.Printf("failed to write transaction export: %v", err)
+			return
+		}
+		written++
+
+		if time.Since(lastFlush) >= exportFlushInterval {
+			if err := flush(); err != nil {
+				log.Printf("failed to write transaction export: %v", err)
+				return
+			}
+			lastFlush = time.Now()
+		}
+	}
+	if err := export.Err(); err != nil {
+		log.Printf("failed to export transactions after %d of %d: %v", written, export.Total, err)
+		return
+	}
+	if err := enc.Flush(); err != nil {
+		log.Printf("failed to write transaction export: %v", err)
+	}
+}
+
+// csvExport writes an export as CSV with a header row
+type csvExport struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVExport(w io.Writer) *csvExport {
+	return &csvExport{w: csv.NewWriter(w)}
+}
+
+// Encode writes txn as a CSV record, after the header row
+func (e *csvExport) Encode(txn *models.StoredTransaction) error {
+	if !e.header {
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	metadata := ""
+	if len(txn.Metadata) > 0 {
+		data, err := json.Marshal(txn.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata of %s: %w", txn.ID, err)
+		}
+		metadata = string(data)
+	}
+
+	return e.w.Write([]string{
+		txn.ID, txn.IdempotencyKey, txn.AccountID, txn.UserID, txn.TenantID,
+		strconv.FormatFloat(txn.Amount, 'f', -1, 64), txn.Currency, strconv.Itoa(txn.CurrencyExponent), txn.Type, txn.Category,
+		txn.Merchant, txn.MerchantNormalized, txn.Reference, txn.ParentTransactionID,
+		txn.Status, formatExportTime(txn.Timestamp), strconv.FormatFloat(txn.RiskScore, 'f', -1, 64), txn.RiskLevel, strconv.FormatBool(txn.IsApproved),
+		txn.RejectionReason, strconv.FormatBool(txn.IsValid), strings.Join(txn.ValidationErrors, "; "), txn.Country,
+		txn.IPAddress, txn.DeviceInfo, metadata, formatExportTime(txn.ProcessedAt),
+		strconv.FormatInt(txn.ProcessingTime.Milliseconds(), 10), txn.ProcessorID, formatExportTime(txn.CreatedAt), formatExportTime(txn.UpdatedAt),
+		strconv.FormatBool(txn.IsRecurring),
+	})
+}
+
+// Flush writes the header row of an empty export and the buffered records
+func (e *csvExport) Flush() error {
+	if !e.header {
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExport writes an export as one JSON transaction per line
+type ndjsonExport struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONExport(w io.Writer) *ndjsonExport {
+	buf := bufio.NewWriter(w)
+	return &ndjsonExport{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Encode writes txn as a line of JSON
+func (e *ndjsonExport) Encode(txn *models.StoredTransaction) error {
+	return e.enc.Encode(txn)
+}
+
+// Flush writes the buffered lines
+func (e *ndjsonExport) Flush() error {
+	return e.buf.Flush()
+}
+
+// formatExportTime formats a timestamp of an export, empty when unset
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// exportRange describes the time range of an export for the audit log
+func exportRange(filter storage.SearchFilter) string {
+	from, to := "-", "-"
+	if !filter.From.IsZero() {
+		from = filter.From.Format(time.RFC3339)
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.Format(time.RFC3339)
+	}
+	return from + "/" + to
+}
+
+// exportFilename names the attachment of an export after its time range
+func exportFilename(filter storage.SearchFilter, format string) string {
+	name := "transactions"
+	if !filter.From.IsZero() {
+		name += "-from-" + filter.From.UTC().Format("20060102")
+	}
+	if !filter.To.IsZero() {
+		name += "-to-" + filter.To.UTC().Format("20060102")
+	}
+	return name + "." + format
+}
+
+// acceptsGzip reports whether the client accepts a gzip encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
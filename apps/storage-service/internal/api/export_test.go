@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"storage-service/internal/middleware"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+// signedToken returns a token for a user with roles, signed with testSecret
+func signedToken(t *testing.T, roles ...string) string {
+	t.Helper()
+	claims := auth.Claims{
+		UserID: "user-1",
+		Roles:  roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// exportTransaction returns a processed transaction with every exported
+// field of note set
+func exportTransaction() *models.StoredTransaction {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	return &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:        "txn-1",
+			AccountID: "acct-1",
+			Amount:    1234.5,
+			Currency:  "USD",
+			Merchant:  "Corner, \"Shop\"",
+			Status:    "flagged",
+			Timestamp: at,
+		},
+		RiskScore:        0.87,
+		RiskLevel:        "high",
+		RejectionReason:  "velocity",
+		ValidationErrors: []string{"missing country", "unknown device"},
+		IsRecurring:      true,
+		ProcessedAt:      at.Add(time.Second),
+		ProcessingTime:   42 * time.Millisecond,
+	}}
+}
+
+func TestExportRequiresAdminOrAnalyst(t *testing.T) {
+	server := NewServer(nil, nil, middleware.NewAuthMiddleware(auth.NewJWTManager("test", testSecret, nil)), nil, false, 100)
+	router := server.Router()
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"auditor", []string{"auditor"}, http.StatusForbidden},
+		{"user", []string{"user"}, http.StatusForbidden},
+		// Past the gate, an invalid format is refused before the store
+		{"analyst", []string{"analyst"}, http.StatusBadRequest},
+		{"admin", []string{"admin"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/transactions/export?format=xml", nil)
+			if tt.roles != nil {
+				r.Header.Set("Authorization", "Bearer "+signedToken(t, tt.roles...))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportRejectsInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown format", "format=xlsx"},
+		{"invalid from", "from=yesterday"},
+		{"invalid to", "to=2026-13-01"},
+		{"empty range", "from=2026-03-02T00:00:00Z&to=2026-03-02T00:00:00Z"},
+		{"reversed range", "from=2026-03-03T00:00:00Z&to=2026-03-02T00:00:00Z"},
+	}
+
+	server := &Server{exportMaxRows: 100}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/transactions/export?"+tt.query, nil)
+			r = r.WithContext(auth.WithClaims(r.Context(), &auth.Claims{Roles: []string{"admin"}}))
+			w := httptest.NewRecorder()
+			server.ExportTransactionsHandler(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newCSVExport(&buf)
+	if err := enc.Encode(exportTransaction()); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want the header and one transaction", len(records))
+	}
+	for i, column := range records[0] {
+		if column != exportColumns[i] {
+			t.Fatalf("header = %v, want %v", records[0], exportColumns)
+		}
+	}
+	if len(records[1]) != len(exportColumns) {
+		t.Fatalf("%d fields, want %d", len(records[1]), len(exportColumns))
+	}
+
+	row := make(map[string]string, len(exportColumns))
+	for i, column := range exportColumns {
+		row[column] = records[1][i]
+	}
+	want := map[string]string{
+		"id":                 "txn-1",
+		"amount":             "1234.5",
+		"merchant":           "Corner, \"Shop\"",
+		"status":             "flagged",
+		"timestamp":          "2026-03-02T09:30:00Z",
+		"risk_score":         "0.87",
+		"risk_level":         "high",
+		"rejection_reason":   "velocity",
+		"validation_errors":  "missing country; unknown device",
+		"processed_at":       "2026-03-02T09:30:01Z",
+		"processing_time_ms": "42",
+		"is_recurring":       "true",
+		"created_at":         "",
+		"metadata":           "",
+	}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("%s = %q, want %q", column, row[column], value)
+		}
+	}
+}
+
+func TestEmptyCSVExportHasHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newCSVExport(&buf).Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if len(records) != 1 || len(records[0]) != len(exportColumns) {
+		t.Errorf("records = %v, want the header alone", records)
+	}
+}
+
+func TestNDJSONExport(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newNDJSONExport(&buf)
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(exportTransaction()); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Error("transactions written before a flush")
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(lines))
+	}
+	var got models.StoredTransaction
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := exportTransaction()
+	if got.ID != want.ID || got.Status != want.Status || got.RiskScore != want.RiskScore ||
+		got.RejectionReason != want.RejectionReason || !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("decoded %+v, want %+v", got.ProcessedTransaction, want.ProcessedTransaction)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"GZIP;q=0.5", true},
+		{"gzip;q=0", false},
+		{"br, identity", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/transactions/export", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(r); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestExportFilenameAndRange(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		filter   storage.SearchFilter
+		format   string
+		filename string
+		period   string
+	}{
+		{storage.SearchFilter{}, "csv", "transactions.csv", "-/-"},
+		{storage.SearchFilter{From: from}, "ndjson", "transactions-from-20260301.ndjson", "2026-03-01T00:00:00Z/-"},
+		{storage.SearchFilter{To: to}, "csv", "transactions-to-20260401.csv", "-/2026-04-01T00:00:00Z"},
+		{storage.SearchFilter{From: from, To: to}, "csv", "transactions-from-20260301-to-20260401.csv", "2026-03-01T00:00:00Z/2026-04-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		if got := exportFilename(tt.filter, tt.format); got != tt.filename {
+			t.Errorf("exportFilename = %q, want %q", got, tt.filename)
+		}
+		if got := exportRange(tt.filter); got != tt.period {
+			t.Errorf("exportRange = %q, want %q", got, tt.period)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/feed"
+	"storage-service/internal/middleware"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/gorilla/websocket"
+)
+
+func TestFeedUpgradeRequiresAnAuditorToken(t *testing.T) {
+	server := NewServer(nil, nil, middleware.NewAuthMiddleware(auth.NewJWTManager("test", testSecret, nil)),
+		feed.NewHandler(feed.NewHub(0, 1)), false, 100)
+	srv := httptest.NewServer(server.Router())
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/transactions"
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   int
+	}{
+		{"anonymous", "", "", http.StatusUnauthorized},
+		{"forged token", "Bearer forged", "", http.StatusUnauthorized},
+		{"user", "Bearer " + signedToken(t, "user"), "", http.StatusForbidden},
+		{"auditor", "Bearer " + signedToken(t, "auditor"), "", http.StatusSwitchingProtocols},
+		// Browsers cannot set headers on a WebSocket, so the token may be a
+		// query parameter
+		{"admin in the query", "", "?access_token=" + signedToken(t, "admin"), http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("Authorization", tt.header)
+			}
+			dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+			conn, resp, err := dialer.Dial(url+tt.query, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil || resp.StatusCode != tt.want {
+				t.Errorf("Dial = %v, %v, want %d", resp, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"strings"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/openapi"
+)
+
+// document describes the HTTP API served by Router. The schemas are
+// generated from the request and response types the handlers use; the
+// operations listed here must follow the routes registered in Router.
+func (s *Server) document() *openapi.Document {
+	doc := openapi.New("Transaction Storage API", buildinfo.Version,
+		"Reads stored transactions and account statistics, manages accounts and the blocklist, and runs data subject and operations tasks. "+
+			"Transactions are limited to the caller's tenant, and their PII is redacted without the pii role. Errors are returned as plain text.")
+
+	text := openapi.Text
+	unauthorized := text("Missing or invalid bearer token")
+	forbidden := text("The token lacks the required role")
+	timeout := text("A database query ran past the query timeout")
+	str := &openapi.Schema{Type: "string"}
+	timestamp := &openapi.Schema{Type: "string", Format: "date-time"}
+	tenantParam := openapi.QueryParam("tenant_id", "Tenant an admin's reads are limited to", str)
+	entryID := openapi.PathParam("id", "The blocklist entry ID")
+
+	// secured marks an operation as requiring a bearer token with one of
+	// roles
+	secured := func(roles string, op *openapi.Operation) *openapi.Operation {
+		op.Description = strings.TrimSpace("Requires the " + roles + " role. " + op.Description)
+		op.Security = openapi.Bearer
+		op.Responses["401"] = unauthorized
+		op.Responses["403"] = forbidden
+		op.Responses["504"] = timeout
+		return op
+	}
+	reads := func(op *openapi.Operation) *openapi.Operation { return secured("admin or auditor", op) }
+	exports := func(op *openapi.Operation) *openapi.Operation { return secured("admin or analyst", op) }
+	admin := func(op *openapi.Operation) *openapi.Operation { return secured("admin", op) }
+
+	doc.Add("GET", "/health", &openapi.Operation{
+		Summary:   "Report that the service is up",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": doc.JSON("Healthy", map[string]string{})},
+	})
+	doc.Add("GET", "/version", &openapi.Operation{
+		Summary:   "Return the build information of the service",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": doc.JSON("Build information", buildinfo.Info{})},
+	})
+	if s.feed != nil {
+		doc.Add("GET", "/ws/transactions", reads(&openapi.Operation{
+			Summary:     "Stream processed transactions over a WebSocket",
+			Description: "Each message is a stored transaction. The token may be passed in the access_token query parameter instead of the Authorization header.",
+			Tags:        []string{"transactions"},
+			Parameters:  []openapi.Parameter{openapi.QueryParam("access_token", "Bearer token, for clients that cannot set headers", str)},
+			Responses: map[string]*openapi.Response{
+				"101": doc.JSON("Switched to the WebSocket protocol; each message is a transaction", models.StoredTransaction{}),
+			},
+		}))
+	}
+
+	doc.Add("GET", "/api/v1/transactions/search", reads(&openapi.Operation{
+		Summary: "Search transactions by merchant and reference",
+		Tags:    []string{"transactions"},
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("q", "Text matched against merchant and reference", str),
+			openapi.QueryParam("account_id", "Account the transactions belong to", str),
+			openapi.QueryParam("status", "Status of the transactions", str),
+			openapi.QueryParam("from", "Earliest timestamp, RFC 3339", timestamp),
+			openapi.QueryParam("to", "Latest timestamp, RFC 3339", timestamp),
+			openapi.QueryParam("limit", "Maximum number of transactions, at most 500", &openapi.Schema{Type: "integer", Format: "int32"}),
+			tenantParam,
+		},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The matching transactions", transactionsResponse{}),
+			"400": text("Invalid timestamp or limit, or a query too short"),
+			"500": text("The search failed"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/transactions/export", exports(&openapi.Operation{
+		Summary: "Export transactions as CSV or NDJSON",
+		Description: "The transactions are streamed oldest first as an attachment, gzipped when the client accepts it. " +
+			"X-Total-Count gives the number of transactions; a failure part way through truncates the body. Exports matching more transactions than EXPORT_MAX_ROWS are refused.",
+		Tags: []string{"transactions"},
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("from", "Earliest timestamp, RFC 3339", timestamp),
+			openapi.QueryParam("to", "Latest timestamp, RFC 3339, exclusive", timestamp),
+			openapi.QueryParam("account_id", "Account the transactions belong to", str),
+			openapi.QueryParam("status", "Status of the transactions", str),
+			openapi.QueryParam("format", "csv, the default, or ndjson", &openapi.Schema{Type: "string", Enum: []string{"csv", "ndjson"}}),
+			tenantParam,
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "The transactions, as an attachment",
+				Content: map[string]openapi.MediaType{
+					"text/csv":             {Schema: str},
+					"application/x-ndjson": {Schema: doc.SchemaOf(models.StoredTransaction{})},
+				},
+			},
+			"400": text("Invalid format or timestamp, or more transactions than the row cap"),
+			"500": text("The export could not be started or audited"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/transactions/{id}", reads(&openapi.Operation{
+		Summary:    "Get a transaction with the refunds made against it",
+		Tags:       []string{"transactions"},
+		Parameters: []openapi.Parameter{openapi.PathParam("id", "The transaction ID"), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The transaction", models.TransactionWithRefunds{}),
+			"404": text("Transaction not found"),
+			"500": text("The transaction could not be read"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/transactions/{id}/audit", reads(&openapi.Operation{
+		Summary:     "Get the audits of the decisions made on a transaction",
+		Description: "Each audit names the rules configuration in force, what each matching rule contributed, the thresholds and the processor. A transaction decided again, such as after a redelivery, has one audit per decision.",
+		Tags:        []string{"transactions"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("id", "The transaction ID"), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The decision audits", decisionAuditsResponse{}),
+			"404": text("Transaction not found"),
+			"500": text("The audits could not be read"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/transactions/{id}/callbacks", reads(&openapi.Operation{
+		Summary:     "Get the callbacks of a transaction and their delivery attempts",
+		Description: "A transaction submitted with a callback URL has its outcome posted there once decided, retried with backoff until delivered or dead-lettered.",
+		Tags:        []string{"transactions"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("id", "The transaction ID"), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The callbacks", callbacksResponse{}),
+			"404": text("Transaction not found"),
+			"500": text("The callbacks could not be read"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/stats/accounts/{account_id}/daily-volume", reads(&openapi.Operation{
+		Summary: "Get the daily transaction volume of an account",
+		Tags:    []string{"accounts"},
+		Parameters: []openapi.Parameter{
+			openapi.PathParam("account_id", "The account ID"),
+			openapi.QueryParam("from", "First day, RFC 3339; defaults to 30 days before to", timestamp),
+			openapi.QueryParam("to", "Last day, RFC 3339; defaults to now", timestamp),
+			tenantParam,
+		},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The daily volume", dailyVolumeResponse{}),
+			"400": text("Invalid timestamp"),
+			"404": text("Account not found in the caller's tenant"),
+			"500": text("The volume could not be read"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/accounts", reads(&openapi.Operation{
+		Summary:    "List the accounts of a user",
+		Tags:       []string{"accounts"},
+		Parameters: []openapi.Parameter{openapi.QueryParam("user_id", "The user the accounts belong to", str), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The accounts", accountsResponse{}),
+			"400": text("Missing user_id"),
+			"500": text("The accounts could not be read"),
+		},
+	}))
+	doc.Add("POST", "/api/v1/accounts", admin(&openapi.Operation{
+		Summary:     "Create an active account",
+		Description: "The account takes the tenant of the caller's token when it carries one.",
+		Tags:        []string{"accounts"},
+		RequestBody: doc.JSONBody("The account", accountRequest{}),
+		Responses: map[string]*openapi.Response{
+			"201": doc.JSON("The account created", models.Account{}),
+			"400": text("Missing ID or user, or an invalid account type or currency"),
+			"409": text("An account with the same ID exists"),
+			"500": text("The account could not be created"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/accounts/{id}", reads(&openapi.Operation{
+		Summary:    "Get an account",
+		Tags:       []string{"accounts"},
+		Parameters: []openapi.Parameter{openapi.PathParam("id", "The account ID"), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The account", models.Account{}),
+			"404": text("Account not found in the caller's tenant"),
+			"500": text("The account could not be read"),
+		},
+	}))
+	doc.Add("PATCH", "/api/v1/accounts/{id}", admin(&openapi.Operation{
+		Summary:     "Freeze, thaw or close an account",
+		Description: "Transactions on frozen and closed accounts are rejected. A closed account cannot be reopened.",
+		Tags:        []string{"accounts"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("id", "The account ID"), tenantParam},
+		RequestBody: doc.JSONBody("The new status: active, frozen or closed", accountStatusRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The account", models.Account{}),
+			"400": text("Invalid status"),
+			"404": text("Account not found in the caller's tenant"),
+			"409": text("The account cannot move to the status"),
+			"500": text("The status could not be changed"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/accounts/{id}/risk", reads(&openapi.Operation{
+		Summary:    "Get the current risk metrics of an account",
+		Tags:       []string{"accounts"},
+		Parameters: []openapi.Parameter{openapi.PathParam("id", "The account ID"), tenantParam},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The risk metrics", models.RiskMetrics{}),
+			"404": text("Account or risk metrics not found"),
+			"500": text("The risk metrics could not be read"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/accounts/{id}/context", reads(&openapi.Operation{
+		Summary:     "Summarize the recent activity of an account",
+		Description: "When the account was opened, its transactions over the last days and how many were flagged, and its risk metrics. Alert notifications carry it for the analyst.",
+		Tags:        []string{"accounts"},
+		Parameters: []openapi.Parameter{
+			openapi.PathParam("id", "The account ID"),
+			openapi.QueryParam("days", "Days of activity counted, 30 by default and at most 365", &openapi.Schema{Type: "integer"}),
+			tenantParam,
+		},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The account context", models.AccountContext{}),
+			"400": text("Invalid days"),
+			"404": text("Account not found in the caller's tenant"),
+			"500": text("The account context could not be read"),
+		},
+	}))
+
+	doc.Add("GET", "/api/v1/blocklist", reads(&openapi.Operation{
+		Summary:    "List the blocklist entries",
+		Tags:       []string{"blocklist"},
+		Parameters: []openapi.Parameter{openapi.QueryParam("include_expired", "Include expired entries", &openapi.Schema{Type: "boolean"})},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The entries", blocklistResponse{}),
+			"500": text("The blocklist could not be read"),
+		},
+	}))
+	doc.Add("POST", "/api/v1/blocklist", admin(&openapi.Operation{
+		Summary:     "Add a blocklist entry",
+		Tags:        []string{"blocklist"},
+		RequestBody: doc.JSONBody("The entry; expires_at is optional and must be in the future", blocklistRequest{}),
+		Responses: map[string]*openapi.Response{
+			"201": doc.JSON("The entry added", models.BlocklistEntry{}),
+			"400": text("Invalid type, value or expiry"),
+			"409": text("An entry of the same type and value exists"),
+			"500": text("The entry could not be added"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/blocklist/{id}", reads(&openapi.Operation{
+		Summary:    "Get a blocklist entry",
+		Tags:       []string{"blocklist"},
+		Parameters: []openapi.Parameter{entryID},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The entry", models.BlocklistEntry{}),
+			"400": text("Invalid entry ID"),
+			"404": text("Entry not found"),
+			"500": text("The entry could not be read"),
+		},
+	}))
+	doc.Add("PUT", "/api/v1/blocklist/{id}", admin(&openapi.Operation{
+		Summary:     "Change the reason and expiry of a blocklist entry",
+		Description: "Type and value cannot be changed; a null expires_at makes the entry permanent.",
+		Tags:        []string{"blocklist"},
+		Parameters:  []openapi.Parameter{entryID},
+		RequestBody: doc.JSONBody("The new reason and expiry", blocklistRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The entry updated", models.BlocklistEntry{}),
+			"400": text("Invalid entry ID or body"),
+			"404": text("Entry not found"),
+			"500": text("The entry could not be updated"),
+		},
+	}))
+	doc.Add("DELETE", "/api/v1/blocklist/{id}", admin(&openapi.Operation{
+		Summary:    "Remove a blocklist entry",
+		Tags:       []string{"blocklist"},
+		Parameters: []openapi.Parameter{entryID},
+		Responses: map[string]*openapi.Response{
+			"204": openapi.Empty("Removed"),
+			"400": text("Invalid entry ID"),
+			"404": text("Entry not found"),
+			"500": text("The entry could not be removed"),
+		},
+	}))
+
+	doc.Add("POST", "/api/v1/admin/users/{user_id}/erase", admin(&openapi.Operation{
+		Summary:    "Anonymize all personal data held for a user",
+		Tags:       []string{"data subjects"},
+		Parameters: []openapi.Parameter{openapi.PathParam("user_id", "The user ID")},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The erasure", storage.ErasureResult{}),
+			"500": text("The user could not be erased"),
+		},
+	}))
+	doc.Add("GET", "/api/v1/admin/users/{user_id}/export", admin(&openapi.Operation{
+		Summary:     "Export all transactions of a user, unredacted",
+		Description: "The export is streamed; a failure part way through truncates the body.",
+		Tags:        []string{"data subjects"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("user_id", "The user ID")},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The transactions, as an attachment", []*models.StoredTransaction{}),
+			"500": text("The export could not be audited"),
+		},
+	}))
+	doc.Add("POST", "/api/v1/admin/reconcile", admin(&openapi.Operation{
+		Summary:     "Reconcile the processed topic against stored transactions",
+		Tags:        []string{"operations"},
+		RequestBody: doc.JSONBody("The time range, and whether to store the missing transactions", reconcileRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The reconciliation report", models.ReconciliationReport{}),
+			"400": text("Invalid body, or from not before to"),
+			"500": text("The reconciliation failed"),
+		},
+	}))
+	doc.Add("POST", "/api/v1/admin/verify-integrity", admin(&openapi.Operation{
+		Summary:     "Verify the integrity chain of an account",
+		Description: "Walks the account's chain of stored transactions and status changes from its first link, recomputing every hash, and reports the first broken link. Transactions outside the chain, stored before integrity mode was enabled, are counted.",
+		Tags:        []string{"operations"},
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("account_id", "The account whose chain is verified", str),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": doc.JSON("The integrity report", models.IntegrityReport{}),
+			"400": text("Missing account_id"),
+			"500": text("The chain could not be read"),
+		},
+	}))
+
+	return doc
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"storage-service/internal/middleware"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// newDocumentedServer returns a server without a store, serving the Swagger
+// UI page when docs is set
+func newDocumentedServer(docs bool) *Server {
+	return NewServer(nil, nil, middleware.NewAuthMiddleware(auth.NewJWTManager("test", testSecret, nil)), nil, docs, 100)
+}
+
+func TestRequestsMatchTheDocument(t *testing.T) {
+	doc := newDocumentedServer(false).document()
+	expires := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"POST", "/api/v1/accounts", accountRequest{ID: "acct-1", UserID: "user-1", AccountType: "checking", Currency: "USD"}},
+		{"PATCH", "/api/v1/accounts/{id}", accountStatusRequest{Status: "frozen"}},
+		{"POST", "/api/v1/blocklist", blocklistRequest{Type: "merchant", Value: "Shady Shop", Reason: "fraud ring", ExpiresAt: &expires}},
+		{"PUT", "/api/v1/blocklist/{id}", blocklistRequest{Type: "merchant", Value: "Shady Shop", Reason: "fraud ring"}},
+		{"POST", "/api/v1/admin/reconcile", reconcileRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if err := doc.ValidateRequest(tt.method, tt.path, body); err != nil {
+				t.Errorf("request does not match the document: %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+func TestOperationsEndpointsMatchTheDocument(t *testing.T) {
+	server := newDocumentedServer(false)
+	doc, router := server.document(), server.Router()
+	for _, path := range []string{"/health", "/version"} {
+		t.Run(path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", w.Code)
+			}
+			if err := doc.ValidateResponse("GET", path, "200", w.Body.Bytes()); err != nil {
+				t.Errorf("response does not match the document: %v\n%s", err, w.Body)
+			}
+		})
+	}
+}
+
+func TestDocsPageIsServedWhenEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		docs bool
+		want int
+	}{
+		{"disabled", false, http.StatusNotFound},
+		{"enabled", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newDocumentedServer(tt.docs).Router()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+			if w.Code != tt.want {
+				t.Errorf("GET /docs = %d, want %d", w.Code, tt.want)
+			}
+
+			// The document itself is always served
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("GET /openapi.json = %d, want 200", w.Code)
+			}
+		})
+	}
+}
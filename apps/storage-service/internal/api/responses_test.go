@@ -0,0 +1,134 @@
+//go:build integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"storage-service/internal/middleware"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+	"storage-service/internal/testdb"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// The response tests run the API against Postgres in a container:
+//
+//	go test -tags=integration ./internal/api/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStore returns a storage on a new database, closed when the test
+// ends
+func newTestStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.NewStorage(storage.Options{DBUrl: testdb.New(t)})
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// TestResponsesMatchTheDocument records the payloads the handlers write
+// for stored data, and checks each against the schema the API document
+// publishes for its path and status
+func TestResponsesMatchTheDocument(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	server := NewServer(store, nil, middleware.NewAuthMiddleware(auth.NewJWTManager("test", testSecret, nil)), nil, false, 100)
+	doc, router := server.document(), server.Router()
+	token := signedToken(t, "admin", "pii")
+
+	at := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	txn := &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             "txn-1",
+			IdempotencyKey: "key-txn-1",
+			AccountID:      "acct-1",
+			UserID:         "user-1",
+			Amount:         42.5,
+			Currency:       "USD",
+			Type:           "purchase",
+			Merchant:       "Corner Shop",
+			Status:         "flagged",
+			Timestamp:      at,
+			Metadata:       map[string]string{"channel": "web"},
+		},
+		RiskScore:         0.72,
+		RiskLevel:         "high",
+		ShadowRiskFactors: []shared.RiskFactor{{Factor: "night", Weight: 0.1, Description: "Transaction at night"}},
+		IsValid:           true,
+		ProcessedAt:       at,
+		ProcessorID:       "processing-service",
+	}}
+	if err := store.StoreTransaction(ctx, txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	// call sends body, when not nil, to path as an admin and checks the
+	// response has status and matches the document for route
+	call := func(method, path, route string, body interface{}, status int) *httptest.ResponseRecorder {
+		t.Helper()
+		var data []byte
+		if body != nil {
+			var err error
+			if data, err = json.Marshal(body); err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+		}
+		r := httptest.NewRequest(method, path, bytes.NewReader(data))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("%s %s = %d, want %d: %s", method, path, w.Code, status, w.Body)
+			return w
+		}
+		if err := doc.ValidateResponse(method, route, strconv.Itoa(w.Code), w.Body.Bytes()); err != nil {
+			t.Errorf("%s %s does not match the document: %v\n%s", method, path, err, w.Body)
+		}
+		return w
+	}
+
+	call("POST", "/api/v1/accounts", "/api/v1/accounts",
+		accountRequest{ID: "acct-1", UserID: "user-1", AccountType: "checking", Currency: "USD"}, http.StatusCreated)
+	call("GET", "/api/v1/accounts?user_id=user-1", "/api/v1/accounts", nil, http.StatusOK)
+	call("GET", "/api/v1/accounts/acct-1", "/api/v1/accounts/{id}", nil, http.StatusOK)
+	call("PATCH", "/api/v1/accounts/acct-1", "/api/v1/accounts/{id}", accountStatusRequest{Status: "frozen"}, http.StatusOK)
+	call("GET", "/api/v1/accounts/acct-1/risk", "/api/v1/accounts/{id}/risk", nil, http.StatusOK)
+	call("GET", "/api/v1/accounts/acct-1/context", "/api/v1/accounts/{id}/context", nil, http.StatusOK)
+
+	call("GET", "/api/v1/transactions/search?account_id=acct-1", "/api/v1/transactions/search", nil, http.StatusOK)
+	call("GET", "/api/v1/transactions/txn-1", "/api/v1/transactions/{id}", nil, http.StatusOK)
+	call("GET", "/api/v1/transactions/txn-1/audit", "/api/v1/transactions/{id}/audit", nil, http.StatusOK)
+	call("GET", "/api/v1/transactions/txn-1/callbacks", "/api/v1/transactions/{id}/callbacks", nil, http.StatusOK)
+	call("GET", "/api/v1/stats/accounts/acct-1/daily-volume", "/api/v1/stats/accounts/{account_id}/daily-volume", nil, http.StatusOK)
+
+	w := call("POST", "/api/v1/blocklist", "/api/v1/blocklist",
+		blocklistRequest{Type: models.BlocklistTypeMerchant, Value: "Shady Shop", Reason: "fraud ring"}, http.StatusCreated)
+	var entry models.BlocklistEntry
+	if err := json.NewDecoder(w.Body).Decode(&entry); err != nil {
+		t.Fatalf("failed to decode blocklist entry: %v", err)
+	}
+	entryPath := "/api/v1/blocklist/" + strconv.FormatInt(entry.ID, 10)
+	call("GET", "/api/v1/blocklist", "/api/v1/blocklist", nil, http.StatusOK)
+	call("GET", entryPath, "/api/v1/blocklist/{id}", nil, http.StatusOK)
+	call("PUT", entryPath, "/api/v1/blocklist/{id}",
+		blocklistRequest{Type: models.BlocklistTypeMerchant, Value: "Shady Shop", Reason: "chargebacks"}, http.StatusOK)
+
+	call("POST", "/api/v1/admin/verify-integrity?account_id=acct-1", "/api/v1/admin/verify-integrity", nil, http.StatusOK)
+	call("GET", "/api/v1/admin/users/user-1/export", "/api/v1/admin/users/{user_id}/export", nil, http.StatusOK)
+	call("POST", "/api/v1/admin/users/user-1/erase", "/api/v1/admin/users/{user_id}/erase", nil, http.StatusOK)
+}
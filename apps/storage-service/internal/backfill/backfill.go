@@ -0,0 +1,290 @@
+// Package backfill imports historical transactions exported from a legacy
+// system, as CSV or NDJSON files, into the transactions table. Records are
+// streamed, mapped onto transactions and stored in batches through the
+// insert of the live consumer, skipping those already stored. A checkpoint
+// file records the progress after every batch, so an interrupted import
+// resumes where it stopped.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+)
+
+// progressInterval is how often the progress of an import is logged
+const progressInterval = 10 * time.Second
+
+// Options configures an import
+type Options struct {
+	// Path is an export file, or a directory whose export files are
+	// imported in name order
+	Path string
+	// Format is FormatCSV or FormatNDJSON, or empty to tell by the
+	// extension of each file
+	Format    string
+	BatchSize int
+	Mapping   *Mapping
+	// Checkpoint is the checkpoint file, created when missing
+	Checkpoint string
+}
+
+// Stats counts the records of an import
+type Stats struct {
+	Read     int64 `json:"read"`
+	Inserted int64 `json:"inserted"`
+	// Skipped were already stored, by ID or idempotency key
+	Skipped int64 `json:"skipped"`
+	// Failed could not be read or mapped, and were logged with their line
+	Failed int64 `json:"failed"`
+}
+
+// Checkpoint is the progress of an import: the files imported in full and
+// the last line of the current file whose records are stored
+type Checkpoint struct {
+	Completed []string  `json:"completed"`
+	File      string    `json:"file,omitempty"`
+	Line      int       `json:"line,omitempty"`
+	Stats     Stats     `json:"stats"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Importer imports legacy exports
+type Importer struct {
+	store *storage.Storage
+	opts  Options
+
+	checkpoint Checkpoint
+	start      time.Time
+	lastLog    time.Time
+}
+
+// NewImporter creates an importer storing into store
+func NewImporter(store *storage.Storage, opts Options) *Importer {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 500
+	}
+	return &Importer{store: store, opts: opts}
+}
+
+// Run imports every file not yet completed by the checkpoint and returns
+// the counts of the import so far, this run and the runs it resumes. It
+// stops at the first storage error or when ctx is done, the checkpoint
+// left at the last stored batch.
+func (i *Importer) Run(ctx context.Context) (Stats, error) {
+	files, err := exportFiles(i.opts.Path)
+	if err != nil {
+		return Stats{}, err
+	}
+	if err := i.loadCheckpoint(); err != nil {
+		return Stats{}, err
+	}
+	if i.checkpoint.File != "" {
+		log.Printf("Resuming backfill at %s line %d", i.checkpoint.File, i.checkpoint.Line+1)
+	}
+
+	i.start = time.Now()
+	i.lastLog = i.start
+	for _, file := range files {
+		if slices.Contains(i.checkpoint.Completed, file) {
+			continue
+		}
+		if err := i.importFile(ctx, file); err != nil {
+			return i.checkpoint.Stats, err
+		}
+	}
+	return i.checkpoint.Stats, nil
+}
+
+// importFile imports one file, from after the checkpoint line when it is
+// the checkpoint file
+func (i *Importer) importFile(ctx context.Context, file string) error {
+	format := i.opts.Format
+	if format == "" {
+		format = formatOf(file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	records, err := newRecordReader(f, format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	resumeAfter := 0
+	if i.checkpoint.File == file {
+		resumeAfter = i.checkpoint.Line
+	}
+	log.Printf("Backfilling %s as %s", file, format)
+
+	var batch []*models.StoredTransaction
+	lastLine := resumeAfter
+	stats := Stats{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, line, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, errMalformed) {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if line <= resumeAfter {
+			continue
+		}
+		lastLine = line
+		stats.Read++
+
+		if err == nil {
+			var txn *models.StoredTransaction
+			if txn, err = i.opts.Mapping.Transaction(record, time.Now().UTC()); err == nil {
+				batch = append(batch, txn)
+			}
+		}
+		if err != nil {
+			stats.Failed++
+			log.Printf("%s:%d: %v", file, line, err)
+		}
+
+		if len(batch) >= i.opts.BatchSize {
+			if err := i.flush(ctx, file, lastLine, batch, &stats); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := i.flush(ctx, file, lastLine, batch, &stats); err != nil {
+		return err
+	}
+	i.checkpoint.Completed = append(i.checkpoint.Completed, file)
+	i.checkpoint.File, i.checkpoint.Line = "", 0
+	if err := i.saveCheckpoint(); err != nil {
+		return err
+	}
+	log.Printf("Backfilled %s", file)
+	return nil
+}
+
+// flush stores a batch and moves the checkpoint to line, with the records
+// read since the last flush counted in stats
+func (i *Importer) flush(ctx context.Context, file string, line int, batch []*models.StoredTransaction, stats *Stats) error {
+	inserted, err := i.store.StoreBackfill(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("failed to store the batch ending at %s line %d: %w", file, line, err)
+	}
+
+	total := &i.checkpoint.Stats
+	total.Read += stats.Read
+	total.Failed += stats.Failed
+	total.Inserted += int64(inserted)
+	total.Skipped += int64(len(batch) - inserted)
+	*stats = Stats{}
+
+	i.checkpoint.File, i.checkpoint.Line = file, line
+	if err := i.saveCheckpoint(); err != nil {
+		return err
+	}
+
+	if time.Since(i.lastLog) >= progressInterval {
+		i.lastLog = time.Now()
+		elapsed := time.Since(i.start).Seconds()
+		log.Printf("Backfill progress: %s line %d, %d read (%.0f rows/s), %d inserted, %d skipped, %d failed",
+			file, line, total.Read, float64(total.Read)/elapsed, total.Inserted, total.Skipped, total.Failed)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint file, when it exists
+func (i *Importer) loadCheckpoint() error {
+	data, err := os.ReadFile(i.opts.Checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &i.checkpoint); err != nil {
+		return fmt.Errorf("failed to parse checkpoint %s: %w", i.opts.Checkpoint, err)
+	}
+	return nil
+}
+
+// saveCheckpoint replaces the checkpoint file, through a rename so an
+// interruption never leaves it half written
+func (i *Importer) saveCheckpoint() error {
+	i.checkpoint.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(i.checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tmp := i.opts.Checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, i.opts.Checkpoint); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// exportFiles returns path when it is a file, or the export files in it in
+// name order when it is a directory, as absolute paths so a checkpoint
+// names them however the import is started
+func exportFiles(path string) ([]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && formatOf(entry.Name()) != "" {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .csv, .ndjson or .jsonl files in %s", path)
+	}
+	return files, nil
+}
+
+// formatOf returns the format of a file by its extension, or ""
+func formatOf(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return FormatCSV
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,260 @@
+//go:build integration
+
+package backfill
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+	"storage-service/internal/testdb"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// The import tests run against Postgres in a container:
+//
+//	go test -tags=integration ./internal/backfill/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends, and a connection to the database
+func newTestStorage(t *testing.T) (*storage.Storage, *sql.DB) {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(storage.Options{DBUrl: dbURL})
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return s, db
+}
+
+// captureLog returns the standard logger's output until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// readCheckpoint reads the checkpoint file at path
+func readCheckpoint(t *testing.T, path string) Checkpoint {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read checkpoint: %v", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatalf("failed to parse checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
+// storedIDs returns the IDs of the stored transactions, in order
+func storedIDs(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT id FROM transactions ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to list transactions: %v", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan transaction: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestBackfillCSV(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestStorage(t)
+	logs := captureLog(t)
+
+	// The live consumer already stored L-7, under another ID
+	live := &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             "live-7",
+			IdempotencyKey: "L-7",
+			AccountID:      "acct-3",
+			Amount:         250,
+			Currency:       "EUR",
+			Type:           "refund",
+			Status:         "approved",
+			Timestamp:      time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC),
+		},
+		RiskLevel:   "low",
+		IsApproved:  true,
+		IsValid:     true,
+		ProcessedAt: time.Now(),
+	}}
+	if err := s.StoreTransaction(ctx, live); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	opts := Options{
+		Path:       filepath.Join("testdata", "legacy.csv"),
+		BatchSize:  2,
+		Mapping:    legacyMapping(),
+		Checkpoint: checkpoint,
+	}
+	stats, err := NewImporter(s, opts).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// L-7 conflicts with the live transaction by idempotency key, and the
+	// second L-1 with the first by ID
+	if want := (Stats{Read: 8, Inserted: 2, Skipped: 2, Failed: 4}); stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	if got := storedIDs(t, db); strings.Join(got, ",") != "L-1,L-2,live-7" {
+		t.Errorf("stored %v, want L-1, L-2 and the live transaction", got)
+	}
+	for _, want := range []string{
+		`legacy.csv:4: amount "abc" is not a number`,
+		"legacy.csv:5: malformed record: wrong number of fields",
+		"legacy.csv:6: malformed record",
+		`legacy.csv:7: currency "XYZ" is not an ISO 4217 code`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+
+	// Risk fields absent from the legacy data are NULL, not made up
+	var unassessed, assessed sql.NullFloat64
+	var level sql.NullString
+	if err := db.QueryRow(`SELECT risk_score, risk_level FROM transactions WHERE id = 'L-1'`).Scan(&unassessed, &level); err != nil {
+		t.Fatalf("failed to read L-1: %v", err)
+	}
+	if unassessed.Valid || level.Valid {
+		t.Errorf("L-1 risk score %v and level %v, want NULL", unassessed, level)
+	}
+	if err := db.QueryRow(`SELECT risk_score FROM transactions WHERE id = 'L-2'`).Scan(&assessed); err != nil {
+		t.Fatalf("failed to read L-2: %v", err)
+	}
+	if !assessed.Valid || assessed.Float64 != 0.12 {
+		t.Errorf("L-2 risk score %v, want the legacy 0.12", assessed)
+	}
+
+	// The completed file is not imported again
+	abs, _ := filepath.Abs(opts.Path)
+	if got := readCheckpoint(t, checkpoint); len(got.Completed) != 1 || got.Completed[0] != abs || got.File != "" {
+		t.Errorf("checkpoint %+v, want %s completed", got, abs)
+	}
+	again, err := NewImporter(s, opts).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run again: %v", err)
+	}
+	if again != stats {
+		t.Errorf("stats %+v after running again, want the completed import's %+v", again, stats)
+	}
+}
+
+// ndjsonLine returns an NDJSON record of a valid transaction
+func ndjsonLine(id string, amount string) string {
+	return fmt.Sprintf(`{"id": %q, "account_id": "acct-1", "amount": %s, "currency": "USD", "type": "purchase", "status": "approved", "timestamp": "2024-01-05T09:30:00Z"}`,
+		id, amount) + "\n"
+}
+
+func TestBackfillResumesAfterInterrupt(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestStorage(t)
+	captureLog(t)
+
+	dir := t.TempDir()
+	write := func(name string, lines ...string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2024-01.ndjson", ndjsonLine("A-1", "10"), ndjsonLine("A-2", "20"))
+	// The amount of B-4 overflows its column, so the batch of B-3 and B-4
+	// fails to store and the import stops
+	write("2024-02.ndjson", ndjsonLine("B-1", "10"), ndjsonLine("B-2", "20"), ndjsonLine("B-3", "30"),
+		ndjsonLine("B-4", "1e16"), ndjsonLine("B-5", "50"), ndjsonLine("B-6", "60"))
+	write("README.txt", "not an export\n")
+
+	opts := Options{
+		Path:       dir,
+		BatchSize:  2,
+		Mapping:    &Mapping{},
+		Checkpoint: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}
+	stats, err := NewImporter(s, opts).Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "2024-02.ndjson line 4") {
+		t.Fatalf("Run() = %v, want the failed batch reported", err)
+	}
+	if want := (Stats{Read: 4, Inserted: 4}); stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	checkpoint := readCheckpoint(t, opts.Checkpoint)
+	if len(checkpoint.Completed) != 1 || filepath.Base(checkpoint.Completed[0]) != "2024-01.ndjson" ||
+		filepath.Base(checkpoint.File) != "2024-02.ndjson" || checkpoint.Line != 2 {
+		t.Errorf("checkpoint %+v, want the first file completed and the second at line 2", checkpoint)
+	}
+
+	// Fixed, the import resumes after line 2 of the second file
+	write("2024-02.ndjson", ndjsonLine("B-1", "10"), ndjsonLine("B-2", "20"), ndjsonLine("B-3", "30"),
+		ndjsonLine("B-4", "40"), ndjsonLine("B-5", "50"), ndjsonLine("B-6", "60"))
+	stats, err = NewImporter(s, opts).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := (Stats{Read: 8, Inserted: 8}); stats != want {
+		t.Errorf("stats %+v, want %+v with no line read twice", stats, want)
+	}
+	want := "A-1,A-2,B-1,B-2,B-3,B-4,B-5,B-6"
+	if got := storedIDs(t, db); strings.Join(got, ",") != want {
+		t.Errorf("stored %v, want %s", got, want)
+	}
+	if checkpoint := readCheckpoint(t, opts.Checkpoint); len(checkpoint.Completed) != 2 || checkpoint.File != "" {
+		t.Errorf("checkpoint %+v, want both files completed", checkpoint)
+	}
+}
+
+func TestBackfillStopsWhenCancelled(t *testing.T) {
+	s, db := newTestStorage(t)
+	captureLog(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := Options{
+		Path:       filepath.Join("testdata", "legacy.ndjson"),
+		Mapping:    &Mapping{},
+		Checkpoint: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}
+	if _, err := NewImporter(s, opts).Run(ctx); err != context.Canceled {
+		t.Fatalf("Run() = %v, want it cancelled", err)
+	}
+	if got := storedIDs(t, db); len(got) != 0 {
+		t.Errorf("stored %v, want nothing", got)
+	}
+}
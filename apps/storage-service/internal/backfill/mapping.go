@@ -0,0 +1,194 @@
+package backfill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+)
+
+// Fields of a transaction a legacy record may fill
+const (
+	FieldID                  = "id"
+	FieldIdempotencyKey      = "idempotency_key"
+	FieldAccountID           = "account_id"
+	FieldUserID              = "user_id"
+	FieldAmount              = "amount"
+	FieldCurrency            = "currency"
+	FieldType                = "type"
+	FieldCategory            = "category"
+	FieldMerchant            = "merchant"
+	FieldReference           = "reference"
+	FieldStatus              = "status"
+	FieldTimestamp           = "timestamp"
+	FieldMetadata            = "metadata"
+	FieldTenantID            = "tenant_id"
+	FieldCountry             = "country"
+	FieldParentTransactionID = "parent_transaction_id"
+	FieldRiskScore           = "risk_score"
+	FieldRiskLevel           = "risk_level"
+)
+
+// fields are the fields a mapping may name
+var fields = []string{
+	FieldID, FieldIdempotencyKey, FieldAccountID, FieldUserID, FieldAmount,
+	FieldCurrency, FieldType, FieldCategory, FieldMerchant, FieldReference,
+	FieldStatus, FieldTimestamp, FieldMetadata, FieldTenantID, FieldCountry,
+	FieldParentTransactionID, FieldRiskScore, FieldRiskLevel,
+}
+
+// required are the fields every record must fill, itself or by default
+var required = []string{
+	FieldID, FieldAccountID, FieldAmount, FieldCurrency, FieldType, FieldStatus, FieldTimestamp,
+}
+
+// ProcessorID is the processor ID of backfilled transactions
+const ProcessorID = "backfill"
+
+// Mapping maps the columns of legacy records onto transaction fields
+type Mapping struct {
+	// Fields maps a transaction field to the legacy column, or NDJSON key,
+	// holding it. A field not mapped is read from the column of its name.
+	Fields map[string]string `json:"fields"`
+	// Defaults fills the fields a record leaves empty
+	Defaults map[string]string `json:"defaults"`
+	// TimestampFormat is the Go layout of the timestamps, RFC 3339 when
+	// empty. Timestamps without a zone are taken as UTC.
+	TimestampFormat string `json:"timestamp_format"`
+}
+
+// LoadMapping reads a JSON mapping file. Without a path every field is read
+// from the column of its name.
+func LoadMapping(path string) (*Mapping, error) {
+	m := &Mapping{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mapping file: %w", err)
+		}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("failed to parse mapping file: %w", err)
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks the mapping names only known fields
+func (m *Mapping) Validate() error {
+	var problems []error
+	for field, column := range m.Fields {
+		if !slices.Contains(fields, field) {
+			problems = append(problems, fmt.Errorf("unknown field %q", field))
+		}
+		if column == "" {
+			problems = append(problems, fmt.Errorf("field %q is mapped to no column", field))
+		}
+	}
+	for field := range m.Defaults {
+		if !slices.Contains(fields, field) {
+			problems = append(problems, fmt.Errorf("unknown default field %q", field))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// value returns the value of field in record, or its default
+func (m *Mapping) value(record map[string]string, field string) string {
+	column := field
+	if mapped, ok := m.Fields[field]; ok {
+		column = mapped
+	}
+	if value := strings.TrimSpace(record[column]); value != "" {
+		return value
+	}
+	return m.Defaults[field]
+}
+
+// Transaction maps a legacy record onto a transaction imported at
+// importedAt. Without a risk score the transaction is unassessed, and its
+// risk fields are stored as NULL rather than made up.
+func (m *Mapping) Transaction(record map[string]string, importedAt time.Time) (*models.StoredTransaction, error) {
+	var missing []string
+	for _, field := range required {
+		if m.value(record, field) == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	txn := &models.StoredTransaction{}
+	txn.ID = m.value(record, FieldID)
+	txn.IdempotencyKey = m.value(record, FieldIdempotencyKey)
+	if txn.IdempotencyKey == "" {
+		txn.IdempotencyKey = txn.ID
+	}
+	txn.AccountID = m.value(record, FieldAccountID)
+	txn.UserID = m.value(record, FieldUserID)
+	txn.Type = m.value(record, FieldType)
+	txn.Category = m.value(record, FieldCategory)
+	txn.Merchant = m.value(record, FieldMerchant)
+	txn.Reference = m.value(record, FieldReference)
+	txn.Status = m.value(record, FieldStatus)
+	txn.TenantID = m.value(record, FieldTenantID)
+	txn.Country = m.value(record, FieldCountry)
+	txn.ParentTransactionID = m.value(record, FieldParentTransactionID)
+
+	amount, err := strconv.ParseFloat(m.value(record, FieldAmount), 64)
+	if err != nil || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return nil, fmt.Errorf("amount %q is not a number", m.value(record, FieldAmount))
+	}
+	txn.Amount = amount
+
+	txn.Currency = strings.ToUpper(m.value(record, FieldCurrency))
+	c, ok := currency.Lookup(txn.Currency)
+	if !ok {
+		return nil, fmt.Errorf("currency %q is not an ISO 4217 code", txn.Currency)
+	}
+	txn.CurrencyExponent = c.Exponent
+
+	layout := m.TimestampFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	timestamp, err := time.Parse(layout, m.value(record, FieldTimestamp))
+	if err != nil {
+		return nil, fmt.Errorf("timestamp %q does not match %q", m.value(record, FieldTimestamp), layout)
+	}
+	txn.Timestamp = timestamp.UTC()
+
+	if metadata := m.value(record, FieldMetadata); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &txn.Metadata); err != nil {
+			return nil, fmt.Errorf("metadata is not a JSON object of strings: %w", err)
+		}
+	}
+
+	if score := m.value(record, FieldRiskScore); score != "" {
+		txn.RiskScore, err = strconv.ParseFloat(score, 64)
+		if err != nil || txn.RiskScore < 0 || txn.RiskScore > 1 {
+			return nil, fmt.Errorf("risk score %q is not a number from 0 to 1", score)
+		}
+		txn.RiskLevel = m.value(record, FieldRiskLevel)
+		txn.IsApproved = txn.Status == models.StatusApproved
+	} else {
+		txn.Unassessed = true
+	}
+
+	txn.IsValid = true
+	txn.ProcessedAt = importedAt
+	txn.ProcessorID = ProcessorID
+	return txn, nil
+}
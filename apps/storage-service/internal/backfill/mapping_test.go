@@ -0,0 +1,157 @@
+package backfill
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyMapping maps the columns of the legacy exports in testdata
+func legacyMapping() *Mapping {
+	return &Mapping{
+		Fields: map[string]string{
+			FieldID:        "txn_ref",
+			FieldAccountID: "acct",
+			FieldAmount:    "amt",
+			FieldCurrency:  "ccy",
+			FieldType:      "kind",
+			FieldStatus:    "state",
+			FieldTimestamp: "booked_at",
+			FieldMerchant:  "shop",
+			FieldRiskScore: "score",
+		},
+		Defaults:        map[string]string{FieldCategory: "legacy"},
+		TimestampFormat: "2006-01-02 15:04:05",
+	}
+}
+
+// legacyRecord returns a legacy record every field of which maps
+func legacyRecord() map[string]string {
+	return map[string]string{
+		"txn_ref":   "L-1",
+		"acct":      "acct-1",
+		"amt":       "42.50",
+		"ccy":       "usd",
+		"kind":      "purchase",
+		"state":     "approved",
+		"booked_at": "2024-01-05 09:30:00",
+		"shop":      "Corner Shop",
+		"score":     "",
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	importedAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	txn, err := legacyMapping().Transaction(legacyRecord(), importedAt)
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+
+	if txn.ID != "L-1" || txn.IdempotencyKey != "L-1" || txn.AccountID != "acct-1" || txn.Merchant != "Corner Shop" {
+		t.Errorf("ID %s, key %s, account %s, merchant %s, want the mapped columns",
+			txn.ID, txn.IdempotencyKey, txn.AccountID, txn.Merchant)
+	}
+	if txn.Amount != 42.5 || txn.Currency != "USD" || txn.CurrencyExponent != 2 {
+		t.Errorf("amount %v %s with exponent %d, want 42.5 USD with 2", txn.Amount, txn.Currency, txn.CurrencyExponent)
+	}
+	if want := time.Date(2024, 1, 5, 9, 30, 0, 0, time.UTC); !txn.Timestamp.Equal(want) {
+		t.Errorf("timestamp %s, want %s", txn.Timestamp, want)
+	}
+	if txn.Category != "legacy" {
+		t.Errorf("category %q, want the default", txn.Category)
+	}
+	if !txn.ProcessedAt.Equal(importedAt) || txn.ProcessorID != ProcessorID || !txn.IsValid {
+		t.Errorf("processed at %s by %s, valid %v, want imported at %s by %s", txn.ProcessedAt, txn.ProcessorID, txn.IsValid, importedAt, ProcessorID)
+	}
+	// Legacy data without a score was never assessed
+	if !txn.Unassessed || txn.RiskScore != 0 || txn.RiskLevel != "" || txn.IsApproved {
+		t.Errorf("unassessed %v with score %v, level %q, approved %v, want no risk fields made up",
+			txn.Unassessed, txn.RiskScore, txn.RiskLevel, txn.IsApproved)
+	}
+}
+
+func TestTransactionWithRiskFields(t *testing.T) {
+	mapping := &Mapping{}
+	record := map[string]string{
+		FieldID:             "L-2",
+		FieldIdempotencyKey: "legacy-key-2",
+		FieldAccountID:      "acct-1",
+		FieldAmount:         "1500",
+		FieldCurrency:       "JPY",
+		FieldType:           "purchase",
+		FieldStatus:         "approved",
+		FieldTimestamp:      "2024-01-06T10:00:00+09:00",
+		FieldMetadata:       `{"channel":"branch"}`,
+		FieldRiskScore:      "0.12",
+		FieldRiskLevel:      "low",
+	}
+	txn, err := mapping.Transaction(record, time.Now())
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+	if txn.Unassessed || txn.RiskScore != 0.12 || txn.RiskLevel != "low" || !txn.IsApproved {
+		t.Errorf("unassessed %v with score %v, level %q, approved %v, want the legacy assessment",
+			txn.Unassessed, txn.RiskScore, txn.RiskLevel, txn.IsApproved)
+	}
+	if txn.IdempotencyKey != "legacy-key-2" || txn.CurrencyExponent != 0 || txn.Metadata["channel"] != "branch" {
+		t.Errorf("key %s, exponent %d, metadata %v", txn.IdempotencyKey, txn.CurrencyExponent, txn.Metadata)
+	}
+	if want := time.Date(2024, 1, 6, 1, 0, 0, 0, time.UTC); !txn.Timestamp.Equal(want) || txn.Timestamp.Location() != time.UTC {
+		t.Errorf("timestamp %s, want %s", txn.Timestamp, want)
+	}
+}
+
+func TestTransactionRejectsBadRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		column  string
+		value   string
+		wantErr string
+	}{
+		{"missing fields", "acct", "", "missing account_id"},
+		{"amount not a number", "amt", "abc", `amount "abc" is not a number`},
+		{"infinite amount", "amt", "Inf", `amount "Inf" is not a number`},
+		{"unknown currency", "ccy", "XYZ", `currency "XYZ" is not an ISO 4217 code`},
+		{"timestamp of another layout", "booked_at", "05/01/2024", `timestamp "05/01/2024" does not match "2006-01-02 15:04:05"`},
+		{"risk score out of range", "score", "7", `risk score "7" is not a number from 0 to 1`},
+		{"metadata not an object", "metadata", `["gift"]`, "metadata is not a JSON object of strings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := legacyRecord()
+			record[tt.column] = tt.value
+			_, err := legacyMapping().Transaction(record, time.Now())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Transaction() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	m, err := LoadMapping(filepath.Join("testdata", "mapping.json"))
+	if err != nil {
+		t.Fatalf("LoadMapping: %v", err)
+	}
+	if m.Fields[FieldID] != "txn_ref" || m.Defaults[FieldCategory] != "legacy" || m.TimestampFormat != "2006-01-02 15:04:05" {
+		t.Errorf("mapping %+v, want the testdata mapping", m)
+	}
+
+	if m, err := LoadMapping(""); err != nil || len(m.Fields) != 0 {
+		t.Errorf("LoadMapping(\"\") = %+v, %v, want the identity mapping", m, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"fields": {"iban": "acct_iban", "amount": ""}, "defaults": {"fee": "0"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadMapping(path)
+	for _, want := range []string{`unknown field "iban"`, `field "amount" is mapped to no column`, `unknown default field "fee"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadMapping() = %v, want it to report %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package backfill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Formats of legacy exports
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// errMalformed wraps the errors of a record that cannot be read, which is
+// skipped rather than ending its file
+var errMalformed = errors.New("malformed record")
+
+// recordReader reads the records of a legacy export one at a time. Next
+// returns the record and the line it starts on, and io.EOF at the end.
+type recordReader interface {
+	Next() (map[string]string, int, error)
+}
+
+// newRecordReader returns the reader of r in format
+func newRecordReader(r io.Reader, format string) (recordReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		return &ndjsonReader{r: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, want %s or %s", format, FormatCSV, FormatNDJSON)
+	}
+}
+
+// csvReader reads CSV with a header row naming the columns
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	// Every record must have as many fields as the header
+	cr.FieldsPerRecord = len(header)
+	return &csvReader{r: cr, header: header}, nil
+}
+
+func (c *csvReader) Next() (map[string]string, int, error) {
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.StartLine, fmt.Errorf("%w: %v", errMalformed, parseErr.Err)
+		}
+		return nil, 0, err
+	}
+	line, _ := c.r.FieldPos(0)
+	record := make(map[string]string, len(fields))
+	for i, column := range c.header {
+		record[column] = fields[i]
+	}
+	return record, line, nil
+}
+
+// ndjsonReader reads one JSON object per line, skipping blank lines. Values
+// are read as their text, and objects and arrays as JSON.
+type ndjsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (n *ndjsonReader) Next() (map[string]string, int, error) {
+	for {
+		data, err := n.r.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return nil, 0, err
+		}
+		n.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var object map[string]any
+		if err := decoder.Decode(&object); err != nil {
+			return nil, n.line, fmt.Errorf("%w: %v", errMalformed, err)
+		}
+		if object == nil {
+			return nil, n.line, fmt.Errorf("%w: not a JSON object", errMalformed)
+		}
+		record := make(map[string]string, len(object))
+		for key, value := range object {
+			record[key] = text(value)
+		}
+		return record, n.line, nil
+	}
+}
+
+// text returns a decoded JSON value as text
+func text(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
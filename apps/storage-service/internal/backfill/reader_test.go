@@ -0,0 +1,86 @@
+package backfill
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// read returns the records of the testdata file name by line, and the
+// lines of the malformed ones
+func read(t *testing.T, name, format string) (map[int]map[string]string, []int) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := newRecordReader(f, format)
+	if err != nil {
+		t.Fatalf("newRecordReader: %v", err)
+	}
+
+	byLine := map[int]map[string]string{}
+	var malformed []int
+	for {
+		record, line, err := records.Next()
+		if err == io.EOF {
+			return byLine, malformed
+		}
+		switch {
+		case errors.Is(err, errMalformed):
+			malformed = append(malformed, line)
+		case err != nil:
+			t.Fatalf("Next: %v", err)
+		default:
+			byLine[line] = record
+		}
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	records, malformed := read(t, "legacy.csv", FormatCSV)
+
+	// Line 5 has too few fields and line 6 a stray quote; reading goes on
+	// past both
+	if len(malformed) != 2 || malformed[0] != 5 || malformed[1] != 6 {
+		t.Errorf("malformed lines %v, want [5 6]", malformed)
+	}
+	for _, line := range []int{2, 3, 4, 7, 8, 9} {
+		if records[line] == nil {
+			t.Errorf("no record read on line %d", line)
+		}
+	}
+	if got := records[3]; got["txn_ref"] != "L-2" || got["score"] != "0.12" || got["shop"] != "Streamflix" {
+		t.Errorf("line 3 = %v, want the L-2 columns by header", got)
+	}
+}
+
+func TestNDJSONReader(t *testing.T) {
+	records, malformed := read(t, "legacy.ndjson", FormatNDJSON)
+
+	// Line 2 is blank, line 4 is cut short and line 5 is no object
+	if len(malformed) != 2 || malformed[0] != 4 || malformed[1] != 5 {
+		t.Errorf("malformed lines %v, want [4 5]", malformed)
+	}
+	if len(records) != 4 || records[2] != nil {
+		t.Errorf("records on lines %v, want 1, 3, 6 and 7", records)
+	}
+	got := records[1]
+	if got["amount"] != "42.5" || got["metadata"] != `{"channel":"branch"}` || got["id"] != "N-1" {
+		t.Errorf("line 1 = %v, want numbers and objects as their text", got)
+	}
+	if got := records[3]; got["risk_score"] != "0.7" {
+		t.Errorf("line 3 risk score %q, want 0.7", got["risk_score"])
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := newRecordReader(strings.NewReader(""), "xlsx")
+	if err == nil || !strings.Contains(err.Error(), `unknown format "xlsx"`) {
+		t.Errorf("newRecordReader() = %v, want the format refused", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package callback delivers the outcome of decided transactions to the
+// callback URLs they were submitted with. Each delivery is a POST of a
+// models.CallbackPayload signed with HMAC-SHA256, retried with exponential
+// backoff and dead-lettered once its attempts run out.
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+)
+
+// Headers of a callback request. The signature is "sha256=" and the hex
+// HMAC-SHA256, keyed with the signing secret, of the timestamp, a dot and
+// the body, so receivers can refuse replays of old deliveries.
+const (
+	SignatureHeader = "X-Callback-Signature"
+	TimestampHeader = "X-Callback-Timestamp"
+	IDHeader        = "X-Callback-ID"
+)
+
+// pendingInterval is how often the number of pending callbacks is updated
+const pendingInterval = 30 * time.Second
+
+// Sign returns the signature of a callback body sent at timestamp, in Unix
+// seconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is that of a callback body sent at
+// timestamp, for receivers
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Config configures a Deliverer
+type Config struct {
+	// Secret signs every callback
+	Secret string
+
+	// Interval is how often due callbacks are claimed, BatchSize at a time
+	Interval  time.Duration
+	BatchSize int
+
+	// Timeout bounds each attempt
+	Timeout time.Duration
+
+	// MaxAttempts attempts are made before a callback is dead-lettered,
+	// the nth retry waiting Backoff doubled n-1 times, at most MaxBackoff
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Deliverer posts pending callbacks to their URLs
+type Deliverer struct {
+	store  *storage.Storage
+	cfg    Config
+	client *http.Client
+}
+
+// NewDeliverer creates a deliverer. Redirects are not followed, so a
+// callback reaches only the host it was allowlisted for.
+func NewDeliverer(store *storage.Storage, cfg Config) *Deliverer {
+	return &Deliverer{
+		store: store,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run delivers due callbacks until ctx is cancelled
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	var lastPending time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.drain(ctx)
+
+		if time.Since(lastPending) >= pendingInterval {
+			if pending, err := d.store.CallbacksPending(ctx); err == nil {
+				metrics.SetCallbacksPending(pending)
+			}
+			lastPending = time.Now()
+		}
+	}
+}
+
+// drain delivers batches of due callbacks until none is left or an error
+// occurs. The callbacks of a batch are delivered concurrently, leased for
+// long enough for every attempt to finish and be recorded.
+func (d *Deliverer) drain(ctx context.Context) {
+	lease := 2*d.cfg.Timeout + d.cfg.Interval
+	for {
+		callbacks, err := d.store.ClaimCallbacks(ctx, d.cfg.BatchSize, lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("callback claim error: %v", err)
+			}
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, cb := range callbacks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, cb)
+			}()
+		}
+		wg.Wait()
+
+		if len(callbacks) < d.cfg.BatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at a callback and records its outcome
+func (d *Deliverer) deliver(ctx context.Context, cb *models.Callback) {
+	start := time.Now()
+	statusCode, err := d.post(ctx, cb)
+	duration := time.Since(start)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down: the lease runs out and the attempt is made again
+		return
+	}
+
+	cb.Attempts++
+	attempt := models.CallbackAttempt{
+		Attempt:     cb.Attempts,
+		StatusCode:  statusCode,
+		Duration:    duration.Milliseconds(),
+		AttemptedAt: start,
+	}
+
+	result := metrics.CallbackDelivered
+	switch {
+	case err == nil:
+		cb.Status = models.CallbackStatusDelivered
+		cb.NextAttemptAt = nil
+		cb.LastError = ""
+		cb.DeliveredAt = &start
+	case permanent(statusCode) || cb.Attempts >= d.cfg.MaxAttempts:
+		result = metrics.CallbackDead
+		attempt.Error = err.Error()
+		cb.Status = models.CallbackStatusDead
+		cb.NextAttemptAt = nil
+		cb.LastError = err.Error()
+		log.Printf("Callback %d of transaction %s dead-lettered after %d attempts: %v",
+			cb.ID, cb.TransactionID, cb.Attempts, err)
+	default:
+		result = metrics.CallbackRetry
+		attempt.Error = err.Error()
+		next := time.Now().Add(d.backoff(cb.Attempts))
+		cb.NextAttemptAt = &next
+		cb.LastError = err.Error()
+	}
+	metrics.RecordCallbackAttempt(result, duration)
+
+	if err := d.store.RecordCallbackAttempt(context.WithoutCancel(ctx), cb, attempt); err != nil {
+		log.Printf("failed to record attempt %d of callback %d: %v", attempt.Attempt, cb.ID, err)
+	}
+}
+
+// post sends a signed callback, returning the response status, zero when
+// none was received, and an error unless it was 2xx
+func (d *Deliverer) post(ctx context.Context, cb *models.Callback) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cb.URL, bytes.NewReader(cb.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, strconv.FormatInt(cb.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, timestamp, cb.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send callback: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New("non-2xx response: " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the attempt following attempt number n
+func (d *Deliverer) backoff(n int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < n && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+// permanent reports whether a response status refuses the callback for
+// good: a client error other than a timeout or rate limit
+func permanent(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,64 @@
+package callback
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"txn-1","status":"approved","risk_level":"low"}`)
+	signature := Sign("secret", 1760000000, body)
+	if signature[:7] != "sha256=" || len(signature) != 7+64 {
+		t.Fatalf("signature = %q, want sha256= and a hex HMAC-SHA256", signature)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		valid     bool
+	}{
+		{"as signed", "secret", 1760000000, string(body), true},
+		{"another secret", "other", 1760000000, string(body), false},
+		{"replayed at another time", "secret", 1760000060, string(body), false},
+		{"tampered body", "secret", 1760000000, `{"id":"txn-1","status":"rejected","risk_level":"low"}`, false},
+	}
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.timestamp, []byte(tt.body), signature); got != tt.valid {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Deliverer{cfg: Config{Backoff: 5 * time.Second, MaxBackoff: time.Minute}}
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("backoff after attempt %d = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{0, false},
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+		{http.StatusGone, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		if got := permanent(tt.status); got != tt.permanent {
+			t.Errorf("permanent(%d) = %v, want %v", tt.status, got, tt.permanent)
+		}
+	}
+}
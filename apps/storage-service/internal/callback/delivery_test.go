@@ -0,0 +1,300 @@
+//go:build integration
+
+package callback
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+	"storage-service/internal/testdb"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// The delivery tests run against Postgres in a container:
+//
+//	go test -tags=integration ./internal/callback/
+
+const testSecret = "callback-test-secret"
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage queueing callbacks on a new database,
+// closed when the test ends, and a connection to the database
+func newTestStorage(t *testing.T) (*storage.Storage, *sql.DB) {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(storage.Options{DBUrl: dbURL, Callbacks: true})
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return s, db
+}
+
+// newTestDeliverer returns a deliverer retrying at once, a few times
+func newTestDeliverer(s *storage.Storage) *Deliverer {
+	return NewDeliverer(s, Config{
+		Secret:      testSecret,
+		Interval:    10 * time.Millisecond,
+		BatchSize:   10,
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	})
+}
+
+// delivery is a callback request a receiver got
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers callbacks with the statuses it is given in turn, then
+// 200, recording the requests
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []delivery
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.deliveries = append(rcv.deliveries, delivery{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []delivery {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]delivery(nil), rcv.deliveries...)
+}
+
+// decided returns a transaction with status, to be called back at callbackURL
+func decided(id, status, callbackURL string) *models.StoredTransaction {
+	return &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             id,
+			IdempotencyKey: "key-" + id,
+			AccountID:      "acct-1",
+			UserID:         "user-1",
+			Amount:         42.5,
+			Currency:       "USD",
+			Type:           "purchase",
+			Status:         status,
+			Timestamp:      time.Now().UTC().Add(-time.Minute),
+			CallbackURL:    callbackURL,
+		},
+		RiskScore:       0.9,
+		RiskLevel:       "critical",
+		RejectionReason: "blocked merchant",
+		IsValid:         true,
+		ProcessedAt:     time.Now().UTC(),
+		ProcessorID:     "processing-service",
+	}}
+}
+
+// store stores transactions, failing the test on error
+func store(t *testing.T, s *storage.Storage, txns ...*models.StoredTransaction) {
+	t.Helper()
+	for _, txn := range txns {
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+}
+
+// deliverUntil drains due callbacks until done or a second has passed
+func deliverUntil(t *testing.T, d *Deliverer, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !done() && time.Now().Before(deadline) {
+		d.drain(context.Background())
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !done() {
+		t.Fatal("callbacks not delivered in time")
+	}
+}
+
+// callbacks returns the callbacks of a transaction
+func callbacks(t *testing.T, s *storage.Storage, id string) []*models.Callback {
+	t.Helper()
+	cbs, err := s.GetCallbacks(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetCallbacks: %v", err)
+	}
+	return cbs
+}
+
+func TestCallbackIsDeliveredSigned(t *testing.T) {
+	s, _ := newTestStorage(t)
+	rcv := newReceiver(t)
+	store(t, s, decided("txn-1", "rejected", rcv.URL+"/hook"))
+
+	deliverUntil(t, newTestDeliverer(s), func() bool { return len(rcv.received()) == 1 })
+
+	got := rcv.received()[0]
+	var payload models.CallbackPayload
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	want := models.CallbackPayload{ID: "txn-1", Status: "rejected", RiskLevel: "critical", RejectionReason: "blocked merchant"}
+	if payload != want {
+		t.Errorf("payload = %+v, want %+v", payload, want)
+	}
+
+	timestamp, err := strconv.ParseInt(got.header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header %q: %v", got.header.Get(TimestampHeader), err)
+	}
+	if !Verify(testSecret, timestamp, got.body, got.header.Get(SignatureHeader)) {
+		t.Errorf("signature %q does not verify", got.header.Get(SignatureHeader))
+	}
+	if Verify("another-secret", timestamp, got.body, got.header.Get(SignatureHeader)) {
+		t.Error("signature verifies under another secret")
+	}
+
+	cbs := callbacks(t, s, "txn-1")
+	if len(cbs) != 1 {
+		t.Fatalf("%d callbacks, want 1", len(cbs))
+	}
+	cb := cbs[0]
+	if got.header.Get(IDHeader) != strconv.FormatInt(cb.ID, 10) {
+		t.Errorf("callback ID header %q, want %d", got.header.Get(IDHeader), cb.ID)
+	}
+	if cb.Status != models.CallbackStatusDelivered || cb.Attempts != 1 || cb.DeliveredAt == nil || cb.NextAttemptAt != nil {
+		t.Errorf("callback = %+v, want delivered at the first attempt", cb)
+	}
+	if len(cb.History) != 1 || cb.History[0].StatusCode != http.StatusOK || cb.History[0].Error != "" {
+		t.Errorf("attempts = %+v, want one answered 200", cb.History)
+	}
+}
+
+func TestCallbackIsRetriedUntilDelivered(t *testing.T) {
+	s, _ := newTestStorage(t)
+	rcv := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	store(t, s, decided("txn-1", "approved", rcv.URL))
+
+	deliverUntil(t, newTestDeliverer(s), func() bool { return len(rcv.received()) == 3 })
+
+	cb := callbacks(t, s, "txn-1")[0]
+	if cb.Status != models.CallbackStatusDelivered || cb.Attempts != 3 {
+		t.Errorf("callback %s after %d attempts, want delivered at the third", cb.Status, cb.Attempts)
+	}
+	var statuses []int
+	for _, attempt := range cb.History {
+		statuses = append(statuses, attempt.StatusCode)
+	}
+	if fmt.Sprint(statuses) != fmt.Sprint([]int{503, 429, 200}) {
+		t.Errorf("attempts answered %v, want 503, 429 then 200", statuses)
+	}
+	if cb.History[0].Error == "" || cb.History[2].Error != "" {
+		t.Errorf("attempt errors = %q, %q, want the failure recorded alone", cb.History[0].Error, cb.History[2].Error)
+	}
+
+	// Every retry is signed afresh
+	for i, got := range rcv.received() {
+		timestamp, _ := strconv.ParseInt(got.header.Get(TimestampHeader), 10, 64)
+		if !Verify(testSecret, timestamp, got.body, got.header.Get(SignatureHeader)) {
+			t.Errorf("attempt %d signature does not verify", i+1)
+		}
+	}
+}
+
+func TestFailingCallbacksAreDeadLettered(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"attempts run out", []int{500, 502, 503}, 3},
+		{"refused for good", []int{http.StatusGone}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestStorage(t)
+			rcv := newReceiver(t, tt.statuses...)
+			store(t, s, decided("txn-1", "flagged", rcv.URL))
+
+			d := newTestDeliverer(s)
+			deliverUntil(t, d, func() bool { return callbacks(t, s, "txn-1")[0].Status == models.CallbackStatusDead })
+
+			// Nothing is attempted once dead
+			d.drain(context.Background())
+			if n := len(rcv.received()); n != tt.attempts {
+				t.Errorf("%d attempts made, want %d", n, tt.attempts)
+			}
+			cb := callbacks(t, s, "txn-1")[0]
+			if cb.Attempts != tt.attempts || cb.LastError == "" || cb.NextAttemptAt != nil {
+				t.Errorf("callback = %+v, want dead after %d attempts with the last error", cb, tt.attempts)
+			}
+
+			var attempts int
+			var lastError string
+			err := db.QueryRow(`SELECT attempts, last_error FROM callback_dead_letters WHERE callback_id = $1`, cb.ID).
+				Scan(&attempts, &lastError)
+			if err != nil {
+				t.Fatalf("dead letter: %v", err)
+			}
+			if attempts != tt.attempts || lastError != cb.LastError {
+				t.Errorf("dead letter after %d attempts with %q, want %d with %q", attempts, lastError, tt.attempts, cb.LastError)
+			}
+		})
+	}
+}
+
+func TestOnlyFinalTransactionsWithACallbackURLAreCalledBack(t *testing.T) {
+	s, _ := newTestStorage(t)
+	rcv := newReceiver(t)
+	store(t, s,
+		decided("txn-final", "approved", rcv.URL),
+		decided("txn-pending", "pending", rcv.URL),
+		decided("txn-no-url", "approved", ""),
+	)
+
+	for _, tt := range []struct {
+		id string
+		n  int
+	}{{"txn-final", 1}, {"txn-pending", 0}, {"txn-no-url", 0}} {
+		if got := len(callbacks(t, s, tt.id)); got != tt.n {
+			t.Errorf("%s has %d callbacks queued, want %d", tt.id, got, tt.n)
+		}
+	}
+	pending, err := s.CallbacksPending(context.Background())
+	if err != nil || pending != 1 {
+		t.Errorf("CallbacksPending = %d, %v, want 1", pending, err)
+	}
+}
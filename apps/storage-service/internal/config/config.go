@@ -1,12 +1,31 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
 )
 
+// DevEnvironment is the APP_ENV value that accepts placeholder secrets
+const DevEnvironment = "development"
+
+// defaultJWTSecret is the placeholder secret, refused outside development
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 // Config holds all configuration for the storage service
 type Config struct {
+	// Environment is the APP_ENV the service runs in
+	Environment string
+
 	// Database configuration
 	DBHost     string
 	DBPort     string
@@ -16,66 +35,339 @@ type Config struct {
 	DBSSLMode  string
 	DBUrl      string
 
+	// Read replica configuration
+	DBReplicaURL          string
+	ReplicaHealthInterval int // in seconds
+
+	// DBFlavor is "postgres" or "timescale"
+	DBFlavor             string
+	TimescaleChunkPeriod string
+
 	// Kafka configuration
 	KafkaBrokers  string
 	InputTopic    string
+	StoredTopic   string
 	ConsumerGroup string
+	DLQTopic      string // transactions that fail every attempt
+
+	// MaxRedrives caps how many times a message is re-driven from DLQTopic
+	// through /admin/dlq/redrive
+	MaxRedrives int
+
+	// Kafka TLS and SASL configuration, shared by every Kafka client
+	KafkaSecurity kafkaconn.Config
+
+	// KafkaTopics provisions the topics the service produces to at
+	// startup, when TOPIC_AUTOCREATE is set
+	KafkaTopics kafkaconn.TopicsConfig
+
+	// Consumer concurrency configuration. Transactions are stored by
+	// ConsumerConcurrency goroutines, one account per worker at a time, with
+	// at most ConsumerBatchSize of them in flight.
+	ConsumerConcurrency int
+	ConsumerBatchSize   int
 
-	// Redis configuration
-	RedisAddr     string
-	RedisPassword string
-	RedisDB       int
+	// Redis configuration: a single node, or through Sentinel or a cluster
+	Redis redisconn.Config
+
+	// Cache configuration
+	CacheTTL         int // in seconds
+	NegativeCacheTTL int // in seconds
+	SummaryCacheTTL  int // in seconds
 
 	// Service configuration
 	BatchSize      int
 	MaxRetries     int
 	ProcessTimeout int // in seconds
 
+	// StartupTimeout bounds the wait for Postgres and Kafka at startup
+	StartupTimeout int // in seconds
+
+	// ShutdownDeadline bounds the whole shutdown, past which the components
+	// not yet stopped are abandoned and the service exits with an error
+	ShutdownDeadline int // in seconds
+
+	// Outbox configuration
+	OutboxPollInterval int // in milliseconds
+	OutboxBatchSize    int
+	OutboxRetention    int // in hours
+
+	// Reconciliation configuration
+	ReconcileInterval  int // in minutes, 0 disables scheduled runs
+	ReconcileLag       int // in minutes
+	ReconcileChunkSize int
+	ReconcileRepair    bool
+
+	// Risk recomputation configuration. Account risk metrics are
+	// recomputed from the transactions of the trailing RiskWindowDays, each
+	// weighing half as much for every RiskHalfLifeDays of age.
+	RiskRecomputeInterval  int // in minutes, 0 disables scheduled runs
+	RiskWindowDays         int
+	RiskHalfLifeDays       int
+	RiskRecomputeBatchSize int
+
+	// Integrity configuration. In integrity mode every stored transaction
+	// is chained to the one stored before it on its account, and the chains
+	// are verified every IntegrityVerifyInterval.
+	IntegrityEnabled        bool
+	IntegrityVerifyInterval int // in minutes, 0 disables scheduled runs
+
+	// Exchange rates converting stats totals into BaseCurrency alongside
+	// the native totals. The rates come from ExchangeRatesFile, or the
+	// built-in defaults without one, and are refreshed from ExchangeRatesURL
+	// every ExchangeRatesRefresh when it is set.
+	BaseCurrency         string
+	ExchangeRatesFile    string
+	ExchangeRatesURL     string
+	ExchangeRatesRefresh int // in minutes
+
+	// Account status configuration. Account changes are published on
+	// AccountTopic, empty publishing none, and the statuses cached for the
+	// processing service are resynced every AccountStatusSyncInterval.
+	AccountTopic              string
+	AccountStatusSyncInterval int // in minutes, 0 disables scheduled syncs
+
+	// Decision audit configuration. The audits the processing service
+	// publishes on AuditTopic are consumed by AuditConsumerGroup into the
+	// append-only decision_audits table; an empty topic consumes none.
+	AuditTopic         string
+	AuditConsumerGroup string
+
+	// Callback configuration. The outcome of a transaction submitted with a
+	// callback URL is posted there, signed with CallbackSecret, once it is
+	// stored with a final status; without a secret no callback is queued.
+	// Each attempt is bounded by CallbackTimeout; a failed one is retried
+	// after CallbackBackoff, doubled on every retry up to
+	// CallbackMaxBackoff, until CallbackMaxAttempts have been made and the
+	// callback is dead-lettered.
+	CallbackSecret       string
+	CallbackPollInterval int // in milliseconds
+	CallbackBatchSize    int
+	CallbackTimeout      int // in seconds
+	CallbackMaxAttempts  int
+	CallbackBackoff      int // in seconds
+	CallbackMaxBackoff   int // in seconds
+
+	// Lag alert configuration. A partition of InputTopic lagging by
+	// LagAlertThreshold messages or more for LagAlertSustain raises an
+	// operational alert on LagAlertTopic, the topic the alert service
+	// consumes, resolved once its lag falls to LagAlertThreshold times
+	// LagAlertRecoveryRatio. A zero threshold disables lag alerts.
+	LagAlertTopic         string
+	LagAlertThreshold     int
+	LagAlertSustain       int // in seconds
+	LagAlertRecoveryRatio float64
+
+	// HTTP API configuration. APIDocsEnabled serves a Swagger UI page at
+	// /docs.
+	HTTPPort       string
+	JWTSecret      string
+	APIDocsEnabled bool
+
+	// JWTKeyID is the key ID of JWTSecret; tokens naming one of
+	// JWTPreviousSecrets, a map of key ID to secret, still validate during
+	// a rotation
+	JWTKeyID           string
+	JWTPreviousSecrets map[string]string
+
+	// Live feed configuration. The feed consumes InputTopic with its own
+	// group, one per instance so every instance sees every partition. It
+	// replays the last FeedReplaySize transactions to new clients and
+	// disconnects clients more than FeedClientBuffer transactions behind.
+	FeedEnabled       bool
+	FeedConsumerGroup string
+	FeedReplaySize    int
+	FeedClientBuffer  int
+
 	// Monitoring configuration
 	MetricsEnabled bool
 	MetricsPort    string
 
+	// AdminToken authenticates the consumer pause and resume endpoints on
+	// the metrics listener, which are disabled without one
+	AdminToken string
+
+	// ChaosEnabled turns on fault injection into Kafka and the database,
+	// driven through /admin/chaos on the metrics listener
+	ChaosEnabled bool
+
 	// Storage configuration
 	MaxConnections int
 	IdleTimeout    int // in seconds
 	QueryTimeout   int // in seconds
+	SearchTimeout  int // in milliseconds
+
+	// ExportMaxRows is the most transactions a bulk export may hold
+	ExportMaxRows int
+
+	// SlowQueryThreshold is the statement duration above which a query is
+	// logged as slow, zero logging none
+	SlowQueryThreshold int // in milliseconds
+
+	// PII encryption configuration
+	PIIEncryptionKeys       string // comma-separated version=base64key pairs
+	PIIEncryptionKeyVersion string
+
+	// Secret rotation. The secret files, empty when the secrets are set
+	// directly, are polled every SecretsReloadInterval.
+	JWTSecretFile         string
+	DBPasswordFile        string
+	SecretsReloadInterval int // in seconds
+
+	// LogSampleRate logs one in this many handled messages at info level
+	LogSampleRate int
+
+	// LogConfigOnStart logs the effective configuration, secrets redacted
+	LogConfigOnStart bool
+
+	// parseErrors lists environment values that could not be parsed
+	parseErrors []error
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from environment variables. Values that
+// cannot be parsed fall back to their defaults and are reported by Validate.
 func LoadConfig() *Config {
+	envErrors = nil
 	cfg := &Config{
+		Environment: getEnv("APP_ENV", "production"),
+
 		// Database configuration
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
 		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "password"),
+		DBPassword: getSecret("DB_PASSWORD", "password"),
 		DBName:     getEnv("DB_NAME", "barclays_tx"),
 		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
 
+		DBReplicaURL:          getSecret("DB_REPLICA_URL", ""),
+		ReplicaHealthInterval: getEnvAsInt("REPLICA_HEALTH_INTERVAL", 5),
+
+		DBFlavor:             getEnv("DB_FLAVOR", "postgres"),
+		TimescaleChunkPeriod: getEnv("TIMESCALE_CHUNK_INTERVAL", "7 days"),
+
 		// Kafka configuration
 		KafkaBrokers:  getEnv("KAFKA_BROKERS", "localhost:9092"),
 		InputTopic:    getEnv("KAFKA_INPUT_TOPIC", "transactions.processed"),
+		StoredTopic:   getEnv("KAFKA_STORED_TOPIC", "transactions.stored"),
 		ConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "storage-service"),
+		DLQTopic:      getEnv("KAFKA_DLQ_TOPIC", "transactions.processed.dlq"),
+		KafkaSecurity: kafkaconn.LoadConfig(),
+		KafkaTopics:   kafkaconn.LoadTopicsConfig(),
+		MaxRedrives:   getEnvAsInt("DLQ_MAX_REDRIVES", 3),
+
+		// Consumer concurrency configuration
+		ConsumerConcurrency: getEnvAsInt("CONSUMER_CONCURRENCY", 8),
+		ConsumerBatchSize:   getEnvAsInt("CONSUMER_BATCH_SIZE", 100),
 
 		// Redis configuration
-		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       getEnvAsInt("REDIS_DB", 0),
+		Redis: redisconn.LoadConfig(),
+
+		// Cache configuration
+		CacheTTL:         getEnvAsInt("CACHE_TTL", 3600),
+		NegativeCacheTTL: getEnvAsInt("NEGATIVE_CACHE_TTL", 30),
+		SummaryCacheTTL:  getEnvAsInt("SUMMARY_CACHE_TTL", 60),
 
 		// Service configuration
 		BatchSize:      getEnvAsInt("BATCH_SIZE", 100),
 		MaxRetries:     getEnvAsInt("MAX_RETRIES", 3),
 		ProcessTimeout: getEnvAsInt("PROCESS_TIMEOUT", 30),
+		StartupTimeout: getEnvAsInt("STARTUP_TIMEOUT", 60),
+
+		ShutdownDeadline: getEnvAsInt("SHUTDOWN_DEADLINE", 60),
+
+		// Outbox configuration
+		OutboxPollInterval: getEnvAsInt("OUTBOX_POLL_INTERVAL_MS", 500),
+		OutboxBatchSize:    getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxRetention:    getEnvAsInt("OUTBOX_RETENTION_HOURS", 24),
+
+		// Reconciliation configuration
+		ReconcileInterval:  getEnvAsInt("RECONCILE_INTERVAL_MINUTES", 60),
+		ReconcileLag:       getEnvAsInt("RECONCILE_LAG_MINUTES", 10),
+		ReconcileChunkSize: getEnvAsInt("RECONCILE_CHUNK_SIZE", 1000),
+		ReconcileRepair:    getEnvAsBool("RECONCILE_REPAIR", false),
+
+		// Risk recomputation configuration
+		RiskRecomputeInterval:  getEnvAsInt("RISK_RECOMPUTE_INTERVAL_MINUTES", 60),
+		RiskWindowDays:         getEnvAsInt("RISK_WINDOW_DAYS", 90),
+		RiskHalfLifeDays:       getEnvAsInt("RISK_HALF_LIFE_DAYS", 14),
+		RiskRecomputeBatchSize: getEnvAsInt("RISK_RECOMPUTE_BATCH_SIZE", 500),
+
+		// Integrity configuration
+		IntegrityEnabled:        getEnvAsBool("INTEGRITY_ENABLED", false),
+		IntegrityVerifyInterval: getEnvAsInt("INTEGRITY_VERIFY_INTERVAL_MINUTES", 1440),
+
+		// Exchange rates
+		BaseCurrency:         getEnv("BASE_CURRENCY", "USD"),
+		ExchangeRatesFile:    getEnv("EXCHANGE_RATES_FILE", ""),
+		ExchangeRatesURL:     getEnv("EXCHANGE_RATES_URL", ""),
+		ExchangeRatesRefresh: getEnvAsInt("EXCHANGE_RATES_REFRESH_MINUTES", 60),
+
+		// Account status configuration
+		AccountTopic:              getEnv("KAFKA_ACCOUNT_TOPIC", "accounts.status"),
+		AccountStatusSyncInterval: getEnvAsInt("ACCOUNT_STATUS_SYNC_MINUTES", 15),
+
+		// Decision audit configuration
+		AuditTopic:         getEnv("KAFKA_AUDIT_TOPIC", "transactions.audit"),
+		AuditConsumerGroup: getEnv("KAFKA_AUDIT_CONSUMER_GROUP", "storage-service-audit"),
+
+		// Callback configuration
+		CallbackSecret:       getSecret("CALLBACK_SIGNING_SECRET", ""),
+		CallbackPollInterval: getEnvAsInt("CALLBACK_POLL_INTERVAL_MS", 1000),
+		CallbackBatchSize:    getEnvAsInt("CALLBACK_BATCH_SIZE", 50),
+		CallbackTimeout:      getEnvAsInt("CALLBACK_TIMEOUT_SECONDS", 10),
+		CallbackMaxAttempts:  getEnvAsInt("CALLBACK_MAX_ATTEMPTS", 8),
+		CallbackBackoff:      getEnvAsInt("CALLBACK_BACKOFF_SECONDS", 5),
+		CallbackMaxBackoff:   getEnvAsInt("CALLBACK_MAX_BACKOFF_SECONDS", 3600),
+
+		// Lag alert configuration
+		LagAlertTopic:         getEnv("LAG_ALERT_TOPIC", "transactions.processed"),
+		LagAlertThreshold:     getEnvAsInt("LAG_ALERT_THRESHOLD", 10000),
+		LagAlertSustain:       getEnvAsInt("LAG_ALERT_SUSTAIN_SECONDS", 300),
+		LagAlertRecoveryRatio: getEnvAsFloat("LAG_ALERT_RECOVERY_RATIO", 0.5),
+
+		// HTTP API configuration
+		HTTPPort:       getEnv("HTTP_PORT", "8082"),
+		JWTSecret:      getSecret("JWT_SECRET", defaultJWTSecret),
+		APIDocsEnabled: getEnvAsBool("API_DOCS_ENABLED", false),
+
+		JWTKeyID:           getEnv("JWT_KEY_ID", "default"),
+		JWTPreviousSecrets: getSecretKeys("JWT_PREVIOUS_SECRETS"),
+
+		// Live feed configuration
+		FeedEnabled:       getEnvAsBool("FEED_ENABLED", true),
+		FeedConsumerGroup: getEnv("FEED_CONSUMER_GROUP", "storage-service-feed-"+hostname()),
+		FeedReplaySize:    getEnvAsInt("FEED_REPLAY_SIZE", 100),
+		FeedClientBuffer:  getEnvAsInt("FEED_CLIENT_BUFFER", 256),
 
 		// Monitoring configuration
 		MetricsEnabled: getEnvAsBool("METRICS_ENABLED", true),
 		MetricsPort:    getEnv("METRICS_PORT", "9092"),
+		AdminToken:     getSecret("ADMIN_TOKEN", ""),
+		ChaosEnabled:   getEnvAsBool("CHAOS_ENABLED", false),
 
 		// Storage configuration
 		MaxConnections: getEnvAsInt("MAX_CONNECTIONS", 10),
 		IdleTimeout:    getEnvAsInt("IDLE_TIMEOUT", 300),
 		QueryTimeout:   getEnvAsInt("QUERY_TIMEOUT", 30),
+		SearchTimeout:  getEnvAsInt("SEARCH_TIMEOUT_MS", 5000),
+
+		ExportMaxRows: getEnvAsInt("EXPORT_MAX_ROWS", 1000000),
+
+		SlowQueryThreshold: getEnvAsInt("SLOW_QUERY_THRESHOLD_MS", 1000),
+
+		// PII encryption configuration
+		PIIEncryptionKeys:       getSecret("PII_ENCRYPTION_KEYS", ""),
+		PIIEncryptionKeyVersion: getEnv("PII_ENCRYPTION_KEY_VERSION", "v1"),
+
+		// Secret rotation
+		JWTSecretFile:         secrets.File("JWT_SECRET"),
+		DBPasswordFile:        secrets.File("DB_PASSWORD"),
+		SecretsReloadInterval: getEnvAsInt("SECRETS_RELOAD_SECONDS", 30),
+
+		LogSampleRate:    getEnvAsInt("LOG_SAMPLE_RATE", 100),
+		LogConfigOnStart: getEnvAsBool("LOG_CONFIG_ON_START", false),
 	}
+	cfg.parseErrors, envErrors = envErrors, nil
 
 	// Build database URL
 	cfg.DBUrl = buildDatabaseURL(cfg)
@@ -83,15 +375,249 @@ func LoadConfig() *Config {
 	return cfg
 }
 
+// Validate checks the configuration and returns every problem found, joined
+// into one error
+func (c *Config) Validate() error {
+	problems := append([]error(nil), c.parseErrors...)
+
+	if c.Environment != DevEnvironment && (c.JWTSecret == "" || c.JWTSecret == defaultJWTSecret) {
+		problems = append(problems, fmt.Errorf("JWT_SECRET must be set outside %s", DevEnvironment))
+	}
+	if c.JWTKeyID == "" {
+		problems = append(problems, errors.New("JWT_KEY_ID is empty"))
+	}
+	if _, ok := c.JWTPreviousSecrets[c.JWTKeyID]; ok {
+		problems = append(problems, fmt.Errorf("JWT_PREVIOUS_SECRETS must not include the current key %q", c.JWTKeyID))
+	}
+	if err := checkDatabaseURL(c.DBUrl); err != nil {
+		problems = append(problems, fmt.Errorf("database URL: %w", err))
+	}
+	if c.DBReplicaURL != "" {
+		if err := checkDatabaseURL(c.DBReplicaURL); err != nil {
+			problems = append(problems, fmt.Errorf("DB_REPLICA_URL: %w", err))
+		}
+	}
+	if c.DBFlavor != "postgres" && c.DBFlavor != "timescale" {
+		problems = append(problems, fmt.Errorf("DB_FLAVOR: %q is not postgres or timescale", c.DBFlavor))
+	}
+	if !hasBroker(c.KafkaBrokers) {
+		problems = append(problems, errors.New("KAFKA_BROKERS lists no brokers"))
+	}
+	if c.InputTopic == "" || c.StoredTopic == "" {
+		problems = append(problems, errors.New("KAFKA_INPUT_TOPIC and KAFKA_STORED_TOPIC must be set"))
+	}
+	if err := c.KafkaTopics.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := c.Redis.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.ConsumerConcurrency < 1 {
+		problems = append(problems, errors.New("CONSUMER_CONCURRENCY must be positive"))
+	}
+	if c.ConsumerBatchSize < 1 {
+		problems = append(problems, errors.New("CONSUMER_BATCH_SIZE must be positive"))
+	}
+	if c.MaxRetries < 0 {
+		problems = append(problems, errors.New("MAX_RETRIES must not be negative"))
+	}
+	if c.StartupTimeout < 1 {
+		problems = append(problems, errors.New("STARTUP_TIMEOUT must be positive"))
+	}
+	if c.ShutdownDeadline < 1 {
+		problems = append(problems, errors.New("SHUTDOWN_DEADLINE must be positive"))
+	}
+	if c.MaxRedrives < 1 {
+		problems = append(problems, errors.New("DLQ_MAX_REDRIVES must be positive"))
+	}
+	if c.MaxConnections < 1 {
+		problems = append(problems, errors.New("MAX_CONNECTIONS must be positive"))
+	}
+	if c.QueryTimeout < 0 || c.SlowQueryThreshold < 0 {
+		problems = append(problems, errors.New("QUERY_TIMEOUT and SLOW_QUERY_THRESHOLD_MS must not be negative"))
+	}
+	if c.ExportMaxRows < 1 {
+		problems = append(problems, errors.New("EXPORT_MAX_ROWS must be positive"))
+	}
+	if c.OutboxPollInterval < 1 || c.OutboxBatchSize < 1 {
+		problems = append(problems, errors.New("OUTBOX_POLL_INTERVAL_MS and OUTBOX_BATCH_SIZE must be positive"))
+	}
+	if c.ReconcileInterval < 0 {
+		problems = append(problems, errors.New("RECONCILE_INTERVAL_MINUTES must not be negative"))
+	}
+	if c.RiskRecomputeInterval < 0 {
+		problems = append(problems, errors.New("RISK_RECOMPUTE_INTERVAL_MINUTES must not be negative"))
+	}
+	if c.RiskWindowDays < 1 || c.RiskHalfLifeDays < 1 || c.RiskRecomputeBatchSize < 1 {
+		problems = append(problems, errors.New("RISK_WINDOW_DAYS, RISK_HALF_LIFE_DAYS and RISK_RECOMPUTE_BATCH_SIZE must be positive"))
+	}
+	if c.IntegrityVerifyInterval < 0 {
+		problems = append(problems, errors.New("INTEGRITY_VERIFY_INTERVAL_MINUTES must not be negative"))
+	}
+	if c.AccountStatusSyncInterval < 0 {
+		problems = append(problems, errors.New("ACCOUNT_STATUS_SYNC_MINUTES must not be negative"))
+	}
+	if c.AuditTopic != "" && (c.AuditConsumerGroup == "" || c.AuditConsumerGroup == c.ConsumerGroup) {
+		problems = append(problems, errors.New("KAFKA_AUDIT_CONSUMER_GROUP must be set and differ from KAFKA_CONSUMER_GROUP"))
+	}
+	if c.CallbackSecret != "" && (c.CallbackPollInterval < 1 || c.CallbackBatchSize < 1 || c.CallbackTimeout < 1 ||
+		c.CallbackMaxAttempts < 1 || c.CallbackBackoff < 1 || c.CallbackMaxBackoff < c.CallbackBackoff) {
+		problems = append(problems, errors.New("CALLBACK_POLL_INTERVAL_MS, CALLBACK_BATCH_SIZE, CALLBACK_TIMEOUT_SECONDS, CALLBACK_MAX_ATTEMPTS and CALLBACK_BACKOFF_SECONDS must be positive, and CALLBACK_MAX_BACKOFF_SECONDS at least CALLBACK_BACKOFF_SECONDS"))
+	}
+	if c.LagAlertThreshold < 0 {
+		problems = append(problems, errors.New("LAG_ALERT_THRESHOLD must not be negative"))
+	}
+	if c.LagAlertThreshold > 0 && c.LagAlertTopic == "" {
+		problems = append(problems, errors.New("LAG_ALERT_THRESHOLD requires LAG_ALERT_TOPIC"))
+	}
+	if c.LagAlertSustain < 1 {
+		problems = append(problems, errors.New("LAG_ALERT_SUSTAIN_SECONDS must be positive"))
+	}
+	if c.LagAlertRecoveryRatio <= 0 || c.LagAlertRecoveryRatio >= 1 {
+		problems = append(problems, errors.New("LAG_ALERT_RECOVERY_RATIO must be between 0 and 1"))
+	}
+	if c.FeedEnabled {
+		if c.FeedConsumerGroup == "" || c.FeedConsumerGroup == c.ConsumerGroup {
+			problems = append(problems, errors.New("FEED_CONSUMER_GROUP must be set and differ from KAFKA_CONSUMER_GROUP"))
+		}
+		if c.FeedReplaySize < 0 {
+			problems = append(problems, errors.New("FEED_REPLAY_SIZE must not be negative"))
+		}
+		if c.FeedClientBuffer < 1 {
+			problems = append(problems, errors.New("FEED_CLIENT_BUFFER must be positive"))
+		}
+	}
+	if _, ok := currency.Lookup(c.BaseCurrency); !ok {
+		problems = append(problems, fmt.Errorf("BASE_CURRENCY %q is not an ISO 4217 currency", c.BaseCurrency))
+	}
+	if c.ExchangeRatesURL != "" && c.ExchangeRatesRefresh < 1 {
+		problems = append(problems, errors.New("EXCHANGE_RATES_REFRESH_MINUTES must be positive"))
+	}
+	if c.ChaosEnabled && c.AdminToken == "" {
+		problems = append(problems, errors.New("CHAOS_ENABLED requires ADMIN_TOKEN"))
+	}
+
+	if c.LogSampleRate < 1 {
+		problems = append(problems, errors.New("LOG_SAMPLE_RATE must be positive"))
+	}
+	if c.SecretsReloadInterval < 1 {
+		problems = append(problems, errors.New("SECRETS_RELOAD_SECONDS must be positive"))
+	}
+
+	if err := buckets.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+// OutputTopics returns the specs of the topics the service produces to:
+// stored events, dead letters, account statuses when published, and lag
+// alerts when raised
+func (c *Config) OutputTopics() []kafkaconn.TopicSpec {
+	topics := []string{c.StoredTopic, c.DLQTopic, c.AccountTopic}
+	if c.LagAlertThreshold > 0 {
+		topics = append(topics, c.LagAlertTopic)
+	}
+	return c.KafkaTopics.Specs(topics...)
+}
+
+// String renders the configuration with secrets redacted
+func (c Config) String() string {
+	type plain Config
+	p := plain(c)
+	p.DBPassword = redact(p.DBPassword)
+	p.DBUrl = redactURL(p.DBUrl)
+	p.DBReplicaURL = redactURL(p.DBReplicaURL)
+	p.JWTSecret = redact(p.JWTSecret)
+	p.JWTPreviousSecrets = make(map[string]string, len(c.JWTPreviousSecrets))
+	for kid, secret := range c.JWTPreviousSecrets {
+		p.JWTPreviousSecrets[kid] = redact(secret)
+	}
+	p.AdminToken = redact(p.AdminToken)
+	p.CallbackSecret = redact(p.CallbackSecret)
+	p.PIIEncryptionKeys = redact(p.PIIEncryptionKeys)
+	p.parseErrors = nil
+	return fmt.Sprintf("%+v", p)
+}
+
+// checkDatabaseURL checks that a PostgreSQL URL names a host, user and
+// database
+func checkDatabaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("not a valid URL")
+	}
+	var missing []string
+	if u.Hostname() == "" {
+		missing = append(missing, "host")
+	}
+	if u.User.Username() == "" {
+		missing = append(missing, "user")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		missing = append(missing, "database name")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// redact hides a secret, keeping whether it was set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// redactURL hides the password in a URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redact(raw)
+	}
+	return u.Redacted()
+}
+
+// hasBroker reports whether a comma-separated broker list names a broker
+func hasBroker(brokers string) bool {
+	for _, b := range strings.Split(brokers, ",") {
+		if strings.TrimSpace(b) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDBPassword replaces the database password, after a rotation, and
+// rebuilds DBUrl
+func (c *Config) SetDBPassword(password string) {
+	c.DBPassword = password
+	c.DBUrl = buildDatabaseURL(c)
+}
+
 // buildDatabaseURL constructs the PostgreSQL connection string
 func buildDatabaseURL(cfg *Config) string {
-	if dbUrl := os.Getenv("DATABASE_URL"); dbUrl != "" {
+	if dbUrl := getSecret("DATABASE_URL", ""); dbUrl != "" {
 		return dbUrl
 	}
 
 	return "postgres://" + cfg.DBUser + ":" + cfg.DBPassword + "@" + cfg.DBHost + ":" + cfg.DBPort + "/" + cfg.DBName + "?sslmode=" + cfg.DBSSLMode
 }
 
+// hostname returns the host name, or "local" when it is unknown
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "local"
+	}
+	return name
+}
+
+// envErrors collects the values the helpers fail to parse during LoadConfig
+var envErrors []error
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -100,20 +626,70 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getSecret reads a secret from key, or from the file named by key_FILE
+func getSecret(key, defaultValue string) string {
+	value, err := secrets.Lookup(key)
+	if err != nil {
+		envErrors = append(envErrors, err)
+		return defaultValue
+	}
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getSecretKeys reads a secret holding a comma-separated list of key ID and
+// secret pairs, each as kid:secret
+func getSecretKeys(key string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(getSecret(key, ""), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			envErrors = append(envErrors, fmt.Errorf("%s: entries must be kid:secret", key))
+			continue
+		}
+		keys[kid] = secret
+	}
+	return keys
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+			return defaultValue
+		}
+		return intValue
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a number", key, value))
+			return defaultValue
 		}
+		return floatValue
 	}
 	return defaultValue
 }
 
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			envErrors = append(envErrors, fmt.Errorf("%s: %q is not a boolean", key, value))
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
 }
@@ -0,0 +1,137 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns a base64 AES-256 key filled with b
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newTestCipher(t *testing.T, spec, current string) *FieldCipher {
+	t.Helper()
+	keys, err := NewStaticKeyProvider(spec, current)
+	if err != nil {
+		t.Fatalf("NewStaticKeyProvider: %v", err)
+	}
+	return NewFieldCipher(keys)
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newTestCipher(t, "v1="+testKey(1), "v1")
+	for _, plaintext := range []string{"203.0.113.7", "iPhone 15; iOS 19", `{"note":"ünïcödé"}`} {
+		sealed, err := c.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+		if !strings.HasPrefix(sealed, "enc:v1:") || strings.Contains(sealed, plaintext) {
+			t.Errorf("Encrypt(%q) = %q, want ciphertext of v1", plaintext, sealed)
+		}
+		opened, err := c.Decrypt(sealed)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if opened != plaintext {
+			t.Errorf("Decrypt = %q, want %q", opened, plaintext)
+		}
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	c := newTestCipher(t, "v1="+testKey(1), "v1")
+	first, _ := c.Encrypt("203.0.113.7")
+	second, _ := c.Encrypt("203.0.113.7")
+	if first == second {
+		t.Error("same plaintext encrypted to the same ciphertext")
+	}
+}
+
+func TestEmptyAndPlaintextValuesPassThrough(t *testing.T) {
+	c := newTestCipher(t, "v1="+testKey(1), "v1")
+	if sealed, err := c.Encrypt(""); err != nil || sealed != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v, want it empty", sealed, err)
+	}
+	// Rows written before encryption was enabled remain readable
+	if opened, err := c.Decrypt("203.0.113.7"); err != nil || opened != "203.0.113.7" {
+		t.Errorf("Decrypt of plaintext = %q, %v, want it unchanged", opened, err)
+	}
+}
+
+func TestTamperedCiphertextIsRejected(t *testing.T) {
+	c := newTestCipher(t, "v1="+testKey(1)+",v2="+testKey(2), "v1")
+	sealed, err := c.Encrypt("203.0.113.7")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, "enc:v1:"))
+	data[len(data)-1] ^= 1
+
+	for name, value := range map[string]string{
+		"flipped bit":        "enc:v1:" + base64.StdEncoding.EncodeToString(data),
+		"relabelled key":     strings.Replace(sealed, "enc:v1:", "enc:v2:", 1),
+		"missing version":    "enc:garbage",
+		"invalid base64":     "enc:v1:!!!",
+		"shorter than nonce": "enc:v1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+	} {
+		if _, err := c.Decrypt(value); err == nil {
+			t.Errorf("%s: decrypted, want an error", name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newTestCipher(t, "v1="+testKey(1), "v1")
+	sealed, err := old.Encrypt("203.0.113.7")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// The new key encrypts from now on, the old one still decrypts
+	rotated := newTestCipher(t, "v1="+testKey(1)+",v2="+testKey(2), "v2")
+	if opened, err := rotated.Decrypt(sealed); err != nil || opened != "203.0.113.7" {
+		t.Errorf("Decrypt of a v1 value = %q, %v after rotation", opened, err)
+	}
+	if !rotated.NeedsRotation(sealed) {
+		t.Error("v1 value does not need rotation to v2")
+	}
+	resealed, err := rotated.Encrypt("203.0.113.7")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(resealed, "enc:v2:") || rotated.NeedsRotation(resealed) {
+		t.Errorf("value %q not encrypted with the current key", resealed)
+	}
+	if !rotated.NeedsRotation("203.0.113.7") {
+		t.Error("plaintext does not need encrypting")
+	}
+	if rotated.NeedsRotation("") {
+		t.Error("empty value needs rotation")
+	}
+
+	// Once the old key is retired, its values cannot be read
+	retired := newTestCipher(t, "v2="+testKey(2), "v2")
+	if _, err := retired.Decrypt(sealed); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Errorf("Decrypt with the key retired = %v, want ErrUnknownKeyVersion", err)
+	}
+}
+
+func TestNewStaticKeyProviderRejectsInvalidSpecs(t *testing.T) {
+	tests := map[string]struct{ spec, current string }{
+		"current not configured": {"v1=" + testKey(1), "v2"},
+		"missing key":            {"v1", "v1"},
+		"empty version":          {"=" + testKey(1), "v1"},
+		"version with colon":     {"v:1=" + testKey(1), "v:1"},
+		"invalid base64":         {"v1=not base64", "v1"},
+		"short key":              {"v1=" + base64.StdEncoding.EncodeToString([]byte("sixteen byte key")), "v1"},
+	}
+	for name, tt := range tests {
+		if _, err := NewStaticKeyProvider(tt.spec, tt.current); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
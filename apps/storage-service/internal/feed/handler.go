@@ -0,0 +1,117 @@
+package feed
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+// Handler serves the feed over WebSocket. Clients filter it with the
+// account_id, status and min_risk query parameters, and only receive the
+// transactions of their tenant unless they are an admin.
+type Handler struct {
+	hub      *Hub
+	upgrader websocket.Upgrader
+}
+
+// NewHandler creates a feed handler for hub
+func NewHandler(hub *Hub) *Handler {
+	return &Handler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			// Clients authenticate with a bearer token rather than cookies,
+			// so a cross-origin page cannot ride on a user's session
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// ServeHTTP upgrades the request and streams matching transactions until the
+// client disconnects or falls behind
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := Filter{
+		AccountID: q.Get("account_id"),
+		Status:    q.Get("status"),
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+		filter.TenantID = claims.TenantScope(q.Get("tenant_id"))
+	}
+	if v := q.Get("min_risk"); v != "" {
+		minRisk, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "invalid min_risk", http.StatusBadRequest)
+			return
+		}
+		filter.MinRisk = minRisk
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+
+	c := h.hub.subscribe(filter)
+	go h.readLoop(conn, c)
+	h.writeLoop(conn, c)
+}
+
+// readLoop discards client messages, answering pings, until the connection
+// fails, then unsubscribes the client
+func (h *Handler) readLoop(conn *websocket.Conn, c *client) {
+	defer h.hub.unsubscribe(c)
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writeLoop sends buffered events and keepalive pings until the client's
+// buffer is closed or a write fails
+func (h *Handler) writeLoop(conn *websocket.Conn, c *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				code, reason := websocket.CloseNormalClosure, ""
+				if c.slow {
+					code, reason = websocket.ClosePolicyViolation, "client too slow"
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
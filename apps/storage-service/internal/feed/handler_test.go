@@ -0,0 +1,222 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+	"github.com/gorilla/websocket"
+)
+
+// serve serves h, feeding from hub, until the test ends and its clients
+// have gone, so the connection count is left as found
+func serve(t *testing.T, hub *Hub, h http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() {
+		waitForClients(t, hub, 0)
+		srv.Close()
+	})
+	return srv
+}
+
+// dial connects a test client to the feed served by srv with query
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/transactions?"+query, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v (%v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// next reads the next transaction sent to conn
+func next(t *testing.T, conn *websocket.Conn) *models.ProcessedTransaction {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var tx models.ProcessedTransaction
+	if err := conn.ReadJSON(&tx); err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+	return &tx
+}
+
+// clients returns the number of clients subscribed to hub
+func clients(hub *Hub) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.clients)
+}
+
+// waitForClients waits until hub has n clients subscribed
+func waitForClients(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clients(hub) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients subscribed, want %d", clients(hub), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFeedFiltersByQuery(t *testing.T) {
+	hub := NewHub(10, 10)
+	publish(t, hub, transaction("txn-0", "acct-1", "flagged", 0.95))
+	srv := serve(t, hub, NewHandler(hub))
+
+	risky := dial(t, srv, "min_risk=0.7&status=flagged")
+	acct := dial(t, srv, "account_id=acct-2")
+	waitForClients(t, hub, 2)
+
+	// A new client first replays the recent events it matches
+	if tx := next(t, risky); tx.ID != "txn-0" {
+		t.Errorf("replayed %s, want txn-0", tx.ID)
+	}
+
+	publish(t, hub, transaction("txn-1", "acct-1", "approved", 0.1))
+	publish(t, hub, transaction("txn-2", "acct-2", "flagged", 0.9))
+	publish(t, hub, transaction("txn-3", "acct-1", "flagged", 0.75))
+
+	for _, want := range []string{"txn-2", "txn-3"} {
+		if tx := next(t, risky); tx.ID != want {
+			t.Errorf("risky client received %s, want %s", tx.ID, want)
+		}
+	}
+	if tx := next(t, acct); tx.ID != "txn-2" {
+		t.Errorf("account client received %s, want txn-2", tx.ID)
+	}
+
+	// A closed client is unsubscribed
+	acct.Close()
+	waitForClients(t, hub, 1)
+}
+
+func TestFeedScopesToTheCallerTenant(t *testing.T) {
+	hub := NewHub(10, 10)
+	for _, tenantID := range []string{"unit-a", "unit-b"} {
+		tx := transaction("txn-"+tenantID, "acct-1", "approved", 0.5)
+		tx.TenantID = tenantID
+		publish(t, hub, tx)
+	}
+	// The claims the authentication middleware leaves on the upgrade request
+	withClaims := func(claims *auth.Claims) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewHandler(hub).ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		})
+	}
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		query  string
+		want   string
+	}{
+		{"tenant auditor", &auth.Claims{Roles: []string{"auditor"}, TenantID: "unit-b"}, "tenant_id=unit-a", "txn-unit-b"},
+		{"admin choosing a tenant", &auth.Claims{Roles: []string{"admin"}}, "tenant_id=unit-b", "txn-unit-b"},
+		{"admin of every tenant", &auth.Claims{Roles: []string{"admin"}}, "", "txn-unit-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, hub, withClaims(tt.claims))
+			if tx := next(t, dial(t, srv, tt.query)); tx.ID != tt.want {
+				t.Errorf("received %s, want %s", tx.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedRejectsInvalidMinRisk(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(NewHub(0, 1)))
+	defer srv.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/transactions?min_risk=high", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Dial = %v, %v, want 400", resp, err)
+	}
+}
+
+func TestFeedDisconnectsASlowClient(t *testing.T) {
+	hub := NewHub(0, 4)
+	srv := serve(t, hub, NewHandler(hub))
+
+	slow := dial(t, srv, "")
+	fast := dial(t, srv, "")
+	waitForClients(t, hub, 2)
+
+	// The fast client reads each event before the next is published, while
+	// the slow one never reads, until the socket buffers and then the slow
+	// client's send buffer are full
+	read := make(chan error)
+	go func() {
+		for {
+			fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err := fast.ReadMessage()
+			read <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+	tx := transaction("txn-1", "acct-1", "approved", 0.5)
+	tx.Merchant = strings.Repeat("x", 64<<10)
+	for published := 0; clients(hub) == 2; published++ {
+		if published == 10000 {
+			t.Fatal("slow client never disconnected")
+		}
+		publish(t, hub, tx)
+		if err := <-read; err != nil {
+			t.Fatalf("fast client: %v", err)
+		}
+	}
+	if clients(hub) != 1 {
+		t.Fatalf("%d clients subscribed, want the fast one", clients(hub))
+	}
+
+	// Draining the slow client reaches the close, with the reason
+	var closeErr *websocket.CloseError
+	for {
+		slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := slow.ReadMessage(); err != nil {
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("ReadMessage: %v, want a close", err)
+			}
+			break
+		}
+	}
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "client too slow" {
+		t.Errorf("close = %v, want a policy violation for a slow client", closeErr)
+	}
+
+	// Closing the fast client ends its reader
+	fast.Close()
+	<-read
+}
+
+func TestEventsAreSentAsPublished(t *testing.T) {
+	hub := NewHub(1, 1)
+	tx := transaction("txn-1", "acct-1", "approved", 0.5)
+	payload := []byte(`{"id":"txn-1","account_id":"acct-1","published":"as is"}`)
+	hub.Publish(tx, payload)
+
+	srv := serve(t, hub, NewHandler(hub))
+	conn := dial(t, srv, "")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded["published"] != "as is" {
+		t.Errorf("received %s, want the consumed payload unchanged", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package feed streams processed transactions to WebSocket clients as they
+// are consumed. Each client has a bounded send buffer; a client that falls
+// behind far enough to fill it is disconnected rather than slowing the
+// consumer or the other clients down.
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"storage-service/internal/handler"
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Filter selects the transactions a client receives. Zero fields match
+// every transaction.
+type Filter struct {
+	AccountID string
+	Status    string
+	MinRisk   float64
+	TenantID  *string
+}
+
+// Match reports whether tx passes the filter
+func (f Filter) Match(tx *models.ProcessedTransaction) bool {
+	if f.AccountID != "" && tx.AccountID != f.AccountID {
+		return false
+	}
+	if f.Status != "" && tx.Status != f.Status {
+		return false
+	}
+	if f.TenantID != nil && tx.TenantID != *f.TenantID {
+		return false
+	}
+	return tx.RiskScore >= f.MinRisk
+}
+
+// event is a transaction with the payload sent to clients
+type event struct {
+	tx      *models.ProcessedTransaction
+	payload []byte
+}
+
+// client is one connected feed subscriber
+type client struct {
+	filter Filter
+	send   chan []byte
+	slow   bool // set before send is closed when the client fell behind
+}
+
+// Hub fans transactions out to the connected clients and keeps the most
+// recent ones for replay to new clients
+type Hub struct {
+	mu         sync.Mutex
+	clients    map[*client]struct{}
+	replay     []event // ring of the last replaySize events
+	next       int
+	bufferSize int
+}
+
+// NewHub creates a hub replaying up to replaySize events to new clients and
+// buffering up to bufferSize events per client
+func NewHub(replaySize, bufferSize int) *Hub {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &Hub{
+		clients:    make(map[*client]struct{}),
+		replay:     make([]event, 0, replaySize),
+		bufferSize: bufferSize,
+	}
+}
+
+// Publish sends a transaction to every client whose filter it matches.
+// Clients whose buffer is full are disconnected.
+func (h *Hub) Publish(tx *models.ProcessedTransaction, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remember(event{tx: tx, payload: payload})
+
+	for c := range h.clients {
+		if !c.filter.Match(tx) {
+			continue
+		}
+		select {
+		case c.send <- payload:
+		default:
+			metrics.RecordFeedSlowClient(len(c.send) + 1)
+			c.slow = true
+			h.remove(c)
+		}
+	}
+}
+
+// Consume is the consumer handler feeding the hub. Alerts and undecodable
+// messages are skipped: the feed is best effort and must never hold the consumer back.
+func (h *Hub) Consume(ctx context.Context, m kafka.Message) error {
+	if !handler.IsTransaction(m) {
+		return nil
+	}
+	var tx models.ProcessedTransaction
+	if err := json.Unmarshal(m.Value, &tx); err != nil {
+		log.Printf("feed: skipping undecodable message at offset %d: %v", m.Offset, err)
+		return nil
+	}
+	h.Publish(&tx, m.Value)
+	return nil
+}
+
+// subscribe registers a client, its buffer primed with the replayed events
+// that match its filter, at most a buffer's worth
+func (h *Hub) subscribe(filter Filter) *client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := &client{filter: filter, send: make(chan []byte, h.bufferSize)}
+
+	var matched [][]byte
+	for _, e := range h.recent() {
+		if filter.Match(e.tx) {
+			matched = append(matched, e.payload)
+		}
+	}
+	if len(matched) > h.bufferSize {
+		matched = matched[len(matched)-h.bufferSize:]
+	}
+	for _, payload := range matched {
+		c.send <- payload
+	}
+
+	h.clients[c] = struct{}{}
+	metrics.SetFeedConnections(len(h.clients))
+	return c
+}
+
+// unsubscribe removes a client, if the hub has not already
+func (h *Hub) unsubscribe(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+// remove drops a registered client and closes its buffer. h.mu must be held.
+func (h *Hub) remove(c *client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	close(c.send)
+	metrics.SetFeedConnections(len(h.clients))
+}
+
+// remember adds an event to the replay ring. h.mu must be held.
+func (h *Hub) remember(e event) {
+	if cap(h.replay) == 0 {
+		return
+	}
+	if len(h.replay) < cap(h.replay) {
+		h.replay = append(h.replay, e)
+		return
+	}
+	h.replay[h.next] = e
+	h.next = (h.next + 1) % len(h.replay)
+}
+
+// recent returns the replay ring oldest first. h.mu must be held.
+func (h *Hub) recent() []event {
+	if len(h.replay) < cap(h.replay) {
+		return h.replay
+	}
+	return append(append([]event(nil), h.replay[h.next:]...), h.replay[:h.next]...)
+}
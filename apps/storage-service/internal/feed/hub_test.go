@@ -0,0 +1,239 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"storage-service/internal/models"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// metricValue returns the value of the unlabelled gauge or counter name in
+// the default registry, 0 when it was never set
+func metricValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name || len(family.GetMetric()) == 0 {
+			continue
+		}
+		metric := family.GetMetric()[0]
+		if metric.GetGauge() != nil {
+			return metric.GetGauge().GetValue()
+		}
+		return metric.GetCounter().GetValue()
+	}
+	return 0
+}
+
+// transaction returns a processed transaction of account with risk
+func transaction(id, account, status string, risk float64) *models.ProcessedTransaction {
+	return &models.ProcessedTransaction{
+		Transaction: shared.Transaction{ID: id, AccountID: account, Status: status},
+		RiskScore:   risk,
+	}
+}
+
+// publish publishes tx to hub with its JSON payload
+func publish(t *testing.T, hub *Hub, tx *models.ProcessedTransaction) {
+	t.Helper()
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	hub.Publish(tx, payload)
+}
+
+// received returns the IDs of the transactions buffered for c
+func received(t *testing.T, c *client) []string {
+	t.Helper()
+	var ids []string
+	for {
+		select {
+		case payload, ok := <-c.send:
+			if !ok {
+				return ids
+			}
+			var tx models.ProcessedTransaction
+			if err := json.Unmarshal(payload, &tx); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			ids = append(ids, tx.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFilterMatch(t *testing.T) {
+	unitA := "unit-a"
+	tx := transaction("txn-1", "acct-1", "flagged", 0.8)
+	tx.TenantID = "unit-a"
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"no filter", Filter{}, true},
+		{"account", Filter{AccountID: "acct-1"}, true},
+		{"other account", Filter{AccountID: "acct-2"}, false},
+		{"status", Filter{Status: "flagged"}, true},
+		{"other status", Filter{Status: "approved"}, false},
+		{"risk at the minimum", Filter{MinRisk: 0.8}, true},
+		{"risk below the minimum", Filter{MinRisk: 0.9}, false},
+		{"tenant", Filter{TenantID: &unitA}, true},
+		{"other tenant", Filter{TenantID: new(string)}, false},
+		{"every field", Filter{AccountID: "acct-1", Status: "flagged", MinRisk: 0.5, TenantID: &unitA}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(tx); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishFiltersPerClient(t *testing.T) {
+	hub := NewHub(0, 10)
+	risky := hub.subscribe(Filter{MinRisk: 0.7})
+	acct := hub.subscribe(Filter{AccountID: "acct-2"})
+	defer hub.unsubscribe(risky)
+	defer hub.unsubscribe(acct)
+
+	publish(t, hub, transaction("txn-1", "acct-1", "approved", 0.1))
+	publish(t, hub, transaction("txn-2", "acct-2", "flagged", 0.9))
+	publish(t, hub, transaction("txn-3", "acct-1", "flagged", 0.75))
+
+	if got := received(t, risky); !equal(got, []string{"txn-2", "txn-3"}) {
+		t.Errorf("risky client received %v", got)
+	}
+	if got := received(t, acct); !equal(got, []string{"txn-2"}) {
+		t.Errorf("account client received %v", got)
+	}
+}
+
+func TestReplayIsCappedAndFiltered(t *testing.T) {
+	hub := NewHub(3, 10)
+	for i, account := range []string{"acct-1", "acct-2", "acct-1", "acct-1", "acct-2"} {
+		publish(t, hub, transaction("txn-"+string(rune('1'+i)), account, "approved", 0.5))
+	}
+
+	// Only the last three events are kept, replayed oldest first
+	all := hub.subscribe(Filter{})
+	defer hub.unsubscribe(all)
+	if got := received(t, all); !equal(got, []string{"txn-3", "txn-4", "txn-5"}) {
+		t.Errorf("replayed %v, want the last 3 events", got)
+	}
+	acct := hub.subscribe(Filter{AccountID: "acct-1"})
+	defer hub.unsubscribe(acct)
+	if got := received(t, acct); !equal(got, []string{"txn-3", "txn-4"}) {
+		t.Errorf("replayed %v, want the account's recent events", got)
+	}
+
+	// The replay never exceeds the client's buffer
+	small := NewHub(5, 2)
+	for _, id := range []string{"txn-1", "txn-2", "txn-3"} {
+		publish(t, small, transaction(id, "acct-1", "approved", 0.5))
+	}
+	c := small.subscribe(Filter{})
+	defer small.unsubscribe(c)
+	if got := received(t, c); !equal(got, []string{"txn-2", "txn-3"}) {
+		t.Errorf("replayed %v, want the 2 most recent", got)
+	}
+
+	none := NewHub(0, 10)
+	publish(t, none, transaction("txn-1", "acct-1", "approved", 0.5))
+	c = none.subscribe(Filter{})
+	defer none.unsubscribe(c)
+	if got := received(t, c); len(got) != 0 {
+		t.Errorf("replayed %v with replay off", got)
+	}
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	hub := NewHub(0, 2)
+	slow := hub.subscribe(Filter{})
+	fast := hub.subscribe(Filter{})
+	defer hub.unsubscribe(fast)
+	if got := metricValue(t, "storage_feed_connections"); got != 2 {
+		t.Errorf("connections = %v, want 2", got)
+	}
+	dropped := metricValue(t, "storage_feed_events_dropped_total")
+	disconnects := metricValue(t, "storage_feed_slow_client_disconnects_total")
+
+	publish(t, hub, transaction("txn-1", "acct-1", "approved", 0.5))
+	publish(t, hub, transaction("txn-2", "acct-1", "approved", 0.5))
+	received(t, fast)
+	// The third event overflows the slow client's buffer
+	publish(t, hub, transaction("txn-3", "acct-1", "approved", 0.5))
+
+	if got := received(t, slow); !equal(got, []string{"txn-1", "txn-2"}) || !slow.slow {
+		t.Errorf("slow client received %v, slow = %v, want the buffer then a close", got, slow.slow)
+	}
+	if _, ok := <-slow.send; ok {
+		t.Error("slow client's buffer is still open")
+	}
+	if got := received(t, fast); !equal(got, []string{"txn-3"}) {
+		t.Errorf("the other client received %v, want it undisturbed", got)
+	}
+	if got := metricValue(t, "storage_feed_connections"); got != 1 {
+		t.Errorf("connections = %v, want 1", got)
+	}
+	if got := metricValue(t, "storage_feed_events_dropped_total") - dropped; got != 3 {
+		t.Errorf("%v events dropped, want the 2 buffered and the overflowing one", got)
+	}
+	if got := metricValue(t, "storage_feed_slow_client_disconnects_total") - disconnects; got != 1 {
+		t.Errorf("%v slow client disconnects, want 1", got)
+	}
+
+	// Unsubscribing after the hub dropped the client is harmless
+	hub.unsubscribe(slow)
+}
+
+func TestConsumeSkipsAlertsAndUndecodableMessages(t *testing.T) {
+	hub := NewHub(0, 10)
+	c := hub.subscribe(Filter{})
+	defer hub.unsubscribe(c)
+
+	payload, err := json.Marshal(transaction("txn-1", "acct-1", "approved", 0.5))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	header := func(version string) []kafka.Header {
+		return []kafka.Header{{Key: models.SchemaVersionHeader, Value: []byte(version)}}
+	}
+	for _, m := range []kafka.Message{
+		{Value: payload},
+		{Value: payload, Headers: header(models.SchemaVersionTransaction)},
+		{Value: []byte(`{"id":"alert-1"}`), Headers: header(models.SchemaVersionAlert)},
+		{Value: []byte("not json")},
+	} {
+		if err := hub.Consume(context.Background(), m); err != nil {
+			t.Errorf("Consume: %v", err)
+		}
+	}
+
+	if got := received(t, c); !equal(got, []string{"txn-1", "txn-1"}) {
+		t.Errorf("received %v, want only the transactions", got)
+	}
+}
@@ -3,24 +3,72 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"storage-service/internal/models"
-	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
 )
 
+// TransactionStore persists processed transactions
+type TransactionStore interface {
+	StoreTransaction(ctx context.Context, txn *models.StoredTransaction) error
+}
+
+// AuditStore appends decision audits
+type AuditStore interface {
+	StoreDecisionAudit(ctx context.Context, audit *models.DecisionAudit) error
+}
+
 type TransactionHandler struct {
-	store *storage.Storage
+	store TransactionStore
 }
 
-func NewTransactionHandler(store *storage.Storage) *TransactionHandler {
+func NewTransactionHandler(store TransactionStore) *TransactionHandler {
 	return &TransactionHandler{store: store}
 }
 
-// Handle satisfies consumer.Handler by decoding a processed transaction and persisting it
+// IsTransaction reports whether m holds a processed transaction. The input
+// topic also carries alerts for the alert service, such as consumer lag
+// alerts, which are not stored.
+func IsTransaction(m kafka.Message) bool {
+	for _, h := range m.Headers {
+		if h.Key == models.SchemaVersionHeader {
+			return string(h.Value) == models.SchemaVersionTransaction
+		}
+	}
+	return true
+}
+
+// Handle satisfies consumer.Handler by decoding a processed transaction and
+// persisting it. A message that cannot be decoded fails permanently.
 func (h *TransactionHandler) Handle(ctx context.Context, message []byte) error {
-	var tx models.ProcessedTransaction
+	var tx models.StoredTransaction
 	if err := json.Unmarshal(message, &tx); err != nil {
-		return err
+		return consumer.Permanent(fmt.Errorf("failed to decode transaction: %w", err))
+	}
+	return h.store.StoreTransaction(ctx, &tx)
+}
+
+// AuditHandler persists the decision audits of the processing service
+type AuditHandler struct {
+	store AuditStore
+}
+
+func NewAuditHandler(store AuditStore) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// Handle satisfies consumer.Handler by decoding a decision audit and
+// appending it. A message that cannot be decoded fails permanently.
+func (h *AuditHandler) Handle(ctx context.Context, m kafka.Message) error {
+	var audit models.DecisionAudit
+	if err := json.Unmarshal(m.Value, &audit); err != nil {
+		return consumer.Permanent(fmt.Errorf("failed to decode decision audit: %w", err))
+	}
+	if audit.TransactionID == "" {
+		return consumer.Permanent(fmt.Errorf("decision audit without transaction ID"))
 	}
-	return h.store.SaveProcessedTransaction(ctx, &tx)
+	return h.store.StoreDecisionAudit(ctx, &audit)
 }
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/consumer"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeStore holds the transactions and decision audits it is given in
+// memory, failing every write with err when it is set
+type fakeStore struct {
+	mu           sync.Mutex
+	transactions []*models.StoredTransaction
+	audits       []*models.DecisionAudit
+	err          error
+}
+
+func (s *fakeStore) StoreTransaction(_ context.Context, txn *models.StoredTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.transactions = append(s.transactions, txn)
+	return nil
+}
+
+func (s *fakeStore) StoreDecisionAudit(_ context.Context, audit *models.DecisionAudit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.audits = append(s.audits, audit)
+	return nil
+}
+
+func (s *fakeStore) stored() ([]*models.StoredTransaction, []*models.DecisionAudit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.StoredTransaction(nil), s.transactions...), append([]*models.DecisionAudit(nil), s.audits...)
+}
+
+func TestTransactionsAreStored(t *testing.T) {
+	store := &fakeStore{}
+	h := NewTransactionHandler(store)
+	message := `{"id": "txn-1", "account_id": "acct-1", "amount": 12.5, "currency": "USD", "risk_score": 0.1, "status": "approved"}`
+	if err := h.Handle(context.Background(), []byte(message)); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	transactions, _ := store.stored()
+	if len(transactions) != 1 {
+		t.Fatalf("%d transactions stored, want 1", len(transactions))
+	}
+	if txn := transactions[0]; txn.ID != "txn-1" || txn.AccountID != "acct-1" || txn.Amount != 12.5 || txn.Status != "approved" {
+		t.Errorf("stored %+v, want txn-1 as decoded", txn.ProcessedTransaction)
+	}
+}
+
+func TestTransactionStoreFailuresAreRetried(t *testing.T) {
+	store := &fakeStore{err: errors.New("connection refused")}
+	err := NewTransactionHandler(store).Handle(context.Background(), []byte(`{"id": "txn-1"}`))
+	if err == nil || consumer.IsPermanent(err) {
+		t.Errorf("Handle = %v, want a failure to retry", err)
+	}
+}
+
+func TestUndecodableTransactionsFailPermanently(t *testing.T) {
+	store := &fakeStore{}
+	err := NewTransactionHandler(store).Handle(context.Background(), []byte(`{"id":`))
+	if !consumer.IsPermanent(err) {
+		t.Errorf("Handle = %v, want a permanent failure", err)
+	}
+	if transactions, _ := store.stored(); len(transactions) != 0 {
+		t.Errorf("%d transactions stored, want none", len(transactions))
+	}
+}
+
+func TestAuditsAreStored(t *testing.T) {
+	store := &fakeStore{}
+	m := kafka.Message{Value: []byte(`{"transaction_id": "txn-1", "decision": "approved"}`)}
+	if err := NewAuditHandler(store).Handle(context.Background(), m); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if _, audits := store.stored(); len(audits) != 1 || audits[0].TransactionID != "txn-1" {
+		t.Errorf("stored %+v, want the audit of txn-1", audits)
+	}
+
+	store.err = errors.New("connection refused")
+	if err := NewAuditHandler(store).Handle(context.Background(), m); err == nil || consumer.IsPermanent(err) {
+		t.Errorf("Handle = %v, want a failure to retry", err)
+	}
+}
+
+func TestUndecodableAuditsFailPermanently(t *testing.T) {
+	// Both are refused before the store is reached
+	store := &fakeStore{}
+	h := NewAuditHandler(store)
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"malformed", `{"transaction_id":`},
+		{"no transaction ID", `{"decision":"approved"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.Handle(context.Background(), kafka.Message{Value: []byte(tt.value)}); !consumer.IsPermanent(err) {
+				t.Errorf("Handle = %v, want a permanent failure", err)
+			}
+		})
+	}
+	if _, audits := store.stored(); len(audits) != 0 {
+		t.Errorf("%d audits stored, want none", len(audits))
+	}
+}
@@ -0,0 +1,532 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buckets"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Cache names used as label values
+const (
+	CacheTransaction = "transaction"
+	CacheSummary     = "summary"
+)
+
+// Database pools used as label values
+const (
+	PoolPrimary = "primary"
+	PoolReplica = "replica"
+)
+
+// Cache lookup results used as label values
+const (
+	CacheHit         = "hit"
+	CacheMiss        = "miss"
+	CacheNegativeHit = "negative_hit"
+	CacheError       = "error"
+)
+
+var (
+	// Build information
+	buildInfo = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "storage_build_info",
+			Help:        "Build information of the running binary, always 1",
+			ConstLabels: buildinfo.Labels(),
+		},
+	)
+
+	// Cache metrics
+	cacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_cache_requests_total",
+			Help: "Total number of cache lookups by cache and result",
+		},
+		[]string{"cache", "result"},
+	)
+
+	cacheInvalidationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_cache_invalidations_total",
+			Help: "Total number of explicit cache invalidations",
+		},
+		[]string{"cache"},
+	)
+
+	// Consumer metrics
+	consumerErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_consumer_errors_total",
+			Help: "Total number of Kafka consumer errors, by stage",
+		},
+		[]string{"stage"},
+	)
+
+	consumerQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_consumer_worker_queue_depth",
+			Help: "Number of messages waiting in each consumer worker queue",
+		},
+		[]string{"worker"},
+	)
+
+	consumerDeadLettered = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_consumer_dead_lettered_total",
+			Help: "Total number of transactions parked on the dead letter topic",
+		},
+	)
+
+	consumerOversized = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_consumer_oversized_skipped_total",
+			Help: "Total number of messages skipped for exceeding the fetch size limit",
+		},
+	)
+
+	consumerAbandoned = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_consumer_abandoned_total",
+			Help: "Total number of shutdown drains that timed out, abandoning the messages in flight",
+		},
+	)
+
+	consumerLag = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_consumer_lag",
+			Help: "Number of processed transactions not yet consumed",
+		},
+	)
+
+	consumerPartitionLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_consumer_partition_lag",
+			Help: "Number of processed transactions not yet committed per partition",
+		},
+		[]string{"partition"},
+	)
+
+	consumerPaused = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_consumer_paused",
+			Help: "Whether consumption is paused by an operator (1) or running (0)",
+		},
+	)
+
+	// Database routing metrics
+	dbReadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_db_reads_total",
+			Help: "Total number of database reads by pool",
+		},
+		[]string{"pool"},
+	)
+
+	queryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "storage_query_duration_seconds",
+			Help:    "Time taken by database statements, including reading their rows, by query",
+			Buckets: buckets.For("storage_query_duration_seconds", prometheus.ExponentialBuckets(0.001, 2, 15)),
+		},
+		[]string{"query"},
+	)
+
+	slowQueriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_slow_queries_total",
+			Help: "Total number of database statements slower than the slow query threshold, by query",
+		},
+		[]string{"query"},
+	)
+
+	replicaHealthy = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_replica_healthy",
+			Help: "Whether the read replica is reachable (1) or reads fall back to primary (0)",
+		},
+	)
+
+	redisUp = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_redis_up",
+			Help: "Whether the Redis cache is reachable (1) or not (0)",
+		},
+	)
+
+	// Outbox metrics
+	outboxDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_outbox_depth",
+			Help: "Number of outbox events waiting to be published",
+		},
+	)
+
+	outboxEventsPublished = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_outbox_events_published_total",
+			Help: "Total number of outbox events published",
+		},
+	)
+
+	outboxPublishLag = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "storage_outbox_publish_lag_seconds",
+			Help:    "Time between an outbox event being written and published",
+			Buckets: buckets.For("storage_outbox_publish_lag_seconds", prometheus.DefBuckets),
+		},
+	)
+
+	// Callback metrics
+	callbacksPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_callbacks_pending",
+			Help: "Number of transaction callbacks waiting to be delivered",
+		},
+	)
+
+	callbackAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_callback_attempts_total",
+			Help: "Total number of transaction callback delivery attempts, by outcome",
+		},
+		[]string{"result"},
+	)
+
+	callbackDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "storage_callback_duration_seconds",
+			Help:    "Duration of transaction callback delivery attempts",
+			Buckets: buckets.For("storage_callback_duration_seconds", prometheus.DefBuckets),
+		},
+	)
+
+	reconciliationMissing = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_reconciliation_missing_transactions",
+			Help: "Processed transactions found missing from storage by the last reconciliation run and not repaired",
+		},
+	)
+
+	// Risk recomputation metrics
+	riskAccountsRecomputed = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_risk_accounts_recomputed_total",
+			Help: "Total number of accounts whose risk metrics were recomputed",
+		},
+	)
+
+	riskRecomputeProgress = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_risk_recompute_progress_accounts",
+			Help: "Number of accounts recomputed so far by the running or last risk recomputation",
+		},
+	)
+
+	riskRecomputeDuration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_risk_recompute_duration_seconds",
+			Help: "Duration of the last completed risk recomputation",
+		},
+	)
+
+	riskRecomputeLastSuccess = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_risk_recompute_last_success_timestamp_seconds",
+			Help: "Unix time the last risk recomputation completed",
+		},
+	)
+
+	// Integrity verification metrics
+	integrityVerifications = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_integrity_verifications_total",
+			Help: "Total number of account integrity chains verified, by result (valid, broken, error)",
+		},
+		[]string{"result"},
+	)
+
+	integrityBrokenChains = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_integrity_broken_chains",
+			Help: "Number of account integrity chains found broken by the last completed verification run",
+		},
+	)
+
+	integrityLastSuccess = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_integrity_verify_last_success_timestamp_seconds",
+			Help: "Unix time the last integrity verification run completed",
+		},
+	)
+
+	// Live feed metrics
+	feedConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_feed_connections",
+			Help: "Number of connected live feed clients",
+		},
+	)
+
+	feedEventsDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_feed_events_dropped_total",
+			Help: "Total number of live feed events not delivered to a client that fell behind",
+		},
+	)
+
+	feedSlowClients = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_feed_slow_client_disconnects_total",
+			Help: "Total number of live feed clients disconnected for falling behind",
+		},
+	)
+
+	// Export metrics
+	exportedTransactions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_exported_transactions_total",
+			Help: "Total number of transactions written to bulk exports by format",
+		},
+		[]string{"format"},
+	)
+
+	rateLookupErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "storage_exchange_rate_lookup_errors_total",
+			Help: "Total number of stats totals left out of the base currency for want of an exchange rate",
+		},
+	)
+
+	// Pipeline latency metrics
+	pipelineEndToEnd = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pipeline_end_to_end_seconds",
+			Help:    "Time from a transaction being accepted by the ingestion service to its row being committed",
+			Buckets: buckets.For("pipeline_end_to_end_seconds", prometheus.ExponentialBuckets(0.005, 2, 15)),
+		},
+		[]string{"risk_level", "status"},
+	)
+
+	pipelineClockSkew = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "pipeline_clock_skew_total",
+			Help: "Total number of transactions committed before their ingestion time, observed as zero latency",
+		},
+	)
+
+	// Fault injection metrics
+	chaosFaultsInjected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_chaos_faults_injected_total",
+			Help: "Total number of faults injected by chaos mode",
+		},
+		[]string{"target", "mode"},
+	)
+)
+
+// RecordCacheRequest records the result of a cache lookup
+func RecordCacheRequest(cache, result string) {
+	cacheRequestsTotal.WithLabelValues(cache, result).Inc()
+}
+
+// RecordCacheInvalidation records an explicit cache invalidation
+func RecordCacheInvalidation(cache string) {
+	cacheInvalidationsTotal.WithLabelValues(cache).Inc()
+}
+
+// ConsumerMetrics reports the Kafka consumer's measurements as storage
+// service metrics
+type ConsumerMetrics struct{}
+
+// RecordError records a consumer error at the given stage
+func (ConsumerMetrics) RecordError(stage string) { consumerErrors.WithLabelValues(stage).Inc() }
+
+// SetQueueDepth records the queue depth of a consumer worker
+func (ConsumerMetrics) SetQueueDepth(worker string, depth int) {
+	consumerQueueDepth.WithLabelValues(worker).Set(float64(depth))
+}
+
+// RecordDeadLettered records a transaction parked on the dead letter topic
+func (ConsumerMetrics) RecordDeadLettered() { consumerDeadLettered.Inc() }
+
+// RecordAbandoned records a shutdown drain that timed out
+func (ConsumerMetrics) RecordAbandoned() { consumerAbandoned.Inc() }
+
+// RecordOversized records a message skipped for its size
+func (ConsumerMetrics) RecordOversized() { consumerOversized.Inc() }
+
+// SetLag records the consumer lag
+func (ConsumerMetrics) SetLag(lag int64) { consumerLag.Set(float64(lag)) }
+
+// SetPartitionLag records the lag of a partition
+func (ConsumerMetrics) SetPartitionLag(partition int, lag int64) {
+	consumerPartitionLag.WithLabelValues(strconv.Itoa(partition)).Set(float64(lag))
+}
+
+// SetPaused records whether consumption is paused
+func (ConsumerMetrics) SetPaused(paused bool) {
+	if paused {
+		consumerPaused.Set(1)
+	} else {
+		consumerPaused.Set(0)
+	}
+}
+
+// SetOutboxDepth records the number of unpublished outbox events
+func SetOutboxDepth(depth int64) {
+	outboxDepth.Set(float64(depth))
+}
+
+// RecordOutboxPublished records a published outbox event and its lag
+func RecordOutboxPublished(lag time.Duration) {
+	outboxEventsPublished.Inc()
+	outboxPublishLag.Observe(lag.Seconds())
+}
+
+// RecordDBRead records a read routed to a database pool
+func RecordDBRead(pool string) {
+	dbReadsTotal.WithLabelValues(pool).Inc()
+}
+
+// ObserveQuery records the duration of a database statement
+func ObserveQuery(query string, duration time.Duration) {
+	queryDuration.WithLabelValues(query).Observe(duration.Seconds())
+}
+
+// RecordSlowQuery records a database statement slower than the threshold
+func RecordSlowQuery(query string) {
+	slowQueriesTotal.WithLabelValues(query).Inc()
+}
+
+// SetReplicaHealthy records the health of the read replica
+func SetReplicaHealthy(healthy bool) {
+	if healthy {
+		replicaHealthy.Set(1)
+	} else {
+		replicaHealthy.Set(0)
+	}
+}
+
+// SetRedisUp records whether the Redis cache is reachable
+func SetRedisUp(up bool) {
+	if up {
+		redisUp.Set(1)
+	} else {
+		redisUp.Set(0)
+	}
+}
+
+// SetReconciliationMissing records the unrepaired gap found by the last reconciliation
+func SetReconciliationMissing(missing int64) {
+	reconciliationMissing.Set(float64(missing))
+}
+
+// RecordRiskRecomputeBatch records a batch of accounts recomputed, with the
+// number recomputed so far in the run
+func RecordRiskRecomputeBatch(accounts, progress int) {
+	riskAccountsRecomputed.Add(float64(accounts))
+	riskRecomputeProgress.Set(float64(progress))
+}
+
+// RecordRiskRecomputeDone records a completed risk recomputation
+func RecordRiskRecomputeDone(duration time.Duration) {
+	riskRecomputeDuration.Set(duration.Seconds())
+	riskRecomputeLastSuccess.SetToCurrentTime()
+}
+
+// Integrity verification results
+const (
+	IntegrityValid  = "valid"
+	IntegrityBroken = "broken"
+	IntegrityError  = "error"
+)
+
+// RecordIntegrityVerification records the verification of an account's
+// integrity chain
+func RecordIntegrityVerification(result string) {
+	integrityVerifications.WithLabelValues(result).Inc()
+}
+
+// RecordIntegrityRunDone records a completed verification of every chain,
+// with the number found broken
+func RecordIntegrityRunDone(broken int) {
+	integrityBrokenChains.Set(float64(broken))
+	integrityLastSuccess.SetToCurrentTime()
+}
+
+// SetFeedConnections records the number of connected live feed clients
+func SetFeedConnections(n int) {
+	feedConnections.Set(float64(n))
+}
+
+// RecordFeedSlowClient records a live feed client disconnected for falling
+// behind, with the events it was never sent
+func RecordFeedSlowClient(dropped int) {
+	feedSlowClients.Inc()
+	feedEventsDropped.Add(float64(dropped))
+}
+
+// Callback attempt outcomes
+const (
+	CallbackDelivered = "delivered"
+	CallbackRetry     = "retry"
+	CallbackDead      = "dead"
+)
+
+// SetCallbacksPending records the number of callbacks waiting to be
+// delivered
+func SetCallbacksPending(n int64) {
+	callbacksPending.Set(float64(n))
+}
+
+// RecordCallbackAttempt records a callback delivery attempt, its outcome
+// and duration
+func RecordCallbackAttempt(result string, duration time.Duration) {
+	callbackAttempts.WithLabelValues(result).Inc()
+	callbackDuration.Observe(duration.Seconds())
+}
+
+// RecordExported records transactions written to a bulk export
+func RecordExported(format string, n int) {
+	exportedTransactions.WithLabelValues(format).Add(float64(n))
+}
+
+// RecordRateLookupError records a total that could not be converted to the
+// base currency
+func RecordRateLookupError() {
+	rateLookupErrors.Inc()
+}
+
+// ObservePipelineLatency records the end-to-end latency of a transaction
+// committed at storedAt, with its ID as the exemplar. A negative latency,
+// from clocks skewed between hosts, is counted and observed as zero.
+func ObservePipelineLatency(transactionID, riskLevel, status string, ingestedAt, storedAt time.Time) {
+	latency := storedAt.Sub(ingestedAt).Seconds()
+	if latency < 0 {
+		pipelineClockSkew.Inc()
+		latency = 0
+	}
+	observer := pipelineEndToEnd.WithLabelValues(riskLevel, status)
+	if exemplar, ok := observer.(prometheus.ExemplarObserver); ok && transactionID != "" {
+		exemplar.ObserveWithExemplar(latency, prometheus.Labels{"transaction_id": transactionID})
+		return
+	}
+	observer.Observe(latency)
+}
+
+// ChaosMetrics reports injected faults as storage service metrics
+type ChaosMetrics struct{}
+
+// RecordFault records an injected fault
+func (ChaosMetrics) RecordFault(target, mode string) {
+	chaosFaultsInjected.WithLabelValues(target, mode).Inc()
+}
+
+// SetBuildInfo exports the build_info gauge
+func SetBuildInfo() {
+	buildInfo.Set(1)
+}
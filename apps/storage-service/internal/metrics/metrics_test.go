@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogram returns the sample count and sum of the histogram name with
+// labels in the default registry, and the transaction IDs of its exemplars
+func histogram(t *testing.T, name string, labels map[string]string) (uint64, float64, []string) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			var exemplars []string
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				for _, label := range bucket.GetExemplar().GetLabel() {
+					exemplars = append(exemplars, label.GetValue())
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum(), exemplars
+		}
+	}
+	return 0, 0, nil
+}
+
+func TestObservePipelineLatency(t *testing.T) {
+	labels := map[string]string{"risk_level": "high", "status": "flagged"}
+	ingested := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	ObservePipelineLatency("txn-1", "high", "flagged", ingested, ingested.Add(250*time.Millisecond))
+	ObservePipelineLatency("txn-2", "high", "flagged", ingested, ingested.Add(4*time.Second))
+
+	count, sum, exemplars := histogram(t, "pipeline_end_to_end_seconds", labels)
+	if count != 2 || sum != 4.25 {
+		t.Errorf("pipeline latency = %d samples summing %vs, want 2 summing 4.25s", count, sum)
+	}
+	// Each lands in its own bucket, whose exemplar names the transaction
+	if strings.Join(exemplars, ",") != "txn-1,txn-2" {
+		t.Errorf("exemplars = %v, want txn-1 and txn-2", exemplars)
+	}
+
+	// A row committed before its ingestion time, by the skewed clocks, is
+	// observed as zero
+	skew := testutil.ToFloat64(pipelineClockSkew)
+	ObservePipelineLatency("txn-3", "high", "flagged", ingested, ingested.Add(-time.Second))
+	if count, sum, _ := histogram(t, "pipeline_end_to_end_seconds", labels); count != 3 || sum != 4.25 {
+		t.Errorf("pipeline latency = %d samples summing %vs, want the skewed one observed as zero", count, sum)
+	}
+	if got := testutil.ToFloat64(pipelineClockSkew) - skew; got != 1 {
+		t.Errorf("clock skew = %v, want 1", got)
+	}
+}
+
+func TestBuildInfoGauge(t *testing.T) {
+	SetBuildInfo()
+
+	want := `# HELP storage_build_info Build information of the running binary, always 1
+# TYPE storage_build_info gauge
+storage_build_info{goversion="` + runtime.Version() + `",revision="unknown",version="dev"} 1
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want), "storage_build_info"); err != nil {
+		t.Error(err)
+	}
+}
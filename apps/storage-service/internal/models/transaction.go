@@ -2,53 +2,107 @@ package models
 
 import (
 	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
 )
 
-// StoredTransaction represents a transaction stored in the database
+// StoredTransaction represents a transaction stored in the database: the
+// processed transaction plus storage metadata
 type StoredTransaction struct {
-	ID             string            `json:"id" db:"id"`
-	IdempotencyKey string            `json:"idempotency_key" db:"idempotency_key"`
-	AccountID      string            `json:"account_id" db:"account_id"`
-	UserID         string            `json:"user_id" db:"user_id"`
-	Amount         float64           `json:"amount" db:"amount"`
-	Currency       string            `json:"currency" db:"currency"`
-	Type           string            `json:"type" db:"type"`
-	Category       string            `json:"category" db:"category"`
-	Merchant       string            `json:"merchant" db:"merchant"`
-	Reference      string            `json:"reference" db:"reference"`
-	Status         string            `json:"status" db:"status"`
-	Timestamp      time.Time         `json:"timestamp" db:"timestamp"`
-	Metadata       map[string]string `json:"metadata" db:"metadata"`
-
-	// Processing results
-	RiskScore       float64 `json:"risk_score" db:"risk_score"`
-	RiskLevel       string  `json:"risk_level" db:"risk_level"`
-	IsApproved      bool    `json:"is_approved" db:"is_approved"`
-	RejectionReason string  `json:"rejection_reason" db:"rejection_reason"`
-
-	// Business validation results
-	IsValid          bool     `json:"is_valid" db:"is_valid"`
-	ValidationErrors []string `json:"validation_errors" db:"validation_errors"`
-
-	// Enrichment data
-	Country    string `json:"country" db:"country"`
-	IPAddress  string `json:"ip_address" db:"ip_address"`
-	DeviceInfo string `json:"device_info" db:"device_info"`
-
-	// Processing metadata
-	ProcessedAt    time.Time     `json:"processed_at" db:"processed_at"`
-	ProcessingTime time.Duration `json:"processing_time" db:"processing_time"`
-	ProcessorID    string        `json:"processor_id" db:"processor_id"`
+	shared.ProcessedTransaction
+
+	// Unassessed is set on a transaction never assessed for risk, such as
+	// one backfilled from a legacy system: its risk score, risk level,
+	// approval and rejection reason are stored as NULL rather than zero
+	Unassessed bool `json:"-" db:"-"`
 
 	// Storage metadata
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// TransactionWithRefunds is a stored transaction and the refunds made
+// against it
+type TransactionWithRefunds struct {
+	*StoredTransaction
+	Refunds []*StoredTransaction `json:"refunds"`
+}
+
+// ProcessedTransaction is the message consumed from transactions.processed
+type ProcessedTransaction = shared.ProcessedTransaction
+
+// TransactionStored is emitted once a transaction has been durably persisted
+type TransactionStored struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"account_id"`
+	Status    string    `json:"status"`
+	RiskLevel string    `json:"risk_level"`
+	StoredAt  time.Time `json:"stored_at"`
+}
+
+// OutboxEvent represents an event waiting in the outbox to be published
+type OutboxEvent struct {
+	ID        int64      `json:"id" db:"id"`
+	Topic     string     `json:"topic" db:"topic"`
+	Key       string     `json:"key" db:"key"`
+	Payload   []byte     `json:"payload" db:"payload"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+}
+
+// CallbackPayload is the body posted to a transaction's callback URL once
+// it is stored with a final status
+type CallbackPayload struct {
+	ID              string `json:"id"`
+	Status          string `json:"status"`
+	RiskLevel       string `json:"risk_level"`
+	RejectionReason string `json:"rejection_reason,omitempty"`
+}
+
+// Callback is the delivery of a transaction's outcome to its callback URL.
+// It is retried with backoff until delivered or, after its last attempt,
+// dead-lettered.
+type Callback struct {
+	ID            int64             `json:"id" db:"id"`
+	TransactionID string            `json:"transaction_id" db:"transaction_id"`
+	URL           string            `json:"url" db:"url"`
+	Payload       []byte            `json:"-" db:"payload"`
+	Status        string            `json:"status" db:"status"`
+	Attempts      int               `json:"attempts" db:"attempts"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	LastError     string            `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time        `json:"delivered_at,omitempty" db:"delivered_at"`
+	History       []CallbackAttempt `json:"history"`
+}
+
+// CallbackAttempt records one attempt to deliver a callback. StatusCode is
+// zero when no response was received.
+type CallbackAttempt struct {
+	Attempt     int       `json:"attempt" db:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty" db:"status_code"`
+	Error       string    `json:"error,omitempty" db:"error"`
+	Duration    int64     `json:"duration_ms" db:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at" db:"attempted_at"`
+}
+
+// IsFinalStatus reports whether a transaction with status has been decided
+func IsFinalStatus(status string) bool {
+	return shared.IsFinalStatus(status)
+}
+
+// Callback statuses
+const (
+	CallbackStatusPending   = "pending"
+	CallbackStatusDelivered = "delivered"
+	CallbackStatusDead      = "dead"
+)
+
 // Account represents a bank account
 type Account struct {
 	ID          string    `json:"id" db:"id"`
 	UserID      string    `json:"user_id" db:"user_id"`
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
 	AccountType string    `json:"account_type" db:"account_type"`
 	Balance     float64   `json:"balance" db:"balance"`
 	Currency    string    `json:"currency" db:"currency"`
@@ -57,6 +111,47 @@ type Account struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// AccountStatusChanged is emitted when an account is created or its status
+// changes
+type AccountStatusChanged = shared.AccountStatusChanged
+
+// Account statuses
+const (
+	AccountStatusActive = shared.AccountStatusActive
+	AccountStatusFrozen = shared.AccountStatusFrozen
+	AccountStatusClosed = shared.AccountStatusClosed
+)
+
+// AccountStatusTransitionAllowed reports whether an account may move from
+// one status to another
+func AccountStatusTransitionAllowed(from, to string) bool {
+	return shared.AccountStatusTransitionAllowed(from, to)
+}
+
+// AccountStatusKey returns the Redis key of an account's cached status
+func AccountStatusKey(accountID string) string {
+	return shared.AccountStatusKey(accountID)
+}
+
+// AccountStatusValue encodes the cached status of an account
+func AccountStatusValue(status string, updatedAt time.Time) string {
+	return shared.AccountStatusValue(status, updatedAt)
+}
+
+// ValidAccountStatus reports whether s is an account status
+func ValidAccountStatus(s string) bool {
+	return shared.ValidAccountStatus(s)
+}
+
+// ValidAccountType reports whether t is an account type
+func ValidAccountType(t string) bool {
+	switch t {
+	case AccountTypeChecking, AccountTypeSavings, AccountTypeCredit, AccountTypeBusiness:
+		return true
+	}
+	return false
+}
+
 // TransactionSummary represents aggregated transaction data
 type TransactionSummary struct {
 	AccountID         string    `json:"account_id" db:"account_id"`
@@ -65,8 +160,110 @@ type TransactionSummary struct {
 	AverageAmount     float64   `json:"average_amount" db:"average_amount"`
 	LastTransaction   time.Time `json:"last_transaction" db:"last_transaction"`
 	RiskLevel         string    `json:"risk_level" db:"risk_level"`
+
+	// Currencies totals the amount in each native currency, and
+	// TotalBaseAmount all of them in BaseCurrency. Currencies without an
+	// exchange rate are left out of the base total and listed in Unconverted.
+	Currencies      []CurrencyAmount `json:"currencies,omitempty"`
+	BaseCurrency    string           `json:"base_currency,omitempty"`
+	TotalBaseAmount float64          `json:"total_base_amount,omitempty"`
+	Unconverted     []string         `json:"unconverted,omitempty"`
+}
+
+// DailyVolume represents the transaction volume of an account on one day
+type DailyVolume struct {
+	AccountID        string    `json:"account_id" db:"account_id"`
+	Day              time.Time `json:"day" db:"day"`
+	TransactionCount int64     `json:"transaction_count" db:"transaction_count"`
+	TotalAmount      float64   `json:"total_amount" db:"total_amount"`
+
+	// Currencies, BaseCurrency, BaseAmount and Unconverted break the total
+	// down as on TransactionSummary
+	Currencies   []CurrencyAmount `json:"currencies,omitempty"`
+	BaseCurrency string           `json:"base_currency,omitempty"`
+	BaseAmount   float64          `json:"base_amount,omitempty"`
+	Unconverted  []string         `json:"unconverted,omitempty"`
+}
+
+// CurrencyAmount is a total amount in one currency
+type CurrencyAmount struct {
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+}
+
+// ReconciliationReport records the outcome of a reconciliation run between
+// the processed topic and the transactions table
+type ReconciliationReport struct {
+	ID         int64     `json:"id" db:"id"`
+	RangeFrom  time.Time `json:"range_from" db:"range_from"`
+	RangeTo    time.Time `json:"range_to" db:"range_to"`
+	Scanned    int64     `json:"scanned" db:"scanned"`
+	Missing    int64     `json:"missing" db:"missing"`
+	Repaired   int64     `json:"repaired" db:"repaired"`
+	MissingIDs []string  `json:"missing_ids" db:"missing_ids"`
+	StartedAt  time.Time `json:"started_at" db:"started_at"`
+	FinishedAt time.Time `json:"finished_at" db:"finished_at"`
 }
 
+// IntegrityReport is the outcome of verifying the integrity chain of an
+// account. Links counts the links verified up to the first broken one, and
+// Unchained the transactions of the account outside the chain, stored
+// before integrity mode was enabled or inserted around it.
+type IntegrityReport struct {
+	AccountID string          `json:"account_id"`
+	Valid     bool            `json:"valid"`
+	Links     int64           `json:"links"`
+	Unchained int64           `json:"unchained"`
+	Broken    *IntegrityBreak `json:"broken,omitempty"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// IntegrityBreak is the first broken link of an integrity chain
+type IntegrityBreak struct {
+	Seq           int64  `json:"seq"`
+	Kind          string `json:"kind"`
+	TransactionID string `json:"transaction_id"`
+	Reason        string `json:"reason"`
+}
+
+// Integrity chain link kinds
+const (
+	IntegrityLinkTransaction = "transaction"
+	IntegrityLinkStatus      = "status"
+)
+
+// BlocklistEntry blocks transactions from a country, with a merchant or on
+// an account
+type BlocklistEntry = shared.BlocklistEntry
+
+// Blocklist entry types
+const (
+	BlocklistTypeCountry  = shared.BlocklistTypeCountry
+	BlocklistTypeMerchant = shared.BlocklistTypeMerchant
+	BlocklistTypeAccount  = shared.BlocklistTypeAccount
+)
+
+// ValidBlocklistType reports whether t is a blocklist entry type
+func ValidBlocklistType(t string) bool {
+	return shared.ValidBlocklistType(t)
+}
+
+// DecisionAudit records how the processing service decided a transaction,
+// consumed from the audit topic
+type DecisionAudit = shared.DecisionAudit
+
+// Alert is an alert the service raises itself, such as a consumer lag alert
+type Alert = shared.Alert
+
+// The schema_version header tells consumers of the processed topic how to
+// decode a message. It is absent or SchemaVersionTransaction on processed
+// transactions; SchemaVersionAlert marks an alert for the alert service.
+const (
+	SchemaVersionHeader      = "schema_version"
+	SchemaVersionTransaction = "0"
+	SchemaVersionAlert       = "1"
+)
+
 // RiskMetrics represents risk-related metrics
 type RiskMetrics struct {
 	AccountID     string    `json:"account_id" db:"account_id"`
@@ -77,46 +274,94 @@ type RiskMetrics struct {
 	LastUpdated   time.Time `json:"last_updated" db:"last_updated"`
 }
 
+// AccountContext summarizes an account for those investigating an alert on
+// it: when it was opened, its transactions since Since and how many were
+// flagged, and its risk metrics. OpenedAt is the account's creation, or
+// its first transaction when it was never registered; Risk is nil when the
+// account has none.
+type AccountContext struct {
+	AccountID        string       `json:"account_id"`
+	OpenedAt         *time.Time   `json:"opened_at,omitempty"`
+	Since            time.Time    `json:"since"`
+	TransactionCount int64        `json:"transaction_count"`
+	FlaggedCount     int64        `json:"flagged_count"`
+	Risk             *RiskMetrics `json:"risk,omitempty"`
+}
+
 // Database schema constants
 const (
 	// Table names
 	TableTransactions = "transactions"
 	TableAccounts     = "accounts"
 	TableRiskMetrics  = "risk_metrics"
+	TableAuditLog     = "audit_log"
+	TableOutbox       = "outbox"
+	TableReconcile    = "reconciliation_reports"
+	TableBlocklist    = "blocklist"
+	TableIntegrity    = "integrity_chain"
+	TableCallbacks    = "transaction_callbacks"
+	TableCallbackDLQ  = "callback_dead_letters"
 
 	// Index names
-	IndexTransactionsAccountID = "idx_transactions_account_id"
-	IndexTransactionsUserID    = "idx_transactions_user_id"
-	IndexTransactionsStatus    = "idx_transactions_status"
-	IndexTransactionsTimestamp = "idx_transactions_timestamp"
-	IndexTransactionsRiskLevel = "idx_transactions_risk_level"
+	IndexTransactionsAccountID = shared.IndexTransactionsAccountID
+	IndexTransactionsUserID    = shared.IndexTransactionsUserID
+	IndexTransactionsStatus    = shared.IndexTransactionsStatus
+	IndexTransactionsTimestamp = shared.IndexTransactionsTimestamp
+	IndexTransactionsRiskLevel = shared.IndexTransactionsRiskLevel
+	IndexTransactionsTenantID  = shared.IndexTransactionsTenantID
+	IndexTransactionsParentID  = shared.IndexTransactionsParentID
+	IndexTransactionsMerchant  = shared.IndexTransactionsMerchant
 
 	// Status values
-	StatusPending  = "pending"
-	StatusApproved = "approved"
-	StatusRejected = "rejected"
-	StatusFlagged  = "flagged"
-	StatusFailed   = "failed"
+	StatusPending  = shared.TransactionStatusPending
+	StatusApproved = shared.TransactionStatusApproved
+	StatusRejected = shared.TransactionStatusRejected
+	StatusFlagged  = shared.TransactionStatusFlagged
+	StatusFailed   = shared.TransactionStatusFailed
 
 	// Risk levels
-	RiskLevelLow      = "low"
-	RiskLevelMedium   = "medium"
-	RiskLevelHigh     = "high"
-	RiskLevelCritical = "critical"
+	RiskLevelLow      = shared.RiskLevelLow
+	RiskLevelMedium   = shared.RiskLevelMedium
+	RiskLevelHigh     = shared.RiskLevelHigh
+	RiskLevelCritical = shared.RiskLevelCritical
 
 	// Account types
 	AccountTypeChecking = "checking"
 	AccountTypeSavings  = "savings"
 	AccountTypeCredit   = "credit"
 	AccountTypeBusiness = "business"
+
+	// Audit actions
+	AuditActionEraseUser          = "erase_user"
+	AuditActionExportUser         = "export_user"
+	AuditActionExportTransactions = "export_transactions"
+	AuditActionReconcile          = "reconcile"
+	AuditActionVerifyIntegrity    = "verify_integrity"
+
+	// Blocklist audit actions
+	AuditActionBlocklistAdd    = "blocklist_add"
+	AuditActionBlocklistUpdate = "blocklist_update"
+	AuditActionBlocklistRemove = "blocklist_remove"
+
+	// Account audit actions
+	AuditActionAccountCreate = "account_create"
+	AuditActionAccountStatus = "account_status"
 )
 
+// CreateExtensionsSQL returns the SQL to enable the required PostgreSQL extensions
+func CreateExtensionsSQL() []string {
+	return []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	}
+}
+
 // CreateTablesSQL returns the SQL to create the necessary tables
 func CreateTablesSQL() []string {
 	return []string{
 		`CREATE TABLE IF NOT EXISTS accounts (
 			id VARCHAR(255) PRIMARY KEY,
 			user_id VARCHAR(255) NOT NULL,
+			tenant_id VARCHAR(64) NOT NULL DEFAULT '',
 			account_type VARCHAR(50) NOT NULL,
 			balance DECIMAL(15,2) DEFAULT 0.00,
 			currency VARCHAR(3) NOT NULL,
@@ -125,35 +370,7 @@ func CreateTablesSQL() []string {
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 
-		`CREATE TABLE IF NOT EXISTS transactions (
-			id VARCHAR(255) PRIMARY KEY,
-			idempotency_key VARCHAR(255) UNIQUE NOT NULL,
-			account_id VARCHAR(255) NOT NULL,
-			user_id VARCHAR(255) NOT NULL,
-			amount DECIMAL(15,2) NOT NULL,
-			currency VARCHAR(3) NOT NULL,
-			type VARCHAR(50) NOT NULL,
-			category VARCHAR(100),
-			merchant VARCHAR(255),
-			reference VARCHAR(255),
-			status VARCHAR(50) NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			metadata JSONB,
-			risk_score DECIMAL(3,2),
-			risk_level VARCHAR(20),
-			is_approved BOOLEAN DEFAULT false,
-			rejection_reason TEXT,
-			is_valid BOOLEAN DEFAULT true,
-			validation_errors TEXT[],
-			country VARCHAR(3),
-			ip_address INET,
-			device_info TEXT,
-			processed_at TIMESTAMP,
-			processing_time INTERVAL,
-			processor_id VARCHAR(255),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
+		shared.TransactionsTableSQL,
 
 		`CREATE TABLE IF NOT EXISTS risk_metrics (
 			account_id VARCHAR(255) PRIMARY KEY,
@@ -163,19 +380,265 @@ func CreateTablesSQL() []string {
 			total_rejected BIGINT DEFAULT 0,
 			last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			topic VARCHAR(255) NOT NULL,
+			key VARCHAR(255),
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			sent_at TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS reconciliation_reports (
+			id BIGSERIAL PRIMARY KEY,
+			range_from TIMESTAMP NOT NULL,
+			range_to TIMESTAMP NOT NULL,
+			scanned BIGINT DEFAULT 0,
+			missing BIGINT DEFAULT 0,
+			repaired BIGINT DEFAULT 0,
+			missing_ids TEXT[],
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS blocklist (
+			id BIGSERIAL PRIMARY KEY,
+			type VARCHAR(20) NOT NULL CHECK (type IN ('country', 'merchant', 'account')),
+			value VARCHAR(255) NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			added_by VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP,
+			UNIQUE (type, value)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor VARCHAR(255) NOT NULL,
+			action VARCHAR(100) NOT NULL,
+			subject VARCHAR(255),
+			details TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Decision audits are partitioned by month of decision; the
+		// partitions are created as audits arrive. A redelivered audit is
+		// the same decision, identified by transaction and time.
+		`CREATE TABLE IF NOT EXISTS decision_audits (
+			transaction_id VARCHAR(255) NOT NULL,
+			tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+			decided_at TIMESTAMP NOT NULL,
+			stage VARCHAR(20) NOT NULL,
+			rules_version VARCHAR(80) NOT NULL,
+			contributions JSONB NOT NULL,
+			noise DOUBLE PRECISION NOT NULL DEFAULT 0,
+			risk_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+			risk_level VARCHAR(20),
+			thresholds JSONB NOT NULL,
+			decision VARCHAR(50) NOT NULL,
+			rejection_reason TEXT,
+			processor_id VARCHAR(255) NOT NULL,
+			processor_version VARCHAR(100) NOT NULL,
+			processor_instance VARCHAR(255) NOT NULL,
+			recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (transaction_id, decided_at)
+		) PARTITION BY RANGE (decided_at)`,
+
+		// The integrity chain of each account, in the order its links were
+		// appended. Every link hashes its record with the hash of the link
+		// before it.
+		`CREATE TABLE IF NOT EXISTS integrity_chain (
+			account_id VARCHAR(255) NOT NULL,
+			seq BIGINT NOT NULL,
+			kind VARCHAR(20) NOT NULL CHECK (kind IN ('transaction', 'status')),
+			transaction_id VARCHAR(255) NOT NULL,
+			status VARCHAR(50),
+			actor VARCHAR(255),
+			previous_hash CHAR(64) NOT NULL,
+			record_hash CHAR(64) NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (account_id, seq)
+		)`,
+
+		// Callbacks of decided transactions, their delivery attempts, and
+		// those that failed every attempt
+		`CREATE TABLE IF NOT EXISTS transaction_callbacks (
+			id BIGSERIAL PRIMARY KEY,
+			transaction_id VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS callback_attempts (
+			callback_id BIGINT NOT NULL REFERENCES transaction_callbacks(id) ON DELETE CASCADE,
+			attempt INT NOT NULL,
+			status_code INT,
+			error TEXT,
+			duration_ms BIGINT NOT NULL,
+			attempted_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (callback_id, attempt)
+		)`,
+		`CREATE TABLE IF NOT EXISTS callback_dead_letters (
+			callback_id BIGINT PRIMARY KEY REFERENCES transaction_callbacks(id) ON DELETE CASCADE,
+			transaction_id VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			attempts INT NOT NULL,
+			last_error TEXT,
+			dead_at TIMESTAMP NOT NULL
+		)`,
+	}
+}
+
+// MigrationsSQL returns the SQL to bring existing tables up to date with
+// CreateTablesSQL. Each statement is safe to run repeatedly.
+func MigrationsSQL() []string {
+	return []string{
+		// PII columns hold ciphertext, which neither INET nor JSONB accept
+		`DO $$ BEGIN
+			IF (SELECT data_type FROM information_schema.columns
+				WHERE table_name = 'transactions' AND column_name = 'ip_address') = 'inet' THEN
+				ALTER TABLE transactions ALTER COLUMN ip_address TYPE TEXT USING host(ip_address);
+			END IF;
+		END $$`,
+		`DO $$ BEGIN
+			IF (SELECT data_type FROM information_schema.columns
+				WHERE table_name = 'transactions' AND column_name = 'metadata') = 'jsonb' THEN
+				ALTER TABLE transactions ALTER COLUMN metadata TYPE TEXT USING metadata::text;
+			END IF;
+		END $$`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS shadow_risk_factors JSONB`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS parent_transaction_id VARCHAR(255)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency_exponent SMALLINT NOT NULL DEFAULT 2`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS merchant_normalized VARCHAR(255)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS is_recurring BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS record_hash CHAR(64)`,
+		// Decision audits are append-only: rows cannot be updated or
+		// deleted, and months past retention go by dropping their partition
+		`CREATE OR REPLACE FUNCTION decision_audits_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'decision_audits is append-only';
+		END $$ LANGUAGE plpgsql`,
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'decision_audits_append_only') THEN
+				CREATE TRIGGER decision_audits_append_only
+					BEFORE UPDATE OR DELETE ON decision_audits
+					FOR EACH ROW EXECUTE FUNCTION decision_audits_append_only();
+			END IF;
+		END $$`,
+		// So is the integrity chain, so a link cannot be rewritten without
+		// dropping the trigger first
+		`CREATE OR REPLACE FUNCTION integrity_chain_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'integrity_chain is append-only';
+		END $$ LANGUAGE plpgsql`,
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'integrity_chain_append_only') THEN
+				CREATE TRIGGER integrity_chain_append_only
+					BEFORE UPDATE OR DELETE ON integrity_chain
+					FOR EACH ROW EXECUTE FUNCTION integrity_chain_append_only();
+			END IF;
+		END $$`,
+		// Three decimal places for currencies such as BHD. A column under a
+		// continuous aggregate cannot change type, so TimescaleDB tables
+		// created before keep two until the aggregate is recreated.
+		`DO $$ BEGIN
+			IF (SELECT numeric_scale FROM information_schema.columns
+				WHERE table_name = 'transactions' AND column_name = 'amount') < 3
+				AND to_regclass('transactions_daily_volume') IS NULL
+				AND to_regclass('transactions_daily_volume_by_currency') IS NULL THEN
+				ALTER TABLE transactions ALTER COLUMN amount TYPE DECIMAL(18,3);
+			END IF;
+		END $$`,
 	}
 }
 
 // CreateIndexesSQL returns the SQL to create the necessary indexes
 func CreateIndexesSQL() []string {
-	return []string{
-		`CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_timestamp ON transactions(timestamp)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_risk_level ON transactions(risk_level)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_idempotency_key ON transactions(idempotency_key)`,
+	return append(shared.TransactionsIndexesSQL(),
 		`CREATE INDEX IF NOT EXISTS idx_accounts_user_id ON accounts(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_accounts_status ON accounts(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(id) WHERE sent_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_decision_audits_tenant_id ON decision_audits(tenant_id, decided_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_integrity_chain_transaction_id ON integrity_chain(transaction_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_callbacks_due ON transaction_callbacks(next_attempt_at) WHERE status = 'pending'`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_callbacks_transaction_id ON transaction_callbacks(transaction_id)`,
+	)
+}
+
+// ViewDailyVolume is the TimescaleDB continuous aggregate of daily volume
+const ViewDailyVolume = "transactions_daily_volume"
+
+// ViewDailyVolumeByCurrency is the TimescaleDB continuous aggregate of daily
+// volume per currency
+const ViewDailyVolumeByCurrency = "transactions_daily_volume_by_currency"
+
+// TimescaleSetupSQL returns the SQL to prepare the transactions table for
+// conversion to a hypertable. TimescaleDB requires every unique constraint to
+// include the time column, so the primary key becomes (id, timestamp) and
+// idempotency is enforced by the existence check on insert.
+func TimescaleSetupSQL() []string {
+	return []string{
+		`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM timescaledb_information.hypertables
+				WHERE hypertable_name = 'transactions') THEN
+				ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_pkey;
+				ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_idempotency_key_key;
+				ALTER TABLE transactions ADD PRIMARY KEY (id, timestamp);
+			END IF;
+		END $$`,
+	}
+}
+
+// CreateHypertableSQL converts the transactions table to a hypertable; $1 is
+// the chunk interval
+const CreateHypertableSQL = `SELECT create_hypertable('transactions', 'timestamp',
+	chunk_time_interval => $1::interval, if_not_exists => TRUE, migrate_data => TRUE)`
+
+// CreateContinuousAggregatesSQL returns the SQL to create the TimescaleDB
+// continuous aggregates and their refresh policies
+func CreateContinuousAggregatesSQL() []string {
+	return []string{
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS transactions_daily_volume
+		WITH (timescaledb.continuous) AS
+		SELECT
+			account_id,
+			time_bucket(INTERVAL '1 day', timestamp) AS day,
+			COUNT(*) AS transaction_count,
+			SUM(amount) AS total_amount
+		FROM transactions
+		GROUP BY account_id, day
+		WITH NO DATA`,
+		`SELECT add_continuous_aggregate_policy('transactions_daily_volume',
+			start_offset => INTERVAL '3 days',
+			end_offset => INTERVAL '1 hour',
+			schedule_interval => INTERVAL '1 hour',
+			if_not_exists => TRUE)`,
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS transactions_daily_volume_by_currency
+		WITH (timescaledb.continuous) AS
+		SELECT
+			account_id,
+			time_bucket(INTERVAL '1 day', timestamp) AS day,
+			currency,
+			COUNT(*) AS transaction_count,
+			SUM(amount) AS total_amount
+		FROM transactions
+		GROUP BY account_id, day, currency
+		WITH NO DATA`,
+		`SELECT add_continuous_aggregate_policy('transactions_daily_volume_by_currency',
+			start_offset => INTERVAL '3 days',
+			end_offset => INTERVAL '1 hour',
+			schedule_interval => INTERVAL '1 hour',
+			if_not_exists => TRUE)`,
 	}
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// published is a transaction as the processing service publishes it on
+// transactions.processed
+func published() shared.ProcessedTransaction {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	return shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             "txn-1",
+			IdempotencyKey: "idem-1",
+			AccountID:      "acct-1",
+			UserID:         "user-1",
+			Amount:         125.5,
+			Currency:       "EUR",
+			Type:           "purchase",
+			Category:       "electronics",
+			Merchant:       "Best Buy #1024",
+			Status:         shared.TransactionStatusApproved,
+			Timestamp:      at,
+			Metadata:       map[string]string{"channel": "web"},
+			TenantID:       "unit-a",
+			IngestedAt:     at.Add(time.Second),
+		},
+		RiskScore:          0.35,
+		RiskLevel:          shared.RiskLevelMedium,
+		IsApproved:         true,
+		IsValid:            true,
+		CurrencyExponent:   2,
+		Country:            "DE",
+		MerchantNormalized: "best buy",
+		ProcessedAt:        at.Add(2 * time.Second),
+		ProcessingTime:     1500 * time.Microsecond,
+		ProcessorID:        "processor-1",
+		ShadowRiskFactors:  []shared.RiskFactor{{Factor: "night", Weight: 0.1}},
+	}
+}
+
+func TestStoredTransactionReadsTheProcessedTransaction(t *testing.T) {
+	out := published()
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var stored StoredTransaction
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(stored.ProcessedTransaction, out) {
+		t.Errorf("stored %+v, want %+v", stored.ProcessedTransaction, out)
+	}
+	// Storage metadata is the database's to set
+	if stored.Unassessed || !stored.CreatedAt.IsZero() || !stored.UpdatedAt.IsZero() {
+		t.Errorf("storage metadata = %v %v %v, want it unset", stored.Unassessed, stored.CreatedAt, stored.UpdatedAt)
+	}
+}
+
+func TestStoredTransactionServedToProcessedTransactionReaders(t *testing.T) {
+	// The API serves stored transactions, which clients such as the
+	// processing service read as processed transactions
+	created := time.Date(2026, 3, 2, 9, 30, 5, 0, time.UTC)
+	stored := StoredTransaction{ProcessedTransaction: published(), Unassessed: true, CreatedAt: created, UpdatedAt: created}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var in shared.ProcessedTransaction
+	if err := json.Unmarshal(data, &in); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(in, stored.ProcessedTransaction) {
+		t.Errorf("read %+v, want %+v", in, stored.ProcessedTransaction)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if _, ok := fields["created_at"]; !ok {
+		t.Error("served transaction has no created_at")
+	}
+	if _, ok := fields["unassessed"]; ok {
+		t.Error("served transaction exposes unassessed")
+	}
+}
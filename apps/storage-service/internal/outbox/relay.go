@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+)
+
+// pruneInterval is how often published events are deleted from the outbox
+const pruneInterval = time.Hour
+
+// Publisher publishes outbox events
+type Publisher interface {
+	PublishOutboxEvents(ctx context.Context, events []models.OutboxEvent) error
+}
+
+// Relay moves events from the outbox table to Kafka
+type Relay struct {
+	store     *storage.Storage
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+// NewRelay creates a new outbox relay polling every interval
+func NewRelay(store *storage.Storage, publisher Publisher, interval time.Duration, batchSize int, retention time.Duration) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+		retention: retention,
+	}
+}
+
+// Run relays outbox events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.drain(ctx)
+
+		if depth, err := r.store.OutboxDepth(ctx); err == nil {
+			metrics.SetOutboxDepth(depth)
+		}
+
+		if time.Since(lastPrune) >= pruneInterval {
+			if _, err := r.store.PruneOutbox(ctx, time.Now().Add(-r.retention)); err != nil {
+				log.Printf("outbox prune error: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// drain publishes batches until the outbox is empty or an error occurs
+func (r *Relay) drain(ctx context.Context) {
+	for {
+		events, err := r.store.RelayOutbox(ctx, r.batchSize, r.publisher.PublishOutboxEvents)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("outbox relay error: %v", err)
+			}
+			return
+		}
+
+		now := time.Now()
+		for _, event := range events {
+			metrics.RecordOutboxPublished(now.Sub(event.CreatedAt))
+		}
+
+		if len(events) < r.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher handles publishing storage events to Kafka
+type Publisher struct {
+	writer *kafka.Writer
+	chaos  *chaos.Injector
+}
+
+// NewPublisher creates a new Kafka publisher. Writes are synchronous and
+// acknowledged by all replicas, because the outbox marks events sent only
+// once the publish has returned. The transport carries the TLS and SASL
+// settings; nil uses the default. Writes are subject to the writer faults of
+// chaosInjector, which may be nil.
+func NewPublisher(brokers string, transport *kafka.Transport, chaosInjector *chaos.Injector) *Publisher {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Balancer:     &kafka.Hash{}, // Use hash balancer for partitioning
+		RequiredAcks: kafka.RequireAll,
+	}
+	if transport != nil {
+		writer.Transport = transport
+	}
+
+	return &Publisher{writer: writer, chaos: chaosInjector}
+}
+
+// PublishOutboxEvents publishes outbox events to their topics
+func (p *Publisher) PublishOutboxEvents(ctx context.Context, events []models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		messages[i] = kafka.Message{
+			Topic: event.Topic,
+			Key:   []byte(event.Key),
+			Value: event.Payload,
+		}
+	}
+
+	err := p.chaos.Inject(ctx, chaos.TargetKafkaWriter)
+	if err == nil {
+		err = p.writer.WriteMessages(ctx, messages...)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %d outbox events: %v", len(events), err)
+	} else {
+		log.Printf("Published %d outbox events in %v", len(events), time.Since(start))
+	}
+
+	return err
+}
+
+// AlertPublisher publishes the alerts the service raises itself, such as
+// consumer lag alerts, onto the topic the alert service consumes
+type AlertPublisher struct {
+	publisher *Publisher
+	topic     string
+}
+
+// NewAlertPublisher creates an alert publisher writing to topic with p
+func NewAlertPublisher(p *Publisher, topic string) *AlertPublisher {
+	return &AlertPublisher{publisher: p, topic: topic}
+}
+
+// PublishAlert publishes an alert for the alert service to dispatch as is
+func (a *AlertPublisher) PublishAlert(ctx context.Context, alert *models.Alert) error {
+	message, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %w", err)
+	}
+
+	err = a.publisher.writer.WriteMessages(ctx, kafka.Message{
+		Topic: a.topic,
+		Key:   []byte(alert.AccountID),
+		Value: message,
+		Headers: []kafka.Header{
+			{Key: models.SchemaVersionHeader, Value: []byte(models.SchemaVersionAlert)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish alert %s: %w", alert.ID, err)
+	}
+	return nil
+}
+
+// Close shuts down the Kafka writer
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,38 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+)
+
+func TestWriterFaults(t *testing.T) {
+	injector := chaos.New(true, nil)
+	// Nothing listens on the broker address, so only an injected fault can
+	// fail the write before it is attempted
+	p := NewPublisher("127.0.0.1:1", nil, injector)
+	defer p.Close()
+	events := []models.OutboxEvent{{Topic: "transactions.stored", Key: "acct-1", Payload: []byte(`{}`)}}
+
+	if err := injector.Set(chaos.TargetKafkaWriter, chaos.ModeError, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := p.PublishOutboxEvents(context.Background(), events); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("PublishOutboxEvents = %v, want %v", err, chaos.ErrInjected)
+	}
+
+	// A latency fault holds the write until the caller gives up
+	if err := injector.Set(chaos.TargetKafkaWriter, chaos.ModeLatency, 1, time.Minute, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.PublishOutboxEvents(ctx, events); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PublishOutboxEvents = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,234 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/internal/handler"
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler re-ingests a processed transaction through the normal storage path
+type Handler interface {
+	Handle(ctx context.Context, payload []byte) error
+}
+
+// Reconciler compares the processed topic with the transactions table and
+// reports (and optionally repairs) transactions that were consumed but never
+// stored. IDs are checked in fixed-size chunks so memory stays bounded
+// however large the range is.
+type Reconciler struct {
+	brokers   []string
+	topic     string
+	store     *storage.Storage
+	handler   Handler
+	chunkSize int
+	dialer    *kafka.Dialer
+}
+
+// NewReconciler creates a new reconciler. The dialer carries the TLS and SASL
+// settings; nil uses the default.
+func NewReconciler(brokers, topic string, dialer *kafka.Dialer, store *storage.Storage, handler Handler, chunkSize int) *Reconciler {
+	var addrs []string
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			addrs = append(addrs, b)
+		}
+	}
+	if chunkSize < 1 {
+		chunkSize = 1000
+	}
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	return &Reconciler{
+		brokers:   addrs,
+		topic:     topic,
+		store:     store,
+		handler:   handler,
+		chunkSize: chunkSize,
+		dialer:    dialer,
+	}
+}
+
+// Reconcile scans messages published in [from, to) and diffs their IDs
+// against the database. When repair is set, missing transactions are passed
+// to the handler. The report is persisted before it is returned.
+func (r *Reconciler) Reconcile(ctx context.Context, from, to time.Time, repair bool) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{
+		RangeFrom:  from,
+		RangeTo:    to,
+		MissingIDs: []string{},
+		StartedAt:  time.Now(),
+	}
+
+	partitions, err := r.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, partition := range partitions {
+		if err := r.reconcilePartition(ctx, partition, report, repair); err != nil {
+			return nil, fmt.Errorf("partition %d: %w", partition.ID, err)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	metrics.SetReconciliationMissing(report.Missing - report.Repaired)
+
+	if err := r.store.SaveReconciliationReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Reconciliation %s - %s: scanned=%d missing=%d repaired=%d",
+		from.Format(time.RFC3339), to.Format(time.RFC3339), report.Scanned, report.Missing, report.Repaired)
+	return report, nil
+}
+
+// RunScheduled reconciles the window ending lag ago every interval until ctx
+// is cancelled. The lag leaves in-flight messages time to be stored.
+func (r *Reconciler) RunScheduled(ctx context.Context, interval, lag time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		to := time.Now().Add(-lag)
+		if _, err := r.Reconcile(ctx, to.Add(-interval), to, repair); err != nil && ctx.Err() == nil {
+			log.Printf("scheduled reconciliation error: %v", err)
+		}
+	}
+}
+
+// partitions lists the partitions of the topic
+func (r *Reconciler) partitions(ctx context.Context) ([]kafka.Partition, error) {
+	conn, err := r.dialer.DialContext(ctx, "tcp", r.brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial kafka: %w", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions: %w", err)
+	}
+	return partitions, nil
+}
+
+// reconcilePartition reads one partition from the first message at or after
+// from until it passes to or reaches the end of the log
+func (r *Reconciler) reconcilePartition(ctx context.Context, partition kafka.Partition, report *models.ReconciliationReport, repair bool) error {
+	leader := net.JoinHostPort(partition.Leader.Host, strconv.Itoa(partition.Leader.Port))
+	conn, err := r.dialer.DialLeader(ctx, "tcp", leader, r.topic, partition.ID)
+	if err != nil {
+		return fmt.Errorf("failed to dial leader: %w", err)
+	}
+	lastOffset, err := conn.ReadLastOffset()
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read last offset: %w", err)
+	}
+
+	// A non-group reader: reconciliation must not move the storage consumer's offsets
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.brokers,
+		Topic:     r.topic,
+		Partition: partition.ID,
+		Dialer:    r.dialer,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffsetAt(ctx, report.RangeFrom); err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
+	}
+
+	chunk := make(map[string][]byte, r.chunkSize)
+	for {
+		if reader.Offset() >= lastOffset {
+			break
+		}
+
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		if !m.Time.Before(report.RangeTo) {
+			break
+		}
+
+		var envelope struct {
+			ID string `json:"id"`
+		}
+		switch {
+		case !handler.IsTransaction(m):
+			// An alert for the alert service, which is not stored
+		case json.Unmarshal(m.Value, &envelope) != nil || envelope.ID == "":
+			log.Printf("reconcile: skipping undecodable message at offset %d", m.Offset)
+		default:
+			chunk[envelope.ID] = m.Value
+			report.Scanned++
+		}
+
+		if len(chunk) >= r.chunkSize {
+			if err := r.checkChunk(ctx, chunk, report, repair); err != nil {
+				return err
+			}
+			chunk = make(map[string][]byte, r.chunkSize)
+		}
+
+		if m.Offset >= lastOffset-1 {
+			break
+		}
+	}
+
+	return r.checkChunk(ctx, chunk, report, repair)
+}
+
+// checkChunk diffs a chunk of IDs against the database and repairs gaps
+func (r *Reconciler) checkChunk(ctx context.Context, chunk map[string][]byte, report *models.ReconciliationReport, repair bool) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(chunk))
+	for id := range chunk {
+		ids = append(ids, id)
+	}
+
+	missing, err := r.store.MissingTransactionIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		report.Missing++
+		report.MissingIDs = append(report.MissingIDs, id)
+
+		if repair && r.handler != nil {
+			if err := r.handler.Handle(ctx, chunk[id]); err != nil {
+				log.Printf("reconcile: failed to repair transaction %s: %v", id, err)
+				continue
+			}
+			report.Repaired++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+//go:build integration
+
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"storage-service/internal/handler"
+	"storage-service/internal/models"
+	"storage-service/internal/storage"
+	"storage-service/internal/testdb"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+)
+
+// The reconciliation tests run against Kafka and Postgres in containers,
+// started once for the package:
+//
+//	go test -tags=integration ./internal/reconcile/
+
+var (
+	brokers string
+
+	// sequence numbers the topics created by the tests
+	sequence atomic.Int64
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	kafkaContainer, err := tckafka.Run(ctx, "confluentinc/confluent-local:7.5.0", tckafka.WithClusterID("reconcile"))
+	if err != nil {
+		log.Fatalf("failed to start kafka: %v", err)
+	}
+	addrs, err := kafkaContainer.Brokers(ctx)
+	if err != nil {
+		log.Fatalf("failed to get kafka brokers: %v", err)
+	}
+	brokers = addrs[0]
+
+	stopPostgres := testdb.Start()
+
+	code := m.Run()
+	if err := testcontainers.TerminateContainer(kafkaContainer); err != nil {
+		log.Printf("failed to terminate kafka: %v", err)
+	}
+	stopPostgres()
+	os.Exit(code)
+}
+
+// newTestStorage returns a storage on a new database, closed when the test
+// ends
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	dbURL := testdb.New(t)
+	s, err := storage.NewStorage(storage.Options{DBUrl: dbURL})
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// newTopic creates a topic of a partition for the test and returns its name
+func newTopic(t *testing.T) string {
+	t.Helper()
+	topic := fmt.Sprintf("transactions.processed.%d", sequence.Add(1))
+	client := &kafka.Client{Addr: kafka.TCP(brokers)}
+	resp, err := client.CreateTopics(context.Background(), &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create topic: %v", err)
+	}
+	if err := resp.Errors[topic]; err != nil {
+		t.Fatalf("failed to create topic: %v", err)
+	}
+	return topic
+}
+
+// processed returns a processed transaction as the processing service
+// publishes it
+func processed(id string, at time.Time) *models.StoredTransaction {
+	return &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             id,
+			IdempotencyKey: "key-" + id,
+			AccountID:      "acct-1",
+			UserID:         "user-1",
+			Amount:         42.5,
+			Currency:       "USD",
+			Type:           "purchase",
+			Status:         "approved",
+			Timestamp:      at,
+		},
+		RiskScore:   0.1,
+		RiskLevel:   "low",
+		IsApproved:  true,
+		IsValid:     true,
+		ProcessedAt: at,
+	}}
+}
+
+// publish writes messages to topic
+func publish(t *testing.T, topic string, messages ...kafka.Message) {
+	t.Helper()
+	w := &kafka.Writer{Addr: kafka.TCP(brokers), Topic: topic, AllowAutoTopicCreation: false}
+	defer w.Close()
+	if err := w.WriteMessages(context.Background(), messages...); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+}
+
+// transactionMessages returns a message of each transaction published at
+func transactionMessages(t *testing.T, at time.Time, txns ...*models.StoredTransaction) []kafka.Message {
+	t.Helper()
+	var messages []kafka.Message
+	for _, txn := range txns {
+		value, err := json.Marshal(txn)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		messages = append(messages, kafka.Message{Key: []byte(txn.AccountID), Value: value, Time: at})
+	}
+	return messages
+}
+
+// missingGauge returns the value of the missing transactions gauge
+func missingGauge(t *testing.T) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "storage_reconciliation_missing_transactions" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestReconcileDetectsAndRepairsGap(t *testing.T) {
+	store := newTestStorage(t)
+	topic := newTopic(t)
+	at := time.Now().Truncate(time.Second)
+
+	var txns []*models.StoredTransaction
+	for i := 0; i < 10; i++ {
+		txns = append(txns, processed(fmt.Sprintf("txn-%d", i), at))
+	}
+	messages := transactionMessages(t, at, txns...)
+	// Neither an alert nor an undecodable message is a transaction to store
+	messages = append(messages,
+		kafka.Message{Value: []byte(`{"id":"alert-1"}`), Time: at,
+			Headers: []kafka.Header{{Key: models.SchemaVersionHeader, Value: []byte(models.SchemaVersionAlert)}}},
+		kafka.Message{Value: []byte(`not json`), Time: at},
+	)
+	publish(t, topic, messages...)
+
+	// The consumer stored all but three
+	gap := map[string]bool{"txn-2": true, "txn-5": true, "txn-9": true}
+	for _, txn := range txns {
+		if gap[txn.ID] {
+			continue
+		}
+		if err := store.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	// Chunks smaller than the range exercise the bounded ID set
+	r := NewReconciler(brokers, topic, nil, store, handler.NewTransactionHandler(store), 4)
+	from, to := at.Add(-time.Minute), at.Add(time.Minute)
+
+	report, err := r.Reconcile(context.Background(), from, to, false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	sort.Strings(report.MissingIDs)
+	if report.Scanned != 10 || report.Missing != 3 || report.Repaired != 0 {
+		t.Errorf("report scanned %d, missing %d, repaired %d, want 10, 3 and 0", report.Scanned, report.Missing, report.Repaired)
+	}
+	if fmt.Sprint(report.MissingIDs) != "[txn-2 txn-5 txn-9]" {
+		t.Errorf("missing IDs = %v, want the gap", report.MissingIDs)
+	}
+	if report.ID == 0 {
+		t.Error("report not persisted")
+	}
+	if gauge := missingGauge(t); gauge != 3 {
+		t.Errorf("missing gauge = %v, want 3", gauge)
+	}
+
+	report, err = r.Reconcile(context.Background(), from, to, true)
+	if err != nil {
+		t.Fatalf("Reconcile with repair: %v", err)
+	}
+	if report.Missing != 3 || report.Repaired != 3 {
+		t.Errorf("repair found %d missing and repaired %d, want 3 and 3", report.Missing, report.Repaired)
+	}
+	if gauge := missingGauge(t); gauge != 0 {
+		t.Errorf("missing gauge = %v after the repair, want 0", gauge)
+	}
+	for id := range gap {
+		stored, err := store.GetTransaction(context.Background(), id)
+		if err != nil {
+			t.Errorf("%s not repaired: %v", id, err)
+			continue
+		}
+		if stored.Amount != 42.5 || stored.RiskLevel != "low" {
+			t.Errorf("%s repaired as %+v", id, stored.ProcessedTransaction)
+		}
+	}
+
+	report, err = r.Reconcile(context.Background(), from, to, true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if report.Missing != 0 {
+		t.Errorf("%d missing after the repair, want none", report.Missing)
+	}
+}
+
+func TestReconcileScansOnlyTheRange(t *testing.T) {
+	store := newTestStorage(t)
+	topic := newTopic(t)
+	before := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	during := before.Add(time.Hour)
+	after := during.Add(time.Hour)
+
+	publish(t, topic, transactionMessages(t, before, processed("txn-before", before))...)
+	publish(t, topic, transactionMessages(t, during, processed("txn-during", during))...)
+	publish(t, topic, transactionMessages(t, after, processed("txn-after", after))...)
+
+	r := NewReconciler(brokers, topic, nil, store, nil, 100)
+	report, err := r.Reconcile(context.Background(), during.Add(-time.Minute), during.Add(time.Minute), true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if report.Scanned != 1 || fmt.Sprint(report.MissingIDs) != "[txn-during]" {
+		t.Errorf("report scanned %d with missing %v, want only txn-during", report.Scanned, report.MissingIDs)
+	}
+	// Without a handler the gap is reported, not repaired
+	if report.Repaired != 0 {
+		t.Errorf("%d repaired without a handler", report.Repaired)
+	}
+}
@@ -0,0 +1,79 @@
+// Package risk recomputes account risk metrics. Stored transactions only
+// ever raise an account's risk score, so the recomputer periodically replaces
+// it with a decayed average over a trailing window, letting accounts that
+// stopped misbehaving recover.
+package risk
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"storage-service/internal/metrics"
+	"storage-service/internal/storage"
+)
+
+// Recomputer recomputes the risk metrics of every account in batches
+type Recomputer struct {
+	store     *storage.Storage
+	window    time.Duration
+	halfLife  time.Duration
+	batchSize int
+}
+
+// NewRecomputer creates a recomputer scoring the transactions of the trailing
+// window, whose weight halves every halfLife
+func NewRecomputer(store *storage.Storage, window, halfLife time.Duration, batchSize int) *Recomputer {
+	if batchSize < 1 {
+		batchSize = 500
+	}
+	return &Recomputer{
+		store:     store,
+		window:    window,
+		halfLife:  halfLife,
+		batchSize: batchSize,
+	}
+}
+
+// Recompute recomputes every account as of now and returns how many were
+// recomputed. Each batch is committed on its own, so a failed run leaves the
+// accounts before the failure recomputed.
+func (r *Recomputer) Recompute(ctx context.Context) (int, error) {
+	start := time.Now()
+	total, after := 0, ""
+	metrics.RecordRiskRecomputeBatch(0, 0)
+	for {
+		last, n, err := r.store.RecomputeRiskMetrics(ctx, after, r.batchSize, start, r.window, r.halfLife)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		metrics.RecordRiskRecomputeBatch(n, total)
+		if n < r.batchSize {
+			break
+		}
+		after = last
+	}
+
+	metrics.RecordRiskRecomputeDone(time.Since(start))
+	log.Printf("Risk recomputation: %d accounts in %s", total, time.Since(start).Round(time.Millisecond))
+	return total, nil
+}
+
+// RunScheduled recomputes every interval until ctx is cancelled
+func (r *Recomputer) RunScheduled(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := r.Recompute(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("scheduled risk recomputation error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// Account errors
+var (
+	ErrAccountExists            = errors.New("account already exists")
+	ErrAccountNotFound          = errors.New("account not found")
+	ErrInvalidStatusTransition  = errors.New("account status change not allowed")
+	errAccountStatusUnavailable = errors.New("account status cache unavailable")
+)
+
+// accountColumns are the columns scanned by scanAccount. Rows created before
+// the accounts API may lack a status or balance.
+const accountColumns = `id, user_id, tenant_id, account_type, COALESCE(balance, 0), currency,
+	COALESCE(status, 'active'), created_at, updated_at`
+
+// setAccountStatus caches the status of an account unless the cache holds
+// one set later, so a sync that read the account before a status change
+// cannot undo the change. Values are encoded by models.AccountStatusValue.
+var setAccountStatus = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	local version = tonumber(string.match(current, "^(%d+):"))
+	if version and version > tonumber(ARGV[1]) then
+		return 0
+	end
+end
+redis.call("SET", KEYS[1], ARGV[2])
+return 1
+`)
+
+// accountSyncBatchSize is the number of account statuses written to the
+// cache per round trip by SyncAccountStatuses
+const accountSyncBatchSize = 1000
+
+// CreateAccount creates an active account, records it in the audit log and
+// publishes its status. It fails with ErrAccountExists when the ID is taken.
+func (s *Storage) CreateAccount(ctx context.Context, actor string, account *models.Account) error {
+	ctx = withQueryName(ctx, "create_account")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin account creation: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	// Truncated to the precision of the column, so the cached status carries
+	// the version SyncAccountStatuses reads back
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	account.Status = models.AccountStatusActive
+	account.CreatedAt, account.UpdatedAt = now, now
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO accounts (id, user_id, tenant_id, account_type, balance, currency, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, account.ID, account.UserID, account.TenantID, account.AccountType, account.Balance,
+		account.Currency, account.Status, account.CreatedAt, account.UpdatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrAccountExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+
+	details := fmt.Sprintf("user_id=%s type=%s currency=%s", account.UserID, account.AccountType, account.Currency)
+	if err := auditAccount(ctx, dbTx, actor, models.AuditActionAccountCreate, account.ID, details); err != nil {
+		return err
+	}
+	if err := s.enqueueAccountEvent(ctx, dbTx, actor, account, ""); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit account creation: %w", err)
+	}
+
+	s.cacheAccountStatus(ctx, account)
+	return nil
+}
+
+// GetAccount returns an account, or ErrAccountNotFound
+func (s *Storage) GetAccount(ctx context.Context, id string) (*models.Account, error) {
+	ctx = withQueryName(ctx, "get_account")
+	row := s.readDB(ctx).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id = $1`, id)
+	return scanAccount(row)
+}
+
+// ListAccountsByUser returns the accounts of a user, oldest first. A nil
+// tenantID lists the accounts of every tenant.
+func (s *Storage) ListAccountsByUser(ctx context.Context, userID string, tenantID *string) ([]*models.Account, error) {
+	ctx = withQueryName(ctx, "list_accounts_by_user")
+	query := `SELECT ` + accountColumns + ` FROM accounts
+		WHERE user_id = $1 AND ($2::text IS NULL OR tenant_id = $2)
+		ORDER BY created_at, id`
+	rows, err := s.readDB(ctx).QueryContext(ctx, query, userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []*models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// UpdateAccountStatus moves an account to status, records the change in the
+// audit log and publishes it. It fails with ErrInvalidStatusTransition when
+// the account may not move to status, such as out of closed.
+func (s *Storage) UpdateAccountStatus(ctx context.Context, actor, id, status string) (*models.Account, error) {
+	ctx = withQueryName(ctx, "update_account_status")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin account status change: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	account, err := scanAccount(dbTx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, err
+	}
+	previous := account.Status
+	if !models.AccountStatusTransitionAllowed(previous, status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, previous, status)
+	}
+
+	account.Status = status
+	account.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	_, err = dbTx.ExecContext(ctx, `UPDATE accounts SET status = $2, updated_at = $3 WHERE id = $1`,
+		account.ID, account.Status, account.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update account status: %w", err)
+	}
+
+	details := fmt.Sprintf("from=%s to=%s", previous, status)
+	if err := auditAccount(ctx, dbTx, actor, models.AuditActionAccountStatus, account.ID, details); err != nil {
+		return nil, err
+	}
+	if err := s.enqueueAccountEvent(ctx, dbTx, actor, account, previous); err != nil {
+		return nil, err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit account status change: %w", err)
+	}
+
+	s.cacheAccountStatus(ctx, account)
+	return account, nil
+}
+
+// SyncAccountStatuses writes the status of every account to the cache,
+// repairing entries missed when a write to Redis failed or Redis lost its
+// data. It returns the number of accounts written.
+func (s *Storage) SyncAccountStatuses(ctx context.Context) (int, error) {
+	ctx = withQueryName(ctx, "sync_account_statuses")
+	if s.redis == nil {
+		return 0, errAccountStatusUnavailable
+	}
+
+	synced := 0
+	after := ""
+	for {
+		// Read from the primary: a lagging replica would cache stale statuses
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, COALESCE(status, 'active'), COALESCE(updated_at, created_at, 'epoch')
+			FROM accounts WHERE id > $1 ORDER BY id LIMIT $2
+		`, after, accountSyncBatchSize)
+		if err != nil {
+			return synced, fmt.Errorf("failed to read account statuses: %w", err)
+		}
+
+		pipe := s.redis.Pipeline()
+		n := 0
+		for rows.Next() {
+			var id, status string
+			var updatedAt time.Time
+			if err := rows.Scan(&id, &status, &updatedAt); err != nil {
+				rows.Close()
+				return synced, fmt.Errorf("failed to scan account status: %w", err)
+			}
+			writeAccountStatus(ctx, pipe, id, status, updatedAt)
+			after = id
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return synced, fmt.Errorf("failed to read account statuses: %w", err)
+		}
+		if n == 0 {
+			return synced, nil
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return synced, fmt.Errorf("failed to cache account statuses: %w", err)
+		}
+		synced += n
+		if n < accountSyncBatchSize {
+			return synced, nil
+		}
+	}
+}
+
+// RunAccountStatusSync syncs the account status cache now and then every
+// interval until ctx is cancelled
+func (s *Storage) RunAccountStatusSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		synced, err := s.SyncAccountStatuses(ctx)
+		switch {
+		case errors.Is(err, errAccountStatusUnavailable):
+			slog.WarnContext(ctx, "redis not available, account statuses are not cached")
+			return
+		case err != nil && ctx.Err() == nil:
+			slog.WarnContext(ctx, "failed to sync account statuses", "synced", synced, "error", err)
+		case err == nil:
+			slog.DebugContext(ctx, "account statuses synced", "accounts", synced)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cacheAccountStatus writes the status of an account to the cache read by
+// the processing service. A failed write is logged and repaired by the next
+// SyncAccountStatuses.
+func (s *Storage) cacheAccountStatus(ctx context.Context, account *models.Account) {
+	if s.redis == nil {
+		return
+	}
+	err := writeAccountStatus(ctx, s.redis, account.ID, account.Status, account.UpdatedAt).Err()
+	if err != nil {
+		slog.WarnContext(ctx, "failed to cache account status", logging.KeyAccountID, account.ID, "error", err)
+	}
+}
+
+// writeAccountStatus caches the status an account was given at updatedAt,
+// unless a later one is cached. The script is sent whole, as in a pipeline
+// a missing script is only reported once the pipeline has run.
+func writeAccountStatus(ctx context.Context, c redis.Scripter, id, status string, updatedAt time.Time) *redis.Cmd {
+	return setAccountStatus.Eval(ctx, c, []string{models.AccountStatusKey(id)},
+		updatedAt.UnixMicro(), models.AccountStatusValue(status, updatedAt))
+}
+
+// enqueueAccountEvent writes an AccountStatusChanged event to the outbox
+// within the transaction that changes the account
+func (s *Storage) enqueueAccountEvent(ctx context.Context, dbTx *sql.Tx, actor string, account *models.Account, previous string) error {
+	ctx = withQueryName(ctx, "enqueue_account_event")
+	if s.accountTopic == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.AccountStatusChanged{
+		AccountID:      account.ID,
+		UserID:         account.UserID,
+		TenantID:       account.TenantID,
+		Status:         account.Status,
+		PreviousStatus: previous,
+		ChangedBy:      actor,
+		ChangedAt:      account.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal account event: %w", err)
+	}
+
+	_, err = dbTx.ExecContext(ctx,
+		`INSERT INTO outbox (topic, key, payload, created_at) VALUES ($1, $2, $3, $4)`,
+		s.accountTopic, account.ID, payload, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue account event: %w", err)
+	}
+	return nil
+}
+
+// auditAccount records an account change in the audit log within dbTx
+func auditAccount(ctx context.Context, dbTx *sql.Tx, actor, action, accountID, details string) error {
+	ctx = withQueryName(ctx, "audit_account")
+	_, err := dbTx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, subject, details, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, actor, action, "account:"+accountID, details, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// scanAccount scans a row selected with accountColumns
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var account models.Account
+	err := row.Scan(&account.ID, &account.UserID, &account.TenantID, &account.AccountType,
+		&account.Balance, &account.Currency, &account.Status, &account.CreatedAt, &account.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan account: %w", err)
+	}
+	return &account, nil
+}
@@ -0,0 +1,226 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newAccountStorage returns a storage publishing account events to the
+// accounts topic and caching their statuses in an in-memory Redis
+func newAccountStorage(t *testing.T) (*Storage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	s := newTestStorage(t, Options{
+		Redis:        redisconn.Config{Mode: redisconn.ModeSingle, Addr: mr.Addr()},
+		AccountTopic: "accounts.status",
+	})
+	return s, mr
+}
+
+// cachedStatus returns the status cached for an account, "" when none is
+func cachedStatus(mr *miniredis.Miniredis, id string) string {
+	value, err := mr.Get(models.AccountStatusKey(id))
+	if err != nil {
+		return ""
+	}
+	return shared.ParseAccountStatusValue(value)
+}
+
+// accountEvents returns the account events in the outbox, as
+// "account previous>status by actor"
+func accountEvents(t *testing.T, s *Storage) []string {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT key, payload FROM outbox WHERE topic = 'accounts.status' ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to read outbox: %v", err)
+	}
+	defer rows.Close()
+	var events []string
+	for rows.Next() {
+		var key string
+		var payload []byte
+		if err := rows.Scan(&key, &payload); err != nil {
+			t.Fatalf("failed to scan outbox: %v", err)
+		}
+		var event models.AccountStatusChanged
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatalf("failed to decode account event: %v", err)
+		}
+		if event.AccountID != key {
+			t.Errorf("event of %s keyed %s", event.AccountID, key)
+		}
+		events = append(events, event.AccountID+" "+event.PreviousStatus+">"+event.Status+" by "+event.ChangedBy)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read outbox: %v", err)
+	}
+	return events
+}
+
+func TestAccountStatusTransitions(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newAccountStorage(t)
+
+	account := &models.Account{ID: "acct-1", UserID: "user-1", AccountType: "checking", Currency: "USD"}
+	if err := s.CreateAccount(ctx, "admin-1", account); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if account.Status != models.AccountStatusActive || cachedStatus(mr, "acct-1") != models.AccountStatusActive {
+		t.Errorf("created %s, cached %q, want active", account.Status, cachedStatus(mr, "acct-1"))
+	}
+	if err := s.CreateAccount(ctx, "admin-1", &models.Account{ID: "acct-1", UserID: "user-2", AccountType: "savings", Currency: "EUR"}); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("CreateAccount of a taken ID = %v, want ErrAccountExists", err)
+	}
+
+	steps := []struct {
+		status string
+		err    error
+	}{
+		{models.AccountStatusFrozen, nil},
+		{models.AccountStatusFrozen, ErrInvalidStatusTransition},
+		{models.AccountStatusActive, nil},
+		{"suspended", ErrInvalidStatusTransition},
+		{models.AccountStatusClosed, nil},
+		// A closed account stays closed
+		{models.AccountStatusActive, ErrInvalidStatusTransition},
+		{models.AccountStatusFrozen, ErrInvalidStatusTransition},
+	}
+	want := models.AccountStatusActive
+	for _, step := range steps {
+		updated, err := s.UpdateAccountStatus(ctx, "admin-2", "acct-1", step.status)
+		if !errors.Is(err, step.err) {
+			t.Fatalf("UpdateAccountStatus(%s) = %v, want %v", step.status, err, step.err)
+		}
+		if err == nil {
+			want = step.status
+			if updated.Status != want {
+				t.Errorf("updated to %s, want %s", updated.Status, want)
+			}
+		}
+		if got := cachedStatus(mr, "acct-1"); got != want {
+			t.Errorf("after %s: cached %q, want %s", step.status, got, want)
+		}
+	}
+	if got, err := s.GetAccount(ctx, "acct-1"); err != nil || got.Status != models.AccountStatusClosed {
+		t.Errorf("GetAccount = %+v, %v, want closed", got, err)
+	}
+	if _, err := s.UpdateAccountStatus(ctx, "admin-2", "acct-none", models.AccountStatusFrozen); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("UpdateAccountStatus of an unknown account = %v, want ErrAccountNotFound", err)
+	}
+
+	// Every change, and only those made, is audited and published
+	wantEvents := []string{
+		"acct-1 >active by admin-1",
+		"acct-1 active>frozen by admin-2",
+		"acct-1 frozen>active by admin-2",
+		"acct-1 active>closed by admin-2",
+	}
+	if got := accountEvents(t, s); strings.Join(got, "\n") != strings.Join(wantEvents, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(wantEvents, "\n"))
+	}
+	wantAudit := []string{
+		"admin-1 account_create account:acct-1",
+		"admin-2 account_status account:acct-1",
+		"admin-2 account_status account:acct-1",
+		"admin-2 account_status account:acct-1",
+	}
+	if got := auditLog(t, s); strings.Join(got, "\n") != strings.Join(wantAudit, "\n") {
+		t.Errorf("audit log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(wantAudit, "\n"))
+	}
+}
+
+func TestListAccountsByUser(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newAccountStorage(t)
+	for _, account := range []*models.Account{
+		{ID: "acct-1", UserID: "user-1", TenantID: "unit-a", AccountType: "checking", Currency: "USD"},
+		{ID: "acct-2", UserID: "user-1", TenantID: "unit-b", AccountType: "savings", Currency: "EUR"},
+		{ID: "acct-3", UserID: "user-2", TenantID: "unit-a", AccountType: "credit", Currency: "USD"},
+	} {
+		if err := s.CreateAccount(ctx, "admin-1", account); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+
+	unitA := "unit-a"
+	tests := []struct {
+		name   string
+		user   string
+		tenant *string
+		want   string
+	}{
+		{"every tenant", "user-1", nil, "acct-1,acct-2"},
+		{"one tenant", "user-1", &unitA, "acct-1"},
+		{"no accounts", "user-3", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, err := s.ListAccountsByUser(ctx, tt.user, tt.tenant)
+			if err != nil {
+				t.Fatalf("ListAccountsByUser: %v", err)
+			}
+			ids := make([]string, len(accounts))
+			for i, account := range accounts {
+				ids[i] = account.ID
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("accounts %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncAccountStatusesRepairsTheCache(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newAccountStorage(t)
+	for _, id := range []string{"acct-1", "acct-2", "acct-3"} {
+		if err := s.CreateAccount(ctx, "admin-1", &models.Account{ID: id, UserID: "user-1", AccountType: "checking", Currency: "USD"}); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+	if _, err := s.UpdateAccountStatus(ctx, "admin-1", "acct-2", models.AccountStatusFrozen); err != nil {
+		t.Fatalf("UpdateAccountStatus: %v", err)
+	}
+
+	// Redis lost its data, and holds a status set after the sync read acct-3
+	mr.FlushAll()
+	later := models.AccountStatusValue(models.AccountStatusClosed, time.Now().Add(time.Minute))
+	mr.Set(models.AccountStatusKey("acct-3"), later)
+
+	if n, err := s.SyncAccountStatuses(ctx); err != nil || n != 3 {
+		t.Fatalf("SyncAccountStatuses = %d, %v, want 3 accounts", n, err)
+	}
+	for id, want := range map[string]string{"acct-1": "active", "acct-2": "frozen", "acct-3": "closed"} {
+		if got := cachedStatus(mr, id); got != want {
+			t.Errorf("%s cached %q, want %s", id, got, want)
+		}
+	}
+	if value, _ := mr.Get(models.AccountStatusKey("acct-3")); value != later {
+		t.Errorf("sync overwrote the later status %q with %q", later, value)
+	}
+}
+
+func TestAccountsWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{Redis: redisconn.Config{Mode: redisconn.ModeSingle, Addr: "127.0.0.1:1"}})
+
+	// Accounts are managed, and their statuses left uncached
+	if err := s.CreateAccount(ctx, "admin-1", &models.Account{ID: "acct-1", UserID: "user-1", AccountType: "checking", Currency: "USD"}); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if _, err := s.SyncAccountStatuses(ctx); !errors.Is(err, errAccountStatusUnavailable) {
+		t.Errorf("SyncAccountStatuses = %v, want errAccountStatusUnavailable", err)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// decisionAuditColumns are the columns scanned by scanDecisionAudit
+const decisionAuditColumns = `transaction_id, tenant_id, decided_at, stage, rules_version,
+	contributions, noise, risk_score, COALESCE(risk_level, ''), thresholds, decision,
+	COALESCE(rejection_reason, ''), processor_id, processor_version, processor_instance`
+
+// StoreDecisionAudit appends the audit of a decision, creating the partition
+// of its month when needed. An audit already stored, redelivered by Kafka,
+// is skipped.
+func (s *Storage) StoreDecisionAudit(ctx context.Context, audit *models.DecisionAudit) error {
+	ctx = withQueryName(ctx, "store_decision_audit")
+	decidedAt := audit.DecidedAt.UTC()
+
+	if err := s.ensureAuditPartition(ctx, decidedAt); err != nil {
+		return err
+	}
+
+	contributions, err := json.Marshal(audit.Contributions)
+	if err != nil {
+		return fmt.Errorf("failed to encode contributions: %w", err)
+	}
+	thresholds, err := json.Marshal(audit.Thresholds)
+	if err != nil {
+		return fmt.Errorf("failed to encode thresholds: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO decision_audits (
+			transaction_id, tenant_id, decided_at, stage, rules_version,
+			contributions, noise, risk_score, risk_level, thresholds, decision,
+			rejection_reason, processor_id, processor_version, processor_instance
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, NULLIF($12, ''), $13, $14, $15)
+		ON CONFLICT (transaction_id, decided_at) DO NOTHING`,
+		audit.TransactionID, audit.TenantID, decidedAt, audit.Stage, audit.RulesVersion,
+		contributions, audit.Noise, audit.RiskScore, audit.RiskLevel, thresholds, audit.Decision,
+		audit.RejectionReason, audit.ProcessorID, audit.ProcessorVersion, audit.ProcessorInstance)
+	if err != nil {
+		return fmt.Errorf("failed to store decision audit: %w", err)
+	}
+	return nil
+}
+
+// GetDecisionAudits returns the audits of the decisions made on a
+// transaction, oldest first
+func (s *Storage) GetDecisionAudits(ctx context.Context, transactionID string) ([]*models.DecisionAudit, error) {
+	ctx = withQueryName(ctx, "get_decision_audits")
+	rows, err := s.readDB(ctx).QueryContext(ctx, `SELECT `+decisionAuditColumns+` FROM decision_audits
+		WHERE transaction_id = $1
+		ORDER BY decided_at`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decision audits: %w", err)
+	}
+	defer rows.Close()
+
+	audits := []*models.DecisionAudit{}
+	for rows.Next() {
+		audit, err := scanDecisionAudit(rows)
+		if err != nil {
+			return nil, err
+		}
+		audits = append(audits, audit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get decision audits: %w", err)
+	}
+	return audits, nil
+}
+
+// scanDecisionAudit scans a row of decisionAuditColumns
+func scanDecisionAudit(row rowScanner) (*models.DecisionAudit, error) {
+	var audit models.DecisionAudit
+	var contributions, thresholds []byte
+	err := row.Scan(&audit.TransactionID, &audit.TenantID, &audit.DecidedAt, &audit.Stage, &audit.RulesVersion,
+		&contributions, &audit.Noise, &audit.RiskScore, &audit.RiskLevel, &thresholds, &audit.Decision,
+		&audit.RejectionReason, &audit.ProcessorID, &audit.ProcessorVersion, &audit.ProcessorInstance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan decision audit: %w", err)
+	}
+	if err := json.Unmarshal(contributions, &audit.Contributions); err != nil {
+		return nil, fmt.Errorf("failed to decode contributions: %w", err)
+	}
+	if err := json.Unmarshal(thresholds, &audit.Thresholds); err != nil {
+		return nil, fmt.Errorf("failed to decode thresholds: %w", err)
+	}
+	return &audit, nil
+}
+
+// ensureAuditPartition creates the decision_audits partition of the month
+// of t, unless this instance already has. When instances race to create it,
+// the losers fail and their audits are retried by the consumer.
+func (s *Storage) ensureAuditPartition(ctx context.Context, t time.Time) error {
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	name := fmt.Sprintf("decision_audits_y%04dm%02d", from.Year(), from.Month())
+
+	s.auditPartitionsMu.Lock()
+	defer s.auditPartitionsMu.Unlock()
+	if s.auditPartitions[name] {
+		return nil
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF decision_audits
+		FOR VALUES FROM ('%s') TO ('%s')`,
+		name, from.Format(time.DateOnly), from.AddDate(0, 1, 0).Format(time.DateOnly))
+	if _, err := s.db.ExecContext(withQueryName(ctx, "create_audit_partition"), query); err != nil {
+		return fmt.Errorf("failed to create decision audit partition %s: %w", name, err)
+	}
+	if s.auditPartitions == nil {
+		s.auditPartitions = make(map[string]bool)
+	}
+	s.auditPartitions[name] = true
+	return nil
+}
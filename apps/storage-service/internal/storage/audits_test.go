@@ -0,0 +1,113 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// testAudit returns the audit of a transaction rejected at decidedAt
+func testAudit(id string, decidedAt time.Time) *models.DecisionAudit {
+	return &models.DecisionAudit{
+		TransactionID: id,
+		TenantID:      "unit-a",
+		DecidedAt:     decidedAt,
+		Stage:         shared.DecisionStageRisk,
+		RulesVersion:  "sha256:0123456789abcdef",
+		Contributions: []shared.RuleContribution{
+			{Rule: "high_amount", Mode: "enforce", Weight: 0.3, Contribution: 0.3},
+			{Rule: "round_amount", Mode: "shadow", Weight: 0.2},
+		},
+		Noise:             0.05,
+		RiskScore:         0.85,
+		RiskLevel:         "critical",
+		Thresholds:        shared.DecisionThresholds{AutoApprove: 0.3, Flag: 0.6, AutoReject: 0.8},
+		Decision:          "rejected",
+		RejectionReason:   "risk score 0.85 above 0.8",
+		ProcessorID:       "processor-001",
+		ProcessorVersion:  "v1.4.2",
+		ProcessorInstance: "processing-7f9c",
+	}
+}
+
+func TestDecisionAuditsAreAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+
+	// Two decisions in different months, the second a redelivery
+	march := time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 1, 0, 1, 0, 0, time.UTC)
+	first, second := testAudit("txn-1", march), testAudit("txn-1", april)
+	second.Decision, second.RejectionReason = "approved", ""
+	for _, audit := range []*models.DecisionAudit{second, first, first} {
+		if err := s.StoreDecisionAudit(ctx, audit); err != nil {
+			t.Fatalf("StoreDecisionAudit: %v", err)
+		}
+	}
+	if err := s.StoreDecisionAudit(ctx, testAudit("txn-2", march)); err != nil {
+		t.Fatalf("StoreDecisionAudit: %v", err)
+	}
+
+	audits, err := s.GetDecisionAudits(ctx, "txn-1")
+	if err != nil {
+		t.Fatalf("GetDecisionAudits: %v", err)
+	}
+	if len(audits) != 2 {
+		t.Fatalf("%d audits, want the two decisions, oldest first", len(audits))
+	}
+	for i, want := range []*models.DecisionAudit{first, second} {
+		got := audits[i]
+		if !got.DecidedAt.Equal(want.DecidedAt) {
+			t.Errorf("audit %d decided at %s, want %s", i, got.DecidedAt, want.DecidedAt)
+		}
+		got.DecidedAt = want.DecidedAt
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("audit %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if audits, err := s.GetDecisionAudits(ctx, "txn-none"); err != nil || audits == nil || len(audits) != 0 {
+		t.Errorf("GetDecisionAudits of an undecided transaction = %v, %v, want an empty list", audits, err)
+	}
+
+	// A partition per month
+	var partitions []string
+	rows, err := s.db.Query(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'decision_audits' ORDER BY c.relname`)
+	if err != nil {
+		t.Fatalf("failed to list partitions: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("failed to scan partition: %v", err)
+		}
+		partitions = append(partitions, name)
+	}
+	if got := strings.Join(partitions, ","); got != "decision_audits_y2026m03,decision_audits_y2026m04" {
+		t.Errorf("partitions %s, want March and April 2026", got)
+	}
+
+	// Rows can be neither changed nor removed
+	for _, statement := range []string{
+		`UPDATE decision_audits SET decision = 'approved' WHERE transaction_id = 'txn-1'`,
+		`DELETE FROM decision_audits WHERE transaction_id = 'txn-1'`,
+	} {
+		if _, err := s.db.Exec(statement); err == nil || !strings.Contains(err.Error(), "append-only") {
+			t.Errorf("%s = %v, want it refused", statement, err)
+		}
+	}
+	if audits, _ := s.GetDecisionAudits(ctx, "txn-1"); len(audits) != 2 || audits[0].Decision != "rejected" {
+		t.Errorf("audits changed: %+v", audits)
+	}
+}
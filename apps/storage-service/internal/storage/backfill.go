@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"storage-service/internal/models"
+)
+
+// StoreBackfill stores a batch of historical transactions in one database
+// transaction, through the insert of the live consumer, and returns how
+// many it inserted. A transaction whose ID or idempotency key is already
+// stored, or earlier in the batch, is skipped. Unlike StoreTransaction no
+// stored event, callback or risk metric is emitted, which would replay
+// history downstream; in integrity mode the transactions join the end of
+// their account's chain as late arrivals do.
+func (s *Storage) StoreBackfill(ctx context.Context, txns []*models.StoredTransaction) (int, error) {
+	ctx = withQueryName(ctx, "store_backfill")
+	if len(txns) == 0 {
+		return 0, nil
+	}
+
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	inserted := 0
+	for _, txn := range txns {
+		var exists bool
+		err := dbTx.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM transactions WHERE id = $1 OR idempotency_key = $2)`,
+			txn.ID, txn.IdempotencyKey).Scan(&exists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check transaction %s existence: %w", txn.ID, err)
+		}
+		if exists {
+			continue
+		}
+
+		if err := s.insertTransaction(ctx, dbTx, txn); err != nil {
+			return 0, fmt.Errorf("transaction %s: %w", txn.ID, err)
+		}
+		if s.integrity {
+			if err := s.chainTransaction(ctx, dbTx, txn); err != nil {
+				return 0, fmt.Errorf("transaction %s: %w", txn.ID, err)
+			}
+		}
+		inserted++
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return inserted, nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// Blocklist errors
+var (
+	ErrBlocklistEntryExists   = errors.New("blocklist entry already exists")
+	ErrBlocklistEntryNotFound = errors.New("blocklist entry not found")
+)
+
+// blocklistColumns are the columns scanned by scanBlocklistEntry
+const blocklistColumns = `id, type, value, reason, added_by, created_at, expires_at`
+
+// ListBlocklist returns the blocklist entries by ID, without the expired
+// ones unless includeExpired is set
+func (s *Storage) ListBlocklist(ctx context.Context, includeExpired bool) ([]*models.BlocklistEntry, error) {
+	ctx = withQueryName(ctx, "list_blocklist")
+	query := `SELECT ` + blocklistColumns + ` FROM blocklist
+		WHERE $1 OR expires_at IS NULL OR expires_at > $2
+		ORDER BY id`
+	rows, err := s.readDB(ctx).QueryContext(ctx, query, includeExpired, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocklist: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.BlocklistEntry{}
+	for rows.Next() {
+		entry, err := scanBlocklistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list blocklist: %w", err)
+	}
+	return entries, nil
+}
+
+// GetBlocklistEntry returns a blocklist entry, or ErrBlocklistEntryNotFound
+func (s *Storage) GetBlocklistEntry(ctx context.Context, id int64) (*models.BlocklistEntry, error) {
+	ctx = withQueryName(ctx, "get_blocklist_entry")
+	row := s.readDB(ctx).QueryRowContext(ctx, `SELECT `+blocklistColumns+` FROM blocklist WHERE id = $1`, id)
+	return scanBlocklistEntry(row)
+}
+
+// AddBlocklistEntry adds an entry and records it in the audit log, setting
+// its ID and creation time. An expired entry for the same type and value is
+// replaced; an active one fails with ErrBlocklistEntryExists.
+func (s *Storage) AddBlocklistEntry(ctx context.Context, actor string, entry *models.BlocklistEntry) error {
+	ctx = withQueryName(ctx, "add_blocklist_entry")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin blocklist add: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	now := time.Now().UTC()
+	err = dbTx.QueryRowContext(ctx, `
+		INSERT INTO blocklist (type, value, reason, added_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (type, value) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			added_by = EXCLUDED.added_by,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE blocklist.expires_at IS NOT NULL AND blocklist.expires_at <= $5
+		RETURNING id
+	`, entry.Type, entry.Value, entry.Reason, actor, now, utcOrNil(entry.ExpiresAt)).Scan(&entry.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrBlocklistEntryExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add blocklist entry: %w", err)
+	}
+	entry.AddedBy = actor
+	entry.CreatedAt = now
+
+	if err := auditBlocklist(ctx, dbTx, actor, models.AuditActionBlocklistAdd, entry); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit blocklist add: %w", err)
+	}
+	return nil
+}
+
+// UpdateBlocklistEntry changes the reason and expiry of an entry and records
+// the change in the audit log
+func (s *Storage) UpdateBlocklistEntry(ctx context.Context, actor string, id int64, reason string, expiresAt *time.Time) (*models.BlocklistEntry, error) {
+	ctx = withQueryName(ctx, "update_blocklist_entry")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin blocklist update: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	entry, err := scanBlocklistEntry(dbTx.QueryRowContext(ctx, `
+		UPDATE blocklist SET reason = $2, expires_at = $3 WHERE id = $1
+		RETURNING `+blocklistColumns, id, reason, utcOrNil(expiresAt)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := auditBlocklist(ctx, dbTx, actor, models.AuditActionBlocklistUpdate, entry); err != nil {
+		return nil, err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit blocklist update: %w", err)
+	}
+	return entry, nil
+}
+
+// RemoveBlocklistEntry deletes an entry and records it in the audit log
+func (s *Storage) RemoveBlocklistEntry(ctx context.Context, actor string, id int64) error {
+	ctx = withQueryName(ctx, "remove_blocklist_entry")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin blocklist removal: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	entry, err := scanBlocklistEntry(dbTx.QueryRowContext(ctx,
+		`DELETE FROM blocklist WHERE id = $1 RETURNING `+blocklistColumns, id))
+	if err != nil {
+		return err
+	}
+
+	if err := auditBlocklist(ctx, dbTx, actor, models.AuditActionBlocklistRemove, entry); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit blocklist removal: %w", err)
+	}
+	return nil
+}
+
+// auditBlocklist records a blocklist change in the audit log within dbTx, so
+// no change is made unrecorded
+func auditBlocklist(ctx context.Context, dbTx *sql.Tx, actor, action string, entry *models.BlocklistEntry) error {
+	ctx = withQueryName(ctx, "audit_blocklist")
+	details := fmt.Sprintf("type=%s value=%s reason=%q", entry.Type, entry.Value, entry.Reason)
+	if entry.ExpiresAt != nil {
+		details += " expires_at=" + entry.ExpiresAt.Format(time.RFC3339)
+	}
+	_, err := dbTx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, subject, details, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, actor, action, fmt.Sprintf("blocklist:%d", entry.ID), details, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// scanBlocklistEntry scans a row of blocklistColumns
+func scanBlocklistEntry(row rowScanner) (*models.BlocklistEntry, error) {
+	var entry models.BlocklistEntry
+	var expiresAt sql.NullTime
+	err := row.Scan(&entry.ID, &entry.Type, &entry.Value, &entry.Reason, &entry.AddedBy, &entry.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBlocklistEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan blocklist entry: %w", err)
+	}
+	if expiresAt.Valid {
+		entry.ExpiresAt = &expiresAt.Time
+	}
+	return &entry, nil
+}
+
+// utcOrNil returns t in UTC, the zone of the table's timestamps, or nil
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
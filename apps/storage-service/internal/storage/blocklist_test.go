@@ -0,0 +1,141 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// auditLog returns the actor, action and subject of each audit log row, in
+// order
+func auditLog(t *testing.T, s *Storage) []string {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT actor, action, subject FROM audit_log ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	defer rows.Close()
+	var log []string
+	for rows.Next() {
+		var actor, action, subject string
+		if err := rows.Scan(&actor, &action, &subject); err != nil {
+			t.Fatalf("failed to scan audit log: %v", err)
+		}
+		log = append(log, strings.Join([]string{actor, action, subject}, " "))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	return log
+}
+
+func TestBlocklistChangesAreAudited(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+
+	entry := &models.BlocklistEntry{Type: models.BlocklistTypeMerchant, Value: "Shady Shop", Reason: "chargeback ring"}
+	if err := s.AddBlocklistEntry(ctx, "admin-1", entry); err != nil {
+		t.Fatalf("AddBlocklistEntry: %v", err)
+	}
+	if entry.ID == 0 || entry.AddedBy != "admin-1" || entry.CreatedAt.IsZero() {
+		t.Errorf("added entry %+v, want its ID, actor and creation time set", entry)
+	}
+	got, err := s.GetBlocklistEntry(ctx, entry.ID)
+	if err != nil || got.Value != "Shady Shop" || got.Reason != "chargeback ring" || got.ExpiresAt != nil {
+		t.Fatalf("GetBlocklistEntry = %+v, %v", got, err)
+	}
+
+	// An active entry for the same type and value is refused
+	duplicate := &models.BlocklistEntry{Type: models.BlocklistTypeMerchant, Value: "Shady Shop", Reason: "again"}
+	if err := s.AddBlocklistEntry(ctx, "admin-2", duplicate); !errors.Is(err, ErrBlocklistEntryExists) {
+		t.Errorf("AddBlocklistEntry of a duplicate = %v, want %v", err, ErrBlocklistEntryExists)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	updated, err := s.UpdateBlocklistEntry(ctx, "admin-2", entry.ID, "confirmed fraud", &expiresAt)
+	if err != nil {
+		t.Fatalf("UpdateBlocklistEntry: %v", err)
+	}
+	if updated.Reason != "confirmed fraud" || updated.ExpiresAt == nil || !updated.ExpiresAt.Equal(expiresAt) || updated.AddedBy != "admin-1" {
+		t.Errorf("updated entry %+v, want the new reason and expiry", updated)
+	}
+
+	if err := s.RemoveBlocklistEntry(ctx, "admin-1", entry.ID); err != nil {
+		t.Fatalf("RemoveBlocklistEntry: %v", err)
+	}
+	if _, err := s.GetBlocklistEntry(ctx, entry.ID); !errors.Is(err, ErrBlocklistEntryNotFound) {
+		t.Errorf("GetBlocklistEntry of a removed entry = %v, want %v", err, ErrBlocklistEntryNotFound)
+	}
+	if _, err := s.UpdateBlocklistEntry(ctx, "admin-1", entry.ID, "", nil); !errors.Is(err, ErrBlocklistEntryNotFound) {
+		t.Errorf("UpdateBlocklistEntry of a removed entry = %v, want %v", err, ErrBlocklistEntryNotFound)
+	}
+	if err := s.RemoveBlocklistEntry(ctx, "admin-1", entry.ID); !errors.Is(err, ErrBlocklistEntryNotFound) {
+		t.Errorf("RemoveBlocklistEntry of a removed entry = %v, want %v", err, ErrBlocklistEntryNotFound)
+	}
+
+	// Every change, and only a change, is recorded with who made it
+	subject := fmt.Sprintf("blocklist:%d", entry.ID)
+	want := []string{
+		"admin-1 " + models.AuditActionBlocklistAdd + " " + subject,
+		"admin-2 " + models.AuditActionBlocklistUpdate + " " + subject,
+		"admin-1 " + models.AuditActionBlocklistRemove + " " + subject,
+	}
+	if got := auditLog(t, s); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExpiredBlocklistEntries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+
+	past := time.Now().Add(-time.Minute)
+	expired := &models.BlocklistEntry{Type: models.BlocklistTypeCountry, Value: "RU", Reason: "sanctions", ExpiresAt: &past}
+	active := &models.BlocklistEntry{Type: models.BlocklistTypeAccount, Value: "acct-1", Reason: "account takeover"}
+	for _, entry := range []*models.BlocklistEntry{expired, active} {
+		if err := s.AddBlocklistEntry(ctx, "admin-1", entry); err != nil {
+			t.Fatalf("AddBlocklistEntry: %v", err)
+		}
+	}
+
+	tests := []struct {
+		includeExpired bool
+		values         string
+	}{
+		{false, "acct-1"},
+		{true, "RU,acct-1"},
+	}
+	for _, tt := range tests {
+		entries, err := s.ListBlocklist(ctx, tt.includeExpired)
+		if err != nil {
+			t.Fatalf("ListBlocklist: %v", err)
+		}
+		var values []string
+		for _, e := range entries {
+			values = append(values, e.Value)
+		}
+		if got := strings.Join(values, ","); got != tt.values {
+			t.Errorf("ListBlocklist(%v) = %s, want %s", tt.includeExpired, got, tt.values)
+		}
+	}
+
+	// An expired entry is replaced rather than refused
+	again := &models.BlocklistEntry{Type: models.BlocklistTypeCountry, Value: "RU", Reason: "sanctions renewed"}
+	if err := s.AddBlocklistEntry(ctx, "admin-2", again); err != nil {
+		t.Fatalf("AddBlocklistEntry over an expired entry: %v", err)
+	}
+	got, err := s.GetBlocklistEntry(ctx, again.ID)
+	if err != nil || got.Reason != "sanctions renewed" || got.AddedBy != "admin-2" || got.ExpiresAt != nil {
+		t.Errorf("replaced entry %+v, %v, want the new one", got, err)
+	}
+	if entries, err := s.ListBlocklist(ctx, true); err != nil || len(entries) != 2 {
+		t.Errorf("ListBlocklist = %d entries, %v, want the expired one replaced", len(entries), err)
+	}
+}
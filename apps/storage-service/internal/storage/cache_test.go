@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testCacheTTL         = time.Hour
+	testNegativeCacheTTL = 30 * time.Second
+	testSummaryCacheTTL  = time.Minute
+)
+
+// newCacheStorage returns a storage caching in an in-memory Redis, without
+// a database: lookups the cache does not answer fail
+func newCacheStorage(t *testing.T) (*Storage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &Storage{
+		redis:            client,
+		cacheTTL:         testCacheTTL,
+		negativeCacheTTL: testNegativeCacheTTL,
+		summaryCacheTTL:  testSummaryCacheTTL,
+	}, mr
+}
+
+// counterValue returns the value of the counter name with labels in the
+// default registry, 0 when it was never incremented
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// cacheRequests returns the number of lookups of cache with result
+func cacheRequests(t *testing.T, cache, result string) float64 {
+	return counterValue(t, "storage_cache_requests_total", map[string]string{"cache": cache, "result": result})
+}
+
+func cachedFixture(id string) *models.StoredTransaction {
+	return &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:        id,
+			AccountID: "acct-1",
+			Amount:    42.5,
+			Currency:  "USD",
+			Status:    "approved",
+			Timestamp: time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+		},
+		RiskScore: 0.1,
+		RiskLevel: "low",
+	}}
+}
+
+func TestCachedTransactionIsServedWithoutTheDatabase(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheTransaction(ctx, cachedFixture("txn-1"))
+
+	if ttl := mr.TTL(transactionCacheKey("txn-1")); ttl != testCacheTTL {
+		t.Errorf("TTL = %s, want %s", ttl, testCacheTTL)
+	}
+
+	hits := cacheRequests(t, "transaction", "hit")
+	txn, err := s.GetTransaction(ctx, "txn-1")
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if txn.ID != "txn-1" || txn.Amount != 42.5 || txn.RiskLevel != "low" {
+		t.Errorf("cached transaction = %+v", txn.ProcessedTransaction)
+	}
+	if got := cacheRequests(t, "transaction", "hit"); got != hits+1 {
+		t.Errorf("%v hits recorded, want 1", got-hits)
+	}
+}
+
+func TestCachedTransactionExpires(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheTransaction(ctx, cachedFixture("txn-1"))
+
+	mr.FastForward(testCacheTTL)
+	misses := cacheRequests(t, "transaction", "miss")
+	if _, err := s.getCachedTransaction(ctx, "txn-1"); !errors.Is(err, redis.Nil) {
+		t.Errorf("error = %v after the TTL, want a miss", err)
+	}
+	if got := cacheRequests(t, "transaction", "miss"); got != misses+1 {
+		t.Errorf("%v misses recorded, want 1", got-misses)
+	}
+}
+
+func TestNotFoundIsCachedBriefly(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheTransactionNotFound(ctx, "junk")
+
+	negative := cacheRequests(t, "transaction", "negative_hit")
+	if _, err := s.GetTransaction(ctx, "junk"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("error = %v, want ErrTransactionNotFound from the cache", err)
+	}
+	if got := cacheRequests(t, "transaction", "negative_hit"); got != negative+1 {
+		t.Errorf("%v negative hits recorded, want 1", got-negative)
+	}
+
+	mr.FastForward(testNegativeCacheTTL)
+	if mr.Exists(transactionCacheKey("junk")) {
+		t.Error("negative entry outlived its TTL")
+	}
+}
+
+func TestNegativeCachingCanBeDisabled(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	s.negativeCacheTTL = 0
+	s.cacheTransactionNotFound(context.Background(), "junk")
+	if mr.Exists(transactionCacheKey("junk")) {
+		t.Error("negative entry cached with a zero TTL")
+	}
+}
+
+func TestCachingReplacesNegativeEntry(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheTransactionNotFound(ctx, "txn-1")
+	s.cacheTransaction(ctx, cachedFixture("txn-1"))
+
+	if _, err := s.GetTransaction(ctx, "txn-1"); err != nil {
+		t.Errorf("GetTransaction: %v, want the stored transaction", err)
+	}
+	if ttl := mr.TTL(transactionCacheKey("txn-1")); ttl != testCacheTTL {
+		t.Errorf("TTL = %s, want the positive %s", ttl, testCacheTTL)
+	}
+}
+
+func TestInvalidateTransaction(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheTransaction(ctx, cachedFixture("txn-1"))
+
+	invalidations := counterValue(t, "storage_cache_invalidations_total", map[string]string{"cache": "transaction"})
+	s.InvalidateTransaction(ctx, "txn-1")
+	if mr.Exists(transactionCacheKey("txn-1")) {
+		t.Error("transaction still cached")
+	}
+	if got := counterValue(t, "storage_cache_invalidations_total", map[string]string{"cache": "transaction"}); got != invalidations+1 {
+		t.Errorf("%v invalidations recorded, want 1", got-invalidations)
+	}
+}
+
+func TestSummaryCache(t *testing.T) {
+	s, mr := newCacheStorage(t)
+	ctx := context.Background()
+	s.cacheSummary(ctx, &models.TransactionSummary{AccountID: "acct-1", TotalTransactions: 3, TotalAmount: 127.5})
+
+	if ttl := mr.TTL(summaryCacheKey("acct-1")); ttl != testSummaryCacheTTL {
+		t.Errorf("TTL = %s, want %s", ttl, testSummaryCacheTTL)
+	}
+	summary, err := s.GetTransactionSummary(ctx, "acct-1")
+	if err != nil {
+		t.Fatalf("GetTransactionSummary: %v", err)
+	}
+	if summary.TotalTransactions != 3 || summary.TotalAmount != 127.5 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	s.invalidateSummary(ctx, "acct-1")
+	if mr.Exists(summaryCacheKey("acct-1")) {
+		t.Error("summary still cached after invalidation")
+	}
+	s.cacheSummary(ctx, &models.TransactionSummary{AccountID: "acct-2"})
+	mr.FastForward(testSummaryCacheTTL)
+	if mr.Exists(summaryCacheKey("acct-2")) {
+		t.Error("summary outlived its TTL")
+	}
+}
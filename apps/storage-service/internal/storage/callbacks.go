@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// enqueueCallback queues the delivery of a transaction's outcome to its
+// callback URL, within the transaction that inserts the row, when it has
+// one and a final status
+func (s *Storage) enqueueCallback(ctx context.Context, dbTx *sql.Tx, txn *models.StoredTransaction) error {
+	ctx = withQueryName(ctx, "enqueue_callback")
+	if !s.callbacks || txn.CallbackURL == "" || !models.IsFinalStatus(txn.Status) {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.CallbackPayload{
+		ID:              txn.ID,
+		Status:          txn.Status,
+		RiskLevel:       txn.RiskLevel,
+		RejectionReason: txn.RejectionReason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback payload: %w", err)
+	}
+
+	now := time.Now()
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO transaction_callbacks (transaction_id, url, payload, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $4)`,
+		txn.ID, txn.CallbackURL, payload, now)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue callback: %w", err)
+	}
+	return nil
+}
+
+// ClaimCallbacks returns up to limit pending callbacks due for an attempt,
+// oldest due first, leasing them for lease: they are not claimed again
+// until the lease ends, so concurrent workers never deliver the same
+// callback at once, and a worker dying mid-delivery only delays it
+func (s *Storage) ClaimCallbacks(ctx context.Context, limit int, lease time.Duration) ([]*models.Callback, error) {
+	ctx = withQueryName(ctx, "claim_callbacks")
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE transaction_callbacks SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM transaction_callbacks
+			WHERE status = 'pending' AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, transaction_id, url, payload, status, attempts, created_at`,
+		limit, now.Add(lease), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim callbacks: %w", err)
+	}
+	defer rows.Close()
+
+	var callbacks []*models.Callback
+	for rows.Next() {
+		var cb models.Callback
+		if err := rows.Scan(&cb.ID, &cb.TransactionID, &cb.URL, &cb.Payload, &cb.Status, &cb.Attempts, &cb.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan callback: %w", err)
+		}
+		callbacks = append(callbacks, &cb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read callbacks: %w", err)
+	}
+	return callbacks, nil
+}
+
+// RecordCallbackAttempt records an attempt to deliver a callback and the
+// state it left the callback in, as set on cb by the caller: delivered,
+// pending until NextAttemptAt, or dead, in which case it is copied to the
+// dead letter table
+func (s *Storage) RecordCallbackAttempt(ctx context.Context, cb *models.Callback, attempt models.CallbackAttempt) error {
+	ctx = withQueryName(ctx, "record_callback_attempt")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin callback attempt: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO callback_attempts (callback_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5, $6)
+		ON CONFLICT (callback_id, attempt) DO NOTHING`,
+		cb.ID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.Duration, attempt.AttemptedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record callback attempt: %w", err)
+	}
+
+	_, err = dbTx.ExecContext(ctx, `
+		UPDATE transaction_callbacks
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_error = NULLIF($5, ''), delivered_at = $6
+		WHERE id = $1`,
+		cb.ID, cb.Status, cb.Attempts, cb.NextAttemptAt, cb.LastError, cb.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to update callback: %w", err)
+	}
+
+	if cb.Status == models.CallbackStatusDead {
+		_, err = dbTx.ExecContext(ctx, `
+			INSERT INTO callback_dead_letters (callback_id, transaction_id, url, payload, attempts, last_error, dead_at)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+			ON CONFLICT (callback_id) DO NOTHING`,
+			cb.ID, cb.TransactionID, cb.URL, cb.Payload, cb.Attempts, cb.LastError, attempt.AttemptedAt)
+		if err != nil {
+			return fmt.Errorf("failed to dead-letter callback: %w", err)
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit callback attempt: %w", err)
+	}
+	return nil
+}
+
+// GetCallbacks returns the callbacks of a transaction with their delivery
+// attempts, oldest first
+func (s *Storage) GetCallbacks(ctx context.Context, transactionID string) ([]*models.Callback, error) {
+	ctx = withQueryName(ctx, "get_callbacks")
+	db := s.readDB(ctx)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, transaction_id, url, status, attempts, next_attempt_at,
+			COALESCE(last_error, ''), created_at, delivered_at
+		FROM transaction_callbacks
+		WHERE transaction_id = $1
+		ORDER BY id`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get callbacks: %w", err)
+	}
+
+	callbacks := []*models.Callback{}
+	byID := make(map[int64]*models.Callback)
+	for rows.Next() {
+		cb := models.Callback{History: []models.CallbackAttempt{}}
+		var nextAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&cb.ID, &cb.TransactionID, &cb.URL, &cb.Status, &cb.Attempts, &nextAttemptAt,
+			&cb.LastError, &cb.CreatedAt, &deliveredAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan callback: %w", err)
+		}
+		if nextAttemptAt.Valid && cb.Status == models.CallbackStatusPending {
+			cb.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			cb.DeliveredAt = &deliveredAt.Time
+		}
+		callbacks = append(callbacks, &cb)
+		byID[cb.ID] = &cb
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read callbacks: %w", err)
+	}
+	if len(callbacks) == 0 {
+		return callbacks, nil
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT a.callback_id, a.attempt, COALESCE(a.status_code, 0), COALESCE(a.error, ''), a.duration_ms, a.attempted_at
+		FROM callback_attempts a
+		JOIN transaction_callbacks c ON c.id = a.callback_id
+		WHERE c.transaction_id = $1
+		ORDER BY a.callback_id, a.attempt`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get callback attempts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var callbackID int64
+		var attempt models.CallbackAttempt
+		if err := rows.Scan(&callbackID, &attempt.Attempt, &attempt.StatusCode, &attempt.Error,
+			&attempt.Duration, &attempt.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan callback attempt: %w", err)
+		}
+		if cb, ok := byID[callbackID]; ok {
+			cb.History = append(cb.History, attempt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read callback attempts: %w", err)
+	}
+	return callbacks, nil
+}
+
+// CallbacksPending returns the number of callbacks waiting to be delivered
+func (s *Storage) CallbacksPending(ctx context.Context) (int64, error) {
+	ctx = withQueryName(ctx, "callbacks_pending")
+	var pending int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM transaction_callbacks WHERE status = 'pending'`).Scan(&pending)
+	return pending, err
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+)
+
+// chaosConn injects database faults into the statements and transactions of
+// a connection. Injected errors are not driver.ErrBadConn, so database/sql
+// returns them to the caller instead of retrying on another connection.
+type chaosConn struct {
+	driver.Conn
+	chaos *chaos.Injector
+}
+
+// ExecContext executes a statement after any injected fault
+func (c *chaosConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.chaos.Inject(ctx, chaos.TargetDB); err != nil {
+		return nil, err
+	}
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+// QueryContext runs a query after any injected fault
+func (c *chaosConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.chaos.Inject(ctx, chaos.TargetDB); err != nil {
+		return nil, err
+	}
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+// PrepareContext prepares a statement after any injected fault
+func (c *chaosConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.chaos.Inject(ctx, chaos.TargetDB); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx starts a transaction after any injected fault
+func (c *chaosConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.chaos.Inject(ctx, chaos.TargetDB); err != nil {
+		return nil, err
+	}
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return nil, errors.New("driver does not support transaction options")
+}
+
+// Ping checks the connection; it is not subject to faults
+func (c *chaosConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession resets the connection before it is reused
+func (c *chaosConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid reports whether the connection can be reused
+func (c *chaosConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
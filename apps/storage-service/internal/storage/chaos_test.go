@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+)
+
+// fakeConn is a database connection counting the statements it runs
+type fakeConn struct {
+	mu         sync.Mutex
+	statements int
+}
+
+func (c *fakeConn) run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements++
+}
+
+func (c *fakeConn) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statements
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.run()
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	c.run()
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	c.run()
+	return fakeRows{}, nil
+}
+
+func (c *fakeConn) Ping(context.Context) error { return nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeRows is an empty result set
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"id"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// chaosConnector opens the fake connection wrapped for chaos
+type chaosConnector struct {
+	conn  *fakeConn
+	chaos *chaos.Injector
+}
+
+func (c chaosConnector) Connect(context.Context) (driver.Conn, error) {
+	return &chaosConn{Conn: c.conn, chaos: c.chaos}, nil
+}
+
+func (c chaosConnector) Driver() driver.Driver { return nil }
+
+// chaosDB returns a database whose single connection is subject to the
+// faults of injector
+func chaosDB(t *testing.T, injector *chaos.Injector) (*sql.DB, *fakeConn) {
+	t.Helper()
+	conn := &fakeConn{}
+	db := sql.OpenDB(chaosConnector{conn: conn, chaos: injector})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, conn
+}
+
+func TestChaosConnFailsStatements(t *testing.T) {
+	ctx := context.Background()
+	injector := chaos.New(true, nil)
+	db, conn := chaosDB(t, injector)
+	if err := injector.Set(chaos.TargetDB, chaos.ModeError, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// The injected error reaches the caller rather than being retried on
+	// another connection, and the statement never runs
+	if _, err := db.ExecContext(ctx, "INSERT INTO transactions VALUES (1)"); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("Exec = %v, want %v", err, chaos.ErrInjected)
+	}
+	if _, err := db.QueryContext(ctx, "SELECT id FROM transactions"); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("Query = %v, want %v", err, chaos.ErrInjected)
+	}
+	if _, err := db.BeginTx(ctx, nil); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("BeginTx = %v, want %v", err, chaos.ErrInjected)
+	}
+	if n := conn.count(); n != 0 {
+		t.Errorf("%d statements ran through an error fault", n)
+	}
+	// Health checks are not subject to faults
+	if err := db.PingContext(ctx); err != nil {
+		t.Errorf("Ping = %v", err)
+	}
+
+	injector.Clear()
+	if _, err := db.ExecContext(ctx, "INSERT INTO transactions VALUES (1)"); err != nil {
+		t.Errorf("Exec once the fault cleared = %v", err)
+	}
+	if n := conn.count(); n != 1 {
+		t.Errorf("%d statements ran, want 1", n)
+	}
+}
+
+func TestChaosConnDelaysStatements(t *testing.T) {
+	ctx := context.Background()
+	injector := chaos.New(true, nil)
+	db, conn := chaosDB(t, injector)
+	if err := injector.Set(chaos.TargetDB, chaos.ModeLatency, 1, 30*time.Millisecond, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := db.ExecContext(ctx, "UPDATE accounts SET status = 'active'"); err != nil {
+		t.Fatalf("Exec = %v", err)
+	}
+	if took := time.Since(start); took < 30*time.Millisecond {
+		t.Errorf("Exec took %s, want the injected 30ms", took)
+	}
+
+	// A statement whose deadline passes during the latency fails with it
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(timeout, "UPDATE accounts SET status = 'active'"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec past its deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := conn.count(); n != 1 {
+		t.Errorf("%d statements ran, want 1", n)
+	}
+}
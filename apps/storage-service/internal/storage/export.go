@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"storage-service/internal/models"
+)
+
+// exportBatchSize is the number of rows fetched from the export cursor at a
+// time, bounding the rows held in memory
+const exportBatchSize = 1000
+
+// ErrExportTooLarge is returned when more transactions match an export than
+// its row cap
+var ErrExportTooLarge = errors.New("export exceeds the row cap")
+
+// TransactionExport reads the transactions matching an export from a
+// database cursor, a batch at a time. Each fetch is a statement of its own,
+// so the query timeout bounds a batch rather than the whole export.
+type TransactionExport struct {
+	store *Storage
+	ctx   context.Context
+	tx    *sql.Tx
+
+	// Total is the number of transactions the export reads
+	Total int
+
+	rows    *sql.Rows
+	fetched int
+	done    bool
+	txn     *models.StoredTransaction
+	err     error
+}
+
+// ExportTransactions opens an export of the transactions matching filter,
+// oldest first. It returns ErrExportTooLarge when more than maxRows match.
+// The count and the cursor read the same snapshot, so the export holds
+// exactly Total transactions. The export must be closed.
+func (s *Storage) ExportTransactions(ctx context.Context, filter SearchFilter, maxRows int) (*TransactionExport, error) {
+	ctx = withQueryName(ctx, "export_transactions")
+
+	conditions, args := filter.conditions([]string{"TRUE"}, nil)
+	where := strings.Join(conditions, " AND ")
+
+	tx, err := s.readDB(ctx).BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin export: %w", err)
+	}
+
+	// Count no further than one over the cap, which is enough to refuse
+	var total int
+	countQuery := fmt.Sprintf(`SELECT count(*) FROM (SELECT 1 FROM transactions WHERE %s LIMIT %d) matching`, where, maxRows+1)
+	if err := tx.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to count export: %w", err)
+	}
+	if total > maxRows {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w of %d", ErrExportTooLarge, maxRows)
+	}
+
+	declare := `DECLARE transaction_export NO SCROLL CURSOR FOR
+		SELECT ` + transactionColumns + ` FROM transactions
+		WHERE ` + where + `
+		ORDER BY timestamp, id`
+	if _, err := tx.ExecContext(ctx, declare, args...); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to open export cursor: %w", err)
+	}
+
+	return &TransactionExport{store: s, ctx: ctx, tx: tx, Total: total}, nil
+}
+
+// Next advances to the next transaction, fetching another batch from the
+// cursor when the current one is read. It returns false at the end of the
+// export or on an error, reported by Err.
+func (e *TransactionExport) Next() bool {
+	for e.err == nil {
+		if e.rows == nil {
+			if e.done {
+				return false
+			}
+			e.rows, e.err = e.tx.QueryContext(e.ctx, fmt.Sprintf("FETCH %d FROM transaction_export", exportBatchSize))
+			if e.err != nil {
+				e.err = fmt.Errorf("failed to fetch exported transactions: %w", e.err)
+				return false
+			}
+			e.fetched = 0
+		}
+
+		if e.rows.Next() {
+			e.txn, e.err = e.store.scanTransaction(e.rows)
+			if e.err != nil {
+				e.err = fmt.Errorf("failed to scan transaction: %w", e.err)
+				return false
+			}
+			e.fetched++
+			return true
+		}
+
+		if err := e.rows.Err(); err != nil {
+			e.err = fmt.Errorf("failed to fetch exported transactions: %w", err)
+		}
+		e.rows.Close()
+		e.rows = nil
+		e.done = e.fetched < exportBatchSize
+	}
+	return false
+}
+
+// Transaction returns the transaction Next advanced to
+func (e *TransactionExport) Transaction() *models.StoredTransaction {
+	return e.txn
+}
+
+// Err returns the error that ended the export early, if any
+func (e *TransactionExport) Err() error {
+	return e.err
+}
+
+// Close releases the cursor and its connection
+func (e *TransactionExport) Close() error {
+	if e.rows != nil {
+		e.rows.Close()
+		e.rows = nil
+	}
+	return e.tx.Rollback()
+}
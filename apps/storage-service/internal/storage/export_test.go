@@ -0,0 +1,154 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// exported reads an export to its end and returns the IDs read
+func exported(t *testing.T, s *Storage, filter SearchFilter, maxRows int) []string {
+	t.Helper()
+	export, err := s.ExportTransactions(context.Background(), filter, maxRows)
+	if err != nil {
+		t.Fatalf("ExportTransactions: %v", err)
+	}
+	defer export.Close()
+
+	var ids []string
+	for export.Next() {
+		ids = append(ids, export.Transaction().ID)
+	}
+	if err := export.Err(); err != nil {
+		t.Fatalf("export failed after %d: %v", len(ids), err)
+	}
+	if len(ids) != export.Total {
+		t.Errorf("read %d transactions, want Total %d", len(ids), export.Total)
+	}
+	return ids
+}
+
+func TestExportFilters(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i, spec := range []struct {
+		id, account, status, tenant string
+	}{
+		{"txn-1", "acct-1", "approved", ""},
+		{"txn-2", "acct-1", "flagged", ""},
+		{"txn-3", "acct-2", "approved", ""},
+		{"txn-4", "acct-1", "approved", "unit-a"},
+		{"txn-5", "acct-2", "rejected", "unit-a"},
+	} {
+		txn := testTransaction(spec.id, spec.account, start.Add(time.Duration(i)*time.Hour))
+		txn.Status = spec.status
+		txn.TenantID = spec.tenant
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	tenant := func(id string) *string { return &id }
+	tests := []struct {
+		name   string
+		filter SearchFilter
+		want   []string
+	}{
+		{"everything oldest first", SearchFilter{}, []string{"txn-1", "txn-2", "txn-3", "txn-4", "txn-5"}},
+		{"account", SearchFilter{AccountID: "acct-1"}, []string{"txn-1", "txn-2", "txn-4"}},
+		{"status", SearchFilter{Status: "approved"}, []string{"txn-1", "txn-3", "txn-4"}},
+		{"account and status", SearchFilter{AccountID: "acct-2", Status: "rejected"}, []string{"txn-5"}},
+		{"default tenant", SearchFilter{TenantID: tenant("")}, []string{"txn-1", "txn-2", "txn-3"}},
+		{"tenant", SearchFilter{TenantID: tenant("unit-a")}, []string{"txn-4", "txn-5"}},
+		{"from inclusive", SearchFilter{From: start.Add(3 * time.Hour)}, []string{"txn-4", "txn-5"}},
+		{"to exclusive", SearchFilter{To: start.Add(2 * time.Hour)}, []string{"txn-1", "txn-2"}},
+		{"range", SearchFilter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)}, []string{"txn-2", "txn-3"}},
+		{"no match", SearchFilter{AccountID: "acct-3"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exported(t, s, tt.filter, 10)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportRefusesMoreThanTheCap(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	storeChain(t, s, "acct-1", 3)
+
+	if _, err := s.ExportTransactions(context.Background(), SearchFilter{}, 2); !errors.Is(err, ErrExportTooLarge) {
+		t.Errorf("error = %v, want ErrExportTooLarge", err)
+	}
+	if ids := exported(t, s, SearchFilter{}, 3); len(ids) != 3 {
+		t.Errorf("exported %d at the cap, want 3", len(ids))
+	}
+}
+
+func TestExportStreamsInBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("inserts a million transactions")
+	}
+	const (
+		n = 1_000_000
+		// A million transactions take hundreds of megabytes held at once
+		maxHeap = 64 << 20
+	)
+
+	s := newTestStorage(t, Options{})
+	_, err := s.db.Exec(`INSERT INTO transactions (id, idempotency_key, account_id, user_id, amount, currency,
+			type, category, merchant, reference, status, timestamp, metadata, risk_score, risk_level,
+			is_approved, rejection_reason, is_valid, country, ip_address, device_info, processed_at,
+			processing_time, processor_id)
+		SELECT 'txn-' || g, 'key-' || g, 'acct-' || (g % 100), 'user-1', 42.5, 'USD',
+			'purchase', 'groceries', 'Corner Shop', 'ref-' || g, 'approved',
+			timestamp '2026-01-01' + g * interval '1 second', '{}', 0.1, 'low',
+			true, '', true, 'US', '10.0.0.1', 'test-device', timestamp '2026-01-01' + g * interval '1 second',
+			interval '5 milliseconds', 'processing-service'
+		FROM generate_series(1, $1) g`, n)
+	if err != nil {
+		t.Fatalf("failed to insert transactions: %v", err)
+	}
+
+	export, err := s.ExportTransactions(context.Background(), SearchFilter{}, n)
+	if err != nil {
+		t.Fatalf("ExportTransactions: %v", err)
+	}
+	defer export.Close()
+
+	var stats runtime.MemStats
+	var peak uint64
+	read := 0
+	var last time.Time
+	for export.Next() {
+		txn := export.Transaction()
+		if txn.Timestamp.Before(last) {
+			t.Fatalf("%s out of order", txn.ID)
+		}
+		last = txn.Timestamp
+		read++
+
+		if read%(10*exportBatchSize) == 0 {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+		}
+	}
+	if err := export.Err(); err != nil {
+		t.Fatalf("export failed after %d: %v", read, err)
+	}
+
+	if read != n || export.Total != n {
+		t.Errorf("read %d of Total %d, want %d", read, export.Total, n)
+	}
+	if peak > maxHeap {
+		t.Errorf("heap peaked at %d MiB, want under %d MiB", peak>>20, maxHeap>>20)
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// In integrity mode every stored transaction is a link of its account's
+// integrity chain: its record hash covers its canonical fields and the hash
+// of the link before it, so altering, deleting or reordering a link breaks
+// every link after it. Links are ordered by when they were appended, not by
+// transaction timestamp, so a transaction arriving late joins the end of
+// the chain. The personal data scrubbed by an erasure and re-encrypted by a
+// key rotation (user ID, IP address, device info and metadata) is left out
+// of the hash.
+
+// genesisHash is the previous hash of the first link of a chain
+var genesisHash = strings.Repeat("0", 64)
+
+// integrityColumns are the canonical fields of a transaction aliased t, as
+// text so they hash the same however they are read. Every column is
+// coalesced, so a missing transaction scans as empty fields.
+const integrityColumns = `COALESCE(t.id, ''), COALESCE(t.idempotency_key, ''),
+	COALESCE(t.account_id, ''), COALESCE(t.tenant_id, ''),
+	COALESCE(t.amount::numeric(18,3)::text, ''), COALESCE(t.currency, ''),
+	COALESCE(t.currency_exponent::text, ''), COALESCE(t.type, ''),
+	COALESCE(t.category, ''), COALESCE(t.merchant, ''), COALESCE(t.reference, ''),
+	COALESCE(t.status, ''), COALESCE(to_char(t.timestamp, 'YYYY-MM-DD"T"HH24:MI:SS.US'), ''),
+	COALESCE(t.risk_score::numeric(3,2)::text, ''), COALESCE(t.risk_level, ''),
+	COALESCE(t.is_approved::text, ''), COALESCE(t.rejection_reason, ''),
+	COALESCE(t.is_valid::text, ''), COALESCE(t.parent_transaction_id, ''),
+	COALESCE(t.processor_id, '')`
+
+// integrityFields is the number of integrityColumns
+const integrityFields = 20
+
+// chainTimeLayout formats the time of a status link as to_char does with
+// 'YYYY-MM-DD"T"HH24:MI:SS.US'
+const chainTimeLayout = "2006-01-02T15:04:05.000000"
+
+// Reasons a link is broken
+const (
+	brokenLinkMissing     = "the link before is missing"
+	brokenPreviousHash    = "the previous hash does not match the link before"
+	brokenTransactionGone = "the transaction was deleted"
+	brokenTransaction     = "the transaction was altered"
+	brokenRecordHash      = "the record hash of the transaction was altered"
+	brokenStatus          = "the status record was altered"
+)
+
+// chainHash returns the hash of a link holding fields after the link
+// hashed previous
+func chainHash(previous string, fields []string) string {
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(append([]byte(previous+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// transactionLinkFields returns the hashed fields of a transaction link
+func transactionLinkFields(canonical []string) []string {
+	return append([]string{models.IntegrityLinkTransaction}, canonical...)
+}
+
+// statusLinkFields returns the hashed fields of a status link
+func statusLinkFields(transactionID, status, actor, createdAt string) []string {
+	return []string{models.IntegrityLinkStatus, transactionID, status, actor, createdAt}
+}
+
+// scanCanonical scans integrityColumns
+func scanCanonical(row rowScanner, extra ...any) ([]string, error) {
+	canonical := make([]string, integrityFields)
+	dest := make([]any, 0, len(extra)+integrityFields)
+	dest = append(dest, extra...)
+	for i := range canonical {
+		dest = append(dest, &canonical[i])
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// chainTransaction appends a transaction just inserted in dbTx to its
+// account's chain and stores its record hash
+func (s *Storage) chainTransaction(ctx context.Context, dbTx *sql.Tx, txn *models.StoredTransaction) error {
+	canonical, err := scanCanonical(dbTx.QueryRowContext(ctx,
+		`SELECT `+integrityColumns+` FROM transactions t WHERE t.id = $1`, txn.ID))
+	if err != nil {
+		return fmt.Errorf("failed to read canonical transaction: %w", err)
+	}
+
+	hash, err := appendLink(ctx, dbTx, txn.AccountID, models.IntegrityLinkTransaction, txn.ID, "", "",
+		time.Now().UTC(), func(previous string) string {
+			return chainHash(previous, transactionLinkFields(canonical))
+		})
+	if err != nil {
+		return err
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `UPDATE transactions SET record_hash = $2 WHERE id = $1`, txn.ID, hash); err != nil {
+		return fmt.Errorf("failed to store record hash: %w", err)
+	}
+	return nil
+}
+
+// RecordStatusChange appends a change of a transaction's status to its
+// account's chain. In integrity mode a status change is recorded this way
+// rather than by updating the hashed status of the transaction. A change to
+// the status the transaction already has, as stored or last recorded, is not
+// recorded.
+func (s *Storage) RecordStatusChange(ctx context.Context, transactionID, status, actor string) error {
+	ctx = withQueryName(ctx, "record_status_change")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var accountID string
+	err = dbTx.QueryRowContext(ctx, `SELECT account_id FROM transactions WHERE id = $1`, transactionID).Scan(&accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTransactionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read transaction: %w", err)
+	}
+
+	// Read the current status under the chain lock, so concurrent changes
+	// to the same status record one link
+	if err := lockChain(ctx, dbTx, accountID); err != nil {
+		return err
+	}
+	var current string
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT COALESCE((
+			SELECT c.status FROM integrity_chain c
+			WHERE c.account_id = t.account_id AND c.kind = 'status' AND c.transaction_id = t.id
+			ORDER BY c.seq DESC LIMIT 1
+		), t.status)
+		FROM transactions t WHERE t.id = $1
+	`, transactionID).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read transaction status: %w", err)
+	}
+	if current == status {
+		return nil
+	}
+
+	// Postgres keeps microseconds, so the time hashed is the time stored
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	_, err = appendLink(ctx, dbTx, accountID, models.IntegrityLinkStatus, transactionID, status, actor,
+		createdAt, func(previous string) string {
+			return chainHash(previous, statusLinkFields(transactionID, status, actor, createdAt.Format(chainTimeLayout)))
+		})
+	if err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// lockChain takes the transaction-scoped advisory lock serializing appends
+// to the chain of an account. Taking it again in the same transaction is a
+// no-op.
+func lockChain(ctx context.Context, dbTx *sql.Tx, accountID string) error {
+	if _, err := dbTx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "integrity:"+accountID); err != nil {
+		return fmt.Errorf("failed to lock integrity chain: %w", err)
+	}
+	return nil
+}
+
+// appendLink appends a link to the chain of an account in dbTx, hashed by
+// hash from the hash of the last link, and returns its hash. Appends to one
+// account are serialized by lockChain, and the primary key refuses a fork
+// should one slip past it.
+func appendLink(ctx context.Context, dbTx *sql.Tx, accountID, kind, transactionID, status, actor string,
+	createdAt time.Time, hash func(previous string) string) (string, error) {
+	if err := lockChain(ctx, dbTx, accountID); err != nil {
+		return "", err
+	}
+
+	var seq int64
+	previous := genesisHash
+	err := dbTx.QueryRowContext(ctx, `
+		SELECT seq, record_hash FROM integrity_chain
+		WHERE account_id = $1 ORDER BY seq DESC LIMIT 1
+	`, accountID).Scan(&seq, &previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to read integrity chain: %w", err)
+	}
+
+	recordHash := hash(previous)
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO integrity_chain (account_id, seq, kind, transaction_id, status, actor, previous_hash, record_hash, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9)
+	`, accountID, seq+1, kind, transactionID, status, actor, previous, recordHash, createdAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to append integrity link: %w", err)
+	}
+	return recordHash, nil
+}
+
+// VerifyIntegrity walks the chain of an account from its first link,
+// recomputing every hash, and reports the first broken link. The chain is
+// read in one snapshot of the primary, so links appended meanwhile are left
+// for the next verification.
+func (s *Storage) VerifyIntegrity(ctx context.Context, accountID string) (*models.IntegrityReport, error) {
+	ctx = withQueryName(ctx, "verify_integrity")
+	dbTx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	rows, err := dbTx.QueryContext(ctx, `
+		SELECT c.seq, c.kind, c.transaction_id, COALESCE(c.status, ''), COALESCE(c.actor, ''),
+			to_char(c.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US'), c.previous_hash, c.record_hash,
+			t.id IS NOT NULL, COALESCE(t.record_hash, ''), `+integrityColumns+`
+		FROM integrity_chain c
+		LEFT JOIN transactions t ON c.kind = 'transaction' AND t.id = c.transaction_id
+		WHERE c.account_id = $1
+		ORDER BY c.seq
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read integrity chain: %w", err)
+	}
+	defer rows.Close()
+
+	report := &models.IntegrityReport{AccountID: accountID}
+	previous := genesisHash
+	for rows.Next() {
+		var seq int64
+		var kind, transactionID, status, actor, createdAt, previousHash, recordHash, rowHash string
+		var found bool
+		canonical, err := scanCanonical(rows, &seq, &kind, &transactionID, &status, &actor,
+			&createdAt, &previousHash, &recordHash, &found, &rowHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan integrity link: %w", err)
+		}
+
+		var reason string
+		switch {
+		case seq != report.Links+1:
+			reason = brokenLinkMissing
+		case previousHash != previous:
+			reason = brokenPreviousHash
+		case kind == models.IntegrityLinkStatus:
+			if chainHash(previous, statusLinkFields(transactionID, status, actor, createdAt)) != recordHash {
+				reason = brokenStatus
+			}
+		case !found:
+			reason = brokenTransactionGone
+		case chainHash(previous, transactionLinkFields(canonical)) != recordHash:
+			reason = brokenTransaction
+		case rowHash != recordHash:
+			reason = brokenRecordHash
+		}
+		if reason != "" {
+			report.Broken = &models.IntegrityBreak{Seq: seq, Kind: kind, TransactionID: transactionID, Reason: reason}
+			break
+		}
+
+		report.Links++
+		previous = recordHash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read integrity chain: %w", err)
+	}
+	rows.Close()
+
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM transactions t
+		WHERE t.account_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM integrity_chain c
+			WHERE c.account_id = t.account_id AND c.kind = 'transaction' AND c.transaction_id = t.id
+		)
+	`, accountID).Scan(&report.Unchained)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unchained transactions: %w", err)
+	}
+
+	report.Valid = report.Broken == nil
+	report.CheckedAt = time.Now()
+	return report, nil
+}
+
+// ChainedAccounts returns up to limit accounts with an integrity chain,
+// after the given account ID, in ID order
+func (s *Storage) ChainedAccounts(ctx context.Context, after string, limit int) ([]string, error) {
+	ctx = withQueryName(ctx, "chained_accounts")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT account_id FROM integrity_chain
+		WHERE account_id > $1 ORDER BY account_id LIMIT $2
+	`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chained accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []string
+	for rows.Next() {
+		var accountID string
+		if err := rows.Scan(&accountID); err != nil {
+			return nil, fmt.Errorf("failed to scan chained account: %w", err)
+		}
+		accounts = append(accounts, accountID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list chained accounts: %w", err)
+	}
+	return accounts, nil
+}
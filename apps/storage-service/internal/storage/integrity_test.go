@@ -0,0 +1,211 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// storeChain stores n transactions of account an hour apart
+func storeChain(t *testing.T, s *Storage, accountID string, n int) {
+	t.Helper()
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		txn := testTransaction(fmt.Sprintf("%s-txn-%d", accountID, i+1), accountID, start.Add(time.Duration(i)*time.Hour))
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+}
+
+// verify verifies the chain of account
+func verify(t *testing.T, s *Storage, accountID string) *models.IntegrityReport {
+	t.Helper()
+	report, err := s.VerifyIntegrity(context.Background(), accountID)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	return report
+}
+
+// statusLinks counts the status links of a transaction
+func statusLinks(t *testing.T, s *Storage, transactionID string) int {
+	t.Helper()
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM integrity_chain WHERE kind = 'status' AND transaction_id = $1`,
+		transactionID).Scan(&n)
+	if err != nil {
+		t.Fatalf("failed to count status links: %v", err)
+	}
+	return n
+}
+
+func TestIntegrityDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper string
+		seq    int64
+		reason string
+	}{
+		{"altered amount", `UPDATE transactions SET amount = 4250 WHERE id = 'acct-1-txn-2'`, 2, brokenTransaction},
+		{"altered status", `UPDATE transactions SET status = 'flagged' WHERE id = 'acct-1-txn-2'`, 2, brokenTransaction},
+		{"deleted transaction", `DELETE FROM transactions WHERE id = 'acct-1-txn-2'`, 2, brokenTransactionGone},
+		{"rewritten record hash", `UPDATE transactions SET record_hash = md5('x') || md5('y') WHERE id = 'acct-1-txn-2'`, 2, brokenRecordHash},
+		{"deleted link", `DELETE FROM integrity_chain WHERE account_id = 'acct-1' AND seq = 2`, 3, brokenLinkMissing},
+		{"altered status link", `UPDATE integrity_chain SET status = 'approved' WHERE account_id = 'acct-1' AND kind = 'status'`, 4, brokenStatus},
+		{"relinked link", `UPDATE integrity_chain SET previous_hash = md5('x') || md5('y') WHERE account_id = 'acct-1' AND seq = 3`, 3, brokenPreviousHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, Options{Integrity: true})
+			storeChain(t, s, "acct-1", 3)
+			if err := s.RecordStatusChange(context.Background(), "acct-1-txn-1", "flagged", "analyst-1"); err != nil {
+				t.Fatalf("RecordStatusChange: %v", err)
+			}
+			if report := verify(t, s, "acct-1"); !report.Valid || report.Links != 4 {
+				t.Fatalf("untampered chain: valid %v with %d links, want 4 valid links", report.Valid, report.Links)
+			}
+
+			if _, err := s.db.Exec(tt.tamper); err != nil {
+				t.Fatalf("failed to tamper: %v", err)
+			}
+			report := verify(t, s, "acct-1")
+			if report.Valid || report.Broken == nil {
+				t.Fatal("tampered chain verified")
+			}
+			if report.Broken.Seq != tt.seq || report.Broken.Reason != tt.reason {
+				t.Errorf("broken at %d (%s), want %d (%s)", report.Broken.Seq, report.Broken.Reason, tt.seq, tt.reason)
+			}
+		})
+	}
+}
+
+func TestIntegrityChainsLateArrivalsInAppendOrder(t *testing.T) {
+	s := newTestStorage(t, Options{Integrity: true})
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	for _, txn := range []*models.StoredTransaction{
+		testTransaction("txn-on-time", "acct-1", now),
+		testTransaction("txn-late", "acct-1", now.Add(-24*time.Hour)),
+	} {
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	var last string
+	err := s.db.QueryRow(`SELECT transaction_id FROM integrity_chain WHERE account_id = 'acct-1' AND seq = 2`).Scan(&last)
+	if err != nil {
+		t.Fatalf("failed to read chain: %v", err)
+	}
+	if last != "txn-late" {
+		t.Errorf("second link is %s, want the late arrival at the end of the chain", last)
+	}
+	if report := verify(t, s, "acct-1"); !report.Valid || report.Links != 2 {
+		t.Errorf("valid %v with %d links, want 2 valid links", report.Valid, report.Links)
+	}
+}
+
+func TestIntegritySerializesConcurrentInserts(t *testing.T) {
+	s := newTestStorage(t, Options{Integrity: true})
+	const n = 20
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.StoreTransaction(context.Background(), testTransaction(fmt.Sprintf("txn-%d", i), "acct-1", at))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	report := verify(t, s, "acct-1")
+	if !report.Valid || report.Links != n || report.Unchained != 0 {
+		t.Errorf("valid %v with %d links and %d unchained, want %d valid links", report.Valid, report.Links, report.Unchained, n)
+	}
+}
+
+func TestRedecidedTransactionIsChainedAsStatusChange(t *testing.T) {
+	s := newTestStorage(t, Options{Integrity: true})
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	if err := s.StoreTransaction(context.Background(), testTransaction("txn-1", "acct-1", at)); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	// A redelivery with the same decision records nothing
+	if err := s.StoreTransaction(context.Background(), testTransaction("txn-1", "acct-1", at)); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	if n := statusLinks(t, s, "txn-1"); n != 0 {
+		t.Fatalf("%d status links for an unchanged decision", n)
+	}
+
+	redecided := testTransaction("txn-1", "acct-1", at)
+	redecided.Status = "flagged"
+	for i := 0; i < 2; i++ {
+		if err := s.StoreTransaction(context.Background(), redecided); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+	if n := statusLinks(t, s, "txn-1"); n != 1 {
+		t.Errorf("%d status links, want 1", n)
+	}
+
+	stored, err := s.GetTransaction(context.Background(), "txn-1")
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if stored.Status != "approved" {
+		t.Errorf("hashed status rewritten to %s", stored.Status)
+	}
+	if report := verify(t, s, "acct-1"); !report.Valid || report.Links != 2 {
+		t.Errorf("valid %v with %d links, want 2 valid links", report.Valid, report.Links)
+	}
+}
+
+func TestConcurrentStatusChangesRecordOneLink(t *testing.T) {
+	s := newTestStorage(t, Options{Integrity: true})
+	storeChain(t, s, "acct-1", 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.RecordStatusChange(context.Background(), "acct-1-txn-1", "rejected", "analyst-1"); err != nil {
+				t.Errorf("RecordStatusChange: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := statusLinks(t, s, "acct-1-txn-1"); n != 1 {
+		t.Errorf("%d status links, want 1", n)
+	}
+	if report := verify(t, s, "acct-1"); !report.Valid {
+		t.Errorf("chain broken at %+v", report.Broken)
+	}
+}
+
+func TestStatusChangeOfUnknownTransaction(t *testing.T) {
+	s := newTestStorage(t, Options{Integrity: true})
+	err := s.RecordStatusChange(context.Background(), "txn-missing", "rejected", "analyst-1")
+	if err != ErrTransactionNotFound {
+		t.Errorf("error = %v, want ErrTransactionNotFound", err)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipelineLatency returns the sample count and sum of the end-to-end
+// latency of approved low risk transactions
+func pipelineLatency(t *testing.T) (uint64, float64) {
+	t.Helper()
+	labels := map[string]string{"risk_level": "low", "status": "approved"}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "pipeline_end_to_end_seconds" {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestStoreObservesThePipelineLatency(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	count, sum := pipelineLatency(t)
+
+	txn := testTransaction("txn-1", "acct-1", time.Now())
+	txn.IngestedAt = time.Now().Add(-2 * time.Second)
+	if err := s.StoreTransaction(ctx, txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	gotCount, gotSum := pipelineLatency(t)
+	if gotCount != count+1 {
+		t.Fatalf("%d latencies observed, want 1", gotCount-count)
+	}
+	if latency := gotSum - sum; latency < 2 || latency > 10 {
+		t.Errorf("latency %vs, want the 2s since ingestion", latency)
+	}
+
+	// Transactions published before ingestion was stamped are skipped
+	if err := s.StoreTransaction(ctx, testTransaction("txn-2", "acct-1", time.Now())); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	if gotCount, _ := pipelineLatency(t); gotCount != count+1 {
+		t.Errorf("%d latencies observed, want only the stamped transaction", gotCount-count)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// enqueueStoredEvent writes a TransactionStored event to the outbox within
+// the transaction that inserts the row
+func (s *Storage) enqueueStoredEvent(ctx context.Context, dbTx *sql.Tx, txn *models.StoredTransaction) error {
+	ctx = withQueryName(ctx, "enqueue_stored_event")
+	if s.storedTopic == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.TransactionStored{
+		ID:        txn.ID,
+		AccountID: txn.AccountID,
+		Status:    txn.Status,
+		RiskLevel: txn.RiskLevel,
+		StoredAt:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal stored event: %w", err)
+	}
+
+	_, err = dbTx.ExecContext(ctx,
+		`INSERT INTO outbox (topic, key, payload, created_at) VALUES ($1, $2, $3, $4)`,
+		s.storedTopic, txn.AccountID, payload, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue stored event: %w", err)
+	}
+	return nil
+}
+
+// RelayOutbox locks up to limit unsent outbox events, hands them to publish
+// and marks them sent once publish succeeds. Rows stay locked for the
+// duration, so concurrent relays never publish the same event twice; if the
+// relay dies before marking, the events are published again on restart.
+func (s *Storage) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []models.OutboxEvent) error) ([]models.OutboxEvent, error) {
+	ctx = withQueryName(ctx, "relay_outbox")
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin outbox relay: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	rows, err := dbTx.QueryContext(ctx, `
+		SELECT id, topic, key, payload, created_at FROM outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		var key sql.NullString
+		if err := rows.Scan(&event.ID, &event.Topic, &key, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Key = key.String
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	if _, err := dbTx.ExecContext(ctx, `UPDATE outbox SET sent_at = $2 WHERE id = ANY($1)`, pq.Array(ids), time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to mark outbox events sent: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit outbox relay: %w", err)
+	}
+	return events, nil
+}
+
+// OutboxDepth returns the number of events waiting to be published
+func (s *Storage) OutboxDepth(ctx context.Context) (int64, error) {
+	ctx = withQueryName(ctx, "outbox_depth")
+	var depth int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox WHERE sent_at IS NULL`).Scan(&depth)
+	return depth, err
+}
+
+// PruneOutbox deletes events that were published before the cutoff
+func (s *Storage) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx = withQueryName(ctx, "prune_outbox")
+	result, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,244 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// storedTopic is the topic of the stored events in the tests
+const storedTopic = "transactions.stored"
+
+// deliveries records the events published by the relays of a test, as the
+// topic would hold them
+type deliveries struct {
+	mu     sync.Mutex
+	events []models.TransactionStored
+}
+
+func (d *deliveries) publish(ctx context.Context, events []models.OutboxEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, event := range events {
+		var stored models.TransactionStored
+		if err := json.Unmarshal(event.Payload, &stored); err != nil {
+			return err
+		}
+		d.events = append(d.events, stored)
+	}
+	return nil
+}
+
+// ids returns the distinct IDs of the transactions delivered, sorted
+func (d *deliveries) ids() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen := make(map[string]bool)
+	var ids []string
+	for _, event := range d.events {
+		if !seen[event.ID] {
+			seen[event.ID] = true
+			ids = append(ids, event.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func outboxDepth(t *testing.T, s *Storage) int64 {
+	t.Helper()
+	depth, err := s.OutboxDepth(context.Background())
+	if err != nil {
+		t.Fatalf("OutboxDepth: %v", err)
+	}
+	return depth
+}
+
+func TestStoreEnqueuesStoredEvent(t *testing.T) {
+	s := newTestStorage(t, Options{StoredTopic: storedTopic})
+	txn := testTransaction("txn-1", "acct-1", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	txn.RiskLevel = "high"
+	txn.Status = "flagged"
+	if err := s.StoreTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	// Storing it again stores nothing, so announces nothing
+	if err := s.StoreTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	var events []models.OutboxEvent
+	_, err := s.RelayOutbox(context.Background(), 10, func(ctx context.Context, batch []models.OutboxEvent) error {
+		events = batch
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RelayOutbox: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events relayed, want 1", len(events))
+	}
+	if events[0].Topic != storedTopic || events[0].Key != "acct-1" {
+		t.Errorf("event on %s keyed %q, want %s keyed by account", events[0].Topic, events[0].Key, storedTopic)
+	}
+	var stored models.TransactionStored
+	if err := json.Unmarshal(events[0].Payload, &stored); err != nil {
+		t.Fatalf("payload is not a stored event: %v", err)
+	}
+	if stored.ID != "txn-1" || stored.AccountID != "acct-1" || stored.Status != "flagged" || stored.RiskLevel != "high" || stored.StoredAt.IsZero() {
+		t.Errorf("stored event = %+v", stored)
+	}
+	if depth := outboxDepth(t, s); depth != 0 {
+		t.Errorf("outbox depth %d after relaying, want 0", depth)
+	}
+}
+
+func TestRolledBackWriteEnqueuesNothing(t *testing.T) {
+	s := newTestStorage(t, Options{StoredTopic: storedTopic})
+
+	// Fail the write after the row is inserted, with the event
+	_, err := s.db.Exec(`
+		CREATE FUNCTION fail_outbox() RETURNS trigger AS $$
+		BEGIN RAISE EXCEPTION 'outbox unavailable'; END
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER fail_outbox BEFORE INSERT ON outbox FOR EACH ROW EXECUTE FUNCTION fail_outbox();`)
+	if err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+	txn := testTransaction("txn-1", "acct-1", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	if err := s.StoreTransaction(context.Background(), txn); err == nil {
+		t.Fatal("StoreTransaction succeeded without its event")
+	}
+
+	var rows int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM transactions`).Scan(&rows); err != nil {
+		t.Fatalf("failed to count transactions: %v", err)
+	}
+	if rows != 0 {
+		t.Error("transaction stored without its event")
+	}
+	if depth := outboxDepth(t, s); depth != 0 {
+		t.Errorf("outbox depth %d, want no event for a rolled-back write", depth)
+	}
+}
+
+func TestEventsSurviveRelayKilledBeforeMarkingSent(t *testing.T) {
+	s := newTestStorage(t, Options{StoredTopic: storedTopic})
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i, id := range []string{"txn-1", "txn-2", "txn-3"} {
+		if err := s.StoreTransaction(context.Background(), testTransaction(id, "acct-1", at.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	// The relay dies mid-publish: its batch is neither published nor marked
+	ctx, kill := context.WithCancel(context.Background())
+	killed := errors.New("relay killed")
+	_, err := s.RelayOutbox(ctx, 10, func(ctx context.Context, events []models.OutboxEvent) error {
+		kill()
+		return killed
+	})
+	if !errors.Is(err, killed) {
+		t.Fatalf("RelayOutbox = %v, want the relay killed", err)
+	}
+	if depth := outboxDepth(t, s); depth != 3 {
+		t.Fatalf("outbox depth %d after the relay died, want all 3 events kept", depth)
+	}
+
+	// The relay dies after publishing, before marking: the events go again
+	var topic deliveries
+	ctx, kill = context.WithCancel(context.Background())
+	_, err = s.RelayOutbox(ctx, 2, func(ctx context.Context, events []models.OutboxEvent) error {
+		topic.publish(ctx, events)
+		kill()
+		return ctx.Err()
+	})
+	if err == nil {
+		t.Fatal("RelayOutbox marked the events sent after the relay was killed")
+	}
+
+	// A new relay delivers every event once the outbox is drained
+	for {
+		events, err := s.RelayOutbox(context.Background(), 2, topic.publish)
+		if err != nil {
+			t.Fatalf("RelayOutbox: %v", err)
+		}
+		if len(events) == 0 {
+			break
+		}
+	}
+	if ids := topic.ids(); len(ids) != 3 || ids[0] != "txn-1" || ids[2] != "txn-3" {
+		t.Errorf("delivered %v, want every stored transaction", ids)
+	}
+	if depth := outboxDepth(t, s); depth != 0 {
+		t.Errorf("outbox depth %d after the restart, want 0", depth)
+	}
+}
+
+func TestConcurrentRelaysPublishEachEventOnce(t *testing.T) {
+	s := newTestStorage(t, Options{StoredTopic: storedTopic})
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		txn := testTransaction(fmt.Sprintf("txn-%d", i), "acct-1", at.Add(time.Duration(i)*time.Minute))
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	var topic deliveries
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				events, err := s.RelayOutbox(context.Background(), 3, topic.publish)
+				if err != nil {
+					t.Errorf("RelayOutbox: %v", err)
+					return
+				}
+				if len(events) == 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(topic.events) != 20 || len(topic.ids()) != 20 {
+		t.Errorf("%d events published for %d transactions, want each of the 20 once", len(topic.events), len(topic.ids()))
+	}
+}
+
+func TestPruneOutboxKeepsUnsentEvents(t *testing.T) {
+	s := newTestStorage(t, Options{StoredTopic: storedTopic})
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for _, id := range []string{"txn-1", "txn-2"} {
+		if err := s.StoreTransaction(context.Background(), testTransaction(id, "acct-1", at)); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+	if _, err := s.RelayOutbox(context.Background(), 1, func(context.Context, []models.OutboxEvent) error { return nil }); err != nil {
+		t.Fatalf("RelayOutbox: %v", err)
+	}
+
+	pruned, err := s.PruneOutbox(context.Background(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PruneOutbox: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("%d events pruned, want the sent one", pruned)
+	}
+	if depth := outboxDepth(t, s); depth != 1 {
+		t.Errorf("outbox depth %d, want the unsent event kept", depth)
+	}
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// sealedPII holds the column values of the PII fields as stored: ciphertext
+// when a cipher is configured, plaintext otherwise
+type sealedPII struct {
+	IPAddress  sql.NullString
+	DeviceInfo sql.NullString
+	Metadata   sql.NullString
+}
+
+// sealPII prepares the PII fields of a transaction for storage
+func (s *Storage) sealPII(txn *models.StoredTransaction) (sealedPII, error) {
+	var pii sealedPII
+
+	var metadata string
+	if len(txn.Metadata) > 0 {
+		data, err := json.Marshal(txn.Metadata)
+		if err != nil {
+			return pii, fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		metadata = string(data)
+	}
+
+	for _, field := range []struct {
+		value string
+		dst   *sql.NullString
+	}{
+		{txn.IPAddress, &pii.IPAddress},
+		{txn.DeviceInfo, &pii.DeviceInfo},
+		{metadata, &pii.Metadata},
+	} {
+		sealed, err := s.encrypt(field.value)
+		if err != nil {
+			return pii, err
+		}
+		*field.dst = sql.NullString{String: sealed, Valid: sealed != ""}
+	}
+
+	return pii, nil
+}
+
+// openPII decrypts stored PII column values into a transaction
+func (s *Storage) openPII(txn *models.StoredTransaction, pii sealedPII) error {
+	ipAddress, err := s.decrypt(pii.IPAddress.String)
+	if err != nil {
+		return err
+	}
+	deviceInfo, err := s.decrypt(pii.DeviceInfo.String)
+	if err != nil {
+		return err
+	}
+	metadata, err := s.decrypt(pii.Metadata.String)
+	if err != nil {
+		return err
+	}
+
+	txn.IPAddress = ipAddress
+	txn.DeviceInfo = deviceInfo
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &txn.Metadata); err != nil {
+			log.Printf("Warning: failed to unmarshal metadata: %v", err)
+		}
+	}
+	return nil
+}
+
+// cachedTransaction is the Redis representation of a transaction, with the
+// PII fields sealed the same way as in the database
+type cachedTransaction struct {
+	models.StoredTransaction
+	SealedMetadata string `json:"sealed_metadata,omitempty"`
+}
+
+// sealForCache serializes a transaction for Redis without exposing PII
+func (s *Storage) sealForCache(txn *models.StoredTransaction) ([]byte, error) {
+	pii, err := s.sealPII(txn)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := cachedTransaction{StoredTransaction: *txn, SealedMetadata: pii.Metadata.String}
+	cached.IPAddress = pii.IPAddress.String
+	cached.DeviceInfo = pii.DeviceInfo.String
+	cached.Metadata = nil
+
+	return json.Marshal(cached)
+}
+
+// openFromCache deserializes a transaction cached by sealForCache
+func (s *Storage) openFromCache(data []byte) (*models.StoredTransaction, error) {
+	var cached cachedTransaction
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+
+	txn := cached.StoredTransaction
+	err := s.openPII(&txn, sealedPII{
+		IPAddress:  sql.NullString{String: cached.IPAddress, Valid: true},
+		DeviceInfo: sql.NullString{String: cached.DeviceInfo, Valid: true},
+		Metadata:   sql.NullString{String: cached.SealedMetadata, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &txn, nil
+}
+
+func (s *Storage) encrypt(value string) (string, error) {
+	if s.cipher == nil {
+		return value, nil
+	}
+	return s.cipher.Encrypt(value)
+}
+
+func (s *Storage) decrypt(value string) (string, error) {
+	if s.cipher == nil {
+		return value, nil
+	}
+	return s.cipher.Decrypt(value)
+}
+
+// BackfillEncryption encrypts PII columns of existing rows in batches. Rows
+// still in plaintext or encrypted with a retired key are re-encrypted with the
+// current key, so the same command completes a key rotation.
+func (s *Storage) BackfillEncryption(ctx context.Context, batchSize int) (int, error) {
+	ctx = withQueryName(ctx, "backfill_encryption")
+	if s.cipher == nil {
+		return 0, fmt.Errorf("no encryption key configured")
+	}
+
+	updated := 0
+	lastID := ""
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, ip_address, device_info, metadata FROM transactions
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2
+		`, lastID, batchSize)
+		if err != nil {
+			return updated, fmt.Errorf("failed to read batch: %w", err)
+		}
+
+		type row struct {
+			id  string
+			pii sealedPII
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.pii.IPAddress, &r.pii.DeviceInfo, &r.pii.Metadata); err != nil {
+				rows.Close()
+				return updated, fmt.Errorf("failed to scan row: %w", err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, fmt.Errorf("failed to read batch: %w", err)
+		}
+
+		if len(batch) == 0 {
+			return updated, nil
+		}
+
+		for _, r := range batch {
+			lastID = r.id
+			if !s.cipher.NeedsRotation(r.pii.IPAddress.String) &&
+				!s.cipher.NeedsRotation(r.pii.DeviceInfo.String) &&
+				!s.cipher.NeedsRotation(r.pii.Metadata.String) {
+				continue
+			}
+
+			var txn models.StoredTransaction
+			if err := s.openPII(&txn, r.pii); err != nil {
+				return updated, fmt.Errorf("failed to decrypt transaction %s: %w", r.id, err)
+			}
+			sealed, err := s.sealPII(&txn)
+			if err != nil {
+				return updated, fmt.Errorf("failed to encrypt transaction %s: %w", r.id, err)
+			}
+
+			_, err = s.db.ExecContext(ctx, `
+				UPDATE transactions SET ip_address = $2, device_info = $3, metadata = $4, updated_at = $5
+				WHERE id = $1
+			`, r.id, sealed.IPAddress, sealed.DeviceInfo, sealed.Metadata, time.Now())
+			if err != nil {
+				return updated, fmt.Errorf("failed to update transaction %s: %w", r.id, err)
+			}
+
+			s.InvalidateTransaction(ctx, r.id)
+			updated++
+		}
+
+		log.Printf("Encryption backfill: %d rows updated so far", updated)
+	}
+}
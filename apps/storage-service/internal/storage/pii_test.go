@@ -0,0 +1,111 @@
+//go:build integration
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/internal/encryption"
+)
+
+// newCipher returns a cipher encrypting with current of the keys filled with
+// the byte of each version
+func newCipher(t *testing.T, current string, versions map[string]byte) *encryption.FieldCipher {
+	t.Helper()
+	var spec []string
+	for version, b := range versions {
+		spec = append(spec, version+"="+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)))
+	}
+	keys, err := encryption.NewStaticKeyProvider(strings.Join(spec, ","), current)
+	if err != nil {
+		t.Fatalf("NewStaticKeyProvider: %v", err)
+	}
+	return encryption.NewFieldCipher(keys)
+}
+
+// storedPII returns the PII columns of transaction id as stored
+func storedPII(t *testing.T, s *Storage, id string) []string {
+	t.Helper()
+	var ip, device, metadata string
+	err := s.db.QueryRow(`SELECT ip_address, device_info, metadata FROM transactions WHERE id = $1`, id).
+		Scan(&ip, &device, &metadata)
+	if err != nil {
+		t.Fatalf("failed to read the columns of %s: %v", id, err)
+	}
+	return []string{ip, device, metadata}
+}
+
+// assertPII checks the PII of transaction id reads back as stored
+func assertPII(t *testing.T, s *Storage, id string) {
+	t.Helper()
+	txn, err := s.GetTransaction(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if txn.IPAddress != "203.0.113.7" || txn.DeviceInfo != "iPhone 15; iOS 19" || txn.Metadata["note"] != "birthday present for Alex" {
+		t.Errorf("%s read back as ip %q, device %q, metadata %v", id, txn.IPAddress, txn.DeviceInfo, txn.Metadata)
+	}
+}
+
+func TestPIIIsEncryptedAtRest(t *testing.T) {
+	s := newTestStorage(t, Options{Cipher: newCipher(t, "v1", map[string]byte{"v1": 1})})
+	storePersonal(t, s, "txn-1", "user-1", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+
+	for _, column := range storedPII(t, s, "txn-1") {
+		if !strings.HasPrefix(column, "enc:v1:") {
+			t.Errorf("column stored as %q, want v1 ciphertext", column)
+		}
+		for _, secret := range []string{"203.0.113.7", "iPhone", "Alex"} {
+			if strings.Contains(column, secret) {
+				t.Errorf("column %q holds %q in plaintext", column, secret)
+			}
+		}
+	}
+	assertPII(t, s, "txn-1")
+}
+
+func TestBackfillEncryptsAndRotates(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	// One row from before encryption, one under the first key
+	s := newTestStorage(t, Options{})
+	storePersonal(t, s, "txn-1", "user-1", at)
+	s.cipher = newCipher(t, "v1", map[string]byte{"v1": 1})
+	storePersonal(t, s, "txn-2", "user-1", at.Add(time.Hour))
+
+	// Rotate to a second key, the first still decrypting
+	s.cipher = newCipher(t, "v2", map[string]byte{"v1": 1, "v2": 2})
+	assertPII(t, s, "txn-1")
+	assertPII(t, s, "txn-2")
+
+	updated, err := s.BackfillEncryption(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("BackfillEncryption: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("%d rows updated, want 2", updated)
+	}
+	for _, id := range []string{"txn-1", "txn-2"} {
+		for _, column := range storedPII(t, s, id) {
+			if !strings.HasPrefix(column, "enc:v2:") {
+				t.Errorf("%s column stored as %q after the backfill, want v2 ciphertext", id, column)
+			}
+		}
+		assertPII(t, s, id)
+	}
+
+	// A second run has nothing left to do
+	if updated, err := s.BackfillEncryption(context.Background(), 1); err != nil || updated != 0 {
+		t.Errorf("second backfill updated %d rows, %v, want none", updated, err)
+	}
+
+	// The first key can now be retired
+	s.cipher = newCipher(t, "v2", map[string]byte{"v2": 2})
+	assertPII(t, s, "txn-1")
+	assertPII(t, s, "txn-2")
+}
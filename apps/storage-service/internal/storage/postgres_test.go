@@ -0,0 +1,60 @@
+//go:build integration
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+	"storage-service/internal/testdb"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+// The integration tests run against Postgres in a container, started once
+// for the package, each test on a database of its own:
+//
+//	go test -tags=integration ./internal/storage/
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// newTestStorage returns a storage with opts on a new database, closed when
+// the test ends
+func newTestStorage(t *testing.T, opts Options) *Storage {
+	t.Helper()
+	opts.DBUrl = testdb.New(t)
+	s, err := NewStorage(opts)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testTransaction returns an approved transaction of account at the given
+// time
+func testTransaction(id, accountID string, at time.Time) *models.StoredTransaction {
+	return &models.StoredTransaction{ProcessedTransaction: shared.ProcessedTransaction{
+		Transaction: shared.Transaction{
+			ID:             id,
+			IdempotencyKey: "key-" + id,
+			AccountID:      accountID,
+			UserID:         "user-1",
+			Amount:         42.5,
+			Currency:       "USD",
+			Type:           "purchase",
+			Category:       "groceries",
+			Status:         "approved",
+			Timestamp:      at,
+		},
+		RiskScore:   0.1,
+		RiskLevel:   "low",
+		IsApproved:  true,
+		IsValid:     true,
+		ProcessedAt: at,
+		ProcessorID: "processing-service",
+	}}
+}
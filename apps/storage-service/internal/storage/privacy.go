@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// ErasureResult describes the outcome of a user erasure
+type ErasureResult struct {
+	Tombstone            string `json:"tombstone"`
+	TransactionsAffected int    `json:"transactions_affected"`
+	AccountsAffected     int    `json:"accounts_affected"`
+}
+
+// EraseUser anonymizes the personal data of a user across all stored
+// transactions and accounts. The user ID is replaced with a random tombstone
+// in both, in one database transaction, and the IP address, device info and
+// metadata of the transactions are scrubbed, while amounts, statuses and risk
+// results are kept for financial record integrity.
+func (s *Storage) EraseUser(ctx context.Context, userID string) (*ErasureResult, error) {
+	ctx = withQueryName(ctx, "erase_user")
+	tombstone, err := newTombstone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tombstone: %w", err)
+	}
+
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin user erasure: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	query := `
+		UPDATE transactions SET
+			user_id = $2,
+			ip_address = NULL,
+			device_info = NULL,
+			metadata = NULL,
+			updated_at = $3
+		WHERE user_id = $1
+		RETURNING id, account_id
+	`
+
+	now := time.Now()
+	rows, err := dbTx.QueryContext(ctx, query, userID, tombstone, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase user: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	accounts := make(map[string]struct{})
+	for rows.Next() {
+		var id, accountID string
+		if err := rows.Scan(&id, &accountID); err != nil {
+			return nil, fmt.Errorf("failed to scan erased transaction: %w", err)
+		}
+		ids = append(ids, id)
+		accounts[accountID] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to erase user: %w", err)
+	}
+	rows.Close()
+
+	// The accounts go under the same tombstone, so the user can neither be
+	// listed by them nor linked back to the transactions
+	result, err := dbTx.ExecContext(ctx, `UPDATE accounts SET user_id = $2, updated_at = $3 WHERE user_id = $1`,
+		userID, tombstone, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase user accounts: %w", err)
+	}
+	erasedAccounts, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase user accounts: %w", err)
+	}
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user erasure: %w", err)
+	}
+
+	// Drop cached copies which still hold the personal data
+	for _, id := range ids {
+		s.InvalidateTransaction(ctx, id)
+	}
+	for accountID := range accounts {
+		s.invalidateSummary(ctx, accountID)
+	}
+
+	log.Printf("Erased personal data from %d transactions and %d accounts", len(ids), erasedAccounts)
+	return &ErasureResult{Tombstone: tombstone, TransactionsAffected: len(ids), AccountsAffected: int(erasedAccounts)}, nil
+}
+
+// ExportUser streams all of a user's transactions to w as a JSON array, for
+// subject-access requests. Rows are written as they are read so large
+// histories are never held in memory.
+func (s *Storage) ExportUser(ctx context.Context, userID string, w io.Writer) (int, error) {
+	ctx = withQueryName(ctx, "export_user")
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE user_id = $1 ORDER BY timestamp`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query user transactions: %w", err)
+	}
+	defer rows.Close()
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		txn, err := s.scanTransaction(rows)
+		if err != nil {
+			return count, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		data, err := json.Marshal(txn)
+		if err != nil {
+			return count, fmt.Errorf("failed to marshal transaction: %w", err)
+		}
+
+		if count > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return count, err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read user transactions: %w", err)
+	}
+
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// RecordAudit writes an entry to the audit log
+func (s *Storage) RecordAudit(ctx context.Context, actor, action, subject, details string) error {
+	ctx = withQueryName(ctx, "record_audit")
+	query := `
+		INSERT INTO audit_log (actor, action, subject, details, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, actor, action, subject, details, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// newTombstone returns a random, non-reversible replacement for an erased user ID
+func newTombstone() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "erased_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,164 @@
+//go:build integration
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// exportUser returns the transactions of a user's subject-access export
+func exportUser(t *testing.T, s *Storage, userID string) []models.StoredTransaction {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := s.ExportUser(context.Background(), userID, &buf)
+	if err != nil {
+		t.Fatalf("ExportUser: %v", err)
+	}
+	var txns []models.StoredTransaction
+	if err := json.Unmarshal(buf.Bytes(), &txns); err != nil {
+		t.Fatalf("export is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if n != len(txns) {
+		t.Errorf("ExportUser counted %d, wrote %d", n, len(txns))
+	}
+	return txns
+}
+
+// storePersonal stores a transaction of user carrying personal data
+func storePersonal(t *testing.T, s *Storage, id, userID string, at time.Time) {
+	t.Helper()
+	txn := testTransaction(id, "acct-"+userID, at)
+	txn.UserID = userID
+	txn.IPAddress = "203.0.113.7"
+	txn.DeviceInfo = "iPhone 15; iOS 19"
+	txn.Metadata = map[string]string{"note": "birthday present for Alex"}
+	if err := s.StoreTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+}
+
+func TestEraseUserScrubsPersonalData(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	storePersonal(t, s, "txn-1", "user-1", start)
+	storePersonal(t, s, "txn-2", "user-1", start.Add(time.Hour))
+	storePersonal(t, s, "txn-3", "user-2", start.Add(2*time.Hour))
+	for _, account := range []*models.Account{
+		{ID: "acct-user-1", UserID: "user-1", AccountType: "checking", Currency: "USD"},
+		{ID: "acct-savings", UserID: "user-1", AccountType: "savings", Currency: "USD"},
+		{ID: "acct-user-2", UserID: "user-2", AccountType: "checking", Currency: "USD"},
+	} {
+		if err := s.CreateAccount(context.Background(), "admin-1", account); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+	}
+
+	before := exportUser(t, s, "user-1")
+	if len(before) != 2 {
+		t.Fatalf("exported %d transactions before erasure, want 2", len(before))
+	}
+	for _, txn := range before {
+		if txn.IPAddress != "203.0.113.7" || txn.DeviceInfo != "iPhone 15; iOS 19" || txn.Metadata["note"] == "" {
+			t.Errorf("%s exported without its personal data: %+v", txn.ID, txn.ProcessedTransaction)
+		}
+	}
+
+	result, err := s.EraseUser(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("EraseUser: %v", err)
+	}
+	if result.TransactionsAffected != 2 || result.AccountsAffected != 2 {
+		t.Errorf("%d transactions and %d accounts erased, want 2 of each", result.TransactionsAffected, result.AccountsAffected)
+	}
+
+	if left := exportUser(t, s, "user-1"); len(left) != 0 {
+		t.Errorf("%d transactions still exported for the erased user", len(left))
+	}
+
+	// The accounts are listed under the tombstone alone
+	ctx := context.Background()
+	if accounts, err := s.ListAccountsByUser(ctx, "user-1", nil); err != nil || len(accounts) != 0 {
+		t.Errorf("ListAccountsByUser = %d accounts, %v, want none for the erased user", len(accounts), err)
+	}
+	accounts, err := s.ListAccountsByUser(ctx, result.Tombstone, nil)
+	if err != nil {
+		t.Fatalf("ListAccountsByUser: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].ID != "acct-user-1" || accounts[1].ID != "acct-savings" {
+		t.Errorf("accounts under the tombstone %+v, want both of the erased user's", accounts)
+	}
+	if account, err := s.GetAccount(ctx, "acct-user-2"); err != nil || account.UserID != "user-2" {
+		t.Errorf("GetAccount = %+v, %v, want the other user's account intact", account, err)
+	}
+
+	// No column of the erased rows holds personal data any more
+	rows, err := s.db.Query(`SELECT id, ip_address, device_info, metadata FROM transactions WHERE user_id = $1`, result.Tombstone)
+	if err != nil {
+		t.Fatalf("failed to query erased rows: %v", err)
+	}
+	defer rows.Close()
+	erased := 0
+	for rows.Next() {
+		var id string
+		var ip, device, metadata sql.NullString
+		if err := rows.Scan(&id, &ip, &device, &metadata); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		if ip.Valid || device.Valid || metadata.Valid {
+			t.Errorf("%s still holds personal data: ip %v, device %v, metadata %v", id, ip, device, metadata)
+		}
+		erased++
+	}
+	if erased != 2 {
+		t.Errorf("%d rows under the tombstone, want 2", erased)
+	}
+	var mentions int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM transactions WHERE user_id = 'user-1'
+		OR ip_address LIKE '%203.0.113.7%' AND user_id <> 'user-2'`).Scan(&mentions)
+	if err != nil {
+		t.Fatalf("failed to search for leftovers: %v", err)
+	}
+	if mentions != 0 {
+		t.Errorf("%d rows still identify the erased user", mentions)
+	}
+
+	// The financial record is kept as it was exported
+	after := exportUser(t, s, result.Tombstone)
+	if len(after) != len(before) {
+		t.Fatalf("%d transactions under the tombstone, want %d", len(after), len(before))
+	}
+	for i, txn := range after {
+		want := before[i]
+		if txn.ID != want.ID || txn.Amount != want.Amount || txn.Currency != want.Currency ||
+			txn.Status != want.Status || txn.RiskScore != want.RiskScore || !txn.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("erasure changed the record of %s: %+v, was %+v", want.ID, txn.ProcessedTransaction, want.ProcessedTransaction)
+		}
+	}
+
+	// Other users are untouched
+	other := exportUser(t, s, "user-2")
+	if len(other) != 1 || other[0].IPAddress != "203.0.113.7" {
+		t.Errorf("other user's export = %+v, want it intact", other)
+	}
+}
+
+func TestEraseUnknownUser(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	result, err := s.EraseUser(context.Background(), "nobody")
+	if err != nil {
+		t.Fatalf("EraseUser: %v", err)
+	}
+	if result.TransactionsAffected != 0 || result.AccountsAffected != 0 {
+		t.Errorf("%d transactions and %d accounts erased, want none", result.TransactionsAffected, result.AccountsAffected)
+	}
+	if txns := exportUser(t, s, "nobody"); len(txns) != 0 {
+		t.Errorf("exported %d transactions, want an empty array", len(txns))
+	}
+}
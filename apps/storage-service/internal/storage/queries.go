@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/internal/metrics"
+)
+
+// ErrQueryTimeout is returned when a statement runs past the query timeout
+var ErrQueryTimeout = errors.New("query timed out")
+
+// unnamedQuery is the name of statements run without withQueryName
+const unnamedQuery = "unnamed"
+
+type queryNameContextKey struct{}
+
+type unboundedContextKey struct{}
+
+// withQueryName names the statements run with ctx in the query metrics and
+// the slow query log
+func withQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameContextKey{}, name)
+}
+
+// withoutQueryTimeout exempts the statements run with ctx from the query
+// timeout, for schema setup whose migrations may rewrite large tables
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unboundedContextKey{}, true)
+}
+
+// queryName returns the name of the statements run with ctx
+func queryName(ctx context.Context) string {
+	if name, ok := ctx.Value(queryNameContextKey{}).(string); ok {
+		return name
+	}
+	return unnamedQuery
+}
+
+// queryObserver bounds every statement by a timeout and records its
+// duration, logging statements slower than a threshold. A zero timeout or
+// threshold disables it.
+type queryObserver struct {
+	timeout       time.Duration
+	slowThreshold time.Duration
+}
+
+// statement is a statement being run under a queryObserver
+type statement struct {
+	observer *queryObserver
+	parent   context.Context
+	ctx      context.Context
+	cancel   context.CancelFunc
+	name     string
+	query    string
+	args     []driver.NamedValue
+	start    time.Time
+}
+
+// start begins a statement, deriving the context it runs with
+func (o *queryObserver) start(ctx context.Context, query string, args []driver.NamedValue) *statement {
+	stmt := &statement{
+		observer: o,
+		parent:   ctx,
+		ctx:      ctx,
+		cancel:   func() {},
+		name:     queryName(ctx),
+		query:    query,
+		args:     args,
+		start:    time.Now(),
+	}
+	if unbounded, _ := ctx.Value(unboundedContextKey{}).(bool); o.timeout > 0 && !unbounded {
+		stmt.ctx, stmt.cancel = context.WithTimeoutCause(ctx, o.timeout, ErrQueryTimeout)
+	}
+	return stmt
+}
+
+// wrap returns err as an ErrQueryTimeout when the statement ran out of time.
+// The driver reports the cancellation in its own terms, so the cause of the
+// context tells a timeout apart from the caller giving up.
+func (s *statement) wrap(err error) error {
+	if err == nil || err == io.EOF || err == driver.ErrSkip {
+		return err
+	}
+	if context.Cause(s.ctx) == ErrQueryTimeout {
+		return fmt.Errorf("%w after %s: %w", ErrQueryTimeout, s.observer.timeout, err)
+	}
+	return err
+}
+
+// finish ends the statement, recording its duration
+func (s *statement) finish() {
+	s.cancel()
+	duration := time.Since(s.start)
+	metrics.ObserveQuery(s.name, duration)
+
+	if s.observer.slowThreshold <= 0 || duration < s.observer.slowThreshold {
+		return
+	}
+	metrics.RecordSlowQuery(s.name)
+	slog.WarnContext(s.parent, "slow query",
+		"query", s.name,
+		"sql", normalizeSQL(s.query),
+		"duration", duration,
+		"params", redactArgs(s.args),
+	)
+}
+
+// normalizeSQL collapses the whitespace of a statement onto one line
+func normalizeSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// redactArgs renders statement parameters for the log. Strings and bytes
+// may hold PII, such as user IDs and IP addresses, so only their length is
+// kept; numbers, booleans and timestamps are logged as they are.
+func redactArgs(args []driver.NamedValue) []string {
+	rendered := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.Value.(type) {
+		case nil:
+			rendered[i] = "NULL"
+		case int64:
+			rendered[i] = strconv.FormatInt(v, 10)
+		case float64:
+			rendered[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			rendered[i] = strconv.FormatBool(v)
+		case time.Time:
+			rendered[i] = v.Format(time.RFC3339Nano)
+		case string:
+			rendered[i] = fmt.Sprintf("[redacted %d bytes]", len(v))
+		case []byte:
+			rendered[i] = fmt.Sprintf("[redacted %d bytes]", len(v))
+		default:
+			rendered[i] = fmt.Sprintf("[redacted %T]", v)
+		}
+	}
+	return rendered
+}
+
+// observedConn runs the statements of a connection under a queryObserver
+type observedConn struct {
+	driver.Conn
+	observer *queryObserver
+}
+
+// ExecContext executes a statement under the query timeout
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmt := c.observer.start(ctx, query, args)
+	defer stmt.finish()
+	result, err := execer.ExecContext(stmt.ctx, query, args)
+	return result, stmt.wrap(err)
+}
+
+// QueryContext runs a query under the query timeout, which lasts until its
+// rows are closed
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmt := c.observer.start(ctx, query, args)
+	rows, err := queryer.QueryContext(stmt.ctx, query, args)
+	if err != nil {
+		stmt.finish()
+		return nil, stmt.wrap(err)
+	}
+	return &observedRows{Rows: rows, stmt: stmt}, nil
+}
+
+// PrepareContext prepares a statement
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx starts a transaction. The transaction itself is not bounded by the
+// query timeout, each of its statements is.
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return nil, errors.New("driver does not support transaction options")
+}
+
+// Ping checks the connection
+func (c *observedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession resets the connection before it is reused
+func (c *observedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid reports whether the connection can be reused
+func (c *observedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// observedRows ends its statement when closed, so reading the rows counts
+// towards the query's duration and timeout
+type observedRows struct {
+	driver.Rows
+	stmt *statement
+}
+
+// Next reads the next row
+func (r *observedRows) Next(dest []driver.Value) error {
+	return r.stmt.wrap(r.Rows.Next(dest))
+}
+
+// Close closes the rows and ends the statement
+func (r *observedRows) Close() error {
+	err := r.Rows.Close()
+	r.stmt.finish()
+	return err
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	query := `
+		SELECT id, amount
+		FROM transactions
+		WHERE account_id = $1
+		  AND status   = 'flagged'`
+	want := "SELECT id, amount FROM transactions WHERE account_id = $1 AND status = 'flagged'"
+	if got := normalizeSQL(query); got != want {
+		t.Errorf("normalizeSQL = %q, want %q", got, want)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: nil},
+		{Ordinal: 2, Value: int64(42)},
+		{Ordinal: 3, Value: 0.25},
+		{Ordinal: 4, Value: true},
+		{Ordinal: 5, Value: at},
+		{Ordinal: 6, Value: "user-1@example.com"},
+		{Ordinal: 7, Value: []byte("203.0.113.7")},
+		{Ordinal: 8, Value: struct{}{}},
+	}
+	want := []string{
+		"NULL",
+		"42",
+		"0.25",
+		"true",
+		"2026-03-02T12:00:00Z",
+		"[redacted 18 bytes]",
+		"[redacted 11 bytes]",
+		"[redacted struct {}]",
+	}
+	if got := redactArgs(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactArgs = %q, want %q", got, want)
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	ctx := context.Background()
+	if got := queryName(ctx); got != unnamedQuery {
+		t.Errorf("queryName of a bare context = %q, want %q", got, unnamedQuery)
+	}
+	if got := queryName(withQueryName(ctx, "search_transactions")); got != "search_transactions" {
+		t.Errorf("queryName = %q, want search_transactions", got)
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	errDriver := errors.New("pq: canceling statement due to user request")
+	observer := &queryObserver{timeout: time.Millisecond}
+
+	// A statement running past the timeout reports ErrQueryTimeout
+	stmt := observer.start(context.Background(), "SELECT pg_sleep(1)", nil)
+	<-stmt.ctx.Done()
+	if err := stmt.wrap(errDriver); !errors.Is(err, ErrQueryTimeout) || !errors.Is(err, errDriver) {
+		t.Errorf("wrap after the timeout = %v, want ErrQueryTimeout wrapping the driver error", err)
+	}
+	stmt.finish()
+
+	// A caller giving up is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	stmt = observer.start(ctx, "SELECT pg_sleep(1)", nil)
+	cancel()
+	if err := stmt.wrap(errDriver); errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("wrap after the caller cancelled = %v, want the driver error alone", err)
+	}
+	stmt.finish()
+
+	// End of rows and skipped statements pass through unwrapped
+	for _, err := range []error{nil, driver.ErrSkip} {
+		if got := stmt.wrap(err); got != err {
+			t.Errorf("wrap(%v) = %v", err, got)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     context.Context
+		bounded bool
+	}{
+		{"timeout", time.Second, context.Background(), true},
+		{"no timeout", 0, context.Background(), false},
+		{"schema setup", time.Second, withoutQueryTimeout(context.Background()), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := (&queryObserver{timeout: tt.timeout}).start(tt.ctx, "SELECT 1", nil)
+			defer stmt.finish()
+			if _, ok := stmt.ctx.Deadline(); ok != tt.bounded {
+				t.Errorf("statement has a deadline: %v, want %v", ok, tt.bounded)
+			}
+		})
+	}
+}
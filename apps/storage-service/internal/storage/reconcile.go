@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"storage-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// MissingTransactionIDs returns the IDs from ids that are not stored. It
+// always reads the primary, since a lagging replica would report false gaps.
+func (s *Storage) MissingTransactionIDs(ctx context.Context, ids []string) ([]string, error) {
+	ctx = withQueryName(ctx, "missing_transaction_ids")
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM transactions WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction IDs: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]struct{}, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction ID: %w", err)
+		}
+		found[id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query transaction IDs: %w", err)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// SaveReconciliationReport persists a reconciliation report and sets its ID
+func (s *Storage) SaveReconciliationReport(ctx context.Context, report *models.ReconciliationReport) error {
+	ctx = withQueryName(ctx, "save_reconciliation_report")
+	query := `
+		INSERT INTO reconciliation_reports (
+			range_from, range_to, scanned, missing, repaired, missing_ids, started_at, finished_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		report.RangeFrom, report.RangeTo, report.Scanned, report.Missing, report.Repaired,
+		pq.Array(report.MissingIDs), report.StartedAt, report.FinishedAt,
+	).Scan(&report.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+	return nil
+}
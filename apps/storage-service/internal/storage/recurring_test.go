@@ -0,0 +1,36 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+func TestRecurringFlagRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	recurring := testTransaction("txn-1", "acct-1", at)
+	recurring.Merchant = "Streamflix"
+	recurring.IsRecurring = true
+	for _, txn := range []*models.StoredTransaction{recurring, testTransaction("txn-2", "acct-1", at)} {
+		if err := s.StoreTransaction(ctx, txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	for id, want := range map[string]bool{"txn-1": true, "txn-2": false} {
+		got, err := s.GetTransaction(ctx, id)
+		if err != nil {
+			t.Fatalf("GetTransaction(%s): %v", id, err)
+		}
+		if got.IsRecurring != want {
+			t.Errorf("%s: IsRecurring = %v, want %v", id, got.IsRecurring, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetRefunds(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	if err := s.StoreTransaction(ctx, testTransaction("txn-purchase", "acct-1", at)); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	// Stored out of order, returned by time
+	for i, id := range []string{"txn-refund-2", "txn-refund-1"} {
+		refund := testTransaction(id, "acct-1", at.Add(time.Duration(2-i)*time.Hour))
+		refund.Type = "refund"
+		refund.ParentTransactionID = "txn-purchase"
+		if err := s.StoreTransaction(ctx, refund); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+	// A refund whose parent was never stored is kept all the same
+	orphan := testTransaction("txn-orphan", "acct-1", at)
+	orphan.Type = "refund"
+	orphan.ParentTransactionID = "txn-missing"
+	if err := s.StoreTransaction(ctx, orphan); err != nil {
+		t.Fatalf("StoreTransaction of an orphan refund: %v", err)
+	}
+
+	refunds, err := s.GetRefunds(ctx, "txn-purchase")
+	if err != nil {
+		t.Fatalf("GetRefunds: %v", err)
+	}
+	if len(refunds) != 2 || refunds[0].ID != "txn-refund-1" || refunds[1].ID != "txn-refund-2" {
+		t.Fatalf("refunds = %v, want both in order", refunds)
+	}
+	if refunds[0].ParentTransactionID != "txn-purchase" || refunds[0].Type != "refund" {
+		t.Errorf("refund = %+v", refunds[0])
+	}
+
+	// A transaction without refunds has an empty list, not null
+	refunds, err = s.GetRefunds(ctx, "txn-refund-1")
+	if err != nil {
+		t.Fatalf("GetRefunds: %v", err)
+	}
+	if refunds == nil || len(refunds) != 0 {
+		t.Errorf("refunds = %v, want an empty list", refunds)
+	}
+
+	stored, err := s.GetTransaction(ctx, "txn-orphan")
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if stored.ParentTransactionID != "txn-missing" {
+		t.Errorf("parent = %q, want txn-missing", stored.ParentTransactionID)
+	}
+}
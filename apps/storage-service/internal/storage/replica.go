@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"storage-service/internal/metrics"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+)
+
+type primaryContextKey struct{}
+
+// WithPrimary marks ctx so reads made with it go to the primary pool. Use it
+// for reads that must observe a write made moments earlier, which a lagging
+// replica might not have applied yet.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// readDB returns the pool a read should use: the replica when one is
+// configured and healthy, unless ctx requires the primary
+func (s *Storage) readDB(ctx context.Context) *sql.DB {
+	if s.replica == nil || !s.replicaHealthy.Load() {
+		metrics.RecordDBRead(metrics.PoolPrimary)
+		return s.db
+	}
+	if primary, _ := ctx.Value(primaryContextKey{}).(bool); primary {
+		metrics.RecordDBRead(metrics.PoolPrimary)
+		return s.db
+	}
+	metrics.RecordDBRead(metrics.PoolReplica)
+	return s.replica
+}
+
+// monitorReplica pings the replica every interval and marks it unhealthy
+// while it is unreachable, so reads fall back to the primary
+func (s *Storage) monitorReplica(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := s.replica.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if s.replicaHealthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Println("Read replica recovered, routing reads to replica")
+			} else {
+				log.Printf("Read replica unreachable, routing reads to primary: %v", err)
+			}
+		}
+		metrics.SetReplicaHealthy(healthy)
+	}
+}
+
+// monitorRedis pings the cache every interval, reporting whether it is
+// reachable. Cache operations fail while it is not and go to the database,
+// and resume once the client reaches the master again, after a failover.
+func (s *Storage) monitorRedis(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	up := true
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := redisconn.Ping(ctx, s.redis)
+		cancel()
+
+		if healthy := err == nil; healthy != up {
+			up = healthy
+			if up {
+				log.Println("Redis reachable again, caching resumed")
+			} else {
+				log.Printf("Redis unreachable, reads go to the database: %v", err)
+			}
+		}
+		metrics.SetRedisUp(up)
+	}
+}
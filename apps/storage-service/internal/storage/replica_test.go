@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newReplicatedStorage returns a storage on a mocked primary and a mocked
+// healthy replica. Each mock fails the test on a statement it was not told
+// to expect, so a read routed to the wrong pool is caught.
+func newReplicatedStorage(t *testing.T) (*Storage, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	t.Helper()
+	primary, primaryMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	replica, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	s := &Storage{db: primary, replica: replica, done: make(chan struct{})}
+	s.replicaHealthy.Store(true)
+	t.Cleanup(func() {
+		primary.Close()
+		replica.Close()
+		for pool, mock := range map[string]sqlmock.Sqlmock{"primary": primaryMock, "replica": replicaMock} {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("%s: %v", pool, err)
+			}
+		}
+	})
+	return s, primaryMock, replicaMock
+}
+
+// expectTransactionsQuery expects a read of transactions on mock
+func expectTransactionsQuery(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM transactions").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// dbReads returns the number of reads made on pool
+func dbReads(t *testing.T, pool string) float64 {
+	return counterValue(t, "storage_db_reads_total", map[string]string{"pool": pool})
+}
+
+// gaugeValue returns the value of the unlabelled gauge name in the default
+// registry
+func gaugeValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestReadsGoToHealthyReplica(t *testing.T) {
+	s, _, replica := newReplicatedStorage(t)
+	expectTransactionsQuery(replica)
+
+	reads := dbReads(t, "replica")
+	if _, err := s.GetTransactionsByAccount(context.Background(), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+	if got := dbReads(t, "replica"); got != reads+1 {
+		t.Errorf("%v replica reads recorded, want 1", got-reads)
+	}
+}
+
+func TestWithPrimaryReadsThePrimary(t *testing.T) {
+	s, primary, _ := newReplicatedStorage(t)
+	expectTransactionsQuery(primary)
+
+	if _, err := s.GetTransactionsByAccount(WithPrimary(context.Background()), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+}
+
+func TestExistenceCheckReadsThePrimary(t *testing.T) {
+	s, primary, _ := newReplicatedStorage(t)
+	primary.ExpectQuery("SELECT EXISTS").WithArgs("txn-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	// The replica may not have the row yet, and would let it be stored twice
+	exists, err := s.transactionExists(context.Background(), "txn-1")
+	if err != nil || !exists {
+		t.Errorf("transactionExists = %v, %v, want the primary's answer", exists, err)
+	}
+}
+
+func TestReadsFallBackWhileReplicaIsUnhealthy(t *testing.T) {
+	s, primary, _ := newReplicatedStorage(t)
+	s.replicaHealthy.Store(false)
+	expectTransactionsQuery(primary)
+
+	reads := dbReads(t, "primary")
+	if _, err := s.GetTransactionsByAccount(context.Background(), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+	if got := dbReads(t, "primary"); got != reads+1 {
+		t.Errorf("%v primary reads recorded, want 1", got-reads)
+	}
+}
+
+func TestReadsWithoutReplicaUseThePrimary(t *testing.T) {
+	s, primary, _ := newReplicatedStorage(t)
+	s.replica = nil
+	expectTransactionsQuery(primary)
+
+	if _, err := s.GetTransactionsByAccount(context.Background(), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+}
+
+func TestMonitorReplicaFailsOverAndBack(t *testing.T) {
+	s, primary, replica := newReplicatedStorage(t)
+
+	// monitor runs the health check until the replica's health is want, as
+	// the gauge reports it, and stops it before the next ping
+	monitor := func(want bool) {
+		t.Helper()
+		s.done = make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			s.monitorReplica(50 * time.Millisecond)
+			close(stopped)
+		}()
+		gauge := 0.0
+		if want {
+			gauge = 1
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for s.replicaHealthy.Load() != want || gaugeValue(t, "storage_replica_healthy") != gauge {
+			if time.Now().After(deadline) {
+				t.Fatalf("replica health never became %v", want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		close(s.done)
+		<-stopped
+	}
+
+	replica.ExpectPing().WillReturnError(errors.New("connection refused"))
+	monitor(false)
+	expectTransactionsQuery(primary)
+	if _, err := s.GetTransactionsByAccount(context.Background(), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+
+	replica.ExpectPing()
+	monitor(true)
+	expectTransactionsQuery(replica)
+	if _, err := s.GetTransactionsByAccount(context.Background(), "acct-1", 10, 0); err != nil {
+		t.Fatalf("GetTransactionsByAccount: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"storage-service/internal/models"
+)
+
+// recomputeRiskSQL recomputes the risk metrics of the next batch of accounts
+// from their transactions in the trailing window. The score is the average of
+// the transactions' risk scores, each weighted by 0.5^(age / half-life), so a
+// score halves in influence every half-life; an account with no transactions
+// in the window drops to zero. The flagged and rejected totals count the
+// window only.
+//
+// $1 is the last account of the previous batch, $2 the batch size, $3 the
+// time of the run, $4 the half-life in seconds and $5 the start of the window.
+const recomputeRiskSQL = `
+	WITH batch AS (
+		SELECT account_id FROM risk_metrics
+		WHERE account_id > $1
+		ORDER BY account_id
+		LIMIT $2
+	), recent AS (
+		SELECT t.account_id,
+			SUM(t.risk_score::float8 * w.weight) / NULLIF(SUM(w.weight), 0) AS risk_score,
+			COUNT(*) FILTER (WHERE t.status = 'flagged') AS flagged,
+			COUNT(*) FILTER (WHERE t.status = 'rejected') AS rejected
+		FROM transactions t
+		JOIN batch b ON b.account_id = t.account_id
+		CROSS JOIN LATERAL (
+			SELECT POWER(0.5::float8, EXTRACT(EPOCH FROM ($3::timestamp - t.timestamp))::float8 / $4::float8) AS weight
+		) w
+		WHERE t.timestamp >= $5 AND t.timestamp <= $3 AND t.risk_score IS NOT NULL
+		GROUP BY t.account_id
+	)
+	UPDATE risk_metrics m SET
+		risk_score = COALESCE(r.risk_score, 0),
+		risk_level = CASE
+			WHEN COALESCE(r.risk_score, 0) > 0.7 THEN 'high'
+			WHEN COALESCE(r.risk_score, 0) > 0.4 THEN 'medium'
+			ELSE 'low'
+		END,
+		total_flagged = COALESCE(r.flagged, 0),
+		total_rejected = COALESCE(r.rejected, 0),
+		last_updated = $3
+	FROM batch b
+	LEFT JOIN recent r ON r.account_id = b.account_id
+	WHERE m.account_id = b.account_id
+	RETURNING m.account_id
+`
+
+// RecomputeRiskMetrics recomputes the risk metrics of up to limit accounts,
+// in account ID order after the account after, over the window ending at
+// now. It returns the last account recomputed, for the next batch, and how
+// many were; fewer than limit means the last batch.
+func (s *Storage) RecomputeRiskMetrics(ctx context.Context, after string, limit int, now time.Time, window, halfLife time.Duration) (string, int, error) {
+	ctx = withQueryName(ctx, "recompute_risk_metrics")
+	rows, err := s.db.QueryContext(ctx, recomputeRiskSQL,
+		after, limit, now, halfLife.Seconds(), now.Add(-window))
+	if err != nil {
+		return after, 0, fmt.Errorf("failed to recompute risk metrics: %w", err)
+	}
+	defer rows.Close()
+
+	last, n := after, 0
+	for rows.Next() {
+		var accountID string
+		if err := rows.Scan(&accountID); err != nil {
+			return after, 0, fmt.Errorf("failed to scan recomputed account: %w", err)
+		}
+		if accountID > last {
+			last = accountID
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return after, 0, fmt.Errorf("failed to recompute risk metrics: %w", err)
+	}
+	return last, n, nil
+}
+
+// GetRiskMetrics returns the risk metrics of an account, or nil when it has
+// none
+func (s *Storage) GetRiskMetrics(ctx context.Context, accountID string) (*models.RiskMetrics, error) {
+	ctx = withQueryName(ctx, "get_risk_metrics")
+	var m models.RiskMetrics
+	err := s.readDB(ctx).QueryRowContext(ctx, `
+		SELECT account_id, risk_score, risk_level, total_flagged, total_rejected, last_updated
+		FROM risk_metrics WHERE account_id = $1
+	`, accountID).Scan(&m.AccountID, &m.RiskScore, &m.RiskLevel, &m.TotalFlagged, &m.TotalRejected, &m.LastUpdated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get risk metrics: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,113 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRecomputeRiskMetricsDecaysOldScores(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	// A synthetic history: each score is weighted 0.5^(age / 14 days), and
+	// transactions older than the 90-day window are left out
+	history := []struct {
+		id      string
+		account string
+		age     time.Duration
+		score   float64
+		status  string
+	}{
+		{"txn-a-now", "acct-a", 0, 0.8, "flagged"},
+		{"txn-a-14d", "acct-a", 14 * day, 0.2, "approved"},
+		{"txn-a-28d", "acct-a", 28 * day, 0.4, "rejected"},
+		{"txn-a-100d", "acct-a", 100 * day, 1, "rejected"},
+		// Flagged once, long ago
+		{"txn-b-old", "acct-b", 200 * day, 0.95, "flagged"},
+	}
+	for _, h := range history {
+		txn := testTransaction(h.id, h.account, now.Add(-h.age))
+		txn.RiskScore, txn.Status = h.score, h.status
+		if err := s.StoreTransaction(ctx, txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+	before, err := s.GetRiskMetrics(ctx, "acct-b")
+	if err != nil || before == nil || before.RiskScore != 0.95 {
+		t.Fatalf("GetRiskMetrics before = %+v, %v, want the ratcheted 0.95", before, err)
+	}
+
+	if _, n, err := s.RecomputeRiskMetrics(ctx, "", 10, now, 90*day, 14*day); err != nil || n != 2 {
+		t.Fatalf("RecomputeRiskMetrics = %d, %v, want both accounts", n, err)
+	}
+
+	tests := []struct {
+		account  string
+		score    float64
+		level    string
+		flagged  int64
+		rejected int64
+	}{
+		// (0.8*1 + 0.2*0.5 + 0.4*0.25) / (1 + 0.5 + 0.25)
+		{"acct-a", 1 / 1.75, "medium", 1, 1},
+		{"acct-b", 0, "low", 0, 0},
+	}
+	for _, tt := range tests {
+		m, err := s.GetRiskMetrics(ctx, tt.account)
+		if err != nil || m == nil {
+			t.Fatalf("GetRiskMetrics(%s) = %+v, %v", tt.account, m, err)
+		}
+		if math.Abs(m.RiskScore-tt.score) > 1e-6 || m.RiskLevel != tt.level {
+			t.Errorf("%s: risk %v %s, want %v %s", tt.account, m.RiskScore, m.RiskLevel, tt.score, tt.level)
+		}
+		if m.TotalFlagged != tt.flagged || m.TotalRejected != tt.rejected {
+			t.Errorf("%s: %d flagged, %d rejected, want %d and %d",
+				tt.account, m.TotalFlagged, m.TotalRejected, tt.flagged, tt.rejected)
+		}
+		if !m.LastUpdated.Equal(now) {
+			t.Errorf("%s: last updated %s, want %s", tt.account, m.LastUpdated, now)
+		}
+	}
+
+	if m, err := s.GetRiskMetrics(ctx, "acct-none"); m != nil || err != nil {
+		t.Errorf("GetRiskMetrics of an unknown account = %+v, %v, want nil", m, err)
+	}
+}
+
+func TestRecomputeRiskMetricsInBatches(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		if err := s.StoreTransaction(ctx, testTransaction(fmt.Sprintf("txn-%d", i), fmt.Sprintf("acct-%d", i), now)); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+	}
+
+	var batches []int
+	after := ""
+	for {
+		last, n, err := s.RecomputeRiskMetrics(ctx, after, 2, now, 90*24*time.Hour, 14*24*time.Hour)
+		if err != nil {
+			t.Fatalf("RecomputeRiskMetrics: %v", err)
+		}
+		batches = append(batches, n)
+		if n < 2 {
+			break
+		}
+		if last <= after {
+			t.Fatalf("batch after %q ended at %q", after, last)
+		}
+		after = last
+	}
+	if fmt.Sprint(batches) != "[2 2 1]" {
+		t.Errorf("batches of %v accounts, want [2 2 1]", batches)
+	}
+}
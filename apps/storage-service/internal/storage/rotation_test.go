@@ -0,0 +1,72 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"testing"
+
+	"storage-service/internal/testdb"
+)
+
+func TestDatabasePasswordRotation(t *testing.T) {
+	ctx := context.Background()
+	dbURL := testdb.New(t)
+	admin, err := sql.Open("postgres", testdb.URL())
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	defer admin.Close()
+
+	// The service connects as a role of its own, whose password rotates
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("failed to parse postgres URL: %v", err)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	for _, stmt := range []string{
+		`CREATE ROLE rotating LOGIN PASSWORD 'first-password'`,
+		`ALTER DATABASE ` + name + ` OWNER TO rotating`,
+	} {
+		if _, err := admin.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	withPassword := func(password string) string {
+		rotated := *u
+		rotated.User = url.UserPassword("rotating", password)
+		return rotated.String()
+	}
+
+	s, err := NewStorage(Options{DBUrl: withPassword("first-password")})
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := admin.Exec(`ALTER ROLE rotating PASSWORD 'second-password'`); err != nil {
+		t.Fatalf("ALTER ROLE: %v", err)
+	}
+	// A password the server no longer accepts fails the rotation loudly
+	if err := s.SetDatabaseURL(ctx, withPassword("first-password")); err == nil {
+		t.Error("rotation to a rejected password succeeded")
+	}
+	if err := s.SetDatabaseURL(ctx, "postgres://%zz"); err == nil {
+		t.Error("rotation to an invalid URL succeeded")
+	}
+
+	if err := s.SetDatabaseURL(ctx, withPassword("second-password")); err != nil {
+		t.Fatalf("SetDatabaseURL: %v", err)
+	}
+	// New connections authenticate with the rotated password
+	var user string
+	if err := s.db.QueryRowContext(ctx, `SELECT current_user`).Scan(&user); err != nil || user != "rotating" {
+		t.Errorf("current_user = %q, %v, want rotating", user, err)
+	}
+	if _, err := s.GetTransaction(ctx, "missing"); err != nil && !strings.Contains(err.Error(), "not found") {
+		t.Errorf("GetTransaction after the rotation: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// MinSearchQueryLength is the shortest query accepted by SearchTransactions.
+// Trigram indexes cannot serve shorter patterns, so they would fall back to a
+// sequential scan.
+const MinSearchQueryLength = 3
+
+// ErrSearchQueryTooShort is returned for queries below MinSearchQueryLength
+var ErrSearchQueryTooShort = errors.New("search query too short")
+
+// SearchFilter narrows a transaction search. A nil TenantID searches every
+// tenant.
+type SearchFilter struct {
+	AccountID string
+	Status    string
+	From      time.Time
+	To        time.Time
+	TenantID  *string
+}
+
+// conditions appends the conditions of the filter, and their arguments, to
+// those of a query
+func (f SearchFilter) conditions(conditions []string, args []interface{}) ([]string, []interface{}) {
+	if f.AccountID != "" {
+		args = append(args, f.AccountID)
+		conditions = append(conditions, fmt.Sprintf("account_id = $%d", len(args)))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.TenantID != nil {
+		args = append(args, *f.TenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conditions = append(conditions, fmt.Sprintf("timestamp < $%d", len(args)))
+	}
+	return conditions, args
+}
+
+// SearchTransactions finds transactions whose merchant or reference contains
+// query, ranked by trigram similarity and then recency. The query runs under
+// a statement timeout so a pathological pattern cannot hold a connection.
+func (s *Storage) SearchTransactions(ctx context.Context, query string, filter SearchFilter, limit int) ([]*models.StoredTransaction, error) {
+	ctx = withQueryName(ctx, "search_transactions")
+	query = strings.TrimSpace(query)
+	if len([]rune(query)) < MinSearchQueryLength {
+		return nil, ErrSearchQueryTooShort
+	}
+
+	conditions := []string{`(merchant ILIKE $1 OR reference ILIKE $1)`}
+	args := []interface{}{"%" + escapeLike(query) + "%", query}
+
+	conditions, args = filter.conditions(conditions, args)
+	args = append(args, limit)
+
+	sqlQuery := `
+		SELECT ` + transactionColumns + ` FROM transactions
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY GREATEST(
+			similarity(COALESCE(merchant, ''), $2),
+			similarity(COALESCE(reference, ''), $2)
+		) DESC, timestamp DESC
+		LIMIT $` + fmt.Sprint(len(args))
+
+	tx, err := s.readDB(ctx).BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin search: %w", err)
+	}
+	defer tx.Rollback()
+
+	timeoutMs := s.searchTimeout.Milliseconds()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMs)); err != nil {
+		return nil, fmt.Errorf("failed to set search timeout: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transactions: %w", searchTimeoutError(err))
+	}
+	defer rows.Close()
+
+	var transactions []*models.StoredTransaction
+	for rows.Next() {
+		txn, err := s.scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, txn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search transactions: %w", searchTimeoutError(err))
+	}
+
+	return transactions, nil
+}
+
+// searchTimeoutError returns err as an ErrQueryTimeout when the search ran
+// past its statement timeout, which the server reports as a cancellation
+func searchTimeoutError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" && strings.Contains(pqErr.Message, "statement timeout") {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	return err
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
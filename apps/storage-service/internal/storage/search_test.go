@@ -0,0 +1,179 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedSearch stores transactions of acct-1 with the merchants by ID, each
+// referenced by its ID
+func seedSearch(t *testing.T, s *Storage, merchants map[string]string) {
+	t.Helper()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for id, merchant := range merchants {
+		txn := testTransaction(id, "acct-1", at)
+		txn.Merchant = merchant
+		txn.Reference = "REF-" + strings.ToUpper(id)
+		if err := s.StoreTransaction(context.Background(), txn); err != nil {
+			t.Fatalf("StoreTransaction: %v", err)
+		}
+		at = at.Add(time.Hour)
+	}
+}
+
+// seedFiller inserts n transactions matching no search of the tests, so the
+// planner has a table worth indexing
+func seedFiller(t *testing.T, s *Storage, n int) {
+	t.Helper()
+	_, err := s.db.Exec(`
+		INSERT INTO transactions (id, idempotency_key, account_id, user_id, amount, currency, type, status, timestamp, merchant, reference)
+		SELECT 'filler-' || g, 'filler-' || g, 'acct-' || (g % 500), 'user-1', g % 1000, 'USD', 'purchase', 'approved',
+			TIMESTAMP '2026-01-01' + g * INTERVAL '1 minute', 'Store ' || md5(g::text), 'INV-' || g
+		FROM generate_series(1, $1) AS g`, n)
+	if err != nil {
+		t.Fatalf("failed to seed filler: %v", err)
+	}
+	if _, err := s.db.Exec(`ANALYZE transactions`); err != nil {
+		t.Fatalf("ANALYZE: %v", err)
+	}
+}
+
+func TestSearchRanksClosestMatchFirst(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	seedSearch(t, s, map[string]string{
+		"txn-a": "Grand Casino Royale Online Ltd",
+		"txn-b": "Casino",
+		"txn-c": "Corner Shop",
+		"txn-d": "Casino Cafe",
+		"txn-e": "Coffee House",
+	})
+	seedFiller(t, s, 1000)
+
+	results, err := s.SearchTransactions(context.Background(), "casino", SearchFilter{}, 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions: %v", err)
+	}
+	var ids []string
+	for _, txn := range results {
+		ids = append(ids, txn.ID)
+	}
+	want := []string{"txn-b", "txn-d", "txn-a"}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("results = %v, want %v", ids, want)
+	}
+}
+
+func TestSearchMatchesReference(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	seedSearch(t, s, map[string]string{"txn-a": "Corner Shop", "txn-b": "Coffee House"})
+
+	results, err := s.SearchTransactions(context.Background(), "ref-txn-b", SearchFilter{}, 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "txn-b" {
+		t.Errorf("results = %d, want txn-b by its reference", len(results))
+	}
+}
+
+func TestSearchFiltersAndLimits(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	seedSearch(t, s, map[string]string{
+		"txn-a": "Casino One",
+		"txn-b": "Casino Two",
+		"txn-c": "Casino Three",
+	})
+	other := testTransaction("txn-d", "acct-2", time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC))
+	other.Merchant = "Casino Four"
+	if err := s.StoreTransaction(context.Background(), other); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	results, err := s.SearchTransactions(context.Background(), "casino", SearchFilter{AccountID: "acct-2"}, 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "txn-d" {
+		t.Errorf("%d results for acct-2, want txn-d only", len(results))
+	}
+
+	results, err = s.SearchTransactions(context.Background(), "casino", SearchFilter{}, 2)
+	if err != nil {
+		t.Fatalf("SearchTransactions: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("%d results, want the limit of 2", len(results))
+	}
+}
+
+func TestSearchMatchesWildcardsLiterally(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	seedSearch(t, s, map[string]string{"txn-a": "100% Organic", "txn-b": "1000 Organics"})
+
+	results, err := s.SearchTransactions(context.Background(), "100%", SearchFilter{}, 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "txn-a" {
+		t.Errorf("%d results, want only the merchant with a literal %%", len(results))
+	}
+}
+
+func TestSearchRejectsShortQuery(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	for _, query := range []string{"", "ca", "  ca  "} {
+		if _, err := s.SearchTransactions(context.Background(), query, SearchFilter{}, 10); !errors.Is(err, ErrSearchQueryTooShort) {
+			t.Errorf("SearchTransactions(%q) = %v, want ErrSearchQueryTooShort", query, err)
+		}
+	}
+}
+
+func TestSearchUsesTrigramIndexes(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: 5 * time.Second})
+	seedSearch(t, s, map[string]string{"txn-a": "Casino"})
+	seedFiller(t, s, 20000)
+
+	rows, err := s.db.Query(`EXPLAIN SELECT id FROM transactions
+		WHERE (merchant ILIKE $1 OR reference ILIKE $1)
+		ORDER BY GREATEST(similarity(COALESCE(merchant, ''), $2), similarity(COALESCE(reference, ''), $2)) DESC, timestamp DESC
+		LIMIT 50`, "%casino%", "casino")
+	if err != nil {
+		t.Fatalf("EXPLAIN: %v", err)
+	}
+	defer rows.Close()
+	var plan strings.Builder
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		plan.WriteString(line + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("EXPLAIN: %v", err)
+	}
+
+	for _, index := range []string{"idx_transactions_merchant_trgm", "idx_transactions_reference_trgm"} {
+		if !strings.Contains(plan.String(), index) {
+			t.Errorf("plan does not use %s:\n%s", index, plan.String())
+		}
+	}
+	if strings.Contains(plan.String(), "Seq Scan on transactions") {
+		t.Errorf("plan scans the table:\n%s", plan.String())
+	}
+}
+
+func TestSearchTimesOut(t *testing.T) {
+	s := newTestStorage(t, Options{SearchTimeout: time.Millisecond})
+	seedFiller(t, s, 20000)
+
+	_, err := s.SearchTransactions(context.Background(), "store", SearchFilter{}, 500)
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("error = %v, want ErrQueryTimeout", err)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	shared "github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+func TestShadowRiskFactorsArePersisted(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Options{})
+	now := time.Now()
+
+	hit := testTransaction("txn-1", "acct-1", now)
+	hit.ShadowRiskFactors = []shared.RiskFactor{{Factor: "round_amount", Weight: 0.2, Description: "Large round amount", Severity: "low"}}
+	if err := s.StoreTransaction(ctx, hit); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+	if err := s.StoreTransaction(ctx, testTransaction("txn-2", "acct-1", now)); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+
+	got, err := s.GetTransaction(ctx, "txn-1")
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if len(got.ShadowRiskFactors) != 1 || got.ShadowRiskFactors[0] != hit.ShadowRiskFactors[0] {
+		t.Errorf("shadow factors = %+v, want %+v", got.ShadowRiskFactors, hit.ShadowRiskFactors)
+	}
+	other, err := s.GetTransaction(ctx, "txn-2")
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if other.ShadowRiskFactors != nil {
+		t.Errorf("shadow factors = %+v, want none", other.ShadowRiskFactors)
+	}
+
+	// Analysts query hit rates off the column
+	var hits, total int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE shadow_risk_factors @> '[{"factor": "round_amount"}]'), COUNT(*)
+		FROM transactions`).Scan(&hits, &total)
+	if err != nil {
+		t.Fatalf("hit rate query: %v", err)
+	}
+	if hits != 1 || total != 2 {
+		t.Errorf("round_amount hit %d of %d, want 1 of 2", hits, total)
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"storage-service/internal/metrics"
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+)
+
+// Database flavors
+const (
+	FlavorPostgres  = "postgres"
+	FlavorTimescale = "timescale"
+)
+
+// initTimescale converts the transactions table to a hypertable and creates
+// the continuous aggregates
+func (s *Storage) initTimescale(chunkInterval string) error {
+	ctx := withoutQueryTimeout(withQueryName(context.Background(), "init_timescale"))
+	for _, sql := range models.TimescaleSetupSQL() {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("failed to prepare hypertable: %w", err)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, models.CreateHypertableSQL, chunkInterval); err != nil {
+		return fmt.Errorf("failed to create hypertable: %w", err)
+	}
+
+	for _, sql := range models.CreateContinuousAggregatesSQL() {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create continuous aggregate: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetDailyVolume returns the daily transaction volume of an account between
+// from (inclusive) and to (exclusive), broken down by currency. On TimescaleDB
+// it reads the continuous aggregate, otherwise it aggregates the raw rows.
+func (s *Storage) GetDailyVolume(ctx context.Context, accountID string, from, to time.Time) ([]*models.DailyVolume, error) {
+	ctx = withQueryName(ctx, "daily_volume")
+	query := `
+		SELECT account_id, date_trunc('day', timestamp) AS day, currency, COUNT(*), SUM(amount)
+		FROM transactions
+		WHERE account_id = $1 AND timestamp >= $2 AND timestamp < $3
+		GROUP BY account_id, day, currency
+		ORDER BY day, currency
+	`
+	if s.flavor == FlavorTimescale {
+		query = `
+			SELECT account_id, day, currency, transaction_count, total_amount
+			FROM ` + models.ViewDailyVolumeByCurrency + `
+			WHERE account_id = $1 AND day >= $2 AND day < $3
+			ORDER BY day, currency
+		`
+	}
+
+	rows, err := s.readDB(ctx).QueryContext(ctx, query, accountID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily volume: %w", err)
+	}
+	defer rows.Close()
+
+	var volumes []*models.DailyVolume
+	for rows.Next() {
+		var (
+			v     models.DailyVolume
+			total models.CurrencyAmount
+		)
+		if err := rows.Scan(&v.AccountID, &v.Day, &total.Currency, &v.TransactionCount, &total.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan daily volume: %w", err)
+		}
+		if n := len(volumes); n > 0 && volumes[n-1].Day.Equal(v.Day) {
+			last := volumes[n-1]
+			last.TransactionCount += v.TransactionCount
+			last.TotalAmount += total.Amount
+			last.Currencies = append(last.Currencies, total)
+			continue
+		}
+		v.TotalAmount = total.Amount
+		v.Currencies = []models.CurrencyAmount{total}
+		volumes = append(volumes, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query daily volume: %w", err)
+	}
+
+	for _, v := range volumes {
+		v.BaseCurrency, v.BaseAmount, v.Unconverted = s.toBase(v.Currencies)
+	}
+	return volumes, nil
+}
+
+// toBase totals amounts in the base currency, returning the currencies left
+// out for want of an exchange rate. Without a converter it reports nothing.
+func (s *Storage) toBase(amounts []models.CurrencyAmount) (base string, total float64, unconverted []string) {
+	if s.rates == nil {
+		return "", 0, nil
+	}
+	for _, amount := range amounts {
+		converted, _, err := s.rates.Convert(amount.Amount, amount.Currency, s.baseCurrency)
+		if err != nil {
+			metrics.RecordRateLookupError()
+			unconverted = append(unconverted, amount.Currency)
+			continue
+		}
+		total += converted
+	}
+	if target, ok := currency.Lookup(s.baseCurrency); ok {
+		scale := math.Pow10(target.Exponent)
+		total = math.Round(total*scale) / scale
+	}
+	return s.baseCurrency, total, unconverted
+}
+
+// AccountInTenant reports whether none of an account's transactions belong to
+// a tenant other than tenantID. The daily volume aggregate is not kept per
+// tenant, so a caller limited to one tenant is checked with this first.
+func (s *Storage) AccountInTenant(ctx context.Context, accountID, tenantID string) (bool, error) {
+	ctx = withQueryName(ctx, "account_in_tenant")
+	var other bool
+	err := s.readDB(ctx).QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM transactions WHERE account_id = $1 AND tenant_id <> $2)`,
+		accountID, tenantID,
+	).Scan(&other)
+	if err != nil {
+		return false, fmt.Errorf("failed to check account tenant: %w", err)
+	}
+	return !other, nil
+}
+
+// GetAccountContext summarizes an account's activity since since
+func (s *Storage) GetAccountContext(ctx context.Context, accountID string, since time.Time) (*models.AccountContext, error) {
+	ctx = withQueryName(ctx, "account_context")
+	summary := &models.AccountContext{AccountID: accountID, Since: since}
+
+	var openedAt sql.NullTime
+	err := s.readDB(ctx).QueryRowContext(ctx, `
+		SELECT COALESCE(
+			(SELECT created_at FROM accounts WHERE id = $1),
+			(SELECT MIN(timestamp) FROM transactions WHERE account_id = $1)
+		)
+	`, accountID).Scan(&openedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account opening: %w", err)
+	}
+	if openedAt.Valid {
+		summary.OpenedAt = &openedAt.Time
+	}
+
+	err = s.readDB(ctx).QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE status = $3)
+		FROM transactions
+		WHERE account_id = $1 AND timestamp >= $2
+	`, accountID, since, models.StatusFlagged).Scan(&summary.TransactionCount, &summary.FlaggedCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count account transactions: %w", err)
+	}
+
+	if summary.Risk, err = s.GetRiskMetrics(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
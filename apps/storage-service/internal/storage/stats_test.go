@@ -0,0 +1,102 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"storage-service/internal/models"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+)
+
+// newConvertingStorage returns a storage totalling stats in USD at 0.8 EUR
+// to the dollar, without a rate for GBP
+func newConvertingStorage(t *testing.T) *Storage {
+	t.Helper()
+	rates, err := currency.ParseRates([]byte(`{"base":"USD","rates":{"EUR":0.8}}`))
+	if err != nil {
+		t.Fatalf("ParseRates: %v", err)
+	}
+	return newTestStorage(t, Options{Rates: currency.NewConverter(rates), BaseCurrency: "USD"})
+}
+
+// storeUnrated stores a GBP transaction of acct-1 on the second day of the
+// volume fixture
+func storeUnrated(t *testing.T, s *Storage) {
+	t.Helper()
+	txn := testTransaction("txn-gbp", "acct-1", time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC))
+	txn.Amount, txn.Currency = 5, "GBP"
+	if err := s.StoreTransaction(context.Background(), txn); err != nil {
+		t.Fatalf("StoreTransaction: %v", err)
+	}
+}
+
+func TestDailyVolumeInTheBaseCurrency(t *testing.T) {
+	s := newConvertingStorage(t)
+	storeVolumeFixture(t, s)
+	storeUnrated(t, s)
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	volumes, err := s.GetDailyVolume(context.Background(), "acct-1", from, from.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("GetDailyVolume: %v", err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("%d days of volume, want 2", len(volumes))
+	}
+
+	// 30.50 USD and 7 EUR, worth 8.75 USD
+	first := volumes[0]
+	wantCurrencies := []models.CurrencyAmount{{Currency: "EUR", Amount: 7}, {Currency: "USD", Amount: 30.5}}
+	if !reflect.DeepEqual(first.Currencies, wantCurrencies) {
+		t.Errorf("first day currencies = %+v, want %+v", first.Currencies, wantCurrencies)
+	}
+	if first.BaseCurrency != "USD" || first.BaseAmount != 39.25 || len(first.Unconverted) != 0 {
+		t.Errorf("first day in base = %v %s, unconverted %v, want 39.25 USD", first.BaseAmount, first.BaseCurrency, first.Unconverted)
+	}
+
+	// The GBP without a rate is left out of the base total
+	second := volumes[1]
+	if second.TransactionCount != 2 || second.TotalAmount != 105 {
+		t.Errorf("second day %d transactions for %v, want 2 for 105 native", second.TransactionCount, second.TotalAmount)
+	}
+	if second.BaseAmount != 100 || !reflect.DeepEqual(second.Unconverted, []string{"GBP"}) {
+		t.Errorf("second day in base = %v, unconverted %v, want 100 and GBP", second.BaseAmount, second.Unconverted)
+	}
+}
+
+func TestTransactionSummaryInTheBaseCurrency(t *testing.T) {
+	s := newConvertingStorage(t)
+	storeVolumeFixture(t, s)
+	storeUnrated(t, s)
+
+	summary, err := s.GetTransactionSummary(context.Background(), "acct-1")
+	if err != nil {
+		t.Fatalf("GetTransactionSummary: %v", err)
+	}
+	wantCurrencies := []models.CurrencyAmount{{Currency: "EUR", Amount: 7}, {Currency: "GBP", Amount: 5}, {Currency: "USD", Amount: 130.5}}
+	if !reflect.DeepEqual(summary.Currencies, wantCurrencies) {
+		t.Errorf("currencies = %+v, want %+v", summary.Currencies, wantCurrencies)
+	}
+	if summary.BaseCurrency != "USD" || summary.TotalBaseAmount != 139.25 || !reflect.DeepEqual(summary.Unconverted, []string{"GBP"}) {
+		t.Errorf("in base = %v %s, unconverted %v, want 139.25 USD without GBP",
+			summary.TotalBaseAmount, summary.BaseCurrency, summary.Unconverted)
+	}
+}
+
+func TestStatsWithoutRatesAreNative(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	storeVolumeFixture(t, s)
+
+	summary, err := s.GetTransactionSummary(context.Background(), "acct-1")
+	if err != nil {
+		t.Fatalf("GetTransactionSummary: %v", err)
+	}
+	if summary.BaseCurrency != "" || summary.TotalBaseAmount != 0 || len(summary.Currencies) != 2 {
+		t.Errorf("summary = %+v, want native totals by currency only", summary)
+	}
+}
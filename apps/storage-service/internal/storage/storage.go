@@ -4,29 +4,137 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"storage-service/internal/encryption"
+	"storage-service/internal/metrics"
 	"storage-service/internal/models"
 
-	_ "github.com/lib/pq"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/currency"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn"
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrTransactionNotFound is returned when a transaction does not exist
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// notFoundMarker is cached in place of a transaction that does not exist
+const notFoundMarker = "__not_found__"
+
+// poolSize is the maximum number of open, and of idle, primary connections
+const poolSize = 25
+
+// Options configures a Storage instance
+type Options struct {
+	DBUrl string
+
+	// ReplicaURL optionally points reads at a read replica
+	ReplicaURL string
+	// ReplicaHealthInterval is how often the replica is health checked
+	ReplicaHealthInterval time.Duration
+
+	// Flavor selects FlavorPostgres or FlavorTimescale
+	Flavor string
+	// ChunkInterval is the hypertable chunk interval, e.g. "7 days"
+	ChunkInterval string
+
+	// Redis cache configuration: a single node, or through Sentinel or a
+	// cluster
+	Redis            redisconn.Config
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	SummaryCacheTTL  time.Duration
+
+	// SearchTimeout bounds the statement time of a transaction search
+	SearchTimeout time.Duration
+	// QueryTimeout bounds every statement, zero leaving them unbounded
+	QueryTimeout time.Duration
+	// SlowQueryThreshold is the duration above which a statement is logged
+	// as slow, zero logging none
+	SlowQueryThreshold time.Duration
+
+	// Cipher encrypts PII columns at rest; nil stores them in plaintext
+	Cipher *encryption.FieldCipher
+
+	// StoredTopic receives a TransactionStored event for every inserted
+	// transaction via the outbox; empty disables the outbox
+	StoredTopic string
+	// AccountTopic receives an AccountStatusChanged event for every account
+	// created or changed via the outbox; empty publishes none
+	AccountTopic string
+
+	// Callbacks queues the outcome of every transaction stored with a final
+	// status and a callback URL for delivery to it
+	Callbacks bool
+
+	// Integrity chains every stored transaction to the one stored before it
+	// on its account, so tampering with stored rows can be detected
+	Integrity bool
+
+	// Rates converts stats totals into BaseCurrency alongside the native
+	// totals; nil reports native totals only
+	Rates        *currency.Converter
+	BaseCurrency string
+
+	// Chaos injects faults into primary database statements; nil injects none
+	Chaos *chaos.Injector
+}
+
 // Storage handles database operations and caching
 type Storage struct {
-	db    *sql.DB
-	redis *redis.Client
+	db        *sql.DB
+	connector *dsnConnector
+	redis     redis.UniversalClient
+
+	// replica serves reads while replicaHealthy is set
+	replica        *sql.DB
+	replicaHealthy atomic.Bool
+	done           chan struct{}
+
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
+	summaryCacheTTL  time.Duration
+	searchTimeout    time.Duration
+	cipher           *encryption.FieldCipher
+	storedTopic      string
+	accountTopic     string
+	flavor           string
+	integrity        bool
+	callbacks        bool
+	rates            *currency.Converter
+	baseCurrency     string
+
+	// auditPartitions are the decision_audits partitions known to exist
+	auditPartitionsMu sync.Mutex
+	auditPartitions   map[string]bool
 }
 
 // NewStorage creates a new storage instance
-func NewStorage(dbURL string) (*Storage, error) {
+func NewStorage(opts Options) (*Storage, error) {
+	if opts.Flavor == "" {
+		opts.Flavor = FlavorPostgres
+	}
+	if opts.Flavor != FlavorPostgres && opts.Flavor != FlavorTimescale {
+		return nil, fmt.Errorf("unsupported database flavor %q", opts.Flavor)
+	}
+
+	queries := &queryObserver{timeout: opts.QueryTimeout, slowThreshold: opts.SlowQueryThreshold}
+
 	// Connect to PostgreSQL
-	db, err := sql.Open("postgres", dbURL)
+	connector, err := newDSNConnector(opts.DBUrl, queries)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	connector.chaos = opts.Chaos
+	db := sql.OpenDB(connector)
 
 	// Test connection
 	if err := db.Ping(); err != nil {
@@ -34,28 +142,40 @@ func NewStorage(dbURL string) (*Storage, error) {
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
+	db.SetMaxOpenConns(poolSize)
+	db.SetMaxIdleConns(poolSize)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	// Initialize Redis client (optional, for caching)
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-	})
+	redisClient := opts.Redis.NewClient()
 
 	// Test Redis connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Printf("Warning: Redis not available, caching disabled: %v", err)
+	if err := redisconn.Ping(ctx, redisClient); err != nil {
+		slog.Warn("redis not available, caching disabled", "error", err)
+		redisClient.Close()
 		redisClient = nil
 	}
+	metrics.SetRedisUp(redisClient != nil)
 
 	storage := &Storage{
-		db:    db,
-		redis: redisClient,
+		db:               db,
+		connector:        connector,
+		redis:            redisClient,
+		cacheTTL:         opts.CacheTTL,
+		negativeCacheTTL: opts.NegativeCacheTTL,
+		summaryCacheTTL:  opts.SummaryCacheTTL,
+		searchTimeout:    opts.SearchTimeout,
+		cipher:           opts.Cipher,
+		storedTopic:      opts.StoredTopic,
+		accountTopic:     opts.AccountTopic,
+		flavor:           opts.Flavor,
+		integrity:        opts.Integrity,
+		callbacks:        opts.Callbacks,
+		rates:            opts.Rates,
+		baseCurrency:     opts.BaseCurrency,
+		done:             make(chan struct{}),
 	}
 
 	// Initialize database schema
@@ -63,34 +183,108 @@ func NewStorage(dbURL string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if opts.Flavor == FlavorTimescale {
+		if err := storage.initTimescale(opts.ChunkInterval); err != nil {
+			return nil, fmt.Errorf("failed to initialize timescale: %w", err)
+		}
+	}
+
+	// Connect to the read replica (optional)
+	if opts.ReplicaURL != "" {
+		replicaConnector, err := newDSNConnector(opts.ReplicaURL, queries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to replica: %w", err)
+		}
+		replica := sql.OpenDB(replicaConnector)
+		replica.SetMaxOpenConns(25)
+		replica.SetMaxIdleConns(25)
+		replica.SetConnMaxLifetime(5 * time.Minute)
+
+		// An unreachable replica is not fatal: reads use the primary until it recovers
+		if err := replica.Ping(); err != nil {
+			slog.Warn("read replica not available, reads use primary", "error", err)
+		} else {
+			storage.replicaHealthy.Store(true)
+		}
+		metrics.SetReplicaHealthy(storage.replicaHealthy.Load())
+
+		interval := opts.ReplicaHealthInterval
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		storage.replica = replica
+		go storage.monitorReplica(interval)
+	}
+
+	if storage.redis != nil {
+		go storage.monitorRedis(redisconn.HealthInterval)
+	}
+
 	return storage, nil
 }
 
+// SetDatabaseURL switches the pool to a new database URL, after a credential
+// rotation. Idle connections are closed so the pool is rebuilt with the new
+// credentials; connections in use are replaced as they reach their maximum
+// lifetime. The returned error reports whether the new URL can connect.
+func (s *Storage) SetDatabaseURL(ctx context.Context, dbURL string) error {
+	if _, err := newDSNConnector(dbURL, nil); err != nil {
+		return err
+	}
+	s.connector.dsn.Store(&dbURL)
+	s.db.SetMaxIdleConns(0)
+	s.db.SetMaxIdleConns(poolSize)
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database with new credentials: %w", err)
+	}
+	return nil
+}
+
 // initSchema creates the necessary tables and indexes
 func (s *Storage) initSchema() error {
-	log.Println("Initializing database schema...")
+	slog.Info("initializing database schema")
+	ctx := withoutQueryTimeout(withQueryName(context.Background(), "init_schema"))
+
+	// Enable extensions
+	for _, sql := range models.CreateExtensionsSQL() {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create extension: %w", err)
+		}
+	}
 
 	// Create tables
 	for _, sql := range models.CreateTablesSQL() {
-		if _, err := s.db.Exec(sql); err != nil {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
 			return fmt.Errorf("failed to create table: %w", err)
 		}
 	}
 
+	// Migrate existing tables
+	for _, sql := range models.MigrationsSQL() {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("failed to migrate table: %w", err)
+		}
+	}
+
 	// Create indexes
 	for _, sql := range models.CreateIndexesSQL() {
-		if _, err := s.db.Exec(sql); err != nil {
+		if _, err := s.db.ExecContext(ctx, sql); err != nil {
 			return fmt.Errorf("failed to create index: %w", err)
 		}
 	}
 
-	log.Println("Database schema initialized successfully")
+	slog.Info("database schema initialized")
 	return nil
 }
 
-// StoreTransaction stores a processed transaction in the database
+// StoreTransaction stores a processed transaction in the database. A
+// transaction already stored is skipped, unless in integrity mode it was
+// decided again with another status, which is recorded as a status change.
 func (s *Storage) StoreTransaction(ctx context.Context, txn *models.StoredTransaction) error {
+	ctx = withQueryName(ctx, "store_transaction")
 	start := time.Now()
+	ctx = logging.WithTransaction(ctx, txn.ID, txn.AccountID)
 
 	// Check if transaction already exists (idempotency)
 	exists, err := s.transactionExists(ctx, txn.ID)
@@ -99,28 +293,84 @@ func (s *Storage) StoreTransaction(ctx context.Context, txn *models.StoredTransa
 	}
 
 	if exists {
-		log.Printf("Transaction %s already exists, skipping", txn.ID)
+		if s.integrity && txn.Status != "" {
+			return s.RecordStatusChange(ctx, txn.ID, txn.Status, txn.ProcessorID)
+		}
+		slog.DebugContext(ctx, "transaction already stored, skipping")
 		return nil
 	}
 
-	// Prepare the SQL statement
+	// Insert the row and its outbox event atomically, so the stored event is
+	// never emitted for a rolled-back write
+	dbTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	if err := s.insertTransaction(ctx, dbTx, txn); err != nil {
+		return err
+	}
+
+	if s.integrity {
+		if err := s.chainTransaction(ctx, dbTx, txn); err != nil {
+			return err
+		}
+	}
+
+	if err := s.enqueueStoredEvent(ctx, dbTx, txn); err != nil {
+		return err
+	}
+
+	if err := s.enqueueCallback(ctx, dbTx, txn); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if !txn.IngestedAt.IsZero() {
+		metrics.ObservePipelineLatency(txn.ID, txn.RiskLevel, txn.Status, txn.IngestedAt, time.Now())
+	}
+
+	// Update risk metrics
+	if err := s.updateRiskMetrics(ctx, txn); err != nil {
+		slog.WarnContext(ctx, "failed to update risk metrics", "error", err)
+	}
+
+	// Cache the transaction, replacing any negative entry, and drop the
+	// account summary which no longer reflects this row
+	if s.redis != nil {
+		s.cacheTransaction(ctx, txn)
+		s.invalidateSummary(ctx, txn.AccountID)
+	}
+
+	slog.DebugContext(ctx, "transaction stored", "duration", time.Since(start))
+	return nil
+}
+
+// insertTransaction inserts the row of a transaction in dbTx. The risk
+// columns of an unassessed transaction are left NULL.
+func (s *Storage) insertTransaction(ctx context.Context, dbTx *sql.Tx, txn *models.StoredTransaction) error {
 	query := `
 		INSERT INTO transactions (
 			id, idempotency_key, account_id, user_id, amount, currency, type, category,
 			merchant, reference, status, timestamp, metadata, risk_score, risk_level,
 			is_approved, rejection_reason, is_valid, validation_errors, country,
 			ip_address, device_info, processed_at, processing_time, processor_id,
-			created_at, updated_at
+			created_at, updated_at, shadow_risk_factors, tenant_id, parent_transaction_id,
+			currency_exponent, merchant_normalized, is_recurring
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
-			$16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27
+			$16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29,
+			NULLIF($30, ''), $31, NULLIF($32, ''), $33
 		)
 	`
 
-	// Convert metadata to JSON
-	metadataJSON, err := json.Marshal(txn.Metadata)
+	// Encrypt PII columns
+	pii, err := s.sealPII(txn)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return fmt.Errorf("failed to encrypt transaction: %w", err)
 	}
 
 	// Convert validation errors to array
@@ -129,36 +379,39 @@ func (s *Storage) StoreTransaction(ctx context.Context, txn *models.StoredTransa
 		validationErrors = txn.ValidationErrors
 	}
 
+	// Shadow rule factors are stored as JSONB, NULL when there are none
+	var shadowFactors []byte
+	if len(txn.ShadowRiskFactors) > 0 {
+		if shadowFactors, err = json.Marshal(txn.ShadowRiskFactors); err != nil {
+			return fmt.Errorf("failed to encode shadow risk factors: %w", err)
+		}
+	}
+
+	var riskScore, riskLevel, isApproved, rejectionReason any = txn.RiskScore, txn.RiskLevel, txn.IsApproved, txn.RejectionReason
+	if txn.Unassessed {
+		riskScore, riskLevel, isApproved, rejectionReason = nil, nil, nil, nil
+	}
+
 	// Execute the insert
-	_, err = s.db.ExecContext(ctx, query,
+	_, err = dbTx.ExecContext(ctx, query,
 		txn.ID, txn.IdempotencyKey, txn.AccountID, txn.UserID, txn.Amount,
 		txn.Currency, txn.Type, txn.Category, txn.Merchant, txn.Reference,
-		txn.Status, txn.Timestamp, metadataJSON, txn.RiskScore, txn.RiskLevel,
-		txn.IsApproved, txn.RejectionReason, txn.IsValid, validationErrors,
-		txn.Country, txn.IPAddress, txn.DeviceInfo, txn.ProcessedAt,
-		txn.ProcessingTime, txn.ProcessorID, time.Now(), time.Now(),
+		txn.Status, txn.Timestamp, pii.Metadata, riskScore, riskLevel,
+		isApproved, rejectionReason, txn.IsValid, pq.Array(validationErrors),
+		txn.Country, pii.IPAddress, pii.DeviceInfo, txn.ProcessedAt,
+		txn.ProcessingTime, txn.ProcessorID, time.Now(), time.Now(), shadowFactors,
+		txn.TenantID, txn.ParentTransactionID, txn.CurrencyExponent,
+		txn.MerchantNormalized, txn.IsRecurring,
 	)
-
 	if err != nil {
 		return fmt.Errorf("failed to insert transaction: %w", err)
 	}
-
-	// Update risk metrics
-	if err := s.updateRiskMetrics(ctx, txn); err != nil {
-		log.Printf("Warning: failed to update risk metrics: %v", err)
-	}
-
-	// Cache the transaction
-	if s.redis != nil {
-		s.cacheTransaction(ctx, txn)
-	}
-
-	log.Printf("Transaction %s stored successfully in %v", txn.ID, time.Since(start))
 	return nil
 }
 
 // transactionExists checks if a transaction already exists
 func (s *Storage) transactionExists(ctx context.Context, id string) (bool, error) {
+	ctx = withQueryName(ctx, "transaction_exists")
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM transactions WHERE id = $1)`
 	err := s.db.QueryRowContext(ctx, query, id).Scan(&exists)
@@ -167,6 +420,7 @@ func (s *Storage) transactionExists(ctx context.Context, id string) (bool, error
 
 // updateRiskMetrics updates the risk metrics for an account
 func (s *Storage) updateRiskMetrics(ctx context.Context, txn *models.StoredTransaction) error {
+	ctx = withQueryName(ctx, "update_risk_metrics")
 	query := `
 		INSERT INTO risk_metrics (account_id, risk_score, risk_level, total_flagged, total_rejected, last_updated)
 		VALUES ($1, $2, $3, $4, $5, $6)
@@ -206,93 +460,216 @@ func (s *Storage) cacheTransaction(ctx context.Context, txn *models.StoredTransa
 		return
 	}
 
-	key := fmt.Sprintf("txn:%s", txn.ID)
-	data, err := json.Marshal(txn)
+	data, err := s.sealForCache(txn)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to marshal transaction for caching", "error", err)
+		return
+	}
+
+	err = s.redis.Set(ctx, transactionCacheKey(txn.ID), data, s.cacheTTL).Err()
 	if err != nil {
-		log.Printf("Failed to marshal transaction for caching: %v", err)
+		slog.WarnContext(ctx, "failed to cache transaction", "error", err)
+	}
+}
+
+// cacheTransactionNotFound caches a short-lived "not found" marker so repeated
+// lookups of unknown IDs do not reach the database
+func (s *Storage) cacheTransactionNotFound(ctx context.Context, id string) {
+	if s.redis == nil || s.negativeCacheTTL <= 0 {
 		return
 	}
 
-	// Cache for 1 hour
-	err = s.redis.Set(ctx, key, data, time.Hour).Err()
+	err := s.redis.Set(ctx, transactionCacheKey(id), notFoundMarker, s.negativeCacheTTL).Err()
 	if err != nil {
-		log.Printf("Failed to cache transaction: %v", err)
+		slog.WarnContext(ctx, "failed to cache transaction miss", logging.KeyTransactionID, id, "error", err)
 	}
 }
 
+// InvalidateTransaction removes a transaction from the cache. Every write path
+// that mutates a stored row must call this so readers never see stale data.
+func (s *Storage) InvalidateTransaction(ctx context.Context, id string) {
+	if s.redis == nil {
+		return
+	}
+
+	if err := s.redis.Del(ctx, transactionCacheKey(id)).Err(); err != nil {
+		slog.WarnContext(ctx, "failed to invalidate cached transaction", logging.KeyTransactionID, id, "error", err)
+		return
+	}
+	metrics.RecordCacheInvalidation(metrics.CacheTransaction)
+}
+
+// invalidateSummary removes an account summary from the cache
+func (s *Storage) invalidateSummary(ctx context.Context, accountID string) {
+	if s.redis == nil {
+		return
+	}
+
+	if err := s.redis.Del(ctx, summaryCacheKey(accountID)).Err(); err != nil {
+		slog.WarnContext(ctx, "failed to invalidate cached summary", logging.KeyAccountID, accountID, "error", err)
+		return
+	}
+	metrics.RecordCacheInvalidation(metrics.CacheSummary)
+}
+
+func transactionCacheKey(id string) string {
+	return fmt.Sprintf("txn:%s", id)
+}
+
+func summaryCacheKey(accountID string) string {
+	return fmt.Sprintf("summary:%s", accountID)
+}
+
 // GetTransaction retrieves a transaction by ID
 func (s *Storage) GetTransaction(ctx context.Context, id string) (*models.StoredTransaction, error) {
+	ctx = withQueryName(ctx, "get_transaction")
 	// Try cache first
 	if s.redis != nil {
-		if cached, err := s.getCachedTransaction(ctx, id); err == nil && cached != nil {
+		cached, err := s.getCachedTransaction(ctx, id)
+		if errors.Is(err, ErrTransactionNotFound) {
+			return nil, err
+		}
+		if err == nil && cached != nil {
 			return cached, nil
 		}
 	}
 
 	// Query database
-	query := `SELECT * FROM transactions WHERE id = $1`
-	row := s.db.QueryRowContext(ctx, query, id)
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1`
+	row := s.readDB(ctx).QueryRowContext(ctx, query, id)
+
+	txn, err := s.scanTransaction(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.cacheTransactionNotFound(ctx, id)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan transaction: %w", err)
+	}
+
+	// Cache the result
+	if s.redis != nil {
+		s.cacheTransaction(ctx, txn)
+	}
+
+	return txn, nil
+}
 
+// transactionColumns lists the transaction columns in the order scanTransaction expects
+const transactionColumns = `id, idempotency_key, account_id, user_id, amount, currency, type, category,
+	merchant, reference, status, timestamp, metadata, COALESCE(risk_score, 0),
+	COALESCE(risk_level, ''), COALESCE(is_approved, false), COALESCE(rejection_reason, ''),
+	is_valid, validation_errors, country,
+	ip_address, device_info, processed_at, processing_time, processor_id,
+	created_at, updated_at, shadow_risk_factors, tenant_id,
+	COALESCE(parent_transaction_id, ''), currency_exponent,
+	COALESCE(merchant_normalized, ''), is_recurring`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTransaction scans a row selected with transactionColumns, decrypting PII columns
+func (s *Storage) scanTransaction(row rowScanner) (*models.StoredTransaction, error) {
 	var txn models.StoredTransaction
-	var metadataJSON []byte
-	var validationErrors []string
+	var pii sealedPII
+	var validationErrors pq.StringArray
+	var shadowFactors []byte
 
 	err := row.Scan(
 		&txn.ID, &txn.IdempotencyKey, &txn.AccountID, &txn.UserID, &txn.Amount,
 		&txn.Currency, &txn.Type, &txn.Category, &txn.Merchant, &txn.Reference,
-		&txn.Status, &txn.Timestamp, &metadataJSON, &txn.RiskScore, &txn.RiskLevel,
+		&txn.Status, &txn.Timestamp, &pii.Metadata, &txn.RiskScore, &txn.RiskLevel,
 		&txn.IsApproved, &txn.RejectionReason, &txn.IsValid, &validationErrors,
-		&txn.Country, &txn.IPAddress, &txn.DeviceInfo, &txn.ProcessedAt,
+		&txn.Country, &pii.IPAddress, &pii.DeviceInfo, &txn.ProcessedAt,
 		&txn.ProcessingTime, &txn.ProcessorID, &txn.CreatedAt, &txn.UpdatedAt,
+		&shadowFactors, &txn.TenantID, &txn.ParentTransactionID, &txn.CurrencyExponent,
+		&txn.MerchantNormalized, &txn.IsRecurring,
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		return nil, err
 	}
-
-	// Parse metadata JSON
-	if metadataJSON != nil {
-		if err := json.Unmarshal(metadataJSON, &txn.Metadata); err != nil {
-			log.Printf("Warning: failed to unmarshal metadata: %v", err)
+	if len(shadowFactors) > 0 {
+		if err := json.Unmarshal(shadowFactors, &txn.ShadowRiskFactors); err != nil {
+			return nil, fmt.Errorf("failed to decode shadow risk factors of %s: %w", txn.ID, err)
 		}
 	}
 
-	txn.ValidationErrors = validationErrors
-
-	// Cache the result
-	if s.redis != nil {
-		s.cacheTransaction(ctx, &txn)
+	if err := s.openPII(&txn, pii); err != nil {
+		return nil, fmt.Errorf("failed to decrypt transaction %s: %w", txn.ID, err)
 	}
+	txn.ValidationErrors = validationErrors
 
 	return &txn, nil
 }
 
-// getCachedTransaction retrieves a transaction from Redis cache
+// getCachedTransaction retrieves a transaction from Redis cache. It returns
+// ErrTransactionNotFound when a negative entry is cached for the ID.
 func (s *Storage) getCachedTransaction(ctx context.Context, id string) (*models.StoredTransaction, error) {
-	key := fmt.Sprintf("txn:%s", id)
-	data, err := s.redis.Get(ctx, key).Bytes()
+	data, err := s.redis.Get(ctx, transactionCacheKey(id)).Bytes()
 	if err != nil {
+		if err == redis.Nil {
+			metrics.RecordCacheRequest(metrics.CacheTransaction, metrics.CacheMiss)
+		} else {
+			metrics.RecordCacheRequest(metrics.CacheTransaction, metrics.CacheError)
+		}
 		return nil, err
 	}
 
-	var txn models.StoredTransaction
-	if err := json.Unmarshal(data, &txn); err != nil {
+	if string(data) == notFoundMarker {
+		metrics.RecordCacheRequest(metrics.CacheTransaction, metrics.CacheNegativeHit)
+		return nil, ErrTransactionNotFound
+	}
+
+	txn, err := s.openFromCache(data)
+	if err != nil {
+		metrics.RecordCacheRequest(metrics.CacheTransaction, metrics.CacheError)
 		return nil, err
 	}
 
-	return &txn, nil
+	metrics.RecordCacheRequest(metrics.CacheTransaction, metrics.CacheHit)
+	return txn, nil
+}
+
+// GetRefunds returns the refunds of a transaction, oldest first
+func (s *Storage) GetRefunds(ctx context.Context, parentID string) ([]*models.StoredTransaction, error) {
+	ctx = withQueryName(ctx, "get_refunds")
+	query := `SELECT ` + transactionColumns + ` FROM transactions
+		WHERE parent_transaction_id = $1 ORDER BY timestamp`
+
+	rows, err := s.readDB(ctx).QueryContext(ctx, query, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refunds: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := []*models.StoredTransaction{}
+	for rows.Next() {
+		txn, err := s.scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		refunds = append(refunds, txn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query refunds: %w", err)
+	}
+
+	return refunds, nil
 }
 
 // GetTransactionsByAccount retrieves transactions for a specific account
 func (s *Storage) GetTransactionsByAccount(ctx context.Context, accountID string, limit, offset int) ([]*models.StoredTransaction, error) {
+	ctx = withQueryName(ctx, "transactions_by_account")
 	query := `
-		SELECT * FROM transactions 
+		SELECT ` + transactionColumns + ` FROM transactions 
 		WHERE account_id = $1 
 		ORDER BY timestamp DESC 
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, accountID, limit, offset)
+	rows, err := s.readDB(ctx).QueryContext(ctx, query, accountID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transactions: %w", err)
 	}
@@ -300,33 +677,12 @@ func (s *Storage) GetTransactionsByAccount(ctx context.Context, accountID string
 
 	var transactions []*models.StoredTransaction
 	for rows.Next() {
-		var txn models.StoredTransaction
-		var metadataJSON []byte
-		var validationErrors []string
-
-		err := rows.Scan(
-			&txn.ID, &txn.IdempotencyKey, &txn.AccountID, &txn.UserID, &txn.Amount,
-			&txn.Currency, &txn.Type, &txn.Category, &txn.Merchant, &txn.Reference,
-			&txn.Status, &txn.Timestamp, &metadataJSON, &txn.RiskScore, &txn.RiskLevel,
-			&txn.IsApproved, &txn.RejectionReason, &txn.IsValid, &validationErrors,
-			&txn.Country, &txn.IPAddress, &txn.DeviceInfo, &txn.ProcessedAt,
-			&txn.ProcessingTime, &txn.ProcessorID, &txn.CreatedAt, &txn.UpdatedAt,
-		)
-
+		txn, err := s.scanTransaction(rows)
 		if err != nil {
-			log.Printf("Failed to scan transaction row: %v", err)
+			slog.WarnContext(ctx, "failed to scan transaction row", "error", err)
 			continue
 		}
-
-		// Parse metadata JSON
-		if metadataJSON != nil {
-			if err := json.Unmarshal(metadataJSON, &txn.Metadata); err != nil {
-				log.Printf("Warning: failed to unmarshal metadata: %v", err)
-			}
-		}
-
-		txn.ValidationErrors = validationErrors
-		transactions = append(transactions, &txn)
+		transactions = append(transactions, txn)
 	}
 
 	return transactions, nil
@@ -334,6 +690,14 @@ func (s *Storage) GetTransactionsByAccount(ctx context.Context, accountID string
 
 // GetTransactionSummary returns a summary of transactions for an account
 func (s *Storage) GetTransactionSummary(ctx context.Context, accountID string) (*models.TransactionSummary, error) {
+	ctx = withQueryName(ctx, "transaction_summary")
+	// Try cache first
+	if s.redis != nil {
+		if cached, err := s.getCachedSummary(ctx, accountID); err == nil {
+			return cached, nil
+		}
+	}
+
 	query := `
 		SELECT 
 			account_id,
@@ -348,7 +712,7 @@ func (s *Storage) GetTransactionSummary(ctx context.Context, accountID string) (
 	`
 
 	var summary models.TransactionSummary
-	err := s.db.QueryRowContext(ctx, query, accountID).Scan(
+	err := s.readDB(ctx).QueryRowContext(ctx, query, accountID).Scan(
 		&summary.AccountID, &summary.TotalTransactions, &summary.TotalAmount,
 		&summary.AverageAmount, &summary.LastTransaction, &summary.RiskLevel,
 	)
@@ -357,13 +721,80 @@ func (s *Storage) GetTransactionSummary(ctx context.Context, accountID string) (
 		return nil, fmt.Errorf("failed to get transaction summary: %w", err)
 	}
 
+	rows, err := s.readDB(ctx).QueryContext(ctx, `
+		SELECT currency, SUM(amount)
+		FROM transactions
+		WHERE account_id = $1
+		GROUP BY currency
+		ORDER BY currency
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction summary by currency: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total models.CurrencyAmount
+		if err := rows.Scan(&total.Currency, &total.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction summary by currency: %w", err)
+		}
+		summary.Currencies = append(summary.Currencies, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get transaction summary by currency: %w", err)
+	}
+	summary.BaseCurrency, summary.TotalBaseAmount, summary.Unconverted = s.toBase(summary.Currencies)
+
+	if s.redis != nil {
+		s.cacheSummary(ctx, &summary)
+	}
+
 	return &summary, nil
 }
 
-// Close closes the database connection
+// cacheSummary caches an account summary in Redis
+func (s *Storage) cacheSummary(ctx context.Context, summary *models.TransactionSummary) {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to marshal summary for caching", "error", err)
+		return
+	}
+
+	err = s.redis.Set(ctx, summaryCacheKey(summary.AccountID), data, s.summaryCacheTTL).Err()
+	if err != nil {
+		slog.WarnContext(ctx, "failed to cache summary", logging.KeyAccountID, summary.AccountID, "error", err)
+	}
+}
+
+// getCachedSummary retrieves an account summary from Redis cache
+func (s *Storage) getCachedSummary(ctx context.Context, accountID string) (*models.TransactionSummary, error) {
+	data, err := s.redis.Get(ctx, summaryCacheKey(accountID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			metrics.RecordCacheRequest(metrics.CacheSummary, metrics.CacheMiss)
+		} else {
+			metrics.RecordCacheRequest(metrics.CacheSummary, metrics.CacheError)
+		}
+		return nil, err
+	}
+
+	var summary models.TransactionSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		metrics.RecordCacheRequest(metrics.CacheSummary, metrics.CacheError)
+		return nil, err
+	}
+
+	metrics.RecordCacheRequest(metrics.CacheSummary, metrics.CacheHit)
+	return &summary, nil
+}
+
+// Close closes the database connections
 func (s *Storage) Close() error {
+	close(s.done)
 	if s.redis != nil {
 		s.redis.Close()
 	}
+	if s.replica != nil {
+		s.replica.Close()
+	}
 	return s.db.Close()
 }
@@ -0,0 +1,119 @@
+//go:build integration
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowQueries returns the number of slow statements counted under query
+func slowQueries(t *testing.T, query string) float64 {
+	return counterValue(t, "storage_slow_queries_total", map[string]string{"query": query})
+}
+
+// captureLogs sends the default logger's records to a buffer until the test
+// ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestQueriesRunPastTheTimeoutFail(t *testing.T) {
+	s := newTestStorage(t, Options{QueryTimeout: 200 * time.Millisecond})
+	ctx := withQueryName(context.Background(), "sleep")
+
+	start := time.Now()
+	_, err := s.db.ExecContext(ctx, `SELECT pg_sleep(5)`)
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("pg_sleep(5) = %v, want ErrQueryTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("statement cancelled after %s, want about 200ms", elapsed)
+	}
+
+	// Reading rows counts towards the timeout too
+	rows, err := s.db.QueryContext(ctx, `SELECT pg_sleep(CASE WHEN n = 1 THEN 0 ELSE 5 END) FROM generate_series(1, 2) AS n`)
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("slow rows = %v, want ErrQueryTimeout", err)
+	}
+
+	// A caller giving up first is not a timeout
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.db.ExecContext(cancelled, `SELECT pg_sleep(5)`); err == nil || errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("cancelled pg_sleep(5) = %v, want the cancellation", err)
+	}
+
+	// Statements within the timeout, and the pool, are unaffected
+	if _, err := s.db.ExecContext(ctx, `SELECT pg_sleep(0.05)`); err != nil {
+		t.Errorf("pg_sleep(0.05): %v", err)
+	}
+	if err := s.StoreTransaction(context.Background(), testTransaction("txn-1", "acct-1", time.Now())); err != nil {
+		t.Errorf("StoreTransaction after timeouts: %v", err)
+	}
+}
+
+func TestSlowQueriesAreLogged(t *testing.T) {
+	s := newTestStorage(t, Options{SlowQueryThreshold: 100 * time.Millisecond})
+	logs := captureLogs(t)
+	before := slowQueries(t, "slow_sleep")
+
+	ctx := withQueryName(context.Background(), "slow_sleep")
+	if _, err := s.db.ExecContext(ctx, `
+		SELECT pg_sleep($1),
+		       $2::text`, 0.2, "user-1@example.com"); err != nil {
+		t.Fatalf("pg_sleep: %v", err)
+	}
+	if _, err := s.db.ExecContext(withQueryName(context.Background(), "fast_sleep"), `SELECT pg_sleep(0)`); err != nil {
+		t.Fatalf("pg_sleep: %v", err)
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err == nil && record["msg"] == "slow query" {
+			records = append(records, record)
+		}
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d slow queries logged, want 1:\n%s", len(records), logs)
+	}
+	record := records[0]
+	if record["query"] != "slow_sleep" || record["sql"] != "SELECT pg_sleep($1), $2::text" {
+		t.Errorf("logged %v %q, want slow_sleep with its SQL on one line", record["query"], record["sql"])
+	}
+	if duration, _ := record["duration"].(float64); time.Duration(duration) < 200*time.Millisecond {
+		t.Errorf("logged duration %v, want at least 200ms", record["duration"])
+	}
+	params, _ := json.Marshal(record["params"])
+	if string(params) != `["0.2","[redacted 18 bytes]"]` {
+		t.Errorf("logged params %s, want the string redacted", params)
+	}
+	if strings.Contains(logs.String(), "example.com") {
+		t.Error("PII in the slow query log")
+	}
+
+	if got := slowQueries(t, "slow_sleep") - before; got != 1 {
+		t.Errorf("%v slow queries counted, want 1", got)
+	}
+	if got := slowQueries(t, "fast_sleep"); got != 0 {
+		t.Errorf("%v fast queries counted as slow", got)
+	}
+}
@@ -2,48 +2,119 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"storage-service/app"
+	"storage-service/internal/backfill"
 	"storage-service/internal/config"
-	"storage-service/internal/consumer"
-	"storage-service/internal/handler"
+	"storage-service/internal/integrity"
+	"storage-service/internal/metrics"
 	"storage-service/internal/storage"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
 )
 
 func main() {
-	// Load config
-	cfg := config.LoadConfig()
+	// Structured logging; the standard log package writes through it too
+	logging.Setup("storage-service")
+	log.Printf("Starting %s", buildinfo.Get("storage-service"))
+	metrics.SetBuildInfo()
 
-	// Connect DB
-	store, err := storage.NewStorage(cfg.DBUrl)
+	// Load config
+	cfg, err := app.LoadConfig()
 	if err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	if cfg.LogConfigOnStart {
+		log.Printf("Effective configuration: %s", cfg)
 	}
-	defer store.Close()
 
-	// Initialize handler
-	txHandler := handler.NewTransactionHandler(store)
+	// One-off commands
+	if len(os.Args) > 1 {
+		store, err := app.OpenStore(context.Background(), cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runCommand(os.Args[1], os.Args[2:], cfg, store)
+		store.Close()
+		return
+	}
 
-	// Setup Kafka consumer
-	cons := consumer.NewConsumer(cfg.KafkaBrokers, cfg.ConsumerGroup, cfg.InputTopic, txHandler)
-	defer cons.Close()
+	// Run until SIGINT or SIGTERM
+	if err := app.Run(context.Background(), cfg); err != nil {
+		log.Fatalf("Storage service failed:\n%v", err)
+	}
+	log.Println("Storage service exited gracefully")
+}
 
-	// Run consumer
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		if err := cons.Start(ctx); err != nil && ctx.Err() == nil {
-			log.Printf("consumer error: %v", err)
+// runCommand runs a one-off maintenance command instead of the service
+func runCommand(name string, args []string, cfg *config.Config, store *storage.Storage) {
+	switch name {
+	case "backfill":
+		runBackfill(args, cfg, store)
+	case "encrypt-backfill":
+		updated, err := store.BackfillEncryption(context.Background(), cfg.BatchSize)
+		if err != nil {
+			log.Fatalf("encryption backfill failed after %d rows: %v", updated, err)
+		}
+		log.Printf("Encryption backfill completed: %d rows updated", updated)
+	case "verify-integrity":
+		verified, broken, err := integrity.NewVerifier(store, cfg.BatchSize).VerifyAll(context.Background())
+		if err != nil {
+			log.Fatalf("integrity verification failed after %d chains: %v", verified, err)
+		}
+		if broken > 0 {
+			log.Fatalf("integrity verification found %d of %d chains broken", broken, verified)
 		}
-	}()
+	default:
+		log.Fatalf("unknown command %q", name)
+	}
+}
+
+// runBackfill imports historical transactions from legacy exports. An
+// interrupted import is resumed by running it again with the same
+// checkpoint file.
+func runBackfill(args []string, cfg *config.Config, store *storage.Storage) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	path := flags.String("path", "", "export file, or directory of export files, to import")
+	format := flags.String("format", "", "csv or ndjson; by file extension when empty")
+	batchSize := flags.Int("batch-size", cfg.BatchSize, "transactions stored per database transaction")
+	mappingFile := flags.String("mapping", "", "JSON file mapping legacy columns onto transaction fields")
+	checkpoint := flags.String("checkpoint", "backfill-checkpoint.json", "file recording the progress, to resume from")
+	flags.Parse(args)
+
+	if *path == "" {
+		log.Fatal("backfill: --path is required")
+	}
+	if *format != "" && *format != backfill.FormatCSV && *format != backfill.FormatNDJSON {
+		log.Fatalf("backfill: --format must be %s or %s", backfill.FormatCSV, backfill.FormatNDJSON)
+	}
+	mapping, err := backfill.LoadMapping(*mappingFile)
+	if err != nil {
+		log.Fatalf("backfill: invalid mapping: %v", err)
+	}
 
-	// Graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	log.Println("Shutting down storage-service...")
-	cancel()
+	start := time.Now()
+	stats, err := backfill.NewImporter(store, backfill.Options{
+		Path:       *path,
+		Format:     *format,
+		BatchSize:  *batchSize,
+		Mapping:    mapping,
+		Checkpoint: *checkpoint,
+	}).Run(ctx)
+	if err != nil {
+		log.Fatalf("backfill stopped after %d read, %d inserted, %d skipped, %d failed, resume with checkpoint %s: %v",
+			stats.Read, stats.Inserted, stats.Skipped, stats.Failed, *checkpoint, err)
+	}
+	log.Printf("Backfill completed in %s: %d read, %d inserted, %d skipped, %d failed",
+		time.Since(start).Round(time.Second), stats.Read, stats.Inserted, stats.Skipped, stats.Failed)
 }
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		want   bool
+	}{
+		{"matching token", "Bearer s3cret", "s3cret", true},
+		{"wrong token", "Bearer guess", "s3cret", false},
+		{"token prefix", "Bearer s3cre", "s3cret", false},
+		{"no bearer scheme", "s3cret", "s3cret", false},
+		{"no header", "", "s3cret", false},
+		{"no token configured", "Bearer ", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := AdminAuthorized(r, tt.token); got != tt.want {
+				t.Errorf("AdminAuthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
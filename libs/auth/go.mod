@@ -0,0 +1,5 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/auth
+
+go 1.23.0
+
+require github.com/golang-jwt/jwt/v5 v5.3.0
@@ -0,0 +1,171 @@
+// Package auth checks the credentials callers present to the services: the
+// JWTs issued by the ingestion service, validated by the services reading
+// what it ingested, and the shared tokens guarding the admin endpoints.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims represents the JWT claims issued by the ingestion service
+type Claims struct {
+	UserID    string   `json:"user_id"`
+	AccountID string   `json:"account_id"`
+	Roles     []string `json:"roles"`
+	TenantID  string   `json:"tenant_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ErrUnknownKeyID is returned for a token naming a key ID that is not
+// configured
+var ErrUnknownKeyID = errors.New("unknown key ID")
+
+// JWTManager validates JWT tokens against the key named by their kid header:
+// the current key or one of the previous keys kept during a rotation
+type JWTManager struct {
+	mu    sync.RWMutex
+	keyID string
+	keys  map[string][]byte
+}
+
+// NewJWTManager creates a JWT manager accepting tokens signed with secret
+// under keyID, or with the previous secrets, by key ID
+func NewJWTManager(keyID, secret string, previous map[string]string) *JWTManager {
+	keys := make(map[string][]byte, len(previous)+1)
+	for kid, s := range previous {
+		keys[kid] = []byte(s)
+	}
+	keys[keyID] = []byte(secret)
+	return &JWTManager{keyID: keyID, keys: keys}
+}
+
+// SetSecret replaces the secret of the current key, so a rotated secret
+// applies without a restart. Tokens signed with the old secret under the
+// same key ID no longer validate.
+func (j *JWTManager) SetSecret(secret string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys[j.keyID] = []byte(secret)
+}
+
+// verificationKey returns the key named by the kid header of token. Tokens
+// without one, issued before key IDs, are checked against the current key.
+func (j *JWTManager) verificationKey(token *jwt.Token) ([]byte, error) {
+	kid, _ := token.Header["kid"].(string)
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if kid == "" {
+		kid = j.keyID
+	}
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKeyID, kid)
+	}
+	return key, nil
+}
+
+// ValidateToken validates a JWT token and returns claims
+func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return j.verificationKey(token)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+// ExtractTokenFromHeader extracts JWT token from Authorization header
+func ExtractTokenFromHeader(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("authorization header required")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", fmt.Errorf("invalid authorization header format")
+	}
+
+	return parts[1], nil
+}
+
+// ExtractTokenFromQuery extracts JWT token from the access_token query
+// parameter, for clients such as browser WebSockets and EventSources that
+// cannot set headers
+func ExtractTokenFromQuery(r *http.Request) (string, error) {
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		return "", fmt.Errorf("access_token parameter required")
+	}
+	return token, nil
+}
+
+// HasRole checks if the user has a specific role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole checks if the user has any of the specified roles
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantScope returns the tenant the caller's reads are limited to, or nil
+// for every tenant. Admins without a tenant claim read every tenant, or the
+// requested one when set; everyone else reads only their own tenant.
+func (c *Claims) TenantScope(requested string) *string {
+	if c.TenantID == "" && c.HasRole("admin") {
+		if requested == "" {
+			return nil
+		}
+		return &requested
+	}
+	tenantID := c.TenantID
+	return &tenantID
+}
+
+// ContextKey is a type for context keys
+type ContextKey string
+
+const (
+	// ClaimsContextKey is the key for storing claims in context
+	ClaimsContextKey ContextKey = "claims"
+)
+
+// WithClaims adds claims to context
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ClaimsContextKey, claims)
+}
+
+// ClaimsFromContext retrieves claims from context
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ClaimsContextKey).(*Claims)
+	return claims, ok
+}
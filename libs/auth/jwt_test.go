@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oldSecret = "old-secret-at-least-thirty-two-bytes!"
+	newSecret = "new-secret-at-least-thirty-two-bytes!"
+)
+
+// sign issues a token for user under kid, as the ingestion service does
+func sign(t *testing.T, kid, secret, user string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: user,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestValidateTokenByKeyID(t *testing.T) {
+	j := NewJWTManager("2025-06", newSecret, map[string]string{"2025-01": oldSecret})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "current key", token: sign(t, "2025-06", newSecret, "user-1")},
+		{name: "previous key", token: sign(t, "2025-01", oldSecret, "user-1")},
+		{name: "no key ID checks the current key", token: sign(t, "", newSecret, "user-1")},
+		{name: "unknown key ID", token: sign(t, "2024-01", oldSecret, "user-1"), wantErr: ErrUnknownKeyID},
+		{name: "wrong secret for the key ID", token: sign(t, "2025-06", oldSecret, "user-1"), wantErr: jwt.ErrSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := j.ValidateToken(tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ValidateToken = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || claims.UserID != "user-1" {
+				t.Errorf("ValidateToken = %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestSetSecretRotatesTheCurrentKey(t *testing.T) {
+	j := NewJWTManager("2025-06", oldSecret, map[string]string{"2025-01": "previous-secret-at-least-32-bytes!"})
+	before := sign(t, "2025-06", oldSecret, "user-1")
+	if _, err := j.ValidateToken(before); err != nil {
+		t.Fatalf("ValidateToken before the rotation: %v", err)
+	}
+
+	j.SetSecret(newSecret)
+	if _, err := j.ValidateToken(before); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Errorf("token signed with the replaced secret: %v, want %v", err, jwt.ErrSignatureInvalid)
+	}
+	if _, err := j.ValidateToken(sign(t, "2025-06", newSecret, "user-1")); err != nil {
+		t.Errorf("token signed with the new secret: %v", err)
+	}
+	// The previous keys of a key-ID rotation are untouched
+	if _, err := j.ValidateToken(sign(t, "2025-01", "previous-secret-at-least-32-bytes!", "user-1")); err != nil {
+		t.Errorf("token signed with a previous key: %v", err)
+	}
+}
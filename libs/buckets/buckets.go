@@ -0,0 +1,92 @@
+// Package buckets sizes the buckets of the Prometheus histograms of the
+// services. Each histogram has default bucket boundaries suited to what it
+// measures, which METRICS_BUCKETS_ and its name in upper case replaces with
+// a comma-separated list of upper bounds, e.g.
+//
+//	METRICS_BUCKETS_REDIS_OPERATION_DURATION_SECONDS=0.0001,0.0005,0.001,0.005
+//
+// Histograms are created before the configuration is validated, so an
+// invalid list falls back to the defaults; Validate reports it so the
+// service refuses to start.
+package buckets
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes the variables setting the buckets of a histogram
+const EnvPrefix = "METRICS_BUCKETS_"
+
+// Defaults for the latencies measured across the services, in seconds
+var (
+	// Redis is sub-millisecond to 100ms, for commands to Redis
+	Redis = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+	// Publish is 1ms to 1s, for publishing to Kafka until acknowledged
+	Publish = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	// Request is 1ms to 5s, for HTTP requests and processing
+	Request = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+)
+
+// EnvVar returns the variable setting the buckets of the histogram named
+// metric
+func EnvVar(metric string) string {
+	return EnvPrefix + strings.ToUpper(metric)
+}
+
+// For returns the buckets of the histogram named metric: those its
+// variable lists, or defaults when it is unset or invalid
+func For(metric string, defaults []float64) []float64 {
+	value, ok := os.LookupEnv(EnvVar(metric))
+	if !ok {
+		return defaults
+	}
+	buckets, err := Parse(value)
+	if err != nil {
+		return defaults
+	}
+	return buckets
+}
+
+// Parse parses a comma-separated list of bucket upper bounds, which must be
+// finite and strictly increasing. The +Inf bucket is implicit.
+func Parse(value string) ([]float64, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, errors.New("no buckets listed")
+	}
+	fields := strings.Split(value, ",")
+	buckets := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", strings.TrimSpace(field))
+		}
+		if math.IsInf(bound, 0) || math.IsNaN(bound) {
+			return nil, fmt.Errorf("%q is not finite", strings.TrimSpace(field))
+		}
+		if n := len(buckets); n > 0 && bound <= buckets[n-1] {
+			return nil, fmt.Errorf("%v does not increase on %v", bound, buckets[n-1])
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
+
+// Validate checks every bucket list set in the environment parses
+func Validate() error {
+	var problems []error
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+		if _, err := Parse(value); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,115 @@
+package buckets
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []float64
+		wantErr string
+	}{
+		{name: "sub-millisecond", value: "0.0001,0.0005,0.001,0.005", want: []float64{0.0001, 0.0005, 0.001, 0.005}},
+		{name: "spaces around bounds", value: " 0.001 , 0.01,1 ", want: []float64{0.001, 0.01, 1}},
+		{name: "a single bucket", value: "1", want: []float64{1}},
+		{name: "nothing listed", value: " ", wantErr: "no buckets listed"},
+		{name: "not a number", value: "0.001,fast", wantErr: `"fast" is not a number`},
+		{name: "empty bound", value: "0.001,,0.01", wantErr: `"" is not a number`},
+		{name: "infinite", value: "0.001,+Inf", wantErr: `"+Inf" is not finite`},
+		{name: "not a number at all", value: "NaN", wantErr: `"NaN" is not finite`},
+		{name: "decreasing", value: "0.1,0.05", wantErr: "0.05 does not increase on 0.1"},
+		{name: "repeated", value: "0.1,0.1", wantErr: "0.1 does not increase on 0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) = %v, %v, want an error containing %q", tt.value, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultsParse(t *testing.T) {
+	for name, defaults := range map[string][]float64{"Redis": Redis, "Publish": Publish, "Request": Request} {
+		var list []string
+		for _, bound := range defaults {
+			list = append(list, strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		if _, err := Parse(strings.Join(list, ",")); err != nil {
+			t.Errorf("%s defaults: %v", name, err)
+		}
+	}
+	if Redis[0] >= 0.001 {
+		t.Errorf("Redis buckets start at %v, want sub-millisecond resolution", Redis[0])
+	}
+	if Publish[0] != 0.001 || Publish[len(Publish)-1] != 1 {
+		t.Errorf("Publish buckets span %v to %v, want 1ms to 1s", Publish[0], Publish[len(Publish)-1])
+	}
+	if Request[0] != 0.001 || Request[len(Request)-1] != 5 {
+		t.Errorf("Request buckets span %v to %v, want 1ms to 5s", Request[0], Request[len(Request)-1])
+	}
+}
+
+func TestFor(t *testing.T) {
+	defaults := []float64{0.1, 1}
+	tests := []struct {
+		name  string
+		value *string
+		want  []float64
+	}{
+		{name: "unset", want: defaults},
+		{name: "set", value: ptr("0.0001,0.001"), want: []float64{0.0001, 0.001}},
+		{name: "invalid falls back to the defaults", value: ptr("1,0.5"), want: defaults},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.value != nil {
+				t.Setenv("METRICS_BUCKETS_TEST_DURATION_SECONDS", *tt.value)
+			}
+			if got := For("test_duration_seconds", defaults); !slices.Equal(got, tt.want) {
+				t.Errorf("For = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv("METRICS_BUCKETS_REDIS_OPERATION_DURATION_SECONDS", "0.0001,0.001")
+	if err := Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want no error", err)
+	}
+
+	t.Setenv("METRICS_BUCKETS_HTTP_REQUEST_DURATION_SECONDS", "0.1,0.05")
+	t.Setenv("METRICS_BUCKETS_KAFKA_PUBLISH_DURATION_SECONDS", "")
+	err := Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want the invalid lists reported")
+	}
+	for _, want := range []string{
+		"METRICS_BUCKETS_HTTP_REQUEST_DURATION_SECONDS: 0.05 does not increase on 0.1",
+		"METRICS_BUCKETS_KAFKA_PUBLISH_DURATION_SECONDS: no buckets listed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "REDIS_OPERATION") {
+		t.Errorf("Validate() = %v, reports a valid list", err)
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,66 @@
+// Package buildinfo describes the running binary. Version, Commit and Date
+// are set at build time with
+//
+//	-ldflags "-X github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo.Version=..."
+//
+// and are exposed on a /version endpoint, in the startup log and as the
+// build_info metric labels.
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info is the build information of a service
+type Info struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of service
+func Get(service string) Info {
+	return Info{
+		Service:   service,
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: Date,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Labels returns the build_info metric labels, following the Prometheus
+// convention of a constant 1 gauge labelled with version, revision and
+// goversion
+func Labels() map[string]string {
+	return map[string]string{
+		"version":   Version,
+		"revision":  Commit,
+		"goversion": runtime.Version(),
+	}
+}
+
+// Handler serves the build information of service as JSON
+func Handler(service string) http.HandlerFunc {
+	info := Get(service)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// String formats the build information for the startup log
+func (i Info) String() string {
+	return i.Service + " " + i.Version + " (commit " + i.Commit + ", built " + i.BuildDate + ", " + i.GoVersion + ")"
+}
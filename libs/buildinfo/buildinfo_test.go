@@ -0,0 +1,78 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// stamp sets the build variables as -ldflags would for the test
+func stamp(t *testing.T, version, commit, date string) {
+	t.Helper()
+	oldVersion, oldCommit, oldDate := Version, Commit, Date
+	Version, Commit, Date = version, commit, date
+	t.Cleanup(func() { Version, Commit, Date = oldVersion, oldCommit, oldDate })
+}
+
+func TestHandlerServesTheBuildInfo(t *testing.T) {
+	stamp(t, "1.4.2", "3f9c2ab", "2025-06-01T12:00:00Z")
+
+	w := httptest.NewRecorder()
+	Handler("storage-service")(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /version = %d %s, want 200 JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"service":    "storage-service",
+		"version":    "1.4.2",
+		"commit":     "3f9c2ab",
+		"build_date": "2025-06-01T12:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	if len(got) != len(want) {
+		t.Errorf("payload %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("payload %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestUnstampedBuild(t *testing.T) {
+	info := Get("alert-service")
+	if info.Version != "dev" || info.Commit != "unknown" || info.BuildDate != "unknown" {
+		t.Errorf("Get = %+v, want the development defaults", info)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	stamp(t, "1.4.2", "3f9c2ab", "2025-06-01T12:00:00Z")
+
+	got := Labels()
+	want := map[string]string{"version": "1.4.2", "revision": "3f9c2ab", "goversion": runtime.Version()}
+	if len(got) != len(want) {
+		t.Errorf("Labels = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("label %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	stamp(t, "1.4.2", "3f9c2ab", "2025-06-01T12:00:00Z")
+
+	want := "ingestion-service 1.4.2 (commit 3f9c2ab, built 2025-06-01T12:00:00Z, " + runtime.Version() + ")"
+	if got := Get("ingestion-service").String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
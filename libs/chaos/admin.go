@@ -0,0 +1,80 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// faultRequest is the body of POST /admin/chaos. Durations are in seconds
+// and the latency of a latency fault in milliseconds.
+type faultRequest struct {
+	Target      string  `json:"target"`
+	Mode        string  `json:"mode"`
+	Probability float64 `json:"probability"`
+	Duration    int     `json:"duration"`
+	LatencyMs   int     `json:"latency_ms"`
+}
+
+// faultResponse is an active fault as listed by the admin endpoint
+type faultResponse struct {
+	Target      string    `json:"target"`
+	Mode        string    `json:"mode"`
+	Probability float64   `json:"probability"`
+	LatencyMs   int64     `json:"latency_ms,omitempty"`
+	Until       time.Time `json:"until"`
+}
+
+// Handler serves /admin/chaos, authenticated by token as a bearer token; an
+// empty token refuses every request. POST sets a fault, GET lists the
+// active faults and DELETE clears them.
+func (i *Injector) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/chaos", func(w http.ResponseWriter, r *http.Request) {
+		var req faultRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		err := i.Set(req.Target, req.Mode, req.Probability,
+			time.Duration(req.LatencyMs)*time.Millisecond, time.Duration(req.Duration)*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeFaults(w, i.Faults())
+	})
+	mux.HandleFunc("GET /admin/chaos", func(w http.ResponseWriter, r *http.Request) {
+		writeFaults(w, i.Faults())
+	})
+	mux.HandleFunc("DELETE /admin/chaos", func(w http.ResponseWriter, r *http.Request) {
+		i.Clear()
+		writeFaults(w, i.Faults())
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeFaults writes the active faults as a JSON response
+func writeFaults(w http.ResponseWriter, faults []Fault) {
+	resp := make([]faultResponse, len(faults))
+	for i, f := range faults {
+		resp[i] = faultResponse{
+			Target:      f.Target,
+			Mode:        f.Mode,
+			Probability: f.Probability,
+			LatencyMs:   f.Latency.Milliseconds(),
+			Until:       f.Until,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]faultResponse{"faults": resp})
+}
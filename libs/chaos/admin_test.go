@@ -0,0 +1,117 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "admin-token"
+
+// serve sends a request of method with body to h with the admin token,
+// returning the status and the faults listed in the response
+func serve(t *testing.T, h http.Handler, method, body string) (int, []faultResponse) {
+	t.Helper()
+	r := httptest.NewRequest(method, "/admin/chaos", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var resp map[string][]faultResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return w.Code, resp["faults"]
+}
+
+func TestHandlerSetsListsAndClearsFaults(t *testing.T) {
+	i := New(true, nil)
+	h := i.Handler(testAdminToken)
+
+	status, faults := serve(t, h, http.MethodPost,
+		`{"target":"db","mode":"latency","probability":0.5,"duration":60,"latency_ms":250}`)
+	if status != http.StatusOK || len(faults) != 1 {
+		t.Fatalf("POST = %d %v, want the fault", status, faults)
+	}
+	f := faults[0]
+	if f.Target != TargetDB || f.Mode != ModeLatency || f.Probability != 0.5 || f.LatencyMs != 250 {
+		t.Errorf("fault = %+v", f)
+	}
+	if until := time.Until(f.Until); until < 55*time.Second || until > time.Minute {
+		t.Errorf("fault until %s, want in a minute", f.Until)
+	}
+
+	if _, faults := serve(t, h, http.MethodPost, `{"target":"kafka_reader","mode":"duplicate","probability":1,"duration":60}`); len(faults) != 2 {
+		t.Errorf("POST = %v, want both faults", faults)
+	}
+	if status, faults := serve(t, h, http.MethodGet, ""); status != http.StatusOK || len(faults) != 2 {
+		t.Errorf("GET = %d %v, want both faults", status, faults)
+	}
+	if status, faults := serve(t, h, http.MethodDelete, ""); status != http.StatusOK || len(faults) != 0 {
+		t.Errorf("DELETE = %d %v, want none left", status, faults)
+	}
+	if len(i.Faults()) != 0 {
+		t.Error("faults still active after DELETE")
+	}
+}
+
+func TestHandlerRejectsInvalidFaults(t *testing.T) {
+	h := New(true, nil).Handler(testAdminToken)
+
+	for _, body := range []string{
+		`not json`,
+		`{"target":"redis","mode":"error","probability":1,"duration":60}`,
+		`{"target":"db","mode":"error","probability":2,"duration":60}`,
+		`{"target":"db","mode":"error","probability":1}`,
+	} {
+		if status, _ := serve(t, h, http.MethodPost, body); status != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, status)
+		}
+	}
+}
+
+func TestHandlerRequiresTheToken(t *testing.T) {
+	i := New(true, nil)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+	}{
+		{"no token", testAdminToken, ""},
+		{"wrong token", testAdminToken, "Bearer guess"},
+		{"admin disabled", "", "Bearer "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin/chaos",
+				strings.NewReader(`{"target":"db","mode":"error","probability":1,"duration":60}`))
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			i.Handler(tt.token).ServeHTTP(w, r)
+			if w.Code != http.StatusUnauthorized || len(i.Faults()) != 0 {
+				t.Errorf("status = %d with %d faults set, want 401 and none", w.Code, len(i.Faults()))
+			}
+		})
+	}
+}
+
+func TestHandlerOfADisabledInjector(t *testing.T) {
+	var i *Injector
+	h := i.Handler(testAdminToken)
+
+	if status, _ := serve(t, h, http.MethodPost, `{"target":"db","mode":"error","probability":1,"duration":60}`); status != http.StatusBadRequest {
+		t.Errorf("POST = %d, want 400", status)
+	}
+	if status, faults := serve(t, h, http.MethodGet, ""); status != http.StatusOK || len(faults) != 0 {
+		t.Errorf("GET = %d %v, want no faults", status, faults)
+	}
+}
@@ -0,0 +1,197 @@
+// Package chaos injects faults into the pipeline to rehearse broker outages
+// and slow databases. Faults are set at runtime through an admin endpoint
+// and revert on their own when their duration expires. The layer only
+// exists when it is enabled: New returns nil otherwise, and every method of
+// a nil Injector does nothing.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fault targets
+const (
+	TargetKafkaWriter = "kafka_writer"
+	TargetKafkaReader = "kafka_reader"
+	TargetDB          = "db"
+)
+
+// Fault modes. Duplicate only applies to the Kafka reader.
+const (
+	ModeError     = "error"
+	ModeLatency   = "latency"
+	ModeDuplicate = "duplicate"
+)
+
+// defaultLatency is the delay of a latency fault that does not set one
+const defaultLatency = 500 * time.Millisecond
+
+// ErrInjected is the error of an injected error fault
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Fault is one active failure mode of a target. Each call on the target
+// fails with Probability until Until.
+type Fault struct {
+	Target      string
+	Mode        string
+	Probability float64
+	Latency     time.Duration
+	Until       time.Time
+}
+
+// Metrics records the injected faults
+type Metrics interface {
+	RecordFault(target, mode string)
+}
+
+// Injector holds the active faults
+type Injector struct {
+	metrics Metrics
+
+	mu     sync.Mutex
+	faults map[string]Fault // by target and mode
+}
+
+// New creates an injector, or returns nil when enabled is false
+func New(enabled bool, metrics Metrics) *Injector {
+	if !enabled {
+		return nil
+	}
+	return &Injector{metrics: metrics, faults: make(map[string]Fault)}
+}
+
+// Set activates a fault for duration, replacing any fault of the same
+// target and mode
+func (i *Injector) Set(target, mode string, probability float64, latency, duration time.Duration) error {
+	if i == nil {
+		return errors.New("chaos: fault injection is disabled")
+	}
+	switch target {
+	case TargetKafkaWriter, TargetKafkaReader, TargetDB:
+	default:
+		return fmt.Errorf("chaos: unknown target %q", target)
+	}
+	switch mode {
+	case ModeError, ModeLatency:
+	case ModeDuplicate:
+		if target != TargetKafkaReader {
+			return fmt.Errorf("chaos: mode %s only applies to %s", ModeDuplicate, TargetKafkaReader)
+		}
+	default:
+		return fmt.Errorf("chaos: unknown mode %q", mode)
+	}
+	if probability <= 0 || probability > 1 {
+		return errors.New("chaos: probability must be in (0, 1]")
+	}
+	if duration <= 0 {
+		return errors.New("chaos: duration must be positive")
+	}
+	if mode == ModeLatency && latency <= 0 {
+		latency = defaultLatency
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults[target+"/"+mode] = Fault{
+		Target:      target,
+		Mode:        mode,
+		Probability: probability,
+		Latency:     latency,
+		Until:       time.Now().Add(duration),
+	}
+	return nil
+}
+
+// Clear removes every fault
+func (i *Injector) Clear() {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	clear(i.faults)
+}
+
+// Faults returns the active faults, ordered by target and mode
+func (i *Injector) Faults() []Fault {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	faults := make([]Fault, 0, len(i.faults))
+	for key, f := range i.faults {
+		if !now.Before(f.Until) {
+			delete(i.faults, key)
+			continue
+		}
+		faults = append(faults, f)
+	}
+	sort.Slice(faults, func(a, b int) bool {
+		if faults[a].Target != faults[b].Target {
+			return faults[a].Target < faults[b].Target
+		}
+		return faults[a].Mode < faults[b].Mode
+	})
+	return faults
+}
+
+// Inject applies the latency and error faults of target: it sleeps while a
+// latency fault fires and returns ErrInjected when an error fault fires, or
+// the error of ctx when it is done first
+func (i *Injector) Inject(ctx context.Context, target string) error {
+	if i == nil {
+		return nil
+	}
+	if f, ok := i.fire(target, ModeLatency); ok {
+		select {
+		case <-time.After(f.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if _, ok := i.fire(target, ModeError); ok {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Duplicate reports whether a duplicate fault of target fires, so the
+// message just consumed should be delivered twice
+func (i *Injector) Duplicate(target string) bool {
+	if i == nil {
+		return false
+	}
+	_, ok := i.fire(target, ModeDuplicate)
+	return ok
+}
+
+// fire reports whether the active fault of target and mode fires, recording
+// it when it does. Expired faults are removed.
+func (i *Injector) fire(target, mode string) (Fault, bool) {
+	key := target + "/" + mode
+
+	i.mu.Lock()
+	f, ok := i.faults[key]
+	if ok && !time.Now().Before(f.Until) {
+		delete(i.faults, key)
+		ok = false
+	}
+	i.mu.Unlock()
+
+	if !ok || rand.Float64() >= f.Probability {
+		return f, false
+	}
+	if i.metrics != nil {
+		i.metrics.RecordFault(target, mode)
+	}
+	return f, true
+}
@@ -0,0 +1,218 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMetrics counts the faults recorded, by target and mode
+type fakeMetrics struct {
+	mu     sync.Mutex
+	faults map[string]int
+}
+
+func (m *fakeMetrics) RecordFault(target, mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.faults == nil {
+		m.faults = make(map[string]int)
+	}
+	m.faults[target+"/"+mode]++
+}
+
+func (m *fakeMetrics) count(target, mode string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.faults[target+"/"+mode]
+}
+
+func TestDisabledInjectorIsANoOp(t *testing.T) {
+	i := New(false, &fakeMetrics{})
+	if i != nil {
+		t.Fatalf("New(false) = %v, want nil", i)
+	}
+
+	// Every method of the nil injector the services hold is safe and inert
+	if err := i.Set(TargetDB, ModeError, 1, 0, time.Minute); err == nil {
+		t.Error("Set on a disabled injector succeeded")
+	}
+	if err := i.Inject(context.Background(), TargetDB); err != nil {
+		t.Errorf("Inject = %v, want nil", err)
+	}
+	if i.Duplicate(TargetKafkaReader) {
+		t.Error("Duplicate = true on a disabled injector")
+	}
+	if faults := i.Faults(); faults != nil {
+		t.Errorf("Faults = %v, want none", faults)
+	}
+	i.Clear()
+}
+
+func TestSetValidates(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		mode        string
+		probability float64
+		duration    time.Duration
+		want        string
+	}{
+		{"unknown target", "redis", ModeError, 1, time.Minute, `unknown target "redis"`},
+		{"unknown mode", TargetDB, "corrupt", 1, time.Minute, `unknown mode "corrupt"`},
+		{"duplicate writes", TargetKafkaWriter, ModeDuplicate, 1, time.Minute, "only applies to kafka_reader"},
+		{"duplicate queries", TargetDB, ModeDuplicate, 1, time.Minute, "only applies to kafka_reader"},
+		{"zero probability", TargetDB, ModeError, 0, time.Minute, "probability must be in (0, 1]"},
+		{"probability above 1", TargetDB, ModeError, 1.5, time.Minute, "probability must be in (0, 1]"},
+		{"no duration", TargetDB, ModeError, 1, 0, "duration must be positive"},
+	}
+
+	i := New(true, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := i.Set(tt.target, tt.mode, tt.probability, 0, tt.duration)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Set = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if faults := i.Faults(); len(faults) != 0 {
+		t.Errorf("invalid faults were set: %v", faults)
+	}
+}
+
+func TestErrorFault(t *testing.T) {
+	metrics := &fakeMetrics{}
+	i := New(true, metrics)
+	if err := i.Set(TargetKafkaWriter, ModeError, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	for range 3 {
+		if err := i.Inject(context.Background(), TargetKafkaWriter); !errors.Is(err, ErrInjected) {
+			t.Errorf("Inject = %v, want %v", err, ErrInjected)
+		}
+	}
+	// Other targets are untouched
+	if err := i.Inject(context.Background(), TargetDB); err != nil {
+		t.Errorf("Inject into another target = %v", err)
+	}
+	if n := metrics.count(TargetKafkaWriter, ModeError); n != 3 {
+		t.Errorf("%d faults recorded, want 3", n)
+	}
+	if n := metrics.count(TargetDB, ModeError); n != 0 {
+		t.Errorf("%d faults recorded for another target", n)
+	}
+}
+
+func TestLatencyFault(t *testing.T) {
+	metrics := &fakeMetrics{}
+	i := New(true, metrics)
+	if err := i.Set(TargetDB, ModeLatency, 1, 30*time.Millisecond, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	start := time.Now()
+	if err := i.Inject(context.Background(), TargetDB); err != nil {
+		t.Fatalf("Inject = %v", err)
+	}
+	if took := time.Since(start); took < 30*time.Millisecond {
+		t.Errorf("Inject took %s, want the 30ms latency", took)
+	}
+	if n := metrics.count(TargetDB, ModeLatency); n != 1 {
+		t.Errorf("%d latency faults recorded, want 1", n)
+	}
+
+	// A caller giving up is not held for the whole latency
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := i.Inject(ctx, TargetDB); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Inject with a short deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A latency fault without a latency gets the default
+	if err := i.Set(TargetKafkaReader, ModeLatency, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	for _, f := range i.Faults() {
+		if f.Target == TargetKafkaReader && f.Latency != defaultLatency {
+			t.Errorf("latency = %s, want %s", f.Latency, defaultLatency)
+		}
+	}
+}
+
+func TestDuplicateFault(t *testing.T) {
+	metrics := &fakeMetrics{}
+	i := New(true, metrics)
+	if i.Duplicate(TargetKafkaReader) {
+		t.Error("Duplicate without a fault")
+	}
+	if err := i.Set(TargetKafkaReader, ModeDuplicate, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !i.Duplicate(TargetKafkaReader) {
+		t.Error("Duplicate = false with a certain fault")
+	}
+	// A duplicate fault neither delays nor fails a read
+	if err := i.Inject(context.Background(), TargetKafkaReader); err != nil {
+		t.Errorf("Inject = %v", err)
+	}
+	if n := metrics.count(TargetKafkaReader, ModeDuplicate); n != 1 {
+		t.Errorf("%d duplicates recorded, want 1", n)
+	}
+}
+
+func TestFaultsFireWithTheirProbability(t *testing.T) {
+	i := New(true, nil)
+	if err := i.Set(TargetDB, ModeError, 0.3, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	const calls = 10000
+	failed := 0
+	for range calls {
+		if i.Inject(context.Background(), TargetDB) != nil {
+			failed++
+		}
+	}
+	if rate := float64(failed) / calls; rate < 0.25 || rate > 0.35 {
+		t.Errorf("failure rate %.3f, want about 0.3", rate)
+	}
+}
+
+func TestFaultsRevertWhenTheyExpire(t *testing.T) {
+	metrics := &fakeMetrics{}
+	i := New(true, metrics)
+	if err := i.Set(TargetDB, ModeError, 1, 0, 20*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := i.Set(TargetKafkaWriter, ModeError, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if faults := i.Faults(); len(faults) != 2 || faults[0].Target != TargetDB || faults[1].Target != TargetKafkaWriter {
+		t.Fatalf("Faults = %v, want both ordered by target", faults)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := i.Inject(context.Background(), TargetDB); err != nil {
+		t.Errorf("Inject after the fault expired = %v", err)
+	}
+	if faults := i.Faults(); len(faults) != 1 || faults[0].Target != TargetKafkaWriter {
+		t.Errorf("Faults = %v, want only the unexpired one", faults)
+	}
+
+	// Setting a fault again replaces it, and Clear removes every fault
+	if err := i.Set(TargetKafkaWriter, ModeError, 0.5, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if faults := i.Faults(); len(faults) != 1 || faults[0].Probability != 0.5 {
+		t.Errorf("Faults = %v, want the replaced fault", faults)
+	}
+	i.Clear()
+	if faults := i.Faults(); len(faults) != 0 {
+		t.Errorf("Faults after Clear = %v", faults)
+	}
+}
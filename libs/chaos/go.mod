@@ -0,0 +1,9 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/chaos
+
+go 1.23.0
+
+require github.com/Harsh5840/real-time-tx-monitoring/libs/auth v0.0.0
+
+require github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/auth => ../auth
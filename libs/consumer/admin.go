@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/auth"
+)
+
+// AdminHandler serves POST /admin/consumer/pause, /admin/consumer/resume
+// and /admin/dlq/redrive for c, authenticated by token as a bearer token; an
+// empty token refuses every request. A pause request waits
+// for the messages in flight up to the drain timeout; it answers 202 when
+// they are still being handled, 200 once the consumer is idle. A re-drive
+// request takes a RedriveRequest and answers with the RedriveSummary, also
+// on failure.
+func AdminHandler(c *Consumer, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/consumer/pause", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), c.cfg.DrainTimeout)
+		defer cancel()
+		if err := c.Pause(ctx); err != nil {
+			writeState(w, http.StatusAccepted, "pausing")
+			return
+		}
+		writeState(w, http.StatusOK, "paused")
+	})
+	mux.HandleFunc("POST /admin/consumer/resume", func(w http.ResponseWriter, r *http.Request) {
+		c.Resume()
+		writeState(w, http.StatusOK, "running")
+	})
+
+	mux.HandleFunc("POST /admin/dlq/redrive", func(w http.ResponseWriter, r *http.Request) {
+		var req RedriveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		summary, err := c.Redrive(r.Context(), req)
+		switch {
+		case errors.Is(err, ErrNoDeadLetterTopic):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrRedriveRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrInvalidRedrive):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err != nil:
+			c.logger.Error("re-drive failed", "error", err)
+			writeJSON(w, http.StatusBadGateway, map[string]any{"summary": summary, "error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, summary)
+		}
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AdminAuthorized(r, token) {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeState writes the consumer state as a JSON response
+func writeState(w http.ResponseWriter, status int, state string) {
+	writeJSON(w, status, map[string]string{"state": state})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
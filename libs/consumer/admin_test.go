@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const testAdminToken = "admin-token"
+
+// post sends an admin request for path to h with the Authorization header
+// authorization, returning the status and body
+func post(h http.Handler, path, authorization string) (int, string) {
+	r := httptest.NewRequest(http.MethodPost, path, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestAdminHandlerRequiresTheToken(t *testing.T) {
+	c := newConsumer(testConfig(1), HandlerFunc(func(ctx context.Context, m kafka.Message) error { return nil }), newFakeTopic().open)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+	}{
+		{"no token", testAdminToken, ""},
+		{"wrong token", testAdminToken, "Bearer guess"},
+		{"not a bearer token", testAdminToken, testAdminToken},
+		{"admin disabled", "", "Bearer "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := post(AdminHandler(c, tt.token), "/admin/consumer/pause", tt.authorization); status != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+			}
+			if c.Paused() {
+				t.Fatal("unauthenticated request paused the consumer")
+			}
+		})
+	}
+}
+
+func TestAdminHandlerPausesAndResumes(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1")
+	done := newHandled()
+	c := newConsumer(testConfig(1), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+	waitFor(t, "the first message", func() bool { return topic.lastCommitted() == 0 })
+	h := AdminHandler(c, testAdminToken)
+
+	status, body := post(h, "/admin/consumer/pause", "Bearer "+testAdminToken)
+	if status != http.StatusOK || body != `{"state":"paused"}` {
+		t.Fatalf("pause = %d %s, want 200 paused", status, body)
+	}
+	topic.produce("acct-2")
+	time.Sleep(20 * time.Millisecond)
+	if n := done.count(); n != 1 {
+		t.Fatalf("%d messages handled while paused, want 1", n)
+	}
+
+	status, body = post(h, "/admin/consumer/resume", "Bearer "+testAdminToken)
+	if status != http.StatusOK || body != `{"state":"running"}` {
+		t.Fatalf("resume = %d %s, want 200 running", status, body)
+	}
+	waitFor(t, "the message produced while paused", func() bool { return topic.lastCommitted() == 1 })
+
+	// Only POST changes the state
+	r := httptest.NewRequest(http.MethodGet, "/admin/consumer/pause", nil)
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || c.Paused() {
+		t.Errorf("GET pause = %d, paused = %v, want 405 and running", w.Code, c.Paused())
+	}
+}
+
+func TestAdminHandlerAcceptsAPauseStillDraining(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1")
+	release := make(chan struct{})
+	cfg := testConfig(1)
+	cfg.DrainTimeout = 10 * time.Millisecond
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		<-release
+		return nil
+	}), topic.open)
+	start(t, c)
+	defer close(release)
+	waitFor(t, "the first fetch", func() bool { return topic.fetchedCount() == 1 })
+
+	// The message in flight outlasts the drain timeout
+	status, body := post(AdminHandler(c, testAdminToken), "/admin/consumer/pause", "Bearer "+testAdminToken)
+	if status != http.StatusAccepted || body != `{"state":"pausing"}` {
+		t.Errorf("pause = %d %s, want 202 pausing", status, body)
+	}
+	if !c.Paused() {
+		t.Error("consumer not paused")
+	}
+}
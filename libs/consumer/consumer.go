@@ -0,0 +1,910 @@
+// Package consumer is the Kafka consumer shared by the pipeline services.
+// Messages are sharded by key (the account ID) over a pool of workers, each
+// handling its queue in order, so state-dependent handlers see an account's
+// messages in sequence while different accounts are handled in parallel and
+// a slow account holds up only its own shard. Only the lowest contiguous
+// offset of each partition whose messages have all been handled, retried to
+// exhaustion and dead-lettered, or given up on is committed. Messages the
+// handler marks Permanent are dead-lettered without retries, and a message
+// too large to be fetched is skipped, leaving a stub describing it on the
+// dead letter topic.
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// Reader fetches the messages of a consumer group and commits their
+// offsets. It is satisfied by *kafka.Reader.
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// messageWriter publishes dead letters. It is satisfied by *kafka.Writer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Handler handles one message. A returned error means the message should be
+// handled again, unless it is wrapped with Permanent.
+type Handler interface {
+	Handle(ctx context.Context, m kafka.Message) error
+}
+
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(ctx context.Context, m kafka.Message) error
+
+// Handle calls f(ctx, m)
+func (f HandlerFunc) Handle(ctx context.Context, m kafka.Message) error {
+	return f(ctx, m)
+}
+
+// permanentError marks an error retrying cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler error retrying cannot fix, such as a payload
+// that does not decode. The message is dead-lettered without further
+// attempts.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// Error stages reported to Metrics
+const (
+	StageRead       = "read"
+	StageHandle     = "handle"
+	StageCommit     = "commit"
+	StageDeadLetter = "dead_letter"
+)
+
+// Metrics receives the consumer's measurements, so each service can keep
+// its own metric names
+type Metrics interface {
+	RecordError(stage string)
+	SetQueueDepth(worker string, depth int)
+	RecordDeadLettered()
+	RecordAbandoned()
+	RecordOversized()
+	SetLag(lag int64)
+	SetPartitionLag(partition int, lag int64)
+	SetPaused(paused bool)
+}
+
+// nopMetrics discards measurements
+type nopMetrics struct{}
+
+func (nopMetrics) RecordError(string)  {}
+func (nopMetrics) RecordDeadLettered() {}
+func (nopMetrics) RecordAbandoned()    {}
+func (nopMetrics) RecordOversized()    {}
+func (nopMetrics) SetLag(int64)        {}
+func (nopMetrics) SetPaused(bool)      {}
+
+func (nopMetrics) SetQueueDepth(string, int)  {}
+func (nopMetrics) SetPartitionLag(int, int64) {}
+
+// Config configures a Consumer. Zero values get the defaults noted.
+type Config struct {
+	Brokers string // comma-separated
+	GroupID string
+	Topic   string
+
+	// Dialer and Transport carry the TLS and SASL settings of the reader and
+	// the dead letter writer; nil means plaintext
+	Dialer    *kafka.Dialer
+	Transport *kafka.Transport
+
+	// Messages are sharded by key over Workers goroutines (default 1), with
+	// at most BatchSize messages (default 100) fetched past the committable
+	// offsets, so a partition's messages are handled at most BatchSize
+	// offsets out of order. Handled offsets are committed every
+	// CommitInterval (default 1s).
+	BatchSize      int
+	Workers        int
+	CommitInterval time.Duration
+
+	// A failing message is retried after Backoff (default 1s), doubling up
+	// to MaxBackoff (default 1m). After MaxAttempts attempts it is published
+	// to DeadLetterTopic, or skipped when there is none; MaxAttempts <= 0
+	// retries until the handler succeeds.
+	Backoff         time.Duration
+	MaxBackoff      time.Duration
+	MaxAttempts     int
+	DeadLetterTopic string
+
+	// MaxRedrives caps how many times a message is re-driven from the dead
+	// letter topic (default 3)
+	MaxRedrives int
+
+	// MaxBytes is the largest fetch (default 10MB). A message larger than
+	// it stalls its partition; when no message arrives for StallTimeout
+	// (default 1m) or a read fails, the partitions are probed and one stuck
+	// at the same oversized message on two probes in a row is skipped.
+	MaxBytes     int
+	StallTimeout time.Duration
+
+	// On shutdown the messages in flight are given DrainTimeout to finish
+	// (default 30s)
+	DrainTimeout time.Duration
+
+	// Lag is reported to Metrics every LagInterval (default 15s), in total
+	// and per partition
+	Metrics     Metrics
+	LagInterval time.Duration
+
+	// When LagAlerter is set, a partition whose lag stays at or over
+	// LagThreshold for LagSustain (default 5m) raises an operational alert,
+	// resolved once its lag has fallen to LagThreshold times
+	// LagRecoveryRatio (default 0.5). LagThreshold <= 0 disables alerting.
+	LagAlerter       LagAlerter
+	LagThreshold     int64
+	LagSustain       time.Duration
+	LagRecoveryRatio float64
+
+	// Logger defaults to the slog default logger. Handled messages are all
+	// logged at debug level, or else one in LogSampleRate (default 100) at
+	// info level.
+	Logger        *slog.Logger
+	LogSampleRate int
+
+	// StartOffset is where a group with no committed offset starts:
+	// kafka.FirstOffset (the default) or kafka.LastOffset
+	StartOffset int64
+
+	// Chaos injects read faults; nil injects none
+	Chaos *chaos.Injector
+}
+
+// Consumer wraps the kafka.Reader
+type Consumer struct {
+	cfg        Config
+	dialer     *kafka.Dialer
+	readerCfg  kafka.ReaderConfig
+	newReader  func() Reader
+	deadLetter messageWriter // nil without a dead letter topic
+	prober     prober
+	h          Handler
+	metrics    Metrics
+	logger     *slog.Logger
+	sampled    *slog.Logger
+
+	// reader is replaced after skipping a message, guarded by readerMu
+	readerMu sync.RWMutex
+	reader   Reader
+
+	// Pause state, guarded by mu. resume is closed by Resume and idle by
+	// Start once it is paused with nothing in flight; cancelFetch stops the
+	// fetch in progress.
+	mu          sync.Mutex
+	paused      bool
+	resume      chan struct{}
+	idle        chan struct{}
+	cancelFetch context.CancelFunc
+
+	// stalled holds the committed offset of each partition seen stuck at
+	// an oversized message by the last probe, taken at lastProbe; only
+	// Start touches them
+	stalled   map[int]int64
+	lastProbe time.Time
+
+	// lagWatch is nil when lag alerting is disabled
+	lagWatch *lagWatch
+
+	// redriving is set while a re-drive runs. A re-drive reads through the
+	// reader openRedrive returns and republishes through the writer
+	// newRedriveWriter returns, concluding the dead letter topic is drained
+	// after redriveIdle without a message.
+	redriving        atomic.Bool
+	openRedrive      func(kafka.ReaderConfig) Reader
+	newRedriveWriter func() messageWriter
+	redriveIdle      time.Duration
+}
+
+// New creates a new consumer of cfg.Topic
+func New(cfg Config, h Handler) *Consumer {
+	c := newConsumer(cfg, h, func(readerCfg kafka.ReaderConfig) Reader {
+		return kafka.NewReader(readerCfg)
+	})
+	if c.cfg.DeadLetterTopic != "" {
+		// Synchronous and acknowledged by all replicas: the source offset is
+		// committed once the message is dead-lettered
+		c.deadLetter = &kafka.Writer{
+			Addr:         kafka.TCP(c.readerCfg.Brokers...),
+			Topic:        c.cfg.DeadLetterTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transportOrDefault(c.cfg.Transport),
+		}
+	}
+	c.newRedriveWriter = func() messageWriter {
+		return &kafka.Writer{
+			Addr:         kafka.TCP(c.readerCfg.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transportOrDefault(c.cfg.Transport),
+		}
+	}
+	c.prober = &brokerProber{c: c, client: &kafka.Client{
+		Addr:      kafka.TCP(c.readerCfg.Brokers...),
+		Transport: transportOrDefault(c.cfg.Transport),
+	}}
+	return c
+}
+
+// newConsumer creates a consumer reading through the readers open returns,
+// re-drives included, without a dead letter writer, re-drive writer or
+// prober
+func newConsumer(cfg Config, h Handler, open func(kafka.ReaderConfig) Reader) *Consumer {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 100
+	}
+	if cfg.CommitInterval <= 0 {
+		cfg.CommitInterval = time.Second
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.LagInterval <= 0 {
+		cfg.LagInterval = 15 * time.Second
+	}
+	if cfg.LogSampleRate < 1 {
+		cfg.LogSampleRate = 100
+	}
+	if cfg.MaxBytes < 1 {
+		cfg.MaxBytes = 10e6 // 10MB
+	}
+	if cfg.StallTimeout <= 0 {
+		cfg.StallTimeout = time.Minute
+	}
+	if cfg.MaxRedrives < 1 {
+		cfg.MaxRedrives = 3
+	}
+	if cfg.LagSustain <= 0 {
+		cfg.LagSustain = 5 * time.Minute
+	}
+	if cfg.LagRecoveryRatio <= 0 || cfg.LagRecoveryRatio > 1 {
+		cfg.LagRecoveryRatio = 0.5
+	}
+
+	dialer := cfg.Dialer
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	addrs := ParseBrokers(cfg.Brokers)
+	c := &Consumer{
+		cfg:    cfg,
+		dialer: dialer,
+		readerCfg: kafka.ReaderConfig{
+			Brokers:     addrs,
+			GroupID:     cfg.GroupID,
+			Topic:       cfg.Topic,
+			Dialer:      dialer,
+			StartOffset: cfg.StartOffset,
+			MinBytes:    10e3, // 10KB
+			MaxBytes:    cfg.MaxBytes,
+		},
+		h:           h,
+		metrics:     cfg.Metrics,
+		stalled:     make(map[int]int64),
+		openRedrive: open,
+		redriveIdle: defaultRedriveIdle,
+	}
+	c.newReader = func() Reader { return open(c.readerCfg) }
+	c.reader = c.newReader()
+	if cfg.LagAlerter != nil && cfg.LagThreshold > 0 {
+		c.lagWatch = &lagWatch{
+			group:      cfg.GroupID,
+			topic:      cfg.Topic,
+			threshold:  cfg.LagThreshold,
+			recovery:   int64(float64(cfg.LagThreshold) * cfg.LagRecoveryRatio),
+			sustain:    cfg.LagSustain,
+			partitions: make(map[int]*partitionLag),
+		}
+	}
+	if c.metrics == nil {
+		c.metrics = nopMetrics{}
+	}
+	if c.logger = cfg.Logger; c.logger == nil {
+		c.logger = slog.Default()
+	}
+	c.logger = c.logger.With("topic", cfg.Topic)
+	c.sampled = logging.Sampled(c.logger, cfg.LogSampleRate)
+	return c
+}
+
+// current returns the reader in use
+func (c *Consumer) current() Reader {
+	c.readerMu.RLock()
+	defer c.readerMu.RUnlock()
+	return c.reader
+}
+
+// transportOrDefault returns t, or the default transport when t is nil. A
+// nil *kafka.Transport must not be stored in the RoundTripper interface.
+func transportOrDefault(t *kafka.Transport) kafka.RoundTripper {
+	if t == nil {
+		return kafka.DefaultTransport
+	}
+	return t
+}
+
+// ParseBrokers splits a comma-separated broker list, ignoring blanks
+func ParseBrokers(brokers string) []string {
+	parts := strings.Split(brokers, ",")
+	addrs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if s := strings.TrimSpace(p); s != "" {
+			addrs = append(addrs, s)
+		}
+	}
+	if len(addrs) == 0 {
+		addrs = []string{brokers}
+	}
+	return addrs
+}
+
+// Start begins consuming messages and forwarding them to the workers. When
+// ctx is cancelled it stops fetching and returns only once the messages in
+// flight have been handled and their offsets committed, or the drain timeout
+// has passed. Messages abandoned at the timeout are left uncommitted and
+// redelivered.
+func (c *Consumer) Start(ctx context.Context) error {
+	c.logger.Info("starting consumer")
+	go c.reportLag(ctx)
+
+	// Handling outlives ctx, so a message is not cut off mid-handling
+	handleCtx, abandon := context.WithCancel(context.WithoutCancel(ctx))
+	defer abandon()
+
+	for {
+		if err := c.waitWhilePaused(ctx); err != nil {
+			return err
+		}
+
+		// Fetch until paused or stopped, then let the workers finish
+		p := c.startPipeline(ctx, handleCtx)
+		fetchCtx, stopFetch := c.fetchContext(ctx)
+		c.fetchInto(fetchCtx, p)
+		stopFetch()
+
+		if ctx.Err() != nil {
+			c.drain(p, abandon)
+			return ctx.Err()
+		}
+		p.finish()
+	}
+}
+
+// Pause stops fetching messages until Resume is called. The group session is
+// kept alive, so the partitions stay assigned. It returns once the messages
+// in flight have been handled and committed, or with the error of ctx when that
+// takes longer; the consumer pauses either way. It waits for a consumer
+// that is not running until ctx is done.
+func (c *Consumer) Pause(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.paused {
+		c.paused = true
+		c.resume = make(chan struct{})
+		c.idle = make(chan struct{})
+		if c.cancelFetch != nil {
+			c.cancelFetch()
+		}
+		c.metrics.SetPaused(true)
+		c.logger.Info("pausing consumer")
+	}
+	idle := c.idle
+	c.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume resumes fetching after Pause
+func (c *Consumer) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	close(c.resume)
+	c.metrics.SetPaused(false)
+	c.logger.Info("consumer resumed")
+}
+
+// Paused reports whether the consumer is paused
+func (c *Consumer) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// waitWhilePaused blocks while the consumer is paused, first telling Pause
+// that nothing is in flight
+func (c *Consumer) waitWhilePaused(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-c.idle:
+	default:
+		close(c.idle)
+		c.logger.Info("consumer paused")
+	}
+	resume := c.resume
+	c.mu.Unlock()
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchContext returns the context of one fetch, cancelled by Pause, or
+// already cancelled when the consumer is paused
+func (c *Consumer) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		cancel()
+		return fetchCtx, cancel
+	}
+	c.cancelFetch = cancel
+	return fetchCtx, func() {
+		c.mu.Lock()
+		c.cancelFetch = nil
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// fetchInto fetches messages and dispatches them to the workers of p until
+// ctx is cancelled, holding at most BatchSize of them in flight
+func (c *Consumer) fetchInto(ctx context.Context, p *pipeline) {
+	for {
+		if !p.acquire(ctx) {
+			return
+		}
+		stallCtx, cancel := context.WithTimeout(ctx, c.cfg.StallTimeout)
+		m, err := c.fetchMessage(stallCtx)
+		cancel()
+		if err != nil {
+			p.release(1)
+			if ctx.Err() != nil {
+				return
+			}
+			if stallCtx.Err() == nil {
+				c.logger.Error("read error", "error", err)
+				c.metrics.RecordError(StageRead)
+			}
+			if errors.Is(err, chaos.ErrInjected) {
+				sleep(ctx, ctx, c.cfg.Backoff)
+			} else if p.settle(ctx) {
+				// Nothing in flight: the committed offsets are where a
+				// stalled partition is stuck
+				c.skipOversized(ctx)
+			}
+			continue
+		}
+
+		// A duplicate delivery fault hands the message over twice
+		if c.cfg.Chaos.Duplicate(chaos.TargetKafkaReader) && p.acquire(ctx) {
+			p.dispatch(m)
+		}
+		p.dispatch(m)
+	}
+}
+
+// fetchMessage fetches the next message, after any injected read fault
+func (c *Consumer) fetchMessage(ctx context.Context) (kafka.Message, error) {
+	if err := c.cfg.Chaos.Inject(ctx, chaos.TargetKafkaReader); err != nil {
+		return kafka.Message{}, err
+	}
+	return c.current().FetchMessage(ctx)
+}
+
+// pipeline is one run of the workers, from a start or resume until the
+// consumer is paused or stopped
+type pipeline struct {
+	c       *Consumer
+	stop    context.Context // cancels retries
+	ctx     context.Context // handling runs under it
+	queues  []chan kafka.Message
+	slots   chan struct{} // a token per message fetched past the committable offsets
+	offsets *offsetTracker
+
+	workers   sync.WaitGroup
+	committer sync.WaitGroup
+	done      chan struct{} // closed once the workers have returned
+}
+
+// startPipeline starts the workers and the commit loop. Retries stop once
+// stop is cancelled; handling itself runs under ctx.
+func (c *Consumer) startPipeline(stop, ctx context.Context) *pipeline {
+	p := &pipeline{
+		c:       c,
+		stop:    stop,
+		ctx:     ctx,
+		queues:  make([]chan kafka.Message, c.cfg.Workers),
+		slots:   make(chan struct{}, c.cfg.BatchSize),
+		offsets: newOffsetTracker(),
+		done:    make(chan struct{}),
+	}
+	for i := range p.queues {
+		// Never full: no more messages are in flight than there are slots
+		p.queues[i] = make(chan kafka.Message, c.cfg.BatchSize)
+		p.workers.Add(1)
+		go p.work(i)
+	}
+	go func() {
+		p.workers.Wait()
+		close(p.done)
+	}()
+	p.committer.Add(1)
+	go p.commitLoop()
+	return p
+}
+
+// acquire takes a slot for a message, waiting while BatchSize messages are
+// fetched past the committable offsets; it reports false once ctx is
+// cancelled
+func (p *pipeline) acquire(ctx context.Context) bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives back the slots of n messages now committable
+func (p *pipeline) release(n int) {
+	for ; n > 0; n-- {
+		<-p.slots
+	}
+}
+
+// settle waits for every message in flight to be handled and commits their
+// offsets, reporting false when ctx is cancelled first
+func (p *pipeline) settle(ctx context.Context) bool {
+	held := 0
+	defer func() { p.release(held) }()
+	for ; held < cap(p.slots); held++ {
+		if !p.acquire(ctx) {
+			return false
+		}
+	}
+	p.commit(ctx)
+	return true
+}
+
+// dispatch queues a message on the worker of its key
+func (p *pipeline) dispatch(m kafka.Message) {
+	p.offsets.track(m)
+	shard := p.shardFor(m)
+	p.c.metrics.SetQueueDepth(strconv.Itoa(shard), len(p.queues[shard])+1)
+	p.queues[shard] <- m
+}
+
+// shardFor picks the worker for a message by hashing its key, falling back to
+// the partition for unkeyed messages
+func (p *pipeline) shardFor(m kafka.Message) int {
+	if len(m.Key) == 0 {
+		return m.Partition % len(p.queues)
+	}
+	h := fnv.New32a()
+	h.Write(m.Key)
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// work handles the messages of one shard in order, releasing the slots of
+// the messages each makes committable. Once handling is cut off by
+// cancellation the rest of the queue is left unhandled, so a key's later
+// messages never get ahead of one to be redelivered; their slots are never
+// released, the pipeline being over.
+func (p *pipeline) work(shard int) {
+	defer p.workers.Done()
+	label := strconv.Itoa(shard)
+	queue := p.queues[shard]
+
+	cancelled := false
+	for m := range queue {
+		p.c.metrics.SetQueueDepth(label, len(queue))
+		if cancelled {
+			continue
+		}
+		if err := p.c.handle(p.stop, p.ctx, m); err != nil {
+			cancelled = true
+			continue
+		}
+		p.release(p.offsets.markDone(m))
+	}
+	p.c.metrics.SetQueueDepth(label, 0)
+}
+
+// commitLoop commits the handled offsets every CommitInterval until the
+// workers have returned
+func (p *pipeline) commitLoop() {
+	defer p.committer.Done()
+	ticker := time.NewTicker(p.c.cfg.CommitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.commit(p.ctx)
+		}
+	}
+}
+
+// commit commits the lowest contiguous handled offset of each partition that
+// advanced since the last commit
+func (p *pipeline) commit(ctx context.Context) {
+	msgs := p.offsets.pendingCommits()
+	if len(msgs) == 0 {
+		return
+	}
+	if err := p.c.current().CommitMessages(ctx, msgs...); err != nil {
+		if ctx.Err() == nil {
+			p.c.logger.Error("commit error", "error", err)
+			p.c.metrics.RecordError(StageCommit)
+		}
+		return
+	}
+	p.offsets.markCommitted(msgs)
+}
+
+// close stops dispatching: the workers return once their queues are empty
+func (p *pipeline) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+// finish waits for the workers to handle every message dispatched, then
+// commits their offsets
+func (p *pipeline) finish() {
+	p.close()
+	<-p.done
+	p.committer.Wait()
+	p.commit(p.ctx)
+}
+
+// handle retries a message until the handler succeeds, its attempts run
+// out, it fails permanently, or either context is cancelled. Only
+// cancellation is returned.
+func (c *Consumer) handle(stop, ctx context.Context, m kafka.Message) error {
+	ctx = logging.WithCorrelationID(ctx, header(m, logging.CorrelationHeader))
+	ctx = withSource(ctx, m)
+	backoff := c.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := c.h.Handle(ctx, m)
+		if err == nil {
+			c.logHandled(ctx, m, attempt, time.Since(start))
+			return nil
+		}
+		c.metrics.RecordError(StageHandle)
+
+		if IsPermanent(err) {
+			c.logger.ErrorContext(ctx, "handler failed permanently, not retrying",
+				"partition", m.Partition, "offset", m.Offset, "error", err)
+			return c.giveUp(stop, ctx, m, err)
+		}
+		if c.cfg.MaxAttempts > 0 && attempt >= c.cfg.MaxAttempts {
+			c.logger.ErrorContext(ctx, "handler failed, giving up",
+				"partition", m.Partition, "offset", m.Offset, "attempts", attempt, "error", err)
+			return c.giveUp(stop, ctx, m, err)
+		}
+
+		c.logger.WarnContext(ctx, "handler failed, retrying",
+			"partition", m.Partition, "offset", m.Offset, "backoff", backoff, "error", err)
+		if err := sleep(stop, ctx, backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// logHandled logs every handled message when debug logging is enabled, and
+// otherwise a sample of them at info level
+func (c *Consumer) logHandled(ctx context.Context, m kafka.Message, attempt int, took time.Duration) {
+	attrs := []any{"partition", m.Partition, "offset", m.Offset, "key", logging.RedactString(string(m.Key)), "attempt", attempt, "duration", took}
+	if c.logger.Enabled(ctx, slog.LevelDebug) {
+		c.logger.DebugContext(ctx, "message handled", attrs...)
+		return
+	}
+	c.sampled.InfoContext(ctx, "message handled", attrs...)
+}
+
+// giveUp dead-letters a message that failed every attempt, retrying the
+// publish until it succeeds or either context is cancelled. Without a dead
+// letter topic the message is skipped.
+func (c *Consumer) giveUp(stop, ctx context.Context, m kafka.Message, cause error) error {
+	if c.deadLetter == nil {
+		return nil
+	}
+
+	backoff := c.cfg.Backoff
+	for {
+		err := c.publishDeadLetter(ctx, m, cause)
+		if err == nil {
+			c.metrics.RecordDeadLettered()
+			return nil
+		}
+
+		c.logger.WarnContext(ctx, "dead letter publish failed, retrying", "backoff", backoff, "error", err)
+		c.metrics.RecordError(StageDeadLetter)
+		if err := sleep(stop, ctx, backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// publishDeadLetter publishes a message to the dead letter topic unchanged,
+// with headers recording where it came from and why it failed
+func (c *Consumer) publishDeadLetter(ctx context.Context, m kafka.Message, cause error) error {
+	headers := append(append([]kafka.Header(nil), m.Headers...),
+		kafka.Header{Key: "dlq_error", Value: []byte(cause.Error())},
+		kafka.Header{Key: "dlq_source_topic", Value: []byte(m.Topic)},
+		kafka.Header{Key: "dlq_source_partition", Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: "dlq_source_offset", Value: []byte(strconv.FormatInt(m.Offset, 10))},
+	)
+
+	err := c.deadLetter.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message at partition %d offset %d: %w", m.Partition, m.Offset, err)
+	}
+	return nil
+}
+
+// header returns the value of a message header, or "" when absent
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// sleep waits for d, returning early with the error of either context
+func sleep(stop, ctx context.Context, d time.Duration) error {
+	select {
+	case <-stop.Done():
+		return stop.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// drain waits for the messages in flight, abandoning them after the drain
+// timeout, and commits the offsets of those handled
+func (c *Consumer) drain(p *pipeline, abandon context.CancelFunc) {
+	p.close()
+
+	c.logger.Info("draining in-flight messages", "timeout", c.cfg.DrainTimeout)
+	select {
+	case <-p.done:
+		c.logger.Info("in-flight messages drained")
+	case <-time.After(c.cfg.DrainTimeout):
+		abandon()
+		c.logger.Warn("drain timed out, abandoning the messages in flight; they will be redelivered", "timeout", c.cfg.DrainTimeout)
+		c.metrics.RecordAbandoned()
+	}
+
+	commitCtx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	p.commit(commitCtx)
+}
+
+// reportLag reports the consumer lag, and watches the lag of each partition,
+// until ctx is cancelled
+func (c *Consumer) reportLag(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.LagInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.metrics.SetLag(c.current().Stats().Lag)
+			c.watchLag(ctx)
+		}
+	}
+}
+
+// Stats returns the reader statistics
+func (c *Consumer) Stats() kafka.ReaderStats {
+	return c.current().Stats()
+}
+
+// ErrPaused is returned by Ready while the consumer is paused
+var ErrPaused = errors.New("consumer paused")
+
+// Ready checks that the consumer is not paused and a Kafka broker is
+// reachable
+func (c *Consumer) Ready(ctx context.Context) error {
+	if c.Paused() {
+		return ErrPaused
+	}
+	return c.Ping(ctx)
+}
+
+// Ping checks that a Kafka broker is reachable
+func (c *Consumer) Ping(ctx context.Context) error {
+	var lastErr error
+	for _, broker := range c.readerCfg.Brokers {
+		conn, err := c.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("no kafka broker reachable: %w", lastErr)
+}
+
+// Close shuts down the consumer
+func (c *Consumer) Close() error {
+	if c.deadLetter != nil {
+		c.deadLetter.Close()
+	}
+	return c.current().Close()
+}
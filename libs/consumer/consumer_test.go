@@ -0,0 +1,974 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/chaos"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeTopic is a single partition topic read by fakeReaders, which resume
+// from its committed offset as a consumer group does
+type fakeTopic struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed int64 // offset of the last message committed, -1 for none
+	fetched   int
+	opened    int
+	maxBytes  int // messages larger than it cannot be fetched; 0 for no limit
+}
+
+func newFakeTopic() *fakeTopic {
+	return &fakeTopic{committed: -1}
+}
+
+// produce appends messages with the given keys
+func (t *fakeTopic) produce(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		offset := int64(len(t.messages))
+		t.messages = append(t.messages, kafka.Message{
+			Topic:  "test",
+			Key:    []byte(key),
+			Value:  []byte(fmt.Sprintf("%s-%d", key, offset)),
+			Offset: offset,
+		})
+	}
+}
+
+// produceValue appends a message with the given value
+func (t *fakeTopic) produceValue(key string, value []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, kafka.Message{
+		Topic:  "test",
+		Key:    []byte(key),
+		Value:  value,
+		Offset: int64(len(t.messages)),
+	})
+}
+
+func (t *fakeTopic) open(kafka.ReaderConfig) Reader {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.opened++
+	return &fakeReader{topic: t, next: t.committed + 1}
+}
+
+func (t *fakeTopic) lastCommitted() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+func (t *fakeTopic) fetchedCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.fetched
+}
+
+// fakeReader fetches the messages of a fakeTopic in order, stalling at one
+// larger than the topic's maxBytes as a kafka.Reader does
+type fakeReader struct {
+	topic *fakeTopic
+	next  int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		t := r.topic
+		t.mu.Lock()
+		if r.next < int64(len(t.messages)) {
+			m := t.messages[r.next]
+			if t.maxBytes == 0 || len(m.Key)+len(m.Value) <= t.maxBytes {
+				r.next++
+				t.fetched++
+				t.mu.Unlock()
+				return m, nil
+			}
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.topic.mu.Lock()
+	defer r.topic.mu.Unlock()
+	for _, m := range msgs {
+		r.topic.committed = max(r.topic.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+func (r *fakeReader) Close() error             { return nil }
+
+// fakeWriter records the dead letters written
+type fakeWriter struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func (w *fakeWriter) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+// fakeMetrics records queue depths and counts
+type fakeMetrics struct {
+	nopMetrics
+	mu           sync.Mutex
+	depth        map[string]int
+	maxDepth     map[string]int
+	deadLettered int
+	oversized    int
+	abandoned    int
+	paused       []bool
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{depth: make(map[string]int), maxDepth: make(map[string]int)}
+}
+
+func (m *fakeMetrics) SetQueueDepth(worker string, depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.depth[worker] = depth
+	m.maxDepth[worker] = max(m.maxDepth[worker], depth)
+}
+
+func (m *fakeMetrics) RecordDeadLettered() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLettered++
+}
+
+func (m *fakeMetrics) RecordOversized() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.oversized++
+}
+
+func (m *fakeMetrics) RecordAbandoned() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.abandoned++
+}
+
+func (m *fakeMetrics) SetPaused(paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = append(m.paused, paused)
+}
+
+// pausedStates returns the paused states reported, in order
+func (m *fakeMetrics) pausedStates() []bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]bool(nil), m.paused...)
+}
+
+func (m *fakeMetrics) abandonedCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.abandoned
+}
+
+func (m *fakeMetrics) depthOf(worker string) (depth, maxDepth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.depth[worker], m.maxDepth[worker]
+}
+
+// testConfig returns a consumer configuration with short intervals
+func testConfig(workers int) Config {
+	return Config{
+		GroupID:        "test-group",
+		Topic:          "test",
+		Workers:        workers,
+		CommitInterval: 5 * time.Millisecond,
+		Backoff:        time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		DrainTimeout:   time.Second,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// start runs c until the test ends, returning the function stopping it and
+// returning the error of Start
+func start(t *testing.T, c *Consumer) func() error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- c.Start(ctx) }()
+
+	var once sync.Once
+	var err error
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			select {
+			case err = <-errc:
+			case <-time.After(5 * time.Second):
+				err = errors.New("consumer did not stop")
+			}
+		})
+		return err
+	}
+	t.Cleanup(func() {
+		if err := stop(); err != nil && !errors.Is(err, context.Canceled) {
+			t.Error(err)
+		}
+	})
+	return stop
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// shardOf returns the worker a key is handled by
+func shardOf(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// distinctKeys returns n keys handled by n different workers
+func distinctKeys(n, workers int) []string {
+	var keys []string
+	used := make(map[int]bool)
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("acct-%d", i)
+		if shard := shardOf(key, workers); !used[shard] {
+			used[shard] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// handled records the messages handled, by key
+type handled struct {
+	mu    sync.Mutex
+	byKey map[string][]int64
+	total int
+}
+
+func newHandled() *handled {
+	return &handled{byKey: make(map[string][]int64)}
+}
+
+func (h *handled) add(m kafka.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.byKey[string(m.Key)] = append(h.byKey[string(m.Key)], m.Offset)
+	h.total++
+}
+
+func (h *handled) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+func TestSlowKeyDoesNotHoldUpOtherKeys(t *testing.T) {
+	const workers = 4
+	topic := newFakeTopic()
+	topic.produce("slow")
+	var others []string
+	for i := 0; len(others) < 20; i++ {
+		key := fmt.Sprintf("acct-%d", i)
+		if shardOf(key, workers) != shardOf("slow", workers) {
+			others = append(others, key)
+		}
+	}
+	topic.produce(others...)
+
+	release := make(chan struct{})
+	done := newHandled()
+	c := newConsumer(testConfig(workers), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if string(m.Key) == "slow" {
+			<-release
+		}
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	waitFor(t, "the other accounts", func() bool { return done.count() == len(others) })
+	time.Sleep(20 * time.Millisecond) // a few commit intervals
+	if committed := topic.lastCommitted(); committed != -1 {
+		t.Fatalf("committed offset %d past the slow message still in flight", committed)
+	}
+
+	close(release)
+	last := int64(len(others))
+	waitFor(t, "the commit of every message", func() bool { return topic.lastCommitted() == last })
+}
+
+func TestKeysAreHandledInOrder(t *testing.T) {
+	topic := newFakeTopic()
+	keys := []string{"acct-a", "acct-b", "acct-c"}
+	for i := 0; i < 50; i++ {
+		topic.produce(keys...)
+	}
+
+	done := newHandled()
+	c := newConsumer(testConfig(4), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if m.Offset%7 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 149 })
+	done.mu.Lock()
+	defer done.mu.Unlock()
+	for _, key := range keys {
+		offsets := done.byKey[key]
+		if len(offsets) != 50 {
+			t.Fatalf("%s: %d messages handled, want 50", key, len(offsets))
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Fatalf("%s: offset %d handled after %d", key, offsets[i], offsets[i-1])
+			}
+		}
+	}
+}
+
+func TestInFlightMessagesAreBounded(t *testing.T) {
+	topic := newFakeTopic()
+	for i := 0; i < 10; i++ {
+		topic.produce("acct-1")
+	}
+
+	release := make(chan struct{})
+	cfg := testConfig(1)
+	cfg.BatchSize = 3
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		<-release
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	waitFor(t, "the first fetches", func() bool { return topic.fetchedCount() == 3 })
+	time.Sleep(20 * time.Millisecond)
+	if n := topic.fetchedCount(); n != 3 {
+		t.Fatalf("%d messages fetched with 3 in flight at most", n)
+	}
+
+	close(release)
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 9 })
+}
+
+func TestOutOfOrderHandlingIsBounded(t *testing.T) {
+	const workers = 2
+	topic := newFakeTopic()
+	keys := distinctKeys(2, workers)
+	topic.produce(keys[0])
+	for i := 0; i < 10; i++ {
+		topic.produce(keys[1])
+	}
+
+	release := make(chan struct{})
+	done := newHandled()
+	cfg := testConfig(workers)
+	cfg.BatchSize = 4
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if string(m.Key) == keys[0] {
+			<-release
+		}
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	// The other key's messages are handled, but fetching stops a batch past
+	// the slow message, which holds back the committable offset
+	waitFor(t, "the messages behind the slow one", func() bool { return done.count() == 3 })
+	time.Sleep(20 * time.Millisecond)
+	if n := topic.fetchedCount(); n != 4 {
+		t.Fatalf("%d messages fetched, want 4 with the slow message at offset 0", n)
+	}
+
+	close(release)
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 10 })
+}
+
+func TestQueueDepthIsReported(t *testing.T) {
+	topic := newFakeTopic()
+	for i := 0; i < 6; i++ {
+		topic.produce("acct-1")
+	}
+
+	release := make(chan struct{})
+	metrics := newFakeMetrics()
+	cfg := testConfig(1)
+	cfg.Metrics = metrics
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		<-release
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	waitFor(t, "a full queue", func() bool {
+		_, maxDepth := metrics.depthOf("0")
+		return maxDepth >= 5
+	})
+	close(release)
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 5 })
+	waitFor(t, "an empty queue", func() bool {
+		depth, _ := metrics.depthOf("0")
+		return depth == 0
+	})
+}
+
+func TestPermanentFailureIsDeadLetteredWithoutRetries(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1", "acct-1", "acct-1")
+
+	var mu sync.Mutex
+	attempts := make(map[int64]int)
+	cfg := testConfig(1)
+	cfg.MaxAttempts = 5
+	metrics := newFakeMetrics()
+	cfg.Metrics = metrics
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[m.Offset]++
+		if m.Offset == 1 {
+			return Permanent(errors.New("undecodable"))
+		}
+		return nil
+	}), topic.open)
+	dlq := &fakeWriter{}
+	c.deadLetter = dlq
+	start(t, c)
+
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 2 })
+	mu.Lock()
+	if attempts[1] != 1 {
+		t.Errorf("permanent failure attempted %d times, want 1", attempts[1])
+	}
+	mu.Unlock()
+
+	letters := dlq.written()
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(letters))
+	}
+	if got := header(letters[0], "dlq_source_offset"); got != "1" {
+		t.Errorf("dead letter source offset %q, want 1", got)
+	}
+	if got := header(letters[0], "dlq_error"); got != "undecodable" {
+		t.Errorf("dead letter error %q, want undecodable", got)
+	}
+}
+
+func TestFailingMessageIsDeadLetteredAfterItsAttempts(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1", "acct-1")
+
+	var mu sync.Mutex
+	attempts := 0
+	cfg := testConfig(1)
+	cfg.MaxAttempts = 3
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if m.Offset != 0 {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("store unavailable")
+	}), topic.open)
+	dlq := &fakeWriter{}
+	c.deadLetter = dlq
+	start(t, c)
+
+	waitFor(t, "every message", func() bool { return topic.lastCommitted() == 1 })
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 {
+		t.Errorf("%d attempts, want 3", attempts)
+	}
+	if n := len(dlq.written()); n != 1 {
+		t.Errorf("%d dead letters, want 1", n)
+	}
+}
+
+func TestShutdownDrainsAndCommits(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(3, 3)...)
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	c := newConsumer(testConfig(3), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}), topic.open)
+	stop := start(t, c)
+
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Start returned %v, want context.Canceled", err)
+	}
+	if committed := topic.lastCommitted(); committed != 2 {
+		t.Errorf("committed offset %d after the drain, want 2", committed)
+	}
+}
+
+func TestAbandonedMessagesAreNotCommitted(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(2, 2)...)
+
+	cfg := testConfig(2)
+	cfg.DrainTimeout = 20 * time.Millisecond
+	started := make(chan struct{}, 2)
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if m.Offset == 0 {
+			started <- struct{}{}
+			<-ctx.Done() // stuck until abandoned
+			return ctx.Err()
+		}
+		started <- struct{}{}
+		return nil
+	}), topic.open)
+	stop := start(t, c)
+
+	<-started
+	<-started
+	stop()
+	if committed := topic.lastCommitted(); committed != -1 {
+		t.Errorf("committed offset %d past the abandoned message", committed)
+	}
+}
+
+// slowNotifier is a notification channel taking delay to accept each
+// message, or until the sender gives up. It records the messages delivered.
+type slowNotifier struct {
+	*httptest.Server
+	delivered *handled
+}
+
+func newSlowNotifier(t *testing.T, delay time.Duration) *slowNotifier {
+	t.Helper()
+	n := &slowNotifier{delivered: newHandled()}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+// handler returns a handler sending each message to the notifier
+func (n *slowNotifier) handler() Handler {
+	return HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		n.delivered.add(m)
+		return nil
+	})
+}
+
+func TestShutdownWaitsForASlowNotifier(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(2, 2)...)
+	notifier := newSlowNotifier(t, 200*time.Millisecond)
+	metrics := newFakeMetrics()
+	cfg := testConfig(2)
+	cfg.Metrics = metrics
+	c := newConsumer(cfg, notifier.handler(), topic.open)
+	stop := start(t, c)
+
+	waitFor(t, "the sends to start", func() bool { return topic.fetchedCount() == 2 })
+	begun := time.Now()
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Start returned %v, want context.Canceled", err)
+	}
+	if n := notifier.delivered.count(); n != 2 {
+		t.Errorf("Start returned after %s with %d of 2 sends done", time.Since(begun), n)
+	}
+	if committed := topic.lastCommitted(); committed != 1 {
+		t.Errorf("committed offset %d after the drain, want 1", committed)
+	}
+	if n := metrics.abandonedCount(); n != 0 {
+		t.Errorf("%d drains abandoned, want 0", n)
+	}
+}
+
+func TestShutdownAbandonsANotifierPastTheTimeout(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(2, 2)...)
+	notifier := newSlowNotifier(t, time.Minute)
+	metrics := newFakeMetrics()
+	cfg := testConfig(2)
+	cfg.DrainTimeout = 50 * time.Millisecond
+	cfg.Metrics = metrics
+	c := newConsumer(cfg, notifier.handler(), topic.open)
+	stop := start(t, c)
+
+	waitFor(t, "the sends to start", func() bool { return topic.fetchedCount() == 2 })
+	begun := time.Now()
+	stop()
+	if elapsed := time.Since(begun); elapsed > time.Second {
+		t.Errorf("Start returned %s after the cancel, want about the drain timeout", elapsed)
+	}
+	if n := notifier.delivered.count(); n != 0 {
+		t.Errorf("%d sends completed, want both abandoned", n)
+	}
+	if committed := topic.lastCommitted(); committed != -1 {
+		t.Errorf("committed offset %d of abandoned messages; they must be redelivered", committed)
+	}
+	if n := metrics.abandonedCount(); n != 1 {
+		t.Errorf("%d drains abandoned, want 1", n)
+	}
+}
+
+func TestPauseWaitsForMessagesInFlight(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(2, 2)...)
+
+	done := newHandled()
+	release := make(chan struct{})
+	c := newConsumer(testConfig(2), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		<-release
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+	waitFor(t, "the first fetches", func() bool { return topic.fetchedCount() == 2 })
+
+	paused := make(chan error, 1)
+	go func() { paused <- c.Pause(context.Background()) }()
+	select {
+	case <-paused:
+		t.Fatal("Pause returned with messages in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-paused; err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if committed := topic.lastCommitted(); committed != 1 {
+		t.Errorf("committed offset %d once paused, want 1", committed)
+	}
+
+	topic.produce("acct-3")
+	time.Sleep(20 * time.Millisecond)
+	if n := done.count(); n != 2 {
+		t.Fatalf("%d messages handled while paused, want 2", n)
+	}
+
+	c.Resume()
+	waitFor(t, "the message produced while paused", func() bool { return topic.lastCommitted() == 2 })
+}
+
+func TestNothingIsHandledWhilePaused(t *testing.T) {
+	keys := distinctKeys(3, 3)
+	topic := newFakeTopic()
+	topic.produce(keys...)
+
+	done := newHandled()
+	metrics := newFakeMetrics()
+	cfg := testConfig(3)
+	cfg.Metrics = metrics
+	// Stalls come and go while paused without fetching resuming
+	cfg.StallTimeout = 5 * time.Millisecond
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+	waitFor(t, "the first messages", func() bool { return topic.lastCommitted() == 2 })
+
+	if err := c.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	// Pausing again is harmless
+	if err := c.Pause(context.Background()); err != nil {
+		t.Fatalf("second Pause: %v", err)
+	}
+	if !c.Paused() || !errors.Is(c.Ready(context.Background()), ErrPaused) {
+		t.Errorf("Paused = %v, Ready = %v, want paused and not ready", c.Paused(), c.Ready(context.Background()))
+	}
+
+	for i := 0; i < 10; i++ {
+		topic.produce(keys...)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n, fetched := done.count(), topic.fetchedCount(); n != 3 || fetched != 3 {
+		t.Fatalf("%d messages handled and %d fetched while paused, want 3", n, fetched)
+	}
+
+	c.Resume()
+	c.Resume()
+	waitFor(t, "the messages produced while paused", func() bool { return topic.lastCommitted() == 32 })
+	done.mu.Lock()
+	for key, offsets := range done.byKey {
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] <= offsets[i-1] {
+				t.Errorf("%s handled out of order after the resume: %v", key, offsets)
+				break
+			}
+		}
+	}
+	done.mu.Unlock()
+	if n := done.count(); n != 33 {
+		t.Errorf("%d messages handled, want each once", n)
+	}
+
+	// The reader, and with it the group session, was kept throughout
+	if topic.opened != 1 {
+		t.Errorf("reader opened %d times, want once", topic.opened)
+	}
+	if got := metrics.pausedStates(); len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("paused states reported %v, want paused then resumed", got)
+	}
+}
+
+func TestPauseGivesUpWaitingButStaysPaused(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1")
+
+	release := make(chan struct{})
+	c := newConsumer(testConfig(1), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		<-release
+		return nil
+	}), topic.open)
+	start(t, c)
+	waitFor(t, "the first fetch", func() bool { return topic.fetchedCount() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Pause(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pause = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !c.Paused() {
+		t.Fatal("consumer not paused after Pause gave up waiting")
+	}
+
+	close(release)
+	if err := c.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	topic.produce("acct-2")
+	time.Sleep(20 * time.Millisecond)
+	if fetched := topic.fetchedCount(); fetched != 1 {
+		t.Errorf("%d messages fetched while paused, want 1", fetched)
+	}
+}
+
+func TestPauseBeforeStart(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1")
+	c := newConsumer(testConfig(1), HandlerFunc(func(ctx context.Context, m kafka.Message) error { return nil }), topic.open)
+
+	// Nothing is running to go idle yet
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Pause(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pause = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	start(t, c)
+	if err := c.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause once started: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if fetched := topic.fetchedCount(); fetched != 0 {
+		t.Fatalf("%d messages fetched by a consumer started paused", fetched)
+	}
+	c.Resume()
+	waitFor(t, "the message", func() bool { return topic.lastCommitted() == 0 })
+}
+
+func TestFailingMessageDoesNotHoldUpTheBatch(t *testing.T) {
+	const workers = 4
+	keys := distinctKeys(workers, workers)
+	topic := newFakeTopic()
+	for i := 0; i < 5; i++ {
+		topic.produce(keys...)
+	}
+
+	// The first message of one account fails until it is dead-lettered
+	done := newHandled()
+	cfg := testConfig(workers)
+	cfg.MaxAttempts = 3
+	cfg.Backoff, cfg.MaxBackoff = 20*time.Millisecond, 20*time.Millisecond
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		if m.Offset == 0 {
+			return errors.New("slack unavailable")
+		}
+		done.add(m)
+		return nil
+	}), topic.open)
+	dlq := &fakeWriter{}
+	c.deadLetter = dlq
+	start(t, c)
+
+	// The other accounts are handled while it is retried
+	others := 5*workers - 5
+	waitFor(t, "the other accounts", func() bool { return done.count() >= others })
+	if letters := dlq.written(); len(letters) != 0 {
+		t.Fatalf("message dead-lettered before its retries, with %d others handled", done.count())
+	}
+
+	last := int64(5*workers - 1)
+	waitFor(t, "the commit of the whole batch", func() bool { return topic.lastCommitted() == last })
+	letters := dlq.written()
+	if len(letters) != 1 || header(letters[0], "dlq_source_offset") != "0" {
+		t.Fatalf("dead letters = %v, want the failing message", letters)
+	}
+	if n := done.count(); n != 5*workers-1 {
+		t.Errorf("%d messages handled, want every one but the failing message", n)
+	}
+}
+
+func TestDuplicateDeliveryFault(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1", "acct-2", "acct-3")
+	done := newHandled()
+	cfg := testConfig(2)
+	cfg.Chaos = chaos.New(true, nil)
+	if err := cfg.Chaos.Set(chaos.TargetKafkaReader, chaos.ModeDuplicate, 1, 0, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	// Every message is handed over twice, as a redelivery would, and committed
+	waitFor(t, "the duplicates", func() bool { return done.count() == 6 })
+	waitFor(t, "the commit", func() bool { return topic.lastCommitted() == 2 })
+	for key, offsets := range done.byKey {
+		if len(offsets) != 2 || offsets[0] != offsets[1] {
+			t.Errorf("%s handled at offsets %v, want its message twice", key, offsets)
+		}
+	}
+	if n := topic.fetchedCount(); n != 3 {
+		t.Errorf("%d messages fetched, want 3", n)
+	}
+}
+
+func TestReadErrorFault(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce("acct-1")
+	done := newHandled()
+	cfg := testConfig(1)
+	cfg.Chaos = chaos.New(true, nil)
+	if err := cfg.Chaos.Set(chaos.TargetKafkaReader, chaos.ModeError, 1, 0, 50*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		done.add(m)
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	// Reads fail without reaching the broker until the fault expires
+	time.Sleep(20 * time.Millisecond)
+	if n := topic.fetchedCount(); n != 0 {
+		t.Fatalf("%d messages fetched through a read fault", n)
+	}
+	waitFor(t, "the message once the fault expired", func() bool { return topic.lastCommitted() == 0 })
+	if n := done.count(); n != 1 {
+		t.Errorf("%d messages handled, want 1", n)
+	}
+}
+
+// BenchmarkThroughput consumes 1000 messages of 100 accounts, each taking
+// a notification's round trip to handle
+func BenchmarkThroughput(b *testing.B) {
+	const (
+		accounts = 100
+		messages = 1000
+		send     = 500 * time.Microsecond
+	)
+	keys := make([]string, messages)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("acct-%d", i%accounts)
+	}
+
+	for _, workers := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := testConfig(workers)
+			handler := HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+				time.Sleep(send)
+				return nil
+			})
+			for i := 0; i < b.N; i++ {
+				topic := newFakeTopic()
+				topic.produce(keys...)
+				ctx, cancel := context.WithCancel(context.Background())
+				errc := make(chan error, 1)
+				go func() { errc <- newConsumer(cfg, handler, topic.open).Start(ctx) }()
+				for topic.lastCommitted() != messages-1 {
+					time.Sleep(100 * time.Microsecond)
+				}
+				cancel()
+				<-errc
+			}
+			b.ReportMetric(float64(b.N*messages)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
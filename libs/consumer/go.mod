@@ -0,0 +1,29 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/consumer
+
+go 1.23.0
+
+require github.com/segmentio/kafka-go v0.4.48
+
+require (
+	github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo v0.0.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+)
+
+require (
+	github.com/Harsh5840/real-time-tx-monitoring/libs/auth v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/chaos v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/logging v0.0.0
+	github.com/Harsh5840/real-time-tx-monitoring/libs/models v0.0.0
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/logging => ../logging
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo => ../buildinfo
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/chaos => ../chaos
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/models => ../models
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/auth => ../auth
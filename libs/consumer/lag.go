@@ -0,0 +1,230 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// lagTimeout bounds one lag check
+const lagTimeout = 10 * time.Second
+
+// RuleConsumerLag is the rule triggering lag alerts
+const RuleConsumerLag = "consumer_lag"
+
+// LagAlerter publishes the alerts raised and resolved by the lag watch,
+// normally onto the topic the alert service consumes
+type LagAlerter interface {
+	PublishAlert(ctx context.Context, alert *models.Alert) error
+}
+
+// partitionLag is the alert state of a partition
+type partitionLag struct {
+	breachedAt time.Time     // first check at or over the threshold, zero when under it
+	alert      *models.Alert // the alert raised, until it is resolved
+}
+
+// lagWatch raises an alert for a partition whose lag stays at or over the
+// threshold for the sustain period, and resolves it once the lag has fallen
+// to the recovery level. Recovering below the threshold rather than at it
+// keeps a lag hovering around the threshold from flapping. Only reportLag
+// touches it.
+type lagWatch struct {
+	group      string
+	topic      string
+	threshold  int64
+	recovery   int64
+	sustain    time.Duration
+	partitions map[int]*partitionLag
+}
+
+// check records the lag of a partition at now and returns the alert to
+// publish, if any: a new alert once the lag has been sustained, or the
+// resolution of the alert raised once it has recovered. The state moves on
+// only when the alert is recorded.
+func (w *lagWatch) check(partition int, lag int64, now time.Time) *models.Alert {
+	state := w.partitions[partition]
+	if state == nil {
+		state = &partitionLag{}
+		w.partitions[partition] = state
+	}
+
+	if state.alert != nil {
+		if lag > w.recovery {
+			return nil
+		}
+		return w.resolution(state.alert, partition, lag, now)
+	}
+
+	if lag < w.threshold {
+		state.breachedAt = time.Time{}
+		return nil
+	}
+	if state.breachedAt.IsZero() {
+		state.breachedAt = now
+	}
+	if now.Sub(state.breachedAt) < w.sustain {
+		return nil
+	}
+	return w.alert(partition, lag, state.breachedAt, now)
+}
+
+// record moves the partition on once alert has been published
+func (w *lagWatch) record(partition int, alert *models.Alert) {
+	state := w.partitions[partition]
+	if alert.ResolvedAt != nil {
+		state.alert, state.breachedAt = nil, time.Time{}
+		return
+	}
+	state.alert = alert
+}
+
+// alert builds the alert of a partition breaching since breachedAt. Every
+// instance of the group watches every partition, so the ID is derived from
+// the breach rounded down to the sustain period, letting the alert service
+// deduplicate the alerts the instances raise for the same breach.
+func (w *lagWatch) alert(partition int, lag int64, breachedAt, now time.Time) *models.Alert {
+	id := fmt.Sprintf("consumer-lag-%s-%s-%d-%d", w.group, w.topic, partition, breachedAt.Truncate(w.sustain).Unix())
+	return &models.Alert{
+		ID:            id,
+		AccountID:     "consumer:" + w.group,
+		AlertType:     models.AlertTypeOperational,
+		Severity:      lagSeverity(lag, w.threshold),
+		Description:   fmt.Sprintf("Consumer group %s is %d messages behind on %s partition %d, over the threshold of %d since %s", w.group, lag, w.topic, partition, w.threshold, breachedAt.UTC().Format(time.RFC3339)),
+		RuleTriggered: RuleConsumerLag,
+		Status:        "open",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Metadata: map[string]string{
+			"consumer_group": w.group,
+			"topic":          w.topic,
+			"partition":      strconv.Itoa(partition),
+			"lag":            strconv.FormatInt(lag, 10),
+			"threshold":      strconv.FormatInt(w.threshold, 10),
+			"breached_at":    breachedAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// resolution builds the alert resolving raised, with its severity so it is
+// routed to the same channels
+func (w *lagWatch) resolution(raised *models.Alert, partition int, lag int64, now time.Time) *models.Alert {
+	metadata := make(map[string]string, len(raised.Metadata)+1)
+	for k, v := range raised.Metadata {
+		metadata[k] = v
+	}
+	metadata["lag"] = strconv.FormatInt(lag, 10)
+	metadata["resolves"] = raised.ID
+
+	return &models.Alert{
+		ID:            raised.ID + "-resolved",
+		AccountID:     raised.AccountID,
+		AlertType:     raised.AlertType,
+		Severity:      raised.Severity,
+		Description:   fmt.Sprintf("Consumer group %s recovered on %s partition %d: %d messages behind", w.group, w.topic, partition, lag),
+		RuleTriggered: RuleConsumerLag,
+		Status:        "resolved",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ResolvedAt:    &now,
+		ResolvedBy:    "consumer",
+		Metadata:      metadata,
+	}
+}
+
+// lagSeverity grades a lag by how far over the threshold it is
+func lagSeverity(lag, threshold int64) string {
+	switch {
+	case lag >= 10*threshold:
+		return models.SeverityCritical
+	case lag >= 3*threshold:
+		return models.SeverityHigh
+	default:
+		return models.SeverityMedium
+	}
+}
+
+// watchLag reports the lag of each partition the group has committed on and
+// checks it against the lag threshold, publishing the alerts raised and
+// resolved. A failed check or publish is retried on the next one.
+func (c *Consumer) watchLag(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, lagTimeout)
+	defer cancel()
+
+	lags, err := c.partitionLags(ctx)
+	if err != nil {
+		c.logger.Warn("failed to fetch partition lag", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for partition, lag := range lags {
+		c.metrics.SetPartitionLag(partition, lag)
+		if c.lagWatch == nil {
+			continue
+		}
+		alert := c.lagWatch.check(partition, lag, now)
+		if alert == nil {
+			continue
+		}
+		if err := c.cfg.LagAlerter.PublishAlert(ctx, alert); err != nil {
+			c.logger.Error("failed to publish lag alert", "partition", partition, "alert_id", alert.ID, "error", err)
+			continue
+		}
+		c.lagWatch.record(partition, alert)
+		c.logger.Warn("consumer lag alert "+alert.Status, "partition", partition, "lag", lag, "severity", alert.Severity, "alert_id", alert.ID)
+	}
+}
+
+// partitionLags returns the lag of each partition the group has committed
+// on: the last offset of the partition less the committed offset
+func (c *Consumer) partitionLags(ctx context.Context) (map[int]int64, error) {
+	client := &kafka.Client{
+		Addr:      kafka.TCP(c.readerCfg.Brokers...),
+		Transport: transportOrDefault(c.cfg.Transport),
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: c.cfg.GroupID,
+		Topics:  nil, // every partition the group committed on
+	})
+	if err == nil {
+		err = committed.Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64)
+	requests := []kafka.OffsetRequest{}
+	for _, p := range committed.Topics[c.cfg.Topic] {
+		if p.Error != nil || p.CommittedOffset < 0 {
+			continue
+		}
+		offsets[p.Partition] = p.CommittedOffset
+		requests = append(requests, kafka.LastOffsetOf(p.Partition))
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	last, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{c.cfg.Topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	lags := make(map[int]int64, len(offsets))
+	for _, p := range last.Topics[c.cfg.Topic] {
+		committedOffset, ok := offsets[p.Partition]
+		if p.Error != nil || !ok {
+			continue
+		}
+		lags[p.Partition] = max(p.LastOffset-committedOffset, 0)
+	}
+	return lags, nil
+}
@@ -0,0 +1,167 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/models"
+)
+
+func newLagWatch() *lagWatch {
+	return &lagWatch{
+		group:      "processing",
+		topic:      "transactions",
+		threshold:  1000,
+		recovery:   500,
+		sustain:    5 * time.Minute,
+		partitions: make(map[int]*partitionLag),
+	}
+}
+
+func TestLagWatchRaisesAndResolvesSustainedLag(t *testing.T) {
+	w := newLagWatch()
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	// Checked every minute, with the alert recorded as published
+	steps := []struct {
+		lag    int64
+		status string // of the alert returned, "" for none
+	}{
+		{200, ""},
+		{1500, ""}, // breach
+		{1200, ""},
+		{900, ""},  // under the threshold before the sustain period
+		{1000, ""}, // breach again
+		{1100, ""},
+		{1300, ""},
+		{1400, ""},
+		{1200, ""},
+		{1100, "open"}, // sustained 5 minutes
+		{1500, ""},
+		{900, ""}, // under the threshold, not yet recovered
+		{1100, ""},
+		{600, ""},
+		{500, "resolved"},
+		{400, ""},
+	}
+
+	var raised *models.Alert
+	for i, step := range steps {
+		now := start.Add(time.Duration(i) * time.Minute)
+		alert := w.check(0, step.lag, now)
+		status := ""
+		if alert != nil {
+			status = alert.Status
+			w.record(0, alert)
+		}
+		if status != step.status {
+			t.Fatalf("minute %d, lag %d: alert %q, want %q", i, step.lag, status, step.status)
+		}
+
+		switch status {
+		case "open":
+			raised = alert
+			breachedAt := start.Add(4 * time.Minute)
+			if alert.AlertType != models.AlertTypeOperational || alert.RuleTriggered != RuleConsumerLag ||
+				alert.AccountID != "consumer:processing" || alert.CreatedAt != now {
+				t.Errorf("alert %+v, want an operational consumer lag alert", alert)
+			}
+			if want := "consumer-lag-processing-transactions-0-1772452800"; alert.ID != want {
+				t.Errorf("alert ID %s, want %s", alert.ID, want)
+			}
+			if alert.Metadata["lag"] != "1100" || alert.Metadata["partition"] != "0" ||
+				alert.Metadata["breached_at"] != breachedAt.Format(time.RFC3339) {
+				t.Errorf("metadata %v, want lag 1100 on partition 0 since %s", alert.Metadata, breachedAt)
+			}
+		case "resolved":
+			if alert.ID != raised.ID+"-resolved" || alert.Metadata["resolves"] != raised.ID ||
+				alert.Severity != raised.Severity || alert.ResolvedAt == nil || !alert.ResolvedAt.Equal(now) {
+				t.Errorf("resolution %+v, want it to resolve %s", alert, raised.ID)
+			}
+			if alert.Metadata["lag"] != "500" {
+				t.Errorf("resolution lag %s, want 500", alert.Metadata["lag"])
+			}
+		}
+	}
+}
+
+func TestLagWatchRetriesUnrecordedAlerts(t *testing.T) {
+	w := newLagWatch()
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	w.check(1, 2000, start)
+
+	// Until an alert is published, each check returns it again
+	first := w.check(1, 2000, start.Add(5*time.Minute))
+	again := w.check(1, 2000, start.Add(6*time.Minute))
+	if first == nil || again == nil || again.ID != first.ID {
+		t.Fatalf("alerts %+v and %+v, want the same alert twice", first, again)
+	}
+	w.record(1, again)
+	if alert := w.check(1, 2000, start.Add(7*time.Minute)); alert != nil {
+		t.Errorf("alert %+v once recorded, want none", alert)
+	}
+
+	resolved := w.check(1, 100, start.Add(8*time.Minute))
+	if resolved == nil || w.check(1, 100, start.Add(9*time.Minute)) == nil {
+		t.Fatal("unrecorded resolution not returned again")
+	}
+	w.record(1, resolved)
+	if alert := w.check(1, 100, start.Add(10*time.Minute)); alert != nil {
+		t.Errorf("alert %+v once resolved, want none", alert)
+	}
+}
+
+func TestLagWatchTracksPartitionsApart(t *testing.T) {
+	w := newLagWatch()
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	for i := range 6 {
+		now := start.Add(time.Duration(i) * time.Minute)
+		if alert := w.check(0, 5000, now); alert != nil {
+			w.record(0, alert)
+		}
+		if alert := w.check(1, 10, now); alert != nil {
+			t.Fatalf("alert %+v for a partition keeping up", alert)
+		}
+	}
+	if w.partitions[0].alert == nil || w.partitions[0].alert.Metadata["partition"] != "0" {
+		t.Errorf("partition 0 state %+v, want its alert raised", w.partitions[0])
+	}
+}
+
+func TestLagSeverity(t *testing.T) {
+	tests := []struct {
+		lag  int64
+		want string
+	}{
+		{1000, models.SeverityMedium},
+		{2999, models.SeverityMedium},
+		{3000, models.SeverityHigh},
+		{9999, models.SeverityHigh},
+		{10000, models.SeverityCritical},
+		{250000, models.SeverityCritical},
+	}
+	for _, tt := range tests {
+		if got := lagSeverity(tt.lag, 1000); got != tt.want {
+			t.Errorf("lagSeverity(%d, 1000) = %s, want %s", tt.lag, got, tt.want)
+		}
+	}
+}
+
+func TestLagAlertIDsAreSharedByInstances(t *testing.T) {
+	start := time.Date(2026, 3, 2, 12, 1, 0, 0, time.UTC)
+
+	// Two instances of the group see the breach a few seconds apart
+	var ids []string
+	for _, offset := range []time.Duration{0, 20 * time.Second} {
+		w := newLagWatch()
+		w.check(0, 1500, start.Add(offset))
+		alert := w.check(0, 1500, start.Add(offset+5*time.Minute))
+		if alert == nil {
+			t.Fatal("no alert after the sustain period")
+		}
+		ids = append(ids, alert.ID)
+	}
+	if ids[0] != ids[1] {
+		t.Errorf("alert IDs %s and %s, want the same breach deduplicated", ids[0], ids[1])
+	}
+}
@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker records which fetched messages have been handled so that only
+// the lowest contiguous offset per partition is ever committed. Messages for
+// different keys complete out of order across workers; committing past a
+// message that is still in flight would lose it on a crash.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	topic       string
+	inflight    []int64 // offsets in fetch order
+	done        map[int64]int
+	committable int64 // highest offset with every earlier offset handled
+	committed   int64 // highest offset already committed
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track registers a fetched message as in flight
+func (t *offsetTracker) track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		p = &partitionOffsets{
+			topic:       m.Topic,
+			done:        make(map[int64]int),
+			committable: -1,
+			committed:   -1,
+		}
+		t.partitions[m.Partition] = p
+	}
+	p.inflight = append(p.inflight, m.Offset)
+}
+
+// markDone records a message as handled and advances the committable offset
+// past every contiguous handled message, returning how many messages it
+// advanced past. A message tracked twice, as a duplicate delivery, must be
+// marked done twice.
+func (t *offsetTracker) markDone(m kafka.Message) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		return 0
+	}
+	p.done[m.Offset]++
+
+	advanced := 0
+	for len(p.inflight) > 0 && p.done[p.inflight[0]] > 0 {
+		offset := p.inflight[0]
+		p.committable = offset
+		if p.done[offset]--; p.done[offset] == 0 {
+			delete(p.done, offset)
+		}
+		p.inflight = p.inflight[1:]
+		advanced++
+	}
+	return advanced
+}
+
+// pendingCommits returns one message per partition whose committable offset
+// has advanced past the last successful commit
+func (t *offsetTracker) pendingCommits() []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var msgs []kafka.Message
+	for partition, p := range t.partitions {
+		if p.committable > p.committed {
+			msgs = append(msgs, kafka.Message{
+				Topic:     p.topic,
+				Partition: partition,
+				Offset:    p.committable,
+			})
+		}
+	}
+	return msgs
+}
+
+// markCommitted records offsets that were successfully committed
+func (t *offsetTracker) markCommitted(msgs []kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range msgs {
+		if p, ok := t.partitions[m.Partition]; ok && m.Offset > p.committed {
+			p.committed = m.Offset
+		}
+	}
+}
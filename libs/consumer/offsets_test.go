@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func message(partition int, offset int64) kafka.Message {
+	return kafka.Message{Topic: "test", Partition: partition, Offset: offset}
+}
+
+// pending returns the offset pending commit on each partition
+func pending(t *offsetTracker) map[int]int64 {
+	offsets := make(map[int]int64)
+	for _, m := range t.pendingCommits() {
+		offsets[m.Partition] = m.Offset
+	}
+	return offsets
+}
+
+func TestOffsetTrackerCommitsOnlyContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	for offset := int64(10); offset < 15; offset++ {
+		tracker.track(message(0, offset))
+	}
+
+	tracker.markDone(message(0, 11))
+	tracker.markDone(message(0, 12))
+	if got := pending(tracker); len(got) != 0 {
+		t.Fatalf("pending %v with offset 10 in flight, want none", got)
+	}
+
+	if n := tracker.markDone(message(0, 10)); n != 3 {
+		t.Errorf("advanced past %d messages, want 3", n)
+	}
+	if got := pending(tracker)[0]; got != 12 {
+		t.Fatalf("pending offset %d, want 12", got)
+	}
+
+	tracker.markCommitted(tracker.pendingCommits())
+	if got := pending(tracker); len(got) != 0 {
+		t.Fatalf("pending %v once committed, want none", got)
+	}
+
+	tracker.markDone(message(0, 14))
+	tracker.markDone(message(0, 13))
+	if got := pending(tracker)[0]; got != 14 {
+		t.Errorf("pending offset %d, want 14", got)
+	}
+}
+
+func TestOffsetTrackerKeepsPartitionsApart(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(message(0, 5))
+	tracker.track(message(1, 7))
+	tracker.track(message(1, 8))
+
+	tracker.markDone(message(1, 7))
+	got := pending(tracker)
+	if _, ok := got[0]; ok {
+		t.Errorf("partition 0 pending with offset 5 in flight")
+	}
+	if got[1] != 7 {
+		t.Errorf("partition 1 pending offset %d, want 7", got[1])
+	}
+}
+
+func TestOffsetTrackerWaitsForEveryDuplicate(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(message(0, 3))
+	tracker.track(message(0, 3))
+	tracker.track(message(0, 4))
+
+	tracker.markDone(message(0, 3))
+	tracker.markDone(message(0, 4))
+	if got := pending(tracker)[0]; got != 3 {
+		t.Fatalf("pending offset %d with a duplicate of 3 in flight, want 3", got)
+	}
+
+	tracker.markDone(message(0, 3))
+	if got := pending(tracker)[0]; got != 4 {
+		t.Errorf("pending offset %d, want 4", got)
+	}
+}
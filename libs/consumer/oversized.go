@@ -0,0 +1,209 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// probeTimeout bounds one probe for oversized messages
+const probeTimeout = 10 * time.Second
+
+// skippedMessage is the dead letter stub of a message too large to fetch
+type skippedMessage struct {
+	Reason    string `json:"reason"`
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Size      int    `json:"size,omitempty"` // zero when unknown
+	MaxBytes  int    `json:"max_bytes"`
+}
+
+// prober looks for partitions stuck at a message too large to fetch
+type prober interface {
+	// committed returns the committed offset of each partition of the topic
+	// the group committed on
+	committed(ctx context.Context) (map[int]int64, error)
+	// oversized reports whether the message at offset of partition is
+	// larger than MaxBytes, returning the stub describing it
+	oversized(ctx context.Context, partition int, offset int64) (skippedMessage, bool)
+}
+
+// skipOversized probes the partitions of the topic for one whose committed
+// offset holds a message larger than MaxBytes. A partition stuck at the same
+// such offset on two probes in a row is skipped past: a stub describing the
+// message is dead-lettered, the offset committed and the reader restarted to
+// resume from it. Probes run at most every half StallTimeout, and fail
+// quietly; they are retried on the next stall.
+func (c *Consumer) skipOversized(ctx context.Context) {
+	if c.prober == nil || time.Since(c.lastProbe) < c.cfg.StallTimeout/2 {
+		return
+	}
+	c.lastProbe = time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	committed, err := c.prober.committed(ctx)
+	if err != nil {
+		c.logger.Warn("failed to probe for oversized messages", "error", err)
+		return
+	}
+
+	stalled := make(map[int]int64)
+	skipped := false
+	for partition, offset := range committed {
+		if offset < 0 {
+			continue
+		}
+		stub, oversized := c.prober.oversized(ctx, partition, offset)
+		if !oversized {
+			continue
+		}
+		if last, ok := c.stalled[partition]; !ok || last != offset {
+			// Give the reader one more stall to get past it
+			stalled[partition] = offset
+			continue
+		}
+		if err := c.skip(ctx, stub); err != nil {
+			c.logger.Error("failed to skip oversized message",
+				"partition", stub.Partition, "offset", stub.Offset, "error", err)
+			stalled[partition] = offset
+			continue
+		}
+		skipped = true
+	}
+	c.stalled = stalled
+
+	if skipped {
+		c.restartReader()
+	}
+}
+
+// brokerProber probes the brokers of a consumer
+type brokerProber struct {
+	c      *Consumer
+	client *kafka.Client
+}
+
+func (b *brokerProber) committed(ctx context.Context) (map[int]int64, error) {
+	resp, err := b.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: b.c.cfg.GroupID,
+		Topics:  nil, // every partition the group committed on
+	})
+	if err == nil {
+		err = resp.Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	committed := make(map[int]int64)
+	for _, p := range resp.Topics[b.c.cfg.Topic] {
+		if p.Error == nil {
+			committed[p.Partition] = p.CommittedOffset
+		}
+	}
+	return committed, nil
+}
+
+// oversized fetches the message at offset and reports whether it is larger
+// than MaxBytes
+func (b *brokerProber) oversized(ctx context.Context, partition int, offset int64) (skippedMessage, bool) {
+	c := b.c
+	stub := skippedMessage{
+		Reason:    "message too large",
+		Topic:     c.cfg.Topic,
+		Partition: partition,
+		Offset:    offset,
+		MaxBytes:  c.cfg.MaxBytes,
+	}
+
+	resp, err := b.client.Fetch(ctx, &kafka.FetchRequest{
+		Topic:     c.cfg.Topic,
+		Partition: partition,
+		Offset:    offset,
+		MinBytes:  1,
+		MaxBytes:  int64(c.cfg.MaxBytes),
+		MaxWait:   time.Second,
+	})
+	if err != nil {
+		return stub, false
+	}
+	if resp.Error != nil {
+		return stub, errors.Is(resp.Error, kafka.MessageSizeTooLarge)
+	}
+	if offset >= resp.HighWatermark {
+		return stub, false // caught up
+	}
+
+	record, err := resp.Records.ReadRecord()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// Behind the high watermark with nothing returned: the message at
+		// offset did not fit
+		return stub, true
+	}
+	if err != nil || record.Offset != offset {
+		return stub, false
+	}
+	if record.Key != nil {
+		stub.Size += record.Key.Len()
+	}
+	if record.Value != nil {
+		stub.Size += record.Value.Len()
+	}
+	return stub, stub.Size > c.cfg.MaxBytes
+}
+
+// skip dead-letters the stub of an oversized message, when there is a dead
+// letter topic, and commits its offset
+func (c *Consumer) skip(ctx context.Context, stub skippedMessage) error {
+	c.logger.Error("skipping oversized message", "partition", stub.Partition, "offset", stub.Offset,
+		"size", stub.Size, "max_bytes", stub.MaxBytes)
+
+	m := kafka.Message{Topic: stub.Topic, Partition: stub.Partition, Offset: stub.Offset}
+	if c.deadLetter != nil {
+		value, err := json.Marshal(stub)
+		if err != nil {
+			return fmt.Errorf("failed to encode stub: %w", err)
+		}
+		cause := fmt.Errorf("%s, the limit is %d bytes", stub.Reason, stub.MaxBytes)
+		if err := c.publishDeadLetter(ctx, kafka.Message{
+			Topic:     stub.Topic,
+			Partition: stub.Partition,
+			Offset:    stub.Offset,
+			Value:     value,
+			Headers:   []kafka.Header{{Key: "dlq_stub", Value: []byte("true")}},
+		}, cause); err != nil {
+			c.metrics.RecordError(StageDeadLetter)
+			return err
+		}
+		c.metrics.RecordDeadLettered()
+	}
+
+	if err := c.current().CommitMessages(ctx, m); err != nil {
+		c.metrics.RecordError(StageCommit)
+		return fmt.Errorf("failed to commit past offset %d: %w", stub.Offset, err)
+	}
+	c.metrics.RecordOversized()
+	return nil
+}
+
+// restartReader replaces the reader, so partitions resume from their
+// committed offsets
+func (c *Consumer) restartReader() {
+	c.readerMu.Lock()
+	old := c.reader
+	c.reader = c.newReader()
+	c.readerMu.Unlock()
+
+	if err := old.Close(); err != nil {
+		c.logger.Warn("failed to close reader", "error", err)
+	}
+	c.logger.Info("reader restarted after skipping oversized messages")
+}
@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeProber probes a fakeTopic as brokerProber probes the brokers
+type fakeProber struct {
+	topic *fakeTopic
+}
+
+func (p fakeProber) committed(context.Context) (map[int]int64, error) {
+	// Kafka commits the offset of the next message to read
+	return map[int]int64{0: p.topic.lastCommitted() + 1}, nil
+}
+
+func (p fakeProber) oversized(_ context.Context, partition int, offset int64) (skippedMessage, bool) {
+	t := p.topic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stub := skippedMessage{Reason: "message too large", Topic: "test", Partition: partition, Offset: offset, MaxBytes: t.maxBytes}
+	if offset >= int64(len(t.messages)) {
+		return stub, false
+	}
+	m := t.messages[offset]
+	stub.Size = len(m.Key) + len(m.Value)
+	return stub, stub.Size > t.maxBytes
+}
+
+func TestOversizedMessageIsSkipped(t *testing.T) {
+	topic := newFakeTopic()
+	topic.maxBytes = 64
+	topic.produce("acct-1", "acct-2", "acct-3")
+	topic.produceValue("acct-4", bytes.Repeat([]byte("x"), 200))
+	topic.produce("acct-5", "acct-6", "acct-7")
+
+	done := newHandled()
+	metrics := newFakeMetrics()
+	deadLetters := &fakeWriter{}
+	cfg := testConfig(2)
+	cfg.Metrics = metrics
+	cfg.MaxBytes = topic.maxBytes
+	cfg.StallTimeout = 20 * time.Millisecond
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		done.add(m)
+		return nil
+	}), topic.open)
+	c.deadLetter = deadLetters
+	c.prober = fakeProber{topic: topic}
+	start(t, c)
+
+	waitFor(t, "the messages past the oversized one", func() bool { return done.count() == 6 })
+	waitFor(t, "the commit of every message", func() bool { return topic.lastCommitted() == 6 })
+
+	written := deadLetters.written()
+	if len(written) != 1 {
+		t.Fatalf("%d dead letters, want the stub only", len(written))
+	}
+	if got := header(written[0], "dlq_stub"); got != "true" {
+		t.Errorf("dlq_stub header = %q, want true", got)
+	}
+	var stub skippedMessage
+	if err := json.Unmarshal(written[0].Value, &stub); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if stub.Offset != 3 || stub.Size != 206 || stub.MaxBytes != 64 {
+		t.Errorf("stub = %+v, want offset 3 of 206 bytes over 64", stub)
+	}
+
+	metrics.mu.Lock()
+	oversized, deadLettered := metrics.oversized, metrics.deadLettered
+	metrics.mu.Unlock()
+	if oversized != 1 || deadLettered != 1 {
+		t.Errorf("oversized %d, dead-lettered %d, want 1 each", oversized, deadLettered)
+	}
+
+	topic.mu.Lock()
+	opened := topic.opened
+	topic.mu.Unlock()
+	if opened < 2 {
+		t.Errorf("reader opened %d times, want it restarted past the skipped offset", opened)
+	}
+}
+
+func TestOversizedMessageIsGivenOneMoreStall(t *testing.T) {
+	topic := newFakeTopic()
+	topic.maxBytes = 64
+	topic.produceValue("acct-1", bytes.Repeat([]byte("x"), 200))
+
+	deadLetters := &fakeWriter{}
+	cfg := testConfig(1)
+	cfg.MaxBytes = topic.maxBytes
+	cfg.StallTimeout = time.Hour
+	c := newConsumer(cfg, HandlerFunc(func(context.Context, kafka.Message) error { return nil }), topic.open)
+	c.deadLetter = deadLetters
+	c.prober = fakeProber{topic: topic}
+
+	// The first probe only notes the stalled partition
+	c.skipOversized(context.Background())
+	if n := len(deadLetters.written()); n != 0 || topic.lastCommitted() != -1 {
+		t.Fatalf("skipped on the first probe: %d dead letters, committed %d", n, topic.lastCommitted())
+	}
+
+	c.lastProbe = time.Time{}
+	c.skipOversized(context.Background())
+	if n := len(deadLetters.written()); n != 1 {
+		t.Errorf("%d dead letters after the second probe, want the stub", n)
+	}
+	if committed := topic.lastCommitted(); committed != 0 {
+		t.Errorf("committed offset %d, want 0", committed)
+	}
+}
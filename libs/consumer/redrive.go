@@ -0,0 +1,217 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RedriveCountHeader counts how many times a message has been re-driven
+// from the dead letter topic
+const RedriveCountHeader = "redrive_count"
+
+// defaultRedriveIdle is how long a re-drive waits for the next
+// dead-lettered message before concluding the topic is drained
+const defaultRedriveIdle = 10 * time.Second
+
+// Re-drive errors
+var (
+	ErrNoDeadLetterTopic = errors.New("consumer has no dead letter topic")
+	ErrRedriveRunning    = errors.New("a re-drive is already running")
+	ErrInvalidRedrive    = errors.New("invalid re-drive request")
+)
+
+// RedriveRequest selects the dead-lettered messages to re-drive. Zero filter
+// fields match every message.
+type RedriveRequest struct {
+	MaxMessages int     `json:"max_messages"` // default 100
+	Rate        float64 `json:"rate"`         // messages per second, default 10
+
+	// Error matches a substring of the dead letter error, Account the
+	// message key, and From and To the time the message was dead-lettered
+	Error   string    `json:"error"`
+	Account string    `json:"account"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+
+	// TargetTopic overrides the topic the message was dead-lettered from
+	TargetTopic string `json:"target_topic"`
+
+	// DryRun lists the messages that would be re-driven without
+	// republishing them or moving the re-drive group on
+	DryRun bool `json:"dry_run"`
+}
+
+// RedriveSummary is the outcome of a re-drive. In a dry run Redriven counts
+// the messages that would have been re-driven, listed in Messages.
+type RedriveSummary struct {
+	Redriven int               `json:"redriven"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+	DryRun   bool              `json:"dry_run"`
+	Messages []RedrivenMessage `json:"messages,omitempty"`
+}
+
+// RedrivenMessage describes a message re-driven in a dry run
+type RedrivenMessage struct {
+	Partition    int       `json:"partition"`
+	Offset       int64     `json:"offset"`
+	Key          string    `json:"key"`
+	Error        string    `json:"error"`
+	TargetTopic  string    `json:"target_topic"`
+	RedriveCount int       `json:"redrive_count"`
+	DeadLettered time.Time `json:"dead_lettered_at"`
+}
+
+// validate applies the defaults of req and checks it
+func (req *RedriveRequest) validate() error {
+	if req.MaxMessages == 0 {
+		req.MaxMessages = 100
+	}
+	if req.Rate == 0 {
+		req.Rate = 10
+	}
+	switch {
+	case req.MaxMessages < 0:
+		return fmt.Errorf("%w: max_messages must be positive", ErrInvalidRedrive)
+	case req.Rate < 0:
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidRedrive)
+	case !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From):
+		return fmt.Errorf("%w: to must not be before from", ErrInvalidRedrive)
+	}
+	return nil
+}
+
+// target returns the topic m is re-driven to, or "" when it is to be
+// skipped: it does not match the filter, is the stub of an oversized
+// message, has been re-driven maxRedrives times or has no topic to go to
+func (req *RedriveRequest) target(m kafka.Message, maxRedrives int) string {
+	if header(m, "dlq_stub") != "" || redriveCount(m) >= maxRedrives {
+		return ""
+	}
+	if req.Error != "" && !strings.Contains(header(m, "dlq_error"), req.Error) {
+		return ""
+	}
+	if req.Account != "" && string(m.Key) != req.Account {
+		return ""
+	}
+	if (!req.From.IsZero() && m.Time.Before(req.From)) || (!req.To.IsZero() && !m.Time.Before(req.To)) {
+		return ""
+	}
+	if req.TargetTopic != "" {
+		return req.TargetTopic
+	}
+	return header(m, "dlq_source_topic")
+}
+
+// Redrive republishes dead-lettered messages matching req to the topic they
+// came from, at most req.Rate a second, until req.MaxMessages have been
+// re-driven or the dead letter topic is drained. The topic is read by a
+// dedicated group, whose offsets mark how far re-drives have got: skipped
+// messages are passed over for good, and stay on the dead letter topic only
+// until its retention expires. Each republished message has its redrive
+// count incremented and is skipped by later re-drives once it reaches
+// MaxRedrives. A failed republish ends the re-drive, leaving the message to
+// the next one. One re-drive runs at a time.
+func (c *Consumer) Redrive(ctx context.Context, req RedriveRequest) (*RedriveSummary, error) {
+	if c.deadLetter == nil {
+		return nil, ErrNoDeadLetterTopic
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if !c.redriving.CompareAndSwap(false, true) {
+		return nil, ErrRedriveRunning
+	}
+	defer c.redriving.Store(false)
+
+	reader := c.openRedrive(kafka.ReaderConfig{
+		Brokers:     c.readerCfg.Brokers,
+		GroupID:     c.cfg.GroupID + "-redrive",
+		Topic:       c.cfg.DeadLetterTopic,
+		Dialer:      c.dialer,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    1,
+		MaxBytes:    c.cfg.MaxBytes,
+	})
+	defer reader.Close()
+	writer := c.newRedriveWriter()
+	defer writer.Close()
+
+	logger := c.logger.With("dead_letter_topic", c.cfg.DeadLetterTopic, "dry_run", req.DryRun)
+	summary := &RedriveSummary{DryRun: req.DryRun}
+	interval := time.Duration(float64(time.Second) / req.Rate)
+	var next time.Time
+	for summary.Redriven < req.MaxMessages {
+		fetchCtx, cancel := context.WithTimeout(ctx, c.redriveIdle)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				break // drained
+			}
+			return summary, fmt.Errorf("failed to read dead letter topic: %w", err)
+		}
+
+		target := req.target(m, c.cfg.MaxRedrives)
+		switch {
+		case target == "":
+			summary.Skipped++
+		case req.DryRun:
+			summary.Redriven++
+			summary.Messages = append(summary.Messages, RedrivenMessage{
+				Partition:    m.Partition,
+				Offset:       m.Offset,
+				Key:          string(m.Key),
+				Error:        header(m, "dlq_error"),
+				TargetTopic:  target,
+				RedriveCount: redriveCount(m),
+				DeadLettered: m.Time,
+			})
+			continue
+		default:
+			if err := sleep(ctx, ctx, time.Until(next)); err != nil {
+				return summary, err
+			}
+			next = time.Now().Add(interval)
+			if err := writer.WriteMessages(ctx, redriven(m, target)); err != nil {
+				summary.Failed++
+				return summary, fmt.Errorf("failed to re-drive message at partition %d offset %d: %w", m.Partition, m.Offset, err)
+			}
+			summary.Redriven++
+		}
+
+		if !req.DryRun {
+			if err := reader.CommitMessages(ctx, m); err != nil {
+				return summary, fmt.Errorf("failed to commit re-drive offset: %w", err)
+			}
+		}
+	}
+
+	logger.Info("re-drive finished", "redriven", summary.Redriven, "skipped", summary.Skipped)
+	return summary, nil
+}
+
+// redriven returns m as republished to topic: without the headers added
+// when it was dead-lettered, and its redrive count incremented
+func redriven(m kafka.Message, topic string) kafka.Message {
+	headers := make([]kafka.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, "dlq_") && h.Key != RedriveCountHeader {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers, kafka.Header{Key: RedriveCountHeader, Value: []byte(strconv.Itoa(redriveCount(m) + 1))})
+	return kafka.Message{Topic: topic, Key: m.Key, Value: m.Value, Headers: headers}
+}
+
+// redriveCount returns how many times m has been re-driven
+func redriveCount(m kafka.Message) int {
+	n, _ := strconv.Atoi(header(m, RedriveCountHeader))
+	return n
+}
@@ -0,0 +1,295 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// deadLettered is when the messages of the seeded dead letter topics were
+// dead-lettered
+var deadLettered = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+// deadLetter appends a message dead-lettered from transactions at at, after
+// redrives earlier re-drives, with the error cause
+func deadLetter(t *fakeTopic, key, cause string, at time.Time, redrives int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	offset := int64(len(t.messages))
+	headers := []kafka.Header{
+		{Key: "trace_id", Value: []byte("trace-" + key)},
+		{Key: "dlq_error", Value: []byte(cause)},
+		{Key: "dlq_source_topic", Value: []byte("transactions")},
+		{Key: "dlq_source_partition", Value: []byte("0")},
+		{Key: "dlq_source_offset", Value: []byte(strconv.FormatInt(offset, 10))},
+	}
+	if redrives > 0 {
+		headers = append(headers, kafka.Header{Key: RedriveCountHeader, Value: []byte(strconv.Itoa(redrives))})
+	}
+	t.messages = append(t.messages, kafka.Message{
+		Topic:   "transactions.dlq",
+		Key:     []byte(key),
+		Value:   []byte(key + "-value"),
+		Offset:  offset,
+		Time:    at,
+		Headers: headers,
+	})
+}
+
+// seededDeadLetters returns a dead letter topic of five messages, one an
+// hour, the second the stub of an oversized message and the fourth at its
+// re-drive cap
+func seededDeadLetters() *fakeTopic {
+	dlq := newFakeTopic()
+	deadLetter(dlq, "acct-1", "invalid amount", deadLettered, 0)
+	deadLetter(dlq, "acct-2", "message too large", deadLettered.Add(time.Hour), 0)
+	dlq.messages[1].Headers = append(dlq.messages[1].Headers, kafka.Header{Key: "dlq_stub", Value: []byte("true")})
+	deadLetter(dlq, "acct-1", "storage unavailable", deadLettered.Add(2*time.Hour), 1)
+	deadLetter(dlq, "acct-3", "storage unavailable", deadLettered.Add(3*time.Hour), 3)
+	deadLetter(dlq, "acct-2", "invalid amount", deadLettered.Add(4*time.Hour), 2)
+	return dlq
+}
+
+// newRedriveConsumer returns a consumer re-driving dlq through writer
+func newRedriveConsumer(dlq *fakeTopic, writer messageWriter) *Consumer {
+	cfg := testConfig(1)
+	cfg.DeadLetterTopic = "transactions.dlq"
+	c := newConsumer(cfg, HandlerFunc(func(ctx context.Context, m kafka.Message) error { return nil }), newFakeTopic().open)
+	c.deadLetter = &fakeWriter{}
+	c.openRedrive = dlq.open
+	c.newRedriveWriter = func() messageWriter { return writer }
+	c.redriveIdle = 20 * time.Millisecond
+	return c
+}
+
+func TestRedriveFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RedriveRequest
+		offsets []int64
+		skipped int
+	}{
+		// The stub and the message at its cap are never re-driven
+		{"everything", RedriveRequest{}, []int64{0, 2, 4}, 2},
+		{"error type", RedriveRequest{Error: "invalid amount"}, []int64{0, 4}, 3},
+		{"account", RedriveRequest{Account: "acct-1"}, []int64{0, 2}, 3},
+		{"time range", RedriveRequest{From: deadLettered.Add(time.Hour), To: deadLettered.Add(4 * time.Hour)}, []int64{2}, 4},
+		{"from", RedriveRequest{From: deadLettered.Add(2 * time.Hour)}, []int64{2, 4}, 3},
+		{"every filter", RedriveRequest{Error: "storage", Account: "acct-1", To: deadLettered.Add(3 * time.Hour)}, []int64{2}, 4},
+		{"no match", RedriveRequest{Account: "acct-9"}, nil, 5},
+		{"max messages", RedriveRequest{MaxMessages: 2}, []int64{0, 2}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{}
+			c := newRedriveConsumer(seededDeadLetters(), writer)
+			tt.req.DryRun = true
+			summary, err := c.Redrive(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Redrive: %v", err)
+			}
+
+			var offsets []int64
+			for _, m := range summary.Messages {
+				offsets = append(offsets, m.Offset)
+			}
+			if !slices.Equal(offsets, tt.offsets) || summary.Redriven != len(tt.offsets) || summary.Skipped != tt.skipped {
+				t.Errorf("dry run listed %v, %d skipped, want %v and %d", offsets, summary.Skipped, tt.offsets, tt.skipped)
+			}
+			if !summary.DryRun || len(writer.written()) != 0 {
+				t.Errorf("dry run republished %d messages", len(writer.written()))
+			}
+		})
+	}
+}
+
+func TestRedriveRepublishesToTheSourceTopic(t *testing.T) {
+	dlq := seededDeadLetters()
+	writer := &fakeWriter{}
+	c := newRedriveConsumer(dlq, writer)
+
+	dryRun, err := c.Redrive(context.Background(), RedriveRequest{DryRun: true, Account: "acct-1"})
+	if err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	listed := dryRun.Messages[1]
+	if listed.Key != "acct-1" || listed.Error != "storage unavailable" || listed.TargetTopic != "transactions" ||
+		listed.RedriveCount != 1 || !listed.DeadLettered.Equal(deadLettered.Add(2*time.Hour)) {
+		t.Errorf("dry run listed %+v", listed)
+	}
+	if dlq.lastCommitted() != -1 {
+		t.Fatal("dry run moved the re-drive group on")
+	}
+
+	summary, err := c.Redrive(context.Background(), RedriveRequest{})
+	if err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	if summary.Redriven != 3 || summary.Skipped != 2 || summary.Failed != 0 || summary.DryRun || summary.Messages != nil {
+		t.Errorf("summary %+v, want 3 re-driven and 2 skipped", summary)
+	}
+
+	written := writer.written()
+	wantCounts := []string{"1", "2", "3"}
+	for i, m := range written {
+		if m.Topic != "transactions" || header(m, RedriveCountHeader) != wantCounts[i] || header(m, "trace_id") == "" {
+			t.Errorf("message %d republished to %s with count %q, want transactions with %s",
+				i, m.Topic, header(m, RedriveCountHeader), wantCounts[i])
+		}
+		for _, h := range m.Headers {
+			if strings.HasPrefix(h.Key, "dlq_") {
+				t.Errorf("message %d republished with %s", i, h.Key)
+			}
+		}
+	}
+
+	// The re-drive group has moved past every message, skipped ones too
+	if got := dlq.lastCommitted(); got != 4 {
+		t.Errorf("re-drive group committed %d, want 4", got)
+	}
+	if summary, err := c.Redrive(context.Background(), RedriveRequest{}); err != nil || summary.Redriven+summary.Skipped != 0 {
+		t.Errorf("second re-drive = %+v, %v, want nothing left", summary, err)
+	}
+}
+
+func TestRedriveTargetTopicOverride(t *testing.T) {
+	writer := &fakeWriter{}
+	c := newRedriveConsumer(seededDeadLetters(), writer)
+	if _, err := c.Redrive(context.Background(), RedriveRequest{TargetTopic: "transactions.retry", MaxMessages: 1}); err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	if written := writer.written(); len(written) != 1 || written[0].Topic != "transactions.retry" {
+		t.Errorf("republished %+v, want one message to transactions.retry", written)
+	}
+}
+
+func TestRedriveIsRateLimited(t *testing.T) {
+	dlq := newFakeTopic()
+	for i := range 6 {
+		deadLetter(dlq, "acct-"+strconv.Itoa(i), "invalid amount", deadLettered, 0)
+	}
+	c := newRedriveConsumer(dlq, &fakeWriter{})
+
+	started := time.Now()
+	summary, err := c.Redrive(context.Background(), RedriveRequest{Rate: 50})
+	if err != nil || summary.Redriven != 6 {
+		t.Fatalf("Redrive = %+v, %v, want 6 re-driven", summary, err)
+	}
+	// Six messages at 50 a second are 20ms apart
+	if took := time.Since(started); took < 100*time.Millisecond {
+		t.Errorf("re-drove 6 messages in %s, want at least 100ms at 50 a second", took)
+	}
+}
+
+func TestRedriveCountCapsPoisonMessages(t *testing.T) {
+	dlq := newFakeTopic()
+	deadLetter(dlq, "acct-1", "invalid amount", deadLettered, 0)
+	writer := &fakeWriter{}
+	c := newRedriveConsumer(dlq, writer)
+
+	// The message fails again each time it is re-driven, and is
+	// dead-lettered with the count it was republished with
+	for round := 1; ; round++ {
+		summary, err := c.Redrive(context.Background(), RedriveRequest{})
+		if err != nil {
+			t.Fatalf("Redrive: %v", err)
+		}
+		if summary.Redriven == 0 {
+			if round != 4 || summary.Skipped != 1 {
+				t.Errorf("capped at round %d with %+v, want the message skipped at round 4", round, summary)
+			}
+			break
+		}
+		if round > 4 {
+			t.Fatal("message re-driven past MaxRedrives")
+		}
+		written := writer.written()
+		count, _ := strconv.Atoi(header(written[len(written)-1], RedriveCountHeader))
+		deadLetter(dlq, "acct-1", "invalid amount", deadLettered, count)
+	}
+	if n := len(writer.written()); n != 3 {
+		t.Errorf("republished %d times, want the default cap of 3", n)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{ err error }
+
+func (w failingWriter) WriteMessages(context.Context, ...kafka.Message) error { return w.err }
+func (w failingWriter) Close() error                                          { return nil }
+
+func TestRedriveStopsAtAFailedRepublish(t *testing.T) {
+	dlq := seededDeadLetters()
+	errKafka := errors.New("kafka: leader not available")
+	c := newRedriveConsumer(dlq, failingWriter{errKafka})
+
+	summary, err := c.Redrive(context.Background(), RedriveRequest{})
+	if !errors.Is(err, errKafka) {
+		t.Fatalf("Redrive = %v, want %v", err, errKafka)
+	}
+	if summary.Failed != 1 || summary.Redriven != 0 {
+		t.Errorf("summary %+v, want the one failure", summary)
+	}
+	// The message is left to the next re-drive
+	if got := dlq.lastCommitted(); got != -1 {
+		t.Errorf("re-drive group committed %d past the failed message", got)
+	}
+}
+
+func TestAdminHandlerRedrives(t *testing.T) {
+	redrive := func(c *Consumer, body string) (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/admin/dlq/redrive", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+testAdminToken)
+		w := httptest.NewRecorder()
+		AdminHandler(c, testAdminToken).ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	c := newRedriveConsumer(seededDeadLetters(), &fakeWriter{})
+	status, body := redrive(c, `{"account":"acct-1","dry_run":true}`)
+	var summary RedriveSummary
+	if err := json.Unmarshal([]byte(body), &summary); err != nil || status != http.StatusOK {
+		t.Fatalf("re-drive = %d %s", status, body)
+	}
+	if summary.Redriven != 2 || !summary.DryRun || len(summary.Messages) != 2 {
+		t.Errorf("summary %+v, want 2 listed", summary)
+	}
+	if status, _ := redrive(c, ""); status != http.StatusOK {
+		t.Errorf("re-drive without a body = %d, want 200 with the defaults", status)
+	}
+
+	tests := []struct {
+		name   string
+		c      *Consumer
+		body   string
+		status int
+	}{
+		{"malformed body", c, `{"max_messages":`, http.StatusBadRequest},
+		{"negative max messages", c, `{"max_messages":-1}`, http.StatusBadRequest},
+		{"negative rate", c, `{"rate":-5}`, http.StatusBadRequest},
+		{"inverted time range", c, `{"from":"2026-03-02T12:00:00Z","to":"2026-03-01T12:00:00Z"}`, http.StatusBadRequest},
+		{"no dead letter topic", newConsumer(testConfig(1), nil, newFakeTopic().open), `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := redrive(tt.c, tt.body); status != tt.status {
+				t.Errorf("status %d %s, want %d", status, body, tt.status)
+			}
+		})
+	}
+
+	c.redriving.Store(true)
+	if status, _ := redrive(c, `{}`); status != http.StatusConflict {
+		t.Errorf("concurrent re-drive = %d, want 409", status)
+	}
+}
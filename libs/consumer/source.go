@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers naming the consumed message a published message was produced
+// from. Consumers of the published messages can drop one published twice,
+// such as after a crash between publishing and committing, by its source.
+const (
+	SourceTopicHeader     = "source_topic"
+	SourcePartitionHeader = "source_partition"
+	SourceOffsetHeader    = "source_offset"
+)
+
+// Source is the position of a consumed message
+type Source struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+type sourceContextKey struct{}
+
+// withSource records the message being handled in ctx
+func withSource(ctx context.Context, m kafka.Message) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, Source{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset})
+}
+
+// SourceFromContext returns the position of the message a handler was given
+// ctx for
+func SourceFromContext(ctx context.Context) (Source, bool) {
+	source, ok := ctx.Value(sourceContextKey{}).(Source)
+	return source, ok
+}
+
+// Headers returns the headers naming the source
+func (s Source) Headers() []kafka.Header {
+	return []kafka.Header{
+		{Key: SourceTopicHeader, Value: []byte(s.Topic)},
+		{Key: SourcePartitionHeader, Value: []byte(strconv.Itoa(s.Partition))},
+		{Key: SourceOffsetHeader, Value: []byte(strconv.FormatInt(s.Offset, 10))},
+	}
+}
+
+// SourceOf returns the source named by the headers of a published message,
+// or false when they name none
+func SourceOf(headers []kafka.Header) (Source, bool) {
+	var source Source
+	var partition, offset string
+	for _, h := range headers {
+		switch h.Key {
+		case SourceTopicHeader:
+			source.Topic = string(h.Value)
+		case SourcePartitionHeader:
+			partition = string(h.Value)
+		case SourceOffsetHeader:
+			offset = string(h.Value)
+		}
+	}
+
+	var err error
+	if source.Partition, err = strconv.Atoi(partition); err != nil || source.Topic == "" {
+		return Source{}, false
+	}
+	if source.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+		return Source{}, false
+	}
+	return source, true
+}
@@ -0,0 +1,79 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestSourceHeadersRoundTrip(t *testing.T) {
+	source := Source{Topic: "transactions.raw", Partition: 3, Offset: 1234567890123}
+	headers := append([]kafka.Header{{Key: "correlation_id", Value: []byte("corr-1")}}, source.Headers()...)
+
+	got, ok := SourceOf(headers)
+	if !ok || got != source {
+		t.Errorf("SourceOf = %+v, %v, want %+v", got, ok, source)
+	}
+}
+
+func TestSourceOfIncompleteHeaders(t *testing.T) {
+	header := func(key, value string) kafka.Header {
+		return kafka.Header{Key: key, Value: []byte(value)}
+	}
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+	}{
+		{"none", nil},
+		{"no topic", []kafka.Header{header(SourcePartitionHeader, "0"), header(SourceOffsetHeader, "7")}},
+		{"no partition", []kafka.Header{header(SourceTopicHeader, "raw"), header(SourceOffsetHeader, "7")}},
+		{"no offset", []kafka.Header{header(SourceTopicHeader, "raw"), header(SourcePartitionHeader, "0")}},
+		{"malformed partition", []kafka.Header{header(SourceTopicHeader, "raw"), header(SourcePartitionHeader, "zero"), header(SourceOffsetHeader, "7")}},
+		{"malformed offset", []kafka.Header{header(SourceTopicHeader, "raw"), header(SourcePartitionHeader, "0"), header(SourceOffsetHeader, "7.5")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := SourceOf(tt.headers); ok {
+				t.Errorf("SourceOf = %+v, want no source", got)
+			}
+		})
+	}
+}
+
+func TestHandlersAreGivenTheirSource(t *testing.T) {
+	topic := newFakeTopic()
+	topic.produce(distinctKeys(3, 3)...)
+
+	var mu sync.Mutex
+	sources := make(map[int64]Source)
+	c := newConsumer(testConfig(3), HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		source, ok := SourceFromContext(ctx)
+		if !ok {
+			t.Errorf("no source for offset %d", m.Offset)
+		}
+		mu.Lock()
+		sources[m.Offset] = source
+		mu.Unlock()
+		return nil
+	}), topic.open)
+	start(t, c)
+
+	waitFor(t, "the messages to be handled", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sources) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for offset, source := range sources {
+		if want := (Source{Topic: "test", Offset: offset}); source != want {
+			t.Errorf("offset %d handled with source %+v, want %+v", offset, source, want)
+		}
+	}
+
+	if _, ok := SourceFromContext(context.Background()); ok {
+		t.Error("source found outside a handler")
+	}
+}
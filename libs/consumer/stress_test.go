@@ -0,0 +1,137 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ledger applies the writes of each account in the order of their offsets,
+// as the storage service applies transactions to an account's rows. A
+// redelivered write is skipped as a duplicate; any other write out of
+// order is recorded as a violation.
+type ledger struct {
+	mu         sync.Mutex
+	pending    map[string][]int64 // offsets of each account not yet applied
+	applied    int
+	duplicates int
+	violations []string
+	seen       map[int64]bool
+}
+
+func newLedger(messages []kafka.Message) *ledger {
+	l := &ledger{pending: make(map[string][]int64), seen: make(map[int64]bool)}
+	for _, m := range messages {
+		l.pending[string(m.Key)] = append(l.pending[string(m.Key)], m.Offset)
+	}
+	return l
+}
+
+func (l *ledger) apply(m kafka.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := string(m.Key)
+	if l.seen[m.Offset] {
+		l.duplicates++
+		return
+	}
+	if pending := l.pending[key]; len(pending) == 0 || pending[0] != m.Offset {
+		l.violations = append(l.violations, fmt.Sprintf("%s: offset %d applied before %v", key, m.Offset, pending[:min(len(pending), 1)]))
+		return
+	}
+	l.pending[key] = l.pending[key][1:]
+	l.seen[m.Offset] = true
+	l.applied++
+}
+
+func (l *ledger) appliedCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.applied
+}
+
+var errTransient = errors.New("transient write failure")
+
+func TestStressKeepsEveryAccountsWritesInOrder(t *testing.T) {
+	const (
+		accounts = 100
+		perKey   = 40
+		total    = accounts * perKey
+	)
+
+	// Interleave the accounts' messages at random, deterministically
+	rng := rand.New(rand.NewSource(1333))
+	keys := make([]string, 0, total)
+	for i := 0; i < accounts; i++ {
+		for j := 0; j < perKey; j++ {
+			keys = append(keys, fmt.Sprintf("acct-%d", i))
+		}
+	}
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	topic := newFakeTopic()
+	topic.produce(keys...)
+	store := newLedger(topic.messages)
+
+	// Writes take varying time and a few fail once, to be retried
+	var mu sync.Mutex
+	failed := make(map[int64]bool)
+	handler := HandlerFunc(func(ctx context.Context, m kafka.Message) error {
+		switch {
+		case m.Offset%97 == 0:
+			mu.Lock()
+			first := !failed[m.Offset]
+			failed[m.Offset] = true
+			mu.Unlock()
+			if first {
+				return errTransient
+			}
+		case m.Offset%13 == 0:
+			time.Sleep(200 * time.Microsecond)
+		}
+		store.apply(m)
+		return nil
+	})
+
+	// Stop the consumer part way, and resume from its commit with another,
+	// redelivering whatever was handled but not yet committed
+	cfg := testConfig(8)
+	cfg.MaxAttempts = 5
+	stop := start(t, newConsumer(cfg, handler, topic.open))
+	waitFor(t, "half the writes", func() bool { return store.appliedCount() >= total/2 })
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Start returned %v, want context.Canceled", err)
+	}
+	start(t, newConsumer(cfg, handler, topic.open))
+
+	deadline := time.Now().Add(30 * time.Second)
+	for topic.lastCommitted() != total-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("committed offset %d of %d after 30s", topic.lastCommitted(), total-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.violations) > 0 {
+		t.Fatalf("%d writes out of order, first: %s", len(store.violations), store.violations[0])
+	}
+	if store.applied != total {
+		t.Errorf("%d of %d writes applied", store.applied, total)
+	}
+	for key, pending := range store.pending {
+		if len(pending) > 0 {
+			t.Errorf("%s: %d writes lost", key, len(pending))
+		}
+	}
+	if topic.opened != 2 {
+		t.Errorf("topic opened %d times, want once per consumer", topic.opened)
+	}
+	t.Logf("%d writes applied, %d redelivered after the restart", store.applied, store.duplicates)
+}
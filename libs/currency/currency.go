@@ -0,0 +1,135 @@
+// Package currency validates transaction currencies and amounts against the
+// ISO 4217 table. The services accept only the currencies in their
+// SUPPORTED_CURRENCIES allowlist, and an amount may not have more decimal
+// places than its currency's minor unit exponent: none for JPY, three for
+// BHD. Amounts are converted between currencies with a Converter, so
+// thresholds set in one base currency apply to transactions in any.
+package currency
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultSupported is the allowlist used when SUPPORTED_CURRENCIES is unset
+const DefaultSupported = "USD,EUR,GBP,INR,CAD,AUD"
+
+// Validation errors, wrapped with the offending currency or amount
+var (
+	ErrUnsupported = errors.New("unsupported currency")
+	ErrPrecision   = errors.New("too many decimal places for currency")
+)
+
+// Currency is an ISO 4217 currency
+type Currency struct {
+	Code string
+	// Exponent is the number of decimal places of the minor unit
+	Exponent int
+	Name     string
+}
+
+//go:embed iso4217.csv
+var table string
+
+// currencies is the ISO 4217 table by code
+var currencies = loadTable()
+
+// loadTable parses the embedded table, which has a header row followed by
+// code, exponent and name
+func loadTable() map[string]Currency {
+	records, err := csv.NewReader(strings.NewReader(table)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("currency: invalid ISO 4217 table: %v", err))
+	}
+
+	byCode := make(map[string]Currency, len(records))
+	for _, record := range records[1:] {
+		exponent, err := strconv.Atoi(record[1])
+		if err != nil {
+			panic(fmt.Sprintf("currency: invalid exponent for %s: %v", record[0], err))
+		}
+		byCode[record[0]] = Currency{Code: record[0], Exponent: exponent, Name: record[2]}
+	}
+	return byCode
+}
+
+// Lookup returns the ISO 4217 currency with the given code
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+// Allowlist is the set of currencies a service accepts
+type Allowlist map[string]Currency
+
+// ParseAllowlist reads a comma-separated list of ISO 4217 codes, failing on
+// codes not in the table or an empty list
+func ParseAllowlist(list string) (Allowlist, error) {
+	allowed := make(Allowlist)
+	var unknown []string
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		c, ok := Lookup(code)
+		if !ok {
+			unknown = append(unknown, code)
+			continue
+		}
+		allowed[code] = c
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown ISO 4217 currency codes: %s", strings.Join(unknown, ", "))
+	}
+	if len(allowed) == 0 {
+		return nil, errors.New("no currencies listed")
+	}
+	return allowed, nil
+}
+
+// Codes returns the allowed currency codes in order
+func (a Allowlist) Codes() []string {
+	codes := make([]string, 0, len(a))
+	for code := range a {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// String returns the allowed codes comma-separated
+func (a Allowlist) String() string {
+	return strings.Join(a.Codes(), ",")
+}
+
+// Validate returns the currency with the given code, or ErrUnsupported when
+// it is not allowed and ErrPrecision when amount has more decimal places
+// than the currency's exponent
+func (a Allowlist) Validate(code string, amount float64) (Currency, error) {
+	c, ok := a[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnsupported, code)
+	}
+	if places := decimalPlaces(amount); places > c.Exponent {
+		return c, fmt.Errorf("%w: %s allows %d, %s has %d",
+			ErrPrecision, code, c.Exponent, strconv.FormatFloat(amount, 'f', -1, 64), places)
+	}
+	return c, nil
+}
+
+// decimalPlaces returns the number of decimal places in the shortest
+// representation of amount, which is how it was written in the request
+func decimalPlaces(amount float64) int {
+	s := strconv.FormatFloat(amount, 'f', -1, 64)
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		return len(s) - dot - 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package currency
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code     string
+		exponent int
+		name     string
+	}{
+		{"USD", 2, "US Dollar"},
+		{"JPY", 0, "Yen"},
+		{"BHD", 3, "Bahraini Dinar"},
+		{"CLF", 4, "Unidad de Fomento"},
+	}
+
+	for _, tt := range tests {
+		c, ok := Lookup(tt.code)
+		if !ok || c.Code != tt.code || c.Exponent != tt.exponent || c.Name != tt.name {
+			t.Errorf("Lookup(%s) = %+v, %v, want exponent %d and name %q", tt.code, c, ok, tt.exponent, tt.name)
+		}
+	}
+	if c, ok := Lookup("XYZ"); ok {
+		t.Errorf("Lookup(XYZ) = %+v, want no currency", c)
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		codes []string
+		err   string
+	}{
+		{"default", DefaultSupported, []string{"AUD", "CAD", "EUR", "GBP", "INR", "USD"}, ""},
+		{"normalized", " jpy, BHD ,,usd ", []string{"BHD", "JPY", "USD"}, ""},
+		{"unknown codes", "USD,XYZ,ABC", nil, "unknown ISO 4217 currency codes: XYZ, ABC"},
+		{"empty", " , ", nil, "no currencies listed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := ParseAllowlist(tt.list)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ParseAllowlist = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAllowlist: %v", err)
+			}
+			if !slices.Equal(allowed.Codes(), tt.codes) {
+				t.Errorf("codes = %v, want %v", allowed.Codes(), tt.codes)
+			}
+			if got := allowed.String(); got != strings.Join(tt.codes, ",") {
+				t.Errorf("String = %q", got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	allowed, err := ParseAllowlist("USD,JPY,BHD")
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		amount   float64
+		exponent int
+		err      error
+	}{
+		{"cents", "USD", 42.5, 2, nil},
+		{"two places", "USD", 19.99, 2, nil},
+		{"fractions of a cent", "USD", 19.999, 2, ErrPrecision},
+		{"whole yen", "JPY", 1500, 0, nil},
+		{"yen with decimals", "JPY", 1500.5, 0, ErrPrecision},
+		{"three places for dinars", "BHD", 12.345, 3, nil},
+		{"four places for dinars", "BHD", 12.3456, 3, ErrPrecision},
+		{"not allowed", "EUR", 10, 0, ErrUnsupported},
+		{"not a currency", "XYZ", 10, 0, ErrUnsupported},
+		{"lowercase", "usd", 10, 0, ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := allowed.Validate(tt.code, tt.amount)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Validate(%s, %v) = %v, want %v", tt.code, tt.amount, err, tt.err)
+			}
+			if !errors.Is(tt.err, ErrUnsupported) && c.Exponent != tt.exponent {
+				t.Errorf("exponent = %d, want %d", c.Exponent, tt.exponent)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/currency
+
+go 1.23.0
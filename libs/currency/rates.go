@@ -0,0 +1,192 @@
+package currency
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoRate is returned when no rate converts between two currencies,
+// wrapped with the currencies
+var ErrNoRate = errors.New("no exchange rate")
+
+// maxRatesBody bounds the rates read from a provider
+const maxRatesBody = 1 << 20
+
+// Rates are exchange rates against a base currency: Rates[code] units of
+// code buy one unit of Base. A file and a provider both serve them as JSON
+// in this shape.
+type Rates struct {
+	Base  string             `json:"base"`
+	AsOf  time.Time          `json:"as_of"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+//go:embed rates.json
+var defaultRates []byte
+
+// DefaultRates returns the rates built into the service, which serve until
+// a rates file or provider replaces them
+func DefaultRates() *Rates {
+	rates, err := ParseRates(defaultRates)
+	if err != nil {
+		panic(fmt.Sprintf("currency: invalid default rates: %v", err))
+	}
+	return rates
+}
+
+// ParseRates decodes rates, failing on a base or currency not in ISO 4217
+// and on rates that are not positive
+func ParseRates(data []byte) (*Rates, error) {
+	var rates Rates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+	if _, ok := Lookup(rates.Base); !ok {
+		return nil, fmt.Errorf("unknown base currency %q", rates.Base)
+	}
+	for code, rate := range rates.Rates {
+		if _, ok := Lookup(code); !ok {
+			return nil, fmt.Errorf("unknown currency %q", code)
+		}
+		if !(rate > 0) || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid rate %v for %s", rate, code)
+		}
+	}
+	if rates.Rates == nil {
+		rates.Rates = make(map[string]float64)
+	}
+	rates.Rates[rates.Base] = 1
+	return &rates, nil
+}
+
+// LoadRatesFile reads rates from a JSON file
+func LoadRatesFile(path string) (*Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates file: %w", err)
+	}
+	return ParseRates(data)
+}
+
+// Rate returns the rate converting from into to: the units of to one unit
+// of from buys
+func (r *Rates) Rate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	fromRate, ok := r.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s to %s", ErrNoRate, from, to)
+	}
+	toRate, ok := r.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s to %s", ErrNoRate, from, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// Converter converts amounts between currencies with the latest good rates.
+// It is safe for concurrent use.
+type Converter struct {
+	rates  atomic.Pointer[Rates]
+	client *http.Client
+}
+
+// NewConverter creates a converter with the given rates
+func NewConverter(rates *Rates) *Converter {
+	c := &Converter{client: &http.Client{Timeout: 10 * time.Second}}
+	c.rates.Store(rates)
+	return c
+}
+
+// LoadConverter creates a converter with the rates of the file at path, or
+// the default rates when path is empty
+func LoadConverter(path string) (*Converter, error) {
+	if path == "" {
+		return NewConverter(DefaultRates()), nil
+	}
+	rates, err := LoadRatesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewConverter(rates), nil
+}
+
+// Rates returns the rates in use
+func (c *Converter) Rates() *Rates {
+	return c.rates.Load()
+}
+
+// Convert converts amount from one currency to another, rounded to the
+// minor unit of to, and returns the rate used. Amounts in the same currency
+// convert at 1 whatever the rates.
+func (c *Converter) Convert(amount float64, from, to string) (converted, rate float64, err error) {
+	rate, err = c.rates.Load().Rate(from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	converted = amount * rate
+	if target, ok := Lookup(to); ok {
+		scale := math.Pow10(target.Exponent)
+		converted = math.Round(converted*scale) / scale
+	}
+	return converted, rate, nil
+}
+
+// Refresh fetches rates from a provider at url, serving them as Rates does,
+// and uses them from then on. On failure the rates in use are kept.
+func (c *Converter) Refresh(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build exchange rates request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch exchange rates: provider returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRatesBody))
+	if err != nil {
+		return fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	rates, err := ParseRates(data)
+	if err != nil {
+		return err
+	}
+	c.rates.Store(rates)
+	return nil
+}
+
+// Run refreshes the rates from url every interval until ctx is cancelled,
+// starting at once. A failed refresh is logged and the last good rates kept,
+// so conversions carry on with stale rates while the provider is down.
+func (c *Converter) Run(ctx context.Context, url string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(ctx, url); err != nil && ctx.Err() == nil {
+			rates := c.Rates()
+			log.Printf("exchange rates refresh: %v; keeping rates as of %s", err, rates.AsOf.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
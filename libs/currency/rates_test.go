@@ -0,0 +1,242 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRates = `{"base":"USD","as_of":"2026-10-01T00:00:00Z","rates":{"EUR":0.8,"INR":80,"JPY":150,"BHD":0.4}}`
+
+// newTestConverter returns a converter with testRates
+func newTestConverter(t *testing.T) *Converter {
+	t.Helper()
+	rates, err := ParseRates([]byte(testRates))
+	if err != nil {
+		t.Fatalf("ParseRates: %v", err)
+	}
+	return NewConverter(rates)
+}
+
+func TestParseRates(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"valid", testRates, ""},
+		{"no rates besides the base", `{"base":"EUR"}`, ""},
+		{"not JSON", `base: USD`, "failed to decode exchange rates"},
+		{"unknown base", `{"base":"XYZ","rates":{"EUR":0.9}}`, `unknown base currency "XYZ"`},
+		{"unknown currency", `{"base":"USD","rates":{"ABC":2}}`, `unknown currency "ABC"`},
+		{"zero rate", `{"base":"USD","rates":{"EUR":0}}`, "invalid rate 0 for EUR"},
+		{"negative rate", `{"base":"USD","rates":{"EUR":-0.9}}`, "invalid rate -0.9 for EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := ParseRates([]byte(tt.data))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseRates = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRates: %v", err)
+			}
+			// The base always converts to itself
+			if rates.Rates[rates.Base] != 1 {
+				t.Errorf("rate of the base %s = %v, want 1", rates.Base, rates.Rates[rates.Base])
+			}
+		})
+	}
+}
+
+func TestDefaultRatesCoverTheSupportedCurrencies(t *testing.T) {
+	rates := DefaultRates()
+	allowed, err := ParseAllowlist(DefaultSupported)
+	if err != nil {
+		t.Fatalf("ParseAllowlist: %v", err)
+	}
+	for _, code := range allowed.Codes() {
+		if _, err := rates.Rate(code, rates.Base); err != nil {
+			t.Errorf("no default rate for %s: %v", code, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	c := newTestConverter(t)
+	tests := []struct {
+		amount    float64
+		from, to  string
+		converted float64
+		rate      float64
+	}{
+		{9999, "EUR", "USD", 12498.75, 1.25},
+		{900000, "INR", "USD", 11250, 0.0125},
+		{100, "USD", "EUR", 80, 0.8},
+		// Between two currencies other than the base
+		{100, "EUR", "INR", 10000, 100},
+		// Rounded to the minor unit of the target
+		{10.01, "USD", "JPY", 1502, 150},
+		{1.2345, "USD", "BHD", 0.494, 0.4},
+		// The same currency converts at 1, rated or not
+		{42.5, "USD", "USD", 42.5, 1},
+		{42.5, "CHF", "CHF", 42.5, 1},
+	}
+	for _, tt := range tests {
+		converted, rate, err := c.Convert(tt.amount, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Convert(%v %s to %s): %v", tt.amount, tt.from, tt.to, err)
+			continue
+		}
+		if converted != tt.converted || rate != tt.rate {
+			t.Errorf("Convert(%v %s to %s) = %v at %v, want %v at %v", tt.amount, tt.from, tt.to, converted, rate, tt.converted, tt.rate)
+		}
+	}
+}
+
+func TestConvertWithoutARate(t *testing.T) {
+	c := newTestConverter(t)
+	for _, pair := range [][2]string{{"CHF", "USD"}, {"USD", "CHF"}, {"CHF", "EUR"}} {
+		_, _, err := c.Convert(100, pair[0], pair[1])
+		if !errors.Is(err, ErrNoRate) {
+			t.Errorf("Convert(%s to %s) = %v, want ErrNoRate", pair[0], pair[1], err)
+		}
+		if err != nil && !strings.Contains(err.Error(), pair[0]+" to "+pair[1]) {
+			t.Errorf("error %q, want it to name the currencies", err)
+		}
+	}
+}
+
+func TestLoadConverter(t *testing.T) {
+	c, err := LoadConverter("")
+	if err != nil || c.Rates().Base != "USD" {
+		t.Fatalf("LoadConverter without a file = %v, want the default rates", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base":"EUR","rates":{"USD":1.1}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	c, err = LoadConverter(path)
+	if err != nil {
+		t.Fatalf("LoadConverter: %v", err)
+	}
+	if converted, _, err := c.Convert(110, "USD", "EUR"); err != nil || converted != 100 {
+		t.Errorf("Convert with the file's rates = %v, %v, want 100", converted, err)
+	}
+
+	if _, err := LoadConverter(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadConverter succeeded without the file")
+	}
+}
+
+// ratesProvider serves body with status, counting its requests
+type ratesProvider struct {
+	*httptest.Server
+	status   atomic.Int64
+	body     atomic.Value
+	requests atomic.Int64
+}
+
+func newRatesProvider(t *testing.T, body string) *ratesProvider {
+	p := &ratesProvider{}
+	p.serve(http.StatusOK, body)
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		w.WriteHeader(int(p.status.Load()))
+		w.Write([]byte(p.body.Load().(string)))
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *ratesProvider) serve(status int, body string) {
+	p.status.Store(int64(status))
+	p.body.Store(body)
+}
+
+func TestRefreshKeepsTheLastGoodRates(t *testing.T) {
+	c := newTestConverter(t)
+	provider := newRatesProvider(t, `{"base":"USD","as_of":"2026-10-02T00:00:00Z","rates":{"EUR":0.5}}`)
+
+	if err := c.Refresh(context.Background(), provider.URL); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if converted, _, _ := c.Convert(100, "USD", "EUR"); converted != 50 {
+		t.Errorf("Convert after the refresh = %v, want the provider's rate", converted)
+	}
+	good := c.Rates()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"provider failing", http.StatusBadGateway, `upstream down`},
+		{"malformed rates", http.StatusOK, `{"base":`},
+		{"invalid rate", http.StatusOK, `{"base":"USD","rates":{"EUR":0}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.serve(tt.status, tt.body)
+			if err := c.Refresh(context.Background(), provider.URL); err == nil {
+				t.Fatal("Refresh succeeded")
+			}
+			if c.Rates() != good {
+				t.Errorf("rates replaced by a failed refresh")
+			}
+		})
+	}
+
+	provider.Close()
+	if err := c.Refresh(context.Background(), provider.URL); err == nil || c.Rates() != good {
+		t.Errorf("Refresh from a closed provider = %v, want an error and the rates kept", err)
+	}
+}
+
+func TestRunRefreshesUntilCancelled(t *testing.T) {
+	c := newTestConverter(t)
+	provider := newRatesProvider(t, `{"base":"USD","rates":{"EUR":0.5}}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, provider.URL, 10*time.Millisecond)
+		close(done)
+	}()
+
+	// The first refresh is at once
+	deadline := time.Now().Add(time.Second)
+	for c.Rates().Rates["EUR"] != 0.5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c.Rates().Rates["EUR"] != 0.5 {
+		t.Fatal("rates not refreshed")
+	}
+
+	// Stale rates serve while the provider is down
+	provider.serve(http.StatusServiceUnavailable, "")
+	seen := provider.requests.Load()
+	for provider.requests.Load() < seen+2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if converted, _, err := c.Convert(100, "USD", "EUR"); err != nil || converted != 50 {
+		t.Errorf("Convert while the provider is down = %v, %v, want the last good rate", converted, err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once cancelled")
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn
+
+go 1.23.0
+
+require github.com/segmentio/kafka-go v0.4.48
+
+require (
+	github.com/Harsh5840/real-time-tx-monitoring/libs/secrets v0.0.0
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	golang.org/x/text v0.13.0 // indirect
+)
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/secrets => ../secrets
@@ -0,0 +1,201 @@
+// Package kafkaconn configures how the services connect to Kafka: plaintext
+// by default, or TLS and SASL (PLAIN or SCRAM) as the production cluster
+// requires. Every reader, writer and dialer is built from one Connection.
+package kafkaconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	MechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// dialTimeout matches kafka.DefaultDialer
+const dialTimeout = 10 * time.Second
+
+// Config holds the Kafka security settings
+type Config struct {
+	TLSEnabled  bool
+	TLSCAFile   string // PEM; the system pool is used when empty
+	TLSCertFile string // PEM client certificate, for mutual TLS
+	TLSKeyFile  string
+
+	SASLMechanism string // empty disables SASL
+	SASLUsername  string
+	SASLPassword  string
+
+	// loadErr is a failure to read the password file, returned by Connect
+	loadErr error
+}
+
+// LoadConfig reads the Kafka security settings from the environment. The
+// SASL password may be given as a file through KAFKA_SASL_PASSWORD_FILE.
+func LoadConfig() Config {
+	tlsEnabled, _ := strconv.ParseBool(os.Getenv("KAFKA_TLS_ENABLED"))
+	password, err := secrets.Lookup("KAFKA_SASL_PASSWORD")
+	return Config{
+		TLSEnabled:    tlsEnabled,
+		TLSCAFile:     os.Getenv("KAFKA_TLS_CA_FILE"),
+		TLSCertFile:   os.Getenv("KAFKA_TLS_CERT_FILE"),
+		TLSKeyFile:    os.Getenv("KAFKA_TLS_KEY_FILE"),
+		SASLMechanism: strings.ToUpper(strings.TrimSpace(os.Getenv("KAFKA_SASL_MECHANISM"))),
+		SASLUsername:  os.Getenv("KAFKA_SASL_USERNAME"),
+		SASLPassword:  password,
+		loadErr:       err,
+	}
+}
+
+// String describes the settings without the password
+func (c Config) String() string {
+	mechanism := c.SASLMechanism
+	if mechanism == "" {
+		mechanism = "none"
+	}
+	return fmt.Sprintf("tls=%t sasl=%s", c.TLSEnabled, mechanism)
+}
+
+// Connection holds the dialer for readers and connections and the
+// transport for writers
+type Connection struct {
+	Dialer    *kafka.Dialer
+	Transport *kafka.Transport
+}
+
+// Connect builds a Connection, loading certificates and checking the SASL
+// settings. Any problem is returned, so the service can refuse to start.
+func (c Config) Connect() (*Connection, error) {
+	if c.loadErr != nil {
+		return nil, c.loadErr
+	}
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Connection{
+		Dialer: &kafka.Dialer{
+			Timeout:       dialTimeout,
+			DualStack:     true,
+			TLS:           tlsConfig,
+			SASLMechanism: mechanism,
+		},
+		Transport: &kafka.Transport{
+			DialTimeout: dialTimeout,
+			TLS:         tlsConfig,
+			SASL:        mechanism,
+		},
+	}, nil
+}
+
+// Ping fetches the cluster metadata from the first of brokers to answer.
+// Unlike a bare dial, it fails until a broker answers requests, not merely
+// accepts connections.
+func (c *Connection) Ping(ctx context.Context, brokers []string) error {
+	lastErr := errors.New("no brokers configured")
+	for _, broker := range brokers {
+		if broker = strings.TrimSpace(broker); broker == "" {
+			continue
+		}
+		conn, err := c.Dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("failed to fetch kafka metadata: %w", lastErr)
+}
+
+// tlsConfig returns the TLS configuration, or nil when TLS is disabled
+func (c Config) tlsConfig() (*tls.Config, error) {
+	if !c.TLSEnabled {
+		if c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != "" {
+			return nil, fmt.Errorf("kafka TLS files are set but KAFKA_TLS_ENABLED is not")
+		}
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka CA file %s contains no PEM certificates", c.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, fmt.Errorf("kafka client certificate and key must be set together")
+	}
+	if c.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kafka client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// saslMechanism returns the SASL mechanism, or nil when SASL is disabled
+func (c Config) saslMechanism() (sasl.Mechanism, error) {
+	if c.SASLMechanism == "" {
+		return nil, nil
+	}
+	if c.SASLUsername == "" || c.SASLPassword == "" {
+		return nil, fmt.Errorf("kafka SASL %s needs a username and password", c.SASLMechanism)
+	}
+
+	switch c.SASLMechanism {
+	case MechanismPlain:
+		return plain.Mechanism{Username: c.SASLUsername, Password: c.SASLPassword}, nil
+	case MechanismSCRAMSHA256:
+		return c.scram(scram.SHA256)
+	case MechanismSCRAMSHA512:
+		return c.scram(scram.SHA512)
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", c.SASLMechanism)
+	}
+}
+
+func (c Config) scram(algo scram.Algorithm) (sasl.Mechanism, error) {
+	mechanism, err := scram.Mechanism(algo, c.SASLUsername, c.SASLPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure kafka SASL %s: %w", c.SASLMechanism, err)
+	}
+	return mechanism, nil
+}
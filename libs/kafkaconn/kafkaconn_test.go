@@ -0,0 +1,317 @@
+package kafkaconn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// certFiles are the PEM files of a CA and a client certificate it issued
+type certFiles struct {
+	ca, cert, key string
+}
+
+// writeCerts writes a CA and a client certificate to a temporary directory
+func writeCerts(t *testing.T) certFiles {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "alert-service"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, client, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+
+	return certFiles{
+		ca:   write("ca.pem", "CERTIFICATE", caDER),
+		cert: write("client.pem", "CERTIFICATE", clientDER),
+		key:  write("client-key.pem", "PRIVATE KEY", keyDER),
+	}
+}
+
+func TestConnectPlaintextByDefault(t *testing.T) {
+	conn, err := Config{}.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if conn.Dialer.TLS != nil || conn.Dialer.SASLMechanism != nil || conn.Transport.TLS != nil || conn.Transport.SASL != nil {
+		t.Errorf("connection = %+v, want plaintext", conn)
+	}
+	if conn.Dialer.Timeout != dialTimeout || conn.Transport.DialTimeout != dialTimeout {
+		t.Errorf("dial timeouts = %s and %s, want %s", conn.Dialer.Timeout, conn.Transport.DialTimeout, dialTimeout)
+	}
+}
+
+func TestConnectTLS(t *testing.T) {
+	files := writeCerts(t)
+
+	conn, err := Config{TLSEnabled: true}.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if conn.Dialer.TLS == nil || conn.Dialer.TLS.RootCAs != nil || len(conn.Dialer.TLS.Certificates) != 0 {
+		t.Errorf("TLS = %+v, want the system pool and no client certificate", conn.Dialer.TLS)
+	}
+
+	conn, err = Config{TLSEnabled: true, TLSCAFile: files.ca, TLSCertFile: files.cert, TLSKeyFile: files.key}.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	cfg := conn.Dialer.TLS
+	if cfg == nil || cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("TLS = %+v, want the CA and the client certificate", cfg)
+	}
+	if conn.Transport.TLS != cfg {
+		t.Error("the transport and the dialer have different TLS settings")
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: cfg.RootCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("client certificate does not verify against the CA: %v", err)
+	}
+}
+
+func TestConnectRejectsBadTLSSettings(t *testing.T) {
+	files := writeCerts(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"files without TLS", Config{TLSCAFile: files.ca}, "KAFKA_TLS_ENABLED is not"},
+		{"missing CA", Config{TLSEnabled: true, TLSCAFile: missing}, "failed to read kafka CA file"},
+		{"CA not PEM", Config{TLSEnabled: true, TLSCAFile: notPEM}, "contains no PEM certificates"},
+		{"certificate without key", Config{TLSEnabled: true, TLSCertFile: files.cert}, "must be set together"},
+		{"key without certificate", Config{TLSEnabled: true, TLSKeyFile: files.key}, "must be set together"},
+		{"key of another certificate", Config{TLSEnabled: true, TLSCertFile: files.ca, TLSKeyFile: files.key},
+			"failed to load kafka client certificate"},
+		{"missing key", Config{TLSEnabled: true, TLSCertFile: files.cert, TLSKeyFile: missing}, "failed to load kafka client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.cfg.Connect()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Connect = %+v, %v, want %q", conn, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectSASL(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		want      string
+	}{
+		{MechanismPlain, "PLAIN"},
+		{MechanismSCRAMSHA256, "SCRAM-SHA-256"},
+		{MechanismSCRAMSHA512, "SCRAM-SHA-512"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mechanism, func(t *testing.T) {
+			conn, err := Config{TLSEnabled: true, SASLMechanism: tt.mechanism, SASLUsername: "alert-service", SASLPassword: "s3cret"}.Connect()
+			if err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			if conn.Dialer.SASLMechanism == nil || conn.Dialer.SASLMechanism.Name() != tt.want {
+				t.Fatalf("dialer SASL = %v, want %s", conn.Dialer.SASLMechanism, tt.want)
+			}
+			if conn.Transport.SASL != conn.Dialer.SASLMechanism {
+				t.Error("the transport and the dialer have different SASL mechanisms")
+			}
+			if conn.Dialer.TLS == nil {
+				t.Error("SASL without the TLS asked for")
+			}
+		})
+	}
+
+	conn, err := Config{SASLMechanism: MechanismPlain, SASLUsername: "alert-service", SASLPassword: "s3cret"}.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if m, ok := conn.Dialer.SASLMechanism.(plain.Mechanism); !ok || m.Username != "alert-service" || m.Password != "s3cret" {
+		t.Errorf("PLAIN mechanism = %+v, want the credentials", conn.Dialer.SASLMechanism)
+	}
+}
+
+func TestConnectRejectsBadSASLSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"no username", Config{SASLMechanism: MechanismSCRAMSHA512, SASLPassword: "s3cret"}, "needs a username and password"},
+		{"no password", Config{SASLMechanism: MechanismPlain, SASLUsername: "alert-service"}, "needs a username and password"},
+		{"unknown mechanism", Config{SASLMechanism: "GSSAPI", SASLUsername: "alert-service", SASLPassword: "s3cret"},
+			`unsupported kafka SASL mechanism "GSSAPI"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if conn, err := tt.cfg.Connect(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Connect = %+v, %v, want %q", conn, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	files := writeCerts(t)
+	password := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(password, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("KAFKA_TLS_ENABLED", "true")
+	t.Setenv("KAFKA_TLS_CA_FILE", files.ca)
+	t.Setenv("KAFKA_TLS_CERT_FILE", files.cert)
+	t.Setenv("KAFKA_TLS_KEY_FILE", files.key)
+	t.Setenv("KAFKA_SASL_MECHANISM", " scram-sha-512 ")
+	t.Setenv("KAFKA_SASL_USERNAME", "alert-service")
+	t.Setenv("KAFKA_SASL_PASSWORD", "")
+	t.Setenv("KAFKA_SASL_PASSWORD_FILE", password)
+
+	cfg := LoadConfig()
+	if !cfg.TLSEnabled || cfg.TLSCAFile != files.ca || cfg.SASLMechanism != MechanismSCRAMSHA512 || cfg.SASLPassword != "s3cret" {
+		t.Errorf("config = %+v", cfg)
+	}
+	if got := cfg.String(); got != "tls=true sasl=SCRAM-SHA-512" || strings.Contains(got, "s3cret") {
+		t.Errorf("String = %q", got)
+	}
+	if _, err := cfg.Connect(); err != nil {
+		t.Errorf("Connect: %v", err)
+	}
+
+	// An unreadable password file fails the connection, not the load
+	t.Setenv("KAFKA_SASL_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	cfg = LoadConfig()
+	if _, err := cfg.Connect(); err == nil || !strings.Contains(err.Error(), "KAFKA_SASL_PASSWORD_FILE") {
+		t.Errorf("Connect with a missing password file = %v", err)
+	}
+
+	if got := (Config{}).String(); got != "tls=false sasl=none" {
+		t.Errorf("String of the default = %q", got)
+	}
+}
+
+// silentBroker accepts connections and closes them unanswered, as a broker
+// still starting up may
+func silentBroker(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// closedPort returns a localhost address nothing listens on
+func closedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestPingFailsUntilABrokerAnswers(t *testing.T) {
+	conn, err := Config{}.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		brokers []string
+		want    string
+	}{
+		{"no brokers", []string{" ", ""}, "no brokers configured"},
+		{"nothing listening", []string{closedPort(t)}, "connection refused"},
+		// Accepting connections is not answering requests
+		{"broker not answering", []string{closedPort(t), silentBroker(t)}, "failed to fetch kafka metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := conn.Ping(ctx, tt.brokers)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Ping = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package kafkaconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Topic defaults, matching the partition count the consumers scale to
+const (
+	DefaultTopicPartitions        = 6
+	DefaultTopicReplicationFactor = 1
+)
+
+// retentionConfig is the topic config the retention is set in
+const retentionConfig = "retention.ms"
+
+// TopicSpec is how a topic is created. A zero RetentionMs leaves the
+// broker's default retention.
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	RetentionMs       int64
+}
+
+func (s TopicSpec) String() string {
+	retention := "default"
+	if s.RetentionMs > 0 {
+		retention = strconv.FormatInt(s.RetentionMs, 10)
+	}
+	return fmt.Sprintf("%s(partitions=%d replication=%d retention.ms=%s)", s.Name, s.Partitions, s.ReplicationFactor, retention)
+}
+
+// TopicsConfig is how the producing services provision their output topics
+// at startup. Without Autocreate topics are left to the cluster, which
+// creates them on first write with a single partition. Existing topics are
+// compared with their spec; a mismatch is logged, or fails the startup
+// when Strict.
+type TopicsConfig struct {
+	Autocreate bool
+	Strict     bool
+
+	// Partitions, ReplicationFactor and RetentionMs are the spec of every
+	// topic Overrides does not name
+	Partitions        int
+	ReplicationFactor int
+	RetentionMs       int64
+	Overrides         map[string]TopicSpec
+
+	// loadErr is a failure to parse the environment, returned by Validate
+	loadErr error
+}
+
+// LoadTopicsConfig reads the topic provisioning from TOPIC_AUTOCREATE,
+// TOPIC_STRICT, KAFKA_TOPIC_PARTITIONS, KAFKA_TOPIC_REPLICATION_FACTOR,
+// KAFKA_TOPIC_RETENTION_MS and KAFKA_TOPIC_SPECS, a comma-separated list of
+// topic=partitions:replication:retention_ms overrides whose empty parts
+// keep the defaults
+func LoadTopicsConfig() TopicsConfig {
+	var errs []error
+	intEnv := func(key string, fallback int64) int64 {
+		value := strings.TrimSpace(os.Getenv(key))
+		if value == "" {
+			return fallback
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, value))
+			return fallback
+		}
+		return n
+	}
+	boolEnv := func(key string) bool {
+		value := strings.TrimSpace(os.Getenv(key))
+		if value == "" {
+			return false
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, value))
+		}
+		return b
+	}
+
+	c := TopicsConfig{
+		Autocreate:        boolEnv("TOPIC_AUTOCREATE"),
+		Strict:            boolEnv("TOPIC_STRICT"),
+		Partitions:        int(intEnv("KAFKA_TOPIC_PARTITIONS", DefaultTopicPartitions)),
+		ReplicationFactor: int(intEnv("KAFKA_TOPIC_REPLICATION_FACTOR", DefaultTopicReplicationFactor)),
+		RetentionMs:       intEnv("KAFKA_TOPIC_RETENTION_MS", 0),
+	}
+	overrides, err := c.parseOverrides(os.Getenv("KAFKA_TOPIC_SPECS"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.Overrides = overrides
+	c.loadErr = errors.Join(errs...)
+	return c
+}
+
+// parseOverrides parses the topic=partitions:replication:retention_ms list
+// of KAFKA_TOPIC_SPECS, the empty parts of an override taken from c
+func (c TopicsConfig) parseOverrides(list string) (map[string]TopicSpec, error) {
+	overrides := make(map[string]TopicSpec)
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		parts := strings.Split(spec, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" || len(parts) > 3 {
+			return nil, fmt.Errorf("KAFKA_TOPIC_SPECS: %q is not topic=partitions:replication:retention_ms", entry)
+		}
+
+		values := []int64{int64(c.Partitions), int64(c.ReplicationFactor), c.RetentionMs}
+		for i, part := range parts {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("KAFKA_TOPIC_SPECS: %q is not topic=partitions:replication:retention_ms", entry)
+			}
+			values[i] = n
+		}
+		overrides[name] = TopicSpec{
+			Name:              name,
+			Partitions:        int(values[0]),
+			ReplicationFactor: int(values[1]),
+			RetentionMs:       values[2],
+		}
+	}
+	return overrides, nil
+}
+
+// String describes the provisioning and the overridden topics
+func (c TopicsConfig) String() string {
+	names := make([]string, 0, len(c.Overrides))
+	for name := range c.Overrides {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	overrides := make([]string, len(names))
+	for i, name := range names {
+		overrides[i] = c.Overrides[name].String()
+	}
+	return fmt.Sprintf("autocreate=%t strict=%t partitions=%d replication=%d retention.ms=%d overrides=%v",
+		c.Autocreate, c.Strict, c.Partitions, c.ReplicationFactor, c.RetentionMs, overrides)
+}
+
+// Validate checks every spec has partitions and replicas, and no retention
+// is negative
+func (c TopicsConfig) Validate() error {
+	problems := []error{c.loadErr}
+	if c.Partitions < 1 || c.ReplicationFactor < 1 || c.RetentionMs < 0 {
+		problems = append(problems, errors.New("KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive, KAFKA_TOPIC_RETENTION_MS not negative"))
+	}
+	for name, spec := range c.Overrides {
+		if spec.Partitions < 1 || spec.ReplicationFactor < 1 || spec.RetentionMs < 0 {
+			problems = append(problems, fmt.Errorf("KAFKA_TOPIC_SPECS: %s needs positive partitions and replication, and a retention that is not negative", name))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Specs returns the specs of the named topics, skipping empty and repeated
+// names
+func (c TopicsConfig) Specs(names ...string) []TopicSpec {
+	var specs []TopicSpec
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		spec, ok := c.Overrides[name]
+		if !ok {
+			spec = TopicSpec{Name: name, Partitions: c.Partitions, ReplicationFactor: c.ReplicationFactor, RetentionMs: c.RetentionMs}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// ProvisionTopics creates the topics of specs missing from the cluster of
+// brokers and compares the others with their spec, through the Kafka admin
+// API. A mismatched topic is logged, and returned as an error when strict;
+// existing topics are never altered. It does nothing unless c.Autocreate.
+// logger may be nil for the default logger.
+func (c TopicsConfig) ProvisionTopics(ctx context.Context, conn *Connection, brokers []string, specs []TopicSpec, logger *slog.Logger) error {
+	if !c.Autocreate || len(specs) == 0 {
+		return nil
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...), Transport: conn.Transport}
+	// Every topic is listed, as asking for missing ones by name may have the
+	// broker create them with its defaults
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list topics: %w", err)
+	}
+	existing := make(map[string]kafka.Topic, len(metadata.Topics))
+	for _, topic := range metadata.Topics {
+		if topic.Error == nil {
+			existing[topic.Name] = topic
+		}
+	}
+
+	var missing []TopicSpec
+	var mismatches []error
+	for _, spec := range specs {
+		topic, ok := existing[spec.Name]
+		if !ok {
+			missing = append(missing, spec)
+			continue
+		}
+		for _, problem := range compareTopic(ctx, client, spec, topic) {
+			logger.Warn("topic does not match its spec", "topic", spec.Name, "problem", problem)
+			mismatches = append(mismatches, fmt.Errorf("topic %s: %s", spec.Name, problem))
+		}
+	}
+
+	if err := createTopics(ctx, client, missing, logger); err != nil {
+		return err
+	}
+	if c.Strict && len(mismatches) > 0 {
+		return errors.Join(mismatches...)
+	}
+	return nil
+}
+
+// createTopics creates topics, one created meanwhile by another service
+// counting as created
+func createTopics(ctx context.Context, client *kafka.Client, specs []TopicSpec, logger *slog.Logger) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	req := &kafka.CreateTopicsRequest{Topics: make([]kafka.TopicConfig, len(specs))}
+	for i, spec := range specs {
+		req.Topics[i] = kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+		}
+		if spec.RetentionMs > 0 {
+			req.Topics[i].ConfigEntries = []kafka.ConfigEntry{{
+				ConfigName:  retentionConfig,
+				ConfigValue: strconv.FormatInt(spec.RetentionMs, 10),
+			}}
+		}
+	}
+	resp, err := client.CreateTopics(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+
+	var problems []error
+	for _, spec := range specs {
+		err := resp.Errors[spec.Name]
+		switch {
+		case err == nil:
+			logger.Info("topic created", "topic", spec.Name, "partitions", spec.Partitions,
+				"replication_factor", spec.ReplicationFactor, "retention_ms", spec.RetentionMs)
+		case errors.Is(err, kafka.TopicAlreadyExists):
+			logger.Info("topic created by another service", "topic", spec.Name)
+		default:
+			problems = append(problems, fmt.Errorf("failed to create topic %s: %w", spec.Name, err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// compareTopic returns how an existing topic differs from its spec. Its
+// retention is only compared when the spec sets one; a failure to read it
+// is reported as a difference.
+func compareTopic(ctx context.Context, client *kafka.Client, spec TopicSpec, topic kafka.Topic) []string {
+	var problems []string
+	if len(topic.Partitions) != spec.Partitions {
+		problems = append(problems, fmt.Sprintf("has %d partitions, spec has %d", len(topic.Partitions), spec.Partitions))
+	}
+	if len(topic.Partitions) > 0 && len(topic.Partitions[0].Replicas) != spec.ReplicationFactor {
+		problems = append(problems, fmt.Sprintf("has replication factor %d, spec has %d", len(topic.Partitions[0].Replicas), spec.ReplicationFactor))
+	}
+	if spec.RetentionMs <= 0 {
+		return problems
+	}
+
+	retention, err := topicRetention(ctx, client, spec.Name)
+	if err != nil {
+		return append(problems, fmt.Sprintf("retention unknown: %v", err))
+	}
+	if retention != spec.RetentionMs {
+		problems = append(problems, fmt.Sprintf("has retention.ms %d, spec has %d", retention, spec.RetentionMs))
+	}
+	return problems
+}
+
+// topicRetention returns the retention.ms of a topic
+func topicRetention(ctx context.Context, client *kafka.Client, name string) (int64, error) {
+	resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: name,
+			ConfigNames:  []string{retentionConfig},
+		}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			return 0, resource.Error
+		}
+		for _, entry := range resource.ConfigEntries {
+			if entry.ConfigName == retentionConfig {
+				return strconv.ParseInt(entry.ConfigValue, 10, 64)
+			}
+		}
+	}
+	return 0, errors.New("not described")
+}
@@ -0,0 +1,119 @@
+package kafkaconn
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// setTopicsEnv sets the topic variables for the test, unsetting the others
+func setTopicsEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{
+		"TOPIC_AUTOCREATE", "TOPIC_STRICT", "KAFKA_TOPIC_PARTITIONS",
+		"KAFKA_TOPIC_REPLICATION_FACTOR", "KAFKA_TOPIC_RETENTION_MS", "KAFKA_TOPIC_SPECS",
+	} {
+		t.Setenv(key, env[key])
+	}
+}
+
+func TestLoadTopicsConfig(t *testing.T) {
+	setTopicsEnv(t, nil)
+	cfg := LoadTopicsConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate of the defaults: %v", err)
+	}
+	want := "autocreate=false strict=false partitions=6 replication=1 retention.ms=0 overrides=[]"
+	if got := cfg.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	setTopicsEnv(t, map[string]string{
+		"TOPIC_AUTOCREATE":               "true",
+		"TOPIC_STRICT":                   "1",
+		"KAFKA_TOPIC_PARTITIONS":         "12",
+		"KAFKA_TOPIC_REPLICATION_FACTOR": "3",
+		"KAFKA_TOPIC_RETENTION_MS":       "604800000",
+		"KAFKA_TOPIC_SPECS":              " transactions.raw.dlq=1::2592000000 , alerts=:2, ",
+	})
+	cfg = LoadTopicsConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	// The empty parts of an override keep the defaults
+	want = "autocreate=true strict=true partitions=12 replication=3 retention.ms=604800000 overrides=[" +
+		"alerts(partitions=12 replication=2 retention.ms=604800000) " +
+		"transactions.raw.dlq(partitions=1 replication=3 retention.ms=2592000000)]"
+	if got := cfg.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestValidateTopicsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"unparsable boolean", map[string]string{"TOPIC_AUTOCREATE": "yes please"}, []string{`TOPIC_AUTOCREATE: "yes please" is not a boolean`}},
+		{"unparsable integer", map[string]string{"KAFKA_TOPIC_PARTITIONS": "six"}, []string{`KAFKA_TOPIC_PARTITIONS: "six" is not an integer`}},
+		{"no partitions", map[string]string{"KAFKA_TOPIC_PARTITIONS": "0"}, []string{"KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive"}},
+		{"negative retention", map[string]string{"KAFKA_TOPIC_RETENTION_MS": "-1"}, []string{"KAFKA_TOPIC_RETENTION_MS not negative"}},
+		{"override without a spec", map[string]string{"KAFKA_TOPIC_SPECS": "alerts"}, []string{`KAFKA_TOPIC_SPECS: "alerts" is not topic=partitions:replication:retention_ms`}},
+		{"override of too many parts", map[string]string{"KAFKA_TOPIC_SPECS": "alerts=1:1:1:1"}, []string{`"alerts=1:1:1:1" is not topic=partitions:replication:retention_ms`}},
+		{"override not a number", map[string]string{"KAFKA_TOPIC_SPECS": "alerts=one"}, []string{`"alerts=one" is not topic=partitions:replication:retention_ms`}},
+		{"override without a name", map[string]string{"KAFKA_TOPIC_SPECS": "=3"}, []string{`"=3" is not topic=partitions:replication:retention_ms`}},
+		{"override of no replicas", map[string]string{"KAFKA_TOPIC_SPECS": "alerts=3:0"}, []string{"KAFKA_TOPIC_SPECS: alerts needs positive partitions and replication"}},
+		{"every problem at once", map[string]string{"TOPIC_STRICT": "maybe", "KAFKA_TOPIC_REPLICATION_FACTOR": "0", "KAFKA_TOPIC_SPECS": "alerts=-1"}, []string{
+			`TOPIC_STRICT: "maybe" is not a boolean`,
+			"KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive",
+			"KAFKA_TOPIC_SPECS: alerts needs positive partitions and replication",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTopicsEnv(t, tt.env)
+			err := LoadTopicsConfig().Validate()
+			for _, want := range tt.want {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSpecs(t *testing.T) {
+	cfg := TopicsConfig{
+		Partitions:        6,
+		ReplicationFactor: 3,
+		RetentionMs:       86400000,
+		Overrides:         map[string]TopicSpec{"transactions.raw.dlq": {Name: "transactions.raw.dlq", Partitions: 1, ReplicationFactor: 3}},
+	}
+	specs := cfg.Specs("transactions.processed", "", "transactions.raw.dlq", "transactions.processed")
+
+	var got []string
+	for _, spec := range specs {
+		got = append(got, spec.String())
+	}
+	want := "transactions.processed(partitions=6 replication=3 retention.ms=86400000)," +
+		"transactions.raw.dlq(partitions=1 replication=3 retention.ms=default)"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Specs = %v, want %s, skipping empty and repeated names", got, want)
+	}
+}
+
+func TestProvisionTopicsDoesNothingUnlessAutocreate(t *testing.T) {
+	// No broker answers on the address, so provisioning would fail
+	cfg := TopicsConfig{Partitions: 6, ReplicationFactor: 1}
+	specs := cfg.Specs("transactions.raw")
+	if err := cfg.ProvisionTopics(context.Background(), &Connection{}, []string{"127.0.0.1:1"}, specs, nil); err != nil {
+		t.Errorf("ProvisionTopics() = %v, want nothing done", err)
+	}
+
+	cfg.Autocreate = true
+	if err := cfg.ProvisionTopics(context.Background(), &Connection{}, []string{"127.0.0.1:1"}, nil, nil); err != nil {
+		t.Errorf("ProvisionTopics() = %v, want nothing done without topics", err)
+	}
+}
@@ -0,0 +1,244 @@
+package kafkaconn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// setWriterEnv sets the writer variables for the test, unsetting the others
+func setWriterEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{
+		"KAFKA_WRITER_COMPRESSION", "KAFKA_WRITER_BATCH_SIZE", "KAFKA_WRITER_BATCH_TIMEOUT_MS",
+		"KAFKA_WRITER_REQUIRED_ACKS", "KAFKA_WRITER_MAX_ATTEMPTS", "KAFKA_WRITER_WRITE_TIMEOUT_MS",
+	} {
+		t.Setenv(key, env[key])
+	}
+}
+
+func TestLoadWriterConfig(t *testing.T) {
+	setWriterEnv(t, nil)
+	cfg := LoadWriterConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate of the defaults: %v", err)
+	}
+	want := "compression=snappy batch_size=default batch_timeout=default acks=default max_attempts=default write_timeout=default"
+	if got := cfg.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	setWriterEnv(t, map[string]string{
+		"KAFKA_WRITER_COMPRESSION":      " ZSTD ",
+		"KAFKA_WRITER_BATCH_SIZE":       "500",
+		"KAFKA_WRITER_BATCH_TIMEOUT_MS": "20",
+		"KAFKA_WRITER_REQUIRED_ACKS":    "All",
+		"KAFKA_WRITER_MAX_ATTEMPTS":     "7",
+		"KAFKA_WRITER_WRITE_TIMEOUT_MS": "2500",
+	})
+	cfg = LoadWriterConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	want = "compression=zstd batch_size=500 batch_timeout=20ms acks=all max_attempts=7 write_timeout=2.5s"
+	if got := cfg.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestValidateWriterConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"unknown codec", map[string]string{"KAFKA_WRITER_COMPRESSION": "brotli"}, []string{`KAFKA_WRITER_COMPRESSION: "brotli"`}},
+		{"unknown acks", map[string]string{"KAFKA_WRITER_REQUIRED_ACKS": "quorum"}, []string{`KAFKA_WRITER_REQUIRED_ACKS: "quorum"`}},
+		{"malformed number", map[string]string{"KAFKA_WRITER_BATCH_SIZE": "lots"}, []string{`KAFKA_WRITER_BATCH_SIZE: "lots" is not an integer`}},
+		{"negative number", map[string]string{"KAFKA_WRITER_MAX_ATTEMPTS": "-1"}, []string{"must not be negative"}},
+		{
+			"every problem at once",
+			map[string]string{"KAFKA_WRITER_COMPRESSION": "brotli", "KAFKA_WRITER_REQUIRED_ACKS": "2", "KAFKA_WRITER_WRITE_TIMEOUT_MS": "soon"},
+			[]string{"KAFKA_WRITER_COMPRESSION", "KAFKA_WRITER_REQUIRED_ACKS", "KAFKA_WRITER_WRITE_TIMEOUT_MS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setWriterEnv(t, tt.env)
+			err := LoadWriterConfig().Validate()
+			if err == nil {
+				t.Fatal("Validate accepted the configuration")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyKeepsTheDefaultsOfUnsetValues(t *testing.T) {
+	defaults := kafka.WriterConfig{
+		Brokers:      []string{"kafka:9092"},
+		BatchSize:    1,
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: int(kafka.RequireAll),
+		MaxAttempts:  3,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	wc := defaults
+	WriterConfig{Compression: CompressionNone}.Apply(&wc)
+	if wc.CompressionCodec != nil || wc.BatchSize != 1 || wc.BatchTimeout != 10*time.Millisecond ||
+		wc.RequiredAcks != int(kafka.RequireAll) || wc.MaxAttempts != 3 || wc.WriteTimeout != 5*time.Second {
+		t.Errorf("unset tuning changed the writer: %+v", wc)
+	}
+
+	wc = defaults
+	WriterConfig{
+		Compression:  CompressionLZ4,
+		BatchSize:    200,
+		BatchTimeout: 50 * time.Millisecond,
+		RequiredAcks: AcksOne,
+		MaxAttempts:  10,
+		WriteTimeout: time.Second,
+	}.Apply(&wc)
+	if wc.CompressionCodec == nil || wc.CompressionCodec.Name() != "lz4" {
+		t.Errorf("codec %v, want lz4", wc.CompressionCodec)
+	}
+	if wc.BatchSize != 200 || wc.BatchTimeout != 50*time.Millisecond || wc.RequiredAcks != int(kafka.RequireOne) ||
+		wc.MaxAttempts != 10 || wc.WriteTimeout != time.Second {
+		t.Errorf("tuning not applied: %+v", wc)
+	}
+
+	// Acknowledgements of none are applied, not taken for unset
+	wc = defaults
+	WriterConfig{RequiredAcks: AcksNone}.Apply(&wc)
+	if wc.RequiredAcks != int(kafka.RequireNone) {
+		t.Errorf("required acks %d, want none", wc.RequiredAcks)
+	}
+}
+
+func TestDescribeWriter(t *testing.T) {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP("kafka:9092"),
+		Compression:  kafka.Snappy,
+		BatchSize:    100,
+		BatchTimeout: 20 * time.Millisecond,
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  5,
+		WriteTimeout: 3 * time.Second,
+	}
+	defer w.Close()
+	want := "compression=snappy batch_size=100 batch_timeout=20ms acks=all max_attempts=5 write_timeout=3s async=false"
+	if got := DescribeWriter(w); got != want {
+		t.Errorf("DescribeWriter = %q, want %q", got, want)
+	}
+}
+
+// processedTransaction is shaped as the processed transactions the
+// producers write, about 600 bytes of JSON
+type processedTransaction struct {
+	ID                 string            `json:"id"`
+	AccountID          string            `json:"account_id"`
+	UserID             string            `json:"user_id"`
+	Amount             float64           `json:"amount"`
+	Currency           string            `json:"currency"`
+	Type               string            `json:"type"`
+	Category           string            `json:"category"`
+	Merchant           string            `json:"merchant"`
+	MerchantNormalized string            `json:"merchant_normalized"`
+	Timestamp          time.Time         `json:"timestamp"`
+	Metadata           map[string]string `json:"metadata"`
+	RiskScore          float64           `json:"risk_score"`
+	RiskLevel          string            `json:"risk_level"`
+	Status             string            `json:"status"`
+	ProcessorID        string            `json:"processor_id"`
+	ProcessedAt        time.Time         `json:"processed_at"`
+	Lane               string            `json:"lane"`
+}
+
+var merchants = []string{"Corner Shop", "AMZN Mktp US*2K4", "Uber *Trip", "Shell Oil 5732", "Netflix.com", "Whole Foods #10234"}
+
+// batchOf returns n processed transactions encoded as the producers encode
+// them
+func batchOf(n int) [][]byte {
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	batch := make([][]byte, n)
+	for i := range batch {
+		merchant := merchants[i%len(merchants)]
+		data, _ := json.Marshal(processedTransaction{
+			ID:                 fmt.Sprintf("txn_%d_%08x", at.Unix(), i*2654435761),
+			AccountID:          fmt.Sprintf("acct-%05d", i*7919%100000),
+			UserID:             fmt.Sprintf("user-%05d", i*104729%100000),
+			Amount:             float64(i*3571%100000) / 100,
+			Currency:           "USD",
+			Type:               "purchase",
+			Category:           "groceries",
+			Merchant:           merchant,
+			MerchantNormalized: strings.ToLower(merchant),
+			Timestamp:          at.Add(time.Duration(i) * time.Second),
+			Metadata:           map[string]string{"device_info": "Pixel 9", "country": "US", "channel": "card_present"},
+			RiskScore:          float64(i*31%100) / 100,
+			RiskLevel:          "low",
+			Status:             "approved",
+			ProcessorID:        "processor-001",
+			ProcessedAt:        at.Add(time.Duration(i)*time.Second + 42*time.Millisecond),
+			Lane:               "fast",
+		})
+		batch[i] = data
+	}
+	return batch
+}
+
+// BenchmarkCompression compresses batches of processed transactions with
+// each codec, reporting the compression ratio alongside the time taken:
+//
+//	go test -run '^$' -bench Compression ./libs/kafkaconn/
+func BenchmarkCompression(b *testing.B) {
+	for _, size := range []int{1, 100} {
+		batch := batchOf(size)
+		raw := 0
+		for _, message := range batch {
+			raw += len(message)
+		}
+
+		for _, name := range []string{CompressionNone, CompressionSnappy, CompressionLZ4, CompressionZstd, CompressionGzip} {
+			codec, err := WriterConfig{Compression: name}.codec()
+			if err != nil {
+				b.Fatalf("codec %s: %v", name, err)
+			}
+			b.Run(fmt.Sprintf("%s/batch=%d", name, size), func(b *testing.B) {
+				var buf bytes.Buffer
+				b.SetBytes(int64(raw))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					buf.Reset()
+					if codec == nil {
+						for _, message := range batch {
+							buf.Write(message)
+						}
+						continue
+					}
+					w := codec.NewWriter(&buf)
+					for _, message := range batch {
+						if _, err := w.Write(message); err != nil {
+							b.Fatalf("Write: %v", err)
+						}
+					}
+					if err := w.Close(); err != nil {
+						b.Fatalf("Close: %v", err)
+					}
+				}
+				b.ReportMetric(float64(raw)/float64(buf.Len()), "ratio")
+				b.ReportMetric(float64(raw)/float64(size), "bytes/msg")
+			})
+		}
+	}
+}
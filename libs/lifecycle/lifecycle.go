@@ -0,0 +1,269 @@
+// Package lifecycle runs the components of a service and stops them in a
+// fixed order on SIGINT or SIGTERM. Components register in a group; on
+// shutdown the groups stop one after another, servers first so no new work
+// comes in, then consumers and background workers so the work in flight
+// finishes, then producers so what it produced is flushed, and the stores
+// it wrote to last. The whole shutdown is held to one deadline, past which
+// the components not yet stopped are abandoned and reported as failed.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Group orders the shutdown: the groups stop in increasing order
+type Group int
+
+// Groups of components, in the order they stop
+const (
+	// Servers stop taking requests first
+	Servers Group = iota
+	// Consumers stop reading input and finish the messages in flight
+	Consumers
+	// Workers are background jobs the consumers may hand work to
+	Workers
+	// Producers flush the messages they hold
+	Producers
+	// Stores, such as Redis clients and database pools, close last
+	Stores
+)
+
+func (g Group) String() string {
+	switch g {
+	case Servers:
+		return "servers"
+	case Consumers:
+		return "consumers"
+	case Workers:
+		return "workers"
+	case Producers:
+		return "producers"
+	case Stores:
+		return "stores"
+	default:
+		return fmt.Sprintf("group %d", int(g))
+	}
+}
+
+// Component is a part of a service with its own start and stop
+type Component struct {
+	Name  string
+	Group Group
+	// Start, when set, runs the component until ctx is done, which it is
+	// once the component's group stops. An error returned before then shuts
+	// the service down.
+	Start func(ctx context.Context) error
+	// Stop, when set, stops the component, giving up once ctx is done. The
+	// coordinator then waits for Start to return.
+	Stop func(ctx context.Context) error
+}
+
+// Closer returns a component stopped by close, such as a client or a
+// connection pool
+func Closer(name string, group Group, close func() error) Component {
+	return Component{
+		Name:  name,
+		Group: group,
+		Stop:  func(context.Context) error { return close() },
+	}
+}
+
+// Background returns a component running run until its group stops, in the
+// Workers group, for the loops of a service that return nothing
+func Background(name string, run func(ctx context.Context)) Component {
+	return Component{
+		Name:  name,
+		Group: Workers,
+		Start: func(ctx context.Context) error {
+			run(ctx)
+			return nil
+		},
+	}
+}
+
+// Server returns a component serving HTTP on srv, in the Servers group.
+// Stopping it lets the requests in flight finish.
+func Server(name string, srv *http.Server) Component {
+	return Component{
+		Name:  name,
+		Group: Servers,
+		Start: func(context.Context) error {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		Stop: srv.Shutdown,
+	}
+}
+
+// Coordinator starts components and stops them in order
+type Coordinator struct {
+	deadline   time.Duration
+	logger     *slog.Logger
+	signals    []os.Signal
+	components []Component
+}
+
+// New returns a coordinator allowing the whole shutdown deadline. Each
+// start and stop is logged; logger may be nil for the default logger.
+func New(deadline time.Duration, logger *slog.Logger) *Coordinator {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Coordinator{
+		deadline: deadline,
+		logger:   logger,
+		signals:  []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+	}
+}
+
+// Add registers components. Within a group they stop in the reverse of the
+// order they were added, as deferred calls do.
+func (c *Coordinator) Add(components ...Component) {
+	c.components = append(c.components, components...)
+}
+
+// failure is a component whose Start failed before shutdown
+type failure struct {
+	name string
+	err  error
+}
+
+// Run starts the components and waits for SIGINT, SIGTERM, ctx to be done
+// or a component to fail, then stops every component, group by group,
+// within the deadline. It returns the errors of the components that failed
+// to run or to stop cleanly, nil when all stopped cleanly.
+func (c *Coordinator) Run(ctx context.Context) error {
+	// Each group runs until it stops, not until ctx is done, so that ctx
+	// starts the shutdown rather than cutting every component off at once
+	groupCtx := map[Group]context.Context{}
+	groupCancel := map[Group]context.CancelFunc{}
+	for _, comp := range c.components {
+		if _, ok := groupCtx[comp.Group]; !ok {
+			groupCtx[comp.Group], groupCancel[comp.Group] = context.WithCancel(context.Background())
+		}
+	}
+	defer func() {
+		for _, cancel := range groupCancel {
+			cancel()
+		}
+	}()
+
+	failed := make(chan failure, len(c.components))
+	running := make([]chan struct{}, len(c.components))
+	for i, comp := range c.components {
+		if comp.Start == nil {
+			continue
+		}
+		running[i] = make(chan struct{})
+		runCtx := groupCtx[comp.Group]
+		go func() {
+			defer close(running[i])
+			if err := comp.Start(runCtx); err != nil && runCtx.Err() == nil {
+				failed <- failure{name: comp.Name, err: err}
+			}
+		}()
+	}
+
+	signalCtx, stopSignals := signal.NotifyContext(ctx, c.signals...)
+	defer stopSignals()
+
+	var problems []error
+	select {
+	case <-signalCtx.Done():
+		c.logger.Info("shutting down", "deadline", c.deadline)
+	case f := <-failed:
+		c.logger.Error("component failed, shutting down", "component", f.name, "error", f.err, "deadline", c.deadline)
+		problems = append(problems, fmt.Errorf("%s: %w", f.name, f.err))
+	}
+
+	deadlineCtx, cancel := context.WithTimeout(context.Background(), c.deadline)
+	defer cancel()
+	shutdownStart := time.Now()
+	for _, group := range c.groups() {
+		groupCancel[group]()
+		for i := len(c.components) - 1; i >= 0; i-- {
+			if c.components[i].Group != group {
+				continue
+			}
+			if err := c.stop(deadlineCtx, c.components[i], running[i]); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+
+	// Components that failed while the others were stopping
+	for len(failed) > 0 {
+		f := <-failed
+		problems = append(problems, fmt.Errorf("%s: %w", f.name, f.err))
+	}
+
+	if len(problems) > 0 {
+		c.logger.Error("shutdown finished with errors", "took", time.Since(shutdownStart), "errors", len(problems))
+		return errors.Join(problems...)
+	}
+	c.logger.Info("shutdown finished", "took", time.Since(shutdownStart))
+	return nil
+}
+
+// stop stops a component and waits for its Start to return, unless ctx is
+// done first
+func (c *Coordinator) stop(ctx context.Context, comp Component, running chan struct{}) error {
+	if ctx.Err() != nil {
+		c.logger.Error("component abandoned", "component", comp.Name, "group", comp.Group)
+		return fmt.Errorf("%s: not stopped before the shutdown deadline", comp.Name)
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		if comp.Stop != nil {
+			if err := comp.Stop(ctx); err != nil {
+				done <- err
+				return
+			}
+		}
+		if running != nil {
+			<-running
+		}
+		done <- nil
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("did not stop before the shutdown deadline")
+	}
+	took := time.Since(start)
+	if err != nil {
+		c.logger.Error("component failed to stop", "component", comp.Name, "group", comp.Group, "took", took, "error", err)
+		return fmt.Errorf("%s: %w", comp.Name, err)
+	}
+	c.logger.Info("component stopped", "component", comp.Name, "group", comp.Group, "took", took)
+	return nil
+}
+
+// groups returns the groups of the components in the order they stop
+func (c *Coordinator) groups() []Group {
+	seen := map[Group]bool{}
+	var groups []Group
+	for _, comp := range c.components {
+		if !seen[comp.Group] {
+			seen[comp.Group] = true
+			groups = append(groups, comp.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
@@ -0,0 +1,386 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recorder records the events of fake components in the order they happen
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) all() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// stops returns the names of the components in the order they were stopped
+func (r *recorder) stops() []string {
+	var names []string
+	for _, event := range r.all() {
+		if name, ok := strings.CutPrefix(event, "stop "); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fake returns a component of group running until its context is done,
+// recording its stop and the end of its run
+func (r *recorder) fake(name string, group Group) Component {
+	return Component{
+		Name:  name,
+		Group: group,
+		Start: func(ctx context.Context) error {
+			<-ctx.Done()
+			r.record("end " + name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+// newTestCoordinator returns a coordinator allowing deadline, logging to
+// the returned buffer
+func newTestCoordinator(deadline time.Duration) (*Coordinator, *syncBuffer) {
+	var logs syncBuffer
+	return New(deadline, slog.New(slog.NewTextHandler(&logs, nil))), &logs
+}
+
+// syncBuffer is a buffer safe for the concurrent writes of the logger
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// run runs c until ctx is done, failing the test if it does not return
+// within a few seconds
+func run(t *testing.T, ctx context.Context, c *Coordinator) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+		return nil
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	rec := &recorder{}
+	c, logs := newTestCoordinator(time.Second)
+	// Added out of order, as a main builds them
+	c.Add(
+		Closer("redis", Stores, func() error { rec.record("stop redis"); return nil }),
+		rec.fake("kafka-producer", Producers),
+		rec.fake("consumer", Consumers),
+		rec.fake("http", Servers),
+		Background("cleanup", func(ctx context.Context) { <-ctx.Done(); rec.record("end cleanup") }),
+		rec.fake("refresher", Workers),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := run(t, ctx, c); err != nil {
+		t.Fatalf("Run() = %v, want a clean shutdown", err)
+	}
+
+	// Within a group, the last added stops first
+	want := []string{"http", "consumer", "refresher", "kafka-producer", "redis"}
+	if got := rec.stops(); !slices.Equal(got, want) {
+		t.Errorf("stopped %v, want %v", got, want)
+	}
+
+	// Each group runs until it is stopped, after the groups before it
+	group := map[string]Group{"http": Servers, "consumer": Consumers, "cleanup": Workers,
+		"refresher": Workers, "kafka-producer": Producers, "redis": Stores}
+	events := rec.all()
+	for i := 1; i < len(events); i++ {
+		prev, cur := strings.Fields(events[i-1])[1], strings.Fields(events[i])[1]
+		if group[cur] < group[prev] {
+			t.Errorf("%q after %q, want the %s stopped before the %s", events[i], events[i-1], group[cur], group[prev])
+		}
+	}
+	if !slices.Contains(events, "end cleanup") {
+		t.Errorf("events %v, want the background loop ended", events)
+	}
+
+	for _, want := range []string{"component stopped", "component=kafka-producer", "group=producers", "took=", "shutdown finished"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestDeadlineAbandonsStuckComponents(t *testing.T) {
+	rec := &recorder{}
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+
+	c, _ := newTestCoordinator(50 * time.Millisecond)
+	c.Add(
+		rec.fake("http", Servers),
+		// A producer whose flush ignores its context
+		Component{Name: "kafka-producer", Group: Producers, Stop: func(context.Context) error {
+			<-stuck
+			return nil
+		}},
+		rec.fake("redis", Stores),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := run(t, ctx, c)
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("shutdown took %s, want it held to the 50ms deadline", took)
+	}
+	if err == nil {
+		t.Fatal("Run() = nil, want the stuck components reported")
+	}
+	for _, want := range []string{
+		"kafka-producer: did not stop before the shutdown deadline",
+		"redis: not stopped before the shutdown deadline",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() = %v, want it to report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "http") {
+		t.Errorf("Run() = %v, reports the server stopped in time", err)
+	}
+	if got := rec.stops(); !slices.Equal(got, []string{"http"}) {
+		t.Errorf("stopped %v, want the server alone", got)
+	}
+}
+
+func TestDeadlineWaitsForStartToReturn(t *testing.T) {
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+
+	c, _ := newTestCoordinator(50 * time.Millisecond)
+	// A consumer that ignores its context keeps running once stopped
+	c.Add(Component{Name: "consumer", Group: Consumers, Start: func(context.Context) error {
+		<-stuck
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := run(t, ctx, c)
+	if err == nil || !strings.Contains(err.Error(), "consumer: did not stop before the shutdown deadline") {
+		t.Errorf("Run() = %v, want the consumer reported", err)
+	}
+}
+
+func TestErrorPropagation(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	errBroker := errors.New("broker gone")
+
+	tests := []struct {
+		name  string
+		build func(rec *recorder) []Component
+		want  []string
+	}{
+		{
+			name: "a component failing to stop",
+			build: func(rec *recorder) []Component {
+				return []Component{
+					rec.fake("http", Servers),
+					{Name: "kafka-producer", Group: Producers, Stop: func(context.Context) error { return errFlush }},
+					rec.fake("redis", Stores),
+				}
+			},
+			want: []string{"kafka-producer: flush failed"},
+		},
+		{
+			name: "a component failing while running",
+			build: func(rec *recorder) []Component {
+				return []Component{
+					rec.fake("http", Servers),
+					{Name: "consumer", Group: Consumers, Start: func(context.Context) error { return errBroker }},
+					rec.fake("redis", Stores),
+				}
+			},
+			want: []string{"consumer: broker gone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			c, logs := newTestCoordinator(time.Second)
+			c.Add(tt.build(rec)...)
+
+			// The failing component shuts the service down by itself;
+			// otherwise ctx does
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := run(t, ctx, c)
+			if err == nil {
+				t.Fatal("Run() = nil, want the failure reported")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Run() = %v, want it to report %q", err, want)
+				}
+			}
+			if !errors.Is(err, errFlush) && !errors.Is(err, errBroker) {
+				t.Errorf("Run() = %v, want the component's error wrapped", err)
+			}
+
+			// The other components still stop, in order
+			if got := rec.stops(); !slices.Equal(got, []string{"http", "redis"}) {
+				t.Errorf("stopped %v, want [http redis]", got)
+			}
+			if !strings.Contains(logs.String(), "shutdown finished with errors") {
+				t.Errorf("logs lack the failed shutdown:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestFailureStartsTheShutdown(t *testing.T) {
+	rec := &recorder{}
+	c, logs := newTestCoordinator(time.Second)
+	c.Add(
+		rec.fake("http", Servers),
+		Component{Name: "consumer", Group: Consumers, Start: func(context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return errors.New("broker gone")
+		}},
+	)
+
+	// ctx is never done: the failure alone ends Run
+	err := run(t, context.Background(), c)
+	if err == nil || !strings.Contains(err.Error(), "consumer: broker gone") {
+		t.Errorf("Run() = %v, want the failure reported", err)
+	}
+	if !strings.Contains(logs.String(), "component failed, shutting down") {
+		t.Errorf("logs lack the failure:\n%s", logs)
+	}
+}
+
+func TestErrorsAfterTheStopAreIgnored(t *testing.T) {
+	c, _ := newTestCoordinator(time.Second)
+	// A consumer reporting its context's error when stopped stopped cleanly
+	c.Add(Component{Name: "consumer", Group: Consumers, Start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := run(t, ctx, c); err != nil {
+		t.Errorf("Run() = %v, want a clean shutdown", err)
+	}
+}
+
+func TestSignalShutsDown(t *testing.T) {
+	// Caught here too, so a signal sent before Run listens for it does not
+	// end the test binary
+	caught := make(chan os.Signal, 16)
+	signal.Notify(caught, syscall.SIGTERM)
+	defer signal.Stop(caught)
+
+	rec := &recorder{}
+	c, logs := newTestCoordinator(time.Second)
+	c.Add(rec.fake("http", Servers))
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	// Run starts listening once its components are started, so signal until
+	// it returns
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Run() = %v, want a clean shutdown", err)
+			}
+			if got := rec.stops(); !slices.Equal(got, []string{"http"}) {
+				t.Errorf("stopped %v, want the server", got)
+			}
+			if !strings.Contains(logs.String(), "shutting down") {
+				t.Errorf("logs lack the shutdown:\n%s", logs)
+			}
+			return
+		case <-ticker.C:
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		case <-timeout:
+			t.Fatal("Run did not return on SIGTERM")
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	c, _ := newTestCoordinator(time.Second)
+	c.Add(Server("http", &http.Server{Addr: "127.0.0.1:0"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := run(t, ctx, c); err != nil {
+		t.Errorf("Run() = %v, want the server closed cleanly", err)
+	}
+
+	// A server that cannot listen fails the service
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	c, _ = newTestCoordinator(time.Second)
+	c.Add(Server("http", &http.Server{Addr: taken.Addr().String()}))
+	if err := run(t, context.Background(), c); err == nil || !strings.Contains(err.Error(), "http: listen") {
+		t.Errorf("Run() = %v, want the listen failure reported", err)
+	}
+}
+
+func TestGroupNames(t *testing.T) {
+	for group, want := range map[Group]string{Servers: "servers", Consumers: "consumers", Workers: "workers",
+		Producers: "producers", Stores: "stores", Group(9): "group 9"} {
+		if got := group.String(); got != want {
+			t.Errorf("Group(%d) = %s, want %s", int(group), got, want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/logging
+
+go 1.23.0
+
+require github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo v0.0.0
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo => ../buildinfo
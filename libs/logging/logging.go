@@ -0,0 +1,163 @@
+// Package logging is the structured, leveled logger shared by the services.
+// Records are JSON lines on stderr at the level set by LOG_LEVEL, carrying
+// the service name and version and, when the context they are logged with
+// has them, the transaction, account and correlation IDs. Sensitive values
+// are masked before they are written, as configured by the LOG_REDACT_*
+// variables.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/buildinfo"
+)
+
+// Standard field names
+const (
+	KeyService       = "service"
+	KeyVersion       = "version"
+	KeyTransactionID = "transaction_id"
+	KeyAccountID     = "account_id"
+	KeyCorrelationID = "correlation_id"
+)
+
+// CorrelationHeader is the Kafka header carrying the correlation ID
+const CorrelationHeader = "correlation_id"
+
+// Setup builds the logger for service from LOG_LEVEL and the redaction
+// rules from LOG_REDACT_*, and installs it as the slog default, so output of
+// the standard log package is also written as JSON, at info level. Invalid
+// redaction rules are reported and the default rules kept.
+func Setup(service string) *slog.Logger {
+	redactor, err := LoadRedactor()
+	if err == nil {
+		SetRedactor(redactor)
+	}
+
+	logger := New(os.Stderr, service, ParseLevel(os.Getenv("LOG_LEVEL")))
+	slog.SetDefault(logger)
+	if err != nil {
+		logger.Warn("invalid log redaction rules, using the defaults", "error", err)
+	}
+	return logger
+}
+
+// New creates a JSON logger writing to w at level, masking sensitive values
+func New(w io.Writer, service string, level slog.Leveler) *slog.Logger {
+	handler := redactHandler{contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}}
+	return slog.New(handler).With(KeyService, service, KeyVersion, buildinfo.Version)
+}
+
+// ParseLevel parses debug, info, warn or error, defaulting to info
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type contextKey int
+
+const (
+	transactionKey contextKey = iota
+	correlationKey
+)
+
+// transaction identifies the transaction a context is handling
+type transaction struct {
+	id        string
+	accountID string
+}
+
+// WithTransaction returns a copy of ctx whose log records carry the
+// transaction and account IDs
+func WithTransaction(ctx context.Context, transactionID, accountID string) context.Context {
+	return context.WithValue(ctx, transactionKey, transaction{id: transactionID, accountID: accountID})
+}
+
+// WithCorrelationID returns a copy of ctx whose log records carry the
+// correlation ID
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	if correlationID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey, correlationID)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey).(string)
+	return id
+}
+
+// contextHandler adds the IDs carried by the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if txn, ok := ctx.Value(transactionKey).(transaction); ok {
+			if txn.id != "" {
+				r.AddAttrs(slog.String(KeyTransactionID, txn.id))
+			}
+			if txn.accountID != "" {
+				r.AddAttrs(slog.String(KeyAccountID, txn.accountID))
+			}
+		}
+		if id := CorrelationID(ctx); id != "" {
+			r.AddAttrs(slog.String(KeyCorrelationID, id))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Sampled returns a logger for high-volume paths that keeps one in every n
+// records below warn level. Warnings and errors are always kept.
+func Sampled(logger *slog.Logger, n int) *slog.Logger {
+	if n <= 1 {
+		return logger
+	}
+	return slog.New(&sampledHandler{Handler: logger.Handler(), n: uint64(n), seen: new(atomic.Uint64)})
+}
+
+// sampledHandler drops all but one in n records below warn level
+type sampledHandler struct {
+	slog.Handler
+	n    uint64
+	seen *atomic.Uint64
+}
+
+func (h *sampledHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && (h.seen.Add(1)-1)%h.n != 0 {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sampledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampledHandler{Handler: h.Handler.WithAttrs(attrs), n: h.n, seen: h.seen}
+}
+
+func (h *sampledHandler) WithGroup(name string) slog.Handler {
+	return &sampledHandler{Handler: h.Handler.WithGroup(name), n: h.n, seen: h.seen}
+}
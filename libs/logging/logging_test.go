@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// entries decodes the JSON lines written to buf
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestEntriesCarryTheTransactionID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "processing-service", slog.LevelInfo)
+
+	ctx := WithCorrelationID(WithTransaction(context.Background(), "txn-1", "acct-1"), "corr-1")
+	logger.InfoContext(ctx, "transaction processed")
+	logger.With("partition", 3).InfoContext(ctx, "committed")
+	logger.InfoContext(context.Background(), "consumer started")
+
+	got := entries(t, &buf)
+	if len(got) != 3 {
+		t.Fatalf("%d entries, want 3", len(got))
+	}
+	for _, entry := range got[:2] {
+		if entry[KeyTransactionID] != "txn-1" || entry[KeyAccountID] != "acct-1" || entry[KeyCorrelationID] != "corr-1" {
+			t.Errorf("entry %v, want the transaction, account and correlation IDs", entry)
+		}
+		if entry[KeyService] != "processing-service" || entry[KeyVersion] == nil {
+			t.Errorf("entry %v, want the service and version", entry)
+		}
+	}
+	if got[1]["partition"] != 3.0 {
+		t.Errorf("entry %v, want the logger's own fields kept", got[1])
+	}
+	// Without a transaction in the context there are no empty IDs either
+	for _, key := range []string{KeyTransactionID, KeyAccountID, KeyCorrelationID} {
+		if _, ok := got[2][key]; ok {
+			t.Errorf("entry %v has %s without a transaction", got[2], key)
+		}
+	}
+}
+
+func TestEntriesOmitMissingIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "alert-service", slog.LevelInfo)
+
+	logger.InfoContext(WithTransaction(context.Background(), "txn-1", ""), "alert sent")
+	logger.InfoContext(WithCorrelationID(context.Background(), ""), "alert sent")
+
+	got := entries(t, &buf)
+	if got[0][KeyTransactionID] != "txn-1" {
+		t.Errorf("entry %v, want the transaction ID", got[0])
+	}
+	if _, ok := got[0][KeyAccountID]; ok {
+		t.Errorf("entry %v has an empty account ID", got[0])
+	}
+	if _, ok := got[1][KeyCorrelationID]; ok {
+		t.Errorf("entry %v has an empty correlation ID", got[1])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{" DEBUG ", slog.LevelDebug},
+		{"info", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"verbose", slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		if got := ParseLevel(tt.in); got != tt.want {
+			t.Errorf("ParseLevel(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLevelDropsDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "storage-service", ParseLevel("info"))
+
+	logger.Debug("transaction stored")
+	logger.Info("consumer started")
+
+	got := entries(t, &buf)
+	if len(got) != 1 || got[0]["msg"] != "consumer started" {
+		t.Errorf("entries %v, want only the info entry", got)
+	}
+}
+
+func TestSampledKeepsOneInN(t *testing.T) {
+	var buf bytes.Buffer
+	logger := Sampled(New(&buf, "processing-service", slog.LevelDebug), 10)
+
+	for range 25 {
+		logger.Info("message handled")
+	}
+	logger.Warn("slow commit")
+	logger.With("partition", 1).Info("message handled")
+
+	// Records 1, 11 and 21 are kept, the warning always, and derived loggers
+	// share the count
+	got := entries(t, &buf)
+	if len(got) != 4 || got[3]["level"] != "WARN" {
+		t.Errorf("%d entries %v, want 3 sampled and the warning", len(got), got)
+	}
+	if Sampled(slog.Default(), 1) != slog.Default() {
+		t.Error("a sample rate of 1 wraps the logger")
+	}
+}
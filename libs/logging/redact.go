@@ -0,0 +1,279 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Redacted replaces the value of a redacted field
+const Redacted = "[redacted]"
+
+// Default redaction rules
+const (
+	DefaultRedactFields       = "ip_address,device_info"
+	DefaultRedactMetadataKeys = `(?i)card|pan|cvv|cvc|iban|account_number|ssn|passport|phone|email|ip|device`
+)
+
+// panPattern matches runs of 13 to 19 digits, optionally separated by single
+// spaces or dashes, that may be card numbers
+var panPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// Redactor masks sensitive values before they are logged: fields with the
+// configured names wherever they appear, metadata entries whose key matches
+// a pattern, and digit runs that pass the Luhn check, which may be card
+// numbers, in any string
+type Redactor struct {
+	fields       map[string]bool
+	metadataKeys *regexp.Regexp
+	pans         bool
+}
+
+// NewRedactor creates a redactor masking the named fields and the metadata
+// entries whose key matches metadataKeys, which may be empty, and card
+// numbers when pans is set
+func NewRedactor(fields []string, metadataKeys string, pans bool) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]bool, len(fields)), pans: pans}
+	for _, field := range fields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			r.fields[field] = true
+		}
+	}
+	if metadataKeys != "" {
+		pattern, err := regexp.Compile(metadataKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata key pattern: %w", err)
+		}
+		r.metadataKeys = pattern
+	}
+	return r, nil
+}
+
+// LoadRedactor builds a redactor from LOG_REDACT_FIELDS, a comma-separated
+// list of field names, LOG_REDACT_METADATA_KEYS, a regular expression, and
+// LOG_REDACT_PANS. Each defaults to the default rules when unset; set them
+// to "" or false to turn a rule off.
+func LoadRedactor() (*Redactor, error) {
+	fields, ok := os.LookupEnv("LOG_REDACT_FIELDS")
+	if !ok {
+		fields = DefaultRedactFields
+	}
+	metadataKeys, ok := os.LookupEnv("LOG_REDACT_METADATA_KEYS")
+	if !ok {
+		metadataKeys = DefaultRedactMetadataKeys
+	}
+	pans := true
+	if value := os.Getenv("LOG_REDACT_PANS"); value != "" {
+		var err error
+		if pans, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("LOG_REDACT_PANS: %q is not a boolean", value)
+		}
+	}
+	return NewRedactor(strings.Split(fields, ","), metadataKeys, pans)
+}
+
+// defaultRedactor is the redactor of Redact, RedactString and RedactJSON
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	r, _ := NewRedactor(strings.Split(DefaultRedactFields, ","), DefaultRedactMetadataKeys, true)
+	defaultRedactor.Store(r)
+}
+
+// SetRedactor replaces the redactor used by Redact, RedactString,
+// RedactJSON and the loggers built by New
+func SetRedactor(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// Redact returns v, such as a transaction or a map, with its sensitive
+// values masked, in a form that logs as JSON
+func Redact(v any) any {
+	return defaultRedactor.Load().Redact(v)
+}
+
+// RedactString masks the card numbers in s
+func RedactString(s string) string {
+	return defaultRedactor.Load().RedactString(s)
+}
+
+// RedactJSON returns a JSON document with its sensitive values masked. Data
+// that is not JSON is treated as a string.
+func RedactJSON(data []byte) string {
+	return defaultRedactor.Load().RedactJSON(data)
+}
+
+// Redact returns v with its sensitive values masked. v is converted to its
+// JSON form first, so struct fields are matched by their JSON names.
+func (r *Redactor) Redact(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return r.RedactString(fmt.Sprint(v))
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return r.RedactString(string(data))
+	}
+	return r.redactValue(generic, false)
+}
+
+// RedactJSON returns a JSON document with its sensitive values masked
+func (r *Redactor) RedactJSON(data []byte) string {
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return r.RedactString(string(data))
+	}
+	redacted, err := json.Marshal(r.redactValue(generic, false))
+	if err != nil {
+		return r.RedactString(string(data))
+	}
+	return string(redacted)
+}
+
+// RedactString masks the card numbers in s, keeping their last four digits
+func (r *Redactor) RedactString(s string) string {
+	if !r.pans {
+		return s
+	}
+	return panPattern.ReplaceAllStringFunc(s, func(match string) string {
+		digits := strings.Map(func(c rune) rune {
+			if c >= '0' && c <= '9' {
+				return c
+			}
+			return -1
+		}, match)
+		if len(digits) < 13 || len(digits) > 19 || !luhn(digits) {
+			return match
+		}
+		return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+	})
+}
+
+// redactValue masks a value decoded from JSON. In metadata, entries are also
+// masked by key.
+func (r *Redactor) redactValue(v any, metadata bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch {
+			case r.fields[strings.ToLower(key)]:
+				v[key] = Redacted
+			case metadata && r.metadataKeys != nil && r.metadataKeys.MatchString(key):
+				v[key] = Redacted
+			default:
+				v[key] = r.redactValue(value, strings.EqualFold(key, "metadata"))
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = r.redactValue(value, false)
+		}
+		return v
+	case string:
+		return r.RedactString(v)
+	default:
+		return v
+	}
+}
+
+// redactAttr masks the value of a log attribute
+func (r *Redactor) redactAttr(a slog.Attr) slog.Attr {
+	if r.fields[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.RedactString(value.String()))
+	case slog.KindGroup:
+		attrs := value.Group()
+		redacted := make([]any, len(attrs))
+		for i, attr := range attrs {
+			redacted[i] = r.redactAttr(attr)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(a.Key, r.RedactString(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, r.RedactString(v.String()))
+		default:
+			return slog.Any(a.Key, r.Redact(v))
+		}
+	default:
+		return slog.Attr{Key: a.Key, Value: value}
+	}
+}
+
+// redactHandler masks the message and attributes of each record
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redactor := defaultRedactor.Load()
+	redacted := slog.NewRecord(r.Time, r.Level, redactor.RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactor.redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactor := defaultRedactor.Load()
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactor.redactAttr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+// NewRedactingWriter returns a writer masking the card numbers in what is
+// written to w, for loggers outside slog such as the standard log package.
+// Each write must hold whole lines, as the standard logger's do.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, RedactString(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// luhn reports whether a digit string passes the Luhn check
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
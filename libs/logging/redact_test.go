@@ -0,0 +1,291 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testPAN is a card number passing the Luhn check, as test cards do
+const testPAN = "4111111111111111"
+
+// panForms are the ways testPAN may be written, and its first twelve
+// digits, none of which may be logged
+var panForms = []string{testPAN, "4111 1111 1111 1111", "4111-1111-1111-1111", "411111111111"}
+
+// assertNoPAN fails the test if output holds the test card number in any
+// form
+func assertNoPAN(t *testing.T, output string) {
+	t.Helper()
+	for _, form := range panForms {
+		if strings.Contains(output, form) {
+			t.Errorf("log output holds the card number %q:\n%s", form, output)
+		}
+	}
+}
+
+// unsetenv unsets key for the rest of the test, after t.Setenv has arranged
+// for it to be restored
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	if err := os.Unsetenv(key); err != nil {
+		t.Fatalf("Unsetenv: %v", err)
+	}
+}
+
+// withRedactor installs r as the default redactor for the test
+func withRedactor(t *testing.T, r *Redactor) {
+	t.Helper()
+	previous := defaultRedactor.Load()
+	SetRedactor(r)
+	t.Cleanup(func() { SetRedactor(previous) })
+}
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"card number", "card " + testPAN + " declined", "card ************1111 declined"},
+		{"spaced", "4111 1111 1111 1111", "************1111"},
+		{"dashed", "ref 4111-1111-1111-1111.", "ref ************1111."},
+		{"19 digits", "6011000990139424009 and more", "***************4009 and more"},
+		{"over 19 digits", "41111111111111111115", "41111111111111111115"},
+		{"amex", "378282246310005", "***********0005"},
+		{"failing the Luhn check", "4111111111111112", "4111111111111112"},
+		{"too short", "411111111111", "411111111111"},
+		{"transaction ID", "txn_1700000000123456", "txn_1700000000123456"},
+		{"no digits", "Corner Shop", "Corner Shop"},
+	}
+	r, err := NewRedactor(nil, "", true)
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.RedactString(tt.in); got != tt.want {
+				t.Errorf("RedactString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	off, _ := NewRedactor(nil, "", false)
+	if got := off.RedactString(testPAN); got != testPAN {
+		t.Errorf("RedactString with card numbers off = %q", got)
+	}
+}
+
+// cardTransaction is shaped as the services' transactions are
+type cardTransaction struct {
+	ID         string            `json:"id"`
+	Amount     float64           `json:"amount"`
+	Merchant   string            `json:"merchant"`
+	IPAddress  string            `json:"ip_address"`
+	DeviceInfo string            `json:"device_info"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+func testTransaction() cardTransaction {
+	return cardTransaction{
+		ID:         "txn-1",
+		Amount:     42.5,
+		Merchant:   "ACME REF " + testPAN,
+		IPAddress:  "203.0.113.7",
+		DeviceInfo: "Pixel 9",
+		Metadata: map[string]string{
+			"card_last4": "1111",
+			"Email":      "jane@example.com",
+			"note":       "paid with 4111 1111 1111 1111",
+			"channel":    "web",
+		},
+	}
+}
+
+func TestRedactTransaction(t *testing.T) {
+	r, err := NewRedactor([]string{"IP_Address", " device_info ", ""}, DefaultRedactMetadataKeys, true)
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+
+	got := r.Redact(testTransaction()).(map[string]any)
+	want := map[string]any{
+		"id":          "txn-1",
+		"amount":      42.5,
+		"merchant":    "ACME REF ************1111",
+		"ip_address":  Redacted,
+		"device_info": Redacted,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	metadata := got["metadata"].(map[string]any)
+	wantMetadata := map[string]any{
+		"card_last4": Redacted,
+		"Email":      Redacted,
+		"note":       "paid with ************1111",
+		"channel":    "web",
+	}
+	for key, value := range wantMetadata {
+		if metadata[key] != value {
+			t.Errorf("metadata %s = %v, want %v", key, metadata[key], value)
+		}
+	}
+
+	// Keys matching the metadata pattern are kept outside metadata
+	if got := r.Redact(map[string]any{"channel": "web", "card_last4": "1111"}).(map[string]any); got["card_last4"] != "1111" {
+		t.Errorf("card_last4 outside metadata = %v, want it kept", got["card_last4"])
+	}
+
+	// The value redacted is a copy
+	txn := testTransaction()
+	r.Redact(txn)
+	if txn.IPAddress != "203.0.113.7" || txn.Metadata["card_last4"] != "1111" {
+		t.Errorf("Redact changed the transaction: %+v", txn)
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	data, _ := json.Marshal(testTransaction())
+	got := RedactJSON(data)
+	assertNoPAN(t, got)
+	if strings.Contains(got, "203.0.113.7") || strings.Contains(got, "jane@example.com") {
+		t.Errorf("RedactJSON kept sensitive values: %s", got)
+	}
+	if !json.Valid([]byte(got)) {
+		t.Errorf("RedactJSON = %s, not JSON", got)
+	}
+
+	// Data that is not JSON is masked as a string
+	if got := RedactJSON([]byte("key=" + testPAN)); got != "key=************1111" {
+		t.Errorf("RedactJSON of text = %q", got)
+	}
+}
+
+// stringer logs as a string naming a card
+type stringer struct{}
+
+func (stringer) String() string { return "card " + testPAN }
+
+func TestLoggedCardNumbersAreMasked(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "ingestion-service", slog.LevelDebug)
+	ctx := context.Background()
+
+	logger.InfoContext(ctx, "charge of "+testPAN+" received")
+	logger.InfoContext(ctx, "transaction received", "transaction", testTransaction())
+	logger.InfoContext(ctx, "message consumed", "key", "4111-1111-1111-1111", "ip_address", "203.0.113.7")
+	logger.ErrorContext(ctx, "charge failed", "error", errors.New("card 4111 1111 1111 1111 declined"))
+	logger.DebugContext(ctx, "merchant", "merchant", stringer{})
+	logger.InfoContext(ctx, "grouped", slog.Group("payment", slog.String("pan", testPAN), slog.Int("amount", 12)))
+	logger.With("card", testPAN).WithGroup("request").InfoContext(ctx, "scoped", "metadata", map[string]string{"card_number": testPAN})
+
+	assertNoPAN(t, buf.String())
+	if strings.Contains(buf.String(), "203.0.113.7") {
+		t.Errorf("log output holds the IP address:\n%s", buf.String())
+	}
+	got := entries(t, &buf)
+	if len(got) != 7 {
+		t.Fatalf("%d entries, want 7", len(got))
+	}
+	if got[0]["msg"] != "charge of ************1111 received" {
+		t.Errorf("message %q, want the card number masked to its last four digits", got[0]["msg"])
+	}
+	if txn := got[1]["transaction"].(map[string]any); txn["id"] != "txn-1" || txn["device_info"] != Redacted {
+		t.Errorf("transaction logged as %v", txn)
+	}
+	if got[2]["ip_address"] != Redacted {
+		t.Errorf("ip_address logged as %v", got[2]["ip_address"])
+	}
+	if payment := got[5]["payment"].(map[string]any); payment["amount"] != 12.0 {
+		t.Errorf("group logged as %v, want its other values kept", payment)
+	}
+}
+
+func TestRedactingWriterMasksTheStandardLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewRedactingWriter(&buf), "", 0)
+
+	data, _ := json.Marshal(Redact(testTransaction()))
+	logger.Printf("[collector] New Transaction: %s", data)
+	logger.Printf("[consumer] key %s", testPAN)
+
+	assertNoPAN(t, buf.String())
+	if !strings.Contains(buf.String(), "[consumer] key ************1111\n") {
+		t.Errorf("logged %q, want the line kept with the card masked", buf.String())
+	}
+}
+
+func TestRedactionFollowsTheRules(t *testing.T) {
+	none, err := NewRedactor(nil, "", false)
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	withRedactor(t, none)
+
+	var buf bytes.Buffer
+	New(&buf, "ingestion-service", slog.LevelInfo).Info("received", "ip_address", "203.0.113.7", "card", testPAN)
+	if !strings.Contains(buf.String(), "203.0.113.7") || !strings.Contains(buf.String(), testPAN) {
+		t.Errorf("with redaction off, logged %s", buf.String())
+	}
+}
+
+func TestLoadRedactor(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+		// whether the IP address, a card metadata entry and a card number
+		// are masked
+		ip, metadata, pan bool
+	}{
+		{"defaults", nil, false, true, true, true},
+		{"rules off", map[string]string{"LOG_REDACT_FIELDS": "", "LOG_REDACT_METADATA_KEYS": "", "LOG_REDACT_PANS": "false"}, false, false, false, false},
+		{"own rules", map[string]string{"LOG_REDACT_FIELDS": "merchant", "LOG_REDACT_METADATA_KEYS": "^card"}, false, false, true, true},
+		{"invalid pattern", map[string]string{"LOG_REDACT_METADATA_KEYS": "(card"}, true, false, false, false},
+		{"invalid boolean", map[string]string{"LOG_REDACT_PANS": "sometimes"}, true, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"LOG_REDACT_FIELDS", "LOG_REDACT_METADATA_KEYS", "LOG_REDACT_PANS"} {
+				if value, ok := tt.env[key]; ok {
+					t.Setenv(key, value)
+				} else {
+					// Unset, as opposed to empty
+					t.Setenv(key, "")
+					unsetenv(t, key)
+				}
+			}
+
+			r, err := LoadRedactor()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadRedactor error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := r.Redact(map[string]any{
+				"ip_address": "203.0.113.7",
+				"metadata":   map[string]any{"card_last4": "1111"},
+				"note":       testPAN,
+			}).(map[string]any)
+			if masked := got["ip_address"] == Redacted; masked != tt.ip {
+				t.Errorf("ip_address masked %v, want %v", masked, tt.ip)
+			}
+			if masked := got["metadata"].(map[string]any)["card_last4"] == Redacted; masked != tt.metadata {
+				t.Errorf("card metadata masked %v, want %v", masked, tt.metadata)
+			}
+			if masked := got["note"] != testPAN; masked != tt.pan {
+				t.Errorf("card number masked %v, want %v", masked, tt.pan)
+			}
+		})
+	}
+}
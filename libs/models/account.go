@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Account statuses. Transactions are only accepted on active accounts.
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+)
+
+// ValidAccountStatus reports whether s is an account status
+func ValidAccountStatus(s string) bool {
+	switch s {
+	case AccountStatusActive, AccountStatusFrozen, AccountStatusClosed:
+		return true
+	}
+	return false
+}
+
+// AccountStatusTransitionAllowed reports whether an account may move from
+// one status to another. Active and frozen accounts may be frozen, thawed or
+// closed; a closed account stays closed.
+func AccountStatusTransitionAllowed(from, to string) bool {
+	if !ValidAccountStatus(to) || from == to {
+		return false
+	}
+	return from == AccountStatusActive || from == AccountStatusFrozen
+}
+
+// AccountStatusKey returns the Redis key under which the storage service
+// caches the status of an account for the processing service
+func AccountStatusKey(accountID string) string {
+	return "account_status:" + accountID
+}
+
+// AccountStatusValue encodes the cached status of an account, prefixed with
+// the time it was set in microseconds, so that a write of an older status
+// can be told from a newer one
+func AccountStatusValue(status string, updatedAt time.Time) string {
+	return strconv.FormatInt(updatedAt.UnixMicro(), 10) + ":" + status
+}
+
+// ParseAccountStatusValue returns the status in a value encoded by
+// AccountStatusValue
+func ParseAccountStatusValue(value string) string {
+	if _, status, ok := strings.Cut(value, ":"); ok {
+		return status
+	}
+	return value
+}
+
+// AccountStatusChanged is emitted when an account is created or its status
+// changes. PreviousStatus is empty for a new account.
+type AccountStatusChanged struct {
+	AccountID      string    `json:"account_id"`
+	UserID         string    `json:"user_id"`
+	TenantID       string    `json:"tenant_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	ChangedBy      string    `json:"changed_by"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
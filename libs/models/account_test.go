@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccountStatusTransitions(t *testing.T) {
+	statuses := []string{AccountStatusActive, AccountStatusFrozen, AccountStatusClosed}
+	allowed := map[[2]string]bool{
+		{AccountStatusActive, AccountStatusFrozen}: true,
+		{AccountStatusActive, AccountStatusClosed}: true,
+		{AccountStatusFrozen, AccountStatusActive}: true,
+		{AccountStatusFrozen, AccountStatusClosed}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range append(statuses, "suspended", "") {
+			if got, want := AccountStatusTransitionAllowed(from, to), allowed[[2]string{from, to}]; got != want {
+				t.Errorf("AccountStatusTransitionAllowed(%q, %q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestAccountStatusValue(t *testing.T) {
+	at := time.Date(2026, 3, 2, 12, 0, 0, 123456000, time.UTC)
+	value := AccountStatusValue(AccountStatusFrozen, at)
+	if value != "1772452800123456:frozen" {
+		t.Errorf("AccountStatusValue = %q, want the time in microseconds and the status", value)
+	}
+	if got := ParseAccountStatusValue(value); got != AccountStatusFrozen {
+		t.Errorf("ParseAccountStatusValue(%q) = %q, want frozen", value, got)
+	}
+	// Values cached before the time prefix are the bare status
+	if got := ParseAccountStatusValue(AccountStatusClosed); got != AccountStatusClosed {
+		t.Errorf("ParseAccountStatusValue(closed) = %q, want closed", got)
+	}
+	if got := AccountStatusKey("acct-1"); got != "account_status:acct-1" {
+		t.Errorf("AccountStatusKey = %q", got)
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Alert represents a fraud or operational alert
+type Alert struct {
+	ID              string     `json:"id"`
+	TransactionID   string     `json:"transaction_id"`
+	AccountID       string     `json:"account_id"`
+	UserID          string     `json:"user_id"`
+	TenantID        string     `json:"tenant_id,omitempty"`
+	AlertType       string     `json:"alert_type"`
+	Severity        string     `json:"severity"`
+	RiskScore       float64    `json:"risk_score"`
+	Amount          float64    `json:"amount"`
+	Currency        string     `json:"currency"`
+	Description     string     `json:"description"`
+	RuleTriggered   string     `json:"rule_triggered"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy      string     `json:"resolved_by,omitempty"`
+	ResolutionNotes string     `json:"resolution_notes,omitempty"`
+	AssignedTo      string     `json:"assigned_to,omitempty"`
+	// Suppressed alerts were recorded without notifying because their
+	// account exceeded its alert rate
+	Suppressed bool              `json:"suppressed"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// SourceTopic is the Kafka topic the alert service consumed the alert,
+	// or the transaction raising it, from
+	SourceTopic string `json:"source_topic,omitempty"`
+	// IncidentID is the incident the alert service grouped the alert into
+	// with related alerts
+	IncidentID string `json:"incident_id,omitempty"`
+}
+
+// Constants for alert types
+const (
+	AlertTypeFraud       = "fraud"
+	AlertTypeOperational = "operational"
+	AlertTypeCompliance  = "compliance"
+	AlertTypeRisk        = "risk"
+)
+
+// Constants for alert severity
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Decision stages, the step of processing that decided a transaction
+const (
+	DecisionStageValidation = "validation"
+	DecisionStageBlocklist  = "blocklist"
+	DecisionStageAccount    = "account"
+	DecisionStageRisk       = "risk"
+	// DecisionStageStaleness failed a transaction picked up too long after
+	// it was ingested
+	DecisionStageStaleness = "staleness"
+)
+
+// DecisionAudit records how the processing service decided a transaction:
+// the rules configuration in force, what each matching rule contributed,
+// and the thresholds the score was held against. It is published on the
+// audit topic alongside the processed transaction, and kept append-only by
+// the storage service. A transaction decided again, such as after a
+// redelivery, has one audit per decision.
+type DecisionAudit struct {
+	TransactionID string    `json:"transaction_id"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	DecidedAt     time.Time `json:"decided_at"`
+	Stage         string    `json:"stage"`
+
+	// RulesVersion is a hash of the name, mode and weight of every rule
+	RulesVersion  string             `json:"rules_version"`
+	Contributions []RuleContribution `json:"contributions"`
+	// Noise is the random component of the score, which contributions and
+	// noise sum to before the score is capped at 1
+	Noise      float64            `json:"noise"`
+	RiskScore  float64            `json:"risk_score"`
+	RiskLevel  string             `json:"risk_level,omitempty"`
+	Thresholds DecisionThresholds `json:"thresholds"`
+
+	Decision        string `json:"decision"`
+	RejectionReason string `json:"rejection_reason,omitempty"`
+
+	ProcessorID       string `json:"processor_id"`
+	ProcessorVersion  string `json:"processor_version"`
+	ProcessorInstance string `json:"processor_instance"`
+}
+
+// RuleContribution is a rule that matched a transaction and what it added
+// to the risk score: its weight in enforce mode, nothing in shadow mode
+type RuleContribution struct {
+	Rule         string  `json:"rule"`
+	Mode         string  `json:"mode"`
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+}
+
+// DecisionThresholds are the risk scores deciding a transaction: approved
+// below AutoApprove, rejected above AutoReject, and flagged for review when
+// approved above Flag
+type DecisionThresholds struct {
+	AutoApprove float64 `json:"auto_approve"`
+	Flag        float64 `json:"flag"`
+	AutoReject  float64 `json:"auto_reject"`
+}
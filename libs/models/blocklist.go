@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// Blocklist entry types
+const (
+	BlocklistTypeCountry  = "country"
+	BlocklistTypeMerchant = "merchant"
+	BlocklistTypeAccount  = "account"
+)
+
+// BlocklistEntry blocks transactions from a country, with a merchant or on an
+// account, maintained through the storage service API
+type BlocklistEntry struct {
+	ID        int64      `json:"id"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	Reason    string     `json:"reason"`
+	AddedBy   string     `json:"added_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil never expires
+}
+
+// Active reports whether the entry has not expired at now
+func (e *BlocklistEntry) Active(now time.Time) bool {
+	return e.ExpiresAt == nil || now.Before(*e.ExpiresAt)
+}
+
+// ValidBlocklistType reports whether t is a blocklist entry type
+func ValidBlocklistType(t string) bool {
+	switch t {
+	case BlocklistTypeCountry, BlocklistTypeMerchant, BlocklistTypeAccount:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package models
+
+// Metadata keys known to the pipeline. The ingestion service checks the
+// format of their values, and the processing service enriches transactions
+// with them.
+const (
+	MetadataCountry    = "country"     // ISO 3166-1 alpha-2 code
+	MetadataIPAddress  = "ip_address"  // IPv4 or IPv6 address
+	MetadataDeviceInfo = "device_info" // device fingerprint or description
+	MetadataChannel    = "channel"     // e.g. web, mobile, pos
+	MetadataMCC        = "mcc"         // four-digit merchant category code
+	MetadataTimezone   = "timezone"    // IANA time zone name
+
+	// MetadataTruncated is set to "true" by the ingestion service on
+	// metadata it truncated to fit its limits
+	MetadataTruncated = "metadata_truncated"
+)
+
+// KnownMetadataKeys lists the metadata keys known to the pipeline
+var KnownMetadataKeys = []string{
+	MetadataCountry,
+	MetadataIPAddress,
+	MetadataDeviceInfo,
+	MetadataChannel,
+	MetadataMCC,
+	MetadataTimezone,
+}
+
+// MetadataCountry returns the country in the metadata, or ""
+func (t *Transaction) MetadataCountry() string { return t.Metadata[MetadataCountry] }
+
+// MetadataIPAddress returns the IP address in the metadata, or ""
+func (t *Transaction) MetadataIPAddress() string { return t.Metadata[MetadataIPAddress] }
+
+// MetadataDeviceInfo returns the device info in the metadata, or ""
+func (t *Transaction) MetadataDeviceInfo() string { return t.Metadata[MetadataDeviceInfo] }
+
+// MetadataChannel returns the channel in the metadata, or ""
+func (t *Transaction) MetadataChannel() string { return t.Metadata[MetadataChannel] }
+
+// MetadataMCC returns the merchant category code in the metadata, or ""
+func (t *Transaction) MetadataMCC() string { return t.Metadata[MetadataMCC] }
+
+// MetadataTimezone returns the time zone in the metadata, or ""
+func (t *Transaction) MetadataTimezone() string { return t.Metadata[MetadataTimezone] }
+
+// MetadataWasTruncated reports whether the ingestion service truncated the
+// metadata to fit its limits
+func (t *Transaction) MetadataWasTruncated() bool { return t.Metadata[MetadataTruncated] == "true" }
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// filled fails the test when a field of v, or of a struct it embeds, is
+// zero, so a field added to a model must be added to its fixture
+func filled(t *testing.T, v any) {
+	t.Helper()
+	var check func(val reflect.Value, path string)
+	check = func(val reflect.Value, path string) {
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.Anonymous {
+				check(val.Field(i), path)
+				continue
+			}
+			if val.Field(i).IsZero() {
+				t.Errorf("fixture leaves %s%s zero", path, field.Name)
+			}
+		}
+	}
+	val := reflect.ValueOf(v).Elem()
+	check(val, val.Type().Name()+".")
+}
+
+// relay marshals from, as its producer publishes it, and unmarshals it into
+// to, as its consumer reads it
+func relay(t *testing.T, from, to any) {
+	t.Helper()
+	data, err := json.Marshal(from)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := json.Unmarshal(data, to); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+}
+
+// ingested is a transaction as the ingestion service publishes it, with
+// every field set
+func ingested() Transaction {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	return Transaction{
+		ID:                  "txn-1",
+		IdempotencyKey:      "idem-1",
+		AccountID:           "acct-1",
+		UserID:              "user-1",
+		Amount:              125.5,
+		Currency:            "EUR",
+		Type:                TransactionTypeRefund,
+		Category:            "electronics",
+		Merchant:            "Best Buy #1024",
+		Reference:           "ref-1",
+		Status:              TransactionStatusPending,
+		Timestamp:           at,
+		Metadata:            map[string]string{"channel": "web"},
+		TenantID:            "unit-a",
+		ParentTransactionID: "txn-0",
+		CallbackURL:         "https://merchant.example.com/callbacks",
+		IngestedAt:          at.Add(time.Second),
+	}
+}
+
+// processed is a transaction as the processing service publishes it, with
+// every field set
+func processed() ProcessedTransaction {
+	txn := ingested()
+	txn.Status = TransactionStatusFlagged
+	return ProcessedTransaction{
+		Transaction:        txn,
+		RiskScore:          0.85,
+		RiskLevel:          RiskLevelHigh,
+		IsApproved:         true,
+		RejectionReason:    "velocity",
+		IsValid:            true,
+		ValidationErrors:   []string{"amount: too precise"},
+		CurrencyExponent:   2,
+		BaseCurrency:       "USD",
+		ExchangeRate:       1.08,
+		BaseAmount:         135.54,
+		Country:            "DE",
+		IPAddress:          "203.0.113.7",
+		DeviceInfo:         "iPhone",
+		MerchantNormalized: "best buy",
+		IsRecurring:        true,
+		ProcessedAt:        txn.IngestedAt.Add(time.Second),
+		ProcessingTime:     1500 * time.Microsecond,
+		ProcessorID:        "processor-1",
+		Lane:               "fast",
+		ShadowRiskFactors:  []RiskFactor{{Factor: "night", Weight: 0.1, Description: "at night", Severity: RiskLevelLow}},
+	}
+}
+
+func TestTransactionSurvivesEveryHop(t *testing.T) {
+	// ingestion -> transactions.raw -> processing
+	published := ingested()
+	filled(t, &published)
+	var raw Transaction
+	relay(t, published, &raw)
+	if !reflect.DeepEqual(raw, published) {
+		t.Errorf("processing read %+v, want %+v", raw, published)
+	}
+
+	// processing -> transactions.processed -> storage and alerts
+	out := processed()
+	filled(t, &out)
+	var in ProcessedTransaction
+	relay(t, out, &in)
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("consumers read %+v, want %+v", in, out)
+	}
+
+	// A consumer of transactions.processed reading only the transaction
+	// gets the transaction ingested
+	var inner Transaction
+	relay(t, out, &inner)
+	if !reflect.DeepEqual(inner, out.Transaction) {
+		t.Errorf("transaction read %+v, want %+v", inner, out.Transaction)
+	}
+}
+
+func TestAlertSurvivesTheWire(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	resolved := at.Add(time.Hour)
+	out := Alert{
+		ID:              "alert-1",
+		TransactionID:   "txn-1",
+		AccountID:       "acct-1",
+		UserID:          "user-1",
+		TenantID:        "unit-a",
+		AlertType:       "fraud",
+		Severity:        "high",
+		RiskScore:       0.85,
+		Amount:          125.5,
+		Currency:        "EUR",
+		Description:     "High risk transaction",
+		RuleTriggered:   "risk_threshold",
+		Status:          "resolved",
+		CreatedAt:       at,
+		UpdatedAt:       resolved,
+		ResolvedAt:      &resolved,
+		ResolvedBy:      "ana",
+		ResolutionNotes: "confirmed with the customer",
+		AssignedTo:      "ana",
+		Suppressed:      true,
+		Metadata:        map[string]string{"rule": "risk_threshold"},
+		SourceTopic:     "transactions.processed",
+		IncidentID:      "inc-1",
+	}
+	filled(t, &out)
+
+	var in Alert
+	relay(t, out, &in)
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("alert read %+v, want %+v", in, out)
+	}
+}
+
+func TestValidationSurvivesTheWire(t *testing.T) {
+	out := TransactionValidation{
+		IsValid:  true,
+		Errors:   []ValidationError{{Field: "amount", Code: ValidationCodePrecision, Message: "too precise"}},
+		Warnings: []ValidationWarning{{Field: "country", Code: ValidationCodeBlockedCountry, Message: "watched"}},
+	}
+	filled(t, &out)
+
+	var in TransactionValidation
+	relay(t, out, &in)
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("validation read %+v, want %+v", in, out)
+	}
+}
+
+// jsonNames returns the JSON names of the fields of typ and the structs it
+// embeds, by the fields carrying them
+func jsonNames(typ reflect.Type, names map[string][]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous {
+			jsonNames(field.Type, names)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = append(names[name], typ.Name()+"."+field.Name)
+	}
+}
+
+func TestJSONNamesAreUnique(t *testing.T) {
+	// encoding/json silently drops both fields of a name taken twice at the
+	// same depth, and the outer one of an embedded struct's name wins
+	for _, v := range []any{ProcessedTransaction{}, Alert{}, TransactionValidation{}} {
+		names := map[string][]string{}
+		jsonNames(reflect.TypeOf(v), names)
+		for name, fields := range names {
+			if len(fields) > 1 {
+				t.Errorf("JSON name %q is taken by %v", name, fields)
+			}
+		}
+	}
+}
+
+func TestTransactionIndexesAreCreated(t *testing.T) {
+	statements := strings.Join(TransactionsIndexesSQL(), "\n")
+	for _, index := range []string{
+		IndexTransactionsAccountID, IndexTransactionsUserID, IndexTransactionsStatus, IndexTransactionsTimestamp,
+		IndexTransactionsRiskLevel, IndexTransactionsTenantID, IndexTransactionsParentID, IndexTransactionsMerchant,
+	} {
+		if !strings.Contains(statements, "CREATE INDEX IF NOT EXISTS "+index+" ON transactions") {
+			t.Errorf("index %s is not created", index)
+		}
+	}
+	for _, column := range []string{"account_id", "tenant_id", "parent_transaction_id", "merchant_normalized"} {
+		if !strings.Contains(TransactionsTableSQL, "\n\t\t\t"+column+" ") {
+			t.Errorf("table has no column %s to index", column)
+		}
+	}
+}
+
+func TestMetadataAccessors(t *testing.T) {
+	txn := &Transaction{Metadata: map[string]string{
+		MetadataCountry:    "GB",
+		MetadataIPAddress:  "203.0.113.7",
+		MetadataDeviceInfo: "iPhone 15",
+		MetadataChannel:    "mobile",
+		MetadataMCC:        "5411",
+		MetadataTimezone:   "Europe/London",
+		MetadataTruncated:  "true",
+	}}
+	got := []string{txn.MetadataCountry(), txn.MetadataIPAddress(), txn.MetadataDeviceInfo(),
+		txn.MetadataChannel(), txn.MetadataMCC(), txn.MetadataTimezone()}
+	want := []string{"GB", "203.0.113.7", "iPhone 15", "mobile", "5411", "Europe/London"}
+	if !reflect.DeepEqual(got, want) || !txn.MetadataWasTruncated() {
+		t.Errorf("accessors = %v, truncated %v, want %v and truncated", got, txn.MetadataWasTruncated(), want)
+	}
+
+	// Without metadata every key reads empty
+	empty := &Transaction{}
+	if empty.MetadataCountry() != "" || empty.MetadataTimezone() != "" || empty.MetadataWasTruncated() {
+		t.Error("accessors of a transaction without metadata are not empty")
+	}
+}
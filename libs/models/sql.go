@@ -0,0 +1,69 @@
+package models
+
+// TransactionsTableSQL creates the transactions table, one row per
+// ProcessedTransaction
+const TransactionsTableSQL = `CREATE TABLE IF NOT EXISTS transactions (
+			id VARCHAR(255) PRIMARY KEY,
+			idempotency_key VARCHAR(255) UNIQUE NOT NULL,
+			account_id VARCHAR(255) NOT NULL,
+			user_id VARCHAR(255) NOT NULL,
+			amount DECIMAL(18,3) NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			currency_exponent SMALLINT NOT NULL DEFAULT 2,
+			type VARCHAR(50) NOT NULL,
+			category VARCHAR(100),
+			merchant VARCHAR(255),
+			merchant_normalized VARCHAR(255),
+			is_recurring BOOLEAN NOT NULL DEFAULT false,
+			reference VARCHAR(255),
+			status VARCHAR(50) NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			metadata TEXT,
+			risk_score DECIMAL(3,2),
+			risk_level VARCHAR(20),
+			is_approved BOOLEAN DEFAULT false,
+			rejection_reason TEXT,
+			is_valid BOOLEAN DEFAULT true,
+			validation_errors TEXT[],
+			country VARCHAR(3),
+			ip_address TEXT,
+			device_info TEXT,
+			processed_at TIMESTAMP,
+			processing_time INTERVAL,
+			processor_id VARCHAR(255),
+			shadow_risk_factors JSONB,
+			tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+			parent_transaction_id VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`
+
+// Index names on the transactions table
+const (
+	IndexTransactionsAccountID = "idx_transactions_account_id"
+	IndexTransactionsUserID    = "idx_transactions_user_id"
+	IndexTransactionsStatus    = "idx_transactions_status"
+	IndexTransactionsTimestamp = "idx_transactions_timestamp"
+	IndexTransactionsRiskLevel = "idx_transactions_risk_level"
+	IndexTransactionsTenantID  = "idx_transactions_tenant_id"
+	IndexTransactionsParentID  = "idx_transactions_parent_transaction_id"
+	IndexTransactionsMerchant  = "idx_transactions_merchant_normalized"
+)
+
+// TransactionsIndexesSQL returns the SQL to create the indexes on the
+// transactions table
+func TransactionsIndexesSQL() []string {
+	return []string{
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_timestamp ON transactions(timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_risk_level ON transactions(risk_level)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_tenant_id ON transactions(tenant_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_parent_transaction_id ON transactions(parent_transaction_id) WHERE parent_transaction_id IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_idempotency_key ON transactions(idempotency_key)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_merchant_normalized ON transactions(merchant_normalized, timestamp) WHERE merchant_normalized IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_merchant_trgm ON transactions USING GIN (merchant gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_reference_trgm ON transactions USING GIN (reference gin_trgm_ops)`,
+	}
+}
@@ -0,0 +1,156 @@
+// Package models holds the types that cross service boundaries: the
+// transaction as it moves through the pipeline, the alerts raised on it and
+// the validation results attached to it. Services wrap or alias these types
+// rather than copying them, so producer and consumer agree on every JSON tag.
+package models
+
+import (
+	"time"
+)
+
+// Transaction represents a financial transaction as ingested, before any
+// processing. It is published on transactions.raw.
+type Transaction struct {
+	ID             string            `json:"id"`                  // unique identifier for the transaction
+	IdempotencyKey string            `json:"idempotency_key"`     // idempotency key for deduplication
+	AccountID      string            `json:"account_id"`          // account identifier for Kafka partitioning
+	UserID         string            `json:"user_id"`             // the user who initiated it
+	Amount         float64           `json:"amount"`              // how much money is involved
+	Currency       string            `json:"currency"`            // currency code (e.g., USD, INR)
+	Type           string            `json:"type"`                // transaction type (deposit, withdrawal, transfer, etc.)
+	Category       string            `json:"category"`            // transaction category (e.g., "groceries", "utilities")
+	Merchant       string            `json:"merchant,omitempty"`  // merchant name for card transactions
+	Reference      string            `json:"reference,omitempty"` // external reference number
+	Status         string            `json:"status"`              // transaction status (pending, completed, failed)
+	Timestamp      time.Time         `json:"timestamp"`           // when the transaction happened
+	Metadata       map[string]string `json:"metadata,omitempty"`  // optional extra info (tags, source, notes)
+	TenantID       string            `json:"tenant_id,omitempty"` // business unit owning it; empty is the default tenant
+
+	// ParentTransactionID links a refund to the transaction it refunds. It
+	// is required on refunds and empty otherwise.
+	ParentTransactionID string `json:"parent_transaction_id,omitempty"`
+
+	// CallbackURL is where the storage service posts the outcome of the
+	// transaction once it is stored with a final status. The ingestion
+	// service only accepts URLs on its allowlisted hosts.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// IngestedAt is when the ingestion service accepted the transaction, the
+	// start of the end-to-end pipeline latency. It is zero on transactions
+	// ingested before it was introduced.
+	IngestedAt time.Time `json:"ingested_at"`
+}
+
+// ProcessedTransaction represents a transaction after business logic
+// processing. It is published by the processing service on
+// transactions.processed.
+type ProcessedTransaction struct {
+	Transaction
+	// Processing results
+	RiskScore       float64 `json:"risk_score"`
+	RiskLevel       string  `json:"risk_level"`
+	IsApproved      bool    `json:"is_approved"`
+	RejectionReason string  `json:"rejection_reason,omitempty"`
+
+	// Business validation results
+	IsValid          bool     `json:"is_valid"`
+	ValidationErrors []string `json:"validation_errors,omitempty"`
+
+	// CurrencyExponent is the number of decimal places of the currency's
+	// minor unit, zero when the currency is not in ISO 4217
+	CurrencyExponent int `json:"currency_exponent"`
+
+	// BaseCurrency is the currency the amount thresholds are set in, and
+	// BaseAmount the amount converted into it at ExchangeRate, recorded so
+	// the conversion behind a decision can be audited. They are empty when
+	// no rate converted the amount.
+	BaseCurrency string  `json:"base_currency,omitempty"`
+	ExchangeRate float64 `json:"exchange_rate,omitempty"`
+	BaseAmount   float64 `json:"base_amount,omitempty"`
+
+	// Enrichment data
+	Country    string `json:"country,omitempty"`
+	IPAddress  string `json:"ip_address,omitempty"`
+	DeviceInfo string `json:"device_info,omitempty"`
+
+	// MerchantNormalized is the canonical name of Merchant, which per-merchant
+	// rules and statistics use so that its spellings count as one merchant
+	MerchantNormalized string `json:"merchant_normalized,omitempty"`
+
+	// IsRecurring is set on a charge continuing an established weekly or
+	// monthly pattern of charges like it, such as a subscription
+	IsRecurring bool `json:"is_recurring,omitempty"`
+
+	// Processing metadata
+	ProcessedAt    time.Time     `json:"processed_at"`
+	ProcessingTime time.Duration `json:"processing_time"`
+	ProcessorID    string        `json:"processor_id"`
+
+	// Lane is the processing lane that assessed the risk of the
+	// transaction, empty when it was rejected before
+	Lane string `json:"lane,omitempty"`
+
+	// ShadowRiskFactors are the factors shadow risk rules would have added.
+	// They are recorded for analysis and never affect the risk score,
+	// approval or status.
+	ShadowRiskFactors []RiskFactor `json:"shadow_risk_factors,omitempty"`
+}
+
+// AmountIn returns the amount in base, as converted by the processing
+// service, and false when it was not converted into base
+func (t *ProcessedTransaction) AmountIn(base string) (float64, bool) {
+	if t.Currency == base {
+		return t.Amount, true
+	}
+	if t.BaseCurrency == base && t.ExchangeRate > 0 {
+		return t.BaseAmount, true
+	}
+	return 0, false
+}
+
+// Processing lanes. Fast-lane transactions are assessed without the
+// lookups of the slow lane.
+const (
+	LaneFast = "fast"
+	LaneSlow = "slow"
+)
+
+// RiskFactor is a risk rule that matched a transaction and the weight it
+// adds to the risk score
+type RiskFactor struct {
+	Factor      string  `json:"factor"`
+	Weight      float64 `json:"weight"`
+	Description string  `json:"description"`
+	Severity    string  `json:"severity"`
+}
+
+// Constants for risk levels
+const (
+	RiskLevelLow      = "low"
+	RiskLevelMedium   = "medium"
+	RiskLevelHigh     = "high"
+	RiskLevelCritical = "critical"
+)
+
+// TransactionTypeRefund is the type of a transaction refunding another,
+// named by its ParentTransactionID
+const TransactionTypeRefund = "refund"
+
+// Constants for transaction statuses
+const (
+	TransactionStatusPending  = "pending"
+	TransactionStatusApproved = "approved"
+	TransactionStatusRejected = "rejected"
+	TransactionStatusFlagged  = "flagged"
+	TransactionStatusFailed   = "failed"
+)
+
+// IsFinalStatus reports whether a transaction with status has been decided,
+// every status but pending
+func IsFinalStatus(status string) bool {
+	switch status {
+	case TransactionStatusApproved, TransactionStatusRejected, TransactionStatusFlagged, TransactionStatusFailed:
+		return true
+	}
+	return false
+}
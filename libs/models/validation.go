@@ -0,0 +1,41 @@
+package models
+
+// TransactionValidation represents validation rules and results
+type TransactionValidation struct {
+	IsValid  bool                `json:"is_valid"`
+	Errors   []ValidationError   `json:"errors,omitempty"`
+	Warnings []ValidationWarning `json:"warnings,omitempty"`
+}
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationWarning represents a validation warning
+type ValidationWarning struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Constants for validation codes
+const (
+	ValidationCodeRequiredField   = "REQUIRED_FIELD"
+	ValidationCodeInvalidAmount   = "INVALID_AMOUNT"
+	ValidationCodeInvalidCurrency = "INVALID_CURRENCY"
+	ValidationCodeBlockedCountry  = "BLOCKED_COUNTRY"
+	ValidationCodeBlockedMerchant = "BLOCKED_MERCHANT"
+	ValidationCodeBlockedAccount  = "BLOCKED_ACCOUNT"
+	ValidationCodeExceedsLimit    = "EXCEEDS_LIMIT"
+	ValidationCodeInvalidType     = "INVALID_TYPE"
+	ValidationCodePrecision       = "INVALID_PRECISION"
+	ValidationCodeAccountInactive = "ACCOUNT_INACTIVE"
+
+	// Violations of the policy of a transaction's type
+	ValidationCodeTypeFieldRequired = "TYPE_FIELD_REQUIRED"
+	ValidationCodeExceedsTypeLimit  = "EXCEEDS_TYPE_LIMIT"
+	ValidationCodeExceedsDailyCap   = "EXCEEDS_DAILY_CAP"
+)
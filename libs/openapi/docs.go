@@ -0,0 +1,22 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed docs.html
+var docsHTML string
+
+// docsPage renders the Swagger UI page. The page is built into the binary;
+// the Swagger UI scripts and styles it loads come from the unpkg CDN.
+var docsPage = template.Must(template.New("docs").Parse(docsHTML))
+
+// DocsHandler serves a Swagger UI page browsing the document at specURL
+func DocsHandler(title, specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsPage.Execute(w, struct{ Title, SpecURL string }{title, specURL})
+	}
+}
@@ -0,0 +1,184 @@
+// Package openapi describes a service's HTTP API as an OpenAPI 3 document.
+// Request and response schemas are generated by reflection from the structs
+// the handlers encode and decode, so the document cannot drift from them
+// unnoticed. The document is served as JSON, with a Swagger UI page to browse
+// it.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents
+const Version = "3.0.3"
+
+// bearerScheme is the name of the bearer token security scheme
+const bearerScheme = "bearerAuth"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// types maps each component schema to the Go type it was generated from
+	types map[string]reflect.Type
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the schemas and security schemes referred to by the
+// operations
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how operations authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// PathItem maps the lower-case HTTP methods of a path to their operations
+type PathItem map[string]*Operation
+
+// Operation describes one method of a path
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response describes a response
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType gives the schema of a body in one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// New creates a document for the API of the given title and version
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		types: make(map[string]reflect.Type),
+	}
+}
+
+// Add adds the operation served by method on path, a path in OpenAPI syntax
+// such as /transactions/{id}
+func (d *Document) Add(method, path string, op *Operation) {
+	item := d.Paths[path]
+	if item == nil {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	if op.Responses == nil {
+		op.Responses = make(map[string]*Response)
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Bearer marks an operation as requiring a bearer token
+var Bearer = []map[string][]string{{bearerScheme: {}}}
+
+// JSONBody describes a required JSON request body shaped like v
+func (d *Document) JSONBody(description string, v interface{}) *RequestBody {
+	return &RequestBody{
+		Description: description,
+		Required:    true,
+		Content:     map[string]MediaType{"application/json": {Schema: d.SchemaOf(v)}},
+	}
+}
+
+// JSON describes a JSON response shaped like v
+func (d *Document) JSON(description string, v interface{}) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: d.SchemaOf(v)}},
+	}
+}
+
+// Text describes a plain text response, as written by http.Error
+func Text(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+// Empty describes a response without a body
+func Empty(description string) *Response {
+	return &Response{Description: description}
+}
+
+// PathParam describes a required path parameter
+func PathParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: "string"}}
+}
+
+// QueryParam describes an optional query parameter of the given schema
+func QueryParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// HeaderParam describes a header parameter
+func HeaderParam(name, description string, required bool) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Required: required, Schema: &Schema{Type: "string"}}
+}
+
+// Handler serves the document as JSON. It is encoded once, so every
+// operation must be added before the handler is created.
+func (d *Document) Handler() http.HandlerFunc {
+	body, err := json.Marshal(d)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "failed to encode OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,189 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// Types with a JSON encoding other than their Go kind suggests
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// SchemaOf returns the schema of the JSON encoding of v. Named structs become
+// component schemas, referred to by their type name.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+// schema returns the schema of the JSON encoding of t, following the rules
+// of encoding/json: embedded structs without a JSON name are flattened into
+// their parent, fields tagged "-" are left out, and fields without omitempty
+// are required, as the encoder always writes them
+func (d *Document) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := d.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return d.component(t)
+	default:
+		// Interfaces may hold any value
+		return &Schema{}
+	}
+}
+
+// component registers the schema of a named struct and returns a reference
+// to it. Types of the same name from different packages are told apart by
+// their package name.
+func (d *Document) component(t reflect.Type) *Schema {
+	name := exported(t.Name())
+	if seen, ok := d.types[name]; ok && seen != t {
+		name = pkgName(t) + name
+	}
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.types[name]; ok {
+		return ref
+	}
+
+	// Registered before its fields, so recursive types refer to themselves
+	d.types[name] = t
+	d.Components.Schemas[name] = d.object(t)
+	return ref
+}
+
+// object returns the inline schema of a struct
+func (d *Document) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(s, t)
+	return s
+}
+
+// addFields adds the encoded fields of struct t to s. Fields of t itself
+// are added before those of its embedded structs, and a name already present
+// is not replaced, so shallower fields win as they do in encoding/json.
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+
+		fs := d.schema(ft)
+		if hasOption(opts, "string") && fs.Ref == "" {
+			fs = &Schema{Type: "string", Nullable: fs.Nullable}
+		}
+		s.Properties[name] = fs
+		if !hasOption(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	for _, et := range embedded {
+		d.addFields(s, et)
+	}
+}
+
+// hasOption reports whether a comma-separated list of JSON tag options
+// includes option
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(opts, ",")
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// pkgName returns the last element of the package path of t, capitalized
+func pkgName(t reflect.Type) string {
+	path := t.PkgPath()
+	name := path[strings.LastIndex(path, "/")+1:]
+	return exported(strings.NewReplacer("-", "", ".", "").Replace(name))
+}
+
+// exported returns name with its first letter upper-cased, so unexported
+// types get component names like the exported ones
+func exported(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,112 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string    `json:"note"`
+}
+
+type node struct {
+	Name     string  `json:"name"`
+	Children []*node `json:"children,omitempty"`
+}
+
+type record struct {
+	base
+	Note     string            `json:"note,omitempty"`
+	Amount   float64           `json:"amount"`
+	Count    int64             `json:"count,string"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Parent   *string           `json:"parent"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Payload  []byte            `json:"payload,omitempty"`
+	Tree     *node             `json:"tree,omitempty"`
+	Internal string            `json:"-"`
+	Untagged bool
+	hidden   int
+}
+
+func TestSchemaFollowsEncodingJSON(t *testing.T) {
+	d := New("Test API", "1.0", "")
+	ref := d.SchemaOf(record{})
+	if ref.Ref != "#/components/schemas/Record" {
+		t.Fatalf("SchemaOf(record{}) = %+v, want a reference to Record", ref)
+	}
+	s := d.Components.Schemas["Record"]
+
+	tests := []struct {
+		property string
+		want     Schema
+	}{
+		{"id", Schema{Type: "string"}},
+		{"created_at", Schema{Type: "string", Format: "date-time"}},
+		// The field of the outer struct wins over the embedded one
+		{"note", Schema{Type: "string"}},
+		{"amount", Schema{Type: "number", Format: "double"}},
+		{"count", Schema{Type: "string"}},
+		{"tags", Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		{"labels", Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}},
+		{"parent", Schema{Type: "string", Nullable: true}},
+		{"raw", Schema{}},
+		{"payload", Schema{Type: "string", Format: "byte"}},
+		{"tree", Schema{Ref: "#/components/schemas/Node"}},
+		{"Untagged", Schema{Type: "boolean"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			if got := s.Properties[tt.property]; got == nil || !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("%s = %+v, want %+v", tt.property, got, tt.want)
+			}
+		})
+	}
+
+	if len(s.Properties) != len(tests) {
+		t.Errorf("%d properties, want %d: %v", len(s.Properties), len(tests), s.Properties)
+	}
+	wantRequired := []string{"amount", "count", "parent", "Untagged", "id", "created_at"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("required %v, want %v", s.Required, wantRequired)
+	}
+
+	// A recursive type refers to itself
+	children := d.Components.Schemas["Node"].Properties["children"]
+	if children.Items == nil || children.Items.Ref != "#/components/schemas/Node" {
+		t.Errorf("children = %+v, want an array of Node", children)
+	}
+}
+
+func TestSchemaOfInlineTypes(t *testing.T) {
+	d := New("Test API", "1.0", "")
+	tests := []struct {
+		name  string
+		value interface{}
+		want  Schema
+	}{
+		{"int", 0, Schema{Type: "integer", Format: "int32"}},
+		{"uint64", uint64(0), Schema{Type: "integer", Format: "int64"}},
+		{"float32", float32(0), Schema{Type: "number", Format: "float"}},
+		{"map", map[string]int{}, Schema{Type: "object", AdditionalProperties: &Schema{Type: "integer", Format: "int32"}}},
+		{"anonymous struct", struct {
+			OK bool `json:"ok"`
+		}{}, Schema{Type: "object", Properties: map[string]*Schema{"ok": {Type: "boolean"}}, Required: []string{"ok"}}},
+		{"interface", []interface{}{}, Schema{Type: "array", Items: &Schema{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.SchemaOf(tt.value); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("SchemaOf(%T) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+	if len(d.Components.Schemas) != 0 {
+		t.Errorf("inline types registered components %v", d.Components.Schemas)
+	}
+}
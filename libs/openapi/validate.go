@@ -0,0 +1,155 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ValidateResponse checks that body, a JSON response to method on path with
+// the given status, matches the schema the document gives it
+func (d *Document) ValidateResponse(method, path, status string, body []byte) error {
+	op := d.Paths[path][strings.ToLower(method)]
+	if op == nil {
+		return fmt.Errorf("no operation %s %s", method, path)
+	}
+	response := op.Responses[status]
+	if response == nil {
+		return fmt.Errorf("%s %s: no %s response", method, path, status)
+	}
+	media, ok := response.Content["application/json"]
+	if !ok {
+		return fmt.Errorf("%s %s: %s response has no JSON body", method, path, status)
+	}
+	return d.Validate(media.Schema, body)
+}
+
+// ValidateRequest checks that body, a JSON request to method on path,
+// matches the schema of its request body
+func (d *Document) ValidateRequest(method, path string, body []byte) error {
+	op := d.Paths[path][strings.ToLower(method)]
+	if op == nil {
+		return fmt.Errorf("no operation %s %s", method, path)
+	}
+	if op.RequestBody == nil {
+		return fmt.Errorf("%s %s: no request body", method, path)
+	}
+	return d.Validate(op.RequestBody.Content["application/json"].Schema, body)
+}
+
+// Validate checks that body is JSON matching s. It covers the parts of the
+// schema the document generates: types, formats of integers, required and
+// unknown properties, nullable values and enums.
+func (d *Document) Validate(s *Schema, body []byte) error {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return d.validate(s, v, "$")
+}
+
+// validate checks v, decoded with numbers kept as json.Number, against s;
+// at names v in errors
+func (d *Document) validate(s *Schema, v interface{}, at string) error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		s = resolved
+	}
+	if v == nil {
+		if s.Type == "" || s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null, want %s", at, s.Type)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %T, want a boolean", at, v)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: %T, want an integer", at, v)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: %s, want an integer", at, n)
+		}
+		if s.Format == "int32" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("%s: %d out of the int32 range", at, i)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("%s: %T, want a number", at, v)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: %T, want a string", at, v)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q not one of %v", at, str, s.Enum)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %T, want an array", at, v)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %T, want an object", at, v)
+		}
+		return d.validateObject(s, obj, at)
+	default:
+		return fmt.Errorf("%s: unknown schema type %s", at, s.Type)
+	}
+	return nil
+}
+
+// validateObject checks the properties of obj against s. Properties s does
+// not list are refused unless it allows additional properties, so fields a
+// handler writes without describing them are caught.
+func (d *Document) validateObject(s *Schema, obj map[string]interface{}, at string) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %s", at, name)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ps, ok := s.Properties[name]
+		if !ok {
+			ps = s.AdditionalProperties
+		}
+		if ps == nil {
+			return fmt.Errorf("%s: unknown property %s", at, name)
+		}
+		if err := d.validate(ps, obj[name], at+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
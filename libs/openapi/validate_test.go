@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type status struct {
+	State string `json:"state"`
+}
+
+type reply struct {
+	ID      string            `json:"id"`
+	Count   int               `json:"count"`
+	Score   float64           `json:"score,omitempty"`
+	Parent  *string           `json:"parent"`
+	Items   []status          `json:"items,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// testDocument returns a document with one operation, taking and returning
+// a reply
+func testDocument() *Document {
+	d := New("Test API", "1.0", "")
+	d.Add("POST", "/replies/{id}", &Operation{
+		Summary:     "Post a reply",
+		Parameters:  []Parameter{PathParam("id", "The reply")},
+		RequestBody: d.JSONBody("The reply", reply{}),
+		Responses: map[string]*Response{
+			"201": d.JSON("Created", reply{}),
+			"204": Empty("Unchanged"),
+			"400": Text("Invalid reply"),
+		},
+	})
+	d.Components.Schemas["Status"].Properties["state"].Enum = []string{"open", "closed"}
+	return d
+}
+
+func TestValidate(t *testing.T) {
+	d := testDocument()
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{"valid", `{"id":"r-1","count":2,"parent":null}`, ""},
+		{"every field", `{"id":"r-1","count":2,"score":0.5,"parent":"r-0","items":[{"state":"open"}],"details":{"a":"b"}}`, ""},
+		{"missing required property", `{"id":"r-1","parent":null}`, "$: missing required property count"},
+		{"unknown property", `{"id":"r-1","count":2,"parent":null,"extra":1}`, "$: unknown property extra"},
+		{"wrong type", `{"id":7,"count":2,"parent":null}`, "$.id: json.Number, want a string"},
+		{"fraction for an integer", `{"id":"r-1","count":2.5,"parent":null}`, "$.count: 2.5, want an integer"},
+		{"integer out of range", `{"id":"r-1","count":4294967296,"parent":null}`, "$.count: 4294967296 out of the int32 range"},
+		{"null not nullable", `{"id":null,"count":2,"parent":null}`, "$.id: null, want string"},
+		{"value outside the enum", `{"id":"r-1","count":2,"parent":null,"items":[{"state":"lost"}]}`, `$.items[0].state: "lost" not one of [open closed]`},
+		{"wrong additional property", `{"id":"r-1","count":2,"parent":null,"details":{"a":1}}`, "$.details.a: json.Number, want a string"},
+		{"not an object", `[]`, "$: []interface {}, want an object"},
+		{"invalid JSON", `{"id":`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.ValidateResponse("POST", "/replies/{id}", "201", []byte(tt.body))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("ValidateResponse: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("ValidateResponse = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if err := d.ValidateRequest("post", "/replies/{id}", []byte(`{"id":"r-1","count":2,"parent":null}`)); err != nil {
+		t.Errorf("ValidateRequest: %v", err)
+	}
+}
+
+func TestValidateUndescribedResponses(t *testing.T) {
+	d := testDocument()
+	tests := []struct {
+		name, method, path, status string
+		err                        string
+	}{
+		{"unknown path", "GET", "/replies", "200", "no operation GET /replies"},
+		{"unknown method", "DELETE", "/replies/{id}", "204", "no operation DELETE /replies/{id}"},
+		{"unknown status", "POST", "/replies/{id}", "500", "no 500 response"},
+		{"empty response", "POST", "/replies/{id}", "204", "204 response has no JSON body"},
+		{"text response", "POST", "/replies/{id}", "400", "400 response has no JSON body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.ValidateResponse(tt.method, tt.path, tt.status, []byte(`{}`))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ValidateResponse = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestHandlerServesTheDocument(t *testing.T) {
+	d := testDocument()
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`"openapi":"3.0.3"`,
+		`"/replies/{id}":{"post":`,
+		`"$ref":"#/components/schemas/Reply"`,
+		`"bearerAuth":{"type":"http","scheme":"bearer","bearerFormat":"JWT"}`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("document lacks %s", want)
+		}
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	DocsHandler("Test <API>", "/openapi.json").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET /docs = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "/openapi.json") || !strings.Contains(body, "Test &lt;API&gt;") {
+		t.Errorf("page neither points at the document nor escapes the title:\n%s", body)
+	}
+}
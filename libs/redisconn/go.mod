@@ -0,0 +1,14 @@
+module github.com/Harsh5840/real-time-tx-monitoring/libs/redisconn
+
+go 1.23.0
+
+require github.com/redis/go-redis/v9 v9.3.1
+
+require github.com/Harsh5840/real-time-tx-monitoring/libs/secrets v0.0.0
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
+
+replace github.com/Harsh5840/real-time-tx-monitoring/libs/secrets => ../secrets
@@ -0,0 +1,188 @@
+// Package redisconn configures how the services connect to Redis: a single
+// node by default, or through Sentinel or a Redis Cluster as production
+// requires. Every mode yields a redis.UniversalClient, so the same helpers
+// serve all three; helpers touching several keys in one command must keep
+// them in one hash slot to work against a cluster.
+package redisconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/secrets"
+	"github.com/redis/go-redis/v9"
+)
+
+// Modes
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+// HealthInterval is how often the services ping Redis to report whether it
+// is reachable
+const HealthInterval = 5 * time.Second
+
+// Config holds the Redis connection settings
+type Config struct {
+	Mode     string
+	Password string
+
+	// Addr and DB are those of the single node. A sentinel-managed master
+	// also uses DB; a cluster has only database 0.
+	Addr string
+	DB   int
+
+	// MasterName is the master the sentinels at SentinelAddrs monitor
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+
+	// ClusterAddrs seed the cluster's node discovery
+	ClusterAddrs []string
+
+	// loadErr is a failure to read the environment, returned by Validate
+	loadErr error
+}
+
+// LoadConfig reads the Redis settings from the environment. The passwords
+// may be given as files through REDIS_PASSWORD_FILE and
+// REDIS_SENTINEL_PASSWORD_FILE.
+func LoadConfig() Config {
+	var errs []error
+	password, err := secrets.Lookup("REDIS_PASSWORD")
+	errs = append(errs, err)
+	sentinelPassword, err := secrets.Lookup("REDIS_SENTINEL_PASSWORD")
+	errs = append(errs, err)
+
+	db := 0
+	if value := os.Getenv("REDIS_DB"); value != "" {
+		if db, err = strconv.Atoi(value); err != nil {
+			errs = append(errs, fmt.Errorf("REDIS_DB: %q is not an integer", value))
+		}
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("REDIS_MODE")))
+	if mode == "" {
+		mode = ModeSingle
+	}
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	return Config{
+		Mode:             mode,
+		Password:         password,
+		Addr:             addr,
+		DB:               db,
+		MasterName:       os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelAddrs:    splitAddrs(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		SentinelPassword: sentinelPassword,
+		ClusterAddrs:     splitAddrs(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		loadErr:          errors.Join(errs...),
+	}
+}
+
+// String describes the settings without the passwords
+func (c Config) String() string {
+	switch c.Mode {
+	case ModeSentinel:
+		return fmt.Sprintf("mode=%s master=%s sentinels=%s db=%d",
+			c.Mode, c.MasterName, strings.Join(c.SentinelAddrs, ","), c.DB)
+	case ModeCluster:
+		return fmt.Sprintf("mode=%s nodes=%s", c.Mode, strings.Join(c.ClusterAddrs, ","))
+	default:
+		return fmt.Sprintf("mode=%s addr=%s db=%d", c.Mode, c.Addr, c.DB)
+	}
+}
+
+// Validate checks that the settings of the mode are complete
+func (c Config) Validate() error {
+	problems := []error{c.loadErr}
+	switch c.Mode {
+	case ModeSingle:
+		if c.Addr == "" {
+			problems = append(problems, errors.New("REDIS_ADDR must be set in single mode"))
+		}
+	case ModeSentinel:
+		if c.MasterName == "" || len(c.SentinelAddrs) == 0 {
+			problems = append(problems, errors.New("REDIS_SENTINEL_MASTER and REDIS_SENTINEL_ADDRS must be set in sentinel mode"))
+		}
+	case ModeCluster:
+		if len(c.ClusterAddrs) == 0 {
+			problems = append(problems, errors.New("REDIS_CLUSTER_ADDRS must be set in cluster mode"))
+		}
+		if c.DB != 0 {
+			problems = append(problems, errors.New("REDIS_DB must be 0 in cluster mode"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("REDIS_MODE: %q is not single, sentinel or cluster", c.Mode))
+	}
+	if c.DB < 0 {
+		problems = append(problems, errors.New("REDIS_DB must not be negative"))
+	}
+	return errors.Join(problems...)
+}
+
+// NewClient builds the client of the mode. It does not connect; the client
+// dials on first use and, through Sentinel or the cluster, follows the
+// master as it fails over. Commands honour the deadline of their context, so
+// callers may bound them more tightly than the connection timeouts.
+func (c Config) NewClient() redis.UniversalClient {
+	switch c.Mode {
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    c.SentinelAddrs,
+			SentinelPassword: c.SentinelPassword,
+			Password:         c.Password,
+			DB:               c.DB,
+
+			ContextTimeoutEnabled: true,
+		})
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    c.ClusterAddrs,
+			Password: c.Password,
+
+			ContextTimeoutEnabled: true,
+		})
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:     c.Addr,
+			Password: c.Password,
+			DB:       c.DB,
+
+			ContextTimeoutEnabled: true,
+		})
+	}
+}
+
+// Ping checks that Redis answers. A cluster answers only when every master
+// does, since each holds a share of the keys.
+func Ping(ctx context.Context, client redis.UniversalClient) error {
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return master.Ping(ctx).Err()
+		})
+	}
+	return client.Ping(ctx).Err()
+}
+
+// splitAddrs splits a comma-separated address list, dropping empty entries
+func splitAddrs(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,174 @@
+package redisconn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// setEnv sets the variables for the test, unsetting every other Redis
+// variable LoadConfig reads
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{
+		"REDIS_MODE", "REDIS_ADDR", "REDIS_DB", "REDIS_PASSWORD", "REDIS_PASSWORD_FILE",
+		"REDIS_SENTINEL_MASTER", "REDIS_SENTINEL_ADDRS", "REDIS_SENTINEL_PASSWORD",
+		"REDIS_SENTINEL_PASSWORD_FILE", "REDIS_CLUSTER_ADDRS",
+	} {
+		t.Setenv(key, env[key])
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Config
+	}{
+		{
+			name: "defaults",
+			env:  nil,
+			want: Config{Mode: ModeSingle, Addr: "localhost:6379"},
+		},
+		{
+			name: "single",
+			env:  map[string]string{"REDIS_ADDR": "redis:6380", "REDIS_DB": "2", "REDIS_PASSWORD": "secret"},
+			want: Config{Mode: ModeSingle, Addr: "redis:6380", DB: 2, Password: "secret"},
+		},
+		{
+			name: "sentinel",
+			env: map[string]string{
+				"REDIS_MODE":                   " Sentinel ",
+				"REDIS_SENTINEL_MASTER":        "mymaster",
+				"REDIS_SENTINEL_ADDRS":         "sentinel-1:26379, sentinel-2:26379,,",
+				"REDIS_SENTINEL_PASSWORD_FILE": passwordFile,
+			},
+			want: Config{
+				Mode:             ModeSentinel,
+				Addr:             "localhost:6379",
+				MasterName:       "mymaster",
+				SentinelAddrs:    []string{"sentinel-1:26379", "sentinel-2:26379"},
+				SentinelPassword: "from-file",
+			},
+		},
+		{
+			name: "cluster",
+			env:  map[string]string{"REDIS_MODE": "cluster", "REDIS_CLUSTER_ADDRS": "node-1:7000,node-2:7000"},
+			want: Config{Mode: ModeCluster, Addr: "localhost:6379", ClusterAddrs: []string{"node-1:7000", "node-2:7000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			got := LoadConfig()
+			if err := got.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"unknown mode", map[string]string{"REDIS_MODE": "replicated"}, []string{`REDIS_MODE: "replicated"`}},
+		{"sentinel without master", map[string]string{"REDIS_MODE": "sentinel", "REDIS_SENTINEL_ADDRS": "s:26379"}, []string{"REDIS_SENTINEL_MASTER and REDIS_SENTINEL_ADDRS"}},
+		{"sentinel without sentinels", map[string]string{"REDIS_MODE": "sentinel", "REDIS_SENTINEL_MASTER": "mymaster"}, []string{"REDIS_SENTINEL_MASTER and REDIS_SENTINEL_ADDRS"}},
+		{"cluster without nodes", map[string]string{"REDIS_MODE": "cluster"}, []string{"REDIS_CLUSTER_ADDRS must be set"}},
+		{"cluster database", map[string]string{"REDIS_MODE": "cluster", "REDIS_CLUSTER_ADDRS": "n:7000", "REDIS_DB": "1"}, []string{"REDIS_DB must be 0"}},
+		{"malformed database", map[string]string{"REDIS_DB": "one"}, []string{`REDIS_DB: "one"`}},
+		{"negative database", map[string]string{"REDIS_DB": "-1"}, []string{"REDIS_DB must not be negative"}},
+		{"unreadable password", map[string]string{"REDIS_PASSWORD_FILE": "/nonexistent/password"}, []string{"REDIS_PASSWORD_FILE"}},
+		{
+			"every problem at once",
+			map[string]string{"REDIS_MODE": "cluster", "REDIS_DB": "-1", "REDIS_SENTINEL_PASSWORD_FILE": "/nonexistent/password"},
+			[]string{"REDIS_SENTINEL_PASSWORD_FILE", "REDIS_CLUSTER_ADDRS must be set", "REDIS_DB must be 0", "REDIS_DB must not be negative"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			err := LoadConfig().Validate()
+			if err == nil {
+				t.Fatal("Validate accepted the configuration")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStringOmitsPasswords(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Mode: ModeSingle, Addr: "redis:6379", DB: 1, Password: "p1"}, "mode=single addr=redis:6379 db=1"},
+		{Config{Mode: ModeSentinel, MasterName: "mymaster", SentinelAddrs: []string{"s1:26379", "s2:26379"}, Password: "p1", SentinelPassword: "p2"},
+			"mode=sentinel master=mymaster sentinels=s1:26379,s2:26379 db=0"},
+		{Config{Mode: ModeCluster, ClusterAddrs: []string{"n1:7000", "n2:7000"}, Password: "p1"}, "mode=cluster nodes=n1:7000,n2:7000"},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.String(); got != tt.want {
+			t.Errorf("String = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNewClientOfEachMode(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Mode: ModeSingle, Addr: "127.0.0.1:1"}, "*redis.Client"},
+		{Config{Mode: ModeSentinel, MasterName: "mymaster", SentinelAddrs: []string{"127.0.0.1:1"}}, "*redis.Client"},
+		{Config{Mode: ModeCluster, ClusterAddrs: []string{"127.0.0.1:1"}}, "*redis.ClusterClient"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cfg.Mode, func(t *testing.T) {
+			client := tt.cfg.NewClient()
+			defer client.Close()
+			if got := reflect.TypeOf(client).String(); got != tt.want {
+				t.Errorf("client %s, want %s", got, tt.want)
+			}
+
+			// Nothing listens; Ping reports it rather than hanging
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := Ping(ctx, client); err == nil {
+				t.Error("Ping of an unreachable Redis succeeded")
+			}
+		})
+	}
+}
+
+// Sentinel clients are failover clients, following the master the sentinels
+// name rather than a fixed address
+func TestSentinelClientFollowsTheMaster(t *testing.T) {
+	client := Config{Mode: ModeSentinel, MasterName: "mymaster", SentinelAddrs: []string{"127.0.0.1:1"}, DB: 3}.NewClient()
+	defer client.Close()
+	opts := client.(*redis.Client).Options()
+	if opts.Addr != "FailoverClient" || opts.DB != 3 {
+		t.Errorf("options addr %q db %d, want a failover client of database 3", opts.Addr, opts.DB)
+	}
+}
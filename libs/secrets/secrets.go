@@ -0,0 +1,87 @@
+// Package secrets reads secrets from the environment or from files, as
+// Kubernetes mounts them. A variable KEY may instead be given as KEY_FILE,
+// naming a file that holds the value; an explicit KEY takes precedence.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileSuffix is appended to a variable name to give the file variant
+const FileSuffix = "_FILE"
+
+// Lookup returns the value of key, read from the file named by key_FILE when
+// key itself is unset. It returns "" when neither is set, and an error when
+// the file cannot be read.
+func Lookup(key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(key + FileSuffix)
+	if path == "" {
+		return "", nil
+	}
+	value, err := ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s%s: %w", key, FileSuffix, err)
+	}
+	return value, nil
+}
+
+// File returns the file key is read from, or "" when key is set directly or
+// has no file variant
+func File(key string) string {
+	if os.Getenv(key) != "" {
+		return ""
+	}
+	return os.Getenv(key + FileSuffix)
+}
+
+// ReadFile reads a secret file, trimming surrounding whitespace
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Watch polls the secret file every interval until ctx is cancelled, calling
+// onChange with the new value whenever the contents change. Contents are
+// compared rather than modification times because Kubernetes rotates a
+// mounted secret by swapping a symlink. A read failure, such as a rotation
+// caught halfway, is logged and retried on the next poll; an empty file is
+// ignored the same way.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func(string)) {
+	current, err := ReadFile(path)
+	if err != nil {
+		log.Printf("secret watch %s: %v", path, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		value, err := ReadFile(path)
+		if err != nil {
+			log.Printf("secret watch %s: %v", path, err)
+			continue
+		}
+		if value == "" || value == current {
+			continue
+		}
+		current = value
+		log.Printf("Secret file %s changed, reloading", path)
+		onChange(value)
+	}
+}
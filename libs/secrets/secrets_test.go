@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSecret writes value to a file in dir and returns its path
+func writeSecret(t *testing.T, dir, name, value string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLookup(t *testing.T) {
+	file := writeSecret(t, t.TempDir(), "password", "  from-file\n")
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name    string
+		value   string
+		file    string
+		want    string
+		wantErr string
+	}{
+		{name: "neither set"},
+		{name: "value only", value: "from-env", want: "from-env"},
+		{name: "file only, trimmed", file: file, want: "from-file"},
+		{name: "explicit value beats the file", value: "from-env", file: file, want: "from-env"},
+		{name: "explicit value hides a missing file", value: "from-env", file: missing, want: "from-env"},
+		{name: "missing file", file: missing, wantErr: "DB_PASSWORD_FILE: failed to read secret file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_PASSWORD", tt.value)
+			t.Setenv("DB_PASSWORD_FILE", tt.file)
+
+			got, err := Lookup("DB_PASSWORD")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Lookup = %q, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Lookup = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_SECRET_FILE", "/run/secrets/jwt")
+	if got := File("JWT_SECRET"); got != "/run/secrets/jwt" {
+		t.Errorf("File = %q, want the file variant", got)
+	}
+
+	// Only a secret read from a file is worth watching
+	t.Setenv("JWT_SECRET", "explicit")
+	if got := File("JWT_SECRET"); got != "" {
+		t.Errorf("File with an explicit value = %q, want none", got)
+	}
+}
+
+// watch starts Watch on path and returns the values it reports
+func watch(t *testing.T, path string) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, path, 5*time.Millisecond, func(value string) { changes <- value })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return changes
+}
+
+// expectChange waits for the next value Watch reports
+func expectChange(t *testing.T, changes <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-changes:
+		if got != want {
+			t.Errorf("onChange(%q), want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no change reported, want %q", want)
+	}
+}
+
+// expectQuiet checks Watch reports nothing for a few polls
+func expectQuiet(t *testing.T, changes <-chan string) {
+	t.Helper()
+	select {
+	case got := <-changes:
+		t.Errorf("onChange(%q), want no call", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchReportsRewrites(t *testing.T) {
+	dir := t.TempDir()
+	path := writeSecret(t, dir, "jwt", "first")
+	changes := watch(t, path)
+
+	// Unchanged contents, even rewritten or with new whitespace, are not a change
+	expectQuiet(t, changes)
+	writeSecret(t, dir, "jwt", "first\n")
+	expectQuiet(t, changes)
+
+	writeSecret(t, dir, "jwt", "second")
+	expectChange(t, changes, "second")
+}
+
+func TestWatchFollowsSymlinkSwaps(t *testing.T) {
+	// Kubernetes mounts each secret as a symlink into a versioned directory
+	// and rotates it by repointing the link
+	dir := t.TempDir()
+	first := writeSecret(t, dir, "v1", "first")
+	second := writeSecret(t, dir, "v2", "second")
+	path := filepath.Join(dir, "jwt")
+	if err := os.Symlink(first, path); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	changes := watch(t, path)
+	expectQuiet(t, changes)
+
+	swap := filepath.Join(dir, "jwt.tmp")
+	if err := os.Symlink(second, swap); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if err := os.Rename(swap, path); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	expectChange(t, changes, "second")
+}
+
+func TestWatchIgnoresRotationsCaughtHalfway(t *testing.T) {
+	dir := t.TempDir()
+	path := writeSecret(t, dir, "jwt", "first")
+	changes := watch(t, path)
+
+	writeSecret(t, dir, "jwt", "  \n")
+	expectQuiet(t, changes)
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	expectQuiet(t, changes)
+
+	writeSecret(t, dir, "jwt", "second")
+	expectChange(t, changes, "second")
+}
+
+func TestWatchStartsWithoutTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt")
+	changes := watch(t, path)
+	expectQuiet(t, changes)
+
+	writeSecret(t, filepath.Dir(path), "jwt", "first")
+	expectChange(t, changes, "first")
+}
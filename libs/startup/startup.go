@@ -0,0 +1,105 @@
+// Package startup holds a service back until the dependencies it cannot run
+// without answer. Services started together, as by docker-compose, come up
+// in any order: rather than give up after one connection attempt, a service
+// retries each check with backoff up to a deadline, and only then begins
+// serving and consuming.
+package startup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backoff between the attempts of a check, and the time an attempt may take
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+	attemptTimeout = 5 * time.Second
+)
+
+// Check is a dependency to wait for. Probe returns nil once it answers.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// Failure is a dependency that did not answer, with its last error
+type Failure struct {
+	Name string
+	Err  error
+}
+
+// Error is returned by Wait when dependencies did not answer in time
+type Error struct {
+	Timeout  time.Duration
+	Failures []Failure
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		parts[i] = fmt.Sprintf("%s (%v)", f.Name, f.Err)
+	}
+	return fmt.Sprintf("dependencies not available after %s: %s", e.Timeout, strings.Join(parts, ", "))
+}
+
+// Wait runs the checks concurrently, retrying each until it passes, and
+// returns once all have passed. When timeout passes or ctx is done first, it
+// returns an *Error listing the checks that never passed. Every attempt is
+// logged; logger may be nil for the default logger.
+func Wait(ctx context.Context, timeout time.Duration, logger *slog.Logger, checks ...Check) error {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = waitFor(ctx, logger, check)
+		}()
+	}
+	wg.Wait()
+
+	var failures []Failure
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, Failure{Name: checks[i].Name, Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return &Error{Timeout: timeout, Failures: failures}
+	}
+	return nil
+}
+
+// waitFor retries a check with exponential backoff until it passes or ctx
+// is done, returning its last error
+func waitFor(ctx context.Context, logger *slog.Logger, check Check) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := check.Probe(attemptCtx)
+		cancel()
+		if err == nil {
+			logger.Info("dependency available", "dependency", check.Name, "attempt", attempt)
+			return nil
+		}
+		logger.Warn("dependency not available", "dependency", check.Name, "attempt", attempt, "retry_in", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
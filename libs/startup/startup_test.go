@@ -0,0 +1,144 @@
+package startup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubDependency is a dependency that comes up after a delay, counting the
+// times it is probed
+type stubDependency struct {
+	up time.Time // zero for never
+
+	mu       sync.Mutex
+	attempts int
+}
+
+// upAfter returns a dependency coming up after delay
+func upAfter(delay time.Duration) *stubDependency {
+	return &stubDependency{up: time.Now().Add(delay)}
+}
+
+func (d *stubDependency) Probe(ctx context.Context) error {
+	d.mu.Lock()
+	d.attempts++
+	d.mu.Unlock()
+	if d.up.IsZero() || time.Now().Before(d.up) {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (d *stubDependency) probes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.attempts
+}
+
+// testLogger returns a logger writing text lines to buf
+func testLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, nil))
+}
+
+func TestWaitReturnsOnceEveryDependencyIsUp(t *testing.T) {
+	postgres, kafka := upAfter(0), upAfter(700*time.Millisecond)
+	var logs bytes.Buffer
+
+	start := time.Now()
+	err := Wait(context.Background(), 10*time.Second, testLogger(&logs),
+		Check{Name: "postgres", Probe: postgres.Probe},
+		Check{Name: "kafka", Probe: kafka.Probe},
+	)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 700*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Wait returned after %s, want once kafka came up after 700ms", elapsed)
+	}
+	if postgres.probes() != 1 {
+		t.Errorf("postgres probed %d times, want once", postgres.probes())
+	}
+	// Kafka is retried after 500ms, then 1s
+	if n := kafka.probes(); n < 2 || n > 3 {
+		t.Errorf("kafka probed %d times, want 2 or 3", n)
+	}
+
+	// Every attempt is logged
+	if n := strings.Count(logs.String(), "dependency not available"); n != kafka.probes()-1 {
+		t.Errorf("%d failed attempts logged, want %d:\n%s", n, kafka.probes()-1, logs.String())
+	}
+	if n := strings.Count(logs.String(), "dependency available"); n != 2 {
+		t.Errorf("%d dependencies logged available, want 2:\n%s", n, logs.String())
+	}
+	if !strings.Contains(logs.String(), "dependency=kafka attempt=1 retry_in=500ms error=\"connection refused\"") {
+		t.Errorf("failed attempt not logged with its backoff and error:\n%s", logs.String())
+	}
+}
+
+func TestWaitListsTheDependenciesStillDown(t *testing.T) {
+	redis, kafka, postgres := upAfter(0), &stubDependency{}, &stubDependency{}
+
+	start := time.Now()
+	err := Wait(context.Background(), time.Second, testLogger(&bytes.Buffer{}),
+		Check{Name: "redis", Probe: redis.Probe},
+		Check{Name: "kafka", Probe: kafka.Probe},
+		Check{Name: "postgres", Probe: postgres.Probe},
+	)
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("Wait returned after %s, want at its 1s deadline", elapsed)
+	}
+
+	var startupErr *Error
+	if !errors.As(err, &startupErr) {
+		t.Fatalf("Wait = %v, want an *Error", err)
+	}
+	if len(startupErr.Failures) != 2 || startupErr.Failures[0].Name != "kafka" || startupErr.Failures[1].Name != "postgres" {
+		t.Errorf("failures %+v, want kafka and postgres in check order", startupErr.Failures)
+	}
+	want := "dependencies not available after 1s: kafka (connection refused), postgres (connection refused)"
+	if err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+}
+
+func TestWaitBoundsHangingAttempts(t *testing.T) {
+	hanging := Check{Name: "kafka", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	start := time.Now()
+	err := Wait(context.Background(), 300*time.Millisecond, testLogger(&bytes.Buffer{}), hanging)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Wait returned after %s, want at its 300ms deadline", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "kafka (context deadline exceeded)") {
+		t.Errorf("Wait = %v, want kafka reported", err)
+	}
+}
+
+func TestWaitStopsWithItsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := Wait(ctx, time.Minute, testLogger(&bytes.Buffer{}), Check{Name: "postgres", Probe: (&stubDependency{}).Probe})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Wait returned %s after its context was cancelled", elapsed)
+	}
+	if err == nil {
+		t.Error("Wait succeeded without the dependency")
+	}
+}
+
+func TestWaitWithoutChecks(t *testing.T) {
+	if err := Wait(context.Background(), time.Second, nil); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+}
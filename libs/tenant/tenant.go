@@ -0,0 +1,50 @@
+// Package tenant separates the transactions of the business units sharing
+// the pipeline. A transaction's tenant comes from the tenant_id claim of the
+// token that ingested it and travels with it in the tenant_id field and
+// Kafka header. The empty tenant is the default one, which tokens without a
+// tenant claim belong to.
+package tenant
+
+import "strings"
+
+// Header is the Kafka header carrying the tenant of a transaction
+const Header = "tenant_id"
+
+// Metric label values for the default tenant and for tenants outside the
+// allowed list, which keep the label bounded
+const (
+	LabelDefault = "default"
+	LabelOther   = "other"
+)
+
+// Set is the list of allowed tenants
+type Set map[string]bool
+
+// Parse reads a comma-separated list of tenants
+func Parse(list string) Set {
+	set := make(Set)
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// Allowed reports whether id is the default tenant or in the set
+func (s Set) Allowed(id string) bool {
+	return id == "" || s[id]
+}
+
+// Label returns the metric label for id: the tenant itself when allowed, or
+// LabelDefault or LabelOther
+func (s Set) Label(id string) string {
+	switch {
+	case id == "":
+		return LabelDefault
+	case s[id]:
+		return id
+	default:
+		return LabelOther
+	}
+}
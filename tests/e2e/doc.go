@@ -0,0 +1,8 @@
+// Package e2e tests the services end to end: the ingestion, processing,
+// storage and alert services run in-process, through their Run functions,
+// against Kafka, Postgres and Redis in containers. The tests are built with
+// the integration tag and need Docker. The Kafka security tests connect to a
+// broker of their own requiring SASL_SSL, as the production cluster does:
+//
+//	go test -tags=integration ./...
+package e2e
@@ -0,0 +1,156 @@
+//go:build integration
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/segmentio/kafka-go"
+)
+
+// pollInterval is how often eventually checks its condition
+const pollInterval = 100 * time.Millisecond
+
+// createTopics creates the topics on the brokers with a partition each, a
+// topic that exists already counting as created. The services consume
+// from the start of topics created ahead of them, so nothing produced
+// before a consumer group joins is missed.
+func createTopics(ctx context.Context, brokers []string, topics ...string) error {
+	configs := make([]kafka.TopicConfig, len(topics))
+	for i, topic := range topics {
+		configs[i] = kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+	var errs []error
+	for topic, err := range resp.Errors {
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			errs = append(errs, fmt.Errorf("topic %s: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// eventually checks condition until it holds, failing the test when it
+// returns an error or still does not hold after timeout. It is how the
+// tests wait on the pipeline, never by sleeping a fixed time.
+func eventually(t *testing.T, timeout time.Duration, what string, condition func() (bool, error)) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := condition()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: timed out after %s", what, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// freePort returns a TCP port free on localhost, for a service to listen on
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// loadConfig loads the configuration of a service from env, on top of the
+// environment of the test. The variables are unset again once it is
+// loaded, as the services read the same names.
+func loadConfig[C any](t *testing.T, env map[string]string, load func() (*C, error)) *C {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("invalid configuration:\n%v", err)
+	}
+	for key := range env {
+		os.Unsetenv(key)
+	}
+	return cfg
+}
+
+// signedToken returns a bearer token for user with roles, signed with secret
+// under the default key ID
+func signedToken(t *testing.T, secret, user string, roles ...string) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"user_id":    user,
+		"account_id": "acct-e2e",
+		"roles":      roles,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"iat":        time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "default"
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// slackStub is a Slack incoming webhook recording the messages posted to it
+type slackStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newSlackStub(t *testing.T) *slackStub {
+	stub := &slackStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.messages = append(stub.messages, payload.Text)
+		stub.mu.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// mentioning returns the messages posted that mention s
+func (s *slackStub) mentioning(substr string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.DeleteFunc(slices.Clone(s.messages), func(message string) bool {
+		return !strings.Contains(message, substr)
+	})
+}
@@ -0,0 +1,299 @@
+//go:build integration
+
+package e2e
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Harsh5840/real-time-tx-monitoring/libs/kafkaconn"
+	"github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The SASL_SSL broker requires TLS with a client certificate and SASL
+// authentication as alice by PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, as the
+// production cluster does
+const (
+	saslUser     = "alice"
+	saslPassword = "alice-secret"
+	// saslPort is the broker's SASL_SSL listener
+	saslPort = "9093/tcp"
+	// saslStarter is run by the container once the mapped port, which the
+	// broker advertises, is known
+	saslStarter = "/tmp/start.sh"
+)
+
+// saslBrokerConfig is the broker's server.properties, formatted with its
+// advertised address
+const saslBrokerConfig = `process.roles=broker,controller
+node.id=1
+controller.quorum.voters=1@localhost:9094
+controller.listener.names=CONTROLLER
+listeners=INTERNAL://:9092,SASL_SSL://:9093,CONTROLLER://:9094
+advertised.listeners=INTERNAL://localhost:9092,SASL_SSL://%s
+listener.security.protocol.map=INTERNAL:PLAINTEXT,SASL_SSL:SASL_SSL,CONTROLLER:PLAINTEXT
+inter.broker.listener.name=INTERNAL
+log.dirs=/tmp/kraft-logs
+offsets.topic.replication.factor=1
+transaction.state.log.replication.factor=1
+transaction.state.log.min.isr=1
+group.initial.rebalance.delay.ms=0
+ssl.keystore.type=PEM
+ssl.keystore.location=/tmp/broker.pem
+ssl.truststore.type=PEM
+ssl.truststore.location=/tmp/ca.pem
+ssl.client.auth=required
+sasl.enabled.mechanisms=PLAIN,SCRAM-SHA-256,SCRAM-SHA-512
+listener.name.sasl_ssl.plain.sasl.jaas.config=org.apache.kafka.common.security.plain.PlainLoginModule required user_alice="alice-secret";
+listener.name.sasl_ssl.scram-sha-256.sasl.jaas.config=org.apache.kafka.common.security.scram.ScramLoginModule required;
+listener.name.sasl_ssl.scram-sha-512.sasl.jaas.config=org.apache.kafka.common.security.scram.ScramLoginModule required;
+`
+
+// saslStarterScript formats the storage with alice's SCRAM credentials and
+// starts the broker
+const saslStarterScript = `#!/bin/sh
+set -e
+/opt/kafka/bin/kafka-storage.sh format -t 4L6g3nShT-eMCtK--X86sw -c /tmp/server.properties \
+	--add-scram 'SCRAM-SHA-256=[name=alice,password=alice-secret]' \
+	--add-scram 'SCRAM-SHA-512=[name=alice,password=alice-secret]'
+exec /opt/kafka/bin/kafka-server-start.sh /tmp/server.properties
+`
+
+// testCA issues the certificates of the broker and the clients
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cert := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "e2e CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, cert, cert, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of name, valid for host when it
+// is set
+func (ca *testCA) issue(name, host string, usage x509.ExtKeyUsage) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, nil, err
+	}
+	cert := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		cert.IPAddresses = []net.IP{ip}
+	} else if host != "" {
+		cert.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, cert, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// startSASLBroker starts a broker accepting only SASL_SSL clients with a
+// certificate of ca, returning its address
+func startSASLBroker(t *testing.T, ca *testCA) string {
+	t.Helper()
+	ctx := context.Background()
+	var broker string
+	container, err := testcontainers.Run(ctx, "apache/kafka:3.8.0",
+		testcontainers.WithExposedPorts(saslPort),
+		testcontainers.WithEntrypoint("sh"),
+		testcontainers.WithCmd("-c", "while [ ! -f "+saslStarter+" ]; do sleep 0.1; done; sh "+saslStarter),
+		testcontainers.WithLifecycleHooks(testcontainers.ContainerLifecycleHooks{
+			PostStarts: []testcontainers.ContainerHook{
+				// The certificate and the advertised listener need the
+				// address the port is mapped to
+				func(ctx context.Context, c testcontainers.Container) error {
+					if err := wait.ForMappedPort(saslPort).WaitUntilReady(ctx, c); err != nil {
+						return err
+					}
+					host, err := c.Host(ctx)
+					if err != nil {
+						return err
+					}
+					broker, err = c.PortEndpoint(ctx, saslPort, "")
+					if err != nil {
+						return err
+					}
+					cert, key, err := ca.issue("broker", host, x509.ExtKeyUsageServerAuth)
+					if err != nil {
+						return err
+					}
+					for path, content := range map[string][]byte{
+						"/tmp/ca.pem":            ca.pem,
+						"/tmp/broker.pem":        append(key, cert...),
+						"/tmp/server.properties": []byte(fmt.Sprintf(saslBrokerConfig, broker)),
+					} {
+						if err := c.CopyToContainer(ctx, content, path, 0o644); err != nil {
+							return err
+						}
+					}
+					if err := c.CopyToContainer(ctx, []byte(saslStarterScript), saslStarter, 0o755); err != nil {
+						return err
+					}
+					return wait.ForLog("Kafka Server started").WithStartupTimeout(2*time.Minute).WaitUntilReady(ctx, c)
+				},
+			},
+		}),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("failed to start the SASL_SSL broker: %v", err)
+	}
+	return broker
+}
+
+// clientFiles writes the CA and a client certificate of ca, returning the
+// TLS settings loading them
+func clientFiles(t *testing.T, ca *testCA) kafkaconn.Config {
+	t.Helper()
+	cert, key, err := ca.issue("e2e client", "", x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := kafkaconn.Config{
+		TLSEnabled:  true,
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+		TLSCertFile: filepath.Join(dir, "client.pem"),
+		TLSKeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+	for path, content := range map[string][]byte{cfg.TLSCAFile: ca.pem, cfg.TLSCertFile: cert, cfg.TLSKeyFile: key} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	return cfg
+}
+
+func TestKafkaSASLSSL(t *testing.T) {
+	ca := newTestCA(t)
+	broker := startSASLBroker(t, ca)
+	files := clientFiles(t, ca)
+
+	for _, mechanism := range []string{kafkaconn.MechanismPlain, kafkaconn.MechanismSCRAMSHA256, kafkaconn.MechanismSCRAMSHA512} {
+		t.Run(mechanism, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			cfg := files
+			cfg.SASLMechanism, cfg.SASLUsername, cfg.SASLPassword = mechanism, saslUser, saslPassword
+			conn, err := cfg.Connect()
+			if err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			if err := conn.Ping(ctx, []string{broker}); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+
+			// A message makes the round trip through the writer's
+			// transport and the reader's dialer
+			topic := "sasl." + mechanism
+			client := &kafka.Client{Addr: kafka.TCP(broker), Transport: conn.Transport}
+			resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+				Topics: []kafka.TopicConfig{{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}},
+			})
+			if err != nil || resp.Errors[topic] != nil {
+				t.Fatalf("CreateTopics: %v %v", err, resp)
+			}
+			writer := &kafka.Writer{Addr: kafka.TCP(broker), Topic: topic, Transport: conn.Transport, RequiredAcks: kafka.RequireAll}
+			defer writer.Close()
+			if err := writer.WriteMessages(ctx, kafka.Message{Key: []byte("acct-1"), Value: []byte(mechanism)}); err != nil {
+				t.Fatalf("WriteMessages: %v", err)
+			}
+			reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{broker}, Topic: topic, Dialer: conn.Dialer})
+			defer reader.Close()
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if string(m.Value) != mechanism {
+				t.Errorf("read %q, want %q", m.Value, mechanism)
+			}
+		})
+	}
+}
+
+func TestKafkaSASLSSLRejectsClients(t *testing.T) {
+	ca := newTestCA(t)
+	broker := startSASLBroker(t, ca)
+	files := clientFiles(t, ca)
+	withoutCert := files
+	withoutCert.TLSCertFile, withoutCert.TLSKeyFile = "", ""
+
+	tests := []struct {
+		name string
+		cfg  kafkaconn.Config
+	}{
+		{"plaintext", kafkaconn.Config{}},
+		{"TLS without SASL", files},
+		{"wrong password", kafkaconn.Config{TLSEnabled: true, TLSCAFile: files.TLSCAFile, TLSCertFile: files.TLSCertFile,
+			TLSKeyFile: files.TLSKeyFile, SASLMechanism: kafkaconn.MechanismSCRAMSHA512, SASLUsername: saslUser, SASLPassword: "guess"}},
+		{"no client certificate", kafkaconn.Config{TLSEnabled: true, TLSCAFile: files.TLSCAFile,
+			SASLMechanism: kafkaconn.MechanismPlain, SASLUsername: saslUser, SASLPassword: saslPassword}},
+		// The system pool does not trust the test CA
+		{"untrusted broker", kafkaconn.Config{TLSEnabled: true, TLSCertFile: files.TLSCertFile, TLSKeyFile: files.TLSKeyFile,
+			SASLMechanism: kafkaconn.MechanismPlain, SASLUsername: saslUser, SASLPassword: saslPassword}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.cfg.Connect()
+			if err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := conn.Ping(ctx, []string{broker}); err == nil {
+				t.Error("Ping succeeded")
+			}
+		})
+	}
+}
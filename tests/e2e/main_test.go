@@ -0,0 +1,95 @@
+//go:build integration
+
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/kafka"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// deps are the addresses of the containers, started once for the package
+var deps struct {
+	brokers      []string
+	redisAddr    string
+	storageDBURL string
+	alertDBURL   string
+}
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	kafkaContainer, err := kafka.Run(ctx, "confluentinc/confluent-local:7.5.0", kafka.WithClusterID("e2e"))
+	if err != nil {
+		log.Fatalf("failed to start kafka: %v", err)
+	}
+	deps.brokers, err = kafkaContainer.Brokers(ctx)
+	if err != nil {
+		log.Fatalf("failed to get kafka brokers: %v", err)
+	}
+
+	redisContainer, err := tcredis.Run(ctx, "redis:7-alpine")
+	if err != nil {
+		log.Fatalf("failed to start redis: %v", err)
+	}
+	deps.redisAddr, err = redisContainer.Endpoint(ctx, "")
+	if err != nil {
+		log.Fatalf("failed to get redis address: %v", err)
+	}
+
+	postgresContainer, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("transactions"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		postgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		log.Fatalf("failed to start postgres: %v", err)
+	}
+	deps.storageDBURL, err = postgresContainer.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Fatalf("failed to get postgres URL: %v", err)
+	}
+	// The alert service migrates a database of its own
+	deps.alertDBURL, err = createDatabase(deps.storageDBURL, "alerts")
+	if err != nil {
+		log.Fatalf("failed to create the alert database: %v", err)
+	}
+
+	code := m.Run()
+	for _, container := range []testcontainers.Container{kafkaContainer, redisContainer, postgresContainer} {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			log.Printf("failed to terminate container: %v", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// createDatabase creates the database name on the server of dbURL and
+// returns its URL
+func createDatabase(dbURL, name string) (string, error) {
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return "", err
+	}
+	defer admin.Close()
+	if _, err := admin.Exec(`CREATE DATABASE ` + name); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/" + name
+	return u.String(), nil
+}
@@ -0,0 +1,365 @@
+//go:build integration
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	alert "alert-service/app"
+	ingestion "ingestion-service/app"
+	processing "processing-service/app"
+	storage "storage-service/app"
+)
+
+// jwtSecret signs the tokens of every service
+const jwtSecret = "e2e-secret-at-least-32-bytes-long"
+
+// pipelineTimeout bounds how long a transaction takes from the API to the
+// database or to Slack
+const pipelineTimeout = time.Minute
+
+// pipeline is the four services running in-process
+type pipeline struct {
+	ingestionURL string
+	storageURL   string
+	readiness    []string
+
+	// exited receives the result of each service's Run
+	exited chan exit
+}
+
+type exit struct {
+	service string
+	err     error
+}
+
+// startPipeline creates the topics of the services and runs them until the
+// test ends, returning once every service is ready
+func startPipeline(t *testing.T, slackWebhook string) *pipeline {
+	t.Helper()
+	brokers := deps.brokers[0]
+	common := map[string]string{
+		"KAFKA_BROKERS":     brokers,
+		"JWT_SECRET":        jwtSecret,
+		"STARTUP_TIMEOUT":   "60",
+		"SHUTDOWN_DEADLINE": "20",
+	}
+	with := func(env map[string]string) map[string]string {
+		for key, value := range common {
+			env[key] = value
+		}
+		return env
+	}
+
+	ingestionPort := freePort(t)
+	ingestionCfg := loadConfig(t, with(map[string]string{
+		"HTTP_PORT":    ingestionPort,
+		"METRICS_PORT": freePort(t),
+		"REDIS_ADDR":   deps.redisAddr,
+	}), ingestion.LoadConfig)
+
+	// The processing service reloads the blocklist from the storage API
+	// every second
+	storagePort, storageMetrics := freePort(t), freePort(t)
+	processingMetrics := freePort(t)
+	processingCfg := loadConfig(t, with(map[string]string{
+		"METRICS_PORT":              processingMetrics,
+		"STORAGE_API_URL":           "http://localhost:" + storagePort,
+		"STORAGE_API_TOKEN":         signedToken(t, jwtSecret, "processing-service", "admin"),
+		"BLOCKLIST_REFRESH_SECONDS": "1",
+	}), processing.LoadConfig)
+
+	storageCfg := loadConfig(t, with(map[string]string{
+		"HTTP_PORT":           storagePort,
+		"METRICS_PORT":        storageMetrics,
+		"DATABASE_URL":        deps.storageDBURL,
+		"FEED_CONSUMER_GROUP": "storage-service-feed-e2e",
+	}), storage.LoadConfig)
+
+	alertMetrics := freePort(t)
+	alertCfg := loadConfig(t, with(map[string]string{
+		"HTTP_PORT":               freePort(t),
+		"METRICS_PORT":            alertMetrics,
+		"DATABASE_URL":            deps.alertDBURL,
+		"REDIS_ADDR":              deps.redisAddr,
+		"ENABLE_SLACK":            "true",
+		"SLACK_WEBHOOK":           slackWebhook,
+		"DIGEST_INTERVAL_MINUTES": "0",
+		"ALERT_ARCHIVE_DIR":       t.TempDir(),
+		"SHUTDOWN_TIMEOUT":        "10",
+	}), alert.LoadConfig)
+
+	topics := []string{
+		ingestionCfg.KafkaTopic,
+		processingCfg.InputTopic, processingCfg.OutputTopic, processingCfg.DLQTopic, processingCfg.AuditTopic,
+		storageCfg.InputTopic, storageCfg.StoredTopic, storageCfg.DLQTopic, storageCfg.AccountTopic, storageCfg.AuditTopic,
+		alertCfg.DLQTopic, alertCfg.InputDLQTopic, alertCfg.QuarantineTopic,
+	}
+	topics = append(topics, alertCfg.InputTopics...)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := createTopics(ctx, deps.brokers, topics...); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &pipeline{
+		ingestionURL: "http://localhost:" + ingestionPort,
+		storageURL:   "http://localhost:" + storagePort,
+		readiness: []string{
+			"http://localhost:" + ingestionPort + "/readyz",
+			"http://localhost:" + processingMetrics + "/readyz",
+			"http://localhost:" + storageMetrics + "/readyz",
+			"http://localhost:" + alertMetrics + "/readyz",
+		},
+		exited: make(chan exit, 4),
+	}
+	runCtx, stop := context.WithCancel(context.Background())
+	services := map[string]func(context.Context) error{
+		"ingestion-service":  func(ctx context.Context) error { return ingestion.Run(ctx, ingestionCfg) },
+		"processing-service": func(ctx context.Context) error { return processing.Run(ctx, processingCfg) },
+		"storage-service":    func(ctx context.Context) error { return storage.Run(ctx, storageCfg) },
+		"alert-service":      func(ctx context.Context) error { return alert.Run(ctx, alertCfg) },
+	}
+	for name, run := range services {
+		go func() {
+			p.exited <- exit{name, run(runCtx)}
+		}()
+	}
+	t.Cleanup(func() {
+		stop()
+		for range services {
+			select {
+			case e := <-p.exited:
+				if e.err != nil {
+					t.Errorf("%s did not shut down cleanly:\n%v", e.service, e.err)
+				}
+			case <-time.After(time.Minute):
+				t.Error("timed out waiting for the services to shut down")
+				return
+			}
+		}
+	})
+
+	p.waitReady(t)
+	return p
+}
+
+// waitReady waits until every service reports ready, failing the test as
+// soon as one exits instead
+func (p *pipeline) waitReady(t *testing.T) {
+	t.Helper()
+	for _, url := range p.readiness {
+		eventually(t, 2*time.Minute, url, func() (bool, error) {
+			select {
+			case e := <-p.exited:
+				return false, fmt.Errorf("%s exited:\n%v", e.service, e.err)
+			default:
+			}
+			resp, err := http.Get(url)
+			if err != nil {
+				return false, nil
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK, nil
+		})
+	}
+}
+
+// ingest posts a transaction to the ingestion API as a teller, returning the
+// ID it was given
+func (p *pipeline) ingest(t *testing.T, key string, txn map[string]any) string {
+	t.Helper()
+	txn["idempotency_key"] = key
+	body, err := json.Marshal(txn)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.ingestionURL+"/api/v1/transactions", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	req.Header.Set("Authorization", "Bearer "+signedToken(t, jwtSecret, "teller-1", "teller"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to post the transaction: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted || accepted.ID == "" {
+		t.Fatalf("status = %d with ID %q, want the transaction accepted", resp.StatusCode, accepted.ID)
+	}
+	return accepted.ID
+}
+
+// storedRisk is the decision on a transaction as stored
+type storedRisk struct {
+	score      float64
+	level      string
+	status     string
+	isApproved bool
+}
+
+// waitStored waits for the transaction id to be stored and returns its risk
+func waitStored(t *testing.T, db *sql.DB, id string) storedRisk {
+	t.Helper()
+	var risk storedRisk
+	eventually(t, pipelineTimeout, "transaction "+id+" stored", func() (bool, error) {
+		err := db.QueryRow(`SELECT risk_score, risk_level, status, is_approved FROM transactions WHERE id = $1`, id).
+			Scan(&risk.score, &risk.level, &risk.status, &risk.isApproved)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	return risk
+}
+
+func TestTransactionPipeline(t *testing.T) {
+	slack := newSlackStub(t)
+	p := startPipeline(t, slack.URL)
+
+	db, err := sql.Open("postgres", deps.storageDBURL)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	defer db.Close()
+
+	// Both are of one account, so are decided and alerted on in order
+	transaction := func(amount float64, merchant string) map[string]any {
+		return map[string]any{
+			"account_id": "acct-e2e",
+			"user_id":    "user-e2e",
+			"amount":     amount,
+			"currency":   "USD",
+			"type":       "purchase",
+			"category":   "shopping",
+			"merchant":   merchant,
+		}
+	}
+	lowID := p.ingest(t, "e2e-low", transaction(25, "Corner Shop"))
+	// Over the high amount threshold, with a risky merchant
+	highID := p.ingest(t, "e2e-high", transaction(15000, "Crypto Exchange"))
+
+	t.Run("low risk is stored approved", func(t *testing.T) {
+		risk := waitStored(t, db, lowID)
+		if risk.score >= 0.3 || risk.level != "low" {
+			t.Errorf("risk = %.2f %s, want low", risk.score, risk.level)
+		}
+		if !risk.isApproved || risk.status != "approved" {
+			t.Errorf("status = %s, approved %v, want approved", risk.status, risk.isApproved)
+		}
+	})
+
+	t.Run("high risk is stored with its risk", func(t *testing.T) {
+		risk := waitStored(t, db, highID)
+		if risk.score < 0.7 || (risk.level != "high" && risk.level != "critical") {
+			t.Errorf("risk = %.2f %s, want high or critical", risk.score, risk.level)
+		}
+		if risk.status == "approved" {
+			t.Errorf("status = %s, want it flagged or rejected", risk.status)
+		}
+	})
+
+	t.Run("refunds are linked to their parent", func(t *testing.T) {
+		// The refund is checked against its stored parent
+		waitStored(t, db, lowID)
+		refund := transaction(10, "Corner Shop")
+		refund["type"] = "refund"
+		refund["parent_transaction_id"] = lowID
+		refundID := p.ingest(t, "e2e-refund", refund)
+		waitStored(t, db, refundID)
+
+		req, err := http.NewRequest(http.MethodGet, p.storageURL+"/api/v1/transactions/"+lowID, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+signedToken(t, jwtSecret, "auditor-1", "auditor"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to get the parent: %v", err)
+		}
+		defer resp.Body.Close()
+		var parent struct {
+			ID      string `json:"id"`
+			Refunds []struct {
+				ID                  string `json:"id"`
+				ParentTransactionID string `json:"parent_transaction_id"`
+			} `json:"refunds"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&parent); err != nil {
+			t.Fatalf("failed to decode the parent: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || parent.ID != lowID {
+			t.Fatalf("GET %s = %d %s, want the parent", lowID, resp.StatusCode, parent.ID)
+		}
+		if len(parent.Refunds) != 1 || parent.Refunds[0].ID != refundID || parent.Refunds[0].ParentTransactionID != lowID {
+			t.Errorf("refunds = %+v, want %s", parent.Refunds, refundID)
+		}
+	})
+
+	t.Run("a merchant blocked through the API rejects its transactions", func(t *testing.T) {
+		body, err := json.Marshal(map[string]any{"type": "merchant", "value": "E2E Blocked Shop", "reason": "chargeback ring"})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, p.storageURL+"/api/v1/blocklist", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+signedToken(t, jwtSecret, "fraud-ops-1", "admin"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to add the blocklist entry: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /api/v1/blocklist = %d, want 201", resp.StatusCode)
+		}
+
+		// Transactions decided before the next refresh may still pass
+		attempt := 0
+		eventually(t, pipelineTimeout, "a transaction at the blocked merchant rejected", func() (bool, error) {
+			attempt++
+			blocked := transaction(30, "E2E Blocked Shop")
+			blocked["account_id"] = "acct-e2e-blocklist"
+			id := p.ingest(t, fmt.Sprintf("e2e-blocked-%d", attempt), blocked)
+			if risk := waitStored(t, db, id); risk.status != "rejected" {
+				return false, nil
+			}
+			var reason string
+			err := db.QueryRow(`SELECT rejection_reason FROM transactions WHERE id = $1`, id).Scan(&reason)
+			if err == nil && !strings.Contains(reason, "Blocked merchant E2E Blocked Shop: chargeback ring") {
+				err = fmt.Errorf("rejected for %q, want the blocked merchant", reason)
+			}
+			return err == nil, err
+		})
+	})
+
+	t.Run("high risk raises a Slack alert", func(t *testing.T) {
+		eventually(t, pipelineTimeout, "alert on "+highID, func() (bool, error) {
+			return len(slack.mentioning(highID)) > 0, nil
+		})
+		// The low risk transaction was handled before the alert was raised
+		if messages := slack.mentioning(lowID); len(messages) > 0 {
+			t.Errorf("low risk transaction alerted on: %q", messages)
+		}
+	})
+}